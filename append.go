@@ -12,6 +12,13 @@ type AppendOptions struct {
 	Binary bool
 	// UTF8 indicates the message was sent using UTF8 literal notation (RFC 6855).
 	UTF8 bool
+	// SizeHint is the size of the message in bytes, as stored: the size
+	// of the literal, or of the message with the header fields added by
+	// message filters. Backends that cannot get the size of a message
+	// later without reading it, such as those storing messages compressed
+	// or remotely, persist it as the RFC822.SIZE of the message. It is 0
+	// if unknown.
+	SizeHint int64
 }
 
 // AppendData represents the result of an APPEND command.
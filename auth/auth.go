@@ -19,6 +19,14 @@ type ClientMechanism interface {
 	Next(challenge []byte) (response []byte, err error)
 }
 
+// ServerVerifier is implemented by client mechanisms in which the server
+// proves that it knows the user's credentials, such as SCRAM. Clients
+// treat a successful completion of the exchange as a failure if
+// ServerVerified reports false, since the server skipped that proof.
+type ServerVerifier interface {
+	ServerVerified() bool
+}
+
 // ServerMechanism is a server-side SASL authentication mechanism.
 type ServerMechanism interface {
 	// Name returns the SASL mechanism name.
@@ -28,6 +36,17 @@ type ServerMechanism interface {
 	Next(response []byte) (challenge []byte, done bool, err error)
 }
 
+// ServerFirstMechanism is implemented by server mechanisms in which the
+// server sends the first challenge, such as LOGIN and CRAM-MD5. The first
+// call to Next receives a nil response and returns that challenge. Other
+// mechanisms expect the client's initial response in the first call, so
+// servers whose client sent none first send an empty challenge.
+type ServerFirstMechanism interface {
+	ServerMechanism
+	// ServerFirst reports whether the server sends the first challenge.
+	ServerFirst() bool
+}
+
 // Authenticator validates credentials from SASL authentication.
 type Authenticator interface {
 	// Authenticate validates the given identity and credentials.
@@ -0,0 +1,37 @@
+package auth
+
+import "crypto/tls"
+
+// Channel binding types (RFC 5929, RFC 9266).
+const (
+	ChannelBindingTLSUnique   = "tls-unique"
+	ChannelBindingTLSExporter = "tls-exporter"
+)
+
+// ChannelBindings maps channel binding types (RFC 5056), such as
+// "tls-exporter", to their data for a connection.
+type ChannelBindings map[string][]byte
+
+// ChannelBinder is implemented by mechanisms that can bind authentication
+// to the TLS connection it runs over, such as SCRAM-SHA-256-PLUS, so that
+// the exchange cannot be relayed to another server. Clients and servers
+// call SetChannelBindings with the bindings of the connection before the
+// exchange starts; it is not called on connections without TLS.
+type ChannelBinder interface {
+	SetChannelBindings(cb ChannelBindings)
+}
+
+// TLSChannelBindings returns the channel bindings of a TLS connection:
+// tls-exporter (RFC 9266) when the keying material can be exported, which
+// is the case with TLS 1.3 and with TLS 1.2 when the extended master
+// secret is used, and tls-unique (RFC 5929) before TLS 1.3.
+func TLSChannelBindings(cs tls.ConnectionState) ChannelBindings {
+	cb := make(ChannelBindings)
+	if data, err := cs.ExportKeyingMaterial("EXPORTER-Channel-Binding", nil, 32); err == nil {
+		cb[ChannelBindingTLSExporter] = data
+	}
+	if cs.Version < tls.VersionTLS13 && len(cs.TLSUnique) > 0 {
+		cb[ChannelBindingTLSUnique] = cs.TLSUnique
+	}
+	return cb
+}
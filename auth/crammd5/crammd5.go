@@ -55,6 +55,9 @@ func NewServerMechanism(authenticator auth.Authenticator) *ServerMechanism {
 // Name returns "CRAM-MD5".
 func (m *ServerMechanism) Name() string { return Name }
 
+// ServerFirst returns true: the server starts CRAM-MD5 with a challenge.
+func (m *ServerMechanism) ServerFirst() bool { return true }
+
 // Next processes the authentication exchange.
 func (m *ServerMechanism) Next(response []byte) ([]byte, bool, error) {
 	switch m.step {
@@ -55,6 +55,9 @@ func NewServerMechanism(authenticator auth.Authenticator) *ServerMechanism {
 // Name returns "LOGIN".
 func (m *ServerMechanism) Name() string { return Name }
 
+// ServerFirst returns true: the server starts LOGIN with a challenge.
+func (m *ServerMechanism) ServerFirst() bool { return true }
+
 // Next processes client responses.
 func (m *ServerMechanism) Next(response []byte) ([]byte, bool, error) {
 	switch m.step {
@@ -0,0 +1,184 @@
+package scram
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/meszmate/imap-go/auth"
+)
+
+// ClientMechanism implements SCRAM-SHA-256 and SCRAM-SHA-256-PLUS
+// authentication for clients. The client verifies the server's signature
+// at the end of the exchange, so an error is returned if the server does
+// not know the password.
+type ClientMechanism struct {
+	// Username is the authentication identity.
+	Username string
+	// Password is the password.
+	Password string
+	// AuthzID is the authorization identity (usually empty).
+	AuthzID string
+	// Plus selects SCRAM-SHA-256-PLUS, which requires channel binding.
+	Plus bool
+	// ChannelBindingType selects the channel binding type for
+	// SCRAM-SHA-256-PLUS. If empty, tls-exporter is used if available,
+	// and tls-unique otherwise.
+	ChannelBindingType string
+	// MaxIterations is the highest iteration count accepted from the
+	// server, which could otherwise make the client spend unbounded time
+	// deriving the key. If zero, DefaultMaxIterations is used.
+	MaxIterations int
+
+	bindings    auth.ChannelBindings
+	header      *gs2Header
+	cbData      []byte
+	nonce       string
+	firstBare   string
+	serverSig   []byte
+	step        int
+	serverFinal bool
+}
+
+var (
+	_ auth.ChannelBinder  = (*ClientMechanism)(nil)
+	_ auth.ServerVerifier = (*ClientMechanism)(nil)
+)
+
+// Name returns "SCRAM-SHA-256" or "SCRAM-SHA-256-PLUS".
+func (m *ClientMechanism) Name() string {
+	if m.Plus {
+		return NameSHA256Plus
+	}
+	return NameSHA256
+}
+
+// SetChannelBindings implements auth.ChannelBinder.
+func (m *ClientMechanism) SetChannelBindings(cb auth.ChannelBindings) {
+	m.bindings = cb
+}
+
+// Start returns the client-first-message.
+func (m *ClientMechanism) Start() ([]byte, error) {
+	m.header = &gs2Header{flag: "n", authzID: m.AuthzID}
+	switch {
+	case m.Plus:
+		typ := m.ChannelBindingType
+		if typ == "" {
+			typ = auth.ChannelBindingTLSExporter
+			if _, ok := m.bindings[typ]; !ok {
+				typ = auth.ChannelBindingTLSUnique
+			}
+		}
+		data, ok := m.bindings[typ]
+		if !ok {
+			return nil, fmt.Errorf("scram: channel binding %q not available", typ)
+		}
+		m.header.flag, m.header.cbType, m.cbData = "p", typ, data
+	case len(m.bindings) > 0:
+		// We could bind to the channel, but the server did not offer the
+		// PLUS variant.
+		m.header.flag = "y"
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+	m.nonce = nonce
+	m.firstBare = "n=" + escapeName(m.Username) + ",r=" + nonce
+	m.step = 1
+	return []byte(m.header.String() + m.firstBare), nil
+}
+
+// Next answers the server-first-message with the client's proof, and
+// checks the server's signature in the server-final-message.
+func (m *ClientMechanism) Next(challenge []byte) ([]byte, error) {
+	switch m.step {
+	case 1:
+		m.step++
+		return m.clientFinal(string(challenge))
+	case 2:
+		m.step++
+		return []byte{}, m.verifyServer(string(challenge))
+	default:
+		return nil, errors.New("scram: unexpected challenge")
+	}
+}
+
+// clientFinal computes the client-final-message.
+func (m *ClientMechanism) clientFinal(serverFirst string) ([]byte, error) {
+	attrs, err := parseAttrs(serverFirst, "r", "s", "i")
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(attrs["r"], m.nonce) || len(attrs["r"]) == len(m.nonce) {
+		return nil, errors.New("scram: invalid server nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil {
+		return nil, errors.New("scram: invalid salt")
+	}
+	iterations, err := strconv.Atoi(attrs["i"])
+	if err != nil || iterations < 1 {
+		return nil, errors.New("scram: invalid iteration count")
+	}
+	maxIterations := m.MaxIterations
+	if maxIterations <= 0 {
+		maxIterations = DefaultMaxIterations
+	}
+	if iterations > maxIterations {
+		return nil, fmt.Errorf("scram: iteration count %d exceeds the maximum of %d", iterations, maxIterations)
+	}
+
+	cbind := base64.StdEncoding.EncodeToString(append([]byte(m.header.String()), m.cbData...))
+	withoutProof := "c=" + cbind + ",r=" + attrs["r"]
+	authMessage := m.firstBare + "," + serverFirst + "," + withoutProof
+
+	salted := saltedPassword(m.Password, salt, iterations)
+	clientKey := hmacSum(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	proof := hmacSum(storedKey[:], authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	m.serverSig = hmacSum(hmacSum(salted, "Server Key"), authMessage)
+
+	return []byte(withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+// verifyServer checks the server-final-message.
+func (m *ClientMechanism) verifyServer(serverFinal string) error {
+	if e, ok := strings.CutPrefix(serverFinal, "e="); ok {
+		return fmt.Errorf("scram: server error: %s", e)
+	}
+	v, ok := strings.CutPrefix(serverFinal, "v=")
+	if !ok {
+		return errors.New("scram: invalid server-final-message")
+	}
+	sig, err := base64.StdEncoding.DecodeString(v)
+	if err != nil || !hmac.Equal(sig, m.serverSig) {
+		return errors.New("scram: invalid server signature")
+	}
+	m.serverFinal = true
+	return nil
+}
+
+// ServerVerified reports whether the server proved that it knows the
+// password. It is only true once the exchange has completed.
+func (m *ClientMechanism) ServerVerified() bool {
+	return m.serverFinal
+}
+
+func init() {
+	auth.DefaultRegistry.RegisterClient(NameSHA256, func() auth.ClientMechanism {
+		return &ClientMechanism{}
+	})
+	auth.DefaultRegistry.RegisterClient(NameSHA256Plus, func() auth.ClientMechanism {
+		return &ClientMechanism{Plus: true}
+	})
+}
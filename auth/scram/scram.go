@@ -0,0 +1,201 @@
+// Package scram implements the SCRAM-SHA-256 and SCRAM-SHA-256-PLUS SASL
+// mechanisms (RFC 5802, RFC 7677).
+//
+// SCRAM proves that the client knows the password without sending it, and
+// that the server knows the stored keys derived from it. The PLUS variant
+// also binds the exchange to the TLS connection (channel binding), so that
+// a server that terminates TLS cannot relay it to another server.
+//
+// Passwords are used as given: they are not normalized with SASLprep, so
+// clients and servers must agree on the form of non-ASCII passwords.
+package scram
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Mechanism names.
+const (
+	NameSHA256     = "SCRAM-SHA-256"
+	NameSHA256Plus = "SCRAM-SHA-256-PLUS"
+)
+
+// DefaultIterations is the iteration count recommended by RFC 7677.
+const DefaultIterations = 4096
+
+// DefaultMaxIterations is the highest iteration count a ClientMechanism
+// accepts from a server unless its MaxIterations is set.
+const DefaultMaxIterations = 1 << 20
+
+// Credentials are the keys a server stores for a user instead of the
+// password.
+type Credentials struct {
+	Salt       []byte
+	Iterations int
+	StoredKey  []byte
+	ServerKey  []byte
+}
+
+// NewCredentials derives the stored credentials of a password for
+// SCRAM-SHA-256. If salt is nil, a random salt is generated. If iterations
+// is zero, DefaultIterations is used.
+func NewCredentials(password string, salt []byte, iterations int) (*Credentials, error) {
+	if salt == nil {
+		salt = make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+	}
+	if iterations <= 0 {
+		iterations = DefaultIterations
+	}
+	salted := saltedPassword(password, salt, iterations)
+	clientKey := hmacSum(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	return &Credentials{
+		Salt:       salt,
+		Iterations: iterations,
+		StoredKey:  storedKey[:],
+		ServerKey:  hmacSum(salted, "Server Key"),
+	}, nil
+}
+
+// saltedPassword computes Hi(password, salt, i), which is PBKDF2 with
+// HMAC-SHA-256 and a single output block.
+func saltedPassword(password string, salt []byte, iterations int) []byte {
+	mac := hmac.New(sha256.New, []byte(password))
+	mac.Write(salt)
+	mac.Write(binary.BigEndian.AppendUint32(nil, 1))
+	u := mac.Sum(nil)
+	result := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range result {
+			result[j] ^= u[j]
+		}
+	}
+	return result
+}
+
+func hmacSum(key []byte, msg string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
+
+// newNonce returns a random printable nonce. Tests replace it to check
+// the exchange against known vectors.
+var newNonce = func() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(b), nil
+}
+
+// escapeName encodes a user name as a saslname: "=" and "," are escaped.
+func escapeName(name string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(name)
+}
+
+// unescapeName decodes a saslname.
+func unescapeName(name string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '=' {
+			b.WriteByte(name[i])
+			continue
+		}
+		switch {
+		case strings.HasPrefix(name[i:], "=3D"):
+			b.WriteByte('=')
+		case strings.HasPrefix(name[i:], "=2C"):
+			b.WriteByte(',')
+		default:
+			return "", errors.New("scram: invalid escape in user name")
+		}
+		i += 2
+	}
+	return b.String(), nil
+}
+
+// gs2Header is the GS2 header of the client's first message, such as
+// "p=tls-exporter,," or "n,a=admin,".
+type gs2Header struct {
+	flag    string // "n", "y" or "p"
+	cbType  string // set if flag is "p"
+	authzID string
+}
+
+func (h *gs2Header) String() string {
+	flag := h.flag
+	if flag == "p" {
+		flag = "p=" + h.cbType
+	}
+	authz := ""
+	if h.authzID != "" {
+		authz = "a=" + escapeName(h.authzID)
+	}
+	return flag + "," + authz + ","
+}
+
+// parseGS2Header splits the client's first message into its GS2 header
+// and the bare message that follows.
+func parseGS2Header(msg string) (*gs2Header, string, error) {
+	flag, rest, ok := strings.Cut(msg, ",")
+	if !ok {
+		return nil, "", errors.New("scram: invalid client-first-message")
+	}
+	authz, bare, ok := strings.Cut(rest, ",")
+	if !ok {
+		return nil, "", errors.New("scram: invalid client-first-message")
+	}
+
+	h := &gs2Header{flag: flag}
+	switch {
+	case flag == "n" || flag == "y":
+	case strings.HasPrefix(flag, "p="):
+		h.flag, h.cbType = "p", flag[2:]
+	default:
+		return nil, "", fmt.Errorf("scram: invalid channel binding flag %q", flag)
+	}
+	if authz != "" {
+		name, ok := strings.CutPrefix(authz, "a=")
+		if !ok {
+			return nil, "", errors.New("scram: invalid authorization identity")
+		}
+		var err error
+		if h.authzID, err = unescapeName(name); err != nil {
+			return nil, "", err
+		}
+	}
+	return h, bare, nil
+}
+
+// parseAttrs parses a message of comma-separated attributes, such as
+// "r=nonce,s=salt,i=4096", which must be given in the order of keys.
+// Extensions, such as "m=", are rejected.
+func parseAttrs(msg string, keys ...string) (map[string]string, error) {
+	parts := strings.Split(msg, ",")
+	if len(parts) != len(keys) {
+		return nil, fmt.Errorf("scram: invalid message %q", msg)
+	}
+	attrs := make(map[string]string, len(keys))
+	for i, part := range parts {
+		value, ok := strings.CutPrefix(part, keys[i]+"=")
+		if !ok {
+			return nil, fmt.Errorf("scram: expected attribute %q in %q", keys[i], msg)
+		}
+		attrs[keys[i]] = value
+	}
+	return attrs, nil
+}
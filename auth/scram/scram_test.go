@@ -0,0 +1,215 @@
+package scram
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/meszmate/imap-go/auth"
+)
+
+// testAuthenticator provides the credentials of the user "user" with the
+// password "pencil" and records authenticated identities.
+type testAuthenticator struct {
+	creds    *Credentials
+	identity string
+}
+
+func (a *testAuthenticator) Authenticate(_ context.Context, mechanism, identity string, credentials []byte) error {
+	a.identity = identity
+	return nil
+}
+
+func (a *testAuthenticator) SCRAMCredentials(mechanism, username string) (*Credentials, error) {
+	if username != "user" {
+		return nil, errors.New("unknown user")
+	}
+	return a.creds, nil
+}
+
+func newTestAuthenticator(t *testing.T) *testAuthenticator {
+	t.Helper()
+	salt, _ := base64.StdEncoding.DecodeString("W22ZaJ0SNY7soEsUEjb6gQ==")
+	creds, err := NewCredentials("pencil", salt, 4096)
+	if err != nil {
+		t.Fatalf("NewCredentials() error: %v", err)
+	}
+	return &testAuthenticator{creds: creds}
+}
+
+// exchange runs a SCRAM exchange between a client and a server mechanism.
+func exchange(client auth.ClientMechanism, server auth.ServerMechanism) error {
+	response, err := client.Start()
+	if err != nil {
+		return err
+	}
+	for {
+		challenge, done, err := server.Next(response)
+		if err != nil || done {
+			return err
+		}
+		if response, err = client.Next(challenge); err != nil {
+			return err
+		}
+	}
+}
+
+// TestRFC7677 checks the exchange of RFC 7677 §3.
+func TestRFC7677(t *testing.T) {
+	nonces := []string{"rOprNGfwEbeRWgbNEkqO", "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0"}
+	defer func(f func() (string, error)) { newNonce = f }(newNonce)
+	newNonce = func() (string, error) {
+		n := nonces[0]
+		nonces = nonces[1:]
+		return n, nil
+	}
+
+	client := &ClientMechanism{Username: "user", Password: "pencil"}
+	server := NewServerMechanism(NameSHA256, newTestAuthenticator(t))
+
+	steps := []struct{ client, server string }{
+		{"n,,n=user,r=rOprNGfwEbeRWgbNEkqO",
+			"r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"},
+		{"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+			"v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="},
+	}
+	response, err := client.Start()
+	if err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	for i, step := range steps {
+		if string(response) != step.client {
+			t.Fatalf("client message %d = %q, want %q", i+1, response, step.client)
+		}
+		challenge, done, err := server.Next(response)
+		if err != nil || done {
+			t.Fatalf("server Next() = %v, %v", done, err)
+		}
+		if string(challenge) != step.server {
+			t.Fatalf("server message %d = %q, want %q", i+1, challenge, step.server)
+		}
+		if response, err = client.Next(challenge); err != nil {
+			t.Fatalf("client Next() error: %v", err)
+		}
+	}
+	if _, done, err := server.Next(response); !done || err != nil {
+		t.Errorf("final server Next() = %v, %v, want done", done, err)
+	}
+	if !client.ServerVerified() {
+		t.Error("ServerVerified() = false")
+	}
+}
+
+func TestChannelBinding(t *testing.T) {
+	bindings := auth.ChannelBindings{auth.ChannelBindingTLSExporter: []byte("exporter")}
+
+	tests := []struct {
+		name           string
+		plus           bool
+		clientBindings auth.ChannelBindings
+		serverName     string
+		serverBindings auth.ChannelBindings
+		password       string
+		wantErr        string
+	}{
+		{"plus", true, bindings, NameSHA256Plus, bindings, "pencil", ""},
+		{"no binding", false, nil, NameSHA256, nil, "pencil", ""},
+		{"binding mismatch", true, bindings, NameSHA256Plus,
+			auth.ChannelBindings{auth.ChannelBindingTLSExporter: []byte("relayed")}, "pencil", "channel binding mismatch"},
+		{"plus without binding", false, nil, NameSHA256Plus, bindings, "pencil", "channel binding required"},
+		{"downgrade", false, bindings, NameSHA256, bindings, "pencil", "server supports channel binding"},
+		{"client binds, server cannot", false, bindings, NameSHA256, nil, "pencil", ""},
+		{"wrong password", false, nil, NameSHA256, nil, "wrong", "invalid proof"},
+		{"unsupported type", true, auth.ChannelBindings{auth.ChannelBindingTLSUnique: []byte("unique")},
+			NameSHA256Plus, bindings, "pencil", "unsupported channel binding type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &ClientMechanism{Username: "user", Password: tt.password, Plus: tt.plus}
+			if tt.clientBindings != nil {
+				client.SetChannelBindings(tt.clientBindings)
+			}
+			a := newTestAuthenticator(t)
+			server := NewServerMechanism(tt.serverName, a)
+			if tt.serverBindings != nil {
+				server.SetChannelBindings(tt.serverBindings)
+			}
+
+			err := exchange(client, server)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("exchange error: %v", err)
+				}
+				if a.identity != "user" || !client.ServerVerified() {
+					t.Errorf("identity %q, server verified %v", a.identity, client.ServerVerified())
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("exchange error = %v, want %q", err, tt.wantErr)
+			}
+			if a.identity != "" {
+				t.Errorf("authenticated as %q after a failed exchange", a.identity)
+			}
+		})
+	}
+}
+
+func TestClient_BadServerSignature(t *testing.T) {
+	client := &ClientMechanism{Username: "user", Password: "pencil"}
+	server := NewServerMechanism(NameSHA256, newTestAuthenticator(t))
+
+	response, _ := client.Start()
+	challenge, _, _ := server.Next(response)
+	response, err := client.Next(challenge)
+	if err != nil {
+		t.Fatalf("Next() error: %v", err)
+	}
+	if _, _, err := server.Next(response); err != nil {
+		t.Fatalf("server Next() error: %v", err)
+	}
+	if _, err := client.Next([]byte("v=" + base64.StdEncoding.EncodeToString(make([]byte, 32)))); err == nil {
+		t.Error("forged server signature accepted")
+	}
+}
+
+func TestClient_MaxIterations(t *testing.T) {
+	salt := base64.StdEncoding.EncodeToString([]byte("salt"))
+	tests := []struct {
+		max        int
+		iterations int
+		wantErr    bool
+	}{
+		{iterations: DefaultMaxIterations + 1, wantErr: true},
+		{iterations: 1 << 30, wantErr: true},
+		{max: 4096, iterations: 4097, wantErr: true},
+		{max: 4096, iterations: 4096},
+	}
+	for _, tt := range tests {
+		client := &ClientMechanism{Username: "user", Password: "pencil", MaxIterations: tt.max}
+		if _, err := client.Start(); err != nil {
+			t.Fatalf("Start() error: %v", err)
+		}
+		serverFirst := fmt.Sprintf("r=%sx,s=%s,i=%d", client.nonce, salt, tt.iterations)
+		if _, err := client.Next([]byte(serverFirst)); (err != nil) != tt.wantErr {
+			t.Errorf("MaxIterations %d, iterations %d: Next() error = %v, wantErr %v", tt.max, tt.iterations, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSASLName(t *testing.T) {
+	name := "a=b,c"
+	escaped := escapeName(name)
+	if escaped != "a=3Db=2Cc" {
+		t.Errorf("escapeName(%q) = %q", name, escaped)
+	}
+	if got, err := unescapeName(escaped); err != nil || got != name {
+		t.Errorf("unescapeName(%q) = %q, %v", escaped, got, err)
+	}
+	if _, err := unescapeName("a=3"); err == nil {
+		t.Error("unescapeName accepted an invalid escape")
+	}
+}
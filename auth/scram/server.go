@@ -0,0 +1,193 @@
+package scram
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/meszmate/imap-go/auth"
+)
+
+// CredentialLookup is implemented by authenticators that support SCRAM. It
+// returns the stored credentials of a user for a mechanism; an error fails
+// the authentication.
+//
+// Once the client's proof has been verified, the mechanism calls the
+// authenticator's Authenticate method with the user name and nil
+// credentials, so that it can establish the identity.
+type CredentialLookup interface {
+	SCRAMCredentials(mechanism, username string) (*Credentials, error)
+}
+
+// ServerMechanism implements SCRAM-SHA-256 and SCRAM-SHA-256-PLUS
+// authentication for servers. The authenticator must implement
+// CredentialLookup.
+type ServerMechanism struct {
+	name     string
+	auth     auth.Authenticator
+	bindings auth.ChannelBindings
+
+	step        int
+	header      *gs2Header
+	username    string
+	creds       *Credentials
+	nonce       string
+	firstBare   string
+	serverFirst string
+}
+
+var _ auth.ChannelBinder = (*ServerMechanism)(nil)
+
+// NewServerMechanism creates a new server-side mechanism. name is
+// NameSHA256 or NameSHA256Plus.
+func NewServerMechanism(name string, authenticator auth.Authenticator) *ServerMechanism {
+	return &ServerMechanism{name: name, auth: authenticator}
+}
+
+// Name returns the mechanism name.
+func (m *ServerMechanism) Name() string { return m.name }
+
+// SetChannelBindings implements auth.ChannelBinder. For SCRAM-SHA-256,
+// setting channel bindings means the server also offers the PLUS variant,
+// so a client that could bind but believes the server cannot is refused,
+// as it may be the victim of a downgrade attack (RFC 5802 §6).
+func (m *ServerMechanism) SetChannelBindings(cb auth.ChannelBindings) {
+	m.bindings = cb
+}
+
+// Next processes the client-first-message and the client-final-message.
+func (m *ServerMechanism) Next(response []byte) ([]byte, bool, error) {
+	switch m.step {
+	case 0:
+		m.step++
+		challenge, err := m.serverFirstMessage(string(response))
+		if err != nil {
+			return nil, true, err
+		}
+		return challenge, false, nil
+	case 1:
+		m.step++
+		challenge, err := m.serverFinalMessage(string(response))
+		if err != nil {
+			return nil, true, err
+		}
+		return challenge, false, nil
+	case 2:
+		// The client acknowledges the server-final-message with an empty
+		// response.
+		m.step++
+		if len(response) != 0 {
+			return nil, true, errors.New("scram: unexpected response")
+		}
+		return nil, true, nil
+	default:
+		return nil, true, errors.New("scram: mechanism already completed")
+	}
+}
+
+// serverFirstMessage parses the client-first-message and returns the
+// server-first-message.
+func (m *ServerMechanism) serverFirstMessage(clientFirst string) ([]byte, error) {
+	header, bare, err := parseGS2Header(clientFirst)
+	if err != nil {
+		return nil, err
+	}
+	plus := m.name == NameSHA256Plus
+	switch {
+	case plus && header.flag != "p":
+		return nil, errors.New("scram: channel binding required")
+	case plus:
+		if _, ok := m.bindings[header.cbType]; !ok {
+			return nil, fmt.Errorf("scram: unsupported channel binding type %q", header.cbType)
+		}
+	case header.flag == "p":
+		return nil, errors.New("scram: channel binding requires " + NameSHA256Plus)
+	case header.flag == "y" && len(m.bindings) > 0:
+		return nil, errors.New("scram: server supports channel binding")
+	}
+
+	attrs, err := parseAttrs(bare, "n", "r")
+	if err != nil {
+		return nil, err
+	}
+	if m.username, err = unescapeName(attrs["n"]); err != nil {
+		return nil, err
+	}
+	if header.authzID != "" && header.authzID != m.username {
+		return nil, errors.New("scram: authorization identity not supported")
+	}
+
+	lookup, ok := m.auth.(CredentialLookup)
+	if !ok {
+		return nil, errors.New("scram: no stored credentials")
+	}
+	if m.creds, err = lookup.SCRAMCredentials(m.name, m.username); err != nil {
+		return nil, err
+	}
+
+	serverNonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+	m.header = header
+	m.nonce = attrs["r"] + serverNonce
+	m.firstBare = bare
+	m.serverFirst = "r=" + m.nonce +
+		",s=" + base64.StdEncoding.EncodeToString(m.creds.Salt) +
+		",i=" + strconv.Itoa(m.creds.Iterations)
+	return []byte(m.serverFirst), nil
+}
+
+// serverFinalMessage verifies the client-final-message, authenticates the
+// user and returns the server-final-message.
+func (m *ServerMechanism) serverFinalMessage(clientFinal string) ([]byte, error) {
+	attrs, err := parseAttrs(clientFinal, "c", "r", "p")
+	if err != nil {
+		return nil, err
+	}
+
+	cbind := []byte(m.header.String())
+	if m.header.flag == "p" {
+		cbind = append(cbind, m.bindings[m.header.cbType]...)
+	}
+	if attrs["c"] != base64.StdEncoding.EncodeToString(cbind) {
+		return nil, errors.New("scram: channel binding mismatch")
+	}
+	if attrs["r"] != m.nonce {
+		return nil, errors.New("scram: nonce mismatch")
+	}
+	proof, err := base64.StdEncoding.DecodeString(attrs["p"])
+	if err != nil || len(proof) != sha256.Size {
+		return nil, errors.New("scram: invalid proof")
+	}
+
+	withoutProof := clientFinal[:len(clientFinal)-len(",p=")-len(attrs["p"])]
+	authMessage := m.firstBare + "," + m.serverFirst + "," + withoutProof
+	clientKey := hmacSum(m.creds.StoredKey, authMessage)
+	for i := range clientKey {
+		clientKey[i] ^= proof[i]
+	}
+	storedKey := sha256.Sum256(clientKey)
+	if !hmac.Equal(storedKey[:], m.creds.StoredKey) {
+		return nil, errors.New("scram: invalid proof")
+	}
+
+	if err := m.auth.Authenticate(context.Background(), m.name, m.username, nil); err != nil {
+		return nil, err
+	}
+	serverSig := hmacSum(m.creds.ServerKey, authMessage)
+	return []byte("v=" + base64.StdEncoding.EncodeToString(serverSig)), nil
+}
+
+func init() {
+	for _, name := range []string{NameSHA256, NameSHA256Plus} {
+		name := name
+		auth.DefaultRegistry.RegisterServer(name, func(a auth.Authenticator) auth.ServerMechanism {
+			return NewServerMechanism(name, a)
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package imap
+
+import (
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// BodyPart is a part of a message found in its body structure, together
+// with its part number.
+type BodyPart struct {
+	// Path is the part number as a list of integers, such as [1 2] for
+	// part 1.2. It is empty for the multipart body of the message itself.
+	Path []int
+	// Structure is the body structure of the part.
+	Structure *BodyStructure
+}
+
+// PartNumber returns the part number as used in section specifiers, such
+// as "1.2", or "" for the body of the message itself.
+func (p BodyPart) PartNumber() string {
+	parts := make([]string, len(p.Path))
+	for i, n := range p.Path {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Section returns the section that fetches the content of the part, such
+// as BODY[1.2] or, with peek, BODY.PEEK[1.2]. For a message/rfc822 part,
+// this is the whole embedded message. For a multipart part, it is the
+// body of the part, with its MIME boundaries.
+func (p BodyPart) Section(peek bool) *FetchItemBodySection {
+	s := &FetchItemBodySection{Part: append([]int(nil), p.Path...), Peek: peek}
+	if len(s.Part) == 0 {
+		s.Specifier = "TEXT"
+	}
+	return s
+}
+
+// MIMESection returns the section that fetches the MIME header of the
+// part, such as BODY.PEEK[1.2.MIME]. It is nil for the body of the
+// message itself, whose header is the message header.
+func (p BodyPart) MIMESection(peek bool) *FetchItemBodySection {
+	if len(p.Path) == 0 {
+		return nil
+	}
+	return &FetchItemBodySection{Part: append([]int(nil), p.Path...), Specifier: "MIME", Peek: peek}
+}
+
+// Walk calls fn for each part of the body structure, in order, with its
+// part number: the body of the message itself, the children of multipart
+// parts, and the body of messages embedded in message/rfc822 parts. If fn
+// returns false, the children of the part are skipped.
+//
+// Part numbers follow RFC 3501 §6.4.5: the body of a message that is not
+// multipart is part 1; the parts of a multipart body are numbered from 1
+// and those of nested multipart parts are numbered below the number of
+// their parent, like 2.1; the body of a message embedded in part 3 is part
+// 3.1 if it is not multipart, and has the parts 3.1, 3.2... otherwise.
+func (bs *BodyStructure) Walk(fn func(part BodyPart) bool) {
+	if bs.IsMultipart() {
+		walkPart(bs, nil, fn)
+	} else {
+		walkPart(bs, []int{1}, fn)
+	}
+}
+
+func walkPart(bs *BodyStructure, path []int, fn func(BodyPart) bool) {
+	if !fn(BodyPart{Path: append([]int(nil), path...), Structure: bs}) {
+		return
+	}
+	switch {
+	case bs.IsMultipart():
+		for i := range bs.Children {
+			walkPart(&bs.Children[i], append(path[:len(path):len(path)], i+1), fn)
+		}
+	case bs.isMessage() && bs.BodyStructure != nil:
+		// The multipart body of an embedded message has the number of the
+		// message part; a single-part body is part 1 below it.
+		embedded := bs.BodyStructure
+		if embedded.IsMultipart() {
+			for i := range embedded.Children {
+				walkPart(&embedded.Children[i], append(path[:len(path):len(path)], i+1), fn)
+			}
+		} else {
+			walkPart(embedded, append(path[:len(path):len(path)], 1), fn)
+		}
+	}
+}
+
+// Leaves returns the parts of the body structure that are not multipart,
+// in order. Parts embedded in message/rfc822 parts are not included: the
+// message/rfc822 part is a leaf, as it is usually fetched as a whole.
+func (bs *BodyStructure) Leaves() []BodyPart {
+	var leaves []BodyPart
+	bs.Walk(func(part BodyPart) bool {
+		if !part.Structure.IsMultipart() {
+			leaves = append(leaves, part)
+			return false
+		}
+		return true
+	})
+	return leaves
+}
+
+// PartFilter selects parts of a body structure for FindParts. Empty fields
+// match any part; matches are case-insensitive.
+type PartFilter struct {
+	// MediaType matches the media type of the part: a full type such as
+	// "image/png", or a top-level type such as "image" or "image/*".
+	MediaType string
+	// Disposition matches the Content-Disposition, such as "attachment"
+	// or "inline".
+	Disposition string
+	// Filename matches the file name of the part (see Filename) with the
+	// syntax of path.Match, such as "*.pdf".
+	Filename string
+}
+
+// matches reports whether bs matches the filter.
+func (f *PartFilter) matches(bs *BodyStructure) bool {
+	if f.MediaType != "" {
+		want := strings.ToLower(strings.TrimSuffix(f.MediaType, "/*"))
+		if strings.Contains(want, "/") {
+			if bs.MediaType() != want {
+				return false
+			}
+		} else if !strings.EqualFold(bs.Type, want) {
+			return false
+		}
+	}
+	if f.Disposition != "" && !strings.EqualFold(bs.Disposition, f.Disposition) {
+		return false
+	}
+	if f.Filename != "" {
+		name := bs.Filename()
+		if name == "" {
+			return false
+		}
+		if ok, _ := path.Match(strings.ToLower(f.Filename), strings.ToLower(name)); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// FindParts returns the leaf parts of the body structure (see Leaves) that
+// match the filter, in order.
+func (bs *BodyStructure) FindParts(filter PartFilter) []BodyPart {
+	var found []BodyPart
+	for _, part := range bs.Leaves() {
+		if filter.matches(part.Structure) {
+			found = append(found, part)
+		}
+	}
+	return found
+}
+
+// MediaType returns the media type of the body, such as "text/plain", in
+// lower case.
+func (bs *BodyStructure) MediaType() string {
+	return strings.ToLower(bs.Type + "/" + bs.Subtype)
+}
+
+// isMessage reports whether the body is an embedded message.
+func (bs *BodyStructure) isMessage() bool {
+	return strings.EqualFold(bs.Type, "message") &&
+		(strings.EqualFold(bs.Subtype, "rfc822") || strings.EqualFold(bs.Subtype, "global"))
+}
+
+// Filename returns the file name of the body: the filename parameter of
+// the Content-Disposition, or the name parameter of the Content-Type
+// used by older mailers. Names encoded as in RFC 2231 or RFC 2047 are
+// decoded. It returns "" if the body has no file name.
+func (bs *BodyStructure) Filename() string {
+	for _, p := range []struct {
+		params map[string]string
+		name   string
+	}{
+		{bs.DispositionParams, "filename"},
+		{bs.Params, "name"},
+	} {
+		if name := paramValue(p.params, p.name); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// paramValue returns the decoded value of a MIME parameter, looked up
+// case-insensitively, preferring the RFC 2231 extended form name*.
+func paramValue(params map[string]string, name string) string {
+	var plain string
+	for k, v := range params {
+		switch {
+		case strings.EqualFold(k, name+"*"):
+			if decoded, ok := decodeRFC2231(v); ok {
+				return decoded
+			}
+		case strings.EqualFold(k, name):
+			plain = v
+		}
+	}
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(plain); err == nil {
+		return decoded
+	}
+	return plain
+}
+
+// decodeRFC2231 decodes an extended parameter value, such as
+//
+//	utf-8''na%C3%AFve.txt
+//
+// Only the UTF-8 and US-ASCII charsets are supported.
+func decodeRFC2231(v string) (string, bool) {
+	parts := strings.SplitN(v, "'", 3)
+	if len(parts) != 3 {
+		return "", false
+	}
+	charset := strings.ToLower(parts[0])
+	if charset != "utf-8" && charset != "us-ascii" && charset != "" {
+		return "", false
+	}
+	decoded, err := url.PathUnescape(parts[2])
+	if err != nil {
+		return "", false
+	}
+	return decoded, true
+}
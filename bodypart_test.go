@@ -0,0 +1,133 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testBodyStructure is a message with a text and HTML alternative, an
+// attached PDF and a forwarded message that has a text part and an image.
+func testBodyStructure() *BodyStructure {
+	return &BodyStructure{Type: "multipart", Subtype: "mixed", Children: []BodyStructure{
+		{Type: "multipart", Subtype: "alternative", Children: []BodyStructure{
+			{Type: "text", Subtype: "plain"},
+			{Type: "text", Subtype: "html"},
+		}},
+		{Type: "application", Subtype: "pdf", Disposition: "attachment",
+			DispositionParams: map[string]string{"filename": "Report.PDF"}},
+		{Type: "message", Subtype: "rfc822", BodyStructure: &BodyStructure{
+			Type: "multipart", Subtype: "mixed", Children: []BodyStructure{
+				{Type: "text", Subtype: "plain"},
+				{Type: "image", Subtype: "png", Params: map[string]string{"name": "=?utf-8?q?caf=C3=A9.png?="}},
+			},
+		}},
+	}}
+}
+
+func TestBodyStructure_Walk(t *testing.T) {
+	var got []string
+	testBodyStructure().Walk(func(part BodyPart) bool {
+		got = append(got, part.PartNumber()+" "+part.Structure.MediaType())
+		return true
+	})
+	want := []string{
+		" multipart/mixed",
+		"1 multipart/alternative",
+		"1.1 text/plain",
+		"1.2 text/html",
+		"2 application/pdf",
+		"3 message/rfc822",
+		"3.1 text/plain",
+		"3.2 image/png",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk() visited %q, want %q", got, want)
+	}
+
+	// The body of a single-part message is part 1, as is that of a
+	// single-part embedded message below its part.
+	single := &BodyStructure{Type: "TEXT", Subtype: "PLAIN"}
+	if leaves := single.Leaves(); len(leaves) != 1 || leaves[0].Section(true).String() != "BODY.PEEK[1]" {
+		t.Errorf("Leaves() of a single-part message = %+v", leaves)
+	}
+	forward := &BodyStructure{Type: "message", Subtype: "rfc822", BodyStructure: single}
+	got = nil
+	forward.Walk(func(part BodyPart) bool {
+		got = append(got, part.PartNumber())
+		return true
+	})
+	if want := []string{"1", "1.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk() of an embedded single-part message visited %q, want %q", got, want)
+	}
+}
+
+func TestBodyStructure_Leaves(t *testing.T) {
+	var got []string
+	for _, part := range testBodyStructure().Leaves() {
+		got = append(got, part.Section(false).String())
+	}
+	want := []string{"BODY[1.1]", "BODY[1.2]", "BODY[2]", "BODY[3]"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Leaves() sections = %q, want %q", got, want)
+	}
+}
+
+func TestBodyStructure_FindParts(t *testing.T) {
+	bs := testBodyStructure()
+	tests := []struct {
+		filter PartFilter
+		want   []string
+	}{
+		{PartFilter{MediaType: "TEXT/plain"}, []string{"1.1"}},
+		{PartFilter{MediaType: "text/*"}, []string{"1.1", "1.2"}},
+		{PartFilter{MediaType: "message"}, []string{"3"}},
+		{PartFilter{Disposition: "Attachment"}, []string{"2"}},
+		{PartFilter{Filename: "*.pdf"}, []string{"2"}},
+		{PartFilter{MediaType: "text/plain", Disposition: "attachment"}, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, part := range bs.FindParts(tt.filter) {
+			got = append(got, part.PartNumber())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("FindParts(%+v) = %q, want %q", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestBodyPart_Sections(t *testing.T) {
+	part := BodyPart{Path: []int{3, 2}}
+	if s := part.Section(true).String(); s != "BODY.PEEK[3.2]" {
+		t.Errorf("Section() = %q", s)
+	}
+	if s := part.MIMESection(false).String(); s != "BODY[3.2.MIME]" {
+		t.Errorf("MIMESection() = %q", s)
+	}
+	root := BodyPart{}
+	if s := root.Section(false).String(); s != "BODY[TEXT]" {
+		t.Errorf("Section() of the message body = %q", s)
+	}
+	if root.MIMESection(false) != nil {
+		t.Error("MIMESection() of the message body is not nil")
+	}
+}
+
+func TestBodyStructure_Filename(t *testing.T) {
+	tests := []struct {
+		bs   BodyStructure
+		want string
+	}{
+		{BodyStructure{DispositionParams: map[string]string{"FILENAME": "a.txt"}, Params: map[string]string{"name": "b.txt"}}, "a.txt"},
+		{BodyStructure{Params: map[string]string{"name": "b.txt"}}, "b.txt"},
+		{BodyStructure{Params: map[string]string{"name": "=?utf-8?q?caf=C3=A9.png?="}}, "café.png"},
+		{BodyStructure{DispositionParams: map[string]string{"filename*": "utf-8''na%C3%AFve.txt", "filename": "naive.txt"}}, "naïve.txt"},
+		{BodyStructure{DispositionParams: map[string]string{"filename*": "iso-8859-2''x%E9.txt", "filename": "x.txt"}}, "x.txt"},
+		{BodyStructure{}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.bs.Filename(); got != tt.want {
+			t.Errorf("Filename() of %+v = %q, want %q", tt.bs, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package imap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseFetchItemBodySection parses a BODY[] fetch item as sent in a FETCH
+// command, such as "BODY.PEEK[1.2.HEADER.FIELDS (From Subject)]<0.1024>",
+// or as returned in a FETCH response, such as "BODY[1.2.TEXT]<0>", whose
+// partial range only has the origin. The item name is matched
+// case-insensitively and the specifier is returned in upper case.
+func ParseFetchItemBodySection(item string) (*FetchItemBodySection, error) {
+	name, rest, ok := strings.Cut(item, "[")
+	section := &FetchItemBodySection{}
+	switch strings.ToUpper(name) {
+	case "BODY":
+	case "BODY.PEEK":
+		section.Peek = true
+	default:
+		ok = false
+	}
+	if !ok {
+		return nil, fmt.Errorf("imap: invalid body section %q", item)
+	}
+
+	end := sectionEnd(rest)
+	if end < 0 {
+		return nil, fmt.Errorf("imap: missing ] in body section %q", item)
+	}
+	if err := section.parseSpec(rest[:end]); err != nil {
+		return nil, err
+	}
+
+	if partial := rest[end+1:]; partial != "" {
+		p, err := ParseSectionPartial(partial)
+		if err != nil {
+			return nil, err
+		}
+		section.Partial = p
+	}
+	return section, nil
+}
+
+// sectionEnd returns the index of the ] closing a section specifier, which
+// may contain quoted header field names, or -1.
+func sectionEnd(s string) int {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == ']' && !quoted:
+			return i
+		}
+	}
+	return -1
+}
+
+// parseSpec parses the section-spec of RFC 9051 §6.4.5, the text between
+// the brackets.
+func (s *FetchItemBodySection) parseSpec(spec string) error {
+	s.Part, s.Specifier, s.Fields, s.NotFields = nil, "", nil, false
+
+	text, fieldList, hasFields := strings.Cut(spec, " ")
+	for text != "" {
+		head, tail, _ := strings.Cut(text, ".")
+		if head == "" || head[0] < '0' || head[0] > '9' {
+			break
+		}
+		n, err := strconv.Atoi(head)
+		if err != nil || n < 1 {
+			return fmt.Errorf("imap: invalid part number %q in section %q", head, spec)
+		}
+		s.Part = append(s.Part, n)
+		text = tail
+	}
+
+	s.Specifier = strings.ToUpper(text)
+	switch s.Specifier {
+	case "", "HEADER", "TEXT":
+	case "MIME":
+		if len(s.Part) == 0 {
+			return fmt.Errorf("imap: MIME section without a part number")
+		}
+	case "HEADER.FIELDS", "HEADER.FIELDS.NOT":
+		s.NotFields = s.Specifier == "HEADER.FIELDS.NOT"
+		if !hasFields {
+			return fmt.Errorf("imap: missing header field list in section %q", spec)
+		}
+		fields, err := parseFieldList(fieldList)
+		if err != nil {
+			return err
+		}
+		s.Fields = fields
+		return nil
+	default:
+		return fmt.Errorf("imap: invalid section %q", spec)
+	}
+	if hasFields {
+		return fmt.Errorf("imap: unexpected data in section %q", spec)
+	}
+	return nil
+}
+
+// parseFieldList parses a parenthesized list of header field names, which
+// are atoms or quoted strings.
+func parseFieldList(s string) ([]string, error) {
+	if len(s) < 2 || s[0] != '(' || s[len(s)-1] != ')' {
+		return nil, fmt.Errorf("imap: invalid header field list %q", s)
+	}
+	s = s[1 : len(s)-1]
+
+	var fields []string
+	for s = strings.TrimLeft(s, " "); s != ""; s = strings.TrimLeft(s, " ") {
+		if s[0] != '"' {
+			field, rest, _ := strings.Cut(s, " ")
+			fields = append(fields, field)
+			s = rest
+			continue
+		}
+		var b strings.Builder
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+			}
+			b.WriteByte(s[i])
+		}
+		if i == len(s) {
+			return nil, fmt.Errorf("imap: unterminated quoted string in header field list")
+		}
+		fields = append(fields, b.String())
+		s = s[i+1:]
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("imap: empty header field list")
+	}
+	return fields, nil
+}
+
+// ParseSectionPartial parses a partial range such as "<0.1024>". The
+// origin-only form "<0>" of FETCH responses gives a Count of 0.
+func ParseSectionPartial(s string) (*SectionPartial, error) {
+	if len(s) < 3 || s[0] != '<' || s[len(s)-1] != '>' {
+		return nil, fmt.Errorf("imap: invalid partial range %q", s)
+	}
+	offset, count, hasCount := strings.Cut(s[1:len(s)-1], ".")
+	p := &SectionPartial{}
+	var err error
+	if p.Offset, err = strconv.ParseInt(offset, 10, 64); err != nil || p.Offset < 0 {
+		return nil, fmt.Errorf("imap: invalid partial range %q", s)
+	}
+	if hasCount {
+		if p.Count, err = strconv.ParseInt(count, 10, 64); err != nil || p.Count < 1 {
+			return nil, fmt.Errorf("imap: invalid partial range %q", s)
+		}
+	}
+	return p, nil
+}
+
+// SectionSpec returns the section specifier between the brackets, such as
+// "1.2.HEADER.FIELDS (From Subject)".
+func (s *FetchItemBodySection) SectionSpec() string {
+	var b strings.Builder
+	for i, n := range s.Part {
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(strconv.Itoa(n))
+	}
+
+	specifier := strings.ToUpper(s.Specifier)
+	if specifier == "HEADER.FIELDS" && s.NotFields {
+		specifier = "HEADER.FIELDS.NOT"
+	}
+	if specifier != "" {
+		if len(s.Part) > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(specifier)
+	}
+
+	if specifier == "HEADER.FIELDS" || specifier == "HEADER.FIELDS.NOT" {
+		b.WriteString(" (")
+		for i, f := range s.Fields {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			writeFieldName(&b, f)
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+// String returns the fetch item as sent in a FETCH command, such as
+// "BODY.PEEK[1.TEXT]<0.1024>".
+func (s *FetchItemBodySection) String() string {
+	name := "BODY"
+	if s.Peek {
+		name = "BODY.PEEK"
+	}
+	name += "[" + s.SectionSpec() + "]"
+	switch {
+	case s.Partial == nil:
+	case s.Partial.Count == 0:
+		// Parsed from a response, which only has the origin.
+		name += fmt.Sprintf("<%d>", s.Partial.Offset)
+	default:
+		name += fmt.Sprintf("<%d.%d>", s.Partial.Offset, s.Partial.Count)
+	}
+	return name
+}
+
+// ResponseName returns the name of the item in a FETCH response, such as
+// "BODY[1.TEXT]<0>": BODY.PEEK is answered with BODY and only the origin
+// of a partial range is returned (RFC 9051 §7.5.2).
+func (s *FetchItemBodySection) ResponseName() string {
+	name := "BODY[" + s.SectionSpec() + "]"
+	if s.Partial != nil {
+		name += "<" + strconv.FormatInt(s.Partial.Offset, 10) + ">"
+	}
+	return name
+}
+
+// writeFieldName writes a header field name as an atom, or as a quoted
+// string if it contains characters that atoms cannot.
+func writeFieldName(b *strings.Builder, name string) {
+	atom := name != ""
+	for i := 0; i < len(name) && atom; i++ {
+		c := name[i]
+		atom = c > ' ' && c < 0x7f && !strings.ContainsRune(`(){%*"\]`, rune(c))
+	}
+	if atom {
+		b.WriteString(name)
+		return
+	}
+	b.WriteByte('"')
+	for i := 0; i < len(name); i++ {
+		if name[i] == '"' || name[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(name[i])
+	}
+	b.WriteByte('"')
+}
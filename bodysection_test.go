@@ -0,0 +1,67 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFetchItemBodySection(t *testing.T) {
+	tests := []struct {
+		in   string
+		want FetchItemBodySection
+		str  string
+		resp string
+	}{
+		{"BODY[]", FetchItemBodySection{}, "BODY[]", "BODY[]"},
+		{"body.peek[text]", FetchItemBodySection{Specifier: "TEXT", Peek: true}, "BODY.PEEK[TEXT]", "BODY[TEXT]"},
+		{"BODY[1.2]", FetchItemBodySection{Part: []int{1, 2}}, "BODY[1.2]", "BODY[1.2]"},
+		{"BODY[3.MIME]<0>", FetchItemBodySection{Part: []int{3}, Specifier: "MIME", Partial: &SectionPartial{}}, "BODY[3.MIME]<0>", "BODY[3.MIME]<0>"},
+		{
+			"BODY.PEEK[1.2.HEADER.FIELDS (A \"B C\")]<0.1024>",
+			FetchItemBodySection{Part: []int{1, 2}, Specifier: "HEADER.FIELDS", Fields: []string{"A", "B C"}, Peek: true, Partial: &SectionPartial{Count: 1024}},
+			"BODY.PEEK[1.2.HEADER.FIELDS (A \"B C\")]<0.1024>",
+			"BODY[1.2.HEADER.FIELDS (A \"B C\")]<0>",
+		},
+		{
+			"BODY[HEADER.FIELDS.NOT (Received)]<10.5>",
+			FetchItemBodySection{Specifier: "HEADER.FIELDS.NOT", Fields: []string{"Received"}, NotFields: true, Partial: &SectionPartial{Offset: 10, Count: 5}},
+			"BODY[HEADER.FIELDS.NOT (Received)]<10.5>",
+			"BODY[HEADER.FIELDS.NOT (Received)]<10>",
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseFetchItemBodySection(tt.in)
+		if err != nil {
+			t.Errorf("ParseFetchItemBodySection(%q) error: %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("ParseFetchItemBodySection(%q) = %+v, want %+v", tt.in, *got, tt.want)
+		}
+		if s := got.String(); s != tt.str {
+			t.Errorf("String() = %q, want %q", s, tt.str)
+		}
+		if s := got.ResponseName(); s != tt.resp {
+			t.Errorf("ResponseName() = %q, want %q", s, tt.resp)
+		}
+	}
+}
+
+func TestParseFetchItemBodySection_Invalid(t *testing.T) {
+	for _, in := range []string{
+		"BINARY[1]",
+		"BODY[1",
+		"BODY[0]",
+		"BODY[MIME]",
+		"BODY[FOO]",
+		"BODY[HEADER.FIELDS]",
+		"BODY[HEADER.FIELDS ()]",
+		"BODY[TEXT (A)]",
+		"BODY[]<1.0>",
+		"BODY[]<x>",
+	} {
+		if _, err := ParseFetchItemBodySection(in); err == nil {
+			t.Errorf("ParseFetchItemBodySection(%q) succeeded", in)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package imap
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+)
+
+// errMalformedBodyStructure is wrapped by the errors of ParseBodyStructure.
+var errMalformedBodyStructure = errors.New("imap: malformed body structure")
+
+// ParseBodyStructure parses the value of a BODYSTRUCTURE or BODY data item
+// of a FETCH response (RFC 3501 section 7.4.2), such as
+// ("TEXT" "PLAIN" ("CHARSET" "UTF-8") NIL NIL "7BIT" 12 1). Strings may be
+// quoted or literals including their {N} header and CRLF, as read by the
+// client. Names and values are kept as the server sent them; the methods
+// of BodyStructure compare them case-insensitively.
+func ParseBodyStructure(s string) (*BodyStructure, error) {
+	v, rest, err := parseBodyValue(s)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(rest) != "" {
+		return nil, fmt.Errorf("%w: trailing data %q", errMalformedBodyStructure, rest)
+	}
+	bs, err := bodyStructureFromValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return bs, nil
+}
+
+// Structure returns the body structure of the message: BodyStructure, or
+// if it is nil the parsed RawBodyStructure, which is then stored in
+// BodyStructure. It returns nil if neither was fetched.
+func (m *FetchMessageBuffer) Structure() (*BodyStructure, error) {
+	if m.BodyStructure != nil || m.RawBodyStructure == "" {
+		return m.BodyStructure, nil
+	}
+	bs, err := ParseBodyStructure(m.RawBodyStructure)
+	if err != nil {
+		return nil, err
+	}
+	m.BodyStructure = bs
+	m.RawBodyStructure = ""
+	return bs, nil
+}
+
+// bodyValue is a value of the body structure grammar: a list, a string
+// or atom, or NIL.
+type bodyValue struct {
+	list   []bodyValue
+	isList bool
+	text   string
+	isNil  bool
+}
+
+// parseBodyValue parses the value at the start of s.
+func parseBodyValue(s string) (bodyValue, string, error) {
+	s = strings.TrimLeft(s, " ")
+	if s == "" {
+		return bodyValue{}, "", fmt.Errorf("%w: unexpected end", errMalformedBodyStructure)
+	}
+	switch c := s[0]; {
+	case c == '(':
+		v := bodyValue{isList: true}
+		s = s[1:]
+		for {
+			s = strings.TrimLeft(s, " ")
+			if s == "" {
+				return bodyValue{}, "", fmt.Errorf("%w: unterminated list", errMalformedBodyStructure)
+			}
+			if s[0] == ')' {
+				return v, s[1:], nil
+			}
+			elem, rest, err := parseBodyValue(s)
+			if err != nil {
+				return bodyValue{}, "", err
+			}
+			v.list = append(v.list, elem)
+			s = rest
+		}
+	case c == '"':
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				if i+1 < len(s) {
+					i++
+					b.WriteByte(s[i])
+				}
+			case '"':
+				return bodyValue{text: b.String()}, s[i+1:], nil
+			default:
+				b.WriteByte(s[i])
+			}
+		}
+		return bodyValue{}, "", fmt.Errorf("%w: unterminated string", errMalformedBodyStructure)
+	case c == '{' || strings.HasPrefix(s, "~{"):
+		s = strings.TrimPrefix(s, "~")
+		end := strings.Index(s, "}\r\n")
+		if end < 0 {
+			return bodyValue{}, "", fmt.Errorf("%w: bad literal", errMalformedBodyStructure)
+		}
+		size, err := strconv.Atoi(strings.TrimSuffix(s[1:end], "+"))
+		start := end + 3
+		if err != nil || size < 0 || start+size > len(s) {
+			return bodyValue{}, "", fmt.Errorf("%w: bad literal", errMalformedBodyStructure)
+		}
+		return bodyValue{text: s[start : start+size]}, s[start+size:], nil
+	default:
+		end := strings.IndexAny(s, " ()")
+		if end < 0 {
+			end = len(s)
+		}
+		if end == 0 {
+			return bodyValue{}, "", fmt.Errorf("%w: unexpected %q", errMalformedBodyStructure, s[0])
+		}
+		atom := s[:end]
+		if strings.EqualFold(atom, "NIL") {
+			return bodyValue{isNil: true}, s[end:], nil
+		}
+		return bodyValue{text: atom}, s[end:], nil
+	}
+}
+
+// bodyStructureFromValue converts a parsed body to a BodyStructure.
+func bodyStructureFromValue(v bodyValue) (*BodyStructure, error) {
+	if !v.isList || len(v.list) == 0 {
+		return nil, fmt.Errorf("%w: body is not a list", errMalformedBodyStructure)
+	}
+	bs := &BodyStructure{}
+
+	if v.list[0].isList {
+		// Multipart: the parts, the subtype and the extension data.
+		i := 0
+		for ; i < len(v.list) && v.list[i].isList; i++ {
+			child, err := bodyStructureFromValue(v.list[i])
+			if err != nil {
+				return nil, err
+			}
+			bs.Children = append(bs.Children, *child)
+		}
+		bs.Type = "multipart"
+		if i < len(v.list) {
+			bs.Subtype = v.list[i].text
+			i++
+		}
+		ext := v.list[i:]
+		if len(ext) > 0 {
+			bs.Params = bodyParams(ext[0])
+			bodyExtension(bs, ext[1:])
+		}
+		return bs, nil
+	}
+
+	if len(v.list) < 7 {
+		return nil, fmt.Errorf("%w: %d fields in a body part", errMalformedBodyStructure, len(v.list))
+	}
+	bs.Type = v.list[0].text
+	bs.Subtype = v.list[1].text
+	bs.Params = bodyParams(v.list[2])
+	bs.ID = v.list[3].text
+	bs.Description = v.list[4].text
+	bs.Encoding = v.list[5].text
+	bs.Size = bodyNumber(v.list[6])
+	rest := v.list[7:]
+
+	switch {
+	case bs.isMessage() && len(rest) >= 3:
+		bs.Envelope = envelopeFromValue(rest[0])
+		inner, err := bodyStructureFromValue(rest[1])
+		if err != nil {
+			return nil, err
+		}
+		bs.BodyStructure = inner
+		bs.Lines = bodyNumber(rest[2])
+		rest = rest[3:]
+	case strings.EqualFold(bs.Type, "text") && len(rest) >= 1:
+		bs.Lines = bodyNumber(rest[0])
+		rest = rest[1:]
+	}
+	if len(rest) > 0 {
+		bs.MD5 = rest[0].text
+		bodyExtension(bs, rest[1:])
+	}
+	return bs, nil
+}
+
+// bodyExtension sets the disposition, language and location of bs from
+// the extension data following the parameters or MD5. Further extension
+// data is ignored.
+func bodyExtension(bs *BodyStructure, ext []bodyValue) {
+	if len(ext) > 0 && ext[0].isList && len(ext[0].list) > 0 {
+		bs.Disposition = ext[0].list[0].text
+		if len(ext[0].list) > 1 {
+			bs.DispositionParams = bodyParams(ext[0].list[1])
+		}
+	}
+	if len(ext) > 1 {
+		switch lang := ext[1]; {
+		case lang.isList:
+			for _, l := range lang.list {
+				bs.Language = append(bs.Language, l.text)
+			}
+		case !lang.isNil:
+			bs.Language = []string{lang.text}
+		}
+	}
+	if len(ext) > 2 {
+		bs.Location = ext[2].text
+	}
+}
+
+// bodyParams converts a body-fld-param list of names and values.
+func bodyParams(v bodyValue) map[string]string {
+	if !v.isList || len(v.list) < 2 {
+		return nil
+	}
+	params := make(map[string]string, len(v.list)/2)
+	for i := 0; i+1 < len(v.list); i += 2 {
+		params[v.list[i].text] = v.list[i+1].text
+	}
+	return params
+}
+
+func bodyNumber(v bodyValue) uint32 {
+	n, _ := strconv.ParseUint(v.text, 10, 32)
+	return uint32(n)
+}
+
+// envelopeFromValue converts the envelope of a message/rfc822 part.
+func envelopeFromValue(v bodyValue) *Envelope {
+	if !v.isList || len(v.list) < 10 {
+		return nil
+	}
+	f := v.list
+	env := &Envelope{
+		Subject:   f[1].text,
+		From:      addressList(f[2]),
+		Sender:    addressList(f[3]),
+		ReplyTo:   addressList(f[4]),
+		To:        addressList(f[5]),
+		Cc:        addressList(f[6]),
+		Bcc:       addressList(f[7]),
+		InReplyTo: f[8].text,
+		MessageID: f[9].text,
+	}
+	if date, err := mail.ParseDate(f[0].text); err == nil {
+		env.Date = date
+	}
+	return env
+}
+
+// addressList converts an envelope address list. The route of each
+// address is ignored.
+func addressList(v bodyValue) []*Address {
+	var addrs []*Address
+	for _, a := range v.list {
+		if !a.isList || len(a.list) < 4 {
+			continue
+		}
+		addrs = append(addrs, &Address{Name: a.list[0].text, Mailbox: a.list[2].text, Host: a.list[3].text})
+	}
+	return addrs
+}
@@ -0,0 +1,57 @@
+package imap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBodyStructure(t *testing.T) {
+	s := `(("text" "plain" ("charset" "utf-8") NIL NIL "quoted-printable" 12 1 NIL NIL NIL NIL)` +
+		`("application" "pdf" ("name" {7}` + "\r\n" + `a (1).p) NIL NIL "base64" 300 NIL ("attachment" ("filename" "a (1).pdf")) NIL NIL)` +
+		`("message" "rfc822" NIL NIL NIL "7bit" 40 ("Tue, 5 Mar 2024 10:30:00 +0000" "Fwd: \"hi\"" (("Alice" NIL "alice" "example.org")) NIL NIL NIL NIL NIL NIL "<id@example.org>")` +
+		` ("text" "plain" NIL NIL NIL "7bit" 10 1) 3)` +
+		` "mixed" ("boundary" "b1") NIL ("en" "de") NIL)`
+	bs, err := ParseBodyStructure(s)
+	if err != nil {
+		t.Fatalf("ParseBodyStructure() error: %v", err)
+	}
+	if bs.MediaType() != "multipart/mixed" || len(bs.Children) != 3 || bs.Params["boundary"] != "b1" || len(bs.Language) != 2 {
+		t.Fatalf("ParseBodyStructure() = %+v", bs)
+	}
+	text := bs.Children[0]
+	if text.Params["charset"] != "utf-8" || text.Encoding != "quoted-printable" || text.Size != 12 || text.Lines != 1 {
+		t.Errorf("text part = %+v", text)
+	}
+	if pdf := bs.Children[1]; pdf.Params["name"] != "a (1).p" || pdf.Filename() != "a (1).pdf" || pdf.Disposition != "attachment" {
+		t.Errorf("pdf part = %+v", pdf)
+	}
+	msg := bs.Children[2]
+	env := msg.Envelope
+	if env == nil || env.Subject != `Fwd: "hi"` || len(env.From) != 1 || env.From[0].String() != "Alice <alice@example.org>" ||
+		!env.Date.Equal(time.Date(2024, 3, 5, 10, 30, 0, 0, time.UTC)) || env.MessageID != "<id@example.org>" {
+		t.Errorf("envelope = %+v", env)
+	}
+	if msg.BodyStructure == nil || msg.BodyStructure.MediaType() != "text/plain" || msg.Lines != 3 {
+		t.Errorf("message part = %+v", msg)
+	}
+
+	for _, bad := range []string{"", `("text" "plain")`, `("text" "plain" NIL NIL NIL "7bit" 1`, `NIL`, `("text" "plain" NIL NIL NIL "7bit" 1) x`} {
+		if _, err := ParseBodyStructure(bad); err == nil {
+			t.Errorf("ParseBodyStructure(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestFetchMessageBuffer_Structure(t *testing.T) {
+	msg := &FetchMessageBuffer{RawBodyStructure: `("TEXT" "PLAIN" NIL NIL NIL "7BIT" 3 1)`}
+	bs, err := msg.Structure()
+	if err != nil || bs == nil || bs.MediaType() != "text/plain" {
+		t.Fatalf("Structure() = %+v, %v", bs, err)
+	}
+	if msg.BodyStructure != bs || msg.RawBodyStructure != "" {
+		t.Errorf("Structure() did not keep the parsed structure")
+	}
+	if bs, err := (&FetchMessageBuffer{}).Structure(); bs != nil || err != nil {
+		t.Errorf("Structure() without body structure = %v, %v", bs, err)
+	}
+}
@@ -85,6 +85,10 @@ const (
 	// RFC 5255 - LANGUAGE
 	CapLanguage Cap = "LANGUAGE"
 
+	// RFC 5255 - I18NLEVEL (COMPARATOR command at level 2)
+	CapI18NLevel1 Cap = "I18NLEVEL=1"
+	CapI18NLevel2 Cap = "I18NLEVEL=2"
+
 	// RFC 5256 - SORT
 	CapSort Cap = "SORT"
 
@@ -261,14 +265,10 @@ func (cs *CapSet) Len() int {
 	return len(cs.caps)
 }
 
-// String returns the capabilities as a space-separated string.
+// String returns the capabilities as a space-separated string, in the
+// order of SortCaps.
 func (cs *CapSet) String() string {
-	caps := cs.All()
-	strs := make([]string, len(caps))
-	for i, c := range caps {
-		strs[i] = string(c)
-	}
-	return strings.Join(strs, " ")
+	return FormatCaps(cs.All())
 }
 
 // Clone returns a copy of the capability set.
@@ -0,0 +1,152 @@
+package imap
+
+import (
+	"sort"
+	"strings"
+)
+
+// IsVersion reports whether the capability names an IMAP protocol version,
+// such as IMAP4rev1 or IMAP4rev2.
+func (c Cap) IsVersion() bool {
+	return strings.HasPrefix(strings.ToUpper(string(c)), "IMAP4")
+}
+
+// AuthMechanism returns the SASL mechanism of an AUTH= capability, in
+// upper case, and reports whether c is one.
+func (c Cap) AuthMechanism() (string, bool) {
+	if len(c) < 5 || !strings.EqualFold(string(c[:5]), "AUTH=") {
+		return "", false
+	}
+	return strings.ToUpper(string(c[5:])), true
+}
+
+// IsVendor reports whether the capability is a vendor extension, whose
+// name starts with "X" by convention (RFC 9051 §7.2.2), such as X-GM-EXT-1
+// or XLIST.
+func (c Cap) IsVendor() bool {
+	return len(c) > 0 && (c[0] == 'X' || c[0] == 'x')
+}
+
+// capClass returns the position of a capability's class in the order used
+// by SortCaps.
+func capClass(c Cap) int {
+	switch {
+	case c.IsVersion():
+		return 0
+	case strings.HasPrefix(strings.ToUpper(string(c)), "AUTH="):
+		return 2
+	case c.IsVendor():
+		return 3
+	default:
+		return 1
+	}
+}
+
+// ParseCapabilities parses the capability list of a CAPABILITY response or
+// response code, for example "IMAP4rev1 IDLE AUTH=plain X-GM-EXT-1". The
+// mechanism names of AUTH= capabilities are converted to upper case, as
+// CapSet.HasAuth expects.
+func ParseCapabilities(s string) *CapSet {
+	fields := strings.Fields(s)
+	cs := &CapSet{caps: make(map[Cap]bool, len(fields))}
+	for _, f := range fields {
+		c := Cap(f)
+		if mech, ok := c.AuthMechanism(); ok {
+			c = Cap("AUTH=" + mech)
+		}
+		cs.caps[c] = true
+	}
+	return cs
+}
+
+// SortCaps sorts capabilities into the order used when formatting them:
+// protocol versions first, then the other standard capabilities, then
+// AUTH= capabilities and finally vendor extensions, each group sorted by
+// name. Names are compared case-insensitively, and names that differ only
+// in case are sorted upper case first, so that the order does not depend
+// on the order of caps.
+func SortCaps(caps []Cap) {
+	sort.Slice(caps, func(i, j int) bool {
+		ci, cj := capClass(caps[i]), capClass(caps[j])
+		if ci != cj {
+			return ci < cj
+		}
+		ui, uj := strings.ToUpper(string(caps[i])), strings.ToUpper(string(caps[j]))
+		if ui != uj {
+			return ui < uj
+		}
+		return caps[i] < caps[j]
+	})
+}
+
+// DedupCaps returns caps sorted with SortCaps and without duplicates.
+// Capability names are case-insensitive, so names that differ only in
+// case are duplicates: the first one in the order of SortCaps, the upper
+// case one, is kept. The mechanism names of AUTH= capabilities are
+// converted to upper case, as in ParseCapabilities. caps is not modified.
+func DedupCaps(caps []Cap) []Cap {
+	sorted := make([]Cap, len(caps))
+	for i, c := range caps {
+		if mech, ok := c.AuthMechanism(); ok {
+			c = Cap("AUTH=" + mech)
+		}
+		sorted[i] = c
+	}
+	SortCaps(sorted)
+	deduped := sorted[:0]
+	for _, c := range sorted {
+		if n := len(deduped); n > 0 && strings.EqualFold(string(deduped[n-1]), string(c)) {
+			continue
+		}
+		deduped = append(deduped, c)
+	}
+	return deduped
+}
+
+// FormatCaps returns caps as a space-separated capability list in the
+// order of SortCaps. caps is not modified.
+func FormatCaps(caps []Cap) string {
+	sorted := make([]Cap, len(caps))
+	copy(sorted, caps)
+	SortCaps(sorted)
+	strs := make([]string, len(sorted))
+	for i, c := range sorted {
+		strs[i] = string(c)
+	}
+	return strings.Join(strs, " ")
+}
+
+// Versions returns the IMAP protocol versions in the set, sorted.
+func (cs *CapSet) Versions() []Cap {
+	return cs.filter(Cap.IsVersion)
+}
+
+// AuthMechanisms returns the SASL mechanisms advertised with AUTH=
+// capabilities, in upper case and sorted.
+func (cs *CapSet) AuthMechanisms() []string {
+	var mechs []string
+	for _, c := range cs.All() {
+		if mech, ok := c.AuthMechanism(); ok {
+			mechs = append(mechs, mech)
+		}
+	}
+	sort.Strings(mechs)
+	return mechs
+}
+
+// Vendor returns the vendor extensions in the set, sorted.
+func (cs *CapSet) Vendor() []Cap {
+	return cs.filter(Cap.IsVendor)
+}
+
+// filter returns the capabilities for which keep returns true, sorted.
+func (cs *CapSet) filter(keep func(Cap) bool) []Cap {
+	var caps []Cap
+	for _, c := range cs.All() {
+		if keep(c) {
+			caps = append(caps, c)
+		}
+	}
+	SortCaps(caps)
+	return caps
+}
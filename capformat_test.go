@@ -0,0 +1,86 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCap_Classification(t *testing.T) {
+	tests := []struct {
+		cap     Cap
+		version bool
+		mech    string
+		vendor  bool
+	}{
+		{CapIMAP4rev1, true, "", false},
+		{"imap4rev2", true, "", false},
+		{CapIdle, false, "", false},
+		{"auth=scram-sha-256", false, "SCRAM-SHA-256", false},
+		{CapAuthXOAuth2, false, "XOAUTH2", false},
+		{"X-GM-EXT-1", false, "", true},
+		{"XLIST", false, "", true},
+		{"AUTH", false, "", false},
+	}
+	for _, tt := range tests {
+		if got := tt.cap.IsVersion(); got != tt.version {
+			t.Errorf("%s.IsVersion() = %v", tt.cap, got)
+		}
+		mech, ok := tt.cap.AuthMechanism()
+		if mech != tt.mech || ok != (tt.mech != "") {
+			t.Errorf("%s.AuthMechanism() = %q, %v", tt.cap, mech, ok)
+		}
+		if got := tt.cap.IsVendor(); got != tt.vendor {
+			t.Errorf("%s.IsVendor() = %v", tt.cap, got)
+		}
+	}
+}
+
+func TestParseCapabilities(t *testing.T) {
+	cs := ParseCapabilities("X-GM-EXT-1  IMAP4rev2 IDLE auth=plain AUTH=XOAUTH2 IMAP4rev1 IDLE ENABLE")
+
+	if cs.Len() != 7 {
+		t.Errorf("Len() = %d, want 7", cs.Len())
+	}
+	if !cs.HasAuth("plain") || !cs.Has("AUTH=PLAIN") {
+		t.Error("AUTH=plain was not normalized")
+	}
+	if got := cs.Versions(); !reflect.DeepEqual(got, []Cap{CapIMAP4rev1, CapIMAP4rev2}) {
+		t.Errorf("Versions() = %v", got)
+	}
+	if got := cs.AuthMechanisms(); !reflect.DeepEqual(got, []string{"PLAIN", "XOAUTH2"}) {
+		t.Errorf("AuthMechanisms() = %v", got)
+	}
+	if got := cs.Vendor(); !reflect.DeepEqual(got, []Cap{"X-GM-EXT-1"}) {
+		t.Errorf("Vendor() = %v", got)
+	}
+
+	want := "IMAP4rev1 IMAP4rev2 ENABLE IDLE AUTH=PLAIN AUTH=XOAUTH2 X-GM-EXT-1"
+	if got := cs.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := ParseCapabilities(want).String(); got != want {
+		t.Errorf("round trip = %q, want %q", got, want)
+	}
+}
+
+func TestFormatCaps(t *testing.T) {
+	caps := []Cap{CapMove, CapAuthPlain, "XYZZY", CapIMAP4rev1, CapCondStore}
+	want := "IMAP4rev1 CONDSTORE MOVE AUTH=PLAIN XYZZY"
+	if got := FormatCaps(caps); got != want {
+		t.Errorf("FormatCaps() = %q, want %q", got, want)
+	}
+	if caps[0] != CapMove {
+		t.Error("FormatCaps() modified its argument")
+	}
+}
+
+func TestDedupCaps(t *testing.T) {
+	caps := []Cap{"idle", CapIMAP4rev2, "AUTH=plain", CapIdle, CapAuthPlain, "x-a", "X-A", CapIMAP4rev1, CapIdle}
+	want := "IMAP4rev1 IMAP4rev2 IDLE AUTH=PLAIN X-A"
+	if got := DedupCaps(caps); FormatCaps(got) != want || len(got) != 5 {
+		t.Errorf("DedupCaps() = %q, want %q", got, want)
+	}
+	if caps[0] != "idle" {
+		t.Error("DedupCaps() modified its argument")
+	}
+}
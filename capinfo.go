@@ -0,0 +1,149 @@
+package imap
+
+import "strings"
+
+// CapInfo describes a standard capability.
+type CapInfo struct {
+	// RFC is the number of the RFC defining the capability.
+	RFC int
+	// Enable reports whether the capability can be enabled with ENABLE
+	// (RFC 5161). Servers ignore requests to enable other capabilities.
+	Enable bool
+	// IMAP4rev2 reports whether the capability is part of IMAP4rev2 (RFC
+	// 9051 appendix E), so that servers advertising IMAP4rev2 support it
+	// whether or not they advertise it.
+	IMAP4rev2 bool
+	// Implies are the capabilities that servers advertising this one
+	// support too, such as CONDSTORE for QRESYNC.
+	Implies []Cap
+}
+
+// capInfos describes the standard capabilities other than AUTH=.
+var capInfos = map[Cap]CapInfo{
+	CapIMAP4rev1:            {RFC: 3501},
+	CapIMAP4rev2:            {RFC: 9051, Enable: true},
+	CapSASLIR:               {RFC: 4959, IMAP4rev2: true},
+	CapIdle:                 {RFC: 2177, IMAP4rev2: true},
+	CapNamespace:            {RFC: 2342, IMAP4rev2: true},
+	CapID:                   {RFC: 2971},
+	CapChildren:             {RFC: 3348, IMAP4rev2: true},
+	CapStartTLS:             {RFC: 3501},
+	CapLogindisabled:        {RFC: 3501},
+	CapMultiAppend:          {RFC: 3502},
+	CapBinary:               {RFC: 3516, IMAP4rev2: true},
+	CapUnselect:             {RFC: 3691, IMAP4rev2: true},
+	CapACL:                  {RFC: 4314},
+	CapUIDPlus:              {RFC: 4315, IMAP4rev2: true},
+	CapURLAuth:              {RFC: 4467},
+	CapCatenate:             {RFC: 4469},
+	CapESearch:              {RFC: 4731, IMAP4rev2: true},
+	CapCompressDeflate:      {RFC: 4978},
+	CapWithin:               {RFC: 5032},
+	CapEnable:               {RFC: 5161, IMAP4rev2: true},
+	CapSearchRes:            {RFC: 5182, IMAP4rev2: true},
+	CapLanguage:             {RFC: 5255},
+	CapI18NLevel1:           {RFC: 5255},
+	CapI18NLevel2:           {RFC: 5255, Implies: []Cap{CapI18NLevel1}},
+	CapSort:                 {RFC: 5256},
+	CapThreadOrderedSubject: {RFC: 5256},
+	CapThreadReferences:     {RFC: 5256},
+	CapListExtended:         {RFC: 5258, IMAP4rev2: true},
+	CapConvert:              {RFC: 5259},
+	CapContextSearch:        {RFC: 5267, Implies: []Cap{CapESearch}},
+	CapContextSort:          {RFC: 5267, Implies: []Cap{CapESort, CapSort}},
+	CapESort:                {RFC: 5267, Implies: []Cap{CapSort}},
+	CapMetadata:             {RFC: 5464, Implies: []Cap{CapMetadataServer}},
+	CapMetadataServer:       {RFC: 5464},
+	CapNotify:               {RFC: 5465},
+	CapFilters:              {RFC: 5466},
+	CapListStatus:           {RFC: 5819, IMAP4rev2: true},
+	CapSortDisplay:          {RFC: 5957, Implies: []Cap{CapSort}},
+	CapSpecialUse:           {RFC: 6154, IMAP4rev2: true},
+	CapCreateSpecialUse:     {RFC: 6154},
+	CapSearchFuzzy:          {RFC: 6203},
+	CapMove:                 {RFC: 6851, IMAP4rev2: true},
+	CapUTF8Accept:           {RFC: 6855, Enable: true},
+	CapUTF8Only:             {RFC: 6855, Implies: []Cap{CapUTF8Accept}},
+	CapCondStore:            {RFC: 7162, Enable: true},
+	CapQResync:              {RFC: 7162, Enable: true, Implies: []Cap{CapCondStore}},
+	CapMultiSearch:          {RFC: 7377},
+	CapLiteralPlus:          {RFC: 7888, Implies: []Cap{CapLiteralMinus}},
+	CapLiteralMinus:         {RFC: 7888, IMAP4rev2: true},
+	CapAppendLimit:          {RFC: 7889},
+	CapUnauthenticate:       {RFC: 8437},
+	CapStatusSize:           {RFC: 8438, IMAP4rev2: true},
+	CapListMyRights:         {RFC: 8440},
+	CapObjectID:             {RFC: 8474},
+	CapReplace:              {RFC: 8508},
+	CapSaveDate:             {RFC: 8514},
+	CapPreview:              {RFC: 8970},
+	CapQuota:                {RFC: 9208},
+	CapQuotaResStorage:      {RFC: 9208},
+	CapQuotaResMessage:      {RFC: 9208},
+	CapQuotaResMailbox:      {RFC: 9208},
+	CapQuotaResAnnotation:   {RFC: 9208},
+	CapPartial:              {RFC: 9394},
+	CapInProgress:           {RFC: 9585},
+	CapUIDOnly:              {RFC: 9586, Enable: true},
+	CapListMetadata:         {RFC: 9590, Implies: []Cap{CapMetadata}},
+	CapJMAPAccess:           {RFC: 9698},
+	CapMessageLimit:         {RFC: 9738},
+}
+
+// capInfosUpper indexes capInfos by upper-case name, as capability names
+// are case-insensitive.
+var capInfosUpper = func() map[string]CapInfo {
+	m := make(map[string]CapInfo, len(capInfos))
+	for c, info := range capInfos {
+		m[strings.ToUpper(string(c))] = info
+	}
+	return m
+}()
+
+// Info returns the description of a standard capability. It returns false
+// for AUTH=, vendor and unknown capabilities.
+func (c Cap) Info() (CapInfo, bool) {
+	info, ok := capInfosUpper[strings.ToUpper(string(c))]
+	return info, ok
+}
+
+// IsEnableable reports whether c is a standard capability that can be
+// enabled with ENABLE.
+func (c Cap) IsEnableable() bool {
+	info, _ := c.Info()
+	return info.Enable
+}
+
+// Supports reports whether a server advertising the set supports c: c is
+// in the set, implied by a capability in the set, such as CONDSTORE by
+// QRESYNC, or part of IMAP4rev2 and the set includes IMAP4rev2.
+func (cs *CapSet) Supports(c Cap) bool {
+	if cs.Has(c) {
+		return true
+	}
+	if info, ok := c.Info(); ok && info.IMAP4rev2 && cs.Has(CapIMAP4rev2) {
+		return true
+	}
+	seen := make(map[Cap]bool)
+	for _, have := range cs.All() {
+		if capImplies(have, c, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// capImplies reports whether have implies c, directly or indirectly.
+func capImplies(have, c Cap, seen map[Cap]bool) bool {
+	if seen[have] {
+		return false
+	}
+	seen[have] = true
+	info, _ := have.Info()
+	for _, implied := range info.Implies {
+		if strings.EqualFold(string(implied), string(c)) || capImplies(implied, c, seen) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package imap
+
+import "testing"
+
+func TestCap_Info(t *testing.T) {
+	info, ok := Cap("qresync").Info()
+	if !ok || info.RFC != 7162 || !info.Enable || len(info.Implies) != 1 || info.Implies[0] != CapCondStore {
+		t.Errorf("Info(qresync) = %+v, %v", info, ok)
+	}
+	if _, ok := Cap("X-GM-EXT-1").Info(); ok {
+		t.Error("Info() of a vendor capability reports a standard one")
+	}
+
+	for _, c := range []Cap{CapCondStore, CapQResync, CapUTF8Accept, CapIMAP4rev2, CapUIDOnly} {
+		if !c.IsEnableable() {
+			t.Errorf("%s is not enable-able", c)
+		}
+	}
+	for _, c := range []Cap{CapMove, CapIdle, CapMetadata, "X-UNKNOWN"} {
+		if c.IsEnableable() {
+			t.Errorf("%s is enable-able", c)
+		}
+	}
+}
+
+func TestCapSet_Supports(t *testing.T) {
+	tests := []struct {
+		caps string
+		cap  Cap
+		want bool
+	}{
+		{"IMAP4rev1 MOVE", CapMove, true},
+		{"IMAP4rev1", CapMove, false},
+		{"IMAP4rev2", CapMove, true},
+		{"IMAP4rev2", CapCondStore, false},
+		{"IMAP4rev1 QRESYNC", CapCondStore, true},
+		{"IMAP4rev1 CONTEXT=SORT", CapSort, true},
+		{"IMAP4rev1 LIST-METADATA", CapMetadataServer, true},
+		{"IMAP4rev1 LITERAL+", CapLiteralMinus, true},
+		{"IMAP4rev1 LITERAL-", CapLiteralPlus, false},
+	}
+	for _, tt := range tests {
+		if got := ParseCapabilities(tt.caps).Supports(tt.cap); got != tt.want {
+			t.Errorf("ParseCapabilities(%q).Supports(%s) = %v, want %v", tt.caps, tt.cap, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package imap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrUnknownCharset is returned for a charset that cannot be converted to
+// UTF-8.
+var ErrUnknownCharset = errors.New("imap: unknown charset")
+
+// ErrUnencodable is returned by EncodeCharset for text containing a
+// character that the charset cannot represent.
+var ErrUnencodable = errors.New("imap: character not representable in charset")
+
+// CharsetReaderFunc returns a reader that converts r from charset to
+// UTF-8, or ErrUnknownCharset. It allows decoding charsets that
+// NewCharsetReader does not know, such as GBK or Shift_JIS, for example
+// with golang.org/x/text:
+//
+//	func(charset string, r io.Reader) (io.Reader, error) {
+//		enc, err := htmlindex.Get(charset)
+//		if err != nil {
+//			return nil, imap.ErrUnknownCharset
+//		}
+//		return transform.NewReader(r, enc.NewDecoder()), nil
+//	}
+type CharsetReaderFunc func(charset string, r io.Reader) (io.Reader, error)
+
+// NewCharsetReader returns a reader that converts r from charset to UTF-8.
+// The charset name is matched case-insensitively and common aliases such as
+// latin1 and cp1252 are understood. UTF-8 is returned unchanged; US-ASCII
+// and an empty charset, the default of RFC 2045, are decoded as
+// windows-1252, its superset, because 8-bit data mislabeled as US-ASCII is
+// common. Other supported charsets are ISO-8859-1 to ISO-8859-16 and
+// windows-1250 to windows-1258; for the rest, ErrUnknownCharset is
+// returned.
+func NewCharsetReader(charset string, r io.Reader) (io.Reader, error) {
+	name := normalizeCharset(charset)
+	switch name {
+	case "utf-8":
+		return r, nil
+	case "", "us-ascii":
+		name = "windows-1252"
+	}
+	table, ok := charmaps[name]
+	if !ok {
+		return nil, ErrUnknownCharset
+	}
+	return &charmapReader{r: r, table: table}, nil
+}
+
+// DecodeCharset converts data from charset to UTF-8. See NewCharsetReader.
+func DecodeCharset(charset string, data []byte) ([]byte, error) {
+	r, err := NewCharsetReader(charset, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// EncodeCharset converts UTF-8 text to charset, the reverse of
+// DecodeCharset, for the charsets it supports. Unlike NewCharsetReader, it
+// treats US-ASCII strictly. ErrUnknownCharset is returned for other
+// charsets and ErrUnencodable if s contains a character that charset
+// cannot represent.
+func EncodeCharset(charset string, s string) ([]byte, error) {
+	name := normalizeCharset(charset)
+	var table *[128]rune
+	switch name {
+	case "utf-8":
+		return []byte(s), nil
+	case "", "us-ascii":
+	default:
+		var ok bool
+		if table, ok = charmaps[name]; !ok {
+			return nil, ErrUnknownCharset
+		}
+	}
+
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+			continue
+		}
+		b := -1
+		if table != nil && r != utf8.RuneError {
+			for i, tr := range table {
+				if tr == r {
+					b = 0x80 + i
+					break
+				}
+			}
+		}
+		if b < 0 {
+			return nil, ErrUnencodable
+		}
+		out = append(out, byte(b))
+	}
+	return out, nil
+}
+
+// latinCharsets maps the latinN aliases of RFC 1345 to their ISO-8859
+// parts.
+var latinCharsets = map[string]string{
+	"latin1":  "iso-8859-1",
+	"latin2":  "iso-8859-2",
+	"latin3":  "iso-8859-3",
+	"latin4":  "iso-8859-4",
+	"latin5":  "iso-8859-9",
+	"latin6":  "iso-8859-10",
+	"latin7":  "iso-8859-13",
+	"latin8":  "iso-8859-14",
+	"latin9":  "iso-8859-15",
+	"latin10": "iso-8859-16",
+}
+
+// normalizeCharset returns the canonical lower-case name of a charset, such
+// as iso-8859-2 for ISO_8859-2, latin2 and iso8859-2.
+func normalizeCharset(charset string) string {
+	name := strings.ToLower(strings.Trim(strings.TrimSpace(charset), `"`))
+	name = strings.ReplaceAll(name, "_", "-")
+	switch name {
+	case "utf8":
+		return "utf-8"
+	case "ascii", "ansi-x3.4-1968", "iso646-us":
+		return "us-ascii"
+	}
+	if latin, ok := latinCharsets[strings.ReplaceAll(name, "-", "")]; ok {
+		return latin
+	}
+	if part, ok := strings.CutPrefix(name, "iso8859-"); ok {
+		return "iso-8859-" + part
+	}
+	if part, ok := strings.CutPrefix(name, "iso-8859-"); ok {
+		// ISO_8859-1:1987
+		part, _, _ = strings.Cut(part, ":")
+		return "iso-8859-" + part
+	}
+	for _, prefix := range []string{"x-cp", "cp", "windows"} {
+		if part, ok := strings.CutPrefix(name, prefix); ok && strings.HasPrefix(strings.TrimPrefix(part, "-"), "125") {
+			return "windows-" + strings.TrimPrefix(part, "-")
+		}
+	}
+	return name
+}
+
+// charmapReader converts a single-byte charset to UTF-8.
+type charmapReader struct {
+	r     io.Reader
+	table *[128]rune
+	buf   [512]byte
+	dst   []byte // converted data
+	out   []byte // unread part of dst
+	err   error
+}
+
+func (cr *charmapReader) Read(p []byte) (int, error) {
+	for len(cr.out) == 0 {
+		if cr.err != nil {
+			return 0, cr.err
+		}
+		var n int
+		n, cr.err = cr.r.Read(cr.buf[:])
+		out := cr.dst[:0]
+		for _, b := range cr.buf[:n] {
+			if b < utf8.RuneSelf {
+				out = append(out, b)
+			} else {
+				out = utf8.AppendRune(out, cr.table[b-0x80])
+			}
+		}
+		cr.dst, cr.out = out, out
+	}
+	n := copy(p, cr.out)
+	cr.out = cr.out[n:]
+	return n, nil
+}
@@ -0,0 +1,84 @@
+package imap
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecodeCharset(t *testing.T) {
+	tests := []struct {
+		charset, in, want string
+	}{
+		{"UTF-8", "café", "café"},
+		{"iso-8859-1", "caf\xe9", "café"},
+		{"Latin1", "caf\xe9", "café"},
+		{"ISO_8859-1:1987", "caf\xe9", "café"},
+		{"windows-1252", "\x80 5", "€ 5"},
+		{"cp1252", "\x93quoted\x94", "“quoted”"},
+		{"us-ascii", "\x80", "€"},
+		{"", "plain", "plain"},
+		{"iso-8859-2", "\xb1\xe6", "ąć"},
+		{"iso8859-15", "\xa4", "€"},
+		{"latin2", "\xb3\xf3d\xbc", "łódź"},
+		{"windows-1251", "\xcf\xf0\xe8\xe2\xe5\xf2", "Привет"},
+		{"x-cp1250", "\x9a", "š"},
+		{"\"ISO-8859-7\"", "\xe1", "α"},
+	}
+	for _, tt := range tests {
+		got, err := DecodeCharset(tt.charset, []byte(tt.in))
+		if err != nil {
+			t.Errorf("DecodeCharset(%q) error: %v", tt.charset, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("DecodeCharset(%q, %q) = %q, want %q", tt.charset, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeCharset_Unknown(t *testing.T) {
+	for _, charset := range []string{"GBK", "iso-8859-12", "x-unknown"} {
+		if _, err := DecodeCharset(charset, []byte("x")); !errors.Is(err, ErrUnknownCharset) {
+			t.Errorf("DecodeCharset(%q) = %v, want ErrUnknownCharset", charset, err)
+		}
+	}
+}
+
+func TestEncodeCharset(t *testing.T) {
+	tests := []struct {
+		charset, in, want string
+		err               error
+	}{
+		{"UTF-8", "café", "café", nil},
+		{"ISO-8859-1", "café", "caf\xe9", nil},
+		{"latin2", "łódź", "\xb3\xf3d\xbc", nil},
+		{"windows-1252", "€ 5", "\x80 5", nil},
+		{"us-ascii", "plain", "plain", nil},
+		{"us-ascii", "café", "", ErrUnencodable},
+		{"iso-8859-1", "łódź", "", ErrUnencodable},
+		{"GBK", "x", "", ErrUnknownCharset},
+	}
+	for _, tt := range tests {
+		got, err := EncodeCharset(tt.charset, tt.in)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("EncodeCharset(%q, %q) error = %v, want %v", tt.charset, tt.in, err, tt.err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("EncodeCharset(%q, %q) = %q, want %q", tt.charset, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNewCharsetReader_SmallReads(t *testing.T) {
+	in := bytes.Repeat([]byte("\xe9t\xe9 "), 300)
+	r, err := NewCharsetReader("latin1", iotest.HalfReader(bytes.NewReader(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := iotest.TestReader(r, bytes.Repeat([]byte("été "), 300)); err != nil {
+		t.Error(err)
+	}
+}
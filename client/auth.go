@@ -1,7 +1,9 @@
 package client
 
 import (
+	"crypto/tls"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -14,6 +16,8 @@ func (c *Client) Login(username, password string) error {
 	// Quote username and password
 	user := quoteArg(username)
 	pass := quoteArg(password)
+	preAuthCaps := c.Caps()
+	capsGen := c.capsGeneration()
 
 	result, err := c.execute("LOGIN", user, pass)
 	if err != nil {
@@ -23,17 +27,35 @@ func (c *Client) Login(username, password string) error {
 		return err
 	}
 
+	// The capabilities change with authentication; keep them only if the
+	// server sent the new ones.
+	c.forgetStaleCaps(capsGen)
 	c.mu.Lock()
 	c.state = imap.ConnStateAuthenticated
+	c.preAuthCaps = preAuthCaps
 	c.mu.Unlock()
 
 	return nil
 }
 
-// Authenticate authenticates using a SASL mechanism.
+// Authenticate authenticates using a SASL mechanism. Over TLS, mechanisms
+// that implement auth.ChannelBinder, such as SCRAM-SHA-256-PLUS, are given
+// the channel bindings of the connection. For mechanisms that implement
+// auth.ServerVerifier, such as SCRAM, an error is returned if the server
+// completes the command without having proved its identity.
 func (c *Client) Authenticate(mechanism imapauth.ClientMechanism) error {
 	tag := c.tags.Next()
-	cmd := c.pending.Add(tag)
+	preAuthCaps := c.Caps()
+	capsGen := c.capsGeneration()
+
+	if cb, ok := mechanism.(imapauth.ChannelBinder); ok {
+		c.mu.Lock()
+		tlsConn, isTLS := c.conn.(*tls.Conn)
+		c.mu.Unlock()
+		if isTLS {
+			cb.SetChannelBindings(imapauth.TLSChannelBindings(tlsConn.ConnectionState()))
+		}
+	}
 
 	// Send AUTHENTICATE command
 	ir, err := mechanism.Start()
@@ -51,11 +73,11 @@ func (c *Client) Authenticate(mechanism imapauth.ClientMechanism) error {
 	}
 	line.WriteString("\r\n")
 
-	c.encoder.RawString(line.String())
-	if err := c.encoder.Flush(); err != nil {
-		c.pending.Complete(tag, &commandResult{err: err})
+	cmd, err := c.send(tag, "AUTHENTICATE", line.String(), true)
+	if err != nil {
 		return err
 	}
+	defer c.release()
 
 	// If we didn't send IR, wait for the first continuation and send it
 	if ir != nil && !c.HasCap("SASL-IR") {
@@ -63,8 +85,7 @@ func (c *Client) Authenticate(mechanism imapauth.ClientMechanism) error {
 			return err
 		}
 		encoded := base64.StdEncoding.EncodeToString(ir)
-		c.encoder.RawString(encoded + "\r\n")
-		if err := c.encoder.Flush(); err != nil {
+		if err := c.writeContinuation([]byte(encoded + "\r\n")); err != nil {
 			return err
 		}
 	}
@@ -80,22 +101,19 @@ func (c *Client) Authenticate(mechanism imapauth.ClientMechanism) error {
 			challenge, err := base64.StdEncoding.DecodeString(cont.text)
 			if err != nil {
 				// Send cancel
-				c.encoder.RawString("*\r\n")
-				_ = c.encoder.Flush()
+				_ = c.writeContinuation([]byte("*\r\n"))
 				return fmt.Errorf("decoding challenge: %w", err)
 			}
 
 			// Get response
 			response, err := mechanism.Next(challenge)
 			if err != nil {
-				c.encoder.RawString("*\r\n")
-				_ = c.encoder.Flush()
+				_ = c.writeContinuation([]byte("*\r\n"))
 				return fmt.Errorf("SASL response: %w", err)
 			}
 
 			encoded := base64.StdEncoding.EncodeToString(response)
-			c.encoder.RawString(encoded + "\r\n")
-			if err := c.encoder.Flush(); err != nil {
+			if err := c.writeContinuation([]byte(encoded + "\r\n")); err != nil {
 				return err
 			}
 
@@ -103,17 +121,31 @@ func (c *Client) Authenticate(mechanism imapauth.ClientMechanism) error {
 			if err := commandResultError(result); err != nil {
 				return err
 			}
+			if v, ok := mechanism.(imapauth.ServerVerifier); ok && !v.ServerVerified() {
+				return errors.New("SASL: server completed authentication without verifying itself")
+			}
+			c.forgetStaleCaps(capsGen)
 			c.mu.Lock()
 			c.state = imap.ConnStateAuthenticated
+			c.preAuthCaps = preAuthCaps
 			c.mu.Unlock()
 			return nil
 		}
 	}
 }
 
-// Logout sends the LOGOUT command and closes the connection.
+// Logout sends the LOGOUT command and closes the connection. Servers that
+// close the connection before the tagged response to LOGOUT arrives, with
+// or without a BYE response, are not treated as an error.
 func (c *Client) Logout() error {
+	c.mu.Lock()
+	c.loggingOut = true
+	c.mu.Unlock()
+
 	err := c.executeCheck("LOGOUT")
+	if isConnectionError(err) {
+		err = nil
+	}
 	c.mu.Lock()
 	c.state = imap.ConnStateLogout
 	c.mu.Unlock()
@@ -0,0 +1,42 @@
+package client
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/auth/scram"
+)
+
+func TestAuthenticate_SCRAMWithoutServerFinal(t *testing.T) {
+	var mu sync.Mutex
+	var authTag string
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1 SASL-IR AUTH=SCRAM-SHA-256] ready", func(w io.Writer, tag, cmd string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if args, ok := strings.CutPrefix(cmd, "AUTHENTICATE SCRAM-SHA-256 "); ok {
+			authTag = tag
+			clientFirst, _ := base64.StdEncoding.DecodeString(args)
+			_, nonce, _ := strings.Cut(string(clientFirst), ",r=")
+			salt := base64.StdEncoding.EncodeToString([]byte("salt"))
+			serverFirst := fmt.Sprintf("r=%sserver,s=%s,i=4096", nonce, salt)
+			fmt.Fprintf(w, "+ %s\r\n", base64.StdEncoding.EncodeToString([]byte(serverFirst)))
+			return
+		}
+		// The client-final-message is accepted without sending the
+		// server-final-message and its signature.
+		fmt.Fprintf(w, "%s OK authenticated\r\n", authTag)
+	})
+
+	err := c.Authenticate(&scram.ClientMechanism{Username: "user", Password: "pencil"})
+	if err == nil {
+		t.Fatal("Authenticate() succeeded without the server's signature")
+	}
+	if c.State() == imap.ConnStateAuthenticated {
+		t.Error("the client is in the authenticated state")
+	}
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"sort"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// DefaultStoreChunkSize is the number of messages changed by each UID
+// STORE of BulkStore and UIDStoreChunked when BulkStoreOptions.ChunkSize
+// is 0.
+const DefaultStoreChunkSize = 500
+
+// BulkStoreOptions contains options for BulkStore, UIDStoreChunked and
+// MarkAllSeen.
+type BulkStoreOptions struct {
+	// ChunkSize is the maximum number of messages changed by one UID
+	// STORE. Some servers reject commands with very long UID sets, so
+	// large changes are split. If 0, DefaultStoreChunkSize is used.
+	ChunkSize int
+	// Progress, if set, is called after each UID STORE with the number of
+	// messages changed so far and the total.
+	Progress func(done, total int)
+}
+
+// BulkStore changes the flags of all messages in the selected mailbox
+// matching criteria, such as "UNSEEN" or "BEFORE 1-Jan-2020", and returns
+// their number. The matching UIDs are found with UID SEARCH and changed
+// with UID STORE in chunks, see UIDStoreChunked.
+func (c *Client) BulkStore(criteria string, action imap.StoreAction, flags []imap.Flag, opts *BulkStoreOptions) (int, error) {
+	nums, err := c.UIDSearch(criteria)
+	if err != nil {
+		return 0, err
+	}
+	uids := make([]imap.UID, len(nums))
+	for i, num := range nums {
+		uids[i] = imap.UID(num)
+	}
+	return len(uids), c.UIDStoreChunked(uids, action, flags, opts)
+}
+
+// UIDStoreChunked changes the flags of the messages with the given UIDs in
+// the selected mailbox, with one UID STORE per opts.ChunkSize messages.
+// The stores are silent, so the server does not send the new flags of
+// every message. If a store fails, the error is returned and the
+// remaining chunks are not sent; the chunks before it stay applied.
+func (c *Client) UIDStoreChunked(uids []imap.UID, action imap.StoreAction, flags []imap.Flag, opts *BulkStoreOptions) error {
+	if opts == nil {
+		opts = &BulkStoreOptions{}
+	}
+	size := opts.ChunkSize
+	if size <= 0 {
+		size = DefaultStoreChunkSize
+	}
+
+	sorted := make([]imap.UID, len(uids))
+	copy(sorted, uids)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	for done := 0; done < len(sorted); {
+		end := done + size
+		if end > len(sorted) {
+			end = len(sorted)
+		}
+		set := &imap.UIDSet{}
+		set.AddNum(sorted[done:end]...)
+		set.Normalize()
+		if err := c.UIDStore(set.String(), action, flags, true); err != nil {
+			return err
+		}
+		done = end
+		if opts.Progress != nil {
+			opts.Progress(done, len(sorted))
+		}
+	}
+	return nil
+}
+
+// MarkAllSeen selects mailbox, unless it is selected already, and adds the
+// \Seen flag to all its unseen messages, see BulkStore. It returns the
+// number of messages marked.
+func (c *Client) MarkAllSeen(mailbox string, opts *BulkStoreOptions) (int, error) {
+	if !c.isSelected(mailbox) {
+		if _, err := c.Select(mailbox, nil); err != nil {
+			return 0, err
+		}
+	}
+	return c.BulkStore("UNSEEN", imap.StoreFlagsAdd, []imap.Flag{imap.FlagSeen}, opts)
+}
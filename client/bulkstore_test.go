@@ -0,0 +1,81 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestMarkAllSeen(t *testing.T) {
+	var mu sync.Mutex
+	var cmds []string
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1] ready", func(w io.Writer, tag, cmd string) {
+		mu.Lock()
+		cmds = append(cmds, cmd)
+		mu.Unlock()
+		switch {
+		case strings.HasPrefix(cmd, "SELECT "):
+			fmt.Fprint(w, "* 7 EXISTS\r\n")
+		case strings.HasPrefix(cmd, "UID SEARCH "):
+			fmt.Fprint(w, "* SEARCH 9 3 4 5 10 20 1\r\n")
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+
+	var progress []string
+	n, err := c.MarkAllSeen("INBOX", &BulkStoreOptions{
+		ChunkSize: 3,
+		Progress: func(done, total int) {
+			progress = append(progress, fmt.Sprintf("%d/%d", done, total))
+		},
+	})
+	if err != nil {
+		t.Fatalf("MarkAllSeen() error: %v", err)
+	}
+	if n != 7 {
+		t.Errorf("MarkAllSeen() = %d, want 7", n)
+	}
+
+	want := []string{
+		"SELECT INBOX",
+		"UID SEARCH UNSEEN",
+		`UID STORE 1,3:4 +FLAGS.SILENT (\Seen)`,
+		`UID STORE 5,9:10 +FLAGS.SILENT (\Seen)`,
+		`UID STORE 20 +FLAGS.SILENT (\Seen)`,
+	}
+	if strings.Join(cmds, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands = %q, want %q", cmds, want)
+	}
+	if strings.Join(progress, " ") != "3/7 6/7 7/7" {
+		t.Errorf("progress = %q", progress)
+	}
+}
+
+func TestUIDStoreChunked_Error(t *testing.T) {
+	var mu sync.Mutex
+	var stores int
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		mu.Lock()
+		stores++
+		mu.Unlock()
+		fmt.Fprintf(w, "%s NO [LIMIT] too many\r\n", tag)
+	})
+
+	uids := make([]imap.UID, 1200)
+	for i := range uids {
+		uids[i] = imap.UID(i + 1)
+	}
+	err := c.UIDStoreChunked(uids, imap.StoreFlagsAdd, []imap.Flag{imap.FlagDeleted}, nil)
+	if err == nil {
+		t.Fatal("UIDStoreChunked() succeeded")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if stores != 1 {
+		t.Errorf("sent %d stores, want 1", stores)
+	}
+}
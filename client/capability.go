@@ -1,5 +1,88 @@
 package client
 
+import (
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// Capabilities returns the server's capabilities as a set, which gives
+// access to the advertised AUTH= mechanisms, protocol versions and vendor
+// extensions.
+func (c *Client) Capabilities() *imap.CapSet {
+	return imap.ParseCapabilities(strings.Join(c.Caps(), " "))
+}
+
+// EnsureCaps returns the server's capabilities, sending CAPABILITY only if
+// they are not known. Servers usually include them in the greeting and in
+// the response to LOGIN or AUTHENTICATE, which saves the round trip; they
+// are unknown if the server did not, and after STARTTLS, which invalidates
+// them.
+func (c *Client) EnsureCaps() ([]string, error) {
+	c.mu.Lock()
+	known := c.caps != nil
+	c.mu.Unlock()
+	if known {
+		return c.Caps(), nil
+	}
+	return c.Capability()
+}
+
+// setCaps replaces the known capabilities. nil marks them as unknown.
+func (c *Client) setCaps(caps []string) {
+	c.mu.Lock()
+	c.caps = caps
+	c.capsGen++
+	c.mu.Unlock()
+}
+
+// capsGeneration returns a counter that changes whenever the capabilities
+// are replaced, so that commands can tell whether their response carried
+// capabilities.
+func (c *Client) capsGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.capsGen
+}
+
+// forgetStaleCaps marks the capabilities as unknown unless they were
+// replaced since gen, after a command that changes them.
+func (c *Client) forgetStaleCaps(gen uint64) {
+	c.mu.Lock()
+	if c.capsGen == gen {
+		c.caps = nil
+		c.capsGen++
+	}
+	c.mu.Unlock()
+}
+
+// parseCaps parses a capability list into the form stored by the client.
+// The server's order is kept, duplicates are dropped and AUTH= mechanisms
+// are converted to upper case, as imap.ParseCapabilities does.
+func parseCaps(s string) []string {
+	fields := strings.Fields(s)
+	caps := make([]string, 0, len(fields))
+	seen := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if mech, ok := imap.Cap(f).AuthMechanism(); ok {
+			f = "AUTH=" + mech
+		}
+		if !seen[f] {
+			seen[f] = true
+			caps = append(caps, f)
+		}
+	}
+	return caps
+}
+
+// Supports reports whether the server supports cap: it advertises it,
+// advertises a capability implying it, such as QRESYNC for CONDSTORE, or
+// advertises IMAP4rev2 which includes it, such as MOVE. See
+// imap.CapSet.Supports.
+func (c *Client) Supports(cap imap.Cap) bool {
+	return c.Capabilities().Supports(cap)
+}
+
 // SupportsIMAP4rev2 returns true if the server supports IMAP4rev2.
 func (c *Client) SupportsIMAP4rev2() bool {
 	return c.HasCap("IMAP4rev2")
@@ -7,55 +90,55 @@ func (c *Client) SupportsIMAP4rev2() bool {
 
 // SupportsIdle returns true if the server supports IDLE.
 func (c *Client) SupportsIdle() bool {
-	return c.HasCap("IDLE")
+	return c.Supports(imap.CapIdle)
 }
 
 // SupportsMove returns true if the server supports MOVE.
 func (c *Client) SupportsMove() bool {
-	return c.HasCap("MOVE")
+	return c.Supports(imap.CapMove)
 }
 
 // SupportsLiteralPlus returns true if the server supports LITERAL+.
 func (c *Client) SupportsLiteralPlus() bool {
-	return c.HasCap("LITERAL+")
+	return c.Supports(imap.CapLiteralPlus)
 }
 
 // SupportsUIDPlus returns true if the server supports UIDPLUS.
 func (c *Client) SupportsUIDPlus() bool {
-	return c.HasCap("UIDPLUS")
+	return c.Supports(imap.CapUIDPlus)
 }
 
 // SupportsCondStore returns true if the server supports CONDSTORE.
 func (c *Client) SupportsCondStore() bool {
-	return c.HasCap("CONDSTORE")
+	return c.Supports(imap.CapCondStore)
 }
 
 // SupportsQResync returns true if the server supports QRESYNC.
 func (c *Client) SupportsQResync() bool {
-	return c.HasCap("QRESYNC")
+	return c.Supports(imap.CapQResync)
 }
 
 // SupportsNamespace returns true if the server supports NAMESPACE.
 func (c *Client) SupportsNamespace() bool {
-	return c.HasCap("NAMESPACE")
+	return c.Supports(imap.CapNamespace)
 }
 
 // SupportsSort returns true if the server supports SORT.
 func (c *Client) SupportsSort() bool {
-	return c.HasCap("SORT")
+	return c.Supports(imap.CapSort)
 }
 
 // SupportsID returns true if the server supports ID.
 func (c *Client) SupportsID() bool {
-	return c.HasCap("ID")
+	return c.Supports(imap.CapID)
 }
 
 // SupportsEnable returns true if the server supports ENABLE.
 func (c *Client) SupportsEnable() bool {
-	return c.HasCap("ENABLE")
+	return c.Supports(imap.CapEnable)
 }
 
 // SupportsStartTLS returns true if the server supports STARTTLS.
 func (c *Client) SupportsStartTLS() bool {
-	return c.HasCap("STARTTLS")
+	return c.Supports(imap.CapStartTLS)
 }
@@ -10,15 +10,43 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net"
+	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	imap "github.com/meszmate/imap-go"
 	"github.com/meszmate/imap-go/wire"
 )
 
+// ErrCommandInProgress is returned when a command is issued while another
+// command holds the connection for a continuation exchange: an APPEND
+// literal upload, AUTHENTICATE or IDLE. STATUS and APPEND interrupt IDLE
+// instead, see Client.Idle.
+var ErrCommandInProgress = errors.New("another command is in progress")
+
+// ErrClosed is wrapped by the errors of commands that fail because the
+// connection was closed.
+var ErrClosed = errors.New("connection closed")
+
+// ErrResponseTooLarge is wrapped by the errors of commands that fail
+// because a response exceeded Options.MaxResponseSize, after which the
+// connection is closed.
+var ErrResponseTooLarge = errors.New("response too large")
+
 // Client is an IMAP client.
+//
+// A Client is safe for concurrent use. Commands issued from several
+// goroutines are written one at a time and pipelined: each command waits
+// only for its own tagged response. Commands that need continuation
+// requests (APPEND, AUTHENTICATE and IDLE) reserve the connection until
+// their continuation data has been sent; any command issued in the
+// meantime fails with ErrCommandInProgress instead of being interleaved
+// with the continuation data. Untagged responses are shared, so callers
+// that rely on the untagged data of a command should not pipeline it with
+// commands that produce the same kind of response.
 type Client struct {
 	conn    net.Conn
 	encoder *wire.Encoder
@@ -28,9 +56,17 @@ type Client struct {
 	pending *pendingCommands
 	reader  *reader
 
+	// debugLog receives the protocol exchange when set.
+	debugLog atomic.Pointer[wireLog]
+
+	// readLimiter throttles literal reads when set.
+	readLimiter atomic.Pointer[RateLimiter]
+
 	mu                 sync.Mutex
 	state              imap.ConnState
 	caps               []string
+	capsGen            uint64
+	preAuthCaps        []string
 	mailboxName        string
 	mailboxMessages    uint32
 	mailboxRecent      uint32
@@ -38,6 +74,24 @@ type Client struct {
 	mailboxUIDNext     uint32
 	mailboxUnseen      uint32
 	mailboxReadOnly    bool
+	mailboxID          string
+	// mailboxHighestModSeq is the HIGHESTMODSEQ of the selected mailbox
+	// (RFC 7162), if reported.
+	mailboxHighestModSeq uint64
+	// enabled are the capabilities the server reported enabled with
+	// ENABLED, and savedSearch is set once a search result has been saved
+	// as $ (RFC 5182) in the selected mailbox. See Snapshot.
+	enabled     []string
+	savedSearch bool
+
+	// idle is the IDLE command in progress, if any, which STATUS and
+	// APPEND interrupt.
+	idle *IdleCommand
+
+	// sections caches body sections for UIDFetchSection; it is created
+	// on first use.
+	sectionsOnce sync.Once
+	sections     *sectionCache
 
 	// untaggedData collects untagged responses for the current command
 	untaggedMu   sync.Mutex
@@ -46,6 +100,17 @@ type Client struct {
 	// continuationCh is used to signal continuation requests to waiting commands
 	continuationCh chan continuation
 
+	// writeMu serializes writes to the connection. exclusive is the name
+	// of the command that currently holds the connection for a
+	// continuation exchange, if any.
+	writeMu   sync.Mutex
+	exclusive string
+
+	// loggingOut is set once LOGOUT has been sent, and bye once the
+	// server has sent BYE; the connection may then end at any time.
+	loggingOut bool
+	bye        *imap.IMAPError
+
 	closed         bool
 	disconnectOnce sync.Once
 	disconnectCh   chan struct{}
@@ -67,8 +132,6 @@ func New(conn net.Conn, opts ...Option) (*Client, error) {
 
 	c := &Client{
 		conn:           conn,
-		encoder:        wire.NewEncoder(conn),
-		decoder:        wire.NewDecoder(conn),
 		options:        options,
 		tags:           newTagGenerator("A"),
 		pending:        newPendingCommands(),
@@ -76,6 +139,10 @@ func New(conn net.Conn, opts ...Option) (*Client, error) {
 		disconnectCh:   make(chan struct{}),
 		state:          imap.ConnStateNotAuthenticated,
 	}
+	c.encoder, c.decoder = c.newWire(conn)
+	if options.DebugLog {
+		c.SetDebugWriter(os.Stderr, nil)
+	}
 
 	// Read the server greeting
 	line, err := c.decoder.ReadLine()
@@ -84,6 +151,7 @@ func New(conn net.Conn, opts ...Option) (*Client, error) {
 	}
 
 	c.options.Logger.Debug("greeting", "line", line)
+	c.validate(line)
 
 	// Parse greeting
 	if strings.HasPrefix(line, "* OK") {
@@ -91,7 +159,7 @@ func New(conn net.Conn, opts ...Option) (*Client, error) {
 	} else if strings.HasPrefix(line, "* PREAUTH") {
 		c.state = imap.ConnStateAuthenticated
 	} else if strings.HasPrefix(line, "* BYE") {
-		return nil, fmt.Errorf("server rejected connection: %s", line)
+		return nil, greetingByeError(line)
 	} else {
 		return nil, fmt.Errorf("unexpected greeting: %s", line)
 	}
@@ -101,10 +169,14 @@ func New(conn net.Conn, opts ...Option) (*Client, error) {
 		end := strings.IndexByte(line[bracketIdx:], ']')
 		if end > 0 {
 			capStr := line[bracketIdx+12 : bracketIdx+end]
-			c.caps = strings.Fields(capStr)
+			c.caps = parseCaps(capStr)
 		}
 	}
 
+	if options.ReadRateLimit > 0 {
+		c.readLimiter.Store(NewRateLimiter(options.ReadRateLimit))
+	}
+
 	// Start the background reader
 	c.reader = newReader(c.decoder, c)
 	go c.reader.run()
@@ -112,6 +184,28 @@ func New(conn net.Conn, opts ...Option) (*Client, error) {
 	return c, nil
 }
 
+// newWire returns the encoder and decoder for conn, with the buffer sizes
+// and line length limit of the options.
+func (c *Client) newWire(conn net.Conn) (*wire.Encoder, *wire.Decoder) {
+	wc := debugConn{Conn: conn, c: c}
+	enc := wire.NewEncoderSize(wc, bufferSize(c.options.WriteBufferSize))
+	dec := wire.NewDecoderSize(wc, bufferSize(c.options.ReadBufferSize))
+	enc.SetTrace(c.options.WireTrace)
+	dec.SetTrace(c.options.WireTrace)
+	if limit := c.options.MaxResponseSize; limit > 0 && limit <= math.MaxInt32 {
+		dec.MaxLineLength = int(limit)
+	}
+	return enc, dec
+}
+
+// bufferSize returns the size of a wire buffer, 4096 bytes unless set.
+func bufferSize(size int) int {
+	if size <= 0 {
+		return 4096
+	}
+	return size
+}
+
 // Dial connects to an IMAP server at the given address.
 func Dial(addr string, opts ...Option) (*Client, error) {
 	conn, err := net.Dial("tcp", addr)
@@ -170,14 +264,13 @@ func (c *Client) Close() error {
 	c.mu.Unlock()
 
 	err := c.conn.Close()
-	c.handleDisconnect(errors.New("connection closed"))
+	c.handleDisconnect(ErrClosed)
 	return err
 }
 
 // execute sends a command and waits for the tagged response.
 func (c *Client) execute(name string, args ...string) (*commandResult, error) {
 	tag := c.tags.Next()
-	cmd := c.pending.Add(tag)
 
 	// Build the command line
 	var line strings.Builder
@@ -190,12 +283,8 @@ func (c *Client) execute(name string, args ...string) (*commandResult, error) {
 	}
 	line.WriteString("\r\n")
 
-	c.options.Logger.Debug("send", "line", strings.TrimRight(line.String(), "\r\n"))
-
-	// Write the command
-	c.encoder.RawString(line.String())
-	if err := c.encoder.Flush(); err != nil {
-		c.pending.Complete(tag, &commandResult{err: err})
+	cmd, err := c.send(tag, name, line.String(), false)
+	if err != nil {
 		return nil, err
 	}
 
@@ -208,6 +297,58 @@ func (c *Client) execute(name string, args ...string) (*commandResult, error) {
 	return result, nil
 }
 
+// send registers tag as pending and writes the command line. If exclusive
+// is set, the connection stays reserved for the command until release is
+// called, so that its continuation data is not interleaved with other
+// commands.
+func (c *Client) send(tag, name, line string, exclusive bool) (*pendingCommand, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.exclusive != "" {
+		return nil, fmt.Errorf("%s: %w (%s)", name, ErrCommandInProgress, c.exclusive)
+	}
+
+	cmd := c.pending.Add(tag)
+
+	c.options.Logger.Debug("send", "line", strings.TrimRight(line, "\r\n"))
+
+	c.encoder.RawString(line)
+	if err := c.encoder.Flush(); err != nil {
+		c.pending.Complete(tag, &commandResult{err: err})
+		return nil, err
+	}
+
+	if exclusive {
+		c.exclusive = name
+	}
+	if savesSearchResult(name, line) {
+		c.mu.Lock()
+		c.savedSearch = true
+		c.mu.Unlock()
+	}
+	return cmd, nil
+}
+
+// writeContinuation writes continuation data for the command holding the
+// connection.
+func (c *Client) writeContinuation(data ...[]byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	for _, b := range data {
+		c.encoder.Raw(b)
+	}
+	return c.encoder.Flush()
+}
+
+// release gives up the connection reserved by an exclusive send.
+func (c *Client) release() {
+	c.writeMu.Lock()
+	c.exclusive = ""
+	c.writeMu.Unlock()
+}
+
 // executeCheck executes a command and returns an error if the response is not OK.
 func (c *Client) executeCheck(name string, args ...string) error {
 	result, err := c.execute(name, args...)
@@ -247,7 +388,7 @@ func (c *Client) handleContinuation(line string) {
 
 func (c *Client) handleDisconnect(err error) {
 	if err == nil {
-		err = errors.New("connection closed")
+		err = ErrClosed
 	}
 
 	c.disconnectOnce.Do(func() {
@@ -255,9 +396,12 @@ func (c *Client) handleDisconnect(err error) {
 		c.disconnectErr = err
 		c.mu.Unlock()
 
-		c.pending.CompleteAll(fmt.Errorf("connection closed: %w", err))
+		if !errors.Is(err, ErrClosed) {
+			err = fmt.Errorf("%w: %w", ErrClosed, err)
+		}
+		c.pending.CompleteAll(err)
 		select {
-		case c.continuationCh <- continuation{err: fmt.Errorf("connection closed: %w", err)}:
+		case c.continuationCh <- continuation{err: err}:
 		default:
 		}
 		close(c.disconnectCh)
@@ -269,7 +413,11 @@ func (c *Client) Done() <-chan struct{} {
 	return c.disconnectCh
 }
 
-// DisconnectErr returns the disconnect cause after Done is closed.
+// DisconnectErr returns the disconnect cause after Done is closed. If the
+// connection was shut down cleanly, by Close or Logout or by the server
+// after a BYE response, the error is or wraps ErrClosed; in the last case
+// it also wraps the BYE response as an *imap.IMAPError. Other causes, such
+// as io.ErrUnexpectedEOF, mean the connection was lost.
 func (c *Client) DisconnectErr() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -286,11 +434,11 @@ func commandResultError(result *commandResult) error {
 	if result.status == "OK" {
 		return nil
 	}
-	return &imap.IMAPError{StatusResponse: &imap.StatusResponse{
+	return throttleError(&imap.IMAPError{StatusResponse: &imap.StatusResponse{
 		Type: imap.StatusResponseType(result.status),
 		Code: imap.ResponseCode(result.code),
 		Text: result.text,
-	}}
+	}})
 }
 
 func (c *Client) waitForContinuation(cmd *pendingCommand) (string, error) {
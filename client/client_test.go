@@ -2,9 +2,12 @@ package client
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -187,3 +190,201 @@ func TestDoneClosedOnClientClose(t *testing.T) {
 		t.Fatal("DisconnectErr() = nil, want non-nil")
 	}
 }
+
+// newScriptedClient connects a Client to a fake server that sends greeting
+// and then calls respond for every command line it receives. respond writes
+// the untagged and tagged responses for the command to w. The client is
+// created with opts.
+func newScriptedClient(t testing.TB, greeting string, respond func(w io.Writer, tag, cmd string), opts ...Option) *Client {
+	t.Helper()
+
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() {
+		_ = serverConn.Close()
+		_ = clientConn.Close()
+	})
+
+	go func() {
+		fmt.Fprint(serverConn, greeting+"\r\n")
+		r := bufio.NewReader(serverConn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			tag, cmd, _ := strings.Cut(line, " ")
+			respond(serverConn, tag, cmd)
+		}
+	}()
+
+	c, err := New(clientConn, opts...)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestConcurrentCommands(t *testing.T) {
+	var mu sync.Mutex
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "%s OK %s completed\r\n", tag, cmd)
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- c.Noop()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Noop() error: %v", err)
+		}
+	}
+}
+
+func TestStatusTextEndingLikeLiteral(t *testing.T) {
+	c := newScriptedClient(t, "* OK ready {5}", func(w io.Writer, tag, cmd string) {
+		fmt.Fprintf(w, "* OK see {5}\r\n* NO quota {3}\r\n%s OK done {2}\r\n", tag)
+	})
+
+	for i := 0; i < 2; i++ {
+		done := make(chan error, 1)
+		go func() { done <- c.Noop() }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Noop() error: %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Noop() hung: status text read as a literal")
+		}
+	}
+}
+
+func TestCommandDuringIdle(t *testing.T) {
+	var idleTag string
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		switch cmd {
+		case "IDLE":
+			idleTag = tag
+			fmt.Fprint(w, "+ idling\r\n")
+		case "":
+			if tag == "DONE" {
+				fmt.Fprintf(w, "%s OK IDLE terminated\r\n", idleTag)
+			}
+		default:
+			fmt.Fprintf(w, "%s OK %s completed\r\n", tag, cmd)
+		}
+	})
+
+	idle, err := c.Idle()
+	if err != nil {
+		t.Fatalf("Idle() error: %v", err)
+	}
+	if err := c.Noop(); !errors.Is(err, ErrCommandInProgress) {
+		t.Errorf("Noop() during IDLE error = %v, want ErrCommandInProgress", err)
+	}
+	if err := idle.Done(); err != nil {
+		t.Fatalf("Done() error: %v", err)
+	}
+	if err := c.Noop(); err != nil {
+		t.Errorf("Noop() after IDLE error: %v", err)
+	}
+}
+
+func TestClient_Capabilities(t *testing.T) {
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1 auth=plain AUTH=XOAUTH2 X-GM-EXT-1 IDLE] ready", func(w io.Writer, tag, cmd string) {
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+
+	if got := c.Caps(); strings.Join(got, " ") != "IMAP4rev1 AUTH=PLAIN AUTH=XOAUTH2 X-GM-EXT-1 IDLE" {
+		t.Errorf("Caps() = %q", got)
+	}
+	caps := c.Capabilities()
+	if got := caps.AuthMechanisms(); len(got) != 2 || got[0] != "PLAIN" || got[1] != "XOAUTH2" {
+		t.Errorf("AuthMechanisms() = %q", got)
+	}
+	if got := caps.Vendor(); len(got) != 1 || got[0] != "X-GM-EXT-1" {
+		t.Errorf("Vendor() = %q", got)
+	}
+}
+
+func TestClient_Supports(t *testing.T) {
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev2 QRESYNC] ready", func(w io.Writer, tag, cmd string) {
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+
+	if !c.SupportsMove() || !c.SupportsIdle() || !c.SupportsCondStore() {
+		t.Error("MOVE, IDLE or CONDSTORE not supported by an IMAP4rev2 QRESYNC server")
+	}
+	if c.SupportsSort() || c.SupportsLiteralPlus() {
+		t.Error("SORT or LITERAL+ supported without being advertised")
+	}
+}
+
+func TestClient_EnsureCaps(t *testing.T) {
+	var mu sync.Mutex
+	var sent []string
+	respond := func(w io.Writer, tag, cmd string) {
+		mu.Lock()
+		sent = append(sent, strings.Fields(cmd)[0])
+		mu.Unlock()
+		switch {
+		case cmd == "CAPABILITY":
+			fmt.Fprintf(w, "* CAPABILITY IMAP4rev1 IDLE\r\n%s OK done\r\n", tag)
+		case strings.HasPrefix(cmd, "LOGIN alice"):
+			fmt.Fprintf(w, "%s OK [CAPABILITY IMAP4rev1 IDLE MOVE] logged in\r\n", tag)
+		default:
+			fmt.Fprintf(w, "%s OK done\r\n", tag)
+		}
+	}
+	sentCommands := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return strings.Join(sent, " ")
+	}
+
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1 AUTH=PLAIN] ready", respond)
+	if caps, err := c.EnsureCaps(); err != nil || strings.Join(caps, " ") != "IMAP4rev1 AUTH=PLAIN" {
+		t.Errorf("EnsureCaps() = %q, %v", caps, err)
+	}
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if caps, err := c.EnsureCaps(); err != nil || strings.Join(caps, " ") != "IMAP4rev1 IDLE MOVE" {
+		t.Errorf("EnsureCaps() after LOGIN = %q, %v", caps, err)
+	}
+	if got := sentCommands(); got != "LOGIN" {
+		t.Errorf("commands = %q, want only LOGIN", got)
+	}
+
+	mu.Lock()
+	sent = nil
+	mu.Unlock()
+	c = newScriptedClient(t, "* OK ready", respond)
+	if caps, err := c.EnsureCaps(); err != nil || strings.Join(caps, " ") != "IMAP4rev1 IDLE" {
+		t.Errorf("EnsureCaps() without greeting capabilities = %q, %v", caps, err)
+	}
+	if err := c.Login("bob", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if c.HasCap("IDLE") {
+		t.Error("capabilities kept after LOGIN without new capabilities")
+	}
+	if _, err := c.EnsureCaps(); err != nil {
+		t.Fatal(err)
+	}
+	if got := sentCommands(); got != "CAPABILITY LOGIN CAPABILITY" {
+		t.Errorf("commands = %q, want CAPABILITY LOGIN CAPABILITY", got)
+	}
+}
@@ -0,0 +1,213 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Direction is the direction of protocol data in the wire log.
+type Direction int
+
+const (
+	// DirectionClient is data sent by the client.
+	DirectionClient Direction = iota
+	// DirectionServer is data sent by the server.
+	DirectionServer
+)
+
+// String returns "C" or "S".
+func (d Direction) String() string {
+	if d == DirectionServer {
+		return "S"
+	}
+	return "C"
+}
+
+// redacted replaces credentials in the wire log.
+const redacted = "<redacted>"
+
+// SetDebugWriter logs the protocol exchange to w. Each line is prefixed
+// with "C: " or "S: " and literals are logged as a single entry. Passwords
+// in LOGIN and SASL data in AUTHENTICATE are always redacted. If sanitize
+// is not nil, it is applied to every line after that and may rewrite it;
+// returning nil drops the line. A nil w disables the log.
+//
+// Literals longer than Options.DebugLiteralLimit are truncated.
+func (c *Client) SetDebugWriter(w io.Writer, sanitize func(dir Direction, line []byte) []byte) {
+	if w == nil {
+		c.debugLog.Store(nil)
+		return
+	}
+	c.debugLog.Store(&wireLog{
+		w:            w,
+		sanitize:     sanitize,
+		literalLimit: c.options.DebugLiteralLimit,
+	})
+}
+
+// debugConn tees the traffic of a connection into the client's wire log.
+type debugConn struct {
+	net.Conn
+	c *Client
+}
+
+func (d debugConn) Read(p []byte) (int, error) {
+	n, err := d.Conn.Read(p)
+	if n > 0 {
+		if l := d.c.debugLog.Load(); l != nil {
+			l.feed(DirectionServer, p[:n])
+		}
+	}
+	return n, err
+}
+
+func (d debugConn) Write(p []byte) (int, error) {
+	if l := d.c.debugLog.Load(); l != nil {
+		l.feed(DirectionClient, p)
+	}
+	return d.Conn.Write(p)
+}
+
+// wireLog splits the traffic in each direction into lines and literals and
+// writes them to w.
+type wireLog struct {
+	mu           sync.Mutex
+	w            io.Writer
+	sanitize     func(dir Direction, line []byte) []byte
+	literalLimit int
+	streams      [2]wireStream
+
+	// authTag is the tag of the AUTHENTICATE command in progress.
+	authTag string
+}
+
+// wireStream is the parser state of one direction.
+type wireStream struct {
+	line    []byte
+	literal int64 // literal bytes still expected
+	size    int64 // size of the current literal
+	data    []byte
+}
+
+func (l *wireLog) feed(dir Direction, p []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := &l.streams[dir]
+	for len(p) > 0 {
+		if s.literal > 0 {
+			n := int64(len(p))
+			if n > s.literal {
+				n = s.literal
+			}
+			keep := p[:n]
+			if l.literalLimit > 0 && len(s.data)+len(keep) > l.literalLimit {
+				keep = keep[:l.literalLimit-len(s.data)]
+			}
+			s.data = append(s.data, keep...)
+			s.literal -= n
+			p = p[n:]
+			if s.literal == 0 {
+				l.writeLiteral(dir, s)
+			}
+			continue
+		}
+
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			s.line = append(s.line, p...)
+			return
+		}
+		line := append(s.line, p[:i+1]...)
+		s.line = nil
+		p = p[i+1:]
+
+		l.writeLine(dir, bytes.TrimRight(line, "\r\n"))
+		if n, ok := literalSize(line); ok && n > 0 {
+			s.literal = n
+			s.size = n
+		}
+	}
+}
+
+func (l *wireLog) writeLine(dir Direction, line []byte) {
+	line = l.redact(dir, line)
+	if l.sanitize != nil {
+		if line = l.sanitize(dir, line); line == nil {
+			return
+		}
+	}
+	fmt.Fprintf(l.w, "%s: %s\n", dir, line)
+}
+
+func (l *wireLog) writeLiteral(dir Direction, s *wireStream) {
+	data := s.data
+	if dir == DirectionClient && l.authTag != "" {
+		data = []byte(redacted)
+	} else if int64(len(data)) < s.size {
+		data = append(data, fmt.Sprintf("[... %d bytes truncated]", s.size-int64(len(data)))...)
+	}
+	s.data = nil
+	s.size = 0
+
+	if l.sanitize != nil {
+		if data = l.sanitize(dir, data); data == nil {
+			return
+		}
+	}
+	fmt.Fprintf(l.w, "%s: %s\n", dir, data)
+}
+
+// redact removes credentials from a line.
+func (l *wireLog) redact(dir Direction, line []byte) []byte {
+	if dir == DirectionServer {
+		if l.authTag != "" && bytes.HasPrefix(line, []byte(l.authTag+" ")) {
+			l.authTag = ""
+		}
+		return line
+	}
+	if l.authTag != "" {
+		// SASL response to a continuation request.
+		return []byte(redacted)
+	}
+
+	fields := strings.SplitN(string(line), " ", 4)
+	if len(fields) < 3 {
+		return line
+	}
+	tag, name := fields[0], strings.ToUpper(fields[1])
+	switch name {
+	case "LOGIN":
+		return []byte(tag + " " + fields[1] + " " + redacted)
+	case "AUTHENTICATE":
+		l.authTag = tag
+		if len(fields) == 4 {
+			return []byte(tag + " " + fields[1] + " " + fields[2] + " " + redacted)
+		}
+	}
+	return line
+}
+
+// literalSize returns the size of the literal announced at the end of
+// line, if any.
+func literalSize(line []byte) (int64, bool) {
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) == 0 || line[len(line)-1] != '}' {
+		return 0, false
+	}
+	open := bytes.LastIndexByte(line, '{')
+	if open < 0 {
+		return 0, false
+	}
+	digits := bytes.TrimSuffix(line[open+1:len(line)-1], []byte("+"))
+	n, err := strconv.ParseInt(string(digits), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
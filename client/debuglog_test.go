@@ -0,0 +1,73 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSetDebugWriter(t *testing.T) {
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		if strings.HasPrefix(cmd, "NOOP") {
+			fmt.Fprint(w, "* 1 FETCH (BODY[] {10}\r\n0123456789)\r\n")
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+
+	var buf bytes.Buffer
+	c.options.DebugLiteralLimit = 4
+	c.SetDebugWriter(&buf, func(dir Direction, line []byte) []byte {
+		if bytes.HasSuffix(line, []byte("OK done")) {
+			return nil
+		}
+		return line
+	})
+
+	if err := c.Login("alice", "s3cret"); err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	if err := c.Noop(); err != nil {
+		t.Fatalf("Noop() error: %v", err)
+	}
+	c.SetDebugWriter(nil, nil)
+
+	got := buf.String()
+	if strings.Contains(got, "s3cret") {
+		t.Errorf("password not redacted:\n%s", got)
+	}
+	for _, want := range []string{
+		"C: A1 LOGIN <redacted>\n",
+		"C: A2 NOOP\n",
+		"S: * 1 FETCH (BODY[] {10}\n",
+		"S: 0123[... 6 bytes truncated]\n",
+		"S: )\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log does not contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "OK done") {
+		t.Errorf("sanitizer did not drop lines:\n%s", got)
+	}
+}
+
+func TestWireLog_Authenticate(t *testing.T) {
+	var buf bytes.Buffer
+	l := &wireLog{w: &buf}
+	l.feed(DirectionClient, []byte("A1 AUTHENTICATE PLAIN AGFsaWNlAHNlY3JldA==\r\n"))
+	l.feed(DirectionServer, []byte("+ \r\n"))
+	l.feed(DirectionClient, []byte("AGFsaWNlAHNlY3JldA==\r\n"))
+	l.feed(DirectionServer, []byte("A1 OK authenticated\r\n"))
+	l.feed(DirectionClient, []byte("A2 NOOP\r\n"))
+
+	want := "C: A1 AUTHENTICATE PLAIN <redacted>\n" +
+		"S: + \n" +
+		"C: <redacted>\n" +
+		"S: A1 OK authenticated\n" +
+		"C: A2 NOOP\n"
+	if buf.String() != want {
+		t.Errorf("log = %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"errors"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// ErrNoTrash is returned by DeleteMessages in MoveToTrash mode if the
+// account has no trash mailbox.
+var ErrNoTrash = errors.New("no trash mailbox")
+
+// DeleteMode is how DeleteMessages deletes messages.
+type DeleteMode int
+
+const (
+	// MoveToTrash moves the messages to the trash mailbox, the mailbox
+	// with the \Trash special-use attribute (RFC 6154) or else the one
+	// named like a trash, see Client.MailboxRoles. Messages deleted from
+	// the trash itself are flagged and expunged, as with FlagAndExpunge.
+	// This is what deleting means to most users, and the only way to
+	// delete messages on servers such as Gmail, where expunging a message
+	// from a mailbox other than the trash only removes a label.
+	MoveToTrash DeleteMode = iota
+	// FlagAndExpunge flags the messages \Deleted and expunges them, which
+	// removes them permanently.
+	FlagAndExpunge
+	// ExpungeOnly expunges the messages without flagging them, so that
+	// only those already flagged \Deleted, for example by a client that
+	// deletes by flagging only, are removed.
+	ExpungeOnly
+)
+
+// String returns the name of the mode.
+func (m DeleteMode) String() string {
+	switch m {
+	case MoveToTrash:
+		return "MoveToTrash"
+	case FlagAndExpunge:
+		return "FlagAndExpunge"
+	case ExpungeOnly:
+		return "ExpungeOnly"
+	default:
+		return "DeleteMode(?)"
+	}
+}
+
+// DeleteOptions contains options for DeleteMessages.
+type DeleteOptions struct {
+	// DryRun reports the commands DeleteMessages would send without
+	// sending them. The trash is still looked up with LIST.
+	DryRun bool
+}
+
+// DeleteResult describes what DeleteMessages did.
+type DeleteResult struct {
+	// Mode is the mode applied, which is FlagAndExpunge instead of
+	// MoveToTrash when deleting from the trash.
+	Mode DeleteMode
+	// Trash is the trash mailbox in MoveToTrash mode.
+	Trash string
+	// Commands are the commands sent, or that would be sent in a dry
+	// run, such as "UID MOVE 1:3 Trash".
+	Commands []string
+	// CopyData holds the UIDs of the messages in the trash, if they were
+	// moved there and the server supports UIDPLUS (RFC 4315).
+	CopyData *imap.CopyData
+}
+
+// DeleteMessages deletes the messages with the given UIDs from mailbox,
+// which is selected first unless it is already selected read-write. mode
+// chooses between moving them to the trash and removing them for good;
+// the commands used depend on the server's capabilities:
+//
+//   - moving uses UID MOVE (RFC 6851), or else UID COPY followed by
+//     flagging and expunging
+//   - expunging uses UID EXPUNGE (RFC 4315), or else its emulation by
+//     ExpungeUIDs, which keeps the other messages of the mailbox flagged
+//     \Deleted unless the emulation is refused with
+//     WithUIDExpungeFallback
+//
+// A dry run on a server without UIDPLUS lists the UID SEARCH and EXPUNGE
+// of the emulation, but not the UID STORE commands, which depend on the
+// result of the search.
+// If a command fails, DeleteMessages returns the error with the result so
+// far; the commands before it stay applied.
+func (c *Client) DeleteMessages(mailbox string, uids []imap.UID, mode DeleteMode, opts *DeleteOptions) (*DeleteResult, error) {
+	if opts == nil {
+		opts = &DeleteOptions{}
+	}
+	res := &DeleteResult{Mode: mode}
+	if len(uids) == 0 {
+		return res, nil
+	}
+
+	if mode == MoveToTrash {
+		roles, err := c.MailboxRoles()
+		if err != nil {
+			return res, err
+		}
+		trash := roles[imap.MailboxAttrTrash]
+		if trash == nil {
+			return res, ErrNoTrash
+		}
+		if sameMailbox(trash.Mailbox, mailbox) {
+			res.Mode = FlagAndExpunge
+		} else {
+			res.Trash = trash.Mailbox
+		}
+	}
+
+	set := &imap.UIDSet{}
+	set.AddNum(uids...)
+	set.Normalize()
+	uidSet := set.String()
+
+	type step struct {
+		cmd string
+		run func() error
+	}
+	var steps []step
+	add := func(cmd string, run func() error) {
+		steps = append(steps, step{cmd, run})
+	}
+
+	c.mu.Lock()
+	selected := c.state == imap.ConnStateSelected && !c.mailboxReadOnly && sameMailbox(c.mailboxName, mailbox)
+	c.mu.Unlock()
+	if !selected {
+		add("SELECT "+quoteArg(mailbox), func() error {
+			_, err := c.Select(mailbox, nil)
+			return err
+		})
+	}
+
+	flag := func() {
+		add("UID STORE "+uidSet+` +FLAGS.SILENT (\Deleted)`, func() error {
+			return c.UIDStore(uidSet, imap.StoreFlagsAdd, []imap.Flag{imap.FlagDeleted}, true)
+		})
+	}
+	expunge := func() {
+		switch {
+		case c.SupportsUIDPlus():
+			add("UID EXPUNGE "+uidSet, func() error { return c.UIDExpunge(uidSet) })
+		case opts.DryRun:
+			add("UID SEARCH "+uidExpungeCriteria(uidSet), nil)
+			add("EXPUNGE", nil)
+		default:
+			// The emulation records the commands it sends.
+			add("", func() error {
+				return c.emulateUIDExpunge(uidSet, func(cmd string) {
+					res.Commands = append(res.Commands, cmd)
+				})
+			})
+		}
+	}
+
+	switch res.Mode {
+	case MoveToTrash:
+		trash := res.Trash
+		if c.SupportsMove() {
+			add("UID MOVE "+uidSet+" "+quoteArg(trash), func() (err error) {
+				res.CopyData, err = c.UIDMove(uidSet, trash)
+				return err
+			})
+		} else {
+			add("UID COPY "+uidSet+" "+quoteArg(trash), func() (err error) {
+				res.CopyData, err = c.UIDCopy(uidSet, trash)
+				return err
+			})
+			flag()
+			expunge()
+		}
+	case FlagAndExpunge:
+		flag()
+		expunge()
+	case ExpungeOnly:
+		expunge()
+	default:
+		return res, errors.New("imap: unknown delete mode " + res.Mode.String())
+	}
+
+	for _, s := range steps {
+		if s.cmd != "" {
+			res.Commands = append(res.Commands, s.cmd)
+		}
+		if opts.DryRun {
+			continue
+		}
+		if err := s.run(); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// sameMailbox reports whether a and b name the same mailbox, INBOX being
+// case-insensitive.
+func sameMailbox(a, b string) bool {
+	if strings.EqualFold(a, "INBOX") {
+		return strings.EqualFold(b, "INBOX")
+	}
+	return a == b
+}
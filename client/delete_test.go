@@ -0,0 +1,144 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// newDeleteClient returns a client of a server with the given capabilities
+// and a trash mailbox if trash is set, and a function returning the
+// commands it received other than LIST.
+func newDeleteClient(t *testing.T, caps string, trash bool) (*Client, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var cmds []string
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1 "+caps+"] ready", func(w io.Writer, tag, cmd string) {
+		name, args, _ := strings.Cut(cmd, " ")
+		if !strings.EqualFold(name, "LIST") {
+			mu.Lock()
+			cmds = append(cmds, cmd)
+			mu.Unlock()
+		}
+		switch {
+		case strings.EqualFold(name, "LIST"):
+			fmt.Fprint(w, "* LIST () \"/\" INBOX\r\n")
+			if trash {
+				fmt.Fprint(w, "* LIST () \"/\" Trash\r\n")
+			}
+		case strings.EqualFold(name, "SELECT"):
+			fmt.Fprint(w, "* 3 EXISTS\r\n* OK [UIDVALIDITY 7] ok\r\n")
+			fmt.Fprintf(w, "%s OK [READ-WRITE] SELECT completed\r\n", tag)
+			return
+		case strings.HasPrefix(args, "MOVE") || strings.HasPrefix(args, "COPY"):
+			fmt.Fprintf(w, "%s OK [COPYUID 9 1:2 20:21] done\r\n", tag)
+			return
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+	return c, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		got := cmds
+		cmds = nil
+		return got
+	}
+}
+
+func TestDeleteMessages(t *testing.T) {
+	tests := []struct {
+		name     string
+		caps     string
+		mailbox  string
+		mode     DeleteMode
+		wantMode DeleteMode
+		want     []string
+	}{
+		{
+			name: "move", caps: "MOVE UIDPLUS", mailbox: "INBOX", mode: MoveToTrash, wantMode: MoveToTrash,
+			want: []string{"SELECT INBOX", "UID MOVE 1:2 Trash"},
+		},
+		{
+			name: "copy", caps: "UIDPLUS", mailbox: "INBOX", mode: MoveToTrash, wantMode: MoveToTrash,
+			want: []string{"SELECT INBOX", "UID COPY 1:2 Trash", `UID STORE 1:2 +FLAGS.SILENT (\Deleted)`, "UID EXPUNGE 1:2"},
+		},
+		{
+			name: "from trash", caps: "MOVE UIDPLUS", mailbox: "Trash", mode: MoveToTrash, wantMode: FlagAndExpunge,
+			want: []string{"SELECT Trash", `UID STORE 1:2 +FLAGS.SILENT (\Deleted)`, "UID EXPUNGE 1:2"},
+		},
+		{
+			name: "flag and expunge", caps: "", mailbox: "INBOX", mode: FlagAndExpunge, wantMode: FlagAndExpunge,
+			want: []string{"SELECT INBOX", `UID STORE 1:2 +FLAGS.SILENT (\Deleted)`, "UID SEARCH DELETED NOT UID 1:2", "EXPUNGE"},
+		},
+		{
+			name: "expunge only", caps: "UIDPLUS", mailbox: "INBOX", mode: ExpungeOnly, wantMode: ExpungeOnly,
+			want: []string{"SELECT INBOX", "UID EXPUNGE 1:2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, sent := newDeleteClient(t, tt.caps, true)
+			res, err := c.DeleteMessages(tt.mailbox, []imap.UID{2, 1}, tt.mode, nil)
+			if err != nil {
+				t.Fatalf("DeleteMessages() error: %v", err)
+			}
+			if res.Mode != tt.wantMode {
+				t.Errorf("Mode = %v, want %v", res.Mode, tt.wantMode)
+			}
+			if !reflect.DeepEqual(res.Commands, tt.want) {
+				t.Errorf("Commands = %q, want %q", res.Commands, tt.want)
+			}
+			if got := sent(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent %q, want %q", got, tt.want)
+			}
+			if tt.wantMode == MoveToTrash && (res.CopyData == nil || res.CopyData.UIDValidity != 9) {
+				t.Errorf("CopyData = %+v", res.CopyData)
+			}
+		})
+	}
+}
+
+func TestDeleteMessages_Selected(t *testing.T) {
+	c, sent := newDeleteClient(t, "MOVE", true)
+	if _, err := c.Select("INBOX", nil); err != nil {
+		t.Fatalf("Select() error: %v", err)
+	}
+	sent()
+	res, err := c.DeleteMessages("INBOX", []imap.UID{5}, MoveToTrash, nil)
+	if err != nil {
+		t.Fatalf("DeleteMessages() error: %v", err)
+	}
+	if want := []string{"UID MOVE 5 Trash"}; !reflect.DeepEqual(sent(), want) || res.Trash != "Trash" {
+		t.Errorf("result = %+v, want only %q", res, want)
+	}
+}
+
+func TestDeleteMessages_DryRun(t *testing.T) {
+	c, sent := newDeleteClient(t, "MOVE", true)
+	res, err := c.DeleteMessages("INBOX", []imap.UID{3, 4, 5}, MoveToTrash, &DeleteOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("DeleteMessages() error: %v", err)
+	}
+	if want := []string{"SELECT INBOX", "UID MOVE 3:5 Trash"}; !reflect.DeepEqual(res.Commands, want) {
+		t.Errorf("Commands = %q, want %q", res.Commands, want)
+	}
+	if got := sent(); len(got) != 0 {
+		t.Errorf("dry run sent %q", got)
+	}
+}
+
+func TestDeleteMessages_NoTrash(t *testing.T) {
+	c, sent := newDeleteClient(t, "MOVE", false)
+	if _, err := c.DeleteMessages("INBOX", []imap.UID{1}, MoveToTrash, nil); !errors.Is(err, ErrNoTrash) {
+		t.Errorf("DeleteMessages() error = %v, want ErrNoTrash", err)
+	}
+	if got := sent(); len(got) != 0 {
+		t.Errorf("sent %q", got)
+	}
+}
@@ -0,0 +1,330 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// FetchHeaders fetches only the given header fields of the messages in
+// seqSet, for example "Subject", "From" and "List-Id", together with their
+// UID, flags and size. It uses BODY.PEEK[HEADER.FIELDS (...)], so the
+// \Seen flag is not set and the rest of the header is not transferred,
+// which makes it suitable for building message lists.
+//
+// The returned header block is parsed into the Header field of each
+// result; it is also available raw in BodySection.
+func (c *Client) FetchHeaders(seqSet string, fields ...string) ([]*imap.FetchMessageBuffer, error) {
+	lines, err := c.Fetch(seqSet, headerFetchItems(fields))
+	if err != nil {
+		return nil, err
+	}
+	return parseHeaderFetches(lines, c.options), nil
+}
+
+// UIDFetchHeaders is like FetchHeaders, but uidSet contains UIDs.
+func (c *Client) UIDFetchHeaders(uidSet string, fields ...string) ([]*imap.FetchMessageBuffer, error) {
+	lines, err := c.UIDFetch(uidSet, headerFetchItems(fields))
+	if err != nil {
+		return nil, err
+	}
+	return parseHeaderFetches(lines, c.options), nil
+}
+
+// UIDFetchMessages runs UID FETCH and parses the responses. It understands
+// the data items UID, FLAGS, INTERNALDATE, RFC822.SIZE, MODSEQ, EMAILID,
+// THREADID, PREVIEW, BODYSTRUCTURE and BODY[section], including BODY.PEEK;
+// the whole message fetched with BODY.PEEK[] is in BodySection[""].
+func (c *Client) UIDFetchMessages(uidSet string, items string) ([]*imap.FetchMessageBuffer, error) {
+	lines, err := c.UIDFetch(uidSet, items)
+	if err != nil {
+		return nil, err
+	}
+	return parseHeaderFetches(lines, c.options), nil
+}
+
+// headerFetchItems returns the FETCH data items used by FetchHeaders.
+func headerFetchItems(fields []string) string {
+	section := &imap.FetchItemBodySection{Specifier: "HEADER.FIELDS", Peek: true}
+	for _, f := range fields {
+		section.Fields = append(section.Fields, textproto.CanonicalMIMEHeaderKey(f))
+	}
+	return "(UID FLAGS RFC822.SIZE " + section.String() + ")"
+}
+
+// parseHeaderFetches parses the FETCH responses collected by Fetch or
+// UIDFetch. Parsing follows the LazyBodyStructure and NoParsedHeaders
+// options of opts; with nil opts, everything is parsed. Servers may send the data items of a message in any order and
+// split them across several FETCH responses, such as Exchange sending
+// FLAGS apart from the rest, or report a flag change of a fetched message
+// while the command runs; the responses of each message are merged into
+// one result, in the order the messages first appeared. Items sent again
+// replace the earlier value.
+func parseHeaderFetches(lines []string, opts *Options) []*imap.FetchMessageBuffer {
+	if opts == nil {
+		opts = &Options{}
+	}
+	var msgs []*imap.FetchMessageBuffer
+	bySeq := make(map[uint32]*imap.FetchMessageBuffer)
+	for _, line := range lines {
+		seqNum, items, ok := splitFetchResponse(strings.TrimPrefix(line, "FETCH "))
+		if !ok {
+			continue
+		}
+		msg := bySeq[seqNum]
+		if msg == nil {
+			msg = &imap.FetchMessageBuffer{SeqNum: seqNum}
+			bySeq[seqNum] = msg
+			msgs = append(msgs, msg)
+		}
+		parseFetchItems(msg, items, opts)
+	}
+	return msgs
+}
+
+// splitFetchResponse splits `seq (item value ...)` into the sequence
+// number and the data items.
+func splitFetchResponse(s string) (uint32, string, bool) {
+	seq, rest, ok := strings.Cut(s, " ")
+	if !ok {
+		return 0, "", false
+	}
+	num, err := strconv.ParseUint(seq, 10, 32)
+	if err != nil {
+		return 0, "", false
+	}
+	return uint32(num), rest, true
+}
+
+// parseFetchItems parses the parenthesized data items of a FETCH response
+// into msg. It understands UID, FLAGS, INTERNALDATE, RFC822.SIZE, MODSEQ,
+// EMAILID, THREADID, PREVIEW, BODYSTRUCTURE, BODY and BODY[section];
+// other items are skipped.
+func parseFetchItems(msg *imap.FetchMessageBuffer, rest string, opts *Options) {
+	rest = strings.TrimLeft(rest, " ")
+	if !strings.HasPrefix(rest, "(") {
+		return
+	}
+	rest = rest[1:]
+	for {
+		rest = strings.TrimLeft(rest, " ")
+		if rest == "" || rest[0] == ')' {
+			return
+		}
+
+		var name string
+		name, rest = readFetchItemName(rest)
+		rest = strings.TrimLeft(rest, " ")
+		upper := strings.ToUpper(name)
+
+		switch {
+		case upper == "FLAGS":
+			var list string
+			list, rest = extractParenthesized(rest)
+			msg.Flags = parseFlagList(list)
+		case upper == "MODSEQ":
+			var list string
+			list, rest = extractParenthesized(rest)
+			msg.ModSeq, _ = strconv.ParseUint(strings.TrimSpace(list), 10, 64)
+		case strings.HasPrefix(upper, "BODY[") || strings.HasPrefix(upper, "BINARY["):
+			var value []byte
+			value, rest = readNString(rest)
+			// The partial suffix of BODY[]<0> is not part of the section.
+			section := name[strings.IndexByte(name, '[')+1 : strings.LastIndexByte(name, ']')]
+			if msg.BodySection == nil {
+				msg.BodySection = make(map[string][]byte)
+			}
+			_, seen := msg.BodySection[section]
+			msg.BodySection[section] = value
+			if isHeaderSection(section) && !seen && !opts.NoParsedHeaders {
+				msg.Header = mergeHeader(msg.Header, parseHeaderBlock(value))
+			}
+		case upper == "BODYSTRUCTURE" || upper == "BODY":
+			var raw string
+			raw, rest = readValue(rest)
+			if opts.LazyBodyStructure {
+				msg.BodyStructure = nil
+				msg.RawBodyStructure = raw
+			} else if bs, err := imap.ParseBodyStructure(raw); err == nil {
+				msg.BodyStructure = bs
+			}
+		case upper == "PREVIEW":
+			var value []byte
+			value, rest = readNString(rest)
+			msg.Preview, msg.PreviewNIL = string(value), value == nil
+		case upper == "EMAILID" || upper == "THREADID":
+			// THREADID is NIL for messages without a thread ID.
+			var id string
+			if strings.HasPrefix(rest, "(") {
+				id, rest = extractParenthesized(rest)
+			} else {
+				_, rest = readQuotedOrAtom(rest)
+			}
+			if upper == "EMAILID" {
+				msg.EmailID = strings.TrimSpace(id)
+			} else {
+				msg.ThreadID = strings.TrimSpace(id)
+			}
+		default:
+			var value string
+			if strings.HasPrefix(rest, "(") {
+				_, rest = extractParenthesized(rest)
+				continue
+			}
+			value, rest = readQuotedOrAtom(rest)
+			switch upper {
+			case "UID":
+				uid, _ := strconv.ParseUint(value, 10, 32)
+				msg.UID = imap.UID(uid)
+			case "RFC822.SIZE":
+				msg.RFC822Size, _ = strconv.ParseInt(value, 10, 64)
+			case "INTERNALDATE":
+				msg.InternalDate = parseInternalDate(value)
+			}
+		}
+	}
+}
+
+// parseFlagList parses the flags of a FLAGS data item. Flags are atoms,
+// but quoted flags, which some servers send, are unquoted.
+func parseFlagList(list string) []imap.Flag {
+	var flags []imap.Flag
+	for _, f := range strings.Fields(list) {
+		if len(f) >= 2 && f[0] == '"' && f[len(f)-1] == '"' {
+			f = strings.NewReplacer(`\\`, `\`, `\"`, `"`).Replace(f[1 : len(f)-1])
+		}
+		flags = append(flags, imap.Flag(f))
+	}
+	return flags
+}
+
+// parseInternalDate parses an INTERNALDATE value. Days below 10 are
+// padded with a space, but some servers use a zero or no padding.
+func parseInternalDate(s string) time.Time {
+	for _, layout := range []string{"_2-Jan-2006 15:04:05 -0700", imap.InternalDateLayout, "2-Jan-2006 15:04:05 -0700"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// readFetchItemName reads a data item name. Section specifiers such as
+// BODY[HEADER.FIELDS (SUBJECT FROM)] and partial suffixes such as <0> are
+// part of the name.
+func readFetchItemName(s string) (string, string) {
+	i := 0
+	for i < len(s) && s[i] != ' ' && s[i] != '(' && s[i] != ')' {
+		if s[i] == '[' {
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return s, ""
+			}
+			i += end
+		}
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// readValue reads a value of any kind, such as a parenthesized list
+// holding strings and literals, and returns it unparsed.
+func readValue(s string) (string, string) {
+	depth := 0
+	i := 0
+	for i < len(s) {
+		switch c := s[i]; {
+		case c == '(':
+			depth++
+			i++
+		case c == ')':
+			if depth == 0 {
+				return s[:i], s[i:]
+			}
+			depth--
+			i++
+			if depth == 0 {
+				return s[:i], s[i:]
+			}
+		case c == '"':
+			_, rest := readQuotedOrAtom(s[i:])
+			i = len(s) - len(rest)
+		case c == '{' || c == '~':
+			_, rest := readNString(s[i:])
+			if rest == "" {
+				return s, ""
+			}
+			i = len(s) - len(rest)
+		case c == ' ' && depth == 0:
+			return s[:i], s[i:]
+		default:
+			i++
+		}
+	}
+	return s, ""
+}
+
+// readNString reads a literal, quoted string or NIL.
+func readNString(s string) ([]byte, string) {
+	if strings.HasPrefix(s, "~{") {
+		s = s[1:]
+	}
+	if strings.HasPrefix(s, "{") {
+		end := strings.Index(s, "}\r\n")
+		if end < 0 {
+			return nil, ""
+		}
+		size, err := strconv.Atoi(strings.TrimSuffix(s[1:end], "+"))
+		start := end + 3
+		if err != nil || size < 0 || start+size > len(s) {
+			return nil, ""
+		}
+		return []byte(s[start : start+size]), s[start+size:]
+	}
+	value, rest := readQuotedOrAtom(s)
+	if !strings.HasPrefix(s, "\"") && strings.EqualFold(value, "NIL") {
+		return nil, rest
+	}
+	return []byte(value), rest
+}
+
+// isHeaderSection reports whether a section specifier returns a header
+// block, such as HEADER, HEADER.FIELDS (...) or 1.HEADER.
+func isHeaderSection(section string) bool {
+	upper := strings.ToUpper(section)
+	if i := strings.IndexByte(upper, ' '); i >= 0 {
+		upper = upper[:i]
+	}
+	return upper == "HEADER" || strings.HasSuffix(upper, ".HEADER") ||
+		strings.HasSuffix(upper, "HEADER.FIELDS") || strings.HasSuffix(upper, "HEADER.FIELDS.NOT")
+}
+
+// parseHeaderBlock parses a raw header block. Fields that cannot be parsed
+// are dropped.
+func parseHeaderBlock(b []byte) textproto.MIMEHeader {
+	if !bytes.HasSuffix(b, []byte("\r\n\r\n")) {
+		b = append(bytes.TrimRight(b, "\r\n"), "\r\n\r\n"...)
+	}
+	h, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(b))).ReadMIMEHeader()
+	if err != nil && err != io.EOF && h == nil {
+		return textproto.MIMEHeader{}
+	}
+	return h
+}
+
+// mergeHeader adds the fields of src to dst and returns dst.
+func mergeHeader(dst, src textproto.MIMEHeader) textproto.MIMEHeader {
+	if dst == nil {
+		return src
+	}
+	for k, v := range src {
+		dst[k] = append(dst[k], v...)
+	}
+	return dst
+}
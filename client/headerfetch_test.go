@@ -0,0 +1,212 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestFetchHeaders(t *testing.T) {
+	header1 := "Subject: Hello\r\nFrom: Alice <alice@example.com>\r\nList-Id: <dev.example.com>\r\n\r\n"
+	header2 := "Subject: =?utf-8?q?Caf=C3=A9?=\r\n\r\n"
+
+	var gotCmd string
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		gotCmd = cmd
+		fmt.Fprintf(w, "* 1 FETCH (UID 10 FLAGS (\\Seen) RFC822.SIZE 120 BODY[HEADER.FIELDS (SUBJECT FROM LIST-ID)] {%d}\r\n%s)\r\n", len(header1), header1)
+		fmt.Fprintf(w, "* 2 FETCH (UID 11 FLAGS () RFC822.SIZE 80 BODY[HEADER.FIELDS (SUBJECT FROM LIST-ID)] \"%s\")\r\n", strings.ReplaceAll(header2, "\r\n", ""))
+		fmt.Fprintf(w, "%s OK FETCH completed\r\n", tag)
+	})
+
+	msgs, err := c.FetchHeaders("1:2", "subject", "FROM", "List-Id")
+	if err != nil {
+		t.Fatalf("FetchHeaders() error: %v", err)
+	}
+	if want := "FETCH 1:2 (UID FLAGS RFC822.SIZE BODY.PEEK[HEADER.FIELDS (Subject From List-Id)])"; gotCmd != want {
+		t.Errorf("command = %q, want %q", gotCmd, want)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want 2", len(msgs))
+	}
+
+	m := msgs[0]
+	if m.SeqNum != 1 || m.UID != 10 || m.RFC822Size != 120 {
+		t.Errorf("msg 1 = seq %d uid %d size %d", m.SeqNum, m.UID, m.RFC822Size)
+	}
+	if len(m.Flags) != 1 || m.Flags[0] != imap.FlagSeen {
+		t.Errorf("msg 1 flags = %v", m.Flags)
+	}
+	if got := m.Header.Get("Subject"); got != "Hello" {
+		t.Errorf("Subject = %q, want %q", got, "Hello")
+	}
+	if got := m.Header.Get("From"); got != "Alice <alice@example.com>" {
+		t.Errorf("From = %q", got)
+	}
+	if got := m.Header.Get("List-Id"); got != "<dev.example.com>" {
+		t.Errorf("List-Id = %q", got)
+	}
+	if got := string(m.BodySection["HEADER.FIELDS (SUBJECT FROM LIST-ID)"]); got != header1 {
+		t.Errorf("raw section = %q, want %q", got, header1)
+	}
+
+	m = msgs[1]
+	if m.UID != 11 || len(m.Flags) != 0 {
+		t.Errorf("msg 2 = uid %d flags %v", m.UID, m.Flags)
+	}
+	if got := m.Header.Get("Subject"); got != "=?utf-8?q?Caf=C3=A9?=" {
+		t.Errorf("Subject = %q", got)
+	}
+	if got := m.Header.Get("From"); got != "" {
+		t.Errorf("From = %q, want empty", got)
+	}
+}
+
+func TestUIDFetchHeaders_NoMatchingFields(t *testing.T) {
+	var gotCmd string
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		gotCmd = cmd
+		fmt.Fprintf(w, "* 3 FETCH (UID 42 BODY[HEADER.FIELDS (X-PRIORITY)] {2}\r\n\r\n FLAGS (\\Flagged))\r\n")
+		fmt.Fprintf(w, "%s OK UID FETCH completed\r\n", tag)
+	})
+
+	msgs, err := c.UIDFetchHeaders("42", "X-Priority")
+	if err != nil {
+		t.Fatalf("UIDFetchHeaders() error: %v", err)
+	}
+	if !strings.HasPrefix(gotCmd, "UID FETCH 42 ") {
+		t.Errorf("command = %q", gotCmd)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages, want 1", len(msgs))
+	}
+	m := msgs[0]
+	if m.SeqNum != 3 || m.UID != 42 {
+		t.Errorf("seq %d uid %d", m.SeqNum, m.UID)
+	}
+	if len(m.Header) != 0 {
+		t.Errorf("Header = %v, want empty", m.Header)
+	}
+	if len(m.Flags) != 1 || m.Flags[0] != imap.FlagFlagged {
+		t.Errorf("flags = %v", m.Flags)
+	}
+}
+
+func TestFetchHeaders_Error(t *testing.T) {
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		fmt.Fprintf(w, "%s NO no mailbox selected\r\n", tag)
+	})
+
+	if _, err := c.FetchHeaders("1", "Subject"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestUIDFetchMessages_InternalDate(t *testing.T) {
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		fmt.Fprintf(w, "* 1 FETCH (UID 7 INTERNALDATE \" 2-Mar-2024 10:00:00 +0100\" BODY[] {2}\r\nhi)\r\n")
+		fmt.Fprintf(w, "%s OK UID FETCH completed\r\n", tag)
+	})
+
+	msgs, err := c.UIDFetchMessages("7", "(UID INTERNALDATE BODY.PEEK[])")
+	if err != nil {
+		t.Fatalf("UIDFetchMessages() error: %v", err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages, want 1", len(msgs))
+	}
+	want := time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC)
+	if m := msgs[0]; !m.InternalDate.Equal(want) || string(m.BodySection[""]) != "hi" {
+		t.Errorf("date %v body %q", m.InternalDate, m.BodySection[""])
+	}
+}
+
+func TestParseFlagList(t *testing.T) {
+	got := parseFlagList(`\Seen "\\Flagged" $Label1`)
+	want := []imap.Flag{imap.FlagSeen, imap.FlagFlagged, "$Label1"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("parseFlagList() = %v, want %v", got, want)
+	}
+}
+
+func TestUIDFetchMessages_ObjectIDs(t *testing.T) {
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		fmt.Fprintf(w, "* 1 FETCH (UID 7 EMAILID (M6d99ac3275bb4e) THREADID (T64b478a75b7ea9))\r\n")
+		fmt.Fprintf(w, "* 2 FETCH (UID 8 THREADID NIL EMAILID (Ma7f3b1f7e1c2d0) FLAGS (\\Seen))\r\n")
+		fmt.Fprintf(w, "%s OK UID FETCH completed\r\n", tag)
+	})
+
+	msgs, err := c.UIDFetchMessages("7:8", "(UID EMAILID THREADID)")
+	if err != nil {
+		t.Fatalf("UIDFetchMessages() error: %v", err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want 2", len(msgs))
+	}
+	if m := msgs[0]; m.EmailID != "M6d99ac3275bb4e" || m.ThreadID != "T64b478a75b7ea9" {
+		t.Errorf("message 1: EMAILID %q, THREADID %q", m.EmailID, m.ThreadID)
+	}
+	if m := msgs[1]; m.EmailID != "Ma7f3b1f7e1c2d0" || m.ThreadID != "" || len(m.Flags) != 1 {
+		t.Errorf("message 2: EMAILID %q, THREADID %q, flags %v", m.EmailID, m.ThreadID, m.Flags)
+	}
+}
+
+func TestUIDFetchMessages_GmailOrder(t *testing.T) {
+	// Gmail puts extension items first and UID after the message body.
+	body := "Subject: Hi\r\n\r\nhello\r\n"
+	c := newScriptedClient(t, "* OK Gimap ready", func(w io.Writer, tag, cmd string) {
+		fmt.Fprintf(w, "* 3 FETCH (X-GM-THRID 1785012376540183405 X-GM-MSGID 1785012376540183405 X-GM-LABELS (\\Inbox \"\\\\Important\") BODY[] {%d}\r\n%s UID 41 FLAGS (\\Seen) MODSEQ (912345))\r\n", len(body), body)
+		fmt.Fprintf(w, "* 4 FETCH (X-GM-THRID 1785012376540183406 X-GM-MSGID 1785012376540183406 X-GM-LABELS () BODY[] {%d}\r\n%s UID 42 FLAGS ())\r\n", len(body), body)
+		fmt.Fprintf(w, "%s OK Success\r\n", tag)
+	})
+
+	msgs, err := c.UIDFetchMessages("41:42", "(UID FLAGS MODSEQ X-GM-LABELS BODY.PEEK[])")
+	if err != nil {
+		t.Fatalf("UIDFetchMessages() error: %v", err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want 2", len(msgs))
+	}
+	if m := msgs[0]; m.UID != 41 || len(m.Flags) != 1 || m.ModSeq != 912345 || string(m.BodySection[""]) != body {
+		t.Errorf("message 1 = uid %d flags %v modseq %d body %q", m.UID, m.Flags, m.ModSeq, m.BodySection[""])
+	}
+	if m := msgs[1]; m.UID != 42 || len(m.Flags) != 0 {
+		t.Errorf("message 2 = uid %d flags %v", m.UID, m.Flags)
+	}
+}
+
+func TestUIDFetchMessages_ExchangeSplit(t *testing.T) {
+	// Exchange reports the \Seen flag set by fetching a body in a FETCH
+	// response of its own, and may interleave the messages.
+	c := newScriptedClient(t, "* OK The Microsoft Exchange IMAP4 service is ready.", func(w io.Writer, tag, cmd string) {
+		fmt.Fprintf(w, "* 1 FETCH (UID 100 RFC822.SIZE 2048)\r\n")
+		fmt.Fprintf(w, "* 2 FETCH (UID 101 RFC822.SIZE 4096)\r\n")
+		fmt.Fprintf(w, "* 1 FETCH (BODY[HEADER] {16}\r\nSubject: One\r\n\r\n UID 100)\r\n")
+		fmt.Fprintf(w, "* 1 FETCH (FLAGS (\\Seen))\r\n")
+		fmt.Fprintf(w, "* 2 FETCH (UID 101 BODY[HEADER] {16}\r\nSubject: Two\r\n\r\n FLAGS (\\Seen \\Flagged))\r\n")
+		fmt.Fprintf(w, "* 2 FETCH (BODY[]<0> {4}\r\nSubj UID 101)\r\n")
+		fmt.Fprintf(w, "%s OK FETCH completed.\r\n", tag)
+	})
+
+	msgs, err := c.UIDFetchMessages("100:101", "(UID RFC822.SIZE BODY[HEADER] BODY[]<0.4>)")
+	if err != nil {
+		t.Fatalf("UIDFetchMessages() error: %v", err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want 2", len(msgs))
+	}
+	m := msgs[0]
+	if m.SeqNum != 1 || m.UID != 100 || m.RFC822Size != 2048 || len(m.Flags) != 1 || m.Header.Get("Subject") != "One" {
+		t.Errorf("message 1 = seq %d uid %d size %d flags %v subject %q", m.SeqNum, m.UID, m.RFC822Size, m.Flags, m.Header.Get("Subject"))
+	}
+	m = msgs[1]
+	if m.SeqNum != 2 || m.UID != 101 || m.RFC822Size != 4096 || len(m.Flags) != 2 || m.Header.Get("Subject") != "Two" {
+		t.Errorf("message 2 = seq %d uid %d size %d flags %v subject %q", m.SeqNum, m.UID, m.RFC822Size, m.Flags, m.Header.Get("Subject"))
+	}
+	if got := string(m.BodySection[""]); got != "Subj" {
+		t.Errorf("partial body = %q, want %q", got, "Subj")
+	}
+}
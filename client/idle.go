@@ -1,55 +1,270 @@
 package client
 
-import "strings"
+import (
+	"strings"
+	"sync"
+)
 
 // IdleCommand represents an in-progress IDLE command.
 type IdleCommand struct {
-	tag    string
 	client *Client
-	cmd    *pendingCommand
+
+	// interruptMu is held by a command interrupting IDLE until IDLE is
+	// restarted.
+	interruptMu sync.Mutex
+
+	mu  sync.Mutex
+	cmd *pendingCommand
+	// stopping is set once Done was called.
+	stopping bool
+	// paused receives the result of the IDLE command ended by an
+	// interruption, and resumed the IDLE command restarting it, or nil if
+	// it was not restarted.
+	paused  chan *commandResult
+	resumed chan *pendingCommand
+	// resumeErr is the error restarting IDLE after an interruption.
+	resumeErr error
+	// batching is set while pauseFor runs its function, during which
+	// interruptions share its break; batchUsers counts them, and
+	// batchDone is signalled when the last one ends.
+	batching   bool
+	batchUsers int
+	batchDone  *sync.Cond
+
+	done chan struct{}
+	err  error
 }
 
 // Idle starts an IDLE command. Call Done() on the returned IdleCommand to stop.
+//
+// Status, Append and MultiAppend can be used while IDLE is in progress,
+// for example to check other mailboxes while waiting for changes to the
+// selected one: they end IDLE with DONE, run, and start IDLE again, which
+// leaves the selected mailbox untouched. The IdleCommand stays in progress
+// across such interruptions. Other commands fail with ErrCommandInProgress
+// until Done is called; IdleWithBreaks runs them in breaks of IDLE.
 func (c *Client) Idle() (*IdleCommand, error) {
+	cmd, err := c.startIdle()
+	if err != nil {
+		return nil, err
+	}
+
+	ic := &IdleCommand{
+		client:  c,
+		cmd:     cmd,
+		resumed: make(chan *pendingCommand),
+		done:    make(chan struct{}),
+	}
+	ic.batchDone = sync.NewCond(&ic.mu)
+	c.mu.Lock()
+	c.idle = ic
+	c.mu.Unlock()
+	go ic.run(cmd)
+	return ic, nil
+}
+
+// startIdle sends IDLE and waits for the server to accept it.
+func (c *Client) startIdle() (*pendingCommand, error) {
 	tag := c.tags.Next()
-	cmd := c.pending.Add(tag)
 
 	var line strings.Builder
 	line.WriteString(tag)
 	line.WriteString(" IDLE\r\n")
 
-	c.encoder.RawString(line.String())
-	if err := c.encoder.Flush(); err != nil {
-		c.pending.Complete(tag, &commandResult{err: err})
+	cmd, err := c.send(tag, "IDLE", line.String(), true)
+	if err != nil {
 		return nil, err
 	}
 
 	// Wait for continuation request
 	if _, err := c.waitForContinuation(cmd); err != nil {
+		c.release()
 		return nil, err
 	}
-
-	return &IdleCommand{
-		tag:    tag,
-		client: c,
-		cmd:    cmd,
-	}, nil
+	return cmd, nil
 }
 
-// Wait blocks until the IDLE command completes or is stopped.
+// Wait blocks until the IDLE command completes or is stopped. It may be
+// called any number of times: the connection is released once, by run,
+// when the command completes, so a later Wait does not release the
+// connection held by another command.
 func (ic *IdleCommand) Wait() error {
-	result := <-ic.cmd.done
-	if err := commandResultError(result); err != nil {
-		return err
-	}
-	return nil
+	<-ic.done
+	return ic.err
 }
 
 // Done sends the DONE command to stop IDLE.
 func (ic *IdleCommand) Done() error {
-	ic.client.encoder.RawString("DONE\r\n")
-	if err := ic.client.encoder.Flush(); err != nil {
-		return err
+	ic.mu.Lock()
+	ic.stopping = true
+	// An interrupted IDLE command is not restarted; see restart.
+	interrupted := ic.paused != nil
+	ic.mu.Unlock()
+
+	select {
+	case <-ic.done:
+	default:
+		if !interrupted {
+			if err := ic.client.writeContinuation([]byte("DONE\r\n")); err != nil {
+				return err
+			}
+		}
 	}
 	return ic.Wait()
 }
+
+// run waits for the IDLE command to complete, following it across
+// interruptions.
+func (ic *IdleCommand) run(cmd *pendingCommand) {
+	for {
+		result := <-cmd.done
+		ic.mu.Lock()
+		paused := ic.paused
+		ic.mu.Unlock()
+		if paused == nil {
+			ic.client.release()
+			ic.finish(commandResultError(result))
+			return
+		}
+
+		paused <- result
+		if cmd = <-ic.resumed; cmd == nil {
+			ic.mu.Lock()
+			err := ic.resumeErr
+			ic.mu.Unlock()
+			ic.finish(err)
+			return
+		}
+	}
+}
+
+// finish ends the IDLE command with err.
+func (ic *IdleCommand) finish(err error) {
+	c := ic.client
+	c.mu.Lock()
+	if c.idle == ic {
+		c.idle = nil
+	}
+	c.mu.Unlock()
+	ic.err = err
+	close(ic.done)
+}
+
+// interruptIdle ends the IDLE command in progress, if any, so that a
+// command that does not depend on the selected mailbox can be sent, and
+// returns the function starting it again, to be called once that command
+// completed.
+func (c *Client) interruptIdle() (resume func()) {
+	c.mu.Lock()
+	ic := c.idle
+	c.mu.Unlock()
+	if ic == nil {
+		return func() {}
+	}
+	return ic.interrupt()
+}
+
+func (ic *IdleCommand) interrupt() (resume func()) {
+	ic.mu.Lock()
+	if ic.batching {
+		// IDLE is already ended for pauseFor, which restarts it once
+		// this command completed.
+		ic.batchUsers++
+		ic.mu.Unlock()
+		return func() {
+			ic.mu.Lock()
+			if ic.batchUsers--; ic.batchUsers == 0 {
+				ic.batchDone.Broadcast()
+			}
+			ic.mu.Unlock()
+		}
+	}
+	ic.mu.Unlock()
+
+	ic.interruptMu.Lock()
+	ic.mu.Lock()
+	select {
+	case <-ic.done:
+		ic.stopping = true
+	default:
+	}
+	if ic.stopping {
+		ic.mu.Unlock()
+		ic.interruptMu.Unlock()
+		return func() {}
+	}
+	paused := make(chan *commandResult, 1)
+	ic.paused = paused
+	ic.mu.Unlock()
+
+	// If DONE cannot be written, the connection is gone and the IDLE
+	// command completes with the disconnect error.
+	_ = ic.client.writeContinuation([]byte("DONE\r\n"))
+	result := <-paused
+	ic.client.release()
+	if err := commandResultError(result); err != nil {
+		ic.resume(nil, err)
+		ic.interruptMu.Unlock()
+		return func() {}
+	}
+	return func() {
+		defer ic.interruptMu.Unlock()
+		ic.restart()
+	}
+}
+
+// pauseFor ends the IDLE command in progress, calls run, and starts IDLE
+// again once run and the commands that interrupted IDLE while it ran
+// completed. Commands that interrupt IDLE while run runs, such as Status,
+// do not end and restart it themselves.
+func (ic *IdleCommand) pauseFor(run func()) {
+	resume := ic.interrupt()
+	ic.mu.Lock()
+	ic.batching = true
+	ic.mu.Unlock()
+
+	run()
+
+	ic.mu.Lock()
+	ic.batching = false
+	for ic.batchUsers > 0 {
+		ic.batchDone.Wait()
+	}
+	ic.mu.Unlock()
+	resume()
+}
+
+// restart starts IDLE again after an interruption, unless Done was called
+// in the meantime.
+func (ic *IdleCommand) restart() {
+	ic.mu.Lock()
+	stopping := ic.stopping
+	ic.mu.Unlock()
+	if stopping {
+		ic.resume(nil, nil)
+		return
+	}
+
+	cmd, err := ic.client.startIdle()
+	if stop := ic.resume(cmd, err); stop {
+		// Done was called while IDLE was restarting, without sending
+		// DONE.
+		_ = ic.client.writeContinuation([]byte("DONE\r\n"))
+	}
+}
+
+// resume hands the restarted IDLE command, or nil and the error that
+// prevented restarting it, to run. It reports whether the restarted
+// command must be stopped.
+func (ic *IdleCommand) resume(cmd *pendingCommand, err error) (stop bool) {
+	ic.mu.Lock()
+	ic.paused = nil
+	ic.resumeErr = err
+	if cmd != nil {
+		ic.cmd = cmd
+	}
+	stop = ic.stopping && cmd != nil
+	ic.mu.Unlock()
+	ic.resumed <- cmd
+	return stop
+}
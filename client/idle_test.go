@@ -0,0 +1,165 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// idleInterruptServer answers IDLE, STATUS and APPEND, recording the commands it
+// receives.
+type idleInterruptServer struct {
+	mu       sync.Mutex
+	idleTag  string
+	commands []string
+}
+
+func (s *idleInterruptServer) respond(w io.Writer, tag, cmd string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name, _, _ := strings.Cut(cmd, " ")
+	switch {
+	case tag == "DONE":
+		s.commands = append(s.commands, "DONE")
+		fmt.Fprintf(w, "%s OK IDLE terminated\r\n", s.idleTag)
+	case name == "IDLE":
+		s.commands = append(s.commands, "IDLE")
+		s.idleTag = tag
+		fmt.Fprint(w, "+ idling\r\n")
+	case name == "STATUS":
+		s.commands = append(s.commands, "STATUS")
+		fmt.Fprint(w, "* STATUS Archive (MESSAGES 7)\r\n")
+		fmt.Fprintf(w, "%s OK STATUS completed\r\n", tag)
+	case name == "APPEND":
+		s.commands = append(s.commands, "APPEND")
+		s.idleTag = tag // the literal line is answered below
+		fmt.Fprint(w, "+ go ahead\r\n")
+	case strings.HasPrefix(tag, "Subject:"):
+		fmt.Fprintf(w, "%s OK [APPENDUID 1 9] APPEND completed\r\n", s.idleTag)
+	default:
+		s.commands = append(s.commands, name)
+		fmt.Fprintf(w, "%s OK %s completed\r\n", tag, name)
+	}
+}
+
+func (s *idleInterruptServer) log() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.Join(s.commands, " ")
+}
+
+func TestIdle_StatusInterrupts(t *testing.T) {
+	s := &idleInterruptServer{}
+	c := newScriptedClient(t, "* OK ready", s.respond)
+
+	idle, err := c.Idle()
+	if err != nil {
+		t.Fatalf("Idle() error: %v", err)
+	}
+	waited := make(chan error, 1)
+	go func() { waited <- idle.Wait() }()
+
+	data, err := c.Status("Archive", &imap.StatusOptions{NumMessages: true})
+	if err != nil {
+		t.Fatalf("Status() during IDLE error: %v", err)
+	}
+	if data.NumMessages == nil || *data.NumMessages != 7 {
+		t.Errorf("Status() = %+v, want 7 messages", data)
+	}
+	select {
+	case err := <-waited:
+		t.Fatalf("Wait() returned %v after an interruption", err)
+	default:
+	}
+
+	if err := idle.Done(); err != nil {
+		t.Fatalf("Done() error: %v", err)
+	}
+	if err := <-waited; err != nil {
+		t.Errorf("Wait() error: %v", err)
+	}
+	if got, want := s.log(), "IDLE DONE STATUS IDLE DONE"; got != want {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+	if err := c.Noop(); err != nil {
+		t.Errorf("Noop() after IDLE error: %v", err)
+	}
+}
+
+func TestIdle_AppendInterrupts(t *testing.T) {
+	s := &idleInterruptServer{}
+	c := newScriptedClient(t, "* OK ready", s.respond)
+
+	idle, err := c.Idle()
+	if err != nil {
+		t.Fatalf("Idle() error: %v", err)
+	}
+	data, err := c.Append("Sent", nil, []byte("Subject: hi"))
+	if err != nil {
+		t.Fatalf("Append() during IDLE error: %v", err)
+	}
+	if data.UID != 9 {
+		t.Errorf("Append() UID = %d, want 9", data.UID)
+	}
+	if err := idle.Done(); err != nil {
+		t.Fatalf("Done() error: %v", err)
+	}
+	if got, want := s.log(), "IDLE DONE APPEND IDLE DONE"; got != want {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+}
+
+func TestIdle_StatusAfterDone(t *testing.T) {
+	s := &idleInterruptServer{}
+	c := newScriptedClient(t, "* OK ready", s.respond)
+
+	idle, err := c.Idle()
+	if err != nil {
+		t.Fatalf("Idle() error: %v", err)
+	}
+	if err := idle.Done(); err != nil {
+		t.Fatalf("Done() error: %v", err)
+	}
+	if _, err := c.Status("Archive", &imap.StatusOptions{NumMessages: true}); err != nil {
+		t.Fatalf("Status() error: %v", err)
+	}
+	if got, want := s.log(), "IDLE DONE STATUS"; got != want {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+}
+
+func TestIdle_WaitAgainKeepsLaterCommandExclusive(t *testing.T) {
+	s := &idleInterruptServer{}
+	c := newScriptedClient(t, "* OK ready", s.respond)
+
+	first, err := c.Idle()
+	if err != nil {
+		t.Fatalf("Idle() error: %v", err)
+	}
+	if err := first.Done(); err != nil {
+		t.Fatalf("Done() error: %v", err)
+	}
+	second, err := c.Idle()
+	if err != nil {
+		t.Fatalf("second Idle() error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := first.Wait(); err != nil {
+			t.Fatalf("Wait() error: %v", err)
+		}
+	}
+	if err := c.Noop(); !errors.Is(err, ErrCommandInProgress) {
+		t.Errorf("Noop() during second IDLE error = %v, want ErrCommandInProgress", err)
+	}
+	if err := second.Done(); err != nil {
+		t.Fatalf("second Done() error: %v", err)
+	}
+	if err := c.Noop(); err != nil {
+		t.Errorf("Noop() after IDLE error = %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrIdleBreakerClosed is returned by IdleBreaker.Do once the breaker is
+// closed.
+var ErrIdleBreakerClosed = errors.New("imap: idle breaker closed")
+
+// IdleBreakOptions controls when an IdleBreaker breaks IDLE.
+type IdleBreakOptions struct {
+	// MinIdle is the minimum time IDLE runs before it is broken, so that
+	// commands queued in quick succession are run together in one break
+	// rather than each ending and restarting IDLE. 0 breaks IDLE as soon
+	// as a command is queued.
+	MinIdle time.Duration
+
+	// MaxBatch is the maximum number of functions run in one break; the
+	// others wait for the next break, after MinIdle, so that a steady
+	// stream of commands does not keep the connection out of IDLE and
+	// delay the notifications of the server. 0 runs all queued functions.
+	MaxBatch int
+}
+
+// IdleBreaker keeps a connection in IDLE and runs commands on it in
+// breaks of IDLE: IDLE is ended with DONE, a batch of queued functions
+// runs, and IDLE starts again. It lets one connection watch the selected
+// mailbox and check other mailboxes, with STATUS, or fetch messages,
+// where a second connection would be too expensive.
+//
+// Functions run one at a time, in the order they were queued. While a
+// function runs, the connection is not in IDLE, so it can use any
+// command; the selected mailbox must stay selected, as IDLE resumes on
+// it.
+type IdleBreaker struct {
+	idle *IdleCommand
+	opts IdleBreakOptions
+
+	mu     sync.Mutex
+	queue  []*idleJob
+	closed bool
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// idleJob is a function queued on an IdleBreaker.
+type idleJob struct {
+	fn   func() error
+	err  error
+	done chan struct{}
+}
+
+// IdleWithBreaks starts IDLE, like Idle, and returns an IdleBreaker to run
+// commands in breaks of it. opts may be nil. Call Close to stop IDLE.
+func (c *Client) IdleWithBreaks(opts *IdleBreakOptions) (*IdleBreaker, error) {
+	ic, err := c.Idle()
+	if err != nil {
+		return nil, err
+	}
+	b := &IdleBreaker{
+		idle: ic,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if opts != nil {
+		b.opts = *opts
+	}
+	go b.run()
+	return b, nil
+}
+
+// Idle returns the IDLE command of the breaker, to wait for it to end.
+func (b *IdleBreaker) Idle() *IdleCommand {
+	return b.idle
+}
+
+// Do queues fn to run in the next break of IDLE and waits for it to run.
+// It returns the error of fn, or ErrIdleBreakerClosed if the breaker was
+// closed before fn ran.
+func (b *IdleBreaker) Do(fn func() error) error {
+	job := &idleJob{fn: fn, done: make(chan struct{})}
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrIdleBreakerClosed
+	}
+	b.queue = append(b.queue, job)
+	b.mu.Unlock()
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	<-job.done
+	return job.err
+}
+
+// Close stops running queued functions, failing those that have not run
+// with ErrIdleBreakerClosed, and ends IDLE with Done, whose error it
+// returns.
+func (b *IdleBreaker) Close() error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.stop)
+	}
+	b.mu.Unlock()
+	<-b.done
+	return b.idle.Done()
+}
+
+// run breaks IDLE for the queued functions until the breaker is closed.
+func (b *IdleBreaker) run() {
+	defer close(b.done)
+	defer b.failQueued()
+
+	idleSince := time.Now()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-b.wake:
+		}
+		if d := b.opts.MinIdle - time.Since(idleSince); d > 0 {
+			timer := time.NewTimer(d)
+			select {
+			case <-b.stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		batch := b.takeBatch()
+		if len(batch) == 0 {
+			continue
+		}
+		b.idle.pauseFor(func() {
+			for _, job := range batch {
+				job.err = job.fn()
+				close(job.done)
+			}
+		})
+		idleSince = time.Now()
+
+		b.mu.Lock()
+		more := len(b.queue) > 0
+		b.mu.Unlock()
+		if more {
+			select {
+			case b.wake <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// takeBatch removes the functions to run in the next break from the
+// queue.
+func (b *IdleBreaker) takeBatch() []*idleJob {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(b.queue)
+	if b.opts.MaxBatch > 0 && n > b.opts.MaxBatch {
+		n = b.opts.MaxBatch
+	}
+	batch := b.queue[:n:n]
+	b.queue = b.queue[n:]
+	return batch
+}
+
+// failQueued fails the functions that have not run.
+func (b *IdleBreaker) failQueued() {
+	b.mu.Lock()
+	queue := b.queue
+	b.queue = nil
+	b.closed = true
+	b.mu.Unlock()
+	for _, job := range queue {
+		job.err = ErrIdleBreakerClosed
+		close(job.done)
+	}
+}
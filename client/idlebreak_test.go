@@ -0,0 +1,104 @@
+package client
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// runBreaks queues n functions on b at once, each running STATUS, and
+// waits for them.
+func runBreaks(t *testing.T, c *Client, b *IdleBreaker, n int) {
+	t.Helper()
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- b.Do(func() error {
+				_, err := c.Status("Archive", &imap.StatusOptions{NumMessages: true})
+				return err
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Do() error: %v", err)
+		}
+	}
+}
+
+func TestIdleBreaker_Batch(t *testing.T) {
+	s := &idleInterruptServer{}
+	c := newScriptedClient(t, "* OK ready", s.respond)
+
+	b, err := c.IdleWithBreaks(&IdleBreakOptions{MinIdle: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("IdleWithBreaks() error: %v", err)
+	}
+	runBreaks(t, c, b, 3)
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	// The three STATUS commands share one break.
+	if got, want := s.log(), "IDLE DONE STATUS STATUS STATUS IDLE DONE"; got != want {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+}
+
+func TestIdleBreaker_MaxBatch(t *testing.T) {
+	s := &idleInterruptServer{}
+	c := newScriptedClient(t, "* OK ready", s.respond)
+
+	b, err := c.IdleWithBreaks(&IdleBreakOptions{MinIdle: 20 * time.Millisecond, MaxBatch: 2})
+	if err != nil {
+		t.Fatalf("IdleWithBreaks() error: %v", err)
+	}
+	start := time.Now()
+	runBreaks(t, c, b, 3)
+	if d := time.Since(start); d < 40*time.Millisecond {
+		t.Errorf("two breaks took %v, want at least two MinIdle", d)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	if got, want := s.log(), "IDLE DONE STATUS STATUS IDLE DONE STATUS IDLE DONE"; got != want {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+}
+
+func TestIdleBreaker_Close(t *testing.T) {
+	s := &idleInterruptServer{}
+	c := newScriptedClient(t, "* OK ready", s.respond)
+
+	b, err := c.IdleWithBreaks(&IdleBreakOptions{MinIdle: time.Hour})
+	if err != nil {
+		t.Fatalf("IdleWithBreaks() error: %v", err)
+	}
+	queued := make(chan error, 1)
+	go func() { queued <- b.Do(func() error { return errors.New("ran") }) }()
+	time.Sleep(10 * time.Millisecond)
+
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	if err := <-queued; !errors.Is(err, ErrIdleBreakerClosed) {
+		t.Errorf("queued Do() = %v, want ErrIdleBreakerClosed", err)
+	}
+	if err := b.Do(func() error { return nil }); !errors.Is(err, ErrIdleBreakerClosed) {
+		t.Errorf("Do() after Close = %v, want ErrIdleBreakerClosed", err)
+	}
+	if got := s.log(); got != "IDLE DONE" {
+		t.Errorf("commands = %q, want %q", got, "IDLE DONE")
+	}
+	if err := c.Noop(); err != nil || !strings.HasSuffix(s.log(), "NOOP") {
+		t.Errorf("Noop() after Close error: %v", err)
+	}
+}
@@ -0,0 +1,384 @@
+// Package journal records changes to messages made while an application
+// is offline in a write-ahead journal, and replays them on the server once
+// it is connected again.
+//
+// Changes are recorded in a Store before they are reported as made, so
+// that they survive a crash or restart when the Store is durable, such as
+// a FileStore. Replay applies the pending changes in order and removes
+// each one from the journal once the server has accepted it. Flag changes
+// are conditional on the mod-sequence the application saw when the server
+// supports CONDSTORE (RFC 7162), so that changes made meanwhile by other
+// clients are reported as conflicts instead of being overwritten.
+package journal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client"
+)
+
+// OpKind is the kind of an operation.
+type OpKind string
+
+// Operation kinds.
+const (
+	// OpStore changes the flags of messages.
+	OpStore OpKind = "store"
+	// OpMove moves messages to another mailbox.
+	OpMove OpKind = "move"
+	// OpAppend appends a message to a mailbox.
+	OpAppend OpKind = "append"
+)
+
+// Op is a change recorded in a journal.
+type Op struct {
+	// ID identifies the operation in its Store.
+	ID uint64 `json:"id"`
+	// Kind is the kind of the operation.
+	Kind OpKind `json:"kind"`
+	// Mailbox is the mailbox the messages are in, or that a message is
+	// appended to.
+	Mailbox string `json:"mailbox"`
+	// UIDValidity is the UIDVALIDITY of Mailbox the UIDs refer to. If the
+	// mailbox has another UIDVALIDITY when the operation is replayed, the
+	// operation is a conflict. 0 means not checked.
+	UIDValidity uint32 `json:"uidValidity,omitempty"`
+	// UIDs are the messages changed by OpStore and OpMove.
+	UIDs []imap.UID `json:"uids,omitempty"`
+
+	// Action and Flags are the flag change of OpStore, and Flags the flags
+	// of the message appended by OpAppend.
+	Action imap.StoreAction `json:"action,omitempty"`
+	Flags  []imap.Flag      `json:"flags,omitempty"`
+	// ModSeq is the mod-sequence of the messages the application saw
+	// when it made the change of OpStore. If it is set and the server
+	// supports CONDSTORE, the change is only applied to messages not
+	// modified since. 0 means unconditional.
+	ModSeq uint64 `json:"modSeq,omitempty"`
+
+	// Dest is the destination mailbox of OpMove.
+	Dest string `json:"dest,omitempty"`
+
+	// Message and InternalDate are the message appended by OpAppend.
+	Message      []byte    `json:"message,omitempty"`
+	InternalDate time.Time `json:"internalDate,omitempty"`
+}
+
+var (
+	// ErrModified is the error of a Conflict for messages modified on the
+	// server since the mod-sequence of an OpStore.
+	ErrModified = errors.New("journal: messages were modified on the server")
+	// ErrUIDValidity is the error of a Conflict for an operation whose
+	// mailbox has another UIDVALIDITY on the server, so its UIDs no longer
+	// refer to the same messages.
+	ErrUIDValidity = errors.New("journal: mailbox UIDVALIDITY changed")
+)
+
+// Conflict is an operation Replay did not apply, or only applied to some
+// of its messages. It has been removed from the journal; the application
+// decides whether to record it again, for instance after fetching the
+// current state of the messages.
+type Conflict struct {
+	// Op is the operation.
+	Op Op
+	// UIDs are the messages the operation was not applied to.
+	UIDs []imap.UID
+	// Err is ErrModified, ErrUIDValidity, or the *imap.IMAPError of a
+	// command the server rejected.
+	Err error
+}
+
+// Applied is an operation Replay applied.
+type Applied struct {
+	// Op is the operation.
+	Op Op
+	// Copy is the COPYUID data of an OpMove, if the server supports
+	// UIDPLUS.
+	Copy *imap.CopyData
+	// Append is the APPENDUID data of an OpAppend, if the server supports
+	// UIDPLUS.
+	Append *imap.AppendData
+}
+
+// Result is the result of Replay.
+type Result struct {
+	// Applied are the operations applied, in order.
+	Applied []Applied
+	// Conflicts are the operations not applied, in order.
+	Conflicts []Conflict
+}
+
+// Journal is a write-ahead journal of changes to messages. It is safe for
+// concurrent use if its Store is, but Replay must not run concurrently
+// with itself.
+type Journal struct {
+	store Store
+}
+
+// New returns a journal that records operations in store.
+func New(store Store) *Journal {
+	return &Journal{store: store}
+}
+
+// Store records a change of the flags of messages in a mailbox, to be
+// applied by Replay. modSeq is the mod-sequence of the messages the change
+// was based on, or 0 to apply it unconditionally.
+func (j *Journal) Store(mailbox string, uidValidity uint32, uids []imap.UID, modSeq uint64, action imap.StoreAction, flags []imap.Flag) (uint64, error) {
+	return j.store.Add(Op{
+		Kind:        OpStore,
+		Mailbox:     mailbox,
+		UIDValidity: uidValidity,
+		UIDs:        uids,
+		ModSeq:      modSeq,
+		Action:      action,
+		Flags:       flags,
+	})
+}
+
+// Move records a move of messages to another mailbox, to be applied by
+// Replay.
+func (j *Journal) Move(mailbox string, uidValidity uint32, uids []imap.UID, dest string) (uint64, error) {
+	return j.store.Add(Op{
+		Kind:        OpMove,
+		Mailbox:     mailbox,
+		UIDValidity: uidValidity,
+		UIDs:        uids,
+		Dest:        dest,
+	})
+}
+
+// Append records a message to append to a mailbox, to be applied by
+// Replay.
+func (j *Journal) Append(mailbox string, msg client.AppendMessage) (uint64, error) {
+	return j.store.Add(Op{
+		Kind:         OpAppend,
+		Mailbox:      mailbox,
+		Flags:        msg.Flags,
+		Message:      msg.Literal,
+		InternalDate: msg.InternalDate,
+	})
+}
+
+// Pending returns the operations not replayed yet, in order.
+func (j *Journal) Pending() ([]Op, error) {
+	return j.store.Pending()
+}
+
+// Replay applies the pending operations on the server c is connected to,
+// in order, and removes each from the journal once it is applied or found
+// to conflict. c must be authenticated; Replay selects the mailboxes of
+// the operations.
+//
+// If a command fails for another reason than the server rejecting it,
+// such as the connection being lost, Replay returns the error together
+// with the operations handled so far; the others stay pending, to be
+// replayed later.
+//
+// An operation applied by the server but not removed from the journal,
+// because the application crashed in between, is applied again. Flag
+// changes and moves are idempotent: messages whose flags already are as
+// requested are not reported as conflicts, and moving messages that were
+// moved already does nothing. A message may however be appended twice.
+func (j *Journal) Replay(c *client.Client) (*Result, error) {
+	ops, err := j.store.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &replay{c: c, result: &Result{}}
+	for _, op := range ops {
+		applied, conflict, err := r.apply(op)
+		if err != nil {
+			return r.result, err
+		}
+		switch {
+		case conflict != nil:
+			r.result.Conflicts = append(r.result.Conflicts, *conflict)
+		case applied != nil:
+			r.result.Applied = append(r.result.Applied, *applied)
+		}
+		if err := j.store.Remove(op.ID); err != nil {
+			return r.result, err
+		}
+	}
+	return r.result, nil
+}
+
+// replay is the state of a Replay.
+type replay struct {
+	c      *client.Client
+	result *Result
+
+	selected    string
+	uidValidity uint32
+}
+
+// apply applies op. It returns a non-nil error only if op could not be
+// handled and must stay pending.
+func (r *replay) apply(op Op) (*Applied, *Conflict, error) {
+	if op.Kind == OpAppend {
+		data, err := r.c.MultiAppend(op.Mailbox, []client.AppendMessage{{
+			Flags:        op.Flags,
+			InternalDate: op.InternalDate,
+			Literal:      op.Message,
+		}})
+		if err != nil {
+			return rejected(op, op.UIDs, err)
+		}
+		return &Applied{Op: op, Append: data[0]}, nil, nil
+	}
+
+	if err := r.selectMailbox(op.Mailbox); err != nil {
+		return rejected(op, op.UIDs, err)
+	}
+	if op.UIDValidity != 0 && op.UIDValidity != r.uidValidity {
+		return nil, &Conflict{Op: op, UIDs: op.UIDs, Err: ErrUIDValidity}, nil
+	}
+	if len(op.UIDs) == 0 {
+		return &Applied{Op: op}, nil, nil
+	}
+	set := uidSet(op.UIDs)
+
+	switch op.Kind {
+	case OpStore:
+		return r.store(op, set)
+	case OpMove:
+		data, err := r.move(set, op.Dest)
+		if err != nil {
+			return rejected(op, op.UIDs, err)
+		}
+		return &Applied{Op: op, Copy: data}, nil, nil
+	default:
+		return nil, &Conflict{Op: op, UIDs: op.UIDs, Err: fmt.Errorf("journal: unknown operation kind %q", op.Kind)}, nil
+	}
+}
+
+// selectMailbox selects mailbox unless it is selected already.
+func (r *replay) selectMailbox(mailbox string) error {
+	if r.selected == mailbox && r.c.State() == imap.ConnStateSelected {
+		return nil
+	}
+	data, err := r.c.Select(mailbox, nil)
+	if err != nil {
+		r.selected = ""
+		return err
+	}
+	r.selected, r.uidValidity = mailbox, data.UIDValidity
+	return nil
+}
+
+// store applies an OpStore, conditionally if possible.
+func (r *replay) store(op Op, set string) (*Applied, *Conflict, error) {
+	if op.ModSeq == 0 || !r.c.SupportsCondStore() {
+		if err := r.c.UIDStore(set, op.Action, op.Flags, true); err != nil {
+			return rejected(op, op.UIDs, err)
+		}
+		return &Applied{Op: op}, nil, nil
+	}
+
+	modified, err := r.c.UIDStoreUnchangedSince(set, op.ModSeq, op.Action, op.Flags)
+	if err != nil {
+		return rejected(op, op.UIDs, err)
+	}
+	if modified.IsEmpty() {
+		return &Applied{Op: op}, nil, nil
+	}
+
+	// Messages whose flags already are as requested were most likely
+	// changed by an earlier replay of this operation.
+	msgs, err := r.c.UIDFetchMessages(modified.String(), "(UID FLAGS)")
+	if err != nil {
+		return rejected(op, op.UIDs, err)
+	}
+	var conflicting []imap.UID
+	for _, msg := range msgs {
+		if !flagsApplied(msg.Flags, op.Action, op.Flags) {
+			conflicting = append(conflicting, msg.UID)
+		}
+	}
+	if len(conflicting) == 0 {
+		return &Applied{Op: op}, nil, nil
+	}
+	sort.Slice(conflicting, func(i, j int) bool { return conflicting[i] < conflicting[j] })
+	return nil, &Conflict{Op: op, UIDs: conflicting, Err: ErrModified}, nil
+}
+
+// move moves messages, with COPY, STORE and EXPUNGE if the server does
+// not support MOVE.
+func (r *replay) move(set, dest string) (*imap.CopyData, error) {
+	if r.c.SupportsMove() {
+		return r.c.UIDMove(set, dest)
+	}
+	data, err := r.c.UIDCopy(set, dest)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.c.UIDStore(set, imap.StoreFlagsAdd, []imap.Flag{imap.FlagDeleted}, true); err != nil {
+		return nil, err
+	}
+	if r.c.SupportsUIDPlus() {
+		if err := r.c.UIDExpunge(set); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// rejected returns a Conflict for op if err is a response of the server
+// rejecting a command, and err otherwise.
+func rejected(op Op, uids []imap.UID, err error) (*Applied, *Conflict, error) {
+	var imapErr *imap.IMAPError
+	if errors.As(err, &imapErr) {
+		return nil, &Conflict{Op: op, UIDs: uids, Err: err}, nil
+	}
+	return nil, nil, err
+}
+
+// flagsApplied reports whether a message with the flags has the flags
+// requested by a change.
+func flagsApplied(current []imap.Flag, action imap.StoreAction, flags []imap.Flag) bool {
+	has := func(f imap.Flag) bool {
+		for _, c := range current {
+			if strings.EqualFold(string(c), string(f)) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, f := range flags {
+		if has(f) != (action != imap.StoreFlagsDel) {
+			return false
+		}
+	}
+	if action == imap.StoreFlagsSet {
+		for _, c := range current {
+			if strings.EqualFold(string(c), string(imap.FlagRecent)) {
+				continue
+			}
+			found := false
+			for _, f := range flags {
+				if strings.EqualFold(string(c), string(f)) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// uidSet returns the UID set string of uids.
+func uidSet(uids []imap.UID) string {
+	set := &imap.UIDSet{}
+	set.AddNum(uids...)
+	set.Normalize()
+	return set.String()
+}
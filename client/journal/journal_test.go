@@ -0,0 +1,291 @@
+package journal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client"
+)
+
+// scriptedServer answers the commands of a client with respond, and
+// records them.
+type scriptedServer struct {
+	mu       sync.Mutex
+	commands []string
+}
+
+func (s *scriptedServer) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// dialScripted returns a client connected to a scripted server greeting it
+// with caps. respond writes the responses to a command, without its
+// literal, and returns false to close the connection instead.
+func dialScripted(t *testing.T, caps string, respond func(w io.Writer, tag, cmd string) bool) (*client.Client, *scriptedServer) {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() {
+		_ = serverConn.Close()
+		_ = clientConn.Close()
+	})
+
+	s := &scriptedServer{}
+	go func() {
+		defer serverConn.Close()
+		fmt.Fprintf(serverConn, "* PREAUTH [CAPABILITY IMAP4rev1 %s] ready\r\n", caps)
+		r := bufio.NewReader(serverConn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			// Read a synchronizing literal at the end of the line.
+			if i := strings.LastIndexByte(line, '{'); i >= 0 && strings.HasSuffix(line, "}") {
+				n, err := strconv.Atoi(line[i+1 : len(line)-1])
+				if err == nil {
+					fmt.Fprint(serverConn, "+ go ahead\r\n")
+					if _, err := io.ReadFull(r, make([]byte, n)); err != nil {
+						return
+					}
+					if _, err := r.ReadString('\n'); err != nil {
+						return
+					}
+					line = line[:i]
+				}
+			}
+			tag, cmd, _ := strings.Cut(line, " ")
+			s.mu.Lock()
+			s.commands = append(s.commands, cmd)
+			s.mu.Unlock()
+			if !respond(serverConn, tag, cmd) {
+				return
+			}
+		}
+	}()
+
+	c, err := client.New(clientConn)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c, s
+}
+
+// respondMailboxes answers SELECT with the UIDVALIDITY of the mailboxes
+// and every other command with OK, or with the response in extra.
+func respondMailboxes(uidValidity map[string]uint32, extra map[string]string) func(w io.Writer, tag, cmd string) bool {
+	return func(w io.Writer, tag, cmd string) bool {
+		if name, ok := strings.CutPrefix(cmd, "SELECT "); ok {
+			v, ok := uidValidity[strings.Trim(name, `"`)]
+			if !ok {
+				fmt.Fprintf(w, "%s NO [NONEXISTENT] no such mailbox\r\n", tag)
+				return true
+			}
+			fmt.Fprintf(w, "* 3 EXISTS\r\n* OK [UIDVALIDITY %d] ok\r\n%s OK [READ-WRITE] done\r\n", v, tag)
+			return true
+		}
+		for prefix, resp := range extra {
+			if strings.HasPrefix(cmd, prefix) {
+				if resp == "" {
+					return false
+				}
+				fmt.Fprint(w, strings.ReplaceAll(resp, "TAG", tag))
+				return true
+			}
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+		return true
+	}
+}
+
+func TestReplay(t *testing.T) {
+	j := New(NewMemoryStore())
+	mustRecord(t)(j.Store("INBOX", 7, []imap.UID{5, 6, 7}, 40, imap.StoreFlagsAdd, []imap.Flag{imap.FlagSeen}))
+	mustRecord(t)(j.Store("INBOX", 7, []imap.UID{8}, 0, imap.StoreFlagsDel, []imap.Flag{imap.FlagFlagged}))
+	mustRecord(t)(j.Move("INBOX", 7, []imap.UID{9, 10}, "Archive"))
+	mustRecord(t)(j.Append("Drafts", client.AppendMessage{Flags: []imap.Flag{imap.FlagDraft}, Literal: []byte("Subject: hi\r\n\r\nhi")}))
+	mustRecord(t)(j.Move("Old", 3, []imap.UID{1}, "Archive"))
+	mustRecord(t)(j.Store("Gone", 1, []imap.UID{1}, 0, imap.StoreFlagsAdd, []imap.Flag{imap.FlagSeen}))
+
+	c, s := dialScripted(t, "CONDSTORE MOVE UIDPLUS", respondMailboxes(
+		map[string]uint32{"INBOX": 7, "Old": 4},
+		map[string]string{
+			// Message 6 already has \Seen from an earlier replay, 7 was
+			// changed by another client.
+			"UID STORE 5:7 (UNCHANGEDSINCE 40)": "TAG OK [MODIFIED 6:7] conditional store\r\n",
+			"UID FETCH 6:7 (UID FLAGS)":         "* 2 FETCH (UID 6 FLAGS (\\Seen))\r\n* 3 FETCH (UID 7 FLAGS (\\Answered))\r\nTAG OK done\r\n",
+			"UID MOVE":                          "TAG OK [COPYUID 12 9:10 20:21] moved\r\n",
+			"APPEND":                            "TAG OK [APPENDUID 30 4] appended\r\n",
+		},
+	))
+
+	result, err := j.Replay(c)
+	if err != nil {
+		t.Fatalf("Replay() error: %v", err)
+	}
+
+	want := []string{
+		"SELECT INBOX",
+		`UID STORE 5:7 (UNCHANGEDSINCE 40) +FLAGS.SILENT (\Seen)`,
+		"UID FETCH 6:7 (UID FLAGS)",
+		`UID STORE 8 -FLAGS.SILENT (\Flagged)`,
+		"UID MOVE 9:10 Archive",
+		`APPEND Drafts (\Draft) `,
+		"SELECT Old",
+		"SELECT Gone",
+	}
+	if got := s.Commands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+
+	if len(result.Applied) != 3 {
+		t.Fatalf("applied %d operations, want 3: %+v", len(result.Applied), result.Applied)
+	}
+	if data := result.Applied[1].Copy; data == nil || data.UIDValidity != 12 || data.DestUIDs.String() != "20:21" {
+		t.Errorf("move COPYUID = %+v", data)
+	}
+	if data := result.Applied[2].Append; data == nil || data.UIDValidity != 30 || data.UID != 4 {
+		t.Errorf("append APPENDUID = %+v", data)
+	}
+
+	if len(result.Conflicts) != 3 {
+		t.Fatalf("%d conflicts, want 3: %+v", len(result.Conflicts), result.Conflicts)
+	}
+	if cf := result.Conflicts[0]; cf.Err != ErrModified || !reflect.DeepEqual(cf.UIDs, []imap.UID{7}) {
+		t.Errorf("store conflict = %+v, want message 7 modified", cf)
+	}
+	if cf := result.Conflicts[1]; cf.Err != ErrUIDValidity || cf.Op.Mailbox != "Old" {
+		t.Errorf("move conflict = %+v, want UIDVALIDITY changed", cf)
+	}
+	var imapErr *imap.IMAPError
+	if cf := result.Conflicts[2]; !errors.As(cf.Err, &imapErr) || cf.Op.Mailbox != "Gone" {
+		t.Errorf("conflict = %+v, want the SELECT error", cf)
+	}
+
+	if pending, _ := j.Pending(); len(pending) != 0 {
+		t.Errorf("%d operations still pending", len(pending))
+	}
+}
+
+func TestReplay_WithoutExtensions(t *testing.T) {
+	j := New(NewMemoryStore())
+	mustRecord(t)(j.Store("INBOX", 0, []imap.UID{1}, 40, imap.StoreFlagsSet, []imap.Flag{imap.FlagSeen}))
+	mustRecord(t)(j.Move("INBOX", 0, []imap.UID{2}, "Trash"))
+
+	c, s := dialScripted(t, "", respondMailboxes(map[string]uint32{"INBOX": 1}, nil))
+	if _, err := j.Replay(c); err != nil {
+		t.Fatalf("Replay() error: %v", err)
+	}
+	want := []string{
+		"SELECT INBOX",
+		`UID STORE 1 FLAGS.SILENT (\Seen)`,
+		"UID COPY 2 Trash",
+		`UID STORE 2 +FLAGS.SILENT (\Deleted)`,
+	}
+	if got := s.Commands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+}
+
+func TestReplay_Disconnect(t *testing.T) {
+	j := New(NewMemoryStore())
+	mustRecord(t)(j.Store("INBOX", 0, []imap.UID{1}, 0, imap.StoreFlagsAdd, []imap.Flag{imap.FlagSeen}))
+	mustRecord(t)(j.Move("INBOX", 0, []imap.UID{2}, "Trash"))
+	mustRecord(t)(j.Store("INBOX", 0, []imap.UID{3}, 0, imap.StoreFlagsAdd, []imap.Flag{imap.FlagSeen}))
+
+	c, _ := dialScripted(t, "MOVE", respondMailboxes(map[string]uint32{"INBOX": 1}, map[string]string{"UID MOVE": ""}))
+	result, err := j.Replay(c)
+	if err == nil {
+		t.Fatal("Replay() succeeded after the connection was lost")
+	}
+	if len(result.Applied) != 1 {
+		t.Errorf("applied %d operations, want 1", len(result.Applied))
+	}
+	pending, _ := j.Pending()
+	if len(pending) != 2 || pending[0].Kind != OpMove || pending[1].UIDs[0] != 3 {
+		t.Errorf("pending = %+v, want the move and the last store", pending)
+	}
+}
+
+func mustRecord(t *testing.T) func(uint64, error) {
+	return func(_ uint64, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("recording operation: %v", err)
+		}
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore() error: %v", err)
+	}
+	j := New(s)
+	mustRecord(t)(j.Store("INBOX", 7, []imap.UID{1, 2}, 40, imap.StoreFlagsAdd, []imap.Flag{imap.FlagSeen}))
+	mustRecord(t)(j.Move("INBOX", 7, []imap.UID{3}, "Archive"))
+	mustRecord(t)(j.Append("Sent", client.AppendMessage{Literal: []byte("Subject: x\r\n\r\nbinary \x00\xff")}))
+	if err := s.Remove(2); err != nil {
+		t.Fatalf("Remove() error: %v", err)
+	}
+	want, _ := s.Pending()
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	// Simulate a crash while an operation was being added.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprint(f, `{"op":{"id":4,"kind":"sto`)
+	f.Close()
+
+	s, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore() after a crash error: %v", err)
+	}
+	defer s.Close()
+	got, _ := s.Pending()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Pending() after reopening = %+v, want %+v", got, want)
+	}
+	if id, err := s.Add(Op{Kind: OpMove, Mailbox: "INBOX"}); err != nil || id != 4 {
+		t.Errorf("Add() = %d, %v, want ID 4", id, err)
+	}
+
+	// The file is compacted once no operation is pending.
+	for _, op := range append(got, Op{ID: 4}) {
+		if err := s.Remove(op.ID); err != nil {
+			t.Fatalf("Remove(%d) error: %v", op.ID, err)
+		}
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+		t.Errorf("journal file after removing all operations: %v, %v", info, err)
+	}
+}
+
+func TestFileStore_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	if err := os.WriteFile(path, []byte("{\"op\":{\"id\":1}}\nnot json\n{\"removed\":1}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFileStore(path); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("OpenFileStore() error = %v, want an error for line 2", err)
+	}
+}
@@ -0,0 +1,261 @@
+package journal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store durably records the pending operations of a Journal.
+type Store interface {
+	// Add records op, assigns it an ID greater than those of the pending
+	// operations, and returns the ID. The operation must be recorded
+	// durably when Add returns.
+	Add(op Op) (uint64, error)
+	// Pending returns the operations that were added and not removed, in
+	// the order they were added.
+	Pending() ([]Op, error)
+	// Remove removes the operation with the ID, once it has been applied
+	// or given up on.
+	Remove(id uint64) error
+}
+
+// MemoryStore is a Store that keeps operations in memory. It is not
+// crash-safe, but lets a Journal queue changes made while disconnected
+// within the same process. It is safe for concurrent use.
+type MemoryStore struct {
+	mu     sync.Mutex
+	ops    []Op
+	lastID uint64
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Add implements Store.
+func (s *MemoryStore) Add(op Op) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	op.ID = s.lastID
+	s.ops = append(s.ops, op)
+	return op.ID, nil
+}
+
+// Pending implements Store.
+func (s *MemoryStore) Pending() ([]Op, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Op(nil), s.ops...), nil
+}
+
+// Remove implements Store.
+func (s *MemoryStore) Remove(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, op := range s.ops {
+		if op.ID == id {
+			s.ops = append(s.ops[:i], s.ops[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// record is a line of the file of a FileStore: either an added operation
+// or the ID of a removed one.
+type record struct {
+	Op      *Op    `json:"op,omitempty"`
+	Removed uint64 `json:"removed,omitempty"`
+}
+
+// FileStore is a Store that keeps operations in an append-only file of
+// JSON lines, synced to disk on each change, so that the operations
+// survive a crash or restart of the application. A line cut short by a
+// crash is ignored when the file is opened. The file is compacted when it
+// is opened and whenever no operation is pending. It is safe for
+// concurrent use.
+type FileStore struct {
+	path string
+
+	mu     sync.Mutex
+	f      *os.File
+	ops    []Op
+	lastID uint64
+}
+
+// OpenFileStore opens the FileStore backed by the file at path, creating
+// the file if it does not exist, and loads the pending operations it
+// contains.
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err := s.load(data); err != nil {
+		return nil, fmt.Errorf("journal: %s: %w", path, err)
+	}
+	if err := s.rewrite(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load replays the records of the file.
+func (s *FileStore) load(data []byte) error {
+	lines := bytes.Split(data, []byte("\n"))
+	// The last line is empty, or was cut short by a crash before the
+	// operation it holds was reported as added.
+	lines = lines[:len(lines)-1]
+	for i, line := range lines {
+		var rec record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("line %d: %w", i+1, err)
+		}
+		switch {
+		case rec.Op != nil:
+			s.ops = append(s.ops, *rec.Op)
+			s.lastID = max(s.lastID, rec.Op.ID)
+		case rec.Removed != 0:
+			s.remove(rec.Removed)
+		}
+	}
+	return nil
+}
+
+// rewrite atomically replaces the file with one holding only the pending
+// operations, and opens it for appending.
+// The caller must hold s.mu, or have exclusive access to s.
+func (s *FileStore) rewrite() error {
+	var buf bytes.Buffer
+	for i := range s.ops {
+		if err := writeRecord(&buf, record{Op: &s.ops[i]}); err != nil {
+			return err
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf.Bytes()); err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if s.f != nil {
+		_ = s.f.Close()
+	}
+	s.f = f
+	return nil
+}
+
+// append writes a record to the file and syncs it. If that fails, the
+// file is rewritten, so that a partly written record does not corrupt the
+// records appended after it.
+// The caller must hold s.mu.
+func (s *FileStore) append(rec record) error {
+	if s.f == nil {
+		return os.ErrClosed
+	}
+	var buf bytes.Buffer
+	if err := writeRecord(&buf, rec); err != nil {
+		return err
+	}
+	_, err := s.f.Write(buf.Bytes())
+	if err == nil {
+		err = s.f.Sync()
+	}
+	if err != nil {
+		_ = s.rewrite()
+	}
+	return err
+}
+
+func writeRecord(w io.Writer, rec record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// remove removes the operation with the ID from s.ops.
+func (s *FileStore) remove(id uint64) bool {
+	for i, op := range s.ops {
+		if op.ID == id {
+			s.ops = append(s.ops[:i], s.ops[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Add implements Store.
+func (s *FileStore) Add(op Op) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op.ID = s.lastID + 1
+	if err := s.append(record{Op: &op}); err != nil {
+		return 0, err
+	}
+	s.lastID = op.ID
+	s.ops = append(s.ops, op)
+	return op.ID, nil
+}
+
+// Pending implements Store.
+func (s *FileStore) Pending() ([]Op, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Op(nil), s.ops...), nil
+}
+
+// Remove implements Store.
+func (s *FileStore) Remove(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.remove(id) {
+		return nil
+	}
+	if len(s.ops) == 0 {
+		return s.rewrite()
+	}
+	return s.append(record{Removed: id})
+}
+
+// Close closes the file of the store.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
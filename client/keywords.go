@@ -0,0 +1,24 @@
+package client
+
+import imap "github.com/meszmate/imap-go"
+
+// MarkJunk marks the messages with the UIDs in uidSet in the selected
+// mailbox as spam, adding $Junk and removing $NotJunk, or, if junk is
+// false, as not spam, the other way round. Servers and filters that learn
+// from these keywords see a consistent state.
+func (c *Client) MarkJunk(uidSet string, junk bool) error {
+	add, remove := imap.FlagJunk, imap.FlagNotJunk
+	if !junk {
+		add, remove = remove, add
+	}
+	if err := c.UIDStore(uidSet, imap.StoreFlagsAdd, []imap.Flag{add}, true); err != nil {
+		return err
+	}
+	return c.UIDStore(uidSet, imap.StoreFlagsDel, []imap.Flag{remove}, true)
+}
+
+// MarkForwarded adds the $Forwarded keyword to the messages with the UIDs
+// in uidSet in the selected mailbox, as clients do after forwarding them.
+func (c *Client) MarkForwarded(uidSet string) error {
+	return c.UIDStore(uidSet, imap.StoreFlagsAdd, []imap.Flag{imap.FlagForwarded}, true)
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestMarkJunk(t *testing.T) {
+	var cmds []string
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		cmds = append(cmds, cmd)
+		fmt.Fprintf(w, "%s OK STORE completed\r\n", tag)
+	})
+
+	if err := c.MarkJunk("1:3", true); err != nil {
+		t.Fatalf("MarkJunk() error: %v", err)
+	}
+	if err := c.MarkJunk("4", false); err != nil {
+		t.Fatalf("MarkJunk() error: %v", err)
+	}
+	if err := c.MarkForwarded("5"); err != nil {
+		t.Fatalf("MarkForwarded() error: %v", err)
+	}
+	want := []string{
+		"UID STORE 1:3 +FLAGS.SILENT ($Junk)",
+		"UID STORE 1:3 -FLAGS.SILENT ($NotJunk)",
+		"UID STORE 4 +FLAGS.SILENT ($NotJunk)",
+		"UID STORE 4 -FLAGS.SILENT ($Junk)",
+		"UID STORE 5 +FLAGS.SILENT ($Forwarded)",
+	}
+	if fmt.Sprint(cmds) != fmt.Sprint(want) {
+		t.Errorf("commands = %q, want %q", cmds, want)
+	}
+}
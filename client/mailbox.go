@@ -8,7 +8,8 @@ import (
 	imap "github.com/meszmate/imap-go"
 )
 
-// Select selects a mailbox.
+// Select selects a mailbox. The mailbox ID is reported if the server
+// supports OBJECTID (RFC 8474).
 func (c *Client) Select(mailbox string, opts *imap.SelectOptions) (*imap.SelectData, error) {
 	cmd := "SELECT"
 	if opts != nil && opts.ReadOnly {
@@ -17,6 +18,11 @@ func (c *Client) Select(mailbox string, opts *imap.SelectOptions) (*imap.SelectD
 
 	// Clear any previous untagged data
 	c.collectUntagged()
+	c.mu.Lock()
+	c.mailboxID = ""
+	c.mailboxHighestModSeq = 0
+	c.savedSearch = false
+	c.mu.Unlock()
 
 	result, err := c.execute(cmd, quoteArg(mailbox))
 	if err != nil {
@@ -40,6 +46,7 @@ func (c *Client) Select(mailbox string, opts *imap.SelectOptions) (*imap.SelectD
 		UIDValidity: c.mailboxUIDValidity,
 		FirstUnseen: c.mailboxUnseen,
 		ReadOnly:    c.mailboxReadOnly,
+		MailboxID:   c.mailboxID,
 	}
 	c.mu.Unlock()
 
@@ -88,6 +95,8 @@ func (c *Client) Unsubscribe(mailbox string) error {
 }
 
 // ListMailboxes lists mailboxes matching the given reference and pattern.
+// The attributes of the mailboxes can be checked with the methods of
+// imap.ListData, such as Selectable, HasChildren and Role.
 func (c *Client) ListMailboxes(ref, pattern string) ([]*imap.ListData, error) {
 	c.collectUntagged()
 
@@ -117,6 +126,37 @@ func (c *Client) ListMailboxes(ref, pattern string) ([]*imap.ListData, error) {
 	return mailboxes, nil
 }
 
+// MailboxRoles lists all mailboxes and returns the mailbox of each
+// special-use role, such as the trash under imap.MailboxAttrTrash. If the
+// server supports SPECIAL-USE (RFC 6154), roles are those of the
+// special-use attributes; otherwise they are guessed from the mailbox
+// names, see imap.MailboxRoles.
+func (c *Client) MailboxRoles() (map[imap.MailboxAttr]*imap.ListData, error) {
+	list, err := c.listSpecialUse()
+	if err != nil {
+		return nil, err
+	}
+	if !c.HasCap(string(imap.CapSpecialUse)) {
+		return imap.MailboxRoles(list), nil
+	}
+	roles := make(map[imap.MailboxAttr]*imap.ListData)
+	for _, data := range list {
+		if _, ok := roles[data.SpecialUse()]; data.SpecialUse() != "" && !ok {
+			roles[data.SpecialUse()] = data
+		}
+	}
+	return roles, nil
+}
+
+// listSpecialUse lists all mailboxes, with their special-use attributes
+// if the server supports SPECIAL-USE.
+func (c *Client) listSpecialUse() ([]*imap.ListData, error) {
+	if c.HasCap(string(imap.CapSpecialUse)) && c.HasCap(string(imap.CapListExtended)) {
+		return c.ListMailboxesExtended("", []string{"*"}, &imap.ListOptions{ReturnSpecialUse: true})
+	}
+	return c.ListMailboxes("", "*")
+}
+
 // ListMailboxesExtended lists mailboxes with extended LIST options (RFC 5258).
 func (c *Client) ListMailboxesExtended(ref string, patterns []string, options *imap.ListOptions) ([]*imap.ListData, error) {
 	c.collectUntagged()
@@ -219,15 +259,23 @@ func (c *Client) ListMailboxesExtended(ref string, patterns []string, options *i
 		}
 	}
 
-	// Match STATUS responses to mailboxes
+	// Match STATUS (RFC 5819) and MYRIGHTS (RFC 8440) responses to
+	// mailboxes
 	for _, line := range untagged {
-		if strings.HasPrefix(line, "STATUS ") {
+		switch {
+		case strings.HasPrefix(line, "STATUS "):
 			statusData := parseStatusResponse2(line[7:])
 			if statusData != nil {
 				if ld, ok := mailboxMap[statusData.Mailbox]; ok {
 					ld.Status = statusData
 				}
 			}
+		case strings.HasPrefix(line, "MYRIGHTS "):
+			mailbox, rights := parseMailboxName(line[9:])
+			if ld, ok := mailboxMap[mailbox]; ok {
+				v, _ := parseExtendedValue(rights)
+				ld.MyRights = v.Text
+			}
 		}
 	}
 
@@ -243,9 +291,11 @@ func hasReturnOpts(opts *imap.ListOptions) bool {
 		opts.ReturnMyRights || opts.ReturnStatus != nil || opts.ReturnMetadata != nil
 }
 
-// Status returns the status of a mailbox.
+// Status returns the status of a mailbox. It can be used while IDLE is in
+// progress, see Idle.
 func (c *Client) Status(mailbox string, opts *imap.StatusOptions) (*imap.StatusData, error) {
 	items := buildStatusItems(opts)
+	defer c.interruptIdle()()
 	c.collectUntagged()
 
 	result, err := c.execute("STATUS", quoteArg(mailbox), "("+strings.Join(items, " ")+")")
@@ -278,6 +328,7 @@ func (c *Client) Unselect() error {
 		c.mu.Lock()
 		c.state = imap.ConnStateAuthenticated
 		c.mailboxName = ""
+		c.savedSearch = false
 		c.mu.Unlock()
 	}
 	return err
@@ -290,6 +341,7 @@ func (c *Client) CloseMailbox() error {
 		c.mu.Lock()
 		c.state = imap.ConnStateAuthenticated
 		c.mailboxName = ""
+		c.savedSearch = false
 		c.mu.Unlock()
 	}
 	return err
@@ -321,6 +373,9 @@ func buildStatusItems(opts *imap.StatusOptions) []string {
 	if opts.HighestModSeq {
 		items = append(items, "HIGHESTMODSEQ")
 	}
+	if opts.MailboxID {
+		items = append(items, "MAILBOXID")
+	}
 	if len(items) == 0 {
 		items = []string{"MESSAGES", "UIDNEXT", "UIDVALIDITY", "UNSEEN"}
 	}
@@ -397,96 +452,86 @@ func parseMailboxName(line string) (string, string) {
 	return line[:idx], line[idx:]
 }
 
-// parseExtendedData parses extended data items from a parenthesized list.
-// Format: ("CHILDINFO" ("SUBSCRIBED") "OLDNAME" ("OldName") ...)
+// parseExtendedData parses the extended data items of a LIST response
+// (RFC 5258 section 9), such as ("CHILDINFO" ("SUBSCRIBED") "OLDNAME"
+// ("OldName")). Items without a field of ListData are kept in Extended.
 func parseExtendedData(s string, data *imap.ListData) {
-	// Remove outer parentheses
-	if len(s) < 2 || s[0] != '(' {
+	v, _ := parseExtendedValue(s)
+	if v.Kind != imap.ExtendedValueList {
 		return
 	}
-	// Find matching close paren
-	depth := 0
-	end := -1
-	for i, ch := range s {
-		if ch == '(' {
-			depth++
-		} else if ch == ')' {
-			depth--
-			if depth == 0 {
-				end = i
-				break
+	for i := 0; i+1 < len(v.List); i += 2 {
+		tag, value := v.List[i].Text, v.List[i+1]
+		switch strings.ToUpper(tag) {
+		case "CHILDINFO":
+			data.ChildInfo = append(data.ChildInfo, value.Strings()...)
+		case "OLDNAME":
+			if names := value.Strings(); len(names) > 0 {
+				data.OldName = names[0]
 			}
+		case "MYRIGHTS":
+			data.MyRights = value.Text
+		case "METADATA":
+			data.Metadata = make(map[string]string)
+			for j := 0; j+1 < len(value.List); j += 2 {
+				data.Metadata[value.List[j].Text] = value.List[j+1].Text
+			}
+		default:
+			data.Extended = append(data.Extended, imap.ListExtendedItem{Tag: tag, Value: value})
 		}
 	}
-	if end < 0 {
-		return
-	}
-	inner := s[1:end]
-
-	// Parse key-value extended items
-	for len(inner) > 0 {
-		inner = strings.TrimLeft(inner, " ")
-		if inner == "" {
-			break
-		}
-
-		// Read key (quoted string like "CHILDINFO")
-		key, rest := readQuotedOrAtom(inner)
-		inner = strings.TrimLeft(rest, " ")
-		key = strings.ToUpper(key)
+}
 
-		switch key {
-		case "CHILDINFO":
-			// Value is a parenthesized list of quoted strings
-			if strings.HasPrefix(inner, "(") {
-				listStr, rest2 := extractParenthesized(inner)
-				inner = strings.TrimLeft(rest2, " ")
-				// Parse items inside the parens
-				listInner := listStr
-				for len(listInner) > 0 {
-					listInner = strings.TrimLeft(listInner, " ")
-					if listInner == "" {
-						break
-					}
-					val, r := readQuotedOrAtom(listInner)
-					data.ChildInfo = append(data.ChildInfo, val)
-					listInner = r
-				}
+// parseExtendedValue parses extended data (RFC 4466 tagged-ext-val) at the
+// start of s and returns it and the rest of s. Quoted strings are
+// unescaped; atoms, including unquoted strings, are returned as
+// ExtendedValueAtom.
+func parseExtendedValue(s string) (imap.ExtendedValue, string) {
+	s = strings.TrimLeft(s, " ")
+	switch {
+	case s == "":
+		return imap.ExtendedAtom(""), ""
+	case s[0] == '(':
+		list := imap.ExtendedList()
+		s = s[1:]
+		for {
+			s = strings.TrimLeft(s, " ")
+			if s == "" {
+				return list, ""
 			}
-		case "OLDNAME":
-			// Value is a parenthesized mailbox name
-			if strings.HasPrefix(inner, "(") {
-				listStr, rest2 := extractParenthesized(inner)
-				inner = strings.TrimLeft(rest2, " ")
-				name, _ := readQuotedOrAtom(strings.TrimSpace(listStr))
-				data.OldName = name
+			if s[0] == ')' {
+				return list, s[1:]
 			}
-		case "MYRIGHTS":
-			// Value is a quoted string
-			val, rest2 := readQuotedOrAtom(inner)
-			data.MyRights = val
-			inner = strings.TrimLeft(rest2, " ")
-		case "METADATA":
-			// Value is a parenthesized list of key-value pairs
-			if strings.HasPrefix(inner, "(") {
-				listStr, rest2 := extractParenthesized(inner)
-				inner = strings.TrimLeft(rest2, " ")
-				data.Metadata = make(map[string]string)
-				listInner := listStr
-				for len(listInner) > 0 {
-					listInner = strings.TrimLeft(listInner, " ")
-					if listInner == "" {
-						break
-					}
-					key, r := readQuotedOrAtom(listInner)
-					r = strings.TrimLeft(r, " ")
-					val, r2 := readQuotedOrAtom(r)
-					data.Metadata[key] = val
-					listInner = strings.TrimLeft(r2, " ")
+			var item imap.ExtendedValue
+			item, s = parseExtendedValue(s)
+			list.List = append(list.List, item)
+		}
+	case s[0] == '"':
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				if i+1 < len(s) {
+					i++
+					b.WriteByte(s[i])
 				}
+			case '"':
+				return imap.ExtendedString(b.String()), s[i+1:]
+			default:
+				b.WriteByte(s[i])
 			}
 		}
+		return imap.ExtendedString(b.String()), ""
+	}
+	end := strings.IndexAny(s, " ()")
+	if end == 0 {
+		// A stray ')' ends nothing; skip it.
+		return imap.ExtendedAtom(""), s[1:]
 	}
+	if end < 0 {
+		end = len(s)
+	}
+	return imap.ExtendedAtom(s[:end]), s[end:]
 }
 
 // readQuotedOrAtom reads a quoted string or atom from the beginning of s.
@@ -560,6 +605,10 @@ func parseStatusResponse2(line string) *imap.StatusData {
 	parts := strings.Fields(rest)
 	for i := 0; i+1 < len(parts); i += 2 {
 		name := strings.ToUpper(parts[i])
+		if name == "MAILBOXID" {
+			data.MailboxID = strings.Trim(parts[i+1], "()")
+			continue
+		}
 		val, err := strconv.ParseUint(parts[i+1], 10, 64)
 		if err != nil {
 			continue
@@ -612,68 +661,9 @@ func (c *Client) Enable(caps ...string) error {
 
 // Append appends a message to a mailbox.
 func (c *Client) Append(mailbox string, flags []imap.Flag, literal []byte) (*imap.AppendData, error) {
-	tag := c.tags.Next()
-	cmd := c.pending.Add(tag)
-
-	var line strings.Builder
-	line.WriteString(tag)
-	line.WriteString(" APPEND ")
-	line.WriteString(quoteArg(mailbox))
-
-	// Flags
-	if len(flags) > 0 {
-		line.WriteString(" (")
-		for i, f := range flags {
-			if i > 0 {
-				line.WriteByte(' ')
-			}
-			line.WriteString(string(f))
-		}
-		line.WriteByte(')')
-	}
-
-	// Literal
-	line.WriteString(fmt.Sprintf(" {%d}\r\n", len(literal)))
-
-	c.encoder.RawString(line.String())
-	if err := c.encoder.Flush(); err != nil {
-		c.pending.Complete(tag, &commandResult{err: err})
-		return nil, err
-	}
-
-	// Wait for continuation request
-	if _, err := c.waitForContinuation(cmd); err != nil {
-		return nil, err
-	}
-
-	// Send the literal data
-	_, err := c.conn.Write(literal)
-	if err != nil {
-		return nil, err
-	}
-	_, err = c.conn.Write([]byte("\r\n"))
+	data, err := c.MultiAppend(mailbox, []AppendMessage{{Flags: flags, Literal: literal}})
 	if err != nil {
 		return nil, err
 	}
-
-	result := <-cmd.done
-	if err := commandResultError(result); err != nil {
-		return nil, err
-	}
-
-	data := &imap.AppendData{}
-	// Parse APPENDUID from response code
-	if strings.HasPrefix(result.code, "APPENDUID ") {
-		parts := strings.Fields(result.code[10:])
-		if len(parts) >= 2 {
-			if v, err := strconv.ParseUint(parts[0], 10, 32); err == nil {
-				data.UIDValidity = uint32(v)
-			}
-			if v, err := strconv.ParseUint(parts[1], 10, 32); err == nil {
-				data.UID = imap.UID(v)
-			}
-		}
-	}
-
-	return data, nil
+	return data[0], nil
 }
@@ -0,0 +1,148 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestSelect_MailboxID(t *testing.T) {
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		fmt.Fprintf(w, "* 3 EXISTS\r\n* OK [UIDVALIDITY 12] UIDs valid\r\n")
+		if strings.Contains(cmd, "INBOX") {
+			fmt.Fprintf(w, "* OK [MAILBOXID (F2212ea87-6097-4256-9d51-71338625)] Ok\r\n")
+		}
+		fmt.Fprintf(w, "%s OK [READ-WRITE] SELECT completed\r\n", tag)
+	})
+
+	data, err := c.Select("INBOX", nil)
+	if err != nil {
+		t.Fatalf("Select() error: %v", err)
+	}
+	if data.MailboxID != "F2212ea87-6097-4256-9d51-71338625" || data.UIDValidity != 12 {
+		t.Errorf("MailboxID %q, UIDValidity %d", data.MailboxID, data.UIDValidity)
+	}
+
+	// The ID of the previous mailbox is not reported for one without.
+	if data, err := c.Select("Other", nil); err != nil || data.MailboxID != "" {
+		t.Errorf("Select(Other) = %+v, %v", data, err)
+	}
+}
+
+func TestStatus_MailboxID(t *testing.T) {
+	var command string
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		command = cmd
+		fmt.Fprintf(w, "* STATUS Drafts (MESSAGES 2 MAILBOXID (Fd7b2a0) UIDVALIDITY 9)\r\n")
+		fmt.Fprintf(w, "%s OK STATUS completed\r\n", tag)
+	})
+
+	data, err := c.Status("Drafts", &imap.StatusOptions{NumMessages: true, UIDValidity: true, MailboxID: true})
+	if err != nil {
+		t.Fatalf("Status() error: %v", err)
+	}
+	if !strings.Contains(command, "(MESSAGES UIDVALIDITY MAILBOXID)") {
+		t.Errorf("command = %q", command)
+	}
+	if data.MailboxID != "Fd7b2a0" || data.NumMessages == nil || *data.NumMessages != 2 ||
+		data.UIDValidity == nil || *data.UIDValidity != 9 {
+		t.Errorf("status = %+v", data)
+	}
+}
+
+func TestListMailboxes_ExtendedData(t *testing.T) {
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		fmt.Fprint(w, `* LIST (\HasChildren) "/" Archive ("X-VENDOR" (1 (a "b c")) "CHILDINFO" ("SUBSCRIBED")`+
+			` "OLDNAME" ("Old \"Archive\"") "METADATA" ("/private/comment" "note") "X-OWNER" ("John Doe"))`+"\r\n")
+		fmt.Fprintf(w, "%s OK LIST completed\r\n", tag)
+	})
+
+	mailboxes, err := c.ListMailboxes("", "*")
+	if err != nil {
+		t.Fatalf("ListMailboxes() error: %v", err)
+	}
+	if len(mailboxes) != 1 {
+		t.Fatalf("got %d mailboxes, want 1", len(mailboxes))
+	}
+	data := mailboxes[0]
+	if len(data.ChildInfo) != 1 || data.ChildInfo[0] != "SUBSCRIBED" {
+		t.Errorf("ChildInfo = %q", data.ChildInfo)
+	}
+	if data.OldName != `Old "Archive"` {
+		t.Errorf("OldName = %q", data.OldName)
+	}
+	if data.Metadata["/private/comment"] != "note" {
+		t.Errorf("Metadata = %v", data.Metadata)
+	}
+	if len(data.Extended) != 2 {
+		t.Fatalf("Extended = %+v, want 2 items", data.Extended)
+	}
+	vendor := data.Extended[0]
+	if vendor.Tag != "X-VENDOR" || vendor.Value.Kind != imap.ExtendedValueList || len(vendor.Value.List) != 2 {
+		t.Fatalf("Extended[0] = %+v", vendor)
+	}
+	if nested := vendor.Value.List[1].Strings(); len(nested) != 2 || nested[1] != "b c" {
+		t.Errorf("nested list = %q", nested)
+	}
+	if owner := data.Extended[1]; owner.Tag != "X-OWNER" || owner.Value.Strings()[0] != "John Doe" {
+		t.Errorf("Extended[1] = %+v", owner)
+	}
+}
+
+func TestListMailboxesExtended_MyRights(t *testing.T) {
+	var command string
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		command = cmd
+		fmt.Fprint(w, "* LIST () \"/\" INBOX\r\n* MYRIGHTS INBOX lrswipkxtea\r\n")
+		fmt.Fprint(w, "* LIST () \"/\" \"Team Folder\"\r\n* MYRIGHTS \"Team Folder\" \"lr\"\r\n")
+		fmt.Fprintf(w, "%s OK LIST completed\r\n", tag)
+	})
+
+	mailboxes, err := c.ListMailboxesExtended("", []string{"*"}, &imap.ListOptions{ReturnMyRights: true})
+	if err != nil {
+		t.Fatalf("ListMailboxesExtended() error: %v", err)
+	}
+	if !strings.HasSuffix(command, "RETURN (MYRIGHTS)") {
+		t.Errorf("command = %q", command)
+	}
+	if len(mailboxes) != 2 || mailboxes[0].MyRights != "lrswipkxtea" || mailboxes[1].MyRights != "lr" {
+		t.Fatalf("mailboxes = %+v", mailboxes)
+	}
+	if !imap.ACLRights(mailboxes[1].MyRights).Contains(imap.ACLRightRead) {
+		t.Error("rights of Team Folder do not include r")
+	}
+}
+
+func TestMailboxRoles(t *testing.T) {
+	list := func(trashAttr string) func(w io.Writer, tag, cmd string) {
+		return func(w io.Writer, tag, cmd string) {
+			fmt.Fprint(w, "* LIST (\\HasNoChildren) \"/\" INBOX\r\n")
+			fmt.Fprint(w, "* LIST (\\HasNoChildren) \"/\" \"Sent Items\"\r\n")
+			fmt.Fprintf(w, "* LIST (\\HasNoChildren%s) \"/\" Bin\r\n", trashAttr)
+			fmt.Fprint(w, "* LIST (\\HasNoChildren) \"/\" Trash\r\n")
+			fmt.Fprintf(w, "%s OK LIST completed\r\n", tag)
+		}
+	}
+
+	// Without SPECIAL-USE, roles are guessed from the names.
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1] ready", list(""))
+	roles, err := c.MailboxRoles()
+	if err != nil {
+		t.Fatalf("MailboxRoles() error: %v", err)
+	}
+	if len(roles) != 2 || roles[imap.MailboxAttrSent].Mailbox != "Sent Items" || roles[imap.MailboxAttrTrash].Mailbox != "Bin" {
+		t.Errorf("MailboxRoles() = %v, want Sent Items and Bin", roles)
+	}
+
+	// With SPECIAL-USE, only the attributes count.
+	c = newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1 SPECIAL-USE] ready", list(" \\Trash"))
+	if roles, err = c.MailboxRoles(); err != nil {
+		t.Fatalf("MailboxRoles() error: %v", err)
+	}
+	if len(roles) != 1 || roles[imap.MailboxAttrTrash].Mailbox != "Bin" || !roles[imap.MailboxAttrTrash].IsTrash() {
+		t.Errorf("MailboxRoles() with SPECIAL-USE = %v, want only Bin as \\Trash", roles)
+	}
+}
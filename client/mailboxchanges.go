@@ -0,0 +1,114 @@
+package client
+
+import (
+	imap "github.com/meszmate/imap-go"
+)
+
+// MailboxChanges describes how a mailbox changed between two snapshots
+// taken with STATUS or SELECT, see CompareStatus and CompareSelect. Items
+// missing from either snapshot are not compared and leave their fields
+// zero.
+type MailboxChanges struct {
+	// UIDValidityReset is set if the UIDVALIDITY changed: the mailbox was
+	// recreated or its UIDs renumbered, so UIDs and mod-sequences cached
+	// for it are invalid and it must be resynchronized from scratch. The
+	// other fields are still computed but compare unrelated mailboxes.
+	UIDValidityReset bool
+
+	// NewMessages is set if UIDNEXT advanced, which means that messages
+	// were added since the first snapshot, though they may have been
+	// expunged again.
+	NewMessages bool
+	// UIDNextDelta is how much UIDNEXT advanced, an upper bound of the
+	// number of messages added.
+	UIDNextDelta uint32
+
+	// MessagesDelta is the change of the number of messages.
+	MessagesDelta int64
+	// UnseenDelta is the change of the number of unseen messages, as
+	// shown by a badge count. SELECT does not report it.
+	UnseenDelta int64
+
+	// ModSeqAdvanced is set if HIGHESTMODSEQ advanced (CONDSTORE): a
+	// message was added or expunged, or its flags changed, even if the
+	// counts did not change.
+	ModSeqAdvanced bool
+}
+
+// Changed reports whether the snapshots differ in any compared item.
+func (ch MailboxChanges) Changed() bool {
+	return ch != MailboxChanges{}
+}
+
+// CompareStatus compares two STATUS snapshots of a mailbox, prev taken
+// before cur.
+func CompareStatus(prev, cur *imap.StatusData) MailboxChanges {
+	var ch MailboxChanges
+	if prev == nil || cur == nil {
+		return ch
+	}
+	if prev.UIDValidity != nil && cur.UIDValidity != nil {
+		ch.UIDValidityReset = *prev.UIDValidity != *cur.UIDValidity
+	}
+	if prev.UIDNext != nil && cur.UIDNext != nil {
+		ch.setUIDNext(*prev.UIDNext, *cur.UIDNext)
+	}
+	if prev.NumMessages != nil && cur.NumMessages != nil {
+		ch.MessagesDelta = int64(*cur.NumMessages) - int64(*prev.NumMessages)
+	}
+	if prev.NumUnseen != nil && cur.NumUnseen != nil {
+		ch.UnseenDelta = int64(*cur.NumUnseen) - int64(*prev.NumUnseen)
+	}
+	if prev.HighestModSeq != nil && cur.HighestModSeq != nil {
+		ch.ModSeqAdvanced = *cur.HighestModSeq > *prev.HighestModSeq
+	}
+	return ch
+}
+
+// CompareSelect compares the data returned by two SELECT or EXAMINE
+// commands for the same mailbox, prev returned before cur. Values that a
+// server did not send, such as HIGHESTMODSEQ without CONDSTORE, are zero
+// and not compared.
+func CompareSelect(prev, cur *imap.SelectData) MailboxChanges {
+	var ch MailboxChanges
+	if prev == nil || cur == nil {
+		return ch
+	}
+	if prev.UIDValidity != 0 && cur.UIDValidity != 0 {
+		ch.UIDValidityReset = prev.UIDValidity != cur.UIDValidity
+	}
+	if prev.UIDNext != 0 && cur.UIDNext != 0 {
+		ch.setUIDNext(uint32(prev.UIDNext), uint32(cur.UIDNext))
+	}
+	ch.MessagesDelta = int64(cur.NumMessages) - int64(prev.NumMessages)
+	if prev.HighestModSeq != 0 && cur.HighestModSeq != 0 {
+		ch.ModSeqAdvanced = cur.HighestModSeq > prev.HighestModSeq
+	}
+	return ch
+}
+
+func (ch *MailboxChanges) setUIDNext(prev, cur uint32) {
+	if cur > prev {
+		ch.NewMessages = true
+		ch.UIDNextDelta = cur - prev
+	}
+}
+
+// PollStatus requests the status of a mailbox and compares it with prev,
+// the result of a previous call, for watchers that poll mailboxes instead
+// of selecting them. HIGHESTMODSEQ is requested if the server supports
+// CONDSTORE. If prev is nil, the changes are zero.
+func (c *Client) PollStatus(mailbox string, prev *imap.StatusData) (*imap.StatusData, MailboxChanges, error) {
+	opts := &imap.StatusOptions{
+		NumMessages:   true,
+		UIDNext:       true,
+		UIDValidity:   true,
+		NumUnseen:     true,
+		HighestModSeq: c.HasCap(string(imap.CapCondStore)),
+	}
+	cur, err := c.Status(mailbox, opts)
+	if err != nil {
+		return nil, MailboxChanges{}, err
+	}
+	return cur, CompareStatus(prev, cur), nil
+}
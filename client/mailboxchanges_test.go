@@ -0,0 +1,91 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func u32(v uint32) *uint32 { return &v }
+
+func TestCompareStatus(t *testing.T) {
+	prev := &imap.StatusData{NumMessages: u32(10), UIDNext: u32(21), UIDValidity: u32(7), NumUnseen: u32(3)}
+
+	tests := []struct {
+		name string
+		cur  *imap.StatusData
+		want MailboxChanges
+	}{
+		{"unchanged", &imap.StatusData{NumMessages: u32(10), UIDNext: u32(21), UIDValidity: u32(7), NumUnseen: u32(3)},
+			MailboxChanges{}},
+		{"new mail", &imap.StatusData{NumMessages: u32(12), UIDNext: u32(23), UIDValidity: u32(7), NumUnseen: u32(5)},
+			MailboxChanges{NewMessages: true, UIDNextDelta: 2, MessagesDelta: 2, UnseenDelta: 2}},
+		{"read and expunged", &imap.StatusData{NumMessages: u32(9), UIDNext: u32(21), UIDValidity: u32(7), NumUnseen: u32(0)},
+			MailboxChanges{MessagesDelta: -1, UnseenDelta: -3}},
+		{"recreated", &imap.StatusData{NumMessages: u32(0), UIDNext: u32(1), UIDValidity: u32(8), NumUnseen: u32(0)},
+			MailboxChanges{UIDValidityReset: true, MessagesDelta: -10, UnseenDelta: -3}},
+		{"missing items", &imap.StatusData{NumUnseen: u32(4)},
+			MailboxChanges{UnseenDelta: 1}},
+	}
+	for _, tt := range tests {
+		if got := CompareStatus(prev, tt.cur); got != tt.want {
+			t.Errorf("%s: CompareStatus() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+	if CompareStatus(nil, prev).Changed() {
+		t.Error("CompareStatus(nil, cur).Changed() = true")
+	}
+}
+
+func TestCompareSelect(t *testing.T) {
+	prev := &imap.SelectData{NumMessages: 4, UIDNext: 5, UIDValidity: 1, HighestModSeq: 10}
+	cur := &imap.SelectData{NumMessages: 4, UIDNext: 5, UIDValidity: 1, HighestModSeq: 12}
+	if got, want := CompareSelect(prev, cur), (MailboxChanges{ModSeqAdvanced: true}); got != want {
+		t.Errorf("CompareSelect() = %+v, want %+v", got, want)
+	}
+
+	// HIGHESTMODSEQ is not compared if a server did not send it
+	cur = &imap.SelectData{NumMessages: 4, UIDNext: 5, UIDValidity: 1}
+	if got := CompareSelect(prev, cur); got.Changed() {
+		t.Errorf("CompareSelect() = %+v, want no changes", got)
+	}
+}
+
+func TestPollStatus(t *testing.T) {
+	var mu sync.Mutex
+	var cmds []string
+	unseen := 1
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1 CONDSTORE] ready", func(w io.Writer, tag, cmd string) {
+		mu.Lock()
+		defer mu.Unlock()
+		cmds = append(cmds, cmd)
+		fmt.Fprintf(w, "* STATUS INBOX (MESSAGES 3 UIDNEXT 4 UIDVALIDITY 1 UNSEEN %d HIGHESTMODSEQ 9)\r\n", unseen)
+		unseen++
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+
+	first, changes, err := c.PollStatus("INBOX", nil)
+	if err != nil {
+		t.Fatalf("PollStatus() error: %v", err)
+	}
+	if changes.Changed() {
+		t.Errorf("first PollStatus() changes = %+v", changes)
+	}
+	_, changes, err = c.PollStatus("INBOX", first)
+	if err != nil {
+		t.Fatalf("PollStatus() error: %v", err)
+	}
+	if changes != (MailboxChanges{UnseenDelta: 1}) {
+		t.Errorf("PollStatus() changes = %+v", changes)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !strings.Contains(cmds[0], "HIGHESTMODSEQ") {
+		t.Errorf("STATUS command %q does not request HIGHESTMODSEQ", cmds[0])
+	}
+}
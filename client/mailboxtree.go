@@ -0,0 +1,290 @@
+package client
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// ErrNoClient is returned by MailboxTree methods that need to send commands
+// when the tree was built with NewMailboxTree.
+var ErrNoClient = errors.New("mailbox tree has no client")
+
+// MailboxTree is the mailbox hierarchy of an account, built from LIST
+// responses, for folder-tree user interfaces. Children of a mailbox are
+// listed on demand with Expand, so large hierarchies need not be listed
+// at once.
+//
+// A MailboxTree is not safe for concurrent use.
+type MailboxTree struct {
+	// Delim is the hierarchy delimiter, or 0 if the server does not have a
+	// hierarchy or it is not known yet.
+	Delim rune
+
+	client     *Client
+	root       *MailboxNode
+	nodes      map[string]*MailboxNode
+	subscribed map[string]bool
+}
+
+// MailboxNode is a mailbox in a MailboxTree.
+type MailboxNode struct {
+	// Name is the full name of the mailbox. It is empty for the root.
+	Name string
+	// Data is the LIST response for the mailbox. It is nil for the root
+	// and for mailboxes only known as the parent of another mailbox.
+	Data *imap.ListData
+
+	tree     *MailboxTree
+	parent   *MailboxNode
+	children map[string]*MailboxNode
+	expanded bool
+}
+
+// NewMailboxTree builds a tree from LIST responses, for example the result
+// of ListMailboxes("", "*"). Parents missing from list are added as nodes
+// without Data. Expand cannot be used on the returned tree.
+func NewMailboxTree(list []*imap.ListData) *MailboxTree {
+	t := newMailboxTree(nil)
+	for _, data := range list {
+		t.add(data)
+	}
+	return t
+}
+
+// MailboxTree lists the top-level mailboxes with LIST "" "%" and returns
+// a tree whose children are listed when they are expanded.
+func (c *Client) MailboxTree() (*MailboxTree, error) {
+	t := newMailboxTree(c)
+	if err := t.root.Expand(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func newMailboxTree(c *Client) *MailboxTree {
+	t := &MailboxTree{
+		client:     c,
+		nodes:      make(map[string]*MailboxNode),
+		subscribed: make(map[string]bool),
+	}
+	t.root = &MailboxNode{tree: t, children: make(map[string]*MailboxNode)}
+	return t
+}
+
+// Root returns the root of the tree. Its children are the top-level
+// mailboxes.
+func (t *MailboxTree) Root() *MailboxNode {
+	return t.root
+}
+
+// Lookup returns the node of the named mailbox, or nil if it is not in the
+// tree. The name INBOX is case-insensitive.
+func (t *MailboxTree) Lookup(name string) *MailboxNode {
+	return t.nodes[mailboxKey(name)]
+}
+
+// Split splits a mailbox name into its hierarchy levels using the
+// delimiter of the tree.
+func (t *MailboxTree) Split(name string) []string {
+	if t.Delim == 0 || name == "" {
+		return []string{name}
+	}
+	return strings.Split(name, string(t.Delim))
+}
+
+// Join joins hierarchy levels into a mailbox name using the delimiter of
+// the tree. It is the inverse of Split.
+func (t *MailboxTree) Join(parts ...string) string {
+	return strings.Join(parts, string(t.Delim))
+}
+
+// SetSubscribed marks the named mailboxes as subscribed, and all others as
+// not subscribed, for example with the result of ListSubscribed.
+func (t *MailboxTree) SetSubscribed(names []string) {
+	t.subscribed = make(map[string]bool, len(names))
+	for _, name := range names {
+		t.subscribed[mailboxKey(name)] = true
+	}
+}
+
+// LoadSubscriptions lists the subscribed mailboxes and overlays their
+// subscription state on the tree, including mailboxes not expanded yet.
+func (t *MailboxTree) LoadSubscriptions() error {
+	if t.client == nil {
+		return ErrNoClient
+	}
+	list, err := t.client.ListSubscribed("", "*")
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(list))
+	for i, data := range list {
+		names[i] = data.Mailbox
+	}
+	t.SetSubscribed(names)
+	return nil
+}
+
+// add adds the mailbox of a LIST response to the tree.
+func (t *MailboxTree) add(data *imap.ListData) *MailboxNode {
+	if t.Delim == 0 && data.Delim != 0 {
+		t.Delim = data.Delim
+	}
+	n := t.node(data.Mailbox)
+	n.Data = data
+	return n
+}
+
+// node returns the node of the named mailbox, creating it and its missing
+// parents if needed.
+func (t *MailboxTree) node(name string) *MailboxNode {
+	key := mailboxKey(name)
+	if n, ok := t.nodes[key]; ok {
+		return n
+	}
+
+	parent := t.root
+	if t.Delim != 0 {
+		if i := strings.LastIndex(name, string(t.Delim)); i > 0 {
+			parent = t.node(name[:i])
+		}
+	}
+	n := &MailboxNode{Name: name, tree: t, parent: parent, children: make(map[string]*MailboxNode)}
+	parent.children[key] = n
+	t.nodes[key] = n
+	return n
+}
+
+// remove removes n and its children from the tree.
+func (t *MailboxTree) remove(n *MailboxNode) {
+	for _, child := range n.children {
+		t.remove(child)
+	}
+	key := mailboxKey(n.Name)
+	delete(t.nodes, key)
+	delete(n.parent.children, key)
+}
+
+// mailboxKey returns the key of a mailbox name in a tree: INBOX is
+// case-insensitive.
+func mailboxKey(name string) string {
+	if strings.EqualFold(name, "INBOX") {
+		return "INBOX"
+	}
+	return name
+}
+
+// Parent returns the parent of the mailbox, or the root for top-level
+// mailboxes. It returns nil for the root.
+func (n *MailboxNode) Parent() *MailboxNode {
+	return n.parent
+}
+
+// IsRoot reports whether n is the root of the tree.
+func (n *MailboxNode) IsRoot() bool {
+	return n.parent == nil
+}
+
+// Leaf returns the last hierarchy level of the name, for display.
+func (n *MailboxNode) Leaf() string {
+	parts := n.tree.Split(n.Name)
+	return parts[len(parts)-1]
+}
+
+// Children returns the known children of the mailbox, sorted by name.
+func (n *MailboxNode) Children() []*MailboxNode {
+	children := make([]*MailboxNode, 0, len(n.children))
+	for _, child := range n.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Name < children[j].Name
+	})
+	return children
+}
+
+// HasChildren reports whether the mailbox has or may have children, for
+// showing an expander. It uses the known children and the \HasChildren,
+// \HasNoChildren and \Noinferiors attributes; if the server sent none of
+// them, unexpanded mailboxes may have children.
+func (n *MailboxNode) HasChildren() bool {
+	if len(n.children) > 0 {
+		return true
+	}
+	if n.expanded || n.Data == nil {
+		return false
+	}
+	switch {
+	case hasAttr(n.Data.Attrs, imap.MailboxAttrHasChildren):
+		return true
+	case hasAttr(n.Data.Attrs, imap.MailboxAttrHasNoChildren),
+		hasAttr(n.Data.Attrs, imap.MailboxAttrNoInferiors):
+		return false
+	}
+	return n.tree.Delim != 0
+}
+
+// Selectable reports whether the mailbox can be selected.
+func (n *MailboxNode) Selectable() bool {
+	if n.Data == nil {
+		return false
+	}
+	return !hasAttr(n.Data.Attrs, imap.MailboxAttrNoSelect) &&
+		!hasAttr(n.Data.Attrs, imap.MailboxAttrNonExistent)
+}
+
+// Subscribed reports whether the mailbox is subscribed, according to the
+// \Subscribed attribute or the subscription state set on the tree.
+func (n *MailboxNode) Subscribed() bool {
+	if n.tree.subscribed[mailboxKey(n.Name)] {
+		return true
+	}
+	return n.Data != nil && hasAttr(n.Data.Attrs, imap.MailboxAttrSubscribed)
+}
+
+// Expanded reports whether the children of the mailbox have been listed.
+func (n *MailboxNode) Expanded() bool {
+	return n.expanded
+}
+
+// Expand lists the children of the mailbox with LIST "" "name/%" and
+// replaces the known children with the result. Mailboxes that have no
+// children according to their attributes are not listed.
+func (n *MailboxNode) Expand() error {
+	t := n.tree
+	if t.client == nil {
+		return ErrNoClient
+	}
+
+	pattern := "%"
+	if !n.IsRoot() {
+		if t.Delim == 0 || (n.Data != nil && !n.HasChildren()) {
+			n.expanded = true
+			return nil
+		}
+		pattern = n.Name + string(t.Delim) + "%"
+	}
+
+	list, err := t.client.ListMailboxes("", pattern)
+	if err != nil {
+		return err
+	}
+
+	listed := make(map[string]bool, len(list))
+	for _, data := range list {
+		child := t.add(data)
+		if child.parent == n {
+			listed[mailboxKey(child.Name)] = true
+		}
+	}
+	for key, child := range n.children {
+		if !listed[key] {
+			t.remove(child)
+		}
+	}
+	n.expanded = true
+	return nil
+}
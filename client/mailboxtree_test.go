@@ -0,0 +1,151 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func childNames(n *MailboxNode) []string {
+	var names []string
+	for _, child := range n.Children() {
+		names = append(names, child.Name)
+	}
+	return names
+}
+
+func TestNewMailboxTree(t *testing.T) {
+	tree := NewMailboxTree([]*imap.ListData{
+		{Mailbox: "INBOX", Delim: '/', Attrs: []imap.MailboxAttr{imap.MailboxAttrHasNoChildren}},
+		{Mailbox: "Work/Projects/Alpha", Delim: '/'},
+		{Mailbox: "Work", Delim: '/', Attrs: []imap.MailboxAttr{imap.MailboxAttrNoSelect, imap.MailboxAttrHasChildren}},
+	})
+
+	if tree.Delim != '/' {
+		t.Fatalf("Delim = %q, want '/'", tree.Delim)
+	}
+	if got := childNames(tree.Root()); !reflect.DeepEqual(got, []string{"INBOX", "Work"}) {
+		t.Errorf("top-level = %q", got)
+	}
+
+	alpha := tree.Lookup("Work/Projects/Alpha")
+	if alpha == nil {
+		t.Fatal("Lookup(Work/Projects/Alpha) = nil")
+	}
+	if alpha.Leaf() != "Alpha" {
+		t.Errorf("Leaf() = %q, want Alpha", alpha.Leaf())
+	}
+	projects := alpha.Parent()
+	if projects.Name != "Work/Projects" || projects.Data != nil || projects.Selectable() {
+		t.Errorf("implied parent = %+v", projects)
+	}
+	if projects.Parent() != tree.Lookup("Work") || tree.Lookup("Work").Parent() != tree.Root() {
+		t.Error("parent chain does not lead to the root")
+	}
+	if tree.Lookup("Work").Selectable() {
+		t.Error("\\Noselect mailbox is selectable")
+	}
+	if tree.Lookup("inbox") == nil || tree.Lookup("INBOX").HasChildren() {
+		t.Error("INBOX lookup or HasChildren is wrong")
+	}
+
+	if got := tree.Split("Work/Projects/Alpha"); !reflect.DeepEqual(got, []string{"Work", "Projects", "Alpha"}) {
+		t.Errorf("Split() = %q", got)
+	}
+	if got := tree.Join("Work", "Projects"); got != "Work/Projects" {
+		t.Errorf("Join() = %q", got)
+	}
+
+	tree.SetSubscribed([]string{"inbox", "Work/Projects/Alpha"})
+	if !tree.Lookup("INBOX").Subscribed() || !alpha.Subscribed() || projects.Subscribed() {
+		t.Error("subscription overlay is wrong")
+	}
+
+	if err := alpha.Expand(); err != ErrNoClient {
+		t.Errorf("Expand() error = %v, want ErrNoClient", err)
+	}
+}
+
+func TestClient_MailboxTree(t *testing.T) {
+	var cmds []string
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		cmds = append(cmds, cmd)
+		switch cmd {
+		case `LIST "" %`:
+			fmt.Fprint(w, `* LIST (\HasNoChildren) "." INBOX`+"\r\n")
+			fmt.Fprint(w, `* LIST (\HasChildren) "." Archive`+"\r\n")
+		case `LIST "" Archive.%`:
+			fmt.Fprint(w, `* LIST (\HasNoChildren) "." Archive.2023`+"\r\n")
+			fmt.Fprint(w, `* LIST (\HasNoChildren) "." Archive.2024`+"\r\n")
+		case `LSUB "" *`:
+			fmt.Fprint(w, `* LSUB () "." Archive.2024`+"\r\n")
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+
+	tree, err := c.MailboxTree()
+	if err != nil {
+		t.Fatalf("MailboxTree() error: %v", err)
+	}
+	archive := tree.Lookup("Archive")
+	if archive == nil || !archive.HasChildren() || archive.Expanded() {
+		t.Fatalf("Archive = %+v, want unexpanded with children", archive)
+	}
+	if len(archive.Children()) != 0 {
+		t.Errorf("children listed before Expand()")
+	}
+
+	if err := archive.Expand(); err != nil {
+		t.Fatalf("Expand() error: %v", err)
+	}
+	if got := childNames(archive); !reflect.DeepEqual(got, []string{"Archive.2023", "Archive.2024"}) {
+		t.Errorf("children = %q", got)
+	}
+
+	// INBOX has no children, so expanding it does not send a command.
+	if err := tree.Lookup("INBOX").Expand(); err != nil {
+		t.Fatalf("Expand() error: %v", err)
+	}
+
+	if err := tree.LoadSubscriptions(); err != nil {
+		t.Fatalf("LoadSubscriptions() error: %v", err)
+	}
+	if !tree.Lookup("Archive.2024").Subscribed() || tree.Lookup("Archive.2023").Subscribed() {
+		t.Error("subscription state not loaded")
+	}
+
+	want := []string{`LIST "" %`, `LIST "" Archive.%`, `LSUB "" *`}
+	if strings.Join(cmds, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands = %q, want %q", cmds, want)
+	}
+}
+
+func TestMailboxNode_ExpandRemovesDeleted(t *testing.T) {
+	gone := false
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		fmt.Fprint(w, `* LIST () "/" A`+"\r\n")
+		if !gone {
+			fmt.Fprint(w, `* LIST () "/" B`+"\r\n")
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+
+	tree, err := c.MailboxTree()
+	if err != nil {
+		t.Fatalf("MailboxTree() error: %v", err)
+	}
+	if got := childNames(tree.Root()); len(got) != 2 {
+		t.Fatalf("top-level = %q", got)
+	}
+	gone = true
+	if err := tree.Root().Expand(); err != nil {
+		t.Fatalf("Expand() error: %v", err)
+	}
+	if got := childNames(tree.Root()); !reflect.DeepEqual(got, []string{"A"}) || tree.Lookup("B") != nil {
+		t.Errorf("top-level after Expand() = %q", got)
+	}
+}
@@ -0,0 +1,237 @@
+package maildir
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client"
+)
+
+// DefaultBatchSize is the number of messages fetched or appended per
+// command if the options do not set one.
+const DefaultBatchSize = 100
+
+// ExportOptions contains options for Export.
+type ExportOptions struct {
+	// BatchSize is the number of messages fetched per UID FETCH command.
+	// If zero, DefaultBatchSize is used.
+	BatchSize int
+	// Prune removes the files of messages exported before that are no
+	// longer in the mailbox, instead of keeping them.
+	Prune bool
+}
+
+// ExportResult is the result of Export.
+type ExportResult struct {
+	// UIDValidity is the UIDVALIDITY of the mailbox.
+	UIDValidity uint32
+	// Exported is the number of messages downloaded.
+	Exported int
+	// Updated is the number of messages already in the Maildir whose flags
+	// were updated.
+	Updated int
+	// Deleted is the number of files removed with ExportOptions.Prune.
+	Deleted int
+	// Bytes is the size of the messages downloaded.
+	Bytes int64
+}
+
+// exportedRe matches the UID and UIDVALIDITY in the unique name of an
+// exported message.
+var exportedRe = regexp.MustCompile(`\.U(\d+)V(\d+)\.`)
+
+// exportedFile is a message file written by an earlier export.
+type exportedFile struct {
+	sub  string // "new" or "cur"
+	name string
+}
+
+// Export mirrors a mailbox to the Maildir dir, which is created if needed.
+// The mailbox is opened read-only with EXAMINE, so the \Seen flags are not
+// changed.
+//
+// Messages are stored in cur under names containing their UID and the
+// UIDVALIDITY of the mailbox, with their flags in the info suffix and
+// their internal date as modification time. Messages exported before with
+// the same UIDVALIDITY are not downloaded again, but their flags are
+// updated. Files of messages that were expunged are kept, unless
+// opts.Prune is set. If Export fails after the mailbox was opened, the
+// result counts the work done until then.
+func Export(c *client.Client, mailbox, dir string, opts *ExportOptions) (*ExportResult, error) {
+	if opts == nil {
+		opts = &ExportOptions{}
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	if err := create(dir); err != nil {
+		return nil, err
+	}
+	kw, err := loadKeywords(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.Examine(mailbox)
+	if err != nil {
+		return nil, err
+	}
+	result := &ExportResult{UIDValidity: data.UIDValidity}
+
+	existing, err := exportedFiles(dir, data.UIDValidity)
+	if err != nil {
+		return result, err
+	}
+
+	uids, err := c.UIDSearch("ALL")
+	if err != nil {
+		return result, err
+	}
+	var known, missing []uint32
+	onServer := make(map[imap.UID]bool, len(uids))
+	for _, uid := range uids {
+		onServer[imap.UID(uid)] = true
+		if _, ok := existing[imap.UID(uid)]; ok {
+			known = append(known, uid)
+		} else {
+			missing = append(missing, uid)
+		}
+	}
+
+	if opts.Prune {
+		for uid, f := range existing {
+			if onServer[uid] {
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, f.sub, f.name)); err != nil && !os.IsNotExist(err) {
+				return result, err
+			}
+			result.Deleted++
+		}
+	}
+
+	for _, batch := range batches(known, batchSize) {
+		msgs, err := c.UIDFetchMessages(batch, "(UID FLAGS)")
+		if err != nil {
+			return result, err
+		}
+		for _, msg := range msgs {
+			f, ok := existing[msg.UID]
+			if !ok {
+				continue
+			}
+			updated, err := updateFlags(dir, f, kw.info(msg.Flags))
+			if err != nil {
+				return result, err
+			}
+			if updated {
+				result.Updated++
+			}
+		}
+	}
+
+	for _, batch := range batches(missing, batchSize) {
+		msgs, err := c.UIDFetchMessages(batch, "(UID FLAGS INTERNALDATE BODY.PEEK[])")
+		if err != nil {
+			return result, err
+		}
+		for _, msg := range msgs {
+			body, ok := msg.BodySection[""]
+			if !ok || msg.UID == 0 {
+				continue
+			}
+			if err := writeMessage(dir, data.UIDValidity, msg, body, kw.info(msg.Flags)); err != nil {
+				return result, err
+			}
+			result.Exported++
+			result.Bytes += int64(len(body))
+		}
+	}
+
+	if err := kw.save(dir); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// exportedFiles returns the files of the messages exported with the given
+// UIDVALIDITY, by UID.
+func exportedFiles(dir string, uidValidity uint32) (map[imap.UID]exportedFile, error) {
+	files := make(map[imap.UID]exportedFile)
+	for _, sub := range []string{"new", "cur"} {
+		entries, err := os.ReadDir(filepath.Join(dir, sub))
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			unique, _ := splitName(e.Name())
+			m := exportedRe.FindStringSubmatch(unique)
+			if m == nil || m[2] != strconv.FormatUint(uint64(uidValidity), 10) {
+				continue
+			}
+			uid, err := strconv.ParseUint(m[1], 10, 32)
+			if err != nil {
+				continue
+			}
+			files[imap.UID(uid)] = exportedFile{sub: sub, name: e.Name()}
+		}
+	}
+	return files, nil
+}
+
+// updateFlags renames an exported message file to cur with the given info
+// and reports whether it changed.
+func updateFlags(dir string, f exportedFile, info string) (bool, error) {
+	unique, _ := splitName(f.name)
+	name := unique + infoSeparator + info
+	if f.sub == "cur" && f.name == name {
+		return false, nil
+	}
+	err := os.Rename(filepath.Join(dir, f.sub, f.name), filepath.Join(dir, "cur", name))
+	return err == nil, err
+}
+
+// writeMessage writes a message to tmp and moves it to cur, as Maildir
+// delivery requires.
+func writeMessage(dir string, uidValidity uint32, msg *imap.FetchMessageBuffer, body []byte, info string) error {
+	date := msg.InternalDate
+	if date.IsZero() {
+		date = time.Now()
+	}
+	unique := fmt.Sprintf("%d.U%dV%d.imap-go", date.Unix(), msg.UID, uidValidity)
+
+	tmp := filepath.Join(dir, "tmp", unique)
+	if err := os.WriteFile(tmp, body, 0o600); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp, date, date); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, "cur", unique+infoSeparator+info))
+}
+
+// batches splits UIDs into UID sets of at most size UIDs.
+func batches(uids []uint32, size int) []string {
+	var sets []string
+	for len(uids) > 0 {
+		n := size
+		if n > len(uids) {
+			n = len(uids)
+		}
+		set := &imap.UIDSet{}
+		for _, uid := range uids[:n] {
+			set.AddNum(imap.UID(uid))
+		}
+		sets = append(sets, set.String())
+		uids = uids[n:]
+	}
+	return sets
+}
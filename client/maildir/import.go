@@ -0,0 +1,123 @@
+package maildir
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client"
+)
+
+// ImportOptions contains options for Import.
+type ImportOptions struct {
+	// BatchSize is the number of messages appended per APPEND command if
+	// the server supports MULTIAPPEND. If zero, DefaultBatchSize is used.
+	BatchSize int
+}
+
+// ImportResult is the result of Import.
+type ImportResult struct {
+	// Imported is the number of messages appended.
+	Imported int
+}
+
+// messageFile is a message file of a Maildir to import.
+type messageFile struct {
+	path    string
+	info    string
+	modTime time.Time
+}
+
+// Import appends the messages in the new and cur directories of the
+// Maildir dir to mailbox, oldest first. The flags of each message are read
+// from the info suffix of its file name and its internal date is the
+// modification time of the file, so that a Maildir written by Export is
+// restored as it was.
+//
+// If the server supports MULTIAPPEND, messages are appended in batches of
+// BatchSize; each batch is appended atomically.
+func Import(c *client.Client, dir, mailbox string, opts *ImportOptions) (*ImportResult, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	if !c.HasCap(string(imap.CapMultiAppend)) {
+		batchSize = 1
+	}
+
+	kw, err := loadKeywords(dir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := messageFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{}
+	for len(files) > 0 {
+		n := batchSize
+		if n > len(files) {
+			n = len(files)
+		}
+		msgs := make([]client.AppendMessage, n)
+		for i, f := range files[:n] {
+			b, err := os.ReadFile(f.path)
+			if err != nil {
+				return result, err
+			}
+			msgs[i] = client.AppendMessage{
+				Flags:        kw.flags(f.info),
+				InternalDate: f.modTime,
+				Literal:      b,
+			}
+		}
+		if _, err := c.MultiAppend(mailbox, msgs); err != nil {
+			return result, err
+		}
+		result.Imported += n
+		files = files[n:]
+	}
+	return result, nil
+}
+
+// messageFiles returns the message files in the new and cur directories,
+// ordered by modification time and name.
+func messageFiles(dir string) ([]messageFile, error) {
+	var files []messageFile
+	for _, sub := range []string{"new", "cur"} {
+		entries, err := os.ReadDir(filepath.Join(dir, sub))
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !e.Type().IsRegular() || e.Name()[0] == '.' {
+				continue
+			}
+			fi, err := e.Info()
+			if err != nil {
+				return nil, err
+			}
+			f := messageFile{
+				path:    filepath.Join(dir, sub, e.Name()),
+				modTime: fi.ModTime(),
+			}
+			if sub == "cur" {
+				_, f.info = splitName(e.Name())
+			}
+			files = append(files, f)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if !files[i].modTime.Equal(files[j].modTime) {
+			return files[i].modTime.Before(files[j].modTime)
+		}
+		return files[i].path < files[j].path
+	})
+	return files, nil
+}
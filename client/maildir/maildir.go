@@ -0,0 +1,168 @@
+// Package maildir mirrors IMAP mailboxes to local Maildir directories and
+// back, as the building blocks of backup and restore tools.
+//
+// Export downloads a mailbox into a Maildir. Flags are stored in the info
+// suffix of the file names ("msg:2,FS") and internal dates in the
+// modification times of the files. Keywords are mapped to the letters a-z
+// with a dovecot-keywords file, as Dovecot does. Exporting again only
+// downloads new messages and updates the flags of those already exported.
+//
+// Import uploads the messages of a Maildir to a mailbox with APPEND, using
+// MULTIAPPEND (RFC 3502) to send several messages per command if the
+// server supports it.
+//
+// SyncOnce runs Export for several mailboxes as a single bounded pass,
+// connecting and disconnecting, for backups run periodically by cron or
+// systemd timers. Its errors are categorized, with exit statuses, so that
+// failures worth retrying can be told from those needing attention.
+package maildir
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// infoSeparator separates the unique name of a message file from its info.
+const infoSeparator = ":2,"
+
+// keywordsFile is the name of the file mapping keywords to letters.
+const keywordsFile = "dovecot-keywords"
+
+// maxKeywords is the number of keywords that have a letter.
+const maxKeywords = 26
+
+// systemFlags maps system flags to their info letters.
+var systemFlags = map[imap.Flag]byte{
+	imap.FlagDraft:    'D',
+	imap.FlagFlagged:  'F',
+	imap.FlagAnswered: 'R',
+	imap.FlagSeen:     'S',
+	imap.FlagDeleted:  'T',
+}
+
+// create creates the tmp, new and cur directories of a Maildir.
+func create(dir string) error {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitName splits a message file name into its unique name and info.
+func splitName(name string) (unique, info string) {
+	if i := strings.Index(name, infoSeparator); i >= 0 {
+		return name[:i], name[i+len(infoSeparator):]
+	}
+	return name, ""
+}
+
+// keywords maps keywords to info letters.
+type keywords struct {
+	names []string
+	dirty bool
+}
+
+// loadKeywords reads the dovecot-keywords file of a Maildir, if any.
+func loadKeywords(dir string) (*keywords, error) {
+	kw := &keywords{}
+	f, err := os.Open(filepath.Join(dir, keywordsFile))
+	if os.IsNotExist(err) {
+		return kw, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		idx, name, ok := strings.Cut(s.Text(), " ")
+		n, err := strconv.Atoi(idx)
+		if !ok || err != nil || n < 0 || n >= maxKeywords || name == "" {
+			continue
+		}
+		for len(kw.names) <= n {
+			kw.names = append(kw.names, "")
+		}
+		kw.names[n] = name
+	}
+	return kw, s.Err()
+}
+
+// save writes the dovecot-keywords file if keywords were added.
+func (kw *keywords) save(dir string) error {
+	if !kw.dirty {
+		return nil
+	}
+	var b strings.Builder
+	for i, name := range kw.names {
+		if name != "" {
+			fmt.Fprintf(&b, "%d %s\n", i, name)
+		}
+	}
+	return os.WriteFile(filepath.Join(dir, keywordsFile), []byte(b.String()), 0o600)
+}
+
+// letter returns the letter of a keyword, assigning one if needed. It
+// returns 0 if all letters are taken.
+func (kw *keywords) letter(name string) byte {
+	for i, n := range kw.names {
+		if strings.EqualFold(n, name) {
+			return byte('a' + i)
+		}
+	}
+	if len(kw.names) >= maxKeywords {
+		return 0
+	}
+	kw.names = append(kw.names, name)
+	kw.dirty = true
+	return byte('a' + len(kw.names) - 1)
+}
+
+// info returns the info of a message with the given flags. Keywords
+// without a letter are dropped.
+func (kw *keywords) info(flags []imap.Flag) string {
+	var letters []byte
+	for _, f := range flags {
+		if strings.HasPrefix(string(f), "\\") {
+			for flag, l := range systemFlags {
+				if strings.EqualFold(string(flag), string(f)) {
+					letters = append(letters, l)
+				}
+			}
+		} else if l := kw.letter(string(f)); l != 0 {
+			letters = append(letters, l)
+		}
+	}
+	sort.Slice(letters, func(i, j int) bool { return letters[i] < letters[j] })
+	return string(letters)
+}
+
+// flags returns the flags of a message with the given info. Unknown
+// letters are ignored.
+func (kw *keywords) flags(info string) []imap.Flag {
+	var flags []imap.Flag
+	for i := 0; i < len(info); i++ {
+		l := info[i]
+		if l >= 'a' && l <= 'z' {
+			if n := int(l - 'a'); n < len(kw.names) && kw.names[n] != "" {
+				flags = append(flags, imap.Flag(kw.names[n]))
+			}
+			continue
+		}
+		for flag, fl := range systemFlags {
+			if fl == l {
+				flags = append(flags, flag)
+			}
+		}
+	}
+	return flags
+}
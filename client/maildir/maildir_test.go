@@ -0,0 +1,328 @@
+package maildir
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client"
+)
+
+type fakeMessage struct {
+	uid   imap.UID
+	flags string
+	date  string
+	body  string
+}
+
+// fakeServer is a minimal IMAP server supporting the commands used by
+// Export and Import, including synchronizing literals.
+type fakeServer struct {
+	mu       sync.Mutex
+	msgs     []fakeMessage
+	appends  []string
+	fetches  []string
+	greeting string
+	// missing is a mailbox that does not exist, and hang a mailbox whose
+	// EXAMINE is never answered.
+	missing, hang string
+}
+
+var literalRe = regexp.MustCompile(`\{(\d+)\}$`)
+
+func (s *fakeServer) dial(t *testing.T) *client.Client {
+	t.Helper()
+
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() {
+		_ = serverConn.Close()
+		_ = clientConn.Close()
+	})
+
+	go func() {
+		fmt.Fprint(serverConn, s.greeting+"\r\n")
+		r := bufio.NewReader(serverConn)
+		for {
+			cmd, err := readCommand(serverConn, r)
+			if err != nil {
+				return
+			}
+			tag, rest, _ := strings.Cut(cmd, " ")
+			s.respond(serverConn, tag, rest)
+		}
+	}()
+
+	c, err := client.New(clientConn)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+// readCommand reads a command line, accepting synchronizing literals.
+func readCommand(w io.Writer, r *bufio.Reader) (string, error) {
+	var b strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		b.WriteString(line)
+		m := literalRe.FindStringSubmatch(line)
+		if m == nil {
+			return b.String(), nil
+		}
+		n, _ := strconv.Atoi(m[1])
+		fmt.Fprint(w, "+ go ahead\r\n")
+		lit := make([]byte, n)
+		if _, err := io.ReadFull(r, lit); err != nil {
+			return "", err
+		}
+		b.Write(lit)
+	}
+}
+
+func (s *fakeServer) respond(w io.Writer, tag, cmd string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name, args, _ := strings.Cut(cmd, " ")
+	switch strings.ToUpper(name) {
+	case "EXAMINE":
+		switch args {
+		case s.missing:
+			fmt.Fprintf(w, "%s NO [NONEXISTENT] no such mailbox\r\n", tag)
+			return
+		case s.hang:
+			return
+		}
+		fmt.Fprintf(w, "* %d EXISTS\r\n", len(s.msgs))
+		fmt.Fprint(w, "* OK [UIDVALIDITY 7] UIDs valid\r\n")
+		fmt.Fprintf(w, "%s OK [READ-ONLY] EXAMINE completed\r\n", tag)
+	case "APPEND":
+		s.appends = append(s.appends, args)
+		fmt.Fprintf(w, "%s OK APPEND completed\r\n", tag)
+	case "UID":
+		sub, args, _ := strings.Cut(args, " ")
+		switch strings.ToUpper(sub) {
+		case "SEARCH":
+			var uids []string
+			for _, m := range s.msgs {
+				uids = append(uids, strconv.Itoa(int(m.uid)))
+			}
+			fmt.Fprintf(w, "* SEARCH %s\r\n", strings.Join(uids, " "))
+		case "FETCH":
+			s.fetches = append(s.fetches, args)
+			setStr, items, _ := strings.Cut(args, " ")
+			set, _ := imap.ParseUIDSet(setStr)
+			for i, m := range s.msgs {
+				if !set.Contains(m.uid) {
+					continue
+				}
+				if strings.Contains(items, "BODY.PEEK[]") {
+					fmt.Fprintf(w, "* %d FETCH (UID %d FLAGS (%s) INTERNALDATE \"%s\" BODY[] {%d}\r\n%s)\r\n",
+						i+1, m.uid, m.flags, m.date, len(m.body), m.body)
+				} else {
+					fmt.Fprintf(w, "* %d FETCH (UID %d FLAGS (%s))\r\n", i+1, m.uid, m.flags)
+				}
+			}
+		}
+		fmt.Fprintf(w, "%s OK UID %s completed\r\n", tag, sub)
+	default:
+		fmt.Fprintf(w, "%s BAD unknown command\r\n", tag)
+	}
+}
+
+func listMaildir(t *testing.T, dir string) []string {
+	t.Helper()
+	var names []string
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		entries, err := os.ReadDir(filepath.Join(dir, sub))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			names = append(names, sub+"/"+e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestKeywords_InfoRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	kw, err := loadKeywords(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags := []imap.Flag{imap.FlagSeen, "$Label1", imap.FlagFlagged, "Work"}
+	info := kw.info(flags)
+	if info != "FSab" {
+		t.Errorf("info = %q, want %q", info, "FSab")
+	}
+	if err := kw.save(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	kw, err = loadKeywords(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := kw.flags(info)
+	want := []imap.Flag{imap.FlagFlagged, imap.FlagSeen, "$Label1", "Work"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("flags = %v, want %v", got, want)
+	}
+	if l := kw.letter("work"); l != 'b' {
+		t.Errorf("letter(work) = %q, want 'b'", l)
+	}
+}
+
+func TestExport(t *testing.T) {
+	srv := &fakeServer{
+		greeting: "* OK ready",
+		msgs: []fakeMessage{
+			{uid: 3, flags: `\Seen`, date: " 2-Mar-2024 10:00:00 +0000", body: "Subject: one\r\n\r\nHello\r\n"},
+			{uid: 5, flags: `\Flagged Work`, date: "15-Apr-2024 12:30:00 +0200", body: "Subject: two\r\n\r\nWorld\r\n"},
+		},
+	}
+	c := srv.dial(t)
+	dir := filepath.Join(t.TempDir(), "backup")
+
+	res, err := Export(c, "INBOX", dir, nil)
+	if err != nil {
+		t.Fatalf("Export() error: %v", err)
+	}
+	if res.UIDValidity != 7 || res.Exported != 2 || res.Updated != 0 {
+		t.Errorf("result = %+v", res)
+	}
+
+	date1 := time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC)
+	date2 := time.Date(2024, 4, 15, 10, 30, 0, 0, time.UTC)
+	name1 := fmt.Sprintf("cur/%d.U3V7.imap-go:2,S", date1.Unix())
+	name2 := fmt.Sprintf("cur/%d.U5V7.imap-go:2,Fa", date2.Unix())
+	want := []string{name1, name2}
+	if got := listMaildir(t, dir); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, name1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != srv.msgs[0].body {
+		t.Errorf("message 1 = %q", b)
+	}
+	fi, err := os.Stat(filepath.Join(dir, name2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ModTime().Equal(date2) {
+		t.Errorf("mtime = %v, want %v", fi.ModTime(), date2)
+	}
+
+	// Exporting again only updates flags and downloads new messages.
+	srv.mu.Lock()
+	srv.msgs[0].flags = `\Seen \Answered`
+	srv.msgs = append(srv.msgs, fakeMessage{uid: 9, date: "15-Apr-2024 12:30:00 +0200", body: "Subject: three\r\n\r\n"})
+	srv.fetches = nil
+	srv.mu.Unlock()
+
+	res, err = Export(c, "INBOX", dir, nil)
+	if err != nil {
+		t.Fatalf("Export() error: %v", err)
+	}
+	if res.Exported != 1 || res.Updated != 1 {
+		t.Errorf("result = %+v", res)
+	}
+	want = []string{
+		fmt.Sprintf("cur/%d.U3V7.imap-go:2,RS", date1.Unix()),
+		name2,
+		fmt.Sprintf("cur/%d.U9V7.imap-go:2,", date2.Unix()),
+	}
+	if got := listMaildir(t, dir); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	wantFetches := []string{"3,5 (UID FLAGS)", "9 (UID FLAGS INTERNALDATE BODY.PEEK[])"}
+	if fmt.Sprint(srv.fetches) != fmt.Sprint(wantFetches) {
+		t.Errorf("fetches = %q, want %q", srv.fetches, wantFetches)
+	}
+}
+
+func writeFile(t *testing.T, path, body string, mtime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestMaildir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := create(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, keywordsFile), []byte("0 Work\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC)
+	writeFile(t, filepath.Join(dir, "cur", "b:2,Sa"), "second", date.Add(time.Hour))
+	writeFile(t, filepath.Join(dir, "cur", "a:2,F"), "first", date)
+	writeFile(t, filepath.Join(dir, "new", "c"), "third", date.Add(2*time.Hour))
+	return dir
+}
+
+func TestImport_MultiAppend(t *testing.T) {
+	srv := &fakeServer{greeting: "* OK [CAPABILITY IMAP4rev1 MULTIAPPEND] ready"}
+	c := srv.dial(t)
+	dir := newTestMaildir(t)
+
+	res, err := Import(c, dir, "Restored", &ImportOptions{BatchSize: 2})
+	if err != nil {
+		t.Fatalf("Import() error: %v", err)
+	}
+	if res.Imported != 3 {
+		t.Errorf("Imported = %d, want 3", res.Imported)
+	}
+	date := func(hour int) string {
+		return time.Date(2024, 3, 2, hour, 0, 0, 0, time.UTC).Local().Format(imap.InternalDateLayout)
+	}
+	want := []string{
+		fmt.Sprintf(`Restored (\Flagged) "%s" {5}first (\Seen Work) "%s" {6}second`, date(10), date(11)),
+		fmt.Sprintf(`Restored "%s" {5}third`, date(12)),
+	}
+	if fmt.Sprint(srv.appends) != fmt.Sprint(want) {
+		t.Errorf("appends = %q, want %q", srv.appends, want)
+	}
+}
+
+func TestImport_NoMultiAppend(t *testing.T) {
+	srv := &fakeServer{greeting: "* OK ready"}
+	c := srv.dial(t)
+	dir := newTestMaildir(t)
+
+	res, err := Import(c, dir, "Restored", nil)
+	if err != nil {
+		t.Fatalf("Import() error: %v", err)
+	}
+	if res.Imported != 3 || len(srv.appends) != 3 {
+		t.Errorf("Imported = %d with %d commands, want 3", res.Imported, len(srv.appends))
+	}
+}
@@ -0,0 +1,365 @@
+package maildir
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client"
+)
+
+// ErrorCategory classifies the error of a sync pass by what the operator
+// of a batch job should do about it.
+type ErrorCategory int
+
+const (
+	// CategoryNone is the category of a successful pass.
+	CategoryNone ErrorCategory = iota
+	// CategoryTransient errors may go away on the next run: the server
+	// could not be reached, the connection was lost, the server was
+	// unavailable, or the pass took longer than SyncOptions.Timeout.
+	CategoryTransient
+	// CategoryAuth errors mean the server rejected the credentials.
+	CategoryAuth
+	// CategoryMailbox errors mean a mailbox could not be synced, for
+	// example because it does not exist. The other mailboxes were synced.
+	CategoryMailbox
+	// CategoryLocal errors mean the Maildir could not be written.
+	CategoryLocal
+	// CategoryProtocol errors are other errors of the server or the
+	// client, which will happen again.
+	CategoryProtocol
+)
+
+// String returns the name of the category.
+func (c ErrorCategory) String() string {
+	switch c {
+	case CategoryNone:
+		return "none"
+	case CategoryTransient:
+		return "transient"
+	case CategoryAuth:
+		return "auth"
+	case CategoryMailbox:
+		return "mailbox"
+	case CategoryLocal:
+		return "local"
+	case CategoryProtocol:
+		return "protocol"
+	default:
+		return "unknown"
+	}
+}
+
+// ExitCode returns the exit status of a program whose sync pass ended
+// with an error of the category, following sysexits(3), so that service
+// managers can tell failures worth retrying from those needing attention:
+// 0 for CategoryNone, 75 (EX_TEMPFAIL) for CategoryTransient, 77
+// (EX_NOPERM) for CategoryAuth, 65 (EX_DATAERR) for CategoryMailbox, 74
+// (EX_IOERR) for CategoryLocal and 76 (EX_PROTOCOL) for CategoryProtocol.
+func (c ErrorCategory) ExitCode() int {
+	switch c {
+	case CategoryNone:
+		return 0
+	case CategoryTransient:
+		return 75
+	case CategoryAuth:
+		return 77
+	case CategoryMailbox:
+		return 65
+	case CategoryLocal:
+		return 74
+	default:
+		return 76
+	}
+}
+
+// SyncError is the error of a sync pass.
+type SyncError struct {
+	Category ErrorCategory
+	// Mailbox is the mailbox being synced, if any.
+	Mailbox string
+	Err     error
+}
+
+// Error implements error.
+func (e *SyncError) Error() string {
+	if e.Mailbox != "" {
+		return fmt.Sprintf("%s: %v", e.Mailbox, e.Err)
+	}
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *SyncError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit status for the error, see
+// ErrorCategory.ExitCode.
+func (e *SyncError) ExitCode() int {
+	return e.Category.ExitCode()
+}
+
+// Categorize returns the category of an error returned by SyncOnce.
+func Categorize(err error) ErrorCategory {
+	if err == nil {
+		return CategoryNone
+	}
+	var syncErr *SyncError
+	if errors.As(err, &syncErr) {
+		return syncErr.Category
+	}
+	return CategoryProtocol
+}
+
+// SyncOptions contains options for SyncOnce.
+type SyncOptions struct {
+	// Mailboxes are the mailboxes to sync. If empty, INBOX is synced.
+	Mailboxes []string
+	// Timeout bounds the whole pass, from connecting to logging out. If
+	// the pass takes longer, the connection is closed and the pass fails
+	// with a CategoryTransient error wrapping
+	// context.DeadlineExceeded. If 0, the pass is not bounded.
+	Timeout time.Duration
+	// Export are the options of the export of each mailbox.
+	Export ExportOptions
+}
+
+// SyncSummary is the result of a sync pass, meant to be logged or written
+// as JSON by batch jobs.
+type SyncSummary struct {
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	// Mailboxes are the mailboxes synced or attempted, in order.
+	Mailboxes []MailboxSummary `json:"mailboxes"`
+	// Fetched, Updated, Deleted and Bytes are the totals of Mailboxes.
+	Fetched int   `json:"fetched"`
+	Updated int   `json:"updated"`
+	Deleted int   `json:"deleted"`
+	Bytes   int64 `json:"bytes"`
+	// Category and Error describe the error the pass ended with, if any.
+	Category string `json:"category"`
+	Error    string `json:"error,omitempty"`
+	// RetryAfter is how long to wait before the next pass if the server
+	// throttled this one, see client.RetryAfterError.
+	RetryAfter time.Duration `json:"retryAfter,omitempty"`
+}
+
+// MailboxSummary is the result of syncing a mailbox.
+type MailboxSummary struct {
+	Mailbox     string `json:"mailbox"`
+	Dir         string `json:"dir"`
+	UIDValidity uint32 `json:"uidValidity,omitempty"`
+	// Fetched is the number of messages downloaded, Updated the number
+	// of messages whose flags changed, and Deleted the number of files
+	// of expunged messages removed with ExportOptions.Prune.
+	Fetched int    `json:"fetched"`
+	Updated int    `json:"updated"`
+	Deleted int    `json:"deleted"`
+	Bytes   int64  `json:"bytes"`
+	Error   string `json:"error,omitempty"`
+}
+
+// SyncOnce performs a single bounded sync pass, for periodic batch jobs
+// run by cron or systemd timers rather than long-lived daemons: it
+// connects with dial, which returns a logged in client, mirrors each
+// mailbox to a Maildir with Export, logs out and returns a summary.
+//
+// With a single mailbox, dir is its Maildir; with several, each mailbox
+// is mirrored to a Maildir under dir named after it, with the hierarchy
+// separator '/' replaced by '.' as in Maildir++ folder names.
+//
+// A mailbox that cannot be synced does not stop the pass; the error is
+// recorded in its summary and the pass returns a CategoryMailbox error
+// once the other mailboxes are synced. Other errors end the pass. All
+// errors are *SyncError values; the summary is returned in all cases.
+//
+// If the server throttles the pass (see client.RetryAfterError), SyncOnce
+// backs off and retries connecting or exporting the mailbox up to three
+// times, within opts.Timeout. If it gives up, the pass fails with a
+// CategoryTransient error and the summary's RetryAfter tells when to run
+// the next one.
+func SyncOnce(dial func() (*client.Client, error), dir string, opts *SyncOptions) (*SyncSummary, error) {
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+	mailboxes := opts.Mailboxes
+	if len(mailboxes) == 0 {
+		mailboxes = []string{"INBOX"}
+	}
+
+	summary := &SyncSummary{Started: time.Now()}
+	err := syncOnce(dial, dir, mailboxes, opts, summary)
+	summary.Duration = time.Since(summary.Started)
+	summary.Category = Categorize(err).String()
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	return summary, err
+}
+
+// maxThrottleRetries is how many times syncOnce retries connecting or
+// exporting a mailbox after the server throttled it.
+const maxThrottleRetries = 3
+
+func syncOnce(dial func() (*client.Client, error), dir string, mailboxes []string, opts *SyncOptions, summary *SyncSummary) error {
+	var timedOut atomic.Bool
+	var conn atomic.Pointer[client.Client]
+	if opts.Timeout > 0 {
+		timer := time.AfterFunc(opts.Timeout, func() {
+			timedOut.Store(true)
+			if c := conn.Load(); c != nil {
+				_ = c.Close()
+			}
+		})
+		defer timer.Stop()
+	}
+	// classify wraps an error in a SyncError, as a timeout if the pass
+	// ran out of time.
+	classify := func(mailbox string, err error, category ErrorCategory) error {
+		if timedOut.Load() {
+			return &SyncError{Category: CategoryTransient, Mailbox: mailbox, Err: fmt.Errorf("%w: %w", context.DeadlineExceeded, err)}
+		}
+		return &SyncError{Category: category, Mailbox: mailbox, Err: err}
+	}
+
+	// backoff waits before retrying an operation the server throttled,
+	// see client.RetryAfterError, doubling the delay it asked for with
+	// every retry. It reports false if err is not throttling, the
+	// operation was retried maxThrottleRetries times already or the wait
+	// would exceed the timeout; the delay is then recorded in the summary
+	// for the next pass.
+	deadline := time.Now().Add(opts.Timeout)
+	backoff := func(err error, retry int) bool {
+		after, ok := client.RetryAfter(err)
+		if !ok {
+			return false
+		}
+		wait := after << retry
+		summary.RetryAfter = wait
+		if retry >= maxThrottleRetries || timedOut.Load() || (opts.Timeout > 0 && time.Now().Add(wait).After(deadline)) {
+			return false
+		}
+		time.Sleep(wait)
+		summary.RetryAfter = 0
+		return !timedOut.Load()
+	}
+
+	var c *client.Client
+	for retry := 0; ; retry++ {
+		var err error
+		c, err = dial()
+		if err == nil {
+			break
+		}
+		if !backoff(err, retry) {
+			return classify("", err, dialCategory(err))
+		}
+	}
+	conn.Store(c)
+	defer func() {
+		_ = c.Logout()
+		_ = c.Close()
+	}()
+	if timedOut.Load() {
+		return classify("", errors.New("connection established too late"), CategoryTransient)
+	}
+
+	var mailboxErr error
+	for _, mailbox := range mailboxes {
+		mdir := dir
+		if len(mailboxes) > 1 {
+			mdir = filepath.Join(dir, folderName(mailbox))
+		}
+		ms := MailboxSummary{Mailbox: mailbox, Dir: mdir}
+		var err error
+		for retry := 0; ; retry++ {
+			var res *ExportResult
+			res, err = Export(c, mailbox, mdir, &opts.Export)
+			if res != nil {
+				ms.UIDValidity = res.UIDValidity
+				ms.Fetched += res.Exported
+				ms.Updated += res.Updated
+				ms.Deleted += res.Deleted
+				ms.Bytes += res.Bytes
+				summary.Fetched += res.Exported
+				summary.Updated += res.Updated
+				summary.Deleted += res.Deleted
+				summary.Bytes += res.Bytes
+			}
+			if err == nil || !backoff(err, retry) {
+				break
+			}
+		}
+		if err != nil {
+			ms.Error = err.Error()
+		}
+		summary.Mailboxes = append(summary.Mailboxes, ms)
+		if err == nil {
+			continue
+		}
+
+		category := exportCategory(err)
+		if category != CategoryMailbox || timedOut.Load() {
+			return classify(mailbox, err, category)
+		}
+		if mailboxErr == nil {
+			mailboxErr = classify(mailbox, err, category)
+		}
+	}
+	return mailboxErr
+}
+
+// dialCategory returns the category of an error connecting and logging
+// in: status responses are rejections of the credentials.
+func dialCategory(err error) ErrorCategory {
+	var imapErr *imap.IMAPError
+	if errors.As(err, &imapErr) && imapErr.StatusResponse != nil && !client.IsTransient(err) {
+		return CategoryAuth
+	}
+	if client.IsTransient(err) {
+		return CategoryTransient
+	}
+	return CategoryProtocol
+}
+
+// exportCategory returns the category of an error of Export.
+func exportCategory(err error) ErrorCategory {
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	switch {
+	case errors.As(err, &pathErr), errors.As(err, &linkErr):
+		return CategoryLocal
+	case client.IsTransient(err):
+		return CategoryTransient
+	}
+	var imapErr *imap.IMAPError
+	if errors.As(err, &imapErr) && imapErr.StatusResponse != nil && imapErr.Type == imap.StatusResponseTypeNO {
+		// The mailbox does not exist or cannot be accessed.
+		return CategoryMailbox
+	}
+	return CategoryProtocol
+}
+
+// folderName returns the directory name of a mailbox. The '/' hierarchy
+// separator is replaced, as are path separators.
+func folderName(mailbox string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == filepath.Separator || r == 0 {
+			return '.'
+		}
+		return r
+	}, mailbox)
+	if strings.HasPrefix(name, ".") {
+		name = "_" + name
+	}
+	return name
+}
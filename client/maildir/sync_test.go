@@ -0,0 +1,154 @@
+package maildir
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client"
+)
+
+func TestSyncOnce(t *testing.T) {
+	srv := &fakeServer{
+		greeting: "* OK ready",
+		missing:  "Gone",
+		msgs: []fakeMessage{
+			{uid: 3, flags: `\Seen`, date: " 2-Mar-2024 10:00:00 +0000", body: "Subject: one\r\n\r\nHello\r\n"},
+			{uid: 5, date: "15-Apr-2024 12:30:00 +0200", body: "Subject: two\r\n\r\n"},
+		},
+	}
+	dir := t.TempDir()
+	dial := func() (*client.Client, error) { return srv.dial(t), nil }
+
+	summary, err := SyncOnce(dial, dir, &SyncOptions{Mailboxes: []string{"INBOX", "Gone", "Lists/go"}})
+	if Categorize(err) != CategoryMailbox {
+		t.Fatalf("SyncOnce() error = %v, want a mailbox error", err)
+	}
+	var syncErr *SyncError
+	if !errors.As(err, &syncErr) || syncErr.Mailbox != "Gone" || syncErr.ExitCode() != 65 {
+		t.Errorf("SyncOnce() error = %#v", err)
+	}
+	if summary.Fetched != 4 || summary.Bytes != 2*int64(len(srv.msgs[0].body)+len(srv.msgs[1].body)) {
+		t.Errorf("summary = %+v", summary)
+	}
+	if summary.Category != "mailbox" || summary.Error == "" {
+		t.Errorf("summary category = %q, error = %q", summary.Category, summary.Error)
+	}
+	if len(summary.Mailboxes) != 3 {
+		t.Fatalf("mailboxes = %+v", summary.Mailboxes)
+	}
+	if ms := summary.Mailboxes[2]; ms.Dir != filepath.Join(dir, "Lists.go") || ms.Fetched != 2 || ms.UIDValidity != 7 {
+		t.Errorf("Lists/go summary = %+v", ms)
+	}
+	if ms := summary.Mailboxes[1]; ms.Error == "" || ms.Fetched != 0 {
+		t.Errorf("Gone summary = %+v", ms)
+	}
+	if n := len(listMaildir(t, filepath.Join(dir, "INBOX"))); n != 2 {
+		t.Errorf("INBOX has %d files, want 2", n)
+	}
+}
+
+func TestSyncOnce_Prune(t *testing.T) {
+	srv := &fakeServer{
+		greeting: "* OK ready",
+		msgs: []fakeMessage{
+			{uid: 3, date: " 2-Mar-2024 10:00:00 +0000", body: "Subject: one\r\n\r\n"},
+			{uid: 5, date: " 2-Mar-2024 10:00:00 +0000", body: "Subject: two\r\n\r\n"},
+		},
+	}
+	dir := t.TempDir()
+	dial := func() (*client.Client, error) { return srv.dial(t), nil }
+	if _, err := SyncOnce(dial, dir, nil); err != nil {
+		t.Fatalf("SyncOnce() error: %v", err)
+	}
+
+	srv.mu.Lock()
+	srv.msgs = srv.msgs[1:]
+	srv.mu.Unlock()
+	summary, err := SyncOnce(dial, dir, &SyncOptions{Export: ExportOptions{Prune: true}})
+	if err != nil {
+		t.Fatalf("SyncOnce() error: %v", err)
+	}
+	if summary.Fetched != 0 || summary.Deleted != 1 || summary.Category != "none" {
+		t.Errorf("summary = %+v", summary)
+	}
+	if got := listMaildir(t, dir); len(got) != 1 {
+		t.Errorf("files = %v", got)
+	}
+}
+
+func TestSyncOnce_DialErrors(t *testing.T) {
+	tests := []struct {
+		err      error
+		category ErrorCategory
+		exitCode int
+	}{
+		{&imap.IMAPError{StatusResponse: &imap.StatusResponse{
+			Type: imap.StatusResponseTypeNO, Code: imap.ResponseCodeAuthenticationFailed, Text: "invalid credentials",
+		}}, CategoryAuth, 77},
+		{&imap.IMAPError{StatusResponse: &imap.StatusResponse{
+			Type: imap.StatusResponseTypeNO, Code: imap.ResponseCodeUnavailable, Text: "try later",
+		}}, CategoryTransient, 75},
+		{fmt.Errorf("dial: %w", io.ErrUnexpectedEOF), CategoryTransient, 75},
+	}
+	for _, tt := range tests {
+		dial := func() (*client.Client, error) { return nil, tt.err }
+		summary, err := SyncOnce(dial, t.TempDir(), nil)
+		if Categorize(err) != tt.category || !errors.Is(err, tt.err) {
+			t.Errorf("SyncOnce() with %v: error = %v, category %v, want %v", tt.err, err, Categorize(err), tt.category)
+		}
+		if code := Categorize(err).ExitCode(); code != tt.exitCode {
+			t.Errorf("SyncOnce() with %v: exit code = %d, want %d", tt.err, code, tt.exitCode)
+		}
+		if summary.Category != tt.category.String() || len(summary.Mailboxes) != 0 {
+			t.Errorf("summary = %+v", summary)
+		}
+	}
+}
+
+func TestSyncOnce_Timeout(t *testing.T) {
+	srv := &fakeServer{greeting: "* OK ready", hang: "INBOX"}
+	dial := func() (*client.Client, error) { return srv.dial(t), nil }
+
+	start := time.Now()
+	_, err := SyncOnce(dial, t.TempDir(), &SyncOptions{Timeout: 50 * time.Millisecond})
+	if Categorize(err) != CategoryTransient || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SyncOnce() error = %v, want a timeout", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("SyncOnce() took %v", d)
+	}
+}
+
+func TestSyncOnce_Throttled(t *testing.T) {
+	srv := &fakeServer{greeting: "* OK ready"}
+	throttled := &client.RetryAfterError{After: 10 * time.Millisecond, Err: errors.New("too many connections")}
+	dials := 0
+	dial := func() (*client.Client, error) {
+		dials++
+		if dials == 1 {
+			return nil, throttled
+		}
+		return srv.dial(t), nil
+	}
+	summary, err := SyncOnce(dial, t.TempDir(), nil)
+	if err != nil || dials != 2 || summary.RetryAfter != 0 {
+		t.Errorf("SyncOnce() = %+v, %v after %d dials, want a retry", summary, err, dials)
+	}
+
+	// A pass that cannot wait for the server gives up and reports when
+	// to run the next one.
+	dial = func() (*client.Client, error) { return nil, throttled }
+	summary, err = SyncOnce(dial, t.TempDir(), &SyncOptions{Timeout: 15 * time.Millisecond})
+	if Categorize(err) != CategoryTransient || !errors.Is(err, throttled) {
+		t.Errorf("SyncOnce() error = %v, want the throttling error", err)
+	}
+	if summary.RetryAfter < 10*time.Millisecond {
+		t.Errorf("summary RetryAfter = %v", summary.RetryAfter)
+	}
+}
@@ -92,6 +92,37 @@ func (c *Client) UIDStore(uidSet string, action imap.StoreAction, flags []imap.F
 	return c.executeCheck("UID STORE", uidSet, item, flagList)
 }
 
+// UIDStoreUnchangedSince modifies the flags of the messages with the given
+// UIDs only if their mod-sequence is not greater than unchangedSince
+// (CONDSTORE, RFC 7162). It returns the UIDs of the messages that were
+// modified since, from the MODIFIED response code, and left unchanged; the
+// set is empty if the store was applied to all messages.
+func (c *Client) UIDStoreUnchangedSince(uidSet string, unchangedSince uint64, action imap.StoreAction, flags []imap.Flag) (*imap.UIDSet, error) {
+	flagStrs := make([]string, len(flags))
+	for i, f := range flags {
+		flagStrs[i] = string(f)
+	}
+	flagList := "(" + strings.Join(flagStrs, " ") + ")"
+	modifier := "(UNCHANGEDSINCE " + strconv.FormatUint(unchangedSince, 10) + ")"
+
+	result, err := c.execute("UID STORE", uidSet, modifier, action.String()+".SILENT", flagList)
+	if err != nil {
+		return nil, err
+	}
+	if err := commandResultError(result); err != nil {
+		return nil, err
+	}
+	modified := &imap.UIDSet{}
+	if code, arg, _ := strings.Cut(result.code, " "); strings.EqualFold(code, string(imap.ResponseCodeModified)) {
+		set, err := imap.ParseUIDSet(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MODIFIED response code: %w", err)
+		}
+		modified = set
+	}
+	return modified, nil
+}
+
 // Copy copies messages to another mailbox.
 func (c *Client) Copy(seqSet, dest string) (*imap.CopyData, error) {
 	result, err := c.execute("COPY", seqSet, quoteArg(dest))
@@ -155,6 +186,23 @@ func (c *Client) Move(seqSet, dest string) (*imap.CopyData, error) {
 	return data, nil
 }
 
+// UIDMove moves messages to another mailbox using UIDs (MOVE extension).
+func (c *Client) UIDMove(uidSet, dest string) (*imap.CopyData, error) {
+	result, err := c.execute("UID MOVE", uidSet, quoteArg(dest))
+	if err != nil {
+		return nil, err
+	}
+	if err := commandResultError(result); err != nil {
+		return nil, err
+	}
+
+	data := &imap.CopyData{}
+	if strings.HasPrefix(result.code, "COPYUID ") {
+		parseCopyUID(result.code[8:], data)
+	}
+	return data, nil
+}
+
 // Expunge permanently removes deleted messages.
 func (c *Client) Expunge() error {
 	return c.executeCheck("EXPUNGE")
@@ -166,32 +214,38 @@ func (c *Client) UIDExpunge(uidSet string) error {
 }
 
 // Search searches for messages matching criteria.
+//
+// If the criteria start with CHARSET UTF-8 and the server rejects it with
+// a BADCHARSET response code, the search is retried in a charset that the
+// server lists as supported and that can represent the criteria, or else
+// with the non-ASCII characters removed from the criteria. The latter
+// finds more messages than asked for, or fewer under NOT, and is logged
+// as a warning.
 func (c *Client) Search(criteria string) ([]uint32, error) {
-	c.collectUntagged()
-
-	result, err := c.execute("SEARCH", criteria)
-	if err != nil {
-		return nil, err
-	}
-	if result.status != "OK" {
-		return nil, &imap.IMAPError{StatusResponse: &imap.StatusResponse{
-			Type: imap.StatusResponseType(result.status),
-			Code: imap.ResponseCode(result.code),
-			Text: result.text,
-		}}
-	}
-
-	return parseSearchResults(c.collectUntagged()), nil
+	return c.search("SEARCH", criteria)
 }
 
-// UIDSearch searches using UIDs.
+// UIDSearch searches using UIDs. Criteria that the server rejects with
+// BADCHARSET are retried as described in Search.
 func (c *Client) UIDSearch(criteria string) ([]uint32, error) {
+	return c.search("UID SEARCH", criteria)
+}
+
+func (c *Client) search(name, criteria string) ([]uint32, error) {
 	c.collectUntagged()
 
-	result, err := c.execute("UID SEARCH", criteria)
+	result, err := c.execute(name, criteria)
 	if err != nil {
 		return nil, err
 	}
+	if result.status == "NO" {
+		if retry, ok := c.searchCharsetFallback(criteria, result.code); ok {
+			c.collectUntagged()
+			if result, err = c.execute(name, retry); err != nil {
+				return nil, err
+			}
+		}
+	}
 	if result.status != "OK" {
 		return nil, &imap.IMAPError{StatusResponse: &imap.StatusResponse{
 			Type: imap.StatusResponseType(result.status),
@@ -218,6 +272,9 @@ func parseCopyUID(s string, data *imap.CopyData) {
 	}
 }
 
+// parseSearchResults returns the numbers of SEARCH responses, or of the
+// ALL data of ESEARCH responses, which some servers send even when the
+// command has no RETURN options.
 func parseSearchResults(lines []string) []uint32 {
 	var results []uint32
 	for _, line := range lines {
@@ -228,11 +285,46 @@ func parseSearchResults(lines []string) []uint32 {
 					results = append(results, uint32(n))
 				}
 			}
+		} else if strings.HasPrefix(line, "ESEARCH ") {
+			results = append(results, parseESearchAll(line[8:])...)
 		}
 	}
 	return results
 }
 
+// parseESearchAll returns the numbers of the ALL data of an ESEARCH
+// response, e.g. `(TAG "A1") UID ALL 1:3,5`.
+func parseESearchAll(s string) []uint32 {
+	fields := strings.Fields(s)
+	for i := 0; i+1 < len(fields); i++ {
+		if !strings.EqualFold(fields[i], "ALL") {
+			continue
+		}
+		set, err := imap.ParseSeqSet(fields[i+1])
+		if err != nil {
+			return nil
+		}
+		var nums []uint32
+		for _, r := range set.Ranges() {
+			start, stop := r.Start, r.Stop
+			if start == 0 || stop == 0 {
+				return nil
+			}
+			if start > stop {
+				start, stop = stop, start
+			}
+			for n := start; ; n++ {
+				nums = append(nums, n)
+				if n == stop {
+					break
+				}
+			}
+		}
+		return nums
+	}
+	return nil
+}
+
 // Sort sorts messages (SORT extension).
 func (c *Client) Sort(criteria string) ([]uint32, error) {
 	c.collectUntagged()
@@ -249,18 +341,7 @@ func (c *Client) Sort(criteria string) ([]uint32, error) {
 		}}
 	}
 
-	var results []uint32
-	for _, line := range c.collectUntagged() {
-		if strings.HasPrefix(line, "SORT ") {
-			fields := strings.Fields(line[5:])
-			for _, f := range fields {
-				if n, err := strconv.ParseUint(f, 10, 32); err == nil {
-					results = append(results, uint32(n))
-				}
-			}
-		}
-	}
-	return results, nil
+	return parseSortResults(c.collectUntagged()), nil
 }
 
 // Thread retrieves threading information (THREAD extension).
@@ -315,7 +396,34 @@ func (c *Client) ID(clientID map[string]string) (map[string]string, error) {
 		}}
 	}
 
-	// Parse ID response from untagged data
-	_ = c.collectUntagged()
-	return nil, nil // Simplified - full parsing would be complex
+	for _, line := range c.collectUntagged() {
+		if strings.HasPrefix(strings.ToUpper(line), "ID ") {
+			return parseIDResponse(line[3:]), nil
+		}
+	}
+	return nil, nil
+}
+
+// parseIDResponse parses the field list of an ID response. It returns nil
+// for NIL.
+func parseIDResponse(s string) map[string]string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "(") {
+		return nil
+	}
+	list, _ := extractParenthesized(s)
+
+	id := make(map[string]string)
+	for list = strings.TrimLeft(list, " "); list != ""; list = strings.TrimLeft(list, " ") {
+		var key, value string
+		key, list = readQuotedOrAtom(list)
+		value, list = readQuotedOrAtom(strings.TrimLeft(list, " "))
+		if key == "" {
+			break
+		}
+		if !strings.EqualFold(value, "NIL") {
+			id[strings.ToLower(key)] = value
+		}
+	}
+	return id
 }
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// ErrMessageIDNotFound is returned by FetchByMessageID if no message in the
+// mailbox has the Message-ID.
+var ErrMessageIDNotFound = errors.New("no message with this Message-ID")
+
+// FetchByMessageIDOptions contains options for FetchByMessageID.
+type FetchByMessageIDOptions struct {
+	// ReadOnly opens the mailbox with EXAMINE instead of SELECT.
+	ReadOnly bool
+	// Headers are additional header fields to fetch, as FetchHeaders does.
+	Headers []string
+	// Body fetches the whole message with BODY.PEEK[], available in
+	// BodySection[""].
+	Body bool
+}
+
+// MessageIDResult is the result of FetchByMessageID.
+type MessageIDResult struct {
+	// MessageID is the Message-ID that was searched for.
+	MessageID string
+	// Messages are the matching messages, ordered by UID. They carry the
+	// UID, flags and size of the message and the requested header fields,
+	// Message-ID among them.
+	Messages []*imap.FetchMessageBuffer
+}
+
+// Unique reports whether exactly one message matched. A Message-ID is
+// supposed to be unique, but copies of a message, for example one filed
+// by the server and one saved by a client, share it.
+func (r *MessageIDResult) Unique() bool {
+	return len(r.Messages) == 1
+}
+
+// UIDs returns the UIDs of the matching messages.
+func (r *MessageIDResult) UIDs() []imap.UID {
+	uids := make([]imap.UID, len(r.Messages))
+	for i, msg := range r.Messages {
+		uids[i] = msg.UID
+	}
+	return uids
+}
+
+// FetchByMessageID finds the messages with the given Message-ID in a
+// mailbox and fetches them, combining UID SEARCH HEADER Message-ID with
+// UID FETCH. If mailbox is empty, the selected mailbox is searched;
+// otherwise the mailbox is selected first unless it already is.
+//
+// If the server supports SEARCHRES (RFC 5182), both commands are sent at
+// once, with the FETCH using the saved search result, so only a single
+// round trip is needed.
+//
+// SEARCH HEADER matches substrings, so the Message-ID header of the
+// results is compared with messageID and messages with a different one
+// are dropped; angle brackets are optional. If no message matches,
+// ErrMessageIDNotFound is returned.
+func (c *Client) FetchByMessageID(mailbox, messageID string, opts *FetchByMessageIDOptions) (*MessageIDResult, error) {
+	if opts == nil {
+		opts = &FetchByMessageIDOptions{}
+	}
+
+	if mailbox != "" && !c.isSelected(mailbox) {
+		if _, err := c.Select(mailbox, &imap.SelectOptions{ReadOnly: opts.ReadOnly}); err != nil {
+			return nil, err
+		}
+	}
+
+	id := strings.TrimSpace(messageID)
+	criteria := "HEADER Message-ID " + quoteArg(id)
+	items := messageIDFetchItems(opts)
+
+	var lines []string
+	if c.HasCap(string(imap.CapSearchRes)) {
+		var err error
+		if lines, err = c.searchResFetch(criteria, items); err != nil {
+			return nil, err
+		}
+	} else {
+		uids, err := c.UIDSearch(criteria)
+		if err != nil {
+			return nil, err
+		}
+		if len(uids) > 0 {
+			set := make([]string, len(uids))
+			for i, uid := range uids {
+				set[i] = strconv.FormatUint(uint64(uid), 10)
+			}
+			if lines, err = c.UIDFetch(strings.Join(set, ","), items); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	result := &MessageIDResult{MessageID: messageID}
+	want := normalizeMessageID(id)
+	for _, msg := range parseHeaderFetches(lines, nil) {
+		if msg.Header != nil && normalizeMessageID(msg.Header.Get("Message-Id")) != want {
+			continue
+		}
+		result.Messages = append(result.Messages, msg)
+	}
+	if len(result.Messages) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMessageIDNotFound, messageID)
+	}
+	sort.Slice(result.Messages, func(i, j int) bool {
+		return result.Messages[i].UID < result.Messages[j].UID
+	})
+	return result, nil
+}
+
+// searchResFetch pipelines UID SEARCH RETURN (SAVE) with UID FETCH $ and
+// returns the FETCH responses.
+func (c *Client) searchResFetch(criteria, items string) ([]string, error) {
+	c.collectUntagged()
+
+	searchTag := c.tags.Next()
+	search, err := c.send(searchTag, "UID SEARCH",
+		searchTag+" UID SEARCH RETURN (SAVE) "+criteria+"\r\n", false)
+	if err != nil {
+		return nil, err
+	}
+	fetchTag := c.tags.Next()
+	fetch, err := c.send(fetchTag, "UID FETCH", fetchTag+" UID FETCH $ "+items+"\r\n", false)
+	if err != nil {
+		<-search.done
+		return nil, err
+	}
+
+	searchResult, fetchResult := <-search.done, <-fetch.done
+	if err := commandResultError(searchResult); err != nil {
+		return nil, err
+	}
+	if err := commandResultError(fetchResult); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, line := range c.collectUntagged() {
+		if strings.HasPrefix(line, "FETCH ") {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// messageIDFetchItems returns the FETCH data items used by
+// FetchByMessageID.
+func messageIDFetchItems(opts *FetchByMessageIDOptions) string {
+	items := headerFetchItems(append([]string{"Message-Id"}, opts.Headers...))
+	if opts.Body {
+		items = strings.TrimSuffix(items, ")") + " BODY.PEEK[])"
+	}
+	return items
+}
+
+// isSelected reports whether mailbox is the selected mailbox.
+func (c *Client) isSelected(mailbox string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != imap.ConnStateSelected {
+		return false
+	}
+	if strings.EqualFold(mailbox, "INBOX") {
+		return strings.EqualFold(c.mailboxName, "INBOX")
+	}
+	return c.mailboxName == mailbox
+}
+
+// normalizeMessageID strips white space and angle brackets from a
+// Message-ID for comparison.
+func normalizeMessageID(id string) string {
+	id = strings.TrimSpace(id)
+	id = strings.TrimPrefix(id, "<")
+	return strings.TrimSuffix(id, ">")
+}
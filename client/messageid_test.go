@@ -0,0 +1,114 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFetchByMessageID(t *testing.T) {
+	var mu sync.Mutex
+	var cmds []string
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1] ready", func(w io.Writer, tag, cmd string) {
+		mu.Lock()
+		cmds = append(cmds, cmd)
+		mu.Unlock()
+		switch {
+		case strings.HasPrefix(cmd, "SELECT "):
+			fmt.Fprint(w, "* 3 EXISTS\r\n")
+		case strings.HasPrefix(cmd, "UID SEARCH "):
+			fmt.Fprint(w, "* SEARCH 9 4 7\r\n")
+		case strings.HasPrefix(cmd, "UID FETCH "):
+			header := "Message-Id: <abc@example.com>\r\n\r\n"
+			fmt.Fprintf(w, "* 3 FETCH (UID 9 FLAGS (\\Seen) RFC822.SIZE 10 BODY[HEADER.FIELDS (Message-Id)] {%d}\r\n%s)\r\n", len(header), header)
+			fmt.Fprintf(w, "* 1 FETCH (UID 4 FLAGS () RFC822.SIZE 20 BODY[HEADER.FIELDS (Message-Id)] {%d}\r\n%s)\r\n", len(header), header)
+			other := "Message-Id: <xabc@example.com>\r\n\r\n"
+			fmt.Fprintf(w, "* 2 FETCH (UID 7 FLAGS () RFC822.SIZE 30 BODY[HEADER.FIELDS (Message-Id)] {%d}\r\n%s)\r\n", len(other), other)
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+
+	result, err := c.FetchByMessageID("INBOX", "abc@example.com", nil)
+	if err != nil {
+		t.Fatalf("FetchByMessageID() error: %v", err)
+	}
+	if uids := result.UIDs(); len(uids) != 2 || uids[0] != 4 || uids[1] != 9 {
+		t.Errorf("UIDs() = %v, want [4 9]", uids)
+	}
+	if result.Unique() {
+		t.Error("Unique() = true for two matches")
+	}
+	if result.Messages[1].RFC822Size != 10 || len(result.Messages[1].Flags) != 1 {
+		t.Errorf("message = %+v", result.Messages[1])
+	}
+
+	want := []string{
+		"SELECT INBOX",
+		`UID SEARCH HEADER Message-ID abc@example.com`,
+		`UID FETCH 9,4,7 (UID FLAGS RFC822.SIZE BODY.PEEK[HEADER.FIELDS (Message-Id)])`,
+	}
+	if strings.Join(cmds, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands = %q, want %q", cmds, want)
+	}
+
+	// The mailbox is already selected.
+	cmds = nil
+	if _, err := c.FetchByMessageID("inbox", "<abc@example.com>", nil); err != nil {
+		t.Fatalf("FetchByMessageID() error: %v", err)
+	}
+	if len(cmds) != 2 {
+		t.Errorf("commands = %q, want no SELECT", cmds)
+	}
+}
+
+func TestFetchByMessageID_NotFound(t *testing.T) {
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		if strings.HasPrefix(cmd, "UID FETCH ") {
+			t.Errorf("unexpected %q", cmd)
+		}
+		fmt.Fprint(w, "* SEARCH\r\n")
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+
+	_, err := c.FetchByMessageID("", "missing@example.com", nil)
+	if !errors.Is(err, ErrMessageIDNotFound) {
+		t.Errorf("error = %v, want ErrMessageIDNotFound", err)
+	}
+}
+
+func TestFetchByMessageID_SearchRes(t *testing.T) {
+	var mu sync.Mutex
+	var cmds []string
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1 SEARCHRES] ready", func(w io.Writer, tag, cmd string) {
+		mu.Lock()
+		cmds = append(cmds, cmd)
+		mu.Unlock()
+		if strings.HasPrefix(cmd, "UID FETCH ") {
+			body := "Message-Id: <abc@example.com>\r\n\r\nhello\r\n"
+			fmt.Fprintf(w, "* 1 FETCH (UID 5 FLAGS () RFC822.SIZE %d BODY[HEADER.FIELDS (Message-Id Subject)] {31}\r\nMessage-Id: <abc@example.com>\r\n BODY[] {%d}\r\n%s)\r\n", len(body), len(body), body)
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+
+	result, err := c.FetchByMessageID("", "abc@example.com", &FetchByMessageIDOptions{Headers: []string{"subject"}, Body: true})
+	if err != nil {
+		t.Fatalf("FetchByMessageID() error: %v", err)
+	}
+	if !result.Unique() || result.Messages[0].UID != 5 {
+		t.Fatalf("result = %+v", result.Messages)
+	}
+	if !strings.HasSuffix(string(result.Messages[0].BodySection[""]), "hello\r\n") {
+		t.Errorf("body = %q", result.Messages[0].BodySection[""])
+	}
+
+	want := []string{
+		`UID SEARCH RETURN (SAVE) HEADER Message-ID abc@example.com`,
+		`UID FETCH $ (UID FLAGS RFC822.SIZE BODY.PEEK[HEADER.FIELDS (Message-Id Subject)] BODY.PEEK[])`,
+	}
+	if strings.Join(cmds, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands = %q, want %q", cmds, want)
+	}
+}
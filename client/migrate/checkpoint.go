@@ -0,0 +1,132 @@
+package migrate
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// Checkpoint records how far the messages of a mailbox have been copied.
+type Checkpoint struct {
+	// UIDValidity is the UIDVALIDITY of the source mailbox. A checkpoint
+	// with another UIDVALIDITY is ignored, since the UIDs have changed
+	// meaning.
+	UIDValidity uint32 `json:"uidValidity"`
+	// LastUID is the highest UID copied from the source mailbox.
+	LastUID imap.UID `json:"lastUID"`
+
+	// The fields below are only recorded when the source supports
+	// OBJECTID (RFC 8474).
+
+	// Mailbox is the destination mailbox the messages were copied to, so
+	// that it can be renamed when the source mailbox is.
+	Mailbox string `json:"mailbox,omitempty"`
+	// EmailIDs are the EMAILIDs of the messages copied. They identify the
+	// messages even after their UIDs change.
+	EmailIDs []string `json:"emailIDs,omitempty"`
+}
+
+// CheckpointStore stores the checkpoints of a migration, by source mailbox
+// name, or by MAILBOXID when the source supports OBJECTID (RFC 8474); see
+// MailboxIDKey.
+type CheckpointStore interface {
+	// Load returns the checkpoint of a mailbox, and false if there is none.
+	Load(mailbox string) (Checkpoint, bool, error)
+	// Save records the checkpoint of a mailbox.
+	Save(mailbox string, cp Checkpoint) error
+}
+
+// MailboxIDKey returns the key of the checkpoint of the source mailbox with
+// the given MAILBOXID, such as "MAILBOXID (F2212ea87)". Keying checkpoints
+// by mailbox ID rather than name lets them follow renames.
+func MailboxIDKey(id string) string {
+	return "MAILBOXID (" + id + ")"
+}
+
+// MemoryCheckpointStore is a CheckpointStore that keeps checkpoints in
+// memory, to resume a migration within the same process, for example
+// after reconnecting. It is safe for concurrent use.
+type MemoryCheckpointStore struct {
+	mu          sync.Mutex
+	checkpoints map[string]Checkpoint
+}
+
+// NewMemoryCheckpointStore returns an empty MemoryCheckpointStore.
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{checkpoints: make(map[string]Checkpoint)}
+}
+
+// Load implements CheckpointStore.
+func (s *MemoryCheckpointStore) Load(mailbox string) (Checkpoint, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp, ok := s.checkpoints[mailbox]
+	return cp, ok, nil
+}
+
+// Save implements CheckpointStore.
+func (s *MemoryCheckpointStore) Save(mailbox string, cp Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoints[mailbox] = cp
+	return nil
+}
+
+// FileCheckpointStore is a CheckpointStore that keeps checkpoints in a JSON
+// file, to resume a migration in a later run. The file is rewritten
+// atomically on each Save. It is safe for concurrent use.
+type FileCheckpointStore struct {
+	path string
+	mem  *MemoryCheckpointStore
+}
+
+// NewFileCheckpointStore returns a FileCheckpointStore backed by the file
+// at path, loading the checkpoints it contains. The file need not exist.
+func NewFileCheckpointStore(path string) (*FileCheckpointStore, error) {
+	s := &FileCheckpointStore{path: path, mem: NewMemoryCheckpointStore()}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.mem.checkpoints); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Load implements CheckpointStore.
+func (s *FileCheckpointStore) Load(mailbox string) (Checkpoint, bool, error) {
+	return s.mem.Load(mailbox)
+}
+
+// Save implements CheckpointStore.
+func (s *FileCheckpointStore) Save(mailbox string, cp Checkpoint) error {
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	s.mem.checkpoints[mailbox] = cp
+
+	data, err := json.MarshalIndent(s.mem.checkpoints, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
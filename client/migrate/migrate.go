@@ -0,0 +1,584 @@
+// Package migrate copies an IMAP account from one server to another, the
+// way imapsync does: the mailbox tree, the messages with their flags and
+// internal dates, and the subscriptions.
+//
+// A migration can be interrupted and run again. With a CheckpointStore, the
+// highest UID copied from each mailbox is recorded, and messages up to it
+// are not copied again as long as the UIDVALIDITY of the mailbox does not
+// change.
+//
+// If the source supports OBJECTID (RFC 8474), checkpoints are keyed by
+// MAILBOXID rather than mailbox name and record the EMAILIDs of the copied
+// messages. A mailbox renamed on the source is then renamed on the
+// destination, and messages are recognized by EMAILID after a change of
+// UIDVALIDITY, so neither causes messages to be copied again.
+package migrate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client"
+)
+
+// DefaultBatchSize is the number of messages fetched and appended per
+// command if the options do not set one.
+const DefaultBatchSize = 50
+
+// Options contains options for Migrate.
+type Options struct {
+	// BatchSize is the number of messages fetched per UID FETCH command,
+	// and appended per APPEND command if the destination supports
+	// MULTIAPPEND. If zero, DefaultBatchSize is used.
+	BatchSize int
+
+	// Checkpoints records the messages already copied, to resume an
+	// interrupted migration. If nil, all messages are copied.
+	Checkpoints CheckpointStore
+
+	// Progress, if set, is called when copying of a mailbox starts, after
+	// each batch of messages and when all messages are copied.
+	Progress func(Progress)
+}
+
+// Progress reports the progress of a migration.
+type Progress struct {
+	// Mailbox is the source mailbox being copied.
+	Mailbox string
+	// MailboxesDone and MailboxesTotal count the mailboxes whose messages
+	// are copied.
+	MailboxesDone, MailboxesTotal int
+	// MessagesDone and MessagesTotal count the messages to copy, without
+	// those skipped thanks to a checkpoint.
+	MessagesDone, MessagesTotal int
+	// Elapsed is the time since the migration started.
+	Elapsed time.Duration
+	// ETA estimates the time until all messages are copied, from the rate
+	// so far. It is zero until a message has been copied.
+	ETA time.Duration
+}
+
+// Result reports the changes made by Migrate.
+type Result struct {
+	// Created lists the destination mailboxes that were created.
+	Created []string
+	// Subscribed lists the destination mailboxes that were subscribed.
+	Subscribed []string
+	// Renamed maps the old names of the destination mailboxes that were
+	// renamed, following a rename on the source, to their new names.
+	Renamed map[string]string
+	// Copied is the number of messages copied.
+	Copied int
+	// Skipped is the number of messages not copied because a checkpoint
+	// shows they were copied by an earlier run.
+	Skipped int
+}
+
+// mailboxPlan is the work to do for a source mailbox.
+type mailboxPlan struct {
+	name        string
+	dest        string
+	key         string // checkpoint key
+	uidValidity uint32
+	uids        []uint32 // UIDs to copy, in ascending order
+	emailIDs    []string // EMAILIDs of the messages copied, with OBJECTID
+}
+
+// migration is the state of a running Migrate call.
+type migration struct {
+	src, dst    *client.Client
+	opts        Options
+	result      *Result
+	start       time.Time
+	multiAppend bool
+	objectID    bool
+	progress    Progress
+}
+
+// Migrate copies the account src is logged in to into the account of dst.
+//
+// Mailboxes missing on the destination are created, parents first, with
+// the hierarchy delimiter of the destination. \Noselect mailboxes are only
+// created as parents of other mailboxes. The messages of each selectable
+// mailbox are then appended to the destination mailbox with their flags,
+// except \Recent, and their internal date, in batches with MULTIAPPEND
+// (RFC 3502) when the destination supports it and one at a time
+// otherwise. The source mailboxes are opened with EXAMINE, so their \Seen
+// flags are not changed. Finally, the destination subscribes to the
+// mailboxes the source is subscribed to.
+//
+// Messages are appended, never compared with the destination's, so without
+// a checkpoint store a second run copies them again.
+//
+// Changes made before an error is encountered are reported in the result.
+func Migrate(src, dst *client.Client, opts *Options) (*Result, error) {
+	m := &migration{
+		src:         src,
+		dst:         dst,
+		result:      &Result{},
+		start:       time.Now(),
+		multiAppend: dst.HasCap(string(imap.CapMultiAppend)),
+		objectID:    src.HasCap(string(imap.CapObjectID)),
+	}
+	if opts != nil {
+		m.opts = *opts
+	}
+	if m.opts.BatchSize <= 0 {
+		m.opts.BatchSize = DefaultBatchSize
+	}
+
+	mailboxes, err := src.ListMailboxes("", "*")
+	if err != nil {
+		return m.result, err
+	}
+	destName, err := m.nameMapper(mailboxes)
+	if err != nil {
+		return m.result, err
+	}
+	if err := m.followRenames(mailboxes, destName); err != nil {
+		return m.result, err
+	}
+	if err := m.createTree(mailboxes, destName); err != nil {
+		return m.result, err
+	}
+
+	plans, err := m.plan(mailboxes, destName)
+	if err != nil {
+		return m.result, err
+	}
+	m.progress.MailboxesTotal = len(plans)
+	for _, p := range plans {
+		m.progress.MessagesTotal += len(p.uids)
+	}
+	for _, p := range plans {
+		if err := m.copyMailbox(p); err != nil {
+			return m.result, err
+		}
+		m.progress.MailboxesDone++
+	}
+	m.report()
+
+	return m.result, m.subscribe(destName)
+}
+
+// nameMapper returns a function that converts a source mailbox name to
+// the destination's hierarchy delimiter.
+func (m *migration) nameMapper(mailboxes []*imap.ListData) (func(string) string, error) {
+	var srcDelim rune
+	for _, data := range mailboxes {
+		if data.Delim != 0 {
+			srcDelim = data.Delim
+			break
+		}
+	}
+	root, err := m.dst.ListMailboxes("", "")
+	if err != nil {
+		return nil, err
+	}
+	var dstDelim rune
+	if len(root) > 0 {
+		dstDelim = root[0].Delim
+	}
+
+	if srcDelim == 0 || dstDelim == 0 || srcDelim == dstDelim {
+		return func(name string) string { return name }, nil
+	}
+	return func(name string) string {
+		return strings.ReplaceAll(name, string(srcDelim), string(dstDelim))
+	}, nil
+}
+
+// followRenames renames the destination mailboxes whose source mailbox,
+// found by MAILBOXID, has been renamed since its checkpoint was recorded.
+// Parents are renamed first, so that their children follow them.
+func (m *migration) followRenames(mailboxes []*imap.ListData, destName func(string) string) error {
+	if !m.objectID || m.opts.Checkpoints == nil {
+		return nil
+	}
+	for _, data := range sortedMailboxes(mailboxes) {
+		if !selectable(data) {
+			continue
+		}
+		status, err := m.src.Status(data.Mailbox, &imap.StatusOptions{MailboxID: true})
+		if err != nil {
+			return err
+		}
+		if status.MailboxID == "" {
+			continue
+		}
+		cp, ok, err := m.opts.Checkpoints.Load(MailboxIDKey(status.MailboxID))
+		if err != nil {
+			return err
+		}
+		dest := destName(data.Mailbox)
+		if !ok || cp.Mailbox == "" || mailboxKey(cp.Mailbox) == "INBOX" || mailboxKey(cp.Mailbox) == mailboxKey(dest) {
+			continue
+		}
+		exists, err := m.destMailboxes()
+		if err != nil {
+			return err
+		}
+		if !exists[mailboxKey(cp.Mailbox)] || exists[mailboxKey(dest)] {
+			continue
+		}
+		if err := m.dst.Rename(cp.Mailbox, dest); err != nil {
+			return fmt.Errorf("migrate: rename %q to %q: %w", cp.Mailbox, dest, err)
+		}
+		if m.result.Renamed == nil {
+			m.result.Renamed = make(map[string]string)
+		}
+		m.result.Renamed[cp.Mailbox] = dest
+	}
+	return nil
+}
+
+// createTree creates the mailboxes missing on the destination, parents
+// first.
+func (m *migration) createTree(mailboxes []*imap.ListData, destName func(string) string) error {
+	exists, err := m.destMailboxes()
+	if err != nil {
+		return err
+	}
+	for _, data := range sortedMailboxes(mailboxes) {
+		dest := destName(data.Mailbox)
+		if !selectable(data) || exists[mailboxKey(dest)] {
+			continue
+		}
+		if err := m.dst.Create(dest); err != nil {
+			return fmt.Errorf("migrate: create %q: %w", dest, err)
+		}
+		exists[mailboxKey(dest)] = true
+		m.result.Created = append(m.result.Created, dest)
+	}
+	return nil
+}
+
+// plan lists the messages to copy from each selectable mailbox.
+func (m *migration) plan(mailboxes []*imap.ListData, destName func(string) string) ([]*mailboxPlan, error) {
+	var plans []*mailboxPlan
+	for _, data := range mailboxes {
+		if !selectable(data) {
+			continue
+		}
+		sel, err := m.src.Examine(data.Mailbox)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: examine %q: %w", data.Mailbox, err)
+		}
+
+		p := &mailboxPlan{
+			name:        data.Mailbox,
+			dest:        destName(data.Mailbox),
+			key:         data.Mailbox,
+			uidValidity: sel.UIDValidity,
+		}
+		if m.objectID && sel.MailboxID != "" {
+			p.key = MailboxIDKey(sel.MailboxID)
+		}
+		cp, ok, err := m.loadCheckpoint(p.key)
+		if err == nil && !ok && p.key != p.name {
+			// The checkpoint may predate OBJECTID support.
+			cp, ok, err = m.loadCheckpoint(p.name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			cp = Checkpoint{}
+		} else if cp.UIDValidity != p.uidValidity {
+			cp.LastUID = 0
+		}
+
+		if m.objectID {
+			err = m.planByEmailID(p, cp, sel.NumMessages)
+		} else {
+			err = m.planByUID(p, cp)
+		}
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, p)
+	}
+	return plans, nil
+}
+
+// planByUID plans to copy the messages of the selected mailbox after the
+// last UID of the checkpoint.
+func (m *migration) planByUID(p *mailboxPlan, cp Checkpoint) error {
+	uids, err := m.src.UIDSearch("ALL")
+	if err != nil {
+		return err
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	i := sort.Search(len(uids), func(i int) bool { return imap.UID(uids[i]) > cp.LastUID })
+	p.uids = uids[i:]
+	m.result.Skipped += i
+	return nil
+}
+
+// planByEmailID plans to copy the messages of the selected mailbox that
+// are neither before the last UID of the checkpoint nor have an EMAILID
+// it records. The checkpoint is updated when there is nothing to copy, so
+// that it follows renames and changes of UIDVALIDITY.
+func (m *migration) planByEmailID(p *mailboxPlan, cp Checkpoint, numMessages uint32) error {
+	var msgs []*imap.FetchMessageBuffer
+	if numMessages > 0 {
+		var err error
+		if msgs, err = m.src.UIDFetchMessages("1:*", "(UID EMAILID)"); err != nil {
+			return err
+		}
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].UID < msgs[j].UID })
+
+	copied := make(map[string]bool, len(cp.EmailIDs))
+	for _, id := range cp.EmailIDs {
+		copied[id] = true
+	}
+	// Only the EMAILIDs of messages that still exist are kept.
+	for _, msg := range msgs {
+		if msg.UID <= cp.LastUID || msg.EmailID != "" && copied[msg.EmailID] {
+			if msg.EmailID != "" {
+				p.emailIDs = append(p.emailIDs, msg.EmailID)
+			}
+			m.result.Skipped++
+			continue
+		}
+		p.uids = append(p.uids, uint32(msg.UID))
+	}
+
+	if len(p.uids) == 0 && len(msgs) > 0 {
+		last := max(cp.LastUID, msgs[len(msgs)-1].UID)
+		return m.saveCheckpoint(p.key, m.checkpoint(p, last))
+	}
+	return nil
+}
+
+// copyMailbox copies the planned messages of a mailbox in batches.
+func (m *migration) copyMailbox(p *mailboxPlan) error {
+	m.progress.Mailbox = p.name
+	m.report()
+	if len(p.uids) == 0 {
+		return nil
+	}
+
+	sel, err := m.src.Examine(p.name)
+	if err != nil {
+		return fmt.Errorf("migrate: examine %q: %w", p.name, err)
+	}
+	if sel.UIDValidity != p.uidValidity {
+		return fmt.Errorf("migrate: UIDVALIDITY of %q changed during the migration", p.name)
+	}
+
+	for uids := p.uids; len(uids) > 0; {
+		n := min(m.opts.BatchSize, len(uids))
+		batch := uids[:n]
+		uids = uids[n:]
+
+		set := &imap.UIDSet{}
+		for _, uid := range batch {
+			set.AddNum(imap.UID(uid))
+		}
+		items := "(UID FLAGS INTERNALDATE BODY.PEEK[])"
+		if m.objectID {
+			items = "(UID FLAGS INTERNALDATE EMAILID BODY.PEEK[])"
+		}
+		msgs, err := m.src.UIDFetchMessages(set.String(), items)
+		if err != nil {
+			return err
+		}
+		sort.Slice(msgs, func(i, j int) bool { return msgs[i].UID < msgs[j].UID })
+
+		// Messages expunged since the search are not returned, so the
+		// checkpoint moves to the end of the batch.
+		last := imap.UID(batch[len(batch)-1])
+		if err := m.append(p, msgs); err != nil {
+			return err
+		}
+		if err := m.saveCheckpoint(p.key, m.checkpoint(p, last)); err != nil {
+			return err
+		}
+		m.progress.MessagesDone += len(batch)
+		m.report()
+	}
+	return nil
+}
+
+// append appends fetched messages to the destination mailbox of p. When
+// they are appended one at a time and one fails, the checkpoint is moved
+// past those already appended, so that they are not copied twice.
+func (m *migration) append(p *mailboxPlan, msgs []*imap.FetchMessageBuffer) error {
+	var batch []client.AppendMessage
+	var uids []imap.UID
+	var emailIDs []string
+	for _, msg := range msgs {
+		body, ok := msg.BodySection[""]
+		if !ok {
+			continue
+		}
+		batch = append(batch, client.AppendMessage{
+			Flags:        appendFlags(msg.Flags),
+			InternalDate: msg.InternalDate,
+			Literal:      body,
+		})
+		uids = append(uids, msg.UID)
+		emailIDs = append(emailIDs, msg.EmailID)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if m.multiAppend {
+		if _, err := m.dst.MultiAppend(p.dest, batch); err != nil {
+			return fmt.Errorf("migrate: append to %q: %w", p.dest, err)
+		}
+		m.result.Copied += len(batch)
+		p.addEmailIDs(emailIDs...)
+		return nil
+	}
+	for i := range batch {
+		if _, err := m.dst.MultiAppend(p.dest, batch[i:i+1]); err != nil {
+			if i > 0 {
+				_ = m.saveCheckpoint(p.key, m.checkpoint(p, uids[i-1]))
+			}
+			return fmt.Errorf("migrate: append to %q: %w", p.dest, err)
+		}
+		m.result.Copied++
+		p.addEmailIDs(emailIDs[i])
+	}
+	return nil
+}
+
+// addEmailIDs records the EMAILIDs of copied messages. Messages without
+// one are not recorded.
+func (p *mailboxPlan) addEmailIDs(ids ...string) {
+	for _, id := range ids {
+		if id != "" {
+			p.emailIDs = append(p.emailIDs, id)
+		}
+	}
+}
+
+// checkpoint returns the checkpoint of p after the messages up to last
+// were copied.
+func (m *migration) checkpoint(p *mailboxPlan, last imap.UID) Checkpoint {
+	cp := Checkpoint{UIDValidity: p.uidValidity, LastUID: last}
+	if m.objectID {
+		cp.Mailbox = p.dest
+		cp.EmailIDs = p.emailIDs
+	}
+	return cp
+}
+
+// subscribe subscribes the destination to the mailboxes the source is
+// subscribed to.
+func (m *migration) subscribe(destName func(string) string) error {
+	subscribed, err := m.src.ListSubscribed("", "*")
+	if err != nil {
+		return err
+	}
+	current, err := m.dst.ListSubscribed("", "*")
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool)
+	for _, data := range current {
+		have[mailboxKey(data.Mailbox)] = true
+	}
+	for _, data := range subscribed {
+		dest := destName(data.Mailbox)
+		if have[mailboxKey(dest)] {
+			continue
+		}
+		if err := m.dst.Subscribe(dest); err != nil {
+			return fmt.Errorf("migrate: subscribe %q: %w", dest, err)
+		}
+		have[mailboxKey(dest)] = true
+		m.result.Subscribed = append(m.result.Subscribed, dest)
+	}
+	return nil
+}
+
+// report calls the Progress callback.
+func (m *migration) report() {
+	if m.opts.Progress == nil {
+		return
+	}
+	p := m.progress
+	p.Elapsed = time.Since(m.start)
+	if p.MessagesDone > 0 {
+		perMessage := p.Elapsed / time.Duration(p.MessagesDone)
+		p.ETA = perMessage * time.Duration(p.MessagesTotal-p.MessagesDone)
+	}
+	m.opts.Progress(p)
+}
+
+func (m *migration) loadCheckpoint(key string) (Checkpoint, bool, error) {
+	if m.opts.Checkpoints == nil {
+		return Checkpoint{}, false, nil
+	}
+	return m.opts.Checkpoints.Load(key)
+}
+
+func (m *migration) saveCheckpoint(key string, cp Checkpoint) error {
+	if m.opts.Checkpoints == nil {
+		return nil
+	}
+	return m.opts.Checkpoints.Save(key, cp)
+}
+
+// destMailboxes returns the keys of the mailboxes of the destination.
+func (m *migration) destMailboxes() (map[string]bool, error) {
+	existing, err := m.dst.ListMailboxes("", "*")
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, data := range existing {
+		exists[mailboxKey(data.Mailbox)] = true
+	}
+	return exists, nil
+}
+
+// sortedMailboxes returns the mailboxes sorted by name, so that parents
+// come before their children.
+func sortedMailboxes(mailboxes []*imap.ListData) []*imap.ListData {
+	sorted := append([]*imap.ListData(nil), mailboxes...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Mailbox < sorted[j].Mailbox
+	})
+	return sorted
+}
+
+// appendFlags returns the flags of a fetched message that can be set by
+// APPEND: \Recent cannot.
+func appendFlags(flags []imap.Flag) []imap.Flag {
+	var out []imap.Flag
+	for _, f := range flags {
+		if !strings.EqualFold(string(f), string(imap.FlagRecent)) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// selectable reports whether a mailbox can hold messages.
+func selectable(data *imap.ListData) bool {
+	for _, attr := range data.Attrs {
+		if strings.EqualFold(string(attr), string(imap.MailboxAttrNoSelect)) ||
+			strings.EqualFold(string(attr), string(imap.MailboxAttrNonExistent)) {
+			return false
+		}
+	}
+	return true
+}
+
+// mailboxKey returns a key identifying a mailbox name: INBOX is
+// case-insensitive.
+func mailboxKey(name string) string {
+	if strings.EqualFold(name, "INBOX") {
+		return "INBOX"
+	}
+	return name
+}
@@ -0,0 +1,208 @@
+package migrate
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client"
+	"github.com/meszmate/imap-go/imaptest"
+	"github.com/meszmate/imap-go/server"
+	_ "github.com/meszmate/imap-go/server/commands"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+// dialAccount starts a memserver with an account and returns a client
+// logged in to it.
+func dialAccount(t *testing.T) *client.Client {
+	t.Helper()
+	c, _ := dialMem(t)
+	return c
+}
+
+// dialMem is like dialAccount, but also returns the memserver. The server
+// is started with opts.
+func dialMem(t *testing.T, opts ...server.Option) (*client.Client, *memserver.MemServer) {
+	t.Helper()
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	h := imaptest.NewHarness(t, mem.NewServer(opts...))
+	c := h.Dial()
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	return c, mem
+}
+
+func mustAppend(t *testing.T, c *client.Client, mailbox string, msg client.AppendMessage) {
+	t.Helper()
+	if _, err := c.MultiAppend(mailbox, []client.AppendMessage{msg}); err != nil {
+		t.Fatalf("MultiAppend(%q) error: %v", mailbox, err)
+	}
+}
+
+func fetchAll(t *testing.T, c *client.Client, mailbox string) []*imap.FetchMessageBuffer {
+	t.Helper()
+	if _, err := c.Examine(mailbox); err != nil {
+		t.Fatalf("Examine(%q) error: %v", mailbox, err)
+	}
+	msgs, err := c.UIDFetchMessages("1:*", "(UID FLAGS INTERNALDATE BODY.PEEK[])")
+	if err != nil {
+		t.Fatalf("UIDFetchMessages() error: %v", err)
+	}
+	return msgs
+}
+
+func TestMigrate(t *testing.T) {
+	src := dialAccount(t)
+	dst := dialAccount(t)
+
+	date := time.Date(2024, 3, 5, 10, 30, 0, 0, time.UTC)
+	mustAppend(t, src, "INBOX", client.AppendMessage{
+		Flags:        []imap.Flag{imap.FlagSeen},
+		InternalDate: date,
+		Literal:      []byte("Subject: one\r\n\r\nfirst"),
+	})
+	mustAppend(t, src, "INBOX", client.AppendMessage{Literal: []byte("Subject: two\r\n\r\nsecond")})
+	if err := src.Create("Archive/2024"); err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	mustAppend(t, src, "Archive/2024", client.AppendMessage{
+		Flags:   []imap.Flag{imap.FlagFlagged},
+		Literal: []byte("Subject: old\r\n\r\narchived"),
+	})
+	if err := src.Subscribe("Archive/2024"); err != nil {
+		t.Fatalf("Subscribe() error: %v", err)
+	}
+
+	store, err := NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if err != nil {
+		t.Fatalf("NewFileCheckpointStore() error: %v", err)
+	}
+	var last Progress
+	opts := &Options{
+		BatchSize:   1,
+		Checkpoints: store,
+		Progress:    func(p Progress) { last = p },
+	}
+	result, err := Migrate(src, dst, opts)
+	if err != nil {
+		t.Fatalf("Migrate() error: %v", err)
+	}
+	if result.Copied != 3 || result.Skipped != 0 {
+		t.Errorf("Copied, Skipped = %d, %d, want 3, 0", result.Copied, result.Skipped)
+	}
+	if len(result.Subscribed) != 1 || result.Subscribed[0] != "Archive/2024" {
+		t.Errorf("Subscribed = %v, want [Archive/2024]", result.Subscribed)
+	}
+	if last.MessagesDone != 3 || last.MessagesTotal != 3 || last.MailboxesDone != 2 || last.MailboxesTotal != 2 {
+		t.Errorf("last progress = %+v", last)
+	}
+
+	inbox := fetchAll(t, dst, "INBOX")
+	if len(inbox) != 2 {
+		t.Fatalf("destination INBOX has %d messages, want 2", len(inbox))
+	}
+	if got := string(inbox[0].BodySection[""]); got != "Subject: one\r\n\r\nfirst" {
+		t.Errorf("first message = %q", got)
+	}
+	if !inbox[0].InternalDate.Equal(date) {
+		t.Errorf("InternalDate = %v, want %v", inbox[0].InternalDate, date)
+	}
+	if len(inbox[0].Flags) != 1 || inbox[0].Flags[0] != imap.FlagSeen {
+		t.Errorf("Flags = %v, want [\\Seen]", inbox[0].Flags)
+	}
+	archive := fetchAll(t, dst, "Archive/2024")
+	if len(archive) != 1 || len(archive[0].Flags) != 1 || archive[0].Flags[0] != imap.FlagFlagged {
+		t.Errorf("destination Archive/2024 = %+v", archive)
+	}
+
+	// A second run only copies new messages.
+	mustAppend(t, src, "INBOX", client.AppendMessage{Literal: []byte("Subject: three\r\n\r\nthird")})
+	store, err = NewFileCheckpointStore(store.path)
+	if err != nil {
+		t.Fatalf("NewFileCheckpointStore() error: %v", err)
+	}
+	opts.Checkpoints = store
+	result, err = Migrate(src, dst, opts)
+	if err != nil {
+		t.Fatalf("Migrate() error: %v", err)
+	}
+	if result.Copied != 1 || result.Skipped != 3 || len(result.Created) != 0 || len(result.Subscribed) != 0 {
+		t.Errorf("second run = %+v, want 1 copied and 3 skipped", result)
+	}
+	if n := len(fetchAll(t, dst, "INBOX")); n != 3 {
+		t.Errorf("destination INBOX has %d messages, want 3", n)
+	}
+}
+
+func TestMigrate_ObjectID(t *testing.T) {
+	src, mem := dialMem(t, server.WithCapabilities(imap.CapObjectID))
+	dst := dialAccount(t)
+
+	if err := src.Create("Work"); err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	mustAppend(t, src, "Work", client.AppendMessage{Literal: []byte("Subject: w1\r\n\r\nfirst")})
+	mustAppend(t, src, "Work", client.AppendMessage{Literal: []byte("Subject: w2\r\n\r\nsecond")})
+	mustAppend(t, src, "INBOX", client.AppendMessage{Literal: []byte("Subject: i1\r\n\r\ninbox")})
+
+	opts := &Options{Checkpoints: NewMemoryCheckpointStore()}
+	result, err := Migrate(src, dst, opts)
+	if err != nil {
+		t.Fatalf("Migrate() error: %v", err)
+	}
+	if result.Copied != 3 {
+		t.Fatalf("Copied = %d, want 3", result.Copied)
+	}
+
+	// Rename Work on the source, and give INBOX a new UIDVALIDITY as a
+	// server rebuilding its index would.
+	if err := src.Rename("Work", "Projects"); err != nil {
+		t.Fatalf("Rename() error: %v", err)
+	}
+	mustAppend(t, src, "Projects", client.AppendMessage{Literal: []byte("Subject: w3\r\n\r\nthird")})
+	mem.GetUserData("alice").GetMailbox("INBOX").UIDValidity = 100
+
+	result, err = Migrate(src, dst, opts)
+	if err != nil {
+		t.Fatalf("second Migrate() error: %v", err)
+	}
+	if result.Copied != 1 || result.Skipped != 3 || len(result.Created) != 0 {
+		t.Errorf("second run = %+v, want 1 copied and 3 skipped", result)
+	}
+	if want := map[string]string{"Work": "Projects"}; !reflect.DeepEqual(result.Renamed, want) {
+		t.Errorf("Renamed = %v, want %v", result.Renamed, want)
+	}
+	if n := len(fetchAll(t, dst, "Projects")); n != 3 {
+		t.Errorf("destination Projects has %d messages, want 3", n)
+	}
+	if n := len(fetchAll(t, dst, "INBOX")); n != 1 {
+		t.Errorf("destination INBOX has %d messages, want 1", n)
+	}
+	if mailboxes, _ := dst.ListMailboxes("", "Work"); len(mailboxes) != 0 {
+		t.Errorf("destination still has Work")
+	}
+
+	// A third run has nothing to do.
+	result, err = Migrate(src, dst, opts)
+	if err != nil || result.Copied != 0 || result.Skipped != 4 || len(result.Renamed) != 0 {
+		t.Errorf("third run = %+v, %v", result, err)
+	}
+}
+
+func TestMemoryCheckpointStore(t *testing.T) {
+	s := NewMemoryCheckpointStore()
+	if _, ok, _ := s.Load("INBOX"); ok {
+		t.Fatal("Load() found a checkpoint in an empty store")
+	}
+	want := Checkpoint{UIDValidity: 7, LastUID: 42, Mailbox: "INBOX", EmailIDs: []string{"M1"}}
+	if err := s.Save("INBOX", want); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	if got, ok, _ := s.Load("INBOX"); !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %+v, %v, want %+v", got, ok, want)
+	}
+}
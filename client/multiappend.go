@@ -0,0 +1,132 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// AppendMessage is a message appended by MultiAppend.
+type AppendMessage struct {
+	// Flags are set on the message.
+	Flags []imap.Flag
+	// InternalDate is the internal date of the message. If zero, the
+	// server uses the current time.
+	InternalDate time.Time
+	// Literal is the message.
+	Literal []byte
+}
+
+// MultiAppend appends messages to a mailbox with a single APPEND command
+// (MULTIAPPEND, RFC 3502): either all of them are appended or none is.
+// With a single message it is a plain APPEND, which all servers support.
+//
+// If the server supports UIDPLUS, the returned data contains the UID of
+// each message, in order; otherwise the UIDs are zero. MultiAppend can be
+// used while IDLE is in progress, see Idle.
+func (c *Client) MultiAppend(mailbox string, msgs []AppendMessage) ([]*imap.AppendData, error) {
+	if len(msgs) == 0 {
+		return nil, errors.New("imap: no messages to append")
+	}
+
+	defer c.interruptIdle()()
+
+	tag := c.tags.Next()
+	line := tag + " APPEND " + quoteArg(mailbox) + appendMessageHeader(&msgs[0])
+
+	cmd, err := c.send(tag, "APPEND", line, true)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range msgs {
+		// Wait for continuation request
+		if _, err := c.waitForContinuation(cmd); err != nil {
+			c.release()
+			return nil, err
+		}
+
+		// Send the literal data, followed by the next message or the end
+		// of the command
+		next := "\r\n"
+		if i+1 < len(msgs) {
+			next = appendMessageHeader(&msgs[i+1])
+		}
+		if err := c.writeContinuation(msgs[i].Literal, []byte(next)); err != nil {
+			c.release()
+			return nil, err
+		}
+	}
+	c.release()
+
+	result := <-cmd.done
+	if err := commandResultError(result); err != nil {
+		return nil, err
+	}
+
+	data := make([]*imap.AppendData, len(msgs))
+	for i := range data {
+		data[i] = &imap.AppendData{}
+	}
+	// Parse APPENDUID from response code
+	if strings.HasPrefix(result.code, "APPENDUID ") {
+		parts := strings.Fields(result.code[10:])
+		if len(parts) >= 2 {
+			uidValidity, _ := strconv.ParseUint(parts[0], 10, 32)
+			var uids []imap.UID
+			if set, err := imap.ParseUIDSet(parts[1]); err == nil {
+				uids = expandUIDSet(set)
+			}
+			for i, d := range data {
+				d.UIDValidity = uint32(uidValidity)
+				if len(uids) == len(data) {
+					d.UID = uids[i]
+				}
+			}
+		}
+	}
+	return data, nil
+}
+
+// appendMessageHeader returns the flags, date and literal header of a
+// message in an APPEND command, starting with a space.
+func appendMessageHeader(msg *AppendMessage) string {
+	var b strings.Builder
+	if len(msg.Flags) > 0 {
+		b.WriteString(" (")
+		for i, f := range msg.Flags {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(string(f))
+		}
+		b.WriteByte(')')
+	}
+	if !msg.InternalDate.IsZero() {
+		b.WriteString(` "` + msg.InternalDate.Format(imap.InternalDateLayout) + `"`)
+	}
+	fmt.Fprintf(&b, " {%d}\r\n", len(msg.Literal))
+	return b.String()
+}
+
+// expandUIDSet returns the UIDs of a set without "*", in order.
+func expandUIDSet(set *imap.UIDSet) []imap.UID {
+	var uids []imap.UID
+	for _, r := range set.Ranges() {
+		if r.Start == 0 || r.Stop == 0 {
+			continue
+		}
+		start, stop := r.Start, r.Stop
+		if start > stop {
+			start, stop = stop, start
+		}
+		for uid := start; uid <= stop; uid++ {
+			uids = append(uids, imap.UID(uid))
+		}
+	}
+	return uids
+}
@@ -4,6 +4,9 @@ import (
 	"crypto/tls"
 	"log/slog"
 	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/wire"
 )
 
 // Option is a functional option for configuring the client.
@@ -29,8 +32,61 @@ type Options struct {
 	// UnilateralDataHandler handles unsolicited server responses.
 	UnilateralDataHandler *UnilateralDataHandler
 
-	// DebugLog enables wire-level protocol logging.
+	// DebugLog enables wire-level protocol logging to standard error.
+	// Use Client.SetDebugWriter to log elsewhere.
 	DebugLog bool
+
+	// DebugLiteralLimit is the number of bytes of each literal written to
+	// the wire log. 0 means literals are logged in full.
+	DebugLiteralLimit int
+
+	// ReadRateLimit caps the rate at which literal data is read from the
+	// server, in bytes per second. 0 means no limit.
+	ReadRateLimit int
+
+	// WireTrace receives the raw data written to and read from the
+	// server, after TLS encryption is removed. See WithWireTrace.
+	WireTrace wire.TraceFunc
+
+	// CharsetReader converts charsets that imap.NewCharsetReader does not
+	// know to UTF-8 in DecodeText and UIDFetchText. See WithCharsetReader.
+	CharsetReader imap.CharsetReaderFunc
+
+	// ReadBufferSize and WriteBufferSize are the sizes of the buffers
+	// responses are read through and commands written through. 0 means
+	// 4096 bytes.
+	ReadBufferSize  int
+	WriteBufferSize int
+
+	// MaxResponseSize limits the size of a single response, literals
+	// included, such as a FETCH response carrying a message body, which
+	// the client holds in memory. A larger response closes the connection
+	// with ErrResponseTooLarge. 0 means no limit.
+	MaxResponseSize int64
+
+	// LazyBodyStructure leaves BODYSTRUCTURE data unparsed in the
+	// RawBodyStructure field of fetched messages until their Structure
+	// method is called.
+	LazyBodyStructure bool
+
+	// NoParsedHeaders leaves the Header field of fetched messages nil;
+	// the header fields remain available raw in BodySection.
+	NoParsedHeaders bool
+
+	// SectionCacheSize is the number of bytes of body sections
+	// UIDFetchSection keeps, each for SectionCacheTTL or
+	// DefaultSectionCacheTTL. 0 disables the cache. See WithSectionCache.
+	SectionCacheSize int64
+	SectionCacheTTL  time.Duration
+
+	// ResponseValidator, if set, is called with each violation of the
+	// IMAP grammar found in the responses of the server, see
+	// ValidateResponse. Violations do not fail commands.
+	ResponseValidator func(*ResponseViolation)
+
+	// UIDExpungeFallback is how ExpungeUIDs and DeleteMessages remove
+	// messages on servers without UIDPLUS. See WithUIDExpungeFallback.
+	UIDExpungeFallback UIDExpungeFallback
 }
 
 // UnilateralDataHandler handles unsolicited server data.
@@ -93,9 +149,131 @@ func WithUnilateralDataHandler(h *UnilateralDataHandler) Option {
 	}
 }
 
+// WithDebugLiteralLimit truncates literals in the wire log to n bytes.
+func WithDebugLiteralLimit(n int) Option {
+	return func(o *Options) {
+		o.DebugLiteralLimit = n
+	}
+}
+
 // WithDebugLog enables wire-level protocol logging.
 func WithDebugLog(enable bool) Option {
 	return func(o *Options) {
 		o.DebugLog = enable
 	}
 }
+
+// WithReadRateLimit limits the rate at which literal data, such as message
+// bodies in FETCH responses, is read from the server.
+func WithReadRateLimit(bytesPerSec int) Option {
+	return func(o *Options) {
+		o.ReadRateLimit = bytesPerSec
+	}
+}
+
+// WithWireTrace sets a callback that receives all protocol data exchanged
+// with the server, for example to feed a packet capture sink. Unlike the
+// debug log, data is passed unmodified, credentials included, in chunks
+// that do not follow line boundaries. It is called from the goroutines
+// that read and write the connection and must not block.
+func WithWireTrace(fn wire.TraceFunc) Option {
+	return func(o *Options) {
+		o.WireTrace = fn
+	}
+}
+
+// WithCharsetReader sets a function converting additional charsets, such
+// as GBK or Shift_JIS, to UTF-8 when message text is decoded. It is tried
+// before the built-in charsets and should return imap.ErrUnknownCharset
+// for charsets it does not know. See imap.CharsetReaderFunc for an
+// implementation using golang.org/x/text.
+func WithCharsetReader(fn imap.CharsetReaderFunc) Option {
+	return func(o *Options) {
+		o.CharsetReader = fn
+	}
+}
+
+// WithBufferSizes sets the sizes of the buffers responses are read
+// through and commands written through, 4096 bytes by default.
+func WithBufferSizes(read, write int) Option {
+	return func(o *Options) {
+		o.ReadBufferSize = read
+		o.WriteBufferSize = write
+	}
+}
+
+// WithMaxResponseSize limits the size of a single response, literals
+// included. A larger response closes the connection with
+// ErrResponseTooLarge.
+func WithMaxResponseSize(n int64) Option {
+	return func(o *Options) {
+		o.MaxResponseSize = n
+	}
+}
+
+// WithLazyBodyStructure defers parsing BODYSTRUCTURE data until the
+// Structure method of a fetched message is called.
+func WithLazyBodyStructure(lazy bool) Option {
+	return func(o *Options) {
+		o.LazyBodyStructure = lazy
+	}
+}
+
+// WithSectionCache makes UIDFetchSection keep up to size bytes of
+// fetched body sections for ttl, or DefaultSectionCacheTTL if ttl is 0,
+// so that requests for sections fetched shortly before send no command.
+func WithSectionCache(size int64, ttl time.Duration) Option {
+	return func(o *Options) {
+		o.SectionCacheSize = size
+		o.SectionCacheTTL = ttl
+	}
+}
+
+// WithResponseValidator checks every response of the server against the
+// IMAP grammar and reports the violations to fn, without failing the
+// commands, so that the client can be used to test the conformance of
+// servers. fn is called from the goroutine reading responses.
+func WithResponseValidator(fn func(*ResponseViolation)) Option {
+	return func(o *Options) {
+		o.ResponseValidator = fn
+	}
+}
+
+// WithUIDExpungeFallback sets how ExpungeUIDs and DeleteMessages remove
+// messages on servers that do not support UID EXPUNGE:
+// UIDExpungeClearOthers, the default, UIDExpungeIfNoOthers, or
+// UIDExpungeRefuse to fail with ErrUIDExpungeUnsupported instead of
+// emulating it.
+func WithUIDExpungeFallback(f UIDExpungeFallback) Option {
+	return func(o *Options) {
+		o.UIDExpungeFallback = f
+	}
+}
+
+// ConstrainedMaxResponseSize is the MaxResponseSize set by
+// WithConstrainedProfile.
+const ConstrainedMaxResponseSize = 1 << 20
+
+// WithConstrainedProfile configures the client for embedded and mobile
+// devices, trading speed for a small memory footprint:
+//
+//   - responses are read and commands written through 512-byte buffers;
+//   - BODYSTRUCTURE data is parsed only when accessed, see
+//     WithLazyBodyStructure;
+//   - the parsed copy of fetched headers is not kept, see
+//     Options.NoParsedHeaders;
+//   - responses are limited to ConstrainedMaxResponseSize, so that a
+//     message body is fetched in parts with BODY.PEEK[]<offset.size>.
+//
+// Options given after it override these settings, for example
+// WithMaxResponseSize to raise the memory ceiling. BenchmarkProfile
+// compares the footprint of both profiles.
+func WithConstrainedProfile() Option {
+	return func(o *Options) {
+		o.ReadBufferSize = 512
+		o.WriteBufferSize = 512
+		o.LazyBodyStructure = true
+		o.NoParsedHeaders = true
+		o.MaxResponseSize = ConstrainedMaxResponseSize
+	}
+}
@@ -4,68 +4,362 @@ package pool
 import (
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/meszmate/imap-go/client"
 )
 
 // Pool manages a pool of IMAP client connections.
 type Pool struct {
-	mu       sync.Mutex
-	factory  func() (*client.Client, error)
-	clients  []*client.Client
-	maxSize  int
-	closed   bool
+	mu      sync.Mutex
+	factory func() (*client.Client, error)
+	clients []*pooledClient
+	maxSize int
+	closed  bool
+
+	keepalive time.Duration
+	idle      bool
+	restore   bool
+	stop      chan struct{}
+
+	// The throttling state of Do: the number of operations running, the
+	// limit on it (0 if unlimited), when the last throttle ends and the
+	// number of consecutive throttled operations. cond is signalled when
+	// an operation ends.
+	cond           *sync.Cond
+	inflight       int
+	limit          int
+	throttledUntil time.Time
+	throttles      int
+}
+
+// pooledClient is an idle client in the pool.
+type pooledClient struct {
+	c *client.Client
+	// since is when the client was last used or kept alive.
+	since time.Time
+	// idle is the IDLE command the client is in, with WithIdleKeepalive.
+	idle *client.IdleCommand
+}
+
+// Option configures a Pool.
+type Option func(*Pool)
+
+// WithKeepalive keeps idle clients in the pool alive, so that NAT devices
+// and firewalls do not drop their connections: a client that has not been
+// used for interval is sent a NOOP. Clients that fail it are closed and
+// removed from the pool. Get also sends a NOOP to a client that has been
+// idle for interval before returning it, so callers get a live connection.
+//
+// Clients are checked every half interval, so a client is idle for at most
+// one and a half intervals.
+func WithKeepalive(interval time.Duration) Option {
+	return func(p *Pool) {
+		p.keepalive = interval
+	}
+}
+
+// WithIdleKeepalive makes idle clients wait in IDLE rather than being sent
+// NOOPs. The IDLE command is re-entered every keepalive interval, as RFC
+// 2177 recommends servers to log out clients idling for more than 30
+// minutes, and ended by Get, which validates the connection. Clients must
+// be in the authenticated or selected state when they are put back.
+func WithIdleKeepalive() Option {
+	return func(p *Pool) {
+		p.idle = true
+	}
+}
+
+// WithRestore makes Do restore the state of a client whose operation
+// failed with a transient error on the client it retries the operation
+// with, see client.Client.Restore: the capabilities enabled and the
+// mailbox selected, so that the operation can continue where it left off
+// on the new connection. A retry fails if the mailbox cannot be selected
+// again or its UIDVALIDITY changed; saved search results are not
+// restored.
+func WithRestore() Option {
+	return func(p *Pool) {
+		p.restore = true
+	}
 }
 
 // New creates a new connection pool.
-func New(maxSize int, factory func() (*client.Client, error)) *Pool {
-	return &Pool{
+func New(maxSize int, factory func() (*client.Client, error), opts ...Option) *Pool {
+	p := &Pool{
 		factory: factory,
 		maxSize: maxSize,
+		stop:    make(chan struct{}),
+	}
+	p.cond = sync.NewCond(&p.mu)
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.keepalive > 0 {
+		go p.keepaliveLoop()
 	}
+	return p
 }
 
 // Get returns a client from the pool, creating a new one if necessary.
+// Pooled clients whose connection turns out to be dead are closed and
+// skipped.
 func (p *Pool) Get() (*client.Client, error) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	if p.closed {
-		return nil, errors.New("pool is closed")
-	}
-
-	// Try to return an existing client
-	if len(p.clients) > 0 {
-		c := p.clients[len(p.clients)-1]
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, errors.New("pool is closed")
+		}
+		if len(p.clients) == 0 {
+			p.mu.Unlock()
+			break
+		}
+		pc := p.clients[len(p.clients)-1]
 		p.clients = p.clients[:len(p.clients)-1]
-		return c, nil
+		p.mu.Unlock()
+
+		if err := p.validate(pc); err != nil {
+			_ = pc.c.Close()
+			continue
+		}
+		return pc.c, nil
 	}
 
 	// Create a new one
 	return p.factory()
 }
 
+// validate checks that a client taken from the pool is still usable.
+func (p *Pool) validate(pc *pooledClient) error {
+	if pc.idle != nil {
+		return pc.idle.Done()
+	}
+	if p.keepalive > 0 && time.Since(pc.since) >= p.keepalive {
+		return pc.c.Noop()
+	}
+	return nil
+}
+
 // Put returns a client to the pool.
 func (p *Pool) Put(c *client.Client) {
+	pc := &pooledClient{c: c, since: time.Now()}
+	if p.idle {
+		idle, err := c.Idle()
+		if err != nil {
+			_ = c.Close()
+			return
+		}
+		pc.idle = idle
+	}
+	p.put(pc)
+}
+
+// put adds pc to the pool, or closes it if the pool is closed or full.
+func (p *Pool) put(pc *pooledClient) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	if p.closed || len(p.clients) >= p.maxSize {
-		_ = c.Close()
+		_ = pc.c.Close()
 		return
 	}
 
-	p.clients = append(p.clients, c)
+	p.clients = append(p.clients, pc)
+}
+
+// keepaliveLoop refreshes idle clients until the pool is closed.
+func (p *Pool) keepaliveLoop() {
+	ticker := time.NewTicker(p.keepalive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			for _, pc := range p.takeStale() {
+				if err := p.refresh(pc); err != nil {
+					_ = pc.c.Close()
+					continue
+				}
+				pc.since = time.Now()
+				p.put(pc)
+			}
+		}
+	}
+}
+
+// takeStale removes the clients that have been idle for the keepalive
+// interval from the pool and returns them.
+func (p *Pool) takeStale() []*pooledClient {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var stale []*pooledClient
+	fresh := p.clients[:0]
+	for _, pc := range p.clients {
+		if time.Since(pc.since) >= p.keepalive {
+			stale = append(stale, pc)
+		} else {
+			fresh = append(fresh, pc)
+		}
+	}
+	p.clients = fresh
+	return stale
+}
+
+// refresh keeps the connection of an idle client alive.
+func (p *Pool) refresh(pc *pooledClient) error {
+	if pc.idle == nil {
+		return pc.c.Noop()
+	}
+	if err := pc.idle.Done(); err != nil {
+		pc.idle = nil
+		return err
+	}
+	idle, err := pc.c.Idle()
+	pc.idle = idle
+	return err
+}
+
+// maxAttempts is the number of times Do runs an operation that fails with
+// a transient error.
+const maxAttempts = 3
+
+// maxThrottleDelay caps the backoff of Do after throttling.
+const maxThrottleDelay = 5 * time.Minute
+
+// Do runs fn with a client from the pool and returns the client to the
+// pool afterwards. If fn fails with a transient error (see
+// client.IsTransient), the client is closed and fn is retried with another
+// client, up to three attempts in total.
+//
+// If the server throttles the pool (see client.RetryAfterError), either
+// when connecting or in fn, Do backs off: no operation starts before the
+// delay the server asked for has passed, doubled for every further
+// operation throttled in a row, and the number of operations running at
+// once is limited to half of those running when the server throttled.
+// The limit grows back by one with every operation that succeeds and is
+// lifted once it exceeds the size of the pool.
+func (p *Pool) Do(fn func(c *client.Client) error) error {
+	var err error
+	var snapshot *client.Snapshot
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if err := p.acquire(); err != nil {
+			return err
+		}
+		var c *client.Client
+		c, err = p.Get()
+		if err == nil {
+			if snapshot != nil {
+				if err = c.Restore(snapshot); errors.Is(err, client.ErrSavedSearchLost) {
+					err = nil
+				}
+			}
+			if err == nil {
+				err = fn(c)
+				if p.restore && client.IsTransient(err) {
+					snapshot = c.Snapshot()
+				}
+			}
+			if !client.IsTransient(err) {
+				p.Put(c)
+			} else {
+				_ = c.Close()
+			}
+		}
+		p.release(err)
+		if !client.IsTransient(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// acquire waits until the pool is not throttled and an operation may
+// start, and counts it as running.
+func (p *Pool) acquire() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		if p.closed {
+			return errors.New("pool is closed")
+		}
+		if wait := time.Until(p.throttledUntil); wait > 0 {
+			p.mu.Unlock()
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-p.stop:
+				timer.Stop()
+			}
+			p.mu.Lock()
+			continue
+		}
+		if p.limit == 0 || p.inflight < p.limit {
+			p.inflight++
+			return nil
+		}
+		p.cond.Wait()
+	}
+}
+
+// release ends an operation started with acquire that returned err and
+// updates the throttling state.
+func (p *Pool) release(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if after, ok := client.RetryAfter(err); ok {
+		if p.throttles < 16 {
+			p.throttles++
+		}
+		delay := after << (p.throttles - 1)
+		if delay <= 0 || delay > maxThrottleDelay {
+			delay = maxThrottleDelay
+		}
+		if until := time.Now().Add(delay); until.After(p.throttledUntil) {
+			p.throttledUntil = until
+		}
+		limit := p.inflight / 2
+		if limit < 1 {
+			limit = 1
+		}
+		if p.limit == 0 || limit < p.limit {
+			p.limit = limit
+		}
+	} else if err == nil {
+		p.throttles = 0
+		if p.limit > 0 {
+			p.limit++
+			if p.limit > p.maxSize {
+				p.limit = 0
+			}
+		}
+	}
+	p.inflight--
+	p.cond.Broadcast()
+}
+
+// Concurrency returns the number of operations Do runs at once after the
+// server throttled the pool, or 0 if it is not limited.
+func (p *Pool) Concurrency() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.limit
 }
 
-// Close closes all clients in the pool.
+// Close closes all clients in the pool and stops the keepalives.
 func (p *Pool) Close() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	if !p.closed {
+		close(p.stop)
+	}
 	p.closed = true
-	for _, c := range p.clients {
-		_ = c.Close()
+	p.cond.Broadcast()
+	for _, pc := range p.clients {
+		_ = pc.c.Close()
 	}
 	p.clients = nil
 	return nil
@@ -0,0 +1,254 @@
+package pool
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client"
+)
+
+// fakeServer is a scripted server that records the commands it receives.
+type fakeServer struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	commands []string
+	conns    []net.Conn
+	// throttle is the number of NOOP commands still to answer with a
+	// throttling NO.
+	throttle int
+}
+
+// dial returns a client connected to a new fake server connection.
+func (s *fakeServer) dial() (*client.Client, error) {
+	serverConn, clientConn := net.Pipe()
+	s.mu.Lock()
+	s.conns = append(s.conns, serverConn)
+	s.mu.Unlock()
+	s.t.Cleanup(func() {
+		_ = serverConn.Close()
+		_ = clientConn.Close()
+	})
+
+	go func() {
+		fmt.Fprint(serverConn, "* OK ready\r\n")
+		r := bufio.NewReader(serverConn)
+		idleTag := ""
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			tag, cmd, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+			if tag == "DONE" {
+				cmd = "DONE"
+			}
+			s.mu.Lock()
+			s.commands = append(s.commands, cmd)
+			throttled := cmd == "NOOP" && s.throttle > 0
+			if throttled {
+				s.throttle--
+			}
+			s.mu.Unlock()
+
+			if throttled {
+				fmt.Fprintf(serverConn, "%s NO [THROTTLED] Suggested Backoff Time: 50 milliseconds\r\n", tag)
+				continue
+			}
+			switch cmd {
+			case "IDLE":
+				idleTag = tag
+				fmt.Fprint(serverConn, "+ idling\r\n")
+			case "DONE":
+				fmt.Fprintf(serverConn, "%s OK IDLE terminated\r\n", idleTag)
+			default:
+				fmt.Fprintf(serverConn, "%s OK %s completed\r\n", tag, cmd)
+			}
+		}
+	}()
+
+	return client.New(clientConn)
+}
+
+// count returns how many times the server received cmd.
+func (s *fakeServer) count(cmd string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, c := range s.commands {
+		if c == cmd {
+			n++
+		}
+	}
+	return n
+}
+
+// waitFor waits until the server received cmd at least n times.
+func (s *fakeServer) waitFor(cmd string, n int) {
+	s.t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for s.count(cmd) < n {
+		if time.Now().After(deadline) {
+			s.t.Fatalf("server received %d %s commands, want %d", s.count(cmd), cmd, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPool_Keepalive(t *testing.T) {
+	srv := &fakeServer{t: t}
+	p := New(2, srv.dial, WithKeepalive(20*time.Millisecond))
+	defer p.Close()
+
+	c, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	p.Put(c)
+
+	srv.waitFor("NOOP", 2)
+}
+
+func TestPool_GetDropsDeadClients(t *testing.T) {
+	srv := &fakeServer{t: t}
+	p := New(2, srv.dial, WithKeepalive(time.Hour))
+	defer p.Close()
+
+	c, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	p.Put(c)
+
+	// Make the client look stale and kill its connection.
+	p.mu.Lock()
+	p.clients[0].since = time.Now().Add(-2 * time.Hour)
+	p.mu.Unlock()
+	srv.mu.Lock()
+	_ = srv.conns[0].Close()
+	srv.mu.Unlock()
+
+	got, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	if got == c {
+		t.Error("Get() returned a client whose connection is dead")
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if n := len(srv.conns); n != 2 {
+		t.Errorf("factory called %d times, want 2", n)
+	}
+}
+
+func TestPool_IdleKeepalive(t *testing.T) {
+	srv := &fakeServer{t: t}
+	p := New(2, srv.dial, WithKeepalive(20*time.Millisecond), WithIdleKeepalive())
+	defer p.Close()
+
+	c, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	p.Put(c)
+
+	// The keepalive ends IDLE and enters it again.
+	srv.waitFor("IDLE", 2)
+	srv.waitFor("DONE", 1)
+}
+
+func TestPool_IdleGet(t *testing.T) {
+	srv := &fakeServer{t: t}
+	p := New(2, srv.dial, WithKeepalive(time.Hour), WithIdleKeepalive())
+	defer p.Close()
+
+	c, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	p.Put(c)
+	srv.waitFor("IDLE", 1)
+
+	got, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	if got != c {
+		t.Fatal("Get() did not return the pooled client")
+	}
+	if srv.count("DONE") != 1 {
+		t.Errorf("server received %d DONEs, want 1", srv.count("DONE"))
+	}
+	if err := got.Noop(); err != nil {
+		t.Errorf("Noop() after Get() error: %v", err)
+	}
+}
+
+func TestPool_DoThrottled(t *testing.T) {
+	srv := &fakeServer{t: t, throttle: 1}
+	p := New(2, srv.dial)
+	defer p.Close()
+
+	start := time.Now()
+	calls := 0
+	err := p.Do(func(c *client.Client) error {
+		calls++
+		if calls == 2 && p.Concurrency() != 1 {
+			t.Errorf("Concurrency() after throttling = %d, want 1", p.Concurrency())
+		}
+		return c.Noop()
+	})
+	if err != nil {
+		t.Fatalf("Do() error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("fn called %d times, want 2", calls)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Do() retried after %v, want at least the suggested 50ms", elapsed)
+	}
+	if got := p.Concurrency(); got != 2 {
+		t.Errorf("Concurrency() after a success = %d, want 2", got)
+	}
+}
+
+func TestPool_DoRestore(t *testing.T) {
+	srv := &fakeServer{t: t}
+	dial := func() (*client.Client, error) {
+		c, err := srv.dial()
+		if err != nil {
+			return nil, err
+		}
+		return c, c.Login("alice", "secret")
+	}
+	p := New(2, dial, WithRestore())
+	defer p.Close()
+
+	calls := 0
+	err := p.Do(func(c *client.Client) error {
+		calls++
+		if calls == 1 {
+			if _, err := c.Select("INBOX", nil); err != nil {
+				return err
+			}
+			return client.ErrClosed
+		}
+		if c.State() != imap.ConnStateSelected {
+			t.Errorf("retry with state %v, want INBOX selected", c.State())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Do() error: %v", err)
+	}
+	if n := srv.count("SELECT INBOX"); n != 2 {
+		t.Errorf("server received %d SELECT commands, want 2", n)
+	}
+}
@@ -0,0 +1,223 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/textproto"
+	"strings"
+	"unicode/utf8"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+const (
+	// PreviewLength is the maximum number of characters of the previews
+	// generated by Preview.
+	PreviewLength = 200
+
+	// previewFetchSize is the number of bytes of the text part Preview
+	// fetches to generate a preview. It leaves room for transfer encoding
+	// and, in HTML parts, for markup.
+	previewFetchSize = 4096
+)
+
+// Preview returns a short plain-text preview of the message with the
+// given UID, such as the first lines of its text, for message lists.
+//
+// If the server supports PREVIEW (RFC 8970), the preview of the server is
+// fetched. Otherwise, the preview is generated client-side: the body
+// structure of the message is fetched, then the first bytes of its
+// smallest text/plain part, or of its smallest text/html part if it has
+// none, attachments excluded. The part is decoded as with DecodeText,
+// HTML markup is removed, and whitespace is collapsed; the result is cut
+// to PreviewLength characters. Preview returns "" for messages without
+// text. The message is fetched with BODY.PEEK, so the \Seen flag is not
+// set.
+func (c *Client) Preview(uid imap.UID) (string, error) {
+	if c.HasCap("PREVIEW") {
+		msg, err := c.fetchPreviewItems(uid, "(UID PREVIEW)")
+		if err != nil {
+			return "", err
+		}
+		// Servers may have no preview at hand (NIL), or omit it.
+		if msg.Preview != "" {
+			return msg.Preview, nil
+		}
+	}
+
+	msg, err := c.fetchPreviewItems(uid, "(UID BODYSTRUCTURE)")
+	if err != nil {
+		return "", err
+	}
+	bs, err := msg.Structure()
+	if err != nil || bs == nil {
+		return "", fmt.Errorf("imap: no body structure for message %d", uid)
+	}
+	part, ok := previewPart(bs)
+	if !ok {
+		return "", nil
+	}
+
+	section := part.Section(true)
+	section.Partial = &imap.SectionPartial{Offset: 0, Count: previewFetchSize}
+	if msg, err = c.fetchPreviewItems(uid, "(UID "+section.String()+")"); err != nil {
+		return "", err
+	}
+	section.Partial = nil
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType(part.Structure.MediaType(), part.Structure.Params))
+	h.Set("Content-Transfer-Encoding", part.Structure.Encoding)
+	r, err := c.DecodeText(h, bytes.NewReader(bodySection(msg, section.SectionSpec())))
+	if err != nil {
+		return "", err
+	}
+	// The part is usually cut in the middle, which may leave an
+	// incomplete encoded sequence: what was decoded before is kept.
+	text, _ := io.ReadAll(r)
+	return previewText(string(text), part.Structure.MediaType() == "text/html"), nil
+}
+
+// fetchPreviewItems fetches the data items of the message with the given
+// UID.
+func (c *Client) fetchPreviewItems(uid imap.UID, items string) (*imap.FetchMessageBuffer, error) {
+	msgs, err := c.UIDFetchMessages(fmt.Sprint(uid), items)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		if msg.UID == uid {
+			return msg, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %d", ErrNoSuchMessage, uid)
+}
+
+// previewPart returns the part of a message a preview is generated from:
+// the smallest text/plain part that is not an attachment, or the
+// smallest text/html part if there is none.
+func previewPart(bs *imap.BodyStructure) (imap.BodyPart, bool) {
+	for _, mediaType := range []string{"text/plain", "text/html"} {
+		var best imap.BodyPart
+		found := false
+		for _, part := range bs.FindParts(imap.PartFilter{MediaType: mediaType}) {
+			if strings.EqualFold(part.Structure.Disposition, "attachment") || part.Structure.Filename() != "" {
+				continue
+			}
+			if !found || part.Structure.Size < best.Structure.Size {
+				best, found = part, true
+			}
+		}
+		if found {
+			return best, true
+		}
+	}
+	return imap.BodyPart{}, false
+}
+
+// previewText turns the decoded text of a part into a preview: markup is
+// removed from HTML, whitespace is collapsed and the text is cut to
+// PreviewLength characters.
+func previewText(text string, isHTML bool) string {
+	text = strings.ToValidUTF8(text, "")
+	if isHTML {
+		text = stripHTML(text)
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= PreviewLength {
+		return text
+	}
+	n := 0
+	for i := range text {
+		if n == PreviewLength {
+			return strings.TrimRight(text[:i], " ")
+		}
+		n++
+	}
+	return text
+}
+
+// stripHTML returns the text of an HTML document: tags and comments are
+// removed, as well as the content of the head, script and style
+// elements, and character references are decoded. Tags are replaced by a
+// space, so that the text of paragraphs and table cells is not glued
+// together. A tag cut at the end of the document is dropped.
+func stripHTML(s string) string {
+	var b strings.Builder
+	for s != "" {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:i])
+		s = s[i:]
+
+		if strings.HasPrefix(s, "<!--") {
+			end := strings.Index(s, "-->")
+			if end < 0 {
+				break
+			}
+			s = s[end+3:]
+			continue
+		}
+		end := strings.IndexByte(s, '>')
+		if end < 0 {
+			break
+		}
+		tag := s[1:end]
+		name := strings.ToLower(tag)
+		if i := strings.IndexAny(name, " \t\r\n/"); i >= 0 {
+			name = name[:i]
+		}
+		s = s[end+1:]
+		b.WriteByte(' ')
+
+		switch name {
+		case "head", "script", "style", "title":
+			if strings.HasSuffix(tag, "/") {
+				continue
+			}
+			// Skip to the end tag of the element.
+			endTag := indexASCIIFold(s, "</"+name)
+			if endTag < 0 {
+				s = ""
+				continue
+			}
+			s = s[endTag:]
+			if end := strings.IndexByte(s, '>'); end >= 0 {
+				s = s[end+1:]
+			} else {
+				s = ""
+			}
+		}
+	}
+	return html.UnescapeString(b.String())
+}
+
+// indexASCIIFold returns the index of the first instance of the ASCII
+// string substr in s, ignoring ASCII case, or -1.
+func indexASCIIFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		match := true
+		for j := 0; j < len(substr); j++ {
+			a, b := s[i+j], substr[j]
+			if 'A' <= a && a <= 'Z' {
+				a += 'a' - 'A'
+			}
+			if 'A' <= b && b <= 'Z' {
+				b += 'a' - 'A'
+			}
+			if a != b {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newPreviewClient returns a client of a server with the capabilities
+// caps, answering UID FETCH with the responses of fetch, keyed by data
+// item name, and a function returning the data items it was asked for.
+func newPreviewClient(t *testing.T, caps string, fetch map[string]string) (*Client, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var items []string
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1"+caps+"] ready", func(w io.Writer, tag, cmd string) {
+		if _, item, ok := strings.Cut(cmd, "(UID "); ok {
+			item = strings.TrimSuffix(item, ")")
+			mu.Lock()
+			items = append(items, item)
+			mu.Unlock()
+			if resp, ok := fetch[item]; ok {
+				fmt.Fprintf(w, "* 1 FETCH (UID 5 %s)\r\n", resp)
+			}
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+	return c, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return items
+	}
+}
+
+func TestPreview_Server(t *testing.T) {
+	c, items := newPreviewClient(t, " PREVIEW", map[string]string{
+		"PREVIEW": `PREVIEW "Hello from the server"`,
+	})
+	got, err := c.Preview(5)
+	if err != nil {
+		t.Fatalf("Preview() error: %v", err)
+	}
+	if got != "Hello from the server" {
+		t.Errorf("Preview() = %q", got)
+	}
+	if got := items(); len(got) != 1 {
+		t.Errorf("fetched %q, want PREVIEW only", got)
+	}
+}
+
+func TestPreview_ServerNIL(t *testing.T) {
+	c, items := newPreviewClient(t, " PREVIEW", map[string]string{
+		"PREVIEW":              "PREVIEW NIL",
+		"BODYSTRUCTURE":        `BODYSTRUCTURE ("TEXT" "PLAIN" ("CHARSET" "us-ascii") NIL NIL "7BIT" 6 1)`,
+		"BODY.PEEK[1]<0.4096>": "BODY[1]<0> {6}\r\nHello\n",
+	})
+	got, err := c.Preview(5)
+	if err != nil {
+		t.Fatalf("Preview() error: %v", err)
+	}
+	if got != "Hello" {
+		t.Errorf("Preview() = %q, want %q", got, "Hello")
+	}
+	if got := items(); len(got) != 3 {
+		t.Errorf("fetched %q, want PREVIEW, BODYSTRUCTURE and the text", got)
+	}
+}
+
+func TestPreview_Plain(t *testing.T) {
+	body := "Caf=C3=A9 au lait,=\r\n  anyone?\r\n\r\nSee you"
+	c, items := newPreviewClient(t, "", map[string]string{
+		"BODYSTRUCTURE": `BODYSTRUCTURE ((("TEXT" "PLAIN" ("CHARSET" "utf-8") NIL NIL "QUOTED-PRINTABLE" 40 3 NIL NIL NIL NIL)` +
+			`("TEXT" "HTML" ("CHARSET" "utf-8") NIL NIL "7BIT" 20 1 NIL NIL NIL NIL) "ALTERNATIVE")` +
+			`("TEXT" "PLAIN" ("NAME" "notes.txt") NIL NIL "7BIT" 10 1 NIL ("ATTACHMENT" ("FILENAME" "notes.txt")) NIL NIL) "MIXED")`,
+		"BODY.PEEK[1.1]<0.4096>": fmt.Sprintf("BODY[1.1]<0> {%d}\r\n%s", len(body), body),
+	})
+	got, err := c.Preview(5)
+	if err != nil {
+		t.Fatalf("Preview() error: %v", err)
+	}
+	if want := "Café au lait, anyone? See you"; got != want {
+		t.Errorf("Preview() = %q, want %q", got, want)
+	}
+	if got := items(); len(got) != 2 || got[1] != "BODY.PEEK[1.1]<0.4096>" {
+		t.Errorf("fetched %q, want BODYSTRUCTURE and part 1.1", got)
+	}
+}
+
+func TestPreview_HTML(t *testing.T) {
+	// "<html><head><style>p{}</style></head><body><p>Hi&amp;bye</p><p>there</p></body></html>"
+	body := "PGh0bWw+PGhlYWQ+PHN0eWxlPnB7fTwvc3R5bGU+PC9oZWFkPjxib2R5PjxwPkhpJmFtcDtieWU8\r\nL3A+PHA+dGhlcmU8L3A+PC9ib2R5PjwvaHRtbD4=\r\n"
+	c, _ := newPreviewClient(t, "", map[string]string{
+		"BODYSTRUCTURE":        `BODYSTRUCTURE ("TEXT" "HTML" ("CHARSET" "utf-8") NIL NIL "BASE64" 120 2 NIL NIL NIL NIL)`,
+		"BODY.PEEK[1]<0.4096>": fmt.Sprintf("BODY[1]<0> {%d}\r\n%s", len(body), body),
+	})
+	got, err := c.Preview(5)
+	if err != nil {
+		t.Fatalf("Preview() error: %v", err)
+	}
+	if want := "Hi&bye there"; got != want {
+		t.Errorf("Preview() = %q, want %q", got, want)
+	}
+}
+
+func TestPreview_NoText(t *testing.T) {
+	c, items := newPreviewClient(t, "", map[string]string{
+		"BODYSTRUCTURE": `BODYSTRUCTURE ("IMAGE" "PNG" NIL NIL NIL "BASE64" 100 NIL NIL NIL NIL)`,
+	})
+	got, err := c.Preview(5)
+	if err != nil || got != "" {
+		t.Errorf("Preview() = %q, %v; want empty", got, err)
+	}
+	if got := items(); len(got) != 1 {
+		t.Errorf("fetched %q, want BODYSTRUCTURE only", got)
+	}
+}
+
+func TestPreviewText(t *testing.T) {
+	long := strings.Repeat("é", PreviewLength+10)
+	if got := previewText(long, false); got != long[:2*PreviewLength] {
+		t.Errorf("previewText() kept %d characters, want %d", len([]rune(got)), PreviewLength)
+	}
+	// A multi-byte sequence cut by a partial fetch is dropped.
+	if got := previewText("ab \xc3", false); got != "ab" {
+		t.Errorf("previewText() = %q, want %q", got, "ab")
+	}
+
+	tests := []struct{ in, want string }{
+		{"a<br>b", "a b"},
+		{"<!-- note -->text", "text"},
+		{"<SCRIPT type=x>var a = '<p>';</SCRIPT>after", "after"},
+		{"<p>one</p><p>two</p>", "one two"},
+		{"x &lt;y&gt; &#233;", "x <y> é"},
+		{"cut <a href=", "cut"},
+		{"<title>T</title><style/>body", "body"},
+	}
+	for _, tt := range tests {
+		if got := previewText(tt.in, true); got != tt.want {
+			t.Errorf("previewText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
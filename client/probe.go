@@ -0,0 +1,260 @@
+package client
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// probeEnableCaps are the capabilities Probe tries to ENABLE.
+var probeEnableCaps = []imap.Cap{
+	imap.CapCondStore,
+	imap.CapQResync,
+	imap.CapUTF8Accept,
+	imap.CapIMAP4rev2,
+}
+
+// ProbeReport describes what a server supports, as found by Probe.
+type ProbeReport struct {
+	// State is the connection state the probe ran in.
+	State imap.ConnState
+	// PreAuthCaps are the capabilities advertised before authentication,
+	// if the client saw them.
+	PreAuthCaps []string
+	// Caps are the capabilities advertised in State.
+	Caps []string
+	// ServerID is the server's ID response (RFC 2971).
+	ServerID map[string]string
+	// Namespace is the NAMESPACE response (RFC 2342).
+	Namespace *imap.NamespaceData
+	// Enabled lists the capabilities the server accepted in ENABLE.
+	Enabled []string
+	// SpecialUse maps special-use attributes to mailbox names.
+	SpecialUse map[imap.MailboxAttr]string
+	// QuotaRoots are the quota roots of INBOX.
+	QuotaRoots []string
+	// Quotas holds the usage and limits of each quota root.
+	Quotas []*imap.QuotaData
+	// Errors holds the error of each step that failed, keyed by command
+	// name. A failed step does not stop the probe.
+	Errors map[string]error
+}
+
+// Probe exercises the server with read-only commands and reports what it
+// supports: CAPABILITY, ID, NAMESPACE, ENABLE, LIST with special-use
+// attributes and GETQUOTAROOT INBOX. Commands the server does not
+// advertise are skipped, and commands that need authentication are only
+// issued once the client is authenticated. Probe is intended for support
+// tooling and for automatic configuration.
+//
+// Probe enables the extensions it can, which changes how the server
+// responds afterwards, so it is best run on a dedicated connection. It
+// returns the partial report and ctx.Err() if ctx is done between steps.
+func (c *Client) Probe(ctx context.Context) (*ProbeReport, error) {
+	report := &ProbeReport{
+		State:  c.State(),
+		Errors: make(map[string]error),
+	}
+	c.mu.Lock()
+	report.PreAuthCaps = append([]string(nil), c.preAuthCaps...)
+	c.mu.Unlock()
+
+	authenticated := report.State == imap.ConnStateAuthenticated || report.State == imap.ConnStateSelected
+	steps := []struct {
+		name string
+		auth bool
+		cap  imap.Cap
+		run  func() error
+	}{
+		{"CAPABILITY", false, "", func() (err error) {
+			report.Caps, err = c.EnsureCaps()
+			if err == nil && !authenticated {
+				report.PreAuthCaps = report.Caps
+			}
+			return err
+		}},
+		{"ID", false, imap.CapID, func() (err error) {
+			report.ServerID, err = c.ID(nil)
+			return err
+		}},
+		{"NAMESPACE", true, imap.CapNamespace, func() (err error) {
+			report.Namespace, err = c.namespace()
+			return err
+		}},
+		{"ENABLE", true, imap.CapEnable, func() (err error) {
+			report.Enabled, err = c.probeEnable()
+			return err
+		}},
+		{"LIST", true, "", func() (err error) {
+			report.SpecialUse, err = c.specialUseMailboxes()
+			return err
+		}},
+		{"GETQUOTAROOT", true, imap.CapQuota, func() (err error) {
+			report.QuotaRoots, report.Quotas, err = c.quotaRoot("INBOX")
+			return err
+		}},
+	}
+
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if step.auth && !authenticated {
+			continue
+		}
+		if step.cap != "" && !c.HasCap(string(step.cap)) {
+			continue
+		}
+		if err := step.run(); err != nil {
+			report.Errors[step.name] = err
+		}
+	}
+	return report, nil
+}
+
+// probeEnable enables the capabilities in probeEnableCaps that the server
+// advertises and returns those it accepted.
+func (c *Client) probeEnable() ([]string, error) {
+	var caps []string
+	for _, cap := range probeEnableCaps {
+		if c.HasCap(string(cap)) {
+			caps = append(caps, string(cap))
+		}
+	}
+	if len(caps) == 0 {
+		return nil, nil
+	}
+
+	c.collectUntagged()
+	if err := c.Enable(caps...); err != nil {
+		return nil, err
+	}
+
+	var enabled []string
+	for _, line := range c.collectUntagged() {
+		if strings.HasPrefix(strings.ToUpper(line), "ENABLED") {
+			enabled = append(enabled, strings.Fields(line)[1:]...)
+		}
+	}
+	return enabled, nil
+}
+
+// specialUseMailboxes lists all mailboxes and returns those with a
+// special-use attribute.
+func (c *Client) specialUseMailboxes() (map[imap.MailboxAttr]string, error) {
+	list, err := c.listSpecialUse()
+	if err != nil {
+		return nil, err
+	}
+
+	uses := make(map[imap.MailboxAttr]string)
+	for _, data := range list {
+		for _, attr := range imap.SpecialUseAttrs {
+			if _, ok := uses[attr]; !ok && hasAttr(data.Attrs, attr) {
+				uses[attr] = data.Mailbox
+			}
+		}
+	}
+	return uses, nil
+}
+
+// namespace sends a NAMESPACE command (RFC 2342).
+func (c *Client) namespace() (*imap.NamespaceData, error) {
+	c.collectUntagged()
+	if err := c.executeCheck("NAMESPACE"); err != nil {
+		return nil, err
+	}
+
+	for _, line := range c.collectUntagged() {
+		if strings.HasPrefix(line, "NAMESPACE ") {
+			return parseNamespaceResponse(line[10:]), nil
+		}
+	}
+	return &imap.NamespaceData{}, nil
+}
+
+// parseNamespaceResponse parses the personal, other users' and shared
+// namespaces of a NAMESPACE response.
+func parseNamespaceResponse(s string) *imap.NamespaceData {
+	data := &imap.NamespaceData{}
+	for _, ns := range []*[]imap.NamespaceDescriptor{&data.Personal, &data.Other, &data.Shared} {
+		s = strings.TrimLeft(s, " ")
+		if !strings.HasPrefix(s, "(") {
+			// NIL
+			_, s = readQuotedOrAtom(s)
+			continue
+		}
+
+		var inner string
+		inner, s = extractParenthesized(s)
+		for {
+			inner = strings.TrimLeft(inner, " ")
+			if !strings.HasPrefix(inner, "(") {
+				break
+			}
+			var desc string
+			desc, inner = extractParenthesized(inner)
+
+			prefix, rest := readQuotedOrAtom(desc)
+			delim, _ := readQuotedOrAtom(strings.TrimLeft(rest, " "))
+			d := imap.NamespaceDescriptor{Prefix: prefix}
+			if delim != "" && !strings.EqualFold(delim, "NIL") {
+				d.Delim = rune(strings.TrimPrefix(delim, "\\")[0])
+			}
+			*ns = append(*ns, d)
+		}
+	}
+	return data
+}
+
+// quotaRoot sends a GETQUOTAROOT command (RFC 9208).
+func (c *Client) quotaRoot(mailbox string) ([]string, []*imap.QuotaData, error) {
+	c.collectUntagged()
+	if err := c.executeCheck("GETQUOTAROOT", quoteArg(mailbox)); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		roots  []string
+		quotas []*imap.QuotaData
+	)
+	for _, line := range c.collectUntagged() {
+		upper := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(upper, "QUOTAROOT "):
+			_, rest := readQuotedOrAtom(line[10:])
+			for rest = strings.TrimLeft(rest, " "); rest != ""; rest = strings.TrimLeft(rest, " ") {
+				var root string
+				root, rest = readQuotedOrAtom(rest)
+				roots = append(roots, root)
+			}
+		case strings.HasPrefix(upper, "QUOTA "):
+			quotas = append(quotas, parseQuotaResponse(line[6:]))
+		}
+	}
+	return roots, quotas, nil
+}
+
+// parseQuotaResponse parses `root (resource usage limit ...)`.
+func parseQuotaResponse(s string) *imap.QuotaData {
+	root, rest := readQuotedOrAtom(s)
+	data := &imap.QuotaData{Root: root}
+
+	list, _ := extractParenthesized(strings.TrimLeft(rest, " "))
+	fields := strings.Fields(list)
+	for i := 0; i+2 < len(fields); i += 3 {
+		usage, err1 := strconv.ParseInt(fields[i+1], 10, 64)
+		limit, err2 := strconv.ParseInt(fields[i+2], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		data.Resources = append(data.Resources, imap.QuotaResourceData{
+			Name:  imap.QuotaResource(strings.ToUpper(fields[i])),
+			Usage: usage,
+			Limit: limit,
+		})
+	}
+	return data
+}
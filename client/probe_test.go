@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func newProbeServer(t *testing.T) *Client {
+	loggedIn := false
+	return newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1 ID ENABLE] ready", func(w io.Writer, tag, cmd string) {
+		name, _, _ := strings.Cut(cmd, " ")
+		switch name {
+		case "LOGIN":
+			loggedIn = true
+		case "CAPABILITY":
+			if loggedIn {
+				fmt.Fprint(w, "* CAPABILITY IMAP4rev1 ID ENABLE NAMESPACE CONDSTORE QUOTA SPECIAL-USE LIST-EXTENDED\r\n")
+			} else {
+				fmt.Fprint(w, "* CAPABILITY IMAP4rev1 ID ENABLE\r\n")
+			}
+		case "ID":
+			fmt.Fprint(w, "* ID (\"name\" \"TestServer\" \"Version\" \"1.0\" \"os\" NIL)\r\n")
+		case "NAMESPACE":
+			fmt.Fprint(w, "* NAMESPACE ((\"\" \"/\")) NIL ((\"Shared/\" \"/\"))\r\n")
+		case "ENABLE":
+			fmt.Fprint(w, "* ENABLED CONDSTORE\r\n")
+		case "LIST":
+			fmt.Fprint(w, "* LIST (\\HasNoChildren) \"/\" INBOX\r\n")
+			fmt.Fprint(w, "* LIST (\\HasNoChildren \\Sent) \"/\" Sent\r\n")
+			fmt.Fprint(w, "* LIST (\\HasNoChildren \\Trash) \"/\" \"Deleted Items\"\r\n")
+		case "GETQUOTAROOT":
+			fmt.Fprint(w, "* QUOTAROOT INBOX \"\"\r\n")
+			fmt.Fprint(w, "* QUOTA \"\" (STORAGE 10 512 MESSAGE 3 100)\r\n")
+		default:
+			fmt.Fprintf(w, "%s BAD unknown command\r\n", tag)
+			return
+		}
+		fmt.Fprintf(w, "%s OK %s completed\r\n", tag, name)
+	})
+}
+
+func TestProbe(t *testing.T) {
+	c := newProbeServer(t)
+
+	pre, err := c.Probe(context.Background())
+	if err != nil {
+		t.Fatalf("Probe() before login error: %v", err)
+	}
+	if pre.State != imap.ConnStateNotAuthenticated {
+		t.Errorf("State = %v, want not authenticated", pre.State)
+	}
+	if pre.Namespace != nil || pre.SpecialUse != nil {
+		t.Errorf("Probe() before login ran authenticated commands: %+v", pre)
+	}
+	if got := pre.ServerID["name"]; got != "TestServer" {
+		t.Errorf("ServerID[name] = %q, want TestServer", got)
+	}
+
+	if err := c.Login("user", "pass"); err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	report, err := c.Probe(context.Background())
+	if err != nil {
+		t.Fatalf("Probe() error: %v", err)
+	}
+
+	if len(report.Errors) != 0 {
+		t.Errorf("Errors = %v", report.Errors)
+	}
+	if want := []string{"IMAP4rev1", "ID", "ENABLE"}; !reflect.DeepEqual(report.PreAuthCaps, want) {
+		t.Errorf("PreAuthCaps = %v, want %v", report.PreAuthCaps, want)
+	}
+	if !reflect.DeepEqual(report.ServerID, map[string]string{"name": "TestServer", "version": "1.0"}) {
+		t.Errorf("ServerID = %v", report.ServerID)
+	}
+	wantNS := &imap.NamespaceData{
+		Personal: []imap.NamespaceDescriptor{{Prefix: "", Delim: '/'}},
+		Shared:   []imap.NamespaceDescriptor{{Prefix: "Shared/", Delim: '/'}},
+	}
+	if !reflect.DeepEqual(report.Namespace, wantNS) {
+		t.Errorf("Namespace = %+v, want %+v", report.Namespace, wantNS)
+	}
+	if !reflect.DeepEqual(report.Enabled, []string{"CONDSTORE"}) {
+		t.Errorf("Enabled = %v", report.Enabled)
+	}
+	wantUse := map[imap.MailboxAttr]string{
+		imap.MailboxAttrSent:  "Sent",
+		imap.MailboxAttrTrash: "Deleted Items",
+	}
+	if !reflect.DeepEqual(report.SpecialUse, wantUse) {
+		t.Errorf("SpecialUse = %v, want %v", report.SpecialUse, wantUse)
+	}
+	if !reflect.DeepEqual(report.QuotaRoots, []string{""}) {
+		t.Errorf("QuotaRoots = %q", report.QuotaRoots)
+	}
+	wantQuota := []*imap.QuotaData{{Root: "", Resources: []imap.QuotaResourceData{
+		{Name: imap.QuotaResourceStorage, Usage: 10, Limit: 512},
+		{Name: imap.QuotaResourceMessage, Usage: 3, Limit: 100},
+	}}}
+	if !reflect.DeepEqual(report.Quotas, wantQuota) {
+		t.Errorf("Quotas = %+v", report.Quotas)
+	}
+}
+
+func TestProbe_Canceled(t *testing.T) {
+	c := newProbeServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := c.Probe(ctx)
+	if err != context.Canceled {
+		t.Fatalf("Probe() error = %v, want context.Canceled", err)
+	}
+	if report == nil || report.Caps != nil {
+		t.Errorf("Probe() with canceled context ran commands: %+v", report)
+	}
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+const profileBodyStructure = `(("TEXT" "PLAIN" ("CHARSET" "UTF-8") NIL NIL "7BIT" 120 4 NIL NIL NIL NIL)` +
+	`("APPLICATION" "PDF" ("NAME" "report.pdf") NIL NIL "BASE64" 40000 NIL ("ATTACHMENT" ("FILENAME" "report.pdf")) NIL NIL)` +
+	` "MIXED" ("BOUNDARY" "b1") NIL NIL NIL)`
+
+const profileHeader = "Subject: Quarterly report\r\nFrom: alice@example.org\r\n\r\n"
+
+// respondFetch answers UID FETCH with n messages carrying a body structure
+// and a header section.
+func respondFetch(n int) func(w io.Writer, tag, cmd string) {
+	return func(w io.Writer, tag, cmd string) {
+		if strings.HasPrefix(cmd, "UID FETCH") {
+			for i := 1; i <= n; i++ {
+				fmt.Fprintf(w, "* %d FETCH (UID %d BODYSTRUCTURE %s BODY[HEADER.FIELDS (SUBJECT FROM)] {%d}\r\n%s)\r\n",
+					i, i, profileBodyStructure, len(profileHeader), profileHeader)
+			}
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	}
+}
+
+func TestConstrainedProfile(t *testing.T) {
+	const items = "(UID BODYSTRUCTURE BODY.PEEK[HEADER.FIELDS (SUBJECT FROM)])"
+
+	c := newScriptedClient(t, "* OK ready", respondFetch(1))
+	msgs, err := c.UIDFetchMessages("1", items)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("UIDFetchMessages() = %v, %v", msgs, err)
+	}
+	if bs := msgs[0].BodyStructure; bs == nil || len(bs.Children) != 2 || msgs[0].Header.Get("Subject") != "Quarterly report" {
+		t.Errorf("default profile: BodyStructure %+v, Header %v", bs, msgs[0].Header)
+	}
+
+	c = newScriptedClient(t, "* OK ready", respondFetch(1), WithConstrainedProfile())
+	msgs, err = c.UIDFetchMessages("1", items)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("UIDFetchMessages() = %v, %v", msgs, err)
+	}
+	msg := msgs[0]
+	if msg.BodyStructure != nil || msg.RawBodyStructure != profileBodyStructure || msg.Header != nil {
+		t.Errorf("constrained profile: BodyStructure %+v, RawBodyStructure %q, Header %v", msg.BodyStructure, msg.RawBodyStructure, msg.Header)
+	}
+	if string(msg.BodySection["HEADER.FIELDS (SUBJECT FROM)"]) != profileHeader {
+		t.Errorf("BodySection = %q", msg.BodySection)
+	}
+	bs, err := msg.Structure()
+	if err != nil || bs.Children[1].Filename() != "report.pdf" {
+		t.Errorf("Structure() = %+v, %v", bs, err)
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		response string
+	}{
+		{"literal", "* 1 FETCH (UID 1 BODY[] {2000}\r\n" + strings.Repeat("x", 2000) + ")\r\n"},
+		{"line", "* 1 FETCH (UID 1 X-DATA \"" + strings.Repeat("x", 2000) + "\")\r\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+				if strings.HasPrefix(cmd, "UID FETCH") {
+					_, _ = io.WriteString(w, tt.response)
+				}
+				fmt.Fprintf(w, "%s OK done\r\n", tag)
+			}, WithMaxResponseSize(1000))
+
+			if err := c.Noop(); err != nil {
+				t.Fatalf("Noop() error: %v", err)
+			}
+			if _, err := c.UIDFetch("1", "(UID BODY.PEEK[])"); !errors.Is(err, ErrResponseTooLarge) {
+				t.Fatalf("UIDFetch() error = %v, want ErrResponseTooLarge", err)
+			}
+			select {
+			case <-c.Done():
+			case <-time.After(time.Second):
+				t.Fatal("connection not closed")
+			}
+		})
+	}
+}
+
+// BenchmarkProfile compares the memory used to fetch the body structures
+// and headers of 100 messages with the default and constrained profiles.
+// Run it with -benchmem: with the constrained profile, the body
+// structures are not parsed, since they are not accessed, and no header
+// maps are built.
+func BenchmarkProfile(b *testing.B) {
+	const items = "(UID BODYSTRUCTURE BODY.PEEK[HEADER.FIELDS (SUBJECT FROM)])"
+	for _, profile := range []struct {
+		name string
+		opts []Option
+	}{
+		{"default", nil},
+		{"constrained", []Option{WithConstrainedProfile()}},
+	} {
+		b.Run(profile.name, func(b *testing.B) {
+			c := newScriptedClient(b, "* OK ready", respondFetch(100), profile.opts...)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.UIDFetchMessages("1:100", items); err != nil {
+					b.Fatalf("UIDFetchMessages() error: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// DefaultQueryChunkSize is the number of messages fetched by each UID
+// FETCH of QueryMessages when QueryOptions.ChunkSize is 0.
+const DefaultQueryChunkSize = 200
+
+// QueryOptions contains options for QueryMessages.
+type QueryOptions struct {
+	// Search selects the messages, such as "UNSEEN SINCE 1-Jan-2024". If
+	// empty, all messages are selected.
+	Search string
+	// Sort, if set, orders the messages on the server with UID SORT, see
+	// SortMessages. Otherwise they are in the order of UID SEARCH, which
+	// is ascending UIDs.
+	Sort []imap.SortCriterion
+	// Charset is the charset of the strings in Search when sorting. If
+	// empty, UTF-8 is used.
+	Charset string
+	// Items are the FETCH data items, such as "(FLAGS ENVELOPE
+	// RFC822.SIZE)". UID is always fetched. If empty, "(UID FLAGS)" is
+	// used.
+	Items string
+	// Offset and Limit select a page of the ordered result: the messages
+	// from position Offset, at most Limit of them. Only the messages of the
+	// page are fetched. A Limit of 0 means no limit.
+	Offset int
+	Limit  int
+	// ChunkSize is the maximum number of messages fetched by one UID
+	// FETCH. If 0, DefaultQueryChunkSize is used.
+	ChunkSize int
+}
+
+// QueryResult is the result of QueryMessages.
+type QueryResult struct {
+	// Messages are the fetched messages, in the search or sort order.
+	Messages []*imap.FetchMessageBuffer
+	// Total is the number of messages matching the search, regardless of
+	// Offset and Limit.
+	Total int
+	// Missing are the UIDs of the page that were matched but not
+	// returned by FETCH, such as messages expunged in the meantime or
+	// those of a chunk that failed.
+	Missing []imap.UID
+}
+
+// QueryMessages finds the messages of the selected mailbox matching
+// opts.Search, optionally sorted, and fetches opts.Items for the page
+// selected by opts.Offset and opts.Limit, with one UID FETCH per
+// opts.ChunkSize messages. The messages are returned in the search or
+// sort order, whatever the order of the FETCH responses.
+//
+// If the search fails, its error is returned. If a UID FETCH fails with a
+// NO or BAD response, the other chunks are still fetched; the errors of
+// all the failed chunks are joined and returned together with the
+// messages that were fetched. Other errors, such as a broken connection,
+// stop the query.
+func (c *Client) QueryMessages(opts *QueryOptions) (*QueryResult, error) {
+	if opts == nil {
+		opts = &QueryOptions{}
+	}
+
+	var nums []uint32
+	var err error
+	if len(opts.Sort) > 0 {
+		nums, err = c.SortMessages(&SortOptions{
+			Criteria: opts.Sort,
+			Search:   opts.Search,
+			Charset:  opts.Charset,
+			UID:      true,
+		})
+	} else {
+		search := opts.Search
+		if search == "" {
+			search = "ALL"
+		}
+		nums, err = c.UIDSearch(search)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := &QueryResult{Total: len(nums)}
+	page := queryPage(nums, opts.Offset, opts.Limit)
+	if len(page) == 0 {
+		return res, nil
+	}
+
+	size := opts.ChunkSize
+	if size <= 0 {
+		size = DefaultQueryChunkSize
+	}
+	items := queryFetchItems(opts.Items)
+
+	byUID := make(map[imap.UID]*imap.FetchMessageBuffer, len(page))
+	var errs []error
+	for start := 0; start < len(page); start += size {
+		end := start + size
+		if end > len(page) {
+			end = len(page)
+		}
+		set := &imap.UIDSet{}
+		for _, num := range page[start:end] {
+			set.AddNum(imap.UID(num))
+		}
+		set.Normalize()
+
+		msgs, err := c.UIDFetchMessages(set.String(), items)
+		if err != nil {
+			var imapErr *imap.IMAPError
+			if !errors.As(err, &imapErr) {
+				return nil, err
+			}
+			errs = append(errs, fmt.Errorf("imap: fetching UIDs %s: %w", set, err))
+		}
+		for _, msg := range msgs {
+			if msg.UID != 0 {
+				byUID[msg.UID] = msg
+			}
+		}
+	}
+
+	res.Messages = make([]*imap.FetchMessageBuffer, 0, len(page))
+	for _, num := range page {
+		if msg, ok := byUID[imap.UID(num)]; ok {
+			res.Messages = append(res.Messages, msg)
+		} else {
+			res.Missing = append(res.Missing, imap.UID(num))
+		}
+	}
+	return res, errors.Join(errs...)
+}
+
+// queryPage returns the numbers from offset, at most limit of them.
+func queryPage(nums []uint32, offset, limit int) []uint32 {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(nums) {
+		return nil
+	}
+	nums = nums[offset:]
+	if limit > 0 && limit < len(nums) {
+		nums = nums[:limit]
+	}
+	return nums
+}
+
+// fetchMacros are the FETCH macros, which cannot be combined with other
+// data items (RFC 3501 section 6.4.5).
+var fetchMacros = map[string]string{
+	"FAST": "FLAGS INTERNALDATE RFC822.SIZE",
+	"ALL":  "FLAGS INTERNALDATE RFC822.SIZE ENVELOPE",
+	"FULL": "FLAGS INTERNALDATE RFC822.SIZE ENVELOPE BODY",
+}
+
+// queryFetchItems returns the FETCH data items of QueryOptions.Items, with
+// UID added if missing and macros expanded.
+func queryFetchItems(items string) string {
+	items = strings.TrimSpace(items)
+	if expanded, ok := fetchMacros[strings.ToUpper(items)]; ok {
+		items = expanded
+	}
+	if strings.HasPrefix(items, "(") && strings.HasSuffix(items, ")") {
+		items = strings.TrimSpace(items[1 : len(items)-1])
+	}
+	if items == "" {
+		return "(UID FLAGS)"
+	}
+	for _, item := range strings.Fields(items) {
+		if strings.EqualFold(item, "UID") {
+			return "(" + items + ")"
+		}
+	}
+	return "(UID " + items + ")"
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestQueryMessages_SortOrderAndChunks(t *testing.T) {
+	var mu sync.Mutex
+	var cmds []string
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1 SORT] ready", func(w io.Writer, tag, cmd string) {
+		mu.Lock()
+		cmds = append(cmds, cmd)
+		mu.Unlock()
+		switch {
+		case strings.HasPrefix(cmd, "UID SORT "):
+			fmt.Fprint(w, "* SORT 9 3 7 5 2 8\r\n")
+		case strings.HasPrefix(cmd, "UID FETCH 3,7 "):
+			// Responses in UID order, not in the sort order.
+			fmt.Fprint(w, "* 2 FETCH (UID 3 FLAGS (\\Seen))\r\n")
+			fmt.Fprint(w, "* 4 FETCH (UID 7 FLAGS ())\r\n")
+		case strings.HasPrefix(cmd, "UID FETCH 2,5 "):
+			// UID 5 was expunged.
+			fmt.Fprint(w, "* 1 FETCH (UID 2 FLAGS ())\r\n")
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+
+	res, err := c.QueryMessages(&QueryOptions{
+		Search:    "UNSEEN",
+		Sort:      []imap.SortCriterion{{Key: imap.SortKeyDate, Reverse: true}},
+		Items:     "FLAGS",
+		Offset:    1,
+		Limit:     4,
+		ChunkSize: 2,
+	})
+	if err != nil {
+		t.Fatalf("QueryMessages() error: %v", err)
+	}
+
+	want := []string{
+		"UID SORT (REVERSE DATE) UTF-8 UNSEEN",
+		"UID FETCH 3,7 (UID FLAGS)",
+		"UID FETCH 2,5 (UID FLAGS)",
+	}
+	if strings.Join(cmds, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands = %q, want %q", cmds, want)
+	}
+	if res.Total != 6 {
+		t.Errorf("Total = %d, want 6", res.Total)
+	}
+	var uids []imap.UID
+	for _, msg := range res.Messages {
+		uids = append(uids, msg.UID)
+	}
+	if fmt.Sprint(uids) != "[3 7 2]" {
+		t.Errorf("UIDs = %v, want [3 7 2]", uids)
+	}
+	if fmt.Sprint(res.Missing) != "[5]" {
+		t.Errorf("Missing = %v, want [5]", res.Missing)
+	}
+}
+
+func TestQueryMessages_ChunkError(t *testing.T) {
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		switch {
+		case strings.HasPrefix(cmd, "UID SEARCH "):
+			fmt.Fprint(w, "* SEARCH 1 2 3\r\n")
+		case strings.HasPrefix(cmd, "UID FETCH 1:2 "):
+			fmt.Fprintf(w, "%s NO [SERVERBUG] fetch failed\r\n", tag)
+			return
+		case strings.HasPrefix(cmd, "UID FETCH 3 "):
+			fmt.Fprint(w, "* 3 FETCH (UID 3 RFC822.SIZE 42)\r\n")
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+
+	res, err := c.QueryMessages(&QueryOptions{Items: "(UID RFC822.SIZE)", ChunkSize: 2})
+	var imapErr *imap.IMAPError
+	if !errors.As(err, &imapErr) || !strings.Contains(err.Error(), "1:2") {
+		t.Fatalf("QueryMessages() error = %v, want the NO of the first chunk", err)
+	}
+	if len(res.Messages) != 1 || res.Messages[0].RFC822Size != 42 {
+		t.Errorf("Messages = %v, want UID 3", res.Messages)
+	}
+	if fmt.Sprint(res.Missing) != "[1 2]" {
+		t.Errorf("Missing = %v, want [1 2]", res.Missing)
+	}
+}
+
+func TestQueryFetchItems(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", "(UID FLAGS)"},
+		{"FLAGS ENVELOPE", "(UID FLAGS ENVELOPE)"},
+		{"(uid FLAGS)", "(uid FLAGS)"},
+		{"fast", "(UID FLAGS INTERNALDATE RFC822.SIZE)"},
+		{"BODY.PEEK[HEADER.FIELDS (SUBJECT)]", "(UID BODY.PEEK[HEADER.FIELDS (SUBJECT)])"},
+	}
+	for _, tt := range tests {
+		if got := queryFetchItems(tt.in); got != tt.want {
+			t.Errorf("queryFetchItems(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
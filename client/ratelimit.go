@@ -0,0 +1,144 @@
+package client
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket that caps the rate at which literal data
+// (message bodies in FETCH responses) is read from the server. Response
+// lines such as continuation requests and tagged completions are not
+// throttled.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a RateLimiter allowing bytesPerSec bytes per second.
+// The bucket holds up to one second of data, with a minimum of 4 KiB.
+func NewRateLimiter(bytesPerSec int) *RateLimiter {
+	l := &RateLimiter{last: time.Now()}
+	l.SetRate(bytesPerSec)
+	l.tokens = float64(l.burst)
+	return l
+}
+
+// SetRate changes the limit to bytesPerSec bytes per second.
+func (l *RateLimiter) SetRate(bytesPerSec int) {
+	if bytesPerSec < 1 {
+		bytesPerSec = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = float64(bytesPerSec)
+	l.burst = bytesPerSec
+	if l.burst < 4096 {
+		l.burst = 4096
+	}
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+}
+
+// Rate returns the current limit in bytes per second.
+func (l *RateLimiter) Rate() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.rate)
+}
+
+// chunkSize returns the largest read that may be made in one step.
+func (l *RateLimiter) chunkSize() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.burst
+}
+
+// wait consumes n tokens, sleeping until they are available.
+func (l *RateLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// rateLimitedReader throttles reads from r using limiter.
+type rateLimitedReader struct {
+	r       io.Reader
+	limiter *RateLimiter
+}
+
+func (rl *rateLimitedReader) Read(p []byte) (int, error) {
+	if limit := rl.limiter.chunkSize(); len(p) > limit {
+		p = p[:limit]
+	}
+	n, err := rl.r.Read(p)
+	if n > 0 {
+		rl.limiter.wait(n)
+	}
+	return n, err
+}
+
+// SetReadRateLimit limits the rate at which literal data is read from the
+// server to bytesPerSec bytes per second. A value of 0 removes the limit.
+// The limit applies to all responses read after the call, including those
+// for commands already in flight.
+func (c *Client) SetReadRateLimit(bytesPerSec int) {
+	if bytesPerSec <= 0 {
+		c.readLimiter.Store(nil)
+		return
+	}
+	if l := c.readLimiter.Load(); l != nil {
+		l.SetRate(bytesPerSec)
+		return
+	}
+	c.readLimiter.Store(NewRateLimiter(bytesPerSec))
+}
+
+// ReadRateLimit returns the current literal read limit in bytes per second,
+// or 0 if reads are not limited.
+func (c *Client) ReadRateLimit() int {
+	if l := c.readLimiter.Load(); l != nil {
+		return l.Rate()
+	}
+	return 0
+}
+
+// RateLimited runs fn with the literal read limit temporarily set to
+// bytesPerSec, restoring the previous limit afterwards. It is intended for
+// throttling a single large transfer:
+//
+//	err := c.RateLimited(64*1024, func() error {
+//		_, err := c.UIDFetch("1:*", "BODY.PEEK[]")
+//		return err
+//	})
+//
+// Since all responses share one connection, responses to other commands
+// received while fn runs are throttled as well.
+func (c *Client) RateLimited(bytesPerSec int, fn func() error) error {
+	prev := c.readLimiter.Load()
+	if bytesPerSec > 0 {
+		c.readLimiter.Store(NewRateLimiter(bytesPerSec))
+	} else {
+		c.readLimiter.Store(nil)
+	}
+	defer c.readLimiter.Store(prev)
+	return fn()
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchLiteralReadAsSingleResponse(t *testing.T) {
+	body := "Subject: test\r\n\r\nA1 OK not a tagged response\r\n"
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		fmt.Fprintf(w, "* 1 FETCH (UID 7 BODY[] {%d}\r\n%s)\r\n", len(body), body)
+		fmt.Fprintf(w, "%s OK FETCH completed\r\n", tag)
+	})
+
+	responses, err := c.Fetch("1", "(UID BODY[])")
+	if err != nil {
+		t.Fatalf("Fetch() error: %v", err)
+	}
+	if len(responses) != 1 {
+		t.Fatalf("got %d responses, want 1: %q", len(responses), responses)
+	}
+	if !strings.Contains(responses[0], body) || !strings.HasSuffix(responses[0], ")") {
+		t.Errorf("response = %q, want literal body included", responses[0])
+	}
+}
+
+func TestReadRateLimit(t *testing.T) {
+	body := strings.Repeat("x", 6144)
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		fmt.Fprintf(w, "* 1 FETCH (BODY[] {%d}\r\n%s)\r\n", len(body), body)
+		fmt.Fprintf(w, "%s OK FETCH completed\r\n", tag)
+	})
+
+	if got := c.ReadRateLimit(); got != 0 {
+		t.Fatalf("ReadRateLimit() = %d, want 0", got)
+	}
+
+	start := time.Now()
+	err := c.RateLimited(4096, func() error {
+		_, err := c.Fetch("1", "BODY[]")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Fetch() error: %v", err)
+	}
+	// The first 4096 bytes come from the initial burst; the remaining
+	// 2048 bytes take about half a second at 4096 bytes/sec.
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("rate-limited fetch took %v, want >= 400ms", elapsed)
+	}
+	if got := c.ReadRateLimit(); got != 0 {
+		t.Errorf("ReadRateLimit() after RateLimited = %d, want 0", got)
+	}
+
+	c.SetReadRateLimit(1 << 20)
+	if got := c.ReadRateLimit(); got != 1<<20 {
+		t.Errorf("ReadRateLimit() = %d, want %d", got, 1<<20)
+	}
+}
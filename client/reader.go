@@ -26,17 +26,26 @@ func newReader(decoder *wire.Decoder, c *Client) *reader {
 // run reads and dispatches server responses until the connection is closed.
 func (r *reader) run() {
 	for {
-		line, err := r.decoder.ReadLine()
+		line, err := r.readResponse()
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				err = io.ErrUnexpectedEOF
+			if errors.Is(err, wire.ErrLineTooLong) {
+				err = fmt.Errorf("%w: %w", ErrResponseTooLarge, err)
 			}
+			if errors.Is(err, ErrResponseTooLarge) {
+				// The rest of the response cannot be skipped cheaply.
+				r.client.mu.Lock()
+				conn := r.client.conn
+				r.client.mu.Unlock()
+				_ = conn.Close()
+			}
+			err = r.client.disconnectCause(err)
 			r.client.options.Logger.Debug("reader error", "error", err)
 			r.client.handleDisconnect(err)
 			return
 		}
 
 		r.client.options.Logger.Debug("recv", "line", line)
+		r.client.validate(line)
 
 		if err := r.processLine(line); err != nil {
 			r.client.options.Logger.Debug("process error", "error", err)
@@ -44,6 +53,99 @@ func (r *reader) run() {
 	}
 }
 
+// readResponse reads a complete response. Literals announced at the end of
+// a line are read (subject to the client's rate limit) and included in the
+// returned string together with their {N} header, so that a FETCH response
+// carrying a message body is returned as a single unit.
+func (r *reader) readResponse() (string, error) {
+	line, err := r.decoder.ReadLine()
+	if err != nil {
+		return "", err
+	}
+
+	if isTextResponse(line) {
+		return line, nil
+	}
+	size, ok := trailingLiteralSize(line)
+	if !ok {
+		return line, nil
+	}
+
+	limit := r.client.options.MaxResponseSize
+	var b strings.Builder
+	b.WriteString(line)
+	for ok {
+		if limit > 0 && int64(b.Len())+size > limit {
+			return "", fmt.Errorf("%w: literal of %d bytes", ErrResponseTooLarge, size)
+		}
+		b.WriteString("\r\n")
+
+		var lr io.Reader = r.decoder.ReadLiteral(size)
+		if limiter := r.client.readLimiter.Load(); limiter != nil {
+			lr = &rateLimitedReader{r: lr, limiter: limiter}
+		}
+		n, err := io.Copy(&b, lr)
+		if err != nil {
+			return "", err
+		}
+		if n != size {
+			return "", io.ErrUnexpectedEOF
+		}
+
+		rest, err := r.decoder.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		if limit > 0 && int64(b.Len()+len(rest)) > limit {
+			return "", ErrResponseTooLarge
+		}
+		b.WriteString(rest)
+		size, ok = trailingLiteralSize(rest)
+	}
+	return b.String(), nil
+}
+
+// isTextResponse reports whether line is a continuation request or a
+// status response, tagged or untagged. They end with human-readable text,
+// and their response codes contain no literals, so a {N} at their end is
+// part of the text rather than a literal header.
+func isTextResponse(line string) bool {
+	if strings.HasPrefix(line, "+") {
+		return true
+	}
+	_, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return false
+	}
+	status, _, _ := strings.Cut(rest, " ")
+	switch strings.ToUpper(status) {
+	case "OK", "NO", "BAD", "PREAUTH", "BYE":
+		return true
+	}
+	return false
+}
+
+// trailingLiteralSize reports whether line ends with a literal header such
+// as {42}, {42+} or ~{42}, and returns the literal size.
+func trailingLiteralSize(line string) (int64, bool) {
+	if !strings.HasSuffix(line, "}") {
+		return 0, false
+	}
+	open := strings.LastIndexByte(line, '{')
+	if open < 0 {
+		return 0, false
+	}
+	digits := strings.TrimSuffix(line[open+1:len(line)-1], "+")
+	if digits == "" {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || size < 0 {
+		return 0, false
+	}
+	return size, true
+}
+
 // processLine handles a single response line.
 func (r *reader) processLine(line string) error {
 	if len(line) == 0 {
@@ -93,6 +195,7 @@ func (r *reader) processUntagged(line string) error {
 		return nil
 	}
 	if strings.HasPrefix(upperLine, "BYE ") {
+		r.client.handleBye(line[4:])
 		r.handleStatusResponse("BYE", line[4:])
 		return nil
 	}
@@ -133,6 +236,10 @@ func (r *reader) processUntagged(line string) error {
 		return nil
 	}
 
+	if strings.HasPrefix(upperLine, "ENABLED") {
+		r.client.recordEnabled(strings.Fields(line)[1:])
+	}
+
 	// Store for any waiting data collector
 	r.client.storeUntagged(line)
 	return nil
@@ -183,6 +290,12 @@ func (r *reader) processTagged(line string) error {
 
 	status, code, text := parseStatusResponse(rest)
 
+	// Servers send the new capabilities in the tagged OK to LOGIN and
+	// AUTHENTICATE; record them before the command completes.
+	if name, caps, ok := strings.Cut(code, " "); ok && strings.EqualFold(name, "CAPABILITY") {
+		r.handleCapability(caps)
+	}
+
 	r.client.pending.Complete(tag, &commandResult{
 		status: status,
 		code:   code,
@@ -261,6 +374,16 @@ func (r *reader) handleResponseCode(code string) {
 		r.client.storeUntagged("PERMANENTFLAGS " + arg)
 	case "CAPABILITY":
 		r.handleCapability(arg)
+	case "HIGHESTMODSEQ":
+		if n, err := strconv.ParseUint(arg, 10, 64); err == nil {
+			r.client.mu.Lock()
+			r.client.mailboxHighestModSeq = n
+			r.client.mu.Unlock()
+		}
+	case "MAILBOXID":
+		r.client.mu.Lock()
+		r.client.mailboxID = strings.Trim(arg, "()")
+		r.client.mu.Unlock()
 	case "READ-ONLY":
 		r.client.mu.Lock()
 		r.client.mailboxReadOnly = true
@@ -275,10 +398,7 @@ func (r *reader) handleResponseCode(code string) {
 }
 
 func (r *reader) handleCapability(line string) {
-	caps := strings.Fields(line)
-	r.client.mu.Lock()
-	r.client.caps = caps
-	r.client.mu.Unlock()
+	r.client.setCaps(parseCaps(line))
 }
 
 func (r *reader) handleFlags(line string) {
@@ -0,0 +1,213 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// RenameTreeResult reports the changes made by RenameTree.
+type RenameTreeResult struct {
+	// Renamed maps the old names of the mailboxes in the tree to their
+	// new names.
+	Renamed map[string]string
+	// Copied lists the old names of mailboxes that were moved with
+	// CREATE, COPY and DELETE because RENAME did not move them.
+	Copied []string
+	// Resubscribed lists the new names of mailboxes whose subscription
+	// was restored.
+	Resubscribed []string
+}
+
+// RenameTree renames a mailbox together with all of its children, for
+// example "Projects" to "Archive/Projects", and restores the subscription
+// state of every mailbox in the tree under its new name.
+//
+// The mailbox is renamed with a single RENAME, which renames inferior
+// mailboxes as well (RFC 9051 §6.3.6). Children the server did not move
+// are then renamed one by one, parents first. If RENAME fails for a
+// mailbox, it is recreated under the new name, its messages are copied
+// and the old mailbox is deleted.
+//
+// Changes made before an error is encountered are reported in the result.
+func (c *Client) RenameTree(oldName, newName string) (*RenameTreeResult, error) {
+	result := &RenameTreeResult{Renamed: make(map[string]string)}
+
+	tree, delim, err := c.listTree(oldName)
+	if err != nil {
+		return result, err
+	}
+	if len(tree) == 0 {
+		return result, fmt.Errorf("mailbox %q does not exist", oldName)
+	}
+	if delim != 0 && strings.HasPrefix(newName, oldName+string(delim)) {
+		return result, fmt.Errorf("cannot move mailbox %q into itself", oldName)
+	}
+
+	subscribed, err := c.subscribedTree(oldName, delim)
+	if err != nil {
+		return result, err
+	}
+
+	target := func(name string) string {
+		return newName + strings.TrimPrefix(name, oldName)
+	}
+
+	// Parents sort before their children.
+	names := make([]string, 0, len(tree))
+	for name := range tree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	renameErr := c.Rename(oldName, newName)
+	if renameErr == nil {
+		// The old top-level mailbox is gone, so list its former children
+		// directly.
+		remaining := make(map[string]*imap.ListData)
+		if delim != 0 {
+			children, err := c.ListMailboxes("", oldName+string(delim)+"*")
+			if err != nil {
+				return result, err
+			}
+			for _, data := range children {
+				remaining[data.Mailbox] = data
+			}
+		}
+		for _, name := range names {
+			if _, ok := remaining[name]; !ok {
+				result.Renamed[name] = target(name)
+			}
+		}
+		tree = remaining
+		names = names[:0]
+		for name := range tree {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	var copied []string
+	for _, name := range names {
+		if name != oldName || renameErr == nil {
+			if err := c.Rename(name, target(name)); err == nil {
+				result.Renamed[name] = target(name)
+				continue
+			}
+		}
+		if err := c.copyMailbox(name, target(name), tree[name]); err != nil {
+			return result, err
+		}
+		copied = append(copied, name)
+		result.Renamed[name] = target(name)
+		result.Copied = append(result.Copied, name)
+	}
+
+	// Delete copied mailboxes children first.
+	for i := len(copied) - 1; i >= 0; i-- {
+		if err := c.Delete(copied[i]); err != nil {
+			return result, err
+		}
+	}
+
+	for _, name := range subscribed {
+		renamed, ok := result.Renamed[name]
+		if !ok {
+			continue
+		}
+		if err := c.Unsubscribe(name); err != nil {
+			return result, err
+		}
+		if err := c.Subscribe(renamed); err != nil {
+			return result, err
+		}
+		result.Resubscribed = append(result.Resubscribed, renamed)
+	}
+
+	return result, nil
+}
+
+// listTree lists a mailbox and its children, keyed by name. It also
+// returns the hierarchy delimiter.
+func (c *Client) listTree(name string) (map[string]*imap.ListData, rune, error) {
+	tree := make(map[string]*imap.ListData)
+
+	top, err := c.ListMailboxes("", name)
+	if err != nil {
+		return nil, 0, err
+	}
+	var delim rune
+	for _, data := range top {
+		tree[data.Mailbox] = data
+		delim = data.Delim
+	}
+	if delim == 0 {
+		return tree, 0, nil
+	}
+
+	children, err := c.ListMailboxes("", name+string(delim)+"*")
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, data := range children {
+		tree[data.Mailbox] = data
+	}
+	return tree, delim, nil
+}
+
+// subscribedTree returns the subscribed mailboxes in the tree rooted at
+// name.
+func (c *Client) subscribedTree(name string, delim rune) ([]string, error) {
+	patterns := []string{name}
+	if delim != 0 {
+		patterns = append(patterns, name+string(delim)+"*")
+	}
+
+	var subscribed []string
+	for _, pattern := range patterns {
+		list, err := c.ListSubscribed("", pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, data := range list {
+			subscribed = append(subscribed, data.Mailbox)
+		}
+	}
+	return subscribed, nil
+}
+
+// copyMailbox creates dest and copies all messages of src into it.
+func (c *Client) copyMailbox(src, dest string, data *imap.ListData) error {
+	if err := c.Create(dest); err != nil {
+		return err
+	}
+	if data != nil && hasAttr(data.Attrs, imap.MailboxAttrNoSelect) {
+		return nil
+	}
+
+	sel, err := c.Examine(src)
+	if err != nil {
+		return err
+	}
+	if sel.NumMessages > 0 {
+		if _, err := c.Copy("1:*", dest); err != nil {
+			return err
+		}
+	}
+	if c.Supports(imap.CapUnselect) {
+		return c.Unselect()
+	}
+	// CLOSE does not expunge a mailbox opened with EXAMINE.
+	return c.CloseMailbox()
+}
+
+func hasAttr(attrs []imap.MailboxAttr, attr imap.MailboxAttr) bool {
+	for _, a := range attrs {
+		if strings.EqualFold(string(a), string(attr)) {
+			return true
+		}
+	}
+	return false
+}
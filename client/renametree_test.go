@@ -0,0 +1,144 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeTreeServer is a scripted server with a mailbox hierarchy.
+type fakeTreeServer struct {
+	mu         sync.Mutex
+	mailboxes  map[string]int // name -> number of messages
+	subscribed map[string]bool
+	rename     string // "tree", "shallow" or "fail"
+	selected   string
+}
+
+func (s *fakeTreeServer) match(pattern string) []string {
+	var names []string
+	for name := range s.mailboxes {
+		if name == pattern || strings.HasSuffix(pattern, "/*") && strings.HasPrefix(name, strings.TrimSuffix(pattern, "*")) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *fakeTreeServer) respond(w io.Writer, tag, cmd string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fields := strings.Fields(cmd)
+	ok := true
+	switch fields[0] {
+	case "LIST", "LSUB":
+		for _, name := range s.match(fields[2]) {
+			if fields[0] == "LIST" || s.subscribed[name] {
+				fmt.Fprintf(w, "* %s () \"/\" %s\r\n", fields[0], name)
+			}
+		}
+	case "RENAME":
+		from, to := fields[1], fields[2]
+		switch s.rename {
+		case "fail":
+			ok = false
+		case "shallow":
+			s.mailboxes[to] = s.mailboxes[from]
+			delete(s.mailboxes, from)
+		default:
+			for _, name := range s.match(from + "/*") {
+				s.mailboxes[to+strings.TrimPrefix(name, from)] = s.mailboxes[name]
+				delete(s.mailboxes, name)
+			}
+			s.mailboxes[to] = s.mailboxes[from]
+			delete(s.mailboxes, from)
+		}
+	case "CREATE":
+		s.mailboxes[fields[1]] = 0
+	case "DELETE":
+		delete(s.mailboxes, fields[1])
+	case "EXAMINE":
+		s.selected = fields[1]
+		fmt.Fprintf(w, "* %d EXISTS\r\n", s.mailboxes[fields[1]])
+	case "COPY":
+		s.mailboxes[fields[2]] += s.mailboxes[s.selected]
+	case "SUBSCRIBE":
+		s.subscribed[fields[1]] = true
+	case "UNSUBSCRIBE":
+		delete(s.subscribed, fields[1])
+	}
+	if ok {
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	} else {
+		fmt.Fprintf(w, "%s NO cannot\r\n", tag)
+	}
+}
+
+func newFakeTreeServer(rename string) *fakeTreeServer {
+	return &fakeTreeServer{
+		mailboxes: map[string]int{
+			"INBOX":              1,
+			"Archive":            0,
+			"Projects":           2,
+			"Projects/Alpha":     3,
+			"Projects/Alpha/Old": 4,
+			"Projects/Beta":      5,
+		},
+		subscribed: map[string]bool{"Projects": true, "Projects/Beta": true},
+		rename:     rename,
+	}
+}
+
+func TestRenameTree(t *testing.T) {
+	for _, mode := range []string{"tree", "shallow", "fail"} {
+		t.Run(mode, func(t *testing.T) {
+			srv := newFakeTreeServer(mode)
+			c := newScriptedClient(t, "* OK ready", srv.respond)
+
+			res, err := c.RenameTree("Projects", "Archive/Projects")
+			if err != nil {
+				t.Fatalf("RenameTree() error: %v", err)
+			}
+
+			want := map[string]int{
+				"INBOX":                      1,
+				"Archive":                    0,
+				"Archive/Projects":           2,
+				"Archive/Projects/Alpha":     3,
+				"Archive/Projects/Alpha/Old": 4,
+				"Archive/Projects/Beta":      5,
+			}
+			if fmt.Sprint(srv.mailboxes) != fmt.Sprint(want) {
+				t.Errorf("mailboxes = %v, want %v", srv.mailboxes, want)
+			}
+			if len(res.Renamed) != 4 {
+				t.Errorf("Renamed = %v, want 4 entries", res.Renamed)
+			}
+			if mode == "fail" && len(res.Copied) != 4 {
+				t.Errorf("Copied = %v, want all 4 mailboxes", res.Copied)
+			}
+			if mode != "fail" && len(res.Copied) != 0 {
+				t.Errorf("Copied = %v, want none", res.Copied)
+			}
+
+			wantSubs := map[string]bool{"Archive/Projects": true, "Archive/Projects/Beta": true}
+			if fmt.Sprint(srv.subscribed) != fmt.Sprint(wantSubs) {
+				t.Errorf("subscribed = %v, want %v", srv.subscribed, wantSubs)
+			}
+		})
+	}
+}
+
+func TestRenameTree_IntoItself(t *testing.T) {
+	srv := newFakeTreeServer("tree")
+	c := newScriptedClient(t, "* OK ready", srv.respond)
+
+	if _, err := c.RenameTree("Projects", "Projects/Alpha/Projects"); err == nil {
+		t.Fatal("RenameTree() into its own subtree succeeded")
+	}
+}
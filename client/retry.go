@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// ErrorClass classifies an error by whether retrying the operation may
+// succeed.
+type ErrorClass int
+
+const (
+	// ErrorClassNone is the class of a nil error.
+	ErrorClassNone ErrorClass = iota
+	// ErrorClassTransient errors may go away if the operation is retried,
+	// possibly on a new connection: network failures, timeouts, lost
+	// connections, NO responses with UNAVAILABLE or INUSE and throttling
+	// (see RetryAfterError).
+	ErrorClassTransient
+	// ErrorClassPermanent errors will happen again if the operation is
+	// retried unchanged, such as AUTHENTICATIONFAILED, NONEXISTENT or a
+	// BAD response.
+	ErrorClassPermanent
+)
+
+// String returns the name of the class.
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorClassNone:
+		return "none"
+	case ErrorClassTransient:
+		return "transient"
+	case ErrorClassPermanent:
+		return "permanent"
+	default:
+		return "unknown"
+	}
+}
+
+// transientCodes are the response codes of NO responses that are worth
+// retrying (RFC 5530).
+var transientCodes = map[imap.ResponseCode]bool{
+	imap.ResponseCodeUnavailable: true,
+	imap.ResponseCodeInUse:       true,
+}
+
+// ClassifyError reports whether an error returned by a Client is transient
+// or permanent. IMAP status responses are classified by their response
+// code: NO [UNAVAILABLE] and NO [INUSE] are transient, as is BYE, while
+// other NO and BAD responses, for example NO [AUTHENTICATIONFAILED] or
+// NO [NONEXISTENT], are permanent. Timeouts, lost connections and other
+// network errors are transient, and so is throttling, reported as a
+// RetryAfterError. Errors the classifier does not recognize are permanent.
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorClassNone
+	}
+	if _, ok := RetryAfter(err); ok {
+		return ErrorClassTransient
+	}
+
+	var imapErr *imap.IMAPError
+	if errors.As(err, &imapErr) && imapErr.StatusResponse != nil {
+		if imapErr.Type == imap.StatusResponseTypeBYE || transientCodes[imapErr.Code] {
+			return ErrorClassTransient
+		}
+		return ErrorClassPermanent
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrorClassPermanent
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, ErrClosed),
+		errors.Is(err, ErrCommandInProgress),
+		errors.Is(err, ErrProbeTimeout),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, net.ErrClosed),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNABORTED),
+		errors.Is(err, syscall.EPIPE):
+		return ErrorClassTransient
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorClassTransient
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return ErrorClassTransient
+	}
+	return ErrorClassPermanent
+}
+
+// IsTransient reports whether retrying the operation that returned err may
+// succeed. See ClassifyError.
+func IsTransient(err error) bool {
+	return ClassifyError(err) == ErrorClassTransient
+}
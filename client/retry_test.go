@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestClassifyError(t *testing.T) {
+	no := func(code imap.ResponseCode) error {
+		return &imap.IMAPError{StatusResponse: &imap.StatusResponse{
+			Type: imap.StatusResponseTypeNO,
+			Code: code,
+			Text: "failed",
+		}}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"nil", nil, ErrorClassNone},
+		{"UNAVAILABLE", no(imap.ResponseCodeUnavailable), ErrorClassTransient},
+		{"INUSE", no(imap.ResponseCodeInUse), ErrorClassTransient},
+		{"wrapped INUSE", fmt.Errorf("select: %w", no(imap.ResponseCodeInUse)), ErrorClassTransient},
+		{"BYE", &imap.IMAPError{StatusResponse: &imap.StatusResponse{Type: imap.StatusResponseTypeBYE}}, ErrorClassTransient},
+		{"AUTHENTICATIONFAILED", no(imap.ResponseCodeAuthenticationFailed), ErrorClassPermanent},
+		{"NONEXISTENT", no(imap.ResponseCodeNonExistent), ErrorClassPermanent},
+		{"NO without code", no(""), ErrorClassPermanent},
+		{"throttled", &RetryAfterError{After: time.Second, Err: no(ResponseCodeThrottled)}, ErrorClassTransient},
+		{"BAD", imap.ErrBad("syntax error"), ErrorClassPermanent},
+		{"connection closed", fmt.Errorf("%w: %w", ErrClosed, io.ErrUnexpectedEOF), ErrorClassTransient},
+		{"command in progress", ErrCommandInProgress, ErrorClassTransient},
+		{"deadline", context.DeadlineExceeded, ErrorClassTransient},
+		{"canceled", context.Canceled, ErrorClassPermanent},
+		{"timeout", &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, ErrorClassTransient},
+		{"connection reset", &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, ErrorClassTransient},
+		{"dial", fmt.Errorf("dial: %w", &net.OpError{Op: "dial", Err: errors.New("no route to host")}), ErrorClassTransient},
+		{"other", errors.New("something else"), ErrorClassPermanent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyError(tt.err); got != tt.want {
+				t.Errorf("ClassifyError() = %v, want %v", got, tt.want)
+			}
+			if got := IsTransient(tt.err); got != (tt.want == ErrorClassTransient) {
+				t.Errorf("IsTransient() = %v", got)
+			}
+		})
+	}
+}
+
+func TestClassifyError_FromServer(t *testing.T) {
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		fmt.Fprintf(w, "%s NO [UNAVAILABLE] backend down\r\n", tag)
+	})
+
+	err := c.Noop()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !IsTransient(err) {
+		t.Errorf("IsTransient(%v) = false, want true", err)
+	}
+}
@@ -0,0 +1,506 @@
+// Package search builds IMAP search criteria.
+//
+// Criteria are built from constructors for each search key and combined
+// with And, Or and Not, so that nested OR and NOT programs do not have to
+// be written by hand:
+//
+//	q := search.Unseen().And(search.From("x@example.org")).
+//		Or(search.Subject("report")).
+//		Since(time.Now().AddDate(0, 0, -7))
+//	uids, err := c.UIDSearch(q.String())
+//
+// Criteria are immutable: the methods return new criteria and never change
+// the ones they are called on, so a criteria value can be shared and
+// extended safely.
+package search
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// dateLayout is the layout of dates in search keys.
+const dateLayout = "2-Jan-2006"
+
+// Criteria is a search program: a set of search keys that must all match.
+// The zero value matches all messages.
+type Criteria struct {
+	c imap.SearchCriteria
+}
+
+// FromCriteria returns criteria matching the same messages as c, which
+// is copied.
+func FromCriteria(c *imap.SearchCriteria) Criteria {
+	return Criteria{c: clone(c)}
+}
+
+// Criteria returns a copy of the criteria as an imap.SearchCriteria.
+func (q Criteria) Criteria() *imap.SearchCriteria {
+	c := clone(&q.c)
+	return &c
+}
+
+// All matches all messages.
+func All() Criteria { return Criteria{} }
+
+// Seen matches messages with the \Seen flag.
+func Seen() Criteria { return Flag(imap.FlagSeen) }
+
+// Unseen matches messages without the \Seen flag.
+func Unseen() Criteria { return NotFlag(imap.FlagSeen) }
+
+// Answered matches messages with the \Answered flag.
+func Answered() Criteria { return Flag(imap.FlagAnswered) }
+
+// Unanswered matches messages without the \Answered flag.
+func Unanswered() Criteria { return NotFlag(imap.FlagAnswered) }
+
+// Flagged matches messages with the \Flagged flag.
+func Flagged() Criteria { return Flag(imap.FlagFlagged) }
+
+// Unflagged matches messages without the \Flagged flag.
+func Unflagged() Criteria { return NotFlag(imap.FlagFlagged) }
+
+// Deleted matches messages with the \Deleted flag.
+func Deleted() Criteria { return Flag(imap.FlagDeleted) }
+
+// Undeleted matches messages without the \Deleted flag.
+func Undeleted() Criteria { return NotFlag(imap.FlagDeleted) }
+
+// Draft matches messages with the \Draft flag.
+func Draft() Criteria { return Flag(imap.FlagDraft) }
+
+// Undraft matches messages without the \Draft flag.
+func Undraft() Criteria { return NotFlag(imap.FlagDraft) }
+
+// Flag matches messages with the flag, a system flag or a keyword.
+func Flag(flag imap.Flag) Criteria {
+	return Criteria{c: imap.SearchCriteria{Flag: []imap.Flag{flag}}}
+}
+
+// NotFlag matches messages without the flag, a system flag or a keyword.
+func NotFlag(flag imap.Flag) Criteria {
+	return Criteria{c: imap.SearchCriteria{NotFlag: []imap.Flag{flag}}}
+}
+
+// From matches messages whose From header contains s.
+func From(s string) Criteria { return Header("From", s) }
+
+// To matches messages whose To header contains s.
+func To(s string) Criteria { return Header("To", s) }
+
+// Cc matches messages whose Cc header contains s.
+func Cc(s string) Criteria { return Header("Cc", s) }
+
+// Bcc matches messages whose Bcc header contains s.
+func Bcc(s string) Criteria { return Header("Bcc", s) }
+
+// Subject matches messages whose Subject header contains s.
+func Subject(s string) Criteria { return Header("Subject", s) }
+
+// Header matches messages with a header field named name that contains
+// value. An empty value matches all messages with the field.
+func Header(name, value string) Criteria {
+	return Criteria{c: imap.SearchCriteria{
+		Header: []imap.SearchCriteriaHeaderField{{Key: name, Value: value}},
+	}}
+}
+
+// Body matches messages whose body contains s.
+func Body(s string) Criteria {
+	return Criteria{c: imap.SearchCriteria{Body: []string{s}}}
+}
+
+// Text matches messages whose header or body contains s.
+func Text(s string) Criteria {
+	return Criteria{c: imap.SearchCriteria{Text: []string{s}}}
+}
+
+// Since matches messages received on or after the date of t. Only the
+// date is used, in the location of t.
+func Since(t time.Time) Criteria {
+	return Criteria{c: imap.SearchCriteria{Since: t}}
+}
+
+// Before matches messages received before the date of t.
+func Before(t time.Time) Criteria {
+	return Criteria{c: imap.SearchCriteria{Before: t}}
+}
+
+// On matches messages received on the date of t.
+func On(t time.Time) Criteria {
+	return Criteria{c: imap.SearchCriteria{On: t}}
+}
+
+// SentSince matches messages whose Date header is on or after the date
+// of t.
+func SentSince(t time.Time) Criteria {
+	return Criteria{c: imap.SearchCriteria{SentSince: t}}
+}
+
+// SentBefore matches messages whose Date header is before the date of t.
+func SentBefore(t time.Time) Criteria {
+	return Criteria{c: imap.SearchCriteria{SentBefore: t}}
+}
+
+// SentOn matches messages whose Date header is on the date of t.
+func SentOn(t time.Time) Criteria {
+	return Criteria{c: imap.SearchCriteria{SentOn: t}}
+}
+
+// Younger matches messages received less than d ago (WITHIN, RFC 5032).
+// d is rounded down to seconds.
+func Younger(d time.Duration) Criteria {
+	return Criteria{c: imap.SearchCriteria{Younger: int64(d / time.Second)}}
+}
+
+// Older matches messages received more than d ago (WITHIN, RFC 5032).
+func Older(d time.Duration) Criteria {
+	return Criteria{c: imap.SearchCriteria{Older: int64(d / time.Second)}}
+}
+
+// Larger matches messages larger than n bytes.
+func Larger(n int64) Criteria {
+	return Criteria{c: imap.SearchCriteria{Larger: n}}
+}
+
+// Smaller matches messages smaller than n bytes.
+func Smaller(n int64) Criteria {
+	return Criteria{c: imap.SearchCriteria{Smaller: n}}
+}
+
+// UIDs matches the messages with the UIDs in set.
+func UIDs(set *imap.UIDSet) Criteria {
+	return Criteria{c: imap.SearchCriteria{UID: cloneUIDSet(set)}}
+}
+
+// SeqNums matches the messages with the sequence numbers in set.
+func SeqNums(set *imap.SeqSet) Criteria {
+	return Criteria{c: imap.SearchCriteria{SeqNum: cloneSeqSet(set)}}
+}
+
+// ModSeq matches messages whose mod-sequence is modSeq or higher
+// (CONDSTORE, RFC 7162).
+func ModSeq(modSeq uint64) Criteria {
+	return Criteria{c: imap.SearchCriteria{ModSeq: &imap.SearchCriteriaModSeq{ModSeq: modSeq}}}
+}
+
+// Not matches the messages q does not match.
+func Not(q Criteria) Criteria {
+	return Criteria{c: imap.SearchCriteria{Not: []imap.SearchCriteria{clone(&q.c)}}}
+}
+
+// Or matches the messages that a or b matches.
+func Or(a, b Criteria) Criteria {
+	return Criteria{c: imap.SearchCriteria{
+		Or: [][2]imap.SearchCriteria{{clone(&a.c), clone(&b.c)}},
+	}}
+}
+
+// Any matches the messages that any of qs matches. Without criteria, it
+// matches no message.
+func Any(qs ...Criteria) Criteria {
+	switch len(qs) {
+	case 0:
+		return Not(All())
+	case 1:
+		return qs[0]
+	}
+	return Or(qs[0], Any(qs[1:]...))
+}
+
+// And returns criteria matching the messages that q and all of others
+// match.
+func (q Criteria) And(others ...Criteria) Criteria {
+	c := clone(&q.c)
+	for _, other := range others {
+		o := clone(&other.c)
+		if o.Fuzzy != c.Fuzzy {
+			// Fuzziness applies to a whole program, so a program that
+			// differs is kept apart.
+			c.Not = append(c.Not, imap.SearchCriteria{Not: []imap.SearchCriteria{o}})
+			continue
+		}
+		c.And(&o)
+	}
+	return Criteria{c: c}
+}
+
+// Or returns criteria matching the messages that q or other matches.
+func (q Criteria) Or(other Criteria) Criteria {
+	return Or(q, other)
+}
+
+// AndNot returns criteria matching the messages that q matches and other
+// does not.
+func (q Criteria) AndNot(other Criteria) Criteria {
+	return q.And(Not(other))
+}
+
+// Since is short for q.And(Since(t)).
+func (q Criteria) Since(t time.Time) Criteria { return q.And(Since(t)) }
+
+// Before is short for q.And(Before(t)).
+func (q Criteria) Before(t time.Time) Criteria { return q.And(Before(t)) }
+
+// Larger is short for q.And(Larger(n)).
+func (q Criteria) Larger(n int64) Criteria { return q.And(Larger(n)) }
+
+// Smaller is short for q.And(Smaller(n)).
+func (q Criteria) Smaller(n int64) Criteria { return q.And(Smaller(n)) }
+
+// Fuzzy returns the criteria with fuzzy matching of its keys (SEARCH=FUZZY,
+// RFC 6203).
+func (q Criteria) Fuzzy() Criteria {
+	c := clone(&q.c)
+	c.Fuzzy = true
+	return Criteria{c: c}
+}
+
+// String returns the criteria as the arguments of a SEARCH command, such
+// as
+//
+//	OR (UNSEEN FROM "x@example.org") SUBJECT "report"
+//
+// preceded by CHARSET UTF-8 if a string contains non-ASCII characters.
+// It can be passed to Client.Search, Client.UIDSearch and the other
+// methods that take search criteria as a string.
+func (q Criteria) String() string {
+	return Encode(&q.c)
+}
+
+// Keys is like String, but never adds a CHARSET specification, for
+// commands that take the charset as a separate argument, such as SORT.
+func (q Criteria) Keys() string {
+	return strings.Join(keys(&q.c), " ")
+}
+
+// Encode returns c as the arguments of a SEARCH command, like
+// Criteria.String. SaveResult is not encoded: it is requested with
+// RETURN (SAVE).
+func Encode(c *imap.SearchCriteria) string {
+	s := strings.Join(keys(c), " ")
+	if hasNonASCII(c) {
+		s = "CHARSET UTF-8 " + s
+	}
+	return s
+}
+
+// keys returns the search keys of c. Empty criteria are ALL.
+func keys(c *imap.SearchCriteria) []string {
+	var ks []string
+	add := func(k ...string) { ks = append(ks, strings.Join(k, " ")) }
+
+	if c.SeqNum != nil {
+		add(c.SeqNum.String())
+	}
+	if c.UID != nil {
+		add("UID", c.UID.String())
+	}
+	for _, f := range c.Flag {
+		if k, ok := flagKeys[strings.ToLower(string(f))]; ok {
+			add(k[0])
+		} else {
+			add("KEYWORD", string(f))
+		}
+	}
+	for _, f := range c.NotFlag {
+		if k, ok := flagKeys[strings.ToLower(string(f))]; ok {
+			add(k[1])
+		} else {
+			add("UNKEYWORD", string(f))
+		}
+	}
+	for _, d := range []struct {
+		key string
+		t   time.Time
+	}{
+		{"SINCE", c.Since}, {"BEFORE", c.Before}, {"ON", c.On},
+		{"SENTSINCE", c.SentSince}, {"SENTBEFORE", c.SentBefore}, {"SENTON", c.SentOn},
+		{"SAVEDSINCE", c.SavedSince}, {"SAVEDBEFORE", c.SavedBefore}, {"SAVEDON", c.SavedOn},
+	} {
+		if !d.t.IsZero() {
+			add(d.key, d.t.Format(dateLayout))
+		}
+	}
+	for _, h := range c.Header {
+		if k, ok := headerKeys[strings.ToLower(h.Key)]; ok {
+			add(k, quote(h.Value))
+		} else {
+			add("HEADER", quote(h.Key), quote(h.Value))
+		}
+	}
+	for _, s := range c.Body {
+		add("BODY", quote(s))
+	}
+	for _, s := range c.Text {
+		add("TEXT", quote(s))
+	}
+	if c.Larger > 0 {
+		add("LARGER", strconv.FormatInt(c.Larger, 10))
+	}
+	if c.Smaller > 0 {
+		add("SMALLER", strconv.FormatInt(c.Smaller, 10))
+	}
+	if c.Younger > 0 {
+		add("YOUNGER", strconv.FormatInt(c.Younger, 10))
+	}
+	if c.Older > 0 {
+		add("OLDER", strconv.FormatInt(c.Older, 10))
+	}
+	if m := c.ModSeq; m != nil {
+		if m.MetadataName != "" {
+			add("MODSEQ", quote(m.MetadataName), m.MetadataType, strconv.FormatUint(m.ModSeq, 10))
+		} else {
+			add("MODSEQ", strconv.FormatUint(m.ModSeq, 10))
+		}
+	}
+	for i := range c.Not {
+		add("NOT", group(&c.Not[i]))
+	}
+	for i := range c.Or {
+		add("OR", group(&c.Or[i][0]), group(&c.Or[i][1]))
+	}
+
+	if len(ks) == 0 {
+		ks = []string{"ALL"}
+	}
+	if c.Fuzzy {
+		ks = []string{"FUZZY " + parenthesize(ks)}
+	}
+	return ks
+}
+
+// group returns c as a single search key, parenthesizing its keys if it
+// has several.
+func group(c *imap.SearchCriteria) string {
+	return parenthesize(keys(c))
+}
+
+func parenthesize(ks []string) string {
+	if len(ks) == 1 {
+		return ks[0]
+	}
+	return "(" + strings.Join(ks, " ") + ")"
+}
+
+// flagKeys maps lower-case system flags to the search keys matching
+// messages with and without them.
+var flagKeys = map[string][2]string{
+	`\seen`:     {"SEEN", "UNSEEN"},
+	`\answered`: {"ANSWERED", "UNANSWERED"},
+	`\flagged`:  {"FLAGGED", "UNFLAGGED"},
+	`\deleted`:  {"DELETED", "UNDELETED"},
+	`\draft`:    {"DRAFT", "UNDRAFT"},
+	`\recent`:   {"RECENT", "OLD"},
+}
+
+// headerKeys maps lower-case header field names to their search keys.
+var headerKeys = map[string]string{
+	"from":    "FROM",
+	"to":      "TO",
+	"cc":      "CC",
+	"bcc":     "BCC",
+	"subject": "SUBJECT",
+}
+
+// quote returns s as a quoted string. CR and LF cannot be quoted and are
+// replaced with spaces.
+func quote(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; ch {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case '\r', '\n':
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// hasNonASCII reports whether a string of c contains non-ASCII
+// characters.
+func hasNonASCII(c *imap.SearchCriteria) bool {
+	for _, h := range c.Header {
+		if !isASCII(h.Key) || !isASCII(h.Value) {
+			return true
+		}
+	}
+	for _, ss := range [][]string{c.Body, c.Text} {
+		for _, s := range ss {
+			if !isASCII(s) {
+				return true
+			}
+		}
+	}
+	for i := range c.Not {
+		if hasNonASCII(&c.Not[i]) {
+			return true
+		}
+	}
+	for i := range c.Or {
+		if hasNonASCII(&c.Or[i][0]) || hasNonASCII(&c.Or[i][1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// clone returns a deep copy of c, so that criteria built from it do not
+// share slices with it.
+func clone(c *imap.SearchCriteria) imap.SearchCriteria {
+	out := *c
+	out.SeqNum = cloneSeqSet(c.SeqNum)
+	out.UID = cloneUIDSet(c.UID)
+	if c.ModSeq != nil {
+		m := *c.ModSeq
+		out.ModSeq = &m
+	}
+	out.Header = append([]imap.SearchCriteriaHeaderField(nil), c.Header...)
+	out.Body = append([]string(nil), c.Body...)
+	out.Text = append([]string(nil), c.Text...)
+	out.Flag = append([]imap.Flag(nil), c.Flag...)
+	out.NotFlag = append([]imap.Flag(nil), c.NotFlag...)
+	out.Not = nil
+	for i := range c.Not {
+		out.Not = append(out.Not, clone(&c.Not[i]))
+	}
+	out.Or = nil
+	for i := range c.Or {
+		out.Or = append(out.Or, [2]imap.SearchCriteria{clone(&c.Or[i][0]), clone(&c.Or[i][1])})
+	}
+	return out
+}
+
+func cloneSeqSet(s *imap.SeqSet) *imap.SeqSet {
+	if s == nil {
+		return nil
+	}
+	return &imap.SeqSet{Set: append([]imap.NumRange(nil), s.Set...)}
+}
+
+func cloneUIDSet(s *imap.UIDSet) *imap.UIDSet {
+	if s == nil {
+		return nil
+	}
+	return &imap.UIDSet{Set: append([]imap.NumRange(nil), s.Set...)}
+}
@@ -0,0 +1,120 @@
+package search_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client/search"
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/wire"
+)
+
+func TestCriteriaString(t *testing.T) {
+	since := time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC)
+	uids, _ := imap.ParseUIDSet("1:100")
+
+	tests := []struct {
+		name string
+		q    search.Criteria
+		want string
+	}{
+		{"all", search.All(), "ALL"},
+		{"flags", search.Unseen().And(search.Flagged(), search.Flag("$Work")),
+			"FLAGGED KEYWORD $Work UNSEEN"},
+		{"chain", search.Unseen().And(search.From("x@y")).Or(search.Subject("z")).Since(since),
+			`SINCE 5-Mar-2024 OR (UNSEEN FROM "x@y") SUBJECT "z"`},
+		{"not", search.Not(search.Or(search.Seen(), search.Deleted())),
+			"NOT OR SEEN DELETED"},
+		{"and not", search.UIDs(uids).AndNot(search.Header("X-Spam", "yes")),
+			`UID 1:100 NOT HEADER "X-Spam" "yes"`},
+		{"any", search.Any(search.To("a"), search.Cc("b"), search.Bcc("c")),
+			`OR TO "a" OR CC "b" BCC "c"`},
+		{"quoting", search.Text("say \"hi\"\r\n\\"), `TEXT "say \"hi\"  \\"`},
+		{"charset", search.Body("naïve"), `CHARSET UTF-8 BODY "naïve"`},
+		{"sizes", search.Larger(10).Smaller(1000).And(search.Younger(time.Hour)),
+			"LARGER 10 SMALLER 1000 YOUNGER 3600"},
+		{"fuzzy", search.Unseen().And(search.Text("meeting").Fuzzy()),
+			`UNSEEN NOT NOT FUZZY TEXT "meeting"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.q.String(); got != tt.want {
+				t.Errorf("String() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCriteriaImmutable(t *testing.T) {
+	base := search.Unseen()
+	a := base.And(search.From("a"))
+	b := base.And(search.From("b"))
+	if got := base.String(); got != "UNSEEN" {
+		t.Errorf("base = %s", got)
+	}
+	if got := a.String(); got != `UNSEEN FROM "a"` {
+		t.Errorf("a = %s", got)
+	}
+	if got := b.String(); got != `UNSEEN FROM "b"` {
+		t.Errorf("b = %s", got)
+	}
+
+	c := a.Criteria()
+	c.Header[0].Value = "changed"
+	if got := a.String(); got != `UNSEEN FROM "a"` {
+		t.Errorf("a after changing its Criteria = %s", got)
+	}
+}
+
+func TestCriteriaRoundTrip(t *testing.T) {
+	day := time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)
+	qs := []search.Criteria{
+		search.Unseen().And(search.From("x@y")).Or(search.Subject("z")).Since(day),
+		search.Not(search.Any(search.Answered(), search.Draft(), search.NotFlag("$Junk"))),
+		search.Header("List-Id", "go").And(search.SentBefore(day), search.ModSeq(42)),
+		search.Body(`a "quoted" \ string`).Before(day),
+	}
+	for _, q := range qs {
+		got, err := server.ParseSearch(wire.NewDecoder(strings.NewReader(q.String())))
+		if err != nil {
+			t.Fatalf("ParseSearch(%s): %v", q, err)
+		}
+		if want := q.Criteria(); !reflect.DeepEqual(normalize(got), normalize(want)) {
+			t.Errorf("ParseSearch(%s) = %+v, want %+v", q, got, want)
+		}
+	}
+}
+
+// normalize makes the criteria comparable with reflect.DeepEqual: empty
+// slices are nil and header names are canonical.
+func normalize(c *imap.SearchCriteria) *imap.SearchCriteria {
+	out := *c
+	out.Header = nil
+	for _, h := range c.Header {
+		h.Key = strings.ToLower(h.Key)
+		out.Header = append(out.Header, h)
+	}
+	out.Not, out.Or = nil, nil
+	for i := range c.Not {
+		out.Not = append(out.Not, *normalize(&c.Not[i]))
+	}
+	for i := range c.Or {
+		out.Or = append(out.Or, [2]imap.SearchCriteria{*normalize(&c.Or[i][0]), *normalize(&c.Or[i][1])})
+	}
+	if len(c.Flag) == 0 {
+		out.Flag = nil
+	}
+	if len(c.NotFlag) == 0 {
+		out.NotFlag = nil
+	}
+	if len(c.Body) == 0 {
+		out.Body = nil
+	}
+	if len(c.Text) == 0 {
+		out.Text = nil
+	}
+	return &out
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// searchCharsetFallback returns the criteria to retry a search with after
+// the server answered code to criteria in UTF-8, and false if the search
+// should not be retried. The criteria are transcoded to the first charset
+// of a BADCHARSET (charsets) code that can represent them, or else reduced
+// to US-ASCII.
+func (c *Client) searchCharsetFallback(criteria, code string) (string, bool) {
+	name, list, _ := strings.Cut(code, " ")
+	if !strings.EqualFold(name, "BADCHARSET") {
+		return "", false
+	}
+	charset, keys, ok := cutCharset(criteria)
+	if !ok || !isUTF8Charset(charset) {
+		return "", false
+	}
+
+	for _, cs := range strings.Fields(strings.Trim(list, "()")) {
+		cs = strings.Trim(cs, `"`)
+		if isUTF8Charset(cs) {
+			continue
+		}
+		if enc, err := imap.EncodeCharset(cs, keys); err == nil {
+			c.options.Logger.Debug("retrying search in another charset", "charset", cs)
+			return "CHARSET " + cs + " " + string(enc), true
+		}
+	}
+
+	ascii := asciiCriteria(keys)
+	c.options.Logger.Warn("server does not support the charset of the search criteria, searching without non-ASCII characters",
+		"criteria", keys, "ascii", ascii)
+	return ascii, true
+}
+
+// cutCharset splits criteria starting with a CHARSET specification into
+// the charset and the search keys.
+func cutCharset(criteria string) (charset, keys string, ok bool) {
+	word, rest, _ := strings.Cut(criteria, " ")
+	if !strings.EqualFold(word, "CHARSET") {
+		return "", "", false
+	}
+	charset, keys, ok = strings.Cut(rest, " ")
+	return strings.Trim(charset, `"`), keys, ok
+}
+
+func isUTF8Charset(charset string) bool {
+	return strings.EqualFold(charset, "UTF-8") || strings.EqualFold(charset, "UTF8")
+}
+
+// asciiCriteria returns search keys without non-ASCII characters. Each
+// quoted string is replaced with its longest run of ASCII characters, which
+// is a substring of it, so that
+//
+//	SUBJECT "naïve café"
+//
+// becomes SUBJECT "ve caf".
+func asciiCriteria(keys string) string {
+	var b strings.Builder
+	b.Grow(len(keys))
+	for i := 0; i < len(keys); i++ {
+		ch := keys[i]
+		if ch != '"' {
+			if ch < utf8.RuneSelf {
+				b.WriteByte(ch)
+			}
+			continue
+		}
+
+		// Find the end of the quoted string and its longest ASCII run
+		var best, run string
+		start := i + 1
+		j := start
+		for ; j < len(keys) && keys[j] != '"'; j++ {
+			if keys[j] >= utf8.RuneSelf {
+				start = j + 1
+				continue
+			}
+			if keys[j] == '\\' && j+1 < len(keys) {
+				j++
+			}
+			if run = keys[start : j+1]; len(run) > len(best) {
+				best = run
+			}
+		}
+		b.WriteByte('"')
+		b.WriteString(best)
+		b.WriteByte('"')
+		i = j
+	}
+	return b.String()
+}
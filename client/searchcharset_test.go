@@ -0,0 +1,84 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// badCharsetClient returns a client whose server rejects CHARSET UTF-8
+// with code and records the SEARCH commands.
+func badCharsetClient(t *testing.T, code string) (*Client, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var cmds []string
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		mu.Lock()
+		defer mu.Unlock()
+		cmds = append(cmds, cmd)
+		if strings.Contains(cmd, "CHARSET UTF-8") {
+			fmt.Fprintf(w, "%s NO [%s] unsupported charset\r\n", tag, code)
+			return
+		}
+		fmt.Fprintf(w, "* SEARCH 2 3\r\n%s OK done\r\n", tag)
+	})
+	return c, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return cmds
+	}
+}
+
+func TestSearch_BadCharsetTranscode(t *testing.T) {
+	c, cmds := badCharsetClient(t, "BADCHARSET (US-ASCII ISO-8859-1)")
+	got, err := c.UIDSearch(`CHARSET UTF-8 SUBJECT "café"`)
+	if err != nil {
+		t.Fatalf("UIDSearch() error: %v", err)
+	}
+	if fmt.Sprint(got) != "[2 3]" {
+		t.Errorf("UIDSearch() = %v", got)
+	}
+	want := []string{`UID SEARCH CHARSET UTF-8 SUBJECT "café"`, "UID SEARCH CHARSET ISO-8859-1 SUBJECT \"caf\xe9\""}
+	if strings.Join(cmds(), "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands = %q, want %q", cmds(), want)
+	}
+}
+
+func TestSearch_BadCharsetASCII(t *testing.T) {
+	// Neither charset can represent Polish characters
+	c, cmds := badCharsetClient(t, "BADCHARSET (US-ASCII ISO-8859-1)")
+	if _, err := c.Search(`CHARSET UTF-8 FROM "Łukasz" SUBJECT "zażółć gęślą"`); err != nil {
+		t.Fatalf("Search() error: %v", err)
+	}
+	want := []string{`SEARCH CHARSET UTF-8 FROM "Łukasz" SUBJECT "zażółć gęślą"`, `SEARCH FROM "ukasz" SUBJECT "za"`}
+	if strings.Join(cmds(), "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands = %q, want %q", cmds(), want)
+	}
+}
+
+func TestSearch_BadCharsetOther(t *testing.T) {
+	// Other failures are not retried
+	c, cmds := badCharsetClient(t, "CANNOT")
+	if _, err := c.Search(`CHARSET UTF-8 SUBJECT "café"`); err == nil {
+		t.Fatal("Search() error = nil")
+	}
+	if len(cmds()) != 1 {
+		t.Errorf("commands = %q, want one", cmds())
+	}
+}
+
+func TestASCIICriteria(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{`SUBJECT "naïve café"`, `SUBJECT "ve caf"`},
+		{`OR FROM "a\"é" TO "plain"`, `OR FROM "a\"" TO "plain"`},
+		{`SUBJECT "日本"`, `SUBJECT ""`},
+		{`UNSEEN`, `UNSEEN`},
+	}
+	for _, tt := range tests {
+		if got := asciiCriteria(tt.in); got != tt.want {
+			t.Errorf("asciiCriteria(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// DefaultSearchPageSize is the page size used by UIDSearchPages when the
+// given size is 0.
+const DefaultSearchPageSize = 1000
+
+// SearchIterator walks the results of a UID SEARCH in pages. Use it like
+// bufio.Scanner:
+//
+//	it := c.UIDSearchPages("UNSEEN", 500)
+//	for it.Next() {
+//		process(it.Page())
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type SearchIterator struct {
+	c        *Client
+	criteria string
+	pageSize uint32
+
+	// partial is true if pages are fetched with RETURN (PARTIAL).
+	partial bool
+	offset  uint32
+
+	// all holds the full result when PARTIAL is not supported.
+	all     []uint32
+	fetched bool
+
+	page []imap.UID
+	done bool
+	err  error
+}
+
+// UIDSearchPages returns an iterator over the UIDs matching criteria,
+// pageSize UIDs at a time. If the server supports PARTIAL (RFC 9394), each
+// page is requested with UID SEARCH RETURN (PARTIAL first:last) so that the
+// full result never has to be held in memory. Otherwise a single UID SEARCH
+// is issued and its result is returned in pages.
+func (c *Client) UIDSearchPages(criteria string, pageSize uint32) *SearchIterator {
+	if pageSize == 0 {
+		pageSize = DefaultSearchPageSize
+	}
+	return &SearchIterator{
+		c:        c,
+		criteria: criteria,
+		pageSize: pageSize,
+		partial:  c.HasCap(string(imap.CapPartial)),
+		offset:   1,
+	}
+}
+
+// Next fetches the next page. It returns false when there are no more
+// results or an error occurred.
+func (it *SearchIterator) Next() bool {
+	if it.done {
+		return false
+	}
+	if it.partial {
+		it.page, it.err = it.c.uidSearchPartial(it.criteria, it.offset, it.offset+it.pageSize-1)
+		if it.err != nil || uint32(len(it.page)) < it.pageSize {
+			it.done = true
+		}
+		it.offset += it.pageSize
+		return it.err == nil && len(it.page) > 0
+	}
+
+	if !it.fetched {
+		it.fetched = true
+		it.all, it.err = it.c.UIDSearch(it.criteria)
+		if it.err != nil {
+			it.done = true
+			return false
+		}
+	}
+	if len(it.all) == 0 {
+		it.done = true
+		return false
+	}
+	n := len(it.all)
+	if n > int(it.pageSize) {
+		n = int(it.pageSize)
+	}
+	it.page = make([]imap.UID, n)
+	for i, uid := range it.all[:n] {
+		it.page[i] = imap.UID(uid)
+	}
+	it.all = it.all[n:]
+	return true
+}
+
+// Page returns the UIDs of the current page.
+func (it *SearchIterator) Page() []imap.UID {
+	return it.page
+}
+
+// Err returns the first error encountered by Next.
+func (it *SearchIterator) Err() error {
+	return it.err
+}
+
+// uidSearchPartial issues UID SEARCH RETURN (PARTIAL first:last) and
+// returns the UIDs in that window of the result.
+func (c *Client) uidSearchPartial(criteria string, first, last uint32) ([]imap.UID, error) {
+	c.collectUntagged()
+
+	result, err := c.execute("UID SEARCH", fmt.Sprintf("RETURN (PARTIAL %d:%d)", first, last), criteria)
+	if err != nil {
+		return nil, err
+	}
+	if err := commandResultError(result); err != nil {
+		return nil, err
+	}
+
+	for _, line := range c.collectUntagged() {
+		if !strings.HasPrefix(line, "ESEARCH ") {
+			continue
+		}
+		if uids, ok := parsePartialUIDs(line[8:]); ok {
+			return uids, nil
+		}
+	}
+	return nil, nil
+}
+
+// parsePartialUIDs extracts the UIDs from the PARTIAL return data of an
+// ESEARCH response, e.g. `(TAG "A1") UID PARTIAL (1:100 4,8:10)`.
+func parsePartialUIDs(s string) ([]imap.UID, bool) {
+	i := strings.Index(strings.ToUpper(s), "PARTIAL (")
+	if i < 0 {
+		return nil, false
+	}
+	rest := s[i+len("PARTIAL ("):]
+	end := strings.IndexByte(rest, ')')
+	if end < 0 {
+		return nil, false
+	}
+	fields := strings.Fields(rest[:end])
+	if len(fields) != 2 || strings.EqualFold(fields[1], "NIL") {
+		return nil, true
+	}
+	set, err := imap.ParseUIDSet(fields[1])
+	if err != nil {
+		return nil, false
+	}
+	var uids []imap.UID
+	for _, r := range set.Ranges() {
+		start, stop := r.Start, r.Stop
+		if stop == 0 {
+			return nil, false
+		}
+		if start > stop {
+			start, stop = stop, start
+		}
+		for n := start; ; n++ {
+			uids = append(uids, imap.UID(n))
+			if n == stop {
+				break
+			}
+		}
+	}
+	return uids, true
+}
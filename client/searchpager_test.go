@@ -0,0 +1,105 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestUIDSearchPagesPartial(t *testing.T) {
+	var got []string
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev2 PARTIAL] ready", func(w io.Writer, tag, cmd string) {
+		got = append(got, cmd)
+		switch {
+		case strings.Contains(cmd, "PARTIAL 1:3"):
+			fmt.Fprintf(w, "* ESEARCH (TAG \"%s\") UID PARTIAL (1:3 10:12)\r\n", tag)
+		case strings.Contains(cmd, "PARTIAL 4:6"):
+			fmt.Fprintf(w, "* ESEARCH (TAG \"%s\") UID PARTIAL (4:6 20)\r\n", tag)
+		}
+		fmt.Fprintf(w, "%s OK SEARCH completed\r\n", tag)
+	})
+
+	var pages [][]imap.UID
+	it := c.UIDSearchPages("UNSEEN", 3)
+	for it.Next() {
+		pages = append(pages, it.Page())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+
+	want := [][]imap.UID{{10, 11, 12}, {20}}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("pages = %v, want %v", pages, want)
+	}
+	wantCmds := []string{
+		"UID SEARCH RETURN (PARTIAL 1:3) UNSEEN",
+		"UID SEARCH RETURN (PARTIAL 4:6) UNSEEN",
+	}
+	if !reflect.DeepEqual(got, wantCmds) {
+		t.Errorf("commands = %q, want %q", got, wantCmds)
+	}
+}
+
+func TestUIDSearchPagesFallback(t *testing.T) {
+	var got []string
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1] ready", func(w io.Writer, tag, cmd string) {
+		got = append(got, cmd)
+		fmt.Fprint(w, "* SEARCH 2 4 6 8 10\r\n")
+		fmt.Fprintf(w, "%s OK SEARCH completed\r\n", tag)
+	})
+
+	var pages [][]imap.UID
+	it := c.UIDSearchPages("ALL", 2)
+	for it.Next() {
+		pages = append(pages, it.Page())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+
+	want := [][]imap.UID{{2, 4}, {6, 8}, {10}}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("pages = %v, want %v", pages, want)
+	}
+	if len(got) != 1 || got[0] != "UID SEARCH ALL" {
+		t.Errorf("commands = %q, want a single UID SEARCH", got)
+	}
+}
+
+func TestUIDSearchPagesError(t *testing.T) {
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev2 PARTIAL] ready", func(w io.Writer, tag, cmd string) {
+		fmt.Fprintf(w, "%s NO search failed\r\n", tag)
+	})
+
+	it := c.UIDSearchPages("ALL", 10)
+	if it.Next() {
+		t.Fatal("Next() = true, want false")
+	}
+	if it.Err() == nil {
+		t.Fatal("Err() = nil, want error")
+	}
+}
+
+func TestParsePartialUIDs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []imap.UID
+		ok   bool
+	}{
+		{`(TAG "A1") UID PARTIAL (1:5 3,7:9)`, []imap.UID{3, 7, 8, 9}, true},
+		{`(TAG "A1") UID PARTIAL (-1:-5 9:7)`, []imap.UID{7, 8, 9}, true},
+		{`(TAG "A1") UID PARTIAL (1:5 NIL)`, nil, true},
+		{`(TAG "A1") UID COUNT 5`, nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := parsePartialUIDs(tt.in)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePartialUIDs(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
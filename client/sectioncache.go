@@ -0,0 +1,259 @@
+package client
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// DefaultSectionCacheTTL is how long UIDFetchSection keeps a body section
+// when Options.SectionCacheTTL is not set.
+const DefaultSectionCacheTTL = 30 * time.Second
+
+// UIDFetchSection fetches a body section of a message with BODY.PEEK, so
+// the \Seen flag is not set. section is a section specifier such as
+// "HEADER", "TEXT", "1.2" or "", the whole message.
+//
+// With Options.SectionCacheSize set, fetched sections are kept for a short
+// time, so that UI code requesting the same section of a message again is
+// served without a command. HEADER and TEXT are cut from the whole
+// message if it is cached, and a request waits for a fetch of the same
+// section, or of the whole message, already in progress instead of
+// sending another command. Fetching BODY[HEADER] and then BODY[] of a
+// message still sends both commands; fetching BODY[] first sends one.
+// Messages are identified by the selected mailbox, its UIDVALIDITY and
+// their UID, as the content of a message never changes.
+func (c *Client) UIDFetchSection(uid imap.UID, section string) ([]byte, error) {
+	item, err := imap.ParseFetchItemBodySection("BODY.PEEK[" + section + "]")
+	if err != nil || item.Partial != nil {
+		return nil, fmt.Errorf("imap: invalid section %q", section)
+	}
+	section = item.SectionSpec()
+
+	cache := c.sectionCache()
+	if cache == nil {
+		return c.fetchSection(uid, item)
+	}
+	key := c.sectionKey(uid, section)
+	for {
+		if b, ok := cache.lookup(key); ok {
+			return b, nil
+		}
+		call, leader := cache.join(key)
+		if !leader {
+			<-call.done
+			if call.err != nil {
+				return nil, call.err
+			}
+			continue
+		}
+		b, err := c.fetchSection(uid, item)
+		if err == nil {
+			cache.add(key, b)
+		}
+		cache.finish(key, call, err)
+		return b, err
+	}
+}
+
+// fetchSection fetches a body section of a message.
+func (c *Client) fetchSection(uid imap.UID, item *imap.FetchItemBodySection) ([]byte, error) {
+	msgs, err := c.UIDFetchMessages(fmt.Sprint(uid), "(UID "+item.String()+")")
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		if msg.UID == uid {
+			return bodySection(msg, item.SectionSpec()), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %d", ErrNoSuchMessage, uid)
+}
+
+// sectionCache returns the section cache of the client, or nil if
+// Options.SectionCacheSize is not set.
+func (c *Client) sectionCache() *sectionCache {
+	if c.options.SectionCacheSize <= 0 {
+		return nil
+	}
+	c.sectionsOnce.Do(func() {
+		ttl := c.options.SectionCacheTTL
+		if ttl <= 0 {
+			ttl = DefaultSectionCacheTTL
+		}
+		c.sections = newSectionCache(c.options.SectionCacheSize, ttl)
+	})
+	return c.sections
+}
+
+// sectionKey returns the cache key of a section of a message of the
+// selected mailbox.
+func (c *Client) sectionKey(uid imap.UID, section string) sectionKey {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return sectionKey{
+		mailbox:     c.mailboxName,
+		uidValidity: c.mailboxUIDValidity,
+		uid:         uid,
+		section:     section,
+	}
+}
+
+// sectionKey identifies a body section of a message.
+type sectionKey struct {
+	mailbox     string
+	uidValidity uint32
+	uid         imap.UID
+	section     string
+}
+
+// whole returns the key of the whole message.
+func (k sectionKey) whole() sectionKey {
+	k.section = ""
+	return k
+}
+
+// derived reports whether the section can be cut from the whole message.
+func (k sectionKey) derived() bool {
+	return k.section == "HEADER" || k.section == "TEXT"
+}
+
+type sectionEntry struct {
+	key     sectionKey
+	data    []byte
+	expires time.Time
+}
+
+// sectionCall is a fetch in progress, which requests for the same section
+// wait for.
+type sectionCall struct {
+	done chan struct{}
+	err  error
+}
+
+// sectionCache holds recently fetched body sections, up to maxBytes of
+// them, evicting the least recently used first.
+type sectionCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	ttl      time.Duration
+	size     int64
+	lru      *list.List
+	entries  map[sectionKey]*list.Element
+	inflight map[sectionKey]*sectionCall
+}
+
+func newSectionCache(maxBytes int64, ttl time.Duration) *sectionCache {
+	return &sectionCache{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		lru:      list.New(),
+		entries:  make(map[sectionKey]*list.Element),
+		inflight: make(map[sectionKey]*sectionCall),
+	}
+}
+
+// lookup returns a cached section, cut from the whole message if needed.
+func (sc *sectionCache) lookup(key sectionKey) ([]byte, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if b, ok := sc.get(key); ok {
+		return b, true
+	}
+	if !key.derived() {
+		return nil, false
+	}
+	msg, ok := sc.get(key.whole())
+	if !ok {
+		return nil, false
+	}
+	header, text := splitMessage(msg)
+	if key.section == "HEADER" {
+		return bytes.Clone(header), true
+	}
+	return bytes.Clone(text), true
+}
+
+// join returns the fetch in progress that answers key, or registers one
+// for key and reports that the caller must run it.
+func (sc *sectionCache) join(key sectionKey) (*sectionCall, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if call, ok := sc.inflight[key]; ok {
+		return call, false
+	}
+	if key.derived() {
+		if call, ok := sc.inflight[key.whole()]; ok {
+			return call, false
+		}
+	}
+	call := &sectionCall{done: make(chan struct{})}
+	sc.inflight[key] = call
+	return call, true
+}
+
+// finish ends a fetch registered with join.
+func (sc *sectionCache) finish(key sectionKey, call *sectionCall, err error) {
+	sc.mu.Lock()
+	delete(sc.inflight, key)
+	sc.mu.Unlock()
+	call.err = err
+	close(call.done)
+}
+
+// get returns a copy of a cached section. The caller must hold sc.mu.
+func (sc *sectionCache) get(key sectionKey) ([]byte, bool) {
+	elem, ok := sc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*sectionEntry)
+	if time.Now().After(entry.expires) {
+		sc.remove(elem)
+		return nil, false
+	}
+	sc.lru.MoveToFront(elem)
+	return bytes.Clone(entry.data), true
+}
+
+// add caches a section, evicting the least recently used ones to stay
+// within maxBytes. Sections larger than maxBytes are not cached.
+func (sc *sectionCache) add(key sectionKey, data []byte) {
+	size := int64(len(data))
+	if size > sc.maxBytes {
+		return
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if elem, ok := sc.entries[key]; ok {
+		sc.remove(elem)
+	}
+	for sc.size+size > sc.maxBytes {
+		sc.remove(sc.lru.Back())
+	}
+	sc.entries[key] = sc.lru.PushFront(&sectionEntry{key: key, data: bytes.Clone(data), expires: time.Now().Add(sc.ttl)})
+	sc.size += size
+}
+
+// remove drops a cached section. The caller must hold sc.mu.
+func (sc *sectionCache) remove(elem *list.Element) {
+	entry := sc.lru.Remove(elem).(*sectionEntry)
+	delete(sc.entries, entry.key)
+	sc.size -= int64(len(entry.data))
+}
+
+// splitMessage splits a message into its header, with the blank line
+// ending it, and its body, as BODY[HEADER] and BODY[TEXT] return them.
+func splitMessage(msg []byte) (header, text []byte) {
+	if i := bytes.Index(msg, []byte("\r\n\r\n")); i >= 0 {
+		return msg[:i+4], msg[i+4:]
+	}
+	if bytes.HasPrefix(msg, []byte("\r\n")) {
+		return msg[:2], msg[2:]
+	}
+	return msg, nil
+}
@@ -0,0 +1,177 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const sectionCacheMessage = "Subject: hello\r\nFrom: a@example.org\r\n\r\nHello, world\r\n"
+
+// newSectionClient returns a client with a selected mailbox holding
+// sectionCacheMessage as UID 5, and a function returning the UID FETCH
+// commands it received.
+func newSectionClient(t *testing.T, opts ...Option) (*Client, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var fetches []string
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1] ready", func(w io.Writer, tag, cmd string) {
+		switch {
+		case strings.HasPrefix(cmd, "SELECT"):
+			fmt.Fprint(w, "* 1 EXISTS\r\n* OK [UIDVALIDITY 7] ok\r\n")
+		case strings.HasPrefix(cmd, "UID FETCH"):
+			mu.Lock()
+			fetches = append(fetches, cmd)
+			mu.Unlock()
+			_, section, _ := strings.Cut(cmd, "BODY.PEEK[")
+			section, _, _ = strings.Cut(section, "]")
+			data := sectionCacheMessage
+			switch section {
+			case "HEADER":
+				data, _, _ = strings.Cut(data, "\r\n\r\n")
+				data += "\r\n\r\n"
+			case "TEXT":
+				_, data, _ = strings.Cut(data, "\r\n\r\n")
+			}
+			fmt.Fprintf(w, "* 1 FETCH (UID 5 BODY[%s] {%d}\r\n%s)\r\n", section, len(data), data)
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	}, opts...)
+	if _, err := c.Select("INBOX", nil); err != nil {
+		t.Fatalf("Select() error: %v", err)
+	}
+	return c, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		got := fetches
+		fetches = nil
+		return got
+	}
+}
+
+func TestUIDFetchSection_Cache(t *testing.T) {
+	c, fetches := newSectionClient(t, WithSectionCache(1<<20, time.Minute))
+
+	for _, section := range []string{"", "header", "TEXT", ""} {
+		b, err := c.UIDFetchSection(5, section)
+		if err != nil {
+			t.Fatalf("UIDFetchSection(%q) error: %v", section, err)
+		}
+		want := sectionCacheMessage
+		switch section {
+		case "header":
+			want = "Subject: hello\r\nFrom: a@example.org\r\n\r\n"
+		case "TEXT":
+			want = "Hello, world\r\n"
+		}
+		if string(b) != want {
+			t.Errorf("UIDFetchSection(%q) = %q, want %q", section, b, want)
+		}
+	}
+	if got := fetches(); len(got) != 1 || got[0] != "UID FETCH 5 (UID BODY.PEEK[])" {
+		t.Errorf("commands = %q, want one UID FETCH of BODY[]", got)
+	}
+
+	// A section that cannot be cut from the message is fetched.
+	if _, err := c.UIDFetchSection(5, "1"); err != nil {
+		t.Fatalf("UIDFetchSection(1) error: %v", err)
+	}
+	if got := fetches(); len(got) != 1 {
+		t.Errorf("commands = %q, want one UID FETCH of BODY[1]", got)
+	}
+}
+
+func TestUIDFetchSection_HeaderFirst(t *testing.T) {
+	c, fetches := newSectionClient(t, WithSectionCache(1<<20, 0))
+
+	for _, section := range []string{"HEADER", "", "HEADER"} {
+		if _, err := c.UIDFetchSection(5, section); err != nil {
+			t.Fatalf("UIDFetchSection(%q) error: %v", section, err)
+		}
+	}
+	if got := fetches(); len(got) != 2 {
+		t.Errorf("commands = %q, want UID FETCH of BODY[HEADER] and BODY[]", got)
+	}
+}
+
+func TestUIDFetchSection_Bounds(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"disabled", nil},
+		{"too large", []Option{WithSectionCache(10, time.Minute)}},
+		{"expired", []Option{WithSectionCache(1<<20, time.Nanosecond)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, fetches := newSectionClient(t, tt.opts...)
+			for i := 0; i < 2; i++ {
+				if _, err := c.UIDFetchSection(5, ""); err != nil {
+					t.Fatalf("UIDFetchSection() error: %v", err)
+				}
+				time.Sleep(time.Millisecond)
+			}
+			if got := fetches(); len(got) != 2 {
+				t.Errorf("commands = %q, want two", got)
+			}
+		})
+	}
+}
+
+func TestUIDFetchSection_Invalid(t *testing.T) {
+	c, _ := newSectionClient(t)
+	if _, err := c.UIDFetchSection(5, "HEADER]<0.10>"); err == nil {
+		t.Error("UIDFetchSection() succeeded with an invalid section")
+	}
+}
+
+func TestSectionCache_Eviction(t *testing.T) {
+	sc := newSectionCache(10, time.Minute)
+	key := func(section string) sectionKey { return sectionKey{mailbox: "INBOX", uid: 1, section: section} }
+	sc.add(key("1"), []byte("12345"))
+	sc.add(key("2"), []byte("12345"))
+	if _, ok := sc.lookup(key("1")); !ok {
+		t.Fatal("section 1 not cached")
+	}
+	// Section 2 is now the least recently used.
+	sc.add(key("3"), []byte("123"))
+	if _, ok := sc.lookup(key("2")); ok {
+		t.Error("least recently used section not evicted")
+	}
+	if _, ok := sc.lookup(key("1")); !ok {
+		t.Error("recently used section evicted")
+	}
+	if sc.size != 8 {
+		t.Errorf("size = %d, want 8", sc.size)
+	}
+}
+
+func TestSectionCache_Join(t *testing.T) {
+	sc := newSectionCache(1<<20, time.Minute)
+	whole := sectionKey{mailbox: "INBOX", uid: 1}
+	call, leader := sc.join(whole)
+	if !leader {
+		t.Fatal("first join is not the leader")
+	}
+	header := whole
+	header.section = "HEADER"
+	if got, leader := sc.join(header); leader || got != call {
+		t.Error("HEADER does not wait for the fetch of the whole message")
+	}
+	part := whole
+	part.section = "1"
+	if _, leader := sc.join(part); !leader {
+		t.Error("part waits for the fetch of the whole message")
+	}
+
+	sc.add(whole, []byte(sectionCacheMessage))
+	sc.finish(whole, call, nil)
+	<-call.done
+	if b, ok := sc.lookup(header); !ok || !strings.HasPrefix(string(b), "Subject") {
+		t.Errorf("lookup(HEADER) = %q, %v", b, ok)
+	}
+}
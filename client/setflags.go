@@ -0,0 +1,173 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// ErrNoSuchMessage is returned by SetFlags if the selected mailbox has no
+// message with the UID.
+var ErrNoSuchMessage = errors.New("no message with this UID")
+
+// FlagConflictError is returned by SetFlags if the flags of the message
+// were changed by another client after they were read, so the update was
+// not applied. The caller should read the flags again and decide whether
+// to retry.
+type FlagConflictError struct {
+	// UID is the UID of the message.
+	UID imap.UID
+	// ModSeq is the mod-sequence the update was conditional on.
+	ModSeq uint64
+}
+
+// Error implements error.
+func (e *FlagConflictError) Error() string {
+	return fmt.Sprintf("flags of message %d changed since mod-sequence %d", e.UID, e.ModSeq)
+}
+
+// FlagChanges are the changes SetFlags applied to a message.
+type FlagChanges struct {
+	// Added are the flags that were added.
+	Added []imap.Flag
+	// Removed are the flags that were removed.
+	Removed []imap.Flag
+	// ModSeq is the mod-sequence of the message after the changes, if the
+	// server supports CONDSTORE.
+	ModSeq uint64
+}
+
+// SetFlags makes the flags of the message with the UID in the selected
+// mailbox exactly the given ones. It reads the current flags and only
+// stores the difference with -FLAGS and +FLAGS, so calling it again with
+// the same flags sends no STORE at all, and flags it does not touch are
+// left alone even if another client changes them at the same time.
+//
+// If the server supports CONDSTORE (RFC 7162), the stores are conditional
+// on the mod-sequence read with the flags (UNCHANGEDSINCE), and a
+// *FlagConflictError is returned if the message changed in between. If
+// the message does not exist, ErrNoSuchMessage is returned.
+func (c *Client) SetFlags(uid imap.UID, exact []imap.Flag) (*FlagChanges, error) {
+	items := "(UID FLAGS)"
+	if c.HasCap("CONDSTORE") {
+		items = "(UID FLAGS MODSEQ)"
+	}
+	msgs, err := c.UIDFetchMessages(strconv.FormatUint(uint64(uid), 10), items)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		if msg.UID == uid {
+			return c.SetFlagsFrom(msg, exact)
+		}
+	}
+	return nil, ErrNoSuchMessage
+}
+
+// SetFlagsFrom is like SetFlags, but uses the flags and mod-sequence of a
+// message fetched before, such as one returned by UIDFetchMessages with
+// the UID, FLAGS and MODSEQ items, instead of reading them again. The
+// update is only safe from concurrent changes if msg.ModSeq is set.
+func (c *Client) SetFlagsFrom(msg *imap.FetchMessageBuffer, exact []imap.Flag) (*FlagChanges, error) {
+	changes := &FlagChanges{
+		Added:   flagsMissing(exact, msg.Flags),
+		Removed: flagsMissing(msg.Flags, exact),
+		ModSeq:  msg.ModSeq,
+	}
+
+	var err error
+	if len(changes.Removed) > 0 {
+		changes.ModSeq, err = c.storeFlagDelta(msg.UID, changes.ModSeq, imap.StoreFlagsDel, changes.Removed)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(changes.Added) > 0 {
+		changes.ModSeq, err = c.storeFlagDelta(msg.UID, changes.ModSeq, imap.StoreFlagsAdd, changes.Added)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// storeFlagDelta runs UID STORE with the action, conditional on modSeq if
+// it is not zero, and returns the new mod-sequence of the message.
+func (c *Client) storeFlagDelta(uid imap.UID, modSeq uint64, action imap.StoreAction, flags []imap.Flag) (uint64, error) {
+	set := strconv.FormatUint(uint64(uid), 10)
+	args := []string{set}
+	if modSeq > 0 {
+		args = append(args, "(UNCHANGEDSINCE "+strconv.FormatUint(modSeq, 10)+")")
+	}
+	flagStrs := make([]string, len(flags))
+	for i, f := range flags {
+		flagStrs[i] = string(f)
+	}
+	args = append(args, action.String(), "("+strings.Join(flagStrs, " ")+")")
+
+	c.collectUntagged()
+	result, err := c.execute("UID STORE", args...)
+	if err != nil {
+		return 0, err
+	}
+	if err := commandResultError(result); err != nil {
+		return 0, err
+	}
+	if code, _, _ := strings.Cut(result.code, " "); strings.EqualFold(code, string(imap.ResponseCodeModified)) {
+		return 0, &FlagConflictError{UID: uid, ModSeq: modSeq}
+	}
+	if modSeq == 0 {
+		return 0, nil
+	}
+
+	var lines []string
+	for _, line := range c.collectUntagged() {
+		if strings.HasPrefix(line, "FETCH ") {
+			lines = append(lines, line)
+		}
+	}
+	for _, msg := range parseHeaderFetches(lines, nil) {
+		if msg.UID == uid && msg.ModSeq > 0 {
+			return msg.ModSeq, nil
+		}
+	}
+
+	// The server did not report the new mod-sequence, although RFC 7162
+	// requires it.
+	msgs, err := c.UIDFetchMessages(set, "(UID MODSEQ)")
+	if err != nil {
+		return 0, err
+	}
+	for _, msg := range msgs {
+		if msg.UID == uid {
+			return msg.ModSeq, nil
+		}
+	}
+	return 0, ErrNoSuchMessage
+}
+
+// flagsMissing returns the flags in a that are not in b, ignoring case.
+// \Recent is ignored, since clients cannot change it.
+func flagsMissing(a, b []imap.Flag) []imap.Flag {
+	var missing []imap.Flag
+	for _, f := range a {
+		if strings.EqualFold(string(f), string(imap.FlagRecent)) || containsFlag(b, f) || containsFlag(missing, f) {
+			continue
+		}
+		missing = append(missing, f)
+	}
+	return missing
+}
+
+// containsFlag reports whether flags contains f, ignoring case.
+func containsFlag(flags []imap.Flag, f imap.Flag) bool {
+	for _, flag := range flags {
+		if strings.EqualFold(string(flag), string(f)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestSetFlags_CondStore(t *testing.T) {
+	var mu sync.Mutex
+	var cmds []string
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1 CONDSTORE] ready", func(w io.Writer, tag, cmd string) {
+		mu.Lock()
+		cmds = append(cmds, cmd)
+		mu.Unlock()
+		switch {
+		case strings.HasPrefix(cmd, "UID FETCH "):
+			fmt.Fprint(w, "* 2 FETCH (UID 7 FLAGS (\\Seen \\Recent $Junk) MODSEQ (10))\r\n")
+		case strings.Contains(cmd, "-FLAGS"):
+			fmt.Fprint(w, "* 2 FETCH (UID 7 FLAGS (\\Seen) MODSEQ (11))\r\n")
+		case strings.Contains(cmd, "+FLAGS"):
+			fmt.Fprint(w, "* 2 FETCH (UID 7 FLAGS (\\Seen \\Flagged) MODSEQ (12))\r\n")
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+
+	changes, err := c.SetFlags(7, []imap.Flag{"\\seen", imap.FlagFlagged})
+	if err != nil {
+		t.Fatalf("SetFlags() error: %v", err)
+	}
+	if len(changes.Added) != 1 || changes.Added[0] != imap.FlagFlagged {
+		t.Errorf("Added = %v", changes.Added)
+	}
+	if len(changes.Removed) != 1 || changes.Removed[0] != "$Junk" {
+		t.Errorf("Removed = %v", changes.Removed)
+	}
+	if changes.ModSeq != 12 {
+		t.Errorf("ModSeq = %d, want 12", changes.ModSeq)
+	}
+
+	want := []string{
+		"UID FETCH 7 (UID FLAGS MODSEQ)",
+		"UID STORE 7 (UNCHANGEDSINCE 10) -FLAGS ($Junk)",
+		"UID STORE 7 (UNCHANGEDSINCE 11) +FLAGS (\\Flagged)",
+	}
+	if strings.Join(cmds, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands = %q, want %q", cmds, want)
+	}
+}
+
+func TestSetFlags_Unchanged(t *testing.T) {
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		if strings.HasPrefix(cmd, "UID STORE ") {
+			t.Errorf("unexpected %q", cmd)
+		}
+		if cmd == "UID FETCH 3 (UID FLAGS)" {
+			fmt.Fprint(w, "* 1 FETCH (UID 3 FLAGS (\\Seen))\r\n")
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+
+	changes, err := c.SetFlags(3, []imap.Flag{imap.FlagSeen})
+	if err != nil {
+		t.Fatalf("SetFlags() error: %v", err)
+	}
+	if len(changes.Added) != 0 || len(changes.Removed) != 0 {
+		t.Errorf("changes = %+v, want none", changes)
+	}
+}
+
+func TestSetFlags_Conflict(t *testing.T) {
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1 CONDSTORE] ready", func(w io.Writer, tag, cmd string) {
+		if strings.HasPrefix(cmd, "UID STORE ") {
+			fmt.Fprintf(w, "%s OK [MODIFIED 7] conditional STORE failed\r\n", tag)
+			return
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+
+	msg := &imap.FetchMessageBuffer{UID: 7, ModSeq: 10}
+	_, err := c.SetFlagsFrom(msg, []imap.Flag{imap.FlagSeen})
+	var conflict *FlagConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("error = %v, want *FlagConflictError", err)
+	}
+	if conflict.UID != 7 || conflict.ModSeq != 10 {
+		t.Errorf("conflict = %+v", conflict)
+	}
+}
+
+func TestSetFlags_NoSuchMessage(t *testing.T) {
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+
+	if _, err := c.SetFlags(9, nil); !errors.Is(err, ErrNoSuchMessage) {
+		t.Errorf("error = %v, want ErrNoSuchMessage", err)
+	}
+}
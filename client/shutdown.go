@@ -0,0 +1,62 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// disconnectCause returns the error to report for a read error that ended
+// the connection. While the connection is shutting down, because Close or
+// Logout was called or the server sent BYE, the read error is expected and
+// ErrClosed is returned, wrapping the BYE response if there was one.
+func (c *Client) disconnectCause(err error) error {
+	c.mu.Lock()
+	closing := c.closed || c.loggingOut
+	bye := c.bye
+	c.mu.Unlock()
+
+	switch {
+	case closing:
+		return ErrClosed
+	case bye != nil:
+		return fmt.Errorf("%w: %w", ErrClosed, bye)
+	case errors.Is(err, io.EOF):
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// handleBye records an untagged BYE response, after which the server is
+// expected to close the connection.
+func (c *Client) handleBye(text string) {
+	resp := &imap.StatusResponse{Type: imap.StatusResponseTypeBYE, Text: text}
+	if strings.HasPrefix(text, "[") {
+		if end := strings.IndexByte(text, ']'); end > 0 {
+			code, _, _ := strings.Cut(text[1:end], " ")
+			resp.Code = imap.ResponseCode(strings.ToUpper(code))
+			resp.Text = strings.TrimSpace(text[end+1:])
+		}
+	}
+
+	c.mu.Lock()
+	c.bye = &imap.IMAPError{StatusResponse: resp}
+	c.mu.Unlock()
+}
+
+// isConnectionError reports whether err was caused by the connection being
+// closed or reset rather than by a response of the server.
+func isConnectionError(err error) bool {
+	return errors.Is(err, ErrClosed) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE)
+}
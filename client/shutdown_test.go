@@ -0,0 +1,88 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// waitDone waits for the client to disconnect and returns the cause.
+func waitDone(t *testing.T, c *Client) error {
+	t.Helper()
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not disconnect")
+	}
+	return c.DisconnectErr()
+}
+
+func TestLogout_ServerClosesEarly(t *testing.T) {
+	tests := []struct {
+		name string
+		resp string
+	}{
+		{"EOF", ""},
+		{"BYE", "* BYE logging out\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+				fmt.Fprint(w, tt.resp)
+				_ = w.(net.Conn).Close()
+			})
+			if err := c.Logout(); err != nil {
+				t.Fatalf("Logout() error: %v", err)
+			}
+			if err := waitDone(t, c); !errors.Is(err, ErrClosed) {
+				t.Errorf("DisconnectErr() = %v, want ErrClosed", err)
+			}
+		})
+	}
+}
+
+func TestLogout_NO(t *testing.T) {
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		fmt.Fprintf(w, "%s NO not now\r\n", tag)
+	})
+	if err := c.Logout(); err == nil {
+		t.Fatal("Logout() error = nil, want NO")
+	}
+}
+
+func TestServerByeThenClose(t *testing.T) {
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		fmt.Fprint(w, "* BYE [UNAVAILABLE] shutting down\r\n")
+		_ = w.(net.Conn).Close()
+	})
+
+	err := c.Noop()
+	if !errors.Is(err, ErrClosed) {
+		t.Fatalf("Noop() error = %v, want ErrClosed", err)
+	}
+	var imapErr *imap.IMAPError
+	if !errors.As(err, &imapErr) || imapErr.Type != imap.StatusResponseTypeBYE || imapErr.Code != imap.ResponseCodeUnavailable {
+		t.Errorf("Noop() error = %v, want wrapped BYE [UNAVAILABLE]", err)
+	}
+	if err := waitDone(t, c); !errors.Is(err, ErrClosed) {
+		t.Errorf("DisconnectErr() = %v, want ErrClosed", err)
+	}
+}
+
+func TestConnectionLost(t *testing.T) {
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		_ = w.(net.Conn).Close()
+	})
+
+	if err := c.Noop(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Noop() error = %v, want ErrClosed", err)
+	}
+	if err := waitDone(t, c); errors.Is(err, ErrClosed) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("DisconnectErr() = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
@@ -0,0 +1,171 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// ErrUIDValidityChanged is returned by Restore if the UIDVALIDITY of the
+// mailbox selected in the snapshot changed, so that the UIDs the
+// application kept no longer identify the same messages and it must
+// resynchronize the mailbox.
+var ErrUIDValidityChanged = errors.New("UIDVALIDITY changed")
+
+// ErrSavedSearchLost is returned by Restore if a search result had been
+// saved as $ (SEARCHRES, RFC 5182) when the snapshot was taken. Saved
+// results do not outlive their connection, so the search must be run
+// again; the rest of the state is restored.
+var ErrSavedSearchLost = errors.New("saved search result lost")
+
+// Snapshot is the protocol state of a Client, as returned by
+// Client.Snapshot. It can be marshaled as JSON, so that an application
+// can persist it and resume after a crash with Client.Restore, and tests
+// can compare the state of clients.
+type Snapshot struct {
+	// State is the connection state.
+	State imap.ConnState `json:"state"`
+	// Caps are the capabilities of the server.
+	Caps []string `json:"caps,omitempty"`
+	// Enabled are the capabilities enabled with ENABLE (RFC 5161).
+	Enabled []string `json:"enabled,omitempty"`
+	// Mailbox is the selected mailbox, if any.
+	Mailbox *MailboxSnapshot `json:"mailbox,omitempty"`
+	// SavedSearch reports whether a search result was saved as $ in the
+	// selected mailbox (SEARCHRES, RFC 5182).
+	SavedSearch bool `json:"savedSearch,omitempty"`
+}
+
+// MailboxSnapshot is the state of the selected mailbox in a Snapshot: the
+// anchors an application needs to tell whether its view of the mailbox
+// is still valid on a new connection.
+type MailboxSnapshot struct {
+	Name          string `json:"name"`
+	ReadOnly      bool   `json:"readOnly,omitempty"`
+	UIDValidity   uint32 `json:"uidValidity"`
+	UIDNext       uint32 `json:"uidNext,omitempty"`
+	NumMessages   uint32 `json:"numMessages"`
+	HighestModSeq uint64 `json:"highestModSeq,omitempty"`
+}
+
+// Snapshot returns the protocol state of the client.
+func (c *Client) Snapshot() *Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := &Snapshot{
+		State:       c.state,
+		Caps:        append([]string(nil), c.caps...),
+		Enabled:     append([]string(nil), c.enabled...),
+		SavedSearch: c.savedSearch,
+	}
+	if c.state == imap.ConnStateSelected {
+		s.Mailbox = &MailboxSnapshot{
+			Name:          c.mailboxName,
+			ReadOnly:      c.mailboxReadOnly,
+			UIDValidity:   c.mailboxUIDValidity,
+			UIDNext:       c.mailboxUIDNext,
+			NumMessages:   c.mailboxMessages,
+			HighestModSeq: c.mailboxHighestModSeq,
+		}
+	}
+	return s
+}
+
+// Restore re-establishes the state of a snapshot taken from another
+// connection on c, which must be logged in already, as snapshots do not
+// hold credentials: it enables the capabilities that were enabled and
+// selects or examines the mailbox that was selected.
+//
+// If the UIDVALIDITY of the mailbox changed, Restore returns an error
+// wrapping ErrUIDValidityChanged, with the mailbox selected. If a search
+// result was saved, it returns ErrSavedSearchLost after restoring the
+// rest. Enabled capabilities the server no longer supports are reported
+// as errors too, after the mailbox is selected.
+func (c *Client) Restore(s *Snapshot) error {
+	if s == nil || s.State < imap.ConnStateAuthenticated {
+		return nil
+	}
+	if c.State() < imap.ConnStateAuthenticated {
+		return errors.New("restore: client is not authenticated")
+	}
+
+	var errs []error
+	var enable []string
+	for _, name := range s.Enabled {
+		switch {
+		case c.isEnabled(name):
+		case c.Supports(imap.Cap(name)):
+			enable = append(enable, name)
+		default:
+			errs = append(errs, fmt.Errorf("restore: %s is not supported", name))
+		}
+	}
+	if err := c.Enable(enable...); err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+
+	if mbox := s.Mailbox; mbox != nil {
+		data, err := c.Select(mbox.Name, &imap.SelectOptions{ReadOnly: mbox.ReadOnly})
+		if err != nil {
+			return fmt.Errorf("restore: %w", err)
+		}
+		if data.UIDValidity != mbox.UIDValidity {
+			return fmt.Errorf("restore: %s: %w from %d to %d", mbox.Name, ErrUIDValidityChanged, mbox.UIDValidity, data.UIDValidity)
+		}
+	}
+	if s.SavedSearch {
+		errs = append(errs, ErrSavedSearchLost)
+	}
+	return errors.Join(errs...)
+}
+
+// recordEnabled records the capabilities of an ENABLED response.
+func (c *Client) recordEnabled(caps []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, name := range caps {
+		if !containsFold(c.enabled, name) {
+			c.enabled = append(c.enabled, name)
+		}
+	}
+}
+
+// isEnabled reports whether the server reported name enabled.
+func (c *Client) isEnabled(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return containsFold(c.enabled, name)
+}
+
+// containsFold reports whether list holds s, compared case-insensitively.
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// savesSearchResult reports whether a command saves its result as $: a
+// SEARCH, SORT or their UID forms with the SAVE result option.
+func savesSearchResult(name, line string) bool {
+	if !strings.HasSuffix(name, "SEARCH") && !strings.HasSuffix(name, "SORT") {
+		return false
+	}
+	upper := strings.ToUpper(line)
+	i := strings.Index(upper, " RETURN (")
+	if i < 0 {
+		return false
+	}
+	opts, _, _ := strings.Cut(upper[i+len(" RETURN ("):], ")")
+	for _, opt := range strings.Fields(opts) {
+		if opt == "SAVE" {
+			return true
+		}
+	}
+	return false
+}
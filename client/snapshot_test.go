@@ -0,0 +1,103 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// snapshotServer answers ENABLE, SELECT and SEARCH for snapshot tests,
+// recording the commands it receives.
+func snapshotServer(uidValidity uint32, commands *[]string) func(w io.Writer, tag, cmd string) {
+	return func(w io.Writer, tag, cmd string) {
+		*commands = append(*commands, cmd)
+		switch {
+		case strings.HasPrefix(cmd, "ENABLE "):
+			fmt.Fprintf(w, "* ENABLED %s\r\n", strings.TrimPrefix(cmd, "ENABLE "))
+		case strings.HasPrefix(cmd, "SELECT "):
+			fmt.Fprintf(w, "* 3 EXISTS\r\n* OK [UIDVALIDITY %d] UIDs valid\r\n", uidValidity)
+			fmt.Fprint(w, "* OK [UIDNEXT 9] Predicted next UID\r\n* OK [HIGHESTMODSEQ 42] Highest\r\n")
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	}
+}
+
+func TestClient_Snapshot(t *testing.T) {
+	var commands []string
+	c := newScriptedClient(t, "* PREAUTH [CAPABILITY IMAP4rev1 CONDSTORE SEARCHRES] ready", snapshotServer(7, &commands))
+	if err := c.Enable("CONDSTORE"); err != nil {
+		t.Fatalf("Enable() error: %v", err)
+	}
+	if _, err := c.Select("INBOX", nil); err != nil {
+		t.Fatalf("Select() error: %v", err)
+	}
+	if _, err := c.execute("UID SEARCH", "RETURN (SAVE)", "UNSEEN"); err != nil {
+		t.Fatalf("SEARCH error: %v", err)
+	}
+
+	want := &Snapshot{
+		State:       imap.ConnStateSelected,
+		Caps:        []string{"IMAP4rev1", "CONDSTORE", "SEARCHRES"},
+		Enabled:     []string{"CONDSTORE"},
+		Mailbox:     &MailboxSnapshot{Name: "INBOX", UIDValidity: 7, UIDNext: 9, NumMessages: 3, HighestModSeq: 42},
+		SavedSearch: true,
+	}
+	got := c.Snapshot()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Snapshot() = %+v, want %+v", got, want)
+	}
+
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Snapshot
+	if err := json.Unmarshal(b, &decoded); err != nil || !reflect.DeepEqual(&decoded, want) {
+		t.Errorf("JSON round trip = %+v, %v", decoded, err)
+	}
+
+	// Restoring on a new connection enables CONDSTORE and selects INBOX
+	// again, but the saved search result is lost.
+	commands = nil
+	c2 := newScriptedClient(t, "* PREAUTH [CAPABILITY IMAP4rev1 CONDSTORE] ready", snapshotServer(7, &commands))
+	if err := c2.Restore(&decoded); !errors.Is(err, ErrSavedSearchLost) {
+		t.Errorf("Restore() error = %v, want ErrSavedSearchLost", err)
+	}
+	if strings.Join(commands, ", ") != "ENABLE CONDSTORE, SELECT INBOX" {
+		t.Errorf("commands = %q", commands)
+	}
+	if c2.State() != imap.ConnStateSelected {
+		t.Errorf("state = %v after Restore()", c2.State())
+	}
+
+	// A new UIDVALIDITY invalidates the snapshot.
+	decoded.SavedSearch = false
+	c3 := newScriptedClient(t, "* PREAUTH [CAPABILITY IMAP4rev1 CONDSTORE] ready", snapshotServer(8, &commands))
+	if err := c3.Restore(&decoded); !errors.Is(err, ErrUIDValidityChanged) {
+		t.Errorf("Restore() error = %v, want ErrUIDValidityChanged", err)
+	}
+}
+
+func TestSavesSearchResult(t *testing.T) {
+	tests := []struct {
+		name, line string
+		want       bool
+	}{
+		{"UID SEARCH", "A1 UID SEARCH RETURN (SAVE) UNSEEN\r\n", true},
+		{"SEARCH", "A1 SEARCH RETURN (MIN save) ALL\r\n", true},
+		{"UID SORT", "A1 UID SORT RETURN (SAVE) (DATE) UTF-8 ALL\r\n", true},
+		{"UID SEARCH", "A1 UID SEARCH RETURN (COUNT) SUBJECT SAVE\r\n", false},
+		{"UID FETCH", "A1 UID FETCH $ (FLAGS)\r\n", false},
+	}
+	for _, tt := range tests {
+		if got := savesSearchResult(tt.name, tt.line); got != tt.want {
+			t.Errorf("savesSearchResult(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// ErrSortDisplayUnsupported is returned by SortMessages if the sort
+// criteria contain DISPLAYFROM or DISPLAYTO and the server does not
+// advertise SORT=DISPLAY.
+var ErrSortDisplayUnsupported = errors.New("server does not support SORT=DISPLAY")
+
+// ErrComparatorUnsupported is returned if a comparator is requested and
+// the server does not advertise I18NLEVEL=2.
+var ErrComparatorUnsupported = errors.New("server does not support COMPARATOR")
+
+// SortOptions contains options for SortMessages.
+type SortOptions struct {
+	// Criteria is the sort order. It must not be empty.
+	Criteria []imap.SortCriterion
+	// Search selects the messages to sort, such as "UNSEEN". If empty,
+	// all messages are sorted.
+	Search string
+	// Charset is the charset of the strings in Search. If empty, UTF-8
+	// is used.
+	Charset string
+	// UID returns UIDs instead of sequence numbers.
+	UID bool
+	// Comparators select the collation used to compare strings, in order
+	// of preference (RFC 5255), for example a locale-tailored
+	// "i;basic;uca=3.1.1;locale=de" followed by "i;unicode-casemap". If
+	// set, COMPARATOR is sent before SORT, which requires I18NLEVEL=2.
+	Comparators []string
+}
+
+// SortMessages sorts the messages of the selected mailbox on the server
+// (SORT, RFC 5256) and returns their numbers in order.
+//
+// DISPLAYFROM and DISPLAYTO (RFC 5957) sort by the display name of the
+// first sender or recipient, falling back to the address, which is what
+// message lists ordered by correspondent need; they require SORT=DISPLAY,
+// and ErrSortDisplayUnsupported is returned without it.
+func (c *Client) SortMessages(opts *SortOptions) ([]uint32, error) {
+	if opts == nil || len(opts.Criteria) == 0 {
+		return nil, errors.New("imap: no sort criteria")
+	}
+	for _, crit := range opts.Criteria {
+		if (crit.Key == imap.SortKeyDisplayFrom || crit.Key == imap.SortKeyDisplayTo) && !c.HasCap(string(imap.CapSortDisplay)) {
+			return nil, ErrSortDisplayUnsupported
+		}
+	}
+
+	if len(opts.Comparators) > 0 {
+		if _, err := c.Comparator(opts.Comparators...); err != nil {
+			return nil, err
+		}
+	}
+
+	charset := opts.Charset
+	if charset == "" {
+		charset = "UTF-8"
+	}
+	search := opts.Search
+	if search == "" {
+		search = "ALL"
+	}
+	criteria := sortCriteriaString(opts.Criteria) + " " + charset + " " + search
+
+	if opts.UID {
+		return c.UIDSort(criteria)
+	}
+	return c.Sort(criteria)
+}
+
+// UIDSort is like Sort, but returns UIDs.
+func (c *Client) UIDSort(criteria string) ([]uint32, error) {
+	c.collectUntagged()
+
+	result, err := c.execute("UID SORT", criteria)
+	if err != nil {
+		return nil, err
+	}
+	if err := commandResultError(result); err != nil {
+		return nil, err
+	}
+	return parseSortResults(c.collectUntagged()), nil
+}
+
+// Comparator sets the collation used to compare strings in SORT and
+// SEARCH (RFC 5255) to the first of the given comparators the server
+// supports, and returns the comparator that is active afterwards. Without
+// arguments it only returns the active comparator. It requires
+// I18NLEVEL=2; ErrComparatorUnsupported is returned otherwise.
+func (c *Client) Comparator(comparators ...string) (string, error) {
+	if !c.HasCap(string(imap.CapI18NLevel2)) {
+		return "", ErrComparatorUnsupported
+	}
+	c.collectUntagged()
+
+	args := make([]string, len(comparators))
+	for i, name := range comparators {
+		args[i] = quoteString(name)
+	}
+	result, err := c.execute("COMPARATOR", args...)
+	if err != nil {
+		return "", err
+	}
+	if err := commandResultError(result); err != nil {
+		return "", err
+	}
+
+	for _, line := range c.collectUntagged() {
+		if len(line) > 11 && strings.EqualFold(line[:11], "COMPARATOR ") {
+			active, _ := readQuotedOrAtom(line[11:])
+			return active, nil
+		}
+	}
+	return "", errors.New("imap: missing COMPARATOR response")
+}
+
+// sortCriteriaString formats a sort criteria list, such as
+// "(REVERSE DATE SUBJECT)".
+func sortCriteriaString(criteria []imap.SortCriterion) string {
+	keys := make([]string, len(criteria))
+	for i, crit := range criteria {
+		keys[i] = string(crit.Key)
+		if crit.Reverse {
+			keys[i] = "REVERSE " + keys[i]
+		}
+	}
+	return "(" + strings.Join(keys, " ") + ")"
+}
+
+// parseSortResults parses SORT responses.
+func parseSortResults(lines []string) []uint32 {
+	var results []uint32
+	for _, line := range lines {
+		if strings.HasPrefix(line, "SORT ") {
+			fields := strings.Fields(line[5:])
+			for _, f := range fields {
+				if n, err := strconv.ParseUint(f, 10, 32); err == nil {
+					results = append(results, uint32(n))
+				}
+			}
+		}
+	}
+	return results
+}
+
+// quoteString returns s as a quoted string, as required for arguments
+// such as comparator names.
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestSortMessages(t *testing.T) {
+	var mu sync.Mutex
+	var cmds []string
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1 SORT SORT=DISPLAY I18NLEVEL=2] ready", func(w io.Writer, tag, cmd string) {
+		mu.Lock()
+		cmds = append(cmds, cmd)
+		mu.Unlock()
+		switch {
+		case strings.HasPrefix(cmd, "COMPARATOR"):
+			fmt.Fprint(w, "* COMPARATOR \"i;unicode-casemap\" (\"i;unicode-casemap\")\r\n")
+		case strings.HasPrefix(cmd, "UID SORT "):
+			fmt.Fprint(w, "* SORT 9 4 7\r\n")
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+
+	nums, err := c.SortMessages(&SortOptions{
+		Criteria: []imap.SortCriterion{
+			{Key: imap.SortKeyDisplayFrom},
+			{Key: imap.SortKeyDate, Reverse: true},
+		},
+		Search:      "UNSEEN",
+		UID:         true,
+		Comparators: []string{"i;basic;locale=de", "i;unicode-casemap"},
+	})
+	if err != nil {
+		t.Fatalf("SortMessages() error: %v", err)
+	}
+	if len(nums) != 3 || nums[0] != 9 || nums[2] != 7 {
+		t.Errorf("SortMessages() = %v, want [9 4 7]", nums)
+	}
+
+	want := []string{
+		`COMPARATOR "i;basic;locale=de" "i;unicode-casemap"`,
+		`UID SORT (DISPLAYFROM REVERSE DATE) UTF-8 UNSEEN`,
+	}
+	if strings.Join(cmds, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands = %q, want %q", cmds, want)
+	}
+}
+
+func TestSortMessages_Unsupported(t *testing.T) {
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1 SORT] ready", func(w io.Writer, tag, cmd string) {
+		t.Errorf("unexpected %q", cmd)
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+
+	_, err := c.SortMessages(&SortOptions{Criteria: []imap.SortCriterion{{Key: imap.SortKeyDisplayTo}}})
+	if !errors.Is(err, ErrSortDisplayUnsupported) {
+		t.Errorf("error = %v, want ErrSortDisplayUnsupported", err)
+	}
+	_, err = c.SortMessages(&SortOptions{
+		Criteria:    []imap.SortCriterion{{Key: imap.SortKeyFrom}},
+		Comparators: []string{"i;unicode-casemap"},
+	})
+	if !errors.Is(err, ErrComparatorUnsupported) {
+		t.Errorf("error = %v, want ErrComparatorUnsupported", err)
+	}
+}
@@ -3,8 +3,6 @@ package client
 import (
 	"crypto/tls"
 	"fmt"
-
-	"github.com/meszmate/imap-go/wire"
 )
 
 // StartTLS upgrades the connection to TLS.
@@ -27,11 +25,16 @@ func (c *Client) StartTLS(config *tls.Config) error {
 		return fmt.Errorf("TLS handshake: %w", err)
 	}
 
+	c.writeMu.Lock()
 	c.mu.Lock()
 	c.conn = tlsConn
-	c.encoder = wire.NewEncoder(tlsConn)
-	c.decoder = wire.NewDecoder(tlsConn)
+	c.encoder, c.decoder = c.newWire(tlsConn)
+	// Capabilities learned before TLS must be discarded (RFC 3501
+	// section 6.2.1); EnsureCaps requests them again.
+	c.caps = nil
+	c.capsGen++
 	c.mu.Unlock()
+	c.writeMu.Unlock()
 
 	// Re-start the reader with the new decoder
 	c.reader = newReader(c.decoder, c)
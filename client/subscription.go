@@ -0,0 +1,105 @@
+package client
+
+import (
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// ListSubscribed lists subscribed mailboxes matching the given reference and
+// pattern. If the server supports LIST-EXTENDED (RFC 5258), LIST (SUBSCRIBED)
+// is used; otherwise the command falls back to LSUB.
+func (c *Client) ListSubscribed(ref, pattern string) ([]*imap.ListData, error) {
+	if c.Supports(imap.CapListExtended) {
+		return c.ListMailboxesExtended(ref, []string{pattern}, &imap.ListOptions{
+			SelectSubscribed: true,
+		})
+	}
+	return c.lsub(ref, pattern)
+}
+
+// lsub issues an LSUB command. The reader stores LSUB responses in the same
+// form as LIST responses, so they share the parser.
+func (c *Client) lsub(ref, pattern string) ([]*imap.ListData, error) {
+	c.collectUntagged()
+
+	result, err := c.execute("LSUB", quoteArg(ref), quoteArg(pattern))
+	if err != nil {
+		return nil, err
+	}
+	if err := commandResultError(result); err != nil {
+		return nil, err
+	}
+
+	var mailboxes []*imap.ListData
+	for _, line := range c.collectUntagged() {
+		if strings.HasPrefix(line, "LIST ") {
+			if data := parseListResponse(line[5:]); data != nil {
+				mailboxes = append(mailboxes, data)
+			}
+		}
+	}
+	return mailboxes, nil
+}
+
+// SubscriptionSyncResult reports the changes made by SyncSubscriptions.
+type SubscriptionSyncResult struct {
+	// Subscribed lists mailboxes that were subscribed.
+	Subscribed []string
+	// Unsubscribed lists mailboxes that were unsubscribed.
+	Unsubscribed []string
+}
+
+// SyncSubscriptions reconciles the server's subscription list with the
+// desired set of mailbox names. Mailboxes in desired that are not subscribed
+// are subscribed, and subscribed mailboxes not in desired are unsubscribed.
+// INBOX is compared case-insensitively.
+//
+// Changes made before an error is encountered are reported in the result.
+func (c *Client) SyncSubscriptions(desired []string) (*SubscriptionSyncResult, error) {
+	current, err := c.ListSubscribed("", "*")
+	if err != nil {
+		return nil, err
+	}
+
+	have := make(map[string]bool, len(current))
+	for _, data := range current {
+		have[subscriptionKey(data.Mailbox)] = true
+	}
+	want := make(map[string]bool, len(desired))
+	for _, name := range desired {
+		want[subscriptionKey(name)] = true
+	}
+
+	result := &SubscriptionSyncResult{}
+	for _, name := range desired {
+		key := subscriptionKey(name)
+		if have[key] {
+			continue
+		}
+		if err := c.Subscribe(name); err != nil {
+			return result, err
+		}
+		have[key] = true
+		result.Subscribed = append(result.Subscribed, name)
+	}
+	for _, data := range current {
+		if want[subscriptionKey(data.Mailbox)] {
+			continue
+		}
+		if err := c.Unsubscribe(data.Mailbox); err != nil {
+			return result, err
+		}
+		result.Unsubscribed = append(result.Unsubscribed, data.Mailbox)
+	}
+
+	return result, nil
+}
+
+// subscriptionKey returns the comparison key for a mailbox name.
+func subscriptionKey(name string) string {
+	if strings.EqualFold(name, "INBOX") {
+		return "INBOX"
+	}
+	return name
+}
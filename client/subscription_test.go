@@ -0,0 +1,81 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestListSubscribedFallsBackToLSUB(t *testing.T) {
+	var got []string
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1] ready", func(w io.Writer, tag, cmd string) {
+		got = append(got, cmd)
+		fmt.Fprint(w, `* LSUB () "/" INBOX`+"\r\n")
+		fmt.Fprint(w, `* LSUB () "/" "Sent Items"`+"\r\n")
+		fmt.Fprintf(w, "%s OK LSUB completed\r\n", tag)
+	})
+
+	mailboxes, err := c.ListSubscribed("", "*")
+	if err != nil {
+		t.Fatalf("ListSubscribed() error: %v", err)
+	}
+	if len(got) != 1 || !strings.HasPrefix(got[0], "LSUB ") {
+		t.Fatalf("commands = %q, want a single LSUB", got)
+	}
+	if len(mailboxes) != 2 || mailboxes[1].Mailbox != "Sent Items" {
+		t.Fatalf("mailboxes = %+v", mailboxes)
+	}
+}
+
+func TestListSubscribedUsesListExtended(t *testing.T) {
+	var got []string
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1 LIST-EXTENDED] ready", func(w io.Writer, tag, cmd string) {
+		got = append(got, cmd)
+		fmt.Fprint(w, `* LIST (\Subscribed) "/" INBOX`+"\r\n")
+		fmt.Fprintf(w, "%s OK LIST completed\r\n", tag)
+	})
+
+	if _, err := c.ListSubscribed("", "*"); err != nil {
+		t.Fatalf("ListSubscribed() error: %v", err)
+	}
+	if len(got) != 1 || !strings.HasPrefix(got[0], "LIST (SUBSCRIBED) ") {
+		t.Fatalf("commands = %q, want LIST (SUBSCRIBED)", got)
+	}
+}
+
+func TestSyncSubscriptions(t *testing.T) {
+	var mu sync.Mutex
+	var changes []string
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		switch {
+		case strings.HasPrefix(cmd, "LSUB "):
+			fmt.Fprint(w, `* LSUB () "/" inbox`+"\r\n")
+			fmt.Fprint(w, `* LSUB () "/" Old`+"\r\n")
+		default:
+			mu.Lock()
+			changes = append(changes, cmd)
+			mu.Unlock()
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+
+	result, err := c.SyncSubscriptions([]string{"INBOX", "Archive"})
+	if err != nil {
+		t.Fatalf("SyncSubscriptions() error: %v", err)
+	}
+	if len(result.Subscribed) != 1 || result.Subscribed[0] != "Archive" {
+		t.Errorf("Subscribed = %q, want [Archive]", result.Subscribed)
+	}
+	if len(result.Unsubscribed) != 1 || result.Unsubscribed[0] != "Old" {
+		t.Errorf("Unsubscribed = %q, want [Old]", result.Unsubscribed)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"SUBSCRIBE Archive", "UNSUBSCRIBE Old"}
+	if strings.Join(changes, ",") != strings.Join(want, ",") {
+		t.Errorf("commands = %q, want %q", changes, want)
+	}
+}
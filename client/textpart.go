@@ -0,0 +1,87 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/textproto"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// UIDFetchText fetches a body part of a message and returns it decoded to
+// UTF-8 text, ready for display: the Content-Transfer-Encoding is removed
+// and the charset converted, see DecodeText. part is a part number such
+// as "1" or "1.2"; if empty, the body of the whole message is returned,
+// which is what a message without MIME parts needs. The part and its MIME
+// header are fetched with BODY.PEEK, so the \Seen flag is not set.
+func (c *Client) UIDFetchText(uid imap.UID, part string) (io.Reader, error) {
+	header := &imap.FetchItemBodySection{Specifier: "HEADER", Peek: true}
+	body := &imap.FetchItemBodySection{Specifier: "TEXT", Peek: true}
+	if part != "" {
+		var err error
+		if body, err = imap.ParseFetchItemBodySection("BODY.PEEK[" + part + "]"); err != nil || body.Specifier != "" {
+			return nil, fmt.Errorf("imap: invalid part number %q", part)
+		}
+		header = &imap.FetchItemBodySection{Part: body.Part, Specifier: "MIME", Peek: true}
+	}
+	msgs, err := c.UIDFetchMessages(fmt.Sprint(uid), "("+header.String()+" "+body.String()+")")
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		if msg.UID != uid {
+			continue
+		}
+		h := parseHeaderBlock(bodySection(msg, header.SectionSpec()))
+		return c.DecodeText(h, bytes.NewReader(bodySection(msg, body.SectionSpec())))
+	}
+	return nil, fmt.Errorf("%w: %d", ErrNoSuchMessage, uid)
+}
+
+// DecodeText returns a reader that decodes the content of a body part
+// with the MIME header h to UTF-8. It is a pipeline of two stages: the
+// Content-Transfer-Encoding is decoded with imap.NewTransferDecoder, and
+// then, for text parts, the charset parameter of the Content-Type is
+// converted with the CharsetReader of the client options, if set, and
+// imap.NewCharsetReader otherwise or when it does not know the charset.
+// The part is streamed through the pipeline rather than read up front.
+// Parts of other media types are only transfer-decoded.
+func (c *Client) DecodeText(h textproto.MIMEHeader, r io.Reader) (io.Reader, error) {
+	r, err := imap.NewTransferDecoder(h.Get("Content-Transfer-Encoding"), r)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		// RFC 2045 §5.2: a missing or invalid Content-Type means
+		// text/plain; charset=us-ascii.
+		mediaType, params = "text/plain", nil
+	}
+	if !strings.HasPrefix(mediaType, "text/") {
+		return r, nil
+	}
+	charset := params["charset"]
+	if fn := c.options.CharsetReader; fn != nil {
+		cr, err := fn(charset, r)
+		if !errors.Is(err, imap.ErrUnknownCharset) {
+			return cr, err
+		}
+	}
+	return imap.NewCharsetReader(charset, r)
+}
+
+// bodySection returns a fetched body section, whose name the server may
+// have sent in another case.
+func bodySection(msg *imap.FetchMessageBuffer, section string) []byte {
+	for name, b := range msg.BodySection {
+		if strings.EqualFold(name, section) {
+			return b
+		}
+	}
+	return nil
+}
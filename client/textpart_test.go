@@ -0,0 +1,77 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestUIDFetchText(t *testing.T) {
+	mimeHeader := "Content-Type: text/plain; charset=ISO-8859-1\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n"
+	body := "Caf=E9 au lait=\r\n, s'il vous pla=EEt"
+
+	var gotCmd string
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		gotCmd = cmd
+		fmt.Fprintf(w, "* 3 FETCH (UID 42 BODY[1.MIME] {%d}\r\n%s BODY[1] {%d}\r\n%s)\r\n", len(mimeHeader), mimeHeader, len(body), body)
+		fmt.Fprintf(w, "%s OK FETCH completed\r\n", tag)
+	})
+
+	r, err := c.UIDFetchText(42, "1")
+	if err != nil {
+		t.Fatalf("UIDFetchText() error: %v", err)
+	}
+	if want := "UID FETCH 42 (BODY.PEEK[1.MIME] BODY.PEEK[1])"; gotCmd != want {
+		t.Errorf("command = %q, want %q", gotCmd, want)
+	}
+	b, _ := io.ReadAll(r)
+	if want := "Café au lait, s'il vous plaît"; string(b) != want {
+		t.Errorf("text = %q, want %q", b, want)
+	}
+
+	if _, err := c.UIDFetchText(7, "1"); !errors.Is(err, ErrNoSuchMessage) {
+		t.Errorf("UIDFetchText() of a missing message = %v, want ErrNoSuchMessage", err)
+	}
+}
+
+func TestDecodeText_CharsetReader(t *testing.T) {
+	var asked string
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {})
+	c.options.CharsetReader = func(charset string, r io.Reader) (io.Reader, error) {
+		asked = charset
+		if charset != "GBK" {
+			return nil, imap.ErrUnknownCharset
+		}
+		return strings.NewReader("你好"), nil
+	}
+
+	header := func(contentType string) map[string][]string {
+		return map[string][]string{"Content-Type": {contentType}, "Content-Transfer-Encoding": {"base64"}}
+	}
+	r, err := c.DecodeText(header("text/plain; charset=GBK"), strings.NewReader("xOO6ww=="))
+	if err != nil {
+		t.Fatalf("DecodeText() error: %v", err)
+	}
+	if b, _ := io.ReadAll(r); string(b) != "你好" {
+		t.Errorf("GBK text = %q", b)
+	}
+
+	// Charsets unknown to the CharsetReader use the built-in ones.
+	r, err = c.DecodeText(header("text/html; charset=windows-1252"), strings.NewReader("gA=="))
+	if err != nil {
+		t.Fatalf("DecodeText() error: %v", err)
+	}
+	if b, _ := io.ReadAll(r); string(b) != "€" || asked != "windows-1252" {
+		t.Errorf("windows-1252 text = %q, CharsetReader asked for %q", b, asked)
+	}
+
+	// Other media types are only transfer-decoded.
+	r, _ = c.DecodeText(header("image/png"), strings.NewReader("gA=="))
+	if b, _ := io.ReadAll(r); string(b) != "\x80" {
+		t.Errorf("image data = %q", b)
+	}
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// ResponseCodeThrottled is the response code some providers, such as
+// Gmail and Yahoo, send with NO and BYE responses when a client exceeds
+// their rate or bandwidth limits. It is not standardized.
+const ResponseCodeThrottled imap.ResponseCode = "THROTTLED"
+
+// DefaultRetryAfter is how long a RetryAfterError asks to wait when the
+// server does not suggest a delay.
+const DefaultRetryAfter = 5 * time.Second
+
+// RetryAfterError is returned when the server throttles the client: it
+// answered a command or the connection with NO or BYE and a throttling
+// signal, such as the [THROTTLED] response code, [LIMIT] with a rate
+// limit text or "Too many simultaneous connections". The operation may
+// succeed if it is retried after After, with fewer concurrent
+// connections.
+//
+// Err is the underlying error, usually an *imap.IMAPError, so that
+// errors.As finds it.
+type RetryAfterError struct {
+	// After is the delay the server suggested, or DefaultRetryAfter.
+	After time.Duration
+	Err   error
+}
+
+// Error returns the message of the underlying error.
+func (e *RetryAfterError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfter reports whether err is or wraps a RetryAfterError and if so
+// how long to wait before retrying.
+func RetryAfter(err error) (time.Duration, bool) {
+	var retryErr *RetryAfterError
+	if !errors.As(err, &retryErr) {
+		return 0, false
+	}
+	return retryErr.After, true
+}
+
+// throttleTexts are lower-case fragments of the texts providers send with
+// NO and BYE responses when they throttle a client.
+var throttleTexts = []string{
+	"too many simultaneous connections",
+	"too many concurrent connections",
+	"too many connections",
+	"too many requests",
+	"exceeded command or bandwidth limits",
+	"bandwidth limit exceeded",
+	"rate limit",
+	"throttl",
+}
+
+// retryAfterPattern matches the delays providers suggest in their texts,
+// such as Outlook's "Suggested Backoff Time: 35 milliseconds".
+var retryAfterPattern = regexp.MustCompile(`(?i)(?:backoff time|retry after|try again in)\W*(\d+)\s*(milliseconds?|ms|seconds?|secs?|s|minutes?|mins?)\b`)
+
+// throttleDelay reports whether a NO or BYE response with the given code
+// and text throttles the client, and if so how long to wait. [LIMIT] is
+// only taken as throttling with a throttling text, as RFC 5530 uses it for
+// other limits too, such as the number of flags in a mailbox.
+func throttleDelay(code imap.ResponseCode, text string) (time.Duration, bool) {
+	throttled := strings.EqualFold(string(code), string(ResponseCodeThrottled))
+	if !throttled {
+		lower := strings.ToLower(text)
+		for _, t := range throttleTexts {
+			if strings.Contains(lower, t) {
+				throttled = true
+				break
+			}
+		}
+	}
+	if !throttled {
+		return 0, false
+	}
+
+	m := retryAfterPattern.FindStringSubmatch(text)
+	if m == nil {
+		return DefaultRetryAfter, true
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n <= 0 {
+		return DefaultRetryAfter, true
+	}
+	unit := time.Second
+	switch u := strings.ToLower(m[2]); {
+	case u == "ms" || strings.HasPrefix(u, "milli"):
+		unit = time.Millisecond
+	case strings.HasPrefix(u, "min"):
+		unit = time.Minute
+	}
+	return time.Duration(n) * unit, true
+}
+
+// throttleError wraps a NO or BYE status response error in a
+// RetryAfterError if the response throttles the client.
+func throttleError(err *imap.IMAPError) error {
+	if err.Type != imap.StatusResponseTypeNO && err.Type != imap.StatusResponseTypeBYE {
+		return err
+	}
+	if after, ok := throttleDelay(err.Code, err.Text); ok {
+		return &RetryAfterError{After: after, Err: err}
+	}
+	return err
+}
+
+// greetingByeError returns the error for a BYE greeting line, wrapped in a
+// RetryAfterError if the server refused the connection because of
+// throttling.
+func greetingByeError(line string) error {
+	err := fmt.Errorf("server rejected connection: %s", line)
+
+	rest := strings.TrimSpace(strings.TrimPrefix(line, "* BYE"))
+	var code imap.ResponseCode
+	if strings.HasPrefix(rest, "[") {
+		if end := strings.IndexByte(rest, ']'); end > 0 {
+			if fields := strings.Fields(rest[1:end]); len(fields) > 0 {
+				code = imap.ResponseCode(strings.ToUpper(fields[0]))
+			}
+			rest = strings.TrimSpace(rest[end+1:])
+		}
+	}
+	if after, ok := throttleDelay(code, rest); ok {
+		return &RetryAfterError{After: after, Err: err}
+	}
+	return err
+}
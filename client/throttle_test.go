@@ -0,0 +1,77 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestThrottleDelay(t *testing.T) {
+	tests := []struct {
+		code imap.ResponseCode
+		text string
+		want time.Duration
+		ok   bool
+	}{
+		{ResponseCodeThrottled, "Account exceeded command or bandwidth limits", DefaultRetryAfter, true},
+		{"throttled", "slow down", DefaultRetryAfter, true},
+		{imap.ResponseCodeLimit, "Too many simultaneous connections. (Failure)", DefaultRetryAfter, true},
+		{"", "Request is throttled. Suggested Backoff Time: 35 milliseconds", 35 * time.Millisecond, true},
+		{"", "Rate limit reached, try again in 2 minutes", 2 * time.Minute, true},
+		{imap.ResponseCodeLimit, "At most 32 flags in one mailbox supported", 0, false},
+		{imap.ResponseCodeUnavailable, "try later", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := throttleDelay(tt.code, tt.text)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("throttleDelay(%q, %q) = %v, %v, want %v, %v", tt.code, tt.text, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestClient_Throttled(t *testing.T) {
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		switch cmd {
+		case "NOOP":
+			fmt.Fprintf(w, "%s NO [THROTTLED] Suggested Backoff Time: 250 milliseconds\r\n", tag)
+		default:
+			fmt.Fprintf(w, "%s BAD [THROTTLED] not a throttle\r\n", tag)
+		}
+	})
+
+	err := c.Noop()
+	after, ok := RetryAfter(err)
+	if !ok || after != 250*time.Millisecond {
+		t.Errorf("RetryAfter(%v) = %v, %v", err, after, ok)
+	}
+	var imapErr *imap.IMAPError
+	if !errors.As(err, &imapErr) || imapErr.Code != ResponseCodeThrottled {
+		t.Errorf("Noop() error = %#v, want the NO response", err)
+	}
+	if !IsTransient(err) {
+		t.Error("throttling is not transient")
+	}
+
+	if _, ok := RetryAfter(c.Expunge()); ok {
+		t.Error("a BAD response is taken as throttling")
+	}
+}
+
+func TestNew_ThrottledGreeting(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go func() {
+		fmt.Fprint(serverConn, "* BYE [UNAVAILABLE] Too many simultaneous connections\r\n")
+		_ = serverConn.Close()
+	}()
+
+	_, err := New(clientConn)
+	if after, ok := RetryAfter(err); !ok || after != DefaultRetryAfter {
+		t.Errorf("New() error = %v, want throttling", err)
+	}
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// ErrUIDExpungeUnsupported is returned by ExpungeUIDs if the server does
+// not support UID EXPUNGE and the client was created with
+// WithUIDExpungeFallback(UIDExpungeRefuse).
+var ErrUIDExpungeUnsupported = errors.New("imap: server does not support UID EXPUNGE")
+
+// ErrOtherMessagesDeleted is returned by ExpungeUIDs in UIDExpungeIfNoOthers
+// mode if messages outside the set are flagged \Deleted, which an EXPUNGE
+// would remove as well.
+var ErrOtherMessagesDeleted = errors.New(`imap: other messages are flagged \Deleted`)
+
+// UIDExpungeFallback is how ExpungeUIDs removes messages from a mailbox on
+// servers without UIDPLUS (RFC 4315), whose EXPUNGE removes all the
+// messages flagged \Deleted rather than those of a UID set.
+type UIDExpungeFallback int
+
+const (
+	// UIDExpungeClearOthers removes the \Deleted flag from the other
+	// messages that have it, expunges, and flags them \Deleted again,
+	// even if EXPUNGE failed.
+	//
+	// Other clients can see the flag removed until it is restored, and a
+	// message another client flags \Deleted after the flags were cleared
+	// and before the EXPUNGE is removed along with the set. If the
+	// connection breaks before the flags are restored, the other messages
+	// stay without \Deleted: they are kept rather than lost.
+	UIDExpungeClearOthers UIDExpungeFallback = iota
+	// UIDExpungeIfNoOthers expunges only if no other message is flagged
+	// \Deleted, and returns ErrOtherMessagesDeleted otherwise. A message
+	// another client flags \Deleted between the check and the EXPUNGE is
+	// removed along with the set.
+	UIDExpungeIfNoOthers
+	// UIDExpungeRefuse does not emulate UID EXPUNGE: ExpungeUIDs returns
+	// ErrUIDExpungeUnsupported.
+	UIDExpungeRefuse
+)
+
+// String returns the name of the fallback.
+func (f UIDExpungeFallback) String() string {
+	switch f {
+	case UIDExpungeClearOthers:
+		return "UIDExpungeClearOthers"
+	case UIDExpungeIfNoOthers:
+		return "UIDExpungeIfNoOthers"
+	case UIDExpungeRefuse:
+		return "UIDExpungeRefuse"
+	default:
+		return "UIDExpungeFallback(?)"
+	}
+}
+
+// ExpungeUIDs permanently removes the messages of uidSet that are flagged
+// \Deleted from the selected mailbox, leaving the other messages flagged
+// \Deleted in place. It sends UID EXPUNGE if the server supports UIDPLUS,
+// and otherwise emulates it with UID SEARCH, UID STORE and EXPUNGE as
+// chosen with WithUIDExpungeFallback, UIDExpungeClearOthers by default.
+// See UIDExpungeFallback for the race each emulation leaves open.
+func (c *Client) ExpungeUIDs(uidSet string) error {
+	if c.SupportsUIDPlus() {
+		return c.UIDExpunge(uidSet)
+	}
+	return c.emulateUIDExpunge(uidSet, func(string) {})
+}
+
+// emulateUIDExpunge expunges the messages of uidSet flagged \Deleted
+// without UID EXPUNGE, calling sent with each command before sending it.
+func (c *Client) emulateUIDExpunge(uidSet string, sent func(cmd string)) (err error) {
+	fallback := c.options.UIDExpungeFallback
+	if fallback == UIDExpungeRefuse {
+		return ErrUIDExpungeUnsupported
+	}
+
+	criteria := uidExpungeCriteria(uidSet)
+	sent("UID SEARCH " + criteria)
+	uids, err := c.UIDSearch(criteria)
+	if err != nil {
+		return err
+	}
+	if len(uids) > 0 {
+		if fallback == UIDExpungeIfNoOthers {
+			return fmt.Errorf("%w: %d messages", ErrOtherMessagesDeleted, len(uids))
+		}
+		set := &imap.UIDSet{}
+		for _, uid := range uids {
+			set.AddNum(imap.UID(uid))
+		}
+		set.Normalize()
+		others := set.String()
+		deleted := []imap.Flag{imap.FlagDeleted}
+
+		sent("UID STORE " + others + ` -FLAGS.SILENT (\Deleted)`)
+		if err := c.UIDStore(others, imap.StoreFlagsDel, deleted, true); err != nil {
+			return err
+		}
+		defer func() {
+			sent("UID STORE " + others + ` +FLAGS.SILENT (\Deleted)`)
+			if rerr := c.UIDStore(others, imap.StoreFlagsAdd, deleted, true); rerr != nil && err == nil {
+				err = fmt.Errorf("imap: restoring \\Deleted on %s: %w", others, rerr)
+			}
+		}()
+	}
+
+	sent("EXPUNGE")
+	return c.Expunge()
+}
+
+// uidExpungeCriteria returns the search criteria matching the messages an
+// EXPUNGE would remove besides those of uidSet.
+func uidExpungeCriteria(uidSet string) string {
+	return "DELETED NOT UID " + uidSet
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newExpungeClient returns a client of a server without UIDPLUS, with a
+// selected mailbox where the messages with UIDs 7 and 9 are flagged
+// \Deleted besides those being expunged, and a function returning the
+// commands it received. EXPUNGE fails if failExpunge is set.
+func newExpungeClient(t *testing.T, caps string, failExpunge bool, opts ...Option) (*Client, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var cmds []string
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1 "+caps+"] ready", func(w io.Writer, tag, cmd string) {
+		mu.Lock()
+		cmds = append(cmds, cmd)
+		mu.Unlock()
+		switch {
+		case strings.HasPrefix(cmd, "SELECT"):
+			fmt.Fprint(w, "* 9 EXISTS\r\n* OK [UIDVALIDITY 7] ok\r\n")
+		case strings.HasPrefix(cmd, "UID SEARCH"):
+			fmt.Fprint(w, "* SEARCH 9 7\r\n")
+		case cmd == "EXPUNGE" && failExpunge:
+			fmt.Fprintf(w, "%s NO expunge failed\r\n", tag)
+			return
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	}, opts...)
+	if _, err := c.Select("INBOX", nil); err != nil {
+		t.Fatalf("Select() error: %v", err)
+	}
+	return c, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		got := cmds[1:]
+		cmds = cmds[:1]
+		return got
+	}
+}
+
+func TestExpungeUIDs(t *testing.T) {
+	c, sent := newExpungeClient(t, "UIDPLUS", false)
+	if err := c.ExpungeUIDs("1:3"); err != nil {
+		t.Fatalf("ExpungeUIDs() error: %v", err)
+	}
+	if got, want := sent(), []string{"UID EXPUNGE 1:3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+}
+
+func TestExpungeUIDs_ClearOthers(t *testing.T) {
+	c, sent := newExpungeClient(t, "", false)
+	if err := c.ExpungeUIDs("1:3"); err != nil {
+		t.Fatalf("ExpungeUIDs() error: %v", err)
+	}
+	want := []string{
+		"UID SEARCH DELETED NOT UID 1:3",
+		`UID STORE 7,9 -FLAGS.SILENT (\Deleted)`,
+		"EXPUNGE",
+		`UID STORE 7,9 +FLAGS.SILENT (\Deleted)`,
+	}
+	if got := sent(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+}
+
+func TestExpungeUIDs_RestoreAfterFailure(t *testing.T) {
+	c, sent := newExpungeClient(t, "", true)
+	if err := c.ExpungeUIDs("1:3"); err == nil {
+		t.Fatal("ExpungeUIDs() succeeded although EXPUNGE failed")
+	}
+	if got := sent(); len(got) != 4 || got[3] != `UID STORE 7,9 +FLAGS.SILENT (\Deleted)` {
+		t.Errorf("sent %q, want the flags restored last", got)
+	}
+}
+
+func TestExpungeUIDs_Fallbacks(t *testing.T) {
+	c, sent := newExpungeClient(t, "", false, WithUIDExpungeFallback(UIDExpungeIfNoOthers))
+	if err := c.ExpungeUIDs("1:3"); !errors.Is(err, ErrOtherMessagesDeleted) {
+		t.Errorf("ExpungeUIDs() error = %v, want ErrOtherMessagesDeleted", err)
+	}
+	if got, want := sent(), []string{"UID SEARCH DELETED NOT UID 1:3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+
+	c, sent = newExpungeClient(t, "", false, WithUIDExpungeFallback(UIDExpungeRefuse))
+	if err := c.ExpungeUIDs("1:3"); !errors.Is(err, ErrUIDExpungeUnsupported) {
+		t.Errorf("ExpungeUIDs() error = %v, want ErrUIDExpungeUnsupported", err)
+	}
+	if got := sent(); len(got) != 0 {
+		t.Errorf("sent %q, want nothing", got)
+	}
+}
@@ -0,0 +1,244 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// DefaultUploadChunkSize is the default size of the chunks sent by
+// AppendResumable.
+const DefaultUploadChunkSize = 4 << 20
+
+// Upload records the progress of a resumable append, so that it can be
+// resumed on a new connection after the connection was lost.
+type Upload struct {
+	// Token identifies the upload on the server. It is empty until the
+	// upload is created, and again once the message was appended.
+	Token string
+	// Offset is the number of bytes acknowledged by the server.
+	Offset int64
+}
+
+// ResumableAppendOptions are options for AppendResumable.
+type ResumableAppendOptions struct {
+	// Flags are set on the message.
+	Flags []imap.Flag
+	// InternalDate is the internal date of the message. If zero, the
+	// server uses the current time.
+	InternalDate time.Time
+	// ChunkSize is the number of bytes sent with each command. The default
+	// is DefaultUploadChunkSize.
+	ChunkSize int64
+	// Upload records the progress of the upload. If its Token is set, the
+	// upload it identifies is resumed from the offset the server
+	// acknowledged.
+	Upload *Upload
+	// Progress, if set, is called after each acknowledged chunk with the
+	// number of bytes stored by the server.
+	Progress func(sent, total int64)
+}
+
+// AppendResumable appends the size bytes of r to a mailbox. If the server
+// advertises XUPLOAD, the message is uploaded in chunks that the server
+// keeps across connections, and options.Upload records the progress: if
+// the connection is lost, calling AppendResumable again on a new
+// connection with the same Upload sends only the bytes the server did not
+// acknowledge.
+//
+//	up := &client.Upload{}
+//	for {
+//		data, err := c.AppendResumable("INBOX", f, size, &client.ResumableAppendOptions{Upload: up})
+//		if err == nil || !client.IsTransient(err) {
+//			return data, err
+//		}
+//		c = reconnect()
+//	}
+//
+// Otherwise, the message is sent with a plain APPEND, so that an
+// interrupted append starts again from the beginning.
+func (c *Client) AppendResumable(mailbox string, r io.ReaderAt, size int64, options *ResumableAppendOptions) (*imap.AppendData, error) {
+	if options == nil {
+		options = &ResumableAppendOptions{}
+	}
+	caps, err := c.EnsureCaps()
+	if err != nil {
+		return nil, err
+	}
+	if !imap.ParseCapabilities(strings.Join(caps, " ")).Has(imap.Cap("XUPLOAD")) {
+		literal := make([]byte, size)
+		if _, err := io.ReadFull(io.NewSectionReader(r, 0, size), literal); err != nil {
+			return nil, fmt.Errorf("reading message: %w", err)
+		}
+		data, err := c.MultiAppend(mailbox, []AppendMessage{{
+			Flags:        options.Flags,
+			InternalDate: options.InternalDate,
+			Literal:      literal,
+		}})
+		if err != nil {
+			return nil, err
+		}
+		return data[0], nil
+	}
+
+	up := options.Upload
+	if up == nil {
+		up = &Upload{}
+	}
+	if up.Token != "" {
+		offset, err := c.uploadCommand("STATUS", up.Token)
+		switch {
+		case err == nil:
+			up.Offset = offset
+		case isResponseCode(err, imap.ResponseCodeNonExistent):
+			// The upload expired: start again
+			up.Token, up.Offset = "", 0
+		default:
+			return nil, err
+		}
+	}
+	if up.Token == "" {
+		c.collectUntagged()
+		result, err := c.execute("XUPLOAD", "BEGIN", strconv.FormatInt(size, 10))
+		if err != nil {
+			return nil, err
+		}
+		if err := commandResultError(result); err != nil {
+			return nil, err
+		}
+		token, _, ok := uploadStatus(c.collectUntagged())
+		if !ok {
+			return nil, errors.New("imap: missing XUPLOAD response")
+		}
+		up.Token, up.Offset = token, 0
+	}
+
+	chunkSize := options.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultUploadChunkSize
+	}
+	buf := make([]byte, min(chunkSize, size))
+	for up.Offset < size {
+		chunk := buf[:min(chunkSize, size-up.Offset)]
+		if _, err := io.ReadFull(io.NewSectionReader(r, up.Offset, int64(len(chunk))), chunk); err != nil {
+			return nil, fmt.Errorf("reading message: %w", err)
+		}
+		offset, err := c.uploadData(up.Token, up.Offset, chunk)
+		if err != nil {
+			return nil, err
+		}
+		up.Offset = offset
+		if options.Progress != nil {
+			options.Progress(offset, size)
+		}
+	}
+
+	args := []string{"FINISH", up.Token, quoteArg(mailbox)}
+	if len(options.Flags) > 0 {
+		flags := make([]string, len(options.Flags))
+		for i, f := range options.Flags {
+			flags[i] = string(f)
+		}
+		args = append(args, "("+strings.Join(flags, " ")+")")
+	}
+	if !options.InternalDate.IsZero() {
+		args = append(args, `"`+options.InternalDate.Format(imap.InternalDateLayout)+`"`)
+	}
+	result, err := c.execute("XUPLOAD", args...)
+	if err != nil {
+		return nil, err
+	}
+	if err := commandResultError(result); err != nil {
+		return nil, err
+	}
+	up.Token, up.Offset = "", 0
+
+	data := &imap.AppendData{}
+	if strings.HasPrefix(result.code, "APPENDUID ") {
+		parts := strings.Fields(result.code[10:])
+		if len(parts) == 2 {
+			uidValidity, _ := strconv.ParseUint(parts[0], 10, 32)
+			uid, _ := strconv.ParseUint(parts[1], 10, 32)
+			data.UIDValidity, data.UID = uint32(uidValidity), imap.UID(uid)
+		}
+	}
+	return data, nil
+}
+
+// uploadCommand sends an XUPLOAD command on an upload and returns the
+// offset acknowledged by the server.
+func (c *Client) uploadCommand(op, token string) (int64, error) {
+	c.collectUntagged()
+	result, err := c.execute("XUPLOAD", op, token)
+	if err != nil {
+		return 0, err
+	}
+	if err := commandResultError(result); err != nil {
+		return 0, err
+	}
+	_, offset, ok := uploadStatus(c.collectUntagged())
+	if !ok {
+		return 0, errors.New("imap: missing XUPLOAD response")
+	}
+	return offset, nil
+}
+
+// uploadData sends a chunk of an upload at offset and returns the offset
+// acknowledged by the server.
+func (c *Client) uploadData(token string, offset int64, chunk []byte) (int64, error) {
+	c.collectUntagged()
+	tag := c.tags.Next()
+	line := fmt.Sprintf("%s XUPLOAD DATA %s %d {%d}\r\n", tag, token, offset, len(chunk))
+	cmd, err := c.send(tag, "XUPLOAD", line, true)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := c.waitForContinuation(cmd); err != nil {
+		c.release()
+		return 0, err
+	}
+	err = c.writeContinuation(chunk, []byte("\r\n"))
+	c.release()
+	if err != nil {
+		return 0, err
+	}
+
+	result := <-cmd.done
+	if err := commandResultError(result); err != nil {
+		return 0, err
+	}
+	_, acked, ok := uploadStatus(c.collectUntagged())
+	if !ok {
+		return 0, errors.New("imap: missing XUPLOAD response")
+	}
+	return acked, nil
+}
+
+// uploadStatus returns the token and offset of the last XUPLOAD response
+// among untagged responses.
+func uploadStatus(untagged []string) (token string, offset int64, ok bool) {
+	for _, line := range untagged {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || !strings.EqualFold(fields[0], "XUPLOAD") {
+			continue
+		}
+		n, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		token, offset, ok = fields[1], n, true
+	}
+	return token, offset, ok
+}
+
+// isResponseCode reports whether err is a status response with the given
+// response code.
+func isResponseCode(err error, code imap.ResponseCode) bool {
+	var imapErr *imap.IMAPError
+	return errors.As(err, &imapErr) && imapErr.StatusResponse != nil && imapErr.Code == code
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAppendResumable_Expired(t *testing.T) {
+	var mu sync.Mutex
+	var cmds []string
+	var dataTag string
+	var offset int
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1 XUPLOAD] ready", func(w io.Writer, tag, cmd string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if dataTag != "" {
+			// The chunk, which has no line breaks
+			cmds = append(cmds, "chunk "+tag)
+			offset += len(tag)
+			fmt.Fprintf(w, "* XUPLOAD t2 %d\r\n", offset)
+			fmt.Fprintf(w, "%s OK done\r\n", dataTag)
+			dataTag = ""
+			return
+		}
+		cmds = append(cmds, cmd)
+		switch {
+		case cmd == "XUPLOAD STATUS t1":
+			fmt.Fprintf(w, "%s NO [NONEXISTENT] no such upload\r\n", tag)
+			return
+		case cmd == "XUPLOAD BEGIN 8":
+			fmt.Fprint(w, "* XUPLOAD t2 0\r\n")
+		case strings.HasPrefix(cmd, "XUPLOAD DATA "):
+			dataTag = tag
+			fmt.Fprint(w, "+ Ready\r\n")
+			return
+		case strings.HasPrefix(cmd, "XUPLOAD FINISH "):
+			fmt.Fprintf(w, "%s OK [APPENDUID 7 42] done\r\n", tag)
+			return
+		}
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	})
+
+	up := &Upload{Token: "t1", Offset: 4}
+	data, err := c.AppendResumable("Sent Items", strings.NewReader("abcdefgh"), 8,
+		&ResumableAppendOptions{ChunkSize: 4, Upload: up})
+	if err != nil {
+		t.Fatalf("AppendResumable() error: %v", err)
+	}
+	if data.UIDValidity != 7 || data.UID != 42 {
+		t.Errorf("AppendResumable() = %+v", data)
+	}
+	if *up != (Upload{}) {
+		t.Errorf("Upload = %+v, want zero", up)
+	}
+
+	want := []string{
+		"XUPLOAD STATUS t1",
+		"XUPLOAD BEGIN 8",
+		"XUPLOAD DATA t2 0 {4}",
+		"chunk abcd",
+		"XUPLOAD DATA t2 4 {4}",
+		"chunk efgh",
+		`XUPLOAD FINISH t2 "Sent Items"`,
+	}
+	if strings.Join(cmds, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands = %q, want %q", cmds, want)
+	}
+}
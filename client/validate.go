@@ -0,0 +1,809 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ViolationRule names the grammar rule a server response breaks, see
+// ResponseViolation.
+type ViolationRule string
+
+// Grammar rules checked by ValidateResponse.
+const (
+	// ViolationSyntax is a response that does not parse: an invalid tag,
+	// unbalanced parentheses, a missing space or value, or a response or
+	// data item in the wrong shape.
+	ViolationSyntax ViolationRule = "syntax"
+	// ViolationNil is NIL where it is not allowed, or an empty list where
+	// NIL is required.
+	ViolationNil ViolationRule = "nil"
+	// ViolationNumber is a number that is not a number, is zero where a
+	// non-zero number is required, or is out of range.
+	ViolationNumber ViolationRule = "number"
+	// ViolationFlag is a flag or mailbox attribute that is not an atom, or
+	// \* outside PERMANENTFLAGS.
+	ViolationFlag ViolationRule = "flag"
+	// ViolationString is a quoted string with an invalid escape or a line
+	// break, or a literal announced with "+" or holding NUL.
+	ViolationString ViolationRule = "string"
+	// ViolationDateTime is an INTERNALDATE or SAVEDATE that is not a
+	// quoted date-time.
+	ViolationDateTime ViolationRule = "date-time"
+)
+
+// ResponseViolation is a server response that does not follow the grammar
+// of RFC 9051 and RFC 3501, as reported to Options.ResponseValidator.
+type ResponseViolation struct {
+	// Response is the response, with its literals.
+	Response string
+	// Rule is the rule the response breaks.
+	Rule ViolationRule
+	// Detail describes the violation.
+	Detail string
+}
+
+// Error returns a description of the violation.
+func (v *ResponseViolation) Error() string {
+	resp := v.Response
+	if len(resp) > 80 {
+		resp = resp[:77] + "..."
+	}
+	return fmt.Sprintf("%s: %s in %q", v.Rule, v.Detail, resp)
+}
+
+// validate passes the violations of a server response to the validator of
+// the options, if set.
+func (c *Client) validate(resp string) {
+	fn := c.options.ResponseValidator
+	if fn == nil {
+		return
+	}
+	for _, v := range ValidateResponse(resp) {
+		fn(v)
+	}
+}
+
+// ValidateResponse checks a server response, with its literals as the
+// client reads them, against the IMAP grammar and returns its violations:
+// the syntax of tags, status responses and response codes, the use of
+// NIL, the syntax of flags, strings and dates, and the range of numbers
+// in the responses of RFC 9051 and the common extensions. Responses it
+// does not know are only checked for well-formed strings, literals and
+// parentheses.
+func ValidateResponse(resp string) []*ResponseViolation {
+	p := &respParser{s: resp}
+	p.response()
+	return p.violations
+}
+
+// valueKind is the kind of a respValue.
+type valueKind int
+
+const (
+	valueAtom valueKind = iota
+	valueString
+	valueList
+)
+
+// respValue is a value of a response: an atom, including NIL and
+// numbers, a quoted string or literal, or a parenthesized list.
+type respValue struct {
+	kind   valueKind
+	quoted bool
+	text   string
+	items  []respValue
+}
+
+func (v respValue) isNil() bool {
+	return v.kind == valueAtom && strings.EqualFold(v.text, "NIL")
+}
+
+// Limits of the numbers of the grammar.
+const (
+	maxNumber   = 1<<32 - 1
+	maxNumber64 = 1<<63 - 1
+)
+
+// respParser checks a response, recording its violations.
+type respParser struct {
+	s          string
+	pos        int
+	violations []*ResponseViolation
+}
+
+func (p *respParser) report(rule ViolationRule, format string, args ...any) {
+	p.violations = append(p.violations, &ResponseViolation{
+		Response: p.s,
+		Rule:     rule,
+		Detail:   fmt.Sprintf(format, args...),
+	})
+}
+
+func (p *respParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *respParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+// sp consumes a space, reporting its absence.
+func (p *respParser) sp(after string) bool {
+	if p.peek() != ' ' {
+		p.report(ViolationSyntax, "missing space after %s", after)
+		return false
+	}
+	p.pos++
+	return true
+}
+
+// word reads up to the next space or one of stop.
+func (p *respParser) word(stop string) string {
+	start := p.pos
+	for !p.eof() && p.s[p.pos] != ' ' && strings.IndexByte(stop, p.s[p.pos]) < 0 {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// response checks a whole response.
+func (p *respParser) response() {
+	if strings.HasPrefix(p.s, "+") {
+		if len(p.s) > 1 && p.s[1] != ' ' {
+			p.report(ViolationSyntax, "missing space after +")
+		}
+		return
+	}
+
+	tag := p.word("")
+	if tag != "*" {
+		p.checkTag(tag)
+	}
+	if !p.sp("tag") {
+		return
+	}
+	name := strings.ToUpper(p.word("["))
+	if tag != "*" {
+		switch name {
+		case "OK", "NO", "BAD":
+			p.respText()
+		default:
+			p.report(ViolationSyntax, "tagged response %s is not OK, NO or BAD", name)
+		}
+		return
+	}
+
+	switch name {
+	case "OK", "NO", "BAD", "PREAUTH", "BYE":
+		p.respText()
+	case "CAPABILITY":
+		p.capabilities(p.rest())
+	case "FLAGS":
+		if p.sp(name) {
+			p.flagList(p.value(), "FLAGS", false)
+			p.end()
+		}
+	case "LIST", "LSUB":
+		p.mailboxList(name)
+	case "STATUS":
+		p.status()
+	case "SEARCH", "SORT":
+		p.search(name)
+	default:
+		next, _, _ := strings.Cut(strings.TrimPrefix(p.s[p.pos:], " "), " ")
+		if isDigits(name) || isMessageData(next) {
+			p.messageData(name)
+			return
+		}
+		p.rest()
+	}
+}
+
+// checkTag checks that tag consists of ASTRING-CHARs other than "+".
+func (p *respParser) checkTag(tag string) {
+	if tag == "" {
+		p.report(ViolationSyntax, "missing tag")
+		return
+	}
+	for i := 0; i < len(tag); i++ {
+		if c := tag[i]; c == '+' || (!isAtomChar(c) && c != ']') {
+			p.report(ViolationSyntax, "invalid character %q in tag", c)
+			return
+		}
+	}
+}
+
+// respText checks the text of a status response and its response code.
+func (p *respParser) respText() {
+	if !p.sp("status") {
+		return
+	}
+	if p.peek() != '[' {
+		return
+	}
+	p.pos++
+	code := strings.ToUpper(p.word("]"))
+	if code == "" {
+		p.report(ViolationSyntax, "empty response code")
+	}
+	var args []respValue
+	if p.peek() == ' ' {
+		p.pos++
+		for !p.eof() && p.peek() != ']' {
+			if len(args) > 0 && !p.sp(code) {
+				break
+			}
+			start := p.pos
+			args = append(args, p.value())
+			if p.pos == start {
+				p.pos++
+			}
+		}
+	}
+	if p.peek() != ']' {
+		p.report(ViolationSyntax, "unterminated response code %s", code)
+		return
+	}
+	p.pos++
+	if !p.eof() {
+		p.sp("response code")
+	}
+	p.respCode(code, args)
+}
+
+// respCode checks the arguments of a response code.
+func (p *respParser) respCode(code string, args []respValue) {
+	arg := func(i int) respValue {
+		if i < len(args) {
+			return args[i]
+		}
+		p.report(ViolationSyntax, "missing argument of %s", code)
+		return respValue{kind: valueAtom, text: "1"}
+	}
+	switch code {
+	case "UIDNEXT", "UIDVALIDITY", "UNSEEN":
+		p.number(arg(0), code, true, maxNumber)
+	case "HIGHESTMODSEQ":
+		p.number(arg(0), code, true, maxNumber64)
+	case "PERMANENTFLAGS":
+		p.flagList(arg(0), code, true)
+	case "APPENDUID":
+		p.number(arg(0), code, true, maxNumber)
+		p.uidSet(arg(1), code)
+	case "COPYUID":
+		p.number(arg(0), code, true, maxNumber)
+		p.uidSet(arg(1), code)
+		p.uidSet(arg(2), code)
+	case "CAPABILITY":
+		p.capabilities(args)
+	}
+}
+
+// messageData checks a response starting with a number, such as EXISTS
+// or FETCH.
+func (p *respParser) messageData(num string) {
+	if !p.sp(num) {
+		return
+	}
+	name := strings.ToUpper(p.word(""))
+	v := respValue{kind: valueAtom, text: num}
+	switch name {
+	case "EXISTS", "RECENT":
+		p.number(v, name, false, maxNumber)
+		p.end()
+	case "EXPUNGE":
+		p.number(v, name, true, maxNumber)
+		p.end()
+	case "FETCH":
+		p.number(v, name, true, maxNumber)
+		if p.sp(name) {
+			p.msgAtt(p.value())
+			p.end()
+		}
+	default:
+		p.rest()
+	}
+}
+
+// msgAtt checks the data items of a FETCH response.
+func (p *respParser) msgAtt(v respValue) {
+	if v.kind != valueList {
+		p.report(ViolationSyntax, "FETCH data is not a list")
+		return
+	}
+	for i := 0; i < len(v.items); i += 2 {
+		item := v.items[i]
+		name := strings.ToUpper(item.text)
+		if item.kind != valueAtom || name == "" {
+			p.report(ViolationSyntax, "FETCH data item name is not an atom")
+			continue
+		}
+		if i+1 >= len(v.items) {
+			p.report(ViolationSyntax, "missing value of %s", name)
+			return
+		}
+		value := v.items[i+1]
+		base, _, _ := strings.Cut(name, "[")
+		switch base {
+		case "FLAGS":
+			p.flagList(value, name, false)
+		case "UID":
+			p.number(value, name, true, maxNumber)
+		case "RFC822.SIZE", "BINARY.SIZE":
+			p.number(value, name, false, maxNumber64)
+		case "MODSEQ":
+			if value.kind != valueList || len(value.items) != 1 {
+				p.report(ViolationSyntax, "MODSEQ is not a list of one mod-sequence")
+			} else {
+				p.number(value.items[0], name, true, maxNumber64)
+			}
+		case "INTERNALDATE":
+			p.dateTime(value, name, false)
+		case "SAVEDATE":
+			p.dateTime(value, name, true)
+		case "ENVELOPE":
+			p.envelope(value)
+		case "BODY", "BODY.PEEK", "BINARY", "RFC822", "RFC822.HEADER", "RFC822.TEXT", "PREVIEW":
+			if base == "BODY" && !strings.Contains(name, "[") {
+				p.list(value, name)
+			} else {
+				p.nstring(value, name)
+			}
+		case "BODYSTRUCTURE":
+			p.list(value, name)
+		case "EMAILID":
+			p.objectID(value, name, false)
+		case "THREADID":
+			p.objectID(value, name, true)
+		}
+	}
+}
+
+// envelope checks an ENVELOPE: date, subject, six address lists,
+// in-reply-to and message-id.
+func (p *respParser) envelope(v respValue) {
+	if v.kind != valueList || len(v.items) != 10 {
+		p.report(ViolationSyntax, "ENVELOPE is not a list of 10 fields")
+		return
+	}
+	p.nstring(v.items[0], "envelope date")
+	p.nstring(v.items[1], "envelope subject")
+	for _, addrs := range v.items[2:8] {
+		if addrs.isNil() {
+			continue
+		}
+		if addrs.kind != valueList {
+			p.report(ViolationSyntax, "envelope address list is not a list or NIL")
+			continue
+		}
+		if len(addrs.items) == 0 {
+			p.report(ViolationNil, "empty envelope address list instead of NIL")
+		}
+		for _, addr := range addrs.items {
+			if addr.kind != valueList || len(addr.items) != 4 {
+				p.report(ViolationSyntax, "address is not a list of 4 fields")
+				continue
+			}
+			for _, field := range addr.items {
+				p.nstring(field, "address field")
+			}
+		}
+	}
+	p.nstring(v.items[8], "envelope in-reply-to")
+	p.nstring(v.items[9], "envelope message-id")
+}
+
+// mailboxList checks a LIST or LSUB response.
+func (p *respParser) mailboxList(name string) {
+	if !p.sp(name) {
+		return
+	}
+	attrs := p.value()
+	if attrs.kind != valueList {
+		p.report(ViolationSyntax, "%s attributes are not a list", name)
+	}
+	for _, attr := range attrs.items {
+		if attr.kind != valueAtom || !strings.HasPrefix(attr.text, `\`) || !isAtom(attr.text[1:]) {
+			p.report(ViolationFlag, "invalid mailbox attribute %q", attr.text)
+		}
+	}
+	if !p.sp(name + " attributes") {
+		return
+	}
+	delim := p.value()
+	if !delim.isNil() && (delim.kind != valueString || !delim.quoted || len(delim.text) != 1) {
+		p.report(ViolationSyntax, "%s delimiter is not a quoted character or NIL", name)
+	}
+	if !p.sp(name + " delimiter") {
+		return
+	}
+	p.astring(p.value(), name+" mailbox")
+	if p.peek() == ' ' {
+		p.pos++
+		p.list(p.value(), name+" extended data")
+	}
+	p.end()
+}
+
+// status checks a STATUS response.
+func (p *respParser) status() {
+	if !p.sp("STATUS") {
+		return
+	}
+	p.astring(p.value(), "STATUS mailbox")
+	if !p.sp("STATUS mailbox") {
+		return
+	}
+	atts := p.value()
+	if atts.kind != valueList || len(atts.items)%2 != 0 {
+		p.report(ViolationSyntax, "STATUS attributes are not a list of pairs")
+		return
+	}
+	for i := 0; i < len(atts.items); i += 2 {
+		name := strings.ToUpper(atts.items[i].text)
+		value := atts.items[i+1]
+		switch name {
+		case "MAILBOXID":
+			p.objectID(value, name, false)
+		case "HIGHESTMODSEQ", "SIZE", "DELETED-STORAGE":
+			p.number(value, name, false, maxNumber64)
+		default:
+			p.number(value, name, false, maxNumber)
+		}
+	}
+	p.end()
+}
+
+// search checks a SEARCH or SORT response: message numbers, optionally
+// followed by (MODSEQ mod-sequence).
+func (p *respParser) search(name string) {
+	for !p.eof() {
+		if !p.sp(name) {
+			return
+		}
+		v := p.value()
+		if v.kind == valueList {
+			if len(v.items) != 2 || !strings.EqualFold(v.items[0].text, "MODSEQ") {
+				p.report(ViolationSyntax, "invalid %s modifier", name)
+			} else {
+				p.number(v.items[1], name+" MODSEQ", true, maxNumber64)
+			}
+			continue
+		}
+		p.number(v, name, true, maxNumber)
+	}
+}
+
+// capabilities checks a capability list, which must include IMAP4rev1
+// or IMAP4rev2.
+func (p *respParser) capabilities(caps []respValue) {
+	rev := false
+	for _, c := range caps {
+		if c.kind != valueAtom || !isAtom(c.text) {
+			p.report(ViolationSyntax, "capability %q is not an atom", c.text)
+		}
+		if strings.EqualFold(c.text, "IMAP4rev1") || strings.EqualFold(c.text, "IMAP4rev2") {
+			rev = true
+		}
+	}
+	if !rev {
+		p.report(ViolationSyntax, "capabilities do not include IMAP4rev1 or IMAP4rev2")
+	}
+}
+
+// rest checks the values up to the end of the response and returns them.
+func (p *respParser) rest() []respValue {
+	var values []respValue
+	for !p.eof() {
+		if !p.sp("value") {
+			return values
+		}
+		start := p.pos
+		values = append(values, p.value())
+		if p.pos == start {
+			p.report(ViolationSyntax, "unexpected %q", p.peek())
+			return values
+		}
+	}
+	return values
+}
+
+// end reports data following a complete response.
+func (p *respParser) end() {
+	if !p.eof() {
+		p.report(ViolationSyntax, "unexpected data %q at end of response", p.s[p.pos:])
+	}
+}
+
+// value reads a value: a parenthesized list, a quoted string, a literal
+// or an atom.
+func (p *respParser) value() respValue {
+	switch c := p.peek(); {
+	case p.eof() || c == ')':
+		p.report(ViolationSyntax, "missing value")
+		return respValue{}
+	case c == '(':
+		return p.parenList()
+	case c == '"':
+		return p.quoted()
+	case c == '{' || (c == '~' && strings.HasPrefix(p.s[p.pos:], "~{")):
+		return p.literal()
+	default:
+		return respValue{kind: valueAtom, text: p.atom()}
+	}
+}
+
+func (p *respParser) parenList() respValue {
+	v := respValue{kind: valueList}
+	p.pos++
+	for {
+		if p.eof() {
+			p.report(ViolationSyntax, "unbalanced parenthesis")
+			return v
+		}
+		if p.peek() == ')' {
+			p.pos++
+			return v
+		}
+		if len(v.items) > 0 && !p.sp("list item") {
+			return v
+		}
+		if p.peek() == ' ' || p.peek() == ')' {
+			p.report(ViolationSyntax, "extra space in list")
+			continue
+		}
+		start := p.pos
+		v.items = append(v.items, p.value())
+		if p.pos == start {
+			p.pos++
+		}
+	}
+}
+
+func (p *respParser) quoted() respValue {
+	var b strings.Builder
+	p.pos++
+	for {
+		if p.eof() {
+			p.report(ViolationString, "unterminated quoted string")
+			return respValue{kind: valueString, quoted: true, text: b.String()}
+		}
+		c := p.s[p.pos]
+		p.pos++
+		switch c {
+		case '"':
+			return respValue{kind: valueString, quoted: true, text: b.String()}
+		case '\\':
+			if next := p.peek(); next != '\\' && next != '"' {
+				p.report(ViolationString, "invalid escape in quoted string")
+				continue
+			}
+			b.WriteByte(p.s[p.pos])
+			p.pos++
+		case '\r', '\n':
+			p.report(ViolationString, "line break in quoted string")
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+func (p *respParser) literal() respValue {
+	binary := p.peek() == '~'
+	if binary {
+		p.pos++
+	}
+	end := strings.Index(p.s[p.pos:], "}\r\n")
+	if end < 0 {
+		p.report(ViolationSyntax, "invalid literal")
+		p.pos = len(p.s)
+		return respValue{kind: valueString}
+	}
+	digits := p.s[p.pos+1 : p.pos+end]
+	if strings.HasSuffix(digits, "+") {
+		p.report(ViolationString, "non-synchronizing literal in a server response")
+		digits = strings.TrimSuffix(digits, "+")
+	}
+	size, err := strconv.ParseUint(digits, 10, 32)
+	if err != nil || !isDigits(digits) {
+		p.report(ViolationNumber, "invalid literal size %q", digits)
+	}
+	start := p.pos + end + 3
+	if start+int(size) > len(p.s) {
+		p.report(ViolationSyntax, "truncated literal")
+		p.pos = len(p.s)
+		return respValue{kind: valueString}
+	}
+	data := p.s[start : start+int(size)]
+	p.pos = start + int(size)
+	if !binary && strings.IndexByte(data, 0) >= 0 {
+		p.report(ViolationString, "NUL in literal")
+	}
+	return respValue{kind: valueString, text: data}
+}
+
+// atom reads an atom. Section specifiers, such as in
+// BODY[HEADER.FIELDS (SUBJECT)]<0>, are part of the atom.
+func (p *respParser) atom() string {
+	start := p.pos
+	for !p.eof() {
+		c := p.s[p.pos]
+		if c == ' ' || c == '(' || c == ')' || c == ']' || c == '"' {
+			break
+		}
+		if c == '[' {
+			end := strings.IndexByte(p.s[p.pos:], ']')
+			if end < 0 {
+				p.pos = len(p.s)
+				break
+			}
+			p.pos += end
+		}
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// number checks a number of at most max, which must not be zero if
+// nonZero is set.
+func (p *respParser) number(v respValue, what string, nonZero bool, max uint64) {
+	if v.isNil() {
+		p.report(ViolationNil, "%s is NIL", what)
+		return
+	}
+	if v.kind != valueAtom || !isDigits(v.text) {
+		p.report(ViolationNumber, "%s %q is not a number", what, v.text)
+		return
+	}
+	n, err := strconv.ParseUint(v.text, 10, 64)
+	if err != nil || n > max {
+		p.report(ViolationNumber, "%s %s is out of range", what, v.text)
+	} else if nonZero && n == 0 {
+		p.report(ViolationNumber, "%s is zero", what)
+	}
+}
+
+// uidSet checks a set of UIDs such as 1:3,5.
+func (p *respParser) uidSet(v respValue, what string) {
+	if v.kind != valueAtom || v.text == "" {
+		p.report(ViolationSyntax, "%s UID set is not an atom", what)
+		return
+	}
+	for _, r := range strings.Split(v.text, ",") {
+		for _, n := range strings.SplitN(r, ":", 2) {
+			p.number(respValue{kind: valueAtom, text: n}, what+" UID", true, maxNumber)
+		}
+	}
+}
+
+// flagList checks a list of flags. \* is only allowed if perm is set.
+func (p *respParser) flagList(v respValue, what string, perm bool) {
+	if v.isNil() {
+		p.report(ViolationNil, "%s is NIL instead of ()", what)
+		return
+	}
+	if v.kind != valueList {
+		p.report(ViolationSyntax, "%s is not a list", what)
+		return
+	}
+	for _, f := range v.items {
+		switch {
+		case f.kind != valueAtom:
+			p.report(ViolationFlag, "%s flag %q is not an atom", what, f.text)
+		case f.text == `\*`:
+			if !perm {
+				p.report(ViolationFlag, `\* in %s`, what)
+			}
+		case strings.HasPrefix(f.text, `\`):
+			if !isAtom(f.text[1:]) {
+				p.report(ViolationFlag, "invalid %s flag %q", what, f.text)
+			}
+		case !isAtom(f.text):
+			p.report(ViolationFlag, "invalid %s flag %q", what, f.text)
+		}
+	}
+}
+
+// dateTime checks a quoted date-time, such as " 2-Jan-2006 15:04:05
+// -0700".
+func (p *respParser) dateTime(v respValue, what string, nilOK bool) {
+	if v.isNil() {
+		if !nilOK {
+			p.report(ViolationNil, "%s is NIL", what)
+		}
+		return
+	}
+	if v.kind != valueString || !v.quoted || len(v.text) != 26 {
+		p.report(ViolationDateTime, "%s %q is not a quoted date-time", what, v.text)
+		return
+	}
+	if _, err := time.Parse("_2-Jan-2006 15:04:05 -0700", v.text); err != nil {
+		p.report(ViolationDateTime, "%s %q is not a quoted date-time", what, v.text)
+	}
+}
+
+// objectID checks a parenthesized object identifier (RFC 8474), which
+// may be NIL if nilOK is set.
+func (p *respParser) objectID(v respValue, what string, nilOK bool) {
+	if v.isNil() {
+		if !nilOK {
+			p.report(ViolationNil, "%s is NIL", what)
+		}
+		return
+	}
+	if v.kind != valueList || len(v.items) != 1 || v.items[0].kind != valueAtom {
+		p.report(ViolationSyntax, "%s is not a parenthesized object identifier", what)
+		return
+	}
+	id := v.items[0].text
+	if len(id) == 0 || len(id) > 255 || strings.Trim(id, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-") != "" {
+		p.report(ViolationSyntax, "%s %q is not an object identifier", what, id)
+	}
+}
+
+// nstring checks a string or NIL.
+func (p *respParser) nstring(v respValue, what string) {
+	if v.kind != valueString && !v.isNil() {
+		p.report(ViolationSyntax, "%s is not a string or NIL", what)
+	}
+}
+
+// astring checks an atom or string.
+func (p *respParser) astring(v respValue, what string) {
+	if v.kind == valueList || (v.kind == valueAtom && v.text == "") {
+		p.report(ViolationSyntax, "%s is not an atom or string", what)
+	}
+}
+
+// list checks a parenthesized list.
+func (p *respParser) list(v respValue, what string) {
+	if v.kind != valueList {
+		p.report(ViolationSyntax, "%s is not a list", what)
+	}
+}
+
+// isAtomChar reports whether c is an ATOM-CHAR.
+func isAtomChar(c byte) bool {
+	return c > ' ' && c < 0x7f && strings.IndexByte(`(){%*"\]`, c) < 0
+}
+
+// isAtom reports whether s is a non-empty sequence of ATOM-CHARs.
+func isAtom(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isAtomChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isMessageData reports whether name is the name of a response that
+// starts with a message number.
+func isMessageData(name string) bool {
+	switch strings.ToUpper(name) {
+	case "EXISTS", "RECENT", "EXPUNGE", "FETCH":
+		return true
+	}
+	return false
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,145 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+)
+
+func TestValidateResponse(t *testing.T) {
+	valid := []string{
+		"+ Ready for literal",
+		"+",
+		"* OK [CAPABILITY IMAP4rev1 AUTH=PLAIN LITERAL+] Server ready",
+		"* PREAUTH IMAP4rev1 server logged in as Smith",
+		"* BYE Autologout; idle for too long",
+		"A001 OK [READ-WRITE] SELECT completed",
+		"A002 NO [TRYCREATE] No such mailbox",
+		"a1] BAD Unknown command",
+		"* 172 EXISTS",
+		"* 0 EXISTS",
+		"* 1 RECENT",
+		"* 44 EXPUNGE",
+		`* FLAGS (\Answered \Flagged \Deleted \Seen \Draft $Forwarded)`,
+		`* OK [PERMANENTFLAGS (\Deleted \Seen \*)] Limited`,
+		"* OK [UNSEEN 12] Message 12 is first unseen",
+		"* OK [UIDVALIDITY 3857529045] UIDs valid",
+		"* OK [UIDNEXT 4392] Predicted next UID",
+		"* OK [HIGHESTMODSEQ 715194045007] Highest",
+		"A003 OK [APPENDUID 38505 3955] APPEND completed",
+		"A004 OK [COPYUID 38505 304,319:320 3956:3958] Done",
+		`* LIST (\Noselect) "/" ~/Mail/foo`,
+		`* LIST () NIL INBOX`,
+		`* LIST (\HasNoChildren) "." "Sent Items"`,
+		`* LIST () "/" {4}` + "\r\nWork",
+		`* STATUS blurdybloop (MESSAGES 231 UIDNEXT 44292)`,
+		"* SEARCH 2 84 882",
+		"* SEARCH",
+		"* SEARCH 2 5 (MODSEQ 917162500)",
+		"* CAPABILITY IMAP4rev2 STARTTLS AUTH=GSSAPI LOGINDISABLED",
+		`* 12 FETCH (FLAGS (\Seen) INTERNALDATE "17-Jul-1996 02:44:25 -0700" RFC822.SIZE 4286 UID 3)`,
+		`* 2 FETCH (INTERNALDATE " 7-Jul-1996 02:44:25 -0700")`,
+		`* 12 FETCH (ENVELOPE ("Wed, 17 Jul 1996 02:23:25 -0700 (PDT)" "IMAP4rev1 WG mtg summary and minutes" (("Terry Gray" NIL "gray" "cac.washington.edu")) NIL NIL ((NIL NIL "imap" "cac.washington.edu")) NIL NIL NIL "<B27397-0100000@cac.washington.edu>"))`,
+		"* 1 FETCH (UID 5 BODY[HEADER.FIELDS (SUBJECT)] {15}\r\nSubject: hi\r\n\r\n)",
+		"* 1 FETCH (BODY[]<0> NIL MODSEQ (12) EMAILID (M6d99ac3275bb4e) THREADID NIL)",
+		`* 1 FETCH (BODYSTRUCTURE ("TEXT" "PLAIN" ("CHARSET" "US-ASCII") NIL NIL "7BIT" 3028 92))`,
+		"* 1 FETCH (BINARY[1] ~{3}\r\na\x00b BINARY.SIZE[1] 3)",
+		`* ESEARCH (TAG "A282") MIN 2 COUNT 3`,
+		`* NAMESPACE (("" "/")) NIL NIL`,
+		`* ID ("name" "Cyrus" "version" "1.5")`,
+	}
+	for _, resp := range valid {
+		if v := ValidateResponse(resp); len(v) > 0 {
+			t.Errorf("ValidateResponse(%q) = %v, want no violation", resp, v)
+		}
+	}
+
+	invalid := []struct {
+		resp string
+		rule ViolationRule
+	}{
+		{"+Ready", ViolationSyntax},
+		{"A+1 OK done", ViolationSyntax},
+		{"A1 PREAUTH done", ViolationSyntax},
+		{"A1 OK", ViolationSyntax},
+		{"A1 OK [UIDVALIDITY 3 done", ViolationSyntax},
+		{"* OK [UIDVALIDITY 0] zero", ViolationNumber},
+		{"* OK [UIDNEXT 4294967296] too large", ViolationNumber},
+		{"* OK [UIDNEXT] missing", ViolationSyntax},
+		{"* OK [HIGHESTMODSEQ 9223372036854775808] too large", ViolationNumber},
+		{"A1 OK [COPYUID 1 0:2 3:5] done", ViolationNumber},
+		{"* 0 EXPUNGE", ViolationNumber},
+		{"* 0 FETCH (FLAGS ())", ViolationNumber},
+		{"* -1 EXISTS", ViolationNumber},
+		{"* 3 EXISTS more", ViolationSyntax},
+		{"* FLAGS NIL", ViolationNil},
+		{`* FLAGS ("\Seen")`, ViolationFlag},
+		{`* FLAGS (\Seen \*)`, ViolationFlag},
+		{`* FLAGS (\Seen foo%)`, ViolationFlag},
+		{`* FLAGS (\Seen`, ViolationSyntax},
+		{`* FLAGS (\Seen  \Draft)`, ViolationSyntax},
+		{`* LIST (Noselect) "/" foo`, ViolationFlag},
+		{`* LIST () "//" foo`, ViolationSyntax},
+		{`* LIST () / foo`, ViolationSyntax},
+		{`* LIST () "/" (foo)`, ViolationSyntax},
+		{`* STATUS foo (MESSAGES NIL)`, ViolationNil},
+		{`* STATUS foo (MESSAGES x)`, ViolationNumber},
+		{"* SEARCH 1 0", ViolationNumber},
+		{"* CAPABILITY STARTTLS", ViolationSyntax},
+		{"* 1 FETCH (UID NIL)", ViolationNil},
+		{"* 1 FETCH (UID 0)", ViolationNumber},
+		{"* 1 FETCH (FLAGS NIL)", ViolationNil},
+		{`* 1 FETCH (INTERNALDATE "7-Jul-1996 02:44:25 -0700")`, ViolationDateTime},
+		{`* 1 FETCH (INTERNALDATE NIL)`, ViolationNil},
+		{"* 1 FETCH (RFC822.SIZE NIL)", ViolationNil},
+		{"* 1 FETCH (BODY[] hello)", ViolationSyntax},
+		{"* 1 FETCH (MODSEQ (0))", ViolationNumber},
+		{"* 1 FETCH (EMAILID NIL)", ViolationNil},
+		{"* 1 FETCH (UID 1", ViolationSyntax},
+		{"* 1 FETCH (UID)", ViolationSyntax},
+		{`* 1 FETCH (ENVELOPE (NIL NIL () NIL NIL NIL NIL NIL NIL NIL))`, ViolationNil},
+		{`* 1 FETCH (ENVELOPE (NIL NIL))`, ViolationSyntax},
+		{`* 1 FETCH (BODY[] "a\b")`, ViolationString},
+		{`* 1 FETCH (BODY[] "abc)`, ViolationString},
+		{"* 1 FETCH (BODY[] {3+}\r\nabc)", ViolationString},
+		{"* 1 FETCH (BODY[] {3}\r\na\x00c)", ViolationString},
+		{"* 1 FETCH (BODY[] {30}\r\nabc)", ViolationSyntax},
+		{`* ID ("name" "x"`, ViolationSyntax},
+	}
+	for _, tt := range invalid {
+		violations := ValidateResponse(tt.resp)
+		found := false
+		for _, v := range violations {
+			if v.Rule == tt.rule {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("ValidateResponse(%q) = %v, want a %s violation", tt.resp, violations, tt.rule)
+		}
+	}
+}
+
+func TestWithResponseValidator(t *testing.T) {
+	var mu sync.Mutex
+	var got []*ResponseViolation
+	c := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1] ready", func(w io.Writer, tag, cmd string) {
+		fmt.Fprint(w, "* 1 FETCH (UID 0 FLAGS NIL)\r\n")
+		fmt.Fprintf(w, "%s OK done\r\n", tag)
+	}, WithResponseValidator(func(v *ResponseViolation) {
+		mu.Lock()
+		got = append(got, v)
+		mu.Unlock()
+	}))
+
+	// Violations do not fail the command.
+	if _, err := c.Fetch("1", "(UID FLAGS)"); err != nil {
+		t.Fatalf("Fetch() error: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 2 || got[0].Rule != ViolationNumber || got[1].Rule != ViolationNil {
+		t.Errorf("violations = %v, want UID 0 and FLAGS NIL", got)
+	}
+}
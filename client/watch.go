@@ -0,0 +1,185 @@
+package client
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrProbeTimeout is the disconnect cause of a client whose connection was
+// closed because the server did not answer a health probe in time, see
+// CheckAlive.
+var ErrProbeTimeout = errors.New("imap: server did not answer health probe")
+
+// Defaults for WatchOptions.
+const (
+	DefaultProbeInterval = 5 * time.Minute
+	DefaultProbeTimeout  = 30 * time.Second
+)
+
+// CheckAlive checks that the connection is alive by sending NOOP and waiting at
+// most timeout for the response. Connections that die silently, for
+// example when a NAT device drops them, never report an error, and an IDLE
+// command on them waits forever; CheckAlive detects them. If the response does
+// not arrive in time, the connection is closed with ErrProbeTimeout as the
+// disconnect cause, and ErrProbeTimeout is returned.
+func (c *Client) CheckAlive(timeout time.Duration) error {
+	return c.withDeadline(timeout, c.Noop)
+}
+
+// withDeadline calls fn and waits at most timeout for it to return. If it
+// does not, the connection is closed with ErrProbeTimeout, which makes fn
+// return, and ErrProbeTimeout is returned.
+func (c *Client) withDeadline(timeout time.Duration, fn func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		c.abort(ErrProbeTimeout)
+		return ErrProbeTimeout
+	}
+}
+
+// abort closes the connection with err as the disconnect cause.
+func (c *Client) abort(err error) {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.handleDisconnect(err)
+	_ = c.conn.Close()
+}
+
+// WatchOptions contains options for Watch.
+type WatchOptions struct {
+	// Mailbox is the mailbox to watch. If empty, INBOX is watched.
+	Mailbox string
+
+	// ProbeInterval is how often IDLE is interrupted to probe the
+	// connection with NOOP. Servers that do not support IDLE are polled
+	// with NOOP at this interval. If 0, DefaultProbeInterval is used.
+	ProbeInterval time.Duration
+
+	// ProbeTimeout is how long the server may take to answer a probe, or
+	// to end IDLE, before the connection is considered dead. If 0,
+	// DefaultProbeTimeout is used.
+	ProbeTimeout time.Duration
+
+	// Reconnect returns a new logged in client to continue watching with
+	// after the connection was lost or a probe failed. It should configure
+	// the new client with the same UnilateralDataHandler. If nil, Watch
+	// returns the error instead. If Reconnect fails with a transient
+	// error, it is called again after ProbeTimeout.
+	Reconnect func() (*Client, error)
+}
+
+// Watch selects a mailbox and waits for changes to it in IDLE until stop
+// is closed. Changes are reported to the UnilateralDataHandler of the
+// client. Every ProbeInterval, IDLE is ended and the connection probed
+// with a NOOP that must be answered within ProbeTimeout (see CheckAlive), so
+// that connections that died silently are detected; they are then
+// replaced using opts.Reconnect.
+//
+// Watch returns the client in use when it returns, which is c unless it
+// reconnected, and nil or the error that ended watching.
+func (c *Client) Watch(stop <-chan struct{}, opts *WatchOptions) (*Client, error) {
+	if opts == nil {
+		opts = &WatchOptions{}
+	}
+	for {
+		err := c.watch(stop, opts)
+		if err == nil || opts.Reconnect == nil || !IsTransient(err) {
+			return c, err
+		}
+		_ = c.Close()
+
+		for {
+			select {
+			case <-stop:
+				return c, nil
+			default:
+			}
+			next, err := opts.Reconnect()
+			if err == nil {
+				c = next
+				break
+			}
+			if !IsTransient(err) {
+				return c, err
+			}
+			select {
+			case <-stop:
+				return c, nil
+			case <-time.After(opts.probeTimeout()):
+			}
+		}
+	}
+}
+
+// watch watches on c until stop is closed or the connection fails.
+func (c *Client) watch(stop <-chan struct{}, opts *WatchOptions) error {
+	mailbox := opts.Mailbox
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	if !c.isSelected(mailbox) {
+		if _, err := c.Select(mailbox, nil); err != nil {
+			return err
+		}
+	}
+
+	interval := opts.ProbeInterval
+	if interval <= 0 {
+		interval = DefaultProbeInterval
+	}
+	timeout := opts.probeTimeout()
+	idle := c.SupportsIdle()
+
+	for {
+		var cmd *IdleCommand
+		if idle {
+			var err error
+			if cmd, err = c.Idle(); err != nil {
+				return err
+			}
+		}
+
+		timer := time.NewTimer(interval)
+		var stopped bool
+		select {
+		case <-stop:
+			stopped = true
+		case <-c.Done():
+			timer.Stop()
+			if err := c.DisconnectErr(); err != ErrClosed {
+				return err
+			}
+			// Closed by Close or Logout.
+			return nil
+		case <-timer.C:
+		}
+		timer.Stop()
+
+		if cmd != nil {
+			if err := c.withDeadline(timeout, cmd.Done); err != nil {
+				return err
+			}
+		}
+		if stopped {
+			return nil
+		}
+		if err := c.CheckAlive(timeout); err != nil {
+			return err
+		}
+	}
+}
+
+func (o *WatchOptions) probeTimeout() time.Duration {
+	if o.ProbeTimeout <= 0 {
+		return DefaultProbeTimeout
+	}
+	return o.ProbeTimeout
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckAlive_Timeout(t *testing.T) {
+	c := newScriptedClient(t, "* OK ready", func(w io.Writer, tag, cmd string) {
+		// The connection is dead: commands are never answered.
+	})
+
+	if err := c.CheckAlive(20 * time.Millisecond); !errors.Is(err, ErrProbeTimeout) {
+		t.Fatalf("CheckAlive() = %v, want ErrProbeTimeout", err)
+	}
+	<-c.Done()
+	if err := c.DisconnectErr(); err != ErrProbeTimeout {
+		t.Errorf("DisconnectErr() = %v, want ErrProbeTimeout", err)
+	}
+	if !IsTransient(ErrProbeTimeout) {
+		t.Error("ErrProbeTimeout is not transient")
+	}
+}
+
+// idleServer returns a respond function for newScriptedClient that
+// supports SELECT and IDLE. If dead is set, DONE is never answered.
+func idleServer(dead bool, noops chan<- struct{}) func(w io.Writer, tag, cmd string) {
+	var idleTag string
+	return func(w io.Writer, tag, cmd string) {
+		switch {
+		case tag == "DONE":
+			if !dead {
+				fmt.Fprintf(w, "%s OK IDLE terminated\r\n", idleTag)
+			}
+		case cmd == "IDLE":
+			idleTag = tag
+			fmt.Fprint(w, "+ idling\r\n")
+		case cmd == "NOOP":
+			fmt.Fprintf(w, "%s OK NOOP completed\r\n", tag)
+			select {
+			case noops <- struct{}{}:
+			default:
+			}
+		case strings.HasPrefix(cmd, "SELECT "):
+			fmt.Fprint(w, "* 1 EXISTS\r\n")
+			fmt.Fprintf(w, "%s OK [READ-WRITE] SELECT completed\r\n", tag)
+		default:
+			fmt.Fprintf(w, "%s OK done\r\n", tag)
+		}
+	}
+}
+
+func TestWatch_Reconnect(t *testing.T) {
+	const greeting = "* OK [CAPABILITY IMAP4rev1 IDLE] ready"
+	dead := newScriptedClient(t, greeting, idleServer(true, nil))
+
+	noops := make(chan struct{}, 1)
+	var fresh *Client
+	stop := make(chan struct{})
+	go func() {
+		<-noops
+		close(stop)
+	}()
+
+	c, err := dead.Watch(stop, &WatchOptions{
+		ProbeInterval: 10 * time.Millisecond,
+		ProbeTimeout:  20 * time.Millisecond,
+		Reconnect: func() (*Client, error) {
+			fresh = newScriptedClient(t, greeting, idleServer(false, noops))
+			return fresh, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Watch() error: %v", err)
+	}
+	if c != fresh || fresh == nil {
+		t.Error("Watch() did not return the new client")
+	}
+	if err := dead.DisconnectErr(); err != ErrProbeTimeout {
+		t.Errorf("DisconnectErr() of the dead client = %v, want ErrProbeTimeout", err)
+	}
+}
+
+func TestWatch_NoReconnect(t *testing.T) {
+	dead := newScriptedClient(t, "* OK [CAPABILITY IMAP4rev1 IDLE] ready", idleServer(true, nil))
+
+	_, err := dead.Watch(make(chan struct{}), &WatchOptions{
+		ProbeInterval: 10 * time.Millisecond,
+		ProbeTimeout:  20 * time.Millisecond,
+	})
+	if !errors.Is(err, ErrProbeTimeout) {
+		t.Errorf("Watch() = %v, want ErrProbeTimeout", err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client"
+)
+
+func runAppend(args []string, stdout io.Writer) error {
+	fs, cf := newFlagSet("append", "<file>...")
+	mailbox := fs.String("mailbox", "INBOX", "mailbox to append to")
+	flags := fs.String("flags", "", `comma-separated flags to set, e.g. \Seen,Work`)
+	keepDate := fs.Bool("keep-date", true, "use the modification time of the files as internal date")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("append needs at least one file")
+	}
+
+	var msgFlags []imap.Flag
+	if *flags != "" {
+		for _, f := range strings.Split(*flags, ",") {
+			msgFlags = append(msgFlags, imap.Flag(strings.TrimSpace(f)))
+		}
+	}
+	msgs := make([]client.AppendMessage, fs.NArg())
+	for i, name := range fs.Args() {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		msgs[i] = client.AppendMessage{Flags: msgFlags, Literal: b}
+		if *keepDate {
+			fi, err := os.Stat(name)
+			if err != nil {
+				return err
+			}
+			msgs[i].InternalDate = fi.ModTime()
+		}
+	}
+
+	c, err := cf.connect()
+	if err != nil {
+		return err
+	}
+	defer logout(c)
+
+	// With MULTIAPPEND all files are appended atomically by one command.
+	batch := 1
+	if c.HasCap(string(imap.CapMultiAppend)) {
+		batch = len(msgs)
+	}
+	for i := 0; i < len(msgs); i += batch {
+		data, err := c.MultiAppend(*mailbox, msgs[i:i+batch])
+		if err != nil {
+			return err
+		}
+		for j, d := range data {
+			if d.UID != 0 {
+				fmt.Fprintf(stdout, "%s\tUID %d\n", fs.Arg(i+j), d.UID)
+			} else {
+				fmt.Fprintln(stdout, fs.Arg(i+j))
+			}
+		}
+	}
+	return nil
+}
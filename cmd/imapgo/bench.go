@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/meszmate/imap-go/client"
+)
+
+// benchOps are the operations bench can measure, by name.
+var benchOps = map[string]func(c *client.Client) error{
+	"noop": func(c *client.Client) error { return c.Noop() },
+	"search": func(c *client.Client) error {
+		_, err := c.UIDSearch("ALL")
+		return err
+	},
+	"fetch": func(c *client.Client) error {
+		_, err := c.Fetch("1:*", "(UID FLAGS RFC822.SIZE)")
+		return err
+	},
+	"status": func(c *client.Client) error {
+		_, err := c.Status("INBOX", nil)
+		return err
+	},
+}
+
+func runBench(args []string, stdout io.Writer) error {
+	fs, cf := newFlagSet("bench", "")
+	op := fs.String("op", "noop", "operation to run: noop, search, fetch or status")
+	n := fs.Int("n", 1000, "total number of operations")
+	conns := fs.Int("c", 4, "number of concurrent connections")
+	mailbox := fs.String("mailbox", "INBOX", "mailbox selected (read-only) on each connection")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	run, ok := benchOps[*op]
+	if !ok {
+		return fmt.Errorf("unknown operation %q", *op)
+	}
+	if *n <= 0 || *conns <= 0 {
+		return fmt.Errorf("-n and -c must be positive")
+	}
+	if *conns > *n {
+		*conns = *n
+	}
+
+	clients := make([]*client.Client, *conns)
+	for i := range clients {
+		c, err := cf.connect()
+		if err != nil {
+			return err
+		}
+		defer logout(c)
+		if _, err := c.Examine(*mailbox); err != nil {
+			return err
+		}
+		clients[i] = c
+	}
+
+	latencies := make([]time.Duration, *n)
+	errs := make([]error, *conns)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i, c := range clients {
+		wg.Add(1)
+		go func(i int, c *client.Client) {
+			defer wg.Done()
+			// Connection i runs operations i, i+conns, i+2*conns, ...
+			for k := i; k < *n; k += *conns {
+				t := time.Now()
+				if err := run(c); err != nil {
+					errs[i] = err
+					return
+				}
+				latencies[k] = time.Since(t)
+			}
+		}(i, c)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p float64) time.Duration {
+		return latencies[int(p*float64(len(latencies)-1))]
+	}
+	fmt.Fprintf(stdout, "%d %s operations on %d connections in %v\n", *n, *op, *conns, elapsed.Round(time.Millisecond))
+	fmt.Fprintf(stdout, "throughput: %.1f ops/s\n", float64(*n)/elapsed.Seconds())
+	fmt.Fprintf(stdout, "latency:    p50 %v  p90 %v  p99 %v  max %v\n",
+		percentile(0.5), percentile(0.9), percentile(0.99), latencies[len(latencies)-1])
+	return nil
+}
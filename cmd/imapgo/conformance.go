@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/meszmate/imap-go/imaptest"
+)
+
+// errViolations is returned by conformance when a response breaks the
+// grammar, so that imapgo exits with status 1.
+var errViolations = errors.New("the server's responses do not follow the IMAP grammar")
+
+func runConformance(args []string, stdout io.Writer) error {
+	fs, cf := newFlagSet("conformance", "[script ...]")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if cf.addr == "" {
+		return fmt.Errorf("no server address, use -addr or $IMAPGO_ADDR")
+	}
+	if cf.user == "" {
+		return fmt.Errorf("no user, use -user or $IMAPGO_USER: the scripts log in")
+	}
+	if cf.startTLS {
+		return fmt.Errorf("-starttls is not supported, use -tls or -tls=false")
+	}
+
+	scripts, err := conformanceScripts(fs.Args())
+	if err != nil {
+		return err
+	}
+	target := imaptest.Target{
+		Name:     cf.addr,
+		Addr:     cf.addr,
+		Username: cf.user,
+		Password: os.Getenv(passwordEnv),
+	}
+	if cf.tls {
+		host, _, err := net.SplitHostPort(cf.addr)
+		if err != nil {
+			return err
+		}
+		target.TLSConfig = &tls.Config{ServerName: host, InsecureSkipVerify: cf.insecure}
+	}
+
+	violations, err := imaptest.Conformance(target, scripts)
+	for _, v := range violations {
+		cmd := v.Command
+		if cmd == "" {
+			cmd = "greeting"
+		}
+		fmt.Fprintf(stdout, "%s: %s: %v\n", v.Script, cmd, v.ResponseViolation)
+	}
+	if err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("%d violations: %w", len(violations), errViolations)
+	}
+	fmt.Fprintf(stdout, "%d scripts passed\n", len(scripts))
+	return nil
+}
+
+// conformanceScripts returns the scripts of imaptest.CoreScripts named by
+// names, or all of them if names is empty.
+func conformanceScripts(names []string) ([]imaptest.Script, error) {
+	if len(names) == 0 {
+		return imaptest.CoreScripts, nil
+	}
+	var scripts []imaptest.Script
+	for _, name := range names {
+		found := false
+		for _, script := range imaptest.CoreScripts {
+			if strings.EqualFold(script.Name, name) {
+				scripts = append(scripts, script)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown script %q", name)
+		}
+	}
+	return scripts, nil
+}
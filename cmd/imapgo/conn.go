@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/meszmate/imap-go/client"
+)
+
+// passwordEnv is the environment variable holding the password.
+const passwordEnv = "IMAPGO_PASSWORD"
+
+// connFlags are the connection flags shared by all commands.
+type connFlags struct {
+	addr     string
+	user     string
+	tls      bool
+	startTLS bool
+	insecure bool
+	debug    bool
+}
+
+// newFlagSet returns a flag set for a command with the connection flags
+// registered.
+func newFlagSet(name, args string) (*flag.FlagSet, *connFlags) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	cf := &connFlags{}
+	fs.StringVar(&cf.addr, "addr", os.Getenv("IMAPGO_ADDR"), "server address as host:port (default $IMAPGO_ADDR)")
+	fs.StringVar(&cf.user, "user", os.Getenv("IMAPGO_USER"), "user name (default $IMAPGO_USER); the password is read from $"+passwordEnv)
+	fs.BoolVar(&cf.tls, "tls", true, "connect with implicit TLS")
+	fs.BoolVar(&cf.startTLS, "starttls", false, "connect in plain text and upgrade with STARTTLS")
+	fs.BoolVar(&cf.insecure, "insecure", false, "do not verify the server certificate")
+	fs.BoolVar(&cf.debug, "debug", false, "log the protocol exchange to standard error")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: imapgo %s [flags] %s\n\nFlags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs, cf
+}
+
+// dial connects to the server without authenticating.
+func (cf *connFlags) dial(opts ...client.Option) (*client.Client, error) {
+	if cf.addr == "" {
+		return nil, fmt.Errorf("no server address, use -addr or $IMAPGO_ADDR")
+	}
+	host, _, err := net.SplitHostPort(cf.addr)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{ServerName: host, InsecureSkipVerify: cf.insecure}
+
+	opts = append([]client.Option{client.WithDebugLog(cf.debug)}, opts...)
+	if cf.tls && !cf.startTLS {
+		return client.DialTLS(cf.addr, tlsConfig, opts...)
+	}
+	c, err := client.Dial(cf.addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if cf.startTLS {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			_ = c.Close()
+			return nil, fmt.Errorf("STARTTLS: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// connect connects to the server and logs in.
+func (cf *connFlags) connect(opts ...client.Option) (*client.Client, error) {
+	c, err := cf.dial(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if cf.user != "" {
+		if err := c.Login(cf.user, os.Getenv(passwordEnv)); err != nil {
+			_ = c.Close()
+			return nil, fmt.Errorf("login: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// logout logs out and closes the connection, ignoring errors since the
+// command's work is done.
+func logout(c *client.Client) {
+	_ = c.Logout()
+	_ = c.Close()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func runFetch(args []string, stdout io.Writer) error {
+	fs, cf := newFlagSet("fetch", "<uid set>")
+	mailbox := fs.String("mailbox", "INBOX", "mailbox to fetch from")
+	out := fs.String("out", "", "directory to write the messages to as <uid>.eml; if empty, they are written to standard output")
+	headers := fs.String("headers", "", "comma-separated header fields to print instead of downloading the messages, e.g. Subject,From")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("fetch needs a UID set, e.g. 1:* or 4,7")
+	}
+	uidSet := fs.Arg(0)
+
+	c, err := cf.connect()
+	if err != nil {
+		return err
+	}
+	defer logout(c)
+
+	if _, err := c.Examine(*mailbox); err != nil {
+		return err
+	}
+
+	if *headers != "" {
+		fields := strings.Split(*headers, ",")
+		msgs, err := c.UIDFetchHeaders(uidSet, fields...)
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			values := make([]string, len(fields))
+			for i, f := range fields {
+				values[i] = msg.Header.Get(strings.TrimSpace(f))
+			}
+			fmt.Fprintf(stdout, "%d\t%s\n", msg.UID, strings.Join(values, "\t"))
+		}
+		return nil
+	}
+
+	if *out != "" {
+		if err := os.MkdirAll(*out, 0o700); err != nil {
+			return err
+		}
+	}
+	msgs, err := c.UIDFetchMessages(uidSet, "(UID INTERNALDATE BODY.PEEK[])")
+	if err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		body := msg.BodySection[""]
+		if *out == "" {
+			if _, err := stdout.Write(body); err != nil {
+				return err
+			}
+			continue
+		}
+		path := filepath.Join(*out, fmt.Sprintf("%d.eml", msg.UID))
+		if err := os.WriteFile(path, body, 0o600); err != nil {
+			return err
+		}
+		if !msg.InternalDate.IsZero() {
+			if err := os.Chtimes(path, msg.InternalDate, msg.InternalDate); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintln(stdout, path)
+	}
+	return nil
+}
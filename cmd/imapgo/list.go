@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client"
+)
+
+func runList(args []string, stdout io.Writer) error {
+	fs, cf := newFlagSet("list", "[pattern]")
+	subscribed := fs.Bool("subscribed", false, "only list subscribed mailboxes")
+	tree := fs.Bool("tree", false, "print the mailboxes as a tree")
+	status := fs.Bool("status", false, "print the number of messages and unseen messages")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	pattern := "*"
+	if fs.NArg() > 0 {
+		pattern = fs.Arg(0)
+	}
+
+	c, err := cf.connect()
+	if err != nil {
+		return err
+	}
+	defer logout(c)
+
+	var list []*imap.ListData
+	if *subscribed {
+		list, err = c.ListSubscribed("", pattern)
+	} else {
+		list, err = c.ListMailboxes("", pattern)
+	}
+	if err != nil {
+		return err
+	}
+
+	describe := func(data *imap.ListData) (string, error) {
+		var b strings.Builder
+		b.WriteString(data.Mailbox)
+		if *status && !hasAttr(data, imap.MailboxAttrNoSelect) {
+			st, err := c.Status(data.Mailbox, &imap.StatusOptions{NumMessages: true, NumUnseen: true})
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&b, "\t%d messages, %d unseen", deref(st.NumMessages), deref(st.NumUnseen))
+		}
+		if len(data.Attrs) > 0 {
+			fmt.Fprintf(&b, "\t%v", data.Attrs)
+		}
+		return b.String(), nil
+	}
+
+	if !*tree {
+		for _, data := range list {
+			line, err := describe(data)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(stdout, line)
+		}
+		return nil
+	}
+
+	var walk func(n *client.MailboxNode, depth int) error
+	walk = func(n *client.MailboxNode, depth int) error {
+		for _, child := range n.Children() {
+			line := child.Leaf()
+			if child.Data != nil {
+				desc, err := describe(child.Data)
+				if err != nil {
+					return err
+				}
+				line = child.Leaf() + strings.TrimPrefix(desc, child.Name)
+			}
+			fmt.Fprintf(stdout, "%s%s\n", strings.Repeat("  ", depth), line)
+			if err := walk(child, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(client.NewMailboxTree(list).Root(), 0)
+}
+
+func hasAttr(data *imap.ListData, attr imap.MailboxAttr) bool {
+	for _, a := range data.Attrs {
+		if strings.EqualFold(string(a), string(attr)) {
+			return true
+		}
+	}
+	return false
+}
+
+func deref(p *uint32) uint32 {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
@@ -0,0 +1,112 @@
+// Command imapgo is a command-line IMAP client built on the client
+// package. It is both a practical tool for inspecting and moving mail and
+// a living example of the library's high-level APIs.
+//
+// Usage:
+//
+//	imapgo <command> [flags] [arguments]
+//
+// The commands are:
+//
+//	list         list mailboxes
+//	search       search a mailbox and print the matching UIDs
+//	fetch        download messages to files or standard output
+//	append       upload message files to a mailbox
+//	watch        print mailbox changes as they happen, using IDLE
+//	probe        report what a server supports
+//	conformance  check that a server's responses follow the IMAP grammar
+//	export       mirror a mailbox to a Maildir
+//	sync         mirror mailboxes to Maildirs in one bounded pass, for batch jobs
+//	import       upload a Maildir to a mailbox
+//	bench        measure command latency and throughput
+//
+// All commands accept the connection flags -addr, -user, -tls, -starttls
+// and -insecure. The password is read from the IMAPGO_PASSWORD environment
+// variable, so that it does not show up in process listings.
+//
+// conformance runs the scripts of imaptest.CoreScripts, which log in and
+// create, fill and delete a mailbox named imaptest-<random>, and prints
+// the responses that do not follow the IMAP grammar.
+//
+// imapgo exits with status 0 on success and 1 on errors, except for sync,
+// whose exit status tells what kind of error ended the pass (see
+// maildir.ErrorCategory.ExitCode).
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// command is an imapgo subcommand.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdout io.Writer) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"list", "list mailboxes", runList},
+		{"search", "search a mailbox and print the matching UIDs", runSearch},
+		{"fetch", "download messages to files or standard output", runFetch},
+		{"append", "upload message files to a mailbox", runAppend},
+		{"watch", "print mailbox changes as they happen, using IDLE", runWatch},
+		{"probe", "report what a server supports", runProbe},
+		{"conformance", "check that a server's responses follow the IMAP grammar", runConformance},
+		{"export", "mirror a mailbox to a Maildir", runExport},
+		{"sync", "mirror mailboxes to Maildirs in one bounded pass, for batch jobs", runSync},
+		{"import", "upload a Maildir to a mailbox", runImport},
+		{"bench", "measure command latency and throughput", runBench},
+	}
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "imapgo: %v\n", err)
+		}
+		os.Exit(exitCode(err))
+	}
+}
+
+// exitCode returns the exit status for the error of a command: the one
+// chosen by the error if it has an ExitCode method, or 1.
+func exitCode(err error) int {
+	var coder interface{ ExitCode() int }
+	if errors.As(err, &coder) {
+		return coder.ExitCode()
+	}
+	return 1
+}
+
+// run runs the command named by args[0].
+func run(args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(os.Stderr)
+		return flag.ErrHelp
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:], stdout)
+		}
+	}
+	usage(os.Stderr)
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: imapgo <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-11s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "imapgo <command> -h" for the flags of a command.`)
+}
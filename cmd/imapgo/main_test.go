@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/meszmate/imap-go/imaptest"
+	"github.com/meszmate/imap-go/server"
+	_ "github.com/meszmate/imap-go/server/commands"
+	"github.com/meszmate/imap-go/server/memserver"
+	"github.com/meszmate/imap-go/wire"
+)
+
+// newTestServer starts a memserver with two messages in INBOX and returns
+// the connection flags to reach it.
+func newTestServer(t *testing.T) []string {
+	t.Helper()
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	for _, msg := range []string{"Subject: one\r\n\r\nfirst", "Subject: two\r\n\r\nsecond"} {
+		if err := mem.Deliver("alice", "INBOX", strings.NewReader(msg)); err != nil {
+			t.Fatalf("Deliver() error: %v", err)
+		}
+	}
+	h := imaptest.NewHarness(t, mem.NewServer())
+	t.Setenv(passwordEnv, "secret")
+	return []string{"-addr", h.Addr(), "-user", "alice", "-tls=false"}
+}
+
+func runCommand(t *testing.T, args ...string) string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := run(args, &out); err != nil {
+		t.Fatalf("run(%q) error: %v", args, err)
+	}
+	return out.String()
+}
+
+func TestList(t *testing.T) {
+	conn := newTestServer(t)
+	// The in-memory server does not accept wildcards unquoted, as the client
+	// sends them, so list a mailbox by name.
+	out := runCommand(t, append(append([]string{"list", "-status"}, conn...), "INBOX")...)
+	if !strings.HasPrefix(out, "INBOX\t2 messages, 2 unseen") {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	conn := newTestServer(t)
+	if out := runCommand(t, append(append([]string{"search"}, conn...), "ALL")...); out != "1\n2\n" {
+		t.Errorf("output = %q", out)
+	}
+	if out := runCommand(t, append(append([]string{"search", "-subject", "two", "-unseen"}, conn...), "UID", "1:*")...); out != "2\n" {
+		t.Errorf("output with flags = %q", out)
+	}
+}
+
+func TestBench(t *testing.T) {
+	conn := newTestServer(t)
+	out := runCommand(t, append([]string{"bench", "-n", "20", "-c", "2"}, conn...)...)
+	if !strings.HasPrefix(out, "20 noop operations on 2 connections") {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestSync(t *testing.T) {
+	conn := newTestServer(t)
+	dir := t.TempDir()
+	out := runCommand(t, append(append([]string{"sync", "-json"}, conn...), dir)...)
+	var summary struct {
+		Fetched  int    `json:"fetched"`
+		Category string `json:"category"`
+	}
+	if err := json.Unmarshal([]byte(out), &summary); err != nil {
+		t.Fatalf("output = %q: %v", out, err)
+	}
+	if summary.Fetched != 2 || summary.Category != "none" {
+		t.Errorf("summary = %+v", summary)
+	}
+
+	// A missing mailbox and rejected credentials have their own exit
+	// statuses.
+	err := run(append(append([]string{"sync", "-mailbox", "INBOX,Missing"}, conn...), dir), &bytes.Buffer{})
+	if code := exitCode(err); code != 65 {
+		t.Errorf("sync of a missing mailbox: error = %v, exit code %d, want 65", err, code)
+	}
+	t.Setenv(passwordEnv, "wrong")
+	err = run(append(append([]string{"sync"}, conn...), dir), &bytes.Buffer{})
+	if code := exitCode(err); code != 77 {
+		t.Errorf("sync with a wrong password: error = %v, exit code %d, want 77", err, code)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	conn := newTestServer(t)
+	if out := runCommand(t, append([]string{"conformance"}, conn...)...); out != fmt.Sprintf("%d scripts passed\n", len(imaptest.CoreScripts)) {
+		t.Errorf("output = %q", out)
+	}
+
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	srv := mem.NewServer()
+	srv.WrapHandler("NOOP", func(next server.CommandHandler) server.CommandHandler {
+		return server.CommandHandlerFunc(func(ctx *server.CommandContext) error {
+			ctx.Conn.Encoder().Encode(func(enc *wire.Encoder) {
+				enc.Star().Atom("0").SP().Atom("EXPUNGE").CRLF()
+			})
+			ctx.Conn.WriteOK(ctx.Tag, "NOOP completed")
+			return nil
+		})
+	})
+	h := imaptest.NewHarness(t, srv)
+	var out bytes.Buffer
+	err := run([]string{"conformance", "-addr", h.Addr(), "-user", "alice", "-tls=false", "login"}, &out)
+	if !errors.Is(err, errViolations) || exitCode(err) != 1 {
+		t.Errorf("conformance against a broken server: error = %v, exit code %d", err, exitCode(err))
+	}
+	if !strings.HasPrefix(out.String(), "login: a4 NOOP: ") {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	if err := run([]string{"frobnicate"}, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error")
+	}
+}
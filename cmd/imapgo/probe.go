@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+func runProbe(args []string, stdout io.Writer) error {
+	fs, cf := newFlagSet("probe", "")
+	timeout := fs.Duration("timeout", 30*time.Second, "time allowed for the whole probe")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Without -user the probe runs unauthenticated and only covers the
+	// commands allowed before login.
+	c, err := cf.connect()
+	if err != nil {
+		return err
+	}
+	defer logout(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	report, err := c.Probe(ctx)
+	if report == nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "State:        %v\n", report.State)
+	if len(report.PreAuthCaps) > 0 {
+		fmt.Fprintf(stdout, "Pre-auth:     %s\n", strings.Join(report.PreAuthCaps, " "))
+	}
+	fmt.Fprintf(stdout, "Capabilities: %s\n", strings.Join(report.Caps, " "))
+	if len(report.ServerID) > 0 {
+		keys := make([]string, 0, len(report.ServerID))
+		for k := range report.ServerID {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintln(stdout, "Server ID:")
+		for _, k := range keys {
+			fmt.Fprintf(stdout, "  %s: %s\n", k, report.ServerID[k])
+		}
+	}
+	if ns := report.Namespace; ns != nil {
+		for _, d := range ns.Personal {
+			fmt.Fprintf(stdout, "Namespace:    personal %q delimiter %q\n", d.Prefix, d.Delim)
+		}
+		for _, d := range ns.Other {
+			fmt.Fprintf(stdout, "Namespace:    other %q delimiter %q\n", d.Prefix, d.Delim)
+		}
+		for _, d := range ns.Shared {
+			fmt.Fprintf(stdout, "Namespace:    shared %q delimiter %q\n", d.Prefix, d.Delim)
+		}
+	}
+	if len(report.Enabled) > 0 {
+		fmt.Fprintf(stdout, "Enabled:      %s\n", strings.Join(report.Enabled, " "))
+	}
+	var specialUse []string
+	for attr, mailbox := range report.SpecialUse {
+		specialUse = append(specialUse, fmt.Sprintf("%s %s", attr, mailbox))
+	}
+	sort.Strings(specialUse)
+	for _, s := range specialUse {
+		fmt.Fprintf(stdout, "Special-use:  %s\n", s)
+	}
+	for _, q := range report.Quotas {
+		for _, r := range q.Resources {
+			fmt.Fprintf(stdout, "Quota:        %q %s %d/%d\n", q.Root, r.Name, r.Usage, r.Limit)
+		}
+	}
+
+	names := make([]string, 0, len(report.Errors))
+	for name := range report.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(stdout, "Failed:       %s: %v\n", name, report.Errors[name])
+	}
+	return err
+}
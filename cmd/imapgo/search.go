@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/meszmate/imap-go/client/search"
+)
+
+func runSearch(args []string, stdout io.Writer) error {
+	fs, cf := newFlagSet("search", "[criteria]")
+	mailbox := fs.String("mailbox", "INBOX", "mailbox to search")
+	pageSize := fs.Uint("page", 0, "number of UIDs requested at a time, with PARTIAL if the server supports it")
+	from := fs.String("from", "", "match messages whose From header contains `text`")
+	to := fs.String("to", "", "match messages whose To header contains `text`")
+	subject := fs.String("subject", "", "match messages whose Subject header contains `text`")
+	text := fs.String("text", "", "match messages whose header or body contains `text`")
+	since := fs.String("since", "", "match messages received on or after `date` (YYYY-MM-DD)")
+	before := fs.String("before", "", "match messages received before `date` (YYYY-MM-DD)")
+	unseen := fs.Bool("unseen", false, "match unread messages")
+	flagged := fs.Bool("flagged", false, "match flagged messages")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	q := search.All()
+	for _, s := range []struct {
+		value string
+		key   func(string) search.Criteria
+	}{
+		{*from, search.From}, {*to, search.To}, {*subject, search.Subject}, {*text, search.Text},
+	} {
+		if s.value != "" {
+			q = q.And(s.key(s.value))
+		}
+	}
+	for _, d := range []struct {
+		name, value string
+		key         func(time.Time) search.Criteria
+	}{
+		{"since", *since, search.Since}, {"before", *before, search.Before},
+	} {
+		if d.value == "" {
+			continue
+		}
+		t, err := time.Parse("2006-01-02", d.value)
+		if err != nil {
+			return fmt.Errorf("invalid -%s date %q", d.name, d.value)
+		}
+		q = q.And(d.key(t))
+	}
+	if *unseen {
+		q = q.And(search.Unseen())
+	}
+	if *flagged {
+		q = q.And(search.Flagged())
+	}
+
+	// Criteria given as arguments are in IMAP syntax and are added to
+	// those of the flags.
+	criteria := q.String()
+	if raw := strings.Join(fs.Args(), " "); raw != "" {
+		if criteria == "ALL" {
+			criteria = raw
+		} else {
+			criteria += " " + raw
+		}
+	}
+
+	c, err := cf.connect()
+	if err != nil {
+		return err
+	}
+	defer logout(c)
+
+	if _, err := c.Examine(*mailbox); err != nil {
+		return err
+	}
+	it := c.UIDSearchPages(criteria, uint32(*pageSize))
+	for it.Next() {
+		for _, uid := range it.Page() {
+			fmt.Fprintln(stdout, uid)
+		}
+	}
+	return it.Err()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/meszmate/imap-go/client"
+	"github.com/meszmate/imap-go/client/maildir"
+)
+
+func runExport(args []string, stdout io.Writer) error {
+	fs, cf := newFlagSet("export", "<maildir>")
+	mailbox := fs.String("mailbox", "INBOX", "mailbox to export")
+	batch := fs.Int("batch", maildir.DefaultBatchSize, "number of messages fetched per command")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("export needs a Maildir directory")
+	}
+
+	c, err := cf.connect()
+	if err != nil {
+		return err
+	}
+	defer logout(c)
+
+	res, err := maildir.Export(c, *mailbox, fs.Arg(0), &maildir.ExportOptions{BatchSize: *batch})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%d messages exported, %d updated\n", res.Exported, res.Updated)
+	return nil
+}
+
+func runImport(args []string, stdout io.Writer) error {
+	fs, cf := newFlagSet("import", "<maildir>")
+	mailbox := fs.String("mailbox", "INBOX", "mailbox to import to")
+	batch := fs.Int("batch", maildir.DefaultBatchSize, "number of messages appended per command with MULTIAPPEND")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("import needs a Maildir directory")
+	}
+
+	c, err := cf.connect()
+	if err != nil {
+		return err
+	}
+	defer logout(c)
+
+	res, err := maildir.Import(c, fs.Arg(0), *mailbox, &maildir.ImportOptions{BatchSize: *batch})
+	if res != nil {
+		fmt.Fprintf(stdout, "%d messages imported\n", res.Imported)
+	}
+	return err
+}
+
+func runSync(args []string, stdout io.Writer) error {
+	fs, cf := newFlagSet("sync", "<dir>")
+	mailboxes := fs.String("mailbox", "INBOX", "comma-separated mailboxes to sync; several are synced to Maildirs under <dir>")
+	timeout := fs.Duration("timeout", 10*time.Minute, "maximum duration of the pass, 0 for no limit")
+	prune := fs.Bool("prune", false, "remove the files of messages no longer on the server")
+	batch := fs.Int("batch", maildir.DefaultBatchSize, "number of messages fetched per command")
+	jsonOut := fs.Bool("json", false, "print the summary as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("sync needs a directory")
+	}
+	if cf.addr == "" {
+		return fmt.Errorf("no server address, use -addr or $IMAPGO_ADDR")
+	}
+
+	opts := &maildir.SyncOptions{
+		Timeout: *timeout,
+		Export:  maildir.ExportOptions{BatchSize: *batch, Prune: *prune},
+	}
+	for _, name := range strings.Split(*mailboxes, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			opts.Mailboxes = append(opts.Mailboxes, name)
+		}
+	}
+	summary, err := maildir.SyncOnce(func() (*client.Client, error) { return cf.connect() }, fs.Arg(0), opts)
+
+	if *jsonOut {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if jsonErr := enc.Encode(summary); jsonErr != nil && err == nil {
+			return jsonErr
+		}
+		return err
+	}
+	for _, ms := range summary.Mailboxes {
+		fmt.Fprintf(stdout, "%s: %d fetched, %d updated, %d deleted, %d bytes", ms.Mailbox, ms.Fetched, ms.Updated, ms.Deleted, ms.Bytes)
+		if ms.Error != "" {
+			fmt.Fprintf(stdout, " (%s)", ms.Error)
+		}
+		fmt.Fprintln(stdout)
+	}
+	fmt.Fprintf(stdout, "%d fetched, %d updated, %d deleted, %d bytes in %v\n",
+		summary.Fetched, summary.Updated, summary.Deleted, summary.Bytes, summary.Duration.Round(time.Millisecond))
+	return err
+}
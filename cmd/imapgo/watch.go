@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/meszmate/imap-go/client"
+)
+
+func runWatch(args []string, stdout io.Writer) error {
+	fs, cf := newFlagSet("watch", "")
+	mailbox := fs.String("mailbox", "INBOX", "mailbox to watch")
+	probe := fs.Duration("probe", client.DefaultProbeInterval, "how often to check that the connection is alive")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// The handlers run on the client's reader goroutine, which is the only
+	// one writing to stdout once IDLE has started, except for the
+	// reconnect notice, written while no client is connected.
+	event := func(format string, args ...interface{}) {
+		fmt.Fprintf(stdout, "%s %s\n", time.Now().Format(time.TimeOnly), fmt.Sprintf(format, args...))
+	}
+	handler := &client.UnilateralDataHandler{
+		Exists:  func(n uint32) { event("%d EXISTS", n) },
+		Expunge: func(seq uint32) { event("%d EXPUNGE", seq) },
+		Fetch: func(seq uint32, flags []string) {
+			event("%d FLAGS (%s)", seq, strings.Join(flags, " "))
+		},
+	}
+	connect := func() (*client.Client, error) {
+		return cf.connect(client.WithUnilateralDataHandler(handler))
+	}
+	c, err := connect()
+	if err != nil {
+		return err
+	}
+
+	data, err := c.Select(*mailbox, nil)
+	if err != nil {
+		logout(c)
+		return err
+	}
+	fmt.Fprintf(stdout, "%s: %d messages, watching (interrupt to stop)\n", *mailbox, data.NumMessages)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	stop := make(chan struct{})
+	go func() {
+		<-interrupt
+		close(stop)
+	}()
+
+	// Connections that die silently are detected by the periodic probe
+	// and replaced.
+	c, err = c.Watch(stop, &client.WatchOptions{
+		Mailbox:       *mailbox,
+		ProbeInterval: *probe,
+		Reconnect: func() (*client.Client, error) {
+			event("reconnecting")
+			return connect()
+		},
+	})
+	logout(c)
+	return err
+}
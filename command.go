@@ -29,17 +29,18 @@ const (
 	CommandIdle        = "IDLE"
 
 	// Selected state commands
-	CommandClose   = "CLOSE"
+	CommandCheck    = "CHECK"
+	CommandClose    = "CLOSE"
 	CommandUnselect = "UNSELECT"
-	CommandExpunge = "EXPUNGE"
-	CommandSearch  = "SEARCH"
-	CommandFetch   = "FETCH"
-	CommandStore   = "STORE"
-	CommandCopy    = "COPY"
-	CommandMove    = "MOVE"
-	CommandSort    = "SORT"
-	CommandThread  = "THREAD"
-	CommandUID     = "UID"
+	CommandExpunge  = "EXPUNGE"
+	CommandSearch   = "SEARCH"
+	CommandFetch    = "FETCH"
+	CommandStore    = "STORE"
+	CommandCopy     = "COPY"
+	CommandMove     = "MOVE"
+	CommandSort     = "SORT"
+	CommandThread   = "THREAD"
+	CommandUID      = "UID"
 
 	// Extension commands
 	CommandCompress       = "COMPRESS"
@@ -1,5 +1,7 @@
 package imap
 
+import "sort"
+
 // CopyData represents the result of a COPY or MOVE command.
 type CopyData struct {
 	// UIDValidity is the UID validity of the destination mailbox.
@@ -9,3 +11,72 @@ type CopyData struct {
 	// DestUIDs is the set of UIDs in the destination mailbox.
 	DestUIDs UIDSet
 }
+
+// Normalize puts SourceUIDs and DestUIDs in a deterministic, compact form
+// for the COPYUID response code. The nth source UID corresponds to the nth
+// destination UID (RFC 4315), so the pairs are sorted by source UID
+// together and DestUIDs keeps the resulting order, merging only runs of
+// consecutive UIDs. The sets are left unchanged if they contain "*" or
+// differ in size.
+func (d *CopyData) Normalize() {
+	src, ok := expandUIDSet(&d.SourceUIDs)
+	if !ok {
+		return
+	}
+	dst, ok := expandUIDSet(&d.DestUIDs)
+	if !ok || len(src) != len(dst) {
+		return
+	}
+
+	pairs := make([][2]uint32, len(src))
+	for i := range src {
+		pairs[i] = [2]uint32{src[i], dst[i]}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i][0] < pairs[j][0]
+	})
+
+	var source, dest UIDSet
+	for _, p := range pairs {
+		source.AddNum(UID(p[0]))
+		dest.AddNum(UID(p[1]))
+	}
+	source.Normalize()
+	d.SourceUIDs = source
+	d.DestUIDs = UIDSet{Set: compactNumSet(dest.Set)}
+}
+
+// maxNormalizeUIDs is the largest COPYUID set CopyData.Normalize expands.
+const maxNormalizeUIDs = 1 << 20
+
+// expandUIDSet returns the UIDs of a set in order. It reports false if the
+// set contains "*" or too many UIDs.
+func expandUIDSet(us *UIDSet) ([]uint32, bool) {
+	var uids []uint32
+	var total uint64
+	for _, r := range us.Set {
+		if r.Start == 0 || r.Stop == 0 {
+			return nil, false
+		}
+		if r.Start <= r.Stop {
+			total += uint64(r.Stop-r.Start) + 1
+		} else {
+			total += uint64(r.Start-r.Stop) + 1
+		}
+		if total > maxNormalizeUIDs {
+			return nil, false
+		}
+	}
+	for _, r := range us.Set {
+		if r.Start <= r.Stop {
+			for n := uint64(r.Start); n <= uint64(r.Stop); n++ {
+				uids = append(uids, uint32(n))
+			}
+		} else {
+			for n := uint64(r.Start); n >= uint64(r.Stop); n-- {
+				uids = append(uids, uint32(n))
+			}
+		}
+	}
+	return uids, true
+}
@@ -0,0 +1,108 @@
+// Command attachment-downloader saves the attachments of the messages
+// matching a search into a directory:
+//
+//	attachment-downloader -addr imap.example.com:993 -user me@example.com \
+//		-search 'FROM billing@example.com SINCE 1-Jan-2024' -name '*.pdf' -dir invoices
+//
+// It fetches the BODYSTRUCTURE of the messages with QueryMessages, finds
+// the attachments in it with FindParts, and fetches only those parts, so
+// the rest of the messages is not downloaded. Parts are decoded from their
+// Content-Transfer-Encoding before they are saved.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client"
+	"github.com/meszmate/imap-go/examples/internal/exampleutil"
+)
+
+func main() {
+	account := exampleutil.AccountFlags(flag.CommandLine, "")
+	mailbox := flag.String("mailbox", "INBOX", "mailbox to search")
+	search := flag.String("search", "ALL", "IMAP search criteria selecting the messages")
+	name := flag.String("name", "", "only save attachments whose file name matches this pattern, such as *.pdf")
+	dir := flag.String("dir", ".", "directory to save the attachments in")
+	flag.Parse()
+
+	c, err := account.Dial()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() { _ = c.Logout() }()
+
+	if _, err := c.Select(*mailbox, &imap.SelectOptions{ReadOnly: true}); err != nil {
+		log.Fatal(err)
+	}
+	filter := imap.PartFilter{Disposition: "attachment", Filename: *name}
+	if err := download(c, *search, filter, *dir, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// download saves the parts matching filter of the messages of the
+// selected mailbox matching search into dir, and reports them to w.
+func download(c *client.Client, search string, filter imap.PartFilter, dir string, w io.Writer) error {
+	res, err := c.QueryMessages(&client.QueryOptions{Search: search, Items: "(BODYSTRUCTURE)"})
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range res.Messages {
+		bs, err := msg.Structure()
+		if err != nil {
+			return fmt.Errorf("message %d: %w", msg.UID, err)
+		}
+		if bs == nil {
+			continue
+		}
+		for _, part := range bs.FindParts(filter) {
+			data, err := c.UIDFetchSection(msg.UID, part.PartNumber())
+			if err != nil {
+				return fmt.Errorf("message %d, part %s: %w", msg.UID, part.PartNumber(), err)
+			}
+			data, err = imap.DecodeTransferEncoding(part.Structure.Encoding, data)
+			if err != nil {
+				return fmt.Errorf("message %d, part %s: %w", msg.UID, part.PartNumber(), err)
+			}
+			path, err := save(dir, msg.UID, part.Structure.Filename(), data)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "saved %s (%d bytes)\n", filepath.Base(path), len(data))
+		}
+	}
+	return nil
+}
+
+// save writes data to a file of dir named after the attachment. The name
+// given by the message is stripped of its directories, as it comes from
+// the sender; if a file of that name exists, the UID of the message is
+// prepended to it rather than overwriting the file.
+func save(dir string, uid imap.UID, name string, data []byte) (string, error) {
+	name = filepath.Base(filepath.Clean("/" + name))
+	if name == "/" || name == "." {
+		name = "attachment"
+	}
+	path := filepath.Join(dir, name)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		path = filepath.Join(dir, fmt.Sprintf("%d-%s", uid, name))
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
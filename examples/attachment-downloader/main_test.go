@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/examples/internal/exampleutil"
+)
+
+const invoice = "From: billing@example.com\r\n" +
+	"Subject: Your invoice\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=b\r\n" +
+	"\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Please find your invoice attached.\r\n" +
+	"--b\r\n" +
+	"Content-Type: application/pdf; name=invoice.pdf\r\n" +
+	"Content-Disposition: attachment; filename=invoice.pdf\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQKJSBpbnZvaWNlCg==\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/csv\r\n" +
+	"Content-Disposition: attachment; filename=\"../usage.csv\"\r\n" +
+	"\r\n" +
+	"day,bytes\r\n" +
+	"1,42\r\n" +
+	"--b--\r\n"
+
+func Example_download() {
+	srv := exampleutil.StartServer()
+	defer srv.Close()
+	for i := 0; i < 2; i++ {
+		if err := srv.Mem.Deliver("alice", "INBOX", strings.NewReader(invoice)); err != nil {
+			panic(err)
+		}
+	}
+	c := srv.Dial("alice")
+	defer c.Close()
+	if _, err := c.Select("INBOX", &imap.SelectOptions{ReadOnly: true}); err != nil {
+		panic(err)
+	}
+
+	dir, err := os.MkdirTemp("", "attachments")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filter := imap.PartFilter{Disposition: "attachment"}
+	if err := download(c, "FROM billing@example.com", filter, dir, os.Stdout); err != nil {
+		panic(err)
+	}
+	pdf, err := os.ReadFile(filepath.Join(dir, "invoice.pdf"))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%q\n", pdf)
+	// Output:
+	// saved invoice.pdf (19 bytes)
+	// saved usage.csv (15 bytes)
+	// saved 2-invoice.pdf (19 bytes)
+	// saved 2-usage.csv (15 bytes)
+	// "%PDF-1.4\n% invoice\n"
+}
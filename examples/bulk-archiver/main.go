@@ -0,0 +1,149 @@
+// Command bulk-archiver moves old messages out of a mailbox into one
+// archive mailbox per year, as mail clients do, such as Archive/2023 for
+// the messages received in 2023:
+//
+//	bulk-archiver -addr imap.example.com:993 -user me@example.com -days 365 -dry-run
+//
+// Messages are selected by their internal date, the date they were
+// received, with QueryMessages. They are moved with UID MOVE if the server
+// supports it; otherwise they are copied and then deleted from the mailbox
+// with DeleteMessages, which expunges only them even on servers without
+// UIDPLUS. With -dry-run, the moves are only reported.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client"
+	"github.com/meszmate/imap-go/examples/internal/exampleutil"
+)
+
+func main() {
+	account := exampleutil.AccountFlags(flag.CommandLine, "")
+	opts := &archiveOptions{}
+	flag.StringVar(&opts.Mailbox, "mailbox", "INBOX", "mailbox to archive messages from")
+	flag.StringVar(&opts.Root, "root", "Archive", "parent of the archive mailboxes")
+	days := flag.Int("days", 365, "archive messages received more than this many days ago")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "report the moves without making them")
+	flag.Parse()
+	opts.Before = time.Now().AddDate(0, 0, -*days)
+
+	c, err := account.Dial()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() { _ = c.Logout() }()
+
+	if err := archive(c, opts, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// archiveOptions selects the messages to archive and where.
+type archiveOptions struct {
+	Mailbox string
+	Root    string
+	// Before is the date from which messages are kept.
+	Before time.Time
+	DryRun bool
+}
+
+// archive moves the messages of opts.Mailbox received before opts.Before
+// to the archive mailbox of their year, and reports the moves to w.
+func archive(c *client.Client, opts *archiveOptions, w io.Writer) error {
+	if _, err := c.Select(opts.Mailbox, nil); err != nil {
+		return err
+	}
+	res, err := c.QueryMessages(&client.QueryOptions{
+		Search: "BEFORE " + opts.Before.Format("2-Jan-2006"),
+		Items:  "(INTERNALDATE)",
+	})
+	if err != nil {
+		return err
+	}
+
+	byYear := make(map[int][]imap.UID)
+	for _, msg := range res.Messages {
+		year := msg.InternalDate.Year()
+		byYear[year] = append(byYear[year], msg.UID)
+	}
+	years := make([]int, 0, len(byYear))
+	for year := range byYear {
+		years = append(years, year)
+	}
+	sort.Ints(years)
+
+	delim, existing, err := archiveMailboxes(c, opts.Root)
+	if err != nil {
+		return err
+	}
+	for _, year := range years {
+		uids := byYear[year]
+		dest := opts.Root + delim + strconv.Itoa(year)
+		verb := "moved"
+		if opts.DryRun {
+			verb = "would move"
+		} else {
+			if !existing[dest] {
+				if err := c.Create(dest); err != nil {
+					return fmt.Errorf("creating %s: %w", dest, err)
+				}
+			}
+			if err := move(c, opts.Mailbox, uids, dest); err != nil {
+				return fmt.Errorf("moving to %s: %w", dest, err)
+			}
+		}
+		fmt.Fprintf(w, "%s %d messages to %s\n", verb, len(uids), dest)
+	}
+	return nil
+}
+
+// archiveMailboxes returns the hierarchy delimiter of the server and the
+// archive mailboxes that already exist.
+func archiveMailboxes(c *client.Client, root string) (string, map[string]bool, error) {
+	// LIST "" "" returns the delimiter of the root of the hierarchy.
+	list, err := c.ListMailboxes("", "")
+	if err != nil {
+		return "", nil, err
+	}
+	if len(list) == 0 || list[0].Delim == 0 {
+		return "", nil, errors.New("the server has no mailbox hierarchy")
+	}
+	delim := string(list[0].Delim)
+
+	list, err = c.ListMailboxes("", root+delim+"%")
+	if err != nil {
+		return "", nil, err
+	}
+	existing := make(map[string]bool, len(list))
+	for _, data := range list {
+		existing[data.Mailbox] = true
+	}
+	return delim, existing, nil
+}
+
+// move moves the messages with the given UIDs from the selected mailbox
+// to dest.
+func move(c *client.Client, mailbox string, uids []imap.UID, dest string) error {
+	set := &imap.UIDSet{}
+	set.AddNum(uids...)
+	set.Normalize()
+	if c.SupportsMove() {
+		_, err := c.UIDMove(set.String(), dest)
+		return err
+	}
+	if _, err := c.UIDCopy(set.String(), dest); err != nil {
+		return err
+	}
+	_, err := c.DeleteMessages(mailbox, uids, client.FlagAndExpunge, nil)
+	return err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client"
+	"github.com/meszmate/imap-go/examples/internal/exampleutil"
+)
+
+func Example_archive() {
+	srv := exampleutil.StartServer()
+	defer srv.Close()
+	c := srv.Dial("alice")
+	defer c.Close()
+
+	for _, msg := range []struct {
+		date  string
+		flags []imap.Flag
+	}{
+		{"2022-03-14", nil},
+		{"2022-11-02", []imap.Flag{imap.FlagSeen}},
+		{"2023-05-20", nil},
+		{"2025-02-01", nil},
+		// Deleted by another client, but not expunged yet: the
+		// archiver leaves it alone.
+		{"2025-06-30", []imap.Flag{imap.FlagDeleted}},
+	} {
+		date, _ := time.Parse(time.DateOnly, msg.date)
+		literal := []byte("Subject: Sent on " + msg.date + "\r\n\r\nHello.\r\n")
+		appended := []client.AppendMessage{{Flags: msg.flags, InternalDate: date, Literal: literal}}
+		if _, err := c.MultiAppend("INBOX", appended); err != nil {
+			panic(err)
+		}
+	}
+
+	opts := &archiveOptions{
+		Mailbox: "INBOX",
+		Root:    "Archive",
+		Before:  time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+		DryRun:  true,
+	}
+	if err := archive(c, opts, os.Stdout); err != nil {
+		panic(err)
+	}
+	opts.DryRun = false
+	if err := archive(c, opts, os.Stdout); err != nil {
+		panic(err)
+	}
+
+	for _, mailbox := range []string{"INBOX", "Archive/2022", "Archive/2023"} {
+		data, err := c.Select(mailbox, &imap.SelectOptions{ReadOnly: true})
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("%s: %d messages\n", mailbox, data.NumMessages)
+	}
+	// Output:
+	// would move 2 messages to Archive/2022
+	// would move 1 messages to Archive/2023
+	// moved 2 messages to Archive/2022
+	// moved 1 messages to Archive/2023
+	// INBOX: 2 messages
+	// Archive/2022: 2 messages
+	// Archive/2023: 1 messages
+}
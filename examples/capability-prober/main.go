@@ -0,0 +1,119 @@
+// Command capability-prober logs in to an IMAP server and reports the
+// features it supports, such as to check a server before configuring a
+// client for it:
+//
+//	capability-prober -addr imap.example.com:993 -user me@example.com
+//
+// The password is read from the -password flag or the IMAP_PASSWORD
+// environment variable. The report comes from Client.Probe.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client"
+	"github.com/meszmate/imap-go/examples/internal/exampleutil"
+)
+
+// features are the extensions reported, with what they are good for.
+var features = []struct {
+	cap  imap.Cap
+	what string
+}{
+	{imap.CapIMAP4rev2, "IMAP4rev2"},
+	{imap.CapIdle, "push notifications (IDLE)"},
+	{imap.CapMove, "atomic moves (MOVE)"},
+	{imap.CapUIDPlus, "UIDs of copied and appended messages (UIDPLUS)"},
+	{imap.CapCondStore, "change tracking (CONDSTORE)"},
+	{imap.CapQResync, "quick resynchronization (QRESYNC)"},
+	{imap.CapSpecialUse, "special-use mailboxes (SPECIAL-USE)"},
+	{imap.CapLiteralPlus, "non-synchronizing literals (LITERAL+)"},
+	{imap.CapSort, "server-side sorting (SORT)"},
+	{imap.CapQuota, "quotas (QUOTA)"},
+}
+
+func main() {
+	account := exampleutil.AccountFlags(flag.CommandLine, "")
+	timeout := flag.Duration("timeout", 30*time.Second, "time allowed for the probe")
+	flag.Parse()
+
+	c, err := account.Dial()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() { _ = c.Logout() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if err := probe(ctx, c, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// probe writes the report of Client.Probe to w.
+func probe(ctx context.Context, c *client.Client, w io.Writer) error {
+	report, err := c.Probe(ctx)
+	if err != nil {
+		return err
+	}
+
+	if name := report.ServerID["name"]; name != "" {
+		fmt.Fprintf(w, "Server: %s %s\n", name, report.ServerID["version"])
+	}
+
+	fmt.Fprintln(w, "Features:")
+	for _, f := range features {
+		mark := "no "
+		if hasCap(report.Caps, f.cap) {
+			mark = "yes"
+		}
+		fmt.Fprintf(w, "  %s  %s\n", mark, f.what)
+	}
+
+	if len(report.SpecialUse) > 0 {
+		fmt.Fprintln(w, "Special-use mailboxes:")
+		var attrs []string
+		for attr := range report.SpecialUse {
+			attrs = append(attrs, string(attr))
+		}
+		sort.Strings(attrs)
+		for _, attr := range attrs {
+			fmt.Fprintf(w, "  %-8s %s\n", attr, report.SpecialUse[imap.MailboxAttr(attr)])
+		}
+	}
+
+	for _, q := range report.Quotas {
+		for _, r := range q.Resources {
+			fmt.Fprintf(w, "Quota %q: %s %d of %d\n", q.Root, r.Name, r.Usage, r.Limit)
+		}
+	}
+
+	var failed []string
+	for name := range report.Errors {
+		failed = append(failed, name)
+	}
+	sort.Strings(failed)
+	for _, name := range failed {
+		fmt.Fprintf(w, "%s failed: %v\n", name, report.Errors[name])
+	}
+	return nil
+}
+
+// hasCap reports whether caps contains cap.
+func hasCap(caps []string, cap imap.Cap) bool {
+	for _, c := range caps {
+		if strings.EqualFold(c, string(cap)) {
+			return true
+		}
+	}
+	return false
+}
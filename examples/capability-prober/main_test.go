@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/meszmate/imap-go/examples/internal/exampleutil"
+	"github.com/meszmate/imap-go/extensions/move"
+	"github.com/meszmate/imap-go/extensions/specialuse"
+	"github.com/meszmate/imap-go/extensions/uidplus"
+	"github.com/meszmate/imap-go/server"
+)
+
+func Example_probe() {
+	srv := exampleutil.StartServer(server.WithExtensions(
+		move.New(), specialuse.New(), uidplus.New(),
+	))
+	defer srv.Close()
+	c := srv.Dial("alice")
+	defer c.Close()
+
+	if err := probe(context.Background(), c, os.Stdout); err != nil {
+		panic(err)
+	}
+	// Output:
+	// Features:
+	//   no   IMAP4rev2
+	//   yes  push notifications (IDLE)
+	//   yes  atomic moves (MOVE)
+	//   yes  UIDs of copied and appended messages (UIDPLUS)
+	//   no   change tracking (CONDSTORE)
+	//   no   quick resynchronization (QRESYNC)
+	//   yes  special-use mailboxes (SPECIAL-USE)
+	//   yes  non-synchronizing literals (LITERAL+)
+	//   no   server-side sorting (SORT)
+	//   no   quotas (QUOTA)
+}
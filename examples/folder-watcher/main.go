@@ -0,0 +1,137 @@
+// Command folder-watcher prints the sender and subject of the messages
+// arriving in a mailbox, as they arrive:
+//
+//	folder-watcher -addr imap.example.com:993 -user me@example.com -mailbox INBOX
+//
+// It keeps the connection in IDLE and, when the server reports new
+// messages, fetches their headers in a break of IDLE with an IdleBreaker,
+// so that one connection both waits for and fetches messages. It stops on
+// SIGINT.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client"
+	"github.com/meszmate/imap-go/examples/internal/exampleutil"
+)
+
+func main() {
+	account := exampleutil.AccountFlags(flag.CommandLine, "")
+	mailbox := flag.String("mailbox", "INBOX", "mailbox to watch")
+	flag.Parse()
+
+	w := newWatcher()
+	c, err := account.Dial(w.options()...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() { _ = c.Logout() }()
+	if err := w.start(c, *mailbox); err != nil {
+		log.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		close(stop)
+	}()
+
+	err = w.run(stop, func(msg *imap.FetchMessageBuffer) {
+		fmt.Printf("%s: %s\n", msg.Header.Get("From"), msg.Header.Get("Subject"))
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// watcher reports the messages arriving in a mailbox.
+type watcher struct {
+	// changed is signalled when the server reports new messages.
+	changed chan struct{}
+
+	c       *client.Client
+	breaker *client.IdleBreaker
+	// next is the lowest UID of the messages not reported yet.
+	next imap.UID
+}
+
+func newWatcher() *watcher {
+	return &watcher{changed: make(chan struct{}, 1)}
+}
+
+// options returns the options of the client the watcher is started on.
+func (w *watcher) options() []client.Option {
+	return []client.Option{client.WithUnilateralDataHandler(&client.UnilateralDataHandler{
+		Exists: func(uint32) {
+			// The handler must not block: the messages are fetched by
+			// run, and several reports before it does are one.
+			select {
+			case w.changed <- struct{}{}:
+			default:
+			}
+		},
+	})}
+}
+
+// start selects mailbox and starts IDLE on it. Messages arriving after
+// start returns are reported by run.
+func (w *watcher) start(c *client.Client, mailbox string) error {
+	data, err := c.Select(mailbox, nil)
+	if err != nil {
+		return err
+	}
+	w.c = c
+	w.next = data.UIDNext
+	w.breaker, err = c.IdleWithBreaks(nil)
+	return err
+}
+
+// run calls report with the UID and headers of the messages arriving
+// until stop is closed, and then ends IDLE.
+func (w *watcher) run(stop <-chan struct{}, report func(*imap.FetchMessageBuffer)) error {
+	ended := make(chan error, 1)
+	go func() { ended <- w.breaker.Idle().Wait() }()
+
+	for {
+		select {
+		case <-stop:
+			return w.breaker.Close()
+		case err := <-ended:
+			return fmt.Errorf("IDLE ended: %w", err)
+		case <-w.changed:
+		}
+
+		err := w.breaker.Do(func() error {
+			msgs, err := w.c.UIDFetchHeaders(strconv.FormatUint(uint64(w.next), 10)+":*", "From", "Subject")
+			if err != nil {
+				return err
+			}
+			next := w.next
+			for _, msg := range msgs {
+				// n:* includes the last message even if its UID is
+				// lower than n, when no message arrived.
+				if msg.UID < w.next {
+					continue
+				}
+				report(msg)
+				if msg.UID >= next {
+					next = msg.UID + 1
+				}
+			}
+			w.next = next
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/examples/internal/exampleutil"
+)
+
+func Example_watcher() {
+	srv := exampleutil.StartServer()
+	defer srv.Close()
+	deliver := func(from, subject string) {
+		msg := "From: " + from + "\r\nSubject: " + subject + "\r\n\r\nHello.\r\n"
+		if err := srv.Mem.Deliver("alice", "INBOX", strings.NewReader(msg)); err != nil {
+			panic(err)
+		}
+	}
+	// Messages in the mailbox before the watcher starts are not reported.
+	deliver("carol@example.com", "Old news")
+
+	w := newWatcher()
+	c := srv.Dial("alice", w.options()...)
+	defer c.Close()
+	if err := w.start(c, "INBOX"); err != nil {
+		panic(err)
+	}
+
+	deliver("bob@example.com", "Lunch?")
+	deliver("dave@example.com", "Build is green")
+
+	stop := make(chan struct{})
+	reported := 0
+	err := w.run(stop, func(msg *imap.FetchMessageBuffer) {
+		fmt.Printf("%s: %s\n", msg.Header.Get("From"), msg.Header.Get("Subject"))
+		if reported++; reported == 2 {
+			close(stop)
+		}
+	})
+	if err != nil {
+		panic(err)
+	}
+	// Output:
+	// bob@example.com: Lunch?
+	// dave@example.com: Build is green
+}
@@ -0,0 +1,117 @@
+// Package exampleutil holds the code shared by the example programs: the
+// flags selecting the account to connect to, and an in-process server the
+// examples run against in their tests.
+package exampleutil
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/meszmate/imap-go/client"
+	"github.com/meszmate/imap-go/server"
+	_ "github.com/meszmate/imap-go/server/commands"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+// Account is an IMAP account given on the command line.
+type Account struct {
+	Addr     string
+	User     string
+	Password string
+	// Plain connects without TLS, for servers on localhost.
+	Plain bool
+
+	// prefix is the prefix of the flags of the account.
+	prefix string
+}
+
+// AccountFlags defines the flags of an account on fs, with prefix before
+// their names, such as "src-" for the source account of a migration. The
+// password can also be given in the environment variable named
+// IMAP_PASSWORD, or IMAP_SRC_PASSWORD for the prefix "src-", to keep it out
+// of the process list.
+func AccountFlags(fs *flag.FlagSet, prefix string) *Account {
+	a := &Account{prefix: prefix}
+	fs.StringVar(&a.Addr, prefix+"addr", "imap.example.com:993", "address of the IMAP server")
+	fs.StringVar(&a.User, prefix+"user", "", "user name")
+	fs.StringVar(&a.Password, prefix+"password", "", "password")
+	fs.BoolVar(&a.Plain, prefix+"plain", false, "connect without TLS")
+	return a
+}
+
+// Dial connects to the account's server and logs in.
+func (a *Account) Dial(opts ...client.Option) (*client.Client, error) {
+	password := a.Password
+	if password == "" {
+		password = os.Getenv(passwordEnv(a))
+	}
+
+	var c *client.Client
+	var err error
+	if a.Plain {
+		c, err = client.Dial(a.Addr, opts...)
+	} else {
+		c, err = client.DialTLS(a.Addr, nil, opts...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", a.Addr, err)
+	}
+	if err := c.Login(a.User, password); err != nil {
+		_ = c.Close()
+		return nil, fmt.Errorf("logging in as %s: %w", a.User, err)
+	}
+	return c, nil
+}
+
+// passwordEnv returns the environment variable holding the password of a.
+func passwordEnv(a *Account) string {
+	prefix := strings.ToUpper(strings.ReplaceAll(a.prefix, "-", "_"))
+	return "IMAP_" + prefix + "PASSWORD"
+}
+
+// Server is an in-process server with a memory backend, for the tests of
+// the examples.
+type Server struct {
+	Mem *memserver.MemServer
+
+	srv *server.Server
+	l   net.Listener
+}
+
+// StartServer starts a server on a loopback address with the accounts
+// alice and bob, whose password is "secret". It panics if it cannot
+// listen.
+func StartServer(opts ...server.Option) *Server {
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	mem.AddUser("bob", "secret")
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	srv := mem.NewServer(opts...)
+	go func() { _ = srv.Serve(l) }()
+	return &Server{Mem: mem, srv: srv, l: l}
+}
+
+// Account returns the account of user on the server.
+func (s *Server) Account(user string) *Account {
+	return &Account{Addr: s.l.Addr().String(), User: user, Password: "secret", Plain: true}
+}
+
+// Dial connects to the server as user. It panics on failure.
+func (s *Server) Dial(user string, opts ...client.Option) *client.Client {
+	c, err := s.Account(user).Dial(opts...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	_ = s.srv.Close()
+}
@@ -0,0 +1,90 @@
+// Command migrate copies an IMAP account to another server: its mailboxes,
+// its messages with their flags and dates, and its subscriptions:
+//
+//	migrate -src-addr old.example.com:993 -src-user me \
+//		-dst-addr new.example.com:993 -dst-user me@example.com \
+//		-checkpoint migrate.json
+//
+// The passwords are read from the -src-password and -dst-password flags
+// or the IMAP_SRC_PASSWORD and IMAP_DST_PASSWORD environment variables.
+// With -checkpoint, the messages copied are recorded in a file, and a
+// migration that was interrupted, or that is run again to pick up the
+// messages that arrived since, copies only the messages not copied yet.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/meszmate/imap-go/client"
+	"github.com/meszmate/imap-go/client/migrate"
+	"github.com/meszmate/imap-go/examples/internal/exampleutil"
+)
+
+func main() {
+	srcAccount := exampleutil.AccountFlags(flag.CommandLine, "src-")
+	dstAccount := exampleutil.AccountFlags(flag.CommandLine, "dst-")
+	checkpoint := flag.String("checkpoint", "", "file recording the messages copied, to resume the migration")
+	batch := flag.Int("batch", migrate.DefaultBatchSize, "number of messages copied per command")
+	flag.Parse()
+
+	src, err := srcAccount.Dial()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() { _ = src.Logout() }()
+	dst, err := dstAccount.Dial()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() { _ = dst.Logout() }()
+
+	opts := &migrate.Options{BatchSize: *batch, Progress: printProgress}
+	if *checkpoint != "" {
+		if opts.Checkpoints, err = migrate.NewFileCheckpointStore(*checkpoint); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := run(src, dst, opts, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run migrates the account of src to dst and reports the result to w.
+func run(src, dst *client.Client, opts *migrate.Options, w io.Writer) error {
+	res, err := migrate.Migrate(src, dst, opts)
+	// The changes made before an error are reported too, so that they
+	// can be checked before running the migration again.
+	if len(res.Created) > 0 {
+		fmt.Fprintf(w, "created %s\n", strings.Join(res.Created, ", "))
+	}
+	var renamed []string
+	for old := range res.Renamed {
+		renamed = append(renamed, old)
+	}
+	sort.Strings(renamed)
+	for _, old := range renamed {
+		fmt.Fprintf(w, "renamed %s to %s\n", old, res.Renamed[old])
+	}
+	if len(res.Subscribed) > 0 {
+		fmt.Fprintf(w, "subscribed to %s\n", strings.Join(res.Subscribed, ", "))
+	}
+	fmt.Fprintf(w, "copied %d messages, skipped %d copied before\n", res.Copied, res.Skipped)
+	return err
+}
+
+// printProgress reports the progress of the migration on stderr.
+func printProgress(p migrate.Progress) {
+	eta := "unknown"
+	if p.ETA > 0 {
+		eta = p.ETA.Round(time.Second).String()
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d/%d mailboxes and %d/%d messages done, %s left\n",
+		p.Mailbox, p.MailboxesDone, p.MailboxesTotal, p.MessagesDone, p.MessagesTotal, eta)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/meszmate/imap-go/client/migrate"
+	"github.com/meszmate/imap-go/examples/internal/exampleutil"
+)
+
+func Example_run() {
+	srv := exampleutil.StartServer()
+	defer srv.Close()
+	src := srv.Dial("alice")
+	defer src.Close()
+	dst := srv.Dial("bob")
+	defer dst.Close()
+
+	for _, name := range []string{"Work", "Work/Projects"} {
+		if err := src.Create(name); err != nil {
+			panic(err)
+		}
+	}
+	if err := src.Subscribe("Work/Projects"); err != nil {
+		panic(err)
+	}
+	deliver := func(mailbox, subject string) {
+		msg := "Subject: " + subject + "\r\n\r\nHello.\r\n"
+		if err := srv.Mem.Deliver("alice", mailbox, strings.NewReader(msg)); err != nil {
+			panic(err)
+		}
+	}
+	deliver("INBOX", "Welcome")
+	deliver("INBOX", "Lunch?")
+	deliver("Work/Projects", "Kickoff")
+
+	dir, err := os.MkdirTemp("", "migrate")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	checkpoints, err := migrate.NewFileCheckpointStore(filepath.Join(dir, "migrate.json"))
+	if err != nil {
+		panic(err)
+	}
+	opts := &migrate.Options{Checkpoints: checkpoints}
+	if err := run(src, dst, opts, os.Stdout); err != nil {
+		panic(err)
+	}
+
+	// Running the migration again copies only the new messages.
+	deliver("INBOX", "Moved yet?")
+	if err := run(src, dst, opts, os.Stdout); err != nil {
+		panic(err)
+	}
+	// Output:
+	// created Work, Work/Projects
+	// subscribed to Work/Projects
+	// copied 3 messages, skipped 0 copied before
+	// copied 1 messages, skipped 3 copied before
+}
@@ -31,13 +31,14 @@ func main() {
 		server.WithNewSession(func(conn *server.Conn) (server.Session, error) {
 			return mem.NewSession(conn)
 		}),
+		server.WithReadTimeout(30*time.Second),
+		server.WithWriteTimeout(30*time.Second),
 	)
 
 	// Build middleware chain
 	chain := middleware.Chain(
 		middleware.Recovery(),
 		middleware.Logging(),
-		middleware.Timeout(30*time.Second),
 		middleware.RateLimit(middleware.RateLimitConfig{
 			MaxCommandsPerSecond: 100,
 			BurstSize:            10,
@@ -48,7 +48,7 @@ func main() {
 		server.WithNewSession(func(conn *server.Conn) (server.Session, error) {
 			return mem.NewSession(conn)
 		}),
-		server.WithGreetingText("imap-go demo server ready"),
+		server.WithGreeting(server.Greeting{Text: "imap-go demo server ready"}),
 	)
 
 	log.Printf("Starting IMAP server on %s (user: demo, password: demo)", addr)
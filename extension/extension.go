@@ -38,6 +38,31 @@ type ServerExtension interface {
 	OnEnabled(connID string) error
 }
 
+// ConnInfo is the read-only view of a server connection that is passed to
+// extensions. *server.Conn implements it.
+type ConnInfo interface {
+	// State returns the current connection state.
+	State() imap.ConnState
+	// IsTLS returns whether the connection is using TLS.
+	IsTLS() bool
+	// Enabled returns the capabilities enabled on the connection via ENABLE.
+	Enabled() *imap.CapSet
+}
+
+// StateCapabilityExtension is an optional interface for server extensions
+// whose advertised capabilities depend on the connection, e.g. AUTH=
+// mechanisms that are only listed before authentication. When implemented,
+// StateCapabilities is used instead of Capabilities for CAPABILITY responses
+// and the greeting.
+type StateCapabilityExtension interface {
+	Extension
+
+	// StateCapabilities returns the capabilities to advertise on conn while
+	// it is in the given state. The server caches the result until the
+	// connection changes state, upgrades to TLS or enables a capability.
+	StateCapabilities(state imap.ConnState, conn ConnInfo) []imap.Cap
+}
+
 // ClientExtension extends the IMAP client with new functionality.
 type ClientExtension interface {
 	Extension
@@ -55,8 +55,8 @@ func (r *Registry) All() []Extension {
 }
 
 // Resolve performs dependency resolution and returns extensions in
-// topologically sorted order. Returns an error if there are missing
-// dependencies or cycles.
+// topologically sorted order, with independent extensions in registration
+// order. Returns an error if there are missing dependencies or cycles.
 func (r *Registry) Resolve() ([]Extension, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -87,9 +87,12 @@ func (r *Registry) Resolve() ([]Extension, error) {
 		inDegree[name] = len(r.extensions[name].Dependencies())
 	}
 
+	// Extensions without an ordering constraint between them keep their
+	// registration order, so that the order handler wrappers are stacked
+	// in does not vary between runs.
 	var queue []string
-	for name, deg := range inDegree {
-		if deg == 0 {
+	for _, name := range r.order {
+		if inDegree[name] == 0 {
 			queue = append(queue, name)
 		}
 	}
@@ -101,8 +104,8 @@ func (r *Registry) Resolve() ([]Extension, error) {
 		sorted = append(sorted, r.extensions[name])
 
 		// For each extension that depends on this one, decrease in-degree
-		for otherName, ext := range r.extensions {
-			for _, dep := range ext.Dependencies() {
+		for _, otherName := range r.order {
+			for _, dep := range r.extensions[otherName].Dependencies() {
 				if dep == name {
 					inDegree[otherName]--
 					if inDegree[otherName] == 0 {
@@ -0,0 +1,55 @@
+package extension
+
+// Handler wrappers returned by ServerExtension.WrapHandler are stacked in
+// installation order: the wrapper of the extension installed last is called
+// first. All wrappers of a command share the argument decoder, so they must
+// follow this composition contract:
+//
+//   - A wrapper that calls the handler it wraps must leave the decoder where
+//     it found it. It may peek at the arguments, or read them and replace
+//     the decoder with one over the same bytes, but must not consume them.
+//   - A wrapper that consumes arguments handles the command completely and
+//     never calls the wrapped handler. It replaces the wrappers installed
+//     before it, which are then never called, unless it implements their
+//     behavior too and says so in WrapInfo.Supersedes.
+//
+// Extensions describe their wrappers by implementing WrapDescriber, which
+// the server uses to find conflicting wrappers at startup.
+
+// Names of command arguments for WrapInfo.Parses.
+const (
+	ArgSequenceSet = "sequence-set"
+	ArgMailbox     = "mailbox"
+	ArgFetchItems  = "fetch-items"
+	ArgStoreItems  = "store-items"
+	ArgSearchKeys  = "search-keys"
+	ArgSortKeys    = "sort-criteria"
+)
+
+// WrapInfo describes how a wrapper returned by WrapHandler treats the
+// command arguments and the handler it wraps.
+type WrapInfo struct {
+	// Parses lists the arguments the wrapper consumes from the decoder
+	// before it calls the wrapped handler. Wrappers that follow the
+	// composition contract leave it empty; it exists to describe wrappers
+	// that do not, which conflict with any wrapper below them.
+	Parses []string
+
+	// Replaces is set if the wrapper may handle the command without
+	// calling the wrapped handler after consuming its arguments.
+	Replaces bool
+
+	// Supersedes lists the extensions whose wrappers of the command the
+	// wrapper implements, so that replacing them is not a conflict.
+	Supersedes []string
+}
+
+// WrapDescriber is an optional interface for server extensions that
+// describe the wrappers WrapHandler returns.
+type WrapDescriber interface {
+	ServerExtension
+
+	// DescribeWrap describes the wrapper of the named command. It is only
+	// called for commands WrapHandler returned a wrapper for.
+	DescribeWrap(command string) WrapInfo
+}
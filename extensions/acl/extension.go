@@ -88,7 +88,7 @@ func handleSetACL(ctx *server.CommandContext) error {
 
 	dec := ctx.Decoder
 
-	mailbox, err := dec.ReadAString()
+	mailbox, err := dec.ReadMailbox()
 	if err != nil {
 		ctx.Conn.WriteBAD(ctx.Tag, "Expected mailbox name")
 		return nil
@@ -130,6 +130,10 @@ func handleSetACL(ctx *server.CommandContext) error {
 		}
 	}
 
+	if err := ctx.Conn.CheckMailboxAccess(mailbox); err != nil {
+		return err
+	}
+
 	if err := sess.SetACL(mailbox, identifier, modifier, imap.ACLRights(rights)); err != nil {
 		ctx.Conn.WriteNO(ctx.Tag, fmt.Sprintf("SETACL failed: %v", err))
 		return nil
@@ -151,7 +155,7 @@ func handleDeleteACL(ctx *server.CommandContext) error {
 
 	dec := ctx.Decoder
 
-	mailbox, err := dec.ReadAString()
+	mailbox, err := dec.ReadMailbox()
 	if err != nil {
 		ctx.Conn.WriteBAD(ctx.Tag, "Expected mailbox name")
 		return nil
@@ -168,6 +172,10 @@ func handleDeleteACL(ctx *server.CommandContext) error {
 		return nil
 	}
 
+	if err := ctx.Conn.CheckMailboxAccess(mailbox); err != nil {
+		return err
+	}
+
 	if err := sess.DeleteACL(mailbox, identifier); err != nil {
 		ctx.Conn.WriteNO(ctx.Tag, fmt.Sprintf("DELETEACL failed: %v", err))
 		return nil
@@ -188,12 +196,16 @@ func handleGetACL(ctx *server.CommandContext) error {
 		return nil
 	}
 
-	mailbox, err := ctx.Decoder.ReadAString()
+	mailbox, err := ctx.Decoder.ReadMailbox()
 	if err != nil {
 		ctx.Conn.WriteBAD(ctx.Tag, "Expected mailbox name")
 		return nil
 	}
 
+	if err := ctx.Conn.CheckMailboxAccess(mailbox); err != nil {
+		return err
+	}
+
 	data, err := sess.GetACL(mailbox)
 	if err != nil {
 		ctx.Conn.WriteNO(ctx.Tag, fmt.Sprintf("GETACL failed: %v", err))
@@ -226,7 +238,7 @@ func handleListRights(ctx *server.CommandContext) error {
 
 	dec := ctx.Decoder
 
-	mailbox, err := dec.ReadAString()
+	mailbox, err := dec.ReadMailbox()
 	if err != nil {
 		ctx.Conn.WriteBAD(ctx.Tag, "Expected mailbox name")
 		return nil
@@ -243,6 +255,10 @@ func handleListRights(ctx *server.CommandContext) error {
 		return nil
 	}
 
+	if err := ctx.Conn.CheckMailboxAccess(mailbox); err != nil {
+		return err
+	}
+
 	data, err := sess.ListRights(mailbox, identifier)
 	if err != nil {
 		ctx.Conn.WriteNO(ctx.Tag, fmt.Sprintf("LISTRIGHTS failed: %v", err))
@@ -276,12 +292,16 @@ func handleMyRights(ctx *server.CommandContext) error {
 		return nil
 	}
 
-	mailbox, err := ctx.Decoder.ReadAString()
+	mailbox, err := ctx.Decoder.ReadMailbox()
 	if err != nil {
 		ctx.Conn.WriteBAD(ctx.Tag, "Expected mailbox name")
 		return nil
 	}
 
+	if err := ctx.Conn.CheckMailboxAccess(mailbox); err != nil {
+		return err
+	}
+
 	data, err := sess.MyRights(mailbox)
 	if err != nil {
 		ctx.Conn.WriteNO(ctx.Tag, fmt.Sprintf("MYRIGHTS failed: %v", err))
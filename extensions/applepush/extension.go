@@ -0,0 +1,207 @@
+// Package applepush implements the XAPPLEPUSHSERVICE command used by Apple
+// Mail on iOS and macOS to register a device for push notifications of new
+// mail.
+//
+// The command is not standardized. The client sends its account ID,
+// device token and the mailboxes it wants to be notified about, and the
+// server answers with the APNs topic it sends the notifications with:
+//
+//	C: a XAPPLEPUSHSERVICE aps-version "2" aps-account-id "0715A26B-..."
+//	   aps-device-token "2918390218931890821908309283098109381029309829018310983092892829"
+//	   aps-subtopic "com.apple.mobilemail" mailboxes (INBOX "Sent")
+//	S: * XAPPLEPUSHSERVICE aps-version "2" aps-topic "com.apple.mail.XServer.8f12..."
+//	S: a OK XAPPLEPUSHSERVICE completed
+//
+// Sending the notifications is up to the push provider passed to New.
+// Without one, the capability is not advertised and the command fails
+// with NO [UNAVAILABLE] rather than BAD, so that clients probing for it
+// neither log errors nor retry.
+package applepush
+
+import (
+	"context"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/extension"
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/wire"
+)
+
+// CapXApplePushService is the capability advertised when push
+// notifications are available.
+const CapXApplePushService imap.Cap = "XAPPLEPUSHSERVICE"
+
+// Registration is a device registration sent with XAPPLEPUSHSERVICE.
+type Registration struct {
+	// Username is the authenticated user.
+	Username string
+	// Version is the protocol version, aps-version, such as "2".
+	Version string
+	// AccountID identifies the account on the device, aps-account-id.
+	AccountID string
+	// DeviceToken is the APNs token of the device, aps-device-token.
+	DeviceToken string
+	// Subtopic is the APNs subtopic, aps-subtopic, usually
+	// "com.apple.mobilemail".
+	Subtopic string
+	// Mailboxes are the mailboxes the device wants notifications about.
+	// Version 1 clients send none, meaning INBOX.
+	Mailboxes []string
+	// Params are the other parameters sent by the client, by lower-case
+	// name.
+	Params map[string]string
+}
+
+// RegisterFunc registers a device for push notifications and returns the
+// APNs topic of the certificate the notifications are sent with.
+type RegisterFunc func(ctx context.Context, reg *Registration) (topic string, err error)
+
+// Extension implements the XAPPLEPUSHSERVICE command.
+type Extension struct {
+	extension.BaseExtension
+	register RegisterFunc
+}
+
+var (
+	_ extension.ServerExtension          = (*Extension)(nil)
+	_ extension.StateCapabilityExtension = (*Extension)(nil)
+)
+
+// New creates a new XAPPLEPUSHSERVICE extension that registers devices
+// with register. If register is nil, the command is recognized but push
+// notifications are reported as unavailable.
+func New(register RegisterFunc) *Extension {
+	return &Extension{
+		BaseExtension: extension.BaseExtension{
+			ExtName: "XAPPLEPUSHSERVICE",
+		},
+		register: register,
+	}
+}
+
+// StateCapabilities advertises XAPPLEPUSHSERVICE after authentication if
+// the extension has a push provider.
+func (e *Extension) StateCapabilities(state imap.ConnState, conn extension.ConnInfo) []imap.Cap {
+	if e.register == nil || state == imap.ConnStateNotAuthenticated {
+		return nil
+	}
+	return []imap.Cap{CapXApplePushService}
+}
+
+// CommandHandlers returns the XAPPLEPUSHSERVICE command handler.
+func (e *Extension) CommandHandlers() map[string]interface{} {
+	return map[string]interface{}{
+		"XAPPLEPUSHSERVICE": server.CommandHandlerFunc(e.handle),
+	}
+}
+
+func (e *Extension) WrapHandler(name string, handler interface{}) interface{} { return nil }
+
+// SessionExtension returns nil: registrations go to the push provider,
+// not the session.
+func (e *Extension) SessionExtension() interface{} { return nil }
+
+func (e *Extension) OnEnabled(connID string) error { return nil }
+
+// handle handles the XAPPLEPUSHSERVICE command.
+func (e *Extension) handle(ctx *server.CommandContext) error {
+	state := ctx.Conn.State()
+	if state != imap.ConnStateAuthenticated && state != imap.ConnStateSelected {
+		return imap.ErrBad("XAPPLEPUSHSERVICE not allowed in current state")
+	}
+
+	if e.register == nil {
+		return imap.ErrNoWithCode(imap.ResponseCodeUnavailable, "Push notifications are not available")
+	}
+	reg, err := readRegistration(ctx.Decoder)
+	if err != nil {
+		return err
+	}
+	if reg.DeviceToken == "" || reg.AccountID == "" {
+		return imap.ErrBad("missing aps-account-id or aps-device-token")
+	}
+	reg.Username = ctx.Conn.Username()
+
+	topic, err := e.register(ctx.Context, reg)
+	if err != nil {
+		return err
+	}
+
+	ctx.Conn.Encoder().Encode(func(enc *wire.Encoder) {
+		enc.Star().Atom("XAPPLEPUSHSERVICE")
+		enc.SP().Atom("aps-version").SP().QuotedString(reg.Version)
+		enc.SP().Atom("aps-topic").SP().QuotedString(topic)
+		enc.CRLF()
+	})
+	ctx.Conn.WriteOK(ctx.Tag, "XAPPLEPUSHSERVICE completed")
+	return nil
+}
+
+// readRegistration reads the parameters of XAPPLEPUSHSERVICE: pairs of a
+// name and a value, which is a string or, for mailboxes, a list of
+// mailbox names.
+func readRegistration(dec *wire.Decoder) (*Registration, error) {
+	reg := &Registration{Version: "1", Params: make(map[string]string)}
+	if dec == nil {
+		return reg, nil
+	}
+	for first := true; ; first = false {
+		if !first {
+			if err := dec.ReadSP(); err != nil {
+				break
+			}
+		} else if _, err := dec.PeekByte(); err != nil {
+			break
+		}
+
+		name, err := dec.ReadAString()
+		if err != nil {
+			return nil, imap.ErrBad("invalid XAPPLEPUSHSERVICE parameter")
+		}
+		if err := dec.ReadSP(); err != nil {
+			return nil, imap.ErrBad("missing value of " + name)
+		}
+		name = strings.ToLower(name)
+
+		if b, err := dec.PeekByte(); err == nil && b == '(' {
+			var list []string
+			err := dec.ReadList(func() error {
+				mailbox, err := dec.ReadMailbox()
+				if err != nil {
+					return err
+				}
+				list = append(list, imap.CanonicalMailboxName(mailbox))
+				return nil
+			})
+			if err != nil {
+				return nil, imap.ErrBad("invalid value of " + name)
+			}
+			if name == "mailboxes" {
+				reg.Mailboxes = list
+			}
+			continue
+		}
+
+		value, err := dec.ReadAString()
+		if err != nil {
+			return nil, imap.ErrBad("invalid value of " + name)
+		}
+		switch name {
+		case "aps-version":
+			reg.Version = value
+		case "aps-account-id":
+			reg.AccountID = value
+		case "aps-device-token":
+			reg.DeviceToken = value
+		case "aps-subtopic":
+			reg.Subtopic = value
+		default:
+			reg.Params[name] = value
+		}
+	}
+	if len(reg.Mailboxes) == 0 {
+		reg.Mailboxes = []string{imap.InboxName}
+	}
+	return reg, nil
+}
@@ -0,0 +1,131 @@
+package applepush
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/imaptest"
+	"github.com/meszmate/imap-go/server"
+	_ "github.com/meszmate/imap-go/server/commands"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+// dial connects to a memserver with the extension and logs in as alice.
+func dial(t *testing.T, ext *Extension) (run func(command string) (untagged []string, tagged string)) {
+	t.Helper()
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	h := imaptest.NewHarness(t, mem.NewServer(server.WithExtensions(ext)))
+
+	conn, err := net.Dial("tcp", h.Addr())
+	if err != nil {
+		t.Fatalf("Dial() error: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	if _, err := r.ReadString('\n'); err != nil {
+		t.Fatalf("greeting: %v", err)
+	}
+
+	run = func(command string) (untagged []string, tagged string) {
+		t.Helper()
+		tag, _, _ := strings.Cut(command, " ")
+		if _, err := conn.Write([]byte(command + "\r\n")); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if strings.HasPrefix(line, tag+" ") {
+				return untagged, line
+			}
+			untagged = append(untagged, line)
+		}
+	}
+	if _, tagged := run("L LOGIN alice secret"); !strings.HasPrefix(tagged, "L OK") {
+		t.Fatalf("LOGIN: %s", tagged)
+	}
+	return run
+}
+
+const registerCommand = `A XAPPLEPUSHSERVICE aps-version "2" aps-account-id "0715A26B-CA09-4730-A419-793000CA982E" ` +
+	`aps-device-token "2918390218931890821908309283098109381029309829018310983092892829" ` +
+	`aps-subtopic "com.apple.mobilemail" mailboxes (inbox "Sent Messages")`
+
+func TestXApplePushService(t *testing.T) {
+	var got *Registration
+	run := dial(t, New(func(ctx context.Context, reg *Registration) (string, error) {
+		got = reg
+		return "com.apple.mail.XServer.8f12", nil
+	}))
+
+	if untagged, _ := run("C CAPABILITY"); len(untagged) != 1 || !strings.Contains(untagged[0], " XAPPLEPUSHSERVICE") {
+		t.Errorf("CAPABILITY = %q, want XAPPLEPUSHSERVICE", untagged)
+	}
+
+	untagged, tagged := run(registerCommand)
+	if tagged != "A OK XAPPLEPUSHSERVICE completed" {
+		t.Fatalf("XAPPLEPUSHSERVICE = %q", tagged)
+	}
+	want := []string{`* XAPPLEPUSHSERVICE aps-version "2" aps-topic "com.apple.mail.XServer.8f12"`}
+	if !reflect.DeepEqual(untagged, want) {
+		t.Errorf("untagged = %q, want %q", untagged, want)
+	}
+	wantReg := &Registration{
+		Username:    "alice",
+		Version:     "2",
+		AccountID:   "0715A26B-CA09-4730-A419-793000CA982E",
+		DeviceToken: "2918390218931890821908309283098109381029309829018310983092892829",
+		Subtopic:    "com.apple.mobilemail",
+		Mailboxes:   []string{"INBOX", "Sent Messages"},
+		Params:      map[string]string{},
+	}
+	if !reflect.DeepEqual(got, wantReg) {
+		t.Errorf("registration = %+v, want %+v", got, wantReg)
+	}
+
+	if _, tagged := run(`B XAPPLEPUSHSERVICE aps-version "2"`); !strings.HasPrefix(tagged, "B BAD") {
+		t.Errorf("XAPPLEPUSHSERVICE without a device token = %q, want BAD", tagged)
+	}
+}
+
+func TestXApplePushService_ProviderError(t *testing.T) {
+	run := dial(t, New(func(ctx context.Context, reg *Registration) (string, error) {
+		return "", errors.New("APNs certificate expired")
+	}))
+	if _, tagged := run(registerCommand); !strings.HasPrefix(tagged, "A NO") {
+		t.Errorf("XAPPLEPUSHSERVICE = %q, want NO", tagged)
+	}
+}
+
+func TestXApplePushService_Stub(t *testing.T) {
+	run := dial(t, New(nil))
+	if untagged, _ := run("C CAPABILITY"); strings.Contains(untagged[0], "XAPPLEPUSHSERVICE") {
+		t.Errorf("CAPABILITY = %q advertises push without a provider", untagged)
+	}
+	untagged, tagged := run(registerCommand)
+	if len(untagged) != 0 || tagged != "A NO [UNAVAILABLE] Push notifications are not available" {
+		t.Errorf("XAPPLEPUSHSERVICE = %q, %q", untagged, tagged)
+	}
+}
+
+func TestStateCapabilities(t *testing.T) {
+	ext := New(func(ctx context.Context, reg *Registration) (string, error) { return "", nil })
+	if caps := ext.StateCapabilities(imap.ConnStateNotAuthenticated, nil); len(caps) != 0 {
+		t.Errorf("capabilities before authentication = %v", caps)
+	}
+	if caps := ext.StateCapabilities(imap.ConnStateSelected, nil); len(caps) != 1 || caps[0] != CapXApplePushService {
+		t.Errorf("capabilities when selected = %v", caps)
+	}
+}
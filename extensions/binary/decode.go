@@ -0,0 +1,21 @@
+package binary
+
+import (
+	"errors"
+	"io"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// DecodeSection returns a reader that removes the Content-Transfer-Encoding
+// encoding from a MIME part, for answering FETCH BINARY[part]. Backends
+// should use it so that all encodings are decoded the same way. An encoding
+// that cannot be decoded yields a NO error with the UNKNOWN-CTE response
+// code, as required by RFC 3516.
+func DecodeSection(encoding string, r io.Reader) (io.Reader, error) {
+	dec, err := imap.NewTransferDecoder(encoding, r)
+	if errors.Is(err, imap.ErrUnknownTransferEncoding) {
+		return nil, imap.ErrNoWithCode(imap.ResponseCodeUnknownCTE, "unknown content transfer encoding: "+encoding)
+	}
+	return dec, err
+}
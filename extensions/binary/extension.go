@@ -9,6 +9,8 @@
 // by the core FETCH command handler through FetchOptions.BinarySection and
 // FetchOptions.BinarySizeSection fields. This extension wraps APPEND to
 // detect ~{N} binary literals and route to SessionBinary.AppendBinary().
+// Backends answering BINARY[] fetch items can decode parts with
+// DecodeSection.
 package binary
 
 import (
@@ -99,7 +101,7 @@ func handleBinaryAppend(ctx *server.CommandContext, original server.CommandHandl
 	dec := ctx.Decoder
 
 	// Read mailbox name
-	mailbox, err := dec.ReadAString()
+	mailbox, err := dec.ReadMailbox()
 	if err != nil {
 		return imap.ErrBad("invalid mailbox name")
 	}
@@ -163,10 +165,9 @@ func handleBinaryAppend(ctx *server.CommandContext, original server.CommandHandl
 		options.Binary = true
 	}
 
-	// Read the literal body from the connection's main decoder
-	connDec := ctx.Conn.Decoder()
+	// Read the literal body from the connection
 	literalReader := imap.LiteralReader{
-		Reader: connDec.ReadLiteral(litSize),
+		Reader: ctx.Conn.ReadLiteral(ctx.Name, litSize),
 		Size:   litSize,
 	}
 
@@ -185,7 +186,7 @@ func handleBinaryAppend(ctx *server.CommandContext, original server.CommandHandl
 	}
 
 	// Fall back to standard Append
-	data, err := ctx.Session.Append(mailbox, literalReader, options)
+	data, err := ctx.AppendMessage(mailbox, literalReader, options)
 	if err != nil {
 		_, _ = io.Copy(io.Discard, literalReader.Reader)
 		return err
@@ -198,11 +199,8 @@ func handleBinaryAppend(ctx *server.CommandContext, original server.CommandHandl
 // writeAppendOK writes the tagged OK response, optionally with APPENDUID.
 func writeAppendOK(ctx *server.CommandContext, data *imap.AppendData) {
 	if data != nil && data.UIDValidity > 0 && data.UID > 0 {
-		enc := ctx.Conn.Encoder()
-		enc.Encode(func(e *wire.Encoder) {
-			code := fmt.Sprintf("APPENDUID %d %d", data.UIDValidity, uint32(data.UID))
-			e.StatusResponse(ctx.Tag, "OK", code, "APPEND completed")
-		})
+		ctx.Conn.WriteOKCode(ctx.Tag, imap.ResponseCodeAppendUID, "APPEND completed",
+			data.UIDValidity, data.UID)
 	} else {
 		ctx.Conn.WriteOK(ctx.Tag, "APPEND completed")
 	}
@@ -109,7 +109,7 @@ func handleCatenateAppend(ctx *server.CommandContext, original server.CommandHan
 	dec := ctx.Decoder
 
 	// Read the mailbox name
-	mailbox, err := dec.ReadAString()
+	mailbox, err := dec.ReadMailbox()
 	if err != nil {
 		return imap.ErrBad("invalid mailbox name")
 	}
@@ -208,9 +208,8 @@ func handleCatenateAppend(ctx *server.CommandContext, original server.CommandHan
 
 	// Write tagged OK response
 	if data != nil && data.UIDValidity > 0 && data.UID > 0 {
-		ctx.Conn.WriteOKCode(ctx.Tag,
-			fmt.Sprintf("APPENDUID %d %d", data.UIDValidity, uint32(data.UID)),
-			"APPEND completed")
+		ctx.Conn.WriteOKCode(ctx.Tag, imap.ResponseCodeAppendUID, "APPEND completed",
+			data.UIDValidity, data.UID)
 	} else {
 		ctx.Conn.WriteOK(ctx.Tag, "APPEND completed")
 	}
@@ -232,14 +231,13 @@ func handleStandardAppend(ctx *server.CommandContext, dec *wire.Decoder, mailbox
 		options.Binary = true
 	}
 
-	// Read the literal body from the connection's main decoder
-	connDec := ctx.Conn.Decoder()
+	// Read the literal body from the connection
 	literalReader := imap.LiteralReader{
-		Reader: connDec.ReadLiteral(litSize),
+		Reader: ctx.Conn.ReadLiteral(ctx.Name, litSize),
 		Size:   litSize,
 	}
 
-	data, err := ctx.Session.Append(mailbox, literalReader, options)
+	data, err := ctx.AppendMessage(mailbox, literalReader, options)
 	if err != nil {
 		// Drain remaining literal data
 		_, _ = io.Copy(io.Discard, literalReader.Reader)
@@ -251,9 +249,8 @@ func handleStandardAppend(ctx *server.CommandContext, dec *wire.Decoder, mailbox
 
 	// Write tagged OK response
 	if data != nil && data.UIDValidity > 0 && data.UID > 0 {
-		ctx.Conn.WriteOKCode(ctx.Tag,
-			fmt.Sprintf("APPENDUID %d %d", data.UIDValidity, uint32(data.UID)),
-			"APPEND completed")
+		ctx.Conn.WriteOKCode(ctx.Tag, imap.ResponseCodeAppendUID, "APPEND completed",
+			data.UIDValidity, data.UID)
 	} else {
 		ctx.Conn.WriteOK(ctx.Tag, "APPEND completed")
 	}
@@ -352,8 +349,7 @@ func parseCatenateParts(argDec *wire.Decoder, conn *server.Conn) ([]CatenatePart
 			}
 
 			// Read literal body from the connection decoder
-			connDec := conn.Decoder()
-			data, err := io.ReadAll(io.LimitReader(connDec.ReadLiteral(litSize), litSize))
+			data, err := io.ReadAll(io.LimitReader(conn.ReadLiteral("APPEND", litSize), litSize))
 			if err != nil {
 				return nil, fmt.Errorf("error reading TEXT literal: %w", err)
 			}
@@ -364,7 +360,7 @@ func parseCatenateParts(argDec *wire.Decoder, conn *server.Conn) ([]CatenatePart
 
 			// After reading a literal body, subsequent data comes from
 			// the connection decoder.
-			dec = connDec
+			dec = conn.Decoder()
 
 		default:
 			return nil, fmt.Errorf("unknown CATENATE part type: %s", atom)
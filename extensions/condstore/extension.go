@@ -35,7 +35,7 @@ type Extension struct {
 	extension.BaseExtension
 }
 
-var _ extension.ServerExtension = (*Extension)(nil)
+var _ extension.WrapDescriber = (*Extension)(nil)
 
 // New creates a new CONDSTORE extension.
 func New() *Extension {
@@ -88,6 +88,12 @@ func (e *Extension) WrapHandler(name string, handler interface{}) interface{} {
 	return nil
 }
 
+// DescribeWrap describes the wrappers installed by WrapHandler, which
+// parse and handle their commands completely.
+func (e *Extension) DescribeWrap(command string) extension.WrapInfo {
+	return extension.WrapInfo{Replaces: true}
+}
+
 // SessionExtension returns a typed nil pointer to SessionCondStore, indicating
 // that sessions should implement this interface for full CONDSTORE support.
 func (e *Extension) SessionExtension() interface{} {
@@ -110,24 +116,9 @@ func handleCondstoreStore(ctx *server.CommandContext, _ server.CommandHandlerFun
 	dec := ctx.Decoder
 
 	// Read sequence set
-	seqSetStr, err := dec.ReadAtom()
+	numSet, err := server.ParseNumSet(ctx)
 	if err != nil {
-		return imap.ErrBad("invalid sequence set")
-	}
-
-	var numSet imap.NumSet
-	if ctx.NumKind == server.NumKindUID {
-		uidSet, err := imap.ParseUIDSet(seqSetStr)
-		if err != nil {
-			return imap.ErrBad("invalid UID set")
-		}
-		numSet = uidSet
-	} else {
-		seqSet, err := imap.ParseSeqSet(seqSetStr)
-		if err != nil {
-			return imap.ErrBad("invalid sequence set")
-		}
-		numSet = seqSet
+		return err
 	}
 
 	if err := dec.ReadSP(); err != nil {
@@ -239,24 +230,9 @@ func handleCondstoreFetch(ctx *server.CommandContext, _ server.CommandHandlerFun
 	dec := ctx.Decoder
 
 	// Read sequence set
-	seqSetStr, err := dec.ReadAtom()
+	numSet, err := server.ParseNumSet(ctx)
 	if err != nil {
-		return imap.ErrBad("invalid sequence set")
-	}
-
-	var numSet imap.NumSet
-	if ctx.NumKind == server.NumKindUID {
-		uidSet, err := imap.ParseUIDSet(seqSetStr)
-		if err != nil {
-			return imap.ErrBad("invalid UID set")
-		}
-		numSet = uidSet
-	} else {
-		seqSet, err := imap.ParseSeqSet(seqSetStr)
-		if err != nil {
-			return imap.ErrBad("invalid sequence set")
-		}
-		numSet = seqSet
+		return err
 	}
 
 	if err := dec.ReadSP(); err != nil {
@@ -304,7 +280,7 @@ func handleCondstoreFetch(ctx *server.CommandContext, _ server.CommandHandlerFun
 	}
 
 	w := server.NewFetchWriter(ctx.Conn.Encoder())
-	if err := ctx.Session.Fetch(w, numSet, options); err != nil {
+	if err := server.RunFetch(ctx, w, numSet, options); err != nil {
 		return err
 	}
 
@@ -384,31 +360,22 @@ func ParseSingleFetchItem(dec *wire.Decoder, options *imap.FetchOptions) error {
 		options.SaveDate = true
 
 	// BODY with bracket embedded in atom ([ is an atom char)
-	case strings.HasPrefix(upper, "BODY.PEEK["):
-		section, err := parseFetchBodySectionFromAtom(dec, item, true)
+	case strings.HasPrefix(upper, "BODY.PEEK["), strings.HasPrefix(upper, "BODY["):
+		section, err := server.ReadBodySection(dec, item)
 		if err != nil {
 			return err
 		}
 		options.BodySection = append(options.BodySection, section)
-	case strings.HasPrefix(upper, "BODY["):
-		section, err := parseFetchBodySectionFromAtom(dec, item, false)
+	case upper == "BODY.PEEK":
+		section, err := server.ReadBodySection(dec, item)
 		if err != nil {
 			return err
 		}
 		options.BodySection = append(options.BodySection, section)
-	case upper == "BODY.PEEK":
-		b, err := dec.PeekByte()
-		if err == nil && b == '[' {
-			section, err := ParseFetchBodySection(dec, true)
-			if err != nil {
-				return err
-			}
-			options.BodySection = append(options.BodySection, section)
-		}
 	case upper == "BODY":
 		b, err := dec.PeekByte()
 		if err == nil && b == '[' {
-			section, err := ParseFetchBodySection(dec, false)
+			section, err := server.ReadBodySection(dec, item)
 			if err != nil {
 				return err
 			}
@@ -429,14 +396,20 @@ func ParseSingleFetchItem(dec *wire.Decoder, options *imap.FetchOptions) error {
 		if err := dec.ExpectByte(']'); err != nil {
 			return err
 		}
-		section.Partial = ConsumePartial(dec)
+		section.Partial, err = server.ReadSectionPartial(dec)
+		if err != nil {
+			return err
+		}
 		options.BinarySection = append(options.BinarySection, section)
 	case strings.HasPrefix(upper, "BINARY["):
 		section := ParseBinaryItemFromAtom(item, "BINARY[", false)
 		if err := dec.ExpectByte(']'); err != nil {
 			return err
 		}
-		section.Partial = ConsumePartial(dec)
+		section.Partial, err = server.ReadSectionPartial(dec)
+		if err != nil {
+			return err
+		}
 		options.BinarySection = append(options.BinarySection, section)
 
 	case upper == "RFC822":
@@ -455,69 +428,6 @@ func ParseSingleFetchItem(dec *wire.Decoder, options *imap.FetchOptions) error {
 	return nil
 }
 
-// parseFetchBodySectionFromAtom handles BODY[section or BODY.PEEK[section
-// where [ was included in the atom by ReadAtom.
-func parseFetchBodySectionFromAtom(dec *wire.Decoder, item string, peek bool) (*imap.FetchItemBodySection, error) {
-	bracketIdx := strings.IndexByte(item, '[')
-	sectionStr := strings.ToUpper(item[bracketIdx+1:])
-
-	section := &imap.FetchItemBodySection{Peek: peek}
-
-	switch {
-	case sectionStr == "":
-		// empty section — will read ] next
-	case sectionStr == "HEADER":
-		section.Specifier = "HEADER"
-	case sectionStr == "TEXT":
-		section.Specifier = "TEXT"
-	case sectionStr == "MIME":
-		section.Specifier = "MIME"
-	case strings.HasPrefix(sectionStr, "HEADER.FIELDS.NOT"):
-		section.Specifier = "HEADER.FIELDS.NOT"
-		section.NotFields = true
-		if err := dec.ReadSP(); err != nil {
-			return nil, err
-		}
-		fields, err := ReadFieldList(dec)
-		if err != nil {
-			return nil, err
-		}
-		section.Fields = fields
-	case strings.HasPrefix(sectionStr, "HEADER.FIELDS"):
-		section.Specifier = "HEADER.FIELDS"
-		if err := dec.ReadSP(); err != nil {
-			return nil, err
-		}
-		fields, err := ReadFieldList(dec)
-		if err != nil {
-			return nil, err
-		}
-		section.Fields = fields
-	}
-
-	if err := dec.ExpectByte(']'); err != nil {
-		return nil, err
-	}
-
-	// Check for partial <offset.count>
-	b, err := dec.PeekByte()
-	if err == nil && b == '<' {
-		for {
-			ch, err := dec.PeekByte()
-			if err != nil {
-				break
-			}
-			if ch == '>' {
-				_ = dec.ExpectByte('>')
-				break
-			}
-			_, _ = dec.ReadAtom()
-		}
-	}
-
-	return section, nil
-}
-
 // ParseBinaryPart parses a MIME part string like "1.2" into []int{1, 2}.
 func ParseBinaryPart(s string) []int {
 	if s == "" {
@@ -545,106 +455,18 @@ func ParseBinaryItemFromAtom(item, prefix string, peek bool) *imap.FetchItemBina
 }
 
 // ConsumePartial consumes a <offset.count> partial specifier if present.
+// An invalid partial specifier is consumed and nil returned.
 func ConsumePartial(dec *wire.Decoder) *imap.SectionPartial {
-	b, err := dec.PeekByte()
-	if err != nil || b != '<' {
-		return nil
-	}
-	_ = dec.ExpectByte('<')
-	atom, err := dec.ReadAtom()
-	if err != nil {
-		return nil
-	}
-	_ = dec.ExpectByte('>')
-
-	parts := strings.SplitN(atom, ".", 2)
-	if len(parts) != 2 {
-		return nil
-	}
-	offset, err := strconv.ParseInt(parts[0], 10, 64)
-	if err != nil {
-		return nil
-	}
-	count, err := strconv.ParseInt(parts[1], 10, 64)
-	if err != nil {
-		return nil
-	}
-	return &imap.SectionPartial{Offset: offset, Count: count}
+	partial, _ := server.ReadSectionPartial(dec)
+	return partial
 }
 
 // ParseFetchBodySection parses a BODY[section] or BODY.PEEK[section] specification.
 func ParseFetchBodySection(dec *wire.Decoder, peek bool) (*imap.FetchItemBodySection, error) {
-	section := &imap.FetchItemBodySection{
-		Peek: peek,
-	}
-
-	if err := dec.ExpectByte('['); err != nil {
-		return nil, err
-	}
-
-	b, err := dec.PeekByte()
-	if err != nil {
-		return nil, err
-	}
-
-	if b != ']' {
-		spec, err := dec.ReadAtom()
-		if err != nil {
-			return nil, err
-		}
-
-		upper := strings.ToUpper(spec)
-		switch {
-		case upper == "HEADER":
-			section.Specifier = "HEADER"
-		case upper == "TEXT":
-			section.Specifier = "TEXT"
-		case upper == "MIME":
-			section.Specifier = "MIME"
-		case strings.HasPrefix(upper, "HEADER.FIELDS.NOT"):
-			section.Specifier = "HEADER.FIELDS.NOT"
-			section.NotFields = true
-			if err := dec.ReadSP(); err != nil {
-				return nil, err
-			}
-			fields, err := ReadFieldList(dec)
-			if err != nil {
-				return nil, err
-			}
-			section.Fields = fields
-		case strings.HasPrefix(upper, "HEADER.FIELDS"):
-			section.Specifier = "HEADER.FIELDS"
-			if err := dec.ReadSP(); err != nil {
-				return nil, err
-			}
-			fields, err := ReadFieldList(dec)
-			if err != nil {
-				return nil, err
-			}
-			section.Fields = fields
-		}
+	if peek {
+		return server.ReadBodySection(dec, "BODY.PEEK")
 	}
-
-	if err := dec.ExpectByte(']'); err != nil {
-		return nil, err
-	}
-
-	b, err = dec.PeekByte()
-	if err == nil && b == '<' {
-		for {
-			ch, err := dec.PeekByte()
-			if err != nil {
-				break
-			}
-			if ch == '>' {
-				_ = dec.ExpectByte('>')
-				break
-			}
-			_, _ = dec.ReadAtom()
-		}
-	}
-
-	return section, nil
+	return server.ReadBodySection(dec, "BODY")
 }
 
 // ReadFieldList reads a parenthesized list of header field names.
@@ -673,11 +495,16 @@ func handleCondstoreSelect(ctx *server.CommandContext, readOnly bool) error {
 
 	dec := ctx.Decoder
 
-	mailbox, err := dec.ReadAString()
+	mailbox, err := dec.ReadMailbox()
 	if err != nil {
 		return imap.ErrBad("invalid mailbox name")
 	}
 
+	mailbox, err = ctx.Conn.ValidateMailboxName(mailbox)
+	if err != nil {
+		return err
+	}
+
 	options := &imap.SelectOptions{
 		ReadOnly: readOnly,
 	}
@@ -706,97 +533,5 @@ func handleCondstoreSelect(ctx *server.CommandContext, readOnly bool) error {
 		return err
 	}
 
-	enc := ctx.Conn.Encoder()
-
-	// Write FLAGS
-	flagStrs := make([]string, len(data.Flags))
-	for i, f := range data.Flags {
-		flagStrs[i] = string(f)
-	}
-	enc.Encode(func(e *wire.Encoder) {
-		e.Star().Atom("FLAGS").SP().Flags(flagStrs).CRLF()
-	})
-
-	// Write EXISTS
-	enc.Encode(func(e *wire.Encoder) {
-		e.NumResponse(data.NumMessages, "EXISTS")
-	})
-
-	// Write RECENT
-	enc.Encode(func(e *wire.Encoder) {
-		e.NumResponse(data.NumRecent, "RECENT")
-	})
-
-	// Write UIDVALIDITY
-	enc.Encode(func(e *wire.Encoder) {
-		e.Star().Atom("OK").SP()
-		e.ResponseCode("UIDVALIDITY", data.UIDValidity)
-		e.CRLF()
-	})
-
-	// Write UIDNEXT
-	enc.Encode(func(e *wire.Encoder) {
-		e.Star().Atom("OK").SP()
-		e.ResponseCode("UIDNEXT", uint32(data.UIDNext))
-		e.CRLF()
-	})
-
-	// Write PERMANENTFLAGS if present
-	if len(data.PermanentFlags) > 0 {
-		permFlagStrs := make([]string, len(data.PermanentFlags))
-		for i, f := range data.PermanentFlags {
-			permFlagStrs[i] = string(f)
-		}
-		enc.Encode(func(e *wire.Encoder) {
-			e.Star().Atom("OK").SP()
-			e.RawString("[PERMANENTFLAGS ")
-			e.Flags(permFlagStrs)
-			e.RawString("] ")
-			e.CRLF()
-		})
-	}
-
-	// Write UNSEEN if present
-	if data.FirstUnseen > 0 {
-		enc.Encode(func(e *wire.Encoder) {
-			e.Star().Atom("OK").SP()
-			e.ResponseCode("UNSEEN", data.FirstUnseen)
-			e.CRLF()
-		})
-	}
-
-	// Write HIGHESTMODSEQ if present
-	if data.HighestModSeq > 0 {
-		enc.Encode(func(e *wire.Encoder) {
-			e.Star().Atom("OK").SP()
-			e.ResponseCode("HIGHESTMODSEQ", data.HighestModSeq)
-			e.CRLF()
-		})
-	}
-
-	// Write MAILBOXID if present (RFC 8474)
-	if data.MailboxID != "" {
-		enc.Encode(func(e *wire.Encoder) {
-			e.Star().Atom("OK").SP()
-			e.ResponseCode("MAILBOXID", "("+data.MailboxID+")")
-			e.CRLF()
-		})
-	}
-
-	// Update connection state
-	ctx.Conn.SetMailbox(mailbox, data.ReadOnly)
-	if err := ctx.Conn.SetState(imap.ConnStateSelected); err != nil {
-		return err
-	}
-
-	// Tagged OK with READ-ONLY or READ-WRITE code
-	code := "READ-WRITE"
-	if data.ReadOnly {
-		code = "READ-ONLY"
-	}
-	enc.Encode(func(e *wire.Encoder) {
-		e.StatusResponse(ctx.Tag, "OK", code, "SELECT completed")
-	})
-
-	return nil
+	return server.CompleteSelect(ctx, mailbox, readOnly, data)
 }
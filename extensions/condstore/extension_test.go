@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/imaptest"
 	"github.com/meszmate/imap-go/imaptest/mock"
 	"github.com/meszmate/imap-go/server"
 	"github.com/meszmate/imap-go/wire"
@@ -34,40 +35,7 @@ var _ SessionCondStore = (*condstoreMockSession)(nil)
 
 func newTestCommandContext(t *testing.T, args string, sess server.Session) *server.CommandContext {
 	t.Helper()
-
-	clientConn, serverConn := net.Pipe()
-	t.Cleanup(func() {
-		_ = clientConn.Close()
-		_ = serverConn.Close()
-	})
-
-	conn := server.NewTestConn(serverConn, nil)
-
-	// Drain output to prevent blocking
-	go func() {
-		buf := make([]byte, 4096)
-		for {
-			_, err := clientConn.Read(buf)
-			if err != nil {
-				return
-			}
-		}
-	}()
-
-	var dec *wire.Decoder
-	if args != "" {
-		dec = wire.NewDecoder(strings.NewReader(args))
-	}
-
-	return &server.CommandContext{
-		Context: context.Background(),
-		Tag:     "A001",
-		Name:    "TEST",
-		NumKind: server.NumKindSeq,
-		Conn:    conn,
-		Session: sess,
-		Decoder: dec,
-	}
+	return imaptest.NewCommandContext(t, "TEST", args, sess)
 }
 
 func newTestCommandContextAuthenticated(t *testing.T, args string, sess server.Session) *server.CommandContext {
@@ -124,34 +124,29 @@ func handleContextSearch(ctx *server.CommandContext, originalHandler server.Comm
 	}
 
 	dec := ctx.Decoder
-	criteria := &imap.SearchCriteria{}
 	options := &imap.SearchOptions{}
 
-	// Peek to check if first token is "RETURN"
-	first, err := dec.ReadAtom()
+	// Check whether the first token is "RETURN"
+	first, err := server.ReadSearchToken(dec)
 	if err != nil {
-		return imap.ErrBad("missing search criteria")
+		return err
 	}
 
 	if !strings.EqualFold(first, "RETURN") {
 		// No RETURN — delegate to original handler (ESEARCH's wrapper)
 		// Parse the first criterion and remaining criteria, then route to session
-		if err := esearch.ParseSearchCriterion(first, dec, criteria); err != nil {
-			return imap.ErrBad("invalid search criteria: " + err.Error())
-		}
-		if err := dec.ReadSP(); err == nil {
-			if err := esearch.ParseSearchCriteria(dec, criteria); err != nil {
-				return imap.ErrBad("invalid search criteria: " + err.Error())
-			}
+		criteria, err := server.ParseSearchFrom(first, dec)
+		if err != nil {
+			return err
 		}
 
-		data, err := ctx.Session.Search(ctx.NumKind, criteria, options)
+		data, err := server.RunSearch(ctx, criteria, options)
 		if err != nil {
 			return err
 		}
 
 		writeTraditionalSearchResponse(ctx, data)
-		ctx.Conn.WriteOK(ctx.Tag, "SEARCH completed")
+		ctx.Conn.WriteSearchOK(ctx.Tag, data)
 		return nil
 	}
 
@@ -159,17 +154,18 @@ func handleContextSearch(ctx *server.CommandContext, originalHandler server.Comm
 	if err := dec.ReadSP(); err != nil {
 		return imap.ErrBad("missing RETURN options")
 	}
-	hasContext, hasUpdate, err := parseReturnOptions(dec, options)
-	if err != nil {
+	if err := server.ParseSearchReturnOptions(dec, options); err != nil {
 		return err
 	}
+	hasContext, hasUpdate := options.ReturnContext, options.ReturnUpdate
 
 	// Parse search criteria
 	if err := dec.ReadSP(); err != nil {
 		return imap.ErrBad("missing search criteria after RETURN")
 	}
-	if err := esearch.ParseSearchCriteria(dec, criteria); err != nil {
-		return imap.ErrBad("invalid search criteria: " + err.Error())
+	criteria, err := server.ParseSearch(dec)
+	if err != nil {
+		return err
 	}
 
 	// Route to session
@@ -187,10 +183,10 @@ func handleContextSearch(ctx *server.CommandContext, originalHandler server.Comm
 				if sess, ok := ctx.Session.(esearch.SessionESearch); ok {
 					data, err = sess.SearchExtended(ctx.NumKind, criteria, options)
 				} else {
-					data, err = ctx.Session.Search(ctx.NumKind, criteria, options)
+					data, err = server.RunSearch(ctx, criteria, options)
 				}
 			} else {
-				data, err = ctx.Session.Search(ctx.NumKind, criteria, options)
+				data, err = server.RunSearch(ctx, criteria, options)
 			}
 		}
 	} else {
@@ -199,10 +195,10 @@ func handleContextSearch(ctx *server.CommandContext, originalHandler server.Comm
 			if sess, ok := ctx.Session.(esearch.SessionESearch); ok {
 				data, err = sess.SearchExtended(ctx.NumKind, criteria, options)
 			} else {
-				data, err = ctx.Session.Search(ctx.NumKind, criteria, options)
+				data, err = server.RunSearch(ctx, criteria, options)
 			}
 		} else {
-			data, err = ctx.Session.Search(ctx.NumKind, criteria, options)
+			data, err = server.RunSearch(ctx, criteria, options)
 		}
 	}
 	if err != nil {
@@ -217,69 +213,10 @@ func handleContextSearch(ctx *server.CommandContext, originalHandler server.Comm
 		writeTraditionalSearchResponse(ctx, data)
 	}
 
-	ctx.Conn.WriteOK(ctx.Tag, "SEARCH completed")
+	ctx.Conn.WriteSearchOK(ctx.Tag, data)
 	return nil
 }
 
-// parseReturnOptions parses a parenthesized list of RETURN options including UPDATE and CONTEXT.
-func parseReturnOptions(dec *wire.Decoder, options *imap.SearchOptions) (hasContext, hasUpdate bool, err error) {
-	if err := dec.ExpectByte('('); err != nil {
-		return false, false, imap.ErrBad("expected '(' for RETURN options")
-	}
-
-	b, err := dec.PeekByte()
-	if err != nil {
-		return false, false, imap.ErrBad("unexpected end in RETURN options")
-	}
-	if b == ')' {
-		if err := dec.ExpectByte(')'); err != nil {
-			return false, false, imap.ErrBad("expected ')' for RETURN options")
-		}
-		return false, false, nil
-	}
-
-	for {
-		atom, err := dec.ReadAtom()
-		if err != nil {
-			return false, false, imap.ErrBad("invalid RETURN option")
-		}
-		switch strings.ToUpper(atom) {
-		case "MIN":
-			options.ReturnMin = true
-		case "MAX":
-			options.ReturnMax = true
-		case "ALL":
-			options.ReturnAll = true
-		case "COUNT":
-			options.ReturnCount = true
-		case "SAVE":
-			options.ReturnSave = true
-		case "UPDATE":
-			options.ReturnUpdate = true
-			hasUpdate = true
-		case "CONTEXT":
-			options.ReturnContext = true
-			hasContext = true
-		default:
-			return false, false, imap.ErrBad("unknown RETURN option: " + atom)
-		}
-
-		b, err := dec.PeekByte()
-		if err != nil {
-			return false, false, imap.ErrBad("unexpected end in RETURN options")
-		}
-		if b == ')' {
-			if err := dec.ExpectByte(')'); err != nil {
-				return false, false, imap.ErrBad("expected ')' for RETURN options")
-			}
-			return hasContext, hasUpdate, nil
-		}
-		if err := dec.ReadSP(); err != nil {
-			return false, false, imap.ErrBad("expected SP between RETURN options")
-		}
-	}
-}
-
 // hasAnyReturnOption returns true if any RETURN option is set (including CONTEXT/UPDATE).
 func hasAnyReturnOption(options *imap.SearchOptions) bool {
 	return options.ReturnMin || options.ReturnMax || options.ReturnAll ||
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/imaptest"
 	"github.com/meszmate/imap-go/imaptest/mock"
 	"github.com/meszmate/imap-go/server"
 	"github.com/meszmate/imap-go/wire"
@@ -50,85 +51,12 @@ var _ SessionContext = (*contextMockSession)(nil)
 
 func newTestCommandContext(t *testing.T, args string, sess server.Session) *server.CommandContext {
 	t.Helper()
-
-	clientConn, serverConn := net.Pipe()
-	t.Cleanup(func() {
-		_ = clientConn.Close()
-		_ = serverConn.Close()
-	})
-
-	conn := server.NewTestConn(serverConn, nil)
-
-	// Drain output to prevent blocking
-	go func() {
-		buf := make([]byte, 4096)
-		for {
-			_, err := clientConn.Read(buf)
-			if err != nil {
-				return
-			}
-		}
-	}()
-
-	var dec *wire.Decoder
-	if args != "" {
-		dec = wire.NewDecoder(strings.NewReader(args))
-	}
-
-	return &server.CommandContext{
-		Context: context.Background(),
-		Tag:     "A001",
-		Name:    "SEARCH",
-		NumKind: server.NumKindSeq,
-		Conn:    conn,
-		Session: sess,
-		Decoder: dec,
-	}
+	return imaptest.NewCommandContext(t, "SEARCH", args, sess)
 }
 
-func newTestCommandContextWithOutput(t *testing.T, args string, sess server.Session) (*server.CommandContext, *bytes.Buffer, chan struct{}) {
+func newTestCommandContextWithOutput(t *testing.T, args string, sess server.Session) (*server.CommandContext, *imaptest.Output) {
 	t.Helper()
-
-	clientConn, serverConn := net.Pipe()
-	t.Cleanup(func() {
-		_ = clientConn.Close()
-		_ = serverConn.Close()
-	})
-
-	conn := server.NewTestConn(serverConn, nil)
-
-	var outBuf bytes.Buffer
-	done := make(chan struct{})
-	go func() {
-		defer close(done)
-		buf := make([]byte, 8192)
-		for {
-			n, err := clientConn.Read(buf)
-			if n > 0 {
-				outBuf.Write(buf[:n])
-			}
-			if err != nil {
-				return
-			}
-		}
-	}()
-
-	var dec *wire.Decoder
-	if args != "" {
-		dec = wire.NewDecoder(strings.NewReader(args))
-	}
-
-	ctx := &server.CommandContext{
-		Context: context.Background(),
-		Tag:     "A001",
-		Name:    "SEARCH",
-		NumKind: server.NumKindSeq,
-		Conn:    conn,
-		Session: sess,
-		Decoder: dec,
-	}
-
-	return ctx, &outBuf, done
+	return imaptest.CaptureOutput(t, "SEARCH", args, sess)
 }
 
 func newCancelUpdateContext(t *testing.T, args string, sess server.Session) (*server.CommandContext, *bytes.Buffer, chan struct{}) {
@@ -344,15 +272,12 @@ func TestSearch_WithoutReturn_DelegatesToOriginal(t *testing.T) {
 		},
 	}
 
-	ctx, outBuf, done := newTestCommandContextWithOutput(t, "UNSEEN", sess)
+	ctx, outBuf := newTestCommandContextWithOutput(t, "UNSEEN", sess)
 
 	if err := h.Handle(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	if !searchCalled {
 		t.Fatal("Session.Search should have been called")
 	}
@@ -377,15 +302,12 @@ func TestSearch_NoContextSupport_SendsNOUPDATE(t *testing.T) {
 		},
 	}
 
-	ctx, outBuf, done := newTestCommandContextWithOutput(t, `RETURN (UPDATE MIN) ALL`, sess)
+	ctx, outBuf := newTestCommandContextWithOutput(t, `RETURN (UPDATE MIN) ALL`, sess)
 
 	if err := h.Handle(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	output := outBuf.String()
 	if !strings.Contains(output, "NOUPDATE") {
 		t.Errorf("expected NOUPDATE response, got: %s", output)
@@ -403,15 +325,12 @@ func TestSearch_ESearchResponseFormat(t *testing.T) {
 		searchContextResult: &imap.SearchData{Min: 1, Max: 42, Count: 5},
 	}
 
-	ctx, outBuf, done := newTestCommandContextWithOutput(t, `RETURN (UPDATE MIN MAX COUNT) ALL`, sess)
+	ctx, outBuf := newTestCommandContextWithOutput(t, `RETURN (UPDATE MIN MAX COUNT) ALL`, sess)
 
 	if err := h.Handle(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	output := outBuf.String()
 	if !strings.Contains(output, `* ESEARCH (TAG "A001") MIN 1 MAX 42 COUNT 5`) {
 		t.Errorf("unexpected ESEARCH response format: %s", output)
@@ -434,15 +353,12 @@ func TestSearch_AddToInResponse(t *testing.T) {
 		},
 	}
 
-	ctx, outBuf, done := newTestCommandContextWithOutput(t, `RETURN (UPDATE COUNT) ALL`, sess)
+	ctx, outBuf := newTestCommandContextWithOutput(t, `RETURN (UPDATE COUNT) ALL`, sess)
 
 	if err := h.Handle(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	output := outBuf.String()
 	if !strings.Contains(output, "ADDTO") {
 		t.Errorf("response should contain ADDTO, got: %s", output)
@@ -468,15 +384,12 @@ func TestSearch_RemoveFromInResponse(t *testing.T) {
 		},
 	}
 
-	ctx, outBuf, done := newTestCommandContextWithOutput(t, `RETURN (UPDATE COUNT) ALL`, sess)
+	ctx, outBuf := newTestCommandContextWithOutput(t, `RETURN (UPDATE COUNT) ALL`, sess)
 
 	if err := h.Handle(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	output := outBuf.String()
 	if !strings.Contains(output, "REMOVEFROM") {
 		t.Errorf("response should contain REMOVEFROM, got: %s", output)
@@ -496,15 +409,12 @@ func TestSearch_EmptyReturn(t *testing.T) {
 		},
 	}
 
-	ctx, outBuf, done := newTestCommandContextWithOutput(t, `RETURN () ALL`, sess)
+	ctx, outBuf := newTestCommandContextWithOutput(t, `RETURN () ALL`, sess)
 
 	if err := h.Handle(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	output := outBuf.String()
 	if !strings.Contains(output, "* SEARCH") {
 		t.Errorf("expected traditional SEARCH response, got: %s", output)
@@ -8,7 +8,9 @@ import (
 // Extension implements the ENABLE IMAP extension (RFC 5161).
 // ENABLE allows a client to activate server extensions that need explicit
 // opt-in. The command handling is built into the core server; this extension
-// only advertises the capability.
+// only advertises the capability. Capabilities implied by the enabled ones,
+// such as CONDSTORE by QRESYNC, are enabled as well, see
+// server.Server.EnableCapabilities.
 type Extension struct {
 	extension.BaseExtension
 }
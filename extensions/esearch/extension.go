@@ -8,9 +8,7 @@
 package esearch
 
 import (
-	"fmt"
 	"strings"
-	"time"
 
 	imap "github.com/meszmate/imap-go"
 	"github.com/meszmate/imap-go/extension"
@@ -28,18 +26,37 @@ type SessionESearch interface {
 // Extension implements the ESEARCH IMAP extension (RFC 4731).
 type Extension struct {
 	extension.BaseExtension
+
+	esearchOnly bool
 }
 
-var _ extension.ServerExtension = (*Extension)(nil)
+var _ extension.WrapDescriber = (*Extension)(nil)
+
+// Option configures the ESEARCH extension.
+type Option func(*Extension)
+
+// WithESearchOnly answers every SEARCH with an ESEARCH response, as if
+// RETURN (ALL) had been given, instead of a SEARCH response when the
+// client gives no RETURN options. Some servers behave this way; the
+// option lets tests check that clients cope with them.
+func WithESearchOnly() Option {
+	return func(e *Extension) {
+		e.esearchOnly = true
+	}
+}
 
 // New creates a new ESEARCH extension.
-func New() *Extension {
-	return &Extension{
+func New(opts ...Option) *Extension {
+	e := &Extension{
 		BaseExtension: extension.BaseExtension{
 			ExtName:         "ESEARCH",
 			ExtCapabilities: []imap.Cap{imap.CapESearch},
 		},
 	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
 }
 
 // CommandHandlers returns new command handlers to register.
@@ -47,24 +64,27 @@ func (e *Extension) CommandHandlers() map[string]interface{} { return nil }
 
 // WrapHandler wraps an existing command handler.
 func (e *Extension) WrapHandler(name string, handler interface{}) interface{} {
-	h, ok := handler.(server.CommandHandlerFunc)
-	if !ok {
-		ch, ok2 := handler.(server.CommandHandler)
-		if !ok2 {
-			return nil
-		}
-		h = ch.Handle
+	switch handler.(type) {
+	case server.CommandHandlerFunc, server.CommandHandler:
+	default:
+		return nil
 	}
 
 	switch name {
 	case "SEARCH":
 		return server.CommandHandlerFunc(func(ctx *server.CommandContext) error {
-			return handleESearch(ctx, h)
+			return handleESearch(ctx, e.esearchOnly)
 		})
 	}
 	return nil
 }
 
+// DescribeWrap describes the SEARCH wrapper, which handles the command
+// completely.
+func (e *Extension) DescribeWrap(command string) extension.WrapInfo {
+	return extension.WrapInfo{Replaces: true}
+}
+
 // SessionExtension returns the required session extension interface.
 func (e *Extension) SessionExtension() interface{} {
 	return (*SessionESearch)(nil)
@@ -74,20 +94,21 @@ func (e *Extension) SessionExtension() interface{} {
 func (e *Extension) OnEnabled(connID string) error { return nil }
 
 // handleESearch wraps the SEARCH command to parse RETURN options and write ESEARCH responses.
-func handleESearch(ctx *server.CommandContext, _ server.CommandHandlerFunc) error {
+// With esearchOnly, a SEARCH without RETURN options is answered as if
+// RETURN (ALL) had been given.
+func handleESearch(ctx *server.CommandContext, esearchOnly bool) error {
 	if ctx.Decoder == nil {
 		return imap.ErrBad("missing search criteria")
 	}
 
 	dec := ctx.Decoder
-	criteria := &imap.SearchCriteria{}
 	options := &imap.SearchOptions{}
 	hasReturn := false
 
-	// Peek to check if first token is "RETURN"
-	first, err := dec.ReadAtom()
+	// Check whether the first token is "RETURN"
+	first, err := server.ReadSearchToken(dec)
 	if err != nil {
-		return imap.ErrBad("missing search criteria")
+		return err
 	}
 
 	if strings.EqualFold(first, "RETURN") {
@@ -96,27 +117,24 @@ func handleESearch(ctx *server.CommandContext, _ server.CommandHandlerFunc) erro
 		if err := dec.ReadSP(); err != nil {
 			return imap.ErrBad("missing RETURN options")
 		}
-		if err := parseReturnOptions(dec, options); err != nil {
+		if err := server.ParseSearchReturnOptions(dec, options); err != nil {
 			return err
 		}
 		// Parse SP then search criteria
 		if err := dec.ReadSP(); err != nil {
 			return imap.ErrBad("missing search criteria after RETURN")
 		}
-		if err := ParseSearchCriteria(dec, criteria); err != nil {
-			return imap.ErrBad("invalid search criteria: " + err.Error())
-		}
-	} else {
-		// First atom is a search criterion, not RETURN
-		if err := ParseSearchCriterion(first, dec, criteria); err != nil {
-			return imap.ErrBad("invalid search criteria: " + err.Error())
-		}
-		// Try to read more criteria
-		if err := dec.ReadSP(); err == nil {
-			if err := ParseSearchCriteria(dec, criteria); err != nil {
-				return imap.ErrBad("invalid search criteria: " + err.Error())
-			}
-		}
+		first = ""
+	} else if esearchOnly {
+		hasReturn = true
+		options.ReturnAll = true
+	}
+	criteria, err := server.ParseSearchFrom(first, dec)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Conn.CheckSearchCriteria(criteria); err != nil {
+		return err
 	}
 
 	// Route to session
@@ -125,14 +143,19 @@ func handleESearch(ctx *server.CommandContext, _ server.CommandHandlerFunc) erro
 		if sess, ok := ctx.Session.(SessionESearch); ok {
 			data, err = sess.SearchExtended(ctx.NumKind, criteria, options)
 		} else {
-			data, err = ctx.Session.Search(ctx.NumKind, criteria, options)
+			data, err = server.RunSearch(ctx, criteria, options)
 		}
 	} else {
-		data, err = ctx.Session.Search(ctx.NumKind, criteria, options)
+		data, err = server.RunSearch(ctx, criteria, options)
 	}
 	if err != nil {
 		return err
 	}
+	if !(hasReturn && hasAnyReturnOption(options)) || options.ReturnAll {
+		if err := ctx.Conn.CheckSearchData(data); err != nil {
+			return err
+		}
+	}
 
 	// Write response
 	enc := ctx.Conn.Encoder()
@@ -158,64 +181,10 @@ func handleESearch(ctx *server.CommandContext, _ server.CommandHandlerFunc) erro
 		})
 	}
 
-	ctx.Conn.WriteOK(ctx.Tag, "SEARCH completed")
+	ctx.Conn.WriteSearchOK(ctx.Tag, data)
 	return nil
 }
 
-// parseReturnOptions parses a parenthesized list of RETURN options.
-func parseReturnOptions(dec *wire.Decoder, options *imap.SearchOptions) error {
-	if err := dec.ExpectByte('('); err != nil {
-		return imap.ErrBad("expected '(' for RETURN options")
-	}
-
-	b, err := dec.PeekByte()
-	if err != nil {
-		return imap.ErrBad("unexpected end in RETURN options")
-	}
-	if b == ')' {
-		// Empty RETURN () — no options
-		if err := dec.ExpectByte(')'); err != nil {
-			return imap.ErrBad("expected ')' for RETURN options")
-		}
-		return nil
-	}
-
-	for {
-		atom, err := dec.ReadAtom()
-		if err != nil {
-			return imap.ErrBad("invalid RETURN option")
-		}
-		switch strings.ToUpper(atom) {
-		case "MIN":
-			options.ReturnMin = true
-		case "MAX":
-			options.ReturnMax = true
-		case "ALL":
-			options.ReturnAll = true
-		case "COUNT":
-			options.ReturnCount = true
-		case "SAVE":
-			options.ReturnSave = true
-		default:
-			return imap.ErrBad("unknown RETURN option: " + atom)
-		}
-
-		b, err := dec.PeekByte()
-		if err != nil {
-			return imap.ErrBad("unexpected end in RETURN options")
-		}
-		if b == ')' {
-			if err := dec.ExpectByte(')'); err != nil {
-				return imap.ErrBad("expected ')' for RETURN options")
-			}
-			return nil
-		}
-		if err := dec.ReadSP(); err != nil {
-			return imap.ErrBad("expected SP between RETURN options")
-		}
-	}
-}
-
 // hasAnyReturnOption returns true if any RETURN option is set.
 func hasAnyReturnOption(options *imap.SearchOptions) bool {
 	return options.ReturnMin || options.ReturnMax || options.ReturnAll || options.ReturnCount || options.ReturnSave
@@ -255,291 +224,19 @@ func writeESearchResponse(enc *server.ResponseEncoder, ctx *server.CommandContex
 	})
 }
 
-// ParseSearchCriteria reads search criteria from the decoder in a loop.
+// ParseSearchCriteria reads search criteria from the decoder.
+//
+// Deprecated: Use server.SearchParser, which also handles OR,
+// parenthesized keys and CHARSET.
 func ParseSearchCriteria(dec *wire.Decoder, criteria *imap.SearchCriteria) error {
-	for {
-		b, err := dec.PeekByte()
-		if err != nil {
-			return nil
-		}
-		if b == ')' {
-			return nil
-		}
-
-		key, err := dec.ReadAtom()
-		if err != nil {
-			return nil
-		}
-
-		if err := ParseSearchCriterion(key, dec, criteria); err != nil {
-			return err
-		}
-
-		if err := dec.ReadSP(); err != nil {
-			return nil
-		}
-	}
+	var p server.SearchParser
+	return p.ParseKeys(dec, criteria)
 }
 
 // ParseSearchCriterion handles a single already-read criterion key.
+//
+// Deprecated: Use server.SearchParser.
 func ParseSearchCriterion(key string, dec *wire.Decoder, criteria *imap.SearchCriteria) error {
-	switch strings.ToUpper(key) {
-	case "ALL":
-		// Match all messages (no-op for criteria)
-	case "ANSWERED":
-		criteria.Flag = append(criteria.Flag, imap.FlagAnswered)
-	case "DELETED":
-		criteria.Flag = append(criteria.Flag, imap.FlagDeleted)
-	case "DRAFT":
-		criteria.Flag = append(criteria.Flag, imap.FlagDraft)
-	case "FLAGGED":
-		criteria.Flag = append(criteria.Flag, imap.FlagFlagged)
-	case "SEEN":
-		criteria.Flag = append(criteria.Flag, imap.FlagSeen)
-	case "RECENT":
-		criteria.Flag = append(criteria.Flag, imap.FlagRecent)
-	case "UNANSWERED":
-		criteria.NotFlag = append(criteria.NotFlag, imap.FlagAnswered)
-	case "UNDELETED":
-		criteria.NotFlag = append(criteria.NotFlag, imap.FlagDeleted)
-	case "UNDRAFT":
-		criteria.NotFlag = append(criteria.NotFlag, imap.FlagDraft)
-	case "UNFLAGGED":
-		criteria.NotFlag = append(criteria.NotFlag, imap.FlagFlagged)
-	case "UNSEEN":
-		criteria.NotFlag = append(criteria.NotFlag, imap.FlagSeen)
-	case "NEW":
-		criteria.Flag = append(criteria.Flag, imap.FlagRecent)
-		criteria.NotFlag = append(criteria.NotFlag, imap.FlagSeen)
-	case "OLD":
-		criteria.NotFlag = append(criteria.NotFlag, imap.FlagRecent)
-	case "KEYWORD":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		kw, err := dec.ReadAtom()
-		if err != nil {
-			return err
-		}
-		criteria.Flag = append(criteria.Flag, imap.Flag(kw))
-	case "UNKEYWORD":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		kw, err := dec.ReadAtom()
-		if err != nil {
-			return err
-		}
-		criteria.NotFlag = append(criteria.NotFlag, imap.Flag(kw))
-	case "LARGER":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		n, err := dec.ReadNumber64()
-		if err != nil {
-			return err
-		}
-		criteria.Larger = int64(n)
-	case "SMALLER":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		n, err := dec.ReadNumber64()
-		if err != nil {
-			return err
-		}
-		criteria.Smaller = int64(n)
-	case "BODY":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		criteria.Body = append(criteria.Body, s)
-	case "TEXT":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		criteria.Text = append(criteria.Text, s)
-	case "SUBJECT":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
-			Key: "Subject", Value: s,
-		})
-	case "FROM":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
-			Key: "From", Value: s,
-		})
-	case "TO":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
-			Key: "To", Value: s,
-		})
-	case "CC":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
-			Key: "Cc", Value: s,
-		})
-	case "BCC":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
-			Key: "Bcc", Value: s,
-		})
-	case "HEADER":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		hdrName, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		hdrValue, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
-			Key: hdrName, Value: hdrValue,
-		})
-	case "UID":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAtom()
-		if err != nil {
-			return err
-		}
-		uidSet, err := imap.ParseUIDSet(s)
-		if err != nil {
-			return err
-		}
-		criteria.UID = uidSet
-	case "MODSEQ":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		modseqCrit := &imap.SearchCriteriaModSeq{}
-		b, err := dec.PeekByte()
-		if err != nil {
-			return err
-		}
-		if b == '"' {
-			entryName, err := dec.ReadQuotedString()
-			if err != nil {
-				return err
-			}
-			modseqCrit.MetadataName = entryName
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			entryType, err := dec.ReadAtom()
-			if err != nil {
-				return err
-			}
-			modseqCrit.MetadataType = strings.ToLower(entryType)
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-		}
-		n, err := dec.ReadNumber64()
-		if err != nil {
-			return err
-		}
-		modseqCrit.ModSeq = n
-		criteria.ModSeq = modseqCrit
-	case "SAVEDBEFORE":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		t, err := time.Parse("2-Jan-2006", s)
-		if err != nil {
-			return fmt.Errorf("invalid SAVEDBEFORE date: %w", err)
-		}
-		criteria.SavedBefore = t
-	case "SAVEDSINCE":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		t, err := time.Parse("2-Jan-2006", s)
-		if err != nil {
-			return fmt.Errorf("invalid SAVEDSINCE date: %w", err)
-		}
-		criteria.SavedSince = t
-	case "SAVEDON":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		t, err := time.Parse("2-Jan-2006", s)
-		if err != nil {
-			return fmt.Errorf("invalid SAVEDON date: %w", err)
-		}
-		criteria.SavedOn = t
-	case "NOT":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		sub := &imap.SearchCriteria{}
-		if err := ParseSearchCriteria(dec, sub); err != nil {
-			return err
-		}
-		criteria.Not = append(criteria.Not, *sub)
-	default:
-		// Try to parse as a sequence set
-		seqSet, err := imap.ParseSeqSet(key)
-		if err == nil {
-			criteria.SeqNum = seqSet
-		}
-	}
-	return nil
+	var p server.SearchParser
+	return p.ParseKey(key, dec, criteria)
 }
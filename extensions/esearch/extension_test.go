@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/imaptest"
 	"github.com/meszmate/imap-go/imaptest/mock"
 	"github.com/meszmate/imap-go/server"
 	"github.com/meszmate/imap-go/wire"
@@ -39,86 +40,13 @@ var _ SessionESearch = (*esearchMockSession)(nil)
 
 func newTestCommandContext(t *testing.T, args string, sess server.Session) *server.CommandContext {
 	t.Helper()
-
-	clientConn, serverConn := net.Pipe()
-	t.Cleanup(func() {
-		_ = clientConn.Close()
-		_ = serverConn.Close()
-	})
-
-	conn := server.NewTestConn(serverConn, nil)
-
-	// Drain output to prevent blocking
-	go func() {
-		buf := make([]byte, 4096)
-		for {
-			_, err := clientConn.Read(buf)
-			if err != nil {
-				return
-			}
-		}
-	}()
-
-	var dec *wire.Decoder
-	if args != "" {
-		dec = wire.NewDecoder(strings.NewReader(args))
-	}
-
-	return &server.CommandContext{
-		Context: context.Background(),
-		Tag:     "A001",
-		Name:    "SEARCH",
-		NumKind: server.NumKindSeq,
-		Conn:    conn,
-		Session: sess,
-		Decoder: dec,
-	}
+	return imaptest.NewCommandContext(t, "SEARCH", args, sess)
 }
 
 // newTestCommandContextWithOutput creates a context and captures output.
-func newTestCommandContextWithOutput(t *testing.T, args string, sess server.Session) (*server.CommandContext, *bytes.Buffer, chan struct{}) {
+func newTestCommandContextWithOutput(t *testing.T, args string, sess server.Session) (*server.CommandContext, *imaptest.Output) {
 	t.Helper()
-
-	clientConn, serverConn := net.Pipe()
-	t.Cleanup(func() {
-		_ = clientConn.Close()
-		_ = serverConn.Close()
-	})
-
-	conn := server.NewTestConn(serverConn, nil)
-
-	var outBuf bytes.Buffer
-	done := make(chan struct{})
-	go func() {
-		defer close(done)
-		buf := make([]byte, 8192)
-		for {
-			n, err := clientConn.Read(buf)
-			if n > 0 {
-				outBuf.Write(buf[:n])
-			}
-			if err != nil {
-				return
-			}
-		}
-	}()
-
-	var dec *wire.Decoder
-	if args != "" {
-		dec = wire.NewDecoder(strings.NewReader(args))
-	}
-
-	ctx := &server.CommandContext{
-		Context: context.Background(),
-		Tag:     "A001",
-		Name:    "SEARCH",
-		NumKind: server.NumKindSeq,
-		Conn:    conn,
-		Session: sess,
-		Decoder: dec,
-	}
-
-	return ctx, &outBuf, done
+	return imaptest.CaptureOutput(t, "SEARCH", args, sess)
 }
 
 var dummyHandler = server.CommandHandlerFunc(func(ctx *server.CommandContext) error {
@@ -209,15 +137,12 @@ func TestSearch_WithReturnAllCount(t *testing.T) {
 		},
 	}
 
-	ctx, outBuf, done := newTestCommandContextWithOutput(t, "RETURN (ALL COUNT) FLAGGED", sess)
+	ctx, outBuf := newTestCommandContextWithOutput(t, "RETURN (ALL COUNT) FLAGGED", sess)
 
 	if err := h.Handle(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	output := outBuf.String()
 	if !strings.Contains(output, "ESEARCH") {
 		t.Errorf("response should contain ESEARCH, got: %s", output)
@@ -242,15 +167,12 @@ func TestSearch_WithEmptyReturn(t *testing.T) {
 		},
 	}
 
-	ctx, outBuf, done := newTestCommandContextWithOutput(t, "RETURN () ALL", sess)
+	ctx, outBuf := newTestCommandContextWithOutput(t, "RETURN () ALL", sess)
 
 	if err := h.Handle(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	if gotOpts == nil {
 		t.Fatal("Search was not called")
 	}
@@ -281,15 +203,12 @@ func TestSearch_WithoutReturn(t *testing.T) {
 		},
 	}
 
-	ctx, outBuf, done := newTestCommandContextWithOutput(t, "UNSEEN", sess)
+	ctx, outBuf := newTestCommandContextWithOutput(t, "UNSEEN", sess)
 
 	if err := h.Handle(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	if gotOpts == nil {
 		t.Fatal("Search was not called")
 	}
@@ -10,7 +10,6 @@ package esort
 import (
 	"fmt"
 	"strings"
-	"time"
 
 	imap "github.com/meszmate/imap-go"
 	"github.com/meszmate/imap-go/extension"
@@ -105,7 +104,7 @@ func handleESort(ctx *server.CommandContext, originalHandler server.CommandHandl
 	if err := dec.ReadSP(); err != nil {
 		return imap.ErrBad("missing RETURN options")
 	}
-	if err := parseReturnOptions(dec, options); err != nil {
+	if err := server.ParseSearchReturnOptions(dec, options); err != nil {
 		return err
 	}
 	if err := dec.ReadSP(); err != nil {
@@ -113,52 +112,22 @@ func handleESort(ctx *server.CommandContext, originalHandler server.CommandHandl
 	}
 
 	// Parse sort criteria list: (REVERSE? sort-key)+
-	var criteria []imap.SortCriterion
-	if err := dec.ReadList(func() error {
-		atom, err := dec.ReadAtom()
-		if err != nil {
-			return err
-		}
-
-		var criterion imap.SortCriterion
-		upper := strings.ToUpper(atom)
-		if upper == "REVERSE" {
-			criterion.Reverse = true
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			keyAtom, err := dec.ReadAtom()
-			if err != nil {
-				return err
-			}
-			criterion.Key = imap.SortKey(strings.ToUpper(keyAtom))
-		} else {
-			criterion.Key = imap.SortKey(upper)
-		}
-		criteria = append(criteria, criterion)
-		return nil
-	}); err != nil {
-		return imap.ErrBad("invalid sort criteria")
-	}
-
-	if len(criteria) == 0 {
-		return imap.ErrBad("empty sort criteria")
+	criteria, err := server.ReadSortCriteria(ctx.Conn, dec)
+	if err != nil {
+		return err
 	}
 
-	// Read SP and charset (consumed but ignored)
+	// Read SP, charset and search criteria
 	if err := dec.ReadSP(); err != nil {
 		return imap.ErrBad("expected charset")
 	}
-	if _, err := dec.ReadAtom(); err != nil {
-		return imap.ErrBad("invalid charset")
+	var parser server.SearchParser
+	searchCriteria, err := parser.ParseWithCharset(dec)
+	if err != nil {
+		return err
 	}
-
-	// Parse search criteria
-	searchCriteria := &imap.SearchCriteria{}
-	if err := dec.ReadSP(); err == nil {
-		if err := parseSearchCriteria(dec, searchCriteria); err != nil {
-			return imap.ErrBad("invalid search criteria: " + err.Error())
-		}
+	if err := ctx.Conn.CheckSearchCriteria(searchCriteria); err != nil {
+		return err
 	}
 
 	// Route to session
@@ -179,6 +148,11 @@ func handleESort(ctx *server.CommandContext, originalHandler server.CommandHandl
 	if err != nil {
 		return err
 	}
+	if !hasAnyReturnOption(options) || options.ReturnAll {
+		if err := ctx.Conn.CheckSearchData(data); err != nil {
+			return err
+		}
+	}
 
 	// Write response
 	enc := ctx.Conn.Encoder()
@@ -235,59 +209,6 @@ func sortDataToSearchData(sd *imap.SortData) *imap.SearchData {
 	return data
 }
 
-// parseReturnOptions parses a parenthesized list of RETURN options.
-func parseReturnOptions(dec *wire.Decoder, options *imap.SearchOptions) error {
-	if err := dec.ExpectByte('('); err != nil {
-		return imap.ErrBad("expected '(' for RETURN options")
-	}
-
-	b, err := dec.PeekByte()
-	if err != nil {
-		return imap.ErrBad("unexpected end in RETURN options")
-	}
-	if b == ')' {
-		if err := dec.ExpectByte(')'); err != nil {
-			return imap.ErrBad("expected ')' for RETURN options")
-		}
-		return nil
-	}
-
-	for {
-		atom, err := dec.ReadAtom()
-		if err != nil {
-			return imap.ErrBad("invalid RETURN option")
-		}
-		switch strings.ToUpper(atom) {
-		case "MIN":
-			options.ReturnMin = true
-		case "MAX":
-			options.ReturnMax = true
-		case "ALL":
-			options.ReturnAll = true
-		case "COUNT":
-			options.ReturnCount = true
-		case "SAVE":
-			options.ReturnSave = true
-		default:
-			return imap.ErrBad("unknown RETURN option: " + atom)
-		}
-
-		b, err := dec.PeekByte()
-		if err != nil {
-			return imap.ErrBad("unexpected end in RETURN options")
-		}
-		if b == ')' {
-			if err := dec.ExpectByte(')'); err != nil {
-				return imap.ErrBad("expected ')' for RETURN options")
-			}
-			return nil
-		}
-		if err := dec.ReadSP(); err != nil {
-			return imap.ErrBad("expected SP between RETURN options")
-		}
-	}
-}
-
 // hasAnyReturnOption returns true if any RETURN option is set.
 func hasAnyReturnOption(options *imap.SearchOptions) bool {
 	return options.ReturnMin || options.ReturnMax || options.ReturnAll || options.ReturnCount || options.ReturnSave
@@ -326,292 +247,3 @@ func writeESearchResponse(enc *server.ResponseEncoder, ctx *server.CommandContex
 		e.CRLF()
 	})
 }
-
-// parseSearchCriteria reads search criteria from the decoder in a loop.
-func parseSearchCriteria(dec *wire.Decoder, criteria *imap.SearchCriteria) error {
-	for {
-		b, err := dec.PeekByte()
-		if err != nil {
-			return nil
-		}
-		if b == ')' {
-			return nil
-		}
-
-		key, err := dec.ReadAtom()
-		if err != nil {
-			return nil
-		}
-
-		if err := parseSearchCriterion(key, dec, criteria); err != nil {
-			return err
-		}
-
-		if err := dec.ReadSP(); err != nil {
-			return nil
-		}
-	}
-}
-
-// parseSearchCriterion handles a single already-read criterion key.
-func parseSearchCriterion(key string, dec *wire.Decoder, criteria *imap.SearchCriteria) error {
-	switch strings.ToUpper(key) {
-	case "ALL":
-		// Match all messages (no-op for criteria)
-	case "ANSWERED":
-		criteria.Flag = append(criteria.Flag, imap.FlagAnswered)
-	case "DELETED":
-		criteria.Flag = append(criteria.Flag, imap.FlagDeleted)
-	case "DRAFT":
-		criteria.Flag = append(criteria.Flag, imap.FlagDraft)
-	case "FLAGGED":
-		criteria.Flag = append(criteria.Flag, imap.FlagFlagged)
-	case "SEEN":
-		criteria.Flag = append(criteria.Flag, imap.FlagSeen)
-	case "RECENT":
-		criteria.Flag = append(criteria.Flag, imap.FlagRecent)
-	case "UNANSWERED":
-		criteria.NotFlag = append(criteria.NotFlag, imap.FlagAnswered)
-	case "UNDELETED":
-		criteria.NotFlag = append(criteria.NotFlag, imap.FlagDeleted)
-	case "UNDRAFT":
-		criteria.NotFlag = append(criteria.NotFlag, imap.FlagDraft)
-	case "UNFLAGGED":
-		criteria.NotFlag = append(criteria.NotFlag, imap.FlagFlagged)
-	case "UNSEEN":
-		criteria.NotFlag = append(criteria.NotFlag, imap.FlagSeen)
-	case "NEW":
-		criteria.Flag = append(criteria.Flag, imap.FlagRecent)
-		criteria.NotFlag = append(criteria.NotFlag, imap.FlagSeen)
-	case "OLD":
-		criteria.NotFlag = append(criteria.NotFlag, imap.FlagRecent)
-	case "KEYWORD":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		kw, err := dec.ReadAtom()
-		if err != nil {
-			return err
-		}
-		criteria.Flag = append(criteria.Flag, imap.Flag(kw))
-	case "UNKEYWORD":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		kw, err := dec.ReadAtom()
-		if err != nil {
-			return err
-		}
-		criteria.NotFlag = append(criteria.NotFlag, imap.Flag(kw))
-	case "LARGER":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		n, err := dec.ReadNumber64()
-		if err != nil {
-			return err
-		}
-		criteria.Larger = int64(n)
-	case "SMALLER":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		n, err := dec.ReadNumber64()
-		if err != nil {
-			return err
-		}
-		criteria.Smaller = int64(n)
-	case "BODY":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		criteria.Body = append(criteria.Body, s)
-	case "TEXT":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		criteria.Text = append(criteria.Text, s)
-	case "SUBJECT":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
-			Key: "Subject", Value: s,
-		})
-	case "FROM":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
-			Key: "From", Value: s,
-		})
-	case "TO":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
-			Key: "To", Value: s,
-		})
-	case "CC":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
-			Key: "Cc", Value: s,
-		})
-	case "BCC":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
-			Key: "Bcc", Value: s,
-		})
-	case "HEADER":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		hdrName, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		hdrValue, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
-			Key: hdrName, Value: hdrValue,
-		})
-	case "UID":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAtom()
-		if err != nil {
-			return err
-		}
-		uidSet, err := imap.ParseUIDSet(s)
-		if err != nil {
-			return err
-		}
-		criteria.UID = uidSet
-	case "MODSEQ":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		modseqCrit := &imap.SearchCriteriaModSeq{}
-		b, err := dec.PeekByte()
-		if err != nil {
-			return err
-		}
-		if b == '"' {
-			entryName, err := dec.ReadQuotedString()
-			if err != nil {
-				return err
-			}
-			modseqCrit.MetadataName = entryName
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			entryType, err := dec.ReadAtom()
-			if err != nil {
-				return err
-			}
-			modseqCrit.MetadataType = strings.ToLower(entryType)
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-		}
-		n, err := dec.ReadNumber64()
-		if err != nil {
-			return err
-		}
-		modseqCrit.ModSeq = n
-		criteria.ModSeq = modseqCrit
-	case "SAVEDBEFORE":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		t, err := time.Parse("2-Jan-2006", s)
-		if err != nil {
-			return fmt.Errorf("invalid SAVEDBEFORE date: %w", err)
-		}
-		criteria.SavedBefore = t
-	case "SAVEDSINCE":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		t, err := time.Parse("2-Jan-2006", s)
-		if err != nil {
-			return fmt.Errorf("invalid SAVEDSINCE date: %w", err)
-		}
-		criteria.SavedSince = t
-	case "SAVEDON":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		s, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		t, err := time.Parse("2-Jan-2006", s)
-		if err != nil {
-			return fmt.Errorf("invalid SAVEDON date: %w", err)
-		}
-		criteria.SavedOn = t
-	case "NOT":
-		if err := dec.ReadSP(); err != nil {
-			return err
-		}
-		sub := &imap.SearchCriteria{}
-		if err := parseSearchCriteria(dec, sub); err != nil {
-			return err
-		}
-		criteria.Not = append(criteria.Not, *sub)
-	default:
-		// Try to parse as a sequence set
-		seqSet, err := imap.ParseSeqSet(key)
-		if err == nil {
-			criteria.SeqNum = seqSet
-		}
-	}
-	return nil
-}
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/imaptest"
 	"github.com/meszmate/imap-go/server"
 	"github.com/meszmate/imap-go/wire"
 )
@@ -106,85 +107,12 @@ var _ SessionESort = (*esortMockSession)(nil)
 
 func newTestCommandContext(t *testing.T, args string, sess server.Session) *server.CommandContext {
 	t.Helper()
-
-	clientConn, serverConn := net.Pipe()
-	t.Cleanup(func() {
-		_ = clientConn.Close()
-		_ = serverConn.Close()
-	})
-
-	conn := server.NewTestConn(serverConn, nil)
-
-	// Drain output to prevent blocking
-	go func() {
-		buf := make([]byte, 4096)
-		for {
-			_, err := clientConn.Read(buf)
-			if err != nil {
-				return
-			}
-		}
-	}()
-
-	var dec *wire.Decoder
-	if args != "" {
-		dec = wire.NewDecoder(strings.NewReader(args))
-	}
-
-	return &server.CommandContext{
-		Context: context.Background(),
-		Tag:     "A001",
-		Name:    "SORT",
-		NumKind: server.NumKindSeq,
-		Conn:    conn,
-		Session: sess,
-		Decoder: dec,
-	}
+	return imaptest.NewCommandContext(t, "SORT", args, sess)
 }
 
-func newTestCommandContextWithOutput(t *testing.T, args string, sess server.Session) (*server.CommandContext, *bytes.Buffer, chan struct{}) {
+func newTestCommandContextWithOutput(t *testing.T, args string, sess server.Session) (*server.CommandContext, *imaptest.Output) {
 	t.Helper()
-
-	clientConn, serverConn := net.Pipe()
-	t.Cleanup(func() {
-		_ = clientConn.Close()
-		_ = serverConn.Close()
-	})
-
-	conn := server.NewTestConn(serverConn, nil)
-
-	var outBuf bytes.Buffer
-	done := make(chan struct{})
-	go func() {
-		defer close(done)
-		buf := make([]byte, 8192)
-		for {
-			n, err := clientConn.Read(buf)
-			if n > 0 {
-				outBuf.Write(buf[:n])
-			}
-			if err != nil {
-				return
-			}
-		}
-	}()
-
-	var dec *wire.Decoder
-	if args != "" {
-		dec = wire.NewDecoder(strings.NewReader(args))
-	}
-
-	ctx := &server.CommandContext{
-		Context: context.Background(),
-		Tag:     "A001",
-		Name:    "SORT",
-		NumKind: server.NumKindSeq,
-		Conn:    conn,
-		Session: sess,
-		Decoder: dec,
-	}
-
-	return ctx, &outBuf, done
+	return imaptest.CaptureOutput(t, "SORT", args, sess)
 }
 
 var dummyHandler = server.CommandHandlerFunc(func(ctx *server.CommandContext) error {
@@ -263,15 +191,12 @@ func TestSort_WithReturnAllCount(t *testing.T) {
 	sess := &sortMockSession{
 		sortResult: &imap.SortData{AllNums: []uint32{1, 5, 10}},
 	}
-	ctx, outBuf, done := newTestCommandContextWithOutput(t, "RETURN (ALL COUNT) (DATE) UTF-8 FLAGGED", sess)
+	ctx, outBuf := newTestCommandContextWithOutput(t, "RETURN (ALL COUNT) (DATE) UTF-8 FLAGGED", sess)
 
 	if err := h.Handle(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	output := outBuf.String()
 	if !strings.Contains(output, "ESEARCH") {
 		t.Errorf("response should contain ESEARCH, got: %s", output)
@@ -291,15 +216,12 @@ func TestSort_WithEmptyReturn(t *testing.T) {
 	sess := &sortMockSession{
 		sortResult: &imap.SortData{AllNums: []uint32{1, 2, 3}},
 	}
-	ctx, outBuf, done := newTestCommandContextWithOutput(t, "RETURN () (DATE) UTF-8 ALL", sess)
+	ctx, outBuf := newTestCommandContextWithOutput(t, "RETURN () (DATE) UTF-8 ALL", sess)
 
 	if err := h.Handle(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	if !sess.sortCalled {
 		t.Fatal("Sort was not called")
 	}
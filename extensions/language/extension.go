@@ -3,10 +3,23 @@
 // LANGUAGE allows the client to request that the server use a specific
 // language for human-readable text in responses, or to query which
 // languages the server supports.
+//
+// The extension negotiates the language of each connection, which
+// server.Conn.Language returns; the server's Translator localizes the
+// response texts. A Catalog provides both, the languages to negotiate and
+// the Translator:
+//
+//	catalog := language.Catalog{"de": {"No such mailbox": "Postfach existiert nicht"}}
+//	srv := server.New(
+//		server.WithExtensions(language.New(language.WithCatalog(catalog))),
+//		server.WithTranslator(catalog.Translator()),
+//	)
 package language
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	imap "github.com/meszmate/imap-go"
 	"github.com/meszmate/imap-go/extension"
@@ -14,6 +27,10 @@ import (
 	"github.com/meszmate/imap-go/wire"
 )
 
+// DefaultLanguage is the language of response texts before a language is
+// negotiated, "i-default" (RFC 2277). It is always supported.
+const DefaultLanguage = "i-default"
+
 // SessionLanguage is an optional interface for sessions that support
 // the LANGUAGE command.
 type SessionLanguage interface {
@@ -26,89 +43,211 @@ type SessionLanguage interface {
 // Extension implements the LANGUAGE IMAP extension (RFC 5255).
 type Extension struct {
 	extension.BaseExtension
+
+	languages []string
+	catalog   Catalog
 }
 
 var _ extension.ServerExtension = (*Extension)(nil)
 
+// Option configures the LANGUAGE extension.
+type Option func(*Extension)
+
+// WithLanguages sets the languages the server supports, as language tags
+// such as "en" or "de-CH", in order of preference: the first is used when
+// the client asks for the server's default language. Sessions that
+// implement SessionLanguage negotiate the language themselves instead.
+func WithLanguages(tags ...string) Option {
+	return func(e *Extension) {
+		e.languages = tags
+	}
+}
+
+// WithCatalog sets the translations of response texts. Its languages are
+// supported, in alphabetical order unless WithLanguages is given, and the
+// tagged OK response of the LANGUAGE command is translated to the
+// negotiated language.
+func WithCatalog(c Catalog) Option {
+	return func(e *Extension) {
+		e.catalog = c
+	}
+}
+
 // New creates a new LANGUAGE extension.
-func New() *Extension {
-	return &Extension{
+func New(opts ...Option) *Extension {
+	e := &Extension{
 		BaseExtension: extension.BaseExtension{
 			ExtName:         "LANGUAGE",
 			ExtCapabilities: []imap.Cap{imap.CapLanguage},
 		},
 	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.languages == nil {
+		e.languages = e.catalog.Languages()
+	}
+	return e
+}
+
+// Languages returns the supported languages, in order of preference,
+// followed by DefaultLanguage.
+func (e *Extension) Languages() []string {
+	langs := make([]string, 0, len(e.languages)+1)
+	for _, tag := range e.languages {
+		if !strings.EqualFold(tag, DefaultLanguage) {
+			langs = append(langs, tag)
+		}
+	}
+	return append(langs, DefaultLanguage)
 }
 
 // CommandHandlers returns the LANGUAGE command handler.
 func (e *Extension) CommandHandlers() map[string]interface{} {
 	return map[string]interface{}{
-		imap.CommandLanguage: server.CommandHandlerFunc(handleLanguage),
+		imap.CommandLanguage: server.CommandHandlerFunc(e.handleLanguage),
 	}
 }
 
 func (e *Extension) WrapHandler(name string, handler interface{}) interface{} { return nil }
 
 // SessionExtension returns the SessionLanguage interface that sessions
-// must implement to support the LANGUAGE command.
+// may implement to negotiate the language themselves.
 func (e *Extension) SessionExtension() interface{} {
 	return (*SessionLanguage)(nil)
 }
 
 func (e *Extension) OnEnabled(connID string) error { return nil }
 
-// handleLanguage handles the LANGUAGE command.
-func handleLanguage(ctx *server.CommandContext) error {
-	state := ctx.Conn.State()
-	if state != imap.ConnStateAuthenticated && state != imap.ConnStateSelected {
-		ctx.Conn.WriteBAD(ctx.Tag, "LANGUAGE not allowed in current state")
-		return nil
-	}
-
-	sess, ok := ctx.Session.(SessionLanguage)
-	if !ok {
-		ctx.Conn.WriteNO(ctx.Tag, "LANGUAGE not supported")
-		return nil
+// Match returns the supported language the client's language ranges
+// select, trying them in order: a range selects the language it names, or
+// if there is none, the language named by its longest prefix ending before
+// a hyphen, as in the lookup scheme of RFC 4647. The ranges "*" and
+// "default" select the server's preferred language. It returns false if no
+// range selects a language.
+func (e *Extension) Match(ranges []string) (string, bool) {
+	langs := e.Languages()
+	for _, r := range ranges {
+		if r == "*" || strings.EqualFold(r, "default") {
+			return langs[0], true
+		}
+		for r != "" {
+			for _, tag := range langs {
+				if strings.EqualFold(tag, r) {
+					return tag, true
+				}
+			}
+			i := strings.LastIndexByte(r, '-')
+			if i < 0 {
+				break
+			}
+			r = r[:i]
+		}
 	}
+	return "", false
+}
 
-	// Read optional language tags
-	var tags []string
+// handleLanguage handles the LANGUAGE command, which is valid in all
+// states:
+//
+//	language-cmd = "LANGUAGE" *(SP lang-range-quoted)
+func (e *Extension) handleLanguage(ctx *server.CommandContext) error {
+	var ranges []string
 	if ctx.Decoder != nil {
 		for {
-			tag, err := ctx.Decoder.ReadAtom()
+			r, err := ctx.Decoder.ReadAString()
 			if err != nil {
-				break
+				return imap.ErrBad("invalid language range")
 			}
-			tags = append(tags, tag)
-
+			ranges = append(ranges, r)
 			if err := ctx.Decoder.ReadSP(); err != nil {
 				break
 			}
 		}
 	}
 
-	selected, available, err := sess.Language(tags)
-	if err != nil {
-		ctx.Conn.WriteNO(ctx.Tag, fmt.Sprintf("LANGUAGE failed: %v", err))
+	if sess, ok := ctx.Session.(SessionLanguage); ok {
+		selected, available, err := sess.Language(ranges)
+		if err != nil {
+			ctx.Conn.WriteNO(ctx.Tag, fmt.Sprintf("LANGUAGE failed: %v", err))
+			return nil
+		}
+		if len(available) > 0 {
+			writeLanguage(ctx.Conn, available)
+		}
+		if selected != "" {
+			ctx.Conn.SetLanguage(selected)
+		}
+		ctx.Conn.WriteOK(ctx.Tag, e.catalog.translate(ctx.Conn.Language(), "LANGUAGE completed"))
+		return nil
+	}
+
+	if len(ranges) == 0 {
+		writeLanguage(ctx.Conn, e.Languages())
+		ctx.Conn.WriteOK(ctx.Tag, e.catalog.translate(ctx.Conn.Language(), "Supported languages listed"))
 		return nil
 	}
 
-	// Write available languages if returned
-	if len(available) > 0 {
-		ctx.Conn.Encoder().Encode(func(enc *wire.Encoder) {
-			enc.Star().Atom("LANGUAGE").SP().BeginList()
-			for i, lang := range available {
-				if i > 0 {
-					enc.SP()
-				}
-				enc.AString(lang)
+	selected, ok := e.Match(ranges)
+	if !ok {
+		return imap.ErrNo("Unsupported language " + strings.Join(ranges, " "))
+	}
+	ctx.Conn.SetLanguage(selected)
+	writeLanguage(ctx.Conn, []string{selected})
+	ctx.Conn.WriteOK(ctx.Tag, e.catalog.translate(selected, "LANGUAGE completed"))
+	return nil
+}
+
+// writeLanguage writes a LANGUAGE response listing langs.
+func writeLanguage(conn *server.Conn, langs []string) {
+	conn.Encoder().Encode(func(enc *wire.Encoder) {
+		enc.Star().Atom("LANGUAGE").SP().BeginList()
+		for i, lang := range langs {
+			if i > 0 {
+				enc.SP()
 			}
-			enc.EndList().CRLF()
-		})
+			enc.AString(lang)
+		}
+		enc.EndList().CRLF()
+	})
+}
+
+// Catalog holds the translations of response texts, keyed by language tag
+// and then by the text the server sends by default.
+type Catalog map[string]map[string]string
+
+// Languages returns the languages of the catalog, in alphabetical order.
+func (c Catalog) Languages() []string {
+	langs := make([]string, 0, len(c))
+	for tag := range c {
+		langs = append(langs, tag)
 	}
+	sort.Strings(langs)
+	return langs
+}
 
-	_ = selected
+// Translator returns a server.Translator translating response texts to
+// the language negotiated for the connection. Texts without a translation
+// are sent as they are.
+func (c Catalog) Translator() server.Translator {
+	return func(conn *server.Conn, typ imap.StatusResponseType, code imap.ResponseCode, text string) string {
+		return c.translate(conn.Language(), text)
+	}
+}
 
-	ctx.Conn.WriteOK(ctx.Tag, "LANGUAGE completed")
-	return nil
+// translate returns the translation of text to the language tag, or text
+// if there is none.
+func (c Catalog) translate(tag, text string) string {
+	if tag == "" {
+		return text
+	}
+	for lang, texts := range c {
+		if strings.EqualFold(lang, tag) {
+			if tr, ok := texts[text]; ok {
+				return tr
+			}
+			break
+		}
+	}
+	return text
 }
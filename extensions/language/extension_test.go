@@ -0,0 +1,142 @@
+package language
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/imaptest"
+	"github.com/meszmate/imap-go/imaptest/mock"
+	"github.com/meszmate/imap-go/server"
+)
+
+var testCatalog = Catalog{
+	"de": {
+		"LANGUAGE completed": "Sprache gewechselt",
+		"No such mailbox":    "Postfach existiert nicht",
+	},
+	"fr": {
+		"LANGUAGE completed": "Langue changée",
+	},
+}
+
+// languageSession negotiates the language itself.
+type languageSession struct {
+	mock.Session
+	ranges []string
+}
+
+func (s *languageSession) Language(tags []string) (string, []string, error) {
+	s.ranges = tags
+	if len(tags) > 0 && tags[0] == "xx" {
+		return "", nil, errors.New("unsupported")
+	}
+	return "en", []string{"en"}, nil
+}
+
+func runLanguage(t *testing.T, ext *Extension, args string, sess server.Session) (*server.CommandContext, []string, error) {
+	t.Helper()
+	ctx, out := imaptest.CaptureOutput(t, "LANGUAGE", args, sess)
+	h := ext.CommandHandlers()[imap.CommandLanguage].(server.CommandHandlerFunc)
+	err := h.Handle(ctx)
+	return ctx, out.Lines(), err
+}
+
+func TestLanguage_List(t *testing.T) {
+	ext := New(WithCatalog(testCatalog))
+	_, lines, err := runLanguage(t, ext, "", &mock.Session{})
+	if err != nil {
+		t.Fatalf("LANGUAGE error: %v", err)
+	}
+	want := []string{"* LANGUAGE (de fr i-default)", "A001 OK Supported languages listed"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("responses = %q, want %q", lines, want)
+	}
+}
+
+func TestLanguage_Select(t *testing.T) {
+	ext := New(WithCatalog(testCatalog))
+	// Allowed before authentication.
+	ctx, lines, err := runLanguage(t, ext, `"de-CH" fr`, &mock.Session{})
+	if err != nil {
+		t.Fatalf("LANGUAGE error: %v", err)
+	}
+	want := []string{"* LANGUAGE (de)", "A001 OK Sprache gewechselt"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("responses = %q, want %q", lines, want)
+	}
+	if got := ctx.Conn.Language(); got != "de" {
+		t.Errorf("Conn.Language() = %q, want de", got)
+	}
+
+	_, _, err = runLanguage(t, ext, "it es", &mock.Session{})
+	var imapErr *imap.IMAPError
+	if !errors.As(err, &imapErr) || imapErr.Type != imap.StatusResponseTypeNO {
+		t.Errorf("LANGUAGE it es error = %v, want NO", err)
+	}
+}
+
+func TestLanguage_Session(t *testing.T) {
+	ext := New(WithLanguages("de"))
+	sess := &languageSession{}
+	ctx, lines, err := runLanguage(t, ext, "en-US", sess)
+	if err != nil {
+		t.Fatalf("LANGUAGE error: %v", err)
+	}
+	if !reflect.DeepEqual(sess.ranges, []string{"en-US"}) {
+		t.Errorf("session got ranges %q", sess.ranges)
+	}
+	want := []string{"* LANGUAGE (en)", "A001 OK LANGUAGE completed"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("responses = %q, want %q", lines, want)
+	}
+	if got := ctx.Conn.Language(); got != "en" {
+		t.Errorf("Conn.Language() = %q, want en", got)
+	}
+
+	if _, lines, _ := runLanguage(t, ext, "xx", sess); len(lines) != 1 || lines[0] != "A001 NO LANGUAGE failed: unsupported" {
+		t.Errorf("responses = %q", lines)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	ext := New(WithLanguages("en", "de", "pt-BR"))
+	tests := []struct {
+		ranges []string
+		want   string
+		ok     bool
+	}{
+		{[]string{"DE"}, "de", true},
+		{[]string{"de-AT-1996"}, "de", true},
+		{[]string{"pt-br"}, "pt-BR", true},
+		{[]string{"pt"}, "", false},
+		{[]string{"it", "en"}, "en", true},
+		{[]string{"default"}, "en", true},
+		{[]string{"*"}, "en", true},
+		{[]string{"i-default"}, "i-default", true},
+		{[]string{"it"}, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := ext.Match(tt.ranges)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Match(%q) = %q, %v, want %q, %v", tt.ranges, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCatalog_Translator(t *testing.T) {
+	tr := testCatalog.Translator()
+	ctx := imaptest.NewCommandContext(t, "SELECT", "", &mock.Session{})
+
+	if got := tr(ctx.Conn, imap.StatusResponseTypeNO, "", "No such mailbox"); got != "No such mailbox" {
+		t.Errorf("before LANGUAGE: %q", got)
+	}
+	ctx.Conn.SetLanguage("DE")
+	if got := tr(ctx.Conn, imap.StatusResponseTypeNO, imap.ResponseCodeNonExistent, "No such mailbox"); got != "Postfach existiert nicht" {
+		t.Errorf("translated = %q", got)
+	}
+	if got := tr(ctx.Conn, imap.StatusResponseTypeNO, "", "Mailbox is full"); got != "Mailbox is full" {
+		t.Errorf("untranslated = %q", got)
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	imap "github.com/meszmate/imap-go"
 	"github.com/meszmate/imap-go/extension"
+	"github.com/meszmate/imap-go/extensions/listmyrights"
 	"github.com/meszmate/imap-go/server"
 	"github.com/meszmate/imap-go/wire"
 )
@@ -69,6 +70,14 @@ func (e *Extension) SessionExtension() interface{} {
 
 func (e *Extension) OnEnabled(connID string) error { return nil }
 
+// sessionMyRights is implemented by sessions supporting the MYRIGHTS
+// command of the ACL extension (RFC 4314), such as acl.SessionACL. Their
+// rights are returned for LIST RETURN (MYRIGHTS) if the session does not
+// set ListData.MyRights.
+type sessionMyRights interface {
+	MyRights(mailbox string) (*imap.ACLMyRightsData, error)
+}
+
 // handleListExtended wraps the LIST command to parse extended syntax.
 func handleListExtended(ctx *server.CommandContext, _ server.CommandHandlerFunc) error {
 	if ctx.Decoder == nil {
@@ -105,7 +114,7 @@ func handleListExtended(ctx *server.CommandContext, _ server.CommandHandlerFunc)
 		}
 
 		// Read reference name
-		ref, err = dec.ReadAString()
+		ref, err = dec.ReadMailbox()
 		if err != nil {
 			return imap.ErrBad("invalid reference name")
 		}
@@ -121,7 +130,7 @@ func handleListExtended(ctx *server.CommandContext, _ server.CommandHandlerFunc)
 		}
 	} else {
 		// Basic or basic-with-RETURN syntax: ref SP pattern
-		ref, err = dec.ReadAString()
+		ref, err = dec.ReadMailbox()
 		if err != nil {
 			return imap.ErrBad("invalid reference name")
 		}
@@ -154,17 +163,39 @@ func handleListExtended(ctx *server.CommandContext, _ server.CommandHandlerFunc)
 		}
 	}
 
-	// Route to session
-	w := server.NewListWriter(ctx.Conn.Encoder())
-	if isExtended {
-		if sess, ok := ctx.Session.(SessionListExtended); ok {
-			if err := sess.ListExtended(w, ref, patterns, options); err != nil {
-				return err
-			}
-		} else {
-			if err := ctx.Session.List(w, ref, patterns, options); err != nil {
-				return err
-			}
+	if err := ctx.Conn.CheckListPatterns(ref, patterns); err != nil {
+		return err
+	}
+	ref, patterns, err = ctx.Conn.ResolveListReference(ref, patterns)
+	if err != nil {
+		return err
+	}
+
+	// Route to session. Parents are only inferred without selection
+	// options; with SUBSCRIBED, they are reported with CHILDINFO instead
+	// (RFC 5258).
+	w := ctx.Conn.NewListWriter()
+	if !options.SelectSubscribed && !options.SelectSpecialUse {
+		patterns = w.InferParents(ref, patterns)
+	}
+	if options.ReturnMyRights {
+		if sess, ok := ctx.Session.(sessionMyRights); ok {
+			w.SetMyRights(func(mailbox string) (imap.ACLRights, error) {
+				data, err := sess.MyRights(mailbox)
+				if err != nil || data == nil {
+					return "", err
+				}
+				return data.Rights, nil
+			})
+		}
+	}
+	if sess, ok := ctx.Session.(listmyrights.SessionListMyRights); ok && options.ReturnMyRights {
+		if err := sess.ListMyRights(w, ref, patterns, options); err != nil {
+			return err
+		}
+	} else if sess, ok := ctx.Session.(SessionListExtended); ok && isExtended {
+		if err := sess.ListExtended(w, ref, patterns, options); err != nil {
+			return err
 		}
 	} else {
 		if err := ctx.Session.List(w, ref, patterns, options); err != nil {
@@ -172,6 +203,8 @@ func handleListExtended(ctx *server.CommandContext, _ server.CommandHandlerFunc)
 		}
 	}
 
+	w.Flush()
+
 	ctx.Conn.WriteOK(ctx.Tag, "LIST completed")
 	return nil
 }
@@ -204,7 +237,7 @@ func readPatterns(dec *wire.Decoder) ([]string, error) {
 					return nil, imap.ErrBad("expected SP between patterns")
 				}
 			}
-			p, err := dec.ReadAString()
+			p, err := dec.ReadListMailbox()
 			if err != nil {
 				return nil, imap.ErrBad("invalid pattern")
 			}
@@ -217,7 +250,7 @@ func readPatterns(dec *wire.Decoder) ([]string, error) {
 	}
 
 	// Single pattern
-	p, err := dec.ReadAString()
+	p, err := dec.ReadListMailbox()
 	if err != nil {
 		return nil, imap.ErrBad("invalid mailbox pattern")
 	}
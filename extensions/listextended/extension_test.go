@@ -1,16 +1,13 @@
 package listextended
 
 import (
-	"bytes"
-	"context"
-	"net"
 	"strings"
 	"testing"
 
 	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/imaptest"
 	"github.com/meszmate/imap-go/imaptest/mock"
 	"github.com/meszmate/imap-go/server"
-	"github.com/meszmate/imap-go/wire"
 )
 
 // listExtendedMockSession embeds mock.Session and adds ListExtended.
@@ -35,85 +32,12 @@ var _ SessionListExtended = (*listExtendedMockSession)(nil)
 
 func newTestCommandContext(t *testing.T, args string, sess server.Session) *server.CommandContext {
 	t.Helper()
-
-	clientConn, serverConn := net.Pipe()
-	t.Cleanup(func() {
-		_ = clientConn.Close()
-		_ = serverConn.Close()
-	})
-
-	conn := server.NewTestConn(serverConn, nil)
-
-	// Drain output to prevent blocking
-	go func() {
-		buf := make([]byte, 4096)
-		for {
-			_, err := clientConn.Read(buf)
-			if err != nil {
-				return
-			}
-		}
-	}()
-
-	var dec *wire.Decoder
-	if args != "" {
-		dec = wire.NewDecoder(strings.NewReader(args))
-	}
-
-	return &server.CommandContext{
-		Context: context.Background(),
-		Tag:     "A001",
-		Name:    "LIST",
-		NumKind: server.NumKindSeq,
-		Conn:    conn,
-		Session: sess,
-		Decoder: dec,
-	}
+	return imaptest.NewCommandContext(t, "LIST", args, sess)
 }
 
-func newTestCommandContextWithOutput(t *testing.T, args string, sess server.Session) (*server.CommandContext, *bytes.Buffer, chan struct{}) {
+func newTestCommandContextWithOutput(t *testing.T, args string, sess server.Session) (*server.CommandContext, *imaptest.Output) {
 	t.Helper()
-
-	clientConn, serverConn := net.Pipe()
-	t.Cleanup(func() {
-		_ = clientConn.Close()
-		_ = serverConn.Close()
-	})
-
-	conn := server.NewTestConn(serverConn, nil)
-
-	var outBuf bytes.Buffer
-	done := make(chan struct{})
-	go func() {
-		defer close(done)
-		buf := make([]byte, 8192)
-		for {
-			n, err := clientConn.Read(buf)
-			if n > 0 {
-				outBuf.Write(buf[:n])
-			}
-			if err != nil {
-				return
-			}
-		}
-	}()
-
-	var dec *wire.Decoder
-	if args != "" {
-		dec = wire.NewDecoder(strings.NewReader(args))
-	}
-
-	ctx := &server.CommandContext{
-		Context: context.Background(),
-		Tag:     "A001",
-		Name:    "LIST",
-		NumKind: server.NumKindSeq,
-		Conn:    conn,
-		Session: sess,
-		Decoder: dec,
-	}
-
-	return ctx, &outBuf, done
+	return imaptest.CaptureOutput(t, "LIST", args, sess)
 }
 
 var dummyHandler = server.CommandHandlerFunc(func(ctx *server.CommandContext) error {
@@ -425,15 +349,12 @@ func TestListExtended_WriteListResponse(t *testing.T) {
 		},
 	}
 
-	ctx, outBuf, done := newTestCommandContextWithOutput(t, `"" "*"`, sess)
+	ctx, outBuf := newTestCommandContextWithOutput(t, `"" "*"`, sess)
 
 	if err := h.Handle(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	output := outBuf.String()
 	if !strings.Contains(output, "* LIST") {
 		t.Errorf("response should contain LIST, got: %s", output)
@@ -460,15 +381,12 @@ func TestListExtended_WriteExtendedData(t *testing.T) {
 		},
 	}
 
-	ctx, outBuf, done := newTestCommandContextWithOutput(t, `"" "*" RETURN (CHILDREN)`, sess)
+	ctx, outBuf := newTestCommandContextWithOutput(t, `"" "*" RETURN (CHILDREN)`, sess)
 
 	if err := h.Handle(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	output := outBuf.String()
 	if !strings.Contains(output, "CHILDINFO") {
 		t.Errorf("response should contain CHILDINFO, got: %s", output)
@@ -497,15 +415,12 @@ func TestListExtended_WriteStatusResponse(t *testing.T) {
 		},
 	}
 
-	ctx, outBuf, done := newTestCommandContextWithOutput(t, `"" "*" RETURN (STATUS (MESSAGES))`, sess)
+	ctx, outBuf := newTestCommandContextWithOutput(t, `"" "*" RETURN (STATUS (MESSAGES))`, sess)
 
 	if err := h.Handle(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	output := outBuf.String()
 	if !strings.Contains(output, "* LIST") {
 		t.Errorf("response should contain LIST, got: %s", output)
@@ -565,6 +480,49 @@ func TestListExtended_MyRightsReturn(t *testing.T) {
 	}
 }
 
+// myRightsMockSession embeds mock.Session and adds the MYRIGHTS command.
+type myRightsMockSession struct {
+	mock.Session
+}
+
+func (m *myRightsMockSession) MyRights(mailbox string) (*imap.ACLMyRightsData, error) {
+	if mailbox == "Shared" {
+		return nil, imap.ErrNo("no rights")
+	}
+	return &imap.ACLMyRightsData{Mailbox: mailbox, Rights: "lrswi"}, nil
+}
+
+func TestListExtended_MyRightsResponses(t *testing.T) {
+	ext := New()
+	h := ext.WrapHandler("LIST", dummyHandler).(server.CommandHandlerFunc)
+
+	sess := &myRightsMockSession{}
+	sess.ListFunc = func(w *server.ListWriter, ref string, patterns []string, options *imap.ListOptions) error {
+		w.WriteList(&imap.ListData{Delim: '/', Mailbox: "INBOX"})
+		w.WriteList(&imap.ListData{Delim: '/', Mailbox: "Archive", MyRights: "lr"})
+		w.WriteList(&imap.ListData{Attrs: []imap.MailboxAttr{imap.MailboxAttrNoSelect}, Delim: '/', Mailbox: "Folder"})
+		w.WriteList(&imap.ListData{Delim: '/', Mailbox: "Shared"})
+		return nil
+	}
+	ctx, out := newTestCommandContextWithOutput(t, `"" "*" RETURN (MYRIGHTS)`, sess)
+	if err := h.Handle(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		`* LIST () "/" INBOX`,
+		`* MYRIGHTS INBOX lrswi`,
+		`* LIST () "/" Archive`,
+		`* MYRIGHTS Archive lr`,
+		`* LIST (\Noselect) "/" Folder`,
+		`* LIST () "/" Shared`,
+		`A001 OK LIST completed`,
+	}
+	if got := out.Lines(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
 func TestListExtended_EmptySelectionOptions(t *testing.T) {
 	ext := New()
 	h := ext.WrapHandler("LIST", dummyHandler).(server.CommandHandlerFunc)
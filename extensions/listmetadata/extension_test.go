@@ -1,99 +1,24 @@
 package listmetadata
 
 import (
-	"bytes"
-	"context"
-	"net"
 	"strings"
 	"testing"
 
 	imap "github.com/meszmate/imap-go"
 	"github.com/meszmate/imap-go/extensions/listextended"
+	"github.com/meszmate/imap-go/imaptest"
 	"github.com/meszmate/imap-go/imaptest/mock"
 	"github.com/meszmate/imap-go/server"
-	"github.com/meszmate/imap-go/wire"
 )
 
 func newTestCommandContext(t *testing.T, args string, sess server.Session) *server.CommandContext {
 	t.Helper()
-
-	clientConn, serverConn := net.Pipe()
-	t.Cleanup(func() {
-		_ = clientConn.Close()
-		_ = serverConn.Close()
-	})
-
-	conn := server.NewTestConn(serverConn, nil)
-
-	go func() {
-		buf := make([]byte, 4096)
-		for {
-			_, err := clientConn.Read(buf)
-			if err != nil {
-				return
-			}
-		}
-	}()
-
-	var dec *wire.Decoder
-	if args != "" {
-		dec = wire.NewDecoder(strings.NewReader(args))
-	}
-
-	return &server.CommandContext{
-		Context: context.Background(),
-		Tag:     "A001",
-		Name:    "LIST",
-		NumKind: server.NumKindSeq,
-		Conn:    conn,
-		Session: sess,
-		Decoder: dec,
-	}
+	return imaptest.NewCommandContext(t, "LIST", args, sess)
 }
 
-func newTestCommandContextWithOutput(t *testing.T, args string, sess server.Session) (*server.CommandContext, *bytes.Buffer, chan struct{}) {
+func newTestCommandContextWithOutput(t *testing.T, args string, sess server.Session) (*server.CommandContext, *imaptest.Output) {
 	t.Helper()
-
-	clientConn, serverConn := net.Pipe()
-	t.Cleanup(func() {
-		_ = clientConn.Close()
-		_ = serverConn.Close()
-	})
-
-	conn := server.NewTestConn(serverConn, nil)
-
-	var outBuf bytes.Buffer
-	done := make(chan struct{})
-	go func() {
-		defer close(done)
-		buf := make([]byte, 8192)
-		for {
-			n, err := clientConn.Read(buf)
-			if n > 0 {
-				outBuf.Write(buf[:n])
-			}
-			if err != nil {
-				return
-			}
-		}
-	}()
-
-	var dec *wire.Decoder
-	if args != "" {
-		dec = wire.NewDecoder(strings.NewReader(args))
-	}
-
-	ctx := &server.CommandContext{
-		Context: context.Background(),
-		Tag:     "A001",
-		Name:    "LIST",
-		NumKind: server.NumKindSeq,
-		Conn:    conn,
-		Session: sess,
-		Decoder: dec,
-	}
-
-	return ctx, &outBuf, done
+	return imaptest.CaptureOutput(t, "LIST", args, sess)
 }
 
 var dummyHandler = server.CommandHandlerFunc(func(ctx *server.CommandContext) error {
@@ -230,15 +155,12 @@ func TestReturnMetadata_WriteMetadataResponse(t *testing.T) {
 		},
 	}
 
-	ctx, outBuf, done := newTestCommandContextWithOutput(t, `"" "*" RETURN (METADATA ("/shared/comment"))`, sess)
+	ctx, outBuf := newTestCommandContextWithOutput(t, `"" "*" RETURN (METADATA ("/shared/comment"))`, sess)
 
 	if err := h.Handle(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	output := outBuf.String()
 	if !strings.Contains(output, "* LIST") {
 		t.Errorf("response should contain LIST, got: %s", output)
@@ -2,9 +2,19 @@
 //
 // LIST-MYRIGHTS adds the MYRIGHTS return option to the LIST command,
 // allowing clients to retrieve their access rights for each listed mailbox
-// in a single operation. The core LIST command already handles the MYRIGHTS
-// return option via ListOptions.ReturnMyRights; this extension advertises
-// the capability and exposes a session interface.
+// in a single operation. The extended LIST command of the listextended
+// extension parses the option into ListOptions.ReturnMyRights and writes a
+// MYRIGHTS response following the LIST response of each mailbox:
+//
+//	C: A1 LIST "" "%" RETURN (MYRIGHTS)
+//	S: * LIST () "/" INBOX
+//	S: * MYRIGHTS INBOX lrswipkxtea
+//	S: A1 OK LIST completed
+//
+// The rights are those of ListData.MyRights. Sessions that leave it empty
+// but implement the MYRIGHTS command of the acl extension get the rights
+// it returns. This extension advertises the capability and exposes a
+// session interface.
 package listmyrights
 
 import (
@@ -14,8 +24,9 @@ import (
 )
 
 // SessionListMyRights is an optional interface for sessions that support
-// the LIST-MYRIGHTS extension. Backends implementing this interface can
-// return MYRIGHTS data alongside LIST responses.
+// the LIST-MYRIGHTS extension. If implemented, it is called instead of List
+// for LIST commands with the MYRIGHTS return option, so that backends can
+// look up the rights of all mailboxes at once and set ListData.MyRights.
 type SessionListMyRights interface {
 	ListMyRights(w *server.ListWriter, ref string, patterns []string, options *imap.ListOptions) error
 }
@@ -23,8 +34,7 @@ type SessionListMyRights interface {
 // Extension implements the LIST-MYRIGHTS IMAP extension (RFC 8440).
 // LIST-MYRIGHTS adds the MYRIGHTS return option to the LIST command,
 // allowing clients to retrieve their access rights for each listed
-// mailbox. The core LIST command already handles this via ListOptions;
-// this extension advertises the capability and exposes a session interface.
+// mailbox. It depends on the ACL and LIST-EXTENDED extensions.
 type Extension struct {
 	extension.BaseExtension
 }
@@ -37,6 +47,7 @@ func New() *Extension {
 		BaseExtension: extension.BaseExtension{
 			ExtName:         "LIST-MYRIGHTS",
 			ExtCapabilities: []imap.Cap{imap.CapListMyRights},
+			ExtDependencies: []string{"ACL", "LIST-EXTENDED"},
 		},
 	}
 }
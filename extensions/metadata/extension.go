@@ -126,7 +126,7 @@ func handleGetMetadata(ctx *server.CommandContext) error {
 	}
 
 	// Read mailbox name
-	mailbox, err := dec.ReadAString()
+	mailbox, err := dec.ReadMailbox()
 	if err != nil {
 		ctx.Conn.WriteBAD(ctx.Tag, "Expected mailbox name")
 		return nil
@@ -166,6 +166,13 @@ func handleGetMetadata(ctx *server.CommandContext) error {
 		entries = append(entries, entry)
 	}
 
+	// The empty mailbox name is the server's metadata.
+	if mailbox != "" {
+		if err := ctx.Conn.CheckMailboxAccess(mailbox); err != nil {
+			return err
+		}
+	}
+
 	data, err := sess.GetMetadata(mailbox, entries, options)
 	if err != nil {
 		ctx.Conn.WriteNO(ctx.Tag, fmt.Sprintf("GETMETADATA failed: %v", err))
@@ -214,7 +221,7 @@ func handleSetMetadata(ctx *server.CommandContext) error {
 
 	dec := ctx.Decoder
 
-	mailbox, err := dec.ReadAString()
+	mailbox, err := dec.ReadMailbox()
 	if err != nil {
 		ctx.Conn.WriteBAD(ctx.Tag, "Expected mailbox name")
 		return nil
@@ -253,6 +260,13 @@ func handleSetMetadata(ctx *server.CommandContext) error {
 		return nil
 	}
 
+	// The empty mailbox name is the server's metadata.
+	if mailbox != "" {
+		if err := ctx.Conn.CheckMailboxAccess(mailbox); err != nil {
+			return err
+		}
+	}
+
 	if err := sess.SetMetadata(mailbox, entries); err != nil {
 		ctx.Conn.WriteNO(ctx.Tag, fmt.Sprintf("SETMETADATA failed: %v", err))
 		return nil
@@ -52,41 +52,40 @@ func handleMove() server.CommandHandlerFunc {
 		}
 
 		// Read the message set (sequence set or UID set)
-		setStr, err := ctx.Decoder.ReadAtom()
+		numSet, err := server.ParseNumSet(ctx)
 		if err != nil {
-			return imap.ErrBad("invalid message set")
-		}
-
-		var numSet imap.NumSet
-		if ctx.NumKind == server.NumKindUID {
-			uidSet, err := imap.ParseUIDSet(setStr)
-			if err != nil {
-				return imap.ErrBad("invalid UID set")
-			}
-			numSet = uidSet
-		} else {
-			seqSet, err := imap.ParseSeqSet(setStr)
-			if err != nil {
-				return imap.ErrBad("invalid sequence set")
-			}
-			numSet = seqSet
+			return err
 		}
 
 		if err := ctx.Decoder.ReadSP(); err != nil {
 			return imap.ErrBad("missing destination mailbox")
 		}
 
-		dest, err := ctx.Decoder.ReadAString()
+		dest, err := ctx.Decoder.ReadMailbox()
 		if err != nil {
 			return imap.ErrBad("invalid destination mailbox")
 		}
 
-		// The session must implement SessionMove
+		dest = imap.CanonicalMailboxName(dest)
+
+		// The session must implement SessionMove, or SessionTransaction
+		// for MOVE to be run as COPY, STORE and EXPUNGE.
 		sessMove, ok := ctx.Session.(server.SessionMove)
-		if !ok {
+		if _, tx := ctx.Session.(server.SessionTransaction); !ok && !tx {
 			return imap.ErrNo("MOVE not supported")
 		}
 
+		if err := ctx.Conn.CheckMailboxAccess(dest); err != nil {
+			return err
+		}
+		if !ok {
+			if err := moveInTransaction(ctx, numSet, dest); err != nil {
+				return err
+			}
+			ctx.Conn.WriteOK(ctx.Tag, "MOVE completed")
+			return nil
+		}
+
 		w := server.NewMoveWriter(ctx.Conn.Encoder())
 		if err := sessMove.Move(w, numSet, dest); err != nil {
 			return err
@@ -101,3 +100,46 @@ func handleMove() server.CommandHandlerFunc {
 		return nil
 	}
 }
+
+// moveInTransaction moves messages for sessions that do not implement
+// server.SessionMove but server.SessionTransaction: the messages are
+// copied, flagged \Deleted and expunged in one transaction, so that either
+// all steps take effect or none does. Only the moved messages are
+// expunged. The COPYUID response code is sent in an untagged OK response
+// before the EXPUNGE responses, as RFC 6851 section 4.3 requires.
+func moveInTransaction(ctx *server.CommandContext, numSet imap.NumSet, dest string) error {
+	return ctx.InTransaction(func() error {
+		criteria := &imap.SearchCriteria{}
+		switch set := numSet.(type) {
+		case *imap.UIDSet:
+			criteria.UID = set
+		case *imap.SeqSet:
+			criteria.SeqNum = set
+		}
+		found, err := ctx.Session.Search(server.NumKindUID, criteria, nil)
+		if err != nil {
+			return err
+		}
+		if len(found.AllUIDs) == 0 {
+			return nil
+		}
+		uids := &imap.UIDSet{}
+		uids.AddNum(found.AllUIDs...)
+
+		data, err := ctx.Session.Copy(uids, dest)
+		if err != nil {
+			return err
+		}
+		if data != nil && data.UIDValidity > 0 {
+			data.Normalize()
+			ctx.Conn.WriteOKCode("*", imap.ResponseCodeCopyUID, "Moving messages",
+				data.UIDValidity, &data.SourceUIDs, &data.DestUIDs)
+		}
+
+		deleted := &imap.StoreFlags{Action: imap.StoreFlagsAdd, Silent: true, Flags: []imap.Flag{imap.FlagDeleted}}
+		if err := ctx.Session.Store(server.NewFetchWriter(ctx.Conn.Encoder()), uids, deleted, &imap.StoreOptions{}); err != nil {
+			return err
+		}
+		return ctx.Session.Expunge(server.NewExpungeWriter(ctx.Conn.Encoder()), uids)
+	})
+}
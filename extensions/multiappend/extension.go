@@ -108,7 +108,7 @@ func handleMultiAppend(ctx *server.CommandContext, original server.CommandHandle
 	dec := ctx.Decoder
 
 	// Read mailbox name
-	mailbox, err := dec.ReadAString()
+	mailbox, err := dec.ReadMailbox()
 	if err != nil {
 		return imap.ErrBad("invalid mailbox name")
 	}
@@ -132,7 +132,7 @@ func handleMultiAppend(ctx *server.CommandContext, original server.CommandHandle
 	// Read first literal body from connection decoder
 	connDec := ctx.Conn.Decoder()
 	var firstBody bytes.Buffer
-	if _, err := io.Copy(&firstBody, io.LimitReader(connDec.ReadLiteral(litSize), litSize)); err != nil {
+	if _, err := io.Copy(&firstBody, io.LimitReader(ctx.Conn.ReadLiteral(ctx.Name, litSize), litSize)); err != nil {
 		return imap.ErrBad(fmt.Sprintf("error reading literal: %v", err))
 	}
 
@@ -153,7 +153,7 @@ func handleMultiAppend(ctx *server.CommandContext, original server.CommandHandle
 			Size:   int64(firstBody.Len()),
 		}
 
-		data, err := ctx.Session.Append(mailbox, literalReader, options)
+		data, err := ctx.AppendMessage(mailbox, literalReader, options)
 		if err != nil {
 			return err
 		}
@@ -193,7 +193,7 @@ func handleMultiAppend(ctx *server.CommandContext, original server.CommandHandle
 
 		// Read literal body
 		var body bytes.Buffer
-		if _, err := io.Copy(&body, io.LimitReader(connDec.ReadLiteral(litInfo.Size), litInfo.Size)); err != nil {
+		if _, err := io.Copy(&body, io.LimitReader(ctx.Conn.ReadLiteral(ctx.Name, litInfo.Size), litInfo.Size)); err != nil {
 			return imap.ErrBad(fmt.Sprintf("error reading literal: %v", err))
 		}
 
@@ -213,14 +213,41 @@ func handleMultiAppend(ctx *server.CommandContext, original server.CommandHandle
 		}
 	}
 
-	// Check session implements SessionMultiAppend
-	sess, ok := ctx.Session.(SessionMultiAppend)
-	if !ok {
+	// Sessions implementing SessionMultiAppend append the messages
+	// atomically; those implementing server.SessionTransaction append
+	// them one by one in a transaction.
+	var results []*imap.AppendData
+	if sess, ok := ctx.Session.(SessionMultiAppend); ok {
+		if err := ctx.Conn.CheckMailboxAccess(mailbox); err != nil {
+			return err
+		}
+		for i := range messages {
+			body, err := io.ReadAll(messages[i].Literal.Reader)
+			if err != nil {
+				return err
+			}
+			if body, err = ctx.Conn.FilterAppend(mailbox, body); err != nil {
+				return err
+			}
+			messages[i].Literal = imap.LiteralReader{Reader: bytes.NewReader(body), Size: int64(len(body))}
+		}
+		results, err = sess.AppendMulti(mailbox, messages)
+	} else if _, ok := ctx.Session.(server.SessionTransaction); ok {
+		err = ctx.InTransaction(func() error {
+			for _, msg := range messages {
+				options := &imap.AppendOptions{Flags: msg.Flags, InternalDate: msg.InternalDate}
+				data, err := ctx.AppendMessage(mailbox, msg.Literal, options)
+				if err != nil {
+					return err
+				}
+				results = append(results, data)
+			}
+			return nil
+		})
+	} else {
 		ctx.Conn.WriteNO(ctx.Tag, "MULTIAPPEND not supported by backend")
 		return nil
 	}
-
-	results, err := sess.AppendMulti(mailbox, messages)
 	if err != nil {
 		return err
 	}
@@ -332,9 +359,8 @@ func parseDate(s string) (time.Time, error) {
 // optionally with APPENDUID.
 func writeAppendOK(ctx *server.CommandContext, data *imap.AppendData) {
 	if data != nil && data.UIDValidity > 0 && data.UID > 0 {
-		ctx.Conn.WriteOKCode(ctx.Tag,
-			fmt.Sprintf("APPENDUID %d %d", data.UIDValidity, uint32(data.UID)),
-			"APPEND completed")
+		ctx.Conn.WriteOKCode(ctx.Tag, imap.ResponseCodeAppendUID, "APPEND completed",
+			data.UIDValidity, data.UID)
 	} else {
 		ctx.Conn.WriteOK(ctx.Tag, "APPEND completed")
 	}
@@ -344,19 +370,21 @@ func writeAppendOK(ctx *server.CommandContext, data *imap.AppendData) {
 // with APPENDUID containing a comma-separated list of UIDs.
 func writeMultiAppendOK(ctx *server.CommandContext, results []*imap.AppendData) {
 	if len(results) > 0 && results[0] != nil && results[0].UIDValidity > 0 {
-		var uids []string
+		// UIDs are assigned in ascending order, so normalizing the set
+		// keeps them in the order the messages were appended.
+		uids := &imap.UIDSet{}
 		allValid := true
 		for _, r := range results {
 			if r == nil || r.UID == 0 {
 				allValid = false
 				break
 			}
-			uids = append(uids, fmt.Sprintf("%d", uint32(r.UID)))
+			uids.AddNum(r.UID)
 		}
 		if allValid {
-			ctx.Conn.WriteOKCode(ctx.Tag,
-				fmt.Sprintf("APPENDUID %d %s", results[0].UIDValidity, strings.Join(uids, ",")),
-				"APPEND completed")
+			uids.Normalize()
+			ctx.Conn.WriteOKCode(ctx.Tag, imap.ResponseCodeAppendUID, "APPEND completed",
+				results[0].UIDValidity, uids)
 			return
 		}
 	}
@@ -583,8 +583,8 @@ func TestMultiAppend_APPENDUID_Response(t *testing.T) {
 	<-done
 
 	output := outBuf.String()
-	if !strings.Contains(output, "APPENDUID 42 100,101") {
-		t.Errorf("response should contain APPENDUID 42 100,101, got: %s", output)
+	if !strings.Contains(output, "APPENDUID 42 100:101") {
+		t.Errorf("response should contain APPENDUID 42 100:101, got: %s", output)
 	}
 }
 
@@ -803,8 +803,8 @@ func TestWriteMultiAppendOK_AllValid(t *testing.T) {
 	<-done
 
 	output := outBuf.String()
-	if !strings.Contains(output, "APPENDUID 42 100,101,102") {
-		t.Errorf("response should contain APPENDUID 42 100,101,102, got: %s", output)
+	if !strings.Contains(output, "APPENDUID 42 100:102") {
+		t.Errorf("response should contain APPENDUID 42 100:102, got: %s", output)
 	}
 }
 
@@ -11,7 +11,6 @@ import (
 
 	imap "github.com/meszmate/imap-go"
 	"github.com/meszmate/imap-go/extension"
-	"github.com/meszmate/imap-go/extensions/esearch"
 	"github.com/meszmate/imap-go/server"
 	"github.com/meszmate/imap-go/wire"
 )
@@ -120,7 +119,7 @@ func handleMultiSearch(ctx *server.CommandContext) error {
 	if b == '(' {
 		// Parenthesized list of mailboxes
 		if err := dec.ReadList(func() error {
-			mbox, err := dec.ReadAString()
+			mbox, err := dec.ReadMailbox()
 			if err != nil {
 				return err
 			}
@@ -131,7 +130,7 @@ func handleMultiSearch(ctx *server.CommandContext) error {
 		}
 	} else {
 		// Single mailbox
-		mbox, err := dec.ReadAString()
+		mbox, err := dec.ReadMailbox()
 		if err != nil {
 			return imap.ErrBad("invalid mailbox name: " + err.Error())
 		}
@@ -144,7 +143,6 @@ func handleMultiSearch(ctx *server.CommandContext) error {
 	}
 
 	options := &imap.SearchOptions{}
-	criteria := &imap.SearchCriteria{}
 
 	// Parse remaining arguments: optional RETURN, optional CHARSET, then search criteria
 	if err := dec.ReadSP(); err != nil {
@@ -152,55 +150,27 @@ func handleMultiSearch(ctx *server.CommandContext) error {
 	}
 
 	// Read next atom to check for RETURN or CHARSET or search criterion
-	atom, err := dec.ReadAtom()
+	atom, err := server.ReadSearchToken(dec)
 	if err != nil {
-		return imap.ErrBad("missing search arguments")
+		return err
 	}
 
 	if strings.EqualFold(atom, "RETURN") {
 		if err := dec.ReadSP(); err != nil {
 			return imap.ErrBad("missing RETURN options")
 		}
-		if err := parseReturnOptions(dec, options); err != nil {
+		if err := server.ParseSearchReturnOptions(dec, options); err != nil {
 			return err
 		}
 		if err := dec.ReadSP(); err != nil {
 			return imap.ErrBad("missing search criteria after RETURN")
 		}
-		// Read next atom for CHARSET check or search criterion
-		atom, err = dec.ReadAtom()
-		if err != nil {
-			return imap.ErrBad("missing search criteria")
-		}
-	}
-
-	if strings.EqualFold(atom, "CHARSET") {
-		if err := dec.ReadSP(); err != nil {
-			return imap.ErrBad("missing charset name")
-		}
-		// Consume charset name (pass through to backend)
-		if _, err := dec.ReadAString(); err != nil {
-			return imap.ErrBad("invalid charset name")
-		}
-		if err := dec.ReadSP(); err != nil {
-			return imap.ErrBad("missing search criteria after CHARSET")
-		}
-		// Read first search criterion
-		atom, err = dec.ReadAtom()
-		if err != nil {
-			return imap.ErrBad("missing search criteria")
-		}
+		atom = ""
 	}
 
-	// Parse the first search criterion we already read
-	if err := esearch.ParseSearchCriterion(atom, dec, criteria); err != nil {
-		return imap.ErrBad("invalid search criteria: " + err.Error())
-	}
-	// Parse remaining search criteria
-	if err := dec.ReadSP(); err == nil {
-		if err := esearch.ParseSearchCriteria(dec, criteria); err != nil {
-			return imap.ErrBad("invalid search criteria: " + err.Error())
-		}
+	criteria, err := server.ParseSearchFrom(atom, dec)
+	if err != nil {
+		return err
 	}
 
 	// Route to session
@@ -209,11 +179,27 @@ func handleMultiSearch(ctx *server.CommandContext) error {
 		return imap.ErrNo("MULTISEARCH not supported")
 	}
 
+	for _, mbox := range source.Mailboxes {
+		if err := ctx.Conn.CheckMailboxAccess(mbox); err != nil {
+			return err
+		}
+	}
+
 	results, err := sess.MultiSearch(ctx.NumKind, source, criteria, options)
 	if err != nil {
 		return err
 	}
 
+	// Subtree filters reach mailboxes that were not named; leave out
+	// those the user may not access, as LIST does.
+	allowed := results[:0]
+	for _, result := range results {
+		if ctx.Conn.CheckMailboxAccess(result.Mailbox) == nil {
+			allowed = append(allowed, result)
+		}
+	}
+	results = allowed
+
 	// Write per-mailbox ESEARCH responses
 	writeMultiSearchResponse(ctx, results, options)
 
@@ -221,59 +207,6 @@ func handleMultiSearch(ctx *server.CommandContext) error {
 	return nil
 }
 
-// parseReturnOptions parses a parenthesized list of RETURN options.
-func parseReturnOptions(dec *wire.Decoder, options *imap.SearchOptions) error {
-	if err := dec.ExpectByte('('); err != nil {
-		return imap.ErrBad("expected '(' for RETURN options")
-	}
-
-	b, err := dec.PeekByte()
-	if err != nil {
-		return imap.ErrBad("unexpected end in RETURN options")
-	}
-	if b == ')' {
-		if err := dec.ExpectByte(')'); err != nil {
-			return imap.ErrBad("expected ')' for RETURN options")
-		}
-		return nil
-	}
-
-	for {
-		atom, err := dec.ReadAtom()
-		if err != nil {
-			return imap.ErrBad("invalid RETURN option")
-		}
-		switch strings.ToUpper(atom) {
-		case "MIN":
-			options.ReturnMin = true
-		case "MAX":
-			options.ReturnMax = true
-		case "ALL":
-			options.ReturnAll = true
-		case "COUNT":
-			options.ReturnCount = true
-		case "SAVE":
-			options.ReturnSave = true
-		default:
-			return imap.ErrBad("unknown RETURN option: " + atom)
-		}
-
-		b, err := dec.PeekByte()
-		if err != nil {
-			return imap.ErrBad("unexpected end in RETURN options")
-		}
-		if b == ')' {
-			if err := dec.ExpectByte(')'); err != nil {
-				return imap.ErrBad("expected ')' for RETURN options")
-			}
-			return nil
-		}
-		if err := dec.ReadSP(); err != nil {
-			return imap.ErrBad("expected SP between RETURN options")
-		}
-	}
-}
-
 // writeMultiSearchResponse writes one ESEARCH response per mailbox result.
 func writeMultiSearchResponse(ctx *server.CommandContext, results []imap.MultiSearchResult, options *imap.SearchOptions) {
 	enc := ctx.Conn.Encoder()
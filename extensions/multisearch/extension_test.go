@@ -1,13 +1,13 @@
 package multisearch
 
 import (
-	"bytes"
 	"context"
 	"net"
 	"strings"
 	"testing"
 
 	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/imaptest"
 	"github.com/meszmate/imap-go/imaptest/mock"
 	"github.com/meszmate/imap-go/server"
 	"github.com/meszmate/imap-go/wire"
@@ -41,87 +41,16 @@ var _ SessionMultiSearch = (*multiSearchMockSession)(nil)
 
 func newTestCommandContext(t *testing.T, args string, sess server.Session) *server.CommandContext {
 	t.Helper()
-
-	clientConn, serverConn := net.Pipe()
-	t.Cleanup(func() {
-		_ = clientConn.Close()
-		_ = serverConn.Close()
-	})
-
-	conn := server.NewTestConn(serverConn, nil)
-	_ = conn.SetState(imap.ConnStateAuthenticated)
-
-	// Drain output to prevent blocking
-	go func() {
-		buf := make([]byte, 4096)
-		for {
-			_, err := clientConn.Read(buf)
-			if err != nil {
-				return
-			}
-		}
-	}()
-
-	var dec *wire.Decoder
-	if args != "" {
-		dec = wire.NewDecoder(strings.NewReader(args))
-	}
-
-	return &server.CommandContext{
-		Context: context.Background(),
-		Tag:     "A001",
-		Name:    "ESEARCH",
-		NumKind: server.NumKindSeq,
-		Conn:    conn,
-		Session: sess,
-		Decoder: dec,
-	}
+	ctx := imaptest.NewCommandContext(t, "ESEARCH", args, sess)
+	_ = ctx.Conn.SetState(imap.ConnStateAuthenticated)
+	return ctx
 }
 
-func newTestCommandContextWithOutput(t *testing.T, args string, sess server.Session) (*server.CommandContext, *bytes.Buffer, chan struct{}) {
+func newTestCommandContextWithOutput(t *testing.T, args string, sess server.Session) (*server.CommandContext, *imaptest.Output) {
 	t.Helper()
-
-	clientConn, serverConn := net.Pipe()
-	t.Cleanup(func() {
-		_ = clientConn.Close()
-		_ = serverConn.Close()
-	})
-
-	conn := server.NewTestConn(serverConn, nil)
-	_ = conn.SetState(imap.ConnStateAuthenticated)
-
-	var outBuf bytes.Buffer
-	done := make(chan struct{})
-	go func() {
-		defer close(done)
-		buf := make([]byte, 8192)
-		for {
-			n, err := clientConn.Read(buf)
-			if n > 0 {
-				outBuf.Write(buf[:n])
-			}
-			if err != nil {
-				return
-			}
-		}
-	}()
-
-	var dec *wire.Decoder
-	if args != "" {
-		dec = wire.NewDecoder(strings.NewReader(args))
-	}
-
-	ctx := &server.CommandContext{
-		Context: context.Background(),
-		Tag:     "A001",
-		Name:    "ESEARCH",
-		NumKind: server.NumKindSeq,
-		Conn:    conn,
-		Session: sess,
-		Decoder: dec,
-	}
-
-	return ctx, &outBuf, done
+	ctx, out := imaptest.CaptureOutput(t, "ESEARCH", args, sess)
+	_ = ctx.Conn.SetState(imap.ConnStateAuthenticated)
+	return ctx, out
 }
 
 func TestNew(t *testing.T) {
@@ -315,15 +244,12 @@ func TestMultiSearch_ResponseFormat(t *testing.T) {
 			{Mailbox: "INBOX", UIDValidity: 67890, Data: &imap.SearchData{Min: 1, Max: 42, Count: 5}},
 		},
 	}
-	ctx, outBuf, done := newTestCommandContextWithOutput(t, `IN (mailboxes INBOX) RETURN (MIN MAX COUNT) ALL`, sess)
+	ctx, outBuf := newTestCommandContextWithOutput(t, `IN (mailboxes INBOX) RETURN (MIN MAX COUNT) ALL`, sess)
 
 	if err := handleMultiSearch(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	output := outBuf.String()
 	if !strings.Contains(output, "ESEARCH") {
 		t.Errorf("response should contain ESEARCH, got: %s", output)
@@ -358,15 +284,12 @@ func TestMultiSearch_MultipleMailboxResponses(t *testing.T) {
 			{Mailbox: "Sent", UIDValidity: 200, Data: &imap.SearchData{Count: 1}},
 		},
 	}
-	ctx, outBuf, done := newTestCommandContextWithOutput(t, `IN (mailboxes (INBOX Sent)) RETURN (COUNT) ALL`, sess)
+	ctx, outBuf := newTestCommandContextWithOutput(t, `IN (mailboxes (INBOX Sent)) RETURN (COUNT) ALL`, sess)
 
 	if err := handleMultiSearch(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	output := outBuf.String()
 	// Should have two ESEARCH responses
 	count := strings.Count(output, "* ESEARCH")
@@ -446,15 +369,12 @@ func TestMultiSearch_EmptyReturn(t *testing.T) {
 			{Mailbox: "INBOX", UIDValidity: 1, Data: &imap.SearchData{Count: 3}},
 		},
 	}
-	ctx, outBuf, done := newTestCommandContextWithOutput(t, `IN (mailboxes INBOX) RETURN () ALL`, sess)
+	ctx, outBuf := newTestCommandContextWithOutput(t, `IN (mailboxes INBOX) RETURN () ALL`, sess)
 
 	if err := handleMultiSearch(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	// Should produce ESEARCH response with no result items (just TAG, MAILBOX, UIDVALIDITY, UID)
 	output := outBuf.String()
 	if !strings.Contains(output, "ESEARCH") {
@@ -583,15 +503,12 @@ func TestMultiSearch_ModSeqInResponse(t *testing.T) {
 			{Mailbox: "INBOX", UIDValidity: 1, Data: &imap.SearchData{Min: 1, Count: 2, ModSeq: 99999}},
 		},
 	}
-	ctx, outBuf, done := newTestCommandContextWithOutput(t, `IN (mailboxes INBOX) RETURN (MIN COUNT) ALL`, sess)
+	ctx, outBuf := newTestCommandContextWithOutput(t, `IN (mailboxes INBOX) RETURN (MIN COUNT) ALL`, sess)
 
 	if err := handleMultiSearch(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	output := outBuf.String()
 	if !strings.Contains(output, "MODSEQ 99999") {
 		t.Errorf("response should contain MODSEQ, got: %s", output)
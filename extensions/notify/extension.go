@@ -82,6 +82,18 @@ func (e *Extension) OnEnabled(connID string) error {
 	return nil
 }
 
+// mailboxFilters are the mailbox filter keywords of NOTIFY, which name no
+// single mailbox.
+var mailboxFilters = map[string]bool{
+	"SELECTED":         true,
+	"SELECTED-DELAYED": true,
+	"INBOXES":          true,
+	"PERSONAL":         true,
+	"SUBSCRIBED":       true,
+	"SUBTREE":          true,
+	"MAILBOXES":        true,
+}
+
 // handleNotify handles the NOTIFY command.
 //
 // Command syntax:
@@ -136,7 +148,7 @@ func handleNotify(ctx *server.CommandContext) error {
 			}
 
 			// Read mailbox filter (atom or quoted string)
-			mailbox, err := ctx.Decoder.ReadAString()
+			mailbox, err := ctx.Decoder.ReadMailbox()
 			if err != nil {
 				break
 			}
@@ -173,6 +185,15 @@ func handleNotify(ctx *server.CommandContext) error {
 			return nil
 		}
 
+		for _, spec := range specs {
+			if mailboxFilters[strings.ToUpper(spec.Mailbox)] {
+				continue
+			}
+			if err := ctx.Conn.CheckMailboxAccess(spec.Mailbox); err != nil {
+				return err
+			}
+		}
+
 		if err := sess.Notify(specs); err != nil {
 			ctx.Conn.WriteNO(ctx.Tag, fmt.Sprintf("NOTIFY SET failed: %v", err))
 			return nil
@@ -21,6 +21,14 @@ type SessionObjectID interface {
 	ObjectIDs(uid imap.UID) (emailID string, threadID string, err error)
 }
 
+// EmailID returns an EMAILID for a raw message derived from
+// imap.MessageIdentity, so that copies of the same message share an
+// EMAILID. Backends without a persistent message store can use it instead
+// of allocating IDs.
+func EmailID(msg []byte) string {
+	return imap.ObjectIDFromIdentity(imap.MessageIdentity(msg))
+}
+
 // Extension implements the OBJECTID IMAP extension (RFC 8474).
 type Extension struct {
 	extension.BaseExtension
@@ -8,7 +8,6 @@ package partial
 
 import (
 	"fmt"
-	"strconv"
 	"strings"
 
 	imap "github.com/meszmate/imap-go"
@@ -31,7 +30,7 @@ type Extension struct {
 	extension.BaseExtension
 }
 
-var _ extension.ServerExtension = (*Extension)(nil)
+var _ extension.WrapDescriber = (*Extension)(nil)
 
 // New creates a new PARTIAL extension.
 func New() *Extension {
@@ -71,6 +70,15 @@ func (e *Extension) WrapHandler(name string, handler interface{}) interface{} {
 	return nil
 }
 
+// DescribeWrap describes the wrappers installed by WrapHandler. SEARCH is
+// handled completely and SORT when it has RETURN options.
+func (e *Extension) DescribeWrap(command string) extension.WrapInfo {
+	if command == "SORT" {
+		return extension.WrapInfo{Replaces: true, Supersedes: []string{"ESORT"}}
+	}
+	return extension.WrapInfo{Replaces: true, Supersedes: []string{"ESEARCH"}}
+}
+
 // SessionExtension returns the required session extension interface.
 func (e *Extension) SessionExtension() interface{} {
 	return (*SessionPartial)(nil)
@@ -86,13 +94,13 @@ func handlePartialSearch(ctx *server.CommandContext, _ server.CommandHandlerFunc
 	}
 
 	dec := ctx.Decoder
-	criteria := &imap.SearchCriteria{}
 	options := &imap.SearchOptions{}
 	hasReturn := false
 
-	first, err := dec.ReadAtom()
+	// Check whether the first token is "RETURN"
+	first, err := server.ReadSearchToken(dec)
 	if err != nil {
-		return imap.ErrBad("missing search criteria")
+		return err
 	}
 
 	if strings.EqualFold(first, "RETURN") {
@@ -100,24 +108,20 @@ func handlePartialSearch(ctx *server.CommandContext, _ server.CommandHandlerFunc
 		if err := dec.ReadSP(); err != nil {
 			return imap.ErrBad("missing RETURN options")
 		}
-		if err := parseReturnOptions(dec, options); err != nil {
+		if err := server.ParseSearchReturnOptions(dec, options); err != nil {
 			return err
 		}
 		if err := dec.ReadSP(); err != nil {
 			return imap.ErrBad("missing search criteria after RETURN")
 		}
-		if err := esearch.ParseSearchCriteria(dec, criteria); err != nil {
-			return imap.ErrBad("invalid search criteria: " + err.Error())
-		}
-	} else {
-		if err := esearch.ParseSearchCriterion(first, dec, criteria); err != nil {
-			return imap.ErrBad("invalid search criteria: " + err.Error())
-		}
-		if err := dec.ReadSP(); err == nil {
-			if err := esearch.ParseSearchCriteria(dec, criteria); err != nil {
-				return imap.ErrBad("invalid search criteria: " + err.Error())
-			}
-		}
+		first = ""
+	}
+	criteria, err := server.ParseSearchFrom(first, dec)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Conn.CheckSearchCriteria(criteria); err != nil {
+		return err
 	}
 
 	// Route to session
@@ -129,21 +133,26 @@ func handlePartialSearch(ctx *server.CommandContext, _ server.CommandHandlerFunc
 			} else if sess, ok := ctx.Session.(esearch.SessionESearch); ok {
 				data, err = sess.SearchExtended(ctx.NumKind, criteria, options)
 			} else {
-				data, err = ctx.Session.Search(ctx.NumKind, criteria, options)
+				data, err = server.RunSearch(ctx, criteria, options)
 			}
 		} else {
 			if sess, ok := ctx.Session.(esearch.SessionESearch); ok {
 				data, err = sess.SearchExtended(ctx.NumKind, criteria, options)
 			} else {
-				data, err = ctx.Session.Search(ctx.NumKind, criteria, options)
+				data, err = server.RunSearch(ctx, criteria, options)
 			}
 		}
 	} else {
-		data, err = ctx.Session.Search(ctx.NumKind, criteria, options)
+		data, err = server.RunSearch(ctx, criteria, options)
 	}
 	if err != nil {
 		return err
 	}
+	if !(hasReturn && hasAnyReturnOption(options)) || (options.ReturnAll && options.ReturnPartial == nil) {
+		if err := ctx.Conn.CheckSearchData(data); err != nil {
+			return err
+		}
+	}
 
 	// Write response
 	enc := ctx.Conn.Encoder()
@@ -168,7 +177,7 @@ func handlePartialSearch(ctx *server.CommandContext, _ server.CommandHandlerFunc
 		})
 	}
 
-	ctx.Conn.WriteOK(ctx.Tag, "SEARCH completed")
+	ctx.Conn.WriteSearchOK(ctx.Tag, data)
 	return nil
 }
 
@@ -203,7 +212,7 @@ func handlePartialSort(ctx *server.CommandContext, original server.CommandHandle
 		return imap.ErrBad("missing RETURN options")
 	}
 	options := &imap.SearchOptions{}
-	if err := parseReturnOptions(dec, options); err != nil {
+	if err := server.ParseSearchReturnOptions(dec, options); err != nil {
 		return err
 	}
 
@@ -211,28 +220,22 @@ func handlePartialSort(ctx *server.CommandContext, original server.CommandHandle
 	if err := dec.ReadSP(); err != nil {
 		return imap.ErrBad("missing sort criteria")
 	}
-	sortCriteria, err := parseSortCriteria(dec)
+	sortCriteria, err := server.ReadSortCriteria(ctx.Conn, dec)
 	if err != nil {
-		return imap.ErrBad("invalid sort criteria: " + err.Error())
-	}
-	if len(sortCriteria) == 0 {
-		return imap.ErrBad("empty sort criteria")
+		return err
 	}
 
-	// Read SP then charset
+	// Read SP then charset and search criteria
 	if err := dec.ReadSP(); err != nil {
 		return imap.ErrBad("expected charset")
 	}
-	if _, err := dec.ReadAtom(); err != nil {
-		return imap.ErrBad("invalid charset")
+	var parser server.SearchParser
+	searchCriteria, err := parser.ParseWithCharset(dec)
+	if err != nil {
+		return err
 	}
-
-	// Read SP then search criteria
-	searchCriteria := &imap.SearchCriteria{}
-	if err := dec.ReadSP(); err == nil {
-		if err := esearch.ParseSearchCriteria(dec, searchCriteria); err != nil {
-			return imap.ErrBad("invalid search criteria: " + err.Error())
-		}
+	if err := ctx.Conn.CheckSearchCriteria(searchCriteria); err != nil {
+		return err
 	}
 
 	// Route to session — requires SessionESort for ESEARCH-style response
@@ -245,6 +248,11 @@ func handlePartialSort(ctx *server.CommandContext, original server.CommandHandle
 	if err != nil {
 		return err
 	}
+	if options.ReturnAll && options.ReturnPartial == nil {
+		if err := ctx.Conn.CheckSearchData(data); err != nil {
+			return err
+		}
+	}
 
 	// Write ESEARCH response
 	writeESearchResponse(ctx.Conn.Encoder(), ctx, data, options)
@@ -253,100 +261,6 @@ func handlePartialSort(ctx *server.CommandContext, original server.CommandHandle
 	return nil
 }
 
-// parseReturnOptions parses a parenthesized list of RETURN options with PARTIAL support.
-func parseReturnOptions(dec *wire.Decoder, options *imap.SearchOptions) error {
-	if err := dec.ExpectByte('('); err != nil {
-		return imap.ErrBad("expected '(' for RETURN options")
-	}
-
-	b, err := dec.PeekByte()
-	if err != nil {
-		return imap.ErrBad("unexpected end in RETURN options")
-	}
-	if b == ')' {
-		if err := dec.ExpectByte(')'); err != nil {
-			return imap.ErrBad("expected ')' for RETURN options")
-		}
-		return nil
-	}
-
-	for {
-		atom, err := dec.ReadAtom()
-		if err != nil {
-			return imap.ErrBad("invalid RETURN option")
-		}
-		switch strings.ToUpper(atom) {
-		case "MIN":
-			options.ReturnMin = true
-		case "MAX":
-			options.ReturnMax = true
-		case "ALL":
-			options.ReturnAll = true
-		case "COUNT":
-			options.ReturnCount = true
-		case "SAVE":
-			options.ReturnSave = true
-		case "PARTIAL":
-			if err := dec.ReadSP(); err != nil {
-				return imap.ErrBad("missing PARTIAL range")
-			}
-			rangeAtom, err := dec.ReadAtom()
-			if err != nil {
-				return imap.ErrBad("invalid PARTIAL range")
-			}
-			offset, count, err := parsePartialRange(rangeAtom)
-			if err != nil {
-				return imap.ErrBad("invalid PARTIAL range: " + err.Error())
-			}
-			options.ReturnPartial = &imap.SearchReturnPartial{Offset: offset, Count: count}
-		default:
-			return imap.ErrBad("unknown RETURN option: " + atom)
-		}
-
-		b, err := dec.PeekByte()
-		if err != nil {
-			return imap.ErrBad("unexpected end in RETURN options")
-		}
-		if b == ')' {
-			if err := dec.ExpectByte(')'); err != nil {
-				return imap.ErrBad("expected ')' for RETURN options")
-			}
-			return nil
-		}
-		if err := dec.ReadSP(); err != nil {
-			return imap.ErrBad("expected SP between RETURN options")
-		}
-	}
-}
-
-// parsePartialRange parses a PARTIAL range like "1:100" or "-1:100".
-func parsePartialRange(s string) (int32, uint32, error) {
-	idx := strings.LastIndex(s, ":")
-	if idx < 0 {
-		return 0, 0, fmt.Errorf("missing ':' separator")
-	}
-	offsetStr := s[:idx]
-	countStr := s[idx+1:]
-
-	offset64, err := strconv.ParseInt(offsetStr, 10, 32)
-	if err != nil {
-		return 0, 0, fmt.Errorf("invalid offset: %s", offsetStr)
-	}
-	if offset64 == 0 {
-		return 0, 0, fmt.Errorf("offset must not be zero")
-	}
-
-	count64, err := strconv.ParseUint(countStr, 10, 32)
-	if err != nil {
-		return 0, 0, fmt.Errorf("invalid count: %s", countStr)
-	}
-	if count64 == 0 {
-		return 0, 0, fmt.Errorf("count must be positive")
-	}
-
-	return int32(offset64), uint32(count64), nil
-}
-
 // hasAnyReturnOption returns true if any RETURN option is set.
 func hasAnyReturnOption(options *imap.SearchOptions) bool {
 	return options.ReturnMin || options.ReturnMax || options.ReturnAll ||
@@ -403,35 +317,3 @@ func writeESearchResponse(enc *server.ResponseEncoder, ctx *server.CommandContex
 		e.CRLF()
 	})
 }
-
-// parseSortCriteria reads a parenthesized list of sort criteria.
-func parseSortCriteria(dec *wire.Decoder) ([]imap.SortCriterion, error) {
-	var criteria []imap.SortCriterion
-	if err := dec.ReadList(func() error {
-		atom, err := dec.ReadAtom()
-		if err != nil {
-			return err
-		}
-
-		var criterion imap.SortCriterion
-		upper := strings.ToUpper(atom)
-		if upper == "REVERSE" {
-			criterion.Reverse = true
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			keyAtom, err := dec.ReadAtom()
-			if err != nil {
-				return err
-			}
-			criterion.Key = imap.SortKey(strings.ToUpper(keyAtom))
-		} else {
-			criterion.Key = imap.SortKey(upper)
-		}
-		criteria = append(criteria, criterion)
-		return nil
-	}); err != nil {
-		return nil, err
-	}
-	return criteria, nil
-}
@@ -223,8 +223,8 @@ func TestOnEnabled(t *testing.T) {
 func TestParseReturnOptions_Partial(t *testing.T) {
 	dec := wire.NewDecoder(strings.NewReader("(PARTIAL 1:100)"))
 	opts := &imap.SearchOptions{}
-	if err := parseReturnOptions(dec, opts); err != nil {
-		t.Fatalf("parseReturnOptions() error: %v", err)
+	if err := server.ParseSearchReturnOptions(dec, opts); err != nil {
+		t.Fatalf("ParseSearchReturnOptions() error: %v", err)
 	}
 	if opts.ReturnPartial == nil {
 		t.Fatal("ReturnPartial should not be nil")
@@ -240,8 +240,8 @@ func TestParseReturnOptions_Partial(t *testing.T) {
 func TestParseReturnOptions_PartialWithOtherOptions(t *testing.T) {
 	dec := wire.NewDecoder(strings.NewReader("(PARTIAL 1:50 COUNT)"))
 	opts := &imap.SearchOptions{}
-	if err := parseReturnOptions(dec, opts); err != nil {
-		t.Fatalf("parseReturnOptions() error: %v", err)
+	if err := server.ParseSearchReturnOptions(dec, opts); err != nil {
+		t.Fatalf("ParseSearchReturnOptions() error: %v", err)
 	}
 	if opts.ReturnPartial == nil {
 		t.Fatal("ReturnPartial should not be nil")
@@ -257,8 +257,8 @@ func TestParseReturnOptions_PartialWithOtherOptions(t *testing.T) {
 func TestParseReturnOptions_Empty(t *testing.T) {
 	dec := wire.NewDecoder(strings.NewReader("()"))
 	opts := &imap.SearchOptions{}
-	if err := parseReturnOptions(dec, opts); err != nil {
-		t.Fatalf("parseReturnOptions() error: %v", err)
+	if err := server.ParseSearchReturnOptions(dec, opts); err != nil {
+		t.Fatalf("ParseSearchReturnOptions() error: %v", err)
 	}
 	if opts.ReturnMin || opts.ReturnMax || opts.ReturnAll || opts.ReturnCount || opts.ReturnSave || opts.ReturnPartial != nil {
 		t.Error("empty () should have no options set")
@@ -268,8 +268,8 @@ func TestParseReturnOptions_Empty(t *testing.T) {
 func TestParseReturnOptions_StandardOptions(t *testing.T) {
 	dec := wire.NewDecoder(strings.NewReader("(MIN MAX ALL COUNT SAVE)"))
 	opts := &imap.SearchOptions{}
-	if err := parseReturnOptions(dec, opts); err != nil {
-		t.Fatalf("parseReturnOptions() error: %v", err)
+	if err := server.ParseSearchReturnOptions(dec, opts); err != nil {
+		t.Fatalf("ParseSearchReturnOptions() error: %v", err)
 	}
 	if !opts.ReturnMin || !opts.ReturnMax || !opts.ReturnAll || !opts.ReturnCount || !opts.ReturnSave {
 		t.Error("all standard options should be set")
@@ -279,42 +279,6 @@ func TestParseReturnOptions_StandardOptions(t *testing.T) {
 	}
 }
 
-func TestParsePartialRange(t *testing.T) {
-	tests := []struct {
-		name       string
-		input      string
-		wantOffset int32
-		wantCount  uint32
-		wantErr    bool
-	}{
-		{"positive", "1:100", 1, 100, false},
-		{"negative offset", "-1:100", -1, 100, false},
-		{"negative large", "-50:25", -50, 25, false},
-		{"invalid no colon", "abc", 0, 0, true},
-		{"zero offset", "0:100", 0, 0, true},
-		{"zero count", "1:0", 0, 0, true},
-		{"invalid offset", "abc:100", 0, 0, true},
-		{"invalid count", "1:abc", 0, 0, true},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			offset, count, err := parsePartialRange(tt.input)
-			if (err != nil) != tt.wantErr {
-				t.Fatalf("parsePartialRange(%q) error = %v, wantErr = %v", tt.input, err, tt.wantErr)
-			}
-			if !tt.wantErr {
-				if offset != tt.wantOffset {
-					t.Errorf("offset = %d, want %d", offset, tt.wantOffset)
-				}
-				if count != tt.wantCount {
-					t.Errorf("count = %d, want %d", count, tt.wantCount)
-				}
-			}
-		})
-	}
-}
-
 func TestHasAnyReturnOption(t *testing.T) {
 	if hasAnyReturnOption(&imap.SearchOptions{}) {
 		t.Error("empty options should return false")
@@ -92,24 +92,9 @@ func handlePreviewFetch(ctx *server.CommandContext, _ server.CommandHandlerFunc)
 	dec := ctx.Decoder
 
 	// Read sequence set
-	seqSetStr, err := dec.ReadAtom()
+	numSet, err := server.ParseNumSet(ctx)
 	if err != nil {
-		return imap.ErrBad("invalid sequence set")
-	}
-
-	var numSet imap.NumSet
-	if ctx.NumKind == server.NumKindUID {
-		uidSet, err := imap.ParseUIDSet(seqSetStr)
-		if err != nil {
-			return imap.ErrBad("invalid UID set")
-		}
-		numSet = uidSet
-	} else {
-		seqSet, err := imap.ParseSeqSet(seqSetStr)
-		if err != nil {
-			return imap.ErrBad("invalid sequence set")
-		}
-		numSet = seqSet
+		return err
 	}
 
 	if err := dec.ReadSP(); err != nil {
@@ -133,7 +118,7 @@ func handlePreviewFetch(ctx *server.CommandContext, _ server.CommandHandlerFunc)
 	}
 
 	w := server.NewFetchWriter(ctx.Conn.Encoder())
-	if err := ctx.Session.Fetch(w, numSet, options); err != nil {
+	if err := server.RunFetch(ctx, w, numSet, options); err != nil {
 		return err
 	}
 
@@ -36,7 +36,7 @@ type Extension struct {
 	extension.BaseExtension
 }
 
-var _ extension.ServerExtension = (*Extension)(nil)
+var _ extension.WrapDescriber = (*Extension)(nil)
 
 // New creates a new QRESYNC extension.
 func New() *Extension {
@@ -76,6 +76,12 @@ func (e *Extension) WrapHandler(name string, handler interface{}) interface{} {
 	return nil
 }
 
+// DescribeWrap describes the wrappers installed by WrapHandler, which
+// handle their commands completely, including the CONDSTORE parameters.
+func (e *Extension) DescribeWrap(command string) extension.WrapInfo {
+	return extension.WrapInfo{Replaces: true, Supersedes: []string{"CONDSTORE"}}
+}
+
 // SessionExtension returns a typed nil pointer to SessionQResync, indicating
 // that sessions should implement this interface for full QRESYNC support.
 func (e *Extension) SessionExtension() interface{} {
@@ -98,11 +104,16 @@ func handleQResyncSelect(ctx *server.CommandContext, readOnly bool) error {
 
 	dec := ctx.Decoder
 
-	mailbox, err := dec.ReadAString()
+	mailbox, err := dec.ReadMailbox()
 	if err != nil {
 		return imap.ErrBad("invalid mailbox name")
 	}
 
+	mailbox, err = ctx.Conn.ValidateMailboxName(mailbox)
+	if err != nil {
+		return err
+	}
+
 	options := &imap.SelectOptions{
 		ReadOnly: readOnly,
 	}
@@ -174,7 +185,7 @@ func handleQResyncSelect(ctx *server.CommandContext, readOnly bool) error {
 			if err != nil {
 				return err
 			}
-			return writeSelectResponse(ctx, mailbox, data)
+			return server.CompleteSelect(ctx, mailbox, readOnly, data)
 		}
 		// Fall back to plain Select if session doesn't implement QRESYNC
 	}
@@ -184,7 +195,7 @@ func handleQResyncSelect(ctx *server.CommandContext, readOnly bool) error {
 		return err
 	}
 
-	return writeSelectResponse(ctx, mailbox, data)
+	return server.CompleteSelect(ctx, mailbox, readOnly, data)
 }
 
 // parseQResyncParams parses QRESYNC parameters: SP (uidvalidity SP modseq [SP known-uids [SP (seq-set SP uid-set)]])
@@ -317,111 +328,6 @@ func parseQResyncParams(dec *wire.Decoder) (*imap.SelectQResync, error) {
 	return qr, nil
 }
 
-// writeSelectResponse writes the standard SELECT/EXAMINE response.
-func writeSelectResponse(ctx *server.CommandContext, mailbox string, data *imap.SelectData) error {
-	enc := ctx.Conn.Encoder()
-
-	// Write FLAGS
-	flagStrs := make([]string, len(data.Flags))
-	for i, f := range data.Flags {
-		flagStrs[i] = string(f)
-	}
-	enc.Encode(func(e *wire.Encoder) {
-		e.Star().Atom("FLAGS").SP().Flags(flagStrs).CRLF()
-	})
-
-	// Write EXISTS
-	enc.Encode(func(e *wire.Encoder) {
-		e.NumResponse(data.NumMessages, "EXISTS")
-	})
-
-	// Write RECENT
-	enc.Encode(func(e *wire.Encoder) {
-		e.NumResponse(data.NumRecent, "RECENT")
-	})
-
-	// Write UIDVALIDITY
-	enc.Encode(func(e *wire.Encoder) {
-		e.Star().Atom("OK").SP()
-		e.ResponseCode("UIDVALIDITY", data.UIDValidity)
-		e.CRLF()
-	})
-
-	// Write UIDNEXT
-	enc.Encode(func(e *wire.Encoder) {
-		e.Star().Atom("OK").SP()
-		e.ResponseCode("UIDNEXT", uint32(data.UIDNext))
-		e.CRLF()
-	})
-
-	// Write PERMANENTFLAGS if present
-	if len(data.PermanentFlags) > 0 {
-		permFlagStrs := make([]string, len(data.PermanentFlags))
-		for i, f := range data.PermanentFlags {
-			permFlagStrs[i] = string(f)
-		}
-		enc.Encode(func(e *wire.Encoder) {
-			e.Star().Atom("OK").SP()
-			e.RawString("[PERMANENTFLAGS ")
-			e.Flags(permFlagStrs)
-			e.RawString("] ")
-			e.CRLF()
-		})
-	}
-
-	// Write UNSEEN if present
-	if data.FirstUnseen > 0 {
-		enc.Encode(func(e *wire.Encoder) {
-			e.Star().Atom("OK").SP()
-			e.ResponseCode("UNSEEN", data.FirstUnseen)
-			e.CRLF()
-		})
-	}
-
-	// Write HIGHESTMODSEQ if present
-	if data.HighestModSeq > 0 {
-		enc.Encode(func(e *wire.Encoder) {
-			e.Star().Atom("OK").SP()
-			e.ResponseCode("HIGHESTMODSEQ", data.HighestModSeq)
-			e.CRLF()
-		})
-	}
-
-	// Write MAILBOXID if present (RFC 8474)
-	if data.MailboxID != "" {
-		enc.Encode(func(e *wire.Encoder) {
-			e.Star().Atom("OK").SP()
-			e.ResponseCode("MAILBOXID", "("+data.MailboxID+")")
-			e.CRLF()
-		})
-	}
-
-	// Write VANISHED (EARLIER) if present (QRESYNC)
-	if data.Vanished != nil && !data.Vanished.IsEmpty() {
-		vanished := data.Vanished.String()
-		enc.Encode(func(e *wire.Encoder) {
-			e.Star().Atom("VANISHED").SP().Atom("(EARLIER)").SP().Atom(vanished).CRLF()
-		})
-	}
-
-	// Update connection state
-	ctx.Conn.SetMailbox(mailbox, data.ReadOnly)
-	if err := ctx.Conn.SetState(imap.ConnStateSelected); err != nil {
-		return err
-	}
-
-	// Tagged OK with READ-ONLY or READ-WRITE code
-	code := "READ-WRITE"
-	if data.ReadOnly {
-		code = "READ-ONLY"
-	}
-	enc.Encode(func(e *wire.Encoder) {
-		e.StatusResponse(ctx.Tag, "OK", code, "SELECT completed")
-	})
-
-	return nil
-}
-
 // handleQResyncFetch wraps the FETCH command to parse (CHANGEDSINCE <modseq> VANISHED).
 //
 // Format: UID FETCH <seqset> <items> (CHANGEDSINCE <modseq> VANISHED)
@@ -433,24 +339,9 @@ func handleQResyncFetch(ctx *server.CommandContext) error {
 	dec := ctx.Decoder
 
 	// Read sequence set
-	seqSetStr, err := dec.ReadAtom()
+	numSet, err := server.ParseNumSet(ctx)
 	if err != nil {
-		return imap.ErrBad("invalid sequence set")
-	}
-
-	var numSet imap.NumSet
-	if ctx.NumKind == server.NumKindUID {
-		uidSet, err := imap.ParseUIDSet(seqSetStr)
-		if err != nil {
-			return imap.ErrBad("invalid UID set")
-		}
-		numSet = uidSet
-	} else {
-		seqSet, err := imap.ParseSeqSet(seqSetStr)
-		if err != nil {
-			return imap.ErrBad("invalid sequence set")
-		}
-		numSet = seqSet
+		return err
 	}
 
 	if err := dec.ReadSP(); err != nil {
@@ -516,7 +407,7 @@ func handleQResyncFetch(ctx *server.CommandContext) error {
 	}
 
 	w := server.NewFetchWriter(ctx.Conn.Encoder())
-	if err := ctx.Session.Fetch(w, numSet, options); err != nil {
+	if err := server.RunFetch(ctx, w, numSet, options); err != nil {
 		return err
 	}
 
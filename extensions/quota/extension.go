@@ -128,12 +128,16 @@ func handleGetQuotaRoot(ctx *server.CommandContext) error {
 		return nil
 	}
 
-	mailbox, err := ctx.Decoder.ReadAString()
+	mailbox, err := ctx.Decoder.ReadMailbox()
 	if err != nil {
 		ctx.Conn.WriteBAD(ctx.Tag, "Expected mailbox name")
 		return nil
 	}
 
+	if err := ctx.Conn.CheckMailboxAccess(mailbox); err != nil {
+		return err
+	}
+
 	rootData, quotas, err := sess.GetQuotaRoot(mailbox)
 	if err != nil {
 		ctx.Conn.WriteNO(ctx.Tag, fmt.Sprintf("GETQUOTAROOT failed: %v", err))
@@ -76,27 +76,9 @@ func handleReplace() server.CommandHandlerFunc {
 		}
 
 		// Read the message set (sequence set or UID set)
-		setStr, err := ctx.Decoder.ReadAtom()
+		numSet, err := server.ParseNumSet(ctx)
 		if err != nil {
-			ctx.Conn.WriteBAD(ctx.Tag, "invalid message set")
-			return nil
-		}
-
-		var numSet imap.NumSet
-		if ctx.NumKind == server.NumKindUID {
-			uidSet, err := imap.ParseUIDSet(setStr)
-			if err != nil {
-				ctx.Conn.WriteBAD(ctx.Tag, "invalid UID set")
-				return nil
-			}
-			numSet = uidSet
-		} else {
-			seqSet, err := imap.ParseSeqSet(setStr)
-			if err != nil {
-				ctx.Conn.WriteBAD(ctx.Tag, "invalid sequence set")
-				return nil
-			}
-			numSet = seqSet
+			return err
 		}
 
 		if err := ctx.Decoder.ReadSP(); err != nil {
@@ -105,7 +87,7 @@ func handleReplace() server.CommandHandlerFunc {
 		}
 
 		// Read mailbox name
-		mailbox, err := ctx.Decoder.ReadAString()
+		mailbox, err := ctx.Decoder.ReadMailbox()
 		if err != nil {
 			ctx.Conn.WriteBAD(ctx.Tag, "invalid mailbox name")
 			return nil
@@ -188,14 +170,17 @@ func handleReplace() server.CommandHandlerFunc {
 			return nil
 		}
 
-		// Read the literal body from the connection's main decoder
-		connDec := ctx.Conn.Decoder()
+		// Read the literal body from the connection
 		literalReader := imap.LiteralReader{
-			Reader: connDec.ReadLiteral(litSize),
+			Reader: ctx.Conn.ReadLiteral(ctx.Name, litSize),
 			Size:   litSize,
 		}
 
-		data, err := sess.Replace(numSet, mailbox, literalReader, options)
+		err = ctx.Conn.CheckMailboxAccess(mailbox)
+		var data *imap.AppendData
+		if err == nil {
+			data, err = sess.Replace(numSet, mailbox, literalReader, options)
+		}
 		if err != nil {
 			_, _ = io.Copy(io.Discard, literalReader.Reader)
 			ctx.Conn.WriteNO(ctx.Tag, fmt.Sprintf("REPLACE failed: %v", err))
@@ -207,11 +192,8 @@ func handleReplace() server.CommandHandlerFunc {
 
 		// Write tagged OK, optionally with APPENDUID response code
 		if data != nil && data.UIDValidity > 0 && data.UID > 0 {
-			enc := ctx.Conn.Encoder()
-			enc.Encode(func(e *wire.Encoder) {
-				code := fmt.Sprintf("APPENDUID %d %d", data.UIDValidity, uint32(data.UID))
-				e.StatusResponse(ctx.Tag, "OK", code, "REPLACE completed")
-			})
+			ctx.Conn.WriteOKCode(ctx.Tag, imap.ResponseCodeAppendUID, "REPLACE completed",
+				data.UIDValidity, data.UID)
 		} else {
 			ctx.Conn.WriteOK(ctx.Tag, "REPLACE completed")
 		}
@@ -7,7 +7,6 @@
 package searchfuzzy
 
 import (
-	"fmt"
 	"strings"
 
 	imap "github.com/meszmate/imap-go"
@@ -78,13 +77,13 @@ func handleFuzzySearch(ctx *server.CommandContext, _ server.CommandHandlerFunc)
 	}
 
 	dec := ctx.Decoder
-	criteria := &imap.SearchCriteria{}
 	options := &imap.SearchOptions{}
 	hasReturn := false
 
-	first, err := dec.ReadAtom()
+	// Check whether the first token is "RETURN"
+	first, err := server.ReadSearchToken(dec)
 	if err != nil {
-		return imap.ErrBad("missing search criteria")
+		return err
 	}
 
 	if strings.EqualFold(first, "RETURN") {
@@ -92,24 +91,18 @@ func handleFuzzySearch(ctx *server.CommandContext, _ server.CommandHandlerFunc)
 		if err := dec.ReadSP(); err != nil {
 			return imap.ErrBad("missing RETURN options")
 		}
-		if err := parseReturnOptions(dec, options); err != nil {
+		if err := server.ParseSearchReturnOptions(dec, options); err != nil {
 			return err
 		}
 		if err := dec.ReadSP(); err != nil {
 			return imap.ErrBad("missing search criteria after RETURN")
 		}
-		if err := parseFuzzySearchCriteria(dec, criteria); err != nil {
-			return imap.ErrBad("invalid search criteria: " + err.Error())
-		}
-	} else {
-		if err := parseFuzzySearchCriterion(first, dec, criteria); err != nil {
-			return imap.ErrBad("invalid search criteria: " + err.Error())
-		}
-		if err := dec.ReadSP(); err == nil {
-			if err := parseFuzzySearchCriteria(dec, criteria); err != nil {
-				return imap.ErrBad("invalid search criteria: " + err.Error())
-			}
-		}
+		first = ""
+	}
+	parser := server.SearchParser{Hook: fuzzySearchHook}
+	criteria, err := parser.ParseFrom(first, dec)
+	if err != nil {
+		return err
 	}
 
 	// Route to session
@@ -121,19 +114,19 @@ func handleFuzzySearch(ctx *server.CommandContext, _ server.CommandHandlerFunc)
 			if sess, ok := ctx.Session.(esearch.SessionESearch); ok {
 				data, err = sess.SearchExtended(ctx.NumKind, criteria, options)
 			} else {
-				data, err = ctx.Session.Search(ctx.NumKind, criteria, options)
+				data, err = server.RunSearch(ctx, criteria, options)
 			}
 		} else {
-			data, err = ctx.Session.Search(ctx.NumKind, criteria, options)
+			data, err = server.RunSearch(ctx, criteria, options)
 		}
 	} else if hasReturn {
 		if sess, ok := ctx.Session.(esearch.SessionESearch); ok {
 			data, err = sess.SearchExtended(ctx.NumKind, criteria, options)
 		} else {
-			data, err = ctx.Session.Search(ctx.NumKind, criteria, options)
+			data, err = server.RunSearch(ctx, criteria, options)
 		}
 	} else {
-		data, err = ctx.Session.Search(ctx.NumKind, criteria, options)
+		data, err = server.RunSearch(ctx, criteria, options)
 	}
 	if err != nil {
 		return err
@@ -162,103 +155,22 @@ func handleFuzzySearch(ctx *server.CommandContext, _ server.CommandHandlerFunc)
 		})
 	}
 
-	ctx.Conn.WriteOK(ctx.Tag, "SEARCH completed")
+	ctx.Conn.WriteSearchOK(ctx.Tag, data)
 	return nil
 }
 
-// parseFuzzySearchCriteria reads search criteria from the decoder, handling FUZZY modifiers.
-func parseFuzzySearchCriteria(dec *wire.Decoder, criteria *imap.SearchCriteria) error {
-	for {
-		b, err := dec.PeekByte()
-		if err != nil {
-			return nil
-		}
-		if b == ')' {
-			return nil
-		}
-
-		key, err := dec.ReadAtom()
-		if err != nil {
-			return nil
-		}
-
-		if err := parseFuzzySearchCriterion(key, dec, criteria); err != nil {
-			return err
-		}
-
-		if err := dec.ReadSP(); err != nil {
-			return nil
-		}
+// fuzzySearchHook handles the FUZZY search key modifier.
+func fuzzySearchHook(p *server.SearchParser, key string, dec *wire.Decoder, criteria *imap.SearchCriteria) (bool, error) {
+	if !strings.EqualFold(key, "FUZZY") {
+		return false, nil
 	}
-}
-
-// parseFuzzySearchCriterion handles a single already-read criterion key, intercepting FUZZY.
-func parseFuzzySearchCriterion(key string, dec *wire.Decoder, criteria *imap.SearchCriteria) error {
-	if strings.EqualFold(key, "FUZZY") {
-		criteria.Fuzzy = true
-		if err := dec.ReadSP(); err != nil {
-			return fmt.Errorf("expected search key after FUZZY")
-		}
-		next, err := dec.ReadAtom()
-		if err != nil {
-			return fmt.Errorf("expected search key after FUZZY")
-		}
-		return esearch.ParseSearchCriterion(next, dec, criteria)
-	}
-	return esearch.ParseSearchCriterion(key, dec, criteria)
-}
-
-// parseReturnOptions parses a parenthesized list of RETURN options.
-func parseReturnOptions(dec *wire.Decoder, options *imap.SearchOptions) error {
-	if err := dec.ExpectByte('('); err != nil {
-		return imap.ErrBad("expected '(' for RETURN options")
-	}
-
-	b, err := dec.PeekByte()
+	sub, err := p.ParseNextKey(dec)
 	if err != nil {
-		return imap.ErrBad("unexpected end in RETURN options")
-	}
-	if b == ')' {
-		if err := dec.ExpectByte(')'); err != nil {
-			return imap.ErrBad("expected ')' for RETURN options")
-		}
-		return nil
-	}
-
-	for {
-		atom, err := dec.ReadAtom()
-		if err != nil {
-			return imap.ErrBad("invalid RETURN option")
-		}
-		switch strings.ToUpper(atom) {
-		case "MIN":
-			options.ReturnMin = true
-		case "MAX":
-			options.ReturnMax = true
-		case "ALL":
-			options.ReturnAll = true
-		case "COUNT":
-			options.ReturnCount = true
-		case "SAVE":
-			options.ReturnSave = true
-		default:
-			return imap.ErrBad("unknown RETURN option: " + atom)
-		}
-
-		b, err := dec.PeekByte()
-		if err != nil {
-			return imap.ErrBad("unexpected end in RETURN options")
-		}
-		if b == ')' {
-			if err := dec.ExpectByte(')'); err != nil {
-				return imap.ErrBad("expected ')' for RETURN options")
-			}
-			return nil
-		}
-		if err := dec.ReadSP(); err != nil {
-			return imap.ErrBad("expected SP between RETURN options")
-		}
+		return true, err
 	}
+	*criteria = *sub
+	criteria.Fuzzy = true
+	return true, nil
 }
 
 // hasAnyReturnOption returns true if any RETURN option is set.
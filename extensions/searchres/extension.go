@@ -32,7 +32,7 @@ type Extension struct {
 	extension.BaseExtension
 }
 
-var _ extension.ServerExtension = (*Extension)(nil)
+var _ extension.WrapDescriber = (*Extension)(nil)
 
 // New creates a new SEARCHRES extension.
 func New() *Extension {
@@ -84,6 +84,19 @@ func (e *Extension) WrapHandler(name string, handler interface{}) interface{} {
 	return nil
 }
 
+// DescribeWrap describes the wrappers installed by WrapHandler. SEARCH is
+// handled completely, including ESEARCH return options; the other commands
+// are only handled here if their sequence set is "$".
+func (e *Extension) DescribeWrap(command string) extension.WrapInfo {
+	switch command {
+	case "SEARCH":
+		return extension.WrapInfo{Replaces: true, Supersedes: []string{"ESEARCH"}}
+	case "FETCH", "STORE":
+		return extension.WrapInfo{Replaces: true, Supersedes: []string{"CONDSTORE"}}
+	}
+	return extension.WrapInfo{Replaces: true}
+}
+
 // SessionExtension returns the required session extension interface.
 func (e *Extension) SessionExtension() interface{} {
 	return (*SessionSearchRes)(nil)
@@ -99,14 +112,13 @@ func handleSearchRes(ctx *server.CommandContext, original server.CommandHandlerF
 	}
 
 	dec := ctx.Decoder
-	criteria := &imap.SearchCriteria{}
 	options := &imap.SearchOptions{}
 	hasReturn := false
 
-	// Peek to check if first token is "RETURN"
-	first, err := dec.ReadAtom()
+	// Check whether the first token is "RETURN"
+	first, err := server.ReadSearchToken(dec)
 	if err != nil {
-		return imap.ErrBad("missing search criteria")
+		return err
 	}
 
 	if strings.EqualFold(first, "RETURN") {
@@ -114,26 +126,21 @@ func handleSearchRes(ctx *server.CommandContext, original server.CommandHandlerF
 		if err := dec.ReadSP(); err != nil {
 			return imap.ErrBad("missing RETURN options")
 		}
-		if err := parseReturnOptions(dec, options); err != nil {
+		if err := server.ParseSearchReturnOptions(dec, options); err != nil {
 			return err
 		}
 		if err := dec.ReadSP(); err != nil {
 			return imap.ErrBad("missing search criteria after RETURN")
 		}
-		if err := parseSearchCriteriaWithDollar(ctx, dec, criteria); err != nil {
-			return imap.ErrBad("invalid search criteria: " + err.Error())
-		}
-	} else {
-		// First atom is a search criterion, not RETURN
-		if err := parseSearchCriterionWithDollar(ctx, first, dec, criteria); err != nil {
-			return imap.ErrBad("invalid search criteria: " + err.Error())
-		}
-		// Try to read more criteria
-		if err := dec.ReadSP(); err == nil {
-			if err := parseSearchCriteriaWithDollar(ctx, dec, criteria); err != nil {
-				return imap.ErrBad("invalid search criteria: " + err.Error())
-			}
-		}
+		first = ""
+	}
+	parser := server.SearchParser{Hook: dollarSearchHook(ctx)}
+	criteria, err := parser.ParseFrom(first, dec)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Conn.CheckSearchCriteria(criteria); err != nil {
+		return err
 	}
 
 	// Route to session
@@ -142,14 +149,19 @@ func handleSearchRes(ctx *server.CommandContext, original server.CommandHandlerF
 		if sess, ok := ctx.Session.(esearch.SessionESearch); ok {
 			data, err = sess.SearchExtended(ctx.NumKind, criteria, options)
 		} else {
-			data, err = ctx.Session.Search(ctx.NumKind, criteria, options)
+			data, err = server.RunSearch(ctx, criteria, options)
 		}
 	} else {
-		data, err = ctx.Session.Search(ctx.NumKind, criteria, options)
+		data, err = server.RunSearch(ctx, criteria, options)
 	}
 	if err != nil {
 		return err
 	}
+	if !(hasReturn && hasAnyReturnOption(options)) || options.ReturnAll {
+		if err := ctx.Conn.CheckSearchData(data); err != nil {
+			return err
+		}
+	}
 
 	// If SAVE was requested and session supports it, save the result
 	if options.ReturnSave {
@@ -184,53 +196,30 @@ func handleSearchRes(ctx *server.CommandContext, original server.CommandHandlerF
 		})
 	}
 
-	ctx.Conn.WriteOK(ctx.Tag, "SEARCH completed")
+	ctx.Conn.WriteSearchOK(ctx.Tag, data)
 	return nil
 }
 
-// parseSearchCriteriaWithDollar reads search criteria with $ support.
-func parseSearchCriteriaWithDollar(ctx *server.CommandContext, dec *wire.Decoder, criteria *imap.SearchCriteria) error {
-	for {
-		b, err := dec.PeekByte()
-		if err != nil {
-			return nil
-		}
-		if b == ')' {
-			return nil
-		}
-
-		key, err := dec.ReadAtom()
-		if err != nil {
-			return nil
+// dollarSearchHook returns a search key hook that resolves the $ marker
+// to the saved search result.
+func dollarSearchHook(ctx *server.CommandContext) server.SearchKeyHook {
+	return func(_ *server.SearchParser, key string, _ *wire.Decoder, criteria *imap.SearchCriteria) (bool, error) {
+		if key != "$" {
+			return false, nil
 		}
-
-		if err := parseSearchCriterionWithDollar(ctx, key, dec, criteria); err != nil {
-			return err
-		}
-
-		if err := dec.ReadSP(); err != nil {
-			return nil
-		}
-	}
-}
-
-// parseSearchCriterionWithDollar handles a single criterion key, intercepting $.
-func parseSearchCriterionWithDollar(ctx *server.CommandContext, key string, dec *wire.Decoder, criteria *imap.SearchCriteria) error {
-	if key == "$" {
 		sess, ok := ctx.Session.(SessionSearchRes)
 		if !ok {
-			return fmt.Errorf("no saved search result")
+			return true, fmt.Errorf("no saved search result")
 		}
 		savedSet, err := sess.GetSearchResult()
 		if err != nil {
-			return err
+			return true, err
 		}
 		if savedSet != nil {
 			criteria.SeqNum = savedSet
 		}
-		return nil
+		return true, nil
 	}
-	return esearch.ParseSearchCriterion(key, dec, criteria)
 }
 
 // resolveDollar resolves the $ marker to a saved search result set.
@@ -328,7 +317,7 @@ func handleDollarFetch(ctx *server.CommandContext, original server.CommandHandle
 	}
 
 	w := server.NewFetchWriter(ctx.Conn.Encoder())
-	if err := ctx.Session.Fetch(w, numSet, options); err != nil {
+	if err := server.RunFetch(ctx, w, numSet, options); err != nil {
 		return err
 	}
 
@@ -463,25 +452,26 @@ func handleDollarCopy(ctx *server.CommandContext, original server.CommandHandler
 		return imap.ErrBad("missing destination mailbox")
 	}
 
-	dest, err := dec.ReadAString()
+	dest, err := dec.ReadMailbox()
 	if err != nil {
 		return imap.ErrBad("invalid destination mailbox")
 	}
 
+	dest = imap.CanonicalMailboxName(dest)
+
+	if err := ctx.Conn.CheckMailboxAccess(dest); err != nil {
+		return err
+	}
+
 	data, err := ctx.Session.Copy(numSet, dest)
 	if err != nil {
 		return err
 	}
 
 	if data != nil && data.UIDValidity > 0 {
-		enc := ctx.Conn.Encoder()
-		enc.Encode(func(e *wire.Encoder) {
-			code := fmt.Sprintf("COPYUID %d %s %s",
-				data.UIDValidity,
-				data.SourceUIDs.String(),
-				data.DestUIDs.String())
-			e.StatusResponse(ctx.Tag, "OK", code, "COPY completed")
-		})
+		data.Normalize()
+		ctx.Conn.WriteOKCode(ctx.Tag, imap.ResponseCodeCopyUID, "COPY completed",
+			data.UIDValidity, &data.SourceUIDs, &data.DestUIDs)
 	} else {
 		ctx.Conn.WriteOK(ctx.Tag, "COPY completed")
 	}
@@ -512,11 +502,17 @@ func handleDollarMove(ctx *server.CommandContext, original server.CommandHandler
 		return imap.ErrBad("missing destination mailbox")
 	}
 
-	dest, err := dec.ReadAString()
+	dest, err := dec.ReadMailbox()
 	if err != nil {
 		return imap.ErrBad("invalid destination mailbox")
 	}
 
+	dest = imap.CanonicalMailboxName(dest)
+
+	if err := ctx.Conn.CheckMailboxAccess(dest); err != nil {
+		return err
+	}
+
 	sessMove, ok := ctx.Session.(server.SessionMove)
 	if !ok {
 		return imap.ErrNo("MOVE not supported")
@@ -534,60 +530,6 @@ func handleDollarMove(ctx *server.CommandContext, original server.CommandHandler
 	return nil
 }
 
-// parseReturnOptions parses a parenthesized list of RETURN options.
-// This is a local copy of esearch's private parseReturnOptions.
-func parseReturnOptions(dec *wire.Decoder, options *imap.SearchOptions) error {
-	if err := dec.ExpectByte('('); err != nil {
-		return imap.ErrBad("expected '(' for RETURN options")
-	}
-
-	b, err := dec.PeekByte()
-	if err != nil {
-		return imap.ErrBad("unexpected end in RETURN options")
-	}
-	if b == ')' {
-		if err := dec.ExpectByte(')'); err != nil {
-			return imap.ErrBad("expected ')' for RETURN options")
-		}
-		return nil
-	}
-
-	for {
-		atom, err := dec.ReadAtom()
-		if err != nil {
-			return imap.ErrBad("invalid RETURN option")
-		}
-		switch strings.ToUpper(atom) {
-		case "MIN":
-			options.ReturnMin = true
-		case "MAX":
-			options.ReturnMax = true
-		case "ALL":
-			options.ReturnAll = true
-		case "COUNT":
-			options.ReturnCount = true
-		case "SAVE":
-			options.ReturnSave = true
-		default:
-			return imap.ErrBad("unknown RETURN option: " + atom)
-		}
-
-		b, err := dec.PeekByte()
-		if err != nil {
-			return imap.ErrBad("unexpected end in RETURN options")
-		}
-		if b == ')' {
-			if err := dec.ExpectByte(')'); err != nil {
-				return imap.ErrBad("expected ')' for RETURN options")
-			}
-			return nil
-		}
-		if err := dec.ReadSP(); err != nil {
-			return imap.ErrBad("expected SP between RETURN options")
-		}
-	}
-}
-
 // hasAnyReturnOption returns true if any RETURN option is set.
 func hasAnyReturnOption(options *imap.SearchOptions) bool {
 	return options.ReturnMin || options.ReturnMax || options.ReturnAll || options.ReturnCount || options.ReturnSave
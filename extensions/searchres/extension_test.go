@@ -206,8 +206,8 @@ func TestParseReturnOptions(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			dec := wire.NewDecoder(strings.NewReader(tt.input))
 			opts := &imap.SearchOptions{}
-			if err := parseReturnOptions(dec, opts); err != nil {
-				t.Fatalf("parseReturnOptions() error: %v", err)
+			if err := server.ParseSearchReturnOptions(dec, opts); err != nil {
+				t.Fatalf("ParseSearchReturnOptions() error: %v", err)
 			}
 			if opts.ReturnMin != tt.wantMin {
 				t.Errorf("ReturnMin = %v, want %v", opts.ReturnMin, tt.wantMin)
@@ -231,8 +231,8 @@ func TestParseReturnOptions(t *testing.T) {
 func TestParseReturnOptions_Empty(t *testing.T) {
 	dec := wire.NewDecoder(strings.NewReader("()"))
 	opts := &imap.SearchOptions{}
-	if err := parseReturnOptions(dec, opts); err != nil {
-		t.Fatalf("parseReturnOptions() error: %v", err)
+	if err := server.ParseSearchReturnOptions(dec, opts); err != nil {
+		t.Fatalf("ParseSearchReturnOptions() error: %v", err)
 	}
 	if opts.ReturnMin || opts.ReturnMax || opts.ReturnAll || opts.ReturnCount || opts.ReturnSave {
 		t.Error("empty () should have no options set")
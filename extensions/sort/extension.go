@@ -7,7 +7,6 @@ package sort
 
 import (
 	"fmt"
-	"strings"
 
 	imap "github.com/meszmate/imap-go"
 	"github.com/meszmate/imap-go/extension"
@@ -66,60 +65,33 @@ func handleSort(ctx *server.CommandContext) error {
 	dec := ctx.Decoder
 
 	// Parse sort criteria list: (REVERSE? sort-key)+
-	var criteria []imap.SortCriterion
-	if err := dec.ReadList(func() error {
-		atom, err := dec.ReadAtom()
-		if err != nil {
-			return err
-		}
-
-		var criterion imap.SortCriterion
-		upper := strings.ToUpper(atom)
-		if upper == "REVERSE" {
-			criterion.Reverse = true
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			keyAtom, err := dec.ReadAtom()
-			if err != nil {
-				return err
-			}
-			criterion.Key = imap.SortKey(strings.ToUpper(keyAtom))
-		} else {
-			criterion.Key = imap.SortKey(upper)
-		}
-		criteria = append(criteria, criterion)
-		return nil
-	}); err != nil {
-		ctx.Conn.WriteBAD(ctx.Tag, "Invalid sort criteria")
-		return nil
-	}
-
-	if len(criteria) == 0 {
-		ctx.Conn.WriteBAD(ctx.Tag, "Empty sort criteria")
-		return nil
+	criteria, err := server.ReadSortCriteria(ctx.Conn, dec)
+	if err != nil {
+		return err
 	}
 
-	// Read SP and charset
+	// Read SP, then charset and search criteria
 	if err := dec.ReadSP(); err != nil {
 		ctx.Conn.WriteBAD(ctx.Tag, "Expected charset")
 		return nil
 	}
-	_, err := dec.ReadAtom()
+	var parser server.SearchParser
+	searchCriteria, err := parser.ParseWithCharset(dec)
 	if err != nil {
-		ctx.Conn.WriteBAD(ctx.Tag, "Invalid charset")
-		return nil
+		return err
+	}
+	if err := ctx.Conn.CheckSearchCriteria(searchCriteria); err != nil {
+		return err
 	}
-
-	// The remaining arguments are search criteria. For now, use a basic
-	// ALL search criteria since full search criteria parsing is complex.
-	searchCriteria := &imap.SearchCriteria{}
 
 	data, err := sess.Sort(ctx.NumKind, criteria, searchCriteria, &imap.SearchOptions{})
 	if err != nil {
 		ctx.Conn.WriteNO(ctx.Tag, fmt.Sprintf("SORT failed: %v", err))
 		return nil
 	}
+	if err := ctx.Conn.CheckSearchResults(len(data.AllNums)); err != nil {
+		return err
+	}
 
 	// Write untagged SORT response: * SORT num1 num2 ...
 	ctx.Conn.Encoder().Encode(func(enc *wire.Encoder) {
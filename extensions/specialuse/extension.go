@@ -37,8 +37,13 @@ type SessionSpecialUse interface {
 // special-use attributes. The core commands already handle these via
 // ListOptions and CreateOptions; this extension advertises the capabilities
 // and exposes a session interface.
+//
+// With WithProvisioning, the extension also creates the standard
+// special-use folders after an account's first successful login.
 type Extension struct {
 	extension.BaseExtension
+
+	provisioning *Provisioning
 }
 
 var _ extension.ServerExtension = (*Extension)(nil)
@@ -56,7 +61,9 @@ func New() *Extension {
 func (e *Extension) CommandHandlers() map[string]interface{} { return nil }
 
 // WrapHandler wraps the CREATE command to parse the optional USE parameter
-// per RFC 6154 §3: CREATE mailbox-name SP (USE (special-use-attr))
+// per RFC 6154 §3: CREATE mailbox-name SP (USE (special-use-attr)).
+// If provisioning is enabled, LOGIN and AUTHENTICATE are wrapped to
+// provision the default folders after a successful login.
 func (e *Extension) WrapHandler(name string, handler interface{}) interface{} {
 	h, ok := handler.(server.CommandHandlerFunc)
 	if !ok {
@@ -72,6 +79,19 @@ func (e *Extension) WrapHandler(name string, handler interface{}) interface{} {
 		return server.CommandHandlerFunc(func(ctx *server.CommandContext) error {
 			return handleSpecialUseCreate(ctx, h)
 		})
+	case "LOGIN", "AUTHENTICATE":
+		if e.provisioning == nil {
+			return nil
+		}
+		return server.CommandHandlerFunc(func(ctx *server.CommandContext) error {
+			if err := h(ctx); err != nil {
+				return err
+			}
+			if ctx.Conn.State() == imap.ConnStateAuthenticated {
+				e.provisioning.provision(ctx)
+			}
+			return nil
+		})
 	}
 	return nil
 }
@@ -92,11 +112,16 @@ func handleSpecialUseCreate(ctx *server.CommandContext, _ server.CommandHandlerF
 		return imap.ErrBad("missing mailbox name")
 	}
 
-	mailbox, err := ctx.Decoder.ReadAString()
+	mailbox, err := ctx.Decoder.ReadMailbox()
 	if err != nil {
 		return imap.ErrBad("invalid mailbox name")
 	}
 
+	mailbox, err = ctx.Conn.ValidateMailboxName(mailbox)
+	if err != nil {
+		return err
+	}
+
 	options := &imap.CreateOptions{}
 
 	// Try to read SP followed by (USE (\Attr))
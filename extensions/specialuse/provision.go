@@ -0,0 +1,150 @@
+package specialuse
+
+import (
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/server"
+)
+
+// DefaultLocale is the locale used when Provisioning.Locale is nil or
+// returns a locale without folder names.
+const DefaultLocale = "en"
+
+// DefaultProvisionedFolders are the special-use folders provisioned when
+// Provisioning.Folders is nil.
+var DefaultProvisionedFolders = []imap.MailboxAttr{
+	imap.MailboxAttrSent,
+	imap.MailboxAttrDrafts,
+	imap.MailboxAttrTrash,
+	imap.MailboxAttrJunk,
+	imap.MailboxAttrArchive,
+}
+
+// DefaultFolderNames holds folder names for a few common locales, keyed by
+// locale and special-use attribute.
+var DefaultFolderNames = map[string]map[imap.MailboxAttr]string{
+	"en": {
+		imap.MailboxAttrSent:    "Sent",
+		imap.MailboxAttrDrafts:  "Drafts",
+		imap.MailboxAttrTrash:   "Trash",
+		imap.MailboxAttrJunk:    "Junk",
+		imap.MailboxAttrArchive: "Archive",
+	},
+	"de": {
+		imap.MailboxAttrSent:    "Gesendet",
+		imap.MailboxAttrDrafts:  "Entwürfe",
+		imap.MailboxAttrTrash:   "Papierkorb",
+		imap.MailboxAttrJunk:    "Spam",
+		imap.MailboxAttrArchive: "Archiv",
+	},
+	"fr": {
+		imap.MailboxAttrSent:    "Envoyés",
+		imap.MailboxAttrDrafts:  "Brouillons",
+		imap.MailboxAttrTrash:   "Corbeille",
+		imap.MailboxAttrJunk:    "Indésirables",
+		imap.MailboxAttrArchive: "Archives",
+	},
+	"es": {
+		imap.MailboxAttrSent:    "Enviados",
+		imap.MailboxAttrDrafts:  "Borradores",
+		imap.MailboxAttrTrash:   "Papelera",
+		imap.MailboxAttrJunk:    "Spam",
+		imap.MailboxAttrArchive: "Archivo",
+	},
+}
+
+// SessionProvisioner is an optional interface for sessions that record
+// whether the account's default folders have been provisioned. Without
+// it, missing folders are created on every login.
+type SessionProvisioner interface {
+	// NeedsProvisioning reports whether the logged-in account has not
+	// been provisioned yet.
+	NeedsProvisioning() (bool, error)
+
+	// MarkProvisioned records that the account has been provisioned.
+	MarkProvisioned() error
+}
+
+// Provisioning configures the creation of default special-use folders
+// after the first successful login of an account.
+type Provisioning struct {
+	// Folders lists the special-use attributes to provision. If nil,
+	// DefaultProvisionedFolders is used.
+	Folders []imap.MailboxAttr
+
+	// Names maps locales to folder names per special-use attribute. If
+	// nil, DefaultFolderNames is used.
+	Names map[string]map[imap.MailboxAttr]string
+
+	// Locale returns the locale of the logged-in user. If nil,
+	// DefaultLocale is used.
+	Locale func(conn *server.Conn) string
+}
+
+// WithProvisioning enables default folder provisioning on login and
+// returns e.
+func (e *Extension) WithProvisioning(p *Provisioning) *Extension {
+	e.provisioning = p
+	return e
+}
+
+// folderNames returns the folder names for the connection's locale.
+func (p *Provisioning) folderNames(conn *server.Conn) map[imap.MailboxAttr]string {
+	names := p.Names
+	if names == nil {
+		names = DefaultFolderNames
+	}
+	if p.Locale != nil {
+		if n, ok := names[p.Locale(conn)]; ok {
+			return n
+		}
+	}
+	return names[DefaultLocale]
+}
+
+// provision creates the default folders for the logged-in account.
+// Failures are logged and do not affect the login.
+func (p *Provisioning) provision(ctx *server.CommandContext) {
+	logger := ctx.Conn.Logger()
+
+	prov, tracked := ctx.Session.(SessionProvisioner)
+	if tracked {
+		needed, err := prov.NeedsProvisioning()
+		if err != nil {
+			logger.Warn("checking folder provisioning failed", "error", err)
+			return
+		}
+		if !needed {
+			return
+		}
+	}
+
+	folders := p.Folders
+	if folders == nil {
+		folders = DefaultProvisionedFolders
+	}
+	names := p.folderNames(ctx.Conn)
+
+	for _, attr := range folders {
+		name, ok := names[attr]
+		if !ok {
+			continue
+		}
+		options := &imap.CreateOptions{SpecialUse: attr}
+
+		var err error
+		if sess, ok := ctx.Session.(SessionSpecialUse); ok {
+			err = sess.CreateSpecialUse(name, options)
+		} else {
+			err = ctx.Session.Create(name, options)
+		}
+		if err != nil {
+			logger.Debug("provisioning folder failed", "mailbox", name, "use", attr, "error", err)
+		}
+	}
+
+	if tracked {
+		if err := prov.MarkProvisioned(); err != nil {
+			logger.Warn("recording folder provisioning failed", "error", err)
+		}
+	}
+}
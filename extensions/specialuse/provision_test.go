@@ -0,0 +1,113 @@
+package specialuse
+
+import (
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/imaptest/mock"
+	"github.com/meszmate/imap-go/server"
+)
+
+// provisionMockSession records created mailboxes and provisioning state.
+type provisionMockSession struct {
+	mock.Session
+	created     map[string]imap.MailboxAttr
+	provisioned bool
+}
+
+func (m *provisionMockSession) NeedsProvisioning() (bool, error) {
+	return !m.provisioned, nil
+}
+
+func (m *provisionMockSession) MarkProvisioned() error {
+	m.provisioned = true
+	return nil
+}
+
+func newProvisionSession() *provisionMockSession {
+	m := &provisionMockSession{created: map[string]imap.MailboxAttr{}}
+	m.CreateFunc = func(mailbox string, options *imap.CreateOptions) error {
+		m.created[mailbox] = options.SpecialUse
+		return nil
+	}
+	return m
+}
+
+var loginHandler = server.CommandHandlerFunc(func(ctx *server.CommandContext) error {
+	return ctx.Conn.SetState(imap.ConnStateAuthenticated)
+})
+
+func TestProvisioning_FirstLogin(t *testing.T) {
+	ext := New().WithProvisioning(&Provisioning{})
+	h := ext.WrapHandler("LOGIN", loginHandler).(server.CommandHandlerFunc)
+
+	sess := newProvisionSession()
+	if err := h.Handle(newTestCommandContext(t, "", sess)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]imap.MailboxAttr{
+		"Sent":    imap.MailboxAttrSent,
+		"Drafts":  imap.MailboxAttrDrafts,
+		"Trash":   imap.MailboxAttrTrash,
+		"Junk":    imap.MailboxAttrJunk,
+		"Archive": imap.MailboxAttrArchive,
+	}
+	if len(sess.created) != len(want) {
+		t.Fatalf("created = %v, want %v", sess.created, want)
+	}
+	for name, attr := range want {
+		if sess.created[name] != attr {
+			t.Errorf("created[%q] = %q, want %q", name, sess.created[name], attr)
+		}
+	}
+	if !sess.provisioned {
+		t.Error("MarkProvisioned was not called")
+	}
+
+	// A second login does not provision again.
+	sess.created = map[string]imap.MailboxAttr{}
+	if err := h.Handle(newTestCommandContext(t, "", sess)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sess.created) != 0 {
+		t.Errorf("created = %v on second login, want none", sess.created)
+	}
+}
+
+func TestProvisioning_Locale(t *testing.T) {
+	ext := New().WithProvisioning(&Provisioning{
+		Folders: []imap.MailboxAttr{imap.MailboxAttrSent, imap.MailboxAttrTrash},
+		Locale:  func(*server.Conn) string { return "de" },
+	})
+	h := ext.WrapHandler("AUTHENTICATE", loginHandler).(server.CommandHandlerFunc)
+
+	sess := newProvisionSession()
+	if err := h.Handle(newTestCommandContext(t, "", sess)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sess.created) != 2 || sess.created["Gesendet"] != imap.MailboxAttrSent || sess.created["Papierkorb"] != imap.MailboxAttrTrash {
+		t.Errorf("created = %v, want Gesendet and Papierkorb", sess.created)
+	}
+}
+
+func TestProvisioning_FailedLogin(t *testing.T) {
+	ext := New().WithProvisioning(&Provisioning{})
+	failing := server.CommandHandlerFunc(func(ctx *server.CommandContext) error {
+		return imap.ErrNo("invalid credentials")
+	})
+	h := ext.WrapHandler("LOGIN", failing).(server.CommandHandlerFunc)
+
+	sess := newProvisionSession()
+	if err := h.Handle(newTestCommandContext(t, "", sess)); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(sess.created) != 0 {
+		t.Errorf("created = %v after failed login, want none", sess.created)
+	}
+}
+
+func TestWrapHandler_LoginWithoutProvisioning(t *testing.T) {
+	if New().WrapHandler("LOGIN", dummyHandler) != nil {
+		t.Error("WrapHandler(LOGIN) should return nil without provisioning")
+	}
+}
@@ -84,26 +84,28 @@ func handleThread(ctx *server.CommandContext) error {
 		return nil
 	}
 
-	// Read SP and charset
+	// Read SP, then charset and search criteria
 	if err := dec.ReadSP(); err != nil {
 		ctx.Conn.WriteBAD(ctx.Tag, "Expected charset")
 		return nil
 	}
-	_, err = dec.ReadAtom()
+	var parser server.SearchParser
+	searchCriteria, err := parser.ParseWithCharset(dec)
 	if err != nil {
-		ctx.Conn.WriteBAD(ctx.Tag, "Invalid charset")
-		return nil
+		return err
+	}
+	if err := ctx.Conn.CheckSearchCriteria(searchCriteria); err != nil {
+		return err
 	}
-
-	// The remaining arguments are search criteria. For now, use a basic
-	// ALL search criteria since full search criteria parsing is complex.
-	searchCriteria := &imap.SearchCriteria{}
 
 	data, err := sess.Thread(ctx.NumKind, algorithm, searchCriteria, &imap.SearchOptions{})
 	if err != nil {
 		ctx.Conn.WriteNO(ctx.Tag, fmt.Sprintf("THREAD failed: %v", err))
 		return nil
 	}
+	if err := ctx.Conn.CheckSearchResults(countThreadMessages(data.Threads)); err != nil {
+		return err
+	}
 
 	// Write untagged THREAD response: * THREAD (thread1)(thread2)...
 	ctx.Conn.Encoder().Encode(func(enc *wire.Encoder) {
@@ -129,3 +131,12 @@ func writeThread(enc *wire.Encoder, t *imap.Thread) {
 	}
 	enc.EndList()
 }
+
+// countThreadMessages returns the number of messages in threads.
+func countThreadMessages(threads []imap.Thread) int {
+	n := 0
+	for i := range threads {
+		n += 1 + countThreadMessages(threads[i].Children)
+	}
+	return n
+}
@@ -38,7 +38,7 @@ type Extension struct {
 	extension.BaseExtension
 }
 
-var _ extension.ServerExtension = (*Extension)(nil)
+var _ extension.WrapDescriber = (*Extension)(nil)
 
 // New creates a new UIDONLY extension.
 func New() *Extension {
@@ -120,6 +120,24 @@ func (e *Extension) WrapHandler(name string, handler interface{}) interface{} {
 	return nil
 }
 
+// DescribeWrap describes the wrappers installed by WrapHandler. With
+// UIDONLY enabled, UID FETCH, UID STORE, UID EXPUNGE and UID MOVE are
+// handled here, including the CONDSTORE and QRESYNC modifiers; the other
+// wrappers only reject sequence numbers and delegate.
+func (e *Extension) DescribeWrap(command string) extension.WrapInfo {
+	switch command {
+	case "FETCH":
+		return extension.WrapInfo{Replaces: true, Supersedes: []string{"CONDSTORE", "QRESYNC"}}
+	case "STORE":
+		return extension.WrapInfo{Replaces: true, Supersedes: []string{"CONDSTORE"}}
+	case "EXPUNGE":
+		return extension.WrapInfo{Replaces: true, Supersedes: []string{"UIDPLUS"}}
+	case "MOVE":
+		return extension.WrapInfo{Replaces: true}
+	}
+	return extension.WrapInfo{}
+}
+
 // SessionExtension returns a typed nil pointer to SessionUIDOnly, indicating
 // that sessions should implement this interface for full UIDONLY support.
 func (e *Extension) SessionExtension() interface{} {
@@ -189,14 +207,11 @@ func handleUIDOnlyFetch(ctx *server.CommandContext, original server.CommandHandl
 	dec := ctx.Decoder
 
 	// Read UID set
-	uidSetStr, err := dec.ReadAtom()
-	if err != nil {
-		return imap.ErrBad("invalid UID set")
-	}
-	uidSet, err := imap.ParseUIDSet(uidSetStr)
+	numSet, err := server.ParseNumSet(ctx)
 	if err != nil {
-		return imap.ErrBad("invalid UID set")
+		return err
 	}
+	uidSet := numSet.(*imap.UIDSet)
 
 	if err := dec.ReadSP(); err != nil {
 		return imap.ErrBad("missing fetch items")
@@ -256,7 +271,7 @@ func handleUIDOnlyFetch(ctx *server.CommandContext, original server.CommandHandl
 
 	w := server.NewFetchWriter(ctx.Conn.Encoder())
 	w.SetUIDOnly(true)
-	if err := ctx.Session.Fetch(w, uidSet, options); err != nil {
+	if err := server.RunFetch(ctx, w, uidSet, options); err != nil {
 		return err
 	}
 
@@ -285,14 +300,11 @@ func handleUIDOnlyStore(ctx *server.CommandContext, original server.CommandHandl
 	dec := ctx.Decoder
 
 	// Read UID set
-	uidSetStr, err := dec.ReadAtom()
-	if err != nil {
-		return imap.ErrBad("invalid UID set")
-	}
-	uidSet, err := imap.ParseUIDSet(uidSetStr)
+	numSet, err := server.ParseNumSet(ctx)
 	if err != nil {
-		return imap.ErrBad("invalid UID set")
+		return err
 	}
+	uidSet := numSet.(*imap.UIDSet)
 
 	if err := dec.ReadSP(); err != nil {
 		return imap.ErrBad("missing store action")
@@ -403,15 +415,11 @@ func handleUIDOnlyExpunge(ctx *server.CommandContext, original server.CommandHan
 	// EXPUNGE with UIDONLY — create VANISHED-emitting writer
 	var uids *imap.UIDSet
 	if ctx.NumKind == server.NumKindUID && ctx.Decoder != nil {
-		uidStr, err := ctx.Decoder.ReadAtom()
-		if err != nil {
-			return imap.ErrBad("invalid UID set")
-		}
-		uidSet, err := imap.ParseUIDSet(uidStr)
+		numSet, err := server.ParseNumSet(ctx)
 		if err != nil {
-			return imap.ErrBad("invalid UID set")
+			return err
 		}
-		uids = uidSet
+		uids = numSet.(*imap.UIDSet)
 	}
 
 	w := server.NewExpungeWriter(ctx.Conn.Encoder())
@@ -444,25 +452,27 @@ func handleUIDOnlyMove(ctx *server.CommandContext, original server.CommandHandle
 
 	dec := ctx.Decoder
 
-	setStr, err := dec.ReadAtom()
-	if err != nil {
-		return imap.ErrBad("invalid message set")
-	}
-
-	uidSet, err := imap.ParseUIDSet(setStr)
+	numSet, err := server.ParseNumSet(ctx)
 	if err != nil {
-		return imap.ErrBad("invalid UID set")
+		return err
 	}
+	uidSet := numSet.(*imap.UIDSet)
 
 	if err := dec.ReadSP(); err != nil {
 		return imap.ErrBad("missing destination mailbox")
 	}
 
-	dest, err := dec.ReadAString()
+	dest, err := dec.ReadMailbox()
 	if err != nil {
 		return imap.ErrBad("invalid destination mailbox")
 	}
 
+	dest = imap.CanonicalMailboxName(dest)
+
+	if err := ctx.Conn.CheckMailboxAccess(dest); err != nil {
+		return err
+	}
+
 	sessMove, ok := ctx.Session.(server.SessionMove)
 	if !ok {
 		return imap.ErrNo("MOVE not supported")
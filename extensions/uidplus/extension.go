@@ -13,8 +13,6 @@
 package uidplus
 
 import (
-	"fmt"
-
 	imap "github.com/meszmate/imap-go"
 	"github.com/meszmate/imap-go/extension"
 	"github.com/meszmate/imap-go/server"
@@ -40,7 +38,7 @@ type Extension struct {
 	extension.BaseExtension
 }
 
-var _ extension.ServerExtension = (*Extension)(nil)
+var _ extension.WrapDescriber = (*Extension)(nil)
 
 // New creates a new UIDPLUS extension.
 func New() *Extension {
@@ -86,6 +84,12 @@ func (e *Extension) WrapHandler(name string, handler interface{}) interface{} {
 	return nil
 }
 
+// DescribeWrap describes the wrappers installed by WrapHandler, which
+// handle COPY and EXPUNGE completely.
+func (e *Extension) DescribeWrap(command string) extension.WrapInfo {
+	return extension.WrapInfo{Replaces: true}
+}
+
 // SessionExtension returns a typed nil pointer to SessionUIDPlus, indicating
 // that sessions should implement this interface for full UIDPLUS support.
 func (e *Extension) SessionExtension() interface{} {
@@ -105,35 +109,26 @@ func handleUIDPlusCopy(ctx *server.CommandContext, _ server.CommandHandlerFunc)
 	}
 
 	// Read sequence set
-	seqSetStr, err := ctx.Decoder.ReadAtom()
+	numSet, err := server.ParseNumSet(ctx)
 	if err != nil {
-		return imap.ErrBad("invalid sequence set")
-	}
-
-	var numSet imap.NumSet
-	if ctx.NumKind == server.NumKindUID {
-		uidSet, err := imap.ParseUIDSet(seqSetStr)
-		if err != nil {
-			return imap.ErrBad("invalid UID set")
-		}
-		numSet = uidSet
-	} else {
-		seqSet, err := imap.ParseSeqSet(seqSetStr)
-		if err != nil {
-			return imap.ErrBad("invalid sequence set")
-		}
-		numSet = seqSet
+		return err
 	}
 
 	if err := ctx.Decoder.ReadSP(); err != nil {
 		return imap.ErrBad("missing destination mailbox")
 	}
 
-	dest, err := ctx.Decoder.ReadAString()
+	dest, err := ctx.Decoder.ReadMailbox()
 	if err != nil {
 		return imap.ErrBad("invalid destination mailbox")
 	}
 
+	dest = imap.CanonicalMailboxName(dest)
+
+	if err := ctx.Conn.CheckMailboxAccess(dest); err != nil {
+		return err
+	}
+
 	// Route to SessionUIDPlus.CopyUIDs if available, else Session.Copy
 	var data *imap.CopyData
 	if sess, ok := ctx.Session.(SessionUIDPlus); ok {
@@ -147,11 +142,9 @@ func handleUIDPlusCopy(ctx *server.CommandContext, _ server.CommandHandlerFunc)
 
 	// Write tagged OK, optionally with COPYUID response code
 	if data != nil && data.UIDValidity > 0 {
-		code := fmt.Sprintf("COPYUID %d %s %s",
-			data.UIDValidity,
-			data.SourceUIDs.String(),
-			data.DestUIDs.String())
-		ctx.Conn.WriteOKCode(ctx.Tag, code, "COPY completed")
+		data.Normalize()
+		ctx.Conn.WriteOKCode(ctx.Tag, imap.ResponseCodeCopyUID, "COPY completed",
+			data.UIDValidity, &data.SourceUIDs, &data.DestUIDs)
 	} else {
 		ctx.Conn.WriteOK(ctx.Tag, "COPY completed")
 	}
@@ -165,15 +158,11 @@ func handleUIDPlusExpunge(ctx *server.CommandContext, _ server.CommandHandlerFun
 	// For UID EXPUNGE, parse the UID set
 	var uids *imap.UIDSet
 	if ctx.NumKind == server.NumKindUID && ctx.Decoder != nil {
-		uidStr, err := ctx.Decoder.ReadAtom()
-		if err != nil {
-			return imap.ErrBad("invalid UID set")
-		}
-		uidSet, err := imap.ParseUIDSet(uidStr)
+		numSet, err := server.ParseNumSet(ctx)
 		if err != nil {
-			return imap.ErrBad("invalid UID set")
+			return err
 		}
-		uids = uidSet
+		uids = numSet.(*imap.UIDSet)
 	}
 
 	w := server.NewExpungeWriter(ctx.Conn.Encoder())
@@ -1,16 +1,13 @@
 package uidplus
 
 import (
-	"bytes"
-	"context"
-	"net"
 	"strings"
 	"testing"
 
 	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/imaptest"
 	"github.com/meszmate/imap-go/imaptest/mock"
 	"github.com/meszmate/imap-go/server"
-	"github.com/meszmate/imap-go/wire"
 )
 
 // uidplusMockSession embeds mock.Session and adds CopyUIDs and ExpungeUIDs.
@@ -47,86 +44,13 @@ var dummyHandler = server.CommandHandlerFunc(func(ctx *server.CommandContext) er
 
 func newTestCommandContext(t *testing.T, args string, sess server.Session) *server.CommandContext {
 	t.Helper()
-
-	clientConn, serverConn := net.Pipe()
-	t.Cleanup(func() {
-		_ = clientConn.Close()
-		_ = serverConn.Close()
-	})
-
-	conn := server.NewTestConn(serverConn, nil)
-
-	// Drain output to prevent blocking
-	go func() {
-		buf := make([]byte, 4096)
-		for {
-			_, err := clientConn.Read(buf)
-			if err != nil {
-				return
-			}
-		}
-	}()
-
-	var dec *wire.Decoder
-	if args != "" {
-		dec = wire.NewDecoder(strings.NewReader(args))
-	}
-
-	return &server.CommandContext{
-		Context: context.Background(),
-		Tag:     "A001",
-		Name:    "TEST",
-		NumKind: server.NumKindSeq,
-		Conn:    conn,
-		Session: sess,
-		Decoder: dec,
-	}
+	return imaptest.NewCommandContext(t, "TEST", args, sess)
 }
 
 // newTestCommandContextCapture creates a command context that captures output.
-func newTestCommandContextCapture(t *testing.T, args string, sess server.Session) (*server.CommandContext, *bytes.Buffer, chan struct{}) {
+func newTestCommandContextCapture(t *testing.T, args string, sess server.Session) (*server.CommandContext, *imaptest.Output) {
 	t.Helper()
-
-	clientConn, serverConn := net.Pipe()
-	t.Cleanup(func() {
-		_ = clientConn.Close()
-		_ = serverConn.Close()
-	})
-
-	conn := server.NewTestConn(serverConn, nil)
-
-	var outBuf bytes.Buffer
-	done := make(chan struct{})
-	go func() {
-		defer close(done)
-		buf := make([]byte, 8192)
-		for {
-			n, err := clientConn.Read(buf)
-			if n > 0 {
-				outBuf.Write(buf[:n])
-			}
-			if err != nil {
-				return
-			}
-		}
-	}()
-
-	var dec *wire.Decoder
-	if args != "" {
-		dec = wire.NewDecoder(strings.NewReader(args))
-	}
-
-	ctx := &server.CommandContext{
-		Context: context.Background(),
-		Tag:     "A001",
-		Name:    "TEST",
-		NumKind: server.NumKindSeq,
-		Conn:    conn,
-		Session: sess,
-		Decoder: dec,
-	}
-
-	return ctx, &outBuf, done
+	return imaptest.CaptureOutput(t, "TEST", args, sess)
 }
 
 func TestNew(t *testing.T) {
@@ -241,15 +165,12 @@ func TestCopy_COPYUID_ResponseCode(t *testing.T) {
 		},
 	}
 
-	ctx, outBuf, done := newTestCommandContextCapture(t, "1:3 \"Trash\"", sess)
+	ctx, outBuf := newTestCommandContextCapture(t, "1:3 \"Trash\"", sess)
 
 	if err := h.Handle(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	output := outBuf.String()
 	if !strings.Contains(output, "COPYUID 42") {
 		t.Errorf("response should contain COPYUID 42, got: %s", output)
@@ -433,15 +354,12 @@ func TestCopy_PlainOK_NoCOPYUID(t *testing.T) {
 		},
 	}
 
-	ctx, outBuf, done := newTestCommandContextCapture(t, "1 INBOX", sess)
+	ctx, outBuf := newTestCommandContextCapture(t, "1 INBOX", sess)
 
 	if err := h.Handle(ctx); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_ = ctx.Conn.Close()
-	<-done
-
 	output := outBuf.String()
 	if strings.Contains(output, "COPYUID") {
 		t.Errorf("response should NOT contain COPYUID when UIDValidity is 0, got: %s", output)
@@ -77,6 +77,7 @@ func handleUnauthenticate(ctx *server.CommandContext) error {
 		ctx.Conn.WriteNO(ctx.Tag, fmt.Sprintf("UNAUTHENTICATE failed: %v", err))
 		return nil
 	}
+	ctx.Conn.SetUsername("")
 
 	ctx.Conn.WriteOK(ctx.Tag, "UNAUTHENTICATE completed")
 	return nil
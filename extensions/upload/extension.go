@@ -0,0 +1,513 @@
+// Package upload implements XUPLOAD, a vendor extension for resumable
+// APPEND of large messages.
+//
+// A plain APPEND sends the message as a single literal: if the connection
+// drops after 90MB of a 100MB message, the client has to start again from
+// zero. With XUPLOAD the client first creates an upload, sends the
+// message in chunks, and appends the upload to a mailbox once it is
+// complete. The server keeps the chunks it acknowledged across
+// connections, so that a client that lost its connection reconnects, asks
+// for the acknowledged offset and continues from there:
+//
+//	C: a XUPLOAD BEGIN 104857600
+//	S: * XUPLOAD 9f86d081884c7d65 0
+//	S: a OK XUPLOAD BEGIN completed
+//	C: b XUPLOAD DATA 9f86d081884c7d65 0 {4194304}
+//	S: + Ready for upload data
+//	C: <4194304 bytes>
+//	S: * XUPLOAD 9f86d081884c7d65 4194304
+//	S: b OK XUPLOAD DATA completed
+//	   ... connection lost, client reconnects and logs in ...
+//	C: c XUPLOAD STATUS 9f86d081884c7d65
+//	S: * XUPLOAD 9f86d081884c7d65 4194304
+//	S: c OK XUPLOAD STATUS completed
+//	   ... remaining DATA commands ...
+//	C: d XUPLOAD FINISH 9f86d081884c7d65 INBOX (\Seen) "05-Mar-2024 10:00:00 +0000"
+//	S: d OK [APPENDUID 38505 3955] XUPLOAD FINISH completed
+//
+// XUPLOAD ABORT discards an upload. Uploads belong to the user who began
+// them and are discarded if they are not finished in time.
+//
+// The message is appended with the APPEND handler's session method, so
+// the session needs no support for the extension.
+package upload
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/extension"
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/wire"
+)
+
+// CapXUpload is the capability advertised by servers that support
+// resumable uploads.
+const CapXUpload imap.Cap = "XUPLOAD"
+
+const (
+	// DefaultMaxSize is the default maximum size of an upload.
+	DefaultMaxSize = 1 << 30
+	// DefaultExpiry is the default time after which an upload that was not
+	// written to is discarded.
+	DefaultExpiry = 24 * time.Hour
+)
+
+// Option configures the extension.
+type Option func(*Extension)
+
+// WithDir sets the directory the uploads are stored in until they are
+// finished. The default is the system's temporary directory.
+func WithDir(dir string) Option {
+	return func(e *Extension) { e.dir = dir }
+}
+
+// WithMaxSize sets the maximum size of an upload.
+func WithMaxSize(size int64) Option {
+	return func(e *Extension) { e.maxSize = size }
+}
+
+// WithExpiry sets the time after which an upload that was not written to
+// is discarded.
+func WithExpiry(d time.Duration) Option {
+	return func(e *Extension) { e.expiry = d }
+}
+
+// Extension implements the XUPLOAD command.
+type Extension struct {
+	extension.BaseExtension
+
+	dir     string
+	maxSize int64
+	expiry  time.Duration
+
+	mu      sync.Mutex
+	uploads map[string]*upload
+}
+
+// upload is an upload in progress.
+type upload struct {
+	token    string
+	username string
+	size     int64
+	path     string
+
+	// The fields below are protected by the extension's mutex.
+	offset  int64
+	busy    bool
+	touched time.Time
+}
+
+var (
+	_ extension.ServerExtension          = (*Extension)(nil)
+	_ extension.StateCapabilityExtension = (*Extension)(nil)
+)
+
+// New creates a new XUPLOAD extension.
+func New(opts ...Option) *Extension {
+	e := &Extension{
+		BaseExtension: extension.BaseExtension{
+			ExtName: "XUPLOAD",
+		},
+		dir:     os.TempDir(),
+		maxSize: DefaultMaxSize,
+		expiry:  DefaultExpiry,
+		uploads: make(map[string]*upload),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// StateCapabilities advertises XUPLOAD after authentication.
+func (e *Extension) StateCapabilities(state imap.ConnState, conn extension.ConnInfo) []imap.Cap {
+	if state == imap.ConnStateNotAuthenticated {
+		return nil
+	}
+	return []imap.Cap{CapXUpload}
+}
+
+// CommandHandlers returns the XUPLOAD command handler.
+func (e *Extension) CommandHandlers() map[string]interface{} {
+	return map[string]interface{}{
+		"XUPLOAD": server.CommandHandlerFunc(e.handle),
+	}
+}
+
+func (e *Extension) WrapHandler(name string, handler interface{}) interface{} { return nil }
+
+// SessionExtension returns nil: uploads are stored by the extension and
+// appended with the session's Append method.
+func (e *Extension) SessionExtension() interface{} { return nil }
+
+func (e *Extension) OnEnabled(connID string) error { return nil }
+
+// Close discards all uploads in progress.
+func (e *Extension) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for token, u := range e.uploads {
+		_ = os.Remove(u.path)
+		delete(e.uploads, token)
+	}
+	return nil
+}
+
+// handle handles the XUPLOAD command.
+func (e *Extension) handle(ctx *server.CommandContext) error {
+	state := ctx.Conn.State()
+	if state != imap.ConnStateAuthenticated && state != imap.ConnStateSelected {
+		return imap.ErrBad("XUPLOAD not allowed in current state")
+	}
+	if ctx.Decoder == nil {
+		return imap.ErrBad("missing arguments")
+	}
+
+	op, err := ctx.Decoder.ReadAtom()
+	if err != nil {
+		return imap.ErrBad("missing XUPLOAD operation")
+	}
+	op = strings.ToUpper(op)
+	if op == "BEGIN" {
+		return e.begin(ctx)
+	}
+
+	if err := ctx.Decoder.ReadSP(); err != nil {
+		return imap.ErrBad("missing upload token")
+	}
+	token, err := ctx.Decoder.ReadAtom()
+	if err != nil {
+		return imap.ErrBad("invalid upload token")
+	}
+
+	switch op {
+	case "DATA":
+		return e.data(ctx, token)
+	case "STATUS":
+		u, err := e.acquire(ctx, token)
+		if err != nil {
+			return err
+		}
+		offset := e.release(u, 0)
+		writeStatus(ctx, token, offset)
+		ctx.Conn.WriteOK(ctx.Tag, "XUPLOAD STATUS completed")
+		return nil
+	case "FINISH":
+		return e.finish(ctx, token)
+	case "ABORT":
+		u, err := e.acquire(ctx, token)
+		if err != nil {
+			return err
+		}
+		e.remove(u)
+		ctx.Conn.WriteOK(ctx.Tag, "XUPLOAD ABORT completed")
+		return nil
+	default:
+		return imap.ErrBad("unknown XUPLOAD operation " + op)
+	}
+}
+
+// begin handles XUPLOAD BEGIN size.
+func (e *Extension) begin(ctx *server.CommandContext) error {
+	if err := ctx.Decoder.ReadSP(); err != nil {
+		return imap.ErrBad("missing upload size")
+	}
+	size, err := ctx.Decoder.ReadNumber64()
+	if err != nil {
+		return imap.ErrBad("invalid upload size")
+	}
+	if int64(size) > e.maxSize {
+		return imap.ErrNoWithCode(imap.ResponseCodeLimit,
+			fmt.Sprintf("upload size exceeds the maximum of %d bytes", e.maxSize))
+	}
+
+	f, err := os.CreateTemp(e.dir, "xupload-")
+	if err != nil {
+		return imap.ErrNoWithCode(imap.ResponseCodeServerBug, "cannot store upload")
+	}
+	path := f.Name()
+	_ = f.Close()
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		_ = os.Remove(path)
+		return imap.ErrNoWithCode(imap.ResponseCodeServerBug, "cannot create upload token")
+	}
+	u := &upload{
+		token:    hex.EncodeToString(b),
+		username: ctx.Conn.Username(),
+		size:     int64(size),
+		path:     path,
+		touched:  time.Now(),
+	}
+
+	e.mu.Lock()
+	e.expireLocked(u.touched)
+	e.uploads[u.token] = u
+	e.mu.Unlock()
+
+	writeStatus(ctx, u.token, 0)
+	ctx.Conn.WriteOK(ctx.Tag, "XUPLOAD BEGIN completed")
+	return nil
+}
+
+// data handles XUPLOAD DATA token offset literal.
+func (e *Extension) data(ctx *server.CommandContext, token string) error {
+	offset, size, nonSync, err := readChunkHeader(ctx.Decoder)
+	if err != nil {
+		return imap.ErrBad(err.Error())
+	}
+
+	// The literal of a synchronizing chunk that is rejected is never
+	// sent; that of a non-synchronizing one has to be skipped.
+	reject := func(err error) error {
+		if nonSync {
+			_, _ = io.Copy(io.Discard, ctx.Conn.ReadLiteral(ctx.Name, size))
+			_, _ = ctx.Conn.Decoder().ReadLine()
+		}
+		return err
+	}
+
+	u, err := e.acquire(ctx, token)
+	if err != nil {
+		return reject(err)
+	}
+	e.mu.Lock()
+	current := u.offset
+	e.mu.Unlock()
+	if offset != current {
+		e.release(u, 0)
+		return reject(imap.ErrNo(fmt.Sprintf("upload is at offset %d, not %d", current, offset)))
+	}
+	if offset+size > u.size {
+		e.release(u, 0)
+		return reject(imap.ErrNo(fmt.Sprintf("chunk exceeds the upload size of %d bytes", u.size)))
+	}
+
+	if !nonSync {
+		ctx.Conn.WriteContinuation("Ready for upload data")
+	}
+	n, err := writeChunk(u.path, offset, ctx.Conn.ReadLiteral(ctx.Name, size))
+	if err == nil && n == size {
+		_, err = ctx.Conn.Decoder().ReadLine()
+	}
+	if err != nil || n != size {
+		// Only complete chunks are acknowledged: a partial one is dropped
+		// and the client sends it again.
+		_ = os.Truncate(u.path, offset)
+		e.release(u, 0)
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	offset = e.release(u, size)
+	writeStatus(ctx, token, offset)
+	ctx.Conn.WriteOK(ctx.Tag, "XUPLOAD DATA completed")
+	return nil
+}
+
+// finish handles XUPLOAD FINISH token mailbox [flags] [date-time].
+func (e *Extension) finish(ctx *server.CommandContext, token string) error {
+	if err := ctx.Decoder.ReadSP(); err != nil {
+		return imap.ErrBad("missing mailbox")
+	}
+	mailbox, err := ctx.Decoder.ReadMailbox()
+	if err != nil {
+		return imap.ErrBad("invalid mailbox name")
+	}
+	options, err := readAppendOptions(ctx.Decoder)
+	if err != nil {
+		return err
+	}
+
+	u, err := e.acquire(ctx, token)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	offset := u.offset
+	e.mu.Unlock()
+	if offset != u.size {
+		e.release(u, 0)
+		return imap.ErrNo(fmt.Sprintf("upload is incomplete: %d of %d bytes", offset, u.size))
+	}
+
+	f, err := os.Open(u.path)
+	if err != nil {
+		e.release(u, 0)
+		return imap.ErrNoWithCode(imap.ResponseCodeServerBug, "cannot read upload")
+	}
+	data, err := ctx.AppendMessage(imap.CanonicalMailboxName(mailbox),
+		imap.LiteralReader{Reader: f, Size: u.size}, options)
+	_ = f.Close()
+	if err != nil {
+		// The upload is kept, so that the client can try again, for
+		// example after creating the mailbox.
+		e.release(u, 0)
+		return err
+	}
+	e.remove(u)
+
+	if data != nil && data.UIDValidity > 0 && data.UID > 0 {
+		ctx.Conn.WriteOKCode(ctx.Tag, imap.ResponseCodeAppendUID, "XUPLOAD FINISH completed",
+			data.UIDValidity, data.UID)
+	} else {
+		ctx.Conn.WriteOK(ctx.Tag, "XUPLOAD FINISH completed")
+	}
+	return nil
+}
+
+// acquire returns the upload with the given token and marks it busy until
+// release is called. Uploads of other users do not exist.
+func (e *Extension) acquire(ctx *server.CommandContext, token string) (*upload, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.expireLocked(time.Now())
+	u, ok := e.uploads[token]
+	if !ok || u.username != ctx.Conn.Username() {
+		return nil, imap.ErrNoWithCode(imap.ResponseCodeNonExistent, "no such upload")
+	}
+	if u.busy {
+		return nil, imap.ErrNoWithCode(imap.ResponseCodeInUse, "upload is in use by another command")
+	}
+	u.busy = true
+	return u, nil
+}
+
+// release marks an upload acquired with acquire as no longer busy, after
+// written bytes were added to it, and returns its offset.
+func (e *Extension) release(u *upload, written int64) int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	u.offset += written
+	u.busy = false
+	u.touched = time.Now()
+	return u.offset
+}
+
+// remove discards an upload acquired with acquire.
+func (e *Extension) remove(u *upload) {
+	e.mu.Lock()
+	delete(e.uploads, u.token)
+	e.mu.Unlock()
+	_ = os.Remove(u.path)
+}
+
+// expireLocked discards the uploads that were not used since the expiry.
+func (e *Extension) expireLocked(now time.Time) {
+	for token, u := range e.uploads {
+		if !u.busy && now.Sub(u.touched) > e.expiry {
+			_ = os.Remove(u.path)
+			delete(e.uploads, token)
+		}
+	}
+}
+
+// writeStatus writes the untagged XUPLOAD response with the acknowledged
+// offset of an upload.
+func writeStatus(ctx *server.CommandContext, token string, offset int64) {
+	ctx.Conn.Encoder().Encode(func(enc *wire.Encoder) {
+		enc.Star().Atom("XUPLOAD").SP().Atom(token).SP().Number64(uint64(offset)).CRLF()
+	})
+}
+
+// writeChunk writes a chunk at offset in the file at path and returns the
+// number of bytes written.
+func writeChunk(path string, offset int64, r io.Reader) (int64, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(io.NewOffsetWriter(f, offset), r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
+
+// readChunkHeader reads the offset and literal header of XUPLOAD DATA.
+func readChunkHeader(dec *wire.Decoder) (offset, size int64, nonSync bool, err error) {
+	if err := dec.ReadSP(); err != nil {
+		return 0, 0, false, fmt.Errorf("missing offset")
+	}
+	n, err := dec.ReadNumber64()
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("invalid offset")
+	}
+	if err := dec.ReadSP(); err != nil {
+		return 0, 0, false, fmt.Errorf("missing upload data")
+	}
+
+	// The literal header ends the line, which the decoder holds without
+	// its CRLF.
+	var sb strings.Builder
+	for {
+		b, err := dec.PeekByte()
+		if err != nil {
+			break
+		}
+		_ = dec.ExpectByte(b)
+		sb.WriteByte(b)
+	}
+	s := sb.String()
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return 0, 0, false, fmt.Errorf("expected literal, got %q", s)
+	}
+	s = s[1 : len(s)-1]
+	if strings.HasSuffix(s, "+") {
+		nonSync = true
+		s = s[:len(s)-1]
+	}
+	size, err = strconv.ParseInt(s, 10, 64)
+	if err != nil || size < 0 {
+		return 0, 0, false, fmt.Errorf("invalid literal size %q", s)
+	}
+	return int64(n), size, nonSync, nil
+}
+
+// readAppendOptions reads the optional flag list and date-time of
+// XUPLOAD FINISH.
+func readAppendOptions(dec *wire.Decoder) (*imap.AppendOptions, error) {
+	options := &imap.AppendOptions{}
+	for dec.ReadSP() == nil {
+		b, err := dec.PeekByte()
+		if err != nil {
+			return nil, imap.ErrBad("unexpected end of command")
+		}
+		switch {
+		case b == '(' && options.Flags == nil:
+			flags, err := dec.ReadFlags()
+			if err != nil {
+				return nil, imap.ErrBad("invalid flags")
+			}
+			options.Flags = []imap.Flag{}
+			for _, f := range flags {
+				options.Flags = append(options.Flags, imap.Flag(f))
+			}
+		case b == '"' && options.InternalDate.IsZero():
+			s, err := dec.ReadQuotedString()
+			if err != nil {
+				return nil, imap.ErrBad("invalid date-time")
+			}
+			t, err := time.Parse(imap.InternalDateLayout, s)
+			if err != nil {
+				return nil, imap.ErrBad("invalid date-time format")
+			}
+			options.InternalDate = t
+		default:
+			return nil, imap.ErrBad("unexpected argument")
+		}
+	}
+	return options, nil
+}
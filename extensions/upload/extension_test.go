@@ -0,0 +1,287 @@
+package upload
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client"
+	"github.com/meszmate/imap-go/imaptest"
+	"github.com/meszmate/imap-go/server"
+	_ "github.com/meszmate/imap-go/server/commands"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+// newHarness starts a memserver with alice and bob and the given server
+// options.
+func newHarness(t *testing.T, opts ...server.Option) *imaptest.Harness {
+	t.Helper()
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	mem.AddUser("bob", "secret")
+	return imaptest.NewHarness(t, mem.NewServer(opts...))
+}
+
+// dial connects to the harness and logs in as user. run sends a command,
+// which may include literals, and returns its responses.
+func dial(t *testing.T, h *imaptest.Harness, user string) (run func(command string) (untagged []string, tagged string)) {
+	t.Helper()
+	conn, err := net.Dial("tcp", h.Addr())
+	if err != nil {
+		t.Fatalf("Dial() error: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	if _, err := r.ReadString('\n'); err != nil {
+		t.Fatalf("greeting: %v", err)
+	}
+
+	run = func(command string) (untagged []string, tagged string) {
+		t.Helper()
+		tag, _, _ := strings.Cut(command, " ")
+		if _, err := conn.Write([]byte(command + "\r\n")); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if strings.HasPrefix(line, tag+" ") {
+				return untagged, line
+			}
+			untagged = append(untagged, line)
+		}
+	}
+	if _, tagged := run("L LOGIN " + user + " secret"); !strings.HasPrefix(tagged, "L OK") {
+		t.Fatalf("LOGIN: %s", tagged)
+	}
+	return run
+}
+
+// begin creates an upload of size bytes and returns its token.
+func begin(t *testing.T, run func(string) ([]string, string), size string) string {
+	t.Helper()
+	untagged, tagged := run("B XUPLOAD BEGIN " + size)
+	if tagged != "B OK XUPLOAD BEGIN completed" || len(untagged) != 1 {
+		t.Fatalf("XUPLOAD BEGIN = %q, %q", untagged, tagged)
+	}
+	fields := strings.Fields(untagged[0])
+	if len(fields) != 4 || fields[3] != "0" {
+		t.Fatalf("XUPLOAD BEGIN response = %q", untagged[0])
+	}
+	return fields[2]
+}
+
+func TestUpload(t *testing.T) {
+	dir := t.TempDir()
+	h := newHarness(t, server.WithExtensions(New(WithDir(dir), WithMaxSize(1000))))
+	run := dial(t, h, "alice")
+
+	if untagged, _ := run("C CAPABILITY"); len(untagged) != 1 || !strings.Contains(untagged[0], " XUPLOAD") {
+		t.Errorf("CAPABILITY = %q, want XUPLOAD", untagged)
+	}
+	if _, tagged := run("B XUPLOAD BEGIN 1001"); !strings.HasPrefix(tagged, "B NO [LIMIT]") {
+		t.Errorf("XUPLOAD BEGIN above the maximum size = %q", tagged)
+	}
+
+	const msg = "Subject: resumed\r\n\r\nHello, world!\r\n"
+	token := begin(t, run, "35")
+
+	untagged, tagged := run("D1 XUPLOAD DATA " + token + " 0 {20+}\r\n" + msg[:20])
+	if tagged != "D1 OK XUPLOAD DATA completed" || len(untagged) != 1 || untagged[0] != "* XUPLOAD "+token+" 20" {
+		t.Fatalf("XUPLOAD DATA = %q, %q", untagged, tagged)
+	}
+	// A chunk at the wrong offset is rejected, and its non-synchronizing
+	// literal skipped.
+	if _, tagged := run("D2 XUPLOAD DATA " + token + " 0 {3+}\r\nabc"); tagged != "D2 NO upload is at offset 20, not 0" {
+		t.Errorf("XUPLOAD DATA at the wrong offset = %q", tagged)
+	}
+	if _, tagged := run("D3 XUPLOAD DATA " + token + " 20 {16+}\r\n" + msg[20:] + "!"); !strings.HasPrefix(tagged, "D3 NO") {
+		t.Errorf("XUPLOAD DATA beyond the size = %q", tagged)
+	}
+	if _, tagged := run("F XUPLOAD FINISH " + token + " INBOX"); !strings.HasPrefix(tagged, "F NO upload is incomplete") {
+		t.Errorf("XUPLOAD FINISH of an incomplete upload = %q", tagged)
+	}
+
+	// The upload continues on another connection, but only the user who
+	// began it sees it.
+	if _, tagged := dial(t, h, "bob")("S XUPLOAD STATUS " + token); tagged != "S NO [NONEXISTENT] no such upload" {
+		t.Errorf("XUPLOAD STATUS as another user = %q", tagged)
+	}
+	run = dial(t, h, "alice")
+	untagged, tagged = run("S XUPLOAD STATUS " + token)
+	if tagged != "S OK XUPLOAD STATUS completed" || len(untagged) != 1 || untagged[0] != "* XUPLOAD "+token+" 20" {
+		t.Fatalf("XUPLOAD STATUS = %q, %q", untagged, tagged)
+	}
+	if _, tagged := run("D4 XUPLOAD DATA " + token + " 20 {15+}\r\n" + msg[20:]); tagged != "D4 OK XUPLOAD DATA completed" {
+		t.Fatalf("XUPLOAD DATA = %q", tagged)
+	}
+	_, tagged = run("F XUPLOAD FINISH " + token + ` INBOX (\Flagged) "05-Mar-2024 10:00:00 +0000"`)
+	if !strings.HasPrefix(tagged, "F OK [APPENDUID ") {
+		t.Fatalf("XUPLOAD FINISH = %q", tagged)
+	}
+
+	run("X SELECT INBOX")
+	untagged, _ = run("Y FETCH 1 (FLAGS INTERNALDATE BODY.PEEK[])")
+	got := strings.Join(untagged, "\n")
+	for _, want := range []string{`\Flagged`, `"05-Mar-2024 10:00:00 +0000"`, "Hello, world!"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("FETCH = %q, want %q", got, want)
+		}
+	}
+	if _, tagged := run("S XUPLOAD STATUS " + token); !strings.HasPrefix(tagged, "S NO [NONEXISTENT]") {
+		t.Errorf("XUPLOAD STATUS after FINISH = %q", tagged)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("uploads left after FINISH: %v", files)
+	}
+}
+
+func TestUpload_AbortAndExpiry(t *testing.T) {
+	dir := t.TempDir()
+	h := newHarness(t, server.WithExtensions(New(WithDir(dir), WithExpiry(time.Hour))))
+	run := dial(t, h, "alice")
+
+	token := begin(t, run, "10")
+	if _, tagged := run("A XUPLOAD ABORT " + token); tagged != "A OK XUPLOAD ABORT completed" {
+		t.Errorf("XUPLOAD ABORT = %q", tagged)
+	}
+	if _, tagged := run("S XUPLOAD STATUS " + token); !strings.HasPrefix(tagged, "S NO [NONEXISTENT]") {
+		t.Errorf("XUPLOAD STATUS after ABORT = %q", tagged)
+	}
+
+	ext := New(WithDir(dir), WithExpiry(time.Millisecond))
+	run = dial(t, newHarness(t, server.WithExtensions(ext)), "alice")
+	token = begin(t, run, "10")
+	time.Sleep(5 * time.Millisecond)
+	if _, tagged := run("S XUPLOAD STATUS " + token); !strings.HasPrefix(tagged, "S NO [NONEXISTENT]") {
+		t.Errorf("XUPLOAD STATUS of an expired upload = %q", tagged)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("uploads left after ABORT and expiry: %v", files)
+	}
+}
+
+// interruptingReader closes a client's connection once the bytes at
+// offset are read.
+type interruptingReader struct {
+	*bytes.Reader
+	offset int64
+	c      *client.Client
+}
+
+func (r *interruptingReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.offset && r.c != nil {
+		_ = r.c.Close()
+		r.c = nil
+	}
+	return r.Reader.ReadAt(p, off)
+}
+
+func TestAppendResumable(t *testing.T) {
+	h := newHarness(t, server.WithExtensions(New(WithDir(t.TempDir()))))
+	login := func() *client.Client {
+		c := h.Dial()
+		if err := c.Login("alice", "secret"); err != nil {
+			t.Fatalf("Login() error: %v", err)
+		}
+		return c
+	}
+
+	msg := []byte("Subject: big\r\n\r\n" + strings.Repeat("0123456789abcdef", 64))
+	size := int64(len(msg))
+
+	c := login()
+	up := &client.Upload{}
+	var sent []int64
+	options := &client.ResumableAppendOptions{
+		Flags:     []imap.Flag{imap.FlagSeen},
+		ChunkSize: 256,
+		Upload:    up,
+		Progress:  func(n, total int64) { sent = append(sent, n) },
+	}
+	r := &interruptingReader{Reader: bytes.NewReader(msg), offset: 512, c: c}
+	if _, err := c.AppendResumable("INBOX", r, size, options); !client.IsTransient(err) {
+		t.Fatalf("AppendResumable() on a lost connection = %v, want a transient error", err)
+	}
+	if up.Token == "" || up.Offset != 512 {
+		t.Fatalf("Upload after the interruption = %+v, want offset 512", up)
+	}
+
+	c = login()
+	data, err := c.AppendResumable("INBOX", r, size, options)
+	if err != nil {
+		t.Fatalf("AppendResumable() error: %v", err)
+	}
+	if data.UID == 0 {
+		t.Errorf("AppendResumable() = %+v, want a UID", data)
+	}
+	if *up != (client.Upload{}) {
+		t.Errorf("Upload after completion = %+v, want zero", up)
+	}
+	if want := []int64{256, 512, 768, 1024, size}; !equalInts(sent, want) {
+		t.Errorf("progress = %v, want %v", sent, want)
+	}
+
+	if _, err := c.Select("INBOX", nil); err != nil {
+		t.Fatalf("Select() error: %v", err)
+	}
+	msgs, err := c.UIDFetchMessages("1:*", "(FLAGS BODY.PEEK[])")
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("UIDFetchMessages() = %d messages, %v", len(msgs), err)
+	}
+	for _, b := range msgs[0].BodySection {
+		if !bytes.Equal(b, msg) {
+			t.Errorf("appended message = %q, want %q", b, msg)
+		}
+	}
+	if len(msgs[0].Flags) != 1 || msgs[0].Flags[0] != imap.FlagSeen {
+		t.Errorf("flags = %v", msgs[0].Flags)
+	}
+}
+
+func TestAppendResumable_Fallback(t *testing.T) {
+	h := newHarness(t)
+	c := h.Dial()
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+
+	msg := []byte("Subject: plain\r\n\r\nNo XUPLOAD here.\r\n")
+	up := &client.Upload{}
+	data, err := c.AppendResumable("INBOX", bytes.NewReader(msg), int64(len(msg)),
+		&client.ResumableAppendOptions{Upload: up, ChunkSize: 8})
+	if err != nil {
+		t.Fatalf("AppendResumable() error: %v", err)
+	}
+	if data.UID == 0 || up.Token != "" {
+		t.Errorf("AppendResumable() = %+v, upload %+v", data, up)
+	}
+
+	_, err = c.AppendResumable("Missing", bytes.NewReader(msg), int64(len(msg)), nil)
+	var imapErr *imap.IMAPError
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeTryCreate {
+		t.Errorf("AppendResumable() to a missing mailbox = %v, want TRYCREATE", err)
+	}
+}
+
+func equalInts(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -172,7 +172,7 @@ func handleResetKey(ctx *server.CommandContext) error {
 	var mechanisms []string
 
 	if ctx.Decoder != nil {
-		mb, err := ctx.Decoder.ReadAString()
+		mb, err := ctx.Decoder.ReadMailbox()
 		if err == nil {
 			mailbox = mb
 
@@ -127,7 +127,7 @@ func handleUTF8Append(ctx *server.CommandContext, original server.CommandHandler
 	dec := ctx.Decoder
 
 	// Read mailbox name
-	mailbox, err := dec.ReadAString()
+	mailbox, err := dec.ReadMailbox()
 	if err != nil {
 		return imap.ErrBad("invalid mailbox name")
 	}
@@ -226,14 +226,13 @@ func handleUTF8Append(ctx *server.CommandContext, original server.CommandHandler
 
 	options.UTF8 = true
 
-	// Read the literal body from the connection's main decoder
-	connDec := ctx.Conn.Decoder()
+	// Read the literal body from the connection
 	literalReader := imap.LiteralReader{
-		Reader: connDec.ReadLiteral(litSize),
+		Reader: ctx.Conn.ReadLiteral(ctx.Name, litSize),
 		Size:   litSize,
 	}
 
-	data, err := ctx.Session.Append(mailbox, literalReader, options)
+	data, err := ctx.AppendMessage(mailbox, literalReader, options)
 	if err != nil {
 		_, _ = io.Copy(io.Discard, literalReader.Reader)
 		return err
@@ -241,7 +240,7 @@ func handleUTF8Append(ctx *server.CommandContext, original server.CommandHandler
 	_, _ = io.Copy(io.Discard, literalReader.Reader)
 
 	// Read closing parenthesis from connection decoder
-	if pErr := connDec.ExpectByte(')'); pErr != nil {
+	if pErr := ctx.Conn.Decoder().ExpectByte(')'); pErr != nil {
 		return imap.ErrBad("expected ')' after UTF8 literal")
 	}
 
@@ -261,13 +260,12 @@ func handleStandardAppend(ctx *server.CommandContext, dec *wire.Decoder, mailbox
 		options.Binary = true
 	}
 
-	connDec := ctx.Conn.Decoder()
 	literalReader := imap.LiteralReader{
-		Reader: connDec.ReadLiteral(litSize),
+		Reader: ctx.Conn.ReadLiteral(ctx.Name, litSize),
 		Size:   litSize,
 	}
 
-	data, err := ctx.Session.Append(mailbox, literalReader, options)
+	data, err := ctx.AppendMessage(mailbox, literalReader, options)
 	if err != nil {
 		_, _ = io.Copy(io.Discard, literalReader.Reader)
 		return err
@@ -281,9 +279,8 @@ func handleStandardAppend(ctx *server.CommandContext, dec *wire.Decoder, mailbox
 // writeAppendOK writes the tagged OK response, optionally with APPENDUID.
 func writeAppendOK(ctx *server.CommandContext, data *imap.AppendData) {
 	if data != nil && data.UIDValidity > 0 && data.UID > 0 {
-		ctx.Conn.WriteOKCode(ctx.Tag,
-			fmt.Sprintf("APPENDUID %d %d", data.UIDValidity, uint32(data.UID)),
-			"APPEND completed")
+		ctx.Conn.WriteOKCode(ctx.Tag, imap.ResponseCodeAppendUID, "APPEND completed",
+			data.UIDValidity, data.UID)
 	} else {
 		ctx.Conn.WriteOK(ctx.Tag, "APPEND completed")
 	}
@@ -2,6 +2,7 @@ package imap
 
 import (
 	"io"
+	"net/textproto"
 	"time"
 )
 
@@ -110,6 +111,12 @@ type FetchMessageData struct {
 // SectionReader is a reader for a FETCH body section.
 type SectionReader struct {
 	io.Reader
+	// Size is the size of the section in bytes. If it is positive, the
+	// server writes it as the size of the literal and then copies Reader
+	// as it reads it, so Reader must yield exactly Size bytes; a session
+	// can stream a message it knows the size of, such as from a
+	// server.MessageSizer, without reading it into memory. If Size is 0, Reader
+	// is read to its end first.
 	Size int64
 }
 
@@ -118,6 +125,9 @@ type FetchMessageBuffer struct {
 	SeqNum        uint32
 	Envelope      *Envelope
 	BodyStructure *BodyStructure
+	// RawBodyStructure is the BODYSTRUCTURE data item left unparsed by
+	// clients deferring its parsing until Structure is called.
+	RawBodyStructure string
 	Flags         []Flag
 	InternalDate  time.Time
 	RFC822Size    int64
@@ -132,6 +142,9 @@ type FetchMessageBuffer struct {
 
 	// BodySection maps section names to their content.
 	BodySection map[string][]byte
+	// Header holds the header fields parsed from HEADER and HEADER.FIELDS
+	// sections, if any were fetched.
+	Header textproto.MIMEHeader
 
 	// BinarySection maps part strings (e.g., "1.2") to decoded binary content.
 	BinarySection map[string][]byte
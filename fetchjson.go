@@ -0,0 +1,248 @@
+package imap
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The JSON forms of fetched messages are meant for queues and data lakes,
+// so their field names are part of the API: they are documented on the
+// MarshalJSON methods and only ever added to. Unset fields are left out,
+// dates are in RFC 3339 format, maps are written with sorted keys and
+// sections in order of their names, so that the same message always
+// encodes to the same bytes. Envelope, Address and BodyStructure decode
+// from their JSON forms with json.Unmarshal.
+
+// addressJSON is the JSON form of Address.
+type addressJSON struct {
+	Name    string `json:"name,omitempty"`
+	Mailbox string `json:"mailbox"`
+	Host    string `json:"host"`
+}
+
+// MarshalJSON implements json.Marshaler:
+//
+//	{"name":"Alice","mailbox":"alice","host":"example.org"}
+//
+// name is left out if empty.
+func (a Address) MarshalJSON() ([]byte, error) {
+	return json.Marshal(addressJSON(a))
+}
+
+// envelopeJSON is the JSON form of Envelope.
+type envelopeJSON struct {
+	Date      *time.Time `json:"date,omitempty"`
+	Subject   string     `json:"subject,omitempty"`
+	From      []*Address `json:"from,omitempty"`
+	Sender    []*Address `json:"sender,omitempty"`
+	ReplyTo   []*Address `json:"replyTo,omitempty"`
+	To        []*Address `json:"to,omitempty"`
+	Cc        []*Address `json:"cc,omitempty"`
+	Bcc       []*Address `json:"bcc,omitempty"`
+	InReplyTo string     `json:"inReplyTo,omitempty"`
+	MessageID string     `json:"messageId,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. The fields are "date",
+// "subject", the address lists "from", "sender", "replyTo", "to", "cc"
+// and "bcc", "inReplyTo" and "messageId"; empty ones are left out.
+func (e Envelope) MarshalJSON() ([]byte, error) {
+	return json.Marshal(envelopeJSON{
+		Date:      optionalTime(e.Date),
+		Subject:   e.Subject,
+		From:      e.From,
+		Sender:    e.Sender,
+		ReplyTo:   e.ReplyTo,
+		To:        e.To,
+		Cc:        e.Cc,
+		Bcc:       e.Bcc,
+		InReplyTo: e.InReplyTo,
+		MessageID: e.MessageID,
+	})
+}
+
+// bodyStructureJSON is the JSON form of BodyStructure.
+type bodyStructureJSON struct {
+	Type              string            `json:"type"`
+	Subtype           string            `json:"subtype"`
+	Params            map[string]string `json:"params,omitempty"`
+	ID                string            `json:"id,omitempty"`
+	Description       string            `json:"description,omitempty"`
+	Encoding          string            `json:"encoding,omitempty"`
+	Size              uint32            `json:"size,omitempty"`
+	Lines             uint32            `json:"lines,omitempty"`
+	Envelope          *Envelope         `json:"envelope,omitempty"`
+	BodyStructure     *BodyStructure    `json:"bodyStructure,omitempty"`
+	MD5               string            `json:"md5,omitempty"`
+	Disposition       string            `json:"disposition,omitempty"`
+	DispositionParams map[string]string `json:"dispositionParams,omitempty"`
+	Language          []string          `json:"language,omitempty"`
+	Location          string            `json:"location,omitempty"`
+	Children          []BodyStructure   `json:"children,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. The fields are "type" and
+// "subtype", always present, and "params", "id", "description",
+// "encoding", "size", "lines", "envelope" and "bodyStructure" of
+// message/rfc822 parts, "md5", "disposition", "dispositionParams",
+// "language", "location" and the "children" of multipart bodies; empty
+// ones are left out.
+func (bs BodyStructure) MarshalJSON() ([]byte, error) {
+	return json.Marshal(bodyStructureJSON{
+		Type:              bs.Type,
+		Subtype:           bs.Subtype,
+		Params:            bs.Params,
+		ID:                bs.ID,
+		Description:       bs.Description,
+		Encoding:          bs.Encoding,
+		Size:              bs.Size,
+		Lines:             bs.Lines,
+		Envelope:          bs.Envelope,
+		BodyStructure:     bs.BodyStructure,
+		MD5:               bs.MD5,
+		Disposition:       bs.Disposition,
+		DispositionParams: bs.DispositionParams,
+		Language:          bs.Language,
+		Location:          bs.Location,
+		Children:          bs.Children,
+	})
+}
+
+// SectionJSON is the JSON form of a fetched body or binary section.
+type SectionJSON struct {
+	// Section is the name of the section in a FETCH response, such as
+	// "BODY[1.TEXT]<0>" or "BINARY[2]".
+	Section string `json:"section"`
+	// Size is the size of the section data in bytes.
+	Size int64 `json:"size"`
+	// Data is the section data, base64-encoded. It is only set for
+	// messages buffered in memory; the sections of a FetchMessageData are
+	// streamed and only referenced by name and size.
+	Data []byte `json:"data,omitempty"`
+}
+
+// fetchMessageJSON is the JSON form of FetchMessageData and
+// FetchMessageBuffer.
+type fetchMessageJSON struct {
+	SeqNum        uint32         `json:"seqNum"`
+	UID           UID            `json:"uid,omitempty"`
+	Flags         *[]Flag        `json:"flags,omitempty"`
+	InternalDate  *time.Time     `json:"internalDate,omitempty"`
+	RFC822Size    int64          `json:"rfc822Size,omitempty"`
+	ModSeq        uint64         `json:"modSeq,omitempty"`
+	Envelope      *Envelope      `json:"envelope,omitempty"`
+	BodyStructure *BodyStructure `json:"bodyStructure,omitempty"`
+	Preview       string         `json:"preview,omitempty"`
+	PreviewNIL    bool           `json:"previewNil,omitempty"`
+	SaveDate      *time.Time     `json:"saveDate,omitempty"`
+	SaveDateNIL   bool           `json:"saveDateNil,omitempty"`
+	EmailID       string         `json:"emailId,omitempty"`
+	ThreadID      string         `json:"threadId,omitempty"`
+	Sections      []SectionJSON  `json:"sections,omitempty"`
+	BinarySizes   []SectionJSON  `json:"binarySizes,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. The fields are "seqNum", always
+// present, "uid", "flags", "internalDate", "rfc822Size", "modSeq",
+// "envelope", "bodyStructure", "preview" and "previewNil" for a NIL
+// preview, "saveDate" and "saveDateNil", "emailId", "threadId", the body
+// and binary "sections" as SectionJSON without data, and the
+// "binarySizes" of BINARY.SIZE as SectionJSON with the size only. Items
+// that were not fetched are left out; "flags" is written as [] for a
+// message without flags unless Flags is nil. Section readers are not
+// read.
+func (m FetchMessageData) MarshalJSON() ([]byte, error) {
+	v := m.fetchMessageJSON()
+	for section, r := range m.BodySection {
+		v.Sections = append(v.Sections, SectionJSON{Section: section.ResponseName(), Size: r.Size})
+	}
+	for section, r := range m.BinarySection {
+		v.Sections = append(v.Sections, SectionJSON{Section: "BINARY[" + partString(section.Part) + "]", Size: r.Size})
+	}
+	for _, size := range m.BinarySizeSection {
+		v.BinarySizes = append(v.BinarySizes, SectionJSON{Section: "BINARY.SIZE[" + partString(size.Part) + "]", Size: int64(size.Size)})
+	}
+	sortSections(v.Sections)
+	sortSections(v.BinarySizes)
+	return json.Marshal(v)
+}
+
+func (m *FetchMessageData) fetchMessageJSON() fetchMessageJSON {
+	v := fetchMessageJSON{
+		SeqNum:        m.SeqNum,
+		UID:           m.UID,
+		InternalDate:  optionalTime(m.InternalDate),
+		RFC822Size:    m.RFC822Size,
+		ModSeq:        m.ModSeq,
+		Envelope:      m.Envelope,
+		BodyStructure: m.BodyStructure,
+		Preview:       m.Preview,
+		PreviewNIL:    m.PreviewNIL,
+		SaveDate:      m.SaveDate,
+		SaveDateNIL:   m.SaveDateNIL,
+		EmailID:       m.EmailID,
+		ThreadID:      m.ThreadID,
+	}
+	if m.Flags != nil {
+		// Fetched flags are written even if there are none.
+		v.Flags = &m.Flags
+	}
+	return v
+}
+
+// MarshalJSON implements json.Marshaler. The fields are those of
+// FetchMessageData.MarshalJSON, with the data of the sections, so that
+// a message encodes the same whether or not the client deferred parsing
+// its body structure. The parsed Header is left out, as it is in the
+// header sections.
+func (m FetchMessageBuffer) MarshalJSON() ([]byte, error) {
+	bs, err := m.Structure()
+	if err != nil {
+		return nil, err
+	}
+	data := FetchMessageData{
+		SeqNum:        m.SeqNum,
+		Envelope:      m.Envelope,
+		BodyStructure: bs,
+		Flags:         m.Flags,
+		InternalDate:  m.InternalDate,
+		RFC822Size:    m.RFC822Size,
+		UID:           m.UID,
+		ModSeq:        m.ModSeq,
+		Preview:       m.Preview,
+		PreviewNIL:    m.PreviewNIL,
+		SaveDate:      m.SaveDate,
+		SaveDateNIL:   m.SaveDateNIL,
+		EmailID:       m.EmailID,
+		ThreadID:      m.ThreadID,
+	}
+	v := data.fetchMessageJSON()
+	for spec, b := range m.BodySection {
+		v.Sections = append(v.Sections, SectionJSON{Section: "BODY[" + spec + "]", Size: int64(len(b)), Data: b})
+	}
+	for part, b := range m.BinarySection {
+		v.Sections = append(v.Sections, SectionJSON{Section: "BINARY[" + part + "]", Size: int64(len(b)), Data: b})
+	}
+	for part, size := range m.BinarySizeSection {
+		v.BinarySizes = append(v.BinarySizes, SectionJSON{Section: "BINARY.SIZE[" + part + "]", Size: int64(size)})
+	}
+	sortSections(v.Sections)
+	sortSections(v.BinarySizes)
+	return json.Marshal(v)
+}
+
+// partString returns a MIME part number, such as "1.2".
+func partString(part []int) string {
+	nums := make([]string, len(part))
+	for i, n := range part {
+		nums[i] = strconv.Itoa(n)
+	}
+	return strings.Join(nums, ".")
+}
+
+func sortSections(sections []SectionJSON) {
+	sort.Slice(sections, func(i, j int) bool { return sections[i].Section < sections[j].Section })
+}
@@ -0,0 +1,158 @@
+package imap
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// assertGoldenJSON compares the indented JSON form of v with the golden
+// file testdata/<name>.json.golden, or writes it with -update.
+func assertGoldenJSON(t *testing.T, name string, v any) {
+	t.Helper()
+	got, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatalf("Marshal() error: %v", err)
+	}
+	got = append(got, '\n')
+
+	path := filepath.Join("testdata", name+".json.golden")
+	if *updateGolden {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file: %v (run with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s does not match:\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+var jsonTestDate = time.Date(2024, 3, 5, 14, 30, 0, 0, time.FixedZone("", 3600))
+
+var jsonTestEnvelope = &Envelope{
+	Date:      jsonTestDate,
+	Subject:   "Quarterly report",
+	From:      []*Address{{Name: "Alice", Mailbox: "alice", Host: "example.org"}},
+	To:        []*Address{{Mailbox: "bob", Host: "example.org"}, {Mailbox: "carol", Host: "example.net"}},
+	MessageID: "<1@example.org>",
+}
+
+var jsonTestStructure = &BodyStructure{
+	Type:    "multipart",
+	Subtype: "mixed",
+	Params:  map[string]string{"boundary": "b1"},
+	Children: []BodyStructure{
+		{Type: "text", Subtype: "plain", Params: map[string]string{"charset": "utf-8", "format": "flowed"}, Encoding: "7bit", Size: 12, Lines: 1},
+		{
+			Type: "application", Subtype: "pdf", Encoding: "base64", Size: 2048,
+			Disposition: "attachment", DispositionParams: map[string]string{"filename": "report.pdf"},
+		},
+	},
+}
+
+func TestFetchMessageBuffer_JSON(t *testing.T) {
+	saveDate := jsonTestDate.Add(time.Hour)
+	msg := FetchMessageBuffer{
+		SeqNum:        4,
+		UID:           1042,
+		Flags:         []Flag{FlagSeen, "$Important"},
+		InternalDate:  jsonTestDate,
+		RFC822Size:    2300,
+		ModSeq:        77,
+		Envelope:      jsonTestEnvelope,
+		BodyStructure: jsonTestStructure,
+		SaveDate:      &saveDate,
+		EmailID:       "M6d99ac3275bb4e",
+		BodySection: map[string][]byte{
+			"TEXT":   []byte("hello"),
+			"HEADER": []byte("Subject: Quarterly report\r\n\r\n"),
+		},
+		BinarySizeSection: map[string]uint32{"2": 1500},
+	}
+	assertGoldenJSON(t, "fetch_message_buffer", msg)
+
+	// Deferred body structures encode the same.
+	raw := msg
+	raw.BodyStructure = nil
+	raw.RawBodyStructure = `(("text" "plain" ("charset" "utf-8" "format" "flowed") NIL NIL "7bit" 12 1)` +
+		`("application" "pdf" NIL NIL NIL "base64" 2048 NIL ("attachment" ("filename" "report.pdf")) NIL NIL) "mixed" ("boundary" "b1") NIL NIL NIL)`
+	a, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Errorf("deferred body structure encodes as\n%s\nwant\n%s", b, a)
+	}
+	if raw.BodyStructure != nil {
+		t.Error("MarshalJSON() modified the message")
+	}
+}
+
+func TestFetchMessageData_JSON(t *testing.T) {
+	msg := FetchMessageData{
+		SeqNum:     1,
+		UID:        9,
+		Flags:      []Flag{},
+		PreviewNIL: true,
+		BodySection: map[*FetchItemBodySection]SectionReader{
+			{Specifier: "TEXT", Part: []int{1}, Partial: &SectionPartial{Offset: 0, Count: 100}}: {Reader: strings.NewReader("unread"), Size: 100},
+			{}: {Reader: strings.NewReader("unread"), Size: 2300},
+		},
+		BinarySizeSection: []BinarySizeData{{Part: []int{2}, Size: 1500}},
+	}
+	assertGoldenJSON(t, "fetch_message_data", msg)
+}
+
+func TestEnvelope_JSONRoundTrip(t *testing.T) {
+	data, err := json.Marshal(jsonTestEnvelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		t.Fatal(err)
+	}
+	if !env.Date.Equal(jsonTestEnvelope.Date) {
+		t.Errorf("Date = %v, want %v", env.Date, jsonTestEnvelope.Date)
+	}
+	env.Date = jsonTestEnvelope.Date
+	if !reflect.DeepEqual(&env, jsonTestEnvelope) {
+		t.Errorf("Unmarshal() = %+v, want %+v", env, jsonTestEnvelope)
+	}
+
+	data, err = json.Marshal(jsonTestStructure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bs BodyStructure
+	if err := json.Unmarshal(data, &bs); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&bs, jsonTestStructure) {
+		t.Errorf("Unmarshal() = %+v, want %+v", bs, jsonTestStructure)
+	}
+
+	if data, _ := json.Marshal(Envelope{}); string(data) != "{}" {
+		t.Errorf("empty envelope = %s, want {}", data)
+	}
+}
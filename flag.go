@@ -0,0 +1,83 @@
+package imap
+
+import "strings"
+
+// IsSystemFlag reports whether the flag is one of the system flags
+// defined by IMAP, such as \Seen, in any case. The \* wildcard of
+// PERMANENTFLAGS is not a flag.
+func (f Flag) IsSystemFlag() bool {
+	sys, ok := systemFlags[strings.ToLower(string(f))]
+	return ok && sys != FlagWildcard
+}
+
+// IsKeyword reports whether the flag is a keyword, defined by clients or
+// in the keywords registry, rather than a system flag: an atom that does
+// not start with a backslash, such as $Junk or NonJunk.
+func (f Flag) IsKeyword() bool {
+	return isFlagAtom(string(f))
+}
+
+// KeywordInfo describes a well-known keyword.
+type KeywordInfo struct {
+	Flag        Flag
+	Description string
+	// Reference is the RFC that defines the keyword, or empty for
+	// keywords only in de facto use.
+	Reference string
+	// Recommended is set for the keywords RFC 9051 §2.3.2 recommends
+	// servers support, which should be allowed in PERMANENTFLAGS.
+	Recommended bool
+}
+
+// keywords are the well-known keywords in the order of Keywords.
+var keywords = []KeywordInfo{
+	{FlagForwarded, "The message was forwarded.", "RFC 5550", true},
+	{FlagMDNSent, "A message disposition notification was sent for the message.", "RFC 3503", true},
+	{FlagJunk, "The user or a filter marked the message as spam.", "RFC 9051", true},
+	{FlagNotJunk, "The user or a filter marked the message as not spam.", "RFC 9051", true},
+	{FlagPhishing, "The message is likely a phishing attempt; clients should warn before following its links.", "RFC 9051", true},
+	{FlagImportant, "The message is likely important to the user.", "RFC 8457", false},
+	{FlagSubmitPending, "The message is waiting to be submitted for delivery.", "RFC 5550", false},
+	{FlagSubmitted, "The message was submitted for delivery.", "RFC 5550", false},
+	{"Junk", "Legacy spam mark set by Thunderbird and SpamAssassin setups; see $Junk.", "", false},
+	{"NonJunk", "Legacy not-spam mark set by Thunderbird; see $NotJunk.", "", false},
+	{"$Label1", "Thunderbird tag \"Important\".", "", false},
+	{"$Label2", "Thunderbird tag \"Work\".", "", false},
+	{"$Label3", "Thunderbird tag \"Personal\".", "", false},
+	{"$Label4", "Thunderbird tag \"To Do\".", "", false},
+	{"$Label5", "Thunderbird tag \"Later\".", "", false},
+	{"$MailFlagBit0", "Bit 0 of the flag color set by Apple Mail.", "", false},
+	{"$MailFlagBit1", "Bit 1 of the flag color set by Apple Mail.", "", false},
+	{"$MailFlagBit2", "Bit 2 of the flag color set by Apple Mail.", "", false},
+}
+
+// Keywords returns the well-known keywords: those of the IANA keywords
+// registry, then those in de facto use by common clients.
+func Keywords() []KeywordInfo {
+	result := make([]KeywordInfo, len(keywords))
+	copy(result, keywords)
+	return result
+}
+
+// LookupKeyword returns the description of a well-known keyword. Keywords
+// are case-insensitive, so "$junk" finds $Junk.
+func LookupKeyword(f Flag) (KeywordInfo, bool) {
+	for _, info := range keywords {
+		if strings.EqualFold(string(info.Flag), string(f)) {
+			return info, true
+		}
+	}
+	return KeywordInfo{}, false
+}
+
+// RecommendedKeywords returns the keywords RFC 9051 §2.3.2 recommends
+// servers support: $Forwarded, $MDNSent, $Junk, $NotJunk and $Phishing.
+func RecommendedKeywords() []Flag {
+	var flags []Flag
+	for _, info := range keywords {
+		if info.Recommended {
+			flags = append(flags, info.Flag)
+		}
+	}
+	return flags
+}
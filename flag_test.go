@@ -0,0 +1,75 @@
+package imap
+
+import "testing"
+
+func TestFlag_Classification(t *testing.T) {
+	tests := []struct {
+		flag    Flag
+		system  bool
+		keyword bool
+	}{
+		{FlagSeen, true, false},
+		{`\seen`, true, false},
+		{FlagRecent, true, false},
+		{FlagWildcard, false, false},
+		{`\Custom`, false, false},
+		{FlagJunk, false, true},
+		{"NonJunk", false, true},
+		{"two words", false, false},
+		{"", false, false},
+	}
+	for _, tt := range tests {
+		if got := tt.flag.IsSystemFlag(); got != tt.system {
+			t.Errorf("%q.IsSystemFlag() = %v", tt.flag, got)
+		}
+		if got := tt.flag.IsKeyword(); got != tt.keyword {
+			t.Errorf("%q.IsKeyword() = %v", tt.flag, got)
+		}
+	}
+}
+
+func TestLookupKeyword(t *testing.T) {
+	info, ok := LookupKeyword("$junk")
+	if !ok || info.Flag != FlagJunk || info.Reference != "RFC 9051" || !info.Recommended {
+		t.Errorf("LookupKeyword($junk) = %+v, %v", info, ok)
+	}
+	if info, ok := LookupKeyword("$Label1"); !ok || info.Reference != "" {
+		t.Errorf("LookupKeyword($Label1) = %+v, %v", info, ok)
+	}
+	if _, ok := LookupKeyword("$Unknown"); ok {
+		t.Error("LookupKeyword($Unknown) succeeded")
+	}
+	for _, info := range Keywords() {
+		if !info.Flag.IsKeyword() || info.Description == "" {
+			t.Errorf("invalid registry entry %+v", info)
+		}
+	}
+}
+
+func TestRecommendedKeywords(t *testing.T) {
+	got := RecommendedKeywords()
+	want := []Flag{FlagForwarded, FlagMDNSent, FlagJunk, FlagNotJunk, FlagPhishing}
+	if len(got) != len(want) {
+		t.Fatalf("RecommendedKeywords() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("RecommendedKeywords() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSelectData_CanStoreFlag(t *testing.T) {
+	d := &SelectData{PermanentFlags: []Flag{FlagSeen, FlagJunk}}
+	if !d.CanStoreFlag(`\seen`) || !d.CanStoreFlag("$junk") || d.CanStoreFlag(FlagNotJunk) {
+		t.Error("CanStoreFlag() without wildcard")
+	}
+	d.PermanentFlags = append(d.PermanentFlags, FlagWildcard)
+	if !d.CanStoreFlag(FlagNotJunk) || d.CanStoreFlag(FlagDeleted) {
+		t.Error("CanStoreFlag() with wildcard")
+	}
+	d.ReadOnly = true
+	if d.CanStoreFlag(FlagSeen) {
+		t.Error("CanStoreFlag() of a read-only mailbox")
+	}
+}
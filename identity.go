@@ -0,0 +1,181 @@
+package imap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// Message identities returned by MessageIdentity start with one of these
+// prefixes.
+const (
+	IdentityPrefixMessageID = "mid:"
+	IdentityPrefixDigest    = "sha256:"
+)
+
+// volatileHeaders are header fields that are added or changed during
+// transport and delivery, and are excluded from MessageDigest.
+var volatileHeaders = map[string]bool{
+	"received":                   true,
+	"return-path":                true,
+	"delivered-to":               true,
+	"x-original-to":              true,
+	"envelope-to":                true,
+	"status":                     true,
+	"x-status":                   true,
+	"x-keywords":                 true,
+	"x-uid":                      true,
+	"content-length":             true,
+	"lines":                      true,
+	"authentication-results":     true,
+	"arc-authentication-results": true,
+	"x-spam-status":              true,
+	"x-spam-score":               true,
+	"x-spam-flag":                true,
+}
+
+// MessageIdentity returns a stable identity for a raw RFC 5322 message,
+// so that copies of a message in different mailboxes, servers or
+// deliveries compare equal. It is the normalized Message-ID prefixed with
+// IdentityPrefixMessageID, or, if the message has no usable Message-ID,
+// MessageDigest prefixed with IdentityPrefixDigest.
+func MessageIdentity(msg []byte) string {
+	header, _ := splitMessage(msg)
+	for _, f := range parseHeaderFields(header) {
+		if f.name == "message-id" {
+			if id := NormalizeMessageID(f.value); id != "" {
+				return IdentityPrefixMessageID + id
+			}
+			break
+		}
+	}
+	return IdentityPrefixDigest + MessageDigest(msg)
+}
+
+// NormalizeMessageID returns the msg-id in a Message-ID header value
+// without angle brackets and with the domain part lowercased, for example
+// "abc@example.com" for " <abc@EXAMPLE.com> (comment)". It returns an
+// empty string if the value contains no msg-id.
+func NormalizeMessageID(value string) string {
+	value = strings.TrimSpace(value)
+	if start := strings.IndexByte(value, '<'); start >= 0 {
+		end := strings.IndexByte(value[start:], '>')
+		if end < 0 {
+			return ""
+		}
+		value = value[start+1 : start+end]
+	} else if i := strings.IndexAny(value, " \t("); i >= 0 {
+		// Some mailers omit the angle brackets.
+		value = value[:i]
+	}
+	value = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, value)
+
+	at := strings.LastIndexByte(value, '@')
+	if at <= 0 || at == len(value)-1 {
+		return ""
+	}
+	return value[:at] + "@" + strings.ToLower(value[at+1:])
+}
+
+// MessageDigest returns the hex-encoded SHA-256 digest of a canonical form
+// of a raw message. Header field names are lowercased, folded values are
+// unfolded and runs of whitespace are collapsed, fields are sorted, and
+// fields added in transport (such as Received and Return-Path) are left
+// out. Line endings in the body are normalized to CRLF and trailing empty
+// lines are ignored.
+func MessageDigest(msg []byte) string {
+	header, body := splitMessage(msg)
+
+	var fields []string
+	for _, f := range parseHeaderFields(header) {
+		if volatileHeaders[f.name] {
+			continue
+		}
+		fields = append(fields, f.name+":"+strings.Join(strings.Fields(f.value), " "))
+	}
+	sort.Strings(fields)
+
+	h := sha256.New()
+	for _, f := range fields {
+		h.Write([]byte(f))
+		h.Write([]byte("\r\n"))
+	}
+	h.Write([]byte("\r\n"))
+
+	body = bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n"))
+	body = bytes.TrimRight(body, "\r\n")
+	h.Write(bytes.ReplaceAll(body, []byte("\n"), []byte("\r\n")))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ObjectIDFromIdentity derives an object identifier for an identity
+// returned by MessageIdentity, such as an OBJECTID EMAILID (RFC 8474). The
+// result is 23 characters long, starts with a letter and only contains
+// characters allowed in an objectid.
+func ObjectIDFromIdentity(identity string) string {
+	sum := sha256.Sum256([]byte(identity))
+	return "M" + base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+// headerField is a header field with a lowercased name and an unfolded
+// value.
+type headerField struct {
+	name  string
+	value string
+}
+
+// splitMessage splits a raw message into its header and body at the first
+// empty line. A message without an empty line is all header.
+func splitMessage(msg []byte) (header, body []byte) {
+	if bytes.HasPrefix(msg, []byte("\r\n")) {
+		return nil, msg[2:]
+	}
+	if bytes.HasPrefix(msg, []byte("\n")) {
+		return nil, msg[1:]
+	}
+	crlf := bytes.Index(msg, []byte("\r\n\r\n"))
+	lf := bytes.Index(msg, []byte("\n\n"))
+	switch {
+	case crlf >= 0 && (lf < 0 || crlf < lf):
+		return msg[:crlf+2], msg[crlf+4:]
+	case lf >= 0:
+		return msg[:lf+1], msg[lf+2:]
+	default:
+		return msg, nil
+	}
+}
+
+// parseHeaderFields parses a raw header block. Malformed lines are
+// skipped.
+func parseHeaderFields(header []byte) []headerField {
+	var fields []headerField
+	for _, line := range strings.Split(strings.ReplaceAll(string(header), "\r\n", "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if n := len(fields); n > 0 {
+				fields[n-1].value += " " + strings.TrimSpace(line)
+			}
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields = append(fields, headerField{
+			name:  strings.ToLower(strings.TrimSpace(name)),
+			value: strings.TrimSpace(value),
+		})
+	}
+	return fields
+}
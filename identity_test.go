@@ -0,0 +1,70 @@
+package imap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeMessageID(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"<abc@example.com>", "abc@example.com"},
+		{"  <ABC@EXAMPLE.com> (comment)", "ABC@example.com"},
+		{"<abc@\r\n example.com>", "abc@example.com"},
+		{"abc@Example.com", "abc@example.com"},
+		{"abc@example.com (no brackets)", "abc@example.com"},
+		{"<abc>", ""},
+		{"<abc@example.com", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeMessageID(tt.in); got != tt.want {
+			t.Errorf("NormalizeMessageID(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMessageIdentity_MessageID(t *testing.T) {
+	a := "Received: from a\r\nMessage-ID: <1234@Example.COM>\r\nSubject: hi\r\n\r\nbody\r\n"
+	b := "Message-Id:\r\n <1234@example.com>\r\nSubject: hi, modified\r\n\r\nother body\r\n"
+	if got, want := MessageIdentity([]byte(a)), "mid:1234@example.com"; got != want {
+		t.Errorf("MessageIdentity() = %q, want %q", got, want)
+	}
+	if MessageIdentity([]byte(a)) != MessageIdentity([]byte(b)) {
+		t.Error("messages with the same Message-ID have different identities")
+	}
+}
+
+func TestMessageIdentity_Digest(t *testing.T) {
+	a := "From: alice@example.com\r\nSubject: hello\r\n  world\r\n\r\nbody\r\n"
+	// Different line endings, header order, folding, and transport fields.
+	b := "Return-Path: <alice@example.com>\nReceived: by mx\nSubject: hello world\nFrom: alice@example.com\n\nbody\n\n"
+	c := "From: alice@example.com\r\nSubject: hello world\r\n\r\nother body\r\n"
+
+	idA := MessageIdentity([]byte(a))
+	if !strings.HasPrefix(idA, IdentityPrefixDigest) {
+		t.Fatalf("MessageIdentity() = %q, want digest identity", idA)
+	}
+	if idB := MessageIdentity([]byte(b)); idA != idB {
+		t.Errorf("equivalent messages have identities %q and %q", idA, idB)
+	}
+	if idC := MessageIdentity([]byte(c)); idA == idC {
+		t.Error("messages with different bodies have the same identity")
+	}
+}
+
+func TestObjectIDFromIdentity(t *testing.T) {
+	id := ObjectIDFromIdentity("mid:1234@example.com")
+	if len(id) != 23 {
+		t.Errorf("len(ObjectIDFromIdentity()) = %d, want 23", len(id))
+	}
+	for _, r := range id {
+		if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			t.Fatalf("ObjectIDFromIdentity() = %q contains invalid character %q", id, r)
+		}
+	}
+	if id != ObjectIDFromIdentity("mid:1234@example.com") {
+		t.Error("ObjectIDFromIdentity() is not stable")
+	}
+}
@@ -55,6 +55,20 @@ const (
 	FlagWildcard Flag = "\\*"      // Permanent flags wildcard
 )
 
+// Keywords registered with IANA in the IMAP keywords registry, which
+// RFC 9051 §2.3.2 recommends servers support. See LookupKeyword for
+// descriptions of these and other common keywords.
+const (
+	FlagForwarded     Flag = "$Forwarded"     // RFC 5550
+	FlagMDNSent       Flag = "$MDNSent"       // RFC 3503
+	FlagJunk          Flag = "$Junk"          // RFC 9051
+	FlagNotJunk       Flag = "$NotJunk"       // RFC 9051
+	FlagPhishing      Flag = "$Phishing"      // RFC 9051
+	FlagImportant     Flag = "$Important"     // RFC 8457
+	FlagSubmitPending Flag = "$SubmitPending" // RFC 5550
+	FlagSubmitted     Flag = "$Submitted"     // RFC 5550
+)
+
 // MailboxAttr represents a mailbox attribute.
 type MailboxAttr string
 
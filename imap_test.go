@@ -526,3 +526,58 @@ func TestSeqNum_Type(t *testing.T) {
 		t.Errorf("SeqNum = %d, want 42", seq)
 	}
 }
+
+func TestCanonicalMailboxName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"INBOX", "INBOX"},
+		{"inbox", "INBOX"},
+		{"Inbox", "INBOX"},
+		{"InBoX", "INBOX"},
+		{"inBOX", "INBOX"},
+		{"Sent", "Sent"},
+		{"inbox2", "inbox2"},
+		{"INBO", "INBO"},
+		{"inbox/child", "inbox/child"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := CanonicalMailboxName(tt.input); got != tt.expected {
+			t.Errorf("CanonicalMailboxName(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+		if got, want := IsInbox(tt.input), tt.expected == InboxName; got != want {
+			t.Errorf("IsInbox(%q) = %v, want %v", tt.input, got, want)
+		}
+	}
+}
+
+// --- SearchCriteria tests ---
+
+func TestSearchCriteria_And(t *testing.T) {
+	d1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	d2 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	set1, _ := ParseSeqSet("1:10")
+	set2, _ := ParseSeqSet("5:20")
+
+	c := &SearchCriteria{Since: d1, Before: d2, Larger: 10, SeqNum: set1, Flag: []Flag{FlagSeen}}
+	c.And(&SearchCriteria{Since: d2, Before: d1, Larger: 5, Smaller: 100, SeqNum: set2, Flag: []Flag{FlagFlagged}})
+
+	if !c.Since.Equal(d2) || !c.Before.Equal(d1) {
+		t.Errorf("dates = %v, %v; want %v, %v", c.Since, c.Before, d2, d1)
+	}
+	if c.Larger != 10 || c.Smaller != 100 {
+		t.Errorf("sizes = %d, %d; want 10, 100", c.Larger, c.Smaller)
+	}
+	if len(c.Flag) != 2 {
+		t.Errorf("Flag = %v, want 2 flags", c.Flag)
+	}
+	if c.SeqNum != set1 {
+		t.Errorf("SeqNum = %v, want %v", c.SeqNum, set1)
+	}
+	if len(c.Not) != 1 || len(c.Not[0].Not) != 1 || c.Not[0].Not[0].SeqNum != set2 {
+		t.Errorf("Not = %+v, want NOT (NOT %v)", c.Not, set2)
+	}
+}
@@ -0,0 +1,319 @@
+package imaptest
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/meszmate/imap-go/client"
+)
+
+// ChaosDirection selects which traffic a ChaosConfig applies to.
+type ChaosDirection int
+
+const (
+	// ChaosBoth applies faults to traffic in both directions.
+	ChaosBoth ChaosDirection = iota
+	// ChaosClientToServer applies faults only to commands sent by the client.
+	ChaosClientToServer
+	// ChaosServerToClient applies faults only to responses sent by the server.
+	ChaosServerToClient
+)
+
+// ChaosConfig controls the faults injected by a ChaosProxy. Rates are
+// probabilities between 0 and 1 that are evaluated for every chunk of data
+// read from one side of the connection.
+type ChaosConfig struct {
+	// Latency is added before each chunk is forwarded.
+	Latency time.Duration
+	// Jitter adds a random delay of up to Jitter on top of Latency.
+	Jitter time.Duration
+
+	// PartialWriteRate is the probability that a chunk is forwarded in
+	// several small writes instead of one.
+	PartialWriteRate float64
+	// ResetRate is the probability that the connection is abruptly closed
+	// instead of forwarding a chunk.
+	ResetRate float64
+	// CorruptRate is the probability that one byte of a chunk is flipped.
+	CorruptRate float64
+
+	// Direction selects the traffic the faults apply to.
+	Direction ChaosDirection
+
+	// Seed seeds the random source. 0 uses the current time.
+	Seed int64
+}
+
+// ChaosStats counts the faults injected by a ChaosProxy.
+type ChaosStats struct {
+	Delays        int64
+	PartialWrites int64
+	Resets        int64
+	Corruptions   int64
+}
+
+// ChaosProxy is an in-process TCP proxy that forwards connections to a
+// target address while injecting latency, partial writes, connection resets
+// and byte corruption. It is meant to exercise client and server error
+// paths in tests.
+type ChaosProxy struct {
+	t        testing.TB
+	target   string
+	listener net.Listener
+
+	mu    sync.Mutex
+	cfg   ChaosConfig
+	rand  *rand.Rand
+	conns map[net.Conn]struct{}
+
+	delays        atomic.Int64
+	partialWrites atomic.Int64
+	resets        atomic.Int64
+	corruptions   atomic.Int64
+
+	wg sync.WaitGroup
+}
+
+// NewChaosProxy starts a chaos proxy in front of target. The proxy is
+// closed when the test finishes.
+func NewChaosProxy(t testing.TB, target string, cfg ChaosConfig) *ChaosProxy {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("chaos proxy listen: %v", err)
+	}
+
+	p := &ChaosProxy{
+		t:        t,
+		target:   target,
+		listener: l,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	p.SetConfig(cfg)
+
+	p.wg.Add(1)
+	go p.serve()
+
+	t.Cleanup(func() {
+		_ = p.Close()
+	})
+	return p
+}
+
+// ChaosProxy starts a chaos proxy in front of the harness's server.
+func (h *Harness) ChaosProxy(cfg ChaosConfig) *ChaosProxy {
+	h.t.Helper()
+	return NewChaosProxy(h.t, h.Addr(), cfg)
+}
+
+// Addr returns the address clients should connect to.
+func (p *ChaosProxy) Addr() string {
+	return p.listener.Addr().String()
+}
+
+// Dial connects a client to the server through the proxy.
+func (p *ChaosProxy) Dial(opts ...client.Option) (*client.Client, error) {
+	c, err := client.Dial(p.Addr(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.t.Cleanup(func() {
+		_ = c.Close()
+	})
+	return c, nil
+}
+
+// SetConfig replaces the fault configuration. It applies to data forwarded
+// after the call, including on existing connections.
+func (p *ChaosProxy) SetConfig(cfg ChaosConfig) {
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	p.mu.Lock()
+	p.cfg = cfg
+	p.rand = rand.New(rand.NewSource(seed))
+	p.mu.Unlock()
+}
+
+// Stats returns the number of faults injected so far.
+func (p *ChaosProxy) Stats() ChaosStats {
+	return ChaosStats{
+		Delays:        p.delays.Load(),
+		PartialWrites: p.partialWrites.Load(),
+		Resets:        p.resets.Load(),
+		Corruptions:   p.corruptions.Load(),
+	}
+}
+
+// Close stops the proxy and closes all proxied connections.
+func (p *ChaosProxy) Close() error {
+	err := p.listener.Close()
+	p.mu.Lock()
+	for c := range p.conns {
+		_ = c.Close()
+	}
+	p.conns = nil
+	p.mu.Unlock()
+	p.wg.Wait()
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+func (p *ChaosProxy) serve() {
+	defer p.wg.Done()
+	for {
+		down, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		up, err := net.Dial("tcp", p.target)
+		if err != nil {
+			_ = down.Close()
+			continue
+		}
+		if !p.track(down, up) {
+			return
+		}
+
+		p.wg.Add(2)
+		go p.pipe(up, down, ChaosClientToServer)
+		go p.pipe(down, up, ChaosServerToClient)
+	}
+}
+
+// track registers a connection pair. It returns false if the proxy is
+// closed.
+func (p *ChaosProxy) track(conns ...net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conns == nil {
+		for _, c := range conns {
+			_ = c.Close()
+		}
+		return false
+	}
+	for _, c := range conns {
+		p.conns[c] = struct{}{}
+	}
+	return true
+}
+
+// pipe copies from src to dst, injecting faults. When either side fails,
+// both connections are closed.
+func (p *ChaosProxy) pipe(dst, src net.Conn, dir ChaosDirection) {
+	defer p.wg.Done()
+	defer p.closePair(dst, src)
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if !p.forward(dst, buf[:n], dir) {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// chaosPlan is the set of faults chosen for one chunk.
+type chaosPlan struct {
+	delay   time.Duration
+	reset   bool
+	corrupt int // index of the byte to corrupt, or -1
+	splits  []int
+}
+
+func (p *ChaosProxy) plan(n int, dir ChaosDirection) chaosPlan {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	plan := chaosPlan{corrupt: -1}
+	cfg := p.cfg
+	if cfg.Direction != ChaosBoth && cfg.Direction != dir {
+		return plan
+	}
+
+	plan.delay = cfg.Latency
+	if cfg.Jitter > 0 {
+		plan.delay += time.Duration(p.rand.Int63n(int64(cfg.Jitter)))
+	}
+	if p.rand.Float64() < cfg.ResetRate {
+		plan.reset = true
+		return plan
+	}
+	if p.rand.Float64() < cfg.CorruptRate {
+		plan.corrupt = p.rand.Intn(n)
+	}
+	if n > 1 && p.rand.Float64() < cfg.PartialWriteRate {
+		// Split the chunk at up to three random points.
+		for i := 0; i < 3; i++ {
+			plan.splits = append(plan.splits, 1+p.rand.Intn(n-1))
+		}
+	}
+	return plan
+}
+
+// forward writes data to dst according to the fault plan. It returns false
+// if the connection should be torn down.
+func (p *ChaosProxy) forward(dst net.Conn, data []byte, dir ChaosDirection) bool {
+	plan := p.plan(len(data), dir)
+
+	if plan.delay > 0 {
+		p.delays.Add(1)
+		time.Sleep(plan.delay)
+	}
+	if plan.reset {
+		p.resets.Add(1)
+		if tc, ok := dst.(*net.TCPConn); ok {
+			// Send RST instead of FIN.
+			_ = tc.SetLinger(0)
+		}
+		return false
+	}
+	if plan.corrupt >= 0 {
+		p.corruptions.Add(1)
+		data[plan.corrupt] ^= 0xFF
+	}
+	if len(plan.splits) == 0 {
+		_, err := dst.Write(data)
+		return err == nil
+	}
+
+	p.partialWrites.Add(1)
+	start := 0
+	sort.Ints(plan.splits)
+	for _, at := range plan.splits {
+		if at <= start {
+			continue
+		}
+		if _, err := dst.Write(data[start:at]); err != nil {
+			return false
+		}
+		start = at
+		time.Sleep(time.Millisecond)
+	}
+	_, err := dst.Write(data[start:])
+	return err == nil
+}
+
+func (p *ChaosProxy) closePair(a, b net.Conn) {
+	_ = a.Close()
+	_ = b.Close()
+	p.mu.Lock()
+	delete(p.conns, a)
+	delete(p.conns, b)
+	p.mu.Unlock()
+}
@@ -0,0 +1,106 @@
+package imaptest
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	_ "github.com/meszmate/imap-go/server/commands"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+// startEcho starts a TCP server that echoes everything it reads.
+func startEcho(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				_, _ = io.Copy(c, c)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestChaosProxy_LatencyAndPartialWrites(t *testing.T) {
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	h := NewHarness(t, mem.NewServer())
+
+	p := h.ChaosProxy(ChaosConfig{
+		Latency:          time.Millisecond,
+		PartialWriteRate: 1,
+		Seed:             1,
+	})
+	c, err := p.Dial()
+	if err != nil {
+		t.Fatalf("Dial() error: %v", err)
+	}
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	if _, err := c.Select("INBOX", nil); err != nil {
+		t.Fatalf("Select() error: %v", err)
+	}
+
+	stats := p.Stats()
+	if stats.Delays == 0 || stats.PartialWrites == 0 {
+		t.Errorf("Stats() = %+v, want delays and partial writes", stats)
+	}
+}
+
+func TestChaosProxy_Reset(t *testing.T) {
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	h := NewHarness(t, mem.NewServer())
+
+	p := h.ChaosProxy(ChaosConfig{})
+	c, err := p.Dial()
+	if err != nil {
+		t.Fatalf("Dial() error: %v", err)
+	}
+
+	p.SetConfig(ChaosConfig{ResetRate: 1, Direction: ChaosServerToClient})
+	if err := c.Noop(); err == nil {
+		t.Fatal("Noop() succeeded over a reset connection")
+	}
+	if p.Stats().Resets == 0 {
+		t.Error("no resets recorded")
+	}
+}
+
+func TestChaosProxy_Corruption(t *testing.T) {
+	p := NewChaosProxy(t, startEcho(t), ChaosConfig{CorruptRate: 1, Direction: ChaosClientToServer, Seed: 1})
+
+	conn, err := net.Dial("tcp", p.Addr())
+	if err != nil {
+		t.Fatalf("Dial() error: %v", err)
+	}
+	defer conn.Close()
+
+	msg := []byte("a001 NOOP\r\n")
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	got := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatalf("ReadFull() error: %v", err)
+	}
+	if string(got) == string(msg) {
+		t.Error("data was not corrupted")
+	}
+	if p.Stats().Corruptions == 0 {
+		t.Error("no corruptions recorded")
+	}
+}
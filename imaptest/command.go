@@ -0,0 +1,153 @@
+package imaptest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/wire"
+)
+
+// CommandTag is the tag of the commands of NewCommandContext and
+// CaptureOutput.
+const CommandTag = "A001"
+
+// NewCommandContext returns the context of a command for testing its
+// handler directly, without a server or a client:
+//
+//	ctx := imaptest.NewCommandContext(t, "UID SEARCH", "RETURN (COUNT) ALL", sess)
+//	err := handler.Handle(ctx)
+//
+// name is the command name, possibly prefixed with "UID ", and args the
+// rest of the command line, decoded by ctx.Decoder. The connection is
+// in the not authenticated state, see server.Conn.SetState; what the
+// handler writes to it is discarded, and reads from it fail with
+// io.EOF. See CaptureOutput to check the responses.
+func NewCommandContext(t testing.TB, name, args string, sess server.Session) *server.CommandContext {
+	t.Helper()
+	return newCommandContext(t, name, args, sess, io.Discard)
+}
+
+// CaptureOutput is like NewCommandContext, but records the responses the
+// handler writes to the connection in the returned Output.
+func CaptureOutput(t testing.TB, name, args string, sess server.Session) (*server.CommandContext, *Output) {
+	t.Helper()
+	out := &Output{}
+	return newCommandContext(t, name, args, sess, out), out
+}
+
+func newCommandContext(t testing.TB, name, args string, sess server.Session, w io.Writer) *server.CommandContext {
+	numKind := server.NumKindSeq
+	if rest, ok := cutPrefixFold(name, "UID "); ok {
+		numKind = server.NumKindUID
+		name = rest
+	}
+
+	nc := &outputConn{w: w}
+	conn := server.NewTestConn(nc, nil)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	var dec *wire.Decoder
+	if args != "" {
+		dec = wire.NewDecoder(strings.NewReader(args))
+	}
+	return &server.CommandContext{
+		Context: context.Background(),
+		Tag:     CommandTag,
+		Name:    strings.ToUpper(name),
+		NumKind: numKind,
+		Conn:    conn,
+		Session: sess,
+		Decoder: dec,
+	}
+}
+
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
+
+// Output is the output of a connection of CaptureOutput. It is safe for
+// concurrent use, for handlers writing from other goroutines.
+type Output struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *Output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Write(p)
+}
+
+// String returns the output written so far.
+func (o *Output) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+// Lines returns the lines written so far, without CRLF.
+func (o *Output) Lines() []string {
+	s := strings.TrimSuffix(o.String(), "\r\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\r\n")
+}
+
+// Reset discards the output written so far.
+func (o *Output) Reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.buf.Reset()
+}
+
+// outputConn is a net.Conn writing to w, whose reads fail with io.EOF.
+// Writes are synchronous, so the output of a handler is complete when it
+// returns.
+type outputConn struct {
+	w io.Writer
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func (c *outputConn) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (c *outputConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	return c.w.Write(p)
+}
+
+func (c *outputConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *outputConn) LocalAddr() net.Addr                { return outputAddr{} }
+func (c *outputConn) RemoteAddr() net.Addr               { return outputAddr{} }
+func (c *outputConn) SetDeadline(t time.Time) error      { return nil }
+func (c *outputConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *outputConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type outputAddr struct{}
+
+func (outputAddr) Network() string { return "imaptest" }
+func (outputAddr) String() string  { return "imaptest" }
@@ -0,0 +1,47 @@
+package imaptest
+
+import (
+	"testing"
+
+	"github.com/meszmate/imap-go/imaptest/mock"
+	"github.com/meszmate/imap-go/server"
+)
+
+func TestCaptureOutput(t *testing.T) {
+	sess := &mock.Session{}
+	ctx, out := CaptureOutput(t, "uid search", "RETURN (COUNT) ALL", sess)
+
+	if ctx.Name != "SEARCH" || ctx.NumKind != server.NumKindUID {
+		t.Errorf("Name %q, NumKind %v, want SEARCH, UID", ctx.Name, ctx.NumKind)
+	}
+	if ctx.Tag != CommandTag || ctx.Session != sess {
+		t.Errorf("Tag %q, Session %v", ctx.Tag, ctx.Session)
+	}
+	atom, err := ctx.Decoder.ReadAtom()
+	if err != nil || atom != "RETURN" {
+		t.Errorf("ReadAtom() = %q, %v, want RETURN", atom, err)
+	}
+
+	ctx.Conn.WriteContinuation("more")
+	ctx.Conn.WriteOK(ctx.Tag, "SEARCH completed")
+	lines := out.Lines()
+	if len(lines) != 2 || lines[0] != "+ more" || lines[1] != "A001 OK SEARCH completed" {
+		t.Errorf("Lines() = %q", lines)
+	}
+
+	out.Reset()
+	if s := out.String(); s != "" {
+		t.Errorf("String() after Reset() = %q", s)
+	}
+}
+
+func TestNewCommandContext(t *testing.T) {
+	ctx := NewCommandContext(t, "NOOP", "", nil)
+	if ctx.NumKind != server.NumKindSeq || ctx.Decoder != nil {
+		t.Errorf("NumKind %v, Decoder %v, want sequence numbers and no decoder", ctx.NumKind, ctx.Decoder)
+	}
+	// Output is discarded without blocking.
+	for i := 0; i < 100; i++ {
+		ctx.Conn.WriteOK(ctx.Tag, "NOOP completed")
+	}
+}
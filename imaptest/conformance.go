@@ -0,0 +1,82 @@
+package imaptest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/meszmate/imap-go/client"
+)
+
+// Violation is a response of a server that does not follow the IMAP
+// grammar, found by CheckConformance.
+type Violation struct {
+	// Script is the name of the script, and Command the command, as
+	// written in the script, that the response answered. Command is
+	// empty for the greeting.
+	Script  string
+	Command string
+	*client.ResponseViolation
+}
+
+// CheckConformance runs the scripts against target, like Diff, and checks
+// every response of the server, the greeting included, against the IMAP
+// grammar with client.ValidateResponse. It returns the violations found,
+// so that the servers compared with Diff can also be checked on their
+// own. A client can check the responses it reads in the same way with
+// client.WithResponseValidator.
+func CheckConformance(t *testing.T, target Target, scripts []Script) []Violation {
+	t.Helper()
+	violations, err := Conformance(target, scripts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return violations
+}
+
+// Conformance is CheckConformance outside of tests, such as in a command
+// checking a deployed server. It returns an error if the server cannot be
+// reached or stops answering.
+func Conformance(target Target, scripts []Script) ([]Violation, error) {
+	var violations []Violation
+	for _, script := range scripts {
+		greeting, exchanges, err := playScript(target, script, "imaptest-"+randomHex(6))
+		if err != nil {
+			return violations, fmt.Errorf("%s: %w", script.Name, err)
+		}
+		for _, resp := range serverResponses(greeting) {
+			for _, v := range client.ValidateResponse(resp) {
+				violations = append(violations, Violation{Script: script.Name, ResponseViolation: v})
+			}
+		}
+		for i, exchange := range exchanges {
+			for _, resp := range serverResponses(exchange) {
+				for _, v := range client.ValidateResponse(resp) {
+					violations = append(violations, Violation{Script: script.Name, Command: script.Commands[i], ResponseViolation: v})
+				}
+			}
+		}
+	}
+	return violations, nil
+}
+
+// AssertConformance runs CheckConformance and reports each violation as
+// an error.
+func AssertConformance(t *testing.T, target Target, scripts []Script) {
+	t.Helper()
+	for _, v := range CheckConformance(t, target, scripts) {
+		t.Errorf("%s: %s: %s: %v", target.Name, v.Script, v.Command, v.ResponseViolation)
+	}
+}
+
+// serverResponses returns the server responses of a recorded exchange, as
+// the client reads them: with the literals they contain and without the
+// final CRLF.
+func serverResponses(exchange []byte) []string {
+	var responses []string
+	for _, resp := range strings.Split("\r\n"+string(exchange), "\r\nS: ")[1:] {
+		resp, _, _ = strings.Cut(resp, "\r\nC: ")
+		responses = append(responses, strings.TrimSuffix(resp, "\r\n"))
+	}
+	return responses
+}
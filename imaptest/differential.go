@@ -0,0 +1,340 @@
+package imaptest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Target is a server taking part in differential testing.
+type Target struct {
+	// Name identifies the server in reports, such as "imap-go" or
+	// "dovecot".
+	Name string
+	// Addr is the address of the server, without TLS unless TLSConfig
+	// is set.
+	Addr string
+	// TLSConfig, if set, connects to Addr with implicit TLS.
+	TLSConfig *tls.Config
+	// Username and Password are the credentials of a test account,
+	// substituted for $USER and $PASS in scripts. The account's mailboxes
+	// other than those named $MAILBOX are not modified by CoreScripts.
+	Username, Password string
+}
+
+// Target returns the harness's server as a Target that logs in with the
+// given credentials.
+func (h *Harness) Target(name, username, password string) Target {
+	return Target{Name: name, Addr: h.Addr(), Username: username, Password: password}
+}
+
+// Environment variables configuring DovecotTarget.
+const (
+	EnvDovecotAddr     = "IMAPTEST_DOVECOT_ADDR"
+	EnvDovecotUser     = "IMAPTEST_DOVECOT_USER"
+	EnvDovecotPassword = "IMAPTEST_DOVECOT_PASSWORD"
+)
+
+// DovecotTarget returns the Dovecot server configured by the
+// IMAPTEST_DOVECOT_ADDR, IMAPTEST_DOVECOT_USER and
+// IMAPTEST_DOVECOT_PASSWORD environment variables, and false if
+// IMAPTEST_DOVECOT_ADDR is not set. Any disposable Dovecot works, for
+// example:
+//
+//	docker run -d -p 1143:143 dovecot/dovecot
+//	IMAPTEST_DOVECOT_ADDR=localhost:1143 IMAPTEST_DOVECOT_USER=user \
+//		IMAPTEST_DOVECOT_PASSWORD=pass go test ./...
+func DovecotTarget() (Target, bool) {
+	addr := os.Getenv(EnvDovecotAddr)
+	if addr == "" {
+		return Target{}, false
+	}
+	return Target{
+		Name:     "dovecot",
+		Addr:     addr,
+		Username: os.Getenv(EnvDovecotUser),
+		Password: os.Getenv(EnvDovecotPassword),
+	}, true
+}
+
+// Script is a sequence of commands run on a new connection to each
+// target. Commands are tagged lines as accepted by Recorder.Run, in which
+// $USER and $PASS stand for the target's credentials and $MAILBOX for a
+// mailbox name that is unique to the run. The mailboxes $MAILBOX and
+// $MAILBOX-other are deleted after the script, whether or not the script
+// created them.
+type Script struct {
+	Name     string
+	Commands []string
+}
+
+// CoreScripts exercise the commands of RFC 9051 that a server backed by
+// any store should answer the same way.
+var CoreScripts = []Script{
+	{Name: "login", Commands: []string{
+		"a1 LOGIN $USER wrong-password",
+		"a2 LOGIN $USER $PASS",
+		"a3 LOGIN $USER $PASS",
+		"a4 NOOP",
+		"a5 LOGOUT",
+	}},
+	{Name: "mailboxes", Commands: []string{
+		"a1 LOGIN $USER $PASS",
+		"a2 CREATE $MAILBOX",
+		"a3 CREATE $MAILBOX",
+		`a4 LIST "" $MAILBOX`,
+		"a5 STATUS $MAILBOX (MESSAGES UIDNEXT UNSEEN)",
+		"a6 SELECT $MAILBOX-missing",
+		"a7 RENAME $MAILBOX-missing $MAILBOX-other",
+		"a8 DELETE $MAILBOX",
+		`a9 LIST "" $MAILBOX`,
+	}},
+	{Name: "messages", Commands: []string{
+		"a1 LOGIN $USER $PASS",
+		"a2 CREATE $MAILBOX",
+		`a3 APPEND $MAILBOX (\Seen) {31}` + "\r\nSubject: one\r\n\r\nfirst message\r\n",
+		"a4 APPEND $MAILBOX {32}\r\nSubject: two\r\n\r\nsecond message\r\n",
+		"a5 SELECT $MAILBOX",
+		"a6 FETCH 1:* (UID FLAGS RFC822.SIZE)",
+		"a7 FETCH 2 (BODY.PEEK[HEADER.FIELDS (SUBJECT)] BODY.PEEK[TEXT])",
+		`a8 STORE 2 +FLAGS (\Flagged)`,
+		"a9 SEARCH UNSEEN",
+		"b1 UID SEARCH FLAGGED",
+		"b2 SEARCH SUBJECT two",
+		`b3 STORE 1 +FLAGS.SILENT (\Deleted)`,
+		"b4 EXPUNGE",
+		"b5 FETCH 1 (UID FLAGS)",
+		"b6 FETCH 5 (FLAGS)",
+		"b7 CLOSE",
+	}},
+	{Name: "errors", Commands: []string{
+		"a1 FETCH 1 FLAGS",
+		"a2 LOGIN $USER $PASS",
+		"a3 FETCH 1 FLAGS",
+		"a4 XNOSUCHCOMMAND",
+		"a5 SELECT",
+		"a6 EXAMINE INBOX",
+		`a7 STORE 1 +FLAGS (\Seen)`,
+	}},
+}
+
+// Divergence is a command to which two servers answered differently,
+// after normalization.
+type Divergence struct {
+	// Script is the name of the script.
+	Script string
+	// Command is the command, as written in the script.
+	Command string
+	// A and B are the normalized responses of the two servers.
+	A, B string
+}
+
+// DefaultDiffNormalizers are applied to the responses of each command by
+// Diff if no normalizers are given. They remove what legitimately differs
+// between implementations: response text, capability lists and
+// identifiers chosen by the server.
+var DefaultDiffNormalizers = []Normalizer{ScrubDates, ScrubResponseText, ScrubCapabilities, ScrubServerIDs}
+
+// Diff runs the scripts against both targets and returns the commands
+// whose normalized responses differ. The untagged responses of a command
+// are compared as a set, since their order is not significant.
+func Diff(t *testing.T, a, b Target, scripts []Script, normalizers ...Normalizer) []Divergence {
+	t.Helper()
+	if len(normalizers) == 0 {
+		normalizers = DefaultDiffNormalizers
+	}
+
+	var divergences []Divergence
+	for _, script := range scripts {
+		mailbox := "imaptest-" + randomHex(6)
+		got := [2][]string{
+			runScript(t, a, script, mailbox, normalizers),
+			runScript(t, b, script, mailbox, normalizers),
+		}
+		for i, cmd := range script.Commands {
+			if got[0][i] != got[1][i] {
+				divergences = append(divergences, Divergence{
+					Script:  script.Name,
+					Command: cmd,
+					A:       got[0][i],
+					B:       got[1][i],
+				})
+			}
+		}
+	}
+	return divergences
+}
+
+// AssertSameBehavior runs Diff and reports each divergence as an error.
+func AssertSameBehavior(t *testing.T, a, b Target, scripts []Script, normalizers ...Normalizer) {
+	t.Helper()
+	for _, d := range Diff(t, a, b, scripts, normalizers...) {
+		t.Errorf("%s: %s:\n%s:\n%s%s:\n%s", d.Script, d.Command,
+			a.Name, indent(d.A), b.Name, indent(d.B))
+	}
+}
+
+// runScript runs a script on a new connection to target and returns the
+// normalized responses to each command.
+func runScript(t *testing.T, target Target, script Script, mailbox string, normalizers []Normalizer) []string {
+	t.Helper()
+	placeholders := []Normalizer{ScrubPattern(regexp.MustCompile(regexp.QuoteMeta(mailbox)), "$$MAILBOX")}
+	if target.Username != "" {
+		placeholders = append(placeholders,
+			ScrubPattern(regexp.MustCompile(`\b`+regexp.QuoteMeta(target.Username)+`\b`), "$$USER"))
+	}
+
+	_, exchanges := recordScript(t, target, script, mailbox)
+	responses := make([]string, len(exchanges))
+	for i, exchange := range exchanges {
+		exchange = Normalize(Normalize(exchange, placeholders...), normalizers...)
+		responses[i] = canonicalResponses(exchange)
+	}
+	return responses
+}
+
+// recordScript runs a script on a new connection to target and returns
+// the recorded greeting and exchange of each command, unnormalized.
+func recordScript(t *testing.T, target Target, script Script, mailbox string) ([]byte, [][]byte) {
+	t.Helper()
+	greeting, exchanges, err := playScript(target, script, mailbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return greeting, exchanges
+}
+
+// playScript is recordScript returning errors instead of failing a test.
+func playScript(target Target, script Script, mailbox string) (greeting []byte, exchanges [][]byte, err error) {
+	expand := strings.NewReplacer(
+		"$USER", quoteIfNeeded(target.Username),
+		"$PASS", quoteIfNeeded(target.Password),
+		"$MAILBOX", mailbox,
+	)
+
+	rec, err := dialRecorder(target.Addr, target.TLSConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rec.close()
+	greeting = rec.Transcript()
+	exchanges = make([][]byte, len(script.Commands))
+	for i, cmd := range script.Commands {
+		start := len(rec.buf.Bytes())
+		if err := rec.run(expand.Replace(cmd)); err != nil {
+			return nil, nil, err
+		}
+		exchanges[i] = bytes.Clone(rec.buf.Bytes()[start:])
+	}
+
+	// Clean up on a new connection, since the script may have logged out.
+	if strings.Contains(strings.Join(script.Commands, "\n"), "$MAILBOX") {
+		cleanup, err := dialRecorder(target.Addr, target.TLSConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer cleanup.close()
+		commands := []string{expand.Replace("z1 LOGIN $USER $PASS")}
+		for _, name := range []string{mailbox, mailbox + "-other"} {
+			commands = append(commands, "z2 DELETE "+name)
+		}
+		for _, cmd := range append(commands, "z3 LOGOUT") {
+			if err := cleanup.run(cmd); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return greeting, exchanges, nil
+}
+
+// canonicalResponses returns the server responses of a recorded exchange,
+// with the untagged responses sorted and the tags removed.
+func canonicalResponses(exchange []byte) string {
+	var untagged []string
+	var tagged, continuations []string
+	for _, resp := range strings.Split("\r\n"+string(exchange), "\r\nS: ")[1:] {
+		// Drop the command lines recorded after the response
+		resp, _, _ = strings.Cut(resp, "\r\nC: ")
+		resp = strings.TrimSuffix(resp, "\r\n")
+		switch {
+		case strings.HasPrefix(resp, "* "):
+			untagged = append(untagged, resp)
+		case strings.HasPrefix(resp, "+"):
+			continuations = append(continuations, "+")
+		default:
+			_, rest, _ := strings.Cut(resp, " ")
+			tagged = append(tagged, rest)
+		}
+	}
+	sort.Strings(untagged)
+	lines := append(append(untagged, continuations...), tagged...)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// statusTextRe matches the human-readable text of a status response,
+// after its optional response code.
+var statusTextRe = regexp.MustCompile(`(?m)^(S: \S+ (?:OK|NO|BAD|BYE|PREAUTH))( \[[^\]]*\])?(?: [^\r\n]*)?\r$`)
+
+// ScrubResponseText removes the human-readable text of status responses,
+// which differs between servers, keeping their response codes.
+func ScrubResponseText(transcript []byte) []byte {
+	return statusTextRe.ReplaceAll(transcript, []byte("$1$2\r"))
+}
+
+var (
+	capabilityResponseRe = regexp.MustCompile(`(?m)^S: \* CAPABILITY [^\r\n]*`)
+	capabilityCodeRe     = regexp.MustCompile(`\[CAPABILITY [^\]]*\]`)
+)
+
+// ScrubCapabilities removes the capability lists of CAPABILITY responses
+// and response codes, since servers implement different extensions.
+func ScrubCapabilities(transcript []byte) []byte {
+	transcript = capabilityResponseRe.ReplaceAll(transcript, []byte("S: * CAPABILITY"))
+	return capabilityCodeRe.ReplaceAll(transcript, []byte("[CAPABILITY]"))
+}
+
+// serverIDRes match values chosen by the server, with the part to keep as
+// first submatch.
+var serverIDRes = []*regexp.Regexp{
+	regexp.MustCompile(`(UIDVALIDITY )\d+`),
+	regexp.MustCompile(`(APPENDUID )\d+`),
+	regexp.MustCompile(`(COPYUID )\d+`),
+	regexp.MustCompile(`(HIGHESTMODSEQ )\d+`),
+	regexp.MustCompile(`(MODSEQ \()\d+`),
+	regexp.MustCompile(`(MAILBOXID \()[^)]*`),
+	regexp.MustCompile(`(EMAILID \()[^)]*`),
+	regexp.MustCompile(`(THREADID \()[^)]*`),
+}
+
+// ScrubServerIDs replaces UIDVALIDITY values, mod-sequences and object
+// identifiers, which each server chooses, with "x".
+func ScrubServerIDs(transcript []byte) []byte {
+	for _, re := range serverIDRes {
+		transcript = re.ReplaceAll(transcript, []byte("${1}x"))
+	}
+	return transcript
+}
+
+// quoteIfNeeded returns s as an IMAP astring.
+func quoteIfNeeded(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \"\\(){%*]") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func indent(s string) string {
+	return "    " + strings.ReplaceAll(strings.TrimSuffix(s, "\n"), "\n", "\n    ") + "\n"
+}
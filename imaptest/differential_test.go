@@ -0,0 +1,114 @@
+package imaptest
+
+import (
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client"
+	"github.com/meszmate/imap-go/server"
+	_ "github.com/meszmate/imap-go/server/commands"
+	"github.com/meszmate/imap-go/server/memserver"
+	"github.com/meszmate/imap-go/wire"
+)
+
+// memTarget starts a memserver with a single user and returns it as a
+// Target.
+func memTarget(t *testing.T, name, username, password string, opts ...server.Option) (Target, *server.Server) {
+	t.Helper()
+	mem := memserver.New()
+	mem.AddUser(username, password)
+	srv := mem.NewServer(opts...)
+	return NewHarness(t, srv).Target(name, username, password), srv
+}
+
+func TestDiff_SameBehavior(t *testing.T) {
+	// Different accounts and UIDVALIDITY values do not count as
+	// divergences.
+	a, _ := memTarget(t, "a", "alice", "secret")
+	b, _ := memTarget(t, "b", "bob", "hunter 2")
+	AssertSameBehavior(t, a, b, CoreScripts)
+}
+
+func TestDiff_Divergence(t *testing.T) {
+	a, _ := memTarget(t, "a", "alice", "secret")
+	b, srv := memTarget(t, "b", "alice", "secret")
+	srv.WrapHandler("NOOP", func(next server.CommandHandler) server.CommandHandler {
+		return server.CommandHandlerFunc(func(ctx *server.CommandContext) error {
+			return imap.ErrNoWithCode(imap.ResponseCodeUnavailable, "try later")
+		})
+	})
+
+	got := Diff(t, a, b, CoreScripts)
+	if len(got) != 1 {
+		t.Fatalf("Diff() = %+v, want one divergence", got)
+	}
+	want := Divergence{Script: "login", Command: "a4 NOOP", A: "OK\n", B: "NO [UNAVAILABLE]\n"}
+	if got[0] != want {
+		t.Errorf("Diff() = %+v, want %+v", got[0], want)
+	}
+}
+
+// TestDiff_Dovecot compares memserver with the Dovecot server configured
+// by the IMAPTEST_DOVECOT_* environment variables.
+func TestDiff_Dovecot(t *testing.T) {
+	dovecot, ok := DovecotTarget()
+	if !ok {
+		t.Skip(EnvDovecotAddr + " is not set")
+	}
+	a, _ := memTarget(t, "imap-go", "alice", "secret")
+	AssertSameBehavior(t, a, dovecot, CoreScripts)
+}
+
+func TestDiffNormalizers(t *testing.T) {
+	in := "S: * OK [CAPABILITY IMAP4rev1 IDLE] Dovecot ready.\r\n" +
+		"S: * CAPABILITY IMAP4rev2 MOVE\r\n" +
+		"S: * OK [UIDVALIDITY 1760601868] UIDs valid\r\n" +
+		"S: * 1 FETCH (UID 4 MODSEQ (12) EMAILID (M6d99ac3))\r\n" +
+		"S: a1 OK [APPENDUID 38505 3955] Append completed (0.001 + 0.000 secs).\r\n" +
+		"S: a2 NO Mailbox doesn't exist: x\r\n"
+	want := "S: * OK [CAPABILITY]\r\n" +
+		"S: * CAPABILITY\r\n" +
+		"S: * OK [UIDVALIDITY x]\r\n" +
+		"S: * 1 FETCH (UID 4 MODSEQ (x) EMAILID (x))\r\n" +
+		"S: a1 OK [APPENDUID x 3955]\r\n" +
+		"S: a2 NO\r\n"
+	if got := string(Normalize([]byte(in), DefaultDiffNormalizers...)); got != want {
+		t.Errorf("Normalize() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCanonicalResponses(t *testing.T) {
+	exchange := "C: a1 FETCH 1:2 (FLAGS BODY[])\r\n" +
+		"S: * 2 FETCH (FLAGS () BODY[] {5}\r\nhello)\r\n" +
+		"S: * 1 FETCH (FLAGS (\\Seen))\r\n" +
+		"S: a1 OK\r\n"
+	want := "* 1 FETCH (FLAGS (\\Seen))\n" +
+		"* 2 FETCH (FLAGS () BODY[] {5}\r\nhello)\n" +
+		"OK\n"
+	if got := canonicalResponses([]byte(exchange)); got != want {
+		t.Errorf("canonicalResponses() = %q, want %q", got, want)
+	}
+	if strings.Contains(canonicalResponses([]byte("C: a1 APPEND x {1}\r\nS: + go\r\nC: y\r\nS: a1 OK\r\n")), "C:") {
+		t.Error("canonicalResponses() kept a command line")
+	}
+}
+
+func TestConformance(t *testing.T) {
+	target, srv := memTarget(t, "imap-go", "alice", "secret")
+	AssertConformance(t, target, CoreScripts)
+
+	srv.WrapHandler("NOOP", func(next server.CommandHandler) server.CommandHandler {
+		return server.CommandHandlerFunc(func(ctx *server.CommandContext) error {
+			ctx.Conn.Encoder().Encode(func(enc *wire.Encoder) {
+				enc.Star().Atom("0").SP().Atom("EXPUNGE").CRLF()
+			})
+			ctx.Conn.WriteOK(ctx.Tag, "NOOP completed")
+			return nil
+		})
+	})
+	got := CheckConformance(t, target, CoreScripts[:1])
+	if len(got) != 1 || got[0].Command != "a4 NOOP" || got[0].Rule != client.ViolationNumber {
+		t.Errorf("CheckConformance() = %+v, want a number violation for NOOP", got)
+	}
+}
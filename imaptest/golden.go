@@ -0,0 +1,360 @@
+package imaptest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// updateGolden makes AssertGolden rewrite golden files instead of comparing
+// with them. The IMAPTEST_UPDATE environment variable has the same effect.
+var updateGolden = flag.Bool("imaptest.update", false, "rewrite imaptest golden files")
+
+// recordTimeout bounds the time a Recorder waits for a response.
+const recordTimeout = 5 * time.Second
+
+// Recorder sends raw command lines to the harness's server and records the
+// exchange as a transcript, in the style of the RFC examples:
+//
+//	S: * OK [CAPABILITY IMAP4rev1 ...] IMAP server ready
+//	C: A1 LOGIN alice secret
+//	S: A1 OK LOGIN completed
+//
+// Transcripts are meant to be normalized with Normalize and compared with
+// AssertGolden, to lock down the exact output of handlers and extensions.
+type Recorder struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+	buf  bytes.Buffer
+}
+
+// Record connects to the server and returns a Recorder whose transcript
+// starts with the greeting.
+func (h *Harness) Record() *Recorder {
+	h.t.Helper()
+	return RecordAddr(h.t, h.Addr())
+}
+
+// RecordAddr is like Harness.Record for the IMAP server at addr, which
+// need not be served by this package.
+func RecordAddr(t *testing.T, addr string) *Recorder {
+	t.Helper()
+	rec, err := dialRecorder(addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.t = t
+	t.Cleanup(rec.close)
+	return rec
+}
+
+// dialRecorder connects to the server at addr, with implicit TLS if
+// config is not nil, and reads the greeting. The Recorder has no
+// testing.T: only its methods returning errors may be used.
+func dialRecorder(addr string, config *tls.Config) (*Recorder, error) {
+	var conn net.Conn
+	var err error
+	if config != nil {
+		dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: recordTimeout}, Config: config}
+		conn, err = dialer.Dial("tcp", addr)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, recordTimeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+
+	rec := &Recorder{conn: conn, r: bufio.NewReader(conn)}
+	_ = conn.SetReadDeadline(time.Now().Add(recordTimeout))
+	if _, err := rec.readResponse(); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("read greeting: %w", err)
+	}
+	return rec, nil
+}
+
+// close closes the connection.
+func (r *Recorder) close() {
+	_ = r.conn.Close()
+}
+
+// RecordCommands runs the commands on a new connection and returns the
+// transcript.
+func (h *Harness) RecordCommands(commands ...string) []byte {
+	h.t.Helper()
+	rec := h.Record()
+	for _, cmd := range commands {
+		rec.Run(cmd)
+	}
+	return rec.Transcript()
+}
+
+// Run sends a tagged command and records the responses up to and including
+// the tagged response. The command must not end with CRLF. Synchronizing
+// literals are sent after the server's continuation request; the literal
+// data follows the "{n}" with a CRLF, as on the wire:
+//
+//	rec.Run("A1 APPEND INBOX {5}\r\nhello")
+func (r *Recorder) Run(command string) {
+	r.t.Helper()
+	if err := r.run(command); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+// run is Run returning errors instead of failing the test.
+func (r *Recorder) run(command string) error {
+	tag, _, _ := strings.Cut(command, " ")
+	if err := r.conn.SetDeadline(time.Now().Add(recordTimeout)); err != nil {
+		return fmt.Errorf("set deadline: %w", err)
+	}
+
+	rest := command
+	for {
+		chunk, literal, ok := cutSyncLiteral(rest)
+		if err := r.writeLine(chunk); err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		// Wait for the continuation request before sending the literal.
+		for {
+			line, err := r.readResponse()
+			if err != nil {
+				return fmt.Errorf("%s: read continuation: %w", tag, err)
+			}
+			if strings.HasPrefix(line, "+") {
+				break
+			}
+			if strings.HasPrefix(line, tag+" ") {
+				return nil
+			}
+		}
+		rest = literal
+	}
+
+	for {
+		line, err := r.readResponse()
+		if err != nil {
+			return fmt.Errorf("%s: read response: %w", tag, err)
+		}
+		if strings.HasPrefix(line, tag+" ") {
+			break
+		}
+	}
+
+	// Record the responses that arrived along with the tagged response,
+	// so that a response written after it is not mistaken for one of the
+	// next command.
+	for r.r.Buffered() > 0 {
+		if _, err := r.readResponse(); err != nil {
+			return fmt.Errorf("%s: read response: %w", tag, err)
+		}
+	}
+	return nil
+}
+
+// Transcript returns the exchange recorded so far.
+func (r *Recorder) Transcript() []byte {
+	return bytes.Clone(r.buf.Bytes())
+}
+
+// writeLine sends a part of a command, which is either a whole line or the
+// data of a literal followed by the rest of the line, and records it.
+func (r *Recorder) writeLine(s string) error {
+	if _, err := r.conn.Write([]byte(s + "\r\n")); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	r.buf.WriteString("C: " + s + "\r\n")
+	return nil
+}
+
+// readResponse reads and records a response line along with the literals
+// it contains, and returns the first line.
+func (r *Recorder) readResponse() (string, error) {
+	first := ""
+	prefix := "S: "
+	for {
+		line, err := r.r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		r.buf.WriteString(prefix + line)
+		if first == "" {
+			first = line
+		}
+		n, ok := literalSize(strings.TrimRight(line, "\r\n"))
+		if !ok {
+			return first, nil
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(r.r, data); err != nil {
+			return "", err
+		}
+		r.buf.Write(data)
+		prefix = ""
+	}
+}
+
+// literalRe matches a literal at the end of a line.
+var literalRe = regexp.MustCompile(`~?\{(\d+)(\+?)\}$`)
+
+// literalSize returns the size of the literal that ends line, if any.
+func literalSize(line string) (int, bool) {
+	m := literalRe.FindStringSubmatch(line)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// cutSyncLiteral splits a command at the CRLF following its first
+// synchronizing literal. Non-synchronizing literals are sent with the line.
+func cutSyncLiteral(command string) (line, rest string, ok bool) {
+	start := 0
+	for {
+		i := strings.Index(command[start:], "\r\n")
+		if i < 0 {
+			return command, "", false
+		}
+		i += start
+		m := literalRe.FindStringSubmatch(command[:i])
+		if m != nil && m[2] == "" {
+			return command[:i], command[i+2:], true
+		}
+		start = i + 2
+	}
+}
+
+// Normalizer rewrites the parts of a transcript that change between runs.
+type Normalizer func([]byte) []byte
+
+// DefaultNormalizers are used by Normalize if none are given.
+var DefaultNormalizers = []Normalizer{ScrubTags, ScrubDates}
+
+// Normalize applies the normalizers to a transcript, in order. Without
+// normalizers, DefaultNormalizers are applied.
+func Normalize(transcript []byte, normalizers ...Normalizer) []byte {
+	if len(normalizers) == 0 {
+		normalizers = DefaultNormalizers
+	}
+	for _, n := range normalizers {
+		transcript = n(transcript)
+	}
+	return transcript
+}
+
+// transcriptLineRe matches the first word of a transcript line.
+var transcriptLineRe = regexp.MustCompile(`(?m)^([CS]: )(\S+)`)
+
+// ScrubTags renames the command tags of a transcript to A1, A2, ... in the
+// order the commands were sent, in commands and tagged responses alike, so
+// that tests can use any tags.
+func ScrubTags(transcript []byte) []byte {
+	// A tag is the first word of a command line that also starts a server
+	// line; literal data sent by the client never does.
+	matches := transcriptLineRe.FindAllSubmatch(transcript, -1)
+	tagged := make(map[string]bool)
+	for _, m := range matches {
+		if string(m[1]) == "S: " {
+			tagged[string(m[2])] = true
+		}
+	}
+	tags := make(map[string]string)
+	for _, m := range matches {
+		tag := string(m[2])
+		if string(m[1]) == "C: " && tagged[tag] && tags[tag] == "" {
+			tags[tag] = "A" + strconv.Itoa(len(tags)+1)
+		}
+	}
+	return transcriptLineRe.ReplaceAllFunc(transcript, func(b []byte) []byte {
+		m := transcriptLineRe.FindSubmatch(b)
+		if tag, ok := tags[string(m[2])]; ok {
+			return append(append([]byte(nil), m[1]...), tag...)
+		}
+		return b
+	})
+}
+
+// dateTimeRe matches an IMAP date-time, as in INTERNALDATE and SAVEDATE.
+var dateTimeRe = regexp.MustCompile(`[ \d]\d-[A-Z][a-z]{2}-\d{4} \d{2}:\d{2}:\d{2} [+-]\d{4}`)
+
+// ScrubDates replaces IMAP date-times, such as INTERNALDATE values, with
+// " 1-Jan-2000 00:00:00 +0000".
+func ScrubDates(transcript []byte) []byte {
+	return dateTimeRe.ReplaceAll(transcript, []byte(" 1-Jan-2000 00:00:00 +0000"))
+}
+
+// ScrubPattern returns a Normalizer that replaces the matches of re with
+// repl, which may refer to submatches as in regexp.Regexp.ReplaceAll.
+func ScrubPattern(re *regexp.Regexp, repl string) Normalizer {
+	return func(transcript []byte) []byte {
+		return re.ReplaceAll(transcript, []byte(repl))
+	}
+}
+
+// AssertGolden compares got with the golden file testdata/<name>.golden
+// and reports the first differing line. If the test binary is run with
+// -imaptest.update or IMAPTEST_UPDATE is set, the golden file is written
+// instead.
+func AssertGolden(t testing.TB, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".golden")
+	if *updateGolden || os.Getenv("IMAPTEST_UPDATE") != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("create golden directory: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("write golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file: %v (run with -imaptest.update to create it)", err)
+	}
+	if diff := diffLines(want, got); diff != "" {
+		t.Errorf("%s: output does not match golden file:\n%s", path, diff)
+	}
+}
+
+// diffLines describes the first line that differs between want and got,
+// or returns "" if they are equal.
+func diffLines(want, got []byte) string {
+	if bytes.Equal(want, got) {
+		return ""
+	}
+	wantLines := strings.SplitAfter(string(want), "\n")
+	gotLines := strings.SplitAfter(string(got), "\n")
+	for i := 0; ; i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			return fmt.Sprintf("line %d:\n  want %q\n  got  %q", i+1, w, g)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package imaptest
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	_ "github.com/meszmate/imap-go/server/commands"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+func TestRecorder_Golden(t *testing.T) {
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	if err := mem.Deliver("alice", "INBOX", strings.NewReader("Subject: hi\r\n\r\nhello")); err != nil {
+		t.Fatalf("Deliver() error: %v", err)
+	}
+	h := NewHarness(t, mem.NewServer())
+
+	transcript := h.RecordCommands(
+		"x1 LOGIN alice secret",
+		"x2 SELECT INBOX",
+		"x3 FETCH 1 (FLAGS INTERNALDATE RFC822.SIZE)",
+		"x4 LOGOUT",
+	)
+	AssertGolden(t, "session", Normalize(transcript))
+}
+
+func TestScrubTags(t *testing.T) {
+	in := "S: * OK ready\r\n" +
+		"C: abc APPEND INBOX {5}\r\n" +
+		"S: + Ready\r\n" +
+		"C: hello\r\n" +
+		"S: abc OK done\r\n" +
+		"C: zz NOOP\r\n" +
+		"S: zz OK NOOP completed\r\n"
+	want := "S: * OK ready\r\n" +
+		"C: A1 APPEND INBOX {5}\r\n" +
+		"S: + Ready\r\n" +
+		"C: hello\r\n" +
+		"S: A1 OK done\r\n" +
+		"C: A2 NOOP\r\n" +
+		"S: A2 OK NOOP completed\r\n"
+	if got := string(ScrubTags([]byte(in))); got != want {
+		t.Errorf("ScrubTags() = %q, want %q", got, want)
+	}
+}
+
+func TestNormalize_DatesAndPatterns(t *testing.T) {
+	in := `S: * 1 FETCH (INTERNALDATE "16-Oct-2026 09:04:28 +0200" SAVEDATE " 7-Mar-2025 23:59:59 -0500")` + "\r\n" +
+		"S: * OK [UIDVALIDITY 1760601868] \r\n"
+	want := `S: * 1 FETCH (INTERNALDATE " 1-Jan-2000 00:00:00 +0000" SAVEDATE " 1-Jan-2000 00:00:00 +0000")` + "\r\n" +
+		"S: * OK [UIDVALIDITY 1] \r\n"
+	uidValidity := ScrubPattern(regexp.MustCompile(`UIDVALIDITY \d+`), "UIDVALIDITY 1")
+	if got := string(Normalize([]byte(in), ScrubDates, uidValidity)); got != want {
+		t.Errorf("Normalize() = %q, want %q", got, want)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	if diff := diffLines([]byte("a\nb\n"), []byte("a\nb\n")); diff != "" {
+		t.Errorf("diffLines() of equal input = %q, want empty", diff)
+	}
+	want := "line 2:\n  want \"b\\n\"\n  got  \"c\\n\""
+	if diff := diffLines([]byte("a\nb\n"), []byte("a\nc\n")); diff != want {
+		t.Errorf("diffLines() = %q, want %q", diff, want)
+	}
+}
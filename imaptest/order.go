@@ -0,0 +1,259 @@
+package imaptest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// OrderChecker checks that the untagged responses of a session respect
+// the ordering rules of RFC 9051:
+//
+//   - EXISTS, EXPUNGE, FETCH, RECENT and VANISHED responses are only sent
+//     while a command is in progress, that is before the tagged completion
+//     of the command they belong to (§7.5.1 for EXPUNGE; a response after
+//     the tagged OK is an extension writing too late).
+//   - EXPUNGE is not sent while FETCH, STORE or SEARCH is in progress; their
+//     UID forms allow it (§7.5.1).
+//   - EXISTS never reports fewer messages than the client knows of, since
+//     messages only disappear through EXPUNGE (§7.4.1).
+//   - EXPUNGE and FETCH refer to message sequence numbers between 1 and the
+//     number of messages announced by EXISTS and reduced by each EXPUNGE.
+//
+// Commands and responses are fed in the order they are sent on the wire.
+// The message count is only checked once an EXISTS response has been seen
+// after SELECT or EXAMINE.
+type OrderChecker struct {
+	inProgress map[string]string // tag to command name, with the UID prefix
+	lastTagged string
+	count      uint32
+	countKnown bool
+}
+
+// NewOrderChecker returns an OrderChecker for a new session.
+func NewOrderChecker() *OrderChecker {
+	return &OrderChecker{inProgress: make(map[string]string)}
+}
+
+// Command records a command sent by the client. line is the first line of
+// the command, such as "A1 UID FETCH 1:* FLAGS".
+func (oc *OrderChecker) Command(line string) {
+	tag, rest, _ := strings.Cut(line, " ")
+	name := commandName(rest)
+	oc.inProgress[tag] = name
+	if name == "SELECT" || name == "EXAMINE" {
+		oc.countKnown = false
+	}
+}
+
+// commandName returns the upper-case command name at the start of s,
+// including the UID prefix.
+func commandName(s string) string {
+	name, rest, _ := strings.Cut(strings.ToUpper(s), " ")
+	if name == "UID" {
+		next, _, _ := strings.Cut(rest, " ")
+		name += " " + next
+	}
+	return name
+}
+
+// Response checks a response sent by the server. line is the first line of
+// the response, without the literals it may contain.
+func (oc *OrderChecker) Response(line string) error {
+	tag, rest, _ := strings.Cut(line, " ")
+	switch tag {
+	case "+":
+		return nil
+	case "*":
+		return oc.untagged(rest)
+	}
+
+	name, ok := oc.inProgress[tag]
+	if !ok {
+		return fmt.Errorf("tagged response %q for a command that is not in progress", line)
+	}
+	delete(oc.inProgress, tag)
+	oc.lastTagged = tag
+	status, _, _ := strings.Cut(rest, " ")
+	switch {
+	case name == "CLOSE" || name == "UNSELECT":
+		oc.countKnown = false
+	case (name == "SELECT" || name == "EXAMINE") && !strings.EqualFold(status, "OK"):
+		// A failed SELECT leaves no mailbox selected.
+		oc.countKnown = false
+	}
+	return nil
+}
+
+// untagged checks an untagged response, given without the leading "* ".
+func (oc *OrderChecker) untagged(rest string) error {
+	first, tail, _ := strings.Cut(rest, " ")
+	kind, _, _ := strings.Cut(tail, " ")
+	kind = strings.ToUpper(kind)
+	num, err := strconv.ParseUint(first, 10, 32)
+	if err != nil {
+		if strings.EqualFold(first, "VANISHED") {
+			return oc.requireCommand("VANISHED")
+		}
+		return nil
+	}
+	n := uint32(num)
+
+	switch kind {
+	case "EXISTS":
+		if err := oc.requireCommand(kind); err != nil {
+			return err
+		}
+		if oc.countKnown && n < oc.count {
+			return fmt.Errorf("* %d EXISTS decreases the message count from %d without EXPUNGE", n, oc.count)
+		}
+		oc.count, oc.countKnown = n, true
+	case "RECENT":
+		return oc.requireCommand(kind)
+	case "EXPUNGE":
+		if err := oc.requireCommand(kind); err != nil {
+			return err
+		}
+		for _, name := range oc.inProgress {
+			if name == "FETCH" || name == "STORE" || name == "SEARCH" {
+				return fmt.Errorf("* %d EXPUNGE sent while %s is in progress", n, name)
+			}
+		}
+		if oc.countKnown {
+			if n < 1 || n > oc.count {
+				return fmt.Errorf("* %d EXPUNGE out of range, %d messages exist", n, oc.count)
+			}
+			oc.count--
+		}
+	case "FETCH":
+		if err := oc.requireCommand(kind); err != nil {
+			return err
+		}
+		if oc.countKnown && (n < 1 || n > oc.count) {
+			return fmt.Errorf("* %d FETCH out of range, %d messages exist", n, oc.count)
+		}
+	}
+	return nil
+}
+
+// requireCommand returns an error if no command is in progress.
+func (oc *OrderChecker) requireCommand(kind string) error {
+	if len(oc.inProgress) > 0 {
+		return nil
+	}
+	if oc.lastTagged != "" {
+		return fmt.Errorf("untagged %s sent after the tagged response of %s", kind, oc.lastTagged)
+	}
+	return fmt.Errorf("untagged %s sent while no command is in progress", kind)
+}
+
+// CheckOrder runs an OrderChecker over a transcript recorded by a Recorder
+// and returns the violations found, each prefixed with its line number in
+// the transcript.
+func CheckOrder(transcript []byte) error {
+	oc := NewOrderChecker()
+	tr := &transcriptReader{data: transcript}
+	var errs []error
+	for {
+		lineNum, dir, line, ok := tr.next()
+		if !ok {
+			break
+		}
+		if dir == 'C' {
+			oc.Command(line)
+			continue
+		}
+		if err := oc.Response(line); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", lineNum, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AssertOrder reports the violations of the response ordering rules found
+// by CheckOrder in a transcript.
+func AssertOrder(t testing.TB, transcript []byte) {
+	t.Helper()
+	if err := CheckOrder(transcript); err != nil {
+		t.Errorf("response ordering violated:\n%v", err)
+	}
+}
+
+// transcriptReader splits a transcript into commands and responses,
+// skipping the literals they contain and the client's continuation data.
+type transcriptReader struct {
+	data    []byte
+	line    int
+	pending int  // size of a synchronizing literal sent after "+"
+	cont    bool // the server sent a continuation request
+}
+
+// next returns the line number, direction ('C' or 'S') and first line of
+// the next command or response.
+func (tr *transcriptReader) next() (lineNum int, dir byte, line string, ok bool) {
+	for len(tr.data) > 0 {
+		if tr.cont && bytes.HasPrefix(tr.data, []byte("C: ")) {
+			// Literal data or a continuation response, such as DONE
+			// or an AUTHENTICATE response, rather than a command.
+			tr.data = tr.data[len("C: "):]
+			tr.skip(tr.pending)
+			tr.skipLiterals(tr.readLine(), true)
+			tr.cont, tr.pending = false, 0
+			continue
+		}
+
+		lineNum = tr.line + 1
+		prefix, text, found := strings.Cut(tr.readLine(), ": ")
+		if !found || (prefix != "C" && prefix != "S") {
+			continue
+		}
+		dir = prefix[0]
+		if dir == 'S' {
+			tr.cont = strings.HasPrefix(text, "+")
+		}
+		tr.skipLiterals(text, dir == 'C')
+		return lineNum, dir, text, true
+	}
+	return 0, 0, "", false
+}
+
+// readLine consumes and returns the next line, without CRLF.
+func (tr *transcriptReader) readLine() string {
+	i := bytes.IndexByte(tr.data, '\n')
+	if i < 0 {
+		i = len(tr.data) - 1
+	}
+	line := string(tr.data[:i+1])
+	tr.data = tr.data[i+1:]
+	tr.line++
+	return strings.TrimRight(line, "\r\n")
+}
+
+// skip consumes n bytes of literal data, counting the lines they span.
+func (tr *transcriptReader) skip(n int) {
+	n = min(n, len(tr.data))
+	tr.line += bytes.Count(tr.data[:n], []byte("\n"))
+	tr.data = tr.data[n:]
+}
+
+// skipLiterals consumes the literals that end line and the lines that
+// continue it. A synchronizing literal of the client is only sent after a
+// continuation request, so its size is kept for the next client line.
+func (tr *transcriptReader) skipLiterals(line string, client bool) {
+	for {
+		m := literalRe.FindStringSubmatch(line)
+		if m == nil {
+			return
+		}
+		n, _ := strconv.Atoi(m[1])
+		if client && m[2] == "" {
+			tr.pending = n
+			return
+		}
+		tr.skip(n)
+		line = tr.readLine()
+	}
+}
@@ -0,0 +1,120 @@
+package imaptest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+func TestCheckOrder(t *testing.T) {
+	selected := "S: * OK ready\r\n" +
+		"C: A1 SELECT INBOX\r\n" +
+		"S: * 3 EXISTS\r\n" +
+		"S: A1 OK done\r\n"
+
+	tests := []struct {
+		name       string
+		transcript string
+		want       string // substring of the error, or "" for none
+	}{
+		{
+			name: "valid",
+			transcript: selected +
+				"C: A2 NOOP\r\n" +
+				"S: * 2 EXPUNGE\r\n" +
+				"S: * 3 EXISTS\r\n" +
+				"S: * 3 FETCH (FLAGS ())\r\n" +
+				"S: A2 OK done\r\n" +
+				"C: A3 UID FETCH 1:* BODY[]\r\n" +
+				"S: * 1 FETCH (UID 1 BODY[] {13}\r\n" +
+				"S: * 9 EXISTS)\r\n" +
+				"S: * 1 EXPUNGE\r\n" +
+				"S: A3 OK done\r\n" +
+				"C: A4 APPEND INBOX {5}\r\n" +
+				"S: + Ready\r\n" +
+				"C: A5 OK\r\n" +
+				"S: * 3 EXISTS\r\n" +
+				"S: A4 OK done\r\n" +
+				"C: A6 IDLE\r\n" +
+				"S: + idling\r\n" +
+				"S: * 4 EXISTS\r\n" +
+				"C: DONE\r\n" +
+				"S: A6 OK done\r\n",
+		},
+		{
+			name:       "EXISTS after tagged OK",
+			transcript: selected + "S: * 4 EXISTS\r\n",
+			want:       "line 5: untagged EXISTS sent after the tagged response of A1",
+		},
+		{
+			name: "EXPUNGE during FETCH",
+			transcript: selected +
+				"C: A2 FETCH 1:* FLAGS\r\n" +
+				"S: * 1 EXPUNGE\r\n" +
+				"S: A2 OK done\r\n",
+			want: "EXPUNGE sent while FETCH is in progress",
+		},
+		{
+			name: "EXISTS shrinks",
+			transcript: selected +
+				"C: A2 NOOP\r\n" +
+				"S: * 2 EXISTS\r\n" +
+				"S: A2 OK done\r\n",
+			want: "* 2 EXISTS decreases the message count from 3",
+		},
+		{
+			name: "FETCH out of range",
+			transcript: selected +
+				"C: A2 NOOP\r\n" +
+				"S: * 3 EXPUNGE\r\n" +
+				"S: * 3 FETCH (FLAGS ())\r\n" +
+				"S: A2 OK done\r\n",
+			want: "* 3 FETCH out of range, 2 messages exist",
+		},
+		{
+			name:       "unknown tag",
+			transcript: selected + "S: A9 OK done\r\n",
+			want:       "for a command that is not in progress",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckOrder([]byte(tt.transcript))
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("CheckOrder() error: %v", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("CheckOrder() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckOrder_Session(t *testing.T) {
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	for i := 0; i < 3; i++ {
+		if err := mem.Deliver("alice", "INBOX", strings.NewReader("Subject: hi\r\n\r\nhello")); err != nil {
+			t.Fatalf("Deliver() error: %v", err)
+		}
+	}
+	h := NewHarness(t, mem.NewServer())
+
+	other := h.Record()
+	other.Run("b1 LOGIN alice secret")
+	other.Run("b2 SELECT INBOX")
+
+	rec := h.Record()
+	rec.Run("a1 LOGIN alice secret")
+	rec.Run("a2 SELECT INBOX")
+	other.Run(`b3 STORE 2 +FLAGS (\Deleted)`)
+	other.Run("b4 EXPUNGE")
+	rec.Run("a3 FETCH 1:* FLAGS")
+	rec.Run("a4 APPEND INBOX {5}\r\nhello")
+	rec.Run("a5 NOOP")
+	rec.Run("a6 LOGOUT")
+
+	AssertOrder(t, rec.Transcript())
+	AssertOrder(t, other.Transcript())
+}
@@ -0,0 +1,88 @@
+package imaptest
+
+import (
+	"net"
+	"testing"
+
+	"github.com/meszmate/imap-go/client"
+	"github.com/meszmate/imap-go/server"
+)
+
+// Pipe is a client connected to a server over an in-memory pipe, without
+// TCP, for fast full-stack tests of code using the client:
+//
+//	mem := memserver.New()
+//	mem.AddUser("alice", "secret")
+//	p := imaptest.NewPipe(t, mem.NewServer())
+//	app := NewApp(p.Client)
+//	...
+//	if p.ServerConn().Mailbox() != "INBOX" { ... }
+//
+// Both sides can be inspected at any point of a test: the client with
+// the methods of Client, the server's side of the connection with
+// ServerConn and Session.
+type Pipe struct {
+	// Client is the client, connected and greeted but not logged in.
+	Client *client.Client
+
+	t      testing.TB
+	srv    *server.Server
+	server net.Conn
+	done   chan struct{}
+}
+
+// NewPipe connects a new client to srv, with the given client options.
+// The server sees the connection as not using TLS, so srv has to allow
+// insecure authentication for the client to log in, as servers of
+// memserver.MemServer.NewServer do. The connection is closed when the
+// test ends.
+func NewPipe(t testing.TB, srv *server.Server, opts ...client.Option) *Pipe {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	p := &Pipe{t: t, srv: srv, server: serverConn, done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		_ = srv.ServeConn(serverConn)
+	}()
+
+	c, err := client.New(clientConn, opts...)
+	if err != nil {
+		_ = clientConn.Close()
+		<-p.done
+		t.Fatalf("imaptest: connecting client: %v", err)
+	}
+	p.Client = c
+	t.Cleanup(p.Close)
+	return p
+}
+
+// ServerConn returns the server's side of the connection, to inspect its
+// state, selected mailbox or user. It fails the test if the connection
+// has ended.
+func (p *Pipe) ServerConn() *server.Conn {
+	p.t.Helper()
+	for _, c := range p.srv.Conns() {
+		if c.NetConn() == p.server {
+			return c
+		}
+	}
+	p.t.Fatalf("imaptest: the server's side of the pipe is closed")
+	return nil
+}
+
+// Session returns the session of the server's side of the connection,
+// such as a *memserver.Session.
+func (p *Pipe) Session() server.Session {
+	p.t.Helper()
+	return p.ServerConn().Session()
+}
+
+// Close closes the client and waits for the server to finish serving the
+// connection.
+func (p *Pipe) Close() {
+	if p.Client != nil {
+		_ = p.Client.Close()
+	}
+	_ = p.server.Close()
+	<-p.done
+}
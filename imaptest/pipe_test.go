@@ -0,0 +1,46 @@
+package imaptest
+
+import (
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	_ "github.com/meszmate/imap-go/server/commands"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+func TestPipe(t *testing.T) {
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	srv := mem.NewServer()
+	p := NewPipe(t, srv)
+
+	if state := p.ServerConn().State(); state != imap.ConnStateNotAuthenticated {
+		t.Errorf("state before login = %v, want not authenticated", state)
+	}
+	if err := p.Client.Login("alice", "secret"); err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	if _, err := p.Client.Select("INBOX", nil); err != nil {
+		t.Fatalf("Select() error: %v", err)
+	}
+	conn := p.ServerConn()
+	if conn.Username() != "alice" || conn.Mailbox() != "INBOX" {
+		t.Errorf("server side: user %q, mailbox %q", conn.Username(), conn.Mailbox())
+	}
+	if _, ok := p.Session().(*memserver.Session); !ok {
+		t.Errorf("Session() = %T, want *memserver.Session", p.Session())
+	}
+
+	if _, err := p.Client.Append("INBOX", nil, []byte("Subject: pipe\r\n\r\nbody\r\n")); err != nil {
+		t.Fatalf("Append() error: %v", err)
+	}
+	if n := mem.GetUserData("alice").GetMailbox("INBOX").NumMessages(); n != 1 {
+		t.Errorf("INBOX has %d messages, want 1", n)
+	}
+
+	p.Close()
+	p.Close()
+	if n := len(srv.Conns()); n != 0 {
+		t.Errorf("%d connections left", n)
+	}
+}
@@ -0,0 +1,138 @@
+package imaptest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meszmate/imap-go/middleware"
+)
+
+// ReplayOptions configures Replay.
+type ReplayOptions struct {
+	// Username and Password log in instead of the credentials of LOGIN
+	// and AUTHENTICATE commands, which archives do not keep.
+	Username, Password string
+}
+
+// Replay sends the commands of a session recorded by middleware.Recorder,
+// such as a production incident, to the harness's server, and returns
+// the transcript of the replay. It can be compared with the transcript of
+// the archive, after normalization, to find where the server behaves
+// differently.
+//
+// Commands are sent one at a time, each after the response to the one
+// before. The data of redacted literals is replaced by as many "x" bytes,
+// and LOGIN and AUTHENTICATE by a LOGIN with the credentials of opts. IDLE
+// is ended as soon as the server accepts it.
+func (h *Harness) Replay(archive *middleware.SessionArchive, opts *ReplayOptions) []byte {
+	h.t.Helper()
+	return ReplayAddr(h.t, h.Addr(), archive, opts)
+}
+
+// ReplayAddr is like Harness.Replay for the IMAP server at addr.
+func ReplayAddr(t *testing.T, addr string, archive *middleware.SessionArchive, opts *ReplayOptions) []byte {
+	t.Helper()
+	rec := RecordAddr(t, addr)
+	for _, cmd := range replayCommands(archive) {
+		tag, rest, _ := strings.Cut(cmd, " ")
+		name, _, _ := strings.Cut(rest, " ")
+		switch strings.ToUpper(name) {
+		case "LOGIN", "AUTHENTICATE":
+			if opts != nil {
+				cmd = tag + " LOGIN " + quoteIfNeeded(opts.Username) + " " + quoteIfNeeded(opts.Password)
+			}
+			rec.Run(cmd)
+		case "IDLE":
+			rec.runIdle(tag)
+		default:
+			rec.Run(cmd)
+		}
+	}
+	return rec.Transcript()
+}
+
+// replayCommands returns the commands sent by the client of an archive,
+// with their literals, leaving out SASL responses and the DONE of IDLE.
+func replayCommands(archive *middleware.SessionArchive) []string {
+	var commands []string
+	var cur strings.Builder
+	inCommand, skipping := false, ""
+	for _, e := range archive.Entries {
+		if e.From != "C" {
+			continue
+		}
+		switch {
+		case e.Literal:
+			if e.Redacted {
+				cur.WriteString(strings.Repeat("x", e.Size))
+			} else {
+				cur.WriteString(e.Data)
+			}
+			continue
+		case inCommand:
+			// The rest of a command after a literal
+			cur.WriteString(e.Data)
+		case skipping == "AUTHENTICATE" && (e.Redacted || e.Data == "*"):
+			continue
+		case skipping == "IDLE" && strings.EqualFold(e.Data, "DONE"):
+			skipping = ""
+			continue
+		default:
+			cur.WriteString(e.Data)
+		}
+
+		if literalRe.MatchString(e.Data) {
+			inCommand = true
+			cur.WriteString("\r\n")
+			continue
+		}
+		cmd := cur.String()
+		cur.Reset()
+		inCommand, skipping = false, ""
+		if _, rest, ok := strings.Cut(cmd, " "); ok {
+			name, _, _ := strings.Cut(rest, " ")
+			if upper := strings.ToUpper(name); upper == "AUTHENTICATE" || upper == "IDLE" {
+				skipping = upper
+			}
+		}
+		commands = append(commands, cmd)
+	}
+	return commands
+}
+
+// runIdle sends IDLE and ends it with DONE as soon as the server accepts
+// it.
+func (r *Recorder) runIdle(tag string) {
+	r.t.Helper()
+	if err := r.conn.SetDeadline(time.Now().Add(recordTimeout)); err != nil {
+		r.t.Fatalf("set deadline: %v", err)
+	}
+	if err := r.writeLine(tag + " IDLE"); err != nil {
+		r.t.Fatal(err)
+	}
+	for {
+		line, err := r.readResponse()
+		if err != nil {
+			r.t.Fatalf("%s: read response: %v", tag, err)
+		}
+		if strings.HasPrefix(line, tag+" ") {
+			return
+		}
+		if strings.HasPrefix(line, "+") {
+			break
+		}
+	}
+	if err := r.writeLine("DONE"); err != nil {
+		r.t.Fatal(err)
+	}
+	for {
+		line, err := r.readResponse()
+		if err != nil {
+			r.t.Fatalf("%s: read response: %v", tag, err)
+		}
+		if strings.HasPrefix(line, tag+" ") {
+			return
+		}
+	}
+}
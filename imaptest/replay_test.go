@@ -0,0 +1,87 @@
+package imaptest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meszmate/imap-go/middleware"
+	_ "github.com/meszmate/imap-go/server/commands"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+// serverLines returns the normalized server lines of a transcript.
+func serverLines(transcript []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(Normalize(transcript)), "\r\n") {
+		if strings.HasPrefix(line, "S: ") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestReplay(t *testing.T) {
+	archives := make(chan *middleware.SessionArchive, 1)
+	rec := middleware.NewRecorder(func(a *middleware.SessionArchive) { archives <- a })
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	srv := mem.NewServer(rec.ServerOptions()...)
+	middleware.Apply(srv, rec.Middleware())
+	h := NewHarness(t, srv)
+
+	r := h.Record()
+	r.Run("x1 LOGIN alice secret")
+	r.Run("x2 APPEND INBOX {5}\r\nhello")
+	r.Run("x3 SELECT INBOX")
+	r.runIdle("x4")
+	r.Run("x5 FETCH 1 (FLAGS RFC822.SIZE)")
+	r.Run("x6 LOGOUT")
+
+	var archive *middleware.SessionArchive
+	select {
+	case archive = <-archives:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no archive after the connection was closed")
+	}
+	if strings.Contains(string(archive.Transcript()), "secret") {
+		t.Error("archive contains the password")
+	}
+	if len(archive.Commands) != 6 {
+		t.Errorf("archive has %d commands, want 6", len(archive.Commands))
+	}
+
+	// Replay against another server, as another user
+	mem2 := memserver.New()
+	mem2.AddUser("bob", "pw")
+	h2 := NewHarness(t, mem2.NewServer())
+	replay := h2.Replay(archive, &ReplayOptions{Username: "bob", Password: "pw"})
+
+	got, want := serverLines(replay), serverLines(archive.Transcript())
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("replay differs:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if len(got) < 10 {
+		t.Errorf("replay has %d server lines:\n%s", len(got), replay)
+	}
+}
+
+func TestReplayCommands(t *testing.T) {
+	archive := &middleware.SessionArchive{Entries: []middleware.ArchiveEntry{
+		{From: "S", Data: "* OK ready"},
+		{From: "C", Data: "a AUTHENTICATE PLAIN"},
+		{From: "S", Data: "+ "},
+		{From: "C", Data: "<redacted>", Redacted: true},
+		{From: "C", Data: "b IDLE"},
+		{From: "C", Data: "DONE"},
+		{From: "C", Data: "c APPEND INBOX {3+}"},
+		{From: "C", Literal: true, Redacted: true, Size: 3},
+		{From: "C", Data: ""},
+		{From: "C", Data: "d NOOP"},
+	}}
+	got := replayCommands(archive)
+	want := []string{"a AUTHENTICATE PLAIN", "b IDLE", "c APPEND INBOX {3+}\r\nxxx", "d NOOP"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("replayCommands() = %q, want %q", got, want)
+	}
+}
@@ -1,5 +1,7 @@
 package imap
 
+import "strings"
+
 // ListOptions specifies options for the LIST command.
 type ListOptions struct {
 	// SelectSubscribed only returns subscribed mailboxes.
@@ -37,7 +39,10 @@ type ListReturnMetadata struct {
 
 // ListData represents a single LIST response.
 type ListData struct {
-	// Attrs is the list of mailbox attributes.
+	// Attrs is the list of mailbox attributes, such as \Noselect,
+	// \NonExistent, \Marked, \Unmarked and the special-use attributes
+	// (RFC 3501, RFC 5258, RFC 6154). They are written in order, without
+	// duplicates.
 	Attrs []MailboxAttr
 	// Delim is the hierarchy delimiter character (0 if none).
 	Delim rune
@@ -51,8 +56,148 @@ type ListData struct {
 	ChildInfo []string
 	// Status is included when LIST-STATUS is requested.
 	Status *StatusData
-	// MyRights is included when LIST-MYRIGHTS is requested.
+	// MyRights are the rights of the user on the mailbox, see ACLRights,
+	// included when LIST-MYRIGHTS (RFC 8440) is requested.
 	MyRights string
 	// Metadata is included when LIST-METADATA is requested.
 	Metadata map[string]string
+	// Extended holds the other extended data items, such as those of
+	// vendor extensions, in order.
+	Extended []ListExtendedItem
+}
+
+// HasAttr reports whether the mailbox has the attribute attr, compared
+// case-insensitively.
+func (d *ListData) HasAttr(attr MailboxAttr) bool {
+	for _, a := range d.Attrs {
+		if strings.EqualFold(string(a), string(attr)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Selectable reports whether the mailbox can be selected, that is whether
+// it has neither the \Noselect nor the \NonExistent attribute, which
+// implies \Noselect (RFC 5258).
+func (d *ListData) Selectable() bool {
+	return !d.HasAttr(MailboxAttrNoSelect) && !d.HasAttr(MailboxAttrNonExistent)
+}
+
+// HasChildren reports whether the mailbox has the \HasChildren attribute.
+// Servers without the CHILDREN extension or the CHILDREN return option
+// may not send it for mailboxes with children.
+func (d *ListData) HasChildren() bool {
+	return d.HasAttr(MailboxAttrHasChildren)
+}
+
+// SpecialUse returns the special-use attribute of the mailbox (RFC 6154),
+// such as MailboxAttrTrash, or "" if it has none. The attribute is
+// returned as defined by the constant, whatever the case the server used.
+func (d *ListData) SpecialUse() MailboxAttr {
+	for _, a := range d.Attrs {
+		for _, attr := range SpecialUseAttrs {
+			if strings.EqualFold(string(a), string(attr)) {
+				return attr
+			}
+		}
+	}
+	return ""
+}
+
+// Role returns the special-use attribute of the mailbox or, if it has
+// none and is selectable, the one guessed from its name with
+// GuessSpecialUse. Guesses are
+// wrong for servers supporting SPECIAL-USE whose special-use mailboxes
+// have other names, see MailboxRoles to find the mailboxes of a whole
+// LIST result.
+func (d *ListData) Role() MailboxAttr {
+	if attr := d.SpecialUse(); attr != "" {
+		return attr
+	}
+	if !d.Selectable() {
+		return ""
+	}
+	return GuessSpecialUse(d.Mailbox, d.Delim)
+}
+
+// IsTrash reports whether the role of the mailbox is \Trash.
+func (d *ListData) IsTrash() bool { return d.Role() == MailboxAttrTrash }
+
+// IsSent reports whether the role of the mailbox is \Sent.
+func (d *ListData) IsSent() bool { return d.Role() == MailboxAttrSent }
+
+// IsDrafts reports whether the role of the mailbox is \Drafts.
+func (d *ListData) IsDrafts() bool { return d.Role() == MailboxAttrDrafts }
+
+// IsJunk reports whether the role of the mailbox is \Junk.
+func (d *ListData) IsJunk() bool { return d.Role() == MailboxAttrJunk }
+
+// IsArchive reports whether the role of the mailbox is \Archive.
+func (d *ListData) IsArchive() bool { return d.Role() == MailboxAttrArchive }
+
+// ListExtendedItem is an extended data item of a LIST response (RFC 5258
+// section 9, mbox-list-extended-item), such as ("X-VENDOR" (1 2)).
+type ListExtendedItem struct {
+	// Tag is the name of the item, written as a quoted string.
+	Tag string
+	// Value is the data of the item. A string is written inside a list,
+	// since RFC 4466 only allows strings within lists.
+	Value ExtendedValue
+}
+
+// ExtendedValueKind is the kind of an ExtendedValue.
+type ExtendedValueKind int
+
+const (
+	// ExtendedValueAtom is a number, a sequence set or another atom,
+	// written as is.
+	ExtendedValueAtom ExtendedValueKind = iota
+	// ExtendedValueString is a string, written as an atom, a quoted
+	// string or a literal as needed.
+	ExtendedValueString
+	// ExtendedValueList is a parenthesized list of values.
+	ExtendedValueList
+)
+
+// ExtendedValue is the value of extended data (RFC 4466 tagged-ext-val):
+// an atom such as a number or sequence set, a string, or a parenthesized
+// list of values. Parsers cannot tell an atom from a string written as an
+// atom, and return both as ExtendedValueAtom.
+type ExtendedValue struct {
+	Kind ExtendedValueKind
+	// Text is the atom or string.
+	Text string
+	// List is the values of a list.
+	List []ExtendedValue
+}
+
+// ExtendedAtom returns an ExtendedValue holding an atom.
+func ExtendedAtom(s string) ExtendedValue {
+	return ExtendedValue{Kind: ExtendedValueAtom, Text: s}
+}
+
+// ExtendedString returns an ExtendedValue holding a string.
+func ExtendedString(s string) ExtendedValue {
+	return ExtendedValue{Kind: ExtendedValueString, Text: s}
+}
+
+// ExtendedList returns an ExtendedValue holding a list of values.
+func ExtendedList(values ...ExtendedValue) ExtendedValue {
+	return ExtendedValue{Kind: ExtendedValueList, List: values}
+}
+
+// Strings returns the texts of the values of a list, or the text of an
+// atom or string as a single element.
+func (v ExtendedValue) Strings() []string {
+	if v.Kind != ExtendedValueList {
+		return []string{v.Text}
+	}
+	s := make([]string, 0, len(v.List))
+	for _, item := range v.List {
+		if item.Kind != ExtendedValueList {
+			s = append(s, item.Text)
+		}
+	}
+	return s
 }
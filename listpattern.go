@@ -0,0 +1,62 @@
+package imap
+
+// MatchListPattern reports whether a mailbox name matches a LIST pattern
+// (RFC 3501 §6.3.8), in which '*' matches any characters and '%' matches
+// any characters except the hierarchy delimiter delim. Names are compared
+// exactly; callers canonicalize INBOX first.
+//
+// The pattern is matched as a finite automaton over the runes of name, so
+// matching takes O(len(pattern) × len(name)) time whatever the number of
+// wildcards, and patterns like "*a*a*a*a*b" cannot make it backtrack
+// exponentially.
+func MatchListPattern(pattern, name string, delim rune) bool {
+	p := []rune(pattern)
+
+	// active[i] reports whether the first i runes of the pattern can match
+	// the runes of name read so far.
+	active := make([]bool, len(p)+1)
+	next := make([]bool, len(p)+1)
+	active[0] = true
+	closeWildcards(p, active)
+
+	for _, c := range name {
+		alive := false
+		for i := range next {
+			next[i] = false
+		}
+		for i, ok := range active[:len(p)] {
+			if !ok {
+				continue
+			}
+			switch p[i] {
+			case '*':
+				next[i] = true
+			case '%':
+				if c != delim {
+					next[i] = true
+				}
+			default:
+				if p[i] == c {
+					next[i+1] = true
+				}
+			}
+			alive = alive || next[i] || next[i+1]
+		}
+		if !alive {
+			return false
+		}
+		closeWildcards(p, next)
+		active, next = next, active
+	}
+	return active[len(p)]
+}
+
+// closeWildcards marks the states reached by wildcards matching no
+// characters.
+func closeWildcards(p []rune, active []bool) {
+	for i, c := range p {
+		if active[i] && (c == '*' || c == '%') {
+			active[i+1] = true
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package imap
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchListPattern(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"", "", true},
+		{"", "INBOX", false},
+		{"INBOX", "INBOX", true},
+		{"INBOX", "INBOX2", false},
+		{"*", "", true},
+		{"*", "A/B/C", true},
+		{"%", "A", true},
+		{"%", "A/B", false},
+		{"A/*", "A/B/C", true},
+		{"A/*", "A", false},
+		{"A/%", "A/B", true},
+		{"A/%", "A/B/C", false},
+		{"%/C", "B/C", true},
+		{"%/C", "A/B/C", false},
+		{"*/C", "A/B/C", true},
+		{"A%%B", "AxB", true},
+		{"A*%", "A/B", true},
+		{"%*", "A/B", true},
+		{"Te%t", "Test", true},
+		{"Te%t", "Te/t", false},
+		{"*é*", "Café/Menu", true},
+		{"Caf%/%", "Café/Menu", true},
+	}
+	for _, tt := range tests {
+		if got := MatchListPattern(tt.pattern, tt.name, '/'); got != tt.want {
+			t.Errorf("MatchListPattern(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+
+	// A non-ASCII delimiter is honored.
+	if MatchListPattern("%", "a·b", '·') {
+		t.Error("'%' matched across a non-ASCII delimiter")
+	}
+}
+
+func TestMatchListPattern_Adversarial(t *testing.T) {
+	name := strings.Repeat(strings.Repeat("a", 30)+"/", 60)
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{strings.Repeat("*a", 40) + "*b", false},
+		{strings.Repeat("%a", 40) + "%b", false},
+		{strings.Repeat("*%", 200) + "b", false},
+		{strings.Repeat("*a", 40) + "*", true},
+		{strings.Repeat("*", 1000), true},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		if got := MatchListPattern(tt.pattern, name, '/'); got != tt.want {
+			t.Errorf("MatchListPattern(%.20q...) = %v, want %v", tt.pattern, got, tt.want)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("MatchListPattern(%.20q...) took %v", tt.pattern, d)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package imap
+
+import "strings"
+
+// InboxName is the canonical name of the INBOX mailbox.
+const InboxName = "INBOX"
+
+// IsInbox reports whether name refers to INBOX. Per RFC 3501 section 5.1,
+// the name INBOX is case-insensitive, so "inbox" and "Inbox" both match.
+func IsInbox(name string) bool {
+	return strings.EqualFold(name, InboxName)
+}
+
+// CanonicalMailboxName returns the canonical form of a mailbox name: any case
+// variant of INBOX is mapped to "INBOX" and all other names are returned
+// unchanged. Backends can use the result as a lookup key.
+func CanonicalMailboxName(name string) string {
+	if IsInbox(name) {
+		return InboxName
+	}
+	return name
+}
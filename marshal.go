@@ -0,0 +1,223 @@
+package imap
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MarshalText implements encoding.TextMarshaler. The set is encoded in
+// IMAP syntax, such as "1:5,7,10:*", so that it reads naturally in JSON
+// and configuration files.
+func (ss SeqSet) MarshalText() ([]byte, error) {
+	return []byte(formatNumSet(ss.Set)), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. Empty text decodes to
+// an empty set.
+func (ss *SeqSet) UnmarshalText(text []byte) error {
+	ranges, err := unmarshalNumSet(text)
+	if err != nil {
+		return err
+	}
+	ss.Set = ranges
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler, see SeqSet.MarshalText.
+func (us UIDSet) MarshalText() ([]byte, error) {
+	return []byte(formatNumSet(us.Set)), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. Empty text decodes to
+// an empty set.
+func (us *UIDSet) UnmarshalText(text []byte) error {
+	ranges, err := unmarshalNumSet(text)
+	if err != nil {
+		return err
+	}
+	us.Set = ranges
+	return nil
+}
+
+func unmarshalNumSet(text []byte) ([]NumRange, error) {
+	if len(text) == 0 {
+		return nil, nil
+	}
+	return parseNumSet(string(text))
+}
+
+// systemFlags are the flags starting with a backslash defined by IMAP,
+// by lower-case name.
+var systemFlags = map[string]Flag{
+	`\seen`:     FlagSeen,
+	`\answered`: FlagAnswered,
+	`\flagged`:  FlagFlagged,
+	`\deleted`:  FlagDeleted,
+	`\draft`:    FlagDraft,
+	`\recent`:   FlagRecent,
+	`\*`:        FlagWildcard,
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (f Flag) MarshalText() ([]byte, error) {
+	return []byte(f), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. It rejects text that
+// is not a valid flag, such as "" or "two words", and writes system flags
+// in their canonical case, so that "\seen" decodes to FlagSeen.
+func (f *Flag) UnmarshalText(text []byte) error {
+	s := string(text)
+	if sys, ok := systemFlags[strings.ToLower(s)]; ok {
+		*f = sys
+		return nil
+	}
+
+	if !isFlagAtom(strings.TrimPrefix(s, `\`)) {
+		return fmt.Errorf("imap: invalid flag %q", s)
+	}
+	*f = Flag(s)
+	return nil
+}
+
+// isFlagAtom reports whether s is a non-empty atom that may appear in a
+// flag, which excludes "]" as well as the atom-specials.
+func isFlagAtom(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch b := s[i]; {
+		case b <= ' ' || b >= 0x7f,
+			b == '(' || b == ')' || b == '{' || b == '%' || b == '*' || b == '"' || b == '\\' || b == ']':
+			return false
+		}
+	}
+	return true
+}
+
+// searchCriteriaJSON is the JSON form of SearchCriteria, which leaves out
+// unset criteria.
+type searchCriteriaJSON struct {
+	SeqNum *SeqSet `json:",omitempty"`
+	UID    *UIDSet `json:",omitempty"`
+
+	Since      *time.Time `json:",omitempty"`
+	Before     *time.Time `json:",omitempty"`
+	SentSince  *time.Time `json:",omitempty"`
+	SentBefore *time.Time `json:",omitempty"`
+	SentOn     *time.Time `json:",omitempty"`
+	On         *time.Time `json:",omitempty"`
+
+	SavedBefore *time.Time `json:",omitempty"`
+	SavedSince  *time.Time `json:",omitempty"`
+	SavedOn     *time.Time `json:",omitempty"`
+
+	Header []SearchCriteriaHeaderField `json:",omitempty"`
+
+	Body []string `json:",omitempty"`
+	Text []string `json:",omitempty"`
+
+	Larger  int64 `json:",omitempty"`
+	Smaller int64 `json:",omitempty"`
+
+	Flag    []Flag `json:",omitempty"`
+	NotFlag []Flag `json:",omitempty"`
+
+	ModSeq *SearchCriteriaModSeq `json:",omitempty"`
+
+	Or  [][2]SearchCriteria `json:",omitempty"`
+	Not []SearchCriteria    `json:",omitempty"`
+
+	Younger int64 `json:",omitempty"`
+	Older   int64 `json:",omitempty"`
+
+	SaveResult bool `json:",omitempty"`
+	Fuzzy      bool `json:",omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. Unset criteria are left out and
+// number sets are written in IMAP syntax, for example
+//
+//	{"UID":"1:100","Since":"2024-01-01T00:00:00Z","NotFlag":["\\Seen"]}
+func (c SearchCriteria) MarshalJSON() ([]byte, error) {
+	return json.Marshal(searchCriteriaJSON{
+		SeqNum:      c.SeqNum,
+		UID:         c.UID,
+		Since:       optionalTime(c.Since),
+		Before:      optionalTime(c.Before),
+		SentSince:   optionalTime(c.SentSince),
+		SentBefore:  optionalTime(c.SentBefore),
+		SentOn:      optionalTime(c.SentOn),
+		On:          optionalTime(c.On),
+		SavedBefore: optionalTime(c.SavedBefore),
+		SavedSince:  optionalTime(c.SavedSince),
+		SavedOn:     optionalTime(c.SavedOn),
+		Header:      c.Header,
+		Body:        c.Body,
+		Text:        c.Text,
+		Larger:      c.Larger,
+		Smaller:     c.Smaller,
+		Flag:        c.Flag,
+		NotFlag:     c.NotFlag,
+		ModSeq:      c.ModSeq,
+		Or:          c.Or,
+		Not:         c.Not,
+		Younger:     c.Younger,
+		Older:       c.Older,
+		SaveResult:  c.SaveResult,
+		Fuzzy:       c.Fuzzy,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *SearchCriteria) UnmarshalJSON(data []byte) error {
+	var v searchCriteriaJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*c = SearchCriteria{
+		SeqNum:      v.SeqNum,
+		UID:         v.UID,
+		Since:       timeValue(v.Since),
+		Before:      timeValue(v.Before),
+		SentSince:   timeValue(v.SentSince),
+		SentBefore:  timeValue(v.SentBefore),
+		SentOn:      timeValue(v.SentOn),
+		On:          timeValue(v.On),
+		SavedBefore: timeValue(v.SavedBefore),
+		SavedSince:  timeValue(v.SavedSince),
+		SavedOn:     timeValue(v.SavedOn),
+		Header:      v.Header,
+		Body:        v.Body,
+		Text:        v.Text,
+		Larger:      v.Larger,
+		Smaller:     v.Smaller,
+		Flag:        v.Flag,
+		NotFlag:     v.NotFlag,
+		ModSeq:      v.ModSeq,
+		Or:          v.Or,
+		Not:         v.Not,
+		Younger:     v.Younger,
+		Older:       v.Older,
+		SaveResult:  v.SaveResult,
+		Fuzzy:       v.Fuzzy,
+	}
+	return nil
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func timeValue(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
@@ -0,0 +1,116 @@
+package imap
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNumSet_JSON(t *testing.T) {
+	type config struct {
+		Seq  *SeqSet
+		UIDs UIDSet
+	}
+	in := config{
+		Seq:  &SeqSet{Set: []NumRange{{Start: 1, Stop: 5}, {Start: 7, Stop: 7}}},
+		UIDs: UIDSet{Set: []NumRange{{Start: 10, Stop: 0}}},
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), `{"Seq":"1:5,7","UIDs":"10:*"}`; got != want {
+		t.Errorf("Marshal() = %s, want %s", got, want)
+	}
+
+	var out config
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("Unmarshal() = %+v, want %+v", out, in)
+	}
+
+	if err := json.Unmarshal([]byte(`{"UIDs":"1:x"}`), &out); err == nil {
+		t.Error("Unmarshal() of an invalid set succeeded")
+	}
+	if err := json.Unmarshal([]byte(`{"UIDs":""}`), &out); err != nil || !out.UIDs.IsEmpty() {
+		t.Errorf("Unmarshal() of an empty set = %+v, %v", out.UIDs, err)
+	}
+}
+
+func TestFlag_UnmarshalText(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Flag
+		wantErr bool
+	}{
+		{`\Seen`, FlagSeen, false},
+		{`\SEEN`, FlagSeen, false},
+		{`\*`, FlagWildcard, false},
+		{`$Forwarded`, "$Forwarded", false},
+		{`\Extension`, `\Extension`, false},
+		{``, "", true},
+		{`\`, "", true},
+		{`two words`, "", true},
+		{`(paren`, "", true},
+	}
+	for _, tt := range tests {
+		var f Flag
+		err := f.UnmarshalText([]byte(tt.in))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("UnmarshalText(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && f != tt.want {
+			t.Errorf("UnmarshalText(%q) = %q, want %q", tt.in, f, tt.want)
+		}
+	}
+}
+
+func TestSearchCriteria_JSON(t *testing.T) {
+	in := SearchCriteria{
+		UID:     &UIDSet{Set: []NumRange{{Start: 1, Stop: 100}}},
+		Since:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotFlag: []Flag{FlagSeen},
+		Header:  []SearchCriteriaHeaderField{{Key: "List-Id", Value: "dev"}},
+		Or: [][2]SearchCriteria{{
+			{Flag: []Flag{FlagFlagged}},
+			{Larger: 1024},
+		}},
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"UID":"1:100","Since":"2024-01-01T00:00:00Z","Header":[{"Key":"List-Id","Value":"dev"}],` +
+		`"NotFlag":["\\Seen"],"Or":[[{"Flag":["\\Flagged"]},{"Larger":1024}]]}`
+	if string(data) != want {
+		t.Errorf("Marshal() = %s\nwant %s", data, want)
+	}
+
+	var out SearchCriteria
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("Unmarshal() = %+v, want %+v", out, in)
+	}
+}
+
+// TestSearchCriteria_JSONFields checks that the JSON form covers every
+// field of SearchCriteria, so that new criteria are not silently dropped.
+func TestSearchCriteria_JSONFields(t *testing.T) {
+	criteria := reflect.TypeOf(SearchCriteria{})
+	shadow := reflect.TypeOf(searchCriteriaJSON{})
+	if criteria.NumField() != shadow.NumField() {
+		t.Errorf("SearchCriteria has %d fields, its JSON form %d", criteria.NumField(), shadow.NumField())
+	}
+	for i := 0; i < criteria.NumField(); i++ {
+		name := criteria.Field(i).Name
+		if _, ok := shadow.FieldByName(name); !ok {
+			t.Errorf("JSON form of SearchCriteria lacks %s", name)
+		}
+	}
+}
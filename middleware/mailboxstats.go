@@ -0,0 +1,248 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/wire"
+)
+
+// MailboxUsage is the load a mailbox of a user put on the server, as
+// collected by MailboxStats.
+type MailboxUsage struct {
+	Username string `json:"username"`
+	// Mailbox is empty for commands that concern no mailbox, such as
+	// LIST or NOOP outside the selected state.
+	Mailbox string `json:"mailbox"`
+	// Commands is the number of commands, and Errors the number of those
+	// whose handler returned an error.
+	Commands int64 `json:"commands"`
+	Errors   int64 `json:"errors"`
+	// BytesRead and BytesWritten are the bytes of the commands, including
+	// literals, and of their responses.
+	BytesRead    int64 `json:"bytesRead"`
+	BytesWritten int64 `json:"bytesWritten"`
+	// Duration is the total time the commands took, and MaxDuration the
+	// time the slowest took.
+	Duration    time.Duration `json:"duration"`
+	MaxDuration time.Duration `json:"maxDuration"`
+}
+
+// MailboxUsageOrder is the order in which MailboxStats.Top ranks mailboxes.
+type MailboxUsageOrder string
+
+const (
+	// ByCommands ranks mailboxes by their number of commands.
+	ByCommands MailboxUsageOrder = "commands"
+	// ByBytes ranks mailboxes by the bytes read and written.
+	ByBytes MailboxUsageOrder = "bytes"
+	// ByDuration ranks mailboxes by the total time of their commands.
+	ByDuration MailboxUsageOrder = "duration"
+)
+
+// mailboxKey identifies a mailbox of a user in MailboxStats.
+type mailboxKey struct {
+	username, mailbox string
+}
+
+// MailboxStats aggregates the commands, bytes and latency of each mailbox
+// of each user, so that operators can find the mailboxes putting the most
+// load on a shared backend. Record commands with MailboxStatsMiddleware;
+// Top returns the busiest mailboxes, and MailboxStats is an http.Handler
+// serving them as JSON for a debug endpoint.
+//
+// A command is counted for the mailbox it names, such as that of SELECT,
+// STATUS or APPEND, or else for the selected mailbox. Entries are kept
+// until Reset, which long-running servers call periodically to bound the
+// memory used and to look at recent load only.
+type MailboxStats struct {
+	mu      sync.Mutex
+	entries map[mailboxKey]*MailboxUsage
+	since   time.Time
+}
+
+// NewMailboxStats creates an empty MailboxStats.
+func NewMailboxStats() *MailboxStats {
+	return &MailboxStats{
+		entries: make(map[mailboxKey]*MailboxUsage),
+		since:   time.Now(),
+	}
+}
+
+// Record adds a command to the usage of a mailbox. INBOX is
+// case-insensitive.
+func (s *MailboxStats) Record(username, mailbox string, bytesRead, bytesWritten int64, d time.Duration, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if strings.EqualFold(mailbox, "INBOX") {
+		mailbox = "INBOX"
+	}
+	key := mailboxKey{username, mailbox}
+	u, ok := s.entries[key]
+	if !ok {
+		u = &MailboxUsage{Username: username, Mailbox: mailbox}
+		s.entries[key] = u
+	}
+	u.Commands++
+	if failed {
+		u.Errors++
+	}
+	u.BytesRead += bytesRead
+	u.BytesWritten += bytesWritten
+	u.Duration += d
+	if d > u.MaxDuration {
+		u.MaxDuration = d
+	}
+}
+
+// Top returns the usage of the n busiest mailboxes in the given order,
+// busiest first, or of all mailboxes if n is 0 or less. An unknown order
+// ranks by commands.
+func (s *MailboxStats) Top(n int, order MailboxUsageOrder) []MailboxUsage {
+	s.mu.Lock()
+	all := make([]MailboxUsage, 0, len(s.entries))
+	for _, u := range s.entries {
+		all = append(all, *u)
+	}
+	s.mu.Unlock()
+
+	metric := func(u *MailboxUsage) int64 {
+		switch order {
+		case ByBytes:
+			return u.BytesRead + u.BytesWritten
+		case ByDuration:
+			return int64(u.Duration)
+		default:
+			return u.Commands
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if mi, mj := metric(&all[i]), metric(&all[j]); mi != mj {
+			return mi > mj
+		}
+		if all[i].Username != all[j].Username {
+			return all[i].Username < all[j].Username
+		}
+		return all[i].Mailbox < all[j].Mailbox
+	})
+	if n > 0 && n < len(all) {
+		all = all[:n]
+	}
+	return all
+}
+
+// Since returns when the stats were created or last reset.
+func (s *MailboxStats) Since() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.since
+}
+
+// Reset discards all entries.
+func (s *MailboxStats) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = make(map[mailboxKey]*MailboxUsage)
+	s.since = time.Now()
+}
+
+// ServeHTTP serves the busiest mailboxes as JSON. The query parameters
+// "n", 20 by default, and "by", one of "commands", "bytes" and
+// "duration", select them, as with Top. The endpoint exposes user and
+// mailbox names, so it must only be reachable by operators:
+//
+//	mux.Handle("/debug/imap/mailboxes", stats)
+func (s *MailboxStats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := 20
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "invalid n", http.StatusBadRequest)
+			return
+		}
+	}
+	order := MailboxUsageOrder(r.URL.Query().Get("by"))
+	switch order {
+	case "":
+		order = ByCommands
+	case ByCommands, ByBytes, ByDuration:
+	default:
+		http.Error(w, "invalid by", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(struct {
+		Since     time.Time         `json:"since"`
+		By        MailboxUsageOrder `json:"by"`
+		Mailboxes []MailboxUsage    `json:"mailboxes"`
+	}{s.Since(), order, s.Top(n, order)})
+}
+
+// MailboxStatsMiddleware returns a middleware that records the usage of
+// each command in stats. It needs ctx.Line, which the server sets.
+func MailboxStatsMiddleware(stats *MailboxStats) Middleware {
+	return func(next server.CommandHandler) server.CommandHandler {
+		return server.CommandHandlerFunc(func(ctx *server.CommandContext) error {
+			mailbox, ok := commandMailbox(ctx.Line)
+			if !ok && ctx.Conn != nil {
+				mailbox = ctx.Conn.Mailbox()
+			}
+			var read, written int64
+			if ctx.Conn != nil {
+				read, written = ctx.Conn.BytesRead(), ctx.Conn.BytesWritten()
+			}
+
+			start := time.Now()
+			err := next.Handle(ctx)
+			d := time.Since(start)
+
+			var username string
+			if ctx.Conn != nil {
+				username = ctx.Conn.Username()
+				read = ctx.Conn.BytesRead() - read
+				written = ctx.Conn.BytesWritten() - written
+			}
+			if ctx.Line != "" {
+				// The line was read before the handler was called.
+				read += int64(len(ctx.Line)) + 2
+			}
+			stats.Record(username, mailbox, read, written, d, err != nil)
+			return err
+		})
+	}
+}
+
+// mailboxCommands are the commands whose first argument is a mailbox.
+var mailboxCommands = map[string]bool{
+	"SELECT": true, "EXAMINE": true, "CREATE": true, "DELETE": true,
+	"RENAME": true, "SUBSCRIBE": true, "UNSUBSCRIBE": true, "STATUS": true,
+	"APPEND": true, "GETQUOTAROOT": true, "GETACL": true, "SETACL": true,
+	"DELETEACL": true, "LISTRIGHTS": true, "MYRIGHTS": true,
+}
+
+// commandMailbox returns the mailbox named by the first argument of a
+// command line of one of mailboxCommands. It returns false for other
+// commands and for mailbox names sent as literals, which are not part of
+// the line.
+func commandMailbox(line string) (string, bool) {
+	_, rest, _ := strings.Cut(line, " ")
+	name, args, _ := strings.Cut(rest, " ")
+	if !mailboxCommands[strings.ToUpper(name)] {
+		return "", false
+	}
+	if strings.HasPrefix(args, "{") || strings.HasPrefix(args, "~{") {
+		return "", false
+	}
+	mailbox, err := wire.NewDecoder(strings.NewReader(args)).ReadAString()
+	if err != nil {
+		return "", false
+	}
+	return mailbox, true
+}
@@ -0,0 +1,105 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meszmate/imap-go/imaptest"
+	"github.com/meszmate/imap-go/middleware"
+	_ "github.com/meszmate/imap-go/server/commands"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+func TestMailboxStatsMiddleware(t *testing.T) {
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	if err := mem.Deliver("alice", "INBOX", strings.NewReader("Subject: hi\r\n\r\nhello")); err != nil {
+		t.Fatalf("Deliver() error: %v", err)
+	}
+	srv := mem.NewServer()
+	stats := middleware.NewMailboxStats()
+	middleware.Apply(srv, middleware.MailboxStatsMiddleware(stats))
+
+	h := imaptest.NewHarness(t, srv)
+	c := h.Dial()
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	if err := c.Create("Archive"); err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	if _, err := c.Select("inbox", nil); err != nil {
+		t.Fatalf("Select() error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := c.Noop(); err != nil {
+			t.Fatalf("Noop() error: %v", err)
+		}
+	}
+
+	top := stats.Top(0, middleware.ByCommands)
+	if len(top) != 3 {
+		t.Fatalf("Top() = %+v, want 3 entries", top)
+	}
+	inbox := top[0]
+	if inbox.Username != "alice" || inbox.Mailbox != "INBOX" || inbox.Commands != 4 {
+		t.Errorf("busiest = %+v, want alice's INBOX with SELECT and 3 NOOPs", inbox)
+	}
+	if inbox.BytesRead == 0 || inbox.BytesWritten == 0 || inbox.Duration <= 0 {
+		t.Errorf("INBOX usage = %+v, want bytes and duration", inbox)
+	}
+	// LOGIN concerns no mailbox; CREATE counts for the new mailbox.
+	got := map[string]int64{}
+	for _, u := range top[1:] {
+		got[u.Mailbox] = u.Commands
+	}
+	if got[""] != 1 || got["Archive"] != 1 {
+		t.Errorf("other entries = %v", got)
+	}
+
+	if top := stats.Top(1, middleware.ByBytes); len(top) != 1 {
+		t.Errorf("Top(1) = %+v", top)
+	}
+	stats.Reset()
+	if top := stats.Top(0, middleware.ByCommands); len(top) != 0 {
+		t.Errorf("Top() after Reset = %+v", top)
+	}
+}
+
+func TestMailboxStats_ServeHTTP(t *testing.T) {
+	stats := middleware.NewMailboxStats()
+	stats.Record("alice", "INBOX", 10, 100, time.Millisecond, false)
+	stats.Record("alice", "inbox", 10, 100, 3*time.Millisecond, true)
+	stats.Record("bob", "Sent", 5000, 10, time.Millisecond, false)
+
+	rec := httptest.NewRecorder()
+	stats.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/imap/mailboxes?n=1&by=bytes", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	var resp struct {
+		By        string                    `json:"by"`
+		Mailboxes []middleware.MailboxUsage `json:"mailboxes"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Unmarshal() error: %v", err)
+	}
+	if resp.By != "bytes" || len(resp.Mailboxes) != 1 || resp.Mailboxes[0].Username != "bob" {
+		t.Errorf("response = %+v, want bob's Sent", resp)
+	}
+
+	top := stats.Top(1, middleware.ByCommands)
+	if len(top) != 1 || top[0].Commands != 2 || top[0].Errors != 1 || top[0].MaxDuration != 3*time.Millisecond {
+		t.Errorf("Top(1) = %+v, want alice's INBOX merged", top)
+	}
+
+	rec = httptest.NewRecorder()
+	stats.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?by=size", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status for an unknown order = %d, want 400", rec.Code)
+	}
+}
@@ -20,6 +20,28 @@ type Metrics struct {
 	mu              sync.RWMutex
 	commandCounts   map[string]*atomic.Int64
 	commandDuration map[string]*atomic.Int64 // nanoseconds total
+	storage         func() StorageStats
+}
+
+// StorageStats is the memory or disk used by the messages of a backend.
+type StorageStats struct {
+	// Messages is the number of stored messages.
+	Messages int64
+	// Bytes is the total size of the stored messages.
+	Bytes int64
+}
+
+// MetricsSnapshot is a point-in-time copy of Metrics.
+type MetricsSnapshot struct {
+	CommandsTotal  int64
+	CommandErrors  int64
+	ActiveCommands int64
+	// CommandCounts and CommandDurations are by command name.
+	CommandCounts    map[string]int64
+	CommandDurations map[string]time.Duration
+	// Storage is the storage used by the backend, if a source was set
+	// with SetStorageSource.
+	Storage StorageStats
 }
 
 // NewMetrics creates a new Metrics instance.
@@ -50,6 +72,40 @@ func (m *Metrics) CommandDuration(name string) time.Duration {
 	return 0
 }
 
+// SetStorageSource sets the function that reports the storage used by the
+// backend in snapshots, for example one that converts the statistics of
+// memserver.MemServer.Stats.
+func (m *Metrics) SetStorageSource(fn func() StorageStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.storage = fn
+}
+
+// Snapshot returns a copy of the metrics.
+func (m *Metrics) Snapshot() *MetricsSnapshot {
+	m.mu.RLock()
+	snap := &MetricsSnapshot{
+		CommandsTotal:    m.CommandsTotal.Load(),
+		CommandErrors:    m.CommandErrors.Load(),
+		ActiveCommands:   m.ActiveCommands.Load(),
+		CommandCounts:    make(map[string]int64, len(m.commandCounts)),
+		CommandDurations: make(map[string]time.Duration, len(m.commandDuration)),
+	}
+	for name, c := range m.commandCounts {
+		snap.CommandCounts[name] = c.Load()
+	}
+	for name, d := range m.commandDuration {
+		snap.CommandDurations[name] = time.Duration(d.Load())
+	}
+	storage := m.storage
+	m.mu.RUnlock()
+
+	if storage != nil {
+		snap.Storage = storage()
+	}
+	return snap
+}
+
 func (m *Metrics) getCounter(name string) *atomic.Int64 {
 	m.mu.RLock()
 	c, ok := m.commandCounts[name]
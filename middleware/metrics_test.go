@@ -386,3 +386,30 @@ func TestMetricsMiddleware_ZeroDurationHandler(t *testing.T) {
 		t.Fatalf("expected non-negative duration, got %v", dur)
 	}
 }
+
+// --- Snapshot ---
+
+func TestMetrics_Snapshot(t *testing.T) {
+	m := middleware.NewMetrics()
+	m.SetStorageSource(func() middleware.StorageStats {
+		return middleware.StorageStats{Messages: 3, Bytes: 1024}
+	})
+	handler := middleware.MetricsMiddleware(m)(server.CommandHandlerFunc(func(ctx *server.CommandContext) error {
+		return nil
+	}))
+
+	for _, name := range []string{"NOOP", "NOOP", "FETCH"} {
+		_ = handler.Handle(&server.CommandContext{Context: context.Background(), Name: name})
+	}
+
+	snap := m.Snapshot()
+	if snap.CommandsTotal != 3 || snap.CommandCounts["NOOP"] != 2 || snap.CommandCounts["FETCH"] != 1 {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+	if _, ok := snap.CommandDurations["FETCH"]; !ok {
+		t.Fatal("expected a duration for FETCH")
+	}
+	if snap.Storage.Messages != 3 || snap.Storage.Bytes != 1024 {
+		t.Fatalf("expected storage 3 messages, 1024 bytes, got %+v", snap.Storage)
+	}
+}
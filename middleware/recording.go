@@ -0,0 +1,380 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	mathrand "math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/wire"
+)
+
+// ArchiveVersion is the version of the session archive format written by
+// Recorder.
+const ArchiveVersion = 1
+
+// redacted replaces credentials in archives.
+const redacted = "<redacted>"
+
+// SessionArchive is the recording of a connection, in a structured format
+// in the spirit of HTTP Archives (HAR): the data exchanged, line by line,
+// with timings and sizes, and the commands handled. Archives are written
+// as JSON with WriteArchive, and can be replayed against a server with
+// imaptest.Harness.Replay.
+type SessionArchive struct {
+	Version    int       `json:"version"`
+	ID         string    `json:"id"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Started    time.Time `json:"started"`
+	Ended      time.Time `json:"ended"`
+	// Entries are the lines and literals exchanged, in order.
+	Entries []ArchiveEntry `json:"entries"`
+	// Commands are the commands handled, in order.
+	Commands []ArchiveCommand `json:"commands"`
+	// Truncated is set if entries were left out after
+	// Recorder.MaxEntries.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// ArchiveEntry is a line or a literal exchanged on a connection.
+type ArchiveEntry struct {
+	// Time is the time since the start of the session at which the entry
+	// was complete.
+	Time time.Duration `json:"time"`
+	// From is "C" for data sent by the client and "S" for data sent by
+	// the server.
+	From string `json:"from"`
+	// Data is the line, without CRLF, or the data of a literal.
+	Data string `json:"data"`
+	// Literal is set if Data is the data of the literal announced at the
+	// end of the previous line.
+	Literal bool `json:"literal,omitempty"`
+	// Redacted is set if Data was removed or, in lines, credentials were
+	// replaced.
+	Redacted bool `json:"redacted,omitempty"`
+	// Size is the number of bytes of the entry on the wire.
+	Size int `json:"size"`
+}
+
+// ArchiveCommand is a command handled on a connection.
+type ArchiveCommand struct {
+	Tag  string `json:"tag"`
+	Name string `json:"name"`
+	// Start is the time since the start of the session at which the
+	// handler was called.
+	Start    time.Duration `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// WriteArchive writes an archive as JSON.
+func WriteArchive(w io.Writer, a *SessionArchive) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(a)
+}
+
+// ReadArchive reads an archive written by WriteArchive.
+func ReadArchive(r io.Reader) (*SessionArchive, error) {
+	var a SessionArchive
+	if err := json.NewDecoder(r).Decode(&a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// Transcript returns the exchange recorded in the archive in the format
+// of imaptest.Recorder, so that it can be compared with the transcript of
+// a replay. Redacted literals are shown as their size.
+func (a *SessionArchive) Transcript() []byte {
+	var b bytes.Buffer
+	for _, e := range a.Entries {
+		switch {
+		case e.Literal && e.Redacted:
+			b.WriteString("<" + strconv.Itoa(e.Size) + " bytes>")
+		case e.Literal:
+			b.WriteString(e.Data)
+		default:
+			b.WriteString(e.From + ": " + e.Data + "\r\n")
+		}
+	}
+	return b.Bytes()
+}
+
+// Recorder records complete sessions into SessionArchives, for replaying
+// production incidents locally. It needs the wire trace and close hook of
+// the server, and the middleware to time commands:
+//
+//	rec := middleware.NewRecorder(func(a *middleware.SessionArchive) {
+//		f, _ := os.Create(filepath.Join(dir, a.ID+".json"))
+//		defer f.Close()
+//		middleware.WriteArchive(f, a)
+//	})
+//	rec.SampleRate = 0.01
+//	srv := server.New(append(opts, rec.ServerOptions()...)...)
+//	middleware.Apply(srv, rec.Middleware())
+//
+// The data of literals is redacted unless KeepLiterals is set, and
+// credentials sent with LOGIN and AUTHENTICATE always are.
+type Recorder struct {
+	// SampleRate is the fraction of connections recorded, between 0 and
+	// 1. Connections are sampled when they send or receive their first
+	// data.
+	SampleRate float64
+	// MaxEntries limits the entries of an archive. If 0, all entries
+	// are kept.
+	MaxEntries int
+	// KeepLiterals keeps the data of literals, such as messages, other
+	// than those of LOGIN and AUTHENTICATE.
+	KeepLiterals bool
+
+	sink func(*SessionArchive)
+
+	mu       sync.Mutex
+	sessions map[*server.Conn]*sessionRecording
+	random   func() float64
+}
+
+// NewRecorder returns a Recorder recording all connections, which passes
+// each archive to sink when its connection is closed. sink is called from
+// the goroutine of the connection.
+func NewRecorder(sink func(*SessionArchive)) *Recorder {
+	return &Recorder{
+		SampleRate: 1,
+		sink:       sink,
+		sessions:   make(map[*server.Conn]*sessionRecording),
+		random:     mathrand.Float64,
+	}
+}
+
+// ServerOptions returns the options that connect the Recorder to a
+// server: WithWireTrace and WithOnConnClose.
+func (r *Recorder) ServerOptions() []server.Option {
+	return []server.Option{server.WithWireTrace(r.Trace), server.WithOnConnClose(r.Finish)}
+}
+
+// Trace is a server.WireTraceFunc recording the data of sampled
+// connections.
+func (r *Recorder) Trace(conn *server.Conn, dir wire.Direction, data []byte) {
+	if s := r.session(conn, true); s != nil {
+		s.trace(dir, data)
+	}
+}
+
+// Finish passes the archive of a connection to the sink, if the
+// connection was sampled.
+func (r *Recorder) Finish(conn *server.Conn) {
+	r.mu.Lock()
+	s := r.sessions[conn]
+	delete(r.sessions, conn)
+	r.mu.Unlock()
+	if s == nil || r.sink == nil {
+		return
+	}
+	s.mu.Lock()
+	s.archive.Ended = time.Now()
+	archive := s.archive
+	s.mu.Unlock()
+	r.sink(&archive)
+}
+
+// Middleware returns a middleware recording the timing and result of the
+// commands of sampled connections.
+func (r *Recorder) Middleware() Middleware {
+	return func(next server.CommandHandler) server.CommandHandler {
+		return server.CommandHandlerFunc(func(ctx *server.CommandContext) error {
+			s := r.session(ctx.Conn, false)
+			if s == nil {
+				return next.Handle(ctx)
+			}
+			start := time.Now()
+			err := next.Handle(ctx)
+			cmd := ArchiveCommand{
+				Tag:      ctx.Tag,
+				Name:     ctx.Name,
+				Start:    start.Sub(s.archive.Started),
+				Duration: time.Since(start),
+			}
+			if err != nil {
+				cmd.Error = err.Error()
+			}
+			s.mu.Lock()
+			s.archive.Commands = append(s.archive.Commands, cmd)
+			s.mu.Unlock()
+			return err
+		})
+	}
+}
+
+// session returns the recording of conn, or nil if it is not sampled. If
+// create is set, a connection seen for the first time is sampled.
+func (r *Recorder) session(conn *server.Conn, create bool) *sessionRecording {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sessions[conn]
+	if ok || !create {
+		return s
+	}
+	if r.SampleRate >= 1 || r.random() < r.SampleRate {
+		s = &sessionRecording{
+			archive: SessionArchive{
+				Version: ArchiveVersion,
+				ID:      newArchiveID(),
+				Started: time.Now(),
+			},
+			maxEntries:   r.MaxEntries,
+			keepLiterals: r.KeepLiterals,
+		}
+		if addr := conn.RemoteAddr(); addr != nil {
+			s.archive.RemoteAddr = addr.String()
+		}
+	}
+	// Unsampled connections are remembered as nil, so that they are not
+	// sampled again.
+	r.sessions[conn] = s
+	return s
+}
+
+func newArchiveID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// sessionRecording is the recording of a connection in progress.
+type sessionRecording struct {
+	mu           sync.Mutex
+	archive      SessionArchive
+	maxEntries   int
+	keepLiterals bool
+
+	client, server streamState
+	// authTag is the tag of the AUTHENTICATE command in progress, whose
+	// client lines are redacted.
+	authTag string
+	// redactLiterals is set while a LOGIN or AUTHENTICATE command is
+	// sent, whose literals are redacted.
+	redactLiterals bool
+}
+
+// streamState splits a direction of a connection into lines and literals.
+type streamState struct {
+	line    []byte
+	literal []byte
+	// remaining is the size of the literal data still to come.
+	remaining int
+	size      int
+	redact    bool
+}
+
+// literalSuffix matches a literal announced at the end of a line.
+var literalSuffix = regexp.MustCompile(`~?\{(\d+)\+?\}$`)
+
+func (s *sessionRecording) trace(dir wire.Direction, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, from := &s.client, "C"
+	if dir == wire.DirectionWrite {
+		st, from = &s.server, "S"
+	}
+
+	for len(data) > 0 {
+		if st.remaining > 0 {
+			n := min(st.remaining, len(data))
+			if !st.redact {
+				st.literal = append(st.literal, data[:n]...)
+			}
+			st.remaining -= n
+			data = data[n:]
+			if st.remaining == 0 {
+				s.add(ArchiveEntry{From: from, Data: string(st.literal), Literal: true, Redacted: st.redact, Size: st.size})
+				st.literal = nil
+			}
+			continue
+		}
+
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			st.line = append(st.line, data...)
+			return
+		}
+		st.line = append(st.line, data[:i+1]...)
+		data = data[i+1:]
+		size := len(st.line)
+		line := strings.TrimRight(string(st.line), "\r\n")
+		st.line = st.line[:0]
+
+		entry := ArchiveEntry{From: from, Data: line, Size: size}
+		if from == "C" {
+			entry.Data, entry.Redacted = s.redactClientLine(line)
+		} else if s.authTag != "" && strings.HasPrefix(line, s.authTag+" ") {
+			s.authTag = ""
+		}
+		s.add(entry)
+
+		if m := literalSuffix.FindStringSubmatch(line); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			st.remaining, st.size = n, n
+			st.redact = !s.keepLiterals || (from == "C" && s.redactLiterals)
+			if n == 0 {
+				s.add(ArchiveEntry{From: from, Literal: true, Redacted: st.redact})
+			}
+		} else if from == "C" {
+			s.redactLiterals = false
+		}
+	}
+}
+
+// redactClientLine removes the credentials of LOGIN and AUTHENTICATE from
+// a line sent by the client.
+func (s *sessionRecording) redactClientLine(line string) (string, bool) {
+	if s.authTag != "" {
+		// A SASL response, or the * cancelling the exchange
+		if line == "*" {
+			return line, false
+		}
+		return redacted, true
+	}
+	if s.redactLiterals {
+		// The rest of a command after a literal
+		return line, false
+	}
+
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) < 2 {
+		return line, false
+	}
+	switch strings.ToUpper(fields[1]) {
+	case "LOGIN":
+		s.redactLiterals = true
+		if len(fields) == 4 && !literalSuffix.MatchString(fields[3]) {
+			return strings.Join(fields[:3], " ") + " " + redacted, true
+		}
+	case "AUTHENTICATE":
+		s.redactLiterals = true
+		s.authTag = fields[0]
+		if len(fields) == 4 {
+			// SASL-IR initial response
+			return strings.Join(fields[:3], " ") + " " + redacted, true
+		}
+	}
+	return line, false
+}
+
+// add appends an entry, unless the archive is full.
+func (s *sessionRecording) add(e ArchiveEntry) {
+	if s.maxEntries > 0 && len(s.archive.Entries) >= s.maxEntries {
+		s.archive.Truncated = true
+		return
+	}
+	e.Time = time.Since(s.archive.Started)
+	s.archive.Entries = append(s.archive.Entries, e)
+}
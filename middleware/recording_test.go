@@ -0,0 +1,114 @@
+package middleware_test
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/meszmate/imap-go/middleware"
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/wire"
+)
+
+func newRecorderConn(t *testing.T) *server.Conn {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	t.Cleanup(func() {
+		_ = clientConn.Close()
+		_ = serverConn.Close()
+	})
+	return server.NewTestConn(serverConn, slog.Default())
+}
+
+func TestRecorder(t *testing.T) {
+	var archive *middleware.SessionArchive
+	rec := middleware.NewRecorder(func(a *middleware.SessionArchive) { archive = a })
+	conn := newRecorderConn(t)
+
+	client := func(s ...string) {
+		for _, chunk := range s {
+			rec.Trace(conn, wire.DirectionRead, []byte(chunk))
+		}
+	}
+	srv := func(s string) { rec.Trace(conn, wire.DirectionWrite, []byte(s)) }
+
+	srv("* OK ready\r\n")
+	client("A1 LOGIN alice s3cret\r\n")
+	srv("A1 OK LOGIN completed\r\n")
+	client("A2 APPEND INBOX {5}\r\n")
+	srv("+ Ready\r\n")
+	client("hel", "lo\r", "\n")
+	srv("A2 OK APPEND completed\r\n")
+	client("A3 AUTHENTICATE PLAIN\r\n")
+	srv("+ \r\n")
+	client("AGFsaWNlAHMzY3JldA==\r\n")
+	srv("A3 OK done\r\n")
+	client("A4 LOGIN {5}\r\n", "alice {6+}\r\ns3cret\r\n")
+
+	ctx := &server.CommandContext{Tag: "A5", Name: "NOOP", Conn: conn}
+	handler := rec.Middleware()(server.CommandHandlerFunc(func(ctx *server.CommandContext) error { return nil }))
+	if err := handler.Handle(ctx); err != nil {
+		t.Fatalf("Handle() error: %v", err)
+	}
+
+	rec.Finish(conn)
+	if archive == nil {
+		t.Fatal("sink was not called")
+	}
+	transcript := string(archive.Transcript())
+	if strings.Contains(transcript, "s3cret") || strings.Contains(transcript, "AGFsaWNl") || strings.Contains(transcript, "hello") {
+		t.Errorf("transcript leaks credentials or literals:\n%s", transcript)
+	}
+	for _, want := range []string{
+		"C: A1 LOGIN alice <redacted>\r\n",
+		"C: A2 APPEND INBOX {5}\r\nS: + Ready\r\n<5 bytes>C: \r\n",
+		"C: <redacted>\r\n",
+		"C: A4 LOGIN {5}\r\n<5 bytes>C:  {6+}\r\n<6 bytes>C: \r\n",
+	} {
+		if !strings.Contains(transcript, want) {
+			t.Errorf("transcript does not contain %q:\n%s", want, transcript)
+		}
+	}
+	if len(archive.Commands) != 1 || archive.Commands[0].Name != "NOOP" {
+		t.Errorf("Commands = %+v", archive.Commands)
+	}
+
+	var buf bytes.Buffer
+	if err := middleware.WriteArchive(&buf, archive); err != nil {
+		t.Fatalf("WriteArchive() error: %v", err)
+	}
+	read, err := middleware.ReadArchive(&buf)
+	if err != nil {
+		t.Fatalf("ReadArchive() error: %v", err)
+	}
+	if string(read.Transcript()) != transcript {
+		t.Error("archive changed by WriteArchive and ReadArchive")
+	}
+}
+
+func TestRecorder_Sampling(t *testing.T) {
+	calls := 0
+	rec := middleware.NewRecorder(func(a *middleware.SessionArchive) { calls++ })
+	rec.SampleRate = 0
+	conn := newRecorderConn(t)
+	rec.Trace(conn, wire.DirectionWrite, []byte("* OK ready\r\n"))
+	rec.Finish(conn)
+	if calls != 0 {
+		t.Error("unsampled connection was archived")
+	}
+}
+
+func TestRecorder_MaxEntries(t *testing.T) {
+	var archive *middleware.SessionArchive
+	rec := middleware.NewRecorder(func(a *middleware.SessionArchive) { archive = a })
+	rec.MaxEntries = 2
+	rec.KeepLiterals = true
+	conn := newRecorderConn(t)
+	rec.Trace(conn, wire.DirectionRead, []byte("A1 APPEND INBOX {2}\r\nhi\r\nA2 NOOP\r\n"))
+	rec.Finish(conn)
+	if len(archive.Entries) != 2 || !archive.Truncated || archive.Entries[1].Data != "hi" {
+		t.Errorf("archive = %+v", archive)
+	}
+}
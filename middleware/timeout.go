@@ -9,6 +9,12 @@ import (
 )
 
 // Timeout returns a middleware that enforces a timeout on command execution.
+//
+// Deprecated: A single timeout for whole commands either interrupts long
+// FETCHes or lets stalled clients hold the connection, and the handler
+// keeps running after the timeout. Use the server's ReadTimeout,
+// WriteTimeout, LiteralTimeout and IdleTimeout options, which apply to
+// the connection.
 func Timeout(d time.Duration) Middleware {
 	return func(next server.CommandHandler) server.CommandHandler {
 		return server.CommandHandlerFunc(func(ctx *server.CommandContext) error {
@@ -26,7 +32,7 @@ func Timeout(d time.Duration) Middleware {
 			case err := <-done:
 				return err
 			case <-timeoutCtx.Done():
-				return imap.ErrNo("command timed out")
+				return imap.WrapError(imap.ErrNoWithCode(imap.ResponseCodeUnavailable, "command timed out"), timeoutCtx.Err())
 			}
 		})
 	}
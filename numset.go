@@ -2,6 +2,7 @@ package imap
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -32,19 +33,20 @@ func (r NumRange) Contains(num uint32) bool {
 	return num >= start && num <= stop
 }
 
-// String returns the string representation of the range.
+// String returns the string representation of the range. A Start or
+// Stop of 0 is written as "*".
 func (r NumRange) String() string {
 	if r.Start == r.Stop {
-		return strconv.FormatUint(uint64(r.Start), 10)
+		return formatSeqNum(r.Start)
 	}
-	start := strconv.FormatUint(uint64(r.Start), 10)
-	var stop string
-	if r.Stop == 0 {
-		stop = "*"
-	} else {
-		stop = strconv.FormatUint(uint64(r.Stop), 10)
+	return formatSeqNum(r.Start) + ":" + formatSeqNum(r.Stop)
+}
+
+func formatSeqNum(n uint32) string {
+	if n == 0 {
+		return "*"
 	}
-	return start + ":" + stop
+	return strconv.FormatUint(uint64(n), 10)
 }
 
 // NumSet is the interface implemented by SeqSet and UIDSet.
@@ -118,6 +120,14 @@ func (ss *SeqSet) IsEmpty() bool {
 	return len(ss.Set) == 0
 }
 
+// Normalize sorts the ranges of the set and merges those that overlap or
+// are adjacent, so that String returns the shortest form, such as "1:3,7"
+// for a set built by adding 7, 2, 1 and 3. The numbers the set contains
+// are unchanged.
+func (ss *SeqSet) Normalize() {
+	ss.Set = normalizeNumSet(ss.Set)
+}
+
 // UIDSet represents a set of UIDs.
 type UIDSet struct {
 	Set []NumRange
@@ -179,6 +189,14 @@ func (us *UIDSet) IsEmpty() bool {
 	return len(us.Set) == 0
 }
 
+// Normalize sorts the ranges of the set and merges those that overlap or
+// are adjacent, so that String returns the shortest form. Servers call it
+// before writing sets built in no particular order, such as the UIDs of a
+// VANISHED response. The UIDs the set contains are unchanged.
+func (us *UIDSet) Normalize() {
+	us.Set = normalizeNumSet(us.Set)
+}
+
 func parseNumSet(s string) ([]NumRange, error) {
 	if s == "" {
 		return nil, fmt.Errorf("imap: empty number set")
@@ -234,6 +252,80 @@ func parseSeqNum(s string) (uint32, error) {
 	return uint32(n), nil
 }
 
+// normalizeNumSet returns ranges sorted and merged. Ranges ending in "*"
+// absorb all finite ranges from their start on; "*" alone and ranges
+// starting with "*" are kept as they are, after the others.
+func normalizeNumSet(ranges []NumRange) []NumRange {
+	if len(ranges) == 0 {
+		return ranges
+	}
+
+	var finite, dynamic []NumRange
+	var starFrom uint32 // smallest n of the "n:*" ranges, 0 if none
+	for _, r := range ranges {
+		switch {
+		case r.Start == 0:
+			dynamic = append(dynamic, r)
+		case r.Stop == 0:
+			if starFrom == 0 || r.Start < starFrom {
+				starFrom = r.Start
+			}
+		default:
+			if r.Start > r.Stop {
+				r.Start, r.Stop = r.Stop, r.Start
+			}
+			finite = append(finite, r)
+		}
+	}
+
+	sort.Slice(finite, func(i, j int) bool {
+		return finite[i].Start < finite[j].Start
+	})
+
+	merged := make([]NumRange, 0, len(finite)+1+len(dynamic))
+	for _, r := range finite {
+		if starFrom != 0 && uint64(r.Stop)+1 >= uint64(starFrom) {
+			if r.Start < starFrom {
+				starFrom = r.Start
+			}
+			continue
+		}
+		if n := len(merged); n > 0 && uint64(r.Start) <= uint64(merged[n-1].Stop)+1 {
+			if r.Stop > merged[n-1].Stop {
+				merged[n-1].Stop = r.Stop
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	if starFrom != 0 {
+		// Finite ranges merged before starFrom moved down may now touch it.
+		for n := len(merged); n > 0 && uint64(merged[n-1].Stop)+1 >= uint64(starFrom); n = len(merged) {
+			if merged[n-1].Start < starFrom {
+				starFrom = merged[n-1].Start
+			}
+			merged = merged[:n-1]
+		}
+		merged = append(merged, NumRange{Start: starFrom, Stop: 0})
+	}
+	return append(merged, dynamic...)
+}
+
+// compactNumSet merges runs of ascending consecutive single numbers without
+// reordering, for sets whose order is significant.
+func compactNumSet(ranges []NumRange) []NumRange {
+	var out []NumRange
+	for _, r := range ranges {
+		if n := len(out); n > 0 && r.Start == r.Stop && out[n-1].Start <= out[n-1].Stop &&
+			out[n-1].Stop != 0 && uint64(r.Start) == uint64(out[n-1].Stop)+1 {
+			out[n-1].Stop = r.Stop
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
 func formatNumSet(ranges []NumRange) string {
 	if len(ranges) == 0 {
 		return ""
@@ -1,6 +1,7 @@
 package imap
 
 import (
+	"math/rand"
 	"testing"
 )
 
@@ -17,7 +18,7 @@ func TestNumRange_String(t *testing.T) {
 		{"star range", NumRange{Start: 10, Stop: 0}, "10:*"},
 		{"single 1", NumRange{Start: 1, Stop: 1}, "1"},
 		{"large range", NumRange{Start: 100, Stop: 200}, "100:200"},
-		{"start zero (star)", NumRange{Start: 0, Stop: 0}, "0"},
+		{"start zero (star)", NumRange{Start: 0, Stop: 0}, "*"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -75,8 +76,8 @@ func TestParseSeqSet(t *testing.T) {
 		{"range", "1:5", "1:5", false},
 		{"star range", "10:*", "10:*", false},
 		{"mixed", "1,3:5,10:*", "1,3:5,10:*", false},
-		{"just star", "*", "0", false},
-		{"star colon star", "*:*", "0", false},
+		{"just star", "*", "*", false},
+		{"star colon star", "*:*", "*", false},
 		{"empty string", "", "", true},
 		{"invalid number", "abc", "", true},
 		{"zero value", "0", "", true},
@@ -443,9 +444,104 @@ func TestParseSeqSet_SingleStar(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	// "*" is parsed as {Start: 0, Stop: 0}, which String() renders as "0"
-	// but it should be Dynamic
+	// "*" is parsed as {Start: 0, Stop: 0}, which String() renders as "*"
+	// and is Dynamic
 	if !ss.Dynamic() {
 		t.Error("star set should be dynamic")
 	}
 }
+
+// --- Normalize tests ---
+
+func TestUIDSet_Normalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"unordered singles", "7,2,1,3", "1:3,7"},
+		{"overlapping", "5:10,1:6", "1:10"},
+		{"adjacent", "1:3,4:6", "1:6"},
+		{"reversed", "10:5,1", "1,5:10"},
+		{"duplicates", "4,4,4", "4"},
+		{"star absorbs", "9,3:*,1,5:7", "1,3:*"},
+		{"star touched", "1:4,5:*", "1:*"},
+		{"already normal", "1:2,4", "1:2,4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			us, err := ParseUIDSet(tt.in)
+			if err != nil {
+				t.Fatalf("ParseUIDSet(%q) error: %v", tt.in, err)
+			}
+			us.Normalize()
+			if got := us.String(); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeqSet_NormalizeProperties(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		var ss SeqSet
+		for j := rng.Intn(8); j >= 0; j-- {
+			start := uint32(rng.Intn(40) + 1)
+			switch rng.Intn(4) {
+			case 0:
+				ss.AddNum(start)
+			case 1:
+				ss.AddRange(start, 0)
+			default:
+				ss.AddRange(start, uint32(rng.Intn(40)+1))
+			}
+		}
+		before := ss.String()
+		orig := SeqSet{Set: append([]NumRange(nil), ss.Set...)}
+
+		ss.Normalize()
+		for n := uint32(1); n <= 100; n++ {
+			if orig.Contains(n) != ss.Contains(n) {
+				t.Fatalf("Normalize(%q) = %q: Contains(%d) changed", before, ss.String(), n)
+			}
+		}
+		for k := 1; k < len(ss.Set); k++ {
+			prev, cur := ss.Set[k-1], ss.Set[k]
+			if prev.Stop == 0 || uint64(prev.Stop)+1 >= uint64(cur.Start) {
+				t.Fatalf("Normalize(%q) = %q: ranges not sorted and disjoint", before, ss.String())
+			}
+		}
+		again := SeqSet{Set: append([]NumRange(nil), ss.Set...)}
+		again.Normalize()
+		if again.String() != ss.String() {
+			t.Fatalf("Normalize(%q) not idempotent: %q then %q", before, ss.String(), again.String())
+		}
+	}
+}
+
+func TestCopyData_Normalize(t *testing.T) {
+	tests := []struct {
+		name                 string
+		source, dest         string
+		wantSource, wantDest string
+	}{
+		{"ascending", "3,1,2", "12,10,11", "1:3", "10:12"},
+		{"unordered dest", "1,2,3", "20,10,11", "1:3", "20,10:11"},
+		{"sizes differ", "2,1", "10", "2,1", "10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, _ := ParseUIDSet(tt.source)
+			dst, _ := ParseUIDSet(tt.dest)
+			data := &CopyData{UIDValidity: 1, SourceUIDs: *src, DestUIDs: *dst}
+			data.Normalize()
+			if got := data.SourceUIDs.String(); got != tt.wantSource {
+				t.Errorf("SourceUIDs = %q, want %q", got, tt.wantSource)
+			}
+			if got := data.DestUIDs.String(); got != tt.wantDest {
+				t.Errorf("DestUIDs = %q, want %q", got, tt.wantDest)
+			}
+		})
+	}
+}
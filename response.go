@@ -1,7 +1,10 @@
 package imap
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"strings"
 )
 
@@ -59,6 +62,15 @@ const (
 	ResponseCodeInProgress     ResponseCode = "INPROGRESS"
 	ResponseCodeUIDRequired    ResponseCode = "UIDREQUIRED"
 	ResponseCodeNoUpdate       ResponseCode = "NOUPDATE"
+	ResponseCodeUnknownCTE     ResponseCode = "UNKNOWN-CTE"
+	ResponseCodeTooBig         ResponseCode = "TOOBIG"
+
+	// Authentication and availability codes (RFC 5530).
+	ResponseCodeUnavailable          ResponseCode = "UNAVAILABLE"
+	ResponseCodeAuthenticationFailed ResponseCode = "AUTHENTICATIONFAILED"
+	ResponseCodeAuthorizationFailed  ResponseCode = "AUTHORIZATIONFAILED"
+	ResponseCodeExpired              ResponseCode = "EXPIRED"
+	ResponseCodePrivacyRequired      ResponseCode = "PRIVACYREQUIRED"
 )
 
 // StatusResponse represents an IMAP status response.
@@ -108,6 +120,19 @@ func (e *IMAPError) Unwrap() error {
 	return nil
 }
 
+// Errors with RFC 5530 response codes that backends can return, directly or
+// wrapped, to have the server send the matching code. Compare with
+// errors.Is.
+var (
+	ErrAlreadyExists = ErrNoWithCode(ResponseCodeAlreadyExists, "mailbox already exists")
+	ErrNonExistent   = ErrNoWithCode(ResponseCodeNonExistent, "no such mailbox")
+	ErrNoPerm        = ErrNoWithCode(ResponseCodeNoPerm, "permission denied")
+	ErrOverQuota     = ErrNoWithCode(ResponseCodeOverQuota, "quota exceeded")
+	ErrInUse         = ErrNoWithCode(ResponseCodeInUse, "resource in use")
+	ErrLimit         = ErrNoWithCode(ResponseCodeLimit, "limit exceeded")
+	ErrUnavailable   = ErrNoWithCode(ResponseCodeUnavailable, "temporarily unavailable")
+)
+
 // ErrNo creates a NO error with the given text.
 func ErrNo(text string) *IMAPError {
 	return &IMAPError{&StatusResponse{
@@ -149,3 +174,69 @@ func ErrBye(text string) *IMAPError {
 		Text: text,
 	}}
 }
+
+// WrapError returns an error reported to clients as status, which keeps
+// err as its cause: errors.Is and errors.As find both, and the message
+// includes the cause for logs, while clients only see the text of status.
+// Backends use it to classify their errors without losing them:
+//
+//	if errors.Is(err, sql.ErrNoRows) {
+//		return imap.WrapError(imap.ErrNonExistent, err)
+//	}
+//
+// Errors wrapped further with fmt.Errorf and %w, for example by
+// middleware, keep the classification. If err is nil, status is returned.
+func WrapError(status *IMAPError, err error) error {
+	if err == nil {
+		return status
+	}
+	return &wrappedError{status: status, err: err}
+}
+
+// wrappedError is an error classified by WrapError.
+type wrappedError struct {
+	status *IMAPError
+	err    error
+}
+
+func (e *wrappedError) Error() string {
+	return e.status.Error() + ": " + e.err.Error()
+}
+
+func (e *wrappedError) Unwrap() []error {
+	return []error{e.status, e.err}
+}
+
+// ClassifyError returns the status response reported to clients for an
+// error returned by a backend or command handler. An IMAPError in the
+// chain of err, as found by errors.As, is used as is. Otherwise the status
+// is inferred from well-known errors:
+//
+//   - context.DeadlineExceeded: NO [UNAVAILABLE], ErrUnavailable
+//   - fs.ErrNotExist: NO [NONEXISTENT], ErrNonExistent
+//   - fs.ErrExist: NO [ALREADYEXISTS], ErrAlreadyExists
+//   - fs.ErrPermission: NO [NOPERM], ErrNoPerm
+//
+// os.ErrNotExist and the other errors of package os are the errors of
+// package fs. ClassifyError returns nil for other errors, which servers
+// report as internal errors.
+func ClassifyError(err error) *IMAPError {
+	if err == nil {
+		return nil
+	}
+	var imapErr *IMAPError
+	if errors.As(err, &imapErr) {
+		return imapErr
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrUnavailable
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrNonExistent
+	case errors.Is(err, fs.ErrExist):
+		return ErrAlreadyExists
+	case errors.Is(err, fs.ErrPermission):
+		return ErrNoPerm
+	}
+	return nil
+}
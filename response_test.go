@@ -1,7 +1,10 @@
 package imap
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io/fs"
 	"testing"
 )
 
@@ -366,3 +369,45 @@ func TestResponseCode_Values(t *testing.T) {
 		}
 	}
 }
+
+func TestWrapError(t *testing.T) {
+	cause := errors.New("disk full")
+	err := fmt.Errorf("append: %w", WrapError(ErrOverQuota, cause))
+
+	if !errors.Is(err, ErrOverQuota) || !errors.Is(err, cause) {
+		t.Errorf("errors.Is() does not find the status and the cause of %v", err)
+	}
+	var imapErr *IMAPError
+	if !errors.As(err, &imapErr) || imapErr.Code != ResponseCodeOverQuota {
+		t.Errorf("errors.As() = %v, want OVERQUOTA", imapErr)
+	}
+	if want := "append: NO [OVERQUOTA] quota exceeded: disk full"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	if got := WrapError(ErrNoPerm, nil); got != error(ErrNoPerm) {
+		t.Errorf("WrapError(status, nil) = %v, want status", got)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want *IMAPError
+	}{
+		{nil, nil},
+		{errors.New("boom"), nil},
+		{ErrNoPerm, ErrNoPerm},
+		{fmt.Errorf("wrapped: %w", ErrInUse), ErrInUse},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), ErrUnavailable},
+		{&fs.PathError{Op: "open", Path: "x", Err: fs.ErrNotExist}, ErrNonExistent},
+		{fmt.Errorf("mkdir: %w", fs.ErrExist), ErrAlreadyExists},
+		{fmt.Errorf("open: %w", fs.ErrPermission), ErrNoPerm},
+		// An explicit classification wins over inference.
+		{WrapError(ErrLimit, context.DeadlineExceeded), ErrLimit},
+	}
+	for _, tc := range tests {
+		if got := ClassifyError(tc.err); got != tc.want {
+			t.Errorf("ClassifyError(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
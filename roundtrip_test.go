@@ -0,0 +1,378 @@
+package imap_test
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client/search"
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/wire"
+)
+
+// The tests in this file check that values written in the wire format are
+// read back unchanged, for values generated at random by testing/quick.
+
+// quickConfig returns the configuration of the property tests. The seed is
+// logged so that a failure can be reproduced.
+func quickConfig(t *testing.T) *quick.Config {
+	seed := time.Now().UnixNano()
+	t.Logf("seed %d", seed)
+	return &quick.Config{MaxCount: 500, Rand: rand.New(rand.NewSource(seed))}
+}
+
+// randNum returns a random message number, mostly small ones so that
+// ranges overlap, and 0, which stands for "*", one time in ten.
+func randNum(r *rand.Rand) uint32 {
+	switch r.Intn(10) {
+	case 0:
+		return 0
+	case 1:
+		return r.Uint32()>>1 + 1
+	default:
+		return uint32(r.Intn(1000)) + 1
+	}
+}
+
+// randNumSet returns 1 to 8 random ranges and single numbers.
+func randNumSet(r *rand.Rand) []imap.NumRange {
+	ranges := make([]imap.NumRange, r.Intn(8)+1)
+	for i := range ranges {
+		start := randNum(r)
+		stop := start
+		if r.Intn(2) == 0 {
+			stop = randNum(r)
+		}
+		ranges[i] = imap.NumRange{Start: start, Stop: stop}
+	}
+	return ranges
+}
+
+// numSetArg is a random number set for testing/quick.
+type numSetArg []imap.NumRange
+
+func (numSetArg) Generate(r *rand.Rand, _ int) reflect.Value {
+	return reflect.ValueOf(numSetArg(randNumSet(r)))
+}
+
+func TestSeqSet_RoundTrip(t *testing.T) {
+	prop := func(ranges numSetArg) bool {
+		var ss imap.SeqSet
+		for _, rg := range ranges {
+			ss.AddRange(rg.Start, rg.Stop)
+		}
+		parsed, err := imap.ParseSeqSet(ss.String())
+		if err != nil {
+			t.Logf("ParseSeqSet(%q) error: %v", ss.String(), err)
+			return false
+		}
+		if !reflect.DeepEqual(parsed, &ss) || parsed.Dynamic() != ss.Dynamic() {
+			return false
+		}
+		for n := uint32(1); n <= 1010; n++ {
+			if parsed.Contains(n) != ss.Contains(n) {
+				return false
+			}
+		}
+
+		// Normalizing does not change the numbers of the set, nor how it
+		// is read back.
+		norm := ss
+		norm.Set = append([]imap.NumRange(nil), ss.Set...)
+		norm.Normalize()
+		parsed, err = imap.ParseSeqSet(norm.String())
+		if err != nil || !reflect.DeepEqual(parsed, &norm) {
+			return false
+		}
+		for n := uint32(1); n <= 1010; n++ {
+			if norm.Contains(n) != ss.Contains(n) {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(prop, quickConfig(t)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUIDSet_RoundTrip(t *testing.T) {
+	prop := func(ranges numSetArg) bool {
+		var us imap.UIDSet
+		for _, rg := range ranges {
+			us.AddRange(imap.UID(rg.Start), imap.UID(rg.Stop))
+		}
+		parsed, err := imap.ParseUIDSet(us.String())
+		if err != nil {
+			t.Logf("ParseUIDSet(%q) error: %v", us.String(), err)
+			return false
+		}
+		return reflect.DeepEqual(parsed, &us)
+	}
+	if err := quick.Check(prop, quickConfig(t)); err != nil {
+		t.Error(err)
+	}
+}
+
+// atomChars are the characters of atoms that may also start a flag
+// keyword: ATOM-CHAR of RFC 3501 without ']', which is a resp-specials
+// character that decoders reject in atoms.
+var atomChars = func() []byte {
+	var chars []byte
+	for c := byte(0x21); c < 0x7f; c++ {
+		if !strings.ContainsRune(`(){ %*"\]`, rune(c)) {
+			chars = append(chars, c)
+		}
+	}
+	return chars
+}()
+
+// randAtom returns a random atom of 1 to 12 characters.
+func randAtom(r *rand.Rand) string {
+	b := make([]byte, r.Intn(12)+1)
+	for i := range b {
+		b[i] = atomChars[r.Intn(len(atomChars))]
+	}
+	return string(b)
+}
+
+var systemFlags = []imap.Flag{
+	imap.FlagSeen, imap.FlagAnswered, imap.FlagFlagged,
+	imap.FlagDeleted, imap.FlagDraft, imap.FlagRecent,
+}
+
+// randFlag returns a random system flag or keyword.
+func randFlag(r *rand.Rand) imap.Flag {
+	if r.Intn(2) == 0 {
+		return systemFlags[r.Intn(len(systemFlags))]
+	}
+	return imap.Flag(randAtom(r))
+}
+
+// flagsArg is a random list of flags for testing/quick, with the flag
+// extensions of RFC 3501 and \* as in PERMANENTFLAGS.
+type flagsArg []string
+
+func (flagsArg) Generate(r *rand.Rand, _ int) reflect.Value {
+	flags := make([]string, r.Intn(6))
+	for i := range flags {
+		switch r.Intn(8) {
+		case 0:
+			flags[i] = `\*`
+		case 1:
+			flags[i] = `\` + randAtom(r)
+		default:
+			flags[i] = string(randFlag(r))
+		}
+	}
+	return reflect.ValueOf(flagsArg(flags))
+}
+
+func TestFlags_RoundTrip(t *testing.T) {
+	prop := func(flags flagsArg) bool {
+		var buf bytes.Buffer
+		enc := wire.NewEncoder(&buf)
+		enc.Flags(flags)
+		if err := enc.Flush(); err != nil {
+			return false
+		}
+		got, err := wire.NewDecoder(&buf).ReadFlags()
+		if err != nil {
+			t.Logf("ReadFlags(%q) error: %v", buf.String(), err)
+			return false
+		}
+		if len(flags) == 0 {
+			return len(got) == 0
+		}
+		return reflect.DeepEqual(got, []string(flags))
+	}
+	if err := quick.Check(prop, quickConfig(t)); err != nil {
+		t.Error(err)
+	}
+}
+
+// randTime returns a random time between 1970 and 2100, to the second, in
+// a random zone offset of up to 14 hours in quarter hours.
+func randTime(r *rand.Rand) time.Time {
+	offset := (r.Intn(113) - 56) * 15 * 60
+	zone := time.FixedZone("", offset)
+	return time.Unix(r.Int63n(4102444800), 0).In(zone)
+}
+
+// timeArg is a random time for testing/quick.
+type timeArg struct{ time.Time }
+
+func (timeArg) Generate(r *rand.Rand, _ int) reflect.Value {
+	return reflect.ValueOf(timeArg{randTime(r)})
+}
+
+func TestDates_RoundTrip(t *testing.T) {
+	prop := func(arg timeArg) bool {
+		tm := arg.Time
+		_, offset := tm.Zone()
+
+		got, err := time.Parse(imap.InternalDateLayout, imap.InternalDate(tm).String())
+		if err != nil {
+			return false
+		}
+		if _, gotOffset := got.Zone(); !got.Equal(tm) || gotOffset != offset {
+			return false
+		}
+
+		var buf bytes.Buffer
+		enc := wire.NewEncoder(&buf)
+		enc.DateTime(tm).SP().Date(tm)
+		if err := enc.Flush(); err != nil {
+			return false
+		}
+		dec := wire.NewDecoder(&buf)
+		dateTime, err := dec.ReadQuotedString()
+		if err != nil || dec.ReadSP() != nil {
+			return false
+		}
+		date, err := dec.ReadQuotedString()
+		if err != nil {
+			return false
+		}
+		got, err = time.Parse(imap.InternalDateLayout, dateTime)
+		if _, gotOffset := got.Zone(); err != nil || !got.Equal(tm) || gotOffset != offset {
+			return false
+		}
+		got, err = time.Parse("2-Jan-2006", date)
+		y, m, d := tm.Date()
+		return err == nil && got.Equal(time.Date(y, m, d, 0, 0, 0, 0, time.UTC))
+	}
+	if err := quick.Check(prop, quickConfig(t)); err != nil {
+		t.Error(err)
+	}
+}
+
+// randSearchString returns a random string without CR and LF, which cannot
+// be quoted, and with non-ASCII characters one time in four.
+func randSearchString(r *rand.Rand) string {
+	const chars = ` !"#%()*\]{}abcdeXYZ019@.-_`
+	var b strings.Builder
+	for i := r.Intn(10); i >= 0; i-- {
+		b.WriteByte(chars[r.Intn(len(chars))])
+	}
+	if r.Intn(4) == 0 {
+		b.WriteString([]string{"é", "日本", "ß"}[r.Intn(3)])
+	}
+	return b.String()
+}
+
+// randSearchDate returns a random date, at midnight UTC as search dates
+// are read.
+func randSearchDate(r *rand.Rand) time.Time {
+	return time.Date(1970+r.Intn(130), time.Month(r.Intn(12)+1), r.Intn(28)+1, 0, 0, 0, 0, time.UTC)
+}
+
+// headerNames are the header fields of search criteria: those written
+// with their own search key, in the case they are read back with, and
+// others written with HEADER.
+var headerNames = []string{"From", "To", "Cc", "Bcc", "Subject", "X-Mailer", "List-Id", "Message-ID"}
+
+// randCriteria returns random search criteria that the search key grammar
+// can express, with each key other than the flags, the header fields and
+// the strings at most once, as the parser merges repeated keys, and with
+// the NOT and OR keys nested up to depth times.
+func randCriteria(r *rand.Rand, depth int) imap.SearchCriteria {
+	var c imap.SearchCriteria
+	maybe := func() bool { return r.Intn(6) == 0 }
+
+	if maybe() {
+		ss, _ := imap.ParseSeqSet(formatRanges(randNumSet(r)))
+		c.SeqNum = ss
+	}
+	if maybe() {
+		us, _ := imap.ParseUIDSet(formatRanges(randNumSet(r)))
+		c.UID = us
+	}
+	for _, d := range []*time.Time{
+		&c.Since, &c.Before, &c.On, &c.SentSince, &c.SentBefore, &c.SentOn,
+		&c.SavedSince, &c.SavedBefore, &c.SavedOn,
+	} {
+		if r.Intn(12) == 0 {
+			*d = randSearchDate(r)
+		}
+	}
+	for i := r.Intn(3) - 1; i >= 0; i-- {
+		c.Header = append(c.Header, imap.SearchCriteriaHeaderField{
+			Key:   headerNames[r.Intn(len(headerNames))],
+			Value: randSearchString(r),
+		})
+	}
+	for i := r.Intn(3) - 1; i >= 0; i-- {
+		c.Body = append(c.Body, randSearchString(r))
+	}
+	for i := r.Intn(3) - 1; i >= 0; i-- {
+		c.Text = append(c.Text, randSearchString(r))
+	}
+	for i := r.Intn(4) - 1; i >= 0; i-- {
+		c.Flag = append(c.Flag, randFlag(r))
+	}
+	for i := r.Intn(4) - 1; i >= 0; i-- {
+		c.NotFlag = append(c.NotFlag, randFlag(r))
+	}
+	for _, n := range []*int64{&c.Larger, &c.Smaller, &c.Younger, &c.Older} {
+		if maybe() {
+			*n = r.Int63n(1<<40) + 1
+		}
+	}
+	if maybe() {
+		c.ModSeq = &imap.SearchCriteriaModSeq{ModSeq: r.Uint64() >> 1}
+		if r.Intn(2) == 0 {
+			c.ModSeq.MetadataName = "/flags/" + string(randFlag(r))
+			c.ModSeq.MetadataType = []string{"priv", "shared", "all"}[r.Intn(3)]
+		}
+	}
+	if depth > 0 {
+		for i := r.Intn(3) - 1; i >= 0; i-- {
+			c.Not = append(c.Not, randCriteria(r, depth-1))
+		}
+		for i := r.Intn(3) - 1; i >= 0; i-- {
+			c.Or = append(c.Or, [2]imap.SearchCriteria{randCriteria(r, depth-1), randCriteria(r, depth-1)})
+		}
+	}
+	return c
+}
+
+func formatRanges(ranges []imap.NumRange) string {
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// criteriaArg is random search criteria for testing/quick.
+type criteriaArg struct{ imap.SearchCriteria }
+
+func (criteriaArg) Generate(r *rand.Rand, _ int) reflect.Value {
+	return reflect.ValueOf(criteriaArg{randCriteria(r, 2)})
+}
+
+func TestSearchCriteria_RoundTrip(t *testing.T) {
+	prop := func(arg criteriaArg) bool {
+		want := &arg.SearchCriteria
+		s := search.Encode(want)
+		got, err := server.ParseSearch(wire.NewDecoder(strings.NewReader(s)))
+		if err != nil {
+			t.Logf("ParseSearch(%q) error: %v", s, err)
+			return false
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Logf("ParseSearch(%q) = %+v, want %+v", s, got, want)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(prop, quickConfig(t)); err != nil {
+		t.Error(err)
+	}
+}
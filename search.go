@@ -88,6 +88,8 @@ type SearchOptions struct {
 	ReturnUpdate bool
 	// ReturnPartial requests partial results (RFC 9394).
 	ReturnPartial *SearchReturnPartial
+	// ReturnRelevancy requests the relevancy scores of the results (RFC 6203).
+	ReturnRelevancy bool
 }
 
 // SearchReturnPartial specifies partial result options.
@@ -114,6 +116,11 @@ type SearchData struct {
 	// Partial results
 	Partial *SearchPartialData
 
+	// Incomplete is set by sessions that stopped searching early, for
+	// example because the command deadline passed, to report that the
+	// results only cover part of the mailbox.
+	Incomplete bool
+
 	// CONTEXT=SEARCH notifications (RFC 5267)
 	AddTo      []SearchContextUpdate
 	RemoveFrom []SearchContextUpdate
@@ -138,3 +145,100 @@ type MultiSearchResult struct {
 	UIDValidity uint32
 	Data        *SearchData
 }
+
+// And narrows c so that it also requires other to match. List fields are
+// appended and range fields are intersected. Single-valued fields that are
+// set in both and cannot be combined, such as two different sequence sets,
+// are kept by nesting other's value as NOT (NOT ...).
+func (c *SearchCriteria) And(other *SearchCriteria) {
+	var rest SearchCriteria
+	conflict := false
+
+	if other.SeqNum != nil {
+		if c.SeqNum == nil {
+			c.SeqNum = other.SeqNum
+		} else {
+			rest.SeqNum = other.SeqNum
+			conflict = true
+		}
+	}
+	if other.UID != nil {
+		if c.UID == nil {
+			c.UID = other.UID
+		} else {
+			rest.UID = other.UID
+			conflict = true
+		}
+	}
+	if other.ModSeq != nil {
+		if c.ModSeq == nil {
+			c.ModSeq = other.ModSeq
+		} else {
+			rest.ModSeq = other.ModSeq
+			conflict = true
+		}
+	}
+
+	c.Since = laterTime(c.Since, other.Since)
+	c.SentSince = laterTime(c.SentSince, other.SentSince)
+	c.SavedSince = laterTime(c.SavedSince, other.SavedSince)
+	c.Before = earlierTime(c.Before, other.Before)
+	c.SentBefore = earlierTime(c.SentBefore, other.SentBefore)
+	c.SavedBefore = earlierTime(c.SavedBefore, other.SavedBefore)
+
+	for _, on := range []struct{ dst, src, rest *time.Time }{
+		{&c.On, &other.On, &rest.On},
+		{&c.SentOn, &other.SentOn, &rest.SentOn},
+		{&c.SavedOn, &other.SavedOn, &rest.SavedOn},
+	} {
+		switch {
+		case on.src.IsZero():
+		case on.dst.IsZero():
+			*on.dst = *on.src
+		case !on.dst.Equal(*on.src):
+			*on.rest = *on.src
+			conflict = true
+		}
+	}
+
+	if other.Larger > c.Larger {
+		c.Larger = other.Larger
+	}
+	if other.Smaller != 0 && (c.Smaller == 0 || other.Smaller < c.Smaller) {
+		c.Smaller = other.Smaller
+	}
+	if other.Younger != 0 && (c.Younger == 0 || other.Younger < c.Younger) {
+		c.Younger = other.Younger
+	}
+	if other.Older > c.Older {
+		c.Older = other.Older
+	}
+
+	c.Header = append(c.Header, other.Header...)
+	c.Body = append(c.Body, other.Body...)
+	c.Text = append(c.Text, other.Text...)
+	c.Flag = append(c.Flag, other.Flag...)
+	c.NotFlag = append(c.NotFlag, other.NotFlag...)
+	c.Or = append(c.Or, other.Or...)
+	c.Not = append(c.Not, other.Not...)
+	c.SaveResult = c.SaveResult || other.SaveResult
+	c.Fuzzy = c.Fuzzy || other.Fuzzy
+
+	if conflict {
+		c.Not = append(c.Not, SearchCriteria{Not: []SearchCriteria{rest}})
+	}
+}
+
+func laterTime(a, b time.Time) time.Time {
+	if a.IsZero() || b.After(a) {
+		return b
+	}
+	return a
+}
+
+func earlierTime(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
@@ -1,5 +1,7 @@
 package imap
 
+import "strings"
+
 // SelectOptions specifies options for the SELECT/EXAMINE command.
 type SelectOptions struct {
 	// ReadOnly opens the mailbox in read-only mode (EXAMINE).
@@ -51,3 +53,18 @@ type SelectData struct {
 	// MailboxID is the mailbox ID (RFC 8474).
 	MailboxID string
 }
+
+// CanStoreFlag reports whether the flag can be stored permanently in the
+// mailbox: PermanentFlags lists it, or lists \* and the flag is a keyword.
+// It returns false for read-only mailboxes.
+func (d *SelectData) CanStoreFlag(f Flag) bool {
+	if d.ReadOnly {
+		return false
+	}
+	for _, p := range d.PermanentFlags {
+		if strings.EqualFold(string(p), string(f)) || (p == FlagWildcard && f.IsKeyword()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ErrUnknownConn is returned by Kick if no open connection has the given
+// ID.
+var ErrUnknownConn = errors.New("unknown connection")
+
+// DefaultKickReason is the text of the BYE response sent by Kick when it
+// is given none.
+const DefaultKickReason = "Connection closed by administrator"
+
+// ConnInfo describes an open connection, as returned by
+// Server.Connections. It can be marshaled as JSON.
+type ConnInfo struct {
+	// ID identifies the connection for Kick. IDs are assigned in the
+	// order connections are accepted and are not reused.
+	ID         uint64 `json:"id"`
+	Username   string `json:"username,omitempty"`
+	RemoteAddr string `json:"remoteAddr"`
+	State      string `json:"state"`
+	// Mailbox is the selected mailbox, if any.
+	Mailbox  string `json:"mailbox,omitempty"`
+	ReadOnly bool   `json:"readOnly,omitempty"`
+	TLS      bool   `json:"tls"`
+	// Command is the name of the command being handled, if any, such as
+	// IDLE.
+	Command     string    `json:"command,omitempty"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	// Idle is the time since a command was last read or completed.
+	Idle         time.Duration `json:"idle"`
+	BytesRead    int64         `json:"bytesRead"`
+	BytesWritten int64         `json:"bytesWritten"`
+}
+
+// ID returns the ID of the connection, see ConnInfo.ID.
+func (c *Conn) ID() uint64 {
+	return c.id
+}
+
+// Info returns a description of the connection.
+func (c *Conn) Info() ConnInfo {
+	now := time.Now()
+	c.mu.Lock()
+	info := ConnInfo{
+		ID:          c.id,
+		Username:    c.username,
+		Mailbox:     c.mailbox,
+		ReadOnly:    c.readOnly,
+		TLS:         c.isTLS,
+		ConnectedAt: c.connectedAt,
+	}
+	if c.inProgress.Load() > 0 {
+		info.Command = c.command
+	}
+	c.mu.Unlock()
+	info.RemoteAddr = c.RemoteAddr().String()
+	info.State = c.State().String()
+	info.Idle = now.Sub(time.Unix(0, c.lastActive.Load()))
+	info.BytesRead = c.BytesRead()
+	info.BytesWritten = c.BytesWritten()
+	return info
+}
+
+// touch records activity on the connection, see ConnInfo.Idle.
+func (c *Conn) touch() {
+	c.lastActive.Store(time.Now().UnixNano())
+}
+
+// Connections returns a description of the open connections, ordered by
+// ID, so that operators can build admin tooling.
+func (srv *Server) Connections() []ConnInfo {
+	conns := srv.Conns()
+	infos := make([]ConnInfo, 0, len(conns))
+	for _, c := range conns {
+		infos = append(infos, c.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// Kick sends an untagged BYE with reason to the connection with the given
+// ID and closes it. The command being handled, if any, fails on its next
+// write and the session is closed once it returns. Control characters in
+// reason, such as line breaks, are sent as spaces. It returns
+// ErrUnknownConn if no open connection has the ID.
+func (srv *Server) Kick(id uint64, reason string) error {
+	var conn *Conn
+	srv.mu.Lock()
+	for c := range srv.conns {
+		if c.id == id {
+			conn = c
+			break
+		}
+	}
+	srv.mu.Unlock()
+	if conn == nil {
+		return fmt.Errorf("kick %d: %w", id, ErrUnknownConn)
+	}
+
+	if reason == "" {
+		reason = DefaultKickReason
+	}
+	conn.logger.Info("connection kicked", "id", id, "reason", reason)
+	conn.WriteBYE(reason)
+	return conn.Close()
+}
+
+// AdminHandler returns an HTTP handler exposing Connections and Kick as a
+// JSON debug endpoint. GET lists the open connections; POST or DELETE with
+// the query parameter id kicks a connection, with the BYE text given by
+// the optional parameter reason. The handler does no authentication, so
+// it must only be served on an admin listener or behind one.
+func (srv *Server) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(srv.Connections())
+		case http.MethodPost, http.MethodDelete:
+			id, err := strconv.ParseUint(r.FormValue("id"), 10, 64)
+			if err != nil {
+				http.Error(w, "invalid connection id", http.StatusBadRequest)
+				return
+			}
+			err = srv.Kick(id, r.FormValue("reason"))
+			if errors.Is(err, ErrUnknownConn) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// serveAdmin serves a connection of srv and returns the lines the client
+// reads after the greeting, and the client side.
+func serveAdmin(t *testing.T, srv *Server) (net.Conn, <-chan string) {
+	t.Helper()
+	c1, c2 := net.Pipe()
+	t.Cleanup(func() { c2.Close() })
+	go srv.handleConn(c1)
+
+	lines := make(chan string, 10)
+	r := bufio.NewReader(c2)
+	if _, err := r.ReadString('\n'); err != nil {
+		t.Fatalf("reading greeting: %v", err)
+	}
+	go func() {
+		defer close(lines)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- line
+		}
+	}()
+	return c2, lines
+}
+
+func TestServer_Connections(t *testing.T) {
+	srv := New()
+	srv.dispatcher.RegisterFunc("PING", func(ctx *CommandContext) error {
+		ctx.Conn.SetUsername("alice")
+		ctx.Conn.WriteOK(ctx.Tag, "PONG")
+		return nil
+	})
+	c, lines := serveAdmin(t, srv)
+	if _, err := c.Write([]byte("a1 PING\r\n")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if line := <-lines; line != "a1 OK PONG\r\n" {
+		t.Fatalf("got %q, want a1 OK PONG", line)
+	}
+
+	infos := srv.Connections()
+	if len(infos) != 1 {
+		t.Fatalf("Connections() = %d connections, want 1", len(infos))
+	}
+	info := infos[0]
+	if info.ID == 0 || info.Username != "alice" || info.State != "not authenticated" {
+		t.Errorf("Connections()[0] = %+v", info)
+	}
+	if info.BytesRead != int64(len("a1 PING\r\n")) || info.BytesWritten == 0 {
+		t.Errorf("BytesRead = %d, BytesWritten = %d", info.BytesRead, info.BytesWritten)
+	}
+	if info.Idle < 0 || info.Idle > time.Minute {
+		t.Errorf("Idle = %v", info.Idle)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	var got []ConnInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body, err)
+	}
+	if len(got) != 1 || got[0].ID != info.ID || got[0].Username != "alice" {
+		t.Errorf("GET = %s", rec.Body)
+	}
+}
+
+func TestServer_Kick(t *testing.T) {
+	srv := New()
+	_, lines := serveAdmin(t, srv)
+	id := srv.Connections()[0].ID
+
+	if err := srv.Kick(id+1, ""); !errors.Is(err, ErrUnknownConn) {
+		t.Errorf("Kick(unknown) error = %v, want ErrUnknownConn", err)
+	}
+
+	rec := httptest.NewRecorder()
+	form := url.Values{"id": {"x"}}
+	srv.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/?"+form.Encode(), nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST id=x: status %d, want 400", rec.Code)
+	}
+
+	form = url.Values{"id": {strconv.FormatUint(id, 10)}, "reason": {"Go away"}}
+	rec = httptest.NewRecorder()
+	srv.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/?"+form.Encode(), nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("POST: status %d, want 204", rec.Code)
+	}
+	if line := <-lines; line != "* BYE Go away\r\n" {
+		t.Errorf("got %q, want BYE", line)
+	}
+	if _, ok := <-lines; ok {
+		t.Error("connection still open after Kick")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(srv.Connections()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("kicked connection still listed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/?"+form.Encode(), nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("DELETE kicked connection: status %d, want 404", rec.Code)
+	}
+}
+
+func TestServer_KickReasonCannotInjectResponses(t *testing.T) {
+	srv := New()
+	_, lines := serveAdmin(t, srv)
+	id := srv.Connections()[0].ID
+
+	rec := httptest.NewRecorder()
+	query := "id=" + strconv.FormatUint(id, 10) + "&reason=a%0D%0A*%20OK%20x"
+	srv.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/?"+query, nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("POST: status %d, want 204", rec.Code)
+	}
+	if line := <-lines; line != "* BYE a  * OK x\r\n" {
+		t.Errorf("got %q, want a single BYE line", line)
+	}
+	if line, ok := <-lines; ok {
+		t.Errorf("got %q after BYE, want the connection closed", line)
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+)
+
+// ALPNProtocol is the ALPN protocol identifier of IMAP registered with
+// IANA.
+//
+// A gateway serving several protocols on one TLS port selects IMAP by the
+// protocol negotiated with ALPN. With net/http, for example, connections
+// that negotiated "imap" are handed to the IMAP server with ServeConn:
+//
+//	srv := memserver.New().NewServer(server.WithALPN())
+//	httpSrv.TLSConfig.NextProtos = append(httpSrv.TLSConfig.NextProtos, server.ALPNProtocol)
+//	httpSrv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){
+//		server.ALPNProtocol: func(_ *http.Server, conn *tls.Conn, _ http.Handler) {
+//			_ = srv.ServeConn(conn)
+//		},
+//	}
+const ALPNProtocol = "imap"
+
+// alpnTLSConfig returns config with the server's ALPN protocols added to
+// its NextProtos, or config if the server has none.
+func (srv *Server) alpnTLSConfig(config *tls.Config) *tls.Config {
+	protocols := srv.options.ALPNProtocols
+	if len(protocols) == 0 {
+		return config
+	}
+	config = config.Clone()
+	for _, p := range protocols {
+		if !containsString(config.NextProtos, p) {
+			config.NextProtos = append(config.NextProtos, p)
+		}
+	}
+	return config
+}
+
+// acceptALPN completes the TLS handshake of conn, if it is a TLS
+// connection and the server has ALPN protocols, and reports whether IMAP
+// is to be served on it: when it negotiated one of the server's protocols
+// or none, for clients not using ALPN. The handshake must complete within
+// the read timeout.
+func (srv *Server) acceptALPN(conn net.Conn) bool {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok || len(srv.options.ALPNProtocols) == 0 {
+		return true
+	}
+	ctx := context.Background()
+	if d := srv.options.ReadTimeout; d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	logger := srv.options.Logger.With("remote", conn.RemoteAddr().String())
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		logger.Debug("TLS handshake failed", "error", err)
+		return false
+	}
+	protocol := tlsConn.ConnectionState().NegotiatedProtocol
+	if protocol != "" && !containsString(srv.options.ALPNProtocols, protocol) {
+		logger.Info("rejecting connection for another ALPN protocol", "protocol", protocol)
+		return false
+	}
+	return true
+}
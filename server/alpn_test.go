@@ -0,0 +1,22 @@
+package server
+
+import (
+	"crypto/tls"
+	"reflect"
+	"testing"
+)
+
+func TestALPNTLSConfig(t *testing.T) {
+	config := &tls.Config{NextProtos: []string{"h2", ALPNProtocol}}
+	if got := New().alpnTLSConfig(config); got != config {
+		t.Errorf("alpnTLSConfig() without ALPN protocols changed the config")
+	}
+
+	got := New(WithALPN(ALPNProtocol, "x-imap")).alpnTLSConfig(config)
+	if want := []string{"h2", ALPNProtocol, "x-imap"}; !reflect.DeepEqual(got.NextProtos, want) {
+		t.Errorf("NextProtos = %q, want %q", got.NextProtos, want)
+	}
+	if len(config.NextProtos) != 2 {
+		t.Errorf("alpnTLSConfig() modified the config: %q", config.NextProtos)
+	}
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// AuthProvider authenticates users and authorizes their use of mailboxes
+// independently of the Session, so that a directory such as LDAP or an
+// OAuth 2.0 server can be plugged in without changes to the storage
+// backend. See WithAuthProvider. Package server/authprovider has a cache
+// and adapters for common providers.
+type AuthProvider interface {
+	// Authenticate checks the credentials presented for user and returns
+	// the authenticated identity. Errors that are not IMAP errors are
+	// reported to the client as AUTHENTICATIONFAILED without their text.
+	Authenticate(ctx context.Context, user string, credentials Credentials) (Identity, error)
+
+	// Authorize returns an error, such as NO [NOPERM], if identity may not
+	// perform action on mailbox. Errors that are not IMAP errors are
+	// reported as NOPERM.
+	Authorize(identity Identity, action Action, mailbox string) error
+}
+
+// Credentials are what a client presented to authenticate.
+type Credentials struct {
+	// Mechanism is "LOGIN" for the LOGIN command, or the SASL mechanism
+	// used with AUTHENTICATE: PLAIN, LOGIN, OAUTHBEARER or XOAUTH2.
+	// Other mechanisms are handled by the session.
+	Mechanism string
+	// Password is the password given with LOGIN, PLAIN and LOGIN.
+	Password string
+	// Token is the bearer token given with OAUTHBEARER and XOAUTH2.
+	Token string
+}
+
+// Identity is an authenticated user.
+type Identity struct {
+	// Username is the name the session is logged in as. If Authenticate
+	// leaves it empty, the name the client gave is used.
+	Username string
+	// Groups are the groups the user belongs to, for authorization.
+	Groups []string
+	// Attributes are other properties of the user from the provider, such
+	// as a display name or OAuth scopes.
+	Attributes map[string]string
+}
+
+// Action is what a user is about to do with a mailbox: the name of the
+// command that names it. COPY and MOVE are checked against their
+// destination, and LIST and LSUB against each mailbox listed, which is
+// left out of the responses if not authorized. The commands of extensions
+// are checked with their names too, such as GETACL, SETMETADATA, or
+// ESEARCH against each mailbox searched by ESEARCH IN.
+type Action string
+
+// Actions checked by the built-in command handlers.
+const (
+	ActionSelect  Action = "SELECT"
+	ActionExamine Action = "EXAMINE"
+	ActionCreate  Action = "CREATE"
+	ActionDelete  Action = "DELETE"
+	ActionRename  Action = "RENAME"
+	ActionStatus  Action = "STATUS"
+	ActionAppend  Action = "APPEND"
+	ActionCopy    Action = "COPY"
+	ActionMove    Action = "MOVE"
+	ActionList    Action = "LIST"
+	ActionLsub    Action = "LSUB"
+)
+
+// SessionLoginIdentity is an optional interface for sessions that can be
+// logged in as a user authenticated by the server's AuthProvider, without
+// checking credentials themselves. Sessions that do not implement it are
+// logged in with Session.Login and the password, so they must accept the
+// same passwords as the provider.
+type SessionLoginIdentity interface {
+	LoginIdentity(identity Identity) error
+}
+
+// errNoPasswordForSession is returned for token authentication by an
+// AuthProvider when the session cannot be logged in without a password.
+var errNoPasswordForSession = imap.ErrNo("backend does not support external authentication")
+
+// AuthenticateWithProvider authenticates user with the server's
+// AuthProvider and logs the session in as the returned identity. It
+// returns false if the server has no AuthProvider, in which case LOGIN and
+// AUTHENTICATE check credentials with the session. On success, the
+// username to complete authentication with is returned.
+func (c *Conn) AuthenticateWithProvider(ctx context.Context, user string, credentials Credentials) (handled bool, username string, err error) {
+	provider := c.server.options.AuthProvider
+	if provider == nil {
+		return false, "", nil
+	}
+	identity, err := provider.Authenticate(ctx, user, credentials)
+	if err != nil {
+		return true, "", err
+	}
+	if identity.Username == "" {
+		identity.Username = user
+	}
+
+	if sess, ok := c.session.(SessionLoginIdentity); ok {
+		err = sess.LoginIdentity(identity)
+	} else if credentials.Password != "" {
+		err = c.session.Login(identity.Username, credentials.Password)
+	} else {
+		err = errNoPasswordForSession
+	}
+	if err != nil {
+		return true, "", err
+	}
+
+	c.mu.Lock()
+	c.identity = &identity
+	c.mu.Unlock()
+	return true, identity.Username, nil
+}
+
+// Identity returns the identity of the authenticated user: the one
+// returned by the AuthProvider, or one with just the username if the
+// connection authenticated otherwise. It returns false before
+// authentication.
+func (c *Conn) Identity() (Identity, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.identity != nil {
+		return *c.identity, true
+	}
+	if c.username == "" {
+		return Identity{}, false
+	}
+	return Identity{Username: c.username}, true
+}
+
+// authorize checks with the server's AuthProvider that the authenticated
+// user may perform the current command on mailbox.
+func (c *Conn) authorize(mailbox string) error {
+	provider := c.server.options.AuthProvider
+	if provider == nil {
+		return nil
+	}
+	identity, ok := c.Identity()
+	if !ok {
+		return nil
+	}
+	err := provider.Authorize(identity, c.currentAction(), mailbox)
+	var imapErr *imap.IMAPError
+	if err != nil && !errors.As(err, &imapErr) {
+		c.logger.Debug("authorization denied", "mailbox", mailbox, "error", err)
+		return imap.ErrNoWithCode(imap.ResponseCodeNoPerm, "access to mailbox denied")
+	}
+	return err
+}
+
+// setCommand records the name of the command being handled, the Action
+// of authorization checks.
+func (c *Conn) setCommand(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.command = name
+}
+
+func (c *Conn) currentAction() Action {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Action(c.command)
+}
@@ -0,0 +1,73 @@
+// Package authprovider implements server.AuthProvider on top of common
+// directories, so that a server can authenticate users against an
+// htpasswd file, an LDAP server or an OAuth 2.0 authorization server
+// without changes to its storage backend:
+//
+//	provider := authprovider.NewCache(authprovider.New(
+//		&authprovider.LDAPBind{
+//			Addr:       "ldap.example.org:636",
+//			TLSConfig:  &tls.Config{ServerName: "ldap.example.org"},
+//			DNTemplate: "uid=%s,ou=people,dc=example,dc=org",
+//		},
+//		authprovider.PolicyAuthorizer(policy),
+//	), 5*time.Minute)
+//	srv := server.New(server.WithAuthProvider(provider), ...)
+//
+// The adapters only authenticate; New combines one with an AuthorizeFunc
+// into a server.AuthProvider.
+package authprovider
+
+import (
+	"context"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/server"
+)
+
+// Authenticator is the authentication half of a server.AuthProvider,
+// implemented by the adapters of this package.
+type Authenticator interface {
+	Authenticate(ctx context.Context, user string, credentials server.Credentials) (server.Identity, error)
+}
+
+// AuthorizeFunc is the authorization half of a server.AuthProvider. It
+// denies access with NO [NOPERM]; other errors are taken as failures to
+// decide, which Cache does not cache.
+type AuthorizeFunc func(identity server.Identity, action server.Action, mailbox string) error
+
+// errAuthFailed is returned for credentials that are wrong, or that an
+// adapter does not check, such as a token given to LDAPBind.
+var errAuthFailed = imap.ErrNoWithCode(imap.ResponseCodeAuthenticationFailed, "authentication failed")
+
+// provider combines an Authenticator and an AuthorizeFunc.
+type provider struct {
+	Authenticator
+	authorize AuthorizeFunc
+}
+
+// New returns a server.AuthProvider that authenticates users with authn
+// and authorizes them with authz. If authz is nil, authenticated users may
+// access all mailboxes, leaving authorization to the session.
+func New(authn Authenticator, authz AuthorizeFunc) server.AuthProvider {
+	return &provider{Authenticator: authn, authorize: authz}
+}
+
+func (p *provider) Authorize(identity server.Identity, action server.Action, mailbox string) error {
+	if p.authorize == nil {
+		return nil
+	}
+	return p.authorize(identity, action, mailbox)
+}
+
+// PolicyAuthorizer returns an AuthorizeFunc applying a MailboxAccessPolicy
+// to the groups of the identity, such as those found by the directory,
+// instead of those returned by the policy's Groups function. The action
+// is not taken into account.
+func PolicyAuthorizer(policy *server.MailboxAccessPolicy) AuthorizeFunc {
+	return func(identity server.Identity, action server.Action, mailbox string) error {
+		if !policy.Allowed(identity.Username, identity.Groups, mailbox) {
+			return imap.ErrNoWithCode(imap.ResponseCodeNoPerm, "access to mailbox denied")
+		}
+		return nil
+	}
+}
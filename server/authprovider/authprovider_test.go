@@ -0,0 +1,89 @@
+package authprovider_test
+
+import (
+	"context"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/imaptest"
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/server/authprovider"
+	_ "github.com/meszmate/imap-go/server/commands"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+// staticAuthenticator accepts a single password for every user, putting
+// them in group "staff".
+type staticAuthenticator string
+
+func (a staticAuthenticator) Authenticate(ctx context.Context, user string, credentials server.Credentials) (server.Identity, error) {
+	if credentials.Password != string(a) {
+		return server.Identity{}, imap.ErrNo("wrong password")
+	}
+	return server.Identity{Username: user, Groups: []string{"staff"}}, nil
+}
+
+func TestProvider(t *testing.T) {
+	policy := &server.MailboxAccessPolicy{
+		Rules: []server.MailboxAccessRule{
+			{Groups: []string{"staff"}, Patterns: []string{"Shared/*"}},
+			{Patterns: []string{"Shared/*"}, Deny: true},
+		},
+	}
+	mem := memserver.New()
+	srv := mem.NewServer(server.WithAuthProvider(authprovider.New(
+		staticAuthenticator("directory-secret"),
+		authprovider.PolicyAuthorizer(policy),
+	)))
+	h := imaptest.NewHarness(t, srv)
+
+	c := h.Dial()
+	if err := c.Login("carol", "wrong"); err == nil {
+		t.Fatal("Login() with a wrong password succeeded")
+	}
+	// carol is unknown to the memserver and gets mailboxes on first login
+	if err := c.Login("carol", "directory-secret"); err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	if mem.GetUserData("carol") == nil {
+		t.Error("no mailboxes were created for carol")
+	}
+	if err := c.Create("Shared/Team"); err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	if _, err := c.Select("Shared/Team", nil); err != nil {
+		t.Errorf("Select() error: %v", err)
+	}
+}
+
+func TestProvider_Denied(t *testing.T) {
+	authorize := func(identity server.Identity, action server.Action, mailbox string) error {
+		if mailbox == "Archive" && action != server.ActionCreate {
+			return imap.ErrNoWithCode(imap.ResponseCodeNoPerm, "archive is write-only")
+		}
+		return nil
+	}
+	mem := memserver.New()
+	srv := mem.NewServer(server.WithAuthProvider(authprovider.New(staticAuthenticator("pw"), authorize)))
+	h := imaptest.NewHarness(t, srv)
+
+	c := h.Dial()
+	if err := c.Login("dave", "pw"); err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	if err := c.Create("Archive"); err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	if _, err := c.Select("Archive", nil); err == nil {
+		t.Error("Select() of a denied mailbox succeeded")
+	}
+	list, err := c.ListMailboxes("", "*")
+	if err != nil {
+		t.Fatalf("ListMailboxes() error: %v", err)
+	}
+	for _, data := range list {
+		if data.Mailbox == "Archive" {
+			t.Error("ListMailboxes() returned a denied mailbox")
+		}
+	}
+}
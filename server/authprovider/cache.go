@@ -0,0 +1,176 @@
+package authprovider
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/server"
+)
+
+// DefaultCacheSize is the maximum number of entries of a Cache of each
+// kind when Cache.MaxEntries is 0.
+const DefaultCacheSize = 10000
+
+// Cache is a server.AuthProvider that caches the results of another, so
+// that clients opening many connections, and LIST responses authorizing
+// every mailbox, do not each query the directory.
+//
+// Successful authentications are cached for TTL, keyed by a hash of the
+// credentials, so that a changed password takes effect immediately while
+// the old one keeps working until its entry expires. Failed ones are not
+// cached. Authorization decisions, allowed or denied with NO [NOPERM], are
+// cached for TTL; other errors, such as a directory outage, are not, so
+// that they do not deny access for a whole TTL.
+type Cache struct {
+	provider server.AuthProvider
+
+	// TTL is how long results are cached.
+	TTL time.Duration
+	// MaxEntries is the maximum number of authentications and of
+	// authorization decisions cached. If 0, DefaultCacheSize is used.
+	MaxEntries int
+
+	mu    sync.Mutex
+	authn map[[sha256.Size]byte]cachedIdentity
+	authz map[authzKey]cachedDecision
+	now   func() time.Time
+}
+
+var _ server.AuthProvider = (*Cache)(nil)
+
+type cachedIdentity struct {
+	identity server.Identity
+	expires  time.Time
+}
+
+type authzKey struct {
+	username string
+	action   server.Action
+	mailbox  string
+}
+
+type cachedDecision struct {
+	err     error
+	expires time.Time
+}
+
+// NewCache returns a Cache of the results of p.
+func NewCache(p server.AuthProvider, ttl time.Duration) *Cache {
+	return &Cache{
+		provider: p,
+		TTL:      ttl,
+		authn:    make(map[[sha256.Size]byte]cachedIdentity),
+		authz:    make(map[authzKey]cachedDecision),
+		now:      time.Now,
+	}
+}
+
+// Authenticate implements server.AuthProvider.
+func (c *Cache) Authenticate(ctx context.Context, user string, credentials server.Credentials) (server.Identity, error) {
+	key := credentialsKey(user, credentials)
+	now := c.now()
+
+	c.mu.Lock()
+	entry, ok := c.authn[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.identity, nil
+	}
+
+	identity, err := c.provider.Authenticate(ctx, user, credentials)
+	if err != nil {
+		return identity, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.authn) >= c.maxEntries() {
+		c.authn = pruneExpired(c.authn, c.maxEntries(), now, func(e cachedIdentity) time.Time { return e.expires })
+	}
+	c.authn[key] = cachedIdentity{identity: identity, expires: now.Add(c.TTL)}
+	return identity, nil
+}
+
+// Authorize implements server.AuthProvider.
+func (c *Cache) Authorize(identity server.Identity, action server.Action, mailbox string) error {
+	key := authzKey{username: identity.Username, action: action, mailbox: mailbox}
+	now := c.now()
+
+	c.mu.Lock()
+	entry, ok := c.authz[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.err
+	}
+
+	err := c.provider.Authorize(identity, action, mailbox)
+	if !definitive(err) {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.authz) >= c.maxEntries() {
+		c.authz = pruneExpired(c.authz, c.maxEntries(), now, func(e cachedDecision) time.Time { return e.expires })
+	}
+	c.authz[key] = cachedDecision{err: err, expires: now.Add(c.TTL)}
+	return err
+}
+
+// definitive reports whether err is a decision of an AuthProvider's
+// Authorize, to be cached: access allowed, or denied with NO [NOPERM].
+func definitive(err error) bool {
+	var imapErr *imap.IMAPError
+	return err == nil || errors.As(err, &imapErr) && imapErr.Code == imap.ResponseCodeNoPerm
+}
+
+// Purge removes all cached results, for example after a user's groups or
+// password changed.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.authn = make(map[[sha256.Size]byte]cachedIdentity)
+	c.authz = make(map[authzKey]cachedDecision)
+}
+
+func (c *Cache) maxEntries() int {
+	if c.MaxEntries > 0 {
+		return c.MaxEntries
+	}
+	return DefaultCacheSize
+}
+
+// credentialsKey hashes the credentials of an authentication, so that
+// the cache does not keep passwords and tokens in memory.
+func credentialsKey(user string, credentials server.Credentials) [sha256.Size]byte {
+	h := sha256.New()
+	for _, s := range []string{user, credentials.Mechanism, credentials.Password, credentials.Token} {
+		// Length-prefix the fields so that their boundaries are part of
+		// the hash.
+		n := len(s)
+		h.Write([]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+		h.Write([]byte(s))
+	}
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+	return key
+}
+
+// pruneExpired removes the expired entries of m, or all of them if m
+// would still have max entries, so that a cache full of live entries is
+// renewed rather than frozen.
+func pruneExpired[K comparable, V any](m map[K]V, max int, now time.Time, expires func(V) time.Time) map[K]V {
+	for k, v := range m {
+		if !now.Before(expires(v)) {
+			delete(m, k)
+		}
+	}
+	if len(m) >= max {
+		return make(map[K]V)
+	}
+	return m
+}
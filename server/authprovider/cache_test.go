@@ -0,0 +1,114 @@
+package authprovider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/server"
+)
+
+// countingProvider accepts the password "pw", denies mailbox "Secret" and
+// fails to authorize "Unreachable", counting the calls.
+type countingProvider struct {
+	authn, authz int
+}
+
+func (p *countingProvider) Authenticate(ctx context.Context, user string, credentials server.Credentials) (server.Identity, error) {
+	p.authn++
+	if credentials.Password != "pw" {
+		return server.Identity{}, errAuthFailed
+	}
+	return server.Identity{Username: user}, nil
+}
+
+func (p *countingProvider) Authorize(identity server.Identity, action server.Action, mailbox string) error {
+	p.authz++
+	switch mailbox {
+	case "Secret":
+		return imap.ErrNoWithCode(imap.ResponseCodeNoPerm, "denied")
+	case "Unreachable":
+		return errors.New("directory unavailable")
+	}
+	return nil
+}
+
+func TestCache(t *testing.T) {
+	p := &countingProvider{}
+	c := NewCache(p, time.Minute)
+	now := time.Unix(1700000000, 0)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Authenticate(ctx, "alice", server.Credentials{Password: "pw"}); err != nil {
+			t.Fatalf("Authenticate() error: %v", err)
+		}
+		if _, err := c.Authenticate(ctx, "alice", server.Credentials{Password: "bad"}); err == nil {
+			t.Fatal("Authenticate() with a wrong password succeeded")
+		}
+	}
+	// Failures are not cached
+	if p.authn != 4 {
+		t.Errorf("provider authenticated %d times, want 4", p.authn)
+	}
+
+	alice := server.Identity{Username: "alice"}
+	for i := 0; i < 3; i++ {
+		if err := c.Authorize(alice, server.ActionSelect, "INBOX"); err != nil {
+			t.Errorf("Authorize(INBOX) error: %v", err)
+		}
+		if err := c.Authorize(alice, server.ActionSelect, "Secret"); err == nil {
+			t.Error("Authorize(Secret) succeeded")
+		}
+	}
+	if p.authz != 2 {
+		t.Errorf("provider authorized %d times, want 2", p.authz)
+	}
+	// Errors other than NOPERM are not cached
+	for i := 0; i < 3; i++ {
+		if err := c.Authorize(alice, server.ActionSelect, "Unreachable"); err == nil {
+			t.Error("Authorize(Unreachable) succeeded")
+		}
+	}
+	if p.authz != 5 {
+		t.Errorf("provider authorized %d times, want 5", p.authz)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := c.Authenticate(ctx, "alice", server.Credentials{Password: "pw"}); err != nil {
+		t.Fatalf("Authenticate() error: %v", err)
+	}
+	_ = c.Authorize(alice, server.ActionSelect, "INBOX")
+	if p.authn != 5 || p.authz != 6 {
+		t.Errorf("after expiry, provider called %d/%d times, want 5/6", p.authn, p.authz)
+	}
+
+	c.Purge()
+	_ = c.Authorize(alice, server.ActionSelect, "INBOX")
+	if p.authz != 7 {
+		t.Errorf("after Purge(), provider authorized %d times, want 7", p.authz)
+	}
+}
+
+func TestCache_MaxEntries(t *testing.T) {
+	p := &countingProvider{}
+	c := NewCache(p, time.Minute)
+	c.MaxEntries = 2
+	for _, mailbox := range []string{"a", "b", "c"} {
+		_ = c.Authorize(server.Identity{}, server.ActionSelect, mailbox)
+	}
+	if len(c.authz) > 2 {
+		t.Errorf("cache has %d entries, want at most 2", len(c.authz))
+	}
+}
+
+func TestCredentialsKey(t *testing.T) {
+	a := credentialsKey("ab", server.Credentials{Password: "c"})
+	b := credentialsKey("a", server.Credentials{Password: "bc"})
+	if a == b {
+		t.Error("credentialsKey() ignores field boundaries")
+	}
+}
@@ -0,0 +1,172 @@
+package authprovider
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/meszmate/imap-go/server"
+)
+
+// Htpasswd authenticates passwords against an Apache htpasswd file, with
+// one "user:hash" line per user. The MD5 ("$apr1$" and "$1$") and SHA-1
+// ("{SHA}") hashes are supported; bcrypt hashes ("$2y$"), the default of
+// recent htpasswd versions, are checked with CompareBcrypt.
+type Htpasswd struct {
+	path string
+
+	// CompareBcrypt checks a password against a bcrypt hash, returning
+	// nil if it matches, such as bcrypt.CompareHashAndPassword of
+	// golang.org/x/crypto/bcrypt. If nil, users with bcrypt hashes cannot
+	// log in.
+	CompareBcrypt func(hash, password []byte) error
+
+	mu    sync.RWMutex
+	users map[string]string
+}
+
+var _ Authenticator = (*Htpasswd)(nil)
+
+// NewHtpasswd loads the htpasswd file at path.
+func NewHtpasswd(path string) (*Htpasswd, error) {
+	h := &Htpasswd{path: path}
+	if err := h.Reload(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Reload reads the file again, for example after it was edited. If it
+// cannot be read, the users loaded before are kept.
+func (h *Htpasswd) Reload() error {
+	f, err := os.Open(h.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return fmt.Errorf("authprovider: %s:%d: invalid htpasswd line", h.path, n)
+		}
+		users[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.users = users
+	h.mu.Unlock()
+	return nil
+}
+
+// Authenticate implements Authenticator. Only passwords are accepted.
+func (h *Htpasswd) Authenticate(ctx context.Context, user string, credentials server.Credentials) (server.Identity, error) {
+	h.mu.RLock()
+	hash, ok := h.users[user]
+	h.mu.RUnlock()
+	if !ok || credentials.Password == "" || !h.verify(hash, credentials.Password) {
+		return server.Identity{}, errAuthFailed
+	}
+	return server.Identity{Username: user}, nil
+}
+
+// verify reports whether password matches an htpasswd hash.
+func (h *Htpasswd) verify(hash, password string) bool {
+	var computed string
+	switch {
+	case strings.HasPrefix(hash, "$apr1$"):
+		computed = md5Crypt(password, hash, "$apr1$")
+	case strings.HasPrefix(hash, "$1$"):
+		computed = md5Crypt(password, hash, "$1$")
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		computed = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return h.CompareBcrypt != nil && h.CompareBcrypt([]byte(hash), []byte(password)) == nil
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1
+}
+
+// cryptAlphabet is the base64 alphabet of crypt(3).
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// md5Crypt returns the MD5-crypt hash of password with the salt of hash,
+// which starts with magic: "$1$" for crypt(3) or "$apr1$" for Apache.
+func md5Crypt(password, hash, magic string) string {
+	salt := strings.TrimPrefix(hash, magic)
+	salt, _, _ = strings.Cut(salt, "$")
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+
+	alt := md5.New()
+	alt.Write([]byte(password + salt + password))
+	altSum := alt.Sum(nil)
+
+	d := md5.New()
+	d.Write([]byte(password + magic + salt))
+	for i := len(password); i > 0; i -= 16 {
+		d.Write(altSum[:min(i, 16)])
+	}
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			d.Write([]byte{0})
+		} else {
+			d.Write([]byte(password[:1]))
+		}
+	}
+	sum := d.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		d := md5.New()
+		if i&1 == 1 {
+			d.Write([]byte(password))
+		} else {
+			d.Write(sum)
+		}
+		if i%3 != 0 {
+			d.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			d.Write([]byte(password))
+		}
+		if i&1 == 1 {
+			d.Write(sum)
+		} else {
+			d.Write([]byte(password))
+		}
+		sum = d.Sum(nil)
+	}
+
+	var b strings.Builder
+	b.WriteString(magic + salt + "$")
+	encode := func(v uint32, n int) {
+		for ; n > 0; n-- {
+			b.WriteByte(cryptAlphabet[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, i := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint32(sum[i[0]])<<16|uint32(sum[i[1]])<<8|uint32(sum[i[2]]), 4)
+	}
+	encode(uint32(sum[11]), 2)
+	return b.String()
+}
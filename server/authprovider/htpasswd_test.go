@@ -0,0 +1,72 @@
+package authprovider
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/meszmate/imap-go/server"
+)
+
+func TestHtpasswd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	// All hashes are of "secret"
+	content := `# users
+apr:$apr1$abcdefgh$h9FWgUz3n9YxylKLlR5SQ/
+md5:$1$abcdefgh$cHJi5PXp/ki/ktXzqlk6I1
+sha:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=
+bcrypt:$2y$05$fakebcrypthash
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHtpasswd(path)
+	if err != nil {
+		t.Fatalf("NewHtpasswd() error: %v", err)
+	}
+
+	ctx := context.Background()
+	tests := []struct {
+		user, password string
+		ok             bool
+	}{
+		{"apr", "secret", true},
+		{"apr", "Secret", false},
+		{"md5", "secret", true},
+		{"sha", "secret", true},
+		{"sha", "", false},
+		{"bcrypt", "secret", false},
+		{"nobody", "secret", false},
+	}
+	for _, tt := range tests {
+		_, err := h.Authenticate(ctx, tt.user, server.Credentials{Password: tt.password})
+		if (err == nil) != tt.ok {
+			t.Errorf("Authenticate(%q, %q) error = %v, want ok %v", tt.user, tt.password, err, tt.ok)
+		}
+	}
+
+	h.CompareBcrypt = func(hash, password []byte) error {
+		if string(password) != "secret" {
+			return errors.New("mismatch")
+		}
+		return nil
+	}
+	if _, err := h.Authenticate(ctx, "bcrypt", server.Credentials{Password: "secret"}); err != nil {
+		t.Errorf("Authenticate() with CompareBcrypt error: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("new:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Reload(); err != nil {
+		t.Fatalf("Reload() error: %v", err)
+	}
+	if _, err := h.Authenticate(ctx, "apr", server.Credentials{Password: "secret"}); err == nil {
+		t.Error("Authenticate() of a removed user succeeded")
+	}
+	if _, err := h.Authenticate(ctx, "new", server.Credentials{Password: "secret"}); err != nil {
+		t.Errorf("Authenticate() of an added user error: %v", err)
+	}
+}
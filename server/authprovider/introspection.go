@@ -0,0 +1,130 @@
+package authprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/meszmate/imap-go/server"
+)
+
+// Introspection authenticates OAuth 2.0 bearer tokens, as given with the
+// OAUTHBEARER and XOAUTH2 mechanisms, with the token introspection
+// endpoint of an authorization server such as an OpenID Connect provider
+// (RFC 7662). A token is accepted if it is active, was issued for the
+// user named by the client, if any, and has RequiredScope.
+type Introspection struct {
+	// Endpoint is the URL of the introspection endpoint.
+	Endpoint string
+	// ClientID and ClientSecret authenticate the server to the endpoint
+	// with HTTP Basic authentication.
+	ClientID, ClientSecret string
+	// Client is the HTTP client used. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	// UsernameClaim is the member of the introspection response holding
+	// the user name. If empty, "username" is used.
+	UsernameClaim string
+	// GroupsClaim, if set, is the member of the introspection response
+	// holding the groups of the user, as an array of strings.
+	GroupsClaim string
+	// RequiredScope, if set, is a scope the token must have, such as
+	// "email" or "https://mail.example.org/imap".
+	RequiredScope string
+}
+
+var _ Authenticator = (*Introspection)(nil)
+
+// Authenticate implements Authenticator. Only tokens are accepted. If the
+// client did not name a user, the user the token was issued to is logged
+// in.
+func (in *Introspection) Authenticate(ctx context.Context, user string, credentials server.Credentials) (server.Identity, error) {
+	if credentials.Token == "" {
+		return server.Identity{}, errAuthFailed
+	}
+	claims, err := in.introspect(ctx, credentials.Token)
+	if err != nil {
+		return server.Identity{}, errors.Join(errDirectoryUnavailable, err)
+	}
+	if active, _ := claims["active"].(bool); !active {
+		return server.Identity{}, errAuthFailed
+	}
+
+	claim := in.UsernameClaim
+	if claim == "" {
+		claim = "username"
+	}
+	username, _ := claims[claim].(string)
+	switch {
+	case username == "":
+		return server.Identity{}, errAuthFailed
+	case user != "" && user != username:
+		return server.Identity{}, errAuthFailed
+	}
+	scope, _ := claims["scope"].(string)
+	if in.RequiredScope != "" && !hasScope(scope, in.RequiredScope) {
+		return server.Identity{}, errAuthFailed
+	}
+
+	identity := server.Identity{Username: username}
+	if scope != "" {
+		identity.Attributes = map[string]string{"scope": scope}
+	}
+	if in.GroupsClaim != "" {
+		groups, _ := claims[in.GroupsClaim].([]interface{})
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				identity.Groups = append(identity.Groups, s)
+			}
+		}
+	}
+	return identity, nil
+}
+
+// introspect posts the token to the endpoint and returns the response.
+func (in *Introspection) introspect(ctx context.Context, token string) (map[string]interface{}, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, in.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if in.ClientID != "" {
+		// RFC 6749 section 2.3.1 form-encodes the credentials first.
+		req.SetBasicAuth(url.QueryEscape(in.ClientID), url.QueryEscape(in.ClientSecret))
+	}
+
+	client := in.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection: %s", resp.Status)
+	}
+	var claims map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("introspection: %w", err)
+	}
+	return claims, nil
+}
+
+// hasScope reports whether a space-separated list of scopes contains
+// scope.
+func hasScope(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
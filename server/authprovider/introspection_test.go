@@ -0,0 +1,77 @@
+package authprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/server"
+)
+
+func TestIntrospection(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); id != "imap" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		resp := map[string]interface{}{"active": false}
+		switch r.PostFormValue("token") {
+		case "good":
+			resp = map[string]interface{}{
+				"active":   true,
+				"username": "alice",
+				"scope":    "openid imap",
+				"groups":   []string{"staff"},
+			}
+		case "noscope":
+			resp = map[string]interface{}{"active": true, "username": "alice", "scope": "openid"}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	in := &Introspection{
+		Endpoint:      srv.URL,
+		ClientID:      "imap",
+		ClientSecret:  "s3cret",
+		GroupsClaim:   "groups",
+		RequiredScope: "imap",
+	}
+	ctx := context.Background()
+
+	for _, user := range []string{"alice", ""} {
+		identity, err := in.Authenticate(ctx, user, server.Credentials{Token: "good"})
+		if err != nil {
+			t.Fatalf("Authenticate(%q) error: %v", user, err)
+		}
+		if identity.Username != "alice" || len(identity.Groups) != 1 || identity.Attributes["scope"] != "openid imap" {
+			t.Errorf("Authenticate(%q) = %+v", user, identity)
+		}
+	}
+
+	tests := []struct {
+		user        string
+		credentials server.Credentials
+	}{
+		{"bob", server.Credentials{Token: "good"}},
+		{"alice", server.Credentials{Token: "expired"}},
+		{"alice", server.Credentials{Token: "noscope"}},
+		{"alice", server.Credentials{Password: "good"}},
+	}
+	for _, tt := range tests {
+		if _, err := in.Authenticate(ctx, tt.user, tt.credentials); !errors.Is(err, errAuthFailed) {
+			t.Errorf("Authenticate(%q, %+v) error = %v, want %v", tt.user, tt.credentials, err, errAuthFailed)
+		}
+	}
+
+	in.ClientSecret = "wrong"
+	_, err := in.Authenticate(ctx, "alice", server.Credentials{Token: "good"})
+	var imapErr *imap.IMAPError
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeUnavailable {
+		t.Errorf("Authenticate() with a rejected client error = %v, want UNAVAILABLE", err)
+	}
+}
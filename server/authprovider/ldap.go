@@ -0,0 +1,223 @@
+package authprovider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/server"
+)
+
+// DefaultLDAPTimeout is the time allowed for an LDAP bind when
+// LDAPBind.Timeout is 0.
+const DefaultLDAPTimeout = 10 * time.Second
+
+// LDAP result codes (RFC 4511 section 4.1.9).
+const (
+	ldapSuccess            = 0
+	ldapInvalidCredentials = 49
+)
+
+// errDirectoryUnavailable is returned when the directory cannot be
+// reached, so that clients retry later instead of asking for another
+// password.
+var errDirectoryUnavailable = imap.ErrNoWithCode(imap.ResponseCodeUnavailable, "authentication service unavailable")
+
+// LDAPBind authenticates passwords with a simple bind to an LDAP server
+// (RFC 4511) as the DN of the user, on a new connection for each
+// authentication. Only passwords are accepted; empty ones are refused,
+// since LDAP servers treat a bind without password as anonymous.
+type LDAPBind struct {
+	// Addr is the host and port of the LDAP server.
+	Addr string
+	// TLSConfig, if set, makes the connection use TLS from the start
+	// (LDAPS, usually port 636).
+	TLSConfig *tls.Config
+	// DNTemplate is the DN of a user, with %s standing for the user name,
+	// such as "uid=%s,ou=people,dc=example,dc=org". The user name is
+	// escaped as an attribute value (RFC 4514).
+	DNTemplate string
+	// Timeout is the time allowed for connecting and binding. If 0,
+	// DefaultLDAPTimeout is used.
+	Timeout time.Duration
+
+	// Groups, if set, returns the groups of an authenticated user, which
+	// are added to the identity for authorization.
+	Groups func(ctx context.Context, user string) ([]string, error)
+}
+
+var _ Authenticator = (*LDAPBind)(nil)
+
+// Authenticate implements Authenticator.
+func (l *LDAPBind) Authenticate(ctx context.Context, user string, credentials server.Credentials) (server.Identity, error) {
+	if user == "" || credentials.Password == "" {
+		return server.Identity{}, errAuthFailed
+	}
+	timeout := l.Timeout
+	if timeout <= 0 {
+		timeout = DefaultLDAPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dn := fmt.Sprintf(l.DNTemplate, escapeDN(user))
+	code, err := l.bind(ctx, dn, credentials.Password)
+	switch {
+	case err != nil:
+		return server.Identity{}, errors.Join(errDirectoryUnavailable, err)
+	case code == ldapInvalidCredentials:
+		return server.Identity{}, errAuthFailed
+	case code != ldapSuccess:
+		return server.Identity{}, errors.Join(errDirectoryUnavailable, fmt.Errorf("ldap: bind failed with result code %d", code))
+	}
+
+	identity := server.Identity{Username: user}
+	if l.Groups != nil {
+		if identity.Groups, err = l.Groups(ctx, user); err != nil {
+			return server.Identity{}, errors.Join(errDirectoryUnavailable, err)
+		}
+	}
+	return identity, nil
+}
+
+// bind connects to the server and binds as dn, returning the result code.
+func (l *LDAPBind) bind(ctx context.Context, dn, password string) (int, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", l.Addr)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if l.TLSConfig != nil {
+		tlsConn := tls.Client(conn, l.TLSConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return 0, err
+		}
+		conn = tlsConn
+	}
+
+	// BindRequest ::= [APPLICATION 0] SEQUENCE { version INTEGER,
+	// name LDAPDN, authentication [0] simple OCTET STRING }
+	bindRequest := berTLV(0x60, concat(
+		berTLV(0x02, []byte{3}),
+		berTLV(0x04, []byte(dn)),
+		berTLV(0x80, []byte(password)),
+	))
+	const messageID = 1
+	if _, err := conn.Write(berTLV(0x30, concat(berTLV(0x02, []byte{messageID}), bindRequest))); err != nil {
+		return 0, err
+	}
+
+	r := bufio.NewReader(conn)
+	tag, msg, err := readBER(r)
+	if err != nil {
+		return 0, err
+	}
+	if tag != 0x30 {
+		return 0, errors.New("ldap: invalid response")
+	}
+	msgR := bufio.NewReader(bytes.NewReader(msg))
+	if tag, _, err = readBER(msgR); err != nil || tag != 0x02 {
+		return 0, errors.New("ldap: invalid message ID")
+	}
+	// BindResponse ::= [APPLICATION 1] SEQUENCE { resultCode ENUMERATED, ... }
+	tag, resp, err := readBER(msgR)
+	if err != nil || tag != 0x61 {
+		return 0, errors.New("ldap: invalid bind response")
+	}
+	tag, code, err := readBER(bufio.NewReader(bytes.NewReader(resp)))
+	if err != nil || tag != 0x0a || len(code) == 0 {
+		return 0, errors.New("ldap: invalid result code")
+	}
+	var n int
+	for _, b := range code {
+		n = n<<8 | int(b)
+	}
+	return n, nil
+}
+
+// berTLV encodes a BER element with a definite length.
+func berTLV(tag byte, value []byte) []byte {
+	out := []byte{tag}
+	switch n := len(value); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xff:
+		out = append(out, 0x81, byte(n))
+	case n <= 0xffff:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	default:
+		out = append(out, 0x84, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(out, value...)
+}
+
+// readBER reads a BER element with a single-byte tag and a definite
+// length of at most 16 MiB.
+func readBER(r *bufio.Reader) (tag byte, value []byte, err error) {
+	if tag, err = r.ReadByte(); err != nil {
+		return 0, nil, err
+	}
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n := int(b)
+	if b&0x80 != 0 {
+		size := int(b & 0x7f)
+		if size == 0 || size > 3 {
+			return 0, nil, errors.New("ldap: unsupported BER length")
+		}
+		n = 0
+		for i := 0; i < size; i++ {
+			if b, err = r.ReadByte(); err != nil {
+				return 0, nil, err
+			}
+			n = n<<8 | int(b)
+		}
+	}
+	value = make([]byte, n)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return 0, nil, err
+	}
+	return tag, value, nil
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// escapeDN escapes an attribute value of a DN (RFC 4514 section 2.4).
+func escapeDN(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case strings.IndexByte(`,+"\<>;=`, ch) >= 0,
+			ch == ' ' && (i == 0 || i == len(s)-1),
+			ch == '#' && i == 0:
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case ch == 0:
+			b.WriteString(`\00`)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,121 @@
+package authprovider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/server"
+)
+
+// fakeLDAP accepts simple binds with password "secret" and returns the
+// address and a channel of the bound DNs.
+func fakeLDAP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	dns := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, msg, err := readBER(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				r := bufio.NewReader(bytes.NewReader(msg))
+				_, id, _ := readBER(r)
+				_, req, _ := readBER(r)
+				r = bufio.NewReader(bytes.NewReader(req))
+				readBER(r) // version
+				_, dn, _ := readBER(r)
+				_, password, _ := readBER(r)
+				dns <- string(dn)
+
+				code := byte(ldapSuccess)
+				if string(password) != "secret" {
+					code = ldapInvalidCredentials
+				}
+				resp := berTLV(0x61, concat(berTLV(0x0a, []byte{code}), berTLV(0x04, nil), berTLV(0x04, nil)))
+				conn.Write(berTLV(0x30, concat(berTLV(0x02, id), resp)))
+			}()
+		}
+	}()
+	return ln.Addr().String(), dns
+}
+
+func TestLDAPBind(t *testing.T) {
+	addr, dns := fakeLDAP(t)
+	l := &LDAPBind{
+		Addr:       addr,
+		DNTemplate: "uid=%s,ou=people,dc=example,dc=org",
+		Groups: func(ctx context.Context, user string) ([]string, error) {
+			return []string{"staff"}, nil
+		},
+	}
+	ctx := context.Background()
+
+	identity, err := l.Authenticate(ctx, "alice", server.Credentials{Password: "secret"})
+	if err != nil {
+		t.Fatalf("Authenticate() error: %v", err)
+	}
+	if identity.Username != "alice" || len(identity.Groups) != 1 {
+		t.Errorf("Authenticate() = %+v", identity)
+	}
+	if dn := <-dns; dn != "uid=alice,ou=people,dc=example,dc=org" {
+		t.Errorf("bound as %q", dn)
+	}
+
+	_, err = l.Authenticate(ctx, "a,b", server.Credentials{Password: "wrong"})
+	if !errors.Is(err, errAuthFailed) {
+		t.Errorf("Authenticate() with a wrong password error = %v, want %v", err, errAuthFailed)
+	}
+	if dn := <-dns; dn != `uid=a\,b,ou=people,dc=example,dc=org` {
+		t.Errorf("bound as %q", dn)
+	}
+
+	if _, err := l.Authenticate(ctx, "alice", server.Credentials{}); err == nil {
+		t.Error("Authenticate() without password succeeded")
+	}
+}
+
+func TestLDAPBind_Unavailable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	l := &LDAPBind{Addr: addr, DNTemplate: "uid=%s"}
+	_, err = l.Authenticate(context.Background(), "alice", server.Credentials{Password: "secret"})
+	var imapErr *imap.IMAPError
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeUnavailable {
+		t.Errorf("Authenticate() error = %v, want UNAVAILABLE", err)
+	}
+}
+
+func TestEscapeDN(t *testing.T) {
+	tests := map[string]string{
+		"alice":  "alice",
+		" a+b ":  `\ a\+b\ `,
+		"#x=y":   `\#x\=y`,
+		`q"<>;\`: `q\"\<\>\;\\`,
+	}
+	for in, want := range tests {
+		if got := escapeDN(in); got != want {
+			t.Errorf("escapeDN(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"errors"
+	"io"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// DefaultAutoCreateLimit is the number of mailboxes a connection may create
+// through APPEND when Options.AutoCreateLimit is 0.
+const DefaultAutoCreateLimit = 10
+
+// AppendMessage appends a message through the command's session, unless
+// the MailboxAccessPolicy denies access to the mailbox. If the session
+// rejects the APPEND with TRYCREATE and the mailbox matches one of the
+// server's AutoCreateOnAppend patterns, the mailbox is created and the
+// APPEND is retried. Messages are passed to the server's message filters
+// first, see WithMessageFilters, and options.SizeHint is set to the size
+// of the message stored.
+//
+// The mailbox is only created if the session has not consumed any of the
+// message data yet, if the name passes the mailbox name validator and if
+// the connection has not reached the auto-create limit. Otherwise the
+// original TRYCREATE error is returned, or NO [LIMIT] if the limit was
+// reached and ResponseCodePolicy.Limit is set.
+func (ctx *CommandContext) AppendMessage(mailbox string, r imap.LiteralReader, options *imap.AppendOptions) (*imap.AppendData, error) {
+	c := ctx.Conn
+	if err := c.CheckMailboxAccess(mailbox); err != nil {
+		return nil, err
+	}
+	r, err := c.filterLiteral(mailbox, r)
+	if err != nil {
+		return nil, err
+	}
+	if options != nil {
+		options.SizeHint = r.Size
+	}
+
+	counter := &countingReader{r: r.Reader}
+	r.Reader = counter
+
+	data, err := ctx.Session.Append(mailbox, r, options)
+	if err == nil || counter.n > 0 || !isTryCreate(err) {
+		return data, err
+	}
+	if ok, limited := c.mayAutoCreate(mailbox); !ok {
+		if limited && c.server.options.ResponseCodes.Limit {
+			return nil, imap.ErrNoWithCode(imap.ResponseCodeLimit, "too many mailboxes created on this connection")
+		}
+		return nil, err
+	}
+
+	name, verr := c.ValidateMailboxName(mailbox)
+	if verr != nil {
+		return nil, err
+	}
+	if cerr := ctx.Session.Create(name, nil); cerr != nil {
+		c.logger.Debug("auto-create on append failed", "mailbox", name, "error", cerr)
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.autoCreated++
+	c.mu.Unlock()
+	c.logger.Info("auto-created mailbox on append", "mailbox", name)
+
+	return ctx.Session.Append(name, r, options)
+}
+
+// mayAutoCreate reports whether APPEND may create mailbox on this
+// connection. limited is true if the mailbox matches a pattern but the
+// connection has reached the auto-create limit.
+func (c *Conn) mayAutoCreate(mailbox string) (ok, limited bool) {
+	opts := c.server.options
+	matched := false
+	for _, pattern := range opts.AutoCreateOnAppend {
+		if matchAutoCreatePattern(pattern, mailbox) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return false, false
+	}
+
+	limit := opts.AutoCreateLimit
+	if limit == 0 {
+		limit = DefaultAutoCreateLimit
+	}
+
+	c.mu.Lock()
+	reached := c.autoCreated >= limit
+	c.mu.Unlock()
+	return !reached, reached
+}
+
+// isTryCreate reports whether err is a NO response with a TRYCREATE code.
+func isTryCreate(err error) bool {
+	var imapErr *imap.IMAPError
+	return errors.As(err, &imapErr) &&
+		imapErr.Type == imap.StatusResponseTypeNO &&
+		imapErr.Code == imap.ResponseCodeTryCreate
+}
+
+// matchAutoCreatePattern matches name against pattern, where '*' matches
+// any sequence of characters, as does '%' since no hierarchy delimiter is
+// given. INBOX is matched case-insensitively. The name comes from the
+// client, so it is matched with imap.MatchListPattern, in linear time
+// whatever the number of wildcards.
+func matchAutoCreatePattern(pattern, name string) bool {
+	if imap.IsInbox(pattern) && imap.IsInbox(name) {
+		return true
+	}
+	return imap.MatchListPattern(pattern, name, 0)
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
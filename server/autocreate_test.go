@@ -0,0 +1,141 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// appendSession is a Session that only implements Append and Create.
+type appendSession struct {
+	Session
+	mailboxes map[string]bool
+	created   []string
+	consume   bool
+}
+
+func (s *appendSession) Create(mailbox string, options *imap.CreateOptions) error {
+	s.mailboxes[mailbox] = true
+	s.created = append(s.created, mailbox)
+	return nil
+}
+
+func (s *appendSession) Append(mailbox string, r imap.LiteralReader, options *imap.AppendOptions) (*imap.AppendData, error) {
+	if s.consume {
+		_, _ = io.ReadAll(r)
+	}
+	if !s.mailboxes[mailbox] {
+		return nil, imap.ErrNoWithCode(imap.ResponseCodeTryCreate, "no such mailbox")
+	}
+	_, _ = io.ReadAll(r)
+	return &imap.AppendData{UIDValidity: 1, UID: 1}, nil
+}
+
+func newAppendContext(t *testing.T, sess *appendSession, opts ...Option) *CommandContext {
+	t.Helper()
+	c1, c2 := net.Pipe()
+	t.Cleanup(func() {
+		_ = c1.Close()
+		_ = c2.Close()
+	})
+	srv := New(opts...)
+	conn := newConn(c1, srv)
+	conn.session = sess
+	return &CommandContext{Conn: conn, Session: sess, Server: srv}
+}
+
+func literal(s string) imap.LiteralReader {
+	return imap.LiteralReader{Reader: strings.NewReader(s), Size: int64(len(s))}
+}
+
+func TestAppendMessage_AutoCreate(t *testing.T) {
+	sess := &appendSession{mailboxes: map[string]bool{}}
+	ctx := newAppendContext(t, sess, WithAutoCreateOnAppend("Sent", "Archive/*"))
+
+	for _, name := range []string{"Sent", "Archive/2024"} {
+		if _, err := ctx.AppendMessage(name, literal("hello"), nil); err != nil {
+			t.Fatalf("AppendMessage(%q) error: %v", name, err)
+		}
+	}
+	if len(sess.created) != 2 {
+		t.Errorf("created = %v, want Sent and Archive/2024", sess.created)
+	}
+
+	_, err := ctx.AppendMessage("Junk", literal("hello"), nil)
+	if !isTryCreate(err) {
+		t.Errorf("AppendMessage(Junk) error = %v, want TRYCREATE", err)
+	}
+}
+
+func TestAppendMessage_Limit(t *testing.T) {
+	sess := &appendSession{mailboxes: map[string]bool{}}
+	ctx := newAppendContext(t, sess, WithAutoCreateOnAppend("*"), func(o *Options) {
+		o.AutoCreateLimit = 2
+	})
+
+	for _, name := range []string{"a", "b"} {
+		if _, err := ctx.AppendMessage(name, literal("x"), nil); err != nil {
+			t.Fatalf("AppendMessage(%q) error: %v", name, err)
+		}
+	}
+	if _, err := ctx.AppendMessage("c", literal("x"), nil); !isTryCreate(err) {
+		t.Errorf("AppendMessage(c) error = %v, want TRYCREATE after limit", err)
+	}
+
+	ctx.Server.options.ResponseCodes.Limit = true
+	_, err := ctx.AppendMessage("c", literal("x"), nil)
+	var imapErr *imap.IMAPError
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeLimit {
+		t.Errorf("AppendMessage(c) error = %v, want NO [LIMIT] with the Limit policy", err)
+	}
+}
+
+func TestAppendMessage_ConsumedLiteral(t *testing.T) {
+	sess := &appendSession{mailboxes: map[string]bool{}, consume: true}
+	ctx := newAppendContext(t, sess, WithAutoCreateOnAppend("Sent"))
+
+	if _, err := ctx.AppendMessage("Sent", literal("hello"), nil); !isTryCreate(err) {
+		t.Errorf("AppendMessage() error = %v, want TRYCREATE", err)
+	}
+	if len(sess.created) != 0 {
+		t.Errorf("created = %v, want none", sess.created)
+	}
+}
+
+func TestAppendMessage_Validator(t *testing.T) {
+	sess := &appendSession{mailboxes: map[string]bool{}}
+	policy := &MailboxNamePolicy{ForbiddenChars: "#"}
+	ctx := newAppendContext(t, sess, WithAutoCreateOnAppend("*"), WithMailboxNameValidator(policy.Validator()))
+
+	if _, err := ctx.AppendMessage("bad#name", literal("x"), nil); !isTryCreate(err) {
+		t.Errorf("AppendMessage() error = %v, want TRYCREATE", err)
+	}
+	if len(sess.created) != 0 {
+		t.Errorf("created = %v, want none", sess.created)
+	}
+}
+
+func TestMatchAutoCreatePattern(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"Sent", "Sent", true},
+		{"Sent", "sent", false},
+		{"INBOX", "inbox", true},
+		{"Archive/*", "Archive/2024/01", true},
+		{"Archive/*", "Archive", false},
+		{"*Drafts", "Work/Drafts", true},
+		{"*", "", true},
+		{"*a*a*a*a*a*a*a*a*b", strings.Repeat("a", 10000), false},
+	}
+	for _, tt := range tests {
+		if got := matchAutoCreatePattern(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchAutoCreatePattern(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"errors"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// Autologout timer defaults. RFC 9051 §5.4 requires the timer of an
+// authenticated connection to be at least 30 minutes, while a connection
+// that has not authenticated yet may be logged out sooner.
+const (
+	DefaultAutologoutPreAuth = 3 * time.Minute
+	MinAutologoutPostAuth    = 30 * time.Minute
+)
+
+// errAutologout is returned by readAndHandle when the connection has been
+// inactive for longer than the autologout timer.
+var errAutologout = errors.New("autologout")
+
+// WithAutologout sets the inactivity timers after which the server sends
+// "* BYE Autologout" and closes the connection: preAuth applies before
+// the client has authenticated, postAuth afterwards. A postAuth shorter
+// than MinAutologoutPostAuth is raised to it. Zero disables the timer.
+func WithAutologout(preAuth, postAuth time.Duration) Option {
+	return func(o *Options) {
+		if postAuth > 0 && postAuth < MinAutologoutPostAuth {
+			postAuth = MinAutologoutPostAuth
+		}
+		o.AutologoutPreAuth = preAuth
+		o.AutologoutPostAuth = postAuth
+	}
+}
+
+// autologoutTimeout returns how long the connection may wait for the next
+// command in its current state, or 0 for no limit.
+func (c *Conn) autologoutTimeout() time.Duration {
+	switch c.State() {
+	case imap.ConnStateNotAuthenticated:
+		return c.server.options.AutologoutPreAuth
+	case imap.ConnStateAuthenticated, imap.ConnStateSelected:
+		return c.server.options.AutologoutPostAuth
+	default:
+		return 0
+	}
+}
+
+// readLine reads the next command line. The autologout timer only runs
+// while waiting for a command: a command in progress, including IDLE and
+// literal uploads, counts as activity. Once the command has started, the
+// rest of the line has to arrive within Options.ReadTimeout, which also
+// applies to the reads of the command's handler.
+func (c *Conn) readLine() (string, error) {
+	c.SetReadTimeout(c.autologoutTimeout())
+	if _, err := c.decoder.PeekByte(); err != nil {
+		if isTimeout(err) {
+			c.writeFinalBYE("Autologout")
+			return "", errAutologout
+		}
+		return "", err
+	}
+
+	c.SetReadTimeout(c.server.options.ReadTimeout)
+	c.decoder.MaxLineLength = c.maxLineLength()
+	line, err := c.decoder.ReadLine()
+	if err != nil && isTimeout(err) {
+		c.writeFinalBYE("Timed out reading command")
+	}
+	return line, err
+}
+
+// writeFinalBYE writes BYE to a connection that is being closed, without
+// waiting for long if the client does not read it.
+func (c *Conn) writeFinalBYE(text string) {
+	c.mu.Lock()
+	netConn := c.netConn
+	c.mu.Unlock()
+	_ = netConn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	c.WriteBYE(text)
+}
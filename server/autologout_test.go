@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestWithAutologout(t *testing.T) {
+	srv := New(WithAutologout(time.Minute, time.Minute))
+	if srv.options.AutologoutPreAuth != time.Minute {
+		t.Errorf("AutologoutPreAuth = %v, want 1m", srv.options.AutologoutPreAuth)
+	}
+	if srv.options.AutologoutPostAuth != MinAutologoutPostAuth {
+		t.Errorf("AutologoutPostAuth = %v, want %v", srv.options.AutologoutPostAuth, MinAutologoutPostAuth)
+	}
+
+	srv = New(WithAutologout(0, 0))
+	if srv.options.AutologoutPreAuth != 0 || srv.options.AutologoutPostAuth != 0 {
+		t.Errorf("zero timers were not kept")
+	}
+}
+
+// serveAutologout serves a connection in the given state with short
+// autologout timers and returns the client side.
+func serveAutologout(t *testing.T, state imap.ConnState) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	srv := New()
+	srv.options.AutologoutPreAuth = 50 * time.Millisecond
+	srv.options.AutologoutPostAuth = 150 * time.Millisecond
+	srv.dispatcher.RegisterFunc("SLOW", func(ctx *CommandContext) error {
+		time.Sleep(300 * time.Millisecond)
+		ctx.Conn.WriteOK(ctx.Tag, "SLOW completed")
+		return nil
+	})
+
+	c1, c2 := net.Pipe()
+	t.Cleanup(func() { c2.Close() })
+	conn := newConn(c1, srv)
+	if state != imap.ConnStateNotAuthenticated {
+		if err := conn.SetState(state); err != nil {
+			t.Fatalf("SetState() error: %v", err)
+		}
+	}
+	go conn.serve()
+
+	r := bufio.NewReader(c2)
+	if _, err := r.ReadString('\n'); err != nil {
+		t.Fatalf("reading greeting: %v", err)
+	}
+	return c2, r
+}
+
+func TestConn_AutologoutPreAuth(t *testing.T) {
+	_, r := serveAutologout(t, imap.ConnStateNotAuthenticated)
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("ReadString() error: %v", err)
+	}
+	if line != "* BYE Autologout\r\n" {
+		t.Errorf("got %q, want BYE Autologout", line)
+	}
+	if _, err := r.ReadString('\n'); err == nil {
+		t.Error("connection still open after autologout")
+	}
+}
+
+func TestConn_AutologoutPostAuth(t *testing.T) {
+	c, r := serveAutologout(t, imap.ConnStateAuthenticated)
+
+	// The pre-auth timer no longer applies, and a command that takes longer
+	// than the timer, like IDLE, is not interrupted.
+	time.Sleep(100 * time.Millisecond)
+	if _, err := c.Write([]byte("a1 SLOW\r\n")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("ReadString() error: %v", err)
+	}
+	if line != "a1 OK SLOW completed\r\n" {
+		t.Fatalf("got %q, want the tagged OK", line)
+	}
+
+	start := time.Now()
+	line, err = r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("ReadString() error: %v", err)
+	}
+	if !strings.HasPrefix(line, "* BYE Autologout") {
+		t.Errorf("got %q, want BYE Autologout", line)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("autologout after %v, want the timer to restart after the command", elapsed)
+	}
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/wire"
+)
+
+// Defaults for CommandLimits.
+const (
+	DefaultMaxTagLength         = 64
+	DefaultMaxCommandLineLength = 64 * 1024
+	DefaultMaxCommandArguments  = 10000
+)
+
+// CommandLimits bounds the size of command lines, so that a client cannot
+// make the server buffer and parse absurdly long commands. Commands
+// exceeding a limit fail with BAD [LIMIT] before they are dispatched, and
+// are counted in Server.CommandLimitStats.
+type CommandLimits struct {
+	// MaxTagLength is the maximum length of a command tag. 0 means
+	// DefaultMaxTagLength; a negative value means no limit.
+	MaxTagLength int
+
+	// MaxLineLength is the maximum length of a line of a command, up to
+	// a literal or the end of the command, excluding CRLF. Longer lines
+	// are discarded as they are read, without being buffered. It also
+	// applies to the lines read by command handlers, such as AUTHENTICATE
+	// responses. 0 means DefaultMaxCommandLineLength; a negative value
+	// means no limit.
+	MaxLineLength int
+
+	// MaxArguments is the maximum number of arguments and list items in
+	// the first line of a command, up to its first literal. 0 means
+	// DefaultMaxCommandArguments; a negative value means no limit.
+	MaxArguments int
+}
+
+// WithCommandLimits sets limits on the length of command tags and lines
+// and on the number of command arguments.
+func WithCommandLimits(limits CommandLimits) Option {
+	return func(o *Options) {
+		o.CommandLimits = limits
+	}
+}
+
+// CommandLimitStats counts the commands rejected for exceeding
+// CommandLimits, by limit.
+type CommandLimitStats struct {
+	TagTooLong       int64
+	LineTooLong      int64
+	TooManyArguments int64
+}
+
+// commandLimitCounters are the counters of CommandLimitStats.
+type commandLimitCounters struct {
+	tagTooLong       atomic.Int64
+	lineTooLong      atomic.Int64
+	tooManyArguments atomic.Int64
+}
+
+// CommandLimitStats returns the number of commands rejected for exceeding
+// Options.CommandLimits since the server was created.
+func (srv *Server) CommandLimitStats() CommandLimitStats {
+	return CommandLimitStats{
+		TagTooLong:       srv.limits.tagTooLong.Load(),
+		LineTooLong:      srv.limits.lineTooLong.Load(),
+		TooManyArguments: srv.limits.tooManyArguments.Load(),
+	}
+}
+
+// maxLineLength returns the line length limit of the connection, 0 for no
+// limit.
+func (c *Conn) maxLineLength() int {
+	return limitOrDefault(c.server.options.CommandLimits.MaxLineLength, DefaultMaxCommandLineLength)
+}
+
+// checkCommandLimits writes BAD [LIMIT] and returns true if the tag or
+// arguments of a command exceed Options.CommandLimits. Non-synchronizing
+// literals sent with the command are discarded.
+func (c *Conn) checkCommandLimits(tag, rest string) (bool, error) {
+	limits := c.server.options.CommandLimits
+	maxTag := limitOrDefault(limits.MaxTagLength, DefaultMaxTagLength)
+	maxArgs := limitOrDefault(limits.MaxArguments, DefaultMaxCommandArguments)
+
+	var text string
+	switch {
+	case maxTag > 0 && len(tag) > maxTag:
+		c.server.limits.tagTooLong.Add(1)
+		tag, text = "*", "Tag too long"
+	case maxArgs > 0 && countArguments(rest) > maxArgs:
+		c.server.limits.tooManyArguments.Add(1)
+		text = "Too many arguments"
+	default:
+		return false, nil
+	}
+	c.logger.Info("command rejected", "reason", text)
+	err := c.discardLiterals(rest)
+	c.writeStatus(tag, imap.StatusResponseTypeBAD, imap.ResponseCodeLimit, text)
+	return true, err
+}
+
+// rejectLongLine writes BAD [LIMIT] for a command whose line was too long,
+// tagged if the tag could be read, and discards the non-synchronizing
+// literals sent with it.
+func (c *Conn) rejectLongLine(e *wire.LineTooLongError) error {
+	c.server.limits.lineTooLong.Add(1)
+	c.logger.Info("command rejected", "reason", "line too long")
+
+	tag := "*"
+	if t, _, ok := strings.Cut(e.Head, " "); ok && wire.ValidTag(t) {
+		maxTag := limitOrDefault(c.server.options.CommandLimits.MaxTagLength, DefaultMaxTagLength)
+		if maxTag <= 0 || len(t) <= maxTag {
+			tag = t
+		}
+	}
+	err := c.discardLiterals(e.Tail)
+	c.writeStatus(tag, imap.StatusResponseTypeBAD, imap.ResponseCodeLimit, "Command line too long")
+	return err
+}
+
+// countArguments returns the number of arguments and list items in a
+// command line: atoms, strings, literal headers and lists, each list
+// counting for itself and its items.
+func countArguments(line string) int {
+	n := 0
+	inToken := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ', ')', ']':
+			inToken = false
+		case '(':
+			n++
+			inToken = false
+		case '"':
+			n++
+			inToken = false
+			for i++; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' {
+					i++
+				}
+			}
+		default:
+			if !inToken {
+				n++
+				inToken = true
+			}
+		}
+	}
+	return n
+}
+
+// isLineTooLong returns the LineTooLongError of err, if any.
+func isLineTooLong(err error) (*wire.LineTooLongError, bool) {
+	var e *wire.LineTooLongError
+	ok := errors.As(err, &e)
+	return e, ok
+}
@@ -0,0 +1,22 @@
+package server
+
+import "testing"
+
+func TestCountArguments(t *testing.T) {
+	tests := []struct {
+		line string
+		want int
+	}{
+		{"", 0},
+		{"INBOX", 1},
+		{`"My Mailbox" (MESSAGES UNSEEN)`, 4},
+		{`1:* (FLAGS BODY.PEEK[HEADER.FIELDS (SUBJECT FROM)])`, 7},
+		{`"a \" (b c)" {5}`, 2},
+		{"()  ((a))", 4},
+	}
+	for _, tt := range tests {
+		if got := countArguments(tt.line); got != tt.want {
+			t.Errorf("countArguments(%q) = %d, want %d", tt.line, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package commands_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+func TestALPN(t *testing.T) {
+	// A port multiplexing HTTP/2 and IMAP.
+	config := testTLSConfig(t)
+	config.NextProtos = []string{"h2", server.ALPNProtocol}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatalf("Listen() error: %v", err)
+	}
+	srv := memserver.New().NewServer(server.WithALPN())
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	for _, tt := range []struct {
+		protocols []string
+		greeting  bool
+	}{
+		{[]string{server.ALPNProtocol}, true},
+		{nil, true},
+		{[]string{"h2"}, false},
+	} {
+		conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: tt.protocols})
+		if err != nil {
+			t.Fatalf("%v: Dial() error: %v", tt.protocols, err)
+		}
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		_ = conn.Close()
+		if tt.greeting && !strings.HasPrefix(line, "* OK") {
+			t.Errorf("%v: greeting = %q, %v", tt.protocols, line, err)
+		}
+		if !tt.greeting && err != io.EOF {
+			t.Errorf("%v: read %q, %v; want EOF", tt.protocols, line, err)
+		}
+	}
+}
+
+func TestALPN_ServeTLS(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error: %v", err)
+	}
+	srv := memserver.New().NewServer(server.WithALPN())
+	go func() { _ = srv.ServeTLS(l, testTLSConfig(t)) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{server.ALPNProtocol}})
+	if err != nil {
+		t.Fatalf("Dial() error: %v", err)
+	}
+	defer conn.Close()
+	if got := conn.ConnectionState().NegotiatedProtocol; got != server.ALPNProtocol {
+		t.Errorf("NegotiatedProtocol = %q, want %q", got, server.ALPNProtocol)
+	}
+	if line, err := bufio.NewReader(conn).ReadString('\n'); !strings.HasPrefix(line, "* OK") {
+		t.Errorf("greeting = %q, %v", line, err)
+	}
+}
@@ -25,11 +25,13 @@ func Append() server.CommandHandlerFunc {
 			return imap.ErrBad("missing arguments")
 		}
 
-		mailbox, err := ctx.Decoder.ReadAString()
+		mailbox, err := ctx.Decoder.ReadMailbox()
 		if err != nil {
 			return imap.ErrBad("invalid mailbox name")
 		}
 
+		mailbox = imap.CanonicalMailboxName(mailbox)
+
 		options := &imap.AppendOptions{}
 
 		if err := ctx.Decoder.ReadSP(); err != nil {
@@ -98,7 +100,7 @@ func Append() server.CommandHandlerFunc {
 		// Since the arg decoder is built from the line remainder (after CRLF
 		// stripping), we parse the literal header here and then read the
 		// actual data from the connection's main decoder.
-		litSize, isBinary, err := readLiteralSize(ctx.Decoder)
+		litSize, isBinary, nonSync, err := readLiteralSize(ctx.Decoder)
 		if err != nil {
 			return imap.ErrBad(fmt.Sprintf("invalid literal: %v", err))
 		}
@@ -107,30 +109,44 @@ func Append() server.CommandHandlerFunc {
 			options.Binary = true
 		}
 
-		// Read the literal body from the connection's main decoder
-		connDec := ctx.Conn.Decoder()
+		// Refuse messages over the limit before the client sends them. A
+		// non-synchronizing literal is already on its way and is
+		// discarded.
+		if limit := ctx.Server.Options().MaxLiteralSize; limit > 0 && litSize > limit {
+			if nonSync {
+				_, _ = io.Copy(io.Discard, ctx.Conn.ReadLiteral(ctx.Name, litSize))
+				_, _ = ctx.Conn.Decoder().ReadLine()
+			}
+			return imap.ErrNoWithCode(imap.ResponseCodeTooBig, "message too big")
+		}
+
+		// The client waits for a continuation request before sending a
+		// synchronizing literal.
+		if !nonSync {
+			ctx.Conn.WriteContinuation("Ready for literal data")
+		}
+
+		// Read the literal body from the connection
 		literalReader := imap.LiteralReader{
-			Reader: connDec.ReadLiteral(litSize),
+			Reader: ctx.Conn.ReadLiteral(ctx.Name, litSize),
 			Size:   litSize,
 		}
 
-		data, err := ctx.Session.Append(mailbox, literalReader, options)
+		data, err := ctx.AppendMessage(mailbox, literalReader, options)
+
+		// Drain any remaining literal data and the end of the command line
+		_, _ = io.Copy(io.Discard, literalReader.Reader)
+		if _, lineErr := ctx.Conn.Decoder().ReadLine(); lineErr != nil && err == nil {
+			err = lineErr
+		}
 		if err != nil {
-			// Drain any remaining literal data
-			_, _ = io.Copy(io.Discard, literalReader.Reader)
 			return err
 		}
 
-		// Drain any remaining literal data
-		_, _ = io.Copy(io.Discard, literalReader.Reader)
-
 		// Write tagged OK, optionally with APPENDUID response code
 		if data != nil && data.UIDValidity > 0 && data.UID > 0 {
-			enc := ctx.Conn.Encoder()
-			enc.Encode(func(e *wire.Encoder) {
-				code := fmt.Sprintf("APPENDUID %d %d", data.UIDValidity, uint32(data.UID))
-				e.StatusResponse(ctx.Tag, "OK", code, "APPEND completed")
-			})
+			ctx.Conn.WriteOKCode(ctx.Tag, imap.ResponseCodeAppendUID, "APPEND completed",
+				data.UIDValidity, data.UID)
 		} else {
 			ctx.Conn.WriteOK(ctx.Tag, "APPEND completed")
 		}
@@ -142,8 +158,9 @@ func Append() server.CommandHandlerFunc {
 // readLiteralSize reads a literal size specification like {42}, {42+}, or ~{42}
 // from the decoder, without expecting a trailing CRLF (since the arg
 // decoder is built from an already-parsed line).
-// Returns the size, whether it's a binary literal (~{N}), and any error.
-func readLiteralSize(dec *wire.Decoder) (int64, bool, error) {
+// Returns the size, whether it's a binary literal (~{N}), whether it's a
+// non-synchronizing literal ({N+}), and any error.
+func readLiteralSize(dec *wire.Decoder) (size int64, binary, nonSync bool, err error) {
 	// Read remaining content as a string to parse the literal spec
 	var sb strings.Builder
 	for {
@@ -159,7 +176,6 @@ func readLiteralSize(dec *wire.Decoder) (int64, bool, error) {
 
 	s := strings.TrimSpace(sb.String())
 
-	binary := false
 	if strings.HasPrefix(s, "~") {
 		binary = true
 		s = s[1:]
@@ -167,16 +183,19 @@ func readLiteralSize(dec *wire.Decoder) (int64, bool, error) {
 
 	// Expect format: {number} or {number+}
 	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
-		return 0, false, fmt.Errorf("expected literal, got %q", s)
+		return 0, false, false, fmt.Errorf("expected literal, got %q", s)
 	}
 
 	inner := s[1 : len(s)-1]
-	inner = strings.TrimSuffix(inner, "+") // Handle non-synchronizing literal
+	if strings.HasSuffix(inner, "+") {
+		nonSync = true
+		inner = inner[:len(inner)-1]
+	}
 
-	size, err := strconv.ParseInt(inner, 10, 64)
+	size, err = strconv.ParseInt(inner, 10, 64)
 	if err != nil {
-		return 0, false, fmt.Errorf("invalid literal size %q: %w", inner, err)
+		return 0, false, false, fmt.Errorf("invalid literal size %q: %w", inner, err)
 	}
 
-	return size, binary, nil
+	return size, binary, nonSync, nil
 }
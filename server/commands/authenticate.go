@@ -0,0 +1,228 @@
+package commands
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/auth"
+	"github.com/meszmate/imap-go/server"
+
+	// Register the built-in server mechanisms. AUTHENTICATE only offers
+	// those advertised as AUTH= capabilities.
+	_ "github.com/meszmate/imap-go/auth/anonymous"
+	_ "github.com/meszmate/imap-go/auth/crammd5"
+	_ "github.com/meszmate/imap-go/auth/external"
+	_ "github.com/meszmate/imap-go/auth/login"
+	_ "github.com/meszmate/imap-go/auth/oauthbearer"
+	_ "github.com/meszmate/imap-go/auth/plain"
+	"github.com/meszmate/imap-go/auth/scram"
+	_ "github.com/meszmate/imap-go/auth/xoauth2"
+)
+
+// Authenticate returns a handler for the AUTHENTICATE command.
+// AUTHENTICATE runs a SASL exchange with one of the mechanisms advertised
+// as AUTH= capabilities, taken from auth.DefaultRegistry. An initial
+// response given with the command (SASL-IR, RFC 4959) is accepted.
+// Credentials are checked with server.SessionAuthenticate, or with
+// Session.Login for PLAIN and LOGIN; SCRAM mechanisms use
+// server.SessionSCRAM. Over TLS, mechanisms that support channel binding
+// are given the bindings of the connection.
+func Authenticate() server.CommandHandlerFunc {
+	return func(ctx *server.CommandContext) error {
+		if !ctx.Conn.IsTLS() && !ctx.Server.Options().AllowInsecureAuth {
+			return imap.ErrNo("AUTHENTICATE disabled without TLS")
+		}
+
+		if ctx.Decoder == nil {
+			return imap.ErrBad("missing authentication mechanism")
+		}
+
+		name, err := ctx.Decoder.ReadAtom()
+		if err != nil {
+			return imap.ErrBad("invalid authentication mechanism")
+		}
+		name = strings.ToUpper(name)
+
+		var response []byte
+		if _, err := ctx.Decoder.PeekByte(); err == nil {
+			if err := ctx.Decoder.ReadSP(); err != nil {
+				return imap.ErrBad("invalid initial response")
+			}
+			ir, err := ctx.Decoder.ReadAtom()
+			if err != nil {
+				return imap.ErrBad("invalid initial response")
+			}
+			if response, err = decodeSASL(ir); err != nil {
+				return err
+			}
+		}
+
+		if !mechanismAdvertised(ctx, name) {
+			return imap.ErrNo("unsupported authentication mechanism")
+		}
+		authenticator := &sessionAuthenticator{conn: ctx.Conn, sess: ctx.Session}
+		mech, err := auth.DefaultRegistry.NewServerMechanism(name, authenticator)
+		if err != nil {
+			return imap.ErrNo("unsupported authentication mechanism")
+		}
+
+		if cb, ok := mech.(auth.ChannelBinder); ok {
+			state, isTLS := ctx.Conn.TLSConnectionState()
+			if isTLS && (strings.HasSuffix(name, "-PLUS") || mechanismAdvertised(ctx, name+"-PLUS")) {
+				cb.SetChannelBindings(auth.TLSChannelBindings(state))
+			}
+		}
+
+		// Mechanisms started by the client need its initial response; ask
+		// for it with an empty challenge if it was not given.
+		if sf, ok := mech.(auth.ServerFirstMechanism); response == nil && (!ok || !sf.ServerFirst()) {
+			if response, err = readSASLResponse(ctx, nil); err != nil {
+				return err
+			}
+		}
+
+		for {
+			challenge, done, err := mech.Next(response)
+			if err != nil {
+				return authError(err)
+			}
+			if done {
+				break
+			}
+			if response, err = readSASLResponse(ctx, challenge); err != nil {
+				return err
+			}
+		}
+
+		return completeAuth(ctx, authenticator.identity, "AUTHENTICATE completed")
+	}
+}
+
+// mechanismAdvertised reports whether the server advertises the SASL
+// mechanism on the connection.
+func mechanismAdvertised(ctx *server.CommandContext, name string) bool {
+	for _, c := range ctx.Conn.Capabilities() {
+		if strings.EqualFold(string(c), "AUTH="+name) {
+			return true
+		}
+	}
+	return false
+}
+
+// readSASLResponse sends a challenge and reads the client's response. The
+// client cancels the exchange by answering "*".
+func readSASLResponse(ctx *server.CommandContext, challenge []byte) ([]byte, error) {
+	ctx.Conn.WriteContinuation(base64.StdEncoding.EncodeToString(challenge))
+	line, err := ctx.Conn.Decoder().ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	if line == "*" {
+		return nil, imap.ErrBad("AUTHENTICATE cancelled")
+	}
+	return decodeSASL(line)
+}
+
+// decodeSASL decodes a base64 SASL response. "=" is an empty initial
+// response (RFC 4959).
+func decodeSASL(s string) ([]byte, error) {
+	if s == "=" {
+		return []byte{}, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, imap.ErrBad("invalid base64 response")
+	}
+	return b, nil
+}
+
+// sessionAuthenticator checks SASL credentials with the server's
+// AuthProvider or the session and records the identity that was
+// authenticated.
+type sessionAuthenticator struct {
+	conn     *server.Conn
+	sess     server.Session
+	identity string
+}
+
+func (a *sessionAuthenticator) Authenticate(ctx context.Context, mechanism, identity string, credentials []byte) error {
+	if creds, ok := providerCredentials(mechanism, credentials); ok {
+		handled, username, err := a.conn.AuthenticateWithProvider(ctx, identity, creds)
+		if handled {
+			if err == nil {
+				a.identity = username
+			}
+			return err
+		}
+	}
+
+	var err error
+	ss, isSCRAM := a.sess.(server.SessionSCRAM)
+	isSCRAM = isSCRAM && strings.HasPrefix(strings.ToUpper(mechanism), "SCRAM-")
+	if isSCRAM {
+		// The mechanism verified the client's proof.
+		err = ss.SCRAMAuthenticated(identity)
+	} else if sa, ok := a.sess.(server.SessionAuthenticate); ok {
+		err = sa.Authenticate(mechanism, identity, credentials)
+	} else {
+		switch strings.ToUpper(mechanism) {
+		case "PLAIN", "LOGIN":
+			err = a.sess.Login(identity, string(credentials))
+		default:
+			err = imap.ErrNo("unsupported authentication mechanism")
+		}
+	}
+	if err == nil {
+		a.identity = identity
+	}
+	return err
+}
+
+// providerCredentials returns the credentials of the SASL mechanisms that
+// an AuthProvider checks.
+func providerCredentials(mechanism string, credentials []byte) (server.Credentials, bool) {
+	mechanism = strings.ToUpper(mechanism)
+	switch mechanism {
+	case "PLAIN", "LOGIN":
+		return server.Credentials{Mechanism: mechanism, Password: string(credentials)}, true
+	case "OAUTHBEARER", "XOAUTH2":
+		return server.Credentials{Mechanism: mechanism, Token: string(credentials)}, true
+	}
+	return server.Credentials{}, false
+}
+
+// SCRAMCredentials implements scram.CredentialLookup with the session.
+func (a *sessionAuthenticator) SCRAMCredentials(mechanism, username string) (*scram.Credentials, error) {
+	ss, ok := a.sess.(server.SessionSCRAM)
+	if !ok {
+		return nil, imap.ErrNo("unsupported authentication mechanism")
+	}
+	return ss.SCRAMCredentials(mechanism, username)
+}
+
+// authError returns the error reported for failed authentication. Errors
+// from the backend that are not IMAP errors are reported as
+// AUTHENTICATIONFAILED (RFC 5530) without their text.
+func authError(err error) error {
+	var imapErr *imap.IMAPError
+	if errors.As(err, &imapErr) {
+		return err
+	}
+	return imap.ErrNoWithCode(imap.ResponseCodeAuthenticationFailed, "authentication failed")
+}
+
+// completeAuth moves the connection to the authenticated state as
+// username and writes the tagged OK with the capabilities advertised after
+// authentication, which differ from those advertised before (RFC 9051
+// §6.2.2).
+func completeAuth(ctx *server.CommandContext, username, text string) error {
+	if err := ctx.Conn.SetState(imap.ConnStateAuthenticated); err != nil {
+		return err
+	}
+	ctx.Conn.SetUsername(username)
+	ctx.Conn.WriteOKCapabilities(ctx.Tag, text)
+	return nil
+}
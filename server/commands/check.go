@@ -0,0 +1,25 @@
+package commands
+
+import (
+	"github.com/meszmate/imap-go/server"
+)
+
+// Check returns a handler for the CHECK command (RFC 3501).
+// CHECK requests a checkpoint of the selected mailbox from sessions that
+// implement server.SessionCheck, then behaves like NOOP.
+func Check() server.CommandHandlerFunc {
+	return func(ctx *server.CommandContext) error {
+		if sess, ok := ctx.Session.(server.SessionCheck); ok {
+			if err := sess.Check(); err != nil {
+				return err
+			}
+		}
+
+		if err := ctx.PollUpdates(); err != nil {
+			return err
+		}
+
+		ctx.Conn.WriteOK(ctx.Tag, "CHECK completed")
+		return nil
+	}
+}
@@ -16,9 +16,20 @@ func Close() server.CommandHandlerFunc {
 		// tell the backend to expunge. The backend handles this via Expunge.
 		// Per RFC 3501, CLOSE does not send untagged EXPUNGE responses.
 		// We pass a no-op writer or just call expunge and ignore responses.
-		_ = ctx.Session.Expunge(w, nil)
-
-		if err := ctx.Session.Unselect(); err != nil {
+		// A mailbox opened with EXAMINE is not expunged.
+		// Sessions implementing server.SessionTransaction expunge and close
+		// the mailbox in one transaction, which a failed expunge rolls
+		// back; otherwise expunge errors are ignored.
+		_, transactional := ctx.Session.(server.SessionTransaction)
+		err := ctx.InTransaction(func() error {
+			if !ctx.Conn.IsReadOnly() {
+				if err := ctx.Session.Expunge(w, nil); err != nil && transactional {
+					return err
+				}
+			}
+			return ctx.Session.Unselect()
+		})
+		if err != nil {
 			return err
 		}
 
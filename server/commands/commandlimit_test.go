@@ -0,0 +1,54 @@
+package commands_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+func TestCommandLimits(t *testing.T) {
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	srv := mem.NewServer(server.WithCommandLimits(server.CommandLimits{
+		MaxTagLength:  8,
+		MaxLineLength: 100,
+		MaxArguments:  4,
+	}))
+	c := dialServer(t, srv)
+	long := strings.Repeat("x", 200)
+
+	if _, tagged := c.run("A1 NOOP " + long); tagged != "A1 BAD [LIMIT] Command line too long" {
+		t.Errorf("long line = %q", tagged)
+	}
+	if _, tagged := c.run("A2 NOOP"); tagged != "A2 OK NOOP completed" {
+		t.Errorf("NOOP after a long line = %q", tagged)
+	}
+
+	// The non-synchronizing literal of a rejected line is skipped.
+	c.send("A3 APPEND INBOX " + long + " {5+}")
+	c.send("hello")
+	if line := c.readLine(); line != "A3 BAD [LIMIT] Command line too long" {
+		t.Errorf("long line with a literal = %q", line)
+	}
+
+	c.send("TOOLONGTAG NOOP")
+	if line := c.readLine(); line != "* BAD [LIMIT] Tag too long" {
+		t.Errorf("long tag = %q", line)
+	}
+	if _, tagged := c.run("A4 LOGIN alice secret"); !strings.HasPrefix(tagged, "A4 OK") {
+		t.Fatalf("LOGIN = %q", tagged)
+	}
+	if _, tagged := c.run("A5 STATUS INBOX (MESSAGES UIDNEXT UNSEEN)"); tagged != "A5 BAD [LIMIT] Too many arguments" {
+		t.Errorf("too many arguments = %q", tagged)
+	}
+	if _, tagged := c.run("A6 STATUS INBOX (MESSAGES)"); !strings.HasPrefix(tagged, "A6 OK") {
+		t.Errorf("STATUS within limits = %q", tagged)
+	}
+
+	want := server.CommandLimitStats{TagTooLong: 1, LineTooLong: 2, TooManyArguments: 1}
+	if got := srv.CommandLimitStats(); got != want {
+		t.Errorf("CommandLimitStats() = %+v, want %+v", got, want)
+	}
+}
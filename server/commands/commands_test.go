@@ -0,0 +1,534 @@
+package commands_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/extensions/replace"
+	"github.com/meszmate/imap-go/imaptest"
+	"github.com/meszmate/imap-go/server"
+	_ "github.com/meszmate/imap-go/server/commands"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+// testConn is a raw client connection to a memserver with the user alice
+// and two messages in INBOX.
+type testConn struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialTest(t *testing.T, opts ...server.Option) *testConn {
+	t.Helper()
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	for _, msg := range []string{"Subject: one\r\n\r\nfirst", "Subject: two\r\n\r\nsecond"} {
+		if err := mem.Deliver("alice", "INBOX", strings.NewReader(msg)); err != nil {
+			t.Fatalf("Deliver() error: %v", err)
+		}
+	}
+	return dialMem(t, mem, opts...)
+}
+
+// dialMem connects to a server for mem.
+func dialMem(t *testing.T, mem *memserver.MemServer, opts ...server.Option) *testConn {
+	t.Helper()
+	return dialServer(t, mem.NewServer(opts...))
+}
+
+// dialServer connects to srv.
+func dialServer(t *testing.T, srv *server.Server) *testConn {
+	t.Helper()
+	return dialAddr(t, imaptest.NewHarness(t, srv).Addr())
+}
+
+// dialAddr connects to the server at addr.
+func dialAddr(t *testing.T, addr string) *testConn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial() error: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	c := &testConn{t: t, conn: conn, r: bufio.NewReader(conn)}
+	c.readLine() // greeting
+	return c
+}
+
+func (c *testConn) send(line string) {
+	c.t.Helper()
+	if _, err := c.conn.Write([]byte(line + "\r\n")); err != nil {
+		c.t.Fatalf("write: %v", err)
+	}
+}
+
+func (c *testConn) readLine() string {
+	c.t.Helper()
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("read: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+// run sends a command and returns its untagged responses and the tagged
+// response.
+func (c *testConn) run(command string) (untagged []string, tagged string) {
+	c.t.Helper()
+	tag, _, _ := strings.Cut(command, " ")
+	c.send(command)
+	for {
+		line := c.readLine()
+		if strings.HasPrefix(line, tag+" ") {
+			return untagged, line
+		}
+		untagged = append(untagged, line)
+	}
+}
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func withAuthPlain() server.Option {
+	return server.WithCapabilities(imap.CapAuthPlain, imap.CapAuthLogin, imap.CapSASLIR)
+}
+
+func TestAuthenticate_InitialResponse(t *testing.T) {
+	c := dialTest(t, withAuthPlain())
+	_, tagged := c.run("A1 AUTHENTICATE PLAIN " + b64("\x00alice\x00secret"))
+	if !strings.HasPrefix(tagged, "A1 OK [CAPABILITY ") || !strings.HasSuffix(tagged, "] AUTHENTICATE completed") {
+		t.Fatalf("tagged = %q", tagged)
+	}
+	if strings.Contains(tagged, "AUTH=") {
+		t.Errorf("AUTH= capabilities advertised after authentication: %q", tagged)
+	}
+	if _, tagged := c.run("A2 SELECT INBOX"); !strings.HasPrefix(tagged, "A2 OK") {
+		t.Errorf("SELECT after AUTHENTICATE = %q", tagged)
+	}
+}
+
+func TestAuthenticate_Exchange(t *testing.T) {
+	c := dialTest(t, withAuthPlain())
+
+	// PLAIN without an initial response starts with an empty challenge.
+	c.send("A1 AUTHENTICATE PLAIN")
+	if got := c.readLine(); got != "+ " {
+		t.Fatalf("challenge = %q, want %q", got, "+ ")
+	}
+	c.send(b64("\x00alice\x00wrong"))
+	if got := c.readLine(); got != "A1 NO [AUTHENTICATIONFAILED] authentication failed" {
+		t.Errorf("tagged = %q", got)
+	}
+
+	// LOGIN is started by the server.
+	c.send("A2 AUTHENTICATE login")
+	if got := c.readLine(); got != "+ "+b64("Username:") {
+		t.Fatalf("challenge = %q", got)
+	}
+	c.send(b64("alice"))
+	if got := c.readLine(); got != "+ "+b64("Password:") {
+		t.Fatalf("challenge = %q", got)
+	}
+	c.send(b64("secret"))
+	if got := c.readLine(); !strings.HasPrefix(got, "A2 OK [CAPABILITY ") {
+		t.Errorf("tagged = %q", got)
+	}
+}
+
+func TestAuthenticate_Rejected(t *testing.T) {
+	c := dialTest(t, withAuthPlain())
+
+	c.send("A1 AUTHENTICATE PLAIN")
+	c.readLine()
+	c.send("*")
+	if got := c.readLine(); got != "A1 BAD AUTHENTICATE cancelled" {
+		t.Errorf("cancel = %q", got)
+	}
+
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"A2 AUTHENTICATE CRAM-MD5", "A2 NO unsupported authentication mechanism"},
+		{"A3 AUTHENTICATE PLAIN !!!", "A3 BAD invalid base64 response"},
+		{"A4 AUTHENTICATE", "A4 BAD missing authentication mechanism"},
+	}
+	for _, tt := range tests {
+		if _, got := c.run(tt.command); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestBaseCommands(t *testing.T) {
+	c := dialTest(t)
+
+	untagged, tagged := c.run("A0 CAPABILITY")
+	if tagged != "A0 OK CAPABILITY completed" || len(untagged) != 1 || !strings.HasPrefix(untagged[0], "* CAPABILITY IMAP4rev1") {
+		t.Fatalf("CAPABILITY = %q %q", untagged, tagged)
+	}
+	if _, tagged := c.run("A1 LOGIN alice secret"); !strings.HasPrefix(tagged, "A1 OK [CAPABILITY IMAP4rev1") {
+		t.Fatalf("LOGIN = %q", tagged)
+	}
+
+	tests := []struct {
+		command  string
+		want     string
+		untagged string // a prefix of one of the untagged responses, if set
+	}{
+		{"B1 LIST \"\" *", "B1 OK LIST completed", `* LIST`},
+		{"B2 LSUB \"\" %", "B2 OK LSUB completed", ""},
+		{"B3 STATUS INBOX (MESSAGES UNSEEN)", "B3 OK STATUS completed", "* STATUS INBOX (MESSAGES 2 UNSEEN 2)"},
+		{"B4 CHECK", "B4 BAD", ""},
+		{"B5 SELECT INBOX", "B5 OK", "* 2 EXISTS"},
+		{"B6 CHECK", "B6 OK CHECK completed", ""},
+		{"B7 NOOP now", "B7 BAD NOOP takes no arguments", ""},
+		{"B8 UID LOGIN alice secret", "B8 BAD UID LOGIN is not a valid command", ""},
+		{"B9 STORE 1 +FLAGS \\Seen \\Flagged", "B9 OK STORE completed", "* 1 FETCH"},
+		{"C1 UID STORE 1:* -FLAGS.SILENT (\\Flagged)", "C1 OK STORE completed", ""},
+		{"C2 UID FETCH 1:* (FLAGS)", "C2 OK FETCH completed", "* 2 FETCH"},
+		{"C3 SEARCH UNSEEN", "C3 OK SEARCH completed", "* SEARCH 2"},
+		{"C4 COPY 1:* INBOX", "C4 OK", ""},
+		{"C5 UID EXPUNGE", "C5 BAD missing UID set", ""},
+		{"C6 EXPUNGE", "C6 OK EXPUNGE completed", ""},
+		{"C7 CLOSE", "C7 OK CLOSE completed", ""},
+	}
+	for _, tt := range tests {
+		untagged, tagged := c.run(tt.command)
+		if !strings.HasPrefix(tagged, tt.want) {
+			t.Errorf("%s = %q, want %q", tt.command, tagged, tt.want)
+		}
+		if tt.untagged == "" {
+			continue
+		}
+		found := false
+		for _, line := range untagged {
+			found = found || strings.HasPrefix(line, tt.untagged)
+		}
+		if !found {
+			t.Errorf("%s: no untagged %q in %q", tt.command, tt.untagged, untagged)
+		}
+	}
+}
+
+func TestAppend_SynchronizingLiteral(t *testing.T) {
+	c := dialTest(t)
+	c.run("A1 LOGIN alice secret")
+
+	c.send("A2 APPEND INBOX (\\Seen) {5}")
+	if got := c.readLine(); !strings.HasPrefix(got, "+ ") {
+		t.Fatalf("continuation = %q", got)
+	}
+	c.send("hello")
+	if got := c.readLine(); !strings.HasPrefix(got, "A2 OK") {
+		t.Fatalf("APPEND = %q", got)
+	}
+
+	// The CRLF ending the command must not be taken for another command.
+	if _, tagged := c.run("A3 NOOP"); tagged != "A3 OK NOOP completed" {
+		t.Errorf("NOOP = %q", tagged)
+	}
+	untagged, _ := c.run("A4 STATUS INBOX (MESSAGES)")
+	if len(untagged) != 1 || untagged[0] != "* STATUS INBOX (MESSAGES 3)" {
+		t.Errorf("STATUS = %q", untagged)
+	}
+}
+
+func TestMailboxAccessPolicy(t *testing.T) {
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	mem.AddUser("hank", "secret")
+	for _, name := range []string{"Shared", "Shared/HR", "Shared/HR/Payroll", "Shared/Sales"} {
+		if err := mem.GetUserData("alice").CreateMailbox(name); err != nil {
+			t.Fatalf("CreateMailbox() error: %v", err)
+		}
+	}
+	mem.GetUserData("hank").Mailboxes = mem.GetUserData("alice").Mailboxes
+
+	policy := server.WithMailboxAccessPolicy(&server.MailboxAccessPolicy{
+		Groups: func(username string) []string {
+			if username == "hank" {
+				return []string{"hr"}
+			}
+			return nil
+		},
+		Rules: []server.MailboxAccessRule{
+			{Groups: []string{"hr"}, Patterns: []string{"Shared/HR/*"}},
+			{Patterns: []string{"Shared/HR/*"}, Deny: true},
+		},
+	})
+
+	c := dialMem(t, mem, policy)
+	c.run("A1 LOGIN alice secret")
+	untagged, _ := c.run(`A2 LIST "" *`)
+	list := strings.Join(untagged, "\n") + "\n"
+	if strings.Contains(list, "Payroll") || !strings.Contains(list, "Shared/HR\n") || !strings.Contains(list, "Shared/Sales\n") {
+		t.Errorf("LIST = %q", untagged)
+	}
+	for _, cmd := range []string{
+		`A3 SELECT Shared/HR/Payroll`,
+		`A4 STATUS Shared/HR/Payroll (MESSAGES)`,
+		`A5 APPEND Shared/HR/Payroll {1+}` + "\r\nx",
+	} {
+		if _, tagged := c.run(cmd); !strings.Contains(tagged, "NO [NOPERM]") {
+			t.Errorf("%s: %q, want NO [NOPERM]", cmd, tagged)
+		}
+	}
+
+	hr := dialMem(t, mem, policy)
+	hr.run("A1 LOGIN hank secret")
+	if untagged, _ := hr.run(`A2 LIST "" Shared/HR/*`); len(untagged) != 1 {
+		t.Errorf("LIST for hr = %q", untagged)
+	}
+	if _, tagged := hr.run("A3 SELECT Shared/HR/Payroll"); !strings.HasPrefix(tagged, "A3 OK") {
+		t.Errorf("SELECT for hr = %q", tagged)
+	}
+}
+
+// slowSearchSession is a memserver session whose searches find the first
+// message and then wait for the deadline.
+type slowSearchSession struct {
+	*memserver.Session
+	partial bool
+}
+
+func (s *slowSearchSession) SearchWithContext(ctx context.Context, kind server.NumKind, criteria *imap.SearchCriteria, options *imap.SearchOptions) (*imap.SearchData, error) {
+	<-ctx.Done()
+	if !s.partial {
+		return nil, ctx.Err()
+	}
+	return &imap.SearchData{AllSeqNums: []uint32{1}, Incomplete: true}, nil
+}
+
+func TestSearchDeadline(t *testing.T) {
+	for _, partial := range []bool{true, false} {
+		mem := memserver.New()
+		mem.AddUser("alice", "secret")
+		c := dialMem(t, mem,
+			server.WithSearchLimits(server.SearchLimits{MaxDuration: 20 * time.Millisecond}),
+			server.WithNewSession(func(conn *server.Conn) (server.Session, error) {
+				sess, err := mem.NewSession(conn)
+				if err != nil {
+					return nil, err
+				}
+				return &slowSearchSession{Session: sess.(*memserver.Session), partial: partial}, nil
+			}),
+		)
+		c.run("A1 LOGIN alice secret")
+		c.run("A2 SELECT INBOX")
+
+		untagged, tagged := c.run("A3 SEARCH ALL")
+		if partial {
+			if len(untagged) != 1 || untagged[0] != "* SEARCH 1" {
+				t.Errorf("untagged = %q, want the partial results", untagged)
+			}
+			if !strings.HasPrefix(tagged, "A3 OK [LIMIT]") {
+				t.Errorf("tagged = %q, want OK [LIMIT]", tagged)
+			}
+		} else if !strings.HasPrefix(tagged, "A3 NO [LIMIT]") {
+			t.Errorf("tagged = %q, want NO [LIMIT]", tagged)
+		}
+
+		// The connection is still usable.
+		if _, tagged := c.run("A4 NOOP"); !strings.HasPrefix(tagged, "A4 OK") {
+			t.Errorf("NOOP = %q", tagged)
+		}
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	srv := mem.NewServer()
+	c := dialServer(t, srv)
+	c.run("A1 LOGIN alice secret")
+	c.run("A2 SELECT INBOX")
+
+	srv.SetMaintenanceMode(true, "Migrating, back soon")
+	for _, cmd := range []string{
+		"A3 CREATE Archive",
+		"A4 APPEND INBOX {5+}\r\nhello",
+		"A5 UID EXPUNGE 1",
+	} {
+		if _, tagged := c.run(cmd); !strings.HasSuffix(tagged, " NO [INUSE] Migrating, back soon") {
+			t.Errorf("%s: %q, want NO [INUSE]", cmd, tagged)
+		}
+	}
+	// A synchronizing literal is refused before it is sent.
+	c.send("A6 APPEND INBOX {5}")
+	if got := c.readLine(); !strings.HasPrefix(got, "A6 NO [INUSE]") {
+		t.Errorf("APPEND with a synchronizing literal = %q", got)
+	}
+	if untagged, tagged := c.run("A7 LIST \"\" *"); !strings.HasPrefix(tagged, "A7 OK") || len(untagged) != 1 {
+		t.Errorf("LIST in maintenance mode = %q, %q", untagged, tagged)
+	}
+
+	srv.SetMaintenanceMode(false, "")
+	if _, tagged := c.run("A8 CREATE Archive"); !strings.HasPrefix(tagged, "A8 OK") {
+		t.Errorf("CREATE after maintenance = %q", tagged)
+	}
+}
+
+func TestReadOnly_DiscardsLiterals(t *testing.T) {
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	c := dialMem(t, mem, server.WithExtensions(replace.New()))
+	c.run("A1 LOGIN alice secret")
+	c.run("A2 EXAMINE INBOX")
+
+	if _, tagged := c.run("A3 REPLACE 1 INBOX {9+}\r\nA4 LOGOUT"); tagged != "A3 NO mailbox is read-only" {
+		t.Errorf("REPLACE after EXAMINE = %q, want NO", tagged)
+	}
+	// The literal was not read as a command.
+	if untagged, tagged := c.run("A4 NOOP"); len(untagged) != 0 || !strings.HasPrefix(tagged, "A4 OK") {
+		t.Errorf("NOOP after REPLACE = %q, %q", untagged, tagged)
+	}
+}
+
+func TestFetchBodySections(t *testing.T) {
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	msg := "Subject: parts\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nhello world\r\n" +
+		"--b\r\nContent-Type: text/html\r\n\r\n<p>hi</p>\r\n--b--\r\n"
+	if err := mem.Deliver("alice", "INBOX", strings.NewReader(msg)); err != nil {
+		t.Fatalf("Deliver() error: %v", err)
+	}
+	c := dialMem(t, mem)
+	c.run("A1 LOGIN alice secret")
+	c.run("A2 SELECT INBOX")
+
+	c.send("A3 FETCH 1 (BODY.PEEK[1]<6.5> BODY.PEEK[2.MIME] BODY.PEEK[HEADER.FIELDS (Subject)])")
+	want := []string{
+		"* 1 FETCH (BODY[1]<6> {5}",
+		"world BODY[2.MIME] {27}",
+		"Content-Type: text/html",
+		"",
+		" BODY[HEADER.FIELDS (Subject)] {18}",
+		"Subject: parts",
+		"",
+		")",
+	}
+	for _, w := range want {
+		if got := c.readLine(); got != w {
+			t.Errorf("got %q, want %q", got, w)
+		}
+	}
+	if got := c.readLine(); !strings.HasPrefix(got, "A3 OK") {
+		t.Errorf("tagged = %q", got)
+	}
+	if _, tagged := c.run("A4 FETCH 1 BODY[1.FOO]"); !strings.HasPrefix(tagged, "A4 BAD") {
+		t.Errorf("invalid section: %q, want BAD", tagged)
+	}
+}
+
+func TestSelect_MailboxID(t *testing.T) {
+	hasMailboxID := func(untagged []string) bool {
+		for _, line := range untagged {
+			if strings.HasPrefix(line, "* OK [MAILBOXID (") {
+				return true
+			}
+		}
+		return false
+	}
+
+	c := dialTest(t)
+	c.run("A1 LOGIN alice secret")
+	if untagged, _ := c.run("A2 SELECT INBOX"); hasMailboxID(untagged) {
+		t.Errorf("MAILBOXID sent without OBJECTID: %q", untagged)
+	}
+
+	c = dialTest(t, server.WithCapabilities(imap.CapObjectID))
+	c.run("A1 LOGIN alice secret")
+	if untagged, _ := c.run("A2 SELECT INBOX"); !hasMailboxID(untagged) {
+		t.Errorf("MAILBOXID not sent with OBJECTID: %q", untagged)
+	}
+	if untagged, _ := c.run("A3 STATUS INBOX (MAILBOXID)"); len(untagged) != 1 || !strings.HasPrefix(untagged[0], "* STATUS INBOX (MAILBOXID (M") {
+		t.Errorf("STATUS = %q", untagged)
+	}
+}
+
+func TestList_AdversarialPatterns(t *testing.T) {
+	c := dialTest(t, server.WithListLimits(server.ListLimits{MaxPatternLength: 200}))
+	c.run("L LOGIN alice secret")
+	deep := strings.TrimSuffix(strings.Repeat(strings.Repeat("a", 20)+"/", 20), "/")
+	if _, tagged := c.run(`C CREATE "` + deep + `"`); !strings.HasPrefix(tagged, "C OK") {
+		t.Fatalf("CREATE: %s", tagged)
+	}
+
+	// A naive backtracking matcher would not finish these.
+	for _, pattern := range []string{
+		strings.Repeat("*a", 60) + "*b",
+		strings.Repeat("%a", 60) + "%b",
+	} {
+		untagged, tagged := c.run(`A LIST "" "` + pattern + `"`)
+		if tagged != "A OK LIST completed" || len(untagged) != 0 {
+			t.Errorf("LIST %.12q... = %q, %q", pattern, untagged, tagged)
+		}
+	}
+	untagged, tagged := c.run(`A LIST "" "` + strings.Repeat("*a", 60) + `*"`)
+	if tagged != "A OK LIST completed" || len(untagged) == 0 {
+		t.Errorf("LIST matching the deep mailbox = %q, %q", untagged, tagged)
+	}
+
+	// The reference name counts towards the pattern length.
+	_, tagged = c.run(`B LIST "` + strings.Repeat("x", 150) + `" "` + strings.Repeat("*", 60) + `"`)
+	if tagged != "B NO [LIMIT] Mailbox pattern too long" {
+		t.Errorf("LIST with a long pattern = %q", tagged)
+	}
+}
+
+func TestMailboxArguments(t *testing.T) {
+	c := dialTest(t)
+	c.run("A1 LOGIN alice secret")
+	for command, want := range map[string]string{
+		"B1 CREATE Archive]2024":     "B1 OK",
+		"B2 CREATE Arch*ive":         "B2 BAD",
+		"B3 CREATE %":                "B3 BAD",
+		"B4 STATUS inbox (MESSAGES)": "B4 OK",
+		"B5 SELECT iNbOx":            "B5 OK",
+	} {
+		if _, tagged := c.run(command); !strings.HasPrefix(tagged, want) {
+			t.Errorf("%s: %q, want %s", command, tagged, want)
+		}
+	}
+	c.send("A+2 NOOP")
+	if got := c.readLine(); !strings.HasPrefix(got, "* BAD") {
+		t.Errorf("invalid tag: %q, want * BAD", got)
+	}
+}
+
+func TestIdle_Timeout(t *testing.T) {
+	c := dialTest(t, server.WithIdleTimeout(100*time.Millisecond))
+	c.run("a LOGIN alice secret")
+	c.run("b SELECT INBOX")
+
+	// DONE before the timeout ends IDLE as usual
+	c.send("c IDLE")
+	if line := c.readLine(); line != "+ idling" {
+		t.Fatalf("IDLE = %q, want a continuation request", line)
+	}
+	c.send("DONE")
+	if line := c.readLine(); line != "c OK IDLE completed" {
+		t.Fatalf("DONE = %q", line)
+	}
+
+	c.send("d IDLE")
+	c.readLine()
+	if line := c.readLine(); line != "* BYE IDLE timed out" {
+		t.Errorf("after the IDLE timeout: %q, want BYE", line)
+	}
+	if line, err := c.r.ReadString('\n'); err == nil {
+		t.Errorf("connection still open, read %q", line)
+	}
+}
@@ -1,11 +1,8 @@
 package commands
 
 import (
-	"fmt"
-
 	imap "github.com/meszmate/imap-go"
 	"github.com/meszmate/imap-go/server"
-	"github.com/meszmate/imap-go/wire"
 )
 
 // Copy returns a handler for the COPY command.
@@ -17,35 +14,25 @@ func Copy() server.CommandHandlerFunc {
 		}
 
 		// Read sequence set
-		seqSetStr, err := ctx.Decoder.ReadAtom()
+		numSet, err := server.ParseNumSet(ctx)
 		if err != nil {
-			return imap.ErrBad("invalid sequence set")
-		}
-
-		var numSet imap.NumSet
-		if ctx.NumKind == server.NumKindUID {
-			uidSet, err := imap.ParseUIDSet(seqSetStr)
-			if err != nil {
-				return imap.ErrBad("invalid UID set")
-			}
-			numSet = uidSet
-		} else {
-			seqSet, err := imap.ParseSeqSet(seqSetStr)
-			if err != nil {
-				return imap.ErrBad("invalid sequence set")
-			}
-			numSet = seqSet
+			return err
 		}
 
 		if err := ctx.Decoder.ReadSP(); err != nil {
 			return imap.ErrBad("missing destination mailbox")
 		}
 
-		dest, err := ctx.Decoder.ReadAString()
+		dest, err := ctx.Decoder.ReadMailbox()
 		if err != nil {
 			return imap.ErrBad("invalid destination mailbox")
 		}
 
+		dest = imap.CanonicalMailboxName(dest)
+
+		if err := ctx.Conn.CheckMailboxAccess(dest); err != nil {
+			return err
+		}
 		data, err := ctx.Session.Copy(numSet, dest)
 		if err != nil {
 			return err
@@ -53,14 +40,9 @@ func Copy() server.CommandHandlerFunc {
 
 		// Write tagged OK, optionally with COPYUID response code
 		if data != nil && data.UIDValidity > 0 {
-			enc := ctx.Conn.Encoder()
-			enc.Encode(func(e *wire.Encoder) {
-				code := fmt.Sprintf("COPYUID %d %s %s",
-					data.UIDValidity,
-					data.SourceUIDs.String(),
-					data.DestUIDs.String())
-				e.StatusResponse(ctx.Tag, "OK", code, "COPY completed")
-			})
+			data.Normalize()
+			ctx.Conn.WriteOKCode(ctx.Tag, imap.ResponseCodeCopyUID, "COPY completed",
+				data.UIDValidity, &data.SourceUIDs, &data.DestUIDs)
 		} else {
 			ctx.Conn.WriteOK(ctx.Tag, "COPY completed")
 		}
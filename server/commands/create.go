@@ -13,11 +13,16 @@ func Create() server.CommandHandlerFunc {
 			return imap.ErrBad("missing mailbox name")
 		}
 
-		mailbox, err := ctx.Decoder.ReadAString()
+		mailbox, err := ctx.Decoder.ReadMailbox()
 		if err != nil {
 			return imap.ErrBad("invalid mailbox name")
 		}
 
+		mailbox, err = ctx.Conn.ValidateMailboxName(mailbox)
+		if err != nil {
+			return err
+		}
+
 		if err := ctx.Session.Create(mailbox, &imap.CreateOptions{}); err != nil {
 			return err
 		}
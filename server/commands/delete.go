@@ -13,11 +13,16 @@ func Delete() server.CommandHandlerFunc {
 			return imap.ErrBad("missing mailbox name")
 		}
 
-		mailbox, err := ctx.Decoder.ReadAString()
+		mailbox, err := ctx.Decoder.ReadMailbox()
 		if err != nil {
 			return imap.ErrBad("invalid mailbox name")
 		}
 
+		mailbox = imap.CanonicalMailboxName(mailbox)
+
+		if err := ctx.Conn.CheckMailboxAccess(mailbox); err != nil {
+			return err
+		}
 		if err := ctx.Session.Delete(mailbox); err != nil {
 			return err
 		}
@@ -0,0 +1,210 @@
+package commands_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/meszmate/imap-go/imaptest"
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+// closeCounter counts the calls to Session.Close of the sessions of a
+// memserver, and the errors logged by the server.
+type closeCounter struct {
+	mem    *memserver.MemServer
+	closes atomic.Int32
+	errors atomic.Int32
+}
+
+type countedSession struct {
+	server.Session
+	counter *closeCounter
+}
+
+func (s *countedSession) Close() error {
+	s.counter.closes.Add(1)
+	return s.Session.Close()
+}
+
+func (cc *closeCounter) Enabled(context.Context, slog.Level) bool { return true }
+func (cc *closeCounter) Handle(_ context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelError {
+		cc.errors.Add(1)
+	}
+	return nil
+}
+func (cc *closeCounter) WithAttrs([]slog.Attr) slog.Handler { return cc }
+func (cc *closeCounter) WithGroup(string) slog.Handler      { return cc }
+
+// newCloseCounter returns a server for a memserver with the user alice,
+// counting session closes and logged errors.
+func newCloseCounter(t *testing.T) (*closeCounter, *server.Server) {
+	t.Helper()
+	cc := &closeCounter{mem: memserver.New()}
+	cc.mem.AddUser("alice", "secret")
+	srv := cc.mem.NewServer(
+		server.WithLogger(slog.New(cc)),
+		server.WithNewSession(func(conn *server.Conn) (server.Session, error) {
+			sess, err := cc.mem.NewSession(conn)
+			if err != nil {
+				return nil, err
+			}
+			return &countedSession{Session: sess, counter: cc}, nil
+		}),
+	)
+	return cc, srv
+}
+
+// waitClosed waits for the session to be closed, and checks that it was
+// closed exactly once and that no error was logged.
+func (cc *closeCounter) waitClosed(t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for cc.closes.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	// Give a second Close a chance to happen.
+	time.Sleep(20 * time.Millisecond)
+	if n := cc.closes.Load(); n != 1 {
+		t.Errorf("Session.Close called %d times, want 1", n)
+	}
+	if n := cc.errors.Load(); n != 0 {
+		t.Errorf("%d errors logged, want none", n)
+	}
+}
+
+// expectEOF checks that the server closed the connection.
+func (c *testConn) expectEOF() {
+	c.t.Helper()
+	if line, err := c.r.ReadString('\n'); err != io.EOF {
+		c.t.Errorf("read %q, %v; want EOF", line, err)
+	}
+}
+
+func startIdle(t *testing.T, c *testConn) {
+	t.Helper()
+	if _, tagged := c.run("A1 LOGIN alice secret"); !strings.HasPrefix(tagged, "A1 OK") {
+		t.Fatalf("LOGIN: %s", tagged)
+	}
+	if _, tagged := c.run("A2 SELECT INBOX"); !strings.HasPrefix(tagged, "A2 OK") {
+		t.Fatalf("SELECT: %s", tagged)
+	}
+	c.send("A3 IDLE")
+	if line := c.readLine(); !strings.HasPrefix(line, "+") {
+		t.Fatalf("IDLE: %s", line)
+	}
+}
+
+func TestIdle_DoneAndLogout(t *testing.T) {
+	cc, srv := newCloseCounter(t)
+	c := dialServer(t, srv)
+	startIdle(t, c)
+
+	// DONE and LOGOUT in a single write
+	if _, err := c.conn.Write([]byte("DONE\r\nA4 LOGOUT\r\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	want := []string{"A3 OK", "* BYE", "A4 OK"}
+	for _, prefix := range want {
+		if line := c.readLine(); !strings.HasPrefix(line, prefix) {
+			t.Fatalf("got %q, want %q...", line, prefix)
+		}
+	}
+	c.expectEOF()
+	cc.waitClosed(t)
+}
+
+func TestIdle_Disconnect(t *testing.T) {
+	cc, srv := newCloseCounter(t)
+	c := dialServer(t, srv)
+	startIdle(t, c)
+
+	_ = c.conn.Close()
+	cc.waitClosed(t)
+}
+
+func TestIdle_Shutdown(t *testing.T) {
+	cc, srv := newCloseCounter(t)
+	c := dialServer(t, srv)
+	startIdle(t, c)
+
+	_ = srv.Close()
+	if line := c.readLine(); !strings.HasPrefix(line, "* BYE") {
+		t.Fatalf("got %q, want BYE", line)
+	}
+	c.expectEOF()
+	cc.waitClosed(t)
+}
+
+func TestAppend_DisconnectMidLiteral(t *testing.T) {
+	for _, literal := range []string{"{100}", "{100+}"} {
+		t.Run(literal, func(t *testing.T) {
+			cc, srv := newCloseCounter(t)
+			c := dialServer(t, srv)
+			if _, tagged := c.run("A1 LOGIN alice secret"); !strings.HasPrefix(tagged, "A1 OK") {
+				t.Fatalf("LOGIN: %s", tagged)
+			}
+
+			c.send("A2 APPEND INBOX " + literal)
+			if !strings.HasSuffix(literal, "+}") {
+				if line := c.readLine(); !strings.HasPrefix(line, "+") {
+					t.Fatalf("APPEND: %s", line)
+				}
+			}
+			if _, err := c.conn.Write([]byte("Subject: cut short\r\n")); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			_ = c.conn.Close()
+
+			cc.waitClosed(t)
+			if n := cc.mem.GetUserData("alice").GetMailbox("INBOX").NumMessages(); n != 0 {
+				t.Errorf("INBOX has %d messages, want 0", n)
+			}
+		})
+	}
+}
+
+// TestShutdownInterleavings closes connections in the middle of IDLE and
+// literals from several goroutines at once, for the race detector.
+func TestShutdownInterleavings(t *testing.T) {
+	cc, srv := newCloseCounter(t)
+	h := imaptest.NewHarness(t, srv)
+
+	const conns = 8
+	var wg sync.WaitGroup
+	for i := 0; i < conns; i++ {
+		c := dialAddr(t, h.Addr())
+		startIdle(t, c)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			switch i % 3 {
+			case 0:
+				_, _ = c.conn.Write([]byte("DONE\r\nA4 LOGOUT\r\n"))
+			case 1:
+				_, _ = c.conn.Write([]byte("DONE\r\nA4 APPEND INBOX {10+}\r\nabc"))
+				_ = c.conn.Close()
+			default:
+				_ = c.conn.Close()
+			}
+		}(i)
+	}
+	go func() { _ = srv.Close() }()
+	wg.Wait()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for cc.closes.Load() < conns && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := cc.closes.Load(); n != conns {
+		t.Errorf("Session.Close called %d times, want %d", n, conns)
+	}
+}
@@ -33,17 +33,8 @@ func Enable() server.CommandHandlerFunc {
 			return imap.ErrBad("missing capabilities to enable")
 		}
 
-		// Check which capabilities can be enabled
-		serverCaps := ctx.Server.Capabilities(ctx.Conn)
-		serverCapSet := imap.NewCapSet(serverCaps...)
-
-		var enabled []imap.Cap
-		for _, cap := range requested {
-			if serverCapSet.Has(cap) {
-				ctx.Conn.Enabled().Add(cap)
-				enabled = append(enabled, cap)
-			}
-		}
+		// Enable the advertised capabilities and those they imply
+		enabled := ctx.Server.EnableCapabilities(ctx.Conn, requested)
 
 		// Write ENABLED response
 		enc := ctx.Conn.Encoder()
@@ -11,16 +11,12 @@ func Expunge() server.CommandHandlerFunc {
 	return func(ctx *server.CommandContext) error {
 		// For UID EXPUNGE, parse the UID set
 		var uids *imap.UIDSet
-		if ctx.NumKind == server.NumKindUID && ctx.Decoder != nil {
-			uidStr, err := ctx.Decoder.ReadAtom()
+		if ctx.NumKind == server.NumKindUID {
+			numSet, err := server.ParseNumSet(ctx)
 			if err != nil {
-				return imap.ErrBad("invalid UID set")
+				return err
 			}
-			uidSet, err := imap.ParseUIDSet(uidStr)
-			if err != nil {
-				return imap.ErrBad("invalid UID set")
-			}
-			uids = uidSet
+			uids = numSet.(*imap.UIDSet)
 		}
 
 		w := server.NewExpungeWriter(ctx.Conn.Encoder())
@@ -0,0 +1,44 @@
+package commands_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+func TestExpungeIssued(t *testing.T) {
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	for _, msg := range []string{"Subject: one\r\n\r\nfirst", "Subject: two\r\n\r\nsecond"} {
+		if err := mem.Deliver("alice", "INBOX", strings.NewReader(msg)); err != nil {
+			t.Fatalf("Deliver() error: %v", err)
+		}
+	}
+	srv := mem.NewServer()
+	c1, c2 := dialServer(t, srv), dialServer(t, srv)
+	for _, c := range []*testConn{c1, c2} {
+		c.run("A1 LOGIN alice secret")
+		c.run("A2 SELECT INBOX")
+	}
+
+	c2.run("B1 STORE 1 +FLAGS (\\Deleted)")
+	c2.run("B2 EXPUNGE")
+
+	// FETCH cannot report the expunge of message 1.
+	untagged, tagged := c1.run("A3 FETCH 1:* (UID)")
+	if tagged != "A3 OK [EXPUNGEISSUED] FETCH completed" {
+		t.Errorf("FETCH of an expunged message = %q", tagged)
+	}
+	if len(untagged) != 1 || !strings.HasPrefix(untagged[0], "* 2 FETCH (UID 2)") {
+		t.Errorf("FETCH responses = %q", untagged)
+	}
+
+	untagged, tagged = c1.run("A4 NOOP")
+	if tagged != "A4 OK NOOP completed" || len(untagged) != 1 || untagged[0] != "* 1 EXPUNGE" {
+		t.Errorf("NOOP = %q, %q; want the EXPUNGE without EXPUNGEISSUED", untagged, tagged)
+	}
+	if _, tagged := c1.run("A5 FETCH 1 (UID)"); tagged != "A5 OK FETCH completed" {
+		t.Errorf("FETCH after NOOP = %q", tagged)
+	}
+}
@@ -0,0 +1,130 @@
+package commands_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+// benchConn is a raw client connection for benchmarks.
+type benchConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialBench(b *testing.B, addr string) *benchConn {
+	b.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		b.Fatalf("Dial() error: %v", err)
+	}
+	b.Cleanup(func() { _ = conn.Close() })
+	c := &benchConn{conn: conn, r: bufio.NewReaderSize(conn, 64*1024)}
+	if _, err := c.r.ReadString('\n'); err != nil {
+		b.Fatalf("greeting: %v", err)
+	}
+	if err := c.run("L LOGIN alice secret"); err != nil {
+		b.Fatalf("LOGIN: %v", err)
+	}
+	if err := c.run("S SELECT INBOX"); err != nil {
+		b.Fatalf("SELECT: %v", err)
+	}
+	return c
+}
+
+// run sends a command and reads the responses up to the tagged one. The
+// message bodies of the benchmark never start with a tag.
+func (c *benchConn) run(command string) error {
+	tag, _, _ := strings.Cut(command, " ")
+	if _, err := fmt.Fprintf(c.conn, "%s\r\n", command); err != nil {
+		return err
+	}
+	for {
+		line, err := c.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(string(line), tag+" ") {
+			if !strings.HasPrefix(string(line), tag+" OK") {
+				return fmt.Errorf("%s", line)
+			}
+			return nil
+		}
+	}
+}
+
+// BenchmarkSmallCommandLatencyUnderLoad measures the latency of NOOP on
+// one connection while four others stream large FETCH responses, with and
+// without write fairness. It reports the median and 99th percentile
+// latency.
+func BenchmarkSmallCommandLatencyUnderLoad(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []server.Option
+	}{
+		{"default", nil},
+		{"fairness", []server.Option{server.WithWriteFairness(server.WriteFairness{})}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			mem := memserver.New()
+			mem.AddUser("alice", "secret")
+			body := "Subject: big\r\n\r\n" + strings.Repeat(strings.Repeat("a", 78)+"\r\n", 100_000)
+			if err := mem.Deliver("alice", "INBOX", strings.NewReader(body)); err != nil {
+				b.Fatalf("Deliver() error: %v", err)
+			}
+
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				b.Fatalf("Listen() error: %v", err)
+			}
+			srv := mem.NewServer(bc.opts...)
+			go func() { _ = srv.Serve(l) }()
+			b.Cleanup(func() { _ = srv.Close() })
+
+			// Streaming connections fetch the 8 MB message in a loop.
+			stop := make(chan struct{})
+			defer close(stop)
+			for i := 0; i < 4; i++ {
+				hog := dialBench(b, l.Addr().String())
+				go func() {
+					for {
+						select {
+						case <-stop:
+							return
+						default:
+						}
+						if hog.run("F UID FETCH 1 BODY.PEEK[]") != nil {
+							return
+						}
+					}
+				}()
+			}
+
+			c := dialBench(b, l.Addr().String())
+			latencies := make([]time.Duration, 0, b.N)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				start := time.Now()
+				if err := c.run("N NOOP"); err != nil {
+					b.Fatalf("NOOP: %v", err)
+				}
+				latencies = append(latencies, time.Since(start))
+			}
+			b.StopTimer()
+
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			b.ReportMetric(float64(latencies[len(latencies)/2].Nanoseconds()), "p50-ns")
+			b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns")
+		})
+	}
+}
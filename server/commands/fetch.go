@@ -18,24 +18,9 @@ func Fetch() server.CommandHandlerFunc {
 		}
 
 		// Read sequence set
-		seqSetStr, err := ctx.Decoder.ReadAtom()
+		numSet, err := server.ParseNumSet(ctx)
 		if err != nil {
-			return imap.ErrBad("invalid sequence set")
-		}
-
-		var numSet imap.NumSet
-		if ctx.NumKind == server.NumKindUID {
-			uidSet, err := imap.ParseUIDSet(seqSetStr)
-			if err != nil {
-				return imap.ErrBad("invalid UID set")
-			}
-			numSet = uidSet
-		} else {
-			seqSet, err := imap.ParseSeqSet(seqSetStr)
-			if err != nil {
-				return imap.ErrBad("invalid sequence set")
-			}
-			numSet = seqSet
+			return err
 		}
 
 		if err := ctx.Decoder.ReadSP(); err != nil {
@@ -54,7 +39,7 @@ func Fetch() server.CommandHandlerFunc {
 		}
 
 		w := server.NewFetchWriter(ctx.Conn.Encoder())
-		if err := ctx.Session.Fetch(w, numSet, options); err != nil {
+		if err := server.RunFetch(ctx, w, numSet, options); err != nil {
 			return err
 		}
 
@@ -135,31 +120,22 @@ func parseSingleFetchItem(dec *wire.Decoder, options *imap.FetchOptions) error {
 		options.SaveDate = true
 
 	// BODY with bracket embedded in atom ([ is an atom char)
-	case strings.HasPrefix(upper, "BODY.PEEK["):
-		section, err := parseFetchBodySectionFromAtom(dec, item, true)
+	case strings.HasPrefix(upper, "BODY.PEEK["), strings.HasPrefix(upper, "BODY["):
+		section, err := server.ReadBodySection(dec, item)
 		if err != nil {
 			return err
 		}
 		options.BodySection = append(options.BodySection, section)
-	case strings.HasPrefix(upper, "BODY["):
-		section, err := parseFetchBodySectionFromAtom(dec, item, false)
+	case upper == "BODY.PEEK":
+		section, err := server.ReadBodySection(dec, item)
 		if err != nil {
 			return err
 		}
 		options.BodySection = append(options.BodySection, section)
-	case upper == "BODY.PEEK":
-		b, err := dec.PeekByte()
-		if err == nil && b == '[' {
-			section, err := parseFetchBodySection(dec, true)
-			if err != nil {
-				return err
-			}
-			options.BodySection = append(options.BodySection, section)
-		}
 	case upper == "BODY":
 		b, err := dec.PeekByte()
 		if err == nil && b == '[' {
-			section, err := parseFetchBodySection(dec, false)
+			section, err := server.ReadBodySection(dec, item)
 			if err != nil {
 				return err
 			}
@@ -180,14 +156,20 @@ func parseSingleFetchItem(dec *wire.Decoder, options *imap.FetchOptions) error {
 		if err := dec.ExpectByte(']'); err != nil {
 			return err
 		}
-		section.Partial = consumePartial(dec)
+		section.Partial, err = server.ReadSectionPartial(dec)
+		if err != nil {
+			return err
+		}
 		options.BinarySection = append(options.BinarySection, section)
 	case strings.HasPrefix(upper, "BINARY["):
 		section := parseBinaryItemFromAtom(item, "BINARY[", false)
 		if err := dec.ExpectByte(']'); err != nil {
 			return err
 		}
-		section.Partial = consumePartial(dec)
+		section.Partial, err = server.ReadSectionPartial(dec)
+		if err != nil {
+			return err
+		}
 		options.BinarySection = append(options.BinarySection, section)
 
 	case upper == "RFC822":
@@ -206,69 +188,6 @@ func parseSingleFetchItem(dec *wire.Decoder, options *imap.FetchOptions) error {
 	return nil
 }
 
-// parseFetchBodySectionFromAtom handles BODY[section or BODY.PEEK[section
-// where [ was included in the atom by ReadAtom.
-func parseFetchBodySectionFromAtom(dec *wire.Decoder, item string, peek bool) (*imap.FetchItemBodySection, error) {
-	bracketIdx := strings.IndexByte(item, '[')
-	sectionStr := strings.ToUpper(item[bracketIdx+1:])
-
-	section := &imap.FetchItemBodySection{Peek: peek}
-
-	switch {
-	case sectionStr == "":
-		// empty section — will read ] next
-	case sectionStr == "HEADER":
-		section.Specifier = "HEADER"
-	case sectionStr == "TEXT":
-		section.Specifier = "TEXT"
-	case sectionStr == "MIME":
-		section.Specifier = "MIME"
-	case strings.HasPrefix(sectionStr, "HEADER.FIELDS.NOT"):
-		section.Specifier = "HEADER.FIELDS.NOT"
-		section.NotFields = true
-		if err := dec.ReadSP(); err != nil {
-			return nil, err
-		}
-		fields, err := readFieldList(dec)
-		if err != nil {
-			return nil, err
-		}
-		section.Fields = fields
-	case strings.HasPrefix(sectionStr, "HEADER.FIELDS"):
-		section.Specifier = "HEADER.FIELDS"
-		if err := dec.ReadSP(); err != nil {
-			return nil, err
-		}
-		fields, err := readFieldList(dec)
-		if err != nil {
-			return nil, err
-		}
-		section.Fields = fields
-	}
-
-	if err := dec.ExpectByte(']'); err != nil {
-		return nil, err
-	}
-
-	// Check for partial <offset.count>
-	b, err := dec.PeekByte()
-	if err == nil && b == '<' {
-		for {
-			ch, err := dec.PeekByte()
-			if err != nil {
-				break
-			}
-			if ch == '>' {
-				_ = dec.ExpectByte('>')
-				break
-			}
-			_, _ = dec.ReadAtom()
-		}
-	}
-
-	return section, nil
-}
-
 // parseBinaryPart parses a MIME part string like "1.2" into []int{1, 2}.
 func parseBinaryPart(s string) []int {
 	if s == "" {
@@ -294,126 +213,3 @@ func parseBinaryItemFromAtom(item, prefix string, peek bool) *imap.FetchItemBina
 		Peek: peek,
 	}
 }
-
-// consumePartial consumes a <offset.count> partial specifier if present.
-func consumePartial(dec *wire.Decoder) *imap.SectionPartial {
-	b, err := dec.PeekByte()
-	if err != nil || b != '<' {
-		return nil
-	}
-	_ = dec.ExpectByte('<')
-	atom, err := dec.ReadAtom()
-	if err != nil {
-		return nil
-	}
-	_ = dec.ExpectByte('>')
-
-	parts := strings.SplitN(atom, ".", 2)
-	if len(parts) != 2 {
-		return nil
-	}
-	offset, err := strconv.ParseInt(parts[0], 10, 64)
-	if err != nil {
-		return nil
-	}
-	count, err := strconv.ParseInt(parts[1], 10, 64)
-	if err != nil {
-		return nil
-	}
-	return &imap.SectionPartial{Offset: offset, Count: count}
-}
-
-func parseFetchBodySection(dec *wire.Decoder, peek bool) (*imap.FetchItemBodySection, error) {
-	section := &imap.FetchItemBodySection{
-		Peek: peek,
-	}
-
-	// Read '['
-	if err := dec.ExpectByte('['); err != nil {
-		return nil, err
-	}
-
-	// Read section content until ']'
-	b, err := dec.PeekByte()
-	if err != nil {
-		return nil, err
-	}
-
-	if b != ']' {
-		// Read the section specifier
-		spec, err := dec.ReadAtom()
-		if err != nil {
-			return nil, err
-		}
-
-		upper := strings.ToUpper(spec)
-		switch {
-		case upper == "HEADER":
-			section.Specifier = "HEADER"
-		case upper == "TEXT":
-			section.Specifier = "TEXT"
-		case upper == "MIME":
-			section.Specifier = "MIME"
-		case strings.HasPrefix(upper, "HEADER.FIELDS.NOT"):
-			section.Specifier = "HEADER.FIELDS.NOT"
-			section.NotFields = true
-			if err := dec.ReadSP(); err != nil {
-				return nil, err
-			}
-			fields, err := readFieldList(dec)
-			if err != nil {
-				return nil, err
-			}
-			section.Fields = fields
-		case strings.HasPrefix(upper, "HEADER.FIELDS"):
-			section.Specifier = "HEADER.FIELDS"
-			if err := dec.ReadSP(); err != nil {
-				return nil, err
-			}
-			fields, err := readFieldList(dec)
-			if err != nil {
-				return nil, err
-			}
-			section.Fields = fields
-		}
-	}
-
-	// Read ']'
-	if err := dec.ExpectByte(']'); err != nil {
-		return nil, err
-	}
-
-	// Check for partial <offset.count>
-	b, err = dec.PeekByte()
-	if err == nil && b == '<' {
-		// Simplified: skip partial parsing for now, consume until '>'
-		for {
-			ch, err := dec.PeekByte()
-			if err != nil {
-				break
-			}
-			if ch == '>' {
-				_ = dec.ExpectByte('>')
-				break
-			}
-			_, _ = dec.ReadAtom()
-		}
-	}
-
-	return section, nil
-}
-
-func readFieldList(dec *wire.Decoder) ([]string, error) {
-	var fields []string
-	if err := dec.ReadList(func() error {
-		field, err := dec.ReadAString()
-		if err != nil {
-			return err
-		}
-		fields = append(fields, field)
-		return nil
-	}); err != nil {
-		return nil, err
-	}
-	return fields, nil
-}
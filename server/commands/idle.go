@@ -1,11 +1,12 @@
 package commands
 
 import (
+	"errors"
+	"net"
 	"strings"
 
 	imap "github.com/meszmate/imap-go"
 	"github.com/meszmate/imap-go/server"
-	"github.com/meszmate/imap-go/wire"
 )
 
 // Idle returns a handler for the IDLE command (RFC 2177).
@@ -13,14 +14,14 @@ import (
 func Idle() server.CommandHandlerFunc {
 	return func(ctx *server.CommandContext) error {
 		// Send continuation request
-		enc := ctx.Conn.Encoder()
-		enc.Encode(func(e *wire.Encoder) {
-			e.ContinuationRequest("idling")
-		})
+		ctx.Conn.WriteContinuation("idling")
 
 		// Create a stop channel for idle
 		stop := make(chan struct{})
 
+		// IDLE lasts until the client sends DONE, or at most IdleTimeout
+		ctx.Conn.SetReadTimeout(ctx.Server.Options().IdleTimeout)
+
 		// Start a goroutine to wait for DONE from the client
 		doneCh := make(chan error, 1)
 		go func() {
@@ -29,6 +30,7 @@ func Idle() server.CommandHandlerFunc {
 			for {
 				line, err := connDec.ReadLine()
 				if err != nil {
+					close(stop)
 					doneCh <- err
 					return
 				}
@@ -47,10 +49,17 @@ func Idle() server.CommandHandlerFunc {
 		// Wait for the DONE reader to finish
 		readErr := <-doneCh
 
+		var netErr net.Error
+		if errors.As(readErr, &netErr) && netErr.Timeout() {
+			ctx.Conn.WriteBYE("IDLE timed out")
+			return ctx.Conn.Close()
+		}
 		if idleErr != nil {
 			return idleErr
 		}
 		if readErr != nil {
+			// If the client went away or the connection was closed, the
+			// connection ends without this response.
 			return imap.ErrBad("IDLE terminated: " + readErr.Error())
 		}
 
@@ -15,7 +15,7 @@ func List() server.CommandHandlerFunc {
 		}
 
 		// Read reference name
-		ref, err := ctx.Decoder.ReadAString()
+		ref, err := ctx.Decoder.ReadMailbox()
 		if err != nil {
 			return imap.ErrBad("invalid reference name")
 		}
@@ -25,18 +25,26 @@ func List() server.CommandHandlerFunc {
 		}
 
 		// Read mailbox pattern
-		pattern, err := ctx.Decoder.ReadAString()
+		pattern, err := ctx.Decoder.ReadListMailbox()
 		if err != nil {
 			return imap.ErrBad("invalid mailbox pattern")
 		}
 
 		patterns := []string{pattern}
+		if err := ctx.Conn.CheckListPatterns(ref, patterns); err != nil {
+			return err
+		}
+		ref, patterns, err = ctx.Conn.ResolveListReference(ref, patterns)
+		if err != nil {
+			return err
+		}
 		options := &imap.ListOptions{}
 
-		w := server.NewListWriter(ctx.Conn.Encoder())
-		if err := ctx.Session.List(w, ref, patterns, options); err != nil {
+		w := ctx.Conn.NewListWriter()
+		if err := ctx.Session.List(w, ref, w.InferParents(ref, patterns), options); err != nil {
 			return err
 		}
+		w.Flush()
 
 		ctx.Conn.WriteOK(ctx.Tag, "LIST completed")
 		return nil
@@ -53,7 +61,7 @@ func Lsub() server.CommandHandlerFunc {
 		}
 
 		// Read reference name
-		ref, err := ctx.Decoder.ReadAString()
+		ref, err := ctx.Decoder.ReadMailbox()
 		if err != nil {
 			return imap.ErrBad("invalid reference name")
 		}
@@ -63,20 +71,28 @@ func Lsub() server.CommandHandlerFunc {
 		}
 
 		// Read mailbox pattern
-		pattern, err := ctx.Decoder.ReadAString()
+		pattern, err := ctx.Decoder.ReadListMailbox()
 		if err != nil {
 			return imap.ErrBad("invalid mailbox pattern")
 		}
 
 		patterns := []string{pattern}
+		if err := ctx.Conn.CheckListPatterns(ref, patterns); err != nil {
+			return err
+		}
+		ref, patterns, err = ctx.Conn.ResolveListReference(ref, patterns)
+		if err != nil {
+			return err
+		}
 		options := &imap.ListOptions{
 			SelectSubscribed: true,
 		}
 
-		w := server.NewListWriter(ctx.Conn.Encoder())
-		if err := ctx.Session.List(w, ref, patterns, options); err != nil {
+		w := ctx.Conn.NewListWriter()
+		if err := ctx.Session.List(w, ref, w.InferParents(ref, patterns), options); err != nil {
 			return err
 		}
+		w.Flush()
 
 		ctx.Conn.WriteOK(ctx.Tag, "LSUB completed")
 		return nil
@@ -0,0 +1,48 @@
+package commands_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+func TestList_Attributes(t *testing.T) {
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	if err := mem.GetUserData("alice").CreateMailbox("Work/Reports/2024"); err != nil {
+		t.Fatalf("CreateMailbox() error: %v", err)
+	}
+	if err := mem.Deliver("alice", "INBOX", strings.NewReader("Subject: new\r\n\r\nbody")); err != nil {
+		t.Fatalf("Deliver() error: %v", err)
+	}
+	c := dialMem(t, mem)
+	c.run("A1 LOGIN alice secret")
+
+	tests := []struct {
+		cmd  string
+		want []string
+	}{
+		{`LIST "" %`, []string{`* LIST (\Marked) "/" INBOX`, `* LIST (\Noselect) "/" Work`}},
+		{`LIST "" Work/%`, []string{`* LIST (\Noselect) "/" Work/Reports`}},
+		{`LIST "" *`, []string{`* LIST (\Marked) "/" INBOX`, `* LIST () "/" Work/Reports/2024`}},
+		{`LIST "Work/" %/2024`, []string{`* LIST () "/" Work/Reports/2024`}},
+	}
+	for _, tt := range tests {
+		untagged, tagged := c.run("A2 " + tt.cmd)
+		if tagged != "A2 OK LIST completed" || strings.Join(untagged, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s = %q, %q; want %q", tt.cmd, untagged, tagged, tt.want)
+		}
+	}
+
+	// Selecting the mailbox unmarks it.
+	c.run("A3 SELECT INBOX")
+	if untagged, _ := c.run(`A4 LIST "" INBOX`); len(untagged) != 1 || untagged[0] != `* LIST () "/" INBOX` {
+		t.Errorf("LIST after SELECT = %q", untagged)
+	}
+
+	c.run("A5 SUBSCRIBE Work/Reports/2024")
+	if untagged, _ := c.run(`A6 LSUB "" %`); len(untagged) != 2 || untagged[1] != `* LIST (\Noselect) "/" Work` {
+		t.Errorf("LSUB = %q", untagged)
+	}
+}
@@ -31,15 +31,16 @@ func Login() server.CommandHandlerFunc {
 			return imap.ErrBad("invalid password")
 		}
 
-		if err := ctx.Session.Login(username, password); err != nil {
-			return err
+		credentials := server.Credentials{Mechanism: "LOGIN", Password: password}
+		if handled, name, err := ctx.Conn.AuthenticateWithProvider(ctx.Context, username, credentials); handled {
+			if err != nil {
+				return authError(err)
+			}
+			username = name
+		} else if err := ctx.Session.Login(username, password); err != nil {
+			return authError(err)
 		}
 
-		if err := ctx.Conn.SetState(imap.ConnStateAuthenticated); err != nil {
-			return err
-		}
-
-		ctx.Conn.WriteOK(ctx.Tag, "LOGIN completed")
-		return nil
+		return completeAuth(ctx, username, "LOGIN completed")
 	}
 }
@@ -0,0 +1,312 @@
+package commands_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/extension"
+	"github.com/meszmate/imap-go/extensions/acl"
+	"github.com/meszmate/imap-go/extensions/condstore"
+	"github.com/meszmate/imap-go/extensions/esearch"
+	"github.com/meszmate/imap-go/extensions/metadata"
+	"github.com/meszmate/imap-go/extensions/move"
+	"github.com/meszmate/imap-go/extensions/multisearch"
+	"github.com/meszmate/imap-go/extensions/notify"
+	"github.com/meszmate/imap-go/extensions/quota"
+	"github.com/meszmate/imap-go/extensions/searchres"
+	"github.com/meszmate/imap-go/extensions/uidonly"
+	"github.com/meszmate/imap-go/extensions/uidplus"
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/server/authprovider"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+// extensionSession is a memserver session implementing the session
+// interfaces of the extensions that take mailbox arguments. It records the
+// mailboxes passed to it.
+type extensionSession struct {
+	*memserver.Session
+	mu      *sync.Mutex
+	reached *[]string
+	saved   *imap.SeqSet
+}
+
+func (s *extensionSession) reach(mailbox string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*s.reached = append(*s.reached, mailbox)
+}
+
+func (s *extensionSession) Copy(numSet imap.NumSet, dest string) (*imap.CopyData, error) {
+	s.reach(dest)
+	return s.Session.Copy(numSet, dest)
+}
+
+func (s *extensionSession) Move(w *server.MoveWriter, numSet imap.NumSet, dest string) error {
+	s.reach(dest)
+	return nil
+}
+
+func (s *extensionSession) SaveSearchResult(data *imap.SearchData) error {
+	s.saved = &imap.SeqSet{}
+	s.saved.AddNum(data.AllSeqNums...)
+	return nil
+}
+
+func (s *extensionSession) GetSearchResult() (*imap.SeqSet, error) {
+	return s.saved, nil
+}
+
+func (s *extensionSession) MultiSearch(kind server.NumKind, source *multisearch.MultiSearchSource, criteria *imap.SearchCriteria, options *imap.SearchOptions) ([]imap.MultiSearchResult, error) {
+	var results []imap.MultiSearchResult
+	for _, mbox := range source.Mailboxes {
+		s.reach(mbox)
+		results = append(results, imap.MultiSearchResult{Mailbox: mbox, UIDValidity: 1})
+		if source.Filter == "subtree" && mbox == "Shared" {
+			for _, child := range []string{"Shared/HR", "Shared/HR/Payroll", "Shared/Sales"} {
+				results = append(results, imap.MultiSearchResult{Mailbox: child, UIDValidity: 1})
+			}
+		}
+	}
+	return results, nil
+}
+
+func (s *extensionSession) SetACL(mailbox, identifier, modifier string, rights imap.ACLRights) error {
+	s.reach(mailbox)
+	return nil
+}
+
+func (s *extensionSession) DeleteACL(mailbox, identifier string) error {
+	s.reach(mailbox)
+	return nil
+}
+
+func (s *extensionSession) GetACL(mailbox string) (*imap.ACLData, error) {
+	s.reach(mailbox)
+	return &imap.ACLData{Mailbox: mailbox}, nil
+}
+
+func (s *extensionSession) ListRights(mailbox, identifier string) (*imap.ACLListRightsData, error) {
+	s.reach(mailbox)
+	return &imap.ACLListRightsData{Mailbox: mailbox, Identifier: identifier}, nil
+}
+
+func (s *extensionSession) MyRights(mailbox string) (*imap.ACLMyRightsData, error) {
+	s.reach(mailbox)
+	return &imap.ACLMyRightsData{Mailbox: mailbox}, nil
+}
+
+func (s *extensionSession) GetMetadata(mailbox string, entries []string, options *imap.MetadataOptions) (*imap.MetadataData, error) {
+	s.reach(mailbox)
+	return &imap.MetadataData{Mailbox: mailbox}, nil
+}
+
+func (s *extensionSession) SetMetadata(mailbox string, entries []imap.MetadataEntry) error {
+	s.reach(mailbox)
+	return nil
+}
+
+func (s *extensionSession) GetQuota(root string) (*imap.QuotaData, error) {
+	return &imap.QuotaData{Root: root}, nil
+}
+
+func (s *extensionSession) GetQuotaRoot(mailbox string) (*imap.QuotaRootData, []*imap.QuotaData, error) {
+	s.reach(mailbox)
+	return &imap.QuotaRootData{Mailbox: mailbox}, nil, nil
+}
+
+func (s *extensionSession) SetQuota(root string, resources []imap.QuotaResourceData) (*imap.QuotaData, error) {
+	return &imap.QuotaData{Root: root}, nil
+}
+
+func (s *extensionSession) Notify(specs []notify.NotifySpec) error {
+	for _, spec := range specs {
+		s.reach(spec.Mailbox)
+	}
+	return nil
+}
+
+func (s *extensionSession) CancelNotify() error {
+	return nil
+}
+
+// extensionAccessCases are, for extensions whose commands take mailbox
+// arguments, commands naming Shared/HR/Payroll after the setup commands.
+var extensionAccessCases = []struct {
+	name       string
+	extensions func() []extension.ServerExtension
+	setup      []string
+	denied     []string
+}{
+	{
+		name:       "UIDPLUS",
+		extensions: func() []extension.ServerExtension { return []extension.ServerExtension{uidplus.New()} },
+		setup:      []string{"SELECT INBOX"},
+		denied:     []string{"UID COPY 1 Shared/HR/Payroll"},
+	},
+	{
+		name: "UIDONLY",
+		extensions: func() []extension.ServerExtension {
+			return []extension.ServerExtension{condstore.New(), move.New(), uidonly.New()}
+		},
+		setup:  []string{"ENABLE UIDONLY", "SELECT INBOX"},
+		denied: []string{"UID MOVE 1 Shared/HR/Payroll"},
+	},
+	{
+		name: "SEARCHRES",
+		extensions: func() []extension.ServerExtension {
+			return []extension.ServerExtension{esearch.New(), move.New(), searchres.New()}
+		},
+		setup:  []string{"SELECT INBOX", "SEARCH RETURN (SAVE) ALL"},
+		denied: []string{"COPY $ Shared/HR/Payroll", "MOVE $ Shared/HR/Payroll"},
+	},
+	{
+		name: "MULTISEARCH",
+		extensions: func() []extension.ServerExtension {
+			return []extension.ServerExtension{esearch.New(), multisearch.New()}
+		},
+		denied: []string{
+			"ESEARCH IN (mailboxes Shared/HR/Payroll) ALL",
+			"ESEARCH IN (mailboxes (INBOX Shared/HR/Payroll)) ALL",
+		},
+	},
+	{
+		name: "ACL, METADATA, QUOTA and NOTIFY",
+		extensions: func() []extension.ServerExtension {
+			return []extension.ServerExtension{acl.New(), metadata.New(), quota.New(), notify.New()}
+		},
+		denied: []string{
+			"GETACL Shared/HR/Payroll",
+			"SETACL Shared/HR/Payroll bob lr",
+			"DELETEACL Shared/HR/Payroll bob",
+			"LISTRIGHTS Shared/HR/Payroll bob",
+			"MYRIGHTS Shared/HR/Payroll",
+			"GETMETADATA Shared/HR/Payroll /private/comment",
+			`SETMETADATA Shared/HR/Payroll (/private/comment "x")`,
+			"GETQUOTAROOT Shared/HR/Payroll",
+			"NOTIFY SET Shared/HR/Payroll (MessageNew)",
+		},
+	},
+}
+
+// dialExtensionAccess connects as alice to a memserver with the mailboxes
+// Shared, Shared/HR, Shared/HR/Payroll and Shared/Sales and a message in
+// INBOX, the given
+// extensions and access control opt. It returns the mailboxes passed to
+// the session.
+func dialExtensionAccess(t *testing.T, opt server.Option, extensions []extension.ServerExtension) (*testConn, func() []string) {
+	t.Helper()
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	for _, name := range []string{"Shared", "Shared/HR", "Shared/HR/Payroll", "Shared/Sales"} {
+		if err := mem.GetUserData("alice").CreateMailbox(name); err != nil {
+			t.Fatalf("CreateMailbox() error: %v", err)
+		}
+	}
+	if err := mem.Deliver("alice", "INBOX", strings.NewReader("Subject: pay\r\n\r\nx")); err != nil {
+		t.Fatalf("Deliver() error: %v", err)
+	}
+
+	var mu sync.Mutex
+	var reached []string
+	c := dialMem(t, mem, opt,
+		server.WithExtensions(extensions...),
+		server.WithNewSession(func(conn *server.Conn) (server.Session, error) {
+			sess, err := mem.NewSession(conn)
+			if err != nil {
+				return nil, err
+			}
+			return &extensionSession{Session: sess.(*memserver.Session), mu: &mu, reached: &reached}, nil
+		}),
+	)
+	if _, tagged := c.run("A1 LOGIN alice secret"); !strings.HasPrefix(tagged, "A1 OK") {
+		t.Fatalf("LOGIN: %q", tagged)
+	}
+	return c, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), reached...)
+	}
+}
+
+// checkExtensionAccess runs extensionAccessCases with access control opt,
+// which is to deny alice Shared/HR/Payroll, and checks that the commands
+// are refused with NO [NOPERM] before reaching the session.
+func checkExtensionAccess(t *testing.T, opt server.Option) {
+	for _, tc := range extensionAccessCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, reached := dialExtensionAccess(t, opt, tc.extensions())
+			for i, cmd := range tc.setup {
+				tag := fmt.Sprintf("S%d", i+1)
+				if _, tagged := c.run(tag + " " + cmd); !strings.HasPrefix(tagged, tag+" OK") {
+					t.Fatalf("%s: %q", cmd, tagged)
+				}
+			}
+			for i, cmd := range tc.denied {
+				tag := fmt.Sprintf("T%d", i+1)
+				if _, tagged := c.run(tag + " " + cmd); !strings.HasPrefix(tagged, tag+" NO [NOPERM]") {
+					t.Errorf("%s: %q, want NO [NOPERM]", cmd, tagged)
+				}
+			}
+			for _, mbox := range reached() {
+				if mbox == "Shared/HR/Payroll" {
+					t.Errorf("the session was passed %s", mbox)
+				}
+			}
+		})
+	}
+
+	// A subtree search leaves out the mailboxes that may not be accessed.
+	c, _ := dialExtensionAccess(t, opt, []extension.ServerExtension{esearch.New(), multisearch.New()})
+	untagged, tagged := c.run("T1 ESEARCH IN (subtree Shared) ALL")
+	if !strings.HasPrefix(tagged, "T1 OK") {
+		t.Fatalf("ESEARCH IN subtree: %q", tagged)
+	}
+	if results := strings.Join(untagged, "\n"); strings.Contains(results, "Payroll") || !strings.Contains(results, "Shared/Sales") {
+		t.Errorf("ESEARCH IN subtree = %q", untagged)
+	}
+}
+
+func TestMailboxAccessPolicy_Extensions(t *testing.T) {
+	checkExtensionAccess(t, server.WithMailboxAccessPolicy(&server.MailboxAccessPolicy{
+		Rules: []server.MailboxAccessRule{{Patterns: []string{"Shared/HR/*"}, Deny: true}},
+	}))
+}
+
+func TestAuthProvider_Extensions(t *testing.T) {
+	var mu sync.Mutex
+	actions := map[server.Action]bool{}
+	authorize := func(identity server.Identity, action server.Action, mailbox string) error {
+		if mailbox != "Shared/HR/Payroll" {
+			return nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		actions[action] = true
+		return imap.ErrNoWithCode(imap.ResponseCodeNoPerm, "payroll is restricted")
+	}
+	checkExtensionAccess(t, server.WithAuthProvider(authprovider.New(passwordAuthenticator("secret"), authorize)))
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Extension commands are authorized with their own names.
+	for _, action := range []server.Action{server.ActionCopy, server.ActionMove, "ESEARCH", "GETACL", "SETMETADATA", "GETQUOTAROOT", "NOTIFY"} {
+		if !actions[action] {
+			t.Errorf("Authorize() was not called with action %s, got %v", action, actions)
+		}
+	}
+}
+
+// passwordAuthenticator accepts a single password for every user.
+type passwordAuthenticator string
+
+func (a passwordAuthenticator) Authenticate(ctx context.Context, user string, credentials server.Credentials) (server.Identity, error) {
+	if credentials.Password != string(a) {
+		return server.Identity{}, imap.ErrNo("wrong password")
+	}
+	return server.Identity{Username: user}, nil
+}
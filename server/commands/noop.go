@@ -5,9 +5,14 @@ import (
 )
 
 // Noop returns a handler for the NOOP command.
-// NOOP does nothing but elicit a tagged OK response.
+// NOOP does nothing by itself, but flushes pending unsolicited updates
+// (new messages, flag changes, expunges) before the tagged OK response.
 func Noop() server.CommandHandlerFunc {
 	return func(ctx *server.CommandContext) error {
+		if err := ctx.PollUpdates(); err != nil {
+			return err
+		}
+
 		ctx.Conn.WriteOK(ctx.Tag, "NOOP completed")
 		return nil
 	}
@@ -0,0 +1,117 @@
+package commands_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/meszmate/imap-go/extension"
+	"github.com/meszmate/imap-go/extensions/condstore"
+	"github.com/meszmate/imap-go/extensions/move"
+	"github.com/meszmate/imap-go/extensions/preview"
+	"github.com/meszmate/imap-go/extensions/qresync"
+	"github.com/meszmate/imap-go/extensions/uidonly"
+	"github.com/meszmate/imap-go/extensions/uidplus"
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+// TestNumKindMatrix runs the commands taking a message set in sequence
+// number and UID mode under each extension that wraps them, in a mailbox
+// where sequence numbers and UIDs differ, so that a wrapper parsing the
+// set without regard to ctx.NumKind addresses the wrong messages.
+func TestNumKindMatrix(t *testing.T) {
+	configs := []struct {
+		name       string
+		extensions func() []extension.ServerExtension
+	}{
+		{"base", func() []extension.ServerExtension { return nil }},
+		{"CONDSTORE", func() []extension.ServerExtension {
+			return []extension.ServerExtension{condstore.New()}
+		}},
+		{"QRESYNC", func() []extension.ServerExtension {
+			return []extension.ServerExtension{condstore.New(), qresync.New()}
+		}},
+		{"UIDPLUS", func() []extension.ServerExtension {
+			return []extension.ServerExtension{uidplus.New()}
+		}},
+		{"PREVIEW", func() []extension.ServerExtension {
+			return []extension.ServerExtension{condstore.New(), preview.New()}
+		}},
+		{"UIDONLY", func() []extension.ServerExtension {
+			return []extension.ServerExtension{condstore.New(), uidonly.New()}
+		}},
+		{"all", func() []extension.ServerExtension {
+			return []extension.ServerExtension{
+				condstore.New(), qresync.New(), uidplus.New(), move.New(), preview.New(), uidonly.New(),
+			}
+		}},
+	}
+
+	// After the setup, the mailbox holds UIDs 2 and 3 as messages 1 and
+	// 2.
+	cases := []struct {
+		command  string
+		untagged []string // prefixes of the untagged responses
+		copyUID  string   // source UIDs of COPYUID, if reported
+	}{
+		{command: "FETCH 1 (UID)", untagged: []string{"* 1 FETCH (UID 2)"}},
+		{command: "UID FETCH 2 (UID)", untagged: []string{"* 1 FETCH (UID 2)"}},
+		{command: "FETCH * (UID)", untagged: []string{"* 2 FETCH (UID 3)"}},
+		{command: "UID FETCH * (UID)", untagged: []string{"* 2 FETCH (UID 3)"}},
+		{command: "FETCH 2:* (UID)", untagged: []string{"* 2 FETCH (UID 3)"}},
+		{command: "UID FETCH 1:2 (UID)", untagged: []string{"* 1 FETCH (UID 2)"}},
+		{command: "UID FETCH 3:* (UID)", untagged: []string{"* 2 FETCH (UID 3)"}},
+		{command: `STORE 1 +FLAGS (\Flagged)`, untagged: []string{"* 1 FETCH ("}},
+		{command: `UID STORE 3 +FLAGS (\Flagged)`, untagged: []string{"* 2 FETCH ("}},
+		{command: `UID STORE * -FLAGS (\Flagged)`, untagged: []string{"* 2 FETCH ("}},
+		{command: "COPY 1 Archive", copyUID: "2"},
+		{command: "UID COPY 3 Archive", copyUID: "3"},
+		{command: "COPY 1:* Archive", copyUID: "2:3"},
+		{command: `UID STORE 3 +FLAGS.SILENT (\Deleted)`},
+		{command: "UID EXPUNGE 3", untagged: []string{"* 2 EXPUNGE"}},
+	}
+
+	for _, cfg := range configs {
+		t.Run(cfg.name, func(t *testing.T) {
+			mem := memserver.New()
+			mem.AddUser("alice", "secret")
+			for _, msg := range []string{"Subject: one\r\n\r\n1", "Subject: two\r\n\r\n2", "Subject: three\r\n\r\n3"} {
+				if err := mem.Deliver("alice", "INBOX", strings.NewReader(msg)); err != nil {
+					t.Fatalf("Deliver() error: %v", err)
+				}
+			}
+			c := dialMem(t, mem, server.WithExtensions(cfg.extensions()...))
+			for _, cmd := range []string{
+				"S1 LOGIN alice secret", "S2 CREATE Archive", "S3 SELECT INBOX",
+				`S4 STORE 1 +FLAGS.SILENT (\Deleted)`, "S5 EXPUNGE",
+			} {
+				if _, tagged := c.run(cmd); !strings.HasPrefix(tagged, "S") || !strings.Contains(tagged, " OK ") {
+					t.Fatalf("%s: %s", cmd, tagged)
+				}
+			}
+
+			for i, tc := range cases {
+				tag := "T" + string(rune('A'+i))
+				untagged, tagged := c.run(tag + " " + tc.command)
+				if !strings.HasPrefix(tagged, tag+" OK ") {
+					t.Errorf("%s: %s", tc.command, tagged)
+					continue
+				}
+				if len(untagged) != len(tc.untagged) {
+					t.Errorf("%s: untagged = %q, want %q", tc.command, untagged, tc.untagged)
+					continue
+				}
+				for j, want := range tc.untagged {
+					if !strings.HasPrefix(untagged[j], want) {
+						t.Errorf("%s: untagged = %q, want %q", tc.command, untagged, tc.untagged)
+					}
+				}
+				if _, code, ok := strings.Cut(tagged, "[COPYUID "); ok && tc.copyUID != "" {
+					if fields := strings.Fields(code); len(fields) < 2 || fields[1] != tc.copyUID {
+						t.Errorf("%s: %s, want source UIDs %s", tc.command, tagged, tc.copyUID)
+					}
+				}
+			}
+		})
+	}
+}
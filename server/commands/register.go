@@ -26,6 +26,7 @@ func RegisterAll(srv *server.Server) {
 	// Not authenticated state commands
 	srv.HandleFunc(imap.CommandStartTLS, StartTLS())
 	srv.HandleFunc(imap.CommandLogin, Login())
+	srv.HandleFunc(imap.CommandAuthenticate, Authenticate())
 
 	// Authenticated state commands
 	srv.HandleFunc(imap.CommandEnable, Enable())
@@ -43,6 +44,7 @@ func RegisterAll(srv *server.Server) {
 	srv.HandleFunc(imap.CommandIdle, Idle())
 
 	// Selected state commands
+	srv.HandleFunc(imap.CommandCheck, Check())
 	srv.HandleFunc(imap.CommandClose, Close())
 	srv.HandleFunc(imap.CommandUnselect, Unselect())
 	srv.HandleFunc(imap.CommandExpunge, Expunge())
@@ -13,7 +13,7 @@ func Rename() server.CommandHandlerFunc {
 			return imap.ErrBad("missing arguments")
 		}
 
-		oldName, err := ctx.Decoder.ReadAString()
+		oldName, err := ctx.Decoder.ReadMailbox()
 		if err != nil {
 			return imap.ErrBad("invalid mailbox name")
 		}
@@ -22,11 +22,20 @@ func Rename() server.CommandHandlerFunc {
 			return imap.ErrBad("missing new mailbox name")
 		}
 
-		newName, err := ctx.Decoder.ReadAString()
+		newName, err := ctx.Decoder.ReadMailbox()
 		if err != nil {
 			return imap.ErrBad("invalid new mailbox name")
 		}
 
+		oldName, err = ctx.Conn.ValidateMailboxName(oldName)
+		if err != nil {
+			return err
+		}
+		newName, err = ctx.Conn.ValidateMailboxName(newName)
+		if err != nil {
+			return err
+		}
+
 		if err := ctx.Session.Rename(oldName, newName); err != nil {
 			return err
 		}
@@ -0,0 +1,122 @@
+package commands_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/auth/scram"
+	"github.com/meszmate/imap-go/client"
+	"github.com/meszmate/imap-go/imaptest"
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+func withAuthSCRAM() server.Option {
+	return server.WithCapabilities(imap.CapAuthSCRAMSHA256, imap.CapAuthSCRAMSHA256Plus, imap.CapSASLIR)
+}
+
+// testTLSConfig returns a server configuration with a self-signed
+// certificate for 127.0.0.1.
+func testTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "imap-go test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error: %v", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func TestAuthenticate_SCRAM(t *testing.T) {
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	h := imaptest.NewHarness(t, mem.NewServer(withAuthSCRAM()))
+
+	c := h.Dial()
+	if c.HasCap(string(imap.CapAuthSCRAMSHA256Plus)) {
+		t.Error("SCRAM-SHA-256-PLUS advertised without TLS")
+	}
+	if err := c.Authenticate(&scram.ClientMechanism{Username: "alice", Password: "wrong"}); err == nil {
+		t.Fatal("Authenticate() with a wrong password succeeded")
+	}
+	mech := &scram.ClientMechanism{Username: "alice", Password: "secret"}
+	if err := c.Authenticate(mech); err != nil {
+		t.Fatalf("Authenticate() error: %v", err)
+	}
+	if !mech.ServerVerified() {
+		t.Error("server signature not verified")
+	}
+	if _, err := c.Select("INBOX", nil); err != nil {
+		t.Errorf("Select() after AUTHENTICATE error: %v", err)
+	}
+}
+
+func TestAuthenticate_SCRAMPlus(t *testing.T) {
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	config := testTLSConfig(t)
+	srv := mem.NewServer(withAuthSCRAM(), server.WithTLS(config))
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatalf("Listen() error: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = srv.Serve(l)
+	}()
+	t.Cleanup(func() {
+		_ = srv.Close()
+		<-done
+	})
+
+	for _, version := range []uint16{tls.VersionTLS12, tls.VersionTLS13} {
+		c, err := client.DialTLS(l.Addr().String(), &tls.Config{
+			InsecureSkipVerify: true,
+			MinVersion:         version,
+			MaxVersion:         version,
+		})
+		if err != nil {
+			t.Fatalf("DialTLS() error: %v", err)
+		}
+		if !c.HasCap(string(imap.CapAuthSCRAMSHA256Plus)) {
+			t.Fatalf("SCRAM-SHA-256-PLUS not advertised over TLS: %v", c.Caps())
+		}
+		mech := &scram.ClientMechanism{Username: "alice", Password: "secret", Plus: true}
+		if err := c.Authenticate(mech); err != nil {
+			t.Errorf("TLS %x: Authenticate() error: %v", version, err)
+		}
+		_ = c.Close()
+
+		// A client that can bind but picks SCRAM-SHA-256 is refused, since
+		// the server offers the PLUS variant.
+		c, err = client.DialTLS(l.Addr().String(), &tls.Config{InsecureSkipVerify: true, MaxVersion: version})
+		if err != nil {
+			t.Fatalf("DialTLS() error: %v", err)
+		}
+		if err := c.Authenticate(&scram.ClientMechanism{Username: "alice", Password: "secret"}); err == nil {
+			t.Errorf("TLS %x: downgraded Authenticate() succeeded", version)
+		}
+		_ = c.Close()
+	}
+}
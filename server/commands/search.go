@@ -1,10 +1,6 @@
 package commands
 
 import (
-	"fmt"
-	"strings"
-	"time"
-
 	imap "github.com/meszmate/imap-go"
 	"github.com/meszmate/imap-go/server"
 	"github.com/meszmate/imap-go/wire"
@@ -18,18 +14,22 @@ func Search() server.CommandHandlerFunc {
 			return imap.ErrBad("missing search criteria")
 		}
 
-		criteria := &imap.SearchCriteria{}
-		options := &imap.SearchOptions{}
-
-		// Parse search criteria from the decoder
-		if err := parseSearchCriteria(ctx.Decoder, criteria); err != nil {
-			return imap.ErrBad("invalid search criteria: " + err.Error())
+		criteria, err := server.ParseSearch(ctx.Decoder)
+		if err != nil {
+			return err
 		}
+		if err := ctx.Conn.CheckSearchCriteria(criteria); err != nil {
+			return err
+		}
+		options := &imap.SearchOptions{}
 
-		data, err := ctx.Session.Search(ctx.NumKind, criteria, options)
+		data, err := server.RunSearch(ctx, criteria, options)
 		if err != nil {
 			return err
 		}
+		if err := ctx.Conn.CheckSearchData(data); err != nil {
+			return err
+		}
 
 		// Write SEARCH response
 		enc := ctx.Conn.Encoder()
@@ -50,292 +50,7 @@ func Search() server.CommandHandlerFunc {
 			e.CRLF()
 		})
 
-		ctx.Conn.WriteOK(ctx.Tag, "SEARCH completed")
+		ctx.Conn.WriteSearchOK(ctx.Tag, data)
 		return nil
 	}
 }
-
-func parseSearchCriteria(dec *wire.Decoder, criteria *imap.SearchCriteria) error {
-	for {
-		b, err := dec.PeekByte()
-		if err != nil {
-			// End of input
-			return nil
-		}
-		if b == ')' {
-			return nil
-		}
-
-		key, err := dec.ReadAtom()
-		if err != nil {
-			return nil // End of arguments
-		}
-
-		switch strings.ToUpper(key) {
-		case "ALL":
-			// Match all messages (no-op for criteria)
-		case "ANSWERED":
-			criteria.Flag = append(criteria.Flag, imap.FlagAnswered)
-		case "DELETED":
-			criteria.Flag = append(criteria.Flag, imap.FlagDeleted)
-		case "DRAFT":
-			criteria.Flag = append(criteria.Flag, imap.FlagDraft)
-		case "FLAGGED":
-			criteria.Flag = append(criteria.Flag, imap.FlagFlagged)
-		case "SEEN":
-			criteria.Flag = append(criteria.Flag, imap.FlagSeen)
-		case "RECENT":
-			criteria.Flag = append(criteria.Flag, imap.FlagRecent)
-		case "UNANSWERED":
-			criteria.NotFlag = append(criteria.NotFlag, imap.FlagAnswered)
-		case "UNDELETED":
-			criteria.NotFlag = append(criteria.NotFlag, imap.FlagDeleted)
-		case "UNDRAFT":
-			criteria.NotFlag = append(criteria.NotFlag, imap.FlagDraft)
-		case "UNFLAGGED":
-			criteria.NotFlag = append(criteria.NotFlag, imap.FlagFlagged)
-		case "UNSEEN":
-			criteria.NotFlag = append(criteria.NotFlag, imap.FlagSeen)
-		case "NEW":
-			criteria.Flag = append(criteria.Flag, imap.FlagRecent)
-			criteria.NotFlag = append(criteria.NotFlag, imap.FlagSeen)
-		case "OLD":
-			criteria.NotFlag = append(criteria.NotFlag, imap.FlagRecent)
-		case "KEYWORD":
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			kw, err := dec.ReadAtom()
-			if err != nil {
-				return err
-			}
-			criteria.Flag = append(criteria.Flag, imap.Flag(kw))
-		case "UNKEYWORD":
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			kw, err := dec.ReadAtom()
-			if err != nil {
-				return err
-			}
-			criteria.NotFlag = append(criteria.NotFlag, imap.Flag(kw))
-		case "LARGER":
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			n, err := dec.ReadNumber64()
-			if err != nil {
-				return err
-			}
-			criteria.Larger = int64(n)
-		case "SMALLER":
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			n, err := dec.ReadNumber64()
-			if err != nil {
-				return err
-			}
-			criteria.Smaller = int64(n)
-		case "BODY":
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			s, err := dec.ReadAString()
-			if err != nil {
-				return err
-			}
-			criteria.Body = append(criteria.Body, s)
-		case "TEXT":
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			s, err := dec.ReadAString()
-			if err != nil {
-				return err
-			}
-			criteria.Text = append(criteria.Text, s)
-		case "SUBJECT":
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			s, err := dec.ReadAString()
-			if err != nil {
-				return err
-			}
-			criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
-				Key: "Subject", Value: s,
-			})
-		case "FROM":
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			s, err := dec.ReadAString()
-			if err != nil {
-				return err
-			}
-			criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
-				Key: "From", Value: s,
-			})
-		case "TO":
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			s, err := dec.ReadAString()
-			if err != nil {
-				return err
-			}
-			criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
-				Key: "To", Value: s,
-			})
-		case "CC":
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			s, err := dec.ReadAString()
-			if err != nil {
-				return err
-			}
-			criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
-				Key: "Cc", Value: s,
-			})
-		case "BCC":
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			s, err := dec.ReadAString()
-			if err != nil {
-				return err
-			}
-			criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
-				Key: "Bcc", Value: s,
-			})
-		case "HEADER":
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			hdrName, err := dec.ReadAString()
-			if err != nil {
-				return err
-			}
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			hdrValue, err := dec.ReadAString()
-			if err != nil {
-				return err
-			}
-			criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
-				Key: hdrName, Value: hdrValue,
-			})
-		case "UID":
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			s, err := dec.ReadAtom()
-			if err != nil {
-				return err
-			}
-			uidSet, err := imap.ParseUIDSet(s)
-			if err != nil {
-				return err
-			}
-			criteria.UID = uidSet
-		case "MODSEQ":
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			modseqCrit := &imap.SearchCriteriaModSeq{}
-			// Check for optional entry-name (quoted string like "/flags/\\seen")
-			b, err := dec.PeekByte()
-			if err != nil {
-				return err
-			}
-			if b == '"' {
-				entryName, err := dec.ReadQuotedString()
-				if err != nil {
-					return err
-				}
-				modseqCrit.MetadataName = entryName
-				if err := dec.ReadSP(); err != nil {
-					return err
-				}
-				// Read entry-type: "shared", "priv", or "all"
-				entryType, err := dec.ReadAtom()
-				if err != nil {
-					return err
-				}
-				modseqCrit.MetadataType = strings.ToLower(entryType)
-				if err := dec.ReadSP(); err != nil {
-					return err
-				}
-			}
-			n, err := dec.ReadNumber64()
-			if err != nil {
-				return err
-			}
-			modseqCrit.ModSeq = n
-			criteria.ModSeq = modseqCrit
-		case "SAVEDBEFORE":
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			s, err := dec.ReadAString()
-			if err != nil {
-				return err
-			}
-			t, err := time.Parse("2-Jan-2006", s)
-			if err != nil {
-				return fmt.Errorf("invalid SAVEDBEFORE date: %w", err)
-			}
-			criteria.SavedBefore = t
-		case "SAVEDSINCE":
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			s, err := dec.ReadAString()
-			if err != nil {
-				return err
-			}
-			t, err := time.Parse("2-Jan-2006", s)
-			if err != nil {
-				return fmt.Errorf("invalid SAVEDSINCE date: %w", err)
-			}
-			criteria.SavedSince = t
-		case "SAVEDON":
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			s, err := dec.ReadAString()
-			if err != nil {
-				return err
-			}
-			t, err := time.Parse("2-Jan-2006", s)
-			if err != nil {
-				return fmt.Errorf("invalid SAVEDON date: %w", err)
-			}
-			criteria.SavedOn = t
-		case "NOT":
-			if err := dec.ReadSP(); err != nil {
-				return err
-			}
-			sub := &imap.SearchCriteria{}
-			if err := parseSearchCriteria(dec, sub); err != nil {
-				return err
-			}
-			criteria.Not = append(criteria.Not, *sub)
-		default:
-			// Try to parse as a sequence set
-			seqSet, err := imap.ParseSeqSet(key)
-			if err == nil {
-				criteria.SeqNum = seqSet
-			}
-			// Otherwise ignore unknown criteria
-		}
-
-		// Try to read SP between criteria, but don't fail if at end
-		if err := dec.ReadSP(); err != nil {
-			return nil
-		}
-	}
-}
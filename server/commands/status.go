@@ -16,11 +16,13 @@ func Status() server.CommandHandlerFunc {
 			return imap.ErrBad("missing arguments")
 		}
 
-		mailbox, err := ctx.Decoder.ReadAString()
+		mailbox, err := ctx.Decoder.ReadMailbox()
 		if err != nil {
 			return imap.ErrBad("invalid mailbox name")
 		}
 
+		mailbox = imap.CanonicalMailboxName(mailbox)
+
 		if err := ctx.Decoder.ReadSP(); err != nil {
 			return imap.ErrBad("missing status items")
 		}
@@ -59,6 +61,9 @@ func Status() server.CommandHandlerFunc {
 			return imap.ErrBad("invalid status items list")
 		}
 
+		if err := ctx.Conn.CheckMailboxAccess(mailbox); err != nil {
+			return err
+		}
 		data, err := ctx.Session.Status(mailbox, options)
 		if err != nil {
 			return err
@@ -5,6 +5,7 @@ import (
 
 	imap "github.com/meszmate/imap-go"
 	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/wire"
 )
 
 // Store returns a handler for the STORE command.
@@ -16,24 +17,9 @@ func Store() server.CommandHandlerFunc {
 		}
 
 		// Read sequence set
-		seqSetStr, err := ctx.Decoder.ReadAtom()
+		numSet, err := server.ParseNumSet(ctx)
 		if err != nil {
-			return imap.ErrBad("invalid sequence set")
-		}
-
-		var numSet imap.NumSet
-		if ctx.NumKind == server.NumKindUID {
-			uidSet, err := imap.ParseUIDSet(seqSetStr)
-			if err != nil {
-				return imap.ErrBad("invalid UID set")
-			}
-			numSet = uidSet
-		} else {
-			seqSet, err := imap.ParseSeqSet(seqSetStr)
-			if err != nil {
-				return imap.ErrBad("invalid sequence set")
-			}
-			numSet = seqSet
+			return err
 		}
 
 		if err := ctx.Decoder.ReadSP(); err != nil {
@@ -68,8 +54,8 @@ func Store() server.CommandHandlerFunc {
 			return imap.ErrBad("missing flags")
 		}
 
-		// Read flags
-		flagStrs, err := ctx.Decoder.ReadFlags()
+		// Read flags, either as a list or separated by spaces
+		flagStrs, err := readStoreFlags(ctx.Decoder)
 		if err != nil {
 			return imap.ErrBad("invalid flags")
 		}
@@ -89,3 +75,26 @@ func Store() server.CommandHandlerFunc {
 		return nil
 	}
 }
+
+// readStoreFlags reads the flags of STORE, which are either a
+// parenthesized list or one or more flags separated by spaces (RFC 3501
+// store-att-flags).
+func readStoreFlags(dec *wire.Decoder) ([]string, error) {
+	if b, err := dec.PeekByte(); err == nil && b == '(' {
+		return dec.ReadFlags()
+	}
+	var flags []string
+	for {
+		flag, err := dec.ReadFlag()
+		if err != nil {
+			return nil, err
+		}
+		flags = append(flags, flag)
+		if _, err := dec.PeekByte(); err != nil {
+			return flags, nil
+		}
+		if err := dec.ReadSP(); err != nil {
+			return nil, err
+		}
+	}
+}
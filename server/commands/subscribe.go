@@ -13,11 +13,13 @@ func Subscribe() server.CommandHandlerFunc {
 			return imap.ErrBad("missing mailbox name")
 		}
 
-		mailbox, err := ctx.Decoder.ReadAString()
+		mailbox, err := ctx.Decoder.ReadMailbox()
 		if err != nil {
 			return imap.ErrBad("invalid mailbox name")
 		}
 
+		mailbox = imap.CanonicalMailboxName(mailbox)
+
 		if err := ctx.Session.Subscribe(mailbox); err != nil {
 			return err
 		}
@@ -35,11 +37,13 @@ func Unsubscribe() server.CommandHandlerFunc {
 			return imap.ErrBad("missing mailbox name")
 		}
 
-		mailbox, err := ctx.Decoder.ReadAString()
+		mailbox, err := ctx.Decoder.ReadMailbox()
 		if err != nil {
 			return imap.ErrBad("invalid mailbox name")
 		}
 
+		mailbox = imap.CanonicalMailboxName(mailbox)
+
 		if err := ctx.Session.Unsubscribe(mailbox); err != nil {
 			return err
 		}
@@ -0,0 +1,127 @@
+package commands_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/meszmate/imap-go/extensions/move"
+	"github.com/meszmate/imap-go/extensions/multiappend"
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+// txSession is a session without MOVE and MULTIAPPEND support of its own
+// that records its transactions.
+type txSession struct {
+	server.Session
+
+	mu  *sync.Mutex
+	log *[]string
+}
+
+func (s *txSession) record(event string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*s.log = append(*s.log, event)
+	return nil
+}
+
+func (s *txSession) Begin(command string) error { return s.record("begin " + command) }
+func (s *txSession) Commit() error              { return s.record("commit") }
+func (s *txSession) Rollback() error            { return s.record("rollback") }
+
+func dialTx(t *testing.T) (*testConn, *memserver.MemServer, func() string) {
+	t.Helper()
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	for _, msg := range []string{"Subject: one\r\n\r\nfirst", "Subject: two\r\n\r\nsecond"} {
+		if err := mem.Deliver("alice", "INBOX", strings.NewReader(msg)); err != nil {
+			t.Fatalf("Deliver() error: %v", err)
+		}
+	}
+
+	var mu sync.Mutex
+	var log []string
+	srv := mem.NewServer(
+		server.WithExtensions(move.New(), multiappend.New()),
+		server.WithNewSession(func(c *server.Conn) (server.Session, error) {
+			sess, err := mem.NewSession(c)
+			return &txSession{Session: sess, mu: &mu, log: &log}, err
+		}),
+	)
+	c := dialServer(t, srv)
+	for _, cmd := range []string{"T1 LOGIN alice secret", "T2 CREATE Archive", "T3 SELECT INBOX"} {
+		if _, tagged := c.run(cmd); !strings.Contains(tagged, " OK") {
+			t.Fatalf("%s: %q", cmd, tagged)
+		}
+	}
+	events := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		s := strings.Join(log, ", ")
+		log = nil
+		return s
+	}
+	return c, mem, events
+}
+
+func TestTransaction_Close(t *testing.T) {
+	c, mem, events := dialTx(t)
+	c.run(`A1 STORE 1 +FLAGS.SILENT (\Deleted)`)
+	if _, tagged := c.run("A2 CLOSE"); tagged != "A2 OK CLOSE completed" {
+		t.Fatalf("CLOSE = %q", tagged)
+	}
+	if got := events(); got != "begin CLOSE, commit" {
+		t.Errorf("transaction = %q", got)
+	}
+	if n := mem.GetUserData("alice").GetMailbox("INBOX").NumMessages(); n != 1 {
+		t.Errorf("INBOX has %d messages, want 1", n)
+	}
+}
+
+func TestTransaction_MoveFallback(t *testing.T) {
+	c, mem, events := dialTx(t)
+	c.run(`A1 STORE 2 +FLAGS.SILENT (\Deleted)`)
+
+	untagged, tagged := c.run("A2 MOVE 1 Archive")
+	if tagged != "A2 OK MOVE completed" {
+		t.Fatalf("MOVE = %q", tagged)
+	}
+	if len(untagged) != 2 || !strings.HasPrefix(untagged[0], "* OK [COPYUID ") || untagged[1] != "* 1 EXPUNGE" {
+		t.Errorf("untagged = %q", untagged)
+	}
+	if got := events(); got != "begin MOVE, commit" {
+		t.Errorf("transaction = %q", got)
+	}
+	user := mem.GetUserData("alice")
+	if n := user.GetMailbox("Archive").NumMessages(); n != 1 {
+		t.Errorf("Archive has %d messages, want 1", n)
+	}
+	// Only the moved message is expunged.
+	if n := user.GetMailbox("INBOX").NumMessages(); n != 1 {
+		t.Errorf("INBOX has %d messages, want 1", n)
+	}
+
+	if _, tagged := c.run("A3 MOVE 1 Missing"); !strings.HasPrefix(tagged, "A3 NO") {
+		t.Errorf("MOVE to a missing mailbox = %q", tagged)
+	}
+	if got := events(); got != "begin MOVE, rollback" {
+		t.Errorf("transaction = %q", got)
+	}
+}
+
+func TestTransaction_MultiAppend(t *testing.T) {
+	c, mem, events := dialTx(t)
+
+	_, tagged := c.run("A1 APPEND Archive {5+}\r\nfirst {6+}\r\nsecond")
+	if !strings.HasPrefix(tagged, "A1 OK") {
+		t.Fatalf("APPEND = %q", tagged)
+	}
+	if got := events(); got != "begin APPEND, commit" {
+		t.Errorf("transaction = %q", got)
+	}
+	if n := mem.GetUserData("alice").GetMailbox("Archive").NumMessages(); n != 2 {
+		t.Errorf("Archive has %d messages, want 2", n)
+	}
+}
@@ -2,9 +2,13 @@ package server
 
 import (
 	"crypto/tls"
+	"io"
 	"log/slog"
 	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	imap "github.com/meszmate/imap-go"
 	"github.com/meszmate/imap-go/state"
@@ -25,25 +29,97 @@ type Conn struct {
 
 	logger *slog.Logger
 
+	// handlers are the command handlers and extensions of the server when
+	// the connection was accepted.
+	handlers *handlerSet
+
 	mu       sync.Mutex
 	isTLS    bool
 	mailbox  string
 	readOnly bool
 	closed   bool
+	language string
+	username string
+	// identity is the identity returned by the AuthProvider.
+	identity *Identity
+	// command is the name of the command being handled.
+	command string
+
+	// caps is the snapshot of the advertised capabilities, computed by
+	// Capabilities and cleared by InvalidateCapabilities. capsGen counts
+	// invalidations, so that a snapshot computed concurrently with one is
+	// not stored.
+	caps    *capSnapshot
+	capsGen uint64
+
+	// autoCreated counts mailboxes created by AppendMessage.
+	autoCreated int
+
+	// inProgress counts the commands being handled on this connection.
+	inProgress atomic.Int32
+
+	// badResponses counts consecutive BAD responses, for
+	// ResponseCodePolicy.ClientBugThreshold.
+	badResponses atomic.Int32
+
+	// protocolErrors is the history of recent BAD responses, see
+	// ProtocolErrors.
+	protocolErrors protocolErrorLog
+
+	// literal tracks the literal being uploaded, see ReadLiteral.
+	literal literalState
+
+	// readTimedOut is set when reading the data of a command timed out,
+	// leaving the rest of the command unread.
+	readTimedOut atomic.Bool
+
+	// lost is set when a read from the client failed other than by
+	// timing out: the client went away or the connection was closed.
+	lost atomic.Bool
+
+	// expungeIssued is set by SetExpungeIssued.
+	expungeIssued atomic.Bool
+
+	// bytesRead and bytesWritten count the traffic of the connection, see
+	// BytesRead and BytesWritten.
+	bytesRead    atomic.Int64
+	bytesWritten atomic.Int64
+
+	// id identifies the connection in Server.Connections and Server.Kick.
+	id uint64
+	// connectedAt is when the connection was accepted, and lastActive the
+	// time, in Unix nanoseconds, a command was last read or completed.
+	connectedAt time.Time
+	lastActive  atomic.Int64
+
+	// sessionClose calls Session.Close once, see closeSession.
+	sessionClose sync.Once
+
+	// fetchBudget limits the memory used by spooled FETCH responses. It
+	// is nil if Options.FetchMemoryBudget is 0.
+	fetchBudget *memBudget
 }
 
 // newConn creates a new connection.
 func newConn(netConn net.Conn, srv *Server) *Conn {
-	enc := wire.NewEncoder(netConn)
 	c := &Conn{
 		netConn: netConn,
 		server:  srv,
-		decoder: wire.NewDecoder(netConn),
-		encoder: NewResponseEncoder(enc),
 		state:   state.New(imap.ConnStateNotAuthenticated),
 		enabled: imap.NewCapSet(),
 		logger:  srv.options.Logger.With("remote", netConn.RemoteAddr().String()),
+
+		id:          srv.nextConnID.Add(1),
+		connectedAt: time.Now(),
+	}
+	c.lastActive.Store(c.connectedAt.UnixNano())
+	c.decoder = wire.NewDecoder(c.lossReader(netConn))
+	c.handlers = srv.handlers.Load()
+	if srv.options.FetchMemoryBudget > 0 {
+		c.fetchBudget = &memBudget{limit: srv.options.FetchMemoryBudget}
 	}
+	c.decoder.SetTrace(c.wireTrace())
+	c.encoder = c.newEncoder(c.timeoutWriter(netConn))
 
 	_, c.isTLS = netConn.(*tls.Conn)
 
@@ -57,7 +133,11 @@ func (c *Conn) State() imap.ConnState {
 
 // SetState transitions the connection to a new state.
 func (c *Conn) SetState(s imap.ConnState) error {
-	return c.state.Transition(s)
+	if err := c.state.Transition(s); err != nil {
+		return err
+	}
+	c.InvalidateCapabilities()
+	return nil
 }
 
 // Enabled returns the set of enabled capabilities for this connection.
@@ -72,6 +152,18 @@ func (c *Conn) IsTLS() bool {
 	return c.isTLS
 }
 
+// TLSConnectionState returns the state of the TLS connection, and false if
+// the connection does not use TLS.
+func (c *Conn) TLSConnectionState() (tls.ConnectionState, bool) {
+	c.mu.Lock()
+	tlsConn, ok := c.netConn.(*tls.Conn)
+	c.mu.Unlock()
+	if !ok {
+		return tls.ConnectionState{}, false
+	}
+	return tlsConn.ConnectionState(), true
+}
+
 // Mailbox returns the currently selected mailbox name.
 func (c *Conn) Mailbox() string {
 	c.mu.Lock()
@@ -94,6 +186,22 @@ func (c *Conn) IsReadOnly() bool {
 	return c.readOnly
 }
 
+// Username returns the name the user authenticated with, or "" before
+// authentication.
+func (c *Conn) Username() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.username
+}
+
+// SetUsername records the name the user authenticated with. LOGIN and
+// AUTHENTICATE call it on success.
+func (c *Conn) SetUsername(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.username = name
+}
+
 // RemoteAddr returns the remote address of the connection.
 func (c *Conn) RemoteAddr() net.Addr {
 	return c.netConn.RemoteAddr()
@@ -124,7 +232,10 @@ func (c *Conn) Logger() *slog.Logger {
 	return c.logger
 }
 
-// Close closes the connection.
+// Close closes the connection. It can be called from any goroutine, any
+// number of times. A command in progress fails to read from or write to
+// the connection, and no response is written for it; the session is
+// closed once that command has returned, see closeSession.
 func (c *Conn) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -132,67 +243,104 @@ func (c *Conn) Close() error {
 		return nil
 	}
 	c.closed = true
-
-	if c.session != nil {
-		_ = c.session.Close()
-	}
 	return c.netConn.Close()
 }
 
-// WriteOK writes a tagged OK response.
-func (c *Conn) WriteOK(tag, text string) {
-	c.encoder.Encode(func(enc *wire.Encoder) {
-		enc.StatusResponse(tag, "OK", "", text)
+// closeSession calls Session.Close. It is called by the goroutine serving
+// the connection after its last command has returned, so that
+// Session.Close is called exactly once and never concurrently with the
+// handler of a command.
+func (c *Conn) closeSession() {
+	c.sessionClose.Do(func() {
+		if c.session != nil {
+			_ = c.session.Close()
+		}
 	})
 }
 
-// WriteOKCode writes a tagged OK response with a response code.
-func (c *Conn) WriteOKCode(tag, code, text string) {
-	c.encoder.Encode(func(enc *wire.Encoder) {
-		enc.StatusResponse(tag, "OK", code, text)
-	})
+// WriteOK writes a tagged OK response.
+func (c *Conn) WriteOK(tag, text string) {
+	c.writeStatus(tag, imap.StatusResponseTypeOK, "", text)
 }
 
 // WriteNO writes a tagged NO response.
 func (c *Conn) WriteNO(tag, text string) {
-	c.encoder.Encode(func(enc *wire.Encoder) {
-		enc.StatusResponse(tag, "NO", "", text)
-	})
+	c.writeStatus(tag, imap.StatusResponseTypeNO, "", text)
 }
 
 // WriteBAD writes a tagged BAD response.
 func (c *Conn) WriteBAD(tag, text string) {
-	c.encoder.Encode(func(enc *wire.Encoder) {
-		enc.StatusResponse(tag, "BAD", "", text)
-	})
+	c.writeStatus(tag, imap.StatusResponseTypeBAD, "", text)
 }
 
 // WriteBYE writes an untagged BYE response.
 func (c *Conn) WriteBYE(text string) {
+	c.writeStatus("*", imap.StatusResponseTypeBYE, "", text)
+}
+
+// writeStatus writes a status response, passing user-visible text through
+// the server's Translator. args are the arguments of the response code,
+// see WriteStatusResponse.
+func (c *Conn) writeStatus(tag string, typ imap.StatusResponseType, code imap.ResponseCode, text string, args ...any) {
+	code = c.applyExpungeIssued(tag, typ, code)
+	code = c.applyResponseCodePolicy(tag, typ, code)
+	if typ == imap.StatusResponseTypeBAD {
+		c.recordProtocolError(tag, text)
+	}
+	text = responseText(c.translate(typ, code, text))
+	codeStr := formatResponseCode(code, args)
 	c.encoder.Encode(func(enc *wire.Encoder) {
-		enc.StatusResponse("*", "BYE", "", text)
+		enc.StatusResponse(tag, string(typ), codeStr, text)
 	})
 }
 
-// WriteCapabilities writes an untagged CAPABILITY response.
-func (c *Conn) WriteCapabilities() {
-	caps := c.server.Capabilities(c)
-	capStrs := make([]string, len(caps))
-	for i, cap := range caps {
-		capStrs[i] = string(cap)
+// responseText returns text with its control characters, CR and LF
+// included, replaced with spaces. The text of status responses can come
+// from outside the server, such as the reason of Kick or the rejection of
+// a message filter, and is written as is, so a line break in it would let
+// its author inject responses into the connection.
+func responseText(text string) string {
+	if strings.IndexFunc(text, isCTL) < 0 {
+		return text
 	}
+	return strings.Map(func(r rune) rune {
+		if isCTL(r) {
+			return ' '
+		}
+		return r
+	}, text)
+}
 
+// isCTL reports whether r is a control character (RFC 9051 CTL).
+func isCTL(r rune) bool {
+	return r < 0x20 || r == 0x7f
+}
+
+// WriteCapabilities writes an untagged CAPABILITY response.
+func (c *Conn) WriteCapabilities() {
+	snap := c.capabilities()
 	c.encoder.Encode(func(enc *wire.Encoder) {
-		enc.Star().Atom("CAPABILITY")
-		for _, cap := range capStrs {
-			enc.SP().Atom(cap)
-		}
-		enc.CRLF()
+		enc.Star().Atom("CAPABILITY").SP().Atom(snap.text).CRLF()
 	})
 }
 
-// WriteContinuation writes a continuation request.
+// WriteOKCapabilities writes a tagged OK response with a CAPABILITY
+// response code, as sent after authentication.
+func (c *Conn) WriteOKCapabilities(tag, text string) {
+	caps := c.capabilities().caps
+	args := make([]any, len(caps))
+	for i, cap := range caps {
+		args[i] = cap
+	}
+	c.writeStatus(tag, imap.StatusResponseTypeOK, imap.ResponseCodeCapability, text, args...)
+}
+
+// WriteContinuation writes a continuation request, after
+// Options.ContinuationDelay.
 func (c *Conn) WriteContinuation(text string) {
+	if d := c.server.options.ContinuationDelay; d > 0 {
+		time.Sleep(d)
+	}
 	c.encoder.Encode(func(enc *wire.Encoder) {
 		enc.ContinuationRequest(text)
 	})
@@ -208,11 +356,59 @@ func (c *Conn) Decoder() *wire.Decoder {
 	return c.decoder
 }
 
-// writeGreeting writes the initial server greeting.
-func (c *Conn) writeGreeting() {
-	c.encoder.Encode(func(enc *wire.Encoder) {
-		enc.StatusResponse("*", "OK", "", c.server.options.GreetingText)
-	})
+// capSnapshot is the capabilities advertised on a connection in a given
+// state.
+type capSnapshot struct {
+	caps []imap.Cap // as returned by imap.DedupCaps
+	text string     // caps separated by spaces, as written on the wire
+}
+
+// Capabilities returns the capabilities advertised on the connection in
+// its current state, in the order of imap.SortCaps and without the
+// duplicates removed by imap.DedupCaps. They are computed with
+// Server.Capabilities on first use and cached until the connection changes
+// state, upgrades to TLS or enables a capability, so that the greeting,
+// the CAPABILITY command and CAPABILITY response codes agree.
+func (c *Conn) Capabilities() []imap.Cap {
+	return append([]imap.Cap(nil), c.capabilities().caps...)
+}
+
+// InvalidateCapabilities discards the cached capabilities of the
+// connection, see Capabilities. Extensions whose capabilities depend on
+// other connection properties than its state, TLS and enabled
+// capabilities call it when these change.
+func (c *Conn) InvalidateCapabilities() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.caps = nil
+	c.capsGen++
+}
+
+// capabilities returns the cached capability snapshot, computing it if
+// needed.
+func (c *Conn) capabilities() *capSnapshot {
+	c.mu.Lock()
+	snap, gen := c.caps, c.capsGen
+	c.mu.Unlock()
+	if snap != nil {
+		return snap
+	}
+
+	// Server.Capabilities may call back into the connection, so it runs
+	// without c.mu.
+	caps := imap.DedupCaps(c.server.Capabilities(c))
+	strs := make([]string, len(caps))
+	for i, cap := range caps {
+		strs[i] = string(cap)
+	}
+	snap = &capSnapshot{caps: caps, text: strings.Join(strs, " ")}
+
+	c.mu.Lock()
+	if c.capsGen == gen {
+		c.caps = snap
+	}
+	c.mu.Unlock()
+	return snap
 }
 
 // UpgradeTLS upgrades the connection to TLS.
@@ -225,20 +421,53 @@ func (c *Conn) UpgradeTLS(config *tls.Config) error {
 	c.mu.Lock()
 	c.netConn = tlsConn
 	c.isTLS = true
+	c.caps = nil
+	c.capsGen++
 	c.mu.Unlock()
 
 	// Re-create decoder and encoder with the new connection
-	c.decoder = wire.NewDecoder(tlsConn)
-	c.encoder = NewResponseEncoder(wire.NewEncoder(tlsConn))
+	c.decoder = wire.NewDecoder(c.lossReader(tlsConn))
+	c.decoder.SetTrace(c.wireTrace())
+	c.encoder = c.newEncoder(c.timeoutWriter(tlsConn))
 
 	return nil
 }
 
+// newEncoder creates the response encoder for w. With
+// Options.WriteFairness, writes go through the server's scheduler.
+func (c *Conn) newEncoder(w io.Writer) *ResponseEncoder {
+	if c.server.writes != nil {
+		w = c.server.writes.writer(w)
+	}
+	enc := wire.NewEncoder(&countingWriter{w: w, n: &c.bytesWritten})
+	enc.SetTrace(c.wireTrace())
+	re := NewResponseEncoder(enc)
+	re.budget = c.fetchBudget
+	re.spoolDir = c.server.options.SpoolDir
+	return re
+}
+
+// wireTrace returns the Options.WireTrace callback bound to c, or nil.
+func (c *Conn) wireTrace() wire.TraceFunc {
+	fn := c.server.options.WireTrace
+	if fn == nil {
+		return nil
+	}
+	return func(dir wire.Direction, data []byte) {
+		fn(c, dir, data)
+	}
+}
+
 // serve is the main connection loop.
 func (c *Conn) serve() {
-	defer func() { _ = c.Close() }()
+	defer func() {
+		_ = c.Close()
+		c.closeSession()
+	}()
 
-	c.writeGreeting()
+	if !c.writeGreeting() {
+		return
+	}
 
 	for {
 		if err := c.readAndHandle(); err != nil {
@@ -254,7 +483,10 @@ func (c *Conn) serve() {
 
 // readAndHandle reads and dispatches a single command.
 func (c *Conn) readAndHandle() error {
-	line, err := c.decoder.ReadLine()
+	line, err := c.readLine()
+	if e, ok := isLineTooLong(err); ok {
+		return c.rejectLongLine(e)
+	}
 	if err != nil {
 		return err
 	}
@@ -262,10 +494,20 @@ func (c *Conn) readAndHandle() error {
 	tag, name, rest, err := parseLine(line)
 	if err != nil {
 		c.WriteBAD("*", err.Error())
-		return nil
+		return c.checkProtocolErrors()
+	}
+	if rejected, err := c.checkCommandLimits(tag, rest); rejected {
+		return err
 	}
 
 	c.logger.Debug("command", "tag", tag, "name", name)
 
-	return c.server.dispatch(c, tag, name, rest)
+	c.touch()
+	err = c.server.dispatch(c, tag, name, rest)
+	c.finishLiteral()
+	c.touch()
+	if err != nil {
+		return err
+	}
+	return c.checkProtocolErrors()
 }
@@ -0,0 +1,37 @@
+// Package delivery injects messages accepted by a mail transfer agent into
+// an IMAP backend.
+//
+// A backend implements Backend. Messages can be delivered by calling
+// Deliver directly, or over LMTP (RFC 2033) with LMTPServer, which most
+// MTAs support as a final delivery transport:
+//
+//	ms := memserver.New()
+//	lmtp := &delivery.LMTPServer{Backend: ms}
+//	go lmtp.ListenAndServe("127.0.0.1:2424")
+//
+// Filtered passes messages through filters before they are delivered, such
+// as a spam filter adding an X-Spam-Score field or refusing the message.
+//
+// Backends notify connected IMAP sessions of delivered messages through
+// their usual update mechanism, so selected and idling clients see the
+// new messages.
+package delivery
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrUnknownUser is returned by Backend.Deliver if the user does not exist.
+var ErrUnknownUser = errors.New("delivery: unknown user")
+
+// ErrNoSuchMailbox is returned by Backend.Deliver if the mailbox does not
+// exist.
+var ErrNoSuchMailbox = errors.New("delivery: no such mailbox")
+
+// Backend is a mail store that accepts delivered messages.
+type Backend interface {
+	// Deliver appends the message read from literal to a mailbox of a
+	// user. literal contains the full RFC 5322 message.
+	Deliver(user, mailbox string, literal io.Reader) error
+}
@@ -0,0 +1,36 @@
+package delivery
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/meszmate/imap-go/server"
+)
+
+// Filtered returns a Backend that runs filters on each message before
+// delivering it to b, with the same guarantees as for APPEND: see
+// server.MessageFilterFunc. Filters run once per recipient, with the user
+// and mailbox of the recipient. A filter refusing a message makes Deliver
+// return its *server.MessageRejectedError, which LMTPServer reports to the
+// sender.
+func Filtered(b Backend, filters ...server.MessageFilterFunc) Backend {
+	return &filteredBackend{backend: b, filters: filters}
+}
+
+type filteredBackend struct {
+	backend Backend
+	filters []server.MessageFilterFunc
+}
+
+func (f *filteredBackend) Deliver(user, mailbox string, literal io.Reader) error {
+	msg, err := io.ReadAll(literal)
+	if err != nil {
+		return fmt.Errorf("delivery: reading message: %w", err)
+	}
+	msg, err = server.FilterMessage(f.filters, user, mailbox, msg)
+	if err != nil {
+		return err
+	}
+	return f.backend.Deliver(user, mailbox, bytes.NewReader(msg))
+}
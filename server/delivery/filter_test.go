@@ -0,0 +1,49 @@
+package delivery
+
+import (
+	"testing"
+
+	"github.com/meszmate/imap-go/server"
+)
+
+func TestFiltered(t *testing.T) {
+	srv, backend := newTestLMTPServer()
+	srv.Backend = Filtered(srv.Backend, func(m *server.IncomingMessage) error {
+		switch m.User {
+		case "bob@example.org":
+			return &server.MessageRejectedError{Text: "Spam refused"}
+		case "carol@example.org":
+			return &server.MessageRejectedError{Text: "Try again later", Temporary: true}
+		}
+		m.AddHeader("X-Delivered-To", m.User+" "+m.Mailbox)
+		return nil
+	})
+	c := dialLMTP(t, srv)
+	c.reply()
+	c.cmd("LHLO client.example.org")
+	c.cmd("MAIL FROM:<sender@example.org>")
+	for _, rcpt := range []string{"alice@example.org", "bob@example.org", "carol@example.org"} {
+		c.cmd("RCPT TO:<" + rcpt + ">")
+	}
+	c.cmd("DATA")
+	c.data("Subject: hello\r\n\r\nhi\r\n")
+	for _, want := range []string{
+		"250 2.0.0 <alice@example.org> Delivered",
+		"550 5.7.1 <bob@example.org> Spam refused",
+		"451 4.7.1 <carol@example.org> Try again later",
+	} {
+		if got := c.reply(); got != want {
+			t.Errorf("delivery reply = %q, want %q", got, want)
+		}
+	}
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	want := "X-Delivered-To: alice@example.org INBOX\r\nSubject: hello\r\n\r\nhi\r\n"
+	if got := backend.delivered["alice@example.org/INBOX"]; got != want {
+		t.Errorf("delivered = %q, want %q", got, want)
+	}
+	if len(backend.delivered) != 1 {
+		t.Errorf("delivered = %q, want only alice's message", backend.delivered)
+	}
+}
@@ -0,0 +1,317 @@
+package delivery
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+
+	"github.com/meszmate/imap-go/server"
+)
+
+// ErrServerClosed is returned by LMTPServer.Serve after Close.
+var ErrServerClosed = errors.New("delivery: server closed")
+
+// LMTPServer accepts messages over LMTP (RFC 2033) and delivers them to a
+// Backend. Each recipient gets its own delivery status after DATA.
+type LMTPServer struct {
+	// Backend receives the delivered messages.
+	Backend Backend
+
+	// Resolve maps a recipient address to a user and mailbox. An error
+	// rejects the recipient. If nil, the address is used as the user name
+	// and messages are delivered to INBOX.
+	Resolve func(rcpt string) (user, mailbox string, err error)
+
+	// Hostname is announced in the greeting. Defaults to "localhost".
+	Hostname string
+
+	// MaxMessageSize limits the size of a message in bytes. Zero means no
+	// limit.
+	MaxMessageSize int64
+
+	// Logger receives delivery errors. Defaults to slog.Default().
+	Logger *slog.Logger
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	closed    bool
+}
+
+// ListenAndServe listens on the TCP address addr and serves LMTP.
+func (s *LMTPServer) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts LMTP connections on l until Close is called.
+func (s *LMTPServer) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = l.Close()
+		return ErrServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		go s.ServeConn(c)
+	}
+}
+
+// Close stops all listeners. Connections in progress are not interrupted.
+func (s *LMTPServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// ServeConn runs an LMTP session on c and closes it when done.
+func (s *LMTPServer) ServeConn(c net.Conn) {
+	defer c.Close()
+
+	sess := &lmtpSession{
+		srv:  s,
+		text: textproto.NewConn(c),
+	}
+	sess.serve()
+}
+
+func (s *LMTPServer) hostname() string {
+	if s.Hostname != "" {
+		return s.Hostname
+	}
+	return "localhost"
+}
+
+func (s *LMTPServer) logger() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return slog.Default()
+}
+
+func (s *LMTPServer) resolve(rcpt string) (user, mailbox string, err error) {
+	if s.Resolve != nil {
+		return s.Resolve(rcpt)
+	}
+	return rcpt, "INBOX", nil
+}
+
+// recipient is an accepted RCPT TO.
+type recipient struct {
+	addr    string
+	user    string
+	mailbox string
+}
+
+// lmtpSession is the state of one LMTP connection.
+type lmtpSession struct {
+	srv        *LMTPServer
+	text       *textproto.Conn
+	greeted    bool
+	from       bool
+	recipients []recipient
+}
+
+func (sess *lmtpSession) reply(code int, format string, args ...interface{}) bool {
+	return sess.text.PrintfLine("%d %s", code, fmt.Sprintf(format, args...)) == nil
+}
+
+func (sess *lmtpSession) reset() {
+	sess.from = false
+	sess.recipients = nil
+}
+
+func (sess *lmtpSession) serve() {
+	if !sess.reply(220, "%s LMTP ready", sess.srv.hostname()) {
+		return
+	}
+
+	for {
+		line, err := sess.text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "LHLO":
+			sess.greeted = true
+			sess.reset()
+			err = sess.text.PrintfLine("250-%s\r\n250-PIPELINING\r\n250-ENHANCEDSTATUSCODES\r\n250 8BITMIME", sess.srv.hostname())
+			if err != nil {
+				return
+			}
+		case "MAIL":
+			sess.mail(arg)
+		case "RCPT":
+			sess.rcpt(arg)
+		case "DATA":
+			if !sess.data() {
+				return
+			}
+		case "RSET":
+			sess.reset()
+			sess.reply(250, "2.0.0 OK")
+		case "NOOP":
+			sess.reply(250, "2.0.0 OK")
+		case "QUIT":
+			sess.reply(221, "2.0.0 Bye")
+			return
+		default:
+			sess.reply(500, "5.5.2 Unknown command")
+		}
+	}
+}
+
+func (sess *lmtpSession) mail(arg string) {
+	switch {
+	case !sess.greeted:
+		sess.reply(503, "5.5.1 Send LHLO first")
+	case sess.from:
+		sess.reply(503, "5.5.1 Sender already specified")
+	default:
+		if _, ok := parsePath(arg, "FROM:"); !ok {
+			sess.reply(501, "5.5.4 Syntax: MAIL FROM:<address>")
+			return
+		}
+		sess.from = true
+		sess.reply(250, "2.1.0 OK")
+	}
+}
+
+func (sess *lmtpSession) rcpt(arg string) {
+	if !sess.from {
+		sess.reply(503, "5.5.1 Send MAIL first")
+		return
+	}
+	addr, ok := parsePath(arg, "TO:")
+	if !ok || addr == "" {
+		sess.reply(501, "5.5.4 Syntax: RCPT TO:<address>")
+		return
+	}
+	user, mailbox, err := sess.srv.resolve(addr)
+	if err != nil {
+		sess.reply(550, "5.1.1 <%s> User unknown", addr)
+		return
+	}
+	sess.recipients = append(sess.recipients, recipient{addr: addr, user: user, mailbox: mailbox})
+	sess.reply(250, "2.1.5 OK")
+}
+
+// data reads the message and replies once per recipient. It returns false
+// if the connection failed.
+func (sess *lmtpSession) data() bool {
+	if len(sess.recipients) == 0 {
+		return sess.reply(503, "5.5.1 No valid recipients")
+	}
+	if !sess.reply(354, "Start mail input; end with <CRLF>.<CRLF>") {
+		return false
+	}
+
+	dr := sess.text.DotReader()
+	var r io.Reader = dr
+	limit := sess.srv.MaxMessageSize
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	msg, err := io.ReadAll(r)
+	if err != nil {
+		return false
+	}
+	tooLarge := limit > 0 && int64(len(msg)) > limit
+	if tooLarge {
+		// Discard the rest of the message.
+		if _, err := io.Copy(io.Discard, dr); err != nil {
+			return false
+		}
+	}
+	// The dot reader turns CRLF into LF; IMAP messages use CRLF.
+	msg = bytes.ReplaceAll(msg, []byte("\n"), []byte("\r\n"))
+
+	recipients := sess.recipients
+	sess.reset()
+	for _, rcpt := range recipients {
+		if tooLarge {
+			if !sess.reply(552, "5.3.4 <%s> Message too big", rcpt.addr) {
+				return false
+			}
+			continue
+		}
+
+		var ok bool
+		var rejected *server.MessageRejectedError
+		switch err := sess.srv.Backend.Deliver(rcpt.user, rcpt.mailbox, bytes.NewReader(msg)); {
+		case err == nil:
+			ok = sess.reply(250, "2.0.0 <%s> Delivered", rcpt.addr)
+		case errors.As(err, &rejected) && rejected.Temporary:
+			ok = sess.reply(451, "4.7.1 <%s> %s", rcpt.addr, rejected.Text)
+		case errors.As(err, &rejected):
+			ok = sess.reply(550, "5.7.1 <%s> %s", rcpt.addr, rejected.Text)
+		case errors.Is(err, ErrUnknownUser):
+			ok = sess.reply(550, "5.1.1 <%s> User unknown", rcpt.addr)
+		case errors.Is(err, ErrNoSuchMailbox):
+			ok = sess.reply(550, "5.2.0 <%s> Mailbox unavailable", rcpt.addr)
+		default:
+			sess.srv.logger().Error("lmtp delivery failed", "rcpt", rcpt.addr, "error", err)
+			ok = sess.reply(451, "4.3.0 <%s> Temporary delivery failure", rcpt.addr)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// parsePath parses "FROM:<addr>" or "TO:<addr>", ignoring any parameters
+// after the path.
+func parsePath(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	arg = strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(arg, "<") {
+		return "", false
+	}
+	end := strings.IndexByte(arg, '>')
+	if end < 0 {
+		return "", false
+	}
+	return arg[1:end], true
+}
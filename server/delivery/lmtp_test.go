@@ -0,0 +1,186 @@
+package delivery
+
+import (
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakeBackend struct {
+	mu        sync.Mutex
+	delivered map[string]string // user/mailbox -> message
+}
+
+func (b *fakeBackend) Deliver(user, mailbox string, literal io.Reader) error {
+	if user == "nobody@example.org" {
+		return ErrUnknownUser
+	}
+	data, err := io.ReadAll(literal)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.delivered[user+"/"+mailbox] = string(data)
+	return nil
+}
+
+// lmtpClient is a minimal LMTP client for tests.
+type lmtpClient struct {
+	t    *testing.T
+	text *textproto.Conn
+}
+
+func dialLMTP(t *testing.T, srv *LMTPServer) *lmtpClient {
+	t.Helper()
+	client, server := net.Pipe()
+	go srv.ServeConn(server)
+	t.Cleanup(func() { client.Close() })
+	return &lmtpClient{t: t, text: textproto.NewConn(client)}
+}
+
+// reply reads one reply and returns it as "code message".
+func (c *lmtpClient) reply() string {
+	c.t.Helper()
+	code, msg, err := c.text.ReadResponse(0)
+	if err != nil && code == 0 {
+		c.t.Fatalf("reading reply: %v", err)
+	}
+	return strconv.Itoa(code) + " " + strings.ReplaceAll(msg, "\n", "|")
+}
+
+func (c *lmtpClient) cmd(line string) string {
+	c.t.Helper()
+	if err := c.text.PrintfLine("%s", line); err != nil {
+		c.t.Fatalf("writing %q: %v", line, err)
+	}
+	return c.reply()
+}
+
+func (c *lmtpClient) data(msg string) {
+	c.t.Helper()
+	w := c.text.DotWriter()
+	if _, err := io.WriteString(w, msg); err != nil {
+		c.t.Fatalf("writing message: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		c.t.Fatalf("writing message: %v", err)
+	}
+}
+
+func newTestLMTPServer() (*LMTPServer, *fakeBackend) {
+	backend := &fakeBackend{delivered: make(map[string]string)}
+	return &LMTPServer{
+		Backend:  backend,
+		Hostname: "mx.example.org",
+		Resolve: func(rcpt string) (string, string, error) {
+			if strings.HasPrefix(rcpt, "invalid@") {
+				return "", "", ErrUnknownUser
+			}
+			// user+Folder@domain delivers to Folder.
+			local, domain, _ := strings.Cut(rcpt, "@")
+			user, folder, ok := strings.Cut(local, "+")
+			if !ok {
+				folder = "INBOX"
+			}
+			return user + "@" + domain, folder, nil
+		},
+	}, backend
+}
+
+func TestLMTPServer(t *testing.T) {
+	srv, backend := newTestLMTPServer()
+	c := dialLMTP(t, srv)
+
+	steps := []struct{ cmd, want string }{
+		{"", "220 mx.example.org LMTP ready"},
+		{"MAIL FROM:<sender@example.org>", "503 5.5.1 Send LHLO first"},
+		{"LHLO client.example.org", "250 mx.example.org|PIPELINING|ENHANCEDSTATUSCODES|8BITMIME"},
+		{"DATA", "503 5.5.1 No valid recipients"},
+		{"MAIL FROM:<sender@example.org>", "250 2.1.0 OK"},
+		{"RCPT TO:<alice@example.org>", "250 2.1.5 OK"},
+		{"RCPT TO:<invalid@example.org>", "550 5.1.1 <invalid@example.org> User unknown"},
+		{"RCPT TO:<alice+Lists@example.org>", "250 2.1.5 OK"},
+		{"RCPT TO:<nobody@example.org>", "250 2.1.5 OK"},
+		{"DATA", "354 Start mail input; end with <CRLF>.<CRLF>"},
+	}
+	for _, step := range steps {
+		var got string
+		if step.cmd == "" {
+			got = c.reply()
+		} else {
+			got = c.cmd(step.cmd)
+		}
+		if got != step.want {
+			t.Fatalf("%q: reply = %q, want %q", step.cmd, got, step.want)
+		}
+	}
+
+	c.data("Subject: hello\r\n\r\n.leading dot\r\n")
+	for _, want := range []string{
+		"250 2.0.0 <alice@example.org> Delivered",
+		"250 2.0.0 <alice+Lists@example.org> Delivered",
+		"550 5.1.1 <nobody@example.org> User unknown",
+	} {
+		if got := c.reply(); got != want {
+			t.Errorf("delivery reply = %q, want %q", got, want)
+		}
+	}
+	if got := c.cmd("QUIT"); got != "221 2.0.0 Bye" {
+		t.Errorf("QUIT reply = %q", got)
+	}
+
+	msg := "Subject: hello\r\n\r\n.leading dot\r\n"
+	for _, key := range []string{"alice@example.org/INBOX", "alice@example.org/Lists"} {
+		if got := backend.delivered[key]; got != msg {
+			t.Errorf("delivered[%s] = %q, want %q", key, got, msg)
+		}
+	}
+}
+
+func TestLMTPServer_MessageTooBig(t *testing.T) {
+	srv, backend := newTestLMTPServer()
+	srv.MaxMessageSize = 16
+	c := dialLMTP(t, srv)
+
+	c.reply()
+	c.cmd("LHLO client.example.org")
+	c.cmd("MAIL FROM:<sender@example.org>")
+	c.cmd("RCPT TO:<alice@example.org>")
+	if got := c.cmd("DATA"); !strings.HasPrefix(got, "354 ") {
+		t.Fatalf("DATA reply = %q", got)
+	}
+	c.data(strings.Repeat("x", 100) + "\r\n")
+	if got, want := c.reply(), "552 5.3.4 <alice@example.org> Message too big"; got != want {
+		t.Errorf("reply = %q, want %q", got, want)
+	}
+	if got := c.cmd("NOOP"); got != "250 2.0.0 OK" {
+		t.Errorf("NOOP after rejected message = %q", got)
+	}
+	if len(backend.delivered) != 0 {
+		t.Errorf("delivered %v, want nothing", backend.delivered)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		arg, prefix, want string
+		ok                bool
+	}{
+		{"FROM:<a@b>", "FROM:", "a@b", true},
+		{"from: <a@b> SIZE=100", "FROM:", "a@b", true},
+		{"FROM:<>", "FROM:", "", true},
+		{"TO:a@b", "TO:", "", false},
+		{"FROM:<a@b>", "TO:", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := parsePath(tt.arg, tt.prefix)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parsePath(%q, %q) = %q, %v; want %q, %v", tt.arg, tt.prefix, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"errors"
+	"io"
+)
+
+// errConnectionLost ends the serve loop when the client went away, or the
+// connection was closed, while a command was handled.
+var errConnectionLost = errors.New("connection lost")
+
+// lossReader reads from the client, recording failures other than
+// timeouts in Conn.lost. Once a read failed, the rest of the command
+// cannot arrive, whichever reader of the command, such as a literal
+// reader or the DONE reader of IDLE, saw the failure.
+type lossReader struct {
+	c *Conn
+	r io.Reader
+}
+
+// lossReader returns r, which reads from the client, with its failures
+// recorded.
+func (c *Conn) lossReader(r io.Reader) io.Reader {
+	return &lossReader{c: c, r: r}
+}
+
+func (r *lossReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.c.bytesRead.Add(int64(n))
+	if err != nil && !isTimeout(err) {
+		r.c.lost.Store(true)
+	}
+	return n, err
+}
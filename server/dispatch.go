@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -15,6 +16,7 @@ import (
 type Dispatcher struct {
 	mu       sync.RWMutex
 	handlers map[string]CommandHandler
+	unknown  CommandHandler
 }
 
 // NewDispatcher creates a new Dispatcher.
@@ -43,6 +45,22 @@ func (d *Dispatcher) Get(name string) CommandHandler {
 	return d.handlers[strings.ToUpper(name)]
 }
 
+// SetUnknownHandler sets the handler for commands without a registered
+// handler. If nil, they fail with BAD.
+func (d *Dispatcher) SetUnknownHandler(handler CommandHandler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.unknown = handler
+}
+
+// UnknownHandler returns the handler for commands without a registered
+// handler, or nil.
+func (d *Dispatcher) UnknownHandler() CommandHandler {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.unknown
+}
+
 // Wrap wraps an existing handler with a wrapper function.
 // If no handler is registered, this is a no-op.
 func (d *Dispatcher) Wrap(name string, wrapper func(CommandHandler) CommandHandler) {
@@ -66,8 +84,27 @@ func (d *Dispatcher) Names() []string {
 }
 
 // dispatch dispatches a command to its handler.
+//
+// Unsolicited updates are never sent by the dispatcher itself. Handlers
+// flush them with CommandContext.PollUpdates: NOOP and CHECK always do,
+// other commands may. While more than one command is in progress on the
+// connection, or while FETCH, STORE or SEARCH run without the UID prefix,
+// PollUpdates does not allow the session to send EXPUNGE responses, as
+// they would change the sequence numbers the commands refer to (RFC 9051
+// §7.5.1). Every untagged response of a command must be written before its
+// tagged completion; imaptest.CheckOrder verifies these rules on session
+// transcripts.
 func (srv *Server) dispatch(c *Conn, tag, name, rest string) error {
 	upper := strings.ToUpper(name)
+	line := tag + " " + name
+	if rest != "" {
+		line += " " + rest
+	}
+	dispatcher := c.handlerSet().dispatcher
+	unknown := dispatcher.UnknownHandler()
+	// The command is recorded before it is checked, so that the protocol
+	// errors of the checks name it.
+	c.setCommand(upper)
 
 	// Check for UID prefix
 	numKind := NumKindSeq
@@ -79,18 +116,27 @@ func (srv *Server) dispatch(c *Conn, tag, name, rest string) error {
 			return nil
 		}
 		upper = strings.ToUpper(parts[0])
+		c.setCommand(upper)
 		if len(parts) > 1 {
 			rest = parts[1]
 		} else {
 			rest = ""
 		}
+		if !uidCommands[upper] && unknown == nil {
+			c.WriteBAD(tag, fmt.Sprintf("UID %s is not a valid command", upper))
+			return nil
+		}
+	}
+
+	handler := dispatcher.Get(upper)
+	if handler == nil || (numKind == NumKindUID && !uidCommands[upper]) {
+		handler = unknown
 	}
 
 	// Check command is allowed in current state
 	allowed := state.CommandAllowedStates(upper)
 	if allowed == nil {
 		// Extension command - check the dispatcher
-		handler := srv.dispatcher.Get(upper)
 		if handler == nil {
 			c.WriteBAD(tag, fmt.Sprintf("unknown command %s", upper))
 			return nil
@@ -103,12 +149,29 @@ func (srv *Server) dispatch(c *Conn, tag, name, rest string) error {
 		}
 	}
 
-	handler := srv.dispatcher.Get(upper)
 	if handler == nil {
 		c.WriteBAD(tag, fmt.Sprintf("command %s not implemented", upper))
 		return nil
 	}
 
+	// Commands that modify the selected mailbox are refused when it was
+	// opened with EXAMINE, whichever extension handles them. Literals
+	// sent with them are discarded as in refuseInMaintenance.
+	if readOnlyCommands[upper] && c.IsReadOnly() {
+		err := c.discardLiterals(rest)
+		c.WriteNO(tag, "mailbox is read-only")
+		return err
+	}
+
+	if refused, err := c.refuseInMaintenance(tag, upper, rest); refused {
+		return err
+	}
+
+	if rest != "" && numKind == NumKindSeq && noArgCommands[upper] {
+		c.WriteBAD(tag, fmt.Sprintf("%s takes no arguments", upper))
+		return nil
+	}
+
 	// Build decoder for the rest of the line
 	var dec *wire.Decoder
 	if rest != "" {
@@ -119,6 +182,7 @@ func (srv *Server) dispatch(c *Conn, tag, name, rest string) error {
 		Context: context.Background(),
 		Tag:     tag,
 		Name:    upper,
+		Line:    line,
 		NumKind: numKind,
 		Conn:    c,
 		Session: c.session,
@@ -126,27 +190,34 @@ func (srv *Server) dispatch(c *Conn, tag, name, rest string) error {
 		Decoder: dec,
 	}
 
+	c.inProgress.Add(1)
 	err := handler.Handle(ctx)
+	c.inProgress.Add(-1)
+	if c.lost.Load() {
+		// The client went away or the connection was closed during the
+		// command, for example in the middle of a literal or of IDLE:
+		// there is nobody to answer.
+		return errConnectionLost
+	}
+	if c.readTimedOut.Swap(false) || (err != nil && isTimeout(err) && !errors.Is(err, context.DeadlineExceeded)) {
+		// The rest of the command was not received, so the next command
+		// cannot be found: give up on the connection. A backend timing
+		// out is reported below instead.
+		c.writeFinalBYE("Timed out reading command")
+		return errCommandTimeout
+	}
 	if err != nil {
-		// Check if it's an IMAP error
-		if imapErr, ok := err.(*imap.IMAPError); ok {
+		// Report IMAP errors, possibly wrapped by the backend or
+		// middleware, and the well-known errors they are inferred from,
+		// see imap.ClassifyError.
+		if imapErr := imap.ClassifyError(err); imapErr != nil {
+			var explicit *imap.IMAPError
+			if !errors.As(err, &explicit) {
+				c.logger.Debug("command failed", "command", upper, "error", err)
+			}
 			switch imapErr.Type {
-			case imap.StatusResponseTypeNO:
-				c.encoder.Encode(func(enc *wire.Encoder) {
-					code := ""
-					if imapErr.Code != "" {
-						code = string(imapErr.Code)
-					}
-					enc.StatusResponse(tag, "NO", code, imapErr.Text)
-				})
-			case imap.StatusResponseTypeBAD:
-				c.encoder.Encode(func(enc *wire.Encoder) {
-					code := ""
-					if imapErr.Code != "" {
-						code = string(imapErr.Code)
-					}
-					enc.StatusResponse(tag, "BAD", code, imapErr.Text)
-				})
+			case imap.StatusResponseTypeNO, imap.StatusResponseTypeBAD:
+				c.writeStatus(tag, imapErr.Type, imapErr.Code, imapErr.Text)
 			case imap.StatusResponseTypeBYE:
 				c.WriteBYE(imapErr.Text)
 				return fmt.Errorf("BYE: %s", imapErr.Text)
@@ -155,13 +226,62 @@ func (srv *Server) dispatch(c *Conn, tag, name, rest string) error {
 			}
 		} else {
 			c.logger.Error("command handler error", "command", upper, "error", err)
-			c.WriteNO(tag, "internal server error")
+			var code imap.ResponseCode
+			if srv.options.ResponseCodes.ServerBug {
+				code = imap.ResponseCodeServerBug
+			}
+			c.writeStatus(tag, imap.StatusResponseTypeNO, code, "internal server error")
 		}
 	}
 
 	return nil
 }
 
+// readOnlyCommands are the commands that modify the selected mailbox and
+// are therefore not allowed after EXAMINE (RFC 9051 §6.3.3).
+var readOnlyCommands = map[string]bool{
+	"STORE":   true,
+	"EXPUNGE": true,
+	"MOVE":    true,
+	"REPLACE": true,
+}
+
+// uidCommands are the commands that can follow the UID prefix: those of
+// RFC 9051 and the extensions that define UID forms.
+var uidCommands = map[string]bool{
+	"COPY":    true,
+	"FETCH":   true,
+	"SEARCH":  true,
+	"STORE":   true,
+	"MOVE":    true, // RFC 6851
+	"EXPUNGE": true, // RFC 4315
+	"SORT":    true, // RFC 5256
+	"THREAD":  true, // RFC 5256
+	"REPLACE": true, // RFC 8508
+}
+
+// noExpungeCommands are the commands during which EXPUNGE responses must
+// not be sent, unless they use the UID prefix (RFC 9051 §7.5.1).
+var noExpungeCommands = map[string]bool{
+	"FETCH":  true,
+	"STORE":  true,
+	"SEARCH": true,
+}
+
+// noArgCommands are the commands that take no arguments. EXPUNGE only
+// takes one in its UID form.
+var noArgCommands = map[string]bool{
+	"CAPABILITY": true,
+	"NOOP":       true,
+	"LOGOUT":     true,
+	"STARTTLS":   true,
+	"CHECK":      true,
+	"CLOSE":      true,
+	"UNSELECT":   true,
+	"EXPUNGE":    true,
+	"IDLE":       true,
+}
+
 // parseLine parses a command line into tag, command name, and remaining arguments.
 func parseLine(line string) (tag, name, rest string, err error) {
 	if line == "" {
@@ -189,6 +309,9 @@ func parseLine(line string) (tag, name, rest string, err error) {
 	if tag == "" {
 		return "", "", "", fmt.Errorf("empty tag")
 	}
+	if !wire.ValidTag(tag) {
+		return "", "", "", fmt.Errorf("invalid tag")
+	}
 	if name == "" {
 		return "", "", "", fmt.Errorf("empty command name")
 	}
@@ -1,9 +1,18 @@
 package server
 
 import (
+	"bufio"
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
 	"sort"
 	"testing"
+
+	imap "github.com/meszmate/imap-go"
 )
 
 // --- Dispatcher tests ---
@@ -374,6 +383,16 @@ func TestParseLine(t *testing.T) {
 			input:     "A001",
 			wantError: true,
 		},
+		{
+			name:      "invalid tag",
+			input:     "A+1 NOOP",
+			wantError: true,
+		},
+		{
+			name:      "star tag",
+			input:     "* NOOP",
+			wantError: true,
+		},
 		{
 			name:     "tag with trailing space and command",
 			input:    "tag NOOP",
@@ -486,3 +505,137 @@ func TestCommandContext_SetValue_Overwrite(t *testing.T) {
 		t.Fatalf("expected %q, got %v", "updated", v)
 	}
 }
+
+// pollSession records the allowExpunge argument of Poll calls.
+type pollSession struct {
+	Session
+	polls []bool
+}
+
+func (s *pollSession) Poll(w *UpdateWriter, allowExpunge bool) error {
+	s.polls = append(s.polls, allowExpunge)
+	return nil
+}
+
+func TestCommandContextPollUpdates(t *testing.T) {
+	sess := &pollSession{}
+	ctx := newAppendContext(t, nil)
+	ctx.Session = sess
+
+	// Not authenticated: no poll.
+	if err := ctx.PollUpdates(); err != nil {
+		t.Fatalf("PollUpdates() error: %v", err)
+	}
+	if len(sess.polls) != 0 {
+		t.Fatalf("Poll called before authentication")
+	}
+
+	if err := ctx.Conn.SetState(imap.ConnStateAuthenticated); err != nil {
+		t.Fatalf("SetState() error: %v", err)
+	}
+	ctx.Conn.inProgress.Store(1)
+	_ = ctx.PollUpdates()
+	ctx.Conn.inProgress.Store(2)
+	_ = ctx.PollUpdates()
+	ctx.Conn.inProgress.Store(1)
+	ctx.Name = "FETCH"
+	_ = ctx.PollUpdates()
+	ctx.NumKind = NumKindUID
+	_ = ctx.PollUpdates()
+
+	want := []bool{true, false, false, true}
+	if fmt.Sprint(sess.polls) != fmt.Sprint(want) {
+		t.Errorf("Poll allowExpunge = %v, want %v", sess.polls, want)
+	}
+}
+
+func TestDispatch_UnknownCommandHandler(t *testing.T) {
+	var lines []string
+	srv := New(WithUnknownCommandHandler(CommandHandlerFunc(func(ctx *CommandContext) error {
+		lines = append(lines, ctx.Line)
+		arg, _ := ctx.Decoder.ReadAtom()
+		ctx.Conn.WriteOK(ctx.Tag, ctx.Name+" "+arg)
+		return nil
+	})))
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	conn := newConn(c1, srv)
+	if err := conn.SetState(imap.ConnStateAuthenticated); err != nil {
+		t.Fatalf("SetState() error: %v", err)
+	}
+
+	go func() {
+		_ = srv.dispatch(conn, "A1", "xPrivate", "foo bar")
+		_ = srv.dispatch(conn, "A2", "UID", "XFROB 42")
+		// The UID prefix still needs a command.
+		_ = srv.dispatch(conn, "A3", "UID", "")
+	}()
+
+	r := bufio.NewReader(c2)
+	for _, want := range []string{
+		"A1 OK XPRIVATE foo\r\n",
+		"A2 OK XFROB 42\r\n",
+		"A3 BAD missing command after UID\r\n",
+	} {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString() error: %v", err)
+		}
+		if line != want {
+			t.Errorf("got %q, want %q", line, want)
+		}
+	}
+	if len(lines) != 2 || lines[0] != "A1 xPrivate foo bar" || lines[1] != "A2 UID XFROB 42" {
+		t.Errorf("Line = %q", lines)
+	}
+}
+
+func TestDispatch_ErrorClassification(t *testing.T) {
+	errs := map[string]error{
+		"XWRAPPED":  fmt.Errorf("load: %w", imap.ErrNoPerm),
+		"XCLASSIFY": fmt.Errorf("store: %w", imap.WrapError(imap.ErrOverQuota, errors.New("disk full"))),
+		"XNOTEXIST": fmt.Errorf("open: %w", os.ErrNotExist),
+		"XDEADLINE": fmt.Errorf("query: %w", context.DeadlineExceeded),
+		"XOTHER":    errors.New("boom"),
+	}
+	srv := New(WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	for name, err := range errs {
+		err := err
+		srv.dispatcher.RegisterFunc(name, func(ctx *CommandContext) error {
+			return err
+		})
+	}
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	conn := newConn(c1, srv)
+
+	tests := []struct{ name, want string }{
+		{"XWRAPPED", "A1 NO [NOPERM] permission denied\r\n"},
+		{"XCLASSIFY", "A2 NO [OVERQUOTA] quota exceeded\r\n"},
+		{"XNOTEXIST", "A3 NO [NONEXISTENT] no such mailbox\r\n"},
+		{"XDEADLINE", "A4 NO [UNAVAILABLE] temporarily unavailable\r\n"},
+		{"XOTHER", "A5 NO internal server error\r\n"},
+	}
+	go func() {
+		for i, tc := range tests {
+			if err := srv.dispatch(conn, fmt.Sprintf("A%d", i+1), tc.name, ""); err != nil {
+				t.Errorf("dispatch(%s) error: %v", tc.name, err)
+			}
+		}
+	}()
+
+	r := bufio.NewReader(c2)
+	for _, tc := range tests {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString() error: %v", err)
+		}
+		if line != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, line, tc.want)
+		}
+	}
+}
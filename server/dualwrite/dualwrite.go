@@ -0,0 +1,398 @@
+// Package dualwrite composes two backends into one for live migrations,
+// such as from memserver or a Maildir to a SQL backend built with
+// server/storage, behind a single running server.
+//
+// Every mutation is applied to both backends, the old and the new one,
+// while reads are served by the primary backend only:
+//
+//	backend := &dualwrite.Backend{Old: mem.NewSession, New: sql.NewSession}
+//	srv := server.New(server.WithNewSession(backend.NewSession))
+//
+// Once the messages have been copied to the new backend with UIDs
+// preserved, for example with client/migrate, and no divergences are
+// reported, backend.SetPrimary(dualwrite.PrimaryNew) makes new sessions
+// read from it; the old backend can be dropped afterwards.
+package dualwrite
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/wire"
+)
+
+// Primary selects the backend serving reads.
+type Primary int32
+
+const (
+	// PrimaryOld serves reads from Backend.Old.
+	PrimaryOld Primary = iota
+	// PrimaryNew serves reads from Backend.New.
+	PrimaryNew
+)
+
+// String returns "old" or "new".
+func (p Primary) String() string {
+	if p == PrimaryNew {
+		return "new"
+	}
+	return "old"
+}
+
+// Divergence describes an operation whose outcome differed between the
+// backends: it failed on the secondary backend only, or both backends
+// returned different results, such as different UIDs for an APPEND.
+type Divergence struct {
+	// Op is the session method, such as "Append".
+	Op string
+	// Username is the user of the session, if logged in.
+	Username string
+	// Mailbox is the mailbox the operation applies to, if any.
+	Mailbox string
+	// Primary and Secondary describe the results of the backends. If the
+	// secondary backend failed, Secondary is its error.
+	Primary, Secondary string
+	// Err is the error of the secondary backend, if any.
+	Err error
+}
+
+// Backend writes to two backends and reads from the primary one. The
+// sessions it creates implement server.Session only: optional interfaces
+// of the backends' sessions, such as server.SessionMove, are not exposed.
+//
+// Both backends must assign the same UIDs, as mutations addressing
+// messages by sequence number are applied to the secondary backend by
+// UID, resolved with the primary backend, and the UIDs of appended and
+// copied messages are compared.
+type Backend struct {
+	// Old and New create the sessions of the backends, like the function
+	// passed to server.WithNewSession.
+	Old, New func(c *server.Conn) (server.Session, error)
+
+	// Logger logs divergences. If nil, the connection's logger is used.
+	Logger *slog.Logger
+	// OnDivergence, if set, is called with every divergence, such as to
+	// count them.
+	OnDivergence func(d *Divergence)
+
+	primary atomic.Int32
+}
+
+// SetPrimary selects the backend serving reads for new sessions. Sessions
+// already open keep reading from the backend they started with.
+func (b *Backend) SetPrimary(p Primary) {
+	b.primary.Store(int32(p))
+}
+
+// Primary returns the backend serving reads for new sessions, PrimaryOld
+// unless changed with SetPrimary.
+func (b *Backend) Primary() Primary {
+	return Primary(b.primary.Load())
+}
+
+// NewSession creates a session of both backends, for use with
+// server.WithNewSession. If the secondary backend fails to create one,
+// the divergence is reported and the session uses the primary backend
+// only.
+func (b *Backend) NewSession(c *server.Conn) (server.Session, error) {
+	newPrimary, newSecondary := b.Old, b.New
+	if b.Primary() == PrimaryNew {
+		newPrimary, newSecondary = b.New, b.Old
+	}
+	primary, err := newPrimary(c)
+	if err != nil {
+		return nil, err
+	}
+	s := &session{backend: b, primary: primary}
+	s.logger = b.Logger
+	if s.logger == nil {
+		s.logger = c.Logger()
+	}
+	if secondary, err := newSecondary(c); err != nil {
+		s.diverge("NewSession", "", err)
+	} else {
+		s.secondary = secondary
+	}
+	return s, nil
+}
+
+// session applies mutations to both sessions and reads from primary. If
+// the secondary session could not be created or failed to log in,
+// secondary is nil.
+type session struct {
+	backend   *Backend
+	logger    *slog.Logger
+	primary   server.Session
+	secondary server.Session
+
+	username string
+	mailbox  string
+}
+
+// discard returns an encoder for the responses of the secondary session.
+func discard() *server.ResponseEncoder {
+	return server.NewResponseEncoder(wire.NewEncoder(io.Discard))
+}
+
+// report reports a divergence.
+func (s *session) report(d *Divergence) {
+	d.Username = s.username
+	s.logger.Warn("dual-write divergence", "op", d.Op, "user", d.Username, "mailbox", d.Mailbox,
+		"primary", d.Primary, "secondary", d.Secondary)
+	if s.backend.OnDivergence != nil {
+		s.backend.OnDivergence(d)
+	}
+}
+
+// diverge reports a divergence if the secondary session failed with err.
+func (s *session) diverge(op, mailbox string, err error) {
+	if err == nil {
+		return
+	}
+	s.report(&Divergence{Op: op, Mailbox: mailbox, Primary: "ok", Secondary: err.Error(), Err: err})
+}
+
+// compare reports a divergence if the results of the sessions differ.
+func (s *session) compare(op, mailbox string, primary, secondary string) {
+	if primary != secondary {
+		s.report(&Divergence{Op: op, Mailbox: mailbox, Primary: primary, Secondary: secondary})
+	}
+}
+
+// mirror runs fn with the secondary session, if any, and reports its
+// error as a divergence.
+func (s *session) mirror(op, mailbox string, fn func(sess server.Session) error) {
+	if s.secondary != nil {
+		s.diverge(op, mailbox, fn(s.secondary))
+	}
+}
+
+// Close closes both sessions.
+func (s *session) Close() error {
+	err := s.primary.Close()
+	if s.secondary != nil {
+		s.diverge("Close", "", s.secondary.Close())
+	}
+	return err
+}
+
+// Login logs in to both backends. If the secondary backend rejects the
+// credentials, the divergence is reported and the session uses the
+// primary backend only.
+func (s *session) Login(username, password string) error {
+	if err := s.primary.Login(username, password); err != nil {
+		return err
+	}
+	s.username = username
+	if s.secondary != nil {
+		if err := s.secondary.Login(username, password); err != nil {
+			s.diverge("Login", "", err)
+			_ = s.secondary.Close()
+			s.secondary = nil
+		}
+	}
+	return nil
+}
+
+func (s *session) Select(mailbox string, options *imap.SelectOptions) (*imap.SelectData, error) {
+	data, err := s.primary.Select(mailbox, options)
+	if err != nil {
+		return nil, err
+	}
+	s.mailbox = mailbox
+	if s.secondary != nil {
+		other, err := s.secondary.Select(mailbox, options)
+		if err != nil {
+			s.diverge("Select", mailbox, err)
+		} else {
+			s.compare("Select", mailbox, selectSummary(data), selectSummary(other))
+		}
+	}
+	return data, nil
+}
+
+// selectSummary describes the state of a mailbox to compare.
+func selectSummary(data *imap.SelectData) string {
+	return fmt.Sprintf("messages=%d uidvalidity=%d uidnext=%d", data.NumMessages, data.UIDValidity, data.UIDNext)
+}
+
+func (s *session) Create(mailbox string, options *imap.CreateOptions) error {
+	if err := s.primary.Create(mailbox, options); err != nil {
+		return err
+	}
+	s.mirror("Create", mailbox, func(sess server.Session) error { return sess.Create(mailbox, options) })
+	return nil
+}
+
+func (s *session) Delete(mailbox string) error {
+	if err := s.primary.Delete(mailbox); err != nil {
+		return err
+	}
+	s.mirror("Delete", mailbox, func(sess server.Session) error { return sess.Delete(mailbox) })
+	return nil
+}
+
+func (s *session) Rename(mailbox, newName string) error {
+	if err := s.primary.Rename(mailbox, newName); err != nil {
+		return err
+	}
+	s.mirror("Rename", mailbox, func(sess server.Session) error { return sess.Rename(mailbox, newName) })
+	return nil
+}
+
+func (s *session) Subscribe(mailbox string) error {
+	if err := s.primary.Subscribe(mailbox); err != nil {
+		return err
+	}
+	s.mirror("Subscribe", mailbox, func(sess server.Session) error { return sess.Subscribe(mailbox) })
+	return nil
+}
+
+func (s *session) Unsubscribe(mailbox string) error {
+	if err := s.primary.Unsubscribe(mailbox); err != nil {
+		return err
+	}
+	s.mirror("Unsubscribe", mailbox, func(sess server.Session) error { return sess.Unsubscribe(mailbox) })
+	return nil
+}
+
+func (s *session) List(w *server.ListWriter, ref string, patterns []string, options *imap.ListOptions) error {
+	return s.primary.List(w, ref, patterns, options)
+}
+
+func (s *session) Status(mailbox string, options *imap.StatusOptions) (*imap.StatusData, error) {
+	return s.primary.Status(mailbox, options)
+}
+
+// Append reads the message into memory to append it to both backends.
+func (s *session) Append(mailbox string, r imap.LiteralReader, options *imap.AppendOptions) (*imap.AppendData, error) {
+	if s.secondary == nil {
+		return s.primary.Append(mailbox, r, options)
+	}
+	msg, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.primary.Append(mailbox, imap.LiteralReader{Reader: bytes.NewReader(msg), Size: r.Size}, options)
+	if err != nil {
+		return nil, err
+	}
+	other, err := s.secondary.Append(mailbox, imap.LiteralReader{Reader: bytes.NewReader(msg), Size: r.Size}, options)
+	if err != nil {
+		s.diverge("Append", mailbox, err)
+	} else if data != nil && other != nil {
+		s.compare("Append", mailbox, fmt.Sprintf("uid=%d", data.UID), fmt.Sprintf("uid=%d", other.UID))
+	}
+	return data, nil
+}
+
+// Poll polls both sessions, so that the secondary session sees the same
+// messages as the primary one, and writes the updates of the primary one.
+func (s *session) Poll(w *server.UpdateWriter, allowExpunge bool) error {
+	if err := s.primary.Poll(w, allowExpunge); err != nil {
+		return err
+	}
+	s.mirror("Poll", s.mailbox, func(sess server.Session) error {
+		return sess.Poll(server.NewUpdateWriter(discard()), allowExpunge)
+	})
+	return nil
+}
+
+func (s *session) Idle(w *server.UpdateWriter, stop <-chan struct{}) error {
+	return s.primary.Idle(w, stop)
+}
+
+func (s *session) Unselect() error {
+	if err := s.primary.Unselect(); err != nil {
+		return err
+	}
+	s.mirror("Unselect", s.mailbox, func(sess server.Session) error { return sess.Unselect() })
+	s.mailbox = ""
+	return nil
+}
+
+func (s *session) Expunge(w *server.ExpungeWriter, uids *imap.UIDSet) error {
+	if err := s.primary.Expunge(w, uids); err != nil {
+		return err
+	}
+	s.mirror("Expunge", s.mailbox, func(sess server.Session) error {
+		return sess.Expunge(server.NewExpungeWriter(discard()), uids)
+	})
+	return nil
+}
+
+func (s *session) Search(kind server.NumKind, criteria *imap.SearchCriteria, options *imap.SearchOptions) (*imap.SearchData, error) {
+	return s.primary.Search(kind, criteria, options)
+}
+
+func (s *session) Fetch(w *server.FetchWriter, numSet imap.NumSet, options *imap.FetchOptions) error {
+	return s.primary.Fetch(w, numSet, options)
+}
+
+func (s *session) Store(w *server.FetchWriter, numSet imap.NumSet, flags *imap.StoreFlags, options *imap.StoreOptions) error {
+	uids, err := s.resolveUIDs(numSet)
+	if err != nil {
+		return err
+	}
+	if err := s.primary.Store(w, numSet, flags, options); err != nil {
+		return err
+	}
+	if uids == nil {
+		return nil
+	}
+	s.mirror("Store", s.mailbox, func(sess server.Session) error {
+		return sess.Store(server.NewFetchWriter(discard()), uids, flags, options)
+	})
+	return nil
+}
+
+func (s *session) Copy(numSet imap.NumSet, dest string) (*imap.CopyData, error) {
+	uids, err := s.resolveUIDs(numSet)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.primary.Copy(numSet, dest)
+	if err != nil {
+		return nil, err
+	}
+	if s.secondary != nil && uids != nil {
+		other, err := s.secondary.Copy(uids, dest)
+		if err != nil {
+			s.diverge("Copy", dest, err)
+		} else if data != nil && other != nil {
+			s.compare("Copy", dest, copySummary(data), copySummary(other))
+		}
+	}
+	return data, nil
+}
+
+// copySummary describes the messages copied to compare.
+func copySummary(data *imap.CopyData) string {
+	return fmt.Sprintf("source=%s dest=%s", data.SourceUIDs.String(), data.DestUIDs.String())
+}
+
+// resolveUIDs returns the UIDs of the messages numSet addresses in the
+// selected mailbox of the primary session, as the sequence numbers of the
+// secondary session may lag behind, or nil if there are none. A UID set
+// is returned unchanged.
+func (s *session) resolveUIDs(numSet imap.NumSet) (imap.NumSet, error) {
+	seqSet, ok := numSet.(*imap.SeqSet)
+	if !ok || s.secondary == nil {
+		return numSet, nil
+	}
+	found, err := s.primary.Search(server.NumKindUID, &imap.SearchCriteria{SeqNum: seqSet}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if found == nil || len(found.AllUIDs) == 0 {
+		return nil, nil
+	}
+	uids := &imap.UIDSet{}
+	uids.AddNum(found.AllUIDs...)
+	return uids, nil
+}
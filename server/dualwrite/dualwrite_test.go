@@ -0,0 +1,105 @@
+package dualwrite_test
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/imaptest"
+	"github.com/meszmate/imap-go/server"
+	_ "github.com/meszmate/imap-go/server/commands"
+	"github.com/meszmate/imap-go/server/dualwrite"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+func newMem(t *testing.T) *memserver.MemServer {
+	t.Helper()
+	mem := memserver.New()
+	mem.AddUser("alice", "secret")
+	if err := mem.Deliver("alice", "INBOX", strings.NewReader("Subject: one\r\n\r\nfirst")); err != nil {
+		t.Fatalf("Deliver() error: %v", err)
+	}
+	return mem
+}
+
+func TestBackend(t *testing.T) {
+	oldMem, newMem := newMem(t), newMem(t)
+	if err := oldMem.GetUserData("alice").CreateMailbox("Legacy"); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var divergences []*dualwrite.Divergence
+	backend := &dualwrite.Backend{
+		Old:    oldMem.NewSession,
+		New:    newMem.NewSession,
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		OnDivergence: func(d *dualwrite.Divergence) {
+			mu.Lock()
+			defer mu.Unlock()
+			divergences = append(divergences, d)
+		},
+	}
+	h := imaptest.NewHarness(t, oldMem.NewServer(server.WithNewSession(backend.NewSession)))
+
+	c := h.Dial()
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	if _, err := c.Select("INBOX", nil); err != nil {
+		t.Fatalf("Select() error: %v", err)
+	}
+	if _, err := c.Append("INBOX", nil, []byte("Subject: two\r\n\r\nsecond")); err != nil {
+		t.Fatalf("Append() error: %v", err)
+	}
+	if err := c.Noop(); err != nil {
+		t.Fatalf("Noop() error: %v", err)
+	}
+	if err := c.Store("1", imap.StoreFlagsAdd, []imap.Flag{imap.FlagSeen}, true); err != nil {
+		t.Fatalf("Store() error: %v", err)
+	}
+	if err := c.Create("Archive"); err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	if _, err := c.Copy("1:2", "Archive"); err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	if len(divergences) != 0 {
+		t.Errorf("divergences = %+v", divergences)
+	}
+
+	for name, mem := range map[string]*memserver.MemServer{"old": oldMem, "new": newMem} {
+		user := mem.GetUserData("alice")
+		if n := user.GetMailbox("INBOX").NumMessages(); n != 2 {
+			t.Errorf("%s INBOX has %d messages, want 2", name, n)
+		}
+		if n := user.GetMailbox("Archive").NumMessages(); n != 2 {
+			t.Errorf("%s Archive has %d messages, want 2", name, n)
+		}
+		if n := user.GetMailbox("INBOX").NumUnseen(); n != 1 {
+			t.Errorf("%s INBOX has %d unseen messages, want 1", name, n)
+		}
+	}
+
+	// The mailbox missing in the new backend is served by the old one.
+	if _, err := c.Select("Legacy", nil); err != nil {
+		t.Fatalf("Select(Legacy) error: %v", err)
+	}
+	mu.Lock()
+	if len(divergences) != 1 || divergences[0].Op != "Select" || divergences[0].Mailbox != "Legacy" || divergences[0].Err == nil {
+		t.Errorf("divergences = %+v, want the failed Select", divergences)
+	}
+	mu.Unlock()
+
+	backend.SetPrimary(dualwrite.PrimaryNew)
+	c = h.Dial()
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	if _, err := c.Select("Legacy", nil); err == nil {
+		t.Error("Select(Legacy) succeeded reading from the new backend")
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	imap "github.com/meszmate/imap-go"
+)
+
+// EnableCapabilities handles the capabilities requested with ENABLE (RFC
+// 5161): those the server advertises on conn are enabled along with the
+// capabilities they imply, and the requested ones that were enabled are
+// returned for the ENABLED response. Standard capabilities that cannot be
+// enabled, such as MOVE, are ignored (see imap.Cap.IsEnableable); other
+// capabilities, such as those of vendor extensions, are enabled if they
+// are advertised.
+//
+// A capability implies those listed in imap.CapInfo.Implies and the
+// capabilities of the extensions that the extension providing it depends
+// on (see ImpliedCapabilities): enabling QRESYNC also enables CONDSTORE,
+// as RFC 7162 §3.2.3 requires. Implied
+// capabilities are added to Conn.Enabled but not returned, since the
+// client did not ask for them.
+func (srv *Server) EnableCapabilities(conn *Conn, requested []imap.Cap) []imap.Cap {
+	advertised := imap.NewCapSet(conn.Capabilities()...)
+
+	var enabled []imap.Cap
+	for _, c := range requested {
+		if !advertised.Has(c) {
+			continue
+		}
+		if _, standard := c.Info(); standard && !c.IsEnableable() {
+			continue
+		}
+		conn.Enabled().Add(c)
+		enabled = append(enabled, c)
+
+		for _, implied := range srv.ImpliedCapabilities(c) {
+			if advertised.Has(implied) {
+				conn.Enabled().Add(implied)
+			}
+		}
+	}
+	if len(enabled) > 0 {
+		conn.InvalidateCapabilities()
+	}
+	return enabled
+}
+
+// ImpliedCapabilities returns the capabilities implied by enabling c:
+// those listed in imap.CapInfo.Implies and those of the installed
+// extensions that the extension providing c depends on, directly or
+// indirectly.
+func (srv *Server) ImpliedCapabilities(c imap.Cap) []imap.Cap {
+	byName := make(map[string]int, len(srv.extensions))
+	for i, ext := range srv.extensions {
+		byName[ext.Name()] = i
+	}
+
+	var implied []imap.Cap
+	if info, ok := c.Info(); ok {
+		implied = append(implied, info.Implies...)
+	}
+	seen := make(map[string]bool)
+	var visit func(deps []string)
+	visit = func(deps []string) {
+		for _, name := range deps {
+			i, ok := byName[name]
+			if !ok || seen[name] {
+				continue
+			}
+			seen[name] = true
+			implied = append(implied, srv.extensions[i].Capabilities()...)
+			visit(srv.extensions[i].Dependencies())
+		}
+	}
+
+	for _, ext := range srv.extensions {
+		for _, provided := range ext.Capabilities() {
+			if provided == c {
+				seen[ext.Name()] = true
+				visit(ext.Dependencies())
+			}
+		}
+	}
+	return implied
+}
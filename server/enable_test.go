@@ -0,0 +1,114 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/extension"
+)
+
+func capExtension(name string, caps []imap.Cap, deps ...string) extension.ServerExtension {
+	return &testExtension{BaseExtension: extension.BaseExtension{
+		ExtName:         name,
+		ExtCapabilities: caps,
+		ExtDependencies: deps,
+	}}
+}
+
+func TestEnableCapabilities(t *testing.T) {
+	condstore := capExtension("CONDSTORE", []imap.Cap{imap.CapCondStore})
+	qresync := capExtension("QRESYNC", []imap.Cap{imap.CapQResync}, "CONDSTORE")
+	chain := []extension.ServerExtension{
+		capExtension("X-A", []imap.Cap{"X-A"}),
+		capExtension("X-B", []imap.Cap{"X-B"}, "X-A"),
+		capExtension("X-C", []imap.Cap{"X-C"}, "X-B"),
+	}
+
+	tests := []struct {
+		name        string
+		exts        []extension.ServerExtension
+		requested   []imap.Cap
+		wantEnabled string
+		wantConn    []imap.Cap
+	}{
+		{
+			name:        "QRESYNC implies CONDSTORE",
+			exts:        []extension.ServerExtension{condstore, qresync},
+			requested:   []imap.Cap{imap.CapQResync},
+			wantEnabled: "QRESYNC",
+			wantConn:    []imap.Cap{imap.CapQResync, imap.CapCondStore},
+		},
+		{
+			name:        "CONDSTORE alone",
+			exts:        []extension.ServerExtension{condstore, qresync},
+			requested:   []imap.Cap{imap.CapCondStore},
+			wantEnabled: "CONDSTORE",
+			wantConn:    []imap.Cap{imap.CapCondStore},
+		},
+		{
+			name:        "both requested",
+			exts:        []extension.ServerExtension{condstore, qresync},
+			requested:   []imap.Cap{imap.CapCondStore, imap.CapQResync},
+			wantEnabled: "CONDSTORE QRESYNC",
+			wantConn:    []imap.Cap{imap.CapQResync, imap.CapCondStore},
+		},
+		{
+			name:        "dependency not installed",
+			exts:        []extension.ServerExtension{qresync},
+			requested:   []imap.Cap{imap.CapQResync},
+			wantEnabled: "QRESYNC",
+			wantConn:    []imap.Cap{imap.CapQResync},
+		},
+		{
+			name:        "not advertised",
+			exts:        []extension.ServerExtension{condstore},
+			requested:   []imap.Cap{imap.CapQResync, "X-UNKNOWN"},
+			wantEnabled: "",
+		},
+		{
+			name:        "implied without dependency",
+			exts:        []extension.ServerExtension{condstore, capExtension("QRESYNC", []imap.Cap{imap.CapQResync})},
+			requested:   []imap.Cap{imap.CapQResync},
+			wantEnabled: "QRESYNC",
+			wantConn:    []imap.Cap{imap.CapQResync, imap.CapCondStore},
+		},
+		{
+			name:        "not enable-able",
+			exts:        []extension.ServerExtension{condstore, capExtension("MOVE", []imap.Cap{imap.CapMove})},
+			requested:   []imap.Cap{imap.CapMove, imap.CapCondStore},
+			wantEnabled: "CONDSTORE",
+			wantConn:    []imap.Cap{imap.CapCondStore},
+		},
+		{
+			name:        "transitive",
+			exts:        chain,
+			requested:   []imap.Cap{"X-C"},
+			wantEnabled: "X-C",
+			wantConn:    []imap.Cap{"X-A", "X-B", "X-C"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newCapTestConn(t, WithExtensions(tt.exts...))
+			enabled := conn.server.EnableCapabilities(conn, tt.requested)
+
+			var got []string
+			for _, c := range enabled {
+				got = append(got, string(c))
+			}
+			if strings.Join(got, " ") != tt.wantEnabled {
+				t.Errorf("EnableCapabilities() = %v, want %q", got, tt.wantEnabled)
+			}
+			if conn.Enabled().Len() != len(tt.wantConn) {
+				t.Errorf("Conn.Enabled() = %v, want %v", conn.Enabled().All(), tt.wantConn)
+			}
+			for _, c := range tt.wantConn {
+				if !conn.Enabled().Has(c) {
+					t.Errorf("Conn.Enabled() is missing %s", c)
+				}
+			}
+		})
+	}
+}
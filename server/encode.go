@@ -0,0 +1,208 @@
+package server
+
+import (
+	"sort"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/wire"
+)
+
+// envelopeDateLayout is the RFC 5322 date-time format used for the date
+// field of an envelope.
+const envelopeDateLayout = "Mon, 02 Jan 2006 15:04:05 -0700"
+
+// EncodeEnvelope writes env as an IMAP envelope (RFC 3501 section 7.4.2).
+// Empty fields are written as NIL. A nil envelope is written as NIL.
+func EncodeEnvelope(enc *wire.Encoder, env *imap.Envelope) {
+	if env == nil {
+		enc.Nil()
+		return
+	}
+
+	enc.BeginList()
+	if env.Date.IsZero() {
+		enc.Nil()
+	} else {
+		enc.QuotedString(env.Date.Format(envelopeDateLayout))
+	}
+	enc.SP()
+	encodeNString(enc, env.Subject)
+	enc.SP()
+	encodeAddressList(enc, env.From)
+	enc.SP()
+	encodeAddressList(enc, env.Sender)
+	enc.SP()
+	encodeAddressList(enc, env.ReplyTo)
+	enc.SP()
+	encodeAddressList(enc, env.To)
+	enc.SP()
+	encodeAddressList(enc, env.Cc)
+	enc.SP()
+	encodeAddressList(enc, env.Bcc)
+	enc.SP()
+	encodeNString(enc, env.InReplyTo)
+	enc.SP()
+	encodeNString(enc, env.MessageID)
+	enc.EndList()
+}
+
+func encodeAddressList(enc *wire.Encoder, addrs []*imap.Address) {
+	if len(addrs) == 0 {
+		enc.Nil()
+		return
+	}
+	enc.BeginList()
+	for _, addr := range addrs {
+		enc.BeginList()
+		encodeNString(enc, addr.Name)
+		enc.SP().Nil() // at-domain-list (always NIL in modern usage)
+		enc.SP()
+		encodeNString(enc, addr.Mailbox)
+		enc.SP()
+		encodeNString(enc, addr.Host)
+		enc.EndList()
+	}
+	enc.EndList()
+}
+
+// EncodeBodyStructure writes bs as a BODY or BODYSTRUCTURE value
+// (RFC 3501 section 7.4.2). If extended is true, the extension data
+// (MD5, disposition, language and location) is included as required for
+// BODYSTRUCTURE; otherwise the non-extensible BODY form is written.
+func EncodeBodyStructure(enc *wire.Encoder, bs *imap.BodyStructure, extended bool) {
+	enc.BeginList()
+	if bs.IsMultipart() {
+		for i := range bs.Children {
+			EncodeBodyStructure(enc, &bs.Children[i], extended)
+		}
+		enc.SP()
+		encodeString(enc, bs.Subtype)
+		if extended {
+			enc.SP()
+			encodeBodyParams(enc, bs.Params)
+			enc.SP()
+			encodeBodyExtension(enc, bs)
+		}
+		enc.EndList()
+		return
+	}
+
+	encodeString(enc, bs.Type)
+	enc.SP()
+	encodeString(enc, bs.Subtype)
+	enc.SP()
+	encodeBodyParams(enc, bs.Params)
+	enc.SP()
+	encodeNString(enc, bs.ID)
+	enc.SP()
+	encodeNString(enc, bs.Description)
+	enc.SP()
+	encoding := bs.Encoding
+	if encoding == "" {
+		encoding = "7BIT"
+	}
+	encodeString(enc, encoding)
+	enc.SP().Number(bs.Size)
+
+	switch {
+	case strings.EqualFold(bs.Type, "message") &&
+		(strings.EqualFold(bs.Subtype, "rfc822") || strings.EqualFold(bs.Subtype, "global")):
+		enc.SP()
+		EncodeEnvelope(enc, bs.Envelope)
+		enc.SP()
+		inner := bs.BodyStructure
+		if inner == nil {
+			inner = &imap.BodyStructure{Type: "text", Subtype: "plain"}
+		}
+		EncodeBodyStructure(enc, inner, extended)
+		enc.SP().Number(bs.Lines)
+	case strings.EqualFold(bs.Type, "text"):
+		enc.SP().Number(bs.Lines)
+	}
+
+	if extended {
+		enc.SP()
+		encodeNString(enc, bs.MD5)
+		enc.SP()
+		encodeBodyExtension(enc, bs)
+	}
+	enc.EndList()
+}
+
+// encodeBodyExtension writes the disposition, language and location
+// fields shared by single-part and multipart extension data.
+func encodeBodyExtension(enc *wire.Encoder, bs *imap.BodyStructure) {
+	if bs.Disposition == "" {
+		enc.Nil()
+	} else {
+		enc.BeginList()
+		encodeString(enc, bs.Disposition)
+		enc.SP()
+		encodeBodyParams(enc, bs.DispositionParams)
+		enc.EndList()
+	}
+	enc.SP()
+	switch len(bs.Language) {
+	case 0:
+		enc.Nil()
+	case 1:
+		encodeString(enc, bs.Language[0])
+	default:
+		enc.BeginList()
+		for i, lang := range bs.Language {
+			if i > 0 {
+				enc.SP()
+			}
+			encodeString(enc, lang)
+		}
+		enc.EndList()
+	}
+	enc.SP()
+	encodeNString(enc, bs.Location)
+}
+
+// encodeBodyParams writes a body-fld-param list. Parameters are sorted by
+// name so that the output is deterministic.
+func encodeBodyParams(enc *wire.Encoder, params map[string]string) {
+	if len(params) == 0 {
+		enc.Nil()
+		return
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	enc.BeginList()
+	for i, k := range keys {
+		if i > 0 {
+			enc.SP()
+		}
+		encodeString(enc, k)
+		enc.SP()
+		encodeString(enc, params[k])
+	}
+	enc.EndList()
+}
+
+// encodeString writes s as a quoted string or, if required, a literal.
+// Unlike wire.Encoder.String it never writes an atom, since the envelope
+// and body structure grammar only allows strings.
+func encodeString(enc *wire.Encoder, s string) {
+	if wire.NeedsLiteral(s) {
+		enc.Literal([]byte(s))
+		return
+	}
+	enc.QuotedString(s)
+}
+
+// encodeNString writes s with encodeString, or NIL if s is empty.
+func encodeNString(enc *wire.Encoder, s string) {
+	if s == "" {
+		enc.Nil()
+		return
+	}
+	encodeString(enc, s)
+}
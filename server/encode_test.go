@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/wire"
+)
+
+func encodeToString(t *testing.T, fn func(enc *wire.Encoder)) string {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := wire.NewEncoder(&buf)
+	fn(enc)
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Flush() error: %v", err)
+	}
+	return buf.String()
+}
+
+func TestEncodeEnvelope(t *testing.T) {
+	// RFC 3501 section 8, without the "(PDT)" date comment.
+	date := time.Date(1996, time.July, 17, 2, 23, 25, 0, time.FixedZone("PDT", -7*60*60))
+	gray := &imap.Address{Name: "Terry Gray", Mailbox: "gray", Host: "cac.washington.edu"}
+	env := &imap.Envelope{
+		Date:    date,
+		Subject: "IMAP4rev1 WG mtg summary and minutes",
+		From:    []*imap.Address{gray},
+		Sender:  []*imap.Address{gray},
+		ReplyTo: []*imap.Address{gray},
+		To:      []*imap.Address{{Mailbox: "imap", Host: "cac.washington.edu"}},
+		Cc: []*imap.Address{
+			{Mailbox: "minutes", Host: "CNRI.Reston.VA.US"},
+			{Name: "John Klensin", Mailbox: "KLENSIN", Host: "MIT.EDU"},
+		},
+		MessageID: "<B27397-0100000@cac.washington.edu>",
+	}
+
+	want := `("Wed, 17 Jul 1996 02:23:25 -0700" "IMAP4rev1 WG mtg summary and minutes" ` +
+		`(("Terry Gray" NIL "gray" "cac.washington.edu")) ` +
+		`(("Terry Gray" NIL "gray" "cac.washington.edu")) ` +
+		`(("Terry Gray" NIL "gray" "cac.washington.edu")) ` +
+		`((NIL NIL "imap" "cac.washington.edu")) ` +
+		`((NIL NIL "minutes" "CNRI.Reston.VA.US")("John Klensin" NIL "KLENSIN" "MIT.EDU")) ` +
+		`NIL NIL "<B27397-0100000@cac.washington.edu>")`
+
+	got := encodeToString(t, func(enc *wire.Encoder) { EncodeEnvelope(enc, env) })
+	if got != want {
+		t.Errorf("EncodeEnvelope() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEncodeEnvelope_Empty(t *testing.T) {
+	got := encodeToString(t, func(enc *wire.Encoder) { EncodeEnvelope(enc, &imap.Envelope{}) })
+	want := "(NIL NIL NIL NIL NIL NIL NIL NIL NIL NIL)"
+	if got != want {
+		t.Errorf("EncodeEnvelope() = %s, want %s", got, want)
+	}
+
+	got = encodeToString(t, func(enc *wire.Encoder) { EncodeEnvelope(enc, nil) })
+	if got != "NIL" {
+		t.Errorf("EncodeEnvelope(nil) = %s, want NIL", got)
+	}
+}
+
+func TestEncodeBodyStructure(t *testing.T) {
+	textPart := imap.BodyStructure{
+		Type:     "TEXT",
+		Subtype:  "PLAIN",
+		Params:   map[string]string{"CHARSET": "US-ASCII"},
+		Encoding: "7BIT",
+		Size:     1152,
+		Lines:    23,
+	}
+	diffPart := imap.BodyStructure{
+		Type:        "TEXT",
+		Subtype:     "PLAIN",
+		Params:      map[string]string{"CHARSET": "US-ASCII", "NAME": "cc.diff"},
+		ID:          "<960723163407.20117h@cac.washington.edu>",
+		Description: "Compiler diff",
+		Encoding:    "BASE64",
+		Size:        4554,
+		Lines:       73,
+	}
+
+	tests := []struct {
+		name     string
+		bs       *imap.BodyStructure
+		extended bool
+		want     string
+	}{
+		{
+			name: "rfc3501 single part",
+			bs: &imap.BodyStructure{
+				Type:     "TEXT",
+				Subtype:  "PLAIN",
+				Params:   map[string]string{"CHARSET": "US-ASCII"},
+				Encoding: "7BIT",
+				Size:     3028,
+				Lines:    92,
+			},
+			want: `("TEXT" "PLAIN" ("CHARSET" "US-ASCII") NIL NIL "7BIT" 3028 92)`,
+		},
+		{
+			name: "rfc3501 multipart",
+			bs: &imap.BodyStructure{
+				Type:     "MULTIPART",
+				Subtype:  "MIXED",
+				Children: []imap.BodyStructure{textPart, diffPart},
+			},
+			want: `(("TEXT" "PLAIN" ("CHARSET" "US-ASCII") NIL NIL "7BIT" 1152 23)` +
+				`("TEXT" "PLAIN" ("CHARSET" "US-ASCII" "NAME" "cc.diff") ` +
+				`"<960723163407.20117h@cac.washington.edu>" "Compiler diff" "BASE64" 4554 73) "MIXED")`,
+		},
+		{
+			name: "extended single part",
+			bs: &imap.BodyStructure{
+				Type:              "APPLICATION",
+				Subtype:           "PDF",
+				Params:            map[string]string{"NAME": "a.pdf"},
+				Encoding:          "BASE64",
+				Size:              100,
+				MD5:               "abc",
+				Disposition:       "ATTACHMENT",
+				DispositionParams: map[string]string{"FILENAME": "a.pdf"},
+				Language:          []string{"en", "de"},
+				Location:          "http://example.com/a.pdf",
+			},
+			extended: true,
+			want: `("APPLICATION" "PDF" ("NAME" "a.pdf") NIL NIL "BASE64" 100 "abc" ` +
+				`("ATTACHMENT" ("FILENAME" "a.pdf")) ("en" "de") "http://example.com/a.pdf")`,
+		},
+		{
+			name: "extended multipart",
+			bs: &imap.BodyStructure{
+				Type:     "MULTIPART",
+				Subtype:  "MIXED",
+				Params:   map[string]string{"BOUNDARY": "xyz"},
+				Children: []imap.BodyStructure{textPart},
+			},
+			extended: true,
+			want: `(("TEXT" "PLAIN" ("CHARSET" "US-ASCII") NIL NIL "7BIT" 1152 23 NIL NIL NIL NIL) ` +
+				`"MIXED" ("BOUNDARY" "xyz") NIL NIL NIL)`,
+		},
+		{
+			name: "message rfc822",
+			bs: &imap.BodyStructure{
+				Type:          "MESSAGE",
+				Subtype:       "RFC822",
+				Encoding:      "7BIT",
+				Size:          500,
+				Envelope:      &imap.Envelope{Subject: "inner"},
+				BodyStructure: &textPart,
+				Lines:         30,
+			},
+			want: `("MESSAGE" "RFC822" NIL NIL NIL "7BIT" 500 ` +
+				`(NIL "inner" NIL NIL NIL NIL NIL NIL NIL NIL) ` +
+				`("TEXT" "PLAIN" ("CHARSET" "US-ASCII") NIL NIL "7BIT" 1152 23) 30)`,
+		},
+		{
+			name: "single language",
+			bs: &imap.BodyStructure{
+				Type:     "TEXT",
+				Subtype:  "HTML",
+				Size:     10,
+				Lines:    1,
+				Language: []string{"en"},
+			},
+			extended: true,
+			want:     `("TEXT" "HTML" NIL NIL NIL "7BIT" 10 1 NIL NIL "en" NIL)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := encodeToString(t, func(enc *wire.Encoder) { EncodeBodyStructure(enc, tt.bs, tt.extended) })
+			if got != tt.want {
+				t.Errorf("EncodeBodyStructure() =\n%s\nwant\n%s", got, tt.want)
+			}
+
+			// The client's parser reads back what was written.
+			parsed, err := imap.ParseBodyStructure(got)
+			if err != nil {
+				t.Fatalf("ParseBodyStructure() error: %v", err)
+			}
+			if again := encodeToString(t, func(enc *wire.Encoder) { EncodeBodyStructure(enc, parsed, tt.extended) }); again != got {
+				t.Errorf("EncodeBodyStructure(ParseBodyStructure()) =\n%s\nwant\n%s", again, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	imap "github.com/meszmate/imap-go"
+)
+
+// SessionExpungeIssued is an optional interface for sessions that notice
+// when a command refers to messages expunged by another session, which
+// cannot be reported with EXPUNGE responses during commands such as
+// FETCH, STORE and SEARCH (RFC 3501 section 7.4.1). The tagged OK or NO
+// response of the command then carries the EXPUNGEISSUED response code
+// (RFC 5530), so that the client issues NOOP to learn about the expunge.
+type SessionExpungeIssued interface {
+	// ExpungeIssued reports whether the session found messages expunged
+	// by another session that it could not report since it was last
+	// called, and resets it.
+	ExpungeIssued() bool
+}
+
+// SetExpungeIssued attaches the EXPUNGEISSUED response code (RFC 5530) to
+// the next tagged OK or NO response of the connection, to tell the client
+// that messages were expunged that could not be reported with EXPUNGE in
+// the current context. Sessions holding the connection given to
+// Options.NewSession and command handlers can call it; sessions can also
+// implement SessionExpungeIssued instead. A response that already has a
+// code is left alone, and the next one gets EXPUNGEISSUED.
+func (c *Conn) SetExpungeIssued() {
+	c.expungeIssued.Store(true)
+}
+
+// applyExpungeIssued returns EXPUNGEISSUED as the code of a tagged OK or
+// NO response without one if it was set with SetExpungeIssued or reported
+// by the session.
+func (c *Conn) applyExpungeIssued(tag string, typ imap.StatusResponseType, code imap.ResponseCode) imap.ResponseCode {
+	if tag == "*" || (typ != imap.StatusResponseTypeOK && typ != imap.StatusResponseTypeNO) {
+		return code
+	}
+	issued := c.expungeIssued.Swap(false)
+	if s, ok := c.session.(SessionExpungeIssued); ok && s.ExpungeIssued() {
+		issued = true
+	}
+	switch {
+	case !issued:
+		return code
+	case code == "":
+		return imap.ResponseCodeExpungeIssued
+	default:
+		// Keep it for the next response.
+		c.expungeIssued.Store(true)
+		return code
+	}
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestConn_SetExpungeIssued(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	conn := newConn(c1, New())
+
+	ok, no := imap.StatusResponseTypeOK, imap.StatusResponseTypeNO
+	if code := conn.applyExpungeIssued("A1", ok, ""); code != "" {
+		t.Errorf("code without SetExpungeIssued = %q", code)
+	}
+
+	conn.SetExpungeIssued()
+	if code := conn.applyExpungeIssued("*", ok, ""); code != "" {
+		t.Errorf("code of an untagged response = %q", code)
+	}
+	if code := conn.applyExpungeIssued("A2", no, imap.ResponseCodeNonExistent); code != imap.ResponseCodeNonExistent {
+		t.Errorf("code of a response with a code = %q", code)
+	}
+	if code := conn.applyExpungeIssued("A3", no, ""); code != imap.ResponseCodeExpungeIssued {
+		t.Errorf("code of the next tagged response = %q, want EXPUNGEISSUED", code)
+	}
+	if code := conn.applyExpungeIssued("A4", ok, ""); code != "" {
+		t.Errorf("code after EXPUNGEISSUED was sent = %q", code)
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/meszmate/imap-go/extension"
+)
+
+// handlerSet is the command handlers and extensions that a connection
+// uses. Connections keep the set of the server when they were accepted.
+type handlerSet struct {
+	dispatcher *Dispatcher
+	extensions []extension.ServerExtension
+}
+
+// handlerSet returns the handlers of the connection.
+func (c *Conn) handlerSet() *handlerSet {
+	if c.handlers != nil {
+		return c.handlers
+	}
+	// Servers built without New, as in tests
+	return &handlerSet{dispatcher: c.server.dispatcher, extensions: c.server.extensions}
+}
+
+// SetExtensionEnabled enables or disables an installed extension at
+// runtime, so that an extension misbehaving with some clients can be
+// turned off without redeploying. Connections accepted afterwards do not
+// get the capabilities, commands and handler wrappers of a disabled
+// extension, nor of the extensions depending on it; connections already
+// open keep those they started with, so that capabilities they were
+// offered do not disappear.
+//
+// Extensions disabled from the start are set with
+// Options.DisabledExtensions. SetExtensionEnabled returns an error if no
+// extension named name is installed.
+func (srv *Server) SetExtensionEnabled(name string, on bool) error {
+	known := false
+	for _, ext := range srv.extensions {
+		if ext.Name() == name {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return fmt.Errorf("server: no extension named %q is installed", name)
+	}
+
+	srv.handlersMu.Lock()
+	defer srv.handlersMu.Unlock()
+	if srv.disabled[name] == !on {
+		return nil
+	}
+	if srv.disabled == nil {
+		srv.disabled = make(map[string]bool)
+	}
+	if on {
+		delete(srv.disabled, name)
+	} else {
+		srv.disabled[name] = true
+	}
+	srv.options.Logger.Info("extension toggled", "extension", name, "enabled", on)
+	srv.rebuildHandlers()
+	return nil
+}
+
+// ExtensionEnabled reports whether the installed extension name is
+// enabled for new connections.
+func (srv *Server) ExtensionEnabled(name string) bool {
+	extensions := srv.extensions
+	if set := srv.handlers.Load(); set != nil {
+		extensions = set.extensions
+	}
+	for _, ext := range extensions {
+		if ext.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// rebuildHandlers builds the handlers of new connections without the
+// disabled extensions. The built-in handlers are registered again, then
+// the enabled extensions, then the handlers registered with Handle,
+// HandleFunc and WrapHandler. handlersMu must be held.
+func (srv *Server) rebuildHandlers() {
+	if len(srv.disabled) == 0 {
+		srv.handlers.Store(&handlerSet{dispatcher: srv.dispatcher, extensions: srv.extensions})
+		return
+	}
+
+	builder := &Server{options: srv.options, dispatcher: NewDispatcher()}
+	builder.dispatcher.SetUnknownHandler(srv.options.UnknownCommandHandler)
+	builder.registerBuiltinHandlers()
+	set := &handlerSet{dispatcher: builder.dispatcher}
+	set.extensions = srv.installExtensionsInto(set.dispatcher, srv.disabled, false)
+	for _, op := range srv.userOps {
+		op(set.dispatcher)
+	}
+	srv.handlers.Store(set)
+}
+
+// applyHandlers applies a change of the handlers. After New, the change
+// is recorded so that rebuildHandlers applies it again, and also applied
+// to the handlers of new connections.
+func (srv *Server) applyHandlers(op func(*Dispatcher)) {
+	srv.handlersMu.Lock()
+	defer srv.handlersMu.Unlock()
+	op(srv.dispatcher)
+	if !srv.built {
+		return
+	}
+	srv.userOps = append(srv.userOps, op)
+	if set := srv.handlers.Load(); set.dispatcher != srv.dispatcher {
+		op(set.dispatcher)
+	}
+}
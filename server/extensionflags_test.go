@@ -0,0 +1,114 @@
+package server
+
+import (
+	"net"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/extension"
+)
+
+func TestSetExtensionEnabled(t *testing.T) {
+	var wrapped int
+	base := &testExtension{
+		BaseExtension: extension.BaseExtension{ExtName: "BASE", ExtCapabilities: []imap.Cap{"X-BASE"}},
+		handlers: map[string]interface{}{
+			"XBASE": func(ctx *CommandContext) error { return nil },
+		},
+		wrap: func(name string, handler interface{}) interface{} {
+			if name != "NOOP" {
+				return nil
+			}
+			next := handler.(CommandHandler)
+			return CommandHandlerFunc(func(ctx *CommandContext) error {
+				wrapped++
+				return next.Handle(ctx)
+			})
+		},
+	}
+	dependent := &testExtension{
+		BaseExtension: extension.BaseExtension{ExtName: "DEPENDENT", ExtCapabilities: []imap.Cap{"X-DEPENDENT"}, ExtDependencies: []string{"BASE"}},
+	}
+	builtin := RegisterBuiltinFunc
+	t.Cleanup(func() { RegisterBuiltinFunc = builtin })
+	RegisterBuiltinFunc = func(srv *Server) {
+		srv.HandleFunc("NOOP", func(ctx *CommandContext) error { return nil })
+	}
+
+	srv := New(WithExtensions(base, dependent))
+	srv.HandleFunc("XUSER", func(ctx *CommandContext) error { return nil })
+
+	newTestConn := func() *Conn {
+		serverConn, clientConn := net.Pipe()
+		t.Cleanup(func() {
+			_ = serverConn.Close()
+			_ = clientConn.Close()
+		})
+		return newConn(serverConn, srv)
+	}
+	before := newTestConn()
+
+	if err := srv.SetExtensionEnabled("BASE", false); err != nil {
+		t.Fatalf("SetExtensionEnabled() error: %v", err)
+	}
+	if srv.ExtensionEnabled("BASE") || srv.ExtensionEnabled("DEPENDENT") {
+		t.Error("ExtensionEnabled() reports a disabled extension or its dependent as enabled")
+	}
+	after := newTestConn()
+
+	// The open connection keeps the extensions
+	caps := srv.Capabilities(before)
+	if !hasCap(caps, "X-BASE") || !hasCap(caps, "X-DEPENDENT") {
+		t.Errorf("caps of an open connection = %v, want X-BASE and X-DEPENDENT", caps)
+	}
+	if before.handlerSet().dispatcher.Get("XBASE") == nil {
+		t.Error("open connection lost the XBASE command")
+	}
+
+	caps = srv.Capabilities(after)
+	if hasCap(caps, "X-BASE") || hasCap(caps, "X-DEPENDENT") {
+		t.Errorf("caps of a new connection = %v, want neither X-BASE nor X-DEPENDENT", caps)
+	}
+	d := after.handlerSet().dispatcher
+	if d.Get("XBASE") != nil {
+		t.Error("new connection has the XBASE command of a disabled extension")
+	}
+	if d.Get("XUSER") == nil || d.Get("NOOP") == nil {
+		t.Error("new connection lost the built-in or user handlers")
+	}
+	_ = d.Get("NOOP").Handle(nil)
+	if wrapped != 0 {
+		t.Error("NOOP is wrapped by a disabled extension")
+	}
+	_ = before.handlerSet().dispatcher.Get("NOOP").Handle(nil)
+	if wrapped != 1 {
+		t.Error("NOOP of an open connection is not wrapped")
+	}
+
+	if err := srv.SetExtensionEnabled("BASE", true); err != nil {
+		t.Fatalf("SetExtensionEnabled() error: %v", err)
+	}
+	if caps := srv.Capabilities(newTestConn()); !hasCap(caps, "X-BASE") || !hasCap(caps, "X-DEPENDENT") {
+		t.Errorf("caps after re-enabling = %v", caps)
+	}
+
+	if err := srv.SetExtensionEnabled("MISSING", false); err == nil {
+		t.Error("SetExtensionEnabled() of an unknown extension succeeded")
+	}
+}
+
+func TestWithDisabledExtensions(t *testing.T) {
+	ext := &testExtension{
+		BaseExtension: extension.BaseExtension{ExtName: "TEST", ExtCapabilities: []imap.Cap{"X-TEST"}},
+	}
+	c := newCapTestConn(t, WithExtensions(ext), WithDisabledExtensions("TEST"))
+	if caps := c.server.Capabilities(c); hasCap(caps, "X-TEST") {
+		t.Errorf("caps = %v include a disabled extension", caps)
+	}
+	if err := c.server.SetExtensionEnabled("TEST", true); err != nil {
+		t.Fatalf("SetExtensionEnabled() error: %v", err)
+	}
+	if !c.server.ExtensionEnabled("TEST") {
+		t.Error("ExtensionEnabled() = false after enabling")
+	}
+}
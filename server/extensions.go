@@ -0,0 +1,125 @@
+package server
+
+import (
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/extension"
+)
+
+// Extensions returns the installed server extensions in installation order.
+func (srv *Server) Extensions() []extension.ServerExtension {
+	result := make([]extension.ServerExtension, len(srv.extensions))
+	copy(result, srv.extensions)
+	return result
+}
+
+// installExtensions registers the command handlers and handler wrappers of
+// the configured extensions. Extensions are installed in dependency order.
+func (srv *Server) installExtensions() {
+	srv.extensions = append(srv.extensions, srv.installExtensionsInto(srv.dispatcher, nil, true)...)
+
+	for _, c := range srv.ExtensionConflicts() {
+		srv.options.Logger.Warn("conflicting extensions",
+			"command", c.Command, "extension", c.Extension, "other", c.Other, "reason", c.Reason)
+	}
+}
+
+// installExtensionsInto registers the handlers of the configured
+// extensions in d, except those of the disabled extensions and of the
+// extensions depending on them, and returns the extensions installed. If
+// record is set, the handler chains are recorded for HandlerChain.
+func (srv *Server) installExtensionsInto(d *Dispatcher, disabled map[string]bool, record bool) []extension.ServerExtension {
+	if len(srv.options.Extensions) == 0 {
+		return nil
+	}
+
+	reg := extension.NewRegistry()
+	for _, ext := range srv.options.Extensions {
+		if err := reg.Register(ext); err != nil && record {
+			srv.options.Logger.Error("skipping extension", "extension", ext.Name(), "error", err)
+		}
+	}
+
+	ordered, err := reg.Resolve()
+	if err != nil {
+		if record {
+			srv.options.Logger.Error("resolving extensions", "error", err)
+		}
+		ordered = reg.All()
+	}
+
+	var installed []extension.ServerExtension
+	skipped := make(map[string]bool)
+	for _, ext := range ordered {
+		serverExt, ok := ext.(extension.ServerExtension)
+		if !ok {
+			continue
+		}
+		if skip := disabled[ext.Name()]; skip || dependsOn(ext, skipped) {
+			skipped[ext.Name()] = true
+			if !skip {
+				srv.options.Logger.Warn("extension disabled with its dependency", "extension", ext.Name())
+			}
+			continue
+		}
+
+		for name, h := range serverExt.CommandHandlers() {
+			if handler := toCommandHandler(h); handler != nil {
+				d.Register(name, handler)
+				if record {
+					srv.recordHandler(name, serverExt)
+				}
+			} else if record {
+				srv.options.Logger.Error("unsupported command handler type",
+					"extension", serverExt.Name(), "command", name)
+			}
+		}
+
+		for _, name := range d.Names() {
+			current := d.Get(name)
+			if wrapped := toCommandHandler(serverExt.WrapHandler(name, current)); wrapped != nil {
+				d.Register(name, wrapped)
+				if record {
+					srv.recordWrapper(name, serverExt)
+				}
+			}
+		}
+
+		installed = append(installed, serverExt)
+	}
+	return installed
+}
+
+// dependsOn reports whether ext depends on one of names.
+func dependsOn(ext extension.Extension, names map[string]bool) bool {
+	for _, dep := range ext.Dependencies() {
+		if names[dep] {
+			return true
+		}
+	}
+	return false
+}
+
+// toCommandHandler converts a handler returned by an extension to a
+// CommandHandler. It returns nil for unsupported values.
+func toCommandHandler(h interface{}) CommandHandler {
+	switch h := h.(type) {
+	case CommandHandler:
+		return h
+	case func(*CommandContext) error:
+		return CommandHandlerFunc(h)
+	default:
+		return nil
+	}
+}
+
+// isPreAuthCap reports whether a capability is only meaningful before
+// authentication.
+func isPreAuthCap(c imap.Cap) bool {
+	if strings.EqualFold(string(c), string(imap.CapStartTLS)) || strings.EqualFold(string(c), string(imap.CapLogindisabled)) {
+		return true
+	}
+	_, ok := c.AuthMechanism()
+	return ok
+}
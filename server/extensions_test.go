@@ -0,0 +1,206 @@
+package server
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/extension"
+)
+
+type testExtension struct {
+	extension.BaseExtension
+	handlers map[string]interface{}
+	wrap     func(name string, handler interface{}) interface{}
+}
+
+func (e *testExtension) CommandHandlers() map[string]interface{} { return e.handlers }
+func (e *testExtension) WrapHandler(name string, handler interface{}) interface{} {
+	if e.wrap == nil {
+		return nil
+	}
+	return e.wrap(name, handler)
+}
+func (e *testExtension) SessionExtension() interface{} { return nil }
+func (e *testExtension) OnEnabled(connID string) error { return nil }
+
+type stateCapExtension struct {
+	testExtension
+}
+
+func (e *stateCapExtension) StateCapabilities(state imap.ConnState, conn extension.ConnInfo) []imap.Cap {
+	if state == imap.ConnStateNotAuthenticated {
+		return []imap.Cap{"AUTH=TEST"}
+	}
+	return []imap.Cap{"X-POSTAUTH"}
+}
+
+func newCapTestConn(t *testing.T, opts ...Option) *Conn {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() {
+		_ = serverConn.Close()
+		_ = clientConn.Close()
+	})
+	return newConn(serverConn, New(opts...))
+}
+
+func hasCap(caps []imap.Cap, c imap.Cap) bool {
+	for _, have := range caps {
+		if have == c {
+			return true
+		}
+	}
+	return false
+}
+
+func TestInstallExtensions(t *testing.T) {
+	var order []string
+	ext := &testExtension{
+		BaseExtension: extension.BaseExtension{ExtName: "TEST", ExtCapabilities: []imap.Cap{"X-TEST"}},
+		handlers: map[string]interface{}{
+			"XTEST": func(ctx *CommandContext) error { return nil },
+		},
+		wrap: func(name string, handler interface{}) interface{} {
+			if name != "NOOP" {
+				return nil
+			}
+			next := handler.(CommandHandler)
+			return CommandHandlerFunc(func(ctx *CommandContext) error {
+				order = append(order, "wrapper")
+				return next.Handle(ctx)
+			})
+		},
+	}
+
+	options := DefaultOptions()
+	options.Extensions = []extension.ServerExtension{ext}
+	srv := &Server{options: options, dispatcher: NewDispatcher()}
+	srv.Dispatcher().Register("NOOP", CommandHandlerFunc(func(ctx *CommandContext) error {
+		order = append(order, "noop")
+		return nil
+	}))
+	srv.installExtensions()
+
+	if srv.Dispatcher().Get("XTEST") == nil {
+		t.Fatal("extension command XTEST was not registered")
+	}
+	if len(srv.Extensions()) != 1 {
+		t.Fatalf("Extensions() = %d, want 1", len(srv.Extensions()))
+	}
+	_ = srv.Dispatcher().Get("NOOP").Handle(nil)
+	if len(order) != 2 || order[0] != "wrapper" || order[1] != "noop" {
+		t.Fatalf("call order = %v, want [wrapper noop]", order)
+	}
+}
+
+func TestCapabilitiesByState(t *testing.T) {
+	ext := &stateCapExtension{testExtension{
+		BaseExtension: extension.BaseExtension{ExtName: "STATE", ExtCapabilities: []imap.Cap{"X-STATIC"}},
+	}}
+	c := newCapTestConn(t,
+		WithExtensions(ext),
+		WithCapabilities(imap.CapAuthPlain),
+		WithStartTLS(nil),
+	)
+
+	caps := c.server.Capabilities(c)
+	for _, want := range []imap.Cap{"AUTH=TEST", imap.CapAuthPlain, imap.CapStartTLS, imap.CapLogindisabled} {
+		if !hasCap(caps, want) {
+			t.Errorf("pre-auth caps %v missing %s", caps, want)
+		}
+	}
+	if hasCap(caps, "X-STATIC") {
+		t.Errorf("pre-auth caps %v include static caps of a state-aware extension", caps)
+	}
+
+	if err := c.SetState(imap.ConnStateAuthenticated); err != nil {
+		t.Fatal(err)
+	}
+	caps = c.server.Capabilities(c)
+	if !hasCap(caps, "X-POSTAUTH") {
+		t.Errorf("post-auth caps %v missing X-POSTAUTH", caps)
+	}
+	for _, unwanted := range []imap.Cap{"AUTH=TEST", imap.CapAuthPlain, imap.CapStartTLS, imap.CapLogindisabled} {
+		if hasCap(caps, unwanted) {
+			t.Errorf("post-auth caps %v include %s", caps, unwanted)
+		}
+	}
+}
+
+// countingCapExtension counts the calls to StateCapabilities.
+type countingCapExtension struct {
+	stateCapExtension
+	calls int
+}
+
+func (e *countingCapExtension) StateCapabilities(state imap.ConnState, conn extension.ConnInfo) []imap.Cap {
+	e.calls++
+	caps := e.stateCapExtension.StateCapabilities(state, conn)
+	if conn.Enabled().Has("X-ENABLE") {
+		caps = append(caps, "X-ENABLED")
+	}
+	return append(caps, "X-ENABLE")
+}
+
+func TestConnCapabilities_Cached(t *testing.T) {
+	ext := &countingCapExtension{stateCapExtension: stateCapExtension{testExtension{
+		BaseExtension: extension.BaseExtension{ExtName: "STATE"},
+	}}}
+	c := newCapTestConn(t, WithExtensions(ext))
+
+	first := c.Capabilities()
+	first[0] = "X-MODIFIED"
+	if caps := c.Capabilities(); !hasCap(caps, "AUTH=TEST") || hasCap(caps, "X-MODIFIED") || ext.calls != 1 {
+		t.Fatalf("caps %v computed %d times, want the cached snapshot", caps, ext.calls)
+	}
+
+	if err := c.SetState(imap.ConnStateAuthenticated); err != nil {
+		t.Fatal(err)
+	}
+	if caps := c.Capabilities(); !hasCap(caps, "X-POSTAUTH") || hasCap(caps, "AUTH=TEST") || ext.calls != 2 {
+		t.Errorf("caps after authentication %v, computed %d times", caps, ext.calls)
+	}
+
+	c.server.EnableCapabilities(c, []imap.Cap{"X-UNKNOWN"})
+	if c.Capabilities(); ext.calls != 2 {
+		t.Errorf("caps recomputed after enabling nothing")
+	}
+	c.server.EnableCapabilities(c, []imap.Cap{"X-ENABLE"})
+	if caps := c.Capabilities(); !hasCap(caps, "X-ENABLED") || ext.calls != 3 {
+		t.Errorf("caps after ENABLE %v, computed %d times", caps, ext.calls)
+	}
+}
+
+func TestGreetingCapabilities(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{"default", []Option{WithExtensions(&stateCapExtension{})}, "* OK [CAPABILITY "},
+		{"disabled", []Option{WithGreetingCapabilities(false)}, "* OK IMAP server ready\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverConn, clientConn := net.Pipe()
+			defer clientConn.Close()
+			c := newConn(serverConn, New(tt.opts...))
+			go c.writeGreeting()
+
+			buf := make([]byte, 512)
+			n, err := clientConn.Read(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			greeting := string(buf[:n])
+			if !strings.HasPrefix(greeting, tt.want) {
+				t.Errorf("greeting = %q, want prefix %q", greeting, tt.want)
+			}
+			if tt.name == "default" && !strings.Contains(greeting, "AUTH=TEST") {
+				t.Errorf("greeting = %q, want the not authenticated capabilities", greeting)
+			}
+		})
+	}
+}
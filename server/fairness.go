@@ -0,0 +1,151 @@
+package server
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Defaults for WriteFairness.
+const (
+	DefaultWriteChunkSize   = 32 * 1024
+	DefaultWriteRoundBudget = 256 * 1024
+	DefaultMaxWriteWait     = 50 * time.Millisecond
+)
+
+// WriteFairness configures how the server shares its output between
+// connections, so that a connection streaming a large FETCH does not
+// starve the others. See WithWriteFairness.
+//
+// Writes to a connection are split into chunks. Each connection may write
+// RoundBudget bytes per scheduling round; once it has used its budget, it
+// waits for the next round while other connections are writing. A round
+// ends when no connection is writing or when a connection has waited
+// MaxWait. Small responses fit in the budget and are never delayed.
+type WriteFairness struct {
+	// ChunkSize is the largest write made to a connection at once. 0
+	// means DefaultWriteChunkSize.
+	ChunkSize int
+	// RoundBudget is the number of bytes a connection may write per
+	// round. 0 means DefaultWriteRoundBudget.
+	RoundBudget int
+	// MaxWait bounds how long a connection waits for the next round, so
+	// that a connection blocked on a slow client cannot stall the others.
+	// 0 means DefaultMaxWriteWait.
+	MaxWait time.Duration
+}
+
+// writeScheduler shares the output of a server between its connections.
+type writeScheduler struct {
+	chunkSize int
+	budget    int
+	maxWait   time.Duration
+
+	mu       sync.Mutex
+	round    uint64
+	inFlight int           // chunks being written
+	waiting  int           // connections waiting for the next round
+	next     chan struct{} // closed when the round ends
+}
+
+func newWriteScheduler(f WriteFairness) *writeScheduler {
+	s := &writeScheduler{
+		chunkSize: f.ChunkSize,
+		budget:    f.RoundBudget,
+		maxWait:   f.MaxWait,
+		next:      make(chan struct{}),
+	}
+	if s.chunkSize <= 0 {
+		s.chunkSize = DefaultWriteChunkSize
+	}
+	if s.budget <= 0 {
+		s.budget = DefaultWriteRoundBudget
+	}
+	if s.maxWait <= 0 {
+		s.maxWait = DefaultMaxWriteWait
+	}
+	return s
+}
+
+// writer returns a writer that writes to w under the scheduler.
+func (s *writeScheduler) writer(w io.Writer) *fairWriter {
+	return &fairWriter{s: s, w: w}
+}
+
+// acquire waits until fw may write n bytes in the current round.
+func (s *writeScheduler) acquire(fw *fairWriter, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		if fw.round != s.round {
+			fw.round, fw.used = s.round, 0
+		}
+		if fw.used == 0 || fw.used+n <= s.budget {
+			break
+		}
+		if s.inFlight == 0 {
+			s.advance()
+			continue
+		}
+
+		round, next := s.round, s.next
+		s.waiting++
+		s.mu.Unlock()
+		timer := time.NewTimer(s.maxWait)
+		select {
+		case <-next:
+		case <-timer.C:
+		}
+		timer.Stop()
+		s.mu.Lock()
+		s.waiting--
+		if s.round == round {
+			s.advance()
+		}
+	}
+	fw.used += n
+	s.inFlight++
+}
+
+// release records that a chunk has been written.
+func (s *writeScheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	if s.inFlight == 0 && s.waiting > 0 {
+		s.advance()
+	}
+}
+
+// advance starts a new round.
+// The caller must hold s.mu.
+func (s *writeScheduler) advance() {
+	s.round++
+	close(s.next)
+	s.next = make(chan struct{})
+}
+
+// fairWriter is the writer of a connection under a writeScheduler.
+type fairWriter struct {
+	s     *writeScheduler
+	w     io.Writer
+	round uint64
+	used  int // bytes written in round
+}
+
+// Write writes p in chunks, waiting for its turn before each one.
+func (fw *fairWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), fw.s.chunkSize)]
+		fw.s.acquire(fw, len(chunk))
+		n, err := fw.w.Write(chunk)
+		fw.s.release()
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingWriter records the size of each write.
+type recordingWriter struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	writes []int
+	block  chan struct{} // if set, writes wait until it is closed
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if w.block != nil {
+		<-w.block
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writes = append(w.writes, len(p))
+	return w.buf.Write(p)
+}
+
+func (w *recordingWriter) len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Len()
+}
+
+func TestFairWriter_Chunks(t *testing.T) {
+	s := newWriteScheduler(WriteFairness{ChunkSize: 1000, RoundBudget: 4000})
+	var rec recordingWriter
+	fw := s.writer(&rec)
+
+	data := strings.Repeat("0123456789", 1050)
+	n, err := fw.Write([]byte(data))
+	if err != nil || n != len(data) {
+		t.Fatalf("Write() = %d, %v", n, err)
+	}
+	if rec.buf.String() != data {
+		t.Error("data was changed")
+	}
+	if len(rec.writes) != 11 || rec.writes[10] != 500 {
+		t.Errorf("writes = %v, want 10 chunks of 1000 and one of 500", rec.writes)
+	}
+	for _, n := range rec.writes {
+		if n > 1000 {
+			t.Errorf("write of %d bytes exceeds the chunk size", n)
+		}
+	}
+}
+
+// waitFor polls until cond is true.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWriteScheduler_WaitsForOthers(t *testing.T) {
+	s := newWriteScheduler(WriteFairness{ChunkSize: 2, RoundBudget: 4, MaxWait: time.Minute})
+
+	// Connection b is in the middle of a write.
+	b := &recordingWriter{block: make(chan struct{})}
+	bDone := make(chan struct{})
+	go func() {
+		defer close(bDone)
+		_, _ = s.writer(b).Write([]byte("bb"))
+	}()
+	waitFor(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.inFlight == 1
+	})
+
+	// Connection a writes its budget, then waits for b.
+	var a recordingWriter
+	aDone := make(chan struct{})
+	go func() {
+		defer close(aDone)
+		_, _ = s.writer(&a).Write([]byte("aaaaaaaa"))
+	}()
+	waitFor(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.waiting == 1
+	})
+	if n := a.len(); n != 4 {
+		t.Fatalf("a wrote %d bytes before waiting, want its budget of 4", n)
+	}
+
+	close(b.block)
+	<-bDone
+	select {
+	case <-aDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("a did not resume after b finished")
+	}
+	if n := a.len(); n != 8 {
+		t.Errorf("a wrote %d bytes, want 8", n)
+	}
+}
+
+func TestWriteScheduler_MaxWait(t *testing.T) {
+	s := newWriteScheduler(WriteFairness{ChunkSize: 2, RoundBudget: 2, MaxWait: 10 * time.Millisecond})
+
+	// Connection b is stuck writing to a slow client.
+	b := &recordingWriter{block: make(chan struct{})}
+	defer close(b.block)
+	go func() { _, _ = s.writer(b).Write([]byte("bb")) }()
+	waitFor(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.inFlight == 1
+	})
+
+	var a recordingWriter
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = s.writer(&a).Write([]byte("aaaaaa"))
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("a stalled behind a blocked connection")
+	}
+	if n := a.len(); n != 6 {
+		t.Errorf("a wrote %d bytes, want 6", n)
+	}
+}
+
+func TestWriteScheduler_AloneNeverWaits(t *testing.T) {
+	s := newWriteScheduler(WriteFairness{ChunkSize: 2, RoundBudget: 2, MaxWait: time.Minute})
+	var a recordingWriter
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = s.writer(&a).Write(bytes.Repeat([]byte("a"), 100))
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("a connection writing alone waited for MaxWait")
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"sort"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/wire"
+)
+
+// RunFetch passes a FETCH or UID FETCH command to the session and writes
+// its responses through w, applying the rules for messages that do not
+// exist so that sessions do not have to:
+//
+//   - UID FETCH of UIDs that do not exist (any more) is not an error; such
+//     UIDs are skipped silently (RFC 9051 §6.4.8). A session that fails
+//     with a NONEXISTENT response code is treated as having found nothing.
+//   - If options.Vanished is set, which QRESYNC allows for UID FETCH with
+//     CHANGEDSINCE, the requested UIDs that no longer exist are reported in
+//     a VANISHED (EARLIER) response before the FETCH responses (RFC 7162
+//     §3.2.6). They are obtained from SessionVanished if the session
+//     implements it.
+//
+// RunFetch does not write the tagged response.
+func RunFetch(ctx *CommandContext, w *FetchWriter, numSet imap.NumSet, options *imap.FetchOptions) error {
+	uidSet, isUID := numSet.(*imap.UIDSet)
+
+	if options.Vanished && isUID && ctx.Conn.Enabled().Has(imap.CapQResync) {
+		vanished, err := vanishedUIDs(ctx.Session, uidSet, options.ChangedSince)
+		if err != nil {
+			return err
+		}
+		if vanished != nil && !vanished.IsEmpty() {
+			vanished.Normalize()
+			s := vanished.String()
+			ctx.Conn.Encoder().Encode(func(e *wire.Encoder) {
+				e.Star().Atom("VANISHED").SP().Atom("(EARLIER)").SP().Atom(s).CRLF()
+			})
+		}
+	}
+
+	if err := ctx.Session.Fetch(w, numSet, options); err != nil {
+		if !isUID || !isNonExistent(err) {
+			return err
+		}
+	}
+	return w.Err()
+}
+
+// vanishedUIDs returns the UIDs in uids that no longer exist.
+func vanishedUIDs(sess Session, uids *imap.UIDSet, sinceModSeq uint64) (*imap.UIDSet, error) {
+	if sv, ok := sess.(SessionVanished); ok {
+		return sv.ExpungedUIDs(uids, sinceModSeq)
+	}
+
+	var existing []uint32
+	w := &FetchWriter{collect: func(data *imap.FetchMessageData) {
+		existing = append(existing, uint32(data.UID))
+	}}
+	if err := sess.Fetch(w, uids, &imap.FetchOptions{UID: true}); err != nil {
+		if !isNonExistent(err) {
+			return nil, err
+		}
+	}
+	return missingUIDs(uids, existing), nil
+}
+
+// isNonExistent reports whether err is reported as NO [NONEXISTENT].
+func isNonExistent(err error) bool {
+	imapErr := imap.ClassifyError(err)
+	return imapErr != nil && imapErr.Code == imap.ResponseCodeNonExistent
+}
+
+// missingUIDs returns the UIDs in uids that are not in existing. Ranges
+// ending in "*" end at the highest existing UID, since the UIDs above it
+// have not been assigned yet.
+func missingUIDs(uids *imap.UIDSet, existing []uint32) *imap.UIDSet {
+	sort.Slice(existing, func(i, j int) bool { return existing[i] < existing[j] })
+	var max uint32
+	if len(existing) > 0 {
+		max = existing[len(existing)-1]
+	}
+
+	missing := &imap.UIDSet{}
+	for _, r := range uids.Ranges() {
+		start, stop := r.Start, r.Stop
+		if start == 0 || stop == 0 {
+			// "*" or "n:*": the range ends at the highest existing UID.
+			start += stop
+			if start == 0 || start > max {
+				start = max
+			}
+			stop = max
+		} else if start > stop {
+			start, stop = stop, start
+		}
+		if stop == 0 {
+			continue
+		}
+
+		next := start
+		i := sort.Search(len(existing), func(i int) bool { return existing[i] >= start })
+		for ; i < len(existing) && existing[i] <= stop; i++ {
+			if existing[i] > next {
+				missing.AddRange(imap.UID(next), imap.UID(existing[i]-1))
+			}
+			next = existing[i] + 1
+		}
+		if next <= stop {
+			missing.AddRange(imap.UID(next), imap.UID(stop))
+		}
+	}
+	return missing
+}
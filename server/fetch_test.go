@@ -0,0 +1,167 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// fetchSession holds messages with UIDs 2, 3 and 7; UID 7 was modified
+// after mod-sequence 10.
+type fetchSession struct {
+	Session
+	err error
+}
+
+func (s *fetchSession) Fetch(w *FetchWriter, numSet imap.NumSet, options *imap.FetchOptions) error {
+	if s.err != nil {
+		return s.err
+	}
+	uids, _ := numSet.(*imap.UIDSet)
+	for i, uid := range []imap.UID{2, 3, 7} {
+		modSeq := uint64(5)
+		if uid == 7 {
+			modSeq = 20
+		}
+		if uids == nil || !uids.Contains(uid) || modSeq <= options.ChangedSince {
+			continue
+		}
+		w.WriteFetchData(&imap.FetchMessageData{SeqNum: uint32(i + 1), UID: uid})
+	}
+	return nil
+}
+
+// runFetch runs RunFetch for a UID FETCH and returns the written lines.
+func runFetch(t *testing.T, sess Session, qresync bool, uids string, options *imap.FetchOptions) ([]string, error) {
+	t.Helper()
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	srv := New()
+	conn := newConn(c1, srv)
+	conn.session = sess
+	if qresync {
+		conn.Enabled().Add(imap.CapQResync)
+	}
+	ctx := &CommandContext{Conn: conn, Session: sess, Server: srv, NumKind: NumKindUID}
+
+	set, err := imap.ParseUIDSet(uids)
+	if err != nil {
+		t.Fatalf("ParseUIDSet() error: %v", err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- RunFetch(ctx, NewFetchWriter(conn.Encoder()), set, options)
+		c1.Close()
+	}()
+
+	var lines []string
+	r := bufio.NewReader(c2)
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadString() error: %v", err)
+		}
+		lines = append(lines, strings.TrimRight(line, "\r\n"))
+	}
+	return lines, <-errc
+}
+
+func TestRunFetch_UnknownUIDsSkipped(t *testing.T) {
+	lines, err := runFetch(t, &fetchSession{}, false, "1:5,9", &imap.FetchOptions{UID: true})
+	if err != nil {
+		t.Fatalf("RunFetch() error: %v", err)
+	}
+	want := []string{"* 1 FETCH (UID 2)", "* 2 FETCH (UID 3)"}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", lines, want)
+	}
+
+	lines, err = runFetch(t, &fetchSession{err: imap.ErrNonExistent}, false, "9", &imap.FetchOptions{UID: true})
+	if err != nil {
+		t.Errorf("RunFetch() error = %v, want NONEXISTENT to be ignored", err)
+	}
+	if len(lines) != 0 {
+		t.Errorf("got %q, want no output", lines)
+	}
+}
+
+func TestRunFetch_Vanished(t *testing.T) {
+	options := &imap.FetchOptions{UID: true, ChangedSince: 10, Vanished: true}
+	lines, err := runFetch(t, &fetchSession{}, true, "1:*", options)
+	if err != nil {
+		t.Fatalf("RunFetch() error: %v", err)
+	}
+	want := []string{"* VANISHED (EARLIER) 1,4:6", "* 3 FETCH (UID 7)"}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", lines, want)
+	}
+}
+
+func TestRunFetch_VanishedRequiresQResync(t *testing.T) {
+	options := &imap.FetchOptions{UID: true, ChangedSince: 10, Vanished: true}
+	lines, err := runFetch(t, &fetchSession{}, false, "1:*", options)
+	if err != nil {
+		t.Fatalf("RunFetch() error: %v", err)
+	}
+	if len(lines) != 1 || lines[0] != "* 3 FETCH (UID 7)" {
+		t.Errorf("got %q, want only the FETCH response", lines)
+	}
+}
+
+type vanishedSession struct {
+	fetchSession
+	since uint64
+}
+
+func (s *vanishedSession) ExpungedUIDs(uids *imap.UIDSet, sinceModSeq uint64) (*imap.UIDSet, error) {
+	s.since = sinceModSeq
+	return imap.ParseUIDSet("4")
+}
+
+func TestRunFetch_SessionVanished(t *testing.T) {
+	sess := &vanishedSession{}
+	options := &imap.FetchOptions{UID: true, ChangedSince: 10, Vanished: true}
+	lines, err := runFetch(t, sess, true, "1:*", options)
+	if err != nil {
+		t.Fatalf("RunFetch() error: %v", err)
+	}
+	if len(lines) == 0 || lines[0] != "* VANISHED (EARLIER) 4" {
+		t.Errorf("got %q, want VANISHED from the session", lines)
+	}
+	if sess.since != 10 {
+		t.Errorf("ExpungedUIDs() since = %d, want 10", sess.since)
+	}
+}
+
+func TestMissingUIDs(t *testing.T) {
+	tests := []struct {
+		set      string
+		existing []uint32
+		want     string
+	}{
+		{"1:10", []uint32{3, 5}, "1:2,4,6:10"},
+		{"1:*", []uint32{3, 5}, "1:2,4"},
+		{"*:4", []uint32{2, 8}, "4:7"},
+		{"9:*", []uint32{2, 5}, ""},
+		{"4:2", nil, "2:4"},
+		{"*", nil, ""},
+		{"3,5", []uint32{3, 5}, ""},
+	}
+	for _, tt := range tests {
+		set, err := imap.ParseUIDSet(tt.set)
+		if err != nil {
+			t.Fatalf("ParseUIDSet(%q) error: %v", tt.set, err)
+		}
+		if got := missingUIDs(set, tt.existing).String(); got != tt.want {
+			t.Errorf("missingUIDs(%q, %v) = %q, want %q", tt.set, tt.existing, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/wire"
+)
+
+// ReadBodySection reads a BODY[] or BODY.PEEK[] fetch item whose
+// beginning, such as "BODY[1.HEADER.FIELDS" or "BODY", was already read as
+// an atom, and parses it with imap.ParseFetchItemBodySection. The rest of
+// the section specifier, the closing bracket and a partial range are read
+// from dec.
+func ReadBodySection(dec *wire.Decoder, item string) (*imap.FetchItemBodySection, error) {
+	var b strings.Builder
+	b.WriteString(item)
+	if !strings.Contains(item, "[") {
+		if err := dec.ExpectByte('['); err != nil {
+			return nil, err
+		}
+		b.WriteByte('[')
+	}
+
+	quoted := false
+	for {
+		c, err := readByte(dec)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteByte(c)
+		if quoted && c == '\\' {
+			if c, err = readByte(dec); err != nil {
+				return nil, err
+			}
+			b.WriteByte(c)
+			continue
+		}
+		if c == '"' {
+			quoted = !quoted
+		}
+		if c == ']' && !quoted {
+			break
+		}
+	}
+
+	partial, err := readPartial(dec)
+	if err != nil {
+		return nil, err
+	}
+	b.WriteString(partial)
+	return imap.ParseFetchItemBodySection(b.String())
+}
+
+// ReadSectionPartial reads a partial range such as <0.1024> following a
+// fetch item, if there is one.
+func ReadSectionPartial(dec *wire.Decoder) (*imap.SectionPartial, error) {
+	partial, err := readPartial(dec)
+	if err != nil || partial == "" {
+		return nil, err
+	}
+	return imap.ParseSectionPartial(partial)
+}
+
+// readPartial reads the text of a partial range, or nothing if the next
+// byte does not start one.
+func readPartial(dec *wire.Decoder) (string, error) {
+	if c, err := dec.PeekByte(); err != nil || c != '<' {
+		return "", nil
+	}
+	var b strings.Builder
+	for {
+		c, err := readByte(dec)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(c)
+		if c == '>' {
+			return b.String(), nil
+		}
+	}
+}
+
+// readByte reads a single byte.
+func readByte(dec *wire.Decoder) (byte, error) {
+	c, err := dec.PeekByte()
+	if err != nil {
+		return 0, err
+	}
+	return c, dec.ExpectByte(c)
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	imap "github.com/meszmate/imap-go"
+)
+
+// Greeting is the initial response of the server on a connection (RFC
+// 9051 section 7.1.1, 7.1.4 and 7.1.5).
+type Greeting struct {
+	// Type is OK for a connection that has to authenticate, PREAUTH for
+	// one that is already authenticated, such as by its client
+	// certificate or network, or BYE for one that is rejected and closed
+	// after the greeting. If empty, OK is used.
+	Type imap.StatusResponseType
+
+	// Code is an optional response code, such as ALERT. Without a code,
+	// OK and PREAUTH greetings carry a CAPABILITY response code, unless
+	// disabled with Options.GreetingCapabilities.
+	Code imap.ResponseCode
+
+	// Text is the human-readable text. If empty, Options.GreetingText is
+	// used.
+	Text string
+
+	// Username is the user of a PREAUTH connection, see Conn.Username.
+	// The session has to be set up for that user by Options.NewSession
+	// or the GreetingFunc, as no LOGIN is run.
+	Username string
+}
+
+// GreetingFunc returns the greeting of a connection, for example a BYE for
+// connections from blocked addresses:
+//
+//	server.WithGreetingFunc(func(c *server.Conn) server.Greeting {
+//		if blocked(c.RemoteAddr()) {
+//			return server.Greeting{Type: imap.StatusResponseTypeBYE, Text: "Go away"}
+//		}
+//		return server.Greeting{}
+//	})
+//
+// It runs after the session is created, in the connection's goroutine.
+type GreetingFunc func(c *Conn) Greeting
+
+// WithGreeting sets the greeting of all connections, see Greeting.
+func WithGreeting(g Greeting) Option {
+	return func(o *Options) {
+		o.Greeting = g
+	}
+}
+
+// WithGreetingFunc sets a function choosing the greeting of each
+// connection. It overrides Options.Greeting.
+func WithGreetingFunc(fn GreetingFunc) Option {
+	return func(o *Options) {
+		o.GreetingFunc = fn
+	}
+}
+
+// greeting returns the greeting of the connection, with the defaults
+// applied.
+func (c *Conn) greeting() Greeting {
+	g := c.server.options.Greeting
+	if fn := c.server.options.GreetingFunc; fn != nil {
+		g = fn(c)
+	}
+	if g.Type == "" {
+		g.Type = imap.StatusResponseTypeOK
+	}
+	if g.Text == "" {
+		g.Text = c.server.options.GreetingText
+	}
+	return g
+}
+
+// writeGreeting writes the initial server greeting and returns false if it
+// is a BYE, after which the connection is closed. A PREAUTH greeting moves
+// the connection to the authenticated state first. Unless disabled with
+// Options.GreetingCapabilities, OK and PREAUTH greetings without another
+// response code carry a CAPABILITY response code so clients can skip the
+// CAPABILITY command. The capabilities are computed like those of the
+// CAPABILITY command in the state following the greeting.
+func (c *Conn) writeGreeting() bool {
+	g := c.greeting()
+	switch g.Type {
+	case imap.StatusResponseTypeBYE:
+		c.writeStatus("*", g.Type, g.Code, g.Text)
+		return false
+	case imap.StatusResponseTypePREAUTH:
+		if err := c.SetState(imap.ConnStateAuthenticated); err != nil {
+			c.logger.Error("preauthenticating connection", "error", err)
+			c.WriteBYE("internal server error")
+			return false
+		}
+		c.SetUsername(g.Username)
+	default:
+		g.Type = imap.StatusResponseTypeOK
+	}
+
+	code := g.Code
+	if code == "" && c.server.options.GreetingCapabilities {
+		code = imap.ResponseCode("CAPABILITY " + c.capabilities().text)
+	}
+	c.writeStatus("*", g.Type, code, g.Text)
+	return true
+}
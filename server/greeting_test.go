@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestGreeting(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []Option
+		want  string
+		state imap.ConnState
+	}{
+		{
+			"alert",
+			[]Option{WithGreeting(Greeting{Code: imap.ResponseCodeAlert, Text: "Maintenance at 2am"})},
+			"* OK [ALERT] Maintenance at 2am",
+			imap.ConnStateNotAuthenticated,
+		},
+		{
+			"deprecated text",
+			[]Option{WithGreetingText("Hello"), WithGreetingCapabilities(false)},
+			"* OK Hello",
+			imap.ConnStateNotAuthenticated,
+		},
+		{
+			"preauth",
+			[]Option{WithGreeting(Greeting{Type: imap.StatusResponseTypePREAUTH, Username: "alice", Text: "Welcome alice"}), WithExtensions(&stateCapExtension{})},
+			"* PREAUTH [CAPABILITY ",
+			imap.ConnStateAuthenticated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverConn, clientConn := net.Pipe()
+			defer clientConn.Close()
+			c := newConn(serverConn, New(tt.opts...))
+			go c.writeGreeting()
+
+			line, err := bufio.NewReader(clientConn).ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(line, tt.want) {
+				t.Errorf("greeting = %q, want prefix %q", line, tt.want)
+			}
+			if c.State() != tt.state {
+				t.Errorf("state = %v, want %v", c.State(), tt.state)
+			}
+			if tt.name == "preauth" {
+				if !strings.Contains(line, "X-POSTAUTH") || strings.Contains(line, "AUTH=TEST") {
+					t.Errorf("greeting = %q, want the authenticated capabilities", line)
+				}
+				if c.Username() != "alice" {
+					t.Errorf("Username() = %q, want alice", c.Username())
+				}
+			}
+		})
+	}
+}
+
+func TestGreetingFunc_Bye(t *testing.T) {
+	srv := New(WithGreetingFunc(func(c *Conn) Greeting {
+		if strings.HasPrefix(c.RemoteAddr().String(), "pipe") {
+			return Greeting{Type: imap.StatusResponseTypeBYE, Text: "Connection refused"}
+		}
+		return Greeting{}
+	}))
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	c := newConn(serverConn, srv)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.serve()
+	}()
+
+	out, err := io.ReadAll(clientConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "* BYE Connection refused\r\n" {
+		t.Errorf("output = %q, want only the BYE greeting", out)
+	}
+	<-done
+}
@@ -40,6 +40,10 @@ type CommandContext struct {
 	// Name is the command name (uppercase).
 	Name string
 
+	// Line is the command line as received, with the tag but without
+	// literal data and the final CRLF.
+	Line string
+
 	// NumKind indicates if this is a UID command (NumKindUID) or sequence command (NumKindSeq).
 	NumKind NumKind
 
@@ -60,6 +64,21 @@ type CommandContext struct {
 	values map[string]interface{}
 }
 
+// PollUpdates flushes pending unsolicited updates for the connection by
+// calling Session.Poll. EXPUNGE updates are only allowed if no other
+// command is in progress on the connection and the command is not FETCH,
+// STORE or SEARCH, during which RFC 9051 §7.5.1 forbids them; their UID
+// forms allow them. It does nothing before the connection is
+// authenticated.
+func (ctx *CommandContext) PollUpdates() error {
+	if ctx.Conn.State() == imap.ConnStateNotAuthenticated || ctx.Session == nil {
+		return nil
+	}
+	allowExpunge := ctx.Conn.inProgress.Load() <= 1 &&
+		(ctx.NumKind == NumKindUID || !noExpungeCommands[ctx.Name])
+	return ctx.Session.Poll(NewUpdateWriter(ctx.Conn.Encoder()), allowExpunge)
+}
+
 // SetValue stores a value in the command context (for middleware data passing).
 func (ctx *CommandContext) SetValue(key string, value interface{}) {
 	ctx.mu.Lock()
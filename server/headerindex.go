@@ -0,0 +1,142 @@
+package server
+
+import (
+	"reflect"
+	"sort"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// SessionHeaderIndex is an optional interface for sessions that keep an
+// index of the header fields of their messages, so that SEARCH keys such
+// as FROM, TO, SUBJECT and HEADER can be answered without reading the
+// messages. RunSearch looks up the header keys of a search in the index
+// and passes the session the remaining criteria, restricted to the UIDs
+// the index returned, so that only the messages that can still match are
+// loaded, and only if other criteria need them.
+type SessionHeaderIndex interface {
+	// SearchHeader returns the UIDs of the messages of the selected
+	// mailbox, in ascending order, whose header field key contains value,
+	// compared case-insensitively, or that have the field at all if value
+	// is empty. It returns false if the field is not indexed, in which
+	// case the criterion is left to Search.
+	SearchHeader(key, value string) (uids []imap.UID, ok bool, err error)
+}
+
+// ApplyHeaderIndex answers the header criteria of a search from idx. It
+// returns criteria without the header keys the index answered, narrowed
+// to the UIDs of the messages matching them, which may be none. Header
+// keys nested in OR are answered if both sides consist of indexed header
+// keys only; those nested in NOT are left alone. If idx answers nothing,
+// or the search is fuzzy (RFC 6203), criteria is returned unchanged.
+func ApplyHeaderIndex(idx SessionHeaderIndex, criteria *imap.SearchCriteria) (*imap.SearchCriteria, error) {
+	if idx == nil || criteria == nil || criteria.Fuzzy {
+		return criteria, nil
+	}
+
+	rest := *criteria
+	rest.Header = nil
+	rest.Or = nil
+	rest.Not = append([]imap.SearchCriteria(nil), criteria.Not...)
+
+	var candidates []imap.UID
+	answered := false
+	narrow := func(uids []imap.UID) {
+		if !answered {
+			candidates = uids
+			answered = true
+		} else {
+			candidates = intersectUIDs(candidates, uids)
+		}
+	}
+
+	for _, hdr := range criteria.Header {
+		uids, ok, err := idx.SearchHeader(hdr.Key, hdr.Value)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			rest.Header = append(rest.Header, hdr)
+			continue
+		}
+		narrow(uids)
+	}
+
+	for _, pair := range criteria.Or {
+		left, lok, err := searchHeaderOnly(idx, &pair[0])
+		if err != nil {
+			return nil, err
+		}
+		right, rok, err := searchHeaderOnly(idx, &pair[1])
+		if err != nil {
+			return nil, err
+		}
+		if !lok || !rok {
+			rest.Or = append(rest.Or, pair)
+			continue
+		}
+		narrow(unionUIDs(left, right))
+	}
+
+	if !answered {
+		return criteria, nil
+	}
+	uidSet := &imap.UIDSet{}
+	uidSet.AddNum(candidates...)
+	uidSet.Normalize()
+	rest.And(&imap.SearchCriteria{UID: uidSet})
+	return &rest, nil
+}
+
+// searchHeaderOnly answers criteria from idx if it consists of header keys
+// only, all of them indexed.
+func searchHeaderOnly(idx SessionHeaderIndex, criteria *imap.SearchCriteria) ([]imap.UID, bool, error) {
+	if len(criteria.Header) == 0 || !reflect.DeepEqual(imap.SearchCriteria{Header: criteria.Header}, *criteria) {
+		return nil, false, nil
+	}
+	var result []imap.UID
+	for i, hdr := range criteria.Header {
+		uids, ok, err := idx.SearchHeader(hdr.Key, hdr.Value)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		if i == 0 {
+			result = uids
+		} else {
+			result = intersectUIDs(result, uids)
+		}
+	}
+	return result, true, nil
+}
+
+// intersectUIDs returns the UIDs in both a and b, which are sorted.
+func intersectUIDs(a, b []imap.UID) []imap.UID {
+	var out []imap.UID
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// unionUIDs returns the UIDs in a or b, which are sorted, in order.
+func unionUIDs(a, b []imap.UID) []imap.UID {
+	out := append(append(make([]imap.UID, 0, len(a)+len(b)), a...), b...)
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	n := 0
+	for i, uid := range out {
+		if i == 0 || uid != out[n-1] {
+			out[n] = uid
+			n++
+		}
+	}
+	return out[:n]
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// fakeHeaderIndex indexes From and Subject of messages 1 to 4.
+type fakeHeaderIndex struct{}
+
+func (idx *fakeHeaderIndex) SearchHeader(key, value string) ([]imap.UID, bool, error) {
+	fields := map[imap.UID]map[string]string{
+		1: {"from": "alice@example.org", "subject": "lunch"},
+		2: {"from": "bob@example.org", "subject": "lunch"},
+		3: {"from": "alice@example.org", "subject": "report"},
+		4: {"from": "carol@example.org"},
+	}
+	switch key = strings.ToLower(key); key {
+	case "from", "subject":
+	case "x-fail":
+		return nil, false, errors.New("index unavailable")
+	default:
+		return nil, false, nil
+	}
+	var uids []imap.UID
+	for uid := imap.UID(1); uid <= 4; uid++ {
+		if v, ok := fields[uid][key]; ok && strings.Contains(v, strings.ToLower(value)) {
+			uids = append(uids, uid)
+		}
+	}
+	return uids, true, nil
+}
+
+func hdr(key, value string) imap.SearchCriteriaHeaderField {
+	return imap.SearchCriteriaHeaderField{Key: key, Value: value}
+}
+
+func TestApplyHeaderIndex(t *testing.T) {
+	tests := []struct {
+		name     string
+		criteria imap.SearchCriteria
+		uids     string // "" if criteria is returned unchanged
+		header   []imap.SearchCriteriaHeaderField
+		or       int
+	}{
+		{
+			name:     "single key",
+			criteria: imap.SearchCriteria{Header: []imap.SearchCriteriaHeaderField{hdr("From", "alice")}},
+			uids:     "1,3",
+		},
+		{
+			name: "keys are intersected",
+			criteria: imap.SearchCriteria{
+				Header: []imap.SearchCriteriaHeaderField{hdr("From", "alice"), hdr("Subject", "lunch")},
+				Body:   []string{"dessert"},
+			},
+			uids: "1",
+		},
+		{
+			name:     "no match",
+			criteria: imap.SearchCriteria{Header: []imap.SearchCriteriaHeaderField{hdr("From", "dave")}},
+			uids:     "",
+		},
+		{
+			name:     "unindexed key is kept",
+			criteria: imap.SearchCriteria{Header: []imap.SearchCriteriaHeaderField{hdr("From", "alice"), hdr("List-Id", "dev")}},
+			uids:     "1,3",
+			header:   []imap.SearchCriteriaHeaderField{hdr("List-Id", "dev")},
+		},
+		{
+			name: "or of header keys",
+			criteria: imap.SearchCriteria{Or: [][2]imap.SearchCriteria{{
+				{Header: []imap.SearchCriteriaHeaderField{hdr("From", "bob")}},
+				{Header: []imap.SearchCriteriaHeaderField{hdr("From", "carol")}},
+			}}},
+			uids: "2,4",
+		},
+		{
+			name: "or with other keys is kept",
+			criteria: imap.SearchCriteria{
+				Header: []imap.SearchCriteriaHeaderField{hdr("Subject", "lunch")},
+				Or: [][2]imap.SearchCriteria{{
+					{Header: []imap.SearchCriteriaHeaderField{hdr("From", "bob")}},
+					{Flag: []imap.Flag{imap.FlagSeen}},
+				}},
+			},
+			uids: "1:2",
+			or:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := tt.criteria
+			got, err := ApplyHeaderIndex(&fakeHeaderIndex{}, &tt.criteria)
+			if err != nil {
+				t.Fatalf("ApplyHeaderIndex() error: %v", err)
+			}
+			if !reflect.DeepEqual(tt.criteria, orig) {
+				t.Errorf("criteria modified: %+v", tt.criteria)
+			}
+			if got.UID == nil {
+				t.Fatalf("UID = nil, want %q", tt.uids)
+			}
+			if s := got.UID.String(); s != tt.uids {
+				t.Errorf("UID = %q, want %q", s, tt.uids)
+			}
+			if !reflect.DeepEqual(got.Header, tt.header) {
+				t.Errorf("Header = %v, want %v", got.Header, tt.header)
+			}
+			if len(got.Or) != tt.or {
+				t.Errorf("Or = %v, want %d pairs", got.Or, tt.or)
+			}
+			if !reflect.DeepEqual(got.Body, tt.criteria.Body) {
+				t.Errorf("Body = %v, want %v", got.Body, tt.criteria.Body)
+			}
+		})
+	}
+}
+
+func TestApplyHeaderIndex_Unchanged(t *testing.T) {
+	for _, criteria := range []*imap.SearchCriteria{
+		{Body: []string{"lunch"}},
+		{Header: []imap.SearchCriteriaHeaderField{hdr("List-Id", "dev")}},
+		{Header: []imap.SearchCriteriaHeaderField{hdr("From", "alice")}, Fuzzy: true},
+		{Not: []imap.SearchCriteria{{Header: []imap.SearchCriteriaHeaderField{hdr("From", "alice")}}}},
+	} {
+		got, err := ApplyHeaderIndex(&fakeHeaderIndex{}, criteria)
+		if err != nil {
+			t.Fatalf("ApplyHeaderIndex() error: %v", err)
+		}
+		if got != criteria {
+			t.Errorf("ApplyHeaderIndex(%+v) = %+v, want criteria unchanged", criteria, got)
+		}
+	}
+}
+
+func TestApplyHeaderIndex_ExistingUIDs(t *testing.T) {
+	criteria := &imap.SearchCriteria{
+		UID:    &imap.UIDSet{Set: []imap.NumRange{{Start: 2, Stop: 3}}},
+		Header: []imap.SearchCriteriaHeaderField{hdr("From", "alice")},
+	}
+	got, err := ApplyHeaderIndex(&fakeHeaderIndex{}, criteria)
+	if err != nil {
+		t.Fatalf("ApplyHeaderIndex() error: %v", err)
+	}
+	// Both UID sets must still apply.
+	if got.UID.String() != "2:3" || len(got.Not) != 1 {
+		t.Errorf("UID = %v, Not = %+v", got.UID, got.Not)
+	}
+}
+
+func TestApplyHeaderIndex_Error(t *testing.T) {
+	criteria := &imap.SearchCriteria{Header: []imap.SearchCriteriaHeaderField{hdr("X-Fail", "x")}}
+	if _, err := ApplyHeaderIndex(&fakeHeaderIndex{}, criteria); err == nil {
+		t.Error("ApplyHeaderIndex() error = nil, want the index error")
+	}
+}
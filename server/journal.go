@@ -0,0 +1,232 @@
+package server
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// ErrJournalPruned is returned by a Journal asked for the changes since a
+// mod-sequence older than the entries it still has. Backends then have to
+// report changes without the journal, for example by treating all messages
+// as changed and computing expunged UIDs with the UIDs that still exist.
+var ErrJournalPruned = errors.New("journal pruned past the requested mod-sequence")
+
+// JournalEntry is a change to a message recorded in a Journal.
+type JournalEntry struct {
+	// ModSeq is the mod-sequence assigned to the change.
+	ModSeq uint64
+	// UID is the UID of the changed message.
+	UID imap.UID
+	// Expunged is true if the message was expunged, false if it was added
+	// or its flags changed.
+	Expunged bool
+	// Time is when the change was recorded.
+	Time time.Time
+}
+
+// Journal is an append-only log of the changes to the messages of a
+// mailbox, keyed by mod-sequence, that CONDSTORE and QRESYNC (RFC 7162)
+// backends can use to answer CHANGEDSINCE and VANISHED queries without
+// scanning the mailbox. Backends embed one per mailbox, record each change
+// as they make it and store the returned mod-sequence with the message.
+//
+// A Journal is safe for concurrent use.
+type Journal interface {
+	// Record records that the message with the UID was added, had its
+	// flags changed or was expunged, and returns the mod-sequence assigned
+	// to the change, which is higher than all previous ones.
+	Record(uid imap.UID, expunged bool) uint64
+	// HighestModSeq returns the mod-sequence of the last change, or 0 if
+	// nothing was recorded.
+	HighestModSeq() uint64
+	// ChangedSince returns the latest change of each message changed after
+	// modSeq, ordered by mod-sequence. It returns ErrJournalPruned if
+	// changes after modSeq may have been pruned.
+	ChangedSince(modSeq uint64) ([]JournalEntry, error)
+}
+
+// JournalChanges returns the UIDs of the messages that were added or had
+// their flags changed after modSeq and those that were expunged after
+// modSeq, as needed for FETCH CHANGEDSINCE and SELECT QRESYNC.
+func JournalChanges(j Journal, modSeq uint64) (changed, vanished *imap.UIDSet, err error) {
+	entries, err := j.ChangedSince(modSeq)
+	if err != nil {
+		return nil, nil, err
+	}
+	changed, vanished = &imap.UIDSet{}, &imap.UIDSet{}
+	for _, e := range sortedByUID(entries) {
+		if e.Expunged {
+			vanished.AddNum(e.UID)
+		} else {
+			changed.AddNum(e.UID)
+		}
+	}
+	return changed, vanished, nil
+}
+
+// JournalExpungedUIDs returns the UIDs in uids that were expunged after
+// modSeq. Sessions can use it to implement SessionVanished.
+func JournalExpungedUIDs(j Journal, uids *imap.UIDSet, modSeq uint64) (*imap.UIDSet, error) {
+	entries, err := j.ChangedSince(modSeq)
+	if err != nil {
+		return nil, err
+	}
+	vanished := &imap.UIDSet{}
+	for _, e := range sortedByUID(entries) {
+		if e.Expunged && (uids == nil || uids.Contains(e.UID)) {
+			vanished.AddNum(e.UID)
+		}
+	}
+	return vanished, nil
+}
+
+// sortedByUID returns entries sorted by UID, so that the UID sets built
+// from them have as few ranges as possible.
+func sortedByUID(entries []JournalEntry) []JournalEntry {
+	sort.Slice(entries, func(i, k int) bool { return entries[i].UID < entries[k].UID })
+	return entries
+}
+
+// JournalPruning is the policy a MemJournal applies to keep its size
+// bounded. Pruned changes can no longer be reported, so clients whose
+// last known mod-sequence is older need a full resynchronization. The zero
+// value never prunes.
+type JournalPruning struct {
+	// MaxEntries is the number of entries kept. 0 means no limit.
+	MaxEntries int
+	// MaxAge is how long entries are kept. 0 means no limit.
+	MaxAge time.Duration
+}
+
+// MemJournal is an in-memory Journal. It only keeps the latest change of
+// each message.
+type MemJournal struct {
+	mu      sync.Mutex
+	pruning JournalPruning
+	now     func() time.Time
+
+	// entries are ordered by mod-sequence. Entries superseded by a later
+	// change of the same message are left in place until the next
+	// compaction; latest maps UIDs to their current mod-sequence.
+	entries []JournalEntry
+	latest  map[imap.UID]uint64
+	modSeq  uint64
+	// pruned is the highest mod-sequence of the changes that were pruned.
+	pruned uint64
+}
+
+var _ Journal = (*MemJournal)(nil)
+
+// NewMemJournal creates an in-memory journal with the pruning policy.
+func NewMemJournal(pruning JournalPruning) *MemJournal {
+	return &MemJournal{
+		pruning: pruning,
+		now:     time.Now,
+		latest:  make(map[imap.UID]uint64),
+	}
+}
+
+// Record implements Journal.
+func (j *MemJournal) Record(uid imap.UID, expunged bool) uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.modSeq++
+	j.entries = append(j.entries, JournalEntry{
+		ModSeq:   j.modSeq,
+		UID:      uid,
+		Expunged: expunged,
+		Time:     j.now(),
+	})
+	j.latest[uid] = j.modSeq
+
+	j.pruneLocked()
+	if len(j.entries) > 2*len(j.latest)+16 {
+		j.compactLocked()
+	}
+	return j.modSeq
+}
+
+// HighestModSeq implements Journal.
+func (j *MemJournal) HighestModSeq() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.modSeq
+}
+
+// ChangedSince implements Journal.
+func (j *MemJournal) ChangedSince(modSeq uint64) ([]JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.pruneLocked()
+	if modSeq < j.pruned {
+		return nil, ErrJournalPruned
+	}
+
+	i := sort.Search(len(j.entries), func(i int) bool { return j.entries[i].ModSeq > modSeq })
+	var changes []JournalEntry
+	for _, e := range j.entries[i:] {
+		if j.latest[e.UID] == e.ModSeq {
+			changes = append(changes, e)
+		}
+	}
+	return changes, nil
+}
+
+// Prune applies the pruning policy now. It is also applied as changes are
+// recorded and queried.
+func (j *MemJournal) Prune() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.pruneLocked()
+}
+
+// Len returns the number of changes in the journal, one per message at
+// most.
+func (j *MemJournal) Len() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.latest)
+}
+
+func (j *MemJournal) pruneLocked() {
+	n := 0
+	if max := j.pruning.MaxEntries; max > 0 && len(j.latest) > max {
+		j.compactLocked()
+		n = len(j.entries) - max
+	}
+	if j.pruning.MaxAge > 0 {
+		cutoff := j.now().Add(-j.pruning.MaxAge)
+		for n < len(j.entries) && j.entries[n].Time.Before(cutoff) {
+			n++
+		}
+	}
+	if n == 0 {
+		return
+	}
+
+	for _, e := range j.entries[:n] {
+		if j.latest[e.UID] == e.ModSeq {
+			delete(j.latest, e.UID)
+		}
+	}
+	j.pruned = j.entries[n-1].ModSeq
+	j.entries = append(j.entries[:0:0], j.entries[n:]...)
+}
+
+// compactLocked removes the entries superseded by later changes of the
+// same message.
+func (j *MemJournal) compactLocked() {
+	entries := j.entries[:0]
+	for _, e := range j.entries {
+		if j.latest[e.UID] == e.ModSeq {
+			entries = append(entries, e)
+		}
+	}
+	j.entries = entries
+}
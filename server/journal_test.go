@@ -0,0 +1,115 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestMemJournal_ChangedSince(t *testing.T) {
+	j := NewMemJournal(JournalPruning{})
+	for uid := imap.UID(1); uid <= 4; uid++ {
+		j.Record(uid, false) // mod-sequences 1-4
+	}
+	j.Record(2, false) // 5
+	j.Record(3, true)  // 6
+
+	if got := j.HighestModSeq(); got != 6 {
+		t.Errorf("HighestModSeq() = %d, want 6", got)
+	}
+
+	entries, err := j.ChangedSince(3)
+	if err != nil {
+		t.Fatalf("ChangedSince() error: %v", err)
+	}
+	var got []imap.UID
+	for _, e := range entries {
+		got = append(got, e.UID)
+	}
+	if want := []imap.UID{4, 2, 3}; !equalUIDs(got, want) {
+		t.Errorf("ChangedSince(3) UIDs = %v, want %v", got, want)
+	}
+
+	changed, vanished, err := JournalChanges(j, 1)
+	if err != nil {
+		t.Fatalf("JournalChanges() error: %v", err)
+	}
+	if changed.String() != "2,4" || vanished.String() != "3" {
+		t.Errorf("JournalChanges(1) = %q, %q, want \"2,4\", \"3\"", changed, vanished)
+	}
+
+	uids, _ := imap.ParseUIDSet("1:2")
+	expunged, err := JournalExpungedUIDs(j, uids, 0)
+	if err != nil {
+		t.Fatalf("JournalExpungedUIDs() error: %v", err)
+	}
+	if !expunged.IsEmpty() {
+		t.Errorf("JournalExpungedUIDs(1:2) = %q, want empty", expunged)
+	}
+}
+
+func TestMemJournal_Compaction(t *testing.T) {
+	j := NewMemJournal(JournalPruning{})
+	for i := 0; i < 1000; i++ {
+		j.Record(1, false)
+	}
+	if len(j.entries) > 20 {
+		t.Errorf("journal kept %d entries for one message", len(j.entries))
+	}
+	if j.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", j.Len())
+	}
+}
+
+func TestMemJournal_PruneMaxEntries(t *testing.T) {
+	j := NewMemJournal(JournalPruning{MaxEntries: 2})
+	for uid := imap.UID(1); uid <= 5; uid++ {
+		j.Record(uid, uid == 2)
+	}
+
+	if j.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", j.Len())
+	}
+	if _, err := j.ChangedSince(2); !errors.Is(err, ErrJournalPruned) {
+		t.Errorf("ChangedSince(2) error = %v, want ErrJournalPruned", err)
+	}
+	entries, err := j.ChangedSince(3)
+	if err != nil || len(entries) != 2 {
+		t.Errorf("ChangedSince(3) = %v, %v, want 2 entries", entries, err)
+	}
+}
+
+func TestMemJournal_PruneMaxAge(t *testing.T) {
+	now := time.Now()
+	j := NewMemJournal(JournalPruning{MaxAge: time.Hour})
+	j.now = func() time.Time { return now }
+	j.Record(1, true)
+	j.Record(2, false)
+
+	now = now.Add(30 * time.Minute)
+	j.Record(3, false)
+
+	now = now.Add(45 * time.Minute)
+	j.Prune()
+	if _, err := j.ChangedSince(0); !errors.Is(err, ErrJournalPruned) {
+		t.Errorf("ChangedSince(0) error = %v, want ErrJournalPruned", err)
+	}
+	entries, err := j.ChangedSince(2)
+	if err != nil || len(entries) != 1 || entries[0].UID != 3 {
+		t.Errorf("ChangedSince(2) = %v, %v, want UID 3", entries, err)
+	}
+}
+
+func equalUIDs(a, b []imap.UID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
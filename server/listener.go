@@ -0,0 +1,214 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variables used for listener inheritance. LISTEN_PID,
+// LISTEN_FDS and LISTEN_FDNAMES follow the systemd socket activation
+// protocol (sd_listen_fds(3)); EnvHandoffFDs is set by Server.Handoff.
+const (
+	EnvListenPID     = "LISTEN_PID"
+	EnvListenFDs     = "LISTEN_FDS"
+	EnvListenFDNames = "LISTEN_FDNAMES"
+	EnvHandoffFDs    = "IMAPGO_LISTEN_FDS"
+)
+
+// listenFDStart is the first inherited file descriptor (SD_LISTEN_FDS_START).
+const listenFDStart = 3
+
+// InheritedListener is a listener received from the parent process.
+type InheritedListener struct {
+	net.Listener
+	// Name is the name given to the descriptor in LISTEN_FDNAMES, or the
+	// listener's address if no name was given.
+	Name string
+}
+
+// InheritedListeners returns the listeners passed to this process by
+// systemd socket activation or by Server.Handoff in a parent process. It
+// returns nil if no listeners were inherited. The environment variables
+// are cleared so that child processes do not inherit them again.
+//
+// Listener inheritance is only supported on Unix systems.
+func InheritedListeners() ([]InheritedListener, error) {
+	n, names, err := parseListenEnv(os.Getenv, os.Getpid())
+	if err != nil || n == 0 {
+		return nil, err
+	}
+
+	for _, key := range []string{EnvListenPID, EnvListenFDs, EnvListenFDNames, EnvHandoffFDs} {
+		_ = os.Unsetenv(key)
+	}
+
+	listeners := make([]InheritedListener, 0, n)
+	for i := 0; i < n; i++ {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(listenFDStart+i), name)
+		l, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			for _, il := range listeners {
+				_ = il.Close()
+			}
+			return nil, fmt.Errorf("inherited fd %d: %w", listenFDStart+i, err)
+		}
+		if name == "" {
+			name = l.Addr().String()
+		}
+		listeners = append(listeners, InheritedListener{Listener: l, Name: name})
+	}
+	return listeners, nil
+}
+
+// parseListenEnv returns the number of inherited descriptors and their
+// names from the environment.
+func parseListenEnv(getenv func(string) string, pid int) (int, []string, error) {
+	var count string
+	if v := getenv(EnvHandoffFDs); v != "" {
+		count = v
+	} else if v := getenv(EnvListenFDs); v != "" {
+		if p := getenv(EnvListenPID); p != strconv.Itoa(pid) {
+			// Descriptors are meant for another process.
+			return 0, nil, nil
+		}
+		count = v
+	} else {
+		return 0, nil, nil
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 0 {
+		return 0, nil, fmt.Errorf("invalid listener count %q", count)
+	}
+
+	var names []string
+	if v := getenv(EnvListenFDNames); v != "" {
+		names = strings.Split(v, ":")
+	}
+	return n, names, nil
+}
+
+// fileListener is implemented by listeners that can expose their file
+// descriptor, such as *net.TCPListener and *net.UnixListener.
+type fileListener interface {
+	File() (*os.File, error)
+}
+
+// tlsListener is a TLS listener that remembers the underlying listener so
+// that its descriptor can be handed off.
+type tlsListener struct {
+	net.Listener
+	raw net.Listener
+}
+
+func (l *tlsListener) File() (*os.File, error) {
+	fl, ok := l.raw.(fileListener)
+	if !ok {
+		return nil, fmt.Errorf("listener %T does not expose a file descriptor", l.raw)
+	}
+	return fl.File()
+}
+
+// ServeTLS accepts TLS connections on l and serves each one. Unlike
+// wrapping l with tls.NewListener before calling Serve, the listener
+// remains eligible for Handoff. The server's ALPN protocols, if any, are
+// offered in addition to the NextProtos of config.
+func (srv *Server) ServeTLS(l net.Listener, config *tls.Config) error {
+	if config == nil {
+		config = srv.options.TLSConfig
+	}
+	if config == nil {
+		return errors.New("TLS config required")
+	}
+	return srv.Serve(&tlsListener{Listener: tls.NewListener(l, srv.alpnTLSConfig(config)), raw: l})
+}
+
+// Handoff starts cmd, typically a new version of the running binary, with
+// the server's active listeners passed as inherited file descriptors. The
+// new process obtains them with InheritedListeners. The names in
+// LISTEN_FDNAMES are the listener addresses.
+//
+// After the new process is ready to accept connections, call Drain to stop
+// accepting on this process and let existing connections finish. cmd must
+// not have been started and its ExtraFiles must be empty.
+func (srv *Server) Handoff(cmd *exec.Cmd) error {
+	if len(cmd.ExtraFiles) > 0 {
+		return errors.New("handoff: cmd.ExtraFiles must be empty")
+	}
+
+	srv.mu.Lock()
+	listeners := make([]net.Listener, len(srv.listeners))
+	copy(listeners, srv.listeners)
+	srv.mu.Unlock()
+
+	if len(listeners) == 0 {
+		return errors.New("handoff: no active listeners")
+	}
+
+	files := make([]*os.File, 0, len(listeners))
+	names := make([]string, 0, len(listeners))
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	for _, l := range listeners {
+		fl, ok := l.(fileListener)
+		if !ok {
+			return fmt.Errorf("handoff: listener %T does not expose a file descriptor", l)
+		}
+		f, err := fl.File()
+		if err != nil {
+			return fmt.Errorf("handoff: %w", err)
+		}
+		files = append(files, f)
+		names = append(names, l.Addr().String())
+	}
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env,
+		EnvHandoffFDs+"="+strconv.Itoa(len(files)),
+		EnvListenFDNames+"="+strings.Join(names, ":"),
+	)
+	cmd.ExtraFiles = files
+
+	return cmd.Start()
+}
+
+// Drain stops accepting new connections and waits for existing connections
+// to finish. When ctx is done, the remaining connections are closed with a
+// BYE response as in Shutdown.
+func (srv *Server) Drain(ctx context.Context) error {
+	srv.mu.Lock()
+	for _, l := range srv.listeners {
+		_ = l.Close()
+	}
+	srv.mu.Unlock()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for srv.connCount.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			_ = srv.Shutdown(context.Background())
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return srv.Shutdown(ctx)
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testTLSConfig returns a server configuration with a self-signed
+// certificate for 127.0.0.1.
+func testTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "imap-go test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error: %v", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+// waitListener returns the address of the first listener srv serves.
+func waitListener(t *testing.T, srv *Server) string {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		srv.mu.Lock()
+		n := len(srv.listeners)
+		var addr string
+		if n > 0 {
+			addr = srv.listeners[0].Addr().String()
+		}
+		srv.mu.Unlock()
+		if n > 0 {
+			return addr
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("server is not listening")
+	return ""
+}
+
+func TestParseListenEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		wantN     int
+		wantNames []string
+		wantErr   bool
+	}{
+		{name: "none", env: map[string]string{}},
+		{
+			name:      "systemd",
+			env:       map[string]string{EnvListenPID: "42", EnvListenFDs: "2", EnvListenFDNames: "imap:imaps"},
+			wantN:     2,
+			wantNames: []string{"imap", "imaps"},
+		},
+		{
+			name: "systemd other pid",
+			env:  map[string]string{EnvListenPID: "7", EnvListenFDs: "2"},
+		},
+		{
+			name:  "handoff",
+			env:   map[string]string{EnvHandoffFDs: "1"},
+			wantN: 1,
+		},
+		{
+			name:    "invalid count",
+			env:     map[string]string{EnvHandoffFDs: "x"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, names, err := parseListenEnv(func(k string) string { return tt.env[k] }, 42)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if n != tt.wantN {
+				t.Errorf("n = %d, want %d", n, tt.wantN)
+			}
+			if len(names) != len(tt.wantNames) {
+				t.Fatalf("names = %v, want %v", names, tt.wantNames)
+			}
+			for i := range names {
+				if names[i] != tt.wantNames[i] {
+					t.Errorf("names[%d] = %q, want %q", i, names[i], tt.wantNames[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDrainStopsAcceptingAndWaitsForConns(t *testing.T) {
+	srv := New()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(l) }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Wait for the server to register the connection.
+	deadline := time.Now().Add(time.Second)
+	for srv.connCount.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := srv.Drain(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Drain() = %v, want deadline exceeded while a connection is open", err)
+	}
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatalf("Serve() = %v, want nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve() did not return after Drain")
+	}
+
+	if err := srv.Close(); err != nil {
+		t.Fatalf("Close() after Drain = %v", err)
+	}
+}
+
+// TestHandoffChild is run as the new process by TestHandoffListenAndServeTLS
+// and reports the listeners it inherited.
+func TestHandoffChild(t *testing.T) {
+	if os.Getenv("IMAPGO_TEST_HANDOFF_CHILD") == "" {
+		t.Skip("only run by TestHandoffListenAndServeTLS")
+	}
+	listeners, err := InheritedListeners()
+	if err != nil {
+		t.Fatalf("InheritedListeners() error: %v", err)
+	}
+	for _, l := range listeners {
+		fmt.Printf("inherited %s\n", l.Addr())
+		_ = l.Close()
+	}
+}
+
+func TestHandoffListenAndServeTLS(t *testing.T) {
+	srv := New()
+	defer srv.Close()
+	go func() { _ = srv.ListenAndServeTLS("127.0.0.1:0", testTLSConfig(t)) }()
+	addr := waitListener(t, srv)
+
+	var out bytes.Buffer
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHandoffChild$", "-test.v")
+	cmd.Env = append(os.Environ(), "IMAPGO_TEST_HANDOFF_CHILD=1")
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := srv.Handoff(cmd); err != nil {
+		t.Fatalf("Handoff() error: %v", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("child process: %v\n%s", err, out.String())
+	}
+	if want := "inherited " + addr + "\n"; !strings.Contains(out.String(), want) {
+		t.Errorf("child output = %q, want %q", out.String(), want)
+	}
+}
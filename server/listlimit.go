@@ -0,0 +1,69 @@
+package server
+
+import (
+	"unicode/utf8"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// Defaults for ListLimits.
+const (
+	DefaultMaxListPatterns      = 32
+	DefaultMaxListPatternLength = 1024
+)
+
+// ListLimits bounds the patterns of a LIST or LSUB command. Commands
+// exceeding a limit fail with NO [LIMIT].
+type ListLimits struct {
+	// MaxPatterns is the maximum number of patterns in one command, as
+	// sent with the LIST-EXTENDED multiple-pattern syntax. 0 means
+	// DefaultMaxListPatterns; a negative value means no limit.
+	MaxPatterns int
+
+	// MaxPatternLength is the maximum length in characters of a pattern,
+	// including the reference name it is appended to. 0 means
+	// DefaultMaxListPatternLength; a negative value means no limit.
+	MaxPatternLength int
+}
+
+// WithListLimits sets limits on the number and length of LIST patterns.
+func WithListLimits(limits ListLimits) Option {
+	return func(o *Options) {
+		o.ListLimits = limits
+	}
+}
+
+// CheckListPatterns returns a NO [LIMIT] error if the reference name and
+// patterns of a LIST or LSUB command exceed Options.ListLimits. Handlers
+// call it after parsing the command and before passing the patterns to the
+// session.
+func (c *Conn) CheckListPatterns(ref string, patterns []string) error {
+	limits := c.server.options.ListLimits
+	maxPatterns := limitOrDefault(limits.MaxPatterns, DefaultMaxListPatterns)
+	maxLength := limitOrDefault(limits.MaxPatternLength, DefaultMaxListPatternLength)
+
+	if maxPatterns > 0 && len(patterns) > maxPatterns {
+		return imap.ErrNoWithCode(imap.ResponseCodeLimit, "Too many mailbox patterns")
+	}
+	if maxLength > 0 {
+		refLen := utf8.RuneCountInString(ref)
+		for _, pattern := range patterns {
+			if refLen+utf8.RuneCountInString(pattern) > maxLength {
+				return imap.ErrNoWithCode(imap.ResponseCodeLimit, "Mailbox pattern too long")
+			}
+		}
+	}
+	return nil
+}
+
+// limitOrDefault returns def for a zero limit and 0, meaning no limit, for
+// a negative one.
+func limitOrDefault(limit, def int) int {
+	switch {
+	case limit == 0:
+		return def
+	case limit < 0:
+		return 0
+	}
+	return limit
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestConn_CheckListPatterns(t *testing.T) {
+	many := make([]string, DefaultMaxListPatterns+1)
+	long := strings.Repeat("*", DefaultMaxListPatternLength+1)
+	tests := []struct {
+		name     string
+		limits   ListLimits
+		ref      string
+		patterns []string
+		wantErr  string
+	}{
+		{name: "within defaults", patterns: many[1:]},
+		{name: "too many patterns by default", patterns: many, wantErr: "Too many mailbox patterns"},
+		{name: "too long by default", patterns: []string{long}, wantErr: "Mailbox pattern too long"},
+		{name: "no limits", limits: ListLimits{MaxPatterns: -1, MaxPatternLength: -1}, patterns: append(many, long)},
+		{name: "custom count", limits: ListLimits{MaxPatterns: 2}, patterns: []string{"a", "b", "c"}, wantErr: "Too many mailbox patterns"},
+		{name: "reference counts", limits: ListLimits{MaxPatternLength: 5}, ref: "Arch", patterns: []string{"%/%"}, wantErr: "Mailbox pattern too long"},
+		{name: "characters, not bytes", limits: ListLimits{MaxPatternLength: 5}, patterns: []string{"Café*"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := New(WithListLimits(tt.limits))
+			c1, c2 := net.Pipe()
+			defer c1.Close()
+			defer c2.Close()
+			conn := newConn(c1, srv)
+
+			err := conn.CheckListPatterns(tt.ref, tt.patterns)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var imapErr *imap.IMAPError
+			if !errors.As(err, &imapErr) {
+				t.Fatalf("error = %v, want *imap.IMAPError", err)
+			}
+			if imapErr.Type != imap.StatusResponseTypeNO || imapErr.Code != imap.ResponseCodeLimit || imapErr.Text != tt.wantErr {
+				t.Errorf("error = %+v, want NO [LIMIT] %s", imapErr.StatusResponse, tt.wantErr)
+			}
+		})
+	}
+}
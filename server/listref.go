@@ -0,0 +1,103 @@
+package server
+
+import (
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// defaultNamespace is the namespace assumed by ResolveListPattern for
+// sessions that do not implement SessionNamespace: a single personal
+// namespace without prefix and with '/' as hierarchy delimiter.
+var defaultNamespace = &imap.NamespaceData{
+	Personal: []imap.NamespaceDescriptor{{Prefix: "", Delim: '/'}},
+}
+
+// ResolveListPattern returns the mailbox name pattern selected by the
+// reference and mailbox name arguments of LIST and LSUB, interpreted as
+// described in RFC 3501 section 6.3.8 with the namespaces of ns (RFC
+// 2342), or a personal namespace without prefix and with '/' as delimiter
+// if ns is nil.
+//
+// The reference is the context the pattern is interpreted in, so the
+// result is usually their concatenation: "archive/" and "%" select
+// "archive/%". The reference is ignored if the pattern is absolute: if it
+// begins with the prefix of a namespace, such as "#news." or
+// "Other Users/", with '~' or '#', which conventionally start the names
+// of other users' mailboxes and of namespaces, or with the hierarchy
+// delimiter of the namespace of the reference. So "~smith/Mail/" and
+// "/usr/doc/foo" select "/usr/doc/foo".
+//
+// The empty pattern, which requests the hierarchy delimiter, is not
+// resolved by ResolveListPattern, as the answer depends on the reference.
+func ResolveListPattern(ref, pattern string, ns *imap.NamespaceData) string {
+	if ref == "" || pattern == "" {
+		return pattern
+	}
+	if ns == nil {
+		ns = defaultNamespace
+	}
+	if strings.HasPrefix(pattern, "~") || strings.HasPrefix(pattern, "#") {
+		return pattern
+	}
+	for _, d := range namespaceDescriptors(ns) {
+		if d.Prefix != "" && strings.HasPrefix(pattern, d.Prefix) {
+			return pattern
+		}
+	}
+	if d, ok := namespaceOf(ref, ns); ok && d.Delim != 0 && strings.HasPrefix(pattern, string(d.Delim)) {
+		return pattern
+	}
+	return ref + pattern
+}
+
+// ResolveListReference resolves the patterns of a LIST or LSUB command
+// against its reference with ResolveListPattern, using the namespaces of
+// the session if it implements SessionNamespace. It returns an empty
+// reference and the resolved patterns, so that sessions are given the
+// patterns the client selected in full. The request for the hierarchy
+// delimiter, the empty pattern, is returned unchanged, with its reference.
+func (c *Conn) ResolveListReference(ref string, patterns []string) (string, []string, error) {
+	if ref == "" {
+		return ref, patterns, nil
+	}
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return ref, patterns, nil
+		}
+	}
+
+	var ns *imap.NamespaceData
+	if sess, ok := c.session.(SessionNamespace); ok {
+		var err error
+		if ns, err = sess.Namespace(); err != nil {
+			return "", nil, err
+		}
+	}
+	resolved := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		resolved[i] = ResolveListPattern(ref, pattern, ns)
+	}
+	return "", resolved, nil
+}
+
+// namespaceDescriptors returns the namespaces of ns.
+func namespaceDescriptors(ns *imap.NamespaceData) []imap.NamespaceDescriptor {
+	var all []imap.NamespaceDescriptor
+	all = append(all, ns.Personal...)
+	all = append(all, ns.Other...)
+	return append(all, ns.Shared...)
+}
+
+// namespaceOf returns the namespace with the longest prefix name begins
+// with.
+func namespaceOf(name string, ns *imap.NamespaceData) (imap.NamespaceDescriptor, bool) {
+	var best imap.NamespaceDescriptor
+	found := false
+	for _, d := range namespaceDescriptors(ns) {
+		if strings.HasPrefix(name, d.Prefix) && (!found || len(d.Prefix) > len(best.Prefix)) {
+			best, found = d, true
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestResolveListPattern(t *testing.T) {
+	shared := &imap.NamespaceData{
+		Personal: []imap.NamespaceDescriptor{{Prefix: "INBOX.", Delim: '.'}},
+		Other:    []imap.NamespaceDescriptor{{Prefix: "Other Users/", Delim: '/'}},
+		Shared:   []imap.NamespaceDescriptor{{Prefix: "#news.", Delim: '.'}, {Prefix: "Public Folders/", Delim: '/'}},
+	}
+
+	tests := []struct {
+		ref, pattern string
+		ns           *imap.NamespaceData
+		want         string
+	}{
+		// The examples of RFC 3501 section 6.3.8.
+		{"~smith/Mail/", "foo.*", nil, "~smith/Mail/foo.*"},
+		{"archive/", "%", nil, "archive/%"},
+		{"#news.", "comp.mail.*", nil, "#news.comp.mail.*"},
+		{"~smith/Mail/", "/usr/doc/foo", nil, "/usr/doc/foo"},
+		{"archive/", "~fred/Mail/*", nil, "~fred/Mail/*"},
+
+		{"", "INBOX", nil, "INBOX"},
+		{"Work/", "", nil, ""},
+		{"Work", "%", nil, "Work%"},
+		{"INBOX.", "Sent", shared, "INBOX.Sent"},
+		{"INBOX.", ".Sent", shared, ".Sent"},
+		{"INBOX.", "/Sent", shared, "INBOX./Sent"},
+		{"INBOX.", "Other Users/bob/%", shared, "Other Users/bob/%"},
+		{"Other Users/", "bob/*", shared, "Other Users/bob/*"},
+		{"Other Users/", "INBOX.Sent", shared, "INBOX.Sent"},
+		{"Public Folders/", "/x", shared, "/x"},
+		{"#news.", "comp.%", shared, "#news.comp.%"},
+	}
+	for _, tt := range tests {
+		if got := ResolveListPattern(tt.ref, tt.pattern, tt.ns); got != tt.want {
+			t.Errorf("ResolveListPattern(%q, %q) = %q, want %q", tt.ref, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+// namespaceSession is a Session with namespaces.
+type namespaceSession struct {
+	Session
+	ns  *imap.NamespaceData
+	err error
+}
+
+func (s *namespaceSession) Namespace() (*imap.NamespaceData, error) {
+	return s.ns, s.err
+}
+
+func TestConn_ResolveListReference(t *testing.T) {
+	ns := &imap.NamespaceData{Personal: []imap.NamespaceDescriptor{{Prefix: "INBOX.", Delim: '.'}}}
+	c := &Conn{session: &namespaceSession{ns: ns}}
+
+	ref, patterns, err := c.ResolveListReference("INBOX.", []string{"Drafts", ".x", "%"})
+	if err != nil {
+		t.Fatalf("ResolveListReference() error: %v", err)
+	}
+	if want := []string{"INBOX.Drafts", ".x", "INBOX.%"}; ref != "" || !reflect.DeepEqual(patterns, want) {
+		t.Errorf("ResolveListReference() = %q, %q; want \"\", %q", ref, patterns, want)
+	}
+
+	// The request for the hierarchy delimiter keeps its reference.
+	ref, patterns, err = c.ResolveListReference("INBOX.", []string{""})
+	if err != nil || ref != "INBOX." || !reflect.DeepEqual(patterns, []string{""}) {
+		t.Errorf("ResolveListReference(\"\") = %q, %q, %v", ref, patterns, err)
+	}
+
+	c.session = &namespaceSession{err: errors.New("boom")}
+	if _, _, err := c.ResolveListReference("INBOX.", []string{"%"}); err == nil {
+		t.Error("ResolveListReference() did not return the error of Namespace")
+	}
+}
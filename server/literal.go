@@ -0,0 +1,134 @@
+package server
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// LiteralKeepaliveText is the text of the continuation request sent while
+// a literal is uploaded, see Options.LiteralKeepalive.
+const LiteralKeepaliveText = "OK continue"
+
+// LiteralProgress describes a literal being uploaded by a client.
+type LiteralProgress struct {
+	// Command is the name of the command the literal belongs to, such as
+	// APPEND.
+	Command string
+	// Received is the number of literal bytes read so far.
+	Received int64
+	// Size is the size announced in the literal header.
+	Size int64
+	// Started is when reading the literal began.
+	Started time.Time
+}
+
+// Done reports whether the whole literal has been received.
+func (p LiteralProgress) Done() bool {
+	return p.Received >= p.Size
+}
+
+// LiteralProgressFunc is called each time data of a literal is read from
+// a connection. The last call for a literal has Received equal to Size,
+// unless the connection failed. It runs on the goroutine reading the
+// connection, so an implementation that blocks throttles the upload; this
+// can be used for upload rate limiting.
+type LiteralProgressFunc func(conn *Conn, p LiteralProgress)
+
+// literalState tracks the literal being read on a connection.
+type literalState struct {
+	mu        sync.Mutex
+	active    bool
+	progress  LiteralProgress
+	keepalive *time.Timer
+}
+
+// ReadLiteral returns a reader for a literal of the given size whose
+// header has already been read. Command handlers use it instead of
+// reading the literal from Decoder directly, so that progress is reported
+// to Options.LiteralProgress, keepalives are sent and LiteralProgress
+// reflects the upload.
+func (c *Conn) ReadLiteral(command string, size int64) io.Reader {
+	c.literal.mu.Lock()
+	c.stopKeepaliveLocked()
+	c.literal.active = true
+	c.literal.progress = LiteralProgress{
+		Command: command,
+		Size:    size,
+		Started: time.Now(),
+	}
+	if d := c.server.options.LiteralKeepalive; d > 0 && size > 0 {
+		c.literal.keepalive = time.AfterFunc(d, c.sendLiteralKeepalive)
+	}
+	c.literal.mu.Unlock()
+
+	return &literalReader{conn: c, r: c.withLiteralTimeout(c.decoder.ReadLiteral(size))}
+}
+
+// LiteralProgress returns the progress of the literal currently being
+// uploaded on the connection. It returns false if no literal is being
+// read.
+func (c *Conn) LiteralProgress() (LiteralProgress, bool) {
+	c.literal.mu.Lock()
+	defer c.literal.mu.Unlock()
+	return c.literal.progress, c.literal.active
+}
+
+// sendLiteralKeepalive sends a keepalive and schedules the next one while
+// the literal is still being read.
+func (c *Conn) sendLiteralKeepalive() {
+	c.literal.mu.Lock()
+	if !c.literal.active {
+		c.literal.mu.Unlock()
+		return
+	}
+	c.literal.keepalive = time.AfterFunc(c.server.options.LiteralKeepalive, c.sendLiteralKeepalive)
+	c.literal.mu.Unlock()
+
+	c.WriteContinuation(LiteralKeepaliveText)
+}
+
+// finishLiteral marks the current literal, if any, as no longer being
+// read.
+func (c *Conn) finishLiteral() {
+	c.literal.mu.Lock()
+	defer c.literal.mu.Unlock()
+	c.literal.active = false
+	c.stopKeepaliveLocked()
+}
+
+func (c *Conn) stopKeepaliveLocked() {
+	if c.literal.keepalive != nil {
+		c.literal.keepalive.Stop()
+		c.literal.keepalive = nil
+	}
+}
+
+// literalReader reports the progress of reads of a literal.
+type literalReader struct {
+	conn *Conn
+	r    io.Reader
+	done bool
+}
+
+func (lr *literalReader) Read(p []byte) (int, error) {
+	if lr.done {
+		return 0, io.EOF
+	}
+	n, err := lr.r.Read(p)
+
+	c := lr.conn
+	c.literal.mu.Lock()
+	c.literal.progress.Received += int64(n)
+	progress := c.literal.progress
+	c.literal.mu.Unlock()
+
+	if progress.Done() || err != nil {
+		lr.done = true
+		c.finishLiteral()
+	}
+	if fn := c.server.options.LiteralProgress; fn != nil && (n > 0 || lr.done) {
+		fn(c, progress)
+	}
+	return n, err
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConn_ReadLiteral(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []LiteralProgress
+	)
+	srv := New(
+		WithLiteralProgress(func(conn *Conn, p LiteralProgress) {
+			mu.Lock()
+			calls = append(calls, p)
+			mu.Unlock()
+		}),
+		WithLiteralKeepalive(10*time.Millisecond),
+	)
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	conn := newConn(c1, srv)
+
+	if _, ok := conn.LiteralProgress(); ok {
+		t.Fatal("LiteralProgress() reported an upload before ReadLiteral")
+	}
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := io.ReadAll(conn.ReadLiteral("APPEND", 10))
+		done <- result{data, err}
+	}()
+
+	if _, err := c2.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+
+	// The client stalls, so the server sends a keepalive.
+	r := bufio.NewReader(c2)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("ReadString() error: %v", err)
+	}
+	if want := "+ " + LiteralKeepaliveText + "\r\n"; line != want {
+		t.Errorf("keepalive = %q, want %q", line, want)
+	}
+
+	p, ok := conn.LiteralProgress()
+	if !ok {
+		t.Fatal("LiteralProgress() reported no upload")
+	}
+	if p.Command != "APPEND" || p.Received != 5 || p.Size != 10 || p.Done() {
+		t.Errorf("LiteralProgress() = %+v", p)
+	}
+
+	go func() {
+		_, _ = io.Copy(io.Discard, r)
+	}()
+	if _, err := c2.Write([]byte("world")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	res := <-done
+	if res.err != nil || string(res.data) != "helloworld" {
+		t.Fatalf("ReadAll() = %q, %v", res.data, res.err)
+	}
+
+	if _, ok := conn.LiteralProgress(); ok {
+		t.Error("LiteralProgress() reported an upload after the literal was read")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) < 2 {
+		t.Fatalf("got %d progress calls, want at least 2", len(calls))
+	}
+	if calls[0].Received != 5 {
+		t.Errorf("first call Received = %d, want 5", calls[0].Received)
+	}
+	if last := calls[len(calls)-1]; last.Received != 10 || !last.Done() {
+		t.Errorf("last call = %+v, want Received 10", last)
+	}
+}
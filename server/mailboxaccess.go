@@ -0,0 +1,150 @@
+package server
+
+import (
+	imap "github.com/meszmate/imap-go"
+)
+
+// MailboxAccessPolicy restricts the mailboxes each user can see and use,
+// independently of the backend. Mailboxes a user may not access are left
+// out of LIST and LSUB responses, and commands naming them, such as
+// SELECT, EXAMINE, STATUS, APPEND and COPY, or those of extensions such
+// as GETACL, GETMETADATA and ESEARCH IN, are refused with NO [NOPERM]
+// before the session is called.
+//
+// For example, to hide a shared hierarchy from everyone but a group:
+//
+//	&server.MailboxAccessPolicy{
+//		Groups: directory.GroupsOf,
+//		Rules: []server.MailboxAccessRule{
+//			{Groups: []string{"hr"}, Patterns: []string{"Shared/HR/*"}},
+//			{Patterns: []string{"Shared/HR/*"}, Deny: true},
+//		},
+//	}
+type MailboxAccessPolicy struct {
+	// Rules are checked in order; the first rule that applies to the user
+	// and has a pattern matching the mailbox decides. Mailboxes no rule
+	// matches are allowed.
+	Rules []MailboxAccessRule
+
+	// Groups returns the groups of a user, for rules that select users by
+	// group. If nil, users belong to no group.
+	Groups func(username string) []string
+
+	// Delimiter is the hierarchy delimiter that '%' in patterns does not
+	// match. If 0, '/' is used.
+	Delimiter rune
+}
+
+// MailboxAccessRule allows or denies access to the mailboxes matching its
+// patterns for some users.
+type MailboxAccessRule struct {
+	// Users and Groups select the users the rule applies to. A rule
+	// without users and groups applies to everyone.
+	Users  []string
+	Groups []string
+
+	// Patterns are mailbox name patterns, where '*' matches any sequence
+	// of characters and '%' any sequence without the hierarchy delimiter,
+	// as in LIST. "Shared/HR/*" matches the mailboxes below Shared/HR but
+	// not Shared/HR itself. INBOX matches case-insensitively.
+	Patterns []string
+
+	// Deny denies access to the matching mailboxes instead of allowing it.
+	Deny bool
+}
+
+// Allowed reports whether the user, member of groups, may access mailbox.
+func (p *MailboxAccessPolicy) Allowed(username string, groups []string, mailbox string) bool {
+	mailbox = imap.CanonicalMailboxName(mailbox)
+	delim := p.Delimiter
+	if delim == 0 {
+		delim = '/'
+	}
+	for _, rule := range p.Rules {
+		if !rule.appliesTo(username, groups) {
+			continue
+		}
+		for _, pattern := range rule.Patterns {
+			if matchMailboxPattern(imap.CanonicalMailboxName(pattern), mailbox, delim) {
+				return !rule.Deny
+			}
+		}
+	}
+	return true
+}
+
+// appliesTo reports whether the rule selects the user.
+func (r *MailboxAccessRule) appliesTo(username string, groups []string) bool {
+	if len(r.Users) == 0 && len(r.Groups) == 0 {
+		return true
+	}
+	for _, u := range r.Users {
+		if u == username {
+			return true
+		}
+	}
+	for _, g := range r.Groups {
+		for _, ug := range groups {
+			if g == ug {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchMailboxPattern reports whether name matches a LIST-style pattern.
+func matchMailboxPattern(pattern, name string, delim rune) bool {
+	return imap.MatchListPattern(pattern, name, delim)
+}
+
+// mailboxFilter returns a function reporting whether the authenticated
+// user of c may access a mailbox, or nil if the server has neither a
+// MailboxAccessPolicy nor an AuthProvider.
+func (c *Conn) mailboxFilter() func(mailbox string) bool {
+	policy := c.server.options.MailboxAccess
+	provider := c.server.options.AuthProvider
+	if policy == nil && provider == nil {
+		return nil
+	}
+	username := c.Username()
+	var groups []string
+	if policy != nil && policy.Groups != nil {
+		groups = policy.Groups(username)
+	}
+	return func(mailbox string) bool {
+		if policy != nil && !policy.Allowed(username, groups, mailbox) {
+			return false
+		}
+		return provider == nil || c.authorize(mailbox) == nil
+	}
+}
+
+// CheckMailboxAccess returns NO [NOPERM] if the server's
+// MailboxAccessPolicy denies the authenticated user access to mailbox, or
+// the error of its AuthProvider's Authorize for the current command.
+// Command handlers, including those of extensions, call it before passing
+// a mailbox name to the session; ValidateMailboxName and AppendMessage
+// call it already.
+func (c *Conn) CheckMailboxAccess(mailbox string) error {
+	if policy := c.server.options.MailboxAccess; policy != nil {
+		var groups []string
+		username := c.Username()
+		if policy.Groups != nil {
+			groups = policy.Groups(username)
+		}
+		if !policy.Allowed(username, groups, mailbox) {
+			return imap.ErrNoWithCode(imap.ResponseCodeNoPerm, "access to mailbox denied")
+		}
+	}
+	return c.authorize(mailbox)
+}
+
+// NewListWriter returns a ListWriter for LIST and LSUB responses on c,
+// which leaves out the mailboxes the server's MailboxAccessPolicy hides
+// from the user.
+func (c *Conn) NewListWriter() *ListWriter {
+	w := NewListWriter(c.Encoder())
+	w.allowed = c.mailboxFilter()
+	return w
+}
@@ -0,0 +1,52 @@
+package server
+
+import "testing"
+
+func TestMatchMailboxPattern(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*", "Shared/HR/Payroll", true},
+		{"Shared/*", "Shared/HR/Payroll", true},
+		{"Shared/*", "Shared", false},
+		{"Shared/%", "Shared/HR", true},
+		{"Shared/%", "Shared/HR/Payroll", false},
+		{"%/Payroll", "HR/Payroll", true},
+		{"Archive", "Archive", true},
+		{"Archive", "Archive2", false},
+	}
+	for _, tt := range tests {
+		if got := matchMailboxPattern(tt.pattern, tt.name, '/'); got != tt.want {
+			t.Errorf("matchMailboxPattern(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMailboxAccessPolicy_Allowed(t *testing.T) {
+	p := &MailboxAccessPolicy{
+		Rules: []MailboxAccessRule{
+			{Users: []string{"admin"}, Patterns: []string{"*"}},
+			{Groups: []string{"hr"}, Patterns: []string{"Shared/HR/*"}},
+			{Patterns: []string{"Shared/HR/*", "inbox"}, Deny: true},
+		},
+	}
+	tests := []struct {
+		user    string
+		groups  []string
+		mailbox string
+		want    bool
+	}{
+		{"alice", nil, "Shared/HR/Payroll", false},
+		{"alice", nil, "Shared/HR", true},
+		{"alice", nil, "Archive", true},
+		{"alice", []string{"hr"}, "Shared/HR/Payroll", true},
+		{"admin", nil, "Shared/HR/Payroll", true},
+		{"bob", nil, "Inbox", false},
+	}
+	for _, tt := range tests {
+		if got := p.Allowed(tt.user, tt.groups, tt.mailbox); got != tt.want {
+			t.Errorf("Allowed(%q, %v, %q) = %v, want %v", tt.user, tt.groups, tt.mailbox, got, tt.want)
+		}
+	}
+}
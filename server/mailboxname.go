@@ -0,0 +1,102 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// MailboxNameValidator validates a mailbox name received from a client and
+// returns the normalized name that is passed to the session. Returning an
+// error rejects the command; *imap.IMAPError values are sent to the client
+// as-is.
+type MailboxNameValidator func(conn *Conn, name string) (string, error)
+
+// DefaultMailboxNameValidator is used when no validator is configured. It
+// only maps any case variant of INBOX to "INBOX", as required by RFC 3501.
+func DefaultMailboxNameValidator(conn *Conn, name string) (string, error) {
+	return imap.CanonicalMailboxName(name), nil
+}
+
+// MailboxNamePolicy is a configurable set of mailbox naming rules.
+// Use its Validator method with WithMailboxNameValidator.
+type MailboxNamePolicy struct {
+	// MaxLength is the maximum length of a mailbox name in bytes.
+	// 0 means no limit.
+	MaxLength int
+
+	// ForbiddenChars lists characters that may not appear in a name.
+	ForbiddenChars string
+
+	// Reserved lists names that clients may not use. Matching is
+	// case-insensitive.
+	Reserved []string
+
+	// Normalize, if set, is applied to names before any other rule, e.g.
+	// norm.NFC.String from golang.org/x/text/unicode/norm. Names that are
+	// not valid UTF-8 are rejected when Normalize is set.
+	Normalize func(string) string
+}
+
+// Validate checks name against the policy and returns the normalized name.
+func (p *MailboxNamePolicy) Validate(name string) (string, error) {
+	if p.Normalize != nil {
+		if !utf8.ValidString(name) {
+			return "", imap.ErrNoWithCode(imap.ResponseCodeCannot, "mailbox name is not valid UTF-8")
+		}
+		name = p.Normalize(name)
+	}
+
+	if imap.IsInbox(name) {
+		return imap.InboxName, nil
+	}
+
+	if p.MaxLength > 0 && len(name) > p.MaxLength {
+		return "", imap.ErrNoWithCode(imap.ResponseCodeLimit,
+			fmt.Sprintf("mailbox name exceeds %d bytes", p.MaxLength))
+	}
+
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f {
+			return "", imap.ErrNoWithCode(imap.ResponseCodeCannot, "mailbox name contains control characters")
+		}
+		if strings.ContainsRune(p.ForbiddenChars, r) {
+			return "", imap.ErrNoWithCode(imap.ResponseCodeCannot,
+				fmt.Sprintf("mailbox name contains forbidden character %q", r))
+		}
+	}
+
+	for _, reserved := range p.Reserved {
+		if strings.EqualFold(name, reserved) {
+			return "", imap.ErrNoWithCode(imap.ResponseCodeCannot,
+				fmt.Sprintf("mailbox name %q is reserved", name))
+		}
+	}
+
+	return name, nil
+}
+
+// Validator returns a MailboxNameValidator that applies the policy.
+func (p *MailboxNamePolicy) Validator() MailboxNameValidator {
+	return func(conn *Conn, name string) (string, error) {
+		return p.Validate(name)
+	}
+}
+
+// ValidateMailboxName applies the server's mailbox name validator to a name
+// received from the client and checks it against the MailboxAccessPolicy.
+// Command handlers that take a mailbox argument on CREATE, RENAME, SELECT
+// or EXAMINE call this before passing the name to the session.
+func (c *Conn) ValidateMailboxName(name string) (string, error) {
+	validate := c.server.options.MailboxNameValidator
+	if validate == nil {
+		validate = DefaultMailboxNameValidator
+	}
+	name, err := validate(c, name)
+	if err != nil {
+		return "", err
+	}
+	return name, c.CheckMailboxAccess(name)
+}
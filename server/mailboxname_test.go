@@ -0,0 +1,74 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestMailboxNamePolicy_Validate(t *testing.T) {
+	policy := &MailboxNamePolicy{
+		MaxLength:      10,
+		ForbiddenChars: "%*",
+		Reserved:       []string{"Outbox"},
+		Normalize:      strings.TrimSpace,
+	}
+
+	tests := []struct {
+		name    string
+		want    string
+		code    imap.ResponseCode
+		wantErr bool
+	}{
+		{name: "Archive", want: "Archive"},
+		{name: "inbox", want: "INBOX"},
+		{name: " Work ", want: "Work"},
+		{name: "VeryLongMailboxName", code: imap.ResponseCodeLimit, wantErr: true},
+		{name: "a%b", code: imap.ResponseCodeCannot, wantErr: true},
+		{name: "a\x01b", code: imap.ResponseCodeCannot, wantErr: true},
+		{name: "OUTBOX", code: imap.ResponseCodeCannot, wantErr: true},
+		{name: "bad\xff", code: imap.ResponseCodeCannot, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := policy.Validate(tt.name)
+		if tt.wantErr {
+			var imapErr *imap.IMAPError
+			if !errors.As(err, &imapErr) {
+				t.Errorf("Validate(%q) error = %v, want *imap.IMAPError", tt.name, err)
+				continue
+			}
+			if imapErr.Type != imap.StatusResponseTypeNO || imapErr.Code != tt.code {
+				t.Errorf("Validate(%q) = %s %s, want NO %s", tt.name, imapErr.Type, imapErr.Code, tt.code)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Validate(%q) unexpected error: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Validate(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConnValidateMailboxName(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	c := NewTestConn(serverConn, nil)
+	got, err := c.ValidateMailboxName("InBoX")
+	if err != nil || got != "INBOX" {
+		t.Fatalf("default ValidateMailboxName(InBoX) = %q, %v; want INBOX", got, err)
+	}
+
+	c.server.options.MailboxNameValidator = (&MailboxNamePolicy{Reserved: []string{"Shared"}}).Validator()
+	if _, err := c.ValidateMailboxName("shared"); err == nil {
+		t.Fatal("ValidateMailboxName(shared) = nil error, want reserved-name error")
+	}
+}
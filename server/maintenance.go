@@ -0,0 +1,109 @@
+package server
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// DefaultMaintenanceMessage is the text of the NO response to mutating
+// commands in maintenance mode when SetMaintenanceMode is given none.
+const DefaultMaintenanceMessage = "Server is in maintenance mode, try again later"
+
+// mutatingCommands are the commands refused in maintenance mode.
+var mutatingCommands = map[string]bool{
+	"APPEND":  true,
+	"STORE":   true,
+	"EXPUNGE": true,
+	"CREATE":  true,
+	"DELETE":  true,
+	"RENAME":  true,
+	"COPY":    true,
+	"MOVE":    true,
+	"REPLACE": true, // RFC 8508
+}
+
+// SetMaintenanceMode switches the server in or out of read-only
+// maintenance mode at runtime. While readonly is set, the commands that
+// modify mailboxes (APPEND, STORE, EXPUNGE, CREATE, DELETE, RENAME, COPY,
+// MOVE and REPLACE) fail with NO [INUSE] and message, while all other
+// commands keep working. Connections are not interrupted, so a backend
+// can be migrated without disconnecting users. Clients treat INUSE as a
+// temporary failure and retry later.
+func (srv *Server) SetMaintenanceMode(readonly bool, message string) {
+	if !readonly {
+		srv.maintenance.Store(nil)
+		return
+	}
+	if message == "" {
+		message = DefaultMaintenanceMessage
+	}
+	srv.maintenance.Store(&message)
+}
+
+// MaintenanceMode reports whether the server is in maintenance mode, and
+// the message sent to refused commands.
+func (srv *Server) MaintenanceMode() (readonly bool, message string) {
+	if msg := srv.maintenance.Load(); msg != nil {
+		return true, *msg
+	}
+	return false, ""
+}
+
+// refuseInMaintenance writes NO [INUSE] and returns true if the command
+// is not allowed in maintenance mode. Non-synchronizing literals that
+// were sent with the command are discarded; synchronizing ones are never
+// sent, since the client waits for a continuation request.
+func (c *Conn) refuseInMaintenance(tag, name, rest string) (bool, error) {
+	readonly, message := c.server.MaintenanceMode()
+	if !readonly || !mutatingCommands[name] {
+		return false, nil
+	}
+	err := c.discardLiterals(rest)
+	c.writeStatus(tag, imap.StatusResponseTypeNO, imap.ResponseCodeInUse, message)
+	return true, err
+}
+
+// discardLiterals reads and drops the non-synchronizing literals ending
+// line and the lines that follow them, including lines too long to be
+// read.
+func (c *Conn) discardLiterals(line string) error {
+	for {
+		size, nonSync, ok := trailingLiteral(line)
+		if !ok || !nonSync {
+			return nil
+		}
+		if _, err := io.Copy(io.Discard, c.withLiteralTimeout(c.decoder.ReadLiteral(size))); err != nil {
+			return err
+		}
+		var err error
+		line, err = c.decoder.ReadLine()
+		if e, ok := isLineTooLong(err); ok {
+			line, err = e.Tail, nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// trailingLiteral parses the literal header, such as {42}, {42+} or
+// ~{42}, that ends line.
+func trailingLiteral(line string) (size int64, nonSync, ok bool) {
+	if !strings.HasSuffix(line, "}") {
+		return 0, false, false
+	}
+	i := strings.LastIndexByte(line, '{')
+	if i < 0 {
+		return 0, false, false
+	}
+	inner := line[i+1 : len(line)-1]
+	inner, nonSync = strings.CutSuffix(inner, "+")
+	size, err := strconv.ParseInt(inner, 10, 64)
+	if err != nil || size < 0 {
+		return 0, false, false
+	}
+	return size, nonSync, true
+}
@@ -0,0 +1,133 @@
+package memserver_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/meszmate/imap-go/extensions/acl"
+	"github.com/meszmate/imap-go/extensions/appendlimit"
+	"github.com/meszmate/imap-go/extensions/applepush"
+	"github.com/meszmate/imap-go/extensions/binary"
+	"github.com/meszmate/imap-go/extensions/catenate"
+	"github.com/meszmate/imap-go/extensions/children"
+	"github.com/meszmate/imap-go/extensions/compress"
+	"github.com/meszmate/imap-go/extensions/condstore"
+	"github.com/meszmate/imap-go/extensions/contextsearch"
+	"github.com/meszmate/imap-go/extensions/convert"
+	"github.com/meszmate/imap-go/extensions/enable"
+	"github.com/meszmate/imap-go/extensions/esearch"
+	"github.com/meszmate/imap-go/extensions/esort"
+	"github.com/meszmate/imap-go/extensions/filters"
+	"github.com/meszmate/imap-go/extensions/id"
+	"github.com/meszmate/imap-go/extensions/idle"
+	"github.com/meszmate/imap-go/extensions/inprogress"
+	"github.com/meszmate/imap-go/extensions/jmapaccess"
+	"github.com/meszmate/imap-go/extensions/language"
+	"github.com/meszmate/imap-go/extensions/listextended"
+	"github.com/meszmate/imap-go/extensions/listmetadata"
+	"github.com/meszmate/imap-go/extensions/listmyrights"
+	"github.com/meszmate/imap-go/extensions/liststatus"
+	"github.com/meszmate/imap-go/extensions/literalplus"
+	"github.com/meszmate/imap-go/extensions/messagelimit"
+	"github.com/meszmate/imap-go/extensions/metadata"
+	"github.com/meszmate/imap-go/extensions/move"
+	"github.com/meszmate/imap-go/extensions/multiappend"
+	"github.com/meszmate/imap-go/extensions/multisearch"
+	"github.com/meszmate/imap-go/extensions/namespace"
+	"github.com/meszmate/imap-go/extensions/notify"
+	"github.com/meszmate/imap-go/extensions/objectid"
+	"github.com/meszmate/imap-go/extensions/partial"
+	"github.com/meszmate/imap-go/extensions/preview"
+	"github.com/meszmate/imap-go/extensions/qresync"
+	"github.com/meszmate/imap-go/extensions/quota"
+	"github.com/meszmate/imap-go/extensions/replace"
+	"github.com/meszmate/imap-go/extensions/saslir"
+	"github.com/meszmate/imap-go/extensions/savedate"
+	"github.com/meszmate/imap-go/extensions/searchfuzzy"
+	"github.com/meszmate/imap-go/extensions/searchres"
+	"github.com/meszmate/imap-go/extensions/sort"
+	"github.com/meszmate/imap-go/extensions/sortdisplay"
+	"github.com/meszmate/imap-go/extensions/specialuse"
+	"github.com/meszmate/imap-go/extensions/statussize"
+	"github.com/meszmate/imap-go/extensions/thread"
+	"github.com/meszmate/imap-go/extensions/uidonly"
+	"github.com/meszmate/imap-go/extensions/uidplus"
+	"github.com/meszmate/imap-go/extensions/unauthenticate"
+	"github.com/meszmate/imap-go/extensions/unselect"
+	"github.com/meszmate/imap-go/extensions/upload"
+	"github.com/meszmate/imap-go/extensions/urlauth"
+	"github.com/meszmate/imap-go/extensions/utf8accept"
+	"github.com/meszmate/imap-go/extensions/within"
+	"github.com/meszmate/imap-go/server"
+	_ "github.com/meszmate/imap-go/server/commands"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+// TestCapabilities_AllExtensions checks the exact CAPABILITY responses of
+// a server with every extension installed, before and after login: each
+// capability once, protocol versions first, then the other standard
+// capabilities, AUTH= capabilities and vendor extensions, each sorted.
+func TestCapabilities_AllExtensions(t *testing.T) {
+	ms := memserver.New()
+	ms.AddUser("alice", "secret")
+	srv := ms.NewServer(
+		server.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		server.WithAllowInsecureAuth(true),
+		// Duplicates of the capabilities of extensions and of the
+		// defaults, in another case.
+		server.WithCapabilities("idle", "Move", "auth=plain"),
+		server.WithExtensions(
+			acl.New(), appendlimit.New(), applepush.New(nil), binary.New(), catenate.New(), children.New(), compress.New(), condstore.New(), contextsearch.New(), convert.New(), enable.New(), esearch.New(), esort.New(), filters.New(), id.New(), idle.New(), inprogress.New(), jmapaccess.New(), language.New(), listextended.New(), listmetadata.New(), listmyrights.New(), liststatus.New(), literalplus.New(), messagelimit.New(), metadata.New(), move.New(), multiappend.New(), multisearch.New(), namespace.New(), notify.New(), objectid.New(), partial.New(), preview.New(), qresync.New(), quota.New(), replace.New(), saslir.New(), savedate.New(), searchfuzzy.New(), searchres.New(), sort.New(), sortdisplay.New(), specialuse.New(), statussize.New(), thread.New(), uidonly.New(), uidplus.New(), unauthenticate.New(), unselect.New(), upload.New(), urlauth.New(), utf8accept.New(), within.New(),
+		),
+	)
+
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() { _ = clientConn.Close() })
+	go func() { _ = srv.ServeConn(serverConn) }()
+
+	r := bufio.NewReader(clientConn)
+	capability := func(tag, cmd string) string {
+		t.Helper()
+		fmt.Fprintf(clientConn, "%s %s\r\n", tag, cmd)
+		var caps string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("%s: %v", cmd, err)
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if c, ok := strings.CutPrefix(line, "* CAPABILITY "); ok {
+				caps = c
+			}
+			if strings.HasPrefix(line, tag+" ") {
+				if !strings.HasPrefix(line, tag+" OK") {
+					t.Fatalf("%s: %s", cmd, line)
+				}
+				return caps
+			}
+		}
+	}
+	if _, err := r.ReadString('\n'); err != nil {
+		t.Fatalf("greeting: %v", err)
+	}
+
+	const common = "IMAP4rev1 ACL APPENDLIMIT BINARY CATENATE CHILDREN COMPRESS=DEFLATE CONDSTORE " +
+		"CONTEXT=SEARCH CONTEXT=SORT CONVERT CREATE-SPECIAL-USE ENABLE ESEARCH ESORT FILTERS ID IDLE " +
+		"INPROGRESS JMAPACCESS LANGUAGE LIST-EXTENDED LIST-METADATA LIST-MYRIGHTS LIST-STATUS LITERAL+ " +
+		"MESSAGELIMIT METADATA METADATA-SERVER MOVE MULTIAPPEND MULTISEARCH NAMESPACE NOTIFY OBJECTID " +
+		"PARTIAL PREVIEW QRESYNC QUOTA QUOTA=RES-MESSAGE QUOTA=RES-STORAGE REPLACE SASL-IR SAVEDATE " +
+		"SEARCH=FUZZY SEARCHRES SORT SORT=DISPLAY SPECIAL-USE STATUS=SIZE THREAD=ORDEREDSUBJECT " +
+		"THREAD=REFERENCES UIDONLY UIDPLUS UNAUTHENTICATE UNSELECT URLAUTH UTF8=ACCEPT WITHIN"
+	if got, want := capability("a", "CAPABILITY"), common+" AUTH=PLAIN"; got != want {
+		t.Errorf("CAPABILITY before login = %q\nwant %q", got, want)
+	}
+	capability("b", "LOGIN alice secret")
+	if got, want := capability("c", "CAPABILITY"), common+" XUPLOAD"; got != want {
+		t.Errorf("CAPABILITY after login = %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,74 @@
+package memserver
+
+import (
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/server"
+)
+
+// indexedHeaderFields are the header fields of the header index: those of
+// the SEARCH keys with names of their own and the fields used to thread
+// messages. Names are in canonical MIME form.
+var indexedHeaderFields = []string{
+	"From", "To", "Cc", "Bcc", "Subject", "Message-Id", "In-Reply-To", "References",
+}
+
+// indexedField returns the name of the indexed header field key, and
+// false if it is not indexed.
+func indexedField(key string) (string, bool) {
+	for _, f := range indexedHeaderFields {
+		if strings.EqualFold(f, key) {
+			return f, true
+		}
+	}
+	return "", false
+}
+
+// indexedHeader returns the lower-cased value of the indexed header field
+// of the message. The index of a message is built when it is first
+// searched, as message bodies do not change. The caller must hold the
+// mailbox lock.
+func (m *Message) indexedHeader(field string) string {
+	if m.headerIndex == nil {
+		hdr := m.parseHeaders()
+		m.headerIndex = make(map[string]string, len(indexedHeaderFields))
+		for _, f := range indexedHeaderFields {
+			m.headerIndex[f] = strings.ToLower(hdr.Get(f))
+		}
+	}
+	return m.headerIndex[field]
+}
+
+var _ server.SessionHeaderIndex = (*Session)(nil)
+
+// SearchHeader implements server.SessionHeaderIndex with the header index
+// of the messages of the selected mailbox, so that header search keys do
+// not parse the messages again on every search.
+func (s *Session) SearchHeader(key, value string) ([]imap.UID, bool, error) {
+	if s.selectedMailbox == nil {
+		return nil, false, &IMAPError{Message: "no mailbox selected"}
+	}
+	field, ok := indexedField(key)
+	if !ok {
+		return nil, false, nil
+	}
+
+	value = strings.ToLower(value)
+	mbox := s.selectedMailbox
+	mbox.mu.Lock()
+	defer mbox.mu.Unlock()
+
+	var uids []imap.UID
+	for _, msg := range s.viewMessages() {
+		if msg == nil {
+			continue
+		}
+		v := msg.indexedHeader(field)
+		// An empty value matches messages having the field.
+		if v != "" && strings.Contains(v, value) {
+			uids = append(uids, msg.UID)
+		}
+	}
+	return uids, true, nil
+}
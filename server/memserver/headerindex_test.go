@@ -0,0 +1,119 @@
+package memserver
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/server"
+)
+
+// newIndexedSession returns a session with INBOX selected, holding n
+// messages from alice or bob with a body of size bytes.
+func newIndexedSession(tb testing.TB, n, size int) *Session {
+	tb.Helper()
+	ms := New()
+	ms.AddUser("alice", "password123")
+	body := strings.Repeat("lorem ipsum dolor sit amet\r\n", size/28+1)
+	for i := 1; i <= n; i++ {
+		from := "alice@example.org"
+		if i%2 == 0 {
+			from = "bob@example.org"
+		}
+		msg := fmt.Sprintf("From: %s\r\nSubject: Report %d\r\n\r\n%s", from, i, body)
+		if err := ms.Deliver("alice", "INBOX", strings.NewReader(msg)); err != nil {
+			tb.Fatalf("Deliver() error: %v", err)
+		}
+	}
+	s := &Session{srv: ms}
+	if err := s.Login("alice", "password123"); err != nil {
+		tb.Fatalf("Login() error: %v", err)
+	}
+	if _, err := s.Select("INBOX", nil); err != nil {
+		tb.Fatalf("Select() error: %v", err)
+	}
+	return s
+}
+
+func TestSession_SearchHeader(t *testing.T) {
+	s := newIndexedSession(t, 4, 0)
+
+	uids, ok, err := s.SearchHeader("FROM", "BOB")
+	if err != nil || !ok {
+		t.Fatalf("SearchHeader() = %v, %v", ok, err)
+	}
+	if want := []imap.UID{2, 4}; !reflect.DeepEqual(uids, want) {
+		t.Errorf("SearchHeader(FROM) = %v, want %v", uids, want)
+	}
+	if uids, _, _ := s.SearchHeader("Cc", ""); len(uids) != 0 {
+		t.Errorf("SearchHeader(Cc) = %v, want none", uids)
+	}
+	if _, ok, _ := s.SearchHeader("List-Id", "dev"); ok {
+		t.Error("SearchHeader(List-Id) ok = true for an unindexed field")
+	}
+}
+
+// TestSession_SearchHeaderIndexed checks that searches answered from the
+// index find the same messages as those scanning the messages.
+func TestSession_SearchHeaderIndexed(t *testing.T) {
+	s := newIndexedSession(t, 6, 100)
+	for _, criteria := range []*imap.SearchCriteria{
+		{Header: []imap.SearchCriteriaHeaderField{{Key: "From", Value: "alice"}}},
+		{Header: []imap.SearchCriteriaHeaderField{{Key: "Subject", Value: "report 1"}}, Body: []string{"lorem"}},
+		{Header: []imap.SearchCriteriaHeaderField{{Key: "Subject", Value: ""}, {Key: "From", Value: "bob"}}},
+		{Header: []imap.SearchCriteriaHeaderField{{Key: "From", Value: "carol"}}},
+		{Or: [][2]imap.SearchCriteria{{
+			{Header: []imap.SearchCriteriaHeaderField{{Key: "Subject", Value: "report 3"}}},
+			{Header: []imap.SearchCriteriaHeaderField{{Key: "Subject", Value: "report 4"}}},
+		}}},
+	} {
+		want, err := s.Search(imap.NumKindSeq, criteria, nil)
+		if err != nil {
+			t.Fatalf("Search() error: %v", err)
+		}
+		indexed, err := server.ApplyHeaderIndex(s, criteria)
+		if err != nil {
+			t.Fatalf("ApplyHeaderIndex() error: %v", err)
+		}
+		got, err := s.Search(imap.NumKindSeq, indexed, nil)
+		if err != nil {
+			t.Fatalf("Search() error: %v", err)
+		}
+		if !reflect.DeepEqual(got.AllSeqNums, want.AllSeqNums) {
+			t.Errorf("indexed search for %+v = %v, want %v", criteria, got.AllSeqNums, want.AllSeqNums)
+		}
+	}
+}
+
+// BenchmarkSearchHeader compares a FROM search scanning the messages with
+// one answered from the header index, which after the first search does
+// not parse the messages again.
+func BenchmarkSearchHeader(b *testing.B) {
+	s := newIndexedSession(b, 1000, 4096)
+	criteria := &imap.SearchCriteria{
+		Header: []imap.SearchCriteriaHeaderField{{Key: "From", Value: "bob"}},
+	}
+
+	b.Run("scan", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := s.Search(imap.NumKindUID, criteria, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("index", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			indexed, err := server.ApplyHeaderIndex(s, criteria)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := s.Search(imap.NumKindUID, indexed, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package memserver
+
+import (
+	"bytes"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/wire"
+)
+
+func TestSession_ModSeqJournal(t *testing.T) {
+	s, _ := newLoggedInSession(t)
+	for _, body := range []string{"msg1", "msg2", "msg3"} {
+		appendTestMessage(t, s, "INBOX", body, nil)
+	}
+
+	data, err := s.Select("INBOX", nil)
+	if err != nil {
+		t.Fatalf("Select() error: %v", err)
+	}
+	if data.HighestModSeq != 3 {
+		t.Errorf("HighestModSeq = %d, want 3", data.HighestModSeq)
+	}
+
+	uids, _ := imap.ParseUIDSet("2:3")
+	flags := &imap.StoreFlags{Action: imap.StoreFlagsAdd, Flags: []imap.Flag{imap.FlagDeleted}, Silent: true}
+	if err := s.Store(newFetchWriter(), uids, flags, nil); err != nil {
+		t.Fatalf("Store() error: %v", err)
+	}
+	// Storing flags a message already has does not change its mod-sequence.
+	if err := s.Store(newFetchWriter(), uids, flags, nil); err != nil {
+		t.Fatalf("Store() error: %v", err)
+	}
+	expunge, _ := imap.ParseUIDSet("3")
+	if err := s.Expunge(newExpungeWriter(), expunge); err != nil {
+		t.Fatalf("Expunge() error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	w := server.NewFetchWriter(server.NewResponseEncoder(wire.NewEncoder(&buf)))
+	all, _ := imap.ParseUIDSet("1:*")
+	if err := s.Fetch(w, all, &imap.FetchOptions{UID: true, ChangedSince: 3}); err != nil {
+		t.Fatalf("Fetch() error: %v", err)
+	}
+	if want := "* 2 FETCH (UID 2 MODSEQ (4))\r\n"; buf.String() != want {
+		t.Errorf("FETCH CHANGEDSINCE wrote %q, want %q", buf.String(), want)
+	}
+
+	vanished, err := s.ExpungedUIDs(all, 3)
+	if err != nil {
+		t.Fatalf("ExpungedUIDs() error: %v", err)
+	}
+	if vanished.String() != "3" {
+		t.Errorf("ExpungedUIDs() = %q, want \"3\"", vanished)
+	}
+
+	status, err := s.Status("INBOX", &imap.StatusOptions{HighestModSeq: true})
+	if err != nil {
+		t.Fatalf("Status() error: %v", err)
+	}
+	if status.HighestModSeq == nil || *status.HighestModSeq != 6 {
+		t.Errorf("STATUS HIGHESTMODSEQ = %v, want 6", status.HighestModSeq)
+	}
+}
@@ -0,0 +1,69 @@
+package memserver
+
+import (
+	"sort"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// ListResponses returns the LIST responses for the mailboxes matching ref
+// and patterns, for backends that keep subscriptions apart from mailboxes.
+// mailboxes are the names of the existing mailboxes and subscriptions the
+// names of the subscribed ones, which need not exist.
+//
+// Without the SUBSCRIBED selection option, the existing mailboxes are
+// listed. With it, the subscriptions are listed instead, those whose
+// mailbox does not exist with the \NonExistent attribute, as required by
+// RFC 5258. The SUBSCRIBED selection option implies the SUBSCRIBED return
+// option. The responses are sorted by mailbox name.
+func ListResponses(mailboxes, subscriptions []string, ref string, patterns []string, options *imap.ListOptions, delim rune) []*imap.ListData {
+	if options == nil {
+		options = &imap.ListOptions{}
+	}
+	exists := make(map[string]bool, len(mailboxes))
+	for _, name := range mailboxes {
+		exists[name] = true
+	}
+	subscribed := make(map[string]bool, len(subscriptions))
+	for _, name := range subscriptions {
+		subscribed[name] = true
+	}
+
+	candidates := mailboxes
+	if options.SelectSubscribed {
+		candidates = subscriptions
+	}
+	candidates = append([]string(nil), candidates...)
+	sort.Strings(candidates)
+
+	var responses []*imap.ListData
+	for _, name := range candidates {
+		matched := false
+		for _, pattern := range patterns {
+			if matchPattern(name, ref+pattern, delim) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		var attrs []imap.MailboxAttr
+		if !exists[name] {
+			attrs = append(attrs, imap.MailboxAttrNonExistent)
+		}
+		if (options.ReturnSubscribed || options.SelectSubscribed) && subscribed[name] {
+			attrs = append(attrs, imap.MailboxAttrSubscribed)
+		}
+		if options.ReturnChildren && exists[name] {
+			if HasChildren(name, mailboxes, delim) {
+				attrs = append(attrs, imap.MailboxAttrHasChildren)
+			} else {
+				attrs = append(attrs, imap.MailboxAttrHasNoChildren)
+			}
+		}
+		responses = append(responses, &imap.ListData{Attrs: attrs, Delim: delim, Mailbox: name})
+	}
+	return responses
+}
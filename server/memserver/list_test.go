@@ -0,0 +1,41 @@
+package memserver
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestListResponses(t *testing.T) {
+	mailboxes := []string{"INBOX", "Work", "Work/Reports", "Trash"}
+	subscriptions := []string{"INBOX", "Old", "Work/Reports"}
+
+	tests := []struct {
+		name    string
+		options *imap.ListOptions
+		want    string
+	}{
+		{"plain", nil, "INBOX [] Trash [] Work [] Work/Reports []"},
+		{"return subscribed", &imap.ListOptions{ReturnSubscribed: true},
+			`INBOX [\Subscribed] Trash [] Work [] Work/Reports [\Subscribed]`},
+		{"select subscribed", &imap.ListOptions{SelectSubscribed: true},
+			`INBOX [\Subscribed] Old [\NonExistent \Subscribed] Work/Reports [\Subscribed]`},
+		{"children", &imap.ListOptions{SelectSubscribed: true, ReturnChildren: true},
+			`INBOX [\Subscribed \HasNoChildren] Old [\NonExistent \Subscribed] Work/Reports [\Subscribed \HasNoChildren]`},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, data := range ListResponses(mailboxes, subscriptions, "", []string{"*"}, tt.options, '/') {
+			got = append(got, fmt.Sprintf("%s %v", data.Mailbox, data.Attrs))
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("%s: ListResponses() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if got := ListResponses(mailboxes, subscriptions, "Work/", []string{"%"}, nil, '/'); len(got) != 1 || got[0].Mailbox != "Work/Reports" {
+		t.Errorf("ListResponses(Work/%%) = %v", got)
+	}
+}
@@ -1,12 +1,13 @@
 package memserver
 
 import (
-	"fmt"
+	"context"
 	"strings"
 	"sync"
 	"time"
 
 	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/server"
 )
 
 // Mailbox represents an in-memory IMAP mailbox.
@@ -19,7 +20,27 @@ type Mailbox struct {
 	PermanentFlags []imap.Flag
 	UIDNext        imap.UID
 	UIDValidity    uint32
-	Subscribed     bool
+
+	// ID is the mailbox ID reported with OBJECTID (RFC 8474). It is kept
+	// when the mailbox is renamed.
+	ID string
+
+	// changed is closed and replaced when messages are added or expunged
+	// or their flags are changed by a delivery rule.
+	changed chan struct{}
+	// flagChanges counts the flag changes made by delivery rules.
+	flagChanges uint64
+	// journal records the mod-sequences of changes to messages.
+	journal *server.MemJournal
+	// retention is the retention policy enforced by MemServer.Tick.
+	retention Retention
+	// marked reports whether messages were added since the mailbox was
+	// last selected.
+	marked bool
+	// cacheID identifies the mailbox in structures, the cache holding the
+	// envelopes and body structures of its messages, if any.
+	cacheID    uint64
+	structures *imap.StructureCache
 }
 
 // NewMailbox creates a new empty mailbox with standard flags.
@@ -33,20 +54,36 @@ func NewMailbox(name string) *Mailbox {
 			imap.FlagDeleted,
 			imap.FlagDraft,
 		},
-		PermanentFlags: []imap.Flag{
+		// The keywords RFC 9051 recommends are listed, so that clients
+		// know they can be stored before the first message has them.
+		PermanentFlags: append([]imap.Flag{
 			imap.FlagSeen,
 			imap.FlagAnswered,
 			imap.FlagFlagged,
 			imap.FlagDeleted,
 			imap.FlagDraft,
-			imap.FlagWildcard,
-		},
+		}, append(imap.RecommendedKeywords(), imap.FlagWildcard)...),
 		UIDNext:     1,
 		UIDValidity: 1,
-		Subscribed:  false,
+		journal:     server.NewMemJournal(server.JournalPruning{}),
 	}
 }
 
+// Journal returns the journal of changes to the messages of the mailbox,
+// which gives messages their mod-sequences.
+func (mbox *Mailbox) Journal() *server.MemJournal {
+	if mbox.journal == nil {
+		mbox.journal = server.NewMemJournal(server.JournalPruning{})
+	}
+	return mbox.journal
+}
+
+// modified records a change of the flags of msg in the journal.
+// The caller must hold the mailbox lock.
+func (mbox *Mailbox) modified(msg *Message) {
+	msg.ModSeq = mbox.Journal().Record(msg.UID, false)
+}
+
 // Append adds a message to the mailbox.
 // The caller must hold the mailbox lock.
 func (mbox *Mailbox) Append(body []byte, flags []imap.Flag, date time.Time) *Message {
@@ -68,12 +105,53 @@ func (mbox *Mailbox) Append(body []byte, flags []imap.Flag, date time.Time) *Mes
 		Body:         make([]byte, len(body)),
 	}
 	copy(msg.Body, body)
+	mbox.modified(msg)
 
 	mbox.Messages = append(mbox.Messages, msg)
+	mbox.marked = true
+	mbox.notify()
 	return msg
 }
 
-// Expunge removes all messages with the \Deleted flag.
+// Marked reports whether messages were added to the mailbox since it was
+// last selected or examined, the recent messages of RFC 3501, for which
+// LIST returns the \Marked attribute.
+// The caller must hold the mailbox lock.
+func (mbox *Mailbox) Marked() bool {
+	return mbox.marked
+}
+
+// flagsChanged records that the flags of msg were changed behind the back
+// of the sessions, so that they report them on their next poll.
+// The caller must hold the mailbox lock.
+func (mbox *Mailbox) flagsChanged(msg *Message) {
+	mbox.modified(msg)
+	mbox.flagChanges++
+	msg.flagChange = mbox.flagChanges
+	mbox.notify()
+}
+
+// notify wakes up the sessions waiting for changes in watch.
+// The caller must hold the mailbox lock.
+func (mbox *Mailbox) notify() {
+	if mbox.changed != nil {
+		close(mbox.changed)
+		mbox.changed = nil
+	}
+}
+
+// watch returns a channel that is closed when messages are next added or
+// expunged or their flags are changed by a delivery rule.
+// The caller must hold the mailbox lock.
+func (mbox *Mailbox) watch() <-chan struct{} {
+	if mbox.changed == nil {
+		mbox.changed = make(chan struct{})
+	}
+	return mbox.changed
+}
+
+// Expunge removes all messages with the \Deleted flag and releases their
+// bodies.
 // Returns the sequence numbers that were expunged (in descending order for safe removal).
 func (mbox *Mailbox) Expunge(uidSet *imap.UIDSet) []uint32 {
 	var expunged []uint32
@@ -87,12 +165,18 @@ func (mbox *Mailbox) Expunge(uidSet *imap.UIDSet) []uint32 {
 				continue
 			}
 			expunged = append(expunged, seqNum)
+			// Release the body now rather than when the last reference
+			// to the message goes away.
+			mbox.expungeMessage(msg)
 		} else {
 			remaining = append(remaining, msg)
 		}
 	}
 
 	mbox.Messages = remaining
+	if len(expunged) > 0 {
+		mbox.notify()
+	}
 
 	// Adjust sequence numbers: when expunging, we need to report the adjusted
 	// sequence numbers. Since we collected them in order, the first expunged
@@ -192,7 +276,9 @@ func (mbox *Mailbox) SelectData(readOnly bool) *imap.SelectData {
 		UIDNext:        mbox.UIDNext,
 		UIDValidity:    mbox.UIDValidity,
 		FirstUnseen:    mbox.FirstUnseen(),
+		HighestModSeq:  mbox.Journal().HighestModSeq(),
 		ReadOnly:       readOnly,
+		MailboxID:      mbox.ID,
 	}
 }
 
@@ -230,6 +316,13 @@ func (mbox *Mailbox) StatusData(name string, options *imap.StatusOptions) *imap.
 		n := mbox.NumDeleted()
 		data.NumDeleted = &n
 	}
+	if options.HighestModSeq {
+		n := mbox.Journal().HighestModSeq()
+		data.HighestModSeq = &n
+	}
+	if options.MailboxID {
+		data.MailboxID = mbox.ID
+	}
 
 	return data
 }
@@ -295,9 +388,18 @@ func numSetContains(numSet imap.NumSet, num uint32, maxNum uint32) bool {
 
 // SearchMessages performs a basic search on messages in the mailbox.
 func (mbox *Mailbox) SearchMessages(kind imap.NumKind, criteria *imap.SearchCriteria) []uint32 {
-	var results []uint32
+	results, _ := mbox.SearchMessagesContext(context.Background(), kind, criteria)
+	return results
+}
 
+// SearchMessagesContext is like SearchMessages, but stops when ctx is done.
+// It returns the matches found until then and whether the whole mailbox
+// was searched.
+func (mbox *Mailbox) SearchMessagesContext(ctx context.Context, kind imap.NumKind, criteria *imap.SearchCriteria) (results []uint32, complete bool) {
 	for i, msg := range mbox.Messages {
+		if ctx.Err() != nil {
+			return results, false
+		}
 		seqNum := uint32(i + 1)
 
 		if matchesCriteria(msg, seqNum, criteria) {
@@ -310,7 +412,7 @@ func (mbox *Mailbox) SearchMessages(kind imap.NumKind, criteria *imap.SearchCrit
 		}
 	}
 
-	return results
+	return results, true
 }
 
 // matchesCriteria checks if a message matches the given search criteria.
@@ -401,18 +503,21 @@ func matchesCriteria(msg *Message, seqNum uint32, criteria *imap.SearchCriteria)
 		}
 	}
 
-	// Check body text search
-	for _, text := range criteria.Body {
-		bodyText := msg.TextBytes()
-		if !strings.Contains(strings.ToLower(string(bodyText)), strings.ToLower(text)) {
-			return false
+	// Check body text search, with transfer encodings removed
+	if len(criteria.Body) > 0 || len(criteria.Text) > 0 {
+		bodyText := strings.ToLower(string(msg.DecodedText()))
+		for _, text := range criteria.Body {
+			if !strings.Contains(bodyText, strings.ToLower(text)) {
+				return false
+			}
 		}
-	}
 
-	// Check full text search (headers + body)
-	for _, text := range criteria.Text {
-		if !strings.Contains(strings.ToLower(string(msg.Body)), strings.ToLower(text)) {
-			return false
+		// Check full text search (headers + body)
+		fullText := strings.ToLower(string(msg.HeaderBytes())) + bodyText
+		for _, text := range criteria.Text {
+			if !strings.Contains(fullText, strings.ToLower(text)) {
+				return false
+			}
 		}
 	}
 
@@ -449,59 +554,17 @@ func (mbox *Mailbox) CopyMessageTo(msg *Message, dest *Mailbox) imap.UID {
 	return newMsg.UID
 }
 
+// MatchPattern reports whether a mailbox name matches a LIST pattern, in
+// which '%' matches any characters except delim and '*' any characters.
+func MatchPattern(name, pattern string, delim rune) bool {
+	return matchPattern(name, pattern, delim)
+}
+
 // matchPattern matches a mailbox name against an IMAP LIST pattern.
 // '%' matches any character except the hierarchy delimiter.
 // '*' matches any characters including the hierarchy delimiter.
 func matchPattern(name, pattern string, delim rune) bool {
-	return matchPatternRecursive(name, pattern, delim)
-}
-
-func matchPatternRecursive(name, pattern string, delim rune) bool {
-	for len(pattern) > 0 {
-		switch pattern[0] {
-		case '*':
-			// '*' matches everything, try matching rest of pattern at each position
-			pattern = pattern[1:]
-			if len(pattern) == 0 {
-				return true
-			}
-			for i := 0; i <= len(name); i++ {
-				if matchPatternRecursive(name[i:], pattern, delim) {
-					return true
-				}
-			}
-			return false
-		case '%':
-			// '%' matches any character except the delimiter
-			pattern = pattern[1:]
-			if len(pattern) == 0 {
-				// % at end, match rest if no delimiter
-				return !strings.ContainsRune(name, delim)
-			}
-			for i := 0; i <= len(name); i++ {
-				if i > 0 && rune(name[i-1]) == delim {
-					break
-				}
-				if matchPatternRecursive(name[i:], pattern, delim) {
-					return true
-				}
-			}
-			return false
-		default:
-			if len(name) == 0 {
-				return false
-			}
-			// Case-insensitive comparison for INBOX
-			pc := rune(pattern[0])
-			nc := rune(name[0])
-			if pc != nc {
-				return false
-			}
-			name = name[1:]
-			pattern = pattern[1:]
-		}
-	}
-	return len(name) == 0
+	return imap.MatchListPattern(pattern, name, delim)
 }
 
 // HasChildren checks if any mailbox name in the provided list is a child of this mailbox.
@@ -516,7 +579,11 @@ func HasChildren(name string, allNames []string, delim rune) bool {
 }
 
 // ErrNoSuchMailbox is returned when a mailbox doesn't exist.
-var ErrNoSuchMailbox = fmt.Errorf("no such mailbox")
+var ErrNoSuchMailbox error = imap.ErrNonExistent
+
+// ErrReadOnly is returned when a mailbox opened with EXAMINE would be
+// modified.
+var ErrReadOnly error = imap.ErrNo("mailbox is read-only")
 
 // ErrMailboxAlreadyExists is returned when attempting to create a mailbox that already exists.
-var ErrMailboxAlreadyExists = fmt.Errorf("mailbox already exists")
+var ErrMailboxAlreadyExists error = imap.ErrAlreadyExists
@@ -1,6 +1,7 @@
 package memserver
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -24,9 +25,6 @@ func TestNewMailbox(t *testing.T) {
 	if mbox.UIDValidity != 1 {
 		t.Fatalf("expected UIDValidity 1, got %d", mbox.UIDValidity)
 	}
-	if mbox.Subscribed {
-		t.Fatal("expected Subscribed false by default")
-	}
 
 	// Standard flags should be present
 	expectedFlags := []imap.Flag{
@@ -37,9 +35,12 @@ func TestNewMailbox(t *testing.T) {
 		t.Fatalf("expected %d flags, got %d", len(expectedFlags), len(mbox.Flags))
 	}
 
-	// PermanentFlags should include wildcard
-	if len(mbox.PermanentFlags) != 6 {
-		t.Fatalf("expected 6 permanent flags, got %d", len(mbox.PermanentFlags))
+	// PermanentFlags should include the recommended keywords and wildcard
+	if len(mbox.PermanentFlags) != 11 {
+		t.Fatalf("expected 11 permanent flags, got %d", len(mbox.PermanentFlags))
+	}
+	if last := mbox.PermanentFlags[len(mbox.PermanentFlags)-1]; last != imap.FlagWildcard {
+		t.Fatalf("expected wildcard last, got %s", last)
 	}
 }
 
@@ -489,6 +490,25 @@ func TestMailbox_SearchMessages_All(t *testing.T) {
 	}
 }
 
+func TestMailbox_SearchMessagesContext_Cancelled(t *testing.T) {
+	mbox := NewMailbox("INBOX")
+
+	mbox.Append([]byte("msg1"), nil, time.Now())
+	mbox.Append([]byte("msg2"), nil, time.Now())
+
+	results, complete := mbox.SearchMessagesContext(context.Background(), imap.NumKindSeq, nil)
+	if len(results) != 2 || !complete {
+		t.Fatalf("got %v, complete %v; want 2 complete results", results, complete)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, complete = mbox.SearchMessagesContext(ctx, imap.NumKindSeq, nil)
+	if len(results) != 0 || complete {
+		t.Fatalf("got %v, complete %v; want no incomplete results", results, complete)
+	}
+}
+
 func TestMailbox_SearchMessages_ByUID(t *testing.T) {
 	mbox := NewMailbox("INBOX")
 
@@ -1074,8 +1094,8 @@ func TestMailbox_SelectData(t *testing.T) {
 	if len(data.Flags) != 5 {
 		t.Fatalf("expected 5 flags, got %d", len(data.Flags))
 	}
-	if len(data.PermanentFlags) != 6 {
-		t.Fatalf("expected 6 permanent flags, got %d", len(data.PermanentFlags))
+	if len(data.PermanentFlags) != 11 {
+		t.Fatalf("expected 11 permanent flags, got %d", len(data.PermanentFlags))
 	}
 }
 
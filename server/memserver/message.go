@@ -17,6 +17,60 @@ type Message struct {
 	InternalDate time.Time
 	Size         int64
 	Body         []byte
+	ModSeq       uint64 // mod-sequence of the last change (CONDSTORE)
+
+	// flagChange is the value of Mailbox.flagChanges when the flags were
+	// last changed by a delivery rule.
+	flagChange uint64
+	// headerIndex holds the lower-cased values of the indexed header
+	// fields, see indexedHeader.
+	headerIndex map[string]string
+}
+
+// Section returns the data of a BODY[] section of the message, such as
+// the header fields of BODY[HEADER.FIELDS (Subject)], limited to its
+// partial range. For sections of a MIME part, HEADER, TEXT and
+// HEADER.FIELDS refer to the message contained in a message/rfc822 part.
+// A part that does not exist returns nil.
+func (m *Message) Section(section *imap.FetchItemBodySection) []byte {
+	msg := m
+	specifier := strings.ToUpper(section.Specifier)
+	if len(section.Part) > 0 {
+		e, ok := parseEntity(m.Body).section(section.Part)
+		if !ok {
+			return nil
+		}
+		switch specifier {
+		case "":
+			return applyPartial(e.body, section.Partial)
+		case "MIME":
+			return applyPartial(e.headerBytes(), section.Partial)
+		}
+		msg = &Message{Body: e.body}
+	}
+
+	var data []byte
+	switch specifier {
+	case "HEADER":
+		data = msg.HeaderBytes()
+	case "HEADER.FIELDS":
+		data = filterHeaders(msg.HeaderBytes(), section.Fields, false)
+	case "HEADER.FIELDS.NOT":
+		data = filterHeaders(msg.HeaderBytes(), section.Fields, true)
+	case "TEXT":
+		data = msg.TextBytes()
+	default:
+		// Empty specifier = entire message
+		data = msg.Body
+	}
+
+	return applyPartial(data, section.Partial)
+}
+
+// Matches reports whether the message, with sequence number seqNum,
+// matches the search criteria.
+func (m *Message) Matches(seqNum uint32, criteria *imap.SearchCriteria) bool {
+	return matchesCriteria(m, seqNum, criteria)
 }
 
 // HasFlag returns true if the message has the given flag.
@@ -53,6 +107,20 @@ func (m *Message) CopyFlags() []imap.Flag {
 	return flags
 }
 
+// sameFlags reports whether a and b contain the same flags, ignoring order
+// and case.
+func sameFlags(a, b []imap.Flag) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, f := range a {
+		if !hasFlag(b, f) {
+			return false
+		}
+	}
+	return true
+}
+
 // ParseEnvelope parses the message headers to build an Envelope.
 func (m *Message) ParseEnvelope() *imap.Envelope {
 	env := &imap.Envelope{}
@@ -0,0 +1,205 @@
+package memserver
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"sort"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/extensions/binary"
+)
+
+// mimeEntity is a MIME entity split into its header and body.
+type mimeEntity struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// parseEntity splits raw into a MIME header and body.
+func parseEntity(raw []byte) mimeEntity {
+	br := bufio.NewReader(bytes.NewReader(raw))
+	hdr, _ := textproto.NewReader(br).ReadMIMEHeader()
+	body, _ := io.ReadAll(br)
+	return mimeEntity{header: hdr, body: body}
+}
+
+// parts returns the child entities of a multipart entity, or nil if the
+// entity is not multipart.
+func (e mimeEntity) parts() []mimeEntity {
+	mediaType, params, err := mime.ParseMediaType(e.header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return nil
+	}
+
+	var parts []mimeEntity
+	mr := multipart.NewReader(bytes.NewReader(e.body), params["boundary"])
+	for {
+		p, err := mr.NextRawPart()
+		if err != nil {
+			return parts
+		}
+		body, _ := io.ReadAll(p)
+		parts = append(parts, mimeEntity{header: p.Header, body: body})
+	}
+}
+
+// headerBytes returns the header of the entity as a header block ending
+// with an empty line, as returned by BODY[part.MIME]. Fields are written
+// in alphabetical order, since the original order is not kept.
+func (e mimeEntity) headerBytes() []byte {
+	keys := make([]string, 0, len(e.header))
+	for k := range e.header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		for _, v := range e.header[k] {
+			buf.WriteString(k + ": " + v + "\r\n")
+		}
+	}
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// decoded returns the entity body with its Content-Transfer-Encoding
+// removed.
+func (e mimeEntity) decoded() ([]byte, error) {
+	r, err := binary.DecodeSection(e.header.Get("Content-Transfer-Encoding"), bytes.NewReader(e.body))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// text returns the decoded text of the entity and all its descendants,
+// for searching. Bodies that cannot be decoded are returned as is.
+func (e mimeEntity) text() []byte {
+	if parts := e.parts(); parts != nil {
+		var buf bytes.Buffer
+		for _, p := range parts {
+			buf.Write(p.text())
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes()
+	}
+	if data, err := e.decoded(); err == nil {
+		return data
+	}
+	return e.body
+}
+
+// section returns the entity for a MIME part number. Part 1 of a
+// non-multipart entity is its body.
+func (e mimeEntity) section(part []int) (mimeEntity, bool) {
+	for _, n := range part {
+		parts := e.parts()
+		if parts == nil {
+			if n != 1 {
+				return mimeEntity{}, false
+			}
+			continue
+		}
+		if n < 1 || n > len(parts) {
+			return mimeEntity{}, false
+		}
+		e = parts[n-1]
+	}
+	return e, true
+}
+
+// DecodedText returns the message body with all MIME parts decoded.
+func (m *Message) DecodedText() []byte {
+	return parseEntity(m.Body).text()
+}
+
+// BinarySection returns the decoded content of a MIME part, as returned
+// by FETCH BINARY[part] (RFC 3516). An empty part returns the whole
+// message. A part that does not exist returns nil.
+func (m *Message) BinarySection(part []int) ([]byte, error) {
+	if len(part) == 0 {
+		return m.Body, nil
+	}
+	e, ok := parseEntity(m.Body).section(part)
+	if !ok {
+		return nil, nil
+	}
+	return e.decoded()
+}
+
+// ParseBodyStructure parses the MIME structure of the message to build a
+// BodyStructure, as returned by FETCH BODYSTRUCTURE.
+func (m *Message) ParseBodyStructure() *imap.BodyStructure {
+	return parseEntity(m.Body).bodyStructure()
+}
+
+// bodyStructure returns the body structure of the entity. An entity
+// without a valid Content-Type is text/plain in US-ASCII (RFC 2045
+// section 5.2); a multipart entity without parts is treated as such too.
+func (e mimeEntity) bodyStructure() *imap.BodyStructure {
+	mediaType, params, err := mime.ParseMediaType(e.header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{"charset": "us-ascii"}
+	}
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	bs := &imap.BodyStructure{
+		Type:     typ,
+		Subtype:  subtype,
+		Params:   params,
+		MD5:      e.header.Get("Content-MD5"),
+		Location: e.header.Get("Content-Location"),
+	}
+	if disp, dispParams, err := mime.ParseMediaType(e.header.Get("Content-Disposition")); err == nil {
+		bs.Disposition = disp
+		bs.DispositionParams = dispParams
+	}
+	for _, lang := range strings.Split(e.header.Get("Content-Language"), ",") {
+		if lang = strings.TrimSpace(lang); lang != "" {
+			bs.Language = append(bs.Language, lang)
+		}
+	}
+
+	if typ == "multipart" {
+		for _, p := range e.parts() {
+			bs.Children = append(bs.Children, *p.bodyStructure())
+		}
+		if len(bs.Children) > 0 {
+			return bs
+		}
+		bs.Type, bs.Subtype = "text", "plain"
+	}
+
+	bs.ID = e.header.Get("Content-ID")
+	bs.Description = e.header.Get("Content-Description")
+	bs.Encoding = strings.ToUpper(e.header.Get("Content-Transfer-Encoding"))
+	if bs.Encoding == "" {
+		bs.Encoding = "7BIT"
+	}
+	bs.Size = uint32(len(e.body))
+	switch {
+	case typ == "message" && (subtype == "rfc822" || subtype == "global"):
+		inner := &Message{Body: e.body}
+		bs.Envelope = inner.ParseEnvelope()
+		bs.BodyStructure = parseEntity(e.body).bodyStructure()
+		bs.Lines = countLines(e.body)
+	case bs.Type == "text":
+		bs.Lines = countLines(e.body)
+	}
+	return bs
+}
+
+// countLines returns the number of lines of b, including a last line
+// without line ending.
+func countLines(b []byte) uint32 {
+	n := bytes.Count(b, []byte("\n"))
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		n++
+	}
+	return uint32(n)
+}
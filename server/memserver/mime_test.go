@@ -0,0 +1,77 @@
+package memserver
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+const multipartMessage = "Subject: Test\r\n" +
+	"Content-Type: multipart/mixed; boundary=XYZ\r\n" +
+	"\r\n" +
+	"--XYZ\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"caf=C3=A9 au lait\r\n" +
+	"--XYZ\r\n" +
+	"Content-Type: application/octet-stream\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"c2VjcmV0IHBh\r\ncmNlbA==\r\n" +
+	"--XYZ--\r\n"
+
+func TestMessage_BinarySection(t *testing.T) {
+	msg := &Message{Body: []byte(multipartMessage)}
+
+	tests := []struct {
+		part []int
+		want string
+	}{
+		{[]int{1}, "café au lait"},
+		{[]int{2}, "secret parcel"},
+		{[]int{3}, ""},
+	}
+	for _, tt := range tests {
+		got, err := msg.BinarySection(tt.part)
+		if err != nil {
+			t.Fatalf("BinarySection(%v) error: %v", tt.part, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("BinarySection(%v) = %q, want %q", tt.part, got, tt.want)
+		}
+	}
+
+	single := &Message{Body: []byte("Content-Transfer-Encoding: base64\r\n\r\naGVsbG8=\r\n")}
+	if got, _ := single.BinarySection([]int{1}); string(got) != "hello" {
+		t.Errorf("BinarySection([1]) of single part = %q, want %q", got, "hello")
+	}
+}
+
+func TestMessage_BinarySection_UnknownCTE(t *testing.T) {
+	msg := &Message{Body: []byte("Content-Transfer-Encoding: x-uuencode\r\n\r\nbegin\r\n")}
+	_, err := msg.BinarySection([]int{1})
+	var imapErr *imap.IMAPError
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeUnknownCTE {
+		t.Errorf("BinarySection() error = %v, want UNKNOWN-CTE", err)
+	}
+}
+
+func TestMailbox_SearchMessages_ByEncodedBody(t *testing.T) {
+	mbox := NewMailbox("INBOX")
+	mbox.Append([]byte(multipartMessage), nil, time.Now())
+	mbox.Append([]byte("Subject: Other\r\n\r\nNothing here"), nil, time.Now())
+
+	for _, criteria := range []*imap.SearchCriteria{
+		{Body: []string{"café"}},
+		{Body: []string{"secret parcel"}},
+		{Text: []string{"secret parcel"}},
+	} {
+		results := mbox.SearchMessages(imap.NumKindSeq, criteria)
+		if len(results) != 1 || results[0] != 1 {
+			t.Errorf("SearchMessages(%+v) = %v, want [1]", criteria, results)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package memserver
+
+import (
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/extensions/esearch"
+	"github.com/meszmate/imap-go/server"
+)
+
+// Quirks makes a MemServer behave like servers lacking capabilities or
+// deviating from the usual behavior, so that the fallbacks of clients can
+// be tested without connecting to third-party servers. The zero value
+// emulates no quirks.
+type Quirks struct {
+	// Capabilities are advertised in addition to the defaults.
+	Capabilities []imap.Cap
+	// DenyCapabilities are not advertised, even if extensions add them.
+	// Their commands are still handled.
+	DenyCapabilities []imap.Cap
+
+	// NoUIDPlus hides UIDPLUS and leaves the APPENDUID and COPYUID
+	// response codes out, so that clients have to find appended and
+	// copied messages themselves.
+	NoUIDPlus bool
+	// ESearchOnly answers every SEARCH with an ESEARCH response, even
+	// without RETURN options. It installs the ESEARCH extension, which
+	// must not be installed separately.
+	ESearchOnly bool
+	// MaxLiteralSize rejects APPEND of messages larger than this many
+	// bytes with NO [TOOBIG]. If 0, messages of any size are accepted.
+	MaxLiteralSize int64
+	// ContinuationDelay delays every continuation request, such as those
+	// for literals and IDLE.
+	ContinuationDelay time.Duration
+}
+
+// SetQuirks sets the quirks emulated by the MemServer. Quirks affecting
+// responses to commands apply to sessions immediately; those affecting
+// the server, such as capabilities, apply to servers created with
+// NewServer afterwards.
+func (ms *MemServer) SetQuirks(q Quirks) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.quirks = q
+}
+
+// Quirks returns the quirks emulated by the MemServer.
+func (ms *MemServer) Quirks() Quirks {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.quirks
+}
+
+// serverOptions returns the server options emulating the quirks. They
+// come before the options given to NewServer, so that the ESEARCH
+// extension of ESearchOnly is the one installed.
+func (q Quirks) serverOptions() []server.Option {
+	var opts []server.Option
+	if len(q.Capabilities) > 0 {
+		opts = append(opts, server.WithCapabilities(q.Capabilities...))
+	}
+	hidden := q.DenyCapabilities
+	if q.NoUIDPlus {
+		hidden = append(hidden[:len(hidden):len(hidden)], imap.CapUIDPlus)
+	}
+	if len(hidden) > 0 {
+		opts = append(opts, server.WithoutCapabilities(hidden...))
+	}
+	if q.ESearchOnly {
+		opts = append(opts, server.WithExtensions(esearch.New(esearch.WithESearchOnly())))
+	}
+	if q.MaxLiteralSize > 0 {
+		opts = append(opts, server.WithMaxLiteralSize(q.MaxLiteralSize))
+	}
+	if q.ContinuationDelay > 0 {
+		opts = append(opts, server.WithContinuationDelay(q.ContinuationDelay))
+	}
+	return opts
+}
@@ -0,0 +1,128 @@
+package memserver
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/client"
+	"github.com/meszmate/imap-go/extensions/uidplus"
+	"github.com/meszmate/imap-go/imaptest"
+	"github.com/meszmate/imap-go/server"
+	_ "github.com/meszmate/imap-go/server/commands"
+)
+
+// dialQuirks starts a server for ms and returns a logged in client with
+// INBOX selected.
+func dialQuirks(t *testing.T, ms *MemServer) *client.Client {
+	t.Helper()
+	ms.AddUser("alice", "secret")
+	h := imaptest.NewHarness(t, ms.NewServer(server.WithExtensions(uidplus.New())))
+	c := h.Dial()
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	if _, err := c.Select("INBOX", nil); err != nil {
+		t.Fatalf("Select() error: %v", err)
+	}
+	return c
+}
+
+func TestQuirks_Capabilities(t *testing.T) {
+	ms := New()
+	ms.SetQuirks(Quirks{
+		Capabilities:     []imap.Cap{"X-VENDOR"},
+		DenyCapabilities: []imap.Cap{imap.CapIdle},
+		NoUIDPlus:        true,
+	})
+	c := dialQuirks(t, ms)
+	if _, err := c.Capability(); err != nil {
+		t.Fatalf("Capability() error: %v", err)
+	}
+	if !c.HasCap("X-VENDOR") {
+		t.Errorf("X-VENDOR not advertised: %v", c.Caps())
+	}
+	for _, denied := range []string{"IDLE", "UIDPLUS"} {
+		if c.HasCap(denied) {
+			t.Errorf("%s advertised: %v", denied, c.Caps())
+		}
+	}
+}
+
+func TestQuirks_NoUIDPlus(t *testing.T) {
+	ms := New()
+	ms.SetQuirks(Quirks{NoUIDPlus: true})
+	c := dialQuirks(t, ms)
+	if err := c.Create("Archive"); err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+
+	data, err := c.Append("INBOX", nil, []byte("Subject: a\r\n\r\nbody\r\n"))
+	if err != nil {
+		t.Fatalf("Append() error: %v", err)
+	}
+	if data.UID != 0 || data.UIDValidity != 0 {
+		t.Errorf("Append() = %+v, want no APPENDUID", data)
+	}
+	copied, err := c.Copy("1", "Archive")
+	if err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	if copied.UIDValidity != 0 {
+		t.Errorf("Copy() = %+v, want no COPYUID", copied)
+	}
+}
+
+func TestQuirks_ESearchOnly(t *testing.T) {
+	ms := New()
+	ms.SetQuirks(Quirks{ESearchOnly: true})
+	c := dialQuirks(t, ms)
+	for i := 0; i < 3; i++ {
+		if _, err := c.Append("INBOX", nil, []byte("Subject: a\r\n\r\nbody\r\n")); err != nil {
+			t.Fatalf("Append() error: %v", err)
+		}
+	}
+	if err := c.Noop(); err != nil {
+		t.Fatalf("Noop() error: %v", err)
+	}
+
+	nums, err := c.Search("ALL")
+	if err != nil {
+		t.Fatalf("Search() error: %v", err)
+	}
+	if len(nums) != 3 || nums[0] != 1 || nums[2] != 3 {
+		t.Errorf("Search() = %v, want [1 2 3]", nums)
+	}
+}
+
+func TestQuirks_MaxLiteralSize(t *testing.T) {
+	ms := New()
+	ms.SetQuirks(Quirks{MaxLiteralSize: 10, DenyCapabilities: []imap.Cap{imap.CapLiteralPlus}})
+	c := dialQuirks(t, ms)
+
+	_, err := c.Append("INBOX", nil, []byte(strings.Repeat("x", 11)))
+	var imapErr *imap.IMAPError
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeTooBig {
+		t.Fatalf("Append() error = %v, want NO [TOOBIG]", err)
+	}
+	if _, err := c.Append("INBOX", nil, []byte("small")); err != nil {
+		t.Fatalf("Append() after TOOBIG error: %v", err)
+	}
+}
+
+func TestQuirks_ContinuationDelay(t *testing.T) {
+	ms := New()
+	const delay = 50 * time.Millisecond
+	ms.SetQuirks(Quirks{ContinuationDelay: delay, DenyCapabilities: []imap.Cap{imap.CapLiteralPlus}})
+	c := dialQuirks(t, ms)
+
+	start := time.Now()
+	if _, err := c.Append("INBOX", nil, []byte("Subject: a\r\n\r\nbody\r\n")); err != nil {
+		t.Fatalf("Append() error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("Append() took %v, want at least %v", elapsed, delay)
+	}
+}
@@ -0,0 +1,110 @@
+package memserver
+
+import (
+	"time"
+
+	"github.com/meszmate/imap-go/server/delivery"
+)
+
+// Retention is a retention policy for a mailbox, like the auto-expire and
+// archive settings of hosted mail services. It lets clients be tested
+// against messages that disappear server-side without a client expunging
+// them.
+//
+// Policies are enforced when the server's clock ticks (see
+// MemServer.Tick), never in the background, so tests decide exactly when
+// messages go away. The zero value keeps all messages.
+type Retention struct {
+	// MaxAge, if positive, expunges messages whose internal date is more
+	// than MaxAge before the tick.
+	MaxAge time.Duration
+	// MaxMessages, if positive, caps the number of messages in the
+	// mailbox. The oldest messages, those with the lowest UIDs, are
+	// expunged to make room.
+	MaxMessages int
+}
+
+// SetRetention sets the retention policy of a mailbox of a user. It
+// replaces the previous policy; the zero Retention removes it. The policy
+// stays with the mailbox when it is renamed.
+func (ms *MemServer) SetRetention(user, mailbox string, policy Retention) error {
+	ud := ms.GetUserData(user)
+	if ud == nil {
+		return delivery.ErrUnknownUser
+	}
+	mbox := ud.GetMailbox(mailbox)
+	if mbox == nil {
+		return delivery.ErrNoSuchMailbox
+	}
+	mbox.mu.Lock()
+	mbox.retention = policy
+	mbox.mu.Unlock()
+	return nil
+}
+
+// Tick advances the server's synthetic retention clock to now and
+// enforces the retention policies of all mailboxes, returning the number
+// of messages expunged. Sessions with an affected mailbox selected report
+// the expunges on their next poll, and idling sessions are notified
+// immediately.
+func (ms *MemServer) Tick(now time.Time) int {
+	ms.mu.RLock()
+	users := make([]*UserData, 0, len(ms.userData))
+	for _, ud := range ms.userData {
+		users = append(users, ud)
+	}
+	ms.mu.RUnlock()
+
+	n := 0
+	for _, ud := range users {
+		for _, mbox := range ud.mailboxes() {
+			mbox.mu.Lock()
+			n += mbox.applyRetention(now)
+			mbox.mu.Unlock()
+		}
+	}
+	return n
+}
+
+// applyRetention expunges the messages that the retention policy does not
+// keep at now and returns how many were expunged.
+// The caller must hold the mailbox lock.
+func (mbox *Mailbox) applyRetention(now time.Time) int {
+	policy := mbox.retention
+	if policy.MaxAge <= 0 && policy.MaxMessages <= 0 {
+		return 0
+	}
+
+	var kept []*Message
+	for _, msg := range mbox.Messages {
+		if policy.MaxAge > 0 && now.Sub(msg.InternalDate) > policy.MaxAge {
+			mbox.expungeMessage(msg)
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	if policy.MaxMessages > 0 && len(kept) > policy.MaxMessages {
+		excess := len(kept) - policy.MaxMessages
+		for _, msg := range kept[:excess] {
+			mbox.expungeMessage(msg)
+		}
+		kept = kept[excess:]
+	}
+
+	n := len(mbox.Messages) - len(kept)
+	if n > 0 {
+		mbox.Messages = kept
+		mbox.notify()
+	}
+	return n
+}
+
+// expungeMessage records the expunge of msg in the journal, releases its
+// body and invalidates its cached structures. The caller removes it from
+// the message list.
+// The caller must hold the mailbox lock.
+func (mbox *Mailbox) expungeMessage(msg *Message) {
+	mbox.Journal().Record(msg.UID, true)
+	mbox.invalidateStructures(msg)
+	msg.Body = nil
+}
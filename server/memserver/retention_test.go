@@ -0,0 +1,81 @@
+package memserver
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/server/delivery"
+	"github.com/meszmate/imap-go/wire"
+)
+
+func TestMemServer_Retention(t *testing.T) {
+	s, ms := newSelectedSession(t)
+	ud := ms.GetUserData("alice")
+	inbox := ud.GetMailbox("INBOX")
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		ms.store(ud, inbox, []byte("Subject: test\r\n\r\nbody\r\n"), nil, start.Add(time.Duration(i)*24*time.Hour))
+	}
+
+	var buf bytes.Buffer
+	w := server.NewUpdateWriter(server.NewResponseEncoder(wire.NewEncoder(&buf)))
+	if err := s.Poll(w, true); err != nil {
+		t.Fatalf("Poll() error: %v", err)
+	}
+	buf.Reset()
+
+	now := start.Add(72 * time.Hour)
+	if n := ms.Tick(now); n != 0 {
+		t.Errorf("Tick() without a policy expunged %d messages", n)
+	}
+
+	// Messages 1 and 2 are too old, and message 3 exceeds the cap.
+	if err := ms.SetRetention("alice", "INBOX", Retention{MaxAge: 36 * time.Hour, MaxMessages: 1}); err != nil {
+		t.Fatalf("SetRetention() error: %v", err)
+	}
+	if n := ms.Tick(now); n != 3 {
+		t.Errorf("Tick() expunged %d messages, want 3", n)
+	}
+	if len(inbox.Messages) != 1 || inbox.Messages[0].UID != 4 {
+		t.Fatalf("INBOX has %d messages, want only UID 4", len(inbox.Messages))
+	}
+	if n := ms.Tick(now); n != 0 {
+		t.Errorf("second Tick() expunged %d messages, want 0", n)
+	}
+
+	if err := s.Poll(w, false); err != nil {
+		t.Fatalf("Poll() error: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Poll() without expunges wrote %q", buf.String())
+	}
+	if err := s.Poll(w, true); err != nil {
+		t.Fatalf("Poll() error: %v", err)
+	}
+	if want := "* 1 EXPUNGE\r\n* 1 EXPUNGE\r\n* 1 EXPUNGE\r\n"; buf.String() != want {
+		t.Errorf("Poll() wrote %q, want %q", buf.String(), want)
+	}
+
+	// The zero policy keeps everything.
+	if err := ms.SetRetention("alice", "INBOX", Retention{}); err != nil {
+		t.Fatalf("SetRetention() error: %v", err)
+	}
+	if n := ms.Tick(now.Add(365 * 24 * time.Hour)); n != 0 {
+		t.Errorf("Tick() after removing the policy expunged %d messages", n)
+	}
+}
+
+func TestMemServer_SetRetentionErrors(t *testing.T) {
+	ms := New()
+	ms.AddUser("alice", "password")
+	if err := ms.SetRetention("bob", "INBOX", Retention{MaxMessages: 1}); !errors.Is(err, delivery.ErrUnknownUser) {
+		t.Errorf("unknown user: error = %v", err)
+	}
+	if err := ms.SetRetention("alice", "Nope", Retention{MaxMessages: 1}); !errors.Is(err, delivery.ErrNoSuchMailbox) {
+		t.Errorf("unknown mailbox: error = %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package memserver
+
+import (
+	"bufio"
+	"bytes"
+	"net/textproto"
+	"strings"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// Rule is a server-side filter applied to messages as they are appended or
+// delivered, like a Sieve script or a spam filter on a real server. It lets
+// clients be tested against messages that are filed elsewhere or gain
+// keywords such as $Junk without the client's doing.
+//
+// A rule matches a message if all of its non-empty conditions match. The
+// conditions are case-insensitive substring matches.
+type Rule struct {
+	// Header and Value match messages with a Header field containing Value.
+	Header string
+	Value  string
+	// From matches the From header field.
+	From string
+	// Subject matches the Subject header field.
+	Subject string
+
+	// FileInto stores matching messages in this mailbox instead of the one
+	// they were appended or delivered to. It is ignored if the mailbox does
+	// not exist.
+	FileInto string
+	// AddKeywords are added to the flags of matching messages.
+	AddKeywords []imap.Flag
+	// Delay, if positive, adds AddKeywords this long after the message was
+	// stored rather than on arrival, as a filter running in the background
+	// would. Sessions with the mailbox selected report the change as an
+	// unsolicited FETCH response.
+	Delay time.Duration
+}
+
+// matches reports whether the rule matches a message with the given header.
+func (r *Rule) matches(hdr textproto.MIMEHeader) bool {
+	if r.Header != "" && !headerContains(hdr, r.Header, r.Value) {
+		return false
+	}
+	if r.From != "" && !headerContains(hdr, "From", r.From) {
+		return false
+	}
+	if r.Subject != "" && !headerContains(hdr, "Subject", r.Subject) {
+		return false
+	}
+	return true
+}
+
+// headerContains reports whether any field named key contains value.
+func headerContains(hdr textproto.MIMEHeader, key, value string) bool {
+	value = strings.ToLower(value)
+	for _, v := range hdr.Values(key) {
+		if strings.Contains(strings.ToLower(v), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddRule adds a delivery rule. Rules are applied in the order they were
+// added; the first matching rule with a FileInto mailbox that exists
+// decides where the message is stored, and the keywords of all matching
+// rules are added.
+func (ms *MemServer) AddRule(rule Rule) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.rules = append(ms.rules, rule)
+}
+
+// ClearRules removes all delivery rules.
+func (ms *MemServer) ClearRules() {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.rules = nil
+}
+
+// store appends a message to mbox after applying the delivery rules, and
+// returns the mailbox it was stored in along with the message.
+func (ms *MemServer) store(ud *UserData, mbox *Mailbox, body []byte, flags []imap.Flag, date time.Time) (*Mailbox, *Message) {
+	ms.mu.RLock()
+	rules := ms.rules
+	ms.mu.RUnlock()
+
+	var delayed []Rule
+	if len(rules) > 0 {
+		hdr, _ := textproto.NewReader(bufio.NewReader(bytes.NewReader(body))).ReadMIMEHeader()
+		filed := false
+		flags = append([]imap.Flag(nil), flags...)
+		for _, rule := range rules {
+			if !rule.matches(hdr) {
+				continue
+			}
+			if !filed && rule.FileInto != "" {
+				if dest := ud.GetMailbox(rule.FileInto); dest != nil {
+					mbox = dest
+					filed = true
+				}
+			}
+			if rule.Delay > 0 {
+				delayed = append(delayed, rule)
+				continue
+			}
+			for _, kw := range rule.AddKeywords {
+				if !hasFlag(flags, kw) {
+					flags = append(flags, kw)
+				}
+			}
+		}
+	}
+
+	mbox.mu.Lock()
+	msg := mbox.Append(body, flags, date)
+	mbox.mu.Unlock()
+
+	for _, rule := range delayed {
+		keywords := rule.AddKeywords
+		time.AfterFunc(rule.Delay, func() {
+			mbox.mu.Lock()
+			defer mbox.mu.Unlock()
+			if m, _ := mbox.MessageByUID(msg.UID); m != nil {
+				for _, kw := range keywords {
+					m.SetFlag(kw)
+				}
+				mbox.flagsChanged(m)
+			}
+		})
+	}
+	return mbox, msg
+}
+
+// hasFlag reports whether flags contains flag, ignoring case.
+func hasFlag(flags []imap.Flag, flag imap.Flag) bool {
+	for _, f := range flags {
+		if strings.EqualFold(string(f), string(flag)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package memserver
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/wire"
+)
+
+func TestRule_Matches(t *testing.T) {
+	msg := &Message{Body: []byte("From: Spammer <spam@example.com>\r\nSubject: Cheap Pills\r\nX-Spam-Flag: YES\r\n\r\nbody\r\n")}
+	hdr := msg.parseHeaders()
+
+	tests := []struct {
+		name string
+		rule Rule
+		want bool
+	}{
+		{"empty", Rule{}, true},
+		{"from", Rule{From: "SPAM@example"}, true},
+		{"subject", Rule{Subject: "pills"}, true},
+		{"header", Rule{Header: "x-spam-flag", Value: "yes"}, true},
+		{"all", Rule{From: "spammer", Subject: "cheap", Header: "X-Spam-Flag", Value: "YES"}, true},
+		{"from mismatch", Rule{From: "alice"}, false},
+		{"missing header", Rule{Header: "List-Id", Value: "x"}, false},
+		{"one mismatch", Rule{From: "spam", Subject: "hello"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.matches(hdr); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemServer_DeliverRules(t *testing.T) {
+	ms := New()
+	ms.AddUser("alice", "password")
+	ud := ms.GetUserData("alice")
+	if err := ud.CreateMailbox("Junk"); err != nil {
+		t.Fatalf("CreateMailbox() error: %v", err)
+	}
+	ms.AddRule(Rule{Header: "X-Spam-Flag", Value: "YES", FileInto: "Junk", AddKeywords: []imap.Flag{"$Junk"}})
+	ms.AddRule(Rule{Subject: "invoice", AddKeywords: []imap.Flag{"$Important"}})
+	ms.AddRule(Rule{Subject: "lost", FileInto: "Nope"})
+
+	deliver := func(body string) {
+		if err := ms.Deliver("alice", "INBOX", strings.NewReader(body)); err != nil {
+			t.Fatalf("Deliver() error: %v", err)
+		}
+	}
+	deliver("Subject: invoice\r\nX-Spam-Flag: YES\r\n\r\nbody\r\n")
+	deliver("Subject: invoice\r\n\r\nbody\r\n")
+	deliver("Subject: lost\r\n\r\nbody\r\n")
+
+	inbox, junk := ud.GetMailbox("INBOX"), ud.GetMailbox("Junk")
+	if len(junk.Messages) != 1 {
+		t.Fatalf("Junk has %d messages, want 1", len(junk.Messages))
+	}
+	if msg := junk.Messages[0]; !msg.HasFlag("$Junk") || !msg.HasFlag("$Important") {
+		t.Errorf("filed message flags = %v, want $Junk and $Important", msg.Flags)
+	}
+	if len(inbox.Messages) != 2 {
+		t.Fatalf("INBOX has %d messages, want 2", len(inbox.Messages))
+	}
+	if msg := inbox.Messages[0]; !msg.HasFlag("$Important") || msg.HasFlag("$Junk") {
+		t.Errorf("INBOX message flags = %v, want only $Important", msg.Flags)
+	}
+
+	ms.ClearRules()
+	deliver("Subject: invoice\r\nX-Spam-Flag: YES\r\n\r\nbody\r\n")
+	if len(inbox.Messages) != 3 || len(inbox.Messages[2].Flags) != 0 {
+		t.Errorf("rules applied after ClearRules()")
+	}
+}
+
+func TestSession_AppendRules(t *testing.T) {
+	s, ms := newLoggedInSession(t)
+	if err := s.Create("Junk", nil); err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	ms.AddRule(Rule{From: "spam@", FileInto: "Junk", AddKeywords: []imap.Flag{"$Junk"}})
+
+	body := []byte("From: spam@example.com\r\n\r\nbody\r\n")
+	r := imap.LiteralReader{Reader: bytes.NewReader(body), Size: int64(len(body))}
+	data, err := s.Append("INBOX", r, &imap.AppendOptions{Flags: []imap.Flag{imap.FlagSeen}})
+	if err != nil {
+		t.Fatalf("Append() error: %v", err)
+	}
+	if data.UID != 0 {
+		t.Errorf("AppendData.UID = %d, want 0 for a message filed elsewhere", data.UID)
+	}
+
+	junk := s.userData.GetMailbox("Junk")
+	if len(junk.Messages) != 1 {
+		t.Fatalf("Junk has %d messages, want 1", len(junk.Messages))
+	}
+	if msg := junk.Messages[0]; !msg.HasFlag(imap.FlagSeen) || !msg.HasFlag("$Junk") {
+		t.Errorf("flags = %v, want \\Seen and $Junk", msg.Flags)
+	}
+}
+
+func TestSession_PollReportsDelayedKeywords(t *testing.T) {
+	s, ms := newSelectedSession(t)
+	ms.AddRule(Rule{Subject: "offer", AddKeywords: []imap.Flag{"$Junk"}, Delay: time.Millisecond})
+
+	if err := ms.Deliver("alice", "INBOX", strings.NewReader("Subject: offer\r\n\r\nbody\r\n")); err != nil {
+		t.Fatalf("Deliver() error: %v", err)
+	}
+
+	inbox := s.selectedMailbox
+	deadline := time.Now().Add(time.Second)
+	for {
+		inbox.mu.Lock()
+		done := inbox.flagChanges > 0
+		inbox.mu.Unlock()
+		if done || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	var buf bytes.Buffer
+	w := server.NewUpdateWriter(server.NewResponseEncoder(wire.NewEncoder(&buf)))
+	if err := s.Poll(w, true); err != nil {
+		t.Fatalf("Poll() error: %v", err)
+	}
+	if want := "* 1 EXISTS\r\n* 1 FETCH (FLAGS ($Junk))\r\n"; buf.String() != want {
+		t.Errorf("Poll() wrote %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := s.Poll(w, true); err != nil {
+		t.Fatalf("Poll() error: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("second Poll() wrote %q, want nothing", buf.String())
+	}
+}
@@ -0,0 +1,96 @@
+package memserver_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/meszmate/imap-go/extension"
+	"github.com/meszmate/imap-go/extensions/acl"
+	"github.com/meszmate/imap-go/extensions/esearch"
+	"github.com/meszmate/imap-go/extensions/id"
+	"github.com/meszmate/imap-go/extensions/metadata"
+	"github.com/meszmate/imap-go/extensions/move"
+	"github.com/meszmate/imap-go/extensions/namespace"
+	"github.com/meszmate/imap-go/extensions/quota"
+	"github.com/meszmate/imap-go/extensions/sort"
+	"github.com/meszmate/imap-go/extensions/thread"
+	"github.com/meszmate/imap-go/extensions/unselect"
+	"github.com/meszmate/imap-go/server"
+	_ "github.com/meszmate/imap-go/server/commands"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+func TestSelfTest(t *testing.T) {
+	srv := memserver.New().NewServer(server.WithExtensions(
+		acl.New(), esearch.New(), id.New(), metadata.New(), move.New(),
+		namespace.New(), quota.New(), sort.New(), thread.New(), unselect.New(),
+	))
+	if err := srv.SelfTest(context.Background()); err != nil {
+		t.Fatalf("SelfTest() = %v", err)
+	}
+}
+
+func TestSelfTest_NoAccount(t *testing.T) {
+	srv := server.New()
+	if err := srv.SelfTest(context.Background()); !errors.Is(err, server.ErrNoSelfTestAccount) {
+		t.Fatalf("SelfTest() = %v, want ErrNoSelfTestAccount", err)
+	}
+}
+
+// brokenExtension installs a FETCH wrapper that panics and a command whose
+// handler reads arguments it was not given.
+type brokenExtension struct {
+	extension.BaseExtension
+}
+
+func (e *brokenExtension) CommandHandlers() map[string]interface{} {
+	return map[string]interface{}{
+		"XBROKEN": server.CommandHandlerFunc(func(ctx *server.CommandContext) error {
+			_, err := ctx.Decoder.ReadAtom()
+			return err
+		}),
+	}
+}
+
+func (e *brokenExtension) WrapHandler(name string, handler interface{}) interface{} {
+	if name != "FETCH" {
+		return nil
+	}
+	return server.CommandHandlerFunc(func(ctx *server.CommandContext) error {
+		var items []string
+		_ = items[0]
+		return nil
+	})
+}
+
+func (e *brokenExtension) SessionExtension() interface{} { return nil }
+func (e *brokenExtension) OnEnabled(connID string) error { return nil }
+
+func TestSelfTest_Broken(t *testing.T) {
+	srv := memserver.New().NewServer(server.WithExtensions(
+		&brokenExtension{BaseExtension: extension.BaseExtension{ExtName: "BROKEN"}},
+	))
+	err := srv.SelfTest(context.Background())
+	if err == nil {
+		t.Fatal("SelfTest() = nil, want failures")
+	}
+
+	var failed []string
+	for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var failure *server.SelfTestFailure
+		if !errors.As(err, &failure) {
+			t.Fatalf("failure %v is a %T", err, err)
+		}
+		if !strings.Contains(failure.Reason, "handler panicked") {
+			t.Errorf("%s: reason = %q, want a panic", failure.Command, failure.Reason)
+		}
+		failed = append(failed, strings.Fields(failure.Command)[0])
+	}
+	// Both FETCH commands panic, and so does XBROKEN without arguments;
+	// the commands after them still run on new connections.
+	if got := strings.Join(failed, " "); got != "FETCH UID XBROKEN" {
+		t.Errorf("failed commands = %s", got)
+	}
+}
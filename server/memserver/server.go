@@ -2,7 +2,9 @@
 //
 // It implements the server.Session interface with all standard IMAP operations
 // backed by in-memory data structures. This is useful for testing IMAP clients
-// and server infrastructure without requiring a real mail store.
+// and server infrastructure without requiring a real mail store. With
+// SetQuirks, it emulates servers lacking capabilities or deviating from
+// the usual behavior, to test the fallbacks of clients.
 //
 // Usage:
 //
@@ -13,9 +15,14 @@
 package memserver
 
 import (
+	"fmt"
+	"io"
 	"sync"
+	"time"
 
+	imap "github.com/meszmate/imap-go"
 	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/server/delivery"
 )
 
 // MemServer is an in-memory IMAP backend. It stores user credentials and
@@ -24,6 +31,10 @@ type MemServer struct {
 	mu       sync.RWMutex
 	users    map[string]string    // username -> password
 	userData map[string]*UserData // username -> mailbox data
+	rules    []Rule
+	quirks   Quirks
+	// structures caches parsed envelopes and body structures.
+	structures *imap.StructureCache
 }
 
 // New creates a new MemServer.
@@ -64,6 +75,31 @@ func (ms *MemServer) GetUserData(username string) *UserData {
 	return ms.userData[username]
 }
 
+var _ delivery.Backend = (*MemServer)(nil)
+
+// Deliver appends a message to a mailbox of a user, as a mail delivery
+// agent would. The delivery rules may file the message into another
+// mailbox. Sessions with the mailbox selected report the new message on
+// their next poll, and idling sessions are notified immediately.
+func (ms *MemServer) Deliver(user, mailbox string, literal io.Reader) error {
+	ud := ms.GetUserData(user)
+	if ud == nil {
+		return delivery.ErrUnknownUser
+	}
+	mbox := ud.GetMailbox(mailbox)
+	if mbox == nil {
+		return delivery.ErrNoSuchMailbox
+	}
+
+	body, err := io.ReadAll(literal)
+	if err != nil {
+		return fmt.Errorf("failed to read message: %w", err)
+	}
+
+	ms.store(ud, mbox, body, nil, time.Now())
+	return nil
+}
+
 // NewSession creates a new Session for a connection. This is the callback
 // used by the server to create sessions for new connections.
 func (ms *MemServer) NewSession(conn *server.Conn) (server.Session, error) {
@@ -73,13 +109,38 @@ func (ms *MemServer) NewSession(conn *server.Conn) (server.Session, error) {
 }
 
 // NewServer creates a new server.Server configured to use this MemServer
-// as its backend. Additional server options can be passed.
+// as its backend, emulating its quirks, see SetQuirks. Additional server
+// options can be passed. Server.SelfTest runs against a separate
+// MemServer, see SelfTestAccount.
 func (ms *MemServer) NewServer(opts ...server.Option) *server.Server {
 	allOpts := []server.Option{
 		server.WithNewSession(ms.NewSession),
 		server.WithAllowInsecureAuth(true),
+		server.WithSelfTestAccount(SelfTestAccount()),
 	}
+	allOpts = append(allOpts, ms.Quirks().serverOptions()...)
 	allOpts = append(allOpts, opts...)
 
 	return server.New(allOpts...)
 }
+
+// SelfTestAccount returns an account on a new, empty MemServer for
+// server.Server.SelfTest, so that a server with any backend can check its
+// handlers and extensions without touching real mailboxes:
+//
+//	srv := server.New(
+//		server.WithNewSession(backend.NewSession),
+//		server.WithSelfTestAccount(memserver.SelfTestAccount()),
+//	)
+//	if err := srv.SelfTest(ctx); err != nil {
+//		log.Fatal(err)
+//	}
+func SelfTestAccount() server.SelfTestAccount {
+	ms := New()
+	ms.AddUser("selftest", "selftest")
+	return server.SelfTestAccount{
+		NewSession: ms.NewSession,
+		Username:   "selftest",
+		Password:   "selftest",
+	}
+}
@@ -1,7 +1,11 @@
 package memserver
 
 import (
+	"errors"
+	"strings"
 	"testing"
+
+	"github.com/meszmate/imap-go/server/delivery"
 )
 
 func TestNew(t *testing.T) {
@@ -214,7 +218,7 @@ func TestNewUserData(t *testing.T) {
 	if !ok {
 		t.Fatal("INBOX not found")
 	}
-	if !inbox.Subscribed {
+	if !ud.IsSubscribed(inbox.Name) {
 		t.Fatal("INBOX should be subscribed by default")
 	}
 }
@@ -331,6 +335,19 @@ func TestUserData_DeleteMailbox_NonExistent(t *testing.T) {
 	}
 }
 
+func TestUserData_CreateMailbox_UIDValidityIncreases(t *testing.T) {
+	ud := NewUserData()
+	inbox := ud.GetMailbox("INBOX").UIDValidity
+
+	_ = ud.CreateMailbox("A")
+	_ = ud.CreateMailbox("B")
+	a := ud.GetMailbox("A").UIDValidity
+	b := ud.GetMailbox("B").UIDValidity
+	if a <= inbox || b <= a {
+		t.Fatalf("expected increasing UIDValidity, got INBOX=%d A=%d B=%d", inbox, a, b)
+	}
+}
+
 func TestUserData_RenameMailbox(t *testing.T) {
 	ud := NewUserData()
 	_ = ud.CreateMailbox("OldName")
@@ -395,32 +412,6 @@ func TestUserData_MailboxNames(t *testing.T) {
 	}
 }
 
-// --- normalizeINBOX tests ---
-
-func TestNormalizeINBOX(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected string
-	}{
-		{"INBOX", "INBOX"},
-		{"inbox", "INBOX"},
-		{"Inbox", "INBOX"},
-		{"InBoX", "INBOX"},
-		{"inBOX", "INBOX"},
-		{"Sent", "Sent"},
-		{"inbox2", "inbox2"},
-		{"INBO", "INBO"},
-		{"", ""},
-	}
-
-	for _, tt := range tests {
-		got := normalizeINBOX(tt.input)
-		if got != tt.expected {
-			t.Errorf("normalizeINBOX(%q) = %q, want %q", tt.input, got, tt.expected)
-		}
-	}
-}
-
 // --- IMAPError tests ---
 
 func TestIMAPError(t *testing.T) {
@@ -429,3 +420,26 @@ func TestIMAPError(t *testing.T) {
 		t.Fatalf("expected %q, got %q", "test error", e.Error())
 	}
 }
+
+func TestMemServer_Deliver(t *testing.T) {
+	ms := New()
+	ms.AddUser("alice", "password")
+
+	if err := ms.Deliver("alice", "INBOX", strings.NewReader("Subject: hi\r\n\r\nbody\r\n")); err != nil {
+		t.Fatalf("Deliver() error: %v", err)
+	}
+	inbox := ms.GetUserData("alice").GetMailbox("INBOX")
+	if len(inbox.Messages) != 1 {
+		t.Fatalf("INBOX has %d messages, want 1", len(inbox.Messages))
+	}
+	if got := string(inbox.Messages[0].Body); got != "Subject: hi\r\n\r\nbody\r\n" {
+		t.Errorf("delivered body = %q", got)
+	}
+
+	if err := ms.Deliver("bob", "INBOX", strings.NewReader("x")); !errors.Is(err, delivery.ErrUnknownUser) {
+		t.Errorf("Deliver() to unknown user error = %v, want ErrUnknownUser", err)
+	}
+	if err := ms.Deliver("alice", "Nope", strings.NewReader("x")); !errors.Is(err, delivery.ErrNoSuchMailbox) {
+		t.Errorf("Deliver() to missing mailbox error = %v, want ErrNoSuchMailbox", err)
+	}
+}
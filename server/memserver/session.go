@@ -2,6 +2,8 @@ package memserver
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"strings"
@@ -9,6 +11,8 @@ import (
 	"unsafe"
 
 	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/auth/scram"
+	"github.com/meszmate/imap-go/extensions/objectid"
 	"github.com/meszmate/imap-go/server"
 )
 
@@ -21,9 +25,23 @@ type Session struct {
 	userData         *UserData
 	selectedMailbox  *Mailbox
 	selectedReadOnly bool
+	// view holds the UIDs of the messages of the selected mailbox as last
+	// reported to the client: message i+1 has UID view[i]. Messages
+	// expunged by other sessions stay in the view, keeping the sequence
+	// numbers of the others, until the expunge is reported.
+	view []imap.UID
+	// flagChanges is the flag change counter of the selected mailbox when
+	// flag changes were last reported to the client.
+	flagChanges uint64
+	// expungeIssued is set when a command referred to messages of the
+	// view expunged by another session, see ExpungeIssued.
+	expungeIssued bool
 }
 
 var _ server.Session = (*Session)(nil)
+var _ server.SessionVanished = (*Session)(nil)
+var _ server.SessionSCRAM = (*Session)(nil)
+var _ server.SessionExpungeIssued = (*Session)(nil)
 
 // Close is called when the connection is closed.
 func (s *Session) Close() error {
@@ -46,6 +64,47 @@ func (s *Session) Login(username, password string) error {
 	return nil
 }
 
+// SCRAMCredentials returns the SCRAM credentials of a user, derived from
+// the password with a salt computed from the user name.
+func (s *Session) SCRAMCredentials(mechanism, username string) (*scram.Credentials, error) {
+	s.srv.mu.RLock()
+	password, ok := s.srv.users[username]
+	s.srv.mu.RUnlock()
+	if !ok {
+		return nil, &IMAPError{Message: "invalid credentials"}
+	}
+	salt := sha256.Sum256([]byte("memserver:" + username))
+	return scram.NewCredentials(password, salt[:16], scram.DefaultIterations)
+}
+
+// SCRAMAuthenticated logs the session in as a user whose SCRAM proof was
+// verified.
+func (s *Session) SCRAMAuthenticated(username string) error {
+	s.srv.mu.RLock()
+	defer s.srv.mu.RUnlock()
+	userData, ok := s.srv.userData[username]
+	if !ok {
+		return &IMAPError{Message: "invalid credentials"}
+	}
+	s.userData = userData
+	return nil
+}
+
+// LoginIdentity logs the session in as a user authenticated by the
+// server's AuthProvider. Users the MemServer does not know get their
+// mailboxes on first login.
+func (s *Session) LoginIdentity(identity server.Identity) error {
+	s.srv.mu.Lock()
+	defer s.srv.mu.Unlock()
+	userData, ok := s.srv.userData[identity.Username]
+	if !ok {
+		userData = NewUserData()
+		s.srv.userData[identity.Username] = userData
+	}
+	s.userData = userData
+	return nil
+}
+
 // Select opens a mailbox.
 func (s *Session) Select(mailbox string, options *imap.SelectOptions) (*imap.SelectData, error) {
 	if s.userData == nil {
@@ -64,6 +123,12 @@ func (s *Session) Select(mailbox string, options *imap.SelectOptions) (*imap.Sel
 
 	s.selectedMailbox = mbox
 	s.selectedReadOnly = readOnly
+	s.view = make([]imap.UID, len(mbox.Messages))
+	for i, msg := range mbox.Messages {
+		s.view[i] = msg.UID
+	}
+	s.flagChanges = mbox.flagChanges
+	mbox.marked = false
 
 	return mbox.SelectData(readOnly), nil
 }
@@ -83,7 +148,7 @@ func (s *Session) Delete(mailbox string) error {
 	}
 
 	// If the deleted mailbox is currently selected, unselect it
-	if s.selectedMailbox != nil && s.selectedMailbox.Name == mailbox {
+	if s.selectedMailbox != nil && s.selectedMailbox.Name == imap.CanonicalMailboxName(mailbox) {
 		s.selectedMailbox = nil
 		s.selectedReadOnly = false
 	}
@@ -105,35 +170,31 @@ func (s *Session) Subscribe(mailbox string) error {
 		return &IMAPError{Message: "not authenticated"}
 	}
 
-	mbox := s.userData.GetMailbox(mailbox)
-	if mbox == nil {
+	if s.userData.GetMailbox(mailbox) == nil {
 		return ErrNoSuchMailbox
 	}
-
-	mbox.mu.Lock()
-	mbox.Subscribed = true
-	mbox.mu.Unlock()
+	s.userData.SetSubscribed(mailbox, true)
 	return nil
 }
 
-// Unsubscribe unsubscribes from a mailbox.
+// Unsubscribe unsubscribes from a mailbox. A subscription can be removed
+// after its mailbox has been deleted.
 func (s *Session) Unsubscribe(mailbox string) error {
 	if s.userData == nil {
 		return &IMAPError{Message: "not authenticated"}
 	}
 
-	mbox := s.userData.GetMailbox(mailbox)
-	if mbox == nil {
+	if !s.userData.IsSubscribed(mailbox) && s.userData.GetMailbox(mailbox) == nil {
 		return ErrNoSuchMailbox
 	}
-
-	mbox.mu.Lock()
-	mbox.Subscribed = false
-	mbox.mu.Unlock()
+	s.userData.SetSubscribed(mailbox, false)
 	return nil
 }
 
-// List lists mailboxes matching the given patterns.
+// List lists mailboxes matching the given patterns. With the SUBSCRIBED
+// selection option, subscriptions to deleted mailboxes are listed with
+// the \NonExistent attribute. Mailboxes with messages added since they
+// were last selected have the \Marked attribute.
 func (s *Session) List(w *server.ListWriter, ref string, patterns []string, options *imap.ListOptions) error {
 	if s.userData == nil {
 		return &IMAPError{Message: "not authenticated"}
@@ -148,55 +209,18 @@ func (s *Session) List(w *server.ListWriter, ref string, patterns []string, opti
 		return nil
 	}
 
-	allNames := s.userData.MailboxNames()
-
-	s.userData.mu.RLock()
-	defer s.userData.mu.RUnlock()
-
-	for name, mbox := range s.userData.Mailboxes {
-		// Check if mailbox matches any pattern
-		matched := false
-		for _, pattern := range patterns {
-			fullPattern := ref + pattern
-			if matchPattern(name, fullPattern, Delimiter) {
-				matched = true
-				break
-			}
-		}
-
-		if !matched {
-			continue
-		}
-
-		// Apply select options
-		if options != nil && options.SelectSubscribed && !mbox.Subscribed {
-			continue
-		}
-
-		// Build attributes
-		var attrs []imap.MailboxAttr
-
-		if options != nil && options.ReturnSubscribed && mbox.Subscribed {
-			attrs = append(attrs, imap.MailboxAttrSubscribed)
-		}
-
-		if options != nil && options.ReturnChildren {
-			if HasChildren(name, allNames, Delimiter) {
-				attrs = append(attrs, imap.MailboxAttrHasChildren)
-			} else {
-				attrs = append(attrs, imap.MailboxAttrHasNoChildren)
+	mailboxes := s.userData.MailboxNames()
+	subscriptions := s.userData.Subscriptions()
+	for _, data := range ListResponses(mailboxes, subscriptions, ref, patterns, options, Delimiter) {
+		if mbox := s.userData.GetMailbox(data.Mailbox); mbox != nil {
+			mbox.mu.Lock()
+			if mbox.Marked() {
+				data.Attrs = append(data.Attrs, imap.MailboxAttrMarked)
 			}
+			mbox.mu.Unlock()
 		}
-
-		data := &imap.ListData{
-			Attrs:   attrs,
-			Delim:   Delimiter,
-			Mailbox: name,
-		}
-
 		w.WriteList(data)
 	}
-
 	return nil
 }
 
@@ -214,7 +238,7 @@ func (s *Session) Status(mailbox string, options *imap.StatusOptions) (*imap.Sta
 	mbox.mu.Lock()
 	defer mbox.mu.Unlock()
 
-	return mbox.StatusData(mailbox, options), nil
+	return mbox.StatusData(mbox.Name, options), nil
 }
 
 // Append appends a message to a mailbox.
@@ -225,7 +249,7 @@ func (s *Session) Append(mailbox string, r imap.LiteralReader, options *imap.App
 
 	mbox := s.userData.GetMailbox(mailbox)
 	if mbox == nil {
-		return nil, ErrNoSuchMailbox
+		return nil, imap.ErrNoWithCode(imap.ResponseCodeTryCreate, "mailbox does not exist")
 	}
 
 	// Read the full message body
@@ -241,9 +265,12 @@ func (s *Session) Append(mailbox string, r imap.LiteralReader, options *imap.App
 		internalDate = options.InternalDate
 	}
 
-	mbox.mu.Lock()
-	msg := mbox.Append(body, flags, internalDate)
-	mbox.mu.Unlock()
+	dest, msg := s.srv.store(s.userData, mbox, body, flags, internalDate)
+	if dest != mbox || s.srv.Quirks().NoUIDPlus {
+		// Filed elsewhere by a delivery rule: omit APPENDUID, which would
+		// refer to the wrong mailbox. Servers without UIDPLUS omit it too.
+		return &imap.AppendData{}, nil
+	}
 
 	return &imap.AppendData{
 		UIDValidity: mbox.UIDValidity,
@@ -251,21 +278,161 @@ func (s *Session) Append(mailbox string, r imap.LiteralReader, options *imap.App
 	}, nil
 }
 
-// Poll checks for mailbox updates without blocking. No-op for memserver.
+// Poll reports changes to the selected mailbox since the last update:
+// messages expunged by other sessions if allowExpunge is set, messages
+// added, for example by APPEND from another connection or by delivery,
+// and flags changed by delivery rules.
+//
+// New messages are those with a UID above the last one of the session's
+// view, not found by comparing message counts: after other sessions
+// expunge messages, the mailbox can hold fewer messages than the view
+// while also holding new ones, which must still be reported. The view
+// only shrinks when the expunges are reported, see syncExpunged.
 func (s *Session) Poll(w *server.UpdateWriter, allowExpunge bool) error {
+	if s.selectedMailbox == nil {
+		return nil
+	}
+
+	mbox := s.selectedMailbox
+	mbox.mu.Lock()
+	defer mbox.mu.Unlock()
+
+	if allowExpunge {
+		s.syncExpunged(w.WriteExpunge)
+	}
+
+	var last imap.UID
+	if n := len(s.view); n > 0 {
+		last = s.view[n-1]
+	}
+	num := len(s.view)
+	for _, msg := range mbox.Messages {
+		if msg.UID > last {
+			s.view = append(s.view, msg.UID)
+		}
+	}
+	if len(s.view) > num {
+		w.WriteExists(uint32(len(s.view)))
+	}
+
+	if mbox.flagChanges > s.flagChanges {
+		for i, msg := range s.viewMessages() {
+			if msg != nil && msg.flagChange > s.flagChanges {
+				w.WriteMessageFlags(uint32(i+1), msg.CopyFlags())
+			}
+		}
+		s.flagChanges = mbox.flagChanges
+	}
 	return nil
 }
 
-// Idle waits for mailbox updates until stop is closed. No-op for memserver.
+// syncExpunged removes the messages that no longer exist from the view
+// and reports their sequence numbers to writeExpunge, in ascending order,
+// each relative to the view after the previous expunges.
+// The caller must hold the mailbox lock.
+func (s *Session) syncExpunged(writeExpunge func(seqNum uint32)) {
+	kept := s.view[:0]
+	for i, msg := range s.viewMessages() {
+		if msg == nil {
+			writeExpunge(uint32(len(kept) + 1))
+			continue
+		}
+		kept = append(kept, s.view[i])
+	}
+	s.view = kept
+}
+
+// viewMessages returns the messages of the view, or nil for those that
+// were expunged: message i+1 is viewMessages()[i].
+// The caller must hold the mailbox lock.
+func (s *Session) viewMessages() []*Message {
+	msgs := make([]*Message, len(s.view))
+	all := s.selectedMailbox.Messages
+	j := 0
+	for i, uid := range s.view {
+		// Both lists are ordered by UID.
+		for j < len(all) && all[j].UID < uid {
+			j++
+		}
+		if j < len(all) && all[j].UID == uid {
+			msgs[i] = all[j]
+		}
+	}
+	return msgs
+}
+
+// matches returns the messages of the view in numSet, leaving out those
+// expunged by other sessions.
+// The caller must hold the mailbox lock.
+func (s *Session) matches(numSet imap.NumSet, kind imap.NumKind) []*matchedMessage {
+	var max uint32
+	if n := len(s.view); n > 0 {
+		max = uint32(n)
+		if kind == imap.NumKindUID {
+			max = uint32(s.view[n-1])
+		}
+	}
+
+	var result []*matchedMessage
+	for i, msg := range s.viewMessages() {
+		seqNum := uint32(i + 1)
+		num := seqNum
+		if kind == imap.NumKindUID {
+			num = uint32(s.view[i])
+		}
+		if !numSetContains(numSet, num, max) {
+			continue
+		}
+		if msg == nil {
+			// Expunged by another session, but not reported yet.
+			s.expungeIssued = true
+			continue
+		}
+		result = append(result, &matchedMessage{SeqNum: seqNum, Message: msg})
+	}
+	return result
+}
+
+// ExpungeIssued reports whether a command referred to messages expunged
+// by another session since it was last called, so that the client is
+// told with EXPUNGEISSUED.
+func (s *Session) ExpungeIssued() bool {
+	issued := s.expungeIssued
+	s.expungeIssued = false
+	return issued
+}
+
+// Idle reports messages added to the selected mailbox as they arrive,
+// until stop is closed.
 func (s *Session) Idle(w *server.UpdateWriter, stop <-chan struct{}) error {
-	<-stop
-	return nil
+	if s.selectedMailbox == nil {
+		<-stop
+		return nil
+	}
+
+	mbox := s.selectedMailbox
+	for {
+		mbox.mu.Lock()
+		changed := mbox.watch()
+		mbox.mu.Unlock()
+
+		if err := s.Poll(w, true); err != nil {
+			return err
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-changed:
+		}
+	}
 }
 
 // Unselect closes the current mailbox without expunging.
 func (s *Session) Unselect() error {
 	s.selectedMailbox = nil
 	s.selectedReadOnly = false
+	s.view = nil
 	return nil
 }
 
@@ -274,31 +441,55 @@ func (s *Session) Expunge(w *server.ExpungeWriter, uids *imap.UIDSet) error {
 	if s.selectedMailbox == nil {
 		return &IMAPError{Message: "no mailbox selected"}
 	}
+	if s.selectedReadOnly {
+		return ErrReadOnly
+	}
 
 	mbox := s.selectedMailbox
 	mbox.mu.Lock()
-	expunged := mbox.Expunge(uids)
-	mbox.mu.Unlock()
+	defer mbox.mu.Unlock()
+	mbox.Expunge(uids)
 
-	for _, seqNum := range expunged {
-		w.WriteExpunge(seqNum)
-	}
+	// This also reports the messages expunged by other sessions.
+	s.syncExpunged(w.WriteExpunge)
 
 	return nil
 }
 
 // Search searches for messages matching the criteria.
 func (s *Session) Search(kind server.NumKind, criteria *imap.SearchCriteria, options *imap.SearchOptions) (*imap.SearchData, error) {
+	return s.SearchWithContext(context.Background(), kind, criteria, options)
+}
+
+// SearchWithContext searches for messages matching the criteria until ctx
+// is done, and returns the matches found until then as incomplete results.
+func (s *Session) SearchWithContext(ctx context.Context, kind server.NumKind, criteria *imap.SearchCriteria, options *imap.SearchOptions) (*imap.SearchData, error) {
 	if s.selectedMailbox == nil {
 		return nil, &IMAPError{Message: "no mailbox selected"}
 	}
 
 	mbox := s.selectedMailbox
 	mbox.mu.Lock()
-	results := mbox.SearchMessages(imap.NumKind(kind), criteria)
+	var results []uint32
+	complete := true
+	for i, msg := range s.viewMessages() {
+		if ctx.Err() != nil {
+			complete = false
+			break
+		}
+		seqNum := uint32(i + 1)
+		if msg == nil || !matchesCriteria(msg, seqNum, criteria) {
+			continue
+		}
+		if kind == imap.NumKindUID {
+			results = append(results, uint32(msg.UID))
+		} else {
+			results = append(results, seqNum)
+		}
+	}
 	mbox.mu.Unlock()
 
-	data := &imap.SearchData{}
+	data := &imap.SearchData{Incomplete: !complete}
 
 	if kind == imap.NumKindUID {
 		data.AllUIDs = make([]imap.UID, len(results))
@@ -348,6 +539,22 @@ func (s *Session) Fetch(w *server.FetchWriter, numSet imap.NumSet, options *imap
 		return &IMAPError{Message: "no mailbox selected"}
 	}
 
+	// The responses are written once the mailbox is unlocked, so that
+	// other sessions are not blocked while a large response is streamed
+	// to a slow client. Message bodies are never modified in place, so the
+	// sections stay valid.
+	results, err := s.fetchData(numSet, options)
+	if err != nil {
+		return err
+	}
+	for _, data := range results {
+		w.WriteFetchData(data)
+	}
+	return nil
+}
+
+// fetchData returns the FETCH data of the messages in numSet.
+func (s *Session) fetchData(numSet imap.NumSet, options *imap.FetchOptions) ([]*imap.FetchMessageData, error) {
 	mbox := s.selectedMailbox
 	mbox.mu.Lock()
 	defer mbox.mu.Unlock()
@@ -358,10 +565,15 @@ func (s *Session) Fetch(w *server.FetchWriter, numSet imap.NumSet, options *imap
 		kind = imap.NumKindUID
 	}
 
-	matches := mbox.MatchesMessages(numSet, kind)
+	matches := s.matches(numSet, kind)
+	cache := s.srv.StructureCache()
 
+	var results []*imap.FetchMessageData
 	for _, m := range matches {
 		msg := m.Message
+		if options.ChangedSince > 0 && msg.ModSeq <= options.ChangedSince {
+			continue
+		}
 		data := &imap.FetchMessageData{
 			SeqNum: m.SeqNum,
 		}
@@ -383,13 +595,26 @@ func (s *Session) Fetch(w *server.FetchWriter, numSet imap.NumSet, options *imap
 		}
 
 		if options.Envelope {
-			data.Envelope = msg.ParseEnvelope()
+			data.Envelope = mbox.envelope(cache, msg)
+		}
+
+		if options.BodyStructure {
+			data.BodyStructure = mbox.bodyStructure(cache, msg)
+		}
+
+		if options.EmailID {
+			data.EmailID = objectid.EmailID(msg.Body)
+		}
+
+		// CHANGEDSINCE implies MODSEQ (RFC 7162 §3.1.4.1).
+		if options.ModSeq || options.ChangedSince > 0 {
+			data.ModSeq = msg.ModSeq
 		}
 
 		if len(options.BodySection) > 0 {
 			data.BodySection = make(map[*imap.FetchItemBodySection]imap.SectionReader)
 			for _, section := range options.BodySection {
-				bodyData := s.fetchSection(msg, section)
+				bodyData := msg.Section(section)
 				data.BodySection[section] = imap.SectionReader{
 					Reader: bytes.NewReader(bodyData),
 					Size:   int64(len(bodyData)),
@@ -397,49 +622,61 @@ func (s *Session) Fetch(w *server.FetchWriter, numSet imap.NumSet, options *imap
 
 				// Set \Seen flag unless Peek is set
 				if !section.Peek && !s.selectedReadOnly {
-					msg.SetFlag(imap.FlagSeen)
+					s.markSeen(msg)
 				}
 			}
 		}
 
-		w.WriteFetchData(data)
-	}
-
-	return nil
-}
+		if len(options.BinarySection) > 0 {
+			data.BinarySection = make(map[*imap.FetchItemBinarySection]imap.SectionReader)
+			for _, section := range options.BinarySection {
+				binData, err := msg.BinarySection(section.Part)
+				if err != nil {
+					return nil, err
+				}
+				binData = applyPartial(binData, section.Partial)
+				data.BinarySection[section] = imap.SectionReader{
+					Reader: bytes.NewReader(binData),
+					Size:   int64(len(binData)),
+				}
 
-// fetchSection returns the body data for a given section specification.
-func (s *Session) fetchSection(msg *Message, section *imap.FetchItemBodySection) []byte {
-	var data []byte
-
-	switch strings.ToUpper(section.Specifier) {
-	case "HEADER":
-		data = msg.HeaderBytes()
-	case "HEADER.FIELDS":
-		data = filterHeaders(msg.HeaderBytes(), section.Fields, false)
-	case "HEADER.FIELDS.NOT":
-		data = filterHeaders(msg.HeaderBytes(), section.Fields, true)
-	case "TEXT":
-		data = msg.TextBytes()
-	default:
-		// Empty specifier = entire message
-		data = msg.Body
-	}
-
-	// Apply partial
-	if section.Partial != nil {
-		offset := section.Partial.Offset
-		if offset >= int64(len(data)) {
-			return nil
+				if !section.Peek && !s.selectedReadOnly {
+					s.markSeen(msg)
+				}
+			}
 		}
-		end := offset + section.Partial.Count
-		if end > int64(len(data)) {
-			end = int64(len(data))
+
+		for _, part := range options.BinarySizeSection {
+			binData, err := msg.BinarySection(part)
+			if err != nil {
+				return nil, err
+			}
+			data.BinarySizeSection = append(data.BinarySizeSection, imap.BinarySizeData{
+				Part: part,
+				Size: uint32(len(binData)),
+			})
 		}
-		data = data[offset:end]
+
+		results = append(results, data)
 	}
 
-	return data
+	return results, nil
+}
+
+// applyPartial returns the byte range of data selected by partial.
+func applyPartial(data []byte, partial *imap.SectionPartial) []byte {
+	if partial == nil {
+		return data
+	}
+	offset := partial.Offset
+	if offset >= int64(len(data)) {
+		return nil
+	}
+	end := offset + partial.Count
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+	return data[offset:end]
 }
 
 // filterHeaders filters message headers to include only (or exclude) the specified fields.
@@ -496,13 +733,22 @@ func filterHeaders(headerBytes []byte, fields []string, not bool) []byte {
 	return result
 }
 
+// markSeen sets the \Seen flag of a fetched message.
+// The caller must hold the mailbox lock.
+func (s *Session) markSeen(msg *Message) {
+	if !msg.HasFlag(imap.FlagSeen) {
+		msg.SetFlag(imap.FlagSeen)
+		s.selectedMailbox.modified(msg)
+	}
+}
+
 // Store modifies message flags.
 func (s *Session) Store(w *server.FetchWriter, numSet imap.NumSet, flags *imap.StoreFlags, options *imap.StoreOptions) error {
 	if s.selectedMailbox == nil {
 		return &IMAPError{Message: "no mailbox selected"}
 	}
 	if s.selectedReadOnly {
-		return &IMAPError{Message: "mailbox is read-only"}
+		return ErrReadOnly
 	}
 
 	mbox := s.selectedMailbox
@@ -515,10 +761,11 @@ func (s *Session) Store(w *server.FetchWriter, numSet imap.NumSet, flags *imap.S
 		kind = imap.NumKindUID
 	}
 
-	matches := mbox.MatchesMessages(numSet, kind)
+	matches := s.matches(numSet, kind)
 
 	for _, m := range matches {
 		msg := m.Message
+		before := msg.CopyFlags()
 
 		switch flags.Action {
 		case imap.StoreFlagsSet:
@@ -534,6 +781,11 @@ func (s *Session) Store(w *server.FetchWriter, numSet imap.NumSet, flags *imap.S
 			}
 		}
 
+		// The mod-sequence only changes if the flags did.
+		if !sameFlags(before, msg.Flags) {
+			mbox.modified(msg)
+		}
+
 		// Send updated flags unless silent
 		if !flags.Silent {
 			w.WriteFlags(m.SeqNum, msg.CopyFlags())
@@ -543,6 +795,15 @@ func (s *Session) Store(w *server.FetchWriter, numSet imap.NumSet, flags *imap.S
 	return nil
 }
 
+// ExpungedUIDs implements server.SessionVanished using the journal of
+// the selected mailbox.
+func (s *Session) ExpungedUIDs(uids *imap.UIDSet, sinceModSeq uint64) (*imap.UIDSet, error) {
+	if s.selectedMailbox == nil {
+		return nil, &IMAPError{Message: "no mailbox selected"}
+	}
+	return server.JournalExpungedUIDs(s.selectedMailbox.Journal(), uids, sinceModSeq)
+}
+
 // Copy copies messages to another mailbox.
 func (s *Session) Copy(numSet imap.NumSet, dest string) (*imap.CopyData, error) {
 	if s.selectedMailbox == nil {
@@ -555,6 +816,7 @@ func (s *Session) Copy(numSet imap.NumSet, dest string) (*imap.CopyData, error)
 	}
 
 	srcMbox := s.selectedMailbox
+	noUIDPlus := s.srv.Quirks().NoUIDPlus
 
 	// Lock both mailboxes. To avoid deadlock, always lock in a consistent order
 	// based on pointer address.
@@ -584,11 +846,15 @@ func (s *Session) Copy(numSet imap.NumSet, dest string) (*imap.CopyData, error)
 		kind = imap.NumKindUID
 	}
 
-	matches := srcMbox.MatchesMessages(numSet, kind)
+	matches := s.matches(numSet, kind)
 
 	copyData := &imap.CopyData{
 		UIDValidity: destMbox.UIDValidity,
 	}
+	if noUIDPlus {
+		// Without UIDVALIDITY, no COPYUID is written.
+		copyData.UIDValidity = 0
+	}
 
 	for _, m := range matches {
 		newUID := srcMbox.CopyMessageTo(m.Message, destMbox)
@@ -2,7 +2,9 @@ package memserver
 
 import (
 	"bytes"
+	"errors"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -246,6 +248,44 @@ func TestSession_Delete(t *testing.T) {
 	}
 }
 
+func TestSession_Delete_RecreateChangesUIDValidity(t *testing.T) {
+	s, _ := newLoggedInSession(t)
+
+	if err := s.Create("Reused", nil); err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+	before, err := s.Select("Reused", nil)
+	if err != nil {
+		t.Fatalf("Select() error: %v", err)
+	}
+	if err := s.Unselect(); err != nil {
+		t.Fatalf("Unselect() error: %v", err)
+	}
+
+	if err := s.Delete("Reused"); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	if err := s.Create("Reused", nil); err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+
+	status, err := s.Status("Reused", &imap.StatusOptions{UIDValidity: true})
+	if err != nil {
+		t.Fatalf("Status() error: %v", err)
+	}
+	if status.UIDValidity == nil || *status.UIDValidity <= before.UIDValidity {
+		t.Fatalf("expected UIDValidity greater than %d, got %v", before.UIDValidity, status.UIDValidity)
+	}
+
+	after, err := s.Select("Reused", nil)
+	if err != nil {
+		t.Fatalf("Select() error: %v", err)
+	}
+	if after.UIDValidity <= before.UIDValidity {
+		t.Fatalf("expected UIDValidity greater than %d, got %d", before.UIDValidity, after.UIDValidity)
+	}
+}
+
 func TestSession_Delete_NonExistent(t *testing.T) {
 	s, _ := newLoggedInSession(t)
 
@@ -354,8 +394,7 @@ func TestSession_Subscribe(t *testing.T) {
 	}
 
 	ud := ms.GetUserData("alice")
-	mbox := ud.GetMailbox("TestMailbox")
-	if !mbox.Subscribed {
+	if !ud.IsSubscribed("TestMailbox") {
 		t.Fatal("mailbox should be subscribed")
 	}
 }
@@ -391,8 +430,7 @@ func TestSession_Unsubscribe(t *testing.T) {
 	}
 
 	ud := ms.GetUserData("alice")
-	mbox := ud.GetMailbox("INBOX")
-	if mbox.Subscribed {
+	if ud.IsSubscribed("INBOX") {
 		t.Fatal("mailbox should be unsubscribed")
 	}
 }
@@ -416,6 +454,45 @@ func TestSession_Unsubscribe_NotAuthenticated(t *testing.T) {
 	}
 }
 
+func TestSession_Subscription_OutlivesMailbox(t *testing.T) {
+	s, ms := newLoggedInSession(t)
+
+	_ = s.Create("Archive", nil)
+	if err := s.Subscribe("Archive"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.Delete("Archive"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ud := ms.GetUserData("alice")
+	if !ud.IsSubscribed("Archive") {
+		t.Fatal("subscription should survive the deletion of the mailbox")
+	}
+
+	w, buf := newListWriterWithBuffer()
+	if err := s.List(w, "", []string{"*"}, &imap.ListOptions{SelectSubscribed: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), `* LIST (\NonExistent \Subscribed) "/" Archive`) {
+		t.Fatalf("expected Archive as \\NonExistent, got %q", buf.String())
+	}
+
+	// A plain LIST only shows existing mailboxes
+	w, buf = newListWriterWithBuffer()
+	_ = s.List(w, "", []string{"*"}, nil)
+	if strings.Contains(buf.String(), "Archive") {
+		t.Fatalf("deleted mailbox in LIST response: %q", buf.String())
+	}
+
+	if err := s.Unsubscribe("Archive"); err != nil {
+		t.Fatalf("unexpected error unsubscribing from a deleted mailbox: %v", err)
+	}
+	if ud.IsSubscribed("Archive") {
+		t.Fatal("mailbox should be unsubscribed")
+	}
+}
+
 // --- List tests ---
 
 func TestSession_List_EmptyPattern(t *testing.T) {
@@ -778,6 +855,28 @@ func TestSession_Fetch_UID(t *testing.T) {
 	}
 }
 
+func TestSession_Fetch_EmailID(t *testing.T) {
+	s, _ := newSelectedSession(t)
+
+	msg := "Message-ID: <1@example.com>\r\nSubject: Test\r\n\r\nBody"
+	appendTestMessage(t, s, "INBOX", msg, nil)
+	appendTestMessage(t, s, "INBOX", "Received: by mx\r\n"+msg, nil)
+	_, _ = s.Select("INBOX", nil)
+
+	var buf bytes.Buffer
+	w := server.NewFetchWriter(server.NewResponseEncoder(wire.NewEncoder(&buf)))
+	seqSet := &imap.SeqSet{}
+	seqSet.AddRange(1, 2)
+
+	if err := s.Fetch(w, seqSet, &imap.FetchOptions{EmailID: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	id := imap.ObjectIDFromIdentity("mid:1@example.com")
+	if got := strings.Count(buf.String(), "EMAILID ("+id+")"); got != 2 {
+		t.Fatalf("expected EMAILID %s for both messages, got %q", id, buf.String())
+	}
+}
+
 func TestSession_Fetch_Envelope(t *testing.T) {
 	s, _ := newSelectedSession(t)
 
@@ -1176,6 +1275,13 @@ func TestSession_Store_ReadOnly(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error when mailbox is read-only")
 	}
+	var imapErr *imap.IMAPError
+	if !errors.As(err, &imapErr) || imapErr.Type != imap.StatusResponseTypeNO {
+		t.Errorf("Store() error = %v, want a NO response", err)
+	}
+	if s.selectedMailbox.Messages[0].HasFlag(imap.FlagSeen) {
+		t.Error("Store() changed a read-only mailbox")
+	}
 }
 
 func TestSession_Store_NoMailboxSelected(t *testing.T) {
@@ -1281,8 +1387,8 @@ func TestSession_Copy(t *testing.T) {
 	if data == nil {
 		t.Fatal("expected CopyData, got nil")
 	}
-	if data.UIDValidity != 1 {
-		t.Fatalf("expected UIDValidity 1, got %d", data.UIDValidity)
+	if want := s.userData.GetMailbox("Backup").UIDValidity; data.UIDValidity != want {
+		t.Fatalf("expected UIDValidity %d, got %d", want, data.UIDValidity)
 	}
 
 	// Check that messages were copied
@@ -1379,6 +1485,21 @@ func TestSession_Copy_ToSameMailbox(t *testing.T) {
 
 // --- Expunge tests ---
 
+func TestSession_Expunge_ReadOnly(t *testing.T) {
+	s, _ := newLoggedInSession(t)
+
+	appendTestMessage(t, s, "INBOX", "msg1", []imap.Flag{imap.FlagDeleted})
+	_, _ = s.Select("INBOX", &imap.SelectOptions{ReadOnly: true})
+
+	w := newExpungeWriter()
+	if err := s.Expunge(w, nil); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("Expunge() error = %v, want ErrReadOnly", err)
+	}
+	if s.selectedMailbox.NumMessages() != 1 {
+		t.Errorf("Expunge() removed messages from a read-only mailbox")
+	}
+}
+
 func TestSession_Expunge(t *testing.T) {
 	s, _ := newSelectedSession(t)
 
@@ -1512,6 +1633,118 @@ func TestSession_Idle(t *testing.T) {
 	}
 }
 
+func TestSession_PollReportsDelivery(t *testing.T) {
+	s, ms := newSelectedSession(t)
+
+	if err := ms.Deliver("alice", "INBOX", strings.NewReader("Subject: hi\r\n\r\nbody\r\n")); err != nil {
+		t.Fatalf("Deliver() error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	w := server.NewUpdateWriter(server.NewResponseEncoder(wire.NewEncoder(&buf)))
+	if err := s.Poll(w, true); err != nil {
+		t.Fatalf("Poll() error: %v", err)
+	}
+	if buf.String() != "* 1 EXISTS\r\n" {
+		t.Errorf("Poll() wrote %q, want %q", buf.String(), "* 1 EXISTS\r\n")
+	}
+
+	buf.Reset()
+	if err := s.Poll(w, true); err != nil {
+		t.Fatalf("Poll() error: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("second Poll() wrote %q, want nothing", buf.String())
+	}
+}
+
+func TestSession_PollReportsDeliveryAfterOtherSessionExpunge(t *testing.T) {
+	s, ms := newSelectedSession(t)
+	appendTestMessage(t, s, "INBOX", "msg1", []imap.Flag{imap.FlagDeleted})
+	appendTestMessage(t, s, "INBOX", "msg2", []imap.Flag{imap.FlagDeleted})
+	_, _ = s.Select("INBOX", nil)
+
+	other := &Session{srv: ms}
+	if err := other.Login("alice", "password123"); err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	if _, err := other.Select("INBOX", nil); err != nil {
+		t.Fatalf("Select() error: %v", err)
+	}
+	if err := other.Expunge(newExpungeWriter(), nil); err != nil {
+		t.Fatalf("Expunge() error: %v", err)
+	}
+	if err := ms.Deliver("alice", "INBOX", strings.NewReader("Subject: hi\r\n\r\nbody\r\n")); err != nil {
+		t.Fatalf("Deliver() error: %v", err)
+	}
+
+	// While expunges cannot be reported, the expunged messages keep their
+	// sequence numbers, and the delivered message comes after them.
+	var buf bytes.Buffer
+	w := server.NewUpdateWriter(server.NewResponseEncoder(wire.NewEncoder(&buf)))
+	if err := s.Poll(w, false); err != nil {
+		t.Fatalf("Poll() error: %v", err)
+	}
+	if want := "* 3 EXISTS\r\n"; buf.String() != want {
+		t.Errorf("Poll(allowExpunge=false) wrote %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := s.Poll(w, true); err != nil {
+		t.Fatalf("Poll() error: %v", err)
+	}
+	if want := "* 1 EXPUNGE\r\n* 1 EXPUNGE\r\n"; buf.String() != want {
+		t.Errorf("Poll(allowExpunge=true) wrote %q, want %q", buf.String(), want)
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSession_IdleReportsDelivery(t *testing.T) {
+	s, ms := newSelectedSession(t)
+
+	var buf lockedBuffer
+	w := server.NewUpdateWriter(server.NewResponseEncoder(wire.NewEncoder(&buf)))
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Idle(w, stop)
+	}()
+
+	if err := ms.Deliver("alice", "INBOX", strings.NewReader("Subject: hi\r\n\r\nbody\r\n")); err != nil {
+		t.Fatalf("Deliver() error: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for buf.String() != "* 1 EXISTS\r\n" {
+		if time.Now().After(deadline) {
+			t.Fatalf("Idle() wrote %q, want %q", buf.String(), "* 1 EXISTS\r\n")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Idle() error: %v", err)
+	}
+}
+
 // --- filterHeaders tests ---
 
 func TestFilterHeaders_Include(t *testing.T) {
@@ -1804,3 +2037,33 @@ func appendTestMessage(t *testing.T, s *Session, mailbox string, body string, fl
 		t.Fatalf("failed to append message: %v", err)
 	}
 }
+
+// --- INBOX case-insensitivity tests ---
+
+func TestSession_InboxCaseInsensitive(t *testing.T) {
+	s, _ := newLoggedInSession(t)
+
+	if _, err := s.Select("inbox", nil); err != nil {
+		t.Fatalf("Select(inbox) error: %v", err)
+	}
+
+	body := "Subject: hi\r\n\r\nhello"
+	if _, err := s.Append("Inbox", imap.LiteralReader{Reader: strings.NewReader(body), Size: int64(len(body))}, nil); err != nil {
+		t.Fatalf("Append(Inbox) error: %v", err)
+	}
+
+	data, err := s.Status("iNbOx", &imap.StatusOptions{NumMessages: true})
+	if err != nil {
+		t.Fatalf("Status(iNbOx) error: %v", err)
+	}
+	if data.Mailbox != "INBOX" {
+		t.Errorf("Status mailbox = %q, want INBOX", data.Mailbox)
+	}
+	if data.NumMessages == nil || *data.NumMessages != 1 {
+		t.Errorf("Status MESSAGES = %v, want 1", data.NumMessages)
+	}
+
+	if err := s.Create("inbox", nil); err == nil {
+		t.Error("Create(inbox) error = nil, want already exists")
+	}
+}
@@ -0,0 +1,123 @@
+package memserver
+
+import (
+	imap "github.com/meszmate/imap-go"
+)
+
+// MailboxStats is the memory used by the messages of a mailbox.
+type MailboxStats struct {
+	// Messages is the number of messages.
+	Messages int
+	// Bytes is the total size of the stored message bodies.
+	Bytes int64
+}
+
+// UserStats is the memory used by the messages of a user.
+type UserStats struct {
+	Messages int
+	Bytes    int64
+	// Mailboxes are the statistics of each mailbox, by name.
+	Mailboxes map[string]MailboxStats
+}
+
+// Stats is a snapshot of the memory used by the messages stored in a
+// MemServer, for monitoring long-running test servers.
+type Stats struct {
+	Messages int
+	Bytes    int64
+	// Users are the statistics of each user, by username.
+	Users map[string]UserStats
+}
+
+// Stats returns a snapshot of the memory used by the stored messages.
+// Bodies of expunged messages are released immediately and are not
+// counted, even if sessions that have not seen the expunge yet still
+// have the mailbox selected.
+func (ms *MemServer) Stats() *Stats {
+	ms.mu.RLock()
+	users := make(map[string]*UserData, len(ms.userData))
+	for name, ud := range ms.userData {
+		users[name] = ud
+	}
+	ms.mu.RUnlock()
+
+	stats := &Stats{Users: make(map[string]UserStats, len(users))}
+	for name, ud := range users {
+		us := ud.Stats()
+		stats.Users[name] = us
+		stats.Messages += us.Messages
+		stats.Bytes += us.Bytes
+	}
+	return stats
+}
+
+// Stats returns a snapshot of the memory used by the messages of the user.
+func (u *UserData) Stats() UserStats {
+	stats := UserStats{Mailboxes: make(map[string]MailboxStats)}
+	for name, mbox := range u.mailboxes() {
+		mbox.mu.Lock()
+		ms := mbox.stats()
+		mbox.mu.Unlock()
+
+		stats.Mailboxes[name] = ms
+		stats.Messages += ms.Messages
+		stats.Bytes += ms.Bytes
+	}
+	return stats
+}
+
+// Compact releases memory left over by expunged messages, such as the
+// unused capacity of message lists that shrank. Long-running servers can
+// call it periodically; it does not change any visible state.
+func (ms *MemServer) Compact() {
+	ms.mu.RLock()
+	users := make([]*UserData, 0, len(ms.userData))
+	for _, ud := range ms.userData {
+		users = append(users, ud)
+	}
+	ms.mu.RUnlock()
+
+	for _, ud := range users {
+		for _, mbox := range ud.mailboxes() {
+			mbox.mu.Lock()
+			mbox.compact()
+			mbox.mu.Unlock()
+		}
+	}
+}
+
+// mailboxes returns the mailboxes of the user by name, so that they can
+// be locked one at a time without holding the user lock.
+func (u *UserData) mailboxes() map[string]*Mailbox {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	mailboxes := make(map[string]*Mailbox, len(u.Mailboxes))
+	for name, mbox := range u.Mailboxes {
+		mailboxes[name] = mbox
+	}
+	return mailboxes
+}
+
+// stats returns the statistics of the mailbox.
+// The caller must hold the mailbox lock.
+func (mbox *Mailbox) stats() MailboxStats {
+	stats := MailboxStats{Messages: len(mbox.Messages)}
+	for _, msg := range mbox.Messages {
+		stats.Bytes += int64(len(msg.Body))
+	}
+	return stats
+}
+
+// compact reallocates the message list and flag lists whose capacity is
+// mostly unused. Message bodies are exact copies already.
+// The caller must hold the mailbox lock.
+func (mbox *Mailbox) compact() {
+	if cap(mbox.Messages) > 2*len(mbox.Messages)+16 {
+		mbox.Messages = append([]*Message(nil), mbox.Messages...)
+	}
+	for _, msg := range mbox.Messages {
+		if cap(msg.Flags) > 2*len(msg.Flags)+4 {
+			msg.Flags = append([]imap.Flag(nil), msg.Flags...)
+		}
+	}
+}
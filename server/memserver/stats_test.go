@@ -0,0 +1,77 @@
+package memserver
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestMemServer_Stats(t *testing.T) {
+	ms := New()
+	ms.AddUser("alice", "pass")
+	ms.AddUser("bob", "pass")
+	if err := ms.GetUserData("alice").CreateMailbox("Archive"); err != nil {
+		t.Fatalf("CreateMailbox() error: %v", err)
+	}
+
+	deliver := func(user, mailbox, body string) {
+		t.Helper()
+		if err := ms.Deliver(user, mailbox, strings.NewReader(body)); err != nil {
+			t.Fatalf("Deliver() error: %v", err)
+		}
+	}
+	deliver("alice", "INBOX", "Subject: a\r\n\r\nhello\r\n")
+	deliver("alice", "Archive", "Subject: b\r\n\r\n")
+	deliver("bob", "INBOX", "x")
+
+	stats := ms.Stats()
+	if stats.Messages != 3 || stats.Bytes != 36 {
+		t.Errorf("Stats() = %d messages, %d bytes, want 3, 36", stats.Messages, stats.Bytes)
+	}
+	alice := stats.Users["alice"]
+	if alice.Messages != 2 || alice.Mailboxes["Archive"].Bytes != 14 || alice.Mailboxes["INBOX"].Bytes != 21 {
+		t.Errorf("alice = %+v", alice)
+	}
+
+	// Expunged bodies are released and no longer counted.
+	inbox := ms.GetUserData("alice").GetMailbox("INBOX")
+	inbox.mu.Lock()
+	msg := inbox.Messages[0]
+	msg.SetFlag(imap.FlagDeleted)
+	inbox.Expunge(nil)
+	inbox.mu.Unlock()
+	if msg.Body != nil {
+		t.Error("body of expunged message was not released")
+	}
+	if stats := ms.Stats(); stats.Messages != 2 || stats.Bytes != 15 {
+		t.Errorf("Stats() after expunge = %d messages, %d bytes, want 2, 15", stats.Messages, stats.Bytes)
+	}
+}
+
+func TestMemServer_Compact(t *testing.T) {
+	ms := New()
+	ms.AddUser("alice", "pass")
+	inbox := ms.GetUserData("alice").GetMailbox("INBOX")
+
+	inbox.mu.Lock()
+	for i := 0; i < 100; i++ {
+		inbox.Append([]byte("x"), []imap.Flag{imap.FlagDeleted}, time.Time{})
+	}
+	inbox.Append([]byte("kept"), nil, time.Time{})
+	inbox.Expunge(nil)
+	inbox.Messages = append(make([]*Message, 0, 100), inbox.Messages...)
+	inbox.mu.Unlock()
+
+	ms.Compact()
+
+	inbox.mu.Lock()
+	defer inbox.mu.Unlock()
+	if len(inbox.Messages) != 1 || cap(inbox.Messages) != 1 {
+		t.Errorf("len = %d, cap = %d after Compact, want 1, 1", len(inbox.Messages), cap(inbox.Messages))
+	}
+	if string(inbox.Messages[0].Body) != "kept" {
+		t.Errorf("message = %q", inbox.Messages[0].Body)
+	}
+}
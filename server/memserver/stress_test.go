@@ -0,0 +1,249 @@
+package memserver
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meszmate/imap-go/imaptest"
+	_ "github.com/meszmate/imap-go/server/commands"
+)
+
+// stressClient is a raw connection that keeps the client's view of the
+// selected mailbox, the UIDs by sequence number, from the untagged
+// responses it receives, and checks them against the rules of RFC 3501
+// §7.4.1 and §2.3.1.
+type stressClient struct {
+	name string
+	conn net.Conn
+	r    *bufio.Reader
+	tags int
+	// view[i] is the UID of message i+1, or 0 if not known yet.
+	view []uint32
+	// err is the first violation or I/O error.
+	err error
+}
+
+var fetchUIDPattern = regexp.MustCompile(`\bUID (\d+)`)
+
+func dialStress(t *testing.T, addr, name string) *stressClient {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial() error: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	c := &stressClient{name: name, conn: conn, r: bufio.NewReader(conn)}
+	c.readLine() // greeting
+	c.run("LOGIN alice secret")
+	c.run("SELECT INBOX")
+	return c
+}
+
+func (c *stressClient) fail(format string, args ...interface{}) {
+	if c.err == nil {
+		c.err = fmt.Errorf("%s: %s", c.name, fmt.Sprintf(format, args...))
+	}
+}
+
+func (c *stressClient) readLine() string {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.fail("read: %v", err)
+		return ""
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+// run sends a command, applies the untagged responses to the view and
+// returns them with the tagged response. literal, if set, is sent as a
+// synchronizing literal after the command line.
+func (c *stressClient) run(command string, literal ...string) (untagged []string, tagged string) {
+	c.tags++
+	tag := "T" + strconv.Itoa(c.tags)
+	line := tag + " " + command
+	if len(literal) > 0 {
+		line += fmt.Sprintf(" {%d}", len(literal[0]))
+	}
+	if _, err := c.conn.Write([]byte(line + "\r\n")); err != nil {
+		c.fail("write: %v", err)
+		return nil, ""
+	}
+
+	for c.err == nil {
+		resp := c.readLine()
+		switch {
+		case strings.HasPrefix(resp, "+") && len(literal) > 0:
+			if _, err := c.conn.Write([]byte(literal[0] + "\r\n")); err != nil {
+				c.fail("write: %v", err)
+			}
+		case strings.HasPrefix(resp, tag+" "):
+			if !strings.HasPrefix(resp, tag+" OK") {
+				c.fail("%s: %s", command, resp)
+			}
+			c.checkOrder()
+			return untagged, resp
+		case strings.HasPrefix(resp, "* "):
+			untagged = append(untagged, resp[2:])
+			c.apply(command, resp[2:])
+		}
+	}
+	return nil, ""
+}
+
+// apply updates the view with an untagged response.
+func (c *stressClient) apply(command, resp string) {
+	fields := strings.Fields(resp)
+	if len(fields) < 2 {
+		return
+	}
+	n, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil {
+		return
+	}
+	switch fields[1] {
+	case "EXISTS":
+		if int(n) < len(c.view) {
+			c.fail("%s: EXISTS %d decreases the message count %d", command, n, len(c.view))
+			return
+		}
+		for len(c.view) < int(n) {
+			c.view = append(c.view, 0)
+		}
+	case "EXPUNGE":
+		if n == 0 || int(n) > len(c.view) {
+			c.fail("%s: EXPUNGE %d of unknown message, %d exist", command, n, len(c.view))
+			return
+		}
+		c.view = append(c.view[:n-1], c.view[n:]...)
+	case "FETCH":
+		if n == 0 || int(n) > len(c.view) {
+			c.fail("%s: FETCH %d of unknown message, %d exist", command, n, len(c.view))
+			return
+		}
+		m := fetchUIDPattern.FindStringSubmatch(resp)
+		if m == nil {
+			return
+		}
+		uid, _ := strconv.ParseUint(m[1], 10, 32)
+		if known := c.view[n-1]; known != 0 && known != uint32(uid) {
+			c.fail("%s: message %d has UID %d, was %d", command, n, uid, known)
+		}
+		c.view[n-1] = uint32(uid)
+	}
+}
+
+// checkOrder checks that the known UIDs are strictly ascending.
+func (c *stressClient) checkOrder() {
+	var last uint32
+	for i, uid := range c.view {
+		if uid == 0 {
+			continue
+		}
+		if uid <= last {
+			c.fail("UID %d of message %d does not exceed %d: %v", uid, i+1, last, c.view)
+			return
+		}
+		last = uid
+	}
+}
+
+// step runs a random command.
+func (c *stressClient) step(rng *rand.Rand) {
+	randSeq := func() int { return rng.Intn(len(c.view)) + 1 }
+	switch op := rng.Intn(10); {
+	case op < 3:
+		c.run("APPEND INBOX", fmt.Sprintf("Subject: %s %d\r\n\r\nbody", c.name, rng.Int()))
+	case op < 5 && len(c.view) > 0:
+		action := "+FLAGS"
+		if rng.Intn(4) == 0 {
+			action = "-FLAGS"
+		}
+		c.run(fmt.Sprintf("STORE %d %s (\\Deleted)", randSeq(), action))
+	case op < 6 && len(c.view) > 0:
+		if uid := c.view[randSeq()-1]; uid != 0 {
+			c.run(fmt.Sprintf("UID STORE %d +FLAGS (\\Seen)", uid))
+		}
+	case op < 7:
+		c.run("EXPUNGE")
+	case op < 8:
+		c.run("FETCH 1:* (UID FLAGS)")
+	case op < 9:
+		untagged, _ := c.run("SEARCH DELETED")
+		for _, resp := range untagged {
+			if !strings.HasPrefix(resp, "SEARCH") {
+				continue
+			}
+			for _, f := range strings.Fields(resp)[1:] {
+				if n, _ := strconv.Atoi(f); n < 1 || n > len(c.view) {
+					c.fail("SEARCH returned unknown message %d, %d exist", n, len(c.view))
+				}
+			}
+		}
+	default:
+		c.run("NOOP")
+	}
+}
+
+func TestStress_InterleavedExpunges(t *testing.T) {
+	const (
+		sessions = 4
+		steps    = 150
+	)
+	seed := time.Now().UnixNano()
+	t.Logf("seed %d", seed)
+
+	ms := New()
+	ms.AddUser("alice", "secret")
+	h := imaptest.NewHarness(t, ms.NewServer())
+
+	clients := make([]*stressClient, sessions)
+	for i := range clients {
+		clients[i] = dialStress(t, h.Addr(), fmt.Sprintf("session %d", i))
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		wg.Add(1)
+		go func(c *stressClient, rng *rand.Rand) {
+			defer wg.Done()
+			for j := 0; j < steps && c.err == nil; j++ {
+				c.step(rng)
+			}
+		}(c, rand.New(rand.NewSource(seed+int64(i))))
+	}
+	wg.Wait()
+
+	for _, c := range clients {
+		if c.err != nil {
+			t.Fatal(c.err)
+		}
+	}
+
+	// Once synchronized, every view matches the mailbox.
+	inbox := ms.GetUserData("alice").GetMailbox("INBOX")
+	inbox.mu.Lock()
+	var want []uint32
+	for _, msg := range inbox.Messages {
+		want = append(want, uint32(msg.UID))
+	}
+	inbox.mu.Unlock()
+	for _, c := range clients {
+		c.run("NOOP")
+		c.run("FETCH 1:* (UID)")
+		if c.err != nil {
+			t.Fatal(c.err)
+		}
+		if fmt.Sprint(c.view) != fmt.Sprint(want) {
+			t.Errorf("%s: view %v, mailbox %v", c.name, c.view, want)
+		}
+	}
+}
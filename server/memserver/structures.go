@@ -0,0 +1,82 @@
+package memserver
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// lastCacheID is the last cache ID assigned to a mailbox.
+var lastCacheID atomic.Uint64
+
+// SetStructureCache sets the cache of the envelopes and body structures
+// parsed by FETCH. The cache may be shared with other MemServers. A nil
+// cache, the default, parses them for every FETCH.
+func (ms *MemServer) SetStructureCache(cache *imap.StructureCache) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.structures = cache
+}
+
+// StructureCache returns the cache set with SetStructureCache.
+func (ms *MemServer) StructureCache() *imap.StructureCache {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.structures
+}
+
+// envelope returns the envelope of a message of the mailbox, from cache
+// if possible. The caller must hold the mailbox lock.
+func (mbox *Mailbox) envelope(cache *imap.StructureCache, msg *Message) *imap.Envelope {
+	if cache == nil {
+		return msg.ParseEnvelope()
+	}
+	key := mbox.cacheKey(cache, msg)
+	if env, ok := cache.Envelope(key); ok {
+		return env
+	}
+	env := msg.ParseEnvelope()
+	cache.SetEnvelope(key, env)
+	return env
+}
+
+// bodyStructure returns the body structure of a message of the mailbox,
+// from cache if possible. The caller must hold the mailbox lock.
+func (mbox *Mailbox) bodyStructure(cache *imap.StructureCache, msg *Message) *imap.BodyStructure {
+	if cache == nil {
+		return msg.ParseBodyStructure()
+	}
+	key := mbox.cacheKey(cache, msg)
+	if bs, ok := cache.BodyStructure(key); ok {
+		return bs
+	}
+	bs := msg.ParseBodyStructure()
+	cache.SetBodyStructure(key, bs)
+	return bs
+}
+
+// cacheKey returns the key of a message of the mailbox in cache, and
+// records that the mailbox has values in cache to invalidate when its
+// messages are expunged. Mailboxes are identified by an ID unique in the
+// process, since names and UIDVALIDITY values are only unique per user.
+// The caller must hold the mailbox lock.
+func (mbox *Mailbox) cacheKey(cache *imap.StructureCache, msg *Message) imap.MessageKey {
+	if mbox.cacheID == 0 {
+		mbox.cacheID = lastCacheID.Add(1)
+	}
+	mbox.structures = cache
+	return imap.MessageKey{
+		Mailbox:     strconv.FormatUint(mbox.cacheID, 10),
+		UIDValidity: mbox.UIDValidity,
+		UID:         msg.UID,
+	}
+}
+
+// invalidateStructures removes the cached values of an expunged message.
+// The caller must hold the mailbox lock.
+func (mbox *Mailbox) invalidateStructures(msg *Message) {
+	if mbox.structures != nil {
+		mbox.structures.Invalidate(mbox.cacheKey(mbox.structures, msg))
+	}
+}
@@ -0,0 +1,74 @@
+package memserver
+
+import (
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestMessage_ParseBodyStructure(t *testing.T) {
+	msg := &Message{Body: []byte(multipartMessage)}
+	bs := msg.ParseBodyStructure()
+	if !bs.IsMultipart() || bs.Subtype != "mixed" || len(bs.Children) != 2 {
+		t.Fatalf("ParseBodyStructure() = %+v, want multipart/mixed with 2 parts", bs)
+	}
+	text := bs.Children[0]
+	if text.Type != "text" || text.Subtype != "plain" || text.Encoding != "QUOTED-PRINTABLE" || text.Lines != 1 {
+		t.Errorf("part 1 = %+v, want a 1-line quoted-printable text/plain part", text)
+	}
+	if bin := bs.Children[1]; bin.Subtype != "octet-stream" || bin.Encoding != "BASE64" || bin.Size != 22 {
+		t.Errorf("part 2 = %+v, want a 22-byte base64 application/octet-stream part", bin)
+	}
+
+	plain := (&Message{Body: []byte("Subject: hi\r\n\r\nhello\r\n")}).ParseBodyStructure()
+	if plain.Type != "text" || plain.Params["charset"] != "us-ascii" || plain.Encoding != "7BIT" || plain.Size != 7 {
+		t.Errorf("ParseBodyStructure() of a message without Content-Type = %+v", plain)
+	}
+
+	nested := (&Message{Body: []byte("Content-Type: message/rfc822\r\n\r\nSubject: inner\r\n\r\nbody\r\n")}).ParseBodyStructure()
+	if nested.Envelope == nil || nested.Envelope.Subject != "inner" || nested.BodyStructure == nil || nested.Lines != 3 {
+		t.Errorf("ParseBodyStructure() of message/rfc822 = %+v", nested)
+	}
+}
+
+func TestStructureCache_SharedAcrossSessions(t *testing.T) {
+	s1, ms := newSelectedSession(t)
+	cache := imap.NewStructureCache(1 << 20)
+	ms.SetStructureCache(cache)
+	s2 := &Session{srv: ms}
+	if err := s2.Login("alice", "password123"); err != nil {
+		t.Fatal(err)
+	}
+	appendTestMessage(t, s1, "INBOX", "Subject: shared\r\n\r\nhello\r\n", []imap.Flag{imap.FlagDeleted})
+	for _, s := range []*Session{s1, s2} {
+		if _, err := s.Select("INBOX", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	options := &imap.FetchOptions{Envelope: true, BodyStructure: true}
+	uids := &imap.UIDSet{}
+	uids.AddNum(1)
+
+	first, err := s1.fetchData(uids, options)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("fetchData() = %v, %v", first, err)
+	}
+	second, err := s2.fetchData(uids, options)
+	if err != nil || len(second) != 1 {
+		t.Fatalf("fetchData() = %v, %v", second, err)
+	}
+	if first[0].Envelope.Subject != "shared" || second[0].Envelope != first[0].Envelope ||
+		second[0].BodyStructure != first[0].BodyStructure {
+		t.Error("the second session did not get the cached envelope and body structure")
+	}
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Misses != 2 || stats.Entries != 2 {
+		t.Errorf("Stats() = %+v, want 2 hits, 2 misses and 2 entries", stats)
+	}
+
+	if err := s1.Expunge(newExpungeWriter(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if stats := cache.Stats(); stats.Entries != 0 || stats.Bytes != 0 {
+		t.Errorf("Stats() after EXPUNGE = %+v, want no entries", stats)
+	}
+}
@@ -1,23 +1,52 @@
 package memserver
 
-import "sync"
+import (
+	"strconv"
+	"sync"
+
+	imap "github.com/meszmate/imap-go"
+)
 
 // UserData holds all mailbox data for a single user.
 type UserData struct {
 	mu        sync.RWMutex
 	Mailboxes map[string]*Mailbox
+
+	// subscriptions are the names of the mailboxes the user is subscribed
+	// to. They are kept apart from Mailboxes because a subscription
+	// outlives the deletion of its mailbox (RFC 9051 section 6.3.7).
+	subscriptions map[string]bool
+
+	// uidValidity is the last UIDVALIDITY assigned to a mailbox. Every
+	// new mailbox gets a higher value, so a mailbox that is deleted and
+	// recreated under the same name never reuses an old UIDVALIDITY.
+	uidValidity uint32
 }
 
-// NewUserData creates a new UserData with a default INBOX.
+// NewUserData creates a new UserData with a default INBOX, to which the
+// user is subscribed.
 func NewUserData() *UserData {
+	u := &UserData{subscriptions: map[string]bool{"INBOX": true}}
 	inbox := NewMailbox("INBOX")
-	inbox.Subscribed = true
-
-	return &UserData{
-		Mailboxes: map[string]*Mailbox{
-			"INBOX": inbox,
-		},
+	inbox.UIDValidity = u.nextUIDValidityLocked()
+	inbox.ID = mailboxID(inbox.UIDValidity)
+	u.Mailboxes = map[string]*Mailbox{
+		"INBOX": inbox,
 	}
+	return u
+}
+
+// nextUIDValidityLocked returns a UIDVALIDITY greater than any previously
+// assigned to a mailbox of this user. Caller must hold the write lock.
+func (u *UserData) nextUIDValidityLocked() uint32 {
+	u.uidValidity++
+	return u.uidValidity
+}
+
+// mailboxID returns the ID of a mailbox created with the given
+// UIDVALIDITY, which is unique among the mailboxes of the user.
+func mailboxID(uidValidity uint32) string {
+	return "M" + strconv.FormatUint(uint64(uidValidity), 10)
 }
 
 // GetMailbox returns the mailbox with the given name.
@@ -31,15 +60,7 @@ func (u *UserData) GetMailbox(name string) *Mailbox {
 // getMailboxLocked returns a mailbox without locking. Caller must hold at least a read lock.
 func (u *UserData) getMailboxLocked(name string) *Mailbox {
 	// INBOX is case-insensitive
-	mbox, ok := u.Mailboxes[name]
-	if ok {
-		return mbox
-	}
-	// Try case-insensitive match for INBOX
-	if normalizeINBOX(name) == "INBOX" {
-		return u.Mailboxes["INBOX"]
-	}
-	return nil
+	return u.Mailboxes[imap.CanonicalMailboxName(name)]
 }
 
 // CreateMailbox creates a new mailbox with the given name.
@@ -51,7 +72,10 @@ func (u *UserData) CreateMailbox(name string) error {
 		return ErrMailboxAlreadyExists
 	}
 
+	name = imap.CanonicalMailboxName(name)
 	mbox := NewMailbox(name)
+	mbox.UIDValidity = u.nextUIDValidityLocked()
+	mbox.ID = mailboxID(mbox.UIDValidity)
 	u.Mailboxes[name] = mbox
 	return nil
 }
@@ -61,7 +85,7 @@ func (u *UserData) DeleteMailbox(name string) error {
 	u.mu.Lock()
 	defer u.mu.Unlock()
 
-	if normalizeINBOX(name) == "INBOX" {
+	if imap.IsInbox(name) {
 		return &IMAPError{Message: "cannot delete INBOX"}
 	}
 
@@ -88,7 +112,8 @@ func (u *UserData) RenameMailbox(oldName, newName string) error {
 	}
 
 	// Remove old entry and add new one
-	delete(u.Mailboxes, oldName)
+	delete(u.Mailboxes, mbox.Name)
+	newName = imap.CanonicalMailboxName(newName)
 	mbox.Name = newName
 	u.Mailboxes[newName] = mbox
 
@@ -107,22 +132,41 @@ func (u *UserData) MailboxNames() []string {
 	return names
 }
 
-// normalizeINBOX normalizes a mailbox name to "INBOX" if it matches case-insensitively.
-func normalizeINBOX(name string) string {
-	if len(name) == 5 {
-		upper := ""
-		for _, c := range name {
-			if c >= 'a' && c <= 'z' {
-				upper += string(c - 32)
-			} else {
-				upper += string(c)
-			}
-		}
-		if upper == "INBOX" {
-			return "INBOX"
+// SetSubscribed subscribes to or unsubscribes from a mailbox name,
+// whether or not the mailbox exists.
+func (u *UserData) SetSubscribed(name string, subscribed bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	name = imap.CanonicalMailboxName(name)
+	if subscribed {
+		if u.subscriptions == nil {
+			u.subscriptions = make(map[string]bool)
 		}
+		u.subscriptions[name] = true
+	} else {
+		delete(u.subscriptions, name)
 	}
-	return name
+}
+
+// IsSubscribed reports whether the user is subscribed to a mailbox name.
+func (u *UserData) IsSubscribed(name string) bool {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.subscriptions[imap.CanonicalMailboxName(name)]
+}
+
+// Subscriptions returns the names of the mailboxes the user is subscribed
+// to, including deleted ones.
+func (u *UserData) Subscriptions() []string {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	names := make([]string, 0, len(u.subscriptions))
+	for name := range u.subscriptions {
+		names = append(names, name)
+	}
+	return names
 }
 
 // IMAPError is a simple error type for IMAP errors.
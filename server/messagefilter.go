@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// MessageFilterFunc inspects a message before it is stored, such as to pass
+// it to a spam filter or a Sieve interpreter. It can add header fields to
+// the message with IncomingMessage.AddHeader, and refuse it by returning a
+// *MessageRejectedError. Any other error fails the APPEND or delivery as a
+// temporary failure.
+//
+// Filters run after the whole message was received and before it is
+// handed to the session or delivery backend, so the header fields they add
+// are part of the message as stored: backends parse the ENVELOPE,
+// BODYSTRUCTURE and header fields searched by SEARCH from the filtered
+// message. Filters run in the order they were given, and each one sees the
+// fields added by the previous ones in IncomingMessage.Header.
+type MessageFilterFunc func(msg *IncomingMessage) error
+
+// WithMessageFilters adds filters run on messages appended with APPEND or
+// MULTIAPPEND, before the session stores them. Messages are read into
+// memory before the filters run. The same filters can be applied to
+// messages delivered over LMTP with delivery.Filtered.
+func WithMessageFilters(filters ...MessageFilterFunc) Option {
+	return func(o *Options) {
+		o.MessageFilters = append(o.MessageFilters, filters...)
+	}
+}
+
+// IncomingMessage is a message passed to MessageFilterFunc.
+type IncomingMessage struct {
+	// User is the user the message is stored for: the authenticated user
+	// for APPEND, the recipient for a delivery.
+	User string
+	// Mailbox is the mailbox the message is stored in.
+	Mailbox string
+	// Header is the header of the message, with the fields added by the
+	// filters that ran before. It is empty if the header is malformed.
+	Header textproto.MIMEHeader
+
+	data  []byte
+	added bytes.Buffer
+}
+
+// Bytes returns the message as it was received, without the fields added
+// by filters. It must not be modified.
+func (m *IncomingMessage) Bytes() []byte {
+	return m.data
+}
+
+// AddHeader adds a header field at the top of the message, as mail
+// transfer agents add trace fields. Fields are stored in the order they
+// were added. CR and LF in value are replaced with spaces. AddHeader
+// panics if key is not a valid field name.
+func (m *IncomingMessage) AddHeader(key, value string) {
+	if !validFieldName(key) {
+		panic(fmt.Sprintf("server: invalid header field name %q", key))
+	}
+	value = strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+	fmt.Fprintf(&m.added, "%s: %s\r\n", key, value)
+	m.Header.Add(key, value)
+}
+
+// validFieldName reports whether key is a header field name: printable
+// US-ASCII characters other than the colon (RFC 5322 section 2.2).
+func validFieldName(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if c := key[i]; c <= ' ' || c >= 0x7f || c == ':' {
+			return false
+		}
+	}
+	return true
+}
+
+// MessageRejectedError is returned by a MessageFilterFunc to refuse a
+// message. APPEND fails with NO [CANNOT], or NO [UNAVAILABLE] if the
+// rejection is temporary, and LMTP replies 550 or 451.
+type MessageRejectedError struct {
+	// Text is the reason sent to the client or mail transfer agent.
+	Text string
+	// Temporary asks the sender to try again later.
+	Temporary bool
+}
+
+// Error implements error.
+func (e *MessageRejectedError) Error() string {
+	return "message rejected: " + e.Text
+}
+
+// FilterMessage runs filters on a message for user and mailbox, and returns
+// the message with the header fields they added, or msg itself if they
+// added none. It returns the first error of a filter.
+func FilterMessage(filters []MessageFilterFunc, user, mailbox string, msg []byte) ([]byte, error) {
+	if len(filters) == 0 {
+		return msg, nil
+	}
+	hdr, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(msg))).ReadMIMEHeader()
+	if hdr == nil || err != nil && !errors.Is(err, io.EOF) {
+		hdr = make(textproto.MIMEHeader)
+	}
+	m := &IncomingMessage{User: user, Mailbox: mailbox, Header: hdr, data: msg}
+	for _, filter := range filters {
+		if err := filter(m); err != nil {
+			return nil, err
+		}
+	}
+	if m.added.Len() == 0 {
+		return msg, nil
+	}
+	return append(m.added.Bytes(), msg...), nil
+}
+
+// FilterAppend runs the server's message filters on a message appended to
+// mailbox, and returns the message to store. Rejections are returned as NO
+// responses. AppendMessage calls it; handlers that store appended messages
+// otherwise, such as MULTIAPPEND, call it for each message.
+func (c *Conn) FilterAppend(mailbox string, msg []byte) ([]byte, error) {
+	msg, err := FilterMessage(c.server.options.MessageFilters, c.Username(), mailbox, msg)
+	var rejected *MessageRejectedError
+	switch {
+	case errors.As(err, &rejected) && rejected.Temporary:
+		return nil, imap.ErrNoWithCode(imap.ResponseCodeUnavailable, rejected.Text)
+	case errors.As(err, &rejected):
+		return nil, imap.ErrNoWithCode(imap.ResponseCodeCannot, rejected.Text)
+	case err != nil:
+		c.logger.Error("message filter failed", "mailbox", mailbox, "error", err)
+		return nil, imap.ErrUnavailable
+	}
+	return msg, nil
+}
+
+// filterLiteral reads a literal appended to mailbox and runs the message
+// filters on it, if the server has any.
+func (c *Conn) filterLiteral(mailbox string, r imap.LiteralReader) (imap.LiteralReader, error) {
+	if len(c.server.options.MessageFilters) == 0 {
+		return r, nil
+	}
+	msg, err := io.ReadAll(r.Reader)
+	if err != nil {
+		return r, err
+	}
+	if msg, err = c.FilterAppend(mailbox, msg); err != nil {
+		return r, err
+	}
+	return imap.LiteralReader{Reader: bytes.NewReader(msg), Size: int64(len(msg))}, nil
+}
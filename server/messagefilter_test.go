@@ -0,0 +1,130 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestFilterMessage(t *testing.T) {
+	msg := []byte("Subject: hello\r\n\r\nbody\r\n")
+	var seen []string
+	filters := []MessageFilterFunc{
+		func(m *IncomingMessage) error {
+			if m.User != "alice" || m.Mailbox != "INBOX" || m.Header.Get("Subject") != "hello" {
+				t.Errorf("first filter got %q %q %v", m.User, m.Mailbox, m.Header)
+			}
+			m.AddHeader("X-Spam-Score", "1.5\r\n")
+			return nil
+		},
+		func(m *IncomingMessage) error {
+			seen = m.Header.Values("X-Spam-Score")
+			m.AddHeader("X-Sieve-Filtered", "yes")
+			return nil
+		},
+	}
+
+	got, err := FilterMessage(filters, "alice", "INBOX", msg)
+	if err != nil {
+		t.Fatalf("FilterMessage() error: %v", err)
+	}
+	want := "X-Spam-Score: 1.5  \r\nX-Sieve-Filtered: yes\r\n" + string(msg)
+	if string(got) != want {
+		t.Errorf("FilterMessage() = %q, want %q", got, want)
+	}
+	if len(seen) != 1 || seen[0] != "1.5  " {
+		t.Errorf("second filter saw X-Spam-Score %q", seen)
+	}
+
+	got, err = FilterMessage([]MessageFilterFunc{func(*IncomingMessage) error { return nil }}, "alice", "INBOX", msg)
+	if err != nil || string(got) != string(msg) {
+		t.Errorf("FilterMessage() without fields = %q, %v", got, err)
+	}
+}
+
+func TestIncomingMessage_AddHeaderInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("AddHeader() with an invalid name did not panic")
+		}
+	}()
+	m := &IncomingMessage{Header: make(map[string][]string)}
+	m.AddHeader("X Spam", "1")
+}
+
+// storingSession is a Session that keeps the appended messages.
+type storingSession struct {
+	Session
+	stored []string
+}
+
+func (s *storingSession) Append(mailbox string, r imap.LiteralReader, options *imap.AppendOptions) (*imap.AppendData, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) != r.Size {
+		return nil, errors.New("size mismatch")
+	}
+	s.stored = append(s.stored, string(b))
+	return &imap.AppendData{UIDValidity: 1, UID: 1}, nil
+}
+
+func TestAppendMessage_Filters(t *testing.T) {
+	filter := func(m *IncomingMessage) error {
+		switch m.Header.Get("Subject") {
+		case "spam":
+			return &MessageRejectedError{Text: "looks like spam"}
+		case "later":
+			return &MessageRejectedError{Text: "filter busy", Temporary: true}
+		case "broken":
+			return errors.New("filter crashed")
+		}
+		m.AddHeader("X-Spam-Score", "0")
+		return nil
+	}
+	sess := &storingSession{}
+	c1, c2 := net.Pipe()
+	t.Cleanup(func() {
+		_ = c1.Close()
+		_ = c2.Close()
+	})
+	srv := New(WithMessageFilters(filter), WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	conn := newConn(c1, srv)
+	conn.session = sess
+	ctx := &CommandContext{Conn: conn, Session: sess, Server: srv}
+
+	options := &imap.AppendOptions{}
+	if _, err := ctx.AppendMessage("INBOX", literal("Subject: ham\r\n\r\nhi\r\n"), options); err != nil {
+		t.Fatalf("AppendMessage() error: %v", err)
+	}
+	want := "X-Spam-Score: 0\r\nSubject: ham\r\n\r\nhi\r\n"
+	if len(sess.stored) != 1 || sess.stored[0] != want {
+		t.Errorf("stored = %q, want %q", sess.stored, want)
+	}
+	if options.SizeHint != int64(len(want)) {
+		t.Errorf("SizeHint = %d, want %d", options.SizeHint, len(want))
+	}
+
+	for _, tt := range []struct {
+		subject string
+		code    imap.ResponseCode
+	}{
+		{"spam", imap.ResponseCodeCannot},
+		{"later", imap.ResponseCodeUnavailable},
+		{"broken", imap.ResponseCodeUnavailable},
+	} {
+		_, err := ctx.AppendMessage("INBOX", literal("Subject: "+tt.subject+"\r\n\r\n"), nil)
+		var imapErr *imap.IMAPError
+		if !errors.As(err, &imapErr) || imapErr.Type != imap.StatusResponseTypeNO || imapErr.Code != tt.code {
+			t.Errorf("AppendMessage(%s) error = %v, want NO [%s]", tt.subject, err, tt.code)
+		}
+	}
+	if len(sess.stored) != 1 {
+		t.Errorf("rejected messages were stored: %q", sess.stored)
+	}
+}
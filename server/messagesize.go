@@ -0,0 +1,101 @@
+package server
+
+import (
+	"io"
+	"sync"
+)
+
+// MessageSizeStore persists the sizes of messages known to a
+// MessageSizer, typically in the database the backend keeps message
+// metadata in, so that they survive restarts.
+type MessageSizeStore interface {
+	// LoadMessageSize returns the size stored for a message, and false if
+	// there is none.
+	LoadMessageSize(key string) (size int64, ok bool, err error)
+	// StoreMessageSize stores the size of a message.
+	StoreMessageSize(key string, size int64) error
+}
+
+// MessageSizer provides the RFC822.SIZE of messages to backends that
+// cannot get it without reading the message, such as those storing
+// messages compressed or remotely. Messages are identified by a key of the
+// backend's choosing, such as the key of their blob.
+//
+// The size of a message is recorded on APPEND with SetSize, from
+// imap.AppendOptions.SizeHint, or else computed the first time it is
+// needed by reading the message through a counter, without holding it in
+// memory. It is then kept in memory and in Store, if set, so that later
+// FETCH commands, and SectionReader sizes for BODY[], do not read the
+// message again.
+//
+// The zero value is ready to use. A MessageSizer is safe for concurrent
+// use; concurrent first requests for the size of a message each read it.
+type MessageSizer struct {
+	// Store persists sizes. If nil, sizes are only kept in memory.
+	Store MessageSizeStore
+
+	mu    sync.Mutex
+	sizes map[string]int64
+}
+
+// SetSize records the size of a message, such as the SizeHint of its
+// APPEND.
+func (s *MessageSizer) SetSize(key string, size int64) error {
+	s.remember(key, size)
+	if s.Store != nil {
+		return s.Store.StoreMessageSize(key, size)
+	}
+	return nil
+}
+
+// Size returns the size of a message. If it is not known, it is computed
+// by reading the message opened with open to its end, and recorded.
+func (s *MessageSizer) Size(key string, open func() (io.ReadCloser, error)) (int64, error) {
+	s.mu.Lock()
+	size, ok := s.sizes[key]
+	s.mu.Unlock()
+	if ok {
+		return size, nil
+	}
+
+	if s.Store != nil {
+		size, ok, err := s.Store.LoadMessageSize(key)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			s.remember(key, size)
+			return size, nil
+		}
+	}
+
+	rc, err := open()
+	if err != nil {
+		return 0, err
+	}
+	size, err = io.Copy(io.Discard, rc)
+	if cerr := rc.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return size, s.SetSize(key, size)
+}
+
+// Forget drops the size of a message from memory, such as once it was
+// expunged. Sizes in Store are left to the backend to delete.
+func (s *MessageSizer) Forget(key string) {
+	s.mu.Lock()
+	delete(s.sizes, key)
+	s.mu.Unlock()
+}
+
+func (s *MessageSizer) remember(key string, size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sizes == nil {
+		s.sizes = make(map[string]int64)
+	}
+	s.sizes[key] = size
+}
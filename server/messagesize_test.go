@@ -0,0 +1,66 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// mapSizeStore is a MessageSizeStore in a map.
+type mapSizeStore map[string]int64
+
+func (m mapSizeStore) LoadMessageSize(key string) (int64, bool, error) {
+	size, ok := m[key]
+	return size, ok, nil
+}
+
+func (m mapSizeStore) StoreMessageSize(key string, size int64) error {
+	m[key] = size
+	return nil
+}
+
+func TestMessageSizer(t *testing.T) {
+	store := mapSizeStore{"stored": 42}
+	s := &MessageSizer{Store: store}
+
+	opens := 0
+	open := func() (io.ReadCloser, error) {
+		opens++
+		return io.NopCloser(strings.NewReader("Subject: hi\r\n\r\nbody\r\n")), nil
+	}
+	for i := 0; i < 2; i++ {
+		size, err := s.Size("computed", open)
+		if err != nil || size != 21 {
+			t.Errorf("Size(computed) = %d, %v; want 21", size, err)
+		}
+	}
+	if opens != 1 {
+		t.Errorf("message read %d times, want once", opens)
+	}
+	if store["computed"] != 21 {
+		t.Errorf("stored size = %d, want 21", store["computed"])
+	}
+
+	if size, err := s.Size("stored", open); err != nil || size != 42 || opens != 1 {
+		t.Errorf("Size(stored) = %d, %v after %d reads; want 42 from the store", size, err, opens)
+	}
+
+	if err := s.SetSize("appended", 7); err != nil {
+		t.Fatalf("SetSize() error: %v", err)
+	}
+	if size, err := s.Size("appended", open); err != nil || size != 7 || opens != 1 {
+		t.Errorf("Size(appended) = %d, %v after %d reads; want 7", size, err, opens)
+	}
+
+	s.Forget("appended")
+	delete(store, "appended")
+	if size, _ := s.Size("appended", open); size != 21 || opens != 2 {
+		t.Errorf("Size() after Forget = %d after %d reads; want 21 read again", size, opens)
+	}
+
+	boom := errors.New("boom")
+	if _, err := s.Size("missing", func() (io.ReadCloser, error) { return nil, boom }); !errors.Is(err, boom) {
+		t.Errorf("Size() error = %v, want the error of open", err)
+	}
+}
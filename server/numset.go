@@ -0,0 +1,41 @@
+package server
+
+import imap "github.com/meszmate/imap-go"
+
+// ParseNumSet reads the message set argument of a command and parses it
+// according to ctx.NumKind: as an *imap.UIDSet for UID commands and as an
+// *imap.SeqSet otherwise. In both, "*" stands for the largest number in
+// use and is kept as 0 in the ranges, to be resolved by the session
+// against the mailbox.
+//
+// Handlers and wrappers must use it rather than parsing the set
+// themselves, so that a command behaves the same whichever extension
+// handles it. Errors are BAD responses naming the kind of set expected.
+// The search result reference "$" (RFC 5182) is not accepted; it is
+// handled by the searchres extension before the command reaches here.
+func ParseNumSet(ctx *CommandContext) (imap.NumSet, error) {
+	what := "sequence set"
+	if ctx.NumKind == NumKindUID {
+		what = "UID set"
+	}
+	if ctx.Decoder == nil {
+		return nil, imap.ErrBad("missing " + what)
+	}
+
+	s, err := ctx.Decoder.ReadSequenceSet()
+	if err != nil {
+		return nil, imap.ErrBad("invalid " + what)
+	}
+	if ctx.NumKind == NumKindUID {
+		uidSet, err := imap.ParseUIDSet(s)
+		if err != nil {
+			return nil, imap.ErrBad("invalid " + what)
+		}
+		return uidSet, nil
+	}
+	seqSet, err := imap.ParseSeqSet(s)
+	if err != nil {
+		return nil, imap.ErrBad("invalid " + what)
+	}
+	return seqSet, nil
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/wire"
+)
+
+func TestParseNumSet(t *testing.T) {
+	tests := []struct {
+		kind    NumKind
+		input   string
+		want    string
+		wantErr string
+	}{
+		{NumKindSeq, "1,3:5 (FLAGS)", "1,3:5", ""},
+		{NumKindSeq, "2:* (FLAGS)", "2:*", ""},
+		{NumKindSeq, "* (FLAGS)", "*", ""},
+		{NumKindUID, "1,3:5 (FLAGS)", "1,3:5", ""},
+		{NumKindUID, "*:4 (FLAGS)", "*:4", ""},
+		{NumKindSeq, "0 (FLAGS)", "", "invalid sequence set"},
+		{NumKindUID, "0 (FLAGS)", "", "invalid UID set"},
+		{NumKindSeq, "$ (FLAGS)", "", "invalid sequence set"},
+		{NumKindUID, "(FLAGS)", "", "invalid UID set"},
+		{NumKindSeq, "1,,2 (FLAGS)", "", "invalid sequence set"},
+	}
+	for _, tt := range tests {
+		ctx := &CommandContext{NumKind: tt.kind, Decoder: wire.NewDecoder(strings.NewReader(tt.input))}
+		set, err := ParseNumSet(ctx)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseNumSet(%v, %q) error = %v, want %q", tt.kind, tt.input, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseNumSet(%v, %q) error: %v", tt.kind, tt.input, err)
+			continue
+		}
+		if got := set.String(); got != tt.want {
+			t.Errorf("ParseNumSet(%v, %q) = %q, want %q", tt.kind, tt.input, got, tt.want)
+		}
+		_, isUID := set.(*imap.UIDSet)
+		if isUID != (tt.kind == NumKindUID) {
+			t.Errorf("ParseNumSet(%v, %q) = %T", tt.kind, tt.input, set)
+		}
+		// The rest of the arguments is left to the handler.
+		if err := ctx.Decoder.ReadSP(); err != nil {
+			t.Errorf("ParseNumSet(%v, %q) consumed the separator", tt.kind, tt.input)
+		}
+	}
+}
+
+func TestParseNumSet_NoDecoder(t *testing.T) {
+	if _, err := ParseNumSet(&CommandContext{NumKind: NumKindUID}); err == nil || !strings.Contains(err.Error(), "missing UID set") {
+		t.Errorf("ParseNumSet() error = %v, want missing UID set", err)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/extension"
+	"github.com/meszmate/imap-go/wire"
 )
 
 // Option is a functional option for configuring the server.
@@ -16,6 +18,12 @@ type Options struct {
 	// TLSConfig is the TLS configuration for implicit TLS connections.
 	TLSConfig *tls.Config
 
+	// ALPNProtocols are the ALPN protocol identifiers (RFC 7301) IMAP is
+	// served for on implicit TLS connections, such as ALPNProtocol. If
+	// set, connections that negotiated another protocol are closed after
+	// the TLS handshake, without a greeting. See WithALPN.
+	ALPNProtocols []string
+
 	// Caps is the set of capabilities to advertise.
 	Caps *imap.CapSet
 
@@ -27,25 +35,68 @@ type Options struct {
 	NewSession func(conn *Conn) (Session, error)
 
 	// MaxLiteralSize is the maximum size of a literal that the server will accept.
-	// 0 means no limit.
+	// APPEND rejects larger messages with NO [TOOBIG], before the client
+	// sends a synchronizing literal. 0 means no limit.
 	MaxLiteralSize int64
 
-	// ReadTimeout is the timeout for reading a single command.
+	// ReadTimeout is the time allowed to receive the rest of a command
+	// line once its first byte arrived, and each line a command reads
+	// from the client, such as AUTHENTICATE responses. Waiting for the
+	// next command is bounded by the autologout timer instead. 0 means no
+	// limit.
 	ReadTimeout time.Duration
 
-	// WriteTimeout is the timeout for writing a response.
+	// WriteTimeout is the time allowed for each write to the connection.
+	// It bounds how long a client that stopped reading can stall the
+	// server, not the time taken by a command: a long FETCH is not
+	// interrupted as long as the client keeps reading. The connection is
+	// closed when a write times out. 0 means no limit.
 	WriteTimeout time.Duration
 
-	// IdleTimeout is the timeout for IDLE commands.
+	// LiteralTimeout is the time allowed without receiving any data of a
+	// literal being uploaded, so that slow uploads make progress while
+	// stalled ones fail. 0 means no limit.
+	LiteralTimeout time.Duration
+
+	// IdleTimeout is the maximum duration of an IDLE command, after which
+	// the server sends BYE and closes the connection. Clients are
+	// expected to restart IDLE at least every 29 minutes (RFC 2177). 0
+	// means no limit.
 	IdleTimeout time.Duration
 
+	// AutologoutPreAuth and AutologoutPostAuth are the inactivity timers
+	// before and after authentication, see WithAutologout.
+	AutologoutPreAuth  time.Duration
+	AutologoutPostAuth time.Duration
+
 	// MaxConnections is the maximum number of concurrent connections.
 	// 0 means no limit.
 	MaxConnections int
 
-	// GreetingText is the text sent in the initial greeting.
+	// HiddenCaps are capabilities that are not advertised, even if they
+	// are in Caps or added by extensions. See WithoutCapabilities.
+	HiddenCaps []imap.Cap
+
+	// ContinuationDelay delays every continuation request, emulating a
+	// slow or distant server. It is meant for testing clients.
+	ContinuationDelay time.Duration
+
+	// Greeting is the initial greeting of connections. See WithGreeting.
+	Greeting Greeting
+
+	// GreetingFunc, if set, chooses the greeting of each connection
+	// instead of Greeting. See WithGreetingFunc.
+	GreetingFunc GreetingFunc
+
+	// GreetingText is the text of greetings without a text.
 	GreetingText string
 
+	// GreetingCapabilities includes a CAPABILITY response code with the
+	// capabilities of the connection's initial state in OK and PREAUTH
+	// greetings, so that clients can skip the CAPABILITY command. Enabled
+	// by default.
+	GreetingCapabilities bool
+
 	// AllowInsecureAuth allows authentication without TLS.
 	AllowInsecureAuth bool
 
@@ -54,17 +105,128 @@ type Options struct {
 
 	// InsecureSkipVerify disables TLS certificate verification (for testing).
 	InsecureSkipVerify bool
+
+	// MailboxNameValidator validates and normalizes mailbox names on
+	// CREATE, RENAME, SELECT and EXAMINE. If nil,
+	// DefaultMailboxNameValidator is used.
+	MailboxNameValidator MailboxNameValidator
+
+	// AutoCreateOnAppend lists mailbox name patterns that APPEND may
+	// create when the target mailbox does not exist. '*' in a pattern
+	// matches any sequence of characters.
+	AutoCreateOnAppend []string
+
+	// AutoCreateLimit is the maximum number of mailboxes a single
+	// connection may create through AutoCreateOnAppend. 0 means
+	// DefaultAutoCreateLimit.
+	AutoCreateLimit int
+
+	// FetchMemoryBudget is the number of bytes a connection may use to
+	// buffer FETCH responses in memory. Responses that do not fit are
+	// spooled to a temporary file in SpoolDir and streamed from there.
+	// 0 means FETCH responses are written straight to the connection.
+	FetchMemoryBudget int64
+
+	// SpoolDir is the directory for spooled FETCH responses. If empty,
+	// os.TempDir is used.
+	SpoolDir string
+
+	// WriteFairness, if set, shares the server's output fairly between
+	// connections. See WithWriteFairness.
+	WriteFairness *WriteFairness
+
+	// LiteralProgress is called as literal data of commands such as
+	// APPEND is received, so that uploads can be monitored or throttled.
+	LiteralProgress LiteralProgressFunc
+
+	// LiteralKeepalive is the interval at which a continuation request
+	// with LiteralKeepaliveText is sent while a literal is uploaded, to
+	// keep proxies with idle timeouts from dropping the connection. 0
+	// disables keepalives.
+	LiteralKeepalive time.Duration
+
+	// SearchLimits bounds the size of SEARCH, SORT and THREAD results and
+	// the complexity of search criteria.
+	SearchLimits SearchLimits
+
+	// ListLimits bounds the number and length of LIST and LSUB patterns.
+	ListLimits ListLimits
+
+	// CommandLimits bounds the length of command tags and lines and the
+	// number of command arguments.
+	CommandLimits CommandLimits
+
+	// Translator localizes the human-readable text of NO, BAD and BYE
+	// responses and of ALERT response codes. If nil, text is sent as is.
+	Translator Translator
+
+	// ResponseCodes controls when RFC 5530 response codes such as
+	// CLIENTBUG, SERVERBUG and LIMIT are added to responses.
+	ResponseCodes ResponseCodePolicy
+
+	// ProtocolErrors controls the history of protocol errors kept per
+	// connection and when a connection is closed for them.
+	ProtocolErrors ProtocolErrorPolicy
+
+	// MailboxAccess restricts the mailboxes each user can see and use.
+	// If nil, access is left to the session.
+	MailboxAccess *MailboxAccessPolicy
+
+	// AuthProvider, if set, checks the credentials of LOGIN and of the
+	// PLAIN, LOGIN, OAUTHBEARER and XOAUTH2 mechanisms instead of the
+	// session, and authorizes access to mailboxes. See WithAuthProvider.
+	AuthProvider AuthProvider
+
+	// WireTrace receives the raw data read from and written to each
+	// connection, after TLS decryption, for protocol tracing. See
+	// WithWireTrace.
+	WireTrace WireTraceFunc
+
+	// MessageFilters run on messages appended by clients before the
+	// session stores them. See WithMessageFilters.
+	MessageFilters []MessageFilterFunc
+
+	// OnConnClose is called when a connection was closed, after its
+	// session. See WithOnConnClose.
+	OnConnClose func(conn *Conn)
+
+	// Extensions are the server extensions to install. Their command
+	// handlers and wrappers are applied on top of the built-in handlers.
+	Extensions []extension.ServerExtension
+
+	// SelfTestAccount is the account Server.SelfTest logs in to. See
+	// WithSelfTestAccount.
+	SelfTestAccount *SelfTestAccount
+
+	// StrictExtensions makes Serve fail if the handlers installed by
+	// Extensions conflict, see Server.ExtensionConflicts. Otherwise
+	// conflicts are only logged.
+	StrictExtensions bool
+
+	// DisabledExtensions are the names of Extensions that are installed
+	// but disabled, see Server.SetExtensionEnabled.
+	DisabledExtensions []string
+
+	// UnknownCommandHandler handles commands without a registered
+	// handler. If nil, they fail with BAD. See WithUnknownCommandHandler.
+	UnknownCommandHandler CommandHandler
 }
 
 // DefaultOptions returns Options with sensible defaults.
 func DefaultOptions() *Options {
 	return &Options{
-		Caps:         NewDefaultCapSet(),
-		Logger:       slog.Default(),
-		ReadTimeout:  30 * time.Minute,
-		WriteTimeout: 1 * time.Minute,
-		IdleTimeout:  30 * time.Minute,
-		GreetingText: "IMAP server ready",
+		Caps:           NewDefaultCapSet(),
+		Logger:         slog.Default(),
+		ReadTimeout:    1 * time.Minute,
+		WriteTimeout:   1 * time.Minute,
+		LiteralTimeout: 1 * time.Minute,
+		IdleTimeout:    30 * time.Minute,
+		GreetingText:   "IMAP server ready",
+
+		GreetingCapabilities: true,
+
+		AutologoutPreAuth:  DefaultAutologoutPreAuth,
+		AutologoutPostAuth: MinAutologoutPostAuth,
 	}
 }
 
@@ -105,21 +267,30 @@ func WithMaxLiteralSize(size int64) Option {
 	}
 }
 
-// WithReadTimeout sets the read timeout.
+// WithReadTimeout sets the command read timeout, see Options.ReadTimeout.
 func WithReadTimeout(d time.Duration) Option {
 	return func(o *Options) {
 		o.ReadTimeout = d
 	}
 }
 
-// WithWriteTimeout sets the write timeout.
+// WithWriteTimeout sets the write timeout, see Options.WriteTimeout.
 func WithWriteTimeout(d time.Duration) Option {
 	return func(o *Options) {
 		o.WriteTimeout = d
 	}
 }
 
-// WithIdleTimeout sets the IDLE timeout.
+// WithLiteralTimeout sets the literal progress timeout, see
+// Options.LiteralTimeout.
+func WithLiteralTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.LiteralTimeout = d
+	}
+}
+
+// WithIdleTimeout sets the maximum duration of IDLE, see
+// Options.IdleTimeout.
 func WithIdleTimeout(d time.Duration) Option {
 	return func(o *Options) {
 		o.IdleTimeout = d
@@ -140,13 +311,42 @@ func WithCapabilities(caps ...imap.Cap) Option {
 	}
 }
 
+// WithoutCapabilities stops advertising capabilities, whether they are
+// defaults, added with WithCapabilities or added by extensions. The
+// commands of the capabilities are still handled, which lets tests
+// exercise the fallbacks of clients for servers lacking them.
+func WithoutCapabilities(caps ...imap.Cap) Option {
+	return func(o *Options) {
+		o.HiddenCaps = append(o.HiddenCaps, caps...)
+	}
+}
+
+// WithContinuationDelay sets the delay of continuation requests, see
+// Options.ContinuationDelay.
+func WithContinuationDelay(d time.Duration) Option {
+	return func(o *Options) {
+		o.ContinuationDelay = d
+	}
+}
+
 // WithGreetingText sets the greeting text.
+//
+// Deprecated: Use WithGreeting, which also sets the type and response
+// code of the greeting.
 func WithGreetingText(text string) Option {
 	return func(o *Options) {
 		o.GreetingText = text
 	}
 }
 
+// WithGreetingCapabilities sets whether the greeting includes the
+// capabilities, see Options.GreetingCapabilities.
+func WithGreetingCapabilities(enabled bool) Option {
+	return func(o *Options) {
+		o.GreetingCapabilities = enabled
+	}
+}
+
 // WithAllowInsecureAuth allows authentication without TLS.
 func WithAllowInsecureAuth(allow bool) Option {
 	return func(o *Options) {
@@ -154,6 +354,18 @@ func WithAllowInsecureAuth(allow bool) Option {
 	}
 }
 
+// WithALPN serves IMAP on implicit TLS connections only for the given
+// ALPN protocol identifiers, ALPNProtocol if none are given. See
+// Options.ALPNProtocols.
+func WithALPN(protocols ...string) Option {
+	return func(o *Options) {
+		if len(protocols) == 0 {
+			protocols = []string{ALPNProtocol}
+		}
+		o.ALPNProtocols = protocols
+	}
+}
+
 // WithStartTLS enables STARTTLS support with the given TLS config.
 func WithStartTLS(config *tls.Config) Option {
 	return func(o *Options) {
@@ -163,3 +375,139 @@ func WithStartTLS(config *tls.Config) Option {
 		}
 	}
 }
+
+// WithMailboxNameValidator sets the mailbox name validator.
+func WithMailboxNameValidator(v MailboxNameValidator) Option {
+	return func(o *Options) {
+		o.MailboxNameValidator = v
+	}
+}
+
+// WithExtensions installs server extensions.
+func WithExtensions(exts ...extension.ServerExtension) Option {
+	return func(o *Options) {
+		o.Extensions = append(o.Extensions, exts...)
+	}
+}
+
+// WithDisabledExtensions installs the named extensions of WithExtensions
+// disabled, so that they can be enabled at runtime with
+// Server.SetExtensionEnabled.
+func WithDisabledExtensions(names ...string) Option {
+	return func(o *Options) {
+		o.DisabledExtensions = append(o.DisabledExtensions, names...)
+	}
+}
+
+// WithStrictExtensions makes Serve fail if the installed extensions wrap a
+// command in ways that conflict, instead of only logging the conflicts.
+func WithStrictExtensions() Option {
+	return func(o *Options) {
+		o.StrictExtensions = true
+	}
+}
+
+// WithAutoCreateOnAppend makes APPEND create mailboxes matching one of the
+// patterns instead of failing with TRYCREATE, e.g. "Sent", "Drafts" or
+// "Archive/*". In patterns, '*' and '%' match any characters.
+func WithAutoCreateOnAppend(patterns ...string) Option {
+	return func(o *Options) {
+		o.AutoCreateOnAppend = append(o.AutoCreateOnAppend, patterns...)
+	}
+}
+
+// WithFetchMemoryBudget sets the per-connection memory budget for FETCH
+// responses and the directory responses beyond it are spooled to.
+func WithFetchMemoryBudget(budget int64, spoolDir string) Option {
+	return func(o *Options) {
+		o.FetchMemoryBudget = budget
+		o.SpoolDir = spoolDir
+	}
+}
+
+// WithWriteFairness makes connections take turns writing large
+// responses, so that a connection streaming a multi-gigabyte FETCH cannot
+// starve the others. See WriteFairness; its zero value uses the defaults.
+func WithWriteFairness(f WriteFairness) Option {
+	return func(o *Options) {
+		o.WriteFairness = &f
+	}
+}
+
+// WithTranslator sets the translator for user-visible response text.
+func WithTranslator(t Translator) Option {
+	return func(o *Options) {
+		o.Translator = t
+	}
+}
+
+// WithLiteralProgress sets the callback that reports literal upload
+// progress.
+func WithLiteralProgress(fn LiteralProgressFunc) Option {
+	return func(o *Options) {
+		o.LiteralProgress = fn
+	}
+}
+
+// WithLiteralKeepalive sets the interval of keepalives sent during literal
+// uploads.
+func WithLiteralKeepalive(d time.Duration) Option {
+	return func(o *Options) {
+		o.LiteralKeepalive = d
+	}
+}
+
+// WireTraceFunc receives the data read from or written to a connection.
+// It is called from the goroutines serving the connection, so it must not
+// block, and data must not be retained after it returns.
+type WireTraceFunc func(conn *Conn, dir wire.Direction, data []byte)
+
+// WithWireTrace sets a callback that receives all protocol data exchanged
+// with clients, such as a debug writer or a packet capture sink. Data is
+// traced as it is read or flushed, in chunks that do not follow line
+// boundaries, and includes credentials sent with LOGIN or AUTHENTICATE.
+func WithWireTrace(fn WireTraceFunc) Option {
+	return func(o *Options) {
+		o.WireTrace = fn
+	}
+}
+
+// WithOnConnClose sets a function called when a connection served by the
+// server was closed, such as to flush data collected per connection with
+// WithWireTrace.
+func WithOnConnClose(fn func(conn *Conn)) Option {
+	return func(o *Options) {
+		o.OnConnClose = fn
+	}
+}
+
+// WithMailboxAccessPolicy restricts the mailboxes users can see in LIST
+// and use in other commands, before the session is called.
+func WithMailboxAccessPolicy(p *MailboxAccessPolicy) Option {
+	return func(o *Options) {
+		o.MailboxAccess = p
+	}
+}
+
+// WithAuthProvider authenticates users and authorizes their access to
+// mailboxes with p instead of the session. Once p has authenticated a
+// user, the session is logged in with SessionLoginIdentity if it
+// implements it, or with Login otherwise.
+func WithAuthProvider(p AuthProvider) Option {
+	return func(o *Options) {
+		o.AuthProvider = p
+	}
+}
+
+// WithUnknownCommandHandler sets the handler for commands that have no
+// registered handler, instead of answering them with BAD. It receives the
+// raw command line in CommandContext.Line and the arguments in Decoder,
+// which allows a proxy to forward commands of extensions it does not know
+// upstream, or private extensions to be tried without registering them.
+// Commands with the UID prefix that RFC 9051 and the known extensions do
+// not define are passed to it as well, with NumKind set to NumKindUID.
+func WithUnknownCommandHandler(h CommandHandler) Option {
+	return func(o *Options) {
+		o.UnknownCommandHandler = h
+	}
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultProtocolErrorHistory is the number of protocol errors kept per
+// connection if ProtocolErrorPolicy.History is 0.
+const DefaultProtocolErrorHistory = 16
+
+// errTooManyProtocolErrors ends a connection closed for
+// ProtocolErrorPolicy.MaxConsecutive.
+var errTooManyProtocolErrors = errors.New("too many protocol errors")
+
+// ProtocolErrorPolicy controls the history of protocol errors kept for
+// each connection, see Conn.ProtocolErrors, and when a connection is
+// closed for them. The zero value keeps DefaultProtocolErrorHistory
+// errors and never closes connections.
+type ProtocolErrorPolicy struct {
+	// History is the number of recent protocol errors kept per
+	// connection. 0 means DefaultProtocolErrorHistory; a negative value
+	// keeps none.
+	History int
+
+	// MaxConsecutive is the number of consecutive BAD responses after
+	// which the connection is closed with a BYE response summarizing
+	// them, for clients that keep sending commands the server does not
+	// understand. A successful command resets the count. 0 disables it.
+	MaxConsecutive int
+}
+
+// WithProtocolErrorPolicy sets the policy for protocol errors.
+func WithProtocolErrorPolicy(policy ProtocolErrorPolicy) Option {
+	return func(o *Options) {
+		o.ProtocolErrors = policy
+	}
+}
+
+// ProtocolError is a protocol error of a client: a BAD response sent on a
+// connection, for a command line that could not be parsed, an unknown
+// command or invalid arguments.
+type ProtocolError struct {
+	// Time is when the BAD response was sent.
+	Time time.Time
+	// Tag is the tag of the command, or "*" for a line whose tag could
+	// not be parsed.
+	Tag string
+	// Command is the name of the command being handled, or empty.
+	Command string
+	// Text is the text of the BAD response, before translation.
+	Text string
+}
+
+// String returns the command and text of the error, such as
+// "FETCH: Invalid sequence set".
+func (e ProtocolError) String() string {
+	if e.Command == "" {
+		return e.Text
+	}
+	return e.Command + ": " + e.Text
+}
+
+// protocolErrorLog is a bounded history of protocol errors.
+type protocolErrorLog struct {
+	mu   sync.Mutex
+	errs []ProtocolError
+	// next is the index of the oldest error once errs is full.
+	next int
+}
+
+// add records err, keeping at most size errors.
+func (l *protocolErrorLog) add(err ProtocolError, size int) {
+	if size <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.errs) < size {
+		l.errs = append(l.errs, err)
+		return
+	}
+	l.errs[l.next] = err
+	l.next = (l.next + 1) % len(l.errs)
+}
+
+// all returns the recorded errors, oldest first.
+func (l *protocolErrorLog) all() []ProtocolError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	errs := make([]ProtocolError, 0, len(l.errs))
+	errs = append(errs, l.errs[l.next:]...)
+	return append(errs, l.errs[:l.next]...)
+}
+
+// ProtocolErrors returns the recent protocol errors of the connection,
+// oldest first: at most ProtocolErrorPolicy.History of the BAD responses
+// sent on it. Middleware can use them to tell a client that keeps
+// repeating the same mistake from one that sends the odd bad command.
+func (c *Conn) ProtocolErrors() []ProtocolError {
+	return c.protocolErrors.all()
+}
+
+// recordProtocolError adds a BAD response to the history of the
+// connection.
+func (c *Conn) recordProtocolError(tag, text string) {
+	size := c.server.options.ProtocolErrors.History
+	if size == 0 {
+		size = DefaultProtocolErrorHistory
+	}
+	var command string
+	if tag != "*" {
+		command = string(c.currentAction())
+	}
+	c.protocolErrors.add(ProtocolError{Time: time.Now(), Tag: tag, Command: command, Text: text}, size)
+}
+
+// checkProtocolErrors closes the connection if it reached
+// ProtocolErrorPolicy.MaxConsecutive, with a BYE response summarizing the
+// errors, and returns errTooManyProtocolErrors.
+func (c *Conn) checkProtocolErrors() error {
+	limit := c.server.options.ProtocolErrors.MaxConsecutive
+	n := int(c.badResponses.Load())
+	if limit <= 0 || n < limit {
+		return nil
+	}
+
+	errs := c.ProtocolErrors()
+	if len(errs) > n {
+		errs = errs[len(errs)-n:]
+	}
+	summary := summarizeProtocolErrors(errs)
+	c.logger.Warn("closing connection for protocol errors", "count", n, "errors", summary)
+	c.writeFinalBYE(fmt.Sprintf("Too many protocol errors (%d): %s", n, summary))
+	return errTooManyProtocolErrors
+}
+
+// summarizeProtocolErrors describes errs briefly, for a BYE response: the
+// three most recent distinct errors, with their number of occurrences.
+func summarizeProtocolErrors(errs []ProtocolError) string {
+	const maxShown = 3
+	var order []string
+	counts := make(map[string]int)
+	for i := len(errs) - 1; i >= 0; i-- {
+		s := errs[i].String()
+		if counts[s] == 0 {
+			order = append(order, s)
+		}
+		counts[s]++
+	}
+	if len(order) == 0 {
+		return "no details"
+	}
+
+	parts := make([]string, 0, maxShown+1)
+	for i, s := range order {
+		if i == maxShown {
+			parts = append(parts, "...")
+			break
+		}
+		if counts[s] > 1 {
+			s = fmt.Sprintf("%s (x%d)", s, counts[s])
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestConn_ProtocolErrors(t *testing.T) {
+	srv := New(WithProtocolErrorPolicy(ProtocolErrorPolicy{History: 2}))
+	srv.dispatcher.RegisterFunc("XOK", func(ctx *CommandContext) error {
+		ctx.Conn.WriteOK(ctx.Tag, "done")
+		return nil
+	})
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	conn := newConn(c1, srv)
+	go io.Copy(io.Discard, c2)
+
+	_ = srv.dispatch(conn, "A1", "XBOGUS", "")
+	_ = srv.dispatch(conn, "A2", "UID", "XBOGUS 1")
+	_ = srv.dispatch(conn, "A3", "XOK", "")
+	_ = srv.dispatch(conn, "A4", "XOTHER", "")
+
+	errs := conn.ProtocolErrors()
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Tag+" "+e.String())
+	}
+	want := []string{"A2 XBOGUS: UID XBOGUS is not a valid command", "A4 XOTHER: unknown command XOTHER"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("ProtocolErrors() = %q, want %q", got, want)
+	}
+}
+
+func TestServer_MaxProtocolErrors(t *testing.T) {
+	srv := New(
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithProtocolErrorPolicy(ProtocolErrorPolicy{MaxConsecutive: 4}),
+	)
+	srv.dispatcher.RegisterFunc("XOK", func(ctx *CommandContext) error {
+		ctx.Conn.WriteOK(ctx.Tag, "done")
+		return nil
+	})
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	go srv.handleConn(c1)
+
+	r := bufio.NewReader(c2)
+	if _, err := r.ReadString('\n'); err != nil {
+		t.Fatalf("greeting: %v", err)
+	}
+	// The successful command resets the count.
+	for i, cmd := range []string{"XBOGUS", "XBOGUS", "XBOGUS", "XOK", "XBOGUS", "XBOGUS", "XBOGUS", "XOTHER"} {
+		fmt.Fprintf(c2, "A%d %s\r\n", i, cmd)
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("%s: %v", cmd, err)
+		}
+		if i < 7 && strings.HasPrefix(line, "* BYE") {
+			t.Fatalf("connection closed after %s: %q", cmd, line)
+		}
+		if i == 7 {
+			bye, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("no BYE after %s: %v", cmd, err)
+			}
+			want := "* BYE Too many protocol errors (4): XOTHER: unknown command XOTHER; XBOGUS: unknown command XBOGUS (x3)\r\n"
+			if bye != want {
+				t.Errorf("BYE = %q, want %q", bye, want)
+			}
+			if _, err := r.ReadString('\n'); err == nil {
+				t.Error("connection not closed after BYE")
+			}
+			return
+		}
+	}
+}
+
+func TestSummarizeProtocolErrors(t *testing.T) {
+	var errs []ProtocolError
+	for _, cmd := range []string{"A", "B", "C", "D", "D"} {
+		errs = append(errs, ProtocolError{Command: cmd, Text: "bad"})
+	}
+	errs = append(errs, ProtocolError{Tag: "*", Text: "invalid tag"})
+	if got, want := summarizeProtocolErrors(errs), "invalid tag; D: bad (x2); C: bad; ..."; got != want {
+		t.Errorf("summarizeProtocolErrors() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	imap "github.com/meszmate/imap-go"
+)
+
+// ResponseCodePolicy controls when the server adds RFC 5530 response codes
+// that command handlers do not set themselves. The zero value adds none.
+//
+// Backends do not need a policy to send codes for their own errors: an
+// error that is or wraps an *imap.IMAPError, such as imap.ErrNonExistent
+// or imap.ErrOverQuota, is always sent with its code.
+type ResponseCodePolicy struct {
+	// ClientBugThreshold is the number of consecutive BAD responses on a
+	// connection after which further BAD responses carry the CLIENTBUG
+	// code, to point out a client that keeps sending malformed commands.
+	// A successful command resets the count. 0 disables CLIENTBUG.
+	ClientBugThreshold int
+
+	// ServerBug reports handler errors that are not IMAP errors as
+	// NO [SERVERBUG] instead of a plain NO.
+	ServerBug bool
+
+	// Limit reports configured limits with the LIMIT code: connections
+	// beyond Options.MaxConnections get BYE [LIMIT] instead of being
+	// closed silently, and APPEND fails with NO [LIMIT] once a connection
+	// has reached Options.AutoCreateLimit.
+	Limit bool
+}
+
+// WithResponseCodePolicy sets the policy for adding RFC 5530 response
+// codes.
+func WithResponseCodePolicy(policy ResponseCodePolicy) Option {
+	return func(o *Options) {
+		o.ResponseCodes = policy
+	}
+}
+
+// applyResponseCodePolicy returns the response code to send with a status
+// response and updates the connection's count of consecutive BAD
+// responses.
+func (c *Conn) applyResponseCodePolicy(tag string, typ imap.StatusResponseType, code imap.ResponseCode) imap.ResponseCode {
+	if tag == "*" && typ != imap.StatusResponseTypeBAD {
+		return code
+	}
+
+	switch typ {
+	case imap.StatusResponseTypeBAD:
+		n := c.badResponses.Add(1)
+		threshold := c.server.options.ResponseCodes.ClientBugThreshold
+		if code == "" && threshold > 0 && int(n) > threshold {
+			return imap.ResponseCodeClientBug
+		}
+	case imap.StatusResponseTypeOK:
+		c.badResponses.Store(0)
+	}
+	return code
+}
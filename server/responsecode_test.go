@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestDispatch_ResponseCodes(t *testing.T) {
+	srv := New(WithResponseCodePolicy(ResponseCodePolicy{
+		ClientBugThreshold: 2,
+		ServerBug:          true,
+	}))
+	srv.dispatcher.RegisterFunc("XNONEXISTENT", func(ctx *CommandContext) error {
+		return fmt.Errorf("backend: %w", imap.ErrNonExistent)
+	})
+	srv.dispatcher.RegisterFunc("XFAIL", func(ctx *CommandContext) error {
+		return errors.New("disk on fire")
+	})
+	srv.dispatcher.RegisterFunc("XOK", func(ctx *CommandContext) error {
+		ctx.Conn.WriteOK(ctx.Tag, "done")
+		return nil
+	})
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	conn := newConn(c1, srv)
+
+	go func() {
+		for _, cmd := range []string{"XNONEXISTENT", "XFAIL", "XBOGUS", "XBOGUS", "XBOGUS", "XOK", "XBOGUS"} {
+			_ = srv.dispatch(conn, "A1", cmd, "")
+		}
+	}()
+
+	r := bufio.NewReader(c2)
+	for _, want := range []string{
+		"A1 NO [NONEXISTENT] no such mailbox\r\n",
+		"A1 NO [SERVERBUG] internal server error\r\n",
+		"A1 BAD unknown command XBOGUS\r\n",
+		"A1 BAD unknown command XBOGUS\r\n",
+		"A1 BAD [CLIENTBUG] unknown command XBOGUS\r\n",
+		"A1 OK done\r\n",
+		"A1 BAD unknown command XBOGUS\r\n",
+	} {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString() error: %v", err)
+		}
+		if line != want {
+			t.Errorf("got %q, want %q", line, want)
+		}
+	}
+}
+
+func TestDispatch_ResponseCodesDisabled(t *testing.T) {
+	srv := New()
+	srv.dispatcher.RegisterFunc("XFAIL", func(ctx *CommandContext) error {
+		return errors.New("disk on fire")
+	})
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	conn := newConn(c1, srv)
+
+	go func() {
+		for i := 0; i < 5; i++ {
+			_ = srv.dispatch(conn, "A1", "XBOGUS", "")
+		}
+		_ = srv.dispatch(conn, "A1", "XFAIL", "")
+	}()
+
+	r := bufio.NewReader(c2)
+	for i := 0; i < 6; i++ {
+		want := "A1 BAD unknown command XBOGUS\r\n"
+		if i == 5 {
+			want = "A1 NO internal server error\r\n"
+		}
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString() error: %v", err)
+		}
+		if line != want {
+			t.Errorf("got %q, want %q", line, want)
+		}
+	}
+}
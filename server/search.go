@@ -0,0 +1,525 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/wire"
+)
+
+// searchDateLayout is the date format used by date search keys.
+const searchDateLayout = "2-Jan-2006"
+
+// SearchKeyHook parses a search key that the built-in grammar does not know
+// or that an extension needs to intercept. It is called with the key atom
+// already read and returns false if it did not handle the key.
+type SearchKeyHook func(p *SearchParser, key string, dec *wire.Decoder, criteria *imap.SearchCriteria) (bool, error)
+
+// SearchParser parses SEARCH criteria (RFC 3501 section 6.4.4) including
+// the MODSEQ (RFC 7162), SAVEDATE (RFC 8514) and WITHIN (RFC 5032) keys.
+// Errors are returned as *imap.IMAPError values that can be sent to the
+// client as-is.
+//
+// The zero value is ready to use. Extensions that add search keys set Hook;
+// the hook is also consulted for keys nested in NOT, OR and parentheses.
+type SearchParser struct {
+	Hook SearchKeyHook
+}
+
+// ParseSearch parses a complete search program using the built-in grammar.
+// See SearchParser.Parse.
+func ParseSearch(dec *wire.Decoder) (*imap.SearchCriteria, error) {
+	var p SearchParser
+	return p.Parse(dec)
+}
+
+// ParseSearchFrom parses a search program whose first atom has already been
+// read using the built-in grammar. See SearchParser.ParseFrom.
+func ParseSearchFrom(first string, dec *wire.Decoder) (*imap.SearchCriteria, error) {
+	var p SearchParser
+	return p.ParseFrom(first, dec)
+}
+
+// ReadSearchToken reads the first token of a search program so that the
+// caller can check for a RETURN option. It returns an empty string if the
+// program starts with a parenthesized key list, which is left unread.
+func ReadSearchToken(dec *wire.Decoder) (string, error) {
+	if dec == nil {
+		return "", imap.ErrBad("missing search criteria")
+	}
+	b, err := dec.PeekByte()
+	if err != nil {
+		return "", imap.ErrBad("missing search criteria")
+	}
+	if b == '(' {
+		return "", nil
+	}
+	tok, err := ReadSearchAtom(dec)
+	if err != nil {
+		return "", searchSyntaxError(err)
+	}
+	return tok, nil
+}
+
+// Parse reads an optional CHARSET specification followed by one or more
+// search keys separated by spaces, up to the end of the input.
+func (p *SearchParser) Parse(dec *wire.Decoder) (*imap.SearchCriteria, error) {
+	return p.ParseFrom("", dec)
+}
+
+// ParseFrom is like Parse, but for callers that have already read the first
+// atom of the search program, for example to check for a RETURN option.
+// An empty first means nothing has been read.
+func (p *SearchParser) ParseFrom(first string, dec *wire.Decoder) (*imap.SearchCriteria, error) {
+	if dec == nil {
+		return nil, imap.ErrBad("missing search criteria")
+	}
+
+	if first == "" {
+		tok, err := ReadSearchToken(dec)
+		if err != nil {
+			return nil, err
+		}
+		first = tok
+	}
+
+	if strings.EqualFold(first, "CHARSET") {
+		if err := dec.ReadSP(); err != nil {
+			return nil, imap.ErrBad("missing charset")
+		}
+		if err := readSearchCharset(dec); err != nil {
+			return nil, err
+		}
+		first = ""
+	}
+
+	criteria := &imap.SearchCriteria{}
+	if first != "" {
+		if err := p.ParseKey(first, dec, criteria); err != nil {
+			return nil, err
+		}
+		if !readOptionalSP(dec) {
+			return criteria, p.expectEnd(dec)
+		}
+	}
+	if first == "" {
+		if _, err := dec.PeekByte(); err != nil {
+			return nil, imap.ErrBad("missing search criteria")
+		}
+	}
+	if err := p.ParseKeys(dec, criteria); err != nil {
+		return nil, err
+	}
+	return criteria, p.expectEnd(dec)
+}
+
+// ParseWithCharset parses a mandatory charset followed by search keys, as
+// used by the SORT (RFC 5256) and THREAD commands.
+func (p *SearchParser) ParseWithCharset(dec *wire.Decoder) (*imap.SearchCriteria, error) {
+	if dec == nil {
+		return nil, imap.ErrBad("missing charset")
+	}
+	if err := readSearchCharset(dec); err != nil {
+		return nil, err
+	}
+	return p.ParseFrom("", dec)
+}
+
+// readSearchCharset reads and checks a charset and the space following it.
+func readSearchCharset(dec *wire.Decoder) error {
+	charset, err := dec.ReadAString()
+	if err != nil {
+		return imap.ErrBad("missing charset")
+	}
+	if !IsSupportedSearchCharset(charset) {
+		return imap.ErrNoWithCode(imap.ResponseCodeBadCharset,
+			fmt.Sprintf("unsupported charset %s", charset))
+	}
+	if err := dec.ReadSP(); err != nil {
+		return imap.ErrBad("missing search criteria")
+	}
+	return nil
+}
+
+// expectEnd reports an error if input remains after the search program.
+func (p *SearchParser) expectEnd(dec *wire.Decoder) error {
+	if b, err := dec.PeekByte(); err == nil {
+		return imap.ErrBad(fmt.Sprintf("invalid search criteria: unexpected %q", b))
+	}
+	return nil
+}
+
+// ParseKeys reads search keys separated by spaces and adds them to criteria.
+// It stops at the end of the input or before a closing parenthesis.
+func (p *SearchParser) ParseKeys(dec *wire.Decoder, criteria *imap.SearchCriteria) error {
+	for {
+		b, err := dec.PeekByte()
+		if err != nil || b == ')' {
+			return nil
+		}
+
+		key := ""
+		if b != '(' {
+			key, err = ReadSearchAtom(dec)
+			if err != nil {
+				return searchSyntaxError(err)
+			}
+		}
+		if err := p.ParseKey(key, dec, criteria); err != nil {
+			return err
+		}
+
+		if !readOptionalSP(dec) {
+			return nil
+		}
+	}
+}
+
+// readOptionalSP consumes a space if it is the next byte.
+func readOptionalSP(dec *wire.Decoder) bool {
+	if b, err := dec.PeekByte(); err != nil || b != ' ' {
+		return false
+	}
+	return dec.ReadSP() == nil
+}
+
+// ParseKey parses a single search key whose atom has already been read and
+// adds it to criteria. An empty key means the next byte is the opening
+// parenthesis of a key list.
+func (p *SearchParser) ParseKey(key string, dec *wire.Decoder, criteria *imap.SearchCriteria) error {
+	sub, err := p.parseKey(key, dec)
+	if err != nil {
+		return err
+	}
+	criteria.And(sub)
+	return nil
+}
+
+// ParseNextKey reads a space and the search key following it, and returns
+// the key's criteria. Hooks use it for keys that take a search key as an
+// argument.
+func (p *SearchParser) ParseNextKey(dec *wire.Decoder) (*imap.SearchCriteria, error) {
+	if err := dec.ReadSP(); err != nil {
+		return nil, imap.ErrBad("invalid search criteria: missing search key")
+	}
+	b, err := dec.PeekByte()
+	if err != nil {
+		return nil, imap.ErrBad("invalid search criteria: missing search key")
+	}
+	key := ""
+	if b != '(' {
+		key, err = ReadSearchAtom(dec)
+		if err != nil {
+			return nil, searchSyntaxError(err)
+		}
+	}
+	return p.parseKey(key, dec)
+}
+
+func (p *SearchParser) parseKey(key string, dec *wire.Decoder) (*imap.SearchCriteria, error) {
+	criteria := &imap.SearchCriteria{}
+
+	if key == "" {
+		if err := dec.ExpectByte('('); err != nil {
+			return nil, searchSyntaxError(err)
+		}
+		if b, err := dec.PeekByte(); err != nil || b == ')' {
+			return nil, imap.ErrBad("invalid search criteria: empty key list")
+		}
+		if err := p.ParseKeys(dec, criteria); err != nil {
+			return nil, err
+		}
+		if err := dec.ExpectByte(')'); err != nil {
+			return nil, imap.ErrBad("invalid search criteria: missing ')'")
+		}
+		return criteria, nil
+	}
+
+	if p.Hook != nil {
+		handled, err := p.Hook(p, key, dec, criteria)
+		if err != nil {
+			return nil, searchSyntaxError(err)
+		}
+		if handled {
+			return criteria, nil
+		}
+	}
+
+	var err error
+	switch upper := strings.ToUpper(key); upper {
+	case "ALL":
+		// Matches all messages.
+	case "ANSWERED":
+		criteria.Flag = append(criteria.Flag, imap.FlagAnswered)
+	case "DELETED":
+		criteria.Flag = append(criteria.Flag, imap.FlagDeleted)
+	case "DRAFT":
+		criteria.Flag = append(criteria.Flag, imap.FlagDraft)
+	case "FLAGGED":
+		criteria.Flag = append(criteria.Flag, imap.FlagFlagged)
+	case "SEEN":
+		criteria.Flag = append(criteria.Flag, imap.FlagSeen)
+	case "RECENT":
+		criteria.Flag = append(criteria.Flag, imap.FlagRecent)
+	case "UNANSWERED":
+		criteria.NotFlag = append(criteria.NotFlag, imap.FlagAnswered)
+	case "UNDELETED":
+		criteria.NotFlag = append(criteria.NotFlag, imap.FlagDeleted)
+	case "UNDRAFT":
+		criteria.NotFlag = append(criteria.NotFlag, imap.FlagDraft)
+	case "UNFLAGGED":
+		criteria.NotFlag = append(criteria.NotFlag, imap.FlagFlagged)
+	case "UNSEEN":
+		criteria.NotFlag = append(criteria.NotFlag, imap.FlagSeen)
+	case "NEW":
+		criteria.Flag = append(criteria.Flag, imap.FlagRecent)
+		criteria.NotFlag = append(criteria.NotFlag, imap.FlagSeen)
+	case "OLD":
+		criteria.NotFlag = append(criteria.NotFlag, imap.FlagRecent)
+	case "KEYWORD", "UNKEYWORD":
+		var kw string
+		if kw, err = readSearchArg(dec, upper, dec.ReadAtom); err != nil {
+			break
+		}
+		if upper == "KEYWORD" {
+			criteria.Flag = append(criteria.Flag, imap.Flag(kw))
+		} else {
+			criteria.NotFlag = append(criteria.NotFlag, imap.Flag(kw))
+		}
+	case "LARGER", "SMALLER", "YOUNGER", "OLDER":
+		var n uint64
+		if n, err = readSearchNumber(dec, upper); err != nil {
+			break
+		}
+		switch upper {
+		case "LARGER":
+			criteria.Larger = int64(n)
+		case "SMALLER":
+			criteria.Smaller = int64(n)
+		case "YOUNGER":
+			criteria.Younger = int64(n)
+		case "OLDER":
+			criteria.Older = int64(n)
+		}
+	case "BODY", "TEXT":
+		var s string
+		if s, err = readSearchArg(dec, upper, dec.ReadAString); err != nil {
+			break
+		}
+		if upper == "BODY" {
+			criteria.Body = append(criteria.Body, s)
+		} else {
+			criteria.Text = append(criteria.Text, s)
+		}
+	case "SUBJECT", "FROM", "TO", "CC", "BCC":
+		var s string
+		if s, err = readSearchArg(dec, upper, dec.ReadAString); err != nil {
+			break
+		}
+		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
+			Key: searchHeaderNames[upper], Value: s,
+		})
+	case "HEADER":
+		var name, value string
+		if name, err = readSearchArg(dec, upper, dec.ReadAString); err != nil {
+			break
+		}
+		if value, err = readSearchArg(dec, upper, dec.ReadAString); err != nil {
+			break
+		}
+		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
+			Key: name, Value: value,
+		})
+	case "BEFORE", "ON", "SINCE", "SENTBEFORE", "SENTON", "SENTSINCE",
+		"SAVEDBEFORE", "SAVEDON", "SAVEDSINCE":
+		var t time.Time
+		if t, err = readSearchDate(dec, upper); err != nil {
+			break
+		}
+		*searchDateField(criteria, upper) = t
+	case "UID":
+		var s string
+		if s, err = readSearchArg(dec, upper, func() (string, error) { return ReadSearchAtom(dec) }); err != nil {
+			break
+		}
+		var uids *imap.UIDSet
+		if uids, err = imap.ParseUIDSet(s); err != nil {
+			err = fmt.Errorf("invalid UID set %q", s)
+			break
+		}
+		criteria.UID = uids
+	case "MODSEQ":
+		criteria.ModSeq, err = readSearchModSeq(dec)
+	case "NOT":
+		var sub *imap.SearchCriteria
+		if sub, err = p.ParseNextKey(dec); err != nil {
+			return nil, err
+		}
+		criteria.Not = append(criteria.Not, *sub)
+	case "OR":
+		var left, right *imap.SearchCriteria
+		if left, err = p.ParseNextKey(dec); err != nil {
+			return nil, err
+		}
+		if right, err = p.ParseNextKey(dec); err != nil {
+			return nil, err
+		}
+		criteria.Or = append(criteria.Or, [2]imap.SearchCriteria{*left, *right})
+	default:
+		var seqSet *imap.SeqSet
+		if seqSet, err = imap.ParseSeqSet(key); err != nil {
+			err = fmt.Errorf("unknown search key %q", key)
+			break
+		}
+		criteria.SeqNum = seqSet
+	}
+	if err != nil {
+		return nil, searchSyntaxError(err)
+	}
+	return criteria, nil
+}
+
+// searchHeaderNames maps header search keys to header field names.
+var searchHeaderNames = map[string]string{
+	"SUBJECT": "Subject",
+	"FROM":    "From",
+	"TO":      "To",
+	"CC":      "Cc",
+	"BCC":     "Bcc",
+}
+
+// searchDateField returns the criteria field set by a date search key.
+func searchDateField(criteria *imap.SearchCriteria, key string) *time.Time {
+	switch key {
+	case "BEFORE":
+		return &criteria.Before
+	case "ON":
+		return &criteria.On
+	case "SINCE":
+		return &criteria.Since
+	case "SENTBEFORE":
+		return &criteria.SentBefore
+	case "SENTON":
+		return &criteria.SentOn
+	case "SENTSINCE":
+		return &criteria.SentSince
+	case "SAVEDBEFORE":
+		return &criteria.SavedBefore
+	case "SAVEDON":
+		return &criteria.SavedOn
+	default:
+		return &criteria.SavedSince
+	}
+}
+
+// readSearchArg reads the space and argument following a search key.
+func readSearchArg(dec *wire.Decoder, key string, read func() (string, error)) (string, error) {
+	if err := dec.ReadSP(); err != nil {
+		return "", fmt.Errorf("missing argument for %s", key)
+	}
+	s, err := read()
+	if err != nil {
+		return "", fmt.Errorf("invalid argument for %s: %w", key, err)
+	}
+	return s, nil
+}
+
+func readSearchNumber(dec *wire.Decoder, key string) (uint64, error) {
+	if err := dec.ReadSP(); err != nil {
+		return 0, fmt.Errorf("missing argument for %s", key)
+	}
+	n, err := dec.ReadNumber64()
+	if err != nil {
+		return 0, fmt.Errorf("invalid number for %s: %w", key, err)
+	}
+	return n, nil
+}
+
+// readSearchDate reads a date argument, which may be quoted.
+func readSearchDate(dec *wire.Decoder, key string) (time.Time, error) {
+	s, err := readSearchArg(dec, key, dec.ReadAString)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(searchDateLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s date %q", key, s)
+	}
+	return t, nil
+}
+
+// readSearchModSeq reads the arguments of a MODSEQ search key:
+// [SP entry-name SP entry-type-req] SP mod-sequence-valzer.
+func readSearchModSeq(dec *wire.Decoder) (*imap.SearchCriteriaModSeq, error) {
+	if err := dec.ReadSP(); err != nil {
+		return nil, fmt.Errorf("missing argument for MODSEQ")
+	}
+	crit := &imap.SearchCriteriaModSeq{}
+	if b, err := dec.PeekByte(); err == nil && b == '"' {
+		name, err := dec.ReadQuotedString()
+		if err != nil {
+			return nil, err
+		}
+		crit.MetadataName = name
+		entryType, err := readSearchArg(dec, "MODSEQ", dec.ReadAtom)
+		if err != nil {
+			return nil, err
+		}
+		crit.MetadataType = strings.ToLower(entryType)
+		if err := dec.ReadSP(); err != nil {
+			return nil, fmt.Errorf("missing mod-sequence for MODSEQ")
+		}
+	}
+	n, err := dec.ReadNumber64()
+	if err != nil {
+		return nil, fmt.Errorf("invalid mod-sequence for MODSEQ: %w", err)
+	}
+	crit.ModSeq = n
+	return crit, nil
+}
+
+// ReadSearchAtom reads a search key atom. Unlike wire.Decoder.ReadAtom it
+// accepts '*', so that sequence sets such as "1:*" are read whole.
+func ReadSearchAtom(dec *wire.Decoder) (string, error) {
+	var b strings.Builder
+	for {
+		c, err := dec.PeekByte()
+		if err != nil {
+			break
+		}
+		if c == '*' {
+			_ = dec.ExpectByte('*')
+			b.WriteByte('*')
+			continue
+		}
+		if wire.IsAtomSpecial(c) {
+			break
+		}
+		s, err := dec.ReadAtom()
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(s)
+	}
+	if b.Len() == 0 {
+		return "", fmt.Errorf("expected search key")
+	}
+	return b.String(), nil
+}
+
+// IsSupportedSearchCharset reports whether charset can be used in a SEARCH
+// CHARSET specification. US-ASCII and UTF-8 are supported.
+func IsSupportedSearchCharset(charset string) bool {
+	return strings.EqualFold(charset, "US-ASCII") || strings.EqualFold(charset, "UTF-8")
+}
+
+// searchSyntaxError converts a parse error into a BAD response, leaving
+// *imap.IMAPError values unchanged.
+func searchSyntaxError(err error) error {
+	if imapErr, ok := err.(*imap.IMAPError); ok {
+		return imapErr
+	}
+	return imap.ErrBad("invalid search criteria: " + err.Error())
+}
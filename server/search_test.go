@@ -0,0 +1,348 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/wire"
+)
+
+func mustSeqSet(t *testing.T, s string) *imap.SeqSet {
+	t.Helper()
+	set, err := imap.ParseSeqSet(s)
+	if err != nil {
+		t.Fatalf("ParseSeqSet(%q) error: %v", s, err)
+	}
+	return set
+}
+
+func mustUIDSet(t *testing.T, s string) *imap.UIDSet {
+	t.Helper()
+	set, err := imap.ParseUIDSet(s)
+	if err != nil {
+		t.Fatalf("ParseUIDSet(%q) error: %v", s, err)
+	}
+	return set
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParseSearch(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  *imap.SearchCriteria
+	}{
+		{"all", "ALL", &imap.SearchCriteria{}},
+		{"lowercase", "seen", &imap.SearchCriteria{Flag: []imap.Flag{imap.FlagSeen}}},
+		{
+			"flags",
+			"ANSWERED DELETED UNDRAFT UNFLAGGED",
+			&imap.SearchCriteria{
+				Flag:    []imap.Flag{imap.FlagAnswered, imap.FlagDeleted},
+				NotFlag: []imap.Flag{imap.FlagDraft, imap.FlagFlagged},
+			},
+		},
+		{
+			"new",
+			"NEW",
+			&imap.SearchCriteria{Flag: []imap.Flag{imap.FlagRecent}, NotFlag: []imap.Flag{imap.FlagSeen}},
+		},
+		{
+			"keyword",
+			"KEYWORD $Forwarded UNKEYWORD $Junk",
+			&imap.SearchCriteria{Flag: []imap.Flag{"$Forwarded"}, NotFlag: []imap.Flag{"$Junk"}},
+		},
+		{"sequence set", "2:4,7", &imap.SearchCriteria{SeqNum: mustSeqSet(t, "2:4,7")}},
+		{"sequence set star", "1:*", &imap.SearchCriteria{SeqNum: mustSeqSet(t, "1:*")}},
+		{"uid", "UID 100:*", &imap.SearchCriteria{UID: mustUIDSet(t, "100:*")}},
+		{
+			"header keys",
+			`FROM "Smith" SUBJECT hello TO bob CC carol BCC dave`,
+			&imap.SearchCriteria{Header: []imap.SearchCriteriaHeaderField{
+				{Key: "From", Value: "Smith"},
+				{Key: "Subject", Value: "hello"},
+				{Key: "To", Value: "bob"},
+				{Key: "Cc", Value: "carol"},
+				{Key: "Bcc", Value: "dave"},
+			}},
+		},
+		{
+			"header",
+			`HEADER "X-Mailer" "My Client"`,
+			&imap.SearchCriteria{Header: []imap.SearchCriteriaHeaderField{{Key: "X-Mailer", Value: "My Client"}}},
+		},
+		{
+			"header empty value",
+			`HEADER Message-ID ""`,
+			&imap.SearchCriteria{Header: []imap.SearchCriteriaHeaderField{{Key: "Message-ID", Value: ""}}},
+		},
+		{
+			"literal",
+			"BODY {5}\r\nhello TEXT world",
+			&imap.SearchCriteria{Body: []string{"hello"}, Text: []string{"world"}},
+		},
+		{
+			"literal with spaces",
+			"SUBJECT {11}\r\nhello world",
+			&imap.SearchCriteria{Header: []imap.SearchCriteriaHeaderField{{Key: "Subject", Value: "hello world"}}},
+		},
+		{"size", "LARGER 1024 SMALLER 4096", &imap.SearchCriteria{Larger: 1024, Smaller: 4096}},
+		{"within", "YOUNGER 3600 OLDER 60", &imap.SearchCriteria{Younger: 3600, Older: 60}},
+		{
+			"dates",
+			`SINCE 1-Feb-1994 BEFORE "8-Mar-1994" ON 3-Feb-1994`,
+			&imap.SearchCriteria{
+				Since:  date(1994, time.February, 1),
+				Before: date(1994, time.March, 8),
+				On:     date(1994, time.February, 3),
+			},
+		},
+		{
+			"sent dates",
+			"SENTSINCE 1-Jan-2020 SENTBEFORE 1-Jan-2021 SENTON 15-Jun-2020",
+			&imap.SearchCriteria{
+				SentSince:  date(2020, time.January, 1),
+				SentBefore: date(2021, time.January, 1),
+				SentOn:     date(2020, time.June, 15),
+			},
+		},
+		{
+			"saved dates",
+			"SAVEDSINCE 1-Jan-2020 SAVEDBEFORE 1-Jan-2021 SAVEDON 15-Jun-2020",
+			&imap.SearchCriteria{
+				SavedSince:  date(2020, time.January, 1),
+				SavedBefore: date(2021, time.January, 1),
+				SavedOn:     date(2020, time.June, 15),
+			},
+		},
+		{"modseq", "MODSEQ 620162338", &imap.SearchCriteria{ModSeq: &imap.SearchCriteriaModSeq{ModSeq: 620162338}}},
+		{
+			"modseq entry",
+			`MODSEQ "/flags/\\draft" all 620162338`,
+			&imap.SearchCriteria{ModSeq: &imap.SearchCriteriaModSeq{
+				ModSeq: 620162338, MetadataName: `/flags/\draft`, MetadataType: "all",
+			}},
+		},
+		{
+			"not",
+			"NOT SEEN",
+			&imap.SearchCriteria{Not: []imap.SearchCriteria{{Flag: []imap.Flag{imap.FlagSeen}}}},
+		},
+		{
+			"not with argument",
+			`NOT FROM "Smith" DELETED`,
+			&imap.SearchCriteria{
+				Flag: []imap.Flag{imap.FlagDeleted},
+				Not: []imap.SearchCriteria{{Header: []imap.SearchCriteriaHeaderField{
+					{Key: "From", Value: "Smith"},
+				}}},
+			},
+		},
+		{
+			"or",
+			"OR SEEN FLAGGED",
+			&imap.SearchCriteria{Or: [][2]imap.SearchCriteria{{
+				{Flag: []imap.Flag{imap.FlagSeen}},
+				{Flag: []imap.Flag{imap.FlagFlagged}},
+			}}},
+		},
+		{
+			"or with arguments",
+			`OR FROM alice TO bob`,
+			&imap.SearchCriteria{Or: [][2]imap.SearchCriteria{{
+				{Header: []imap.SearchCriteriaHeaderField{{Key: "From", Value: "alice"}}},
+				{Header: []imap.SearchCriteriaHeaderField{{Key: "To", Value: "bob"}}},
+			}}},
+		},
+		{
+			"nested or",
+			"OR OR SEEN FLAGGED DELETED",
+			&imap.SearchCriteria{Or: [][2]imap.SearchCriteria{{
+				{Or: [][2]imap.SearchCriteria{{
+					{Flag: []imap.Flag{imap.FlagSeen}},
+					{Flag: []imap.Flag{imap.FlagFlagged}},
+				}}},
+				{Flag: []imap.Flag{imap.FlagDeleted}},
+			}}},
+		},
+		{
+			"parenthesized",
+			"(SEEN FLAGGED)",
+			&imap.SearchCriteria{Flag: []imap.Flag{imap.FlagSeen, imap.FlagFlagged}},
+		},
+		{
+			"or of lists",
+			"OR (SEEN LARGER 10) (UNSEEN SMALLER 5)",
+			&imap.SearchCriteria{Or: [][2]imap.SearchCriteria{{
+				{Flag: []imap.Flag{imap.FlagSeen}, Larger: 10},
+				{NotFlag: []imap.Flag{imap.FlagSeen}, Smaller: 5},
+			}}},
+		},
+		{
+			"not list",
+			"NOT (SEEN (DELETED))",
+			&imap.SearchCriteria{Not: []imap.SearchCriteria{
+				{Flag: []imap.Flag{imap.FlagSeen, imap.FlagDeleted}},
+			}},
+		},
+		{
+			"list first then keys",
+			"(OR SEEN DRAFT) UID 5",
+			&imap.SearchCriteria{
+				UID: mustUIDSet(t, "5"),
+				Or: [][2]imap.SearchCriteria{{
+					{Flag: []imap.Flag{imap.FlagSeen}},
+					{Flag: []imap.Flag{imap.FlagDraft}},
+				}},
+			},
+		},
+		{"charset", "CHARSET UTF-8 TEXT foo", &imap.SearchCriteria{Text: []string{"foo"}}},
+		{"charset quoted", `CHARSET "us-ascii" ALL`, &imap.SearchCriteria{}},
+		{"range intersection", "LARGER 10 LARGER 20 SINCE 1-Jan-2020 SINCE 1-Jan-2019",
+			&imap.SearchCriteria{Larger: 20, Since: date(2020, time.January, 1)}},
+		{
+			"two sequence sets",
+			"1:10 5:20",
+			&imap.SearchCriteria{
+				SeqNum: mustSeqSet(t, "1:10"),
+				Not: []imap.SearchCriteria{{Not: []imap.SearchCriteria{
+					{SeqNum: mustSeqSet(t, "5:20")},
+				}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSearch(wire.NewDecoder(strings.NewReader(tt.input)))
+			if err != nil {
+				t.Fatalf("ParseSearch(%q) error: %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSearch(%q) =\n%+v\nwant\n%+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSearch_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		typ   imap.StatusResponseType
+		code  imap.ResponseCode
+	}{
+		{"empty", "", imap.StatusResponseTypeBAD, ""},
+		{"unknown key", "FOO", imap.StatusResponseTypeBAD, ""},
+		{"missing argument", "FROM", imap.StatusResponseTypeBAD, ""},
+		{"missing header value", "HEADER Subject", imap.StatusResponseTypeBAD, ""},
+		{"bad number", "LARGER big", imap.StatusResponseTypeBAD, ""},
+		{"bad date", "SINCE yesterday", imap.StatusResponseTypeBAD, ""},
+		{"bad uid set", "UID x", imap.StatusResponseTypeBAD, ""},
+		{"or with one operand", "OR SEEN", imap.StatusResponseTypeBAD, ""},
+		{"not without operand", "NOT", imap.StatusResponseTypeBAD, ""},
+		{"unclosed list", "(SEEN FLAGGED", imap.StatusResponseTypeBAD, ""},
+		{"empty list", "()", imap.StatusResponseTypeBAD, ""},
+		{"stray paren", "SEEN)", imap.StatusResponseTypeBAD, ""},
+		{"charset without keys", "CHARSET UTF-8", imap.StatusResponseTypeBAD, ""},
+		{"unsupported charset", "CHARSET KOI8-R ALL", imap.StatusResponseTypeNO, imap.ResponseCodeBadCharset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSearch(wire.NewDecoder(strings.NewReader(tt.input)))
+			imapErr, ok := err.(*imap.IMAPError)
+			if !ok {
+				t.Fatalf("ParseSearch(%q) error = %v, want *imap.IMAPError", tt.input, err)
+			}
+			if imapErr.Type != tt.typ || imapErr.Code != tt.code {
+				t.Errorf("ParseSearch(%q) error = %v, want %s [%s]", tt.input, err, tt.typ, tt.code)
+			}
+		})
+	}
+}
+
+func TestSearchParser_ParseFrom(t *testing.T) {
+	dec := wire.NewDecoder(strings.NewReader("RETURN (MIN) 1:* SEEN"))
+	first, err := ReadSearchToken(dec)
+	if err != nil || first != "RETURN" {
+		t.Fatalf("ReadSearchToken() = %q, %v", first, err)
+	}
+	// Skip the RETURN options.
+	if _, err := dec.ReadLine(); err != nil {
+		t.Fatalf("ReadLine() error: %v", err)
+	}
+
+	dec = wire.NewDecoder(strings.NewReader("1:* SEEN"))
+	first, err = ReadSearchToken(dec)
+	if err != nil {
+		t.Fatalf("ReadSearchToken() error: %v", err)
+	}
+	got, err := ParseSearchFrom(first, dec)
+	if err != nil {
+		t.Fatalf("ParseSearchFrom() error: %v", err)
+	}
+	want := &imap.SearchCriteria{SeqNum: mustSeqSet(t, "1:*"), Flag: []imap.Flag{imap.FlagSeen}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseSearchFrom() = %+v, want %+v", got, want)
+	}
+
+	dec = wire.NewDecoder(strings.NewReader("(SEEN)"))
+	first, err = ReadSearchToken(dec)
+	if err != nil || first != "" {
+		t.Fatalf("ReadSearchToken() = %q, %v, want empty", first, err)
+	}
+	if _, err := ParseSearchFrom(first, dec); err != nil {
+		t.Fatalf("ParseSearchFrom() error: %v", err)
+	}
+}
+
+func TestSearchParser_ParseWithCharset(t *testing.T) {
+	var p SearchParser
+	got, err := p.ParseWithCharset(wire.NewDecoder(strings.NewReader("UTF-8 SINCE 1-Feb-1994 NOT FROM Smith")))
+	if err != nil {
+		t.Fatalf("ParseWithCharset() error: %v", err)
+	}
+	want := &imap.SearchCriteria{
+		Since: date(1994, time.February, 1),
+		Not: []imap.SearchCriteria{{Header: []imap.SearchCriteriaHeaderField{
+			{Key: "From", Value: "Smith"},
+		}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseWithCharset() = %+v, want %+v", got, want)
+	}
+
+	_, err = p.ParseWithCharset(wire.NewDecoder(strings.NewReader("ISO-2022-JP ALL")))
+	if imapErr, ok := err.(*imap.IMAPError); !ok || imapErr.Code != imap.ResponseCodeBadCharset {
+		t.Errorf("ParseWithCharset() error = %v, want BADCHARSET", err)
+	}
+}
+
+func TestSearchParser_Hook(t *testing.T) {
+	p := SearchParser{Hook: func(p *SearchParser, key string, dec *wire.Decoder, criteria *imap.SearchCriteria) (bool, error) {
+		if key != "$" {
+			return false, nil
+		}
+		criteria.SeqNum = mustSeqSet(t, "3,5")
+		return true, nil
+	}}
+
+	got, err := p.Parse(wire.NewDecoder(strings.NewReader("OR $ SEEN")))
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	want := &imap.SearchCriteria{Or: [][2]imap.SearchCriteria{{
+		{SeqNum: mustSeqSet(t, "3,5")},
+		{Flag: []imap.Flag{imap.FlagSeen}},
+	}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %+v, want %+v", got, want)
+	}
+}
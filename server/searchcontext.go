@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// RunSearch runs a search on the session of ctx. If the session implements
+// SessionSearchWithContext, it is passed the command context, limited by
+// Options.SearchLimits.MaxDuration; a search that runs out of time without
+// returning results fails with NO [LIMIT]. Otherwise Session.Search is
+// called. If the session implements SessionHeaderIndex, header keys are
+// answered from its index first, see ApplyHeaderIndex. Handlers report the
+// results with Conn.WriteSearchOK.
+func RunSearch(ctx *CommandContext, criteria *imap.SearchCriteria, options *imap.SearchOptions) (*imap.SearchData, error) {
+	if idx, ok := ctx.Session.(SessionHeaderIndex); ok {
+		var err error
+		if criteria, err = ApplyHeaderIndex(idx, criteria); err != nil {
+			return nil, err
+		}
+	}
+
+	sess, ok := ctx.Session.(SessionSearchWithContext)
+	if !ok {
+		return ctx.Session.Search(ctx.NumKind, criteria, options)
+	}
+
+	parent := ctx.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	searchCtx := parent
+	if d := ctx.Conn.server.options.SearchLimits.MaxDuration; d > 0 {
+		var cancel context.CancelFunc
+		searchCtx, cancel = context.WithTimeout(parent, d)
+		defer cancel()
+	}
+
+	data, err := sess.SearchWithContext(searchCtx, ctx.NumKind, criteria, options)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, imap.ErrNoWithCode(imap.ResponseCodeLimit, "Search took too long")
+	}
+	return data, err
+}
+
+// WriteSearchOK writes the tagged OK response of a search command. If data
+// is incomplete, the response has the LIMIT response code and says so, so
+// that clients know more messages may match.
+func (c *Conn) WriteSearchOK(tag string, data *imap.SearchData) {
+	if data != nil && data.Incomplete {
+		c.WriteOKCode(tag, imap.ResponseCodeLimit, "SEARCH completed, results incomplete: time limit exceeded")
+		return
+	}
+	c.WriteOK(tag, "SEARCH completed")
+}
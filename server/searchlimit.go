@@ -0,0 +1,137 @@
+package server
+
+import (
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// SearchLimits bounds the cost of SEARCH, SORT and THREAD commands.
+// Commands exceeding a limit fail with NO [LIMIT].
+type SearchLimits struct {
+	// MaxResults is the maximum number of messages a single SEARCH, SORT
+	// or THREAD response may list. Clients that need more results can page
+	// through them with PARTIAL (RFC 9394). 0 means no limit.
+	MaxResults int
+
+	// MaxCriteriaKeys is the maximum number of search keys in a search
+	// program, including keys nested in OR, NOT and parentheses. 0 means
+	// no limit.
+	MaxCriteriaKeys int
+
+	// MaxCriteriaDepth is the maximum nesting depth of OR and NOT in a
+	// search program. 0 means no limit.
+	MaxCriteriaDepth int
+
+	// MaxDuration is the time a SEARCH may take. Sessions implementing
+	// SessionSearchWithContext get a context with this deadline and may return
+	// the results found until then, which are reported as incomplete.
+	// Other sessions are not interrupted. 0 means no limit.
+	MaxDuration time.Duration
+}
+
+// WithSearchLimits sets limits on the size of SEARCH, SORT and THREAD
+// results and on the complexity of search criteria.
+func WithSearchLimits(limits SearchLimits) Option {
+	return func(o *Options) {
+		o.SearchLimits = limits
+	}
+}
+
+// CheckSearchCriteria returns a NO [LIMIT] error if criteria exceed
+// Options.SearchLimits. Handlers call it after parsing a search program
+// and before passing it to the session.
+func (c *Conn) CheckSearchCriteria(criteria *imap.SearchCriteria) error {
+	limits := c.server.options.SearchLimits
+	if limits.MaxCriteriaKeys <= 0 && limits.MaxCriteriaDepth <= 0 {
+		return nil
+	}
+	keys, depth := searchComplexity(criteria)
+	if limits.MaxCriteriaKeys > 0 && keys > limits.MaxCriteriaKeys {
+		return imap.ErrNoWithCode(imap.ResponseCodeLimit, "Too many search keys")
+	}
+	if limits.MaxCriteriaDepth > 0 && depth > limits.MaxCriteriaDepth {
+		return imap.ErrNoWithCode(imap.ResponseCodeLimit, "Search criteria nested too deeply")
+	}
+	return nil
+}
+
+// CheckSearchResults returns a NO [LIMIT] error if a response listing n
+// messages would exceed Options.SearchLimits.MaxResults. If PARTIAL is
+// advertised, the error text suggests using it.
+func (c *Conn) CheckSearchResults(n int) error {
+	max := c.server.options.SearchLimits.MaxResults
+	if max <= 0 || n <= max {
+		return nil
+	}
+	for _, cap := range c.Capabilities() {
+		if cap == imap.CapPartial {
+			return imap.ErrNoWithCode(imap.ResponseCodeLimit, "Too many results, use PARTIAL to page through them")
+		}
+	}
+	return imap.ErrNoWithCode(imap.ResponseCodeLimit, "Too many results, narrow the search")
+}
+
+// searchComplexity returns the number of search keys in criteria and the
+// nesting depth of OR and NOT.
+func searchComplexity(criteria *imap.SearchCriteria) (keys, depth int) {
+	if criteria == nil {
+		return 0, 0
+	}
+
+	for _, set := range []bool{
+		criteria.SeqNum != nil,
+		criteria.UID != nil,
+		!criteria.Since.IsZero(),
+		!criteria.Before.IsZero(),
+		!criteria.SentSince.IsZero(),
+		!criteria.SentBefore.IsZero(),
+		!criteria.SentOn.IsZero(),
+		!criteria.On.IsZero(),
+		!criteria.SavedBefore.IsZero(),
+		!criteria.SavedSince.IsZero(),
+		!criteria.SavedOn.IsZero(),
+		criteria.Larger > 0,
+		criteria.Smaller > 0,
+		criteria.ModSeq != nil,
+		criteria.Younger > 0,
+		criteria.Older > 0,
+	} {
+		if set {
+			keys++
+		}
+	}
+	keys += len(criteria.Header) + len(criteria.Body) + len(criteria.Text) +
+		len(criteria.Flag) + len(criteria.NotFlag)
+
+	for i := range criteria.Or {
+		for j := range criteria.Or[i] {
+			k, d := searchComplexity(&criteria.Or[i][j])
+			keys += k
+			if d+1 > depth {
+				depth = d + 1
+			}
+		}
+	}
+	for i := range criteria.Not {
+		k, d := searchComplexity(&criteria.Not[i])
+		keys += k
+		if d+1 > depth {
+			depth = d + 1
+		}
+	}
+	return keys, depth
+}
+
+// CheckSearchData is like CheckSearchResults for the messages listed in
+// data.
+func (c *Conn) CheckSearchData(data *imap.SearchData) error {
+	if data == nil {
+		return nil
+	}
+	n := len(data.AllSeqNums) + len(data.AllUIDs)
+	if n == 0 && data.All != nil {
+		n = int(data.Count)
+	}
+	return c.CheckSearchResults(n)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestSearchComplexity(t *testing.T) {
+	criteria := &imap.SearchCriteria{
+		Since: time.Now(),
+		Flag:  []imap.Flag{imap.FlagSeen},
+		Header: []imap.SearchCriteriaHeaderField{
+			{Key: "From", Value: "alice"},
+		},
+		Or: [][2]imap.SearchCriteria{{
+			{Body: []string{"a"}},
+			{Not: []imap.SearchCriteria{{Text: []string{"b", "c"}}}},
+		}},
+	}
+
+	keys, depth := searchComplexity(criteria)
+	if keys != 6 {
+		t.Errorf("keys = %d, want 6", keys)
+	}
+	if depth != 2 {
+		t.Errorf("depth = %d, want 2", depth)
+	}
+}
+
+func TestConn_CheckSearchLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  SearchLimits
+		caps    []imap.Cap
+		keys    int
+		results int
+		wantErr string
+	}{
+		{name: "no limits", keys: 100, results: 100000},
+		{name: "within limits", limits: SearchLimits{MaxResults: 10, MaxCriteriaKeys: 3}, keys: 3, results: 10},
+		{name: "too many keys", limits: SearchLimits{MaxCriteriaKeys: 3}, keys: 4, wantErr: "Too many search keys"},
+		{name: "too many results", limits: SearchLimits{MaxResults: 10}, results: 11, wantErr: "Too many results, narrow the search"},
+		{
+			name:    "too many results with PARTIAL",
+			limits:  SearchLimits{MaxResults: 10},
+			caps:    []imap.Cap{imap.CapPartial},
+			results: 11,
+			wantErr: "Too many results, use PARTIAL to page through them",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := New(WithSearchLimits(tt.limits), WithCapabilities(tt.caps...))
+			c1, c2 := net.Pipe()
+			defer c1.Close()
+			defer c2.Close()
+			conn := newConn(c1, srv)
+
+			criteria := &imap.SearchCriteria{}
+			for i := 0; i < tt.keys; i++ {
+				criteria.Text = append(criteria.Text, "x")
+			}
+			err := conn.CheckSearchCriteria(criteria)
+			if err == nil {
+				err = conn.CheckSearchResults(tt.results)
+			}
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var imapErr *imap.IMAPError
+			if !errors.As(err, &imapErr) {
+				t.Fatalf("error = %v, want *imap.IMAPError", err)
+			}
+			if imapErr.Type != imap.StatusResponseTypeNO || imapErr.Code != imap.ResponseCodeLimit || imapErr.Text != tt.wantErr {
+				t.Errorf("error = %+v, want NO [LIMIT] %s", imapErr.StatusResponse, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConn_CheckSearchData(t *testing.T) {
+	srv := New(WithSearchLimits(SearchLimits{MaxResults: 2}))
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	conn := newConn(c1, srv)
+
+	if err := conn.CheckSearchData(&imap.SearchData{AllUIDs: []imap.UID{1, 2}}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := conn.CheckSearchData(&imap.SearchData{AllSeqNums: []uint32{1, 2, 3}}); err == nil {
+		t.Error("expected error for 3 results")
+	}
+	if err := conn.CheckSearchData(&imap.SearchData{All: &imap.SeqSet{}, Count: 5}); err == nil {
+		t.Error("expected error for ESEARCH ALL with 5 results")
+	}
+}
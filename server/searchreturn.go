@@ -0,0 +1,140 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/wire"
+)
+
+// SearchReturnOptionFunc parses a RETURN option of SEARCH or SORT into
+// options. It is called with the decoder positioned right after the name
+// of the option, and reads its arguments, if any, with their leading SP.
+type SearchReturnOptionFunc func(dec *wire.Decoder, options *imap.SearchOptions) error
+
+var (
+	searchReturnMu      sync.RWMutex
+	searchReturnOptions = map[string]SearchReturnOptionFunc{
+		"MIN":       func(_ *wire.Decoder, o *imap.SearchOptions) error { o.ReturnMin = true; return nil },
+		"MAX":       func(_ *wire.Decoder, o *imap.SearchOptions) error { o.ReturnMax = true; return nil },
+		"ALL":       func(_ *wire.Decoder, o *imap.SearchOptions) error { o.ReturnAll = true; return nil },
+		"COUNT":     func(_ *wire.Decoder, o *imap.SearchOptions) error { o.ReturnCount = true; return nil },
+		"SAVE":      func(_ *wire.Decoder, o *imap.SearchOptions) error { o.ReturnSave = true; return nil },
+		"CONTEXT":   func(_ *wire.Decoder, o *imap.SearchOptions) error { o.ReturnContext = true; return nil },
+		"UPDATE":    func(_ *wire.Decoder, o *imap.SearchOptions) error { o.ReturnUpdate = true; return nil },
+		"RELEVANCY": func(_ *wire.Decoder, o *imap.SearchOptions) error { o.ReturnRelevancy = true; return nil },
+		"PARTIAL":   parseSearchReturnPartial,
+	}
+)
+
+// RegisterSearchReturnOption registers the parser of a RETURN option of
+// SEARCH and SORT, replacing the parser registered for the same name, the
+// built-in ones included. Names are case-insensitive.
+//
+// MIN, MAX, ALL, COUNT and SAVE (RFC 4731, RFC 5182), CONTEXT and UPDATE
+// (RFC 5267), RELEVANCY (RFC 6203) and PARTIAL (RFC 9394) are built in.
+func RegisterSearchReturnOption(name string, parse SearchReturnOptionFunc) {
+	searchReturnMu.Lock()
+	defer searchReturnMu.Unlock()
+	searchReturnOptions[strings.ToUpper(name)] = parse
+}
+
+// ParseSearchReturnOptions parses the parenthesized list of RETURN options
+// of SEARCH or SORT into options, with the parsers registered with
+// RegisterSearchReturnOption. It is shared by the extensions that accept
+// RETURN options, so that they all accept the same ones.
+func ParseSearchReturnOptions(dec *wire.Decoder, options *imap.SearchOptions) error {
+	if err := dec.ExpectByte('('); err != nil {
+		return imap.ErrBad("expected '(' for RETURN options")
+	}
+
+	b, err := dec.PeekByte()
+	if err != nil {
+		return imap.ErrBad("unexpected end in RETURN options")
+	}
+	if b == ')' {
+		if err := dec.ExpectByte(')'); err != nil {
+			return imap.ErrBad("expected ')' for RETURN options")
+		}
+		return nil
+	}
+
+	for {
+		atom, err := dec.ReadAtom()
+		if err != nil {
+			return imap.ErrBad("invalid RETURN option")
+		}
+		searchReturnMu.RLock()
+		parse, ok := searchReturnOptions[strings.ToUpper(atom)]
+		searchReturnMu.RUnlock()
+		if !ok {
+			return imap.ErrBad("unknown RETURN option: " + atom)
+		}
+		if err := parse(dec, options); err != nil {
+			return err
+		}
+
+		b, err := dec.PeekByte()
+		if err != nil {
+			return imap.ErrBad("unexpected end in RETURN options")
+		}
+		if b == ')' {
+			if err := dec.ExpectByte(')'); err != nil {
+				return imap.ErrBad("expected ')' for RETURN options")
+			}
+			return nil
+		}
+		if err := dec.ReadSP(); err != nil {
+			return imap.ErrBad("expected SP between RETURN options")
+		}
+	}
+}
+
+// parseSearchReturnPartial parses the range argument of the PARTIAL
+// RETURN option (RFC 9394).
+func parseSearchReturnPartial(dec *wire.Decoder, options *imap.SearchOptions) error {
+	if err := dec.ReadSP(); err != nil {
+		return imap.ErrBad("missing PARTIAL range")
+	}
+	rangeAtom, err := dec.ReadAtom()
+	if err != nil {
+		return imap.ErrBad("invalid PARTIAL range")
+	}
+	offset, count, err := parsePartialRange(rangeAtom)
+	if err != nil {
+		return imap.ErrBad("invalid PARTIAL range: " + err.Error())
+	}
+	options.ReturnPartial = &imap.SearchReturnPartial{Offset: offset, Count: count}
+	return nil
+}
+
+// parsePartialRange parses a PARTIAL range like "1:100" or "-1:100".
+func parsePartialRange(s string) (int32, uint32, error) {
+	idx := strings.LastIndex(s, ":")
+	if idx < 0 {
+		return 0, 0, fmt.Errorf("missing ':' separator")
+	}
+	offsetStr := s[:idx]
+	countStr := s[idx+1:]
+
+	offset64, err := strconv.ParseInt(offsetStr, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid offset: %s", offsetStr)
+	}
+	if offset64 == 0 {
+		return 0, 0, fmt.Errorf("offset must not be zero")
+	}
+
+	count64, err := strconv.ParseUint(countStr, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid count: %s", countStr)
+	}
+	if count64 == 0 {
+		return 0, 0, fmt.Errorf("count must be positive")
+	}
+
+	return int32(offset64), uint32(count64), nil
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/wire"
+)
+
+func TestParseSearchReturnOptions(t *testing.T) {
+	dec := wire.NewDecoder(strings.NewReader("(min MAX ALL COUNT SAVE CONTEXT UPDATE RELEVANCY PARTIAL -1:10)"))
+	opts := &imap.SearchOptions{}
+	if err := ParseSearchReturnOptions(dec, opts); err != nil {
+		t.Fatalf("ParseSearchReturnOptions() error: %v", err)
+	}
+	want := imap.SearchOptions{
+		ReturnMin: true, ReturnMax: true, ReturnAll: true, ReturnCount: true, ReturnSave: true,
+		ReturnContext: true, ReturnUpdate: true, ReturnRelevancy: true,
+	}
+	if opts.ReturnPartial == nil || *opts.ReturnPartial != (imap.SearchReturnPartial{Offset: -1, Count: 10}) {
+		t.Errorf("ReturnPartial = %+v, want -1:10", opts.ReturnPartial)
+	}
+	opts.ReturnPartial = nil
+	if *opts != want {
+		t.Errorf("options = %+v, want %+v", *opts, want)
+	}
+
+	for _, input := range []string{"MIN", "(MIN", "(MIN  MAX)", "(FOO)", "(PARTIAL)", "(PARTIAL 0:10)"} {
+		dec := wire.NewDecoder(strings.NewReader(input))
+		if err := ParseSearchReturnOptions(dec, &imap.SearchOptions{}); err == nil {
+			t.Errorf("ParseSearchReturnOptions(%q) succeeded", input)
+		}
+	}
+}
+
+func TestRegisterSearchReturnOption(t *testing.T) {
+	defer func() {
+		searchReturnMu.Lock()
+		delete(searchReturnOptions, "X-TEST")
+		searchReturnMu.Unlock()
+	}()
+
+	var arg string
+	RegisterSearchReturnOption("x-test", func(dec *wire.Decoder, options *imap.SearchOptions) error {
+		if err := dec.ReadSP(); err != nil {
+			return err
+		}
+		var err error
+		arg, err = dec.ReadAtom()
+		return err
+	})
+	dec := wire.NewDecoder(strings.NewReader("(COUNT X-TEST 42)"))
+	opts := &imap.SearchOptions{}
+	if err := ParseSearchReturnOptions(dec, opts); err != nil {
+		t.Fatalf("ParseSearchReturnOptions() error: %v", err)
+	}
+	if arg != "42" || !opts.ReturnCount {
+		t.Errorf("arg = %q, ReturnCount = %v", arg, opts.ReturnCount)
+	}
+}
+
+func TestParsePartialRange(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		wantOffset int32
+		wantCount  uint32
+		wantErr    bool
+	}{
+		{"positive", "1:100", 1, 100, false},
+		{"negative offset", "-1:100", -1, 100, false},
+		{"negative large", "-50:25", -50, 25, false},
+		{"invalid no colon", "abc", 0, 0, true},
+		{"zero offset", "0:100", 0, 0, true},
+		{"zero count", "1:0", 0, 0, true},
+		{"invalid offset", "abc:100", 0, 0, true},
+		{"invalid count", "1:abc", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, count, err := parsePartialRange(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePartialRange(%q) error = %v, wantErr = %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				if offset != tt.wantOffset {
+					t.Errorf("offset = %d, want %d", offset, tt.wantOffset)
+				}
+				if count != tt.wantCount {
+					t.Errorf("count = %d, want %d", count, tt.wantCount)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/wire"
+)
+
+// CompleteSelect finishes a successful SELECT or EXAMINE of mailbox: it
+// records the selected mailbox on the connection, enters the selected
+// state and writes the response with WriteSelectResponse. readOnly is true
+// for EXAMINE, in which case the mailbox is read-only even if the session
+// did not set data.ReadOnly.
+//
+// The mailbox ID (RFC 8474) is not reported if the server does not
+// advertise OBJECTID.
+//
+// The SELECT and EXAMINE handlers of the core and of all extensions use it,
+// so that EXAMINE behaves the same everywhere.
+func CompleteSelect(ctx *CommandContext, mailbox string, readOnly bool, data *imap.SelectData) error {
+	if readOnly {
+		data.ReadOnly = true
+	}
+	if data.MailboxID != "" && ctx.Server != nil && !advertises(ctx, imap.CapObjectID) {
+		data.MailboxID = ""
+	}
+	ctx.Conn.SetMailbox(mailbox, data.ReadOnly)
+	if err := ctx.Conn.SetState(imap.ConnStateSelected); err != nil {
+		return err
+	}
+	WriteSelectResponse(ctx.Conn, ctx.Tag, data, ctx.Conn.Enabled())
+	return nil
+}
+
+// advertises reports whether the server advertises a capability on the
+// connection of ctx.
+func advertises(ctx *CommandContext, c imap.Cap) bool {
+	for _, have := range ctx.Conn.Capabilities() {
+		if have == c {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteSelectResponse writes the untagged responses for a successful
+// SELECT or EXAMINE followed by the tagged OK with the READ-ONLY or
+// READ-WRITE response code. Optional data such as PERMANENTFLAGS, UNSEEN,
+// HIGHESTMODSEQ (RFC 7162) and MAILBOXID (RFC 8474) is written when set.
+//
+// enabled holds the capabilities the client has enabled, usually
+// conn.Enabled(), and may be nil. RECENT is omitted once IMAP4rev2 is
+// enabled (RFC 9051 removed it), and VANISHED (EARLIER) is only written
+// when QRESYNC is enabled.
+//
+// The SELECT and EXAMINE handlers of the core and of all extensions use
+// it, so that their responses stay consistent.
+func WriteSelectResponse(conn *Conn, tag string, data *imap.SelectData, enabled *imap.CapSet) {
+	enc := conn.Encoder()
+	rev2 := enabled != nil && enabled.Has(imap.CapIMAP4rev2)
+
+	enc.Encode(func(e *wire.Encoder) {
+		e.Star().Atom("FLAGS").SP().Flags(flagStrings(data.Flags)).CRLF()
+	})
+
+	enc.Encode(func(e *wire.Encoder) {
+		e.NumResponse(data.NumMessages, "EXISTS")
+	})
+
+	if !rev2 {
+		enc.Encode(func(e *wire.Encoder) {
+			e.NumResponse(data.NumRecent, "RECENT")
+		})
+	}
+
+	enc.Encode(func(e *wire.Encoder) {
+		e.Star().Atom("OK").SP()
+		e.ResponseCode("UIDVALIDITY", data.UIDValidity)
+		e.CRLF()
+	})
+
+	enc.Encode(func(e *wire.Encoder) {
+		e.Star().Atom("OK").SP()
+		e.ResponseCode("UIDNEXT", uint32(data.UIDNext))
+		e.CRLF()
+	})
+
+	if len(data.PermanentFlags) > 0 {
+		enc.Encode(func(e *wire.Encoder) {
+			e.Star().Atom("OK").SP()
+			e.RawString("[PERMANENTFLAGS ")
+			e.Flags(flagStrings(data.PermanentFlags))
+			e.RawString("] ")
+			e.CRLF()
+		})
+	}
+
+	if data.FirstUnseen > 0 {
+		enc.Encode(func(e *wire.Encoder) {
+			e.Star().Atom("OK").SP()
+			e.ResponseCode("UNSEEN", data.FirstUnseen)
+			e.CRLF()
+		})
+	}
+
+	if data.HighestModSeq > 0 {
+		enc.Encode(func(e *wire.Encoder) {
+			e.Star().Atom("OK").SP()
+			e.ResponseCode("HIGHESTMODSEQ", data.HighestModSeq)
+			e.CRLF()
+		})
+	}
+
+	if data.MailboxID != "" {
+		enc.Encode(func(e *wire.Encoder) {
+			e.Star().Atom("OK").SP()
+			e.ResponseCode("MAILBOXID", "("+data.MailboxID+")")
+			e.CRLF()
+		})
+	}
+
+	if enabled != nil && enabled.Has(imap.CapQResync) && data.Vanished != nil && !data.Vanished.IsEmpty() {
+		data.Vanished.Normalize()
+		vanished := data.Vanished.String()
+		enc.Encode(func(e *wire.Encoder) {
+			e.Star().Atom("VANISHED").SP().Atom("(EARLIER)").SP().Atom(vanished).CRLF()
+		})
+	}
+
+	code := "READ-WRITE"
+	if data.ReadOnly {
+		code = "READ-ONLY"
+	}
+	enc.Encode(func(e *wire.Encoder) {
+		e.StatusResponse(tag, "OK", code, "SELECT completed")
+	})
+}
+
+func flagStrings(flags []imap.Flag) []string {
+	strs := make([]string, len(flags))
+	for i, f := range flags {
+		strs[i] = string(f)
+	}
+	return strs
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestWriteSelectResponse(t *testing.T) {
+	vanished := &imap.UIDSet{}
+	vanished.AddRange(3, 5)
+	data := &imap.SelectData{
+		NumMessages:   10,
+		NumRecent:     2,
+		UIDValidity:   42,
+		UIDNext:       11,
+		FirstUnseen:   4,
+		HighestModSeq: 100,
+		MailboxID:     "F123",
+		Vanished:      vanished,
+		ReadOnly:      true,
+	}
+
+	tests := []struct {
+		name    string
+		enabled *imap.CapSet
+		want    []string
+	}{
+		{
+			name:    "default",
+			enabled: nil,
+			want: []string{
+				"* FLAGS ()\r\n",
+				"* 10 EXISTS\r\n",
+				"* 2 RECENT\r\n",
+				"* OK [UIDVALIDITY 42] \r\n",
+				"* OK [UIDNEXT 11] \r\n",
+				"* OK [UNSEEN 4] \r\n",
+				"* OK [HIGHESTMODSEQ 100] \r\n",
+				"* OK [MAILBOXID (F123)] \r\n",
+				"A1 OK [READ-ONLY] SELECT completed\r\n",
+			},
+		},
+		{
+			name:    "IMAP4rev2 and QRESYNC enabled",
+			enabled: imap.NewCapSet(imap.CapIMAP4rev2, imap.CapQResync),
+			want: []string{
+				"* FLAGS ()\r\n",
+				"* 10 EXISTS\r\n",
+				"* OK [UIDVALIDITY 42] \r\n",
+				"* OK [UIDNEXT 11] \r\n",
+				"* OK [UNSEEN 4] \r\n",
+				"* OK [HIGHESTMODSEQ 100] \r\n",
+				"* OK [MAILBOXID (F123)] \r\n",
+				"* VANISHED (EARLIER) 3:5\r\n",
+				"A1 OK [READ-ONLY] SELECT completed\r\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c1, c2 := net.Pipe()
+			defer c1.Close()
+			defer c2.Close()
+			conn := newConn(c1, New())
+
+			go WriteSelectResponse(conn, "A1", data, tt.enabled)
+
+			r := bufio.NewReader(c2)
+			for _, want := range tt.want {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					t.Fatalf("ReadString() error: %v", err)
+				}
+				if line != want {
+					t.Errorf("got %q, want %q", line, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompleteSelect_ExamineReadOnly(t *testing.T) {
+	srv := New()
+	stored := false
+	srv.dispatcher.RegisterFunc("STORE", func(ctx *CommandContext) error {
+		stored = true
+		ctx.Conn.WriteOK(ctx.Tag, "STORE completed")
+		return nil
+	})
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	conn := newConn(c1, srv)
+	if err := conn.SetState(imap.ConnStateAuthenticated); err != nil {
+		t.Fatalf("SetState() error: %v", err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		// The session did not set ReadOnly; EXAMINE must still be read-only.
+		ctx := &CommandContext{Tag: "A1", Name: "EXAMINE", Conn: conn, Server: srv}
+		if err := CompleteSelect(ctx, "INBOX", true, &imap.SelectData{UIDValidity: 1}); err != nil {
+			errc <- err
+			return
+		}
+		_ = srv.dispatch(conn, "A2", "STORE", "1 +FLAGS (\\Seen)")
+		_ = srv.dispatch(conn, "A3", "UID", "STORE 1 +FLAGS (\\Seen)")
+		errc <- nil
+	}()
+
+	r := bufio.NewReader(c2)
+	var lines []string
+	for len(lines) == 0 || !strings.HasPrefix(lines[len(lines)-1], "A3 ") {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString() error: %v", err)
+		}
+		lines = append(lines, line)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("CompleteSelect() error: %v", err)
+	}
+
+	want := []string{
+		"A1 OK [READ-ONLY] SELECT completed\r\n",
+		"A2 NO mailbox is read-only\r\n",
+		"A3 NO mailbox is read-only\r\n",
+	}
+	if got := lines[len(lines)-3:]; strings.Join(got, "") != strings.Join(want, "") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if !conn.IsReadOnly() || conn.State() != imap.ConnStateSelected {
+		t.Errorf("IsReadOnly() = %v, State() = %v, want read-only selected", conn.IsReadOnly(), conn.State())
+	}
+	if stored {
+		t.Error("STORE handler was called on a read-only mailbox")
+	}
+}
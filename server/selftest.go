@@ -0,0 +1,475 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// SelfTestTimeout is the time Server.SelfTest waits for the response to
+// each command, unless the context expires earlier.
+const SelfTestTimeout = 10 * time.Second
+
+// selfTestMailbox is the mailbox created, used and deleted by SelfTest.
+const selfTestMailbox = "imap-go-selftest"
+
+// ErrNoSelfTestAccount is returned by Server.SelfTest when the server has
+// no SelfTestAccount.
+var ErrNoSelfTestAccount = errors.New("server: no self-test account, see WithSelfTestAccount")
+
+// SelfTestAccount is the backend and account Server.SelfTest logs in to.
+// It should be a scratch account: the self-test creates, changes and
+// deletes a mailbox in it.
+type SelfTestAccount struct {
+	// NewSession creates the session of the self-test connection, like
+	// Options.NewSession.
+	NewSession func(conn *Conn) (Session, error)
+	// Username and Password are sent with LOGIN.
+	Username string
+	Password string
+}
+
+// WithSelfTestAccount sets the account Server.SelfTest runs its commands
+// against. memserver.SelfTestAccount returns one backed by an empty
+// in-memory server, which exercises the handlers and extensions without
+// touching real mailboxes.
+func WithSelfTestAccount(account SelfTestAccount) Option {
+	return func(o *Options) {
+		o.SelfTestAccount = &account
+	}
+}
+
+// SelfTestFailure is a command that failed during Server.SelfTest.
+type SelfTestFailure struct {
+	// Command is the command as sent, without its tag and literal.
+	Command string
+	// Reason describes the failure, such as the BAD response or the panic
+	// of the handler.
+	Reason string
+}
+
+// Error implements error.
+func (f *SelfTestFailure) Error() string {
+	return fmt.Sprintf("self-test: %s: %s", f.Command, f.Reason)
+}
+
+// SelfTest checks that the command handlers of the server and the
+// wrappers installed by its extensions work together, so that a broken
+// handler chain is found at deploy time rather than when a client runs
+// into it.
+//
+// It connects to the server over an in-memory loopback connection, which
+// is treated as secure, with a session of Options.SelfTestAccount, and
+// runs a scripted exchange: every built-in command with typical
+// arguments, sample commands of the common extensions, and every other
+// registered command without arguments. A command fails if its handler
+// panics, if it gets no tagged response within SelfTestTimeout, if a
+// sample command gets BAD, or if a built-in command does not get OK. The
+// conflicts reported by ExtensionConflicts are failures too.
+//
+// SelfTest returns the failures joined with errors.Join, each a
+// *SelfTestFailure or ExtensionConflict, or nil if there are none. It
+// returns ErrNoSelfTestAccount without running anything if the server has
+// no self-test account. A handler that hangs is left running.
+func (srv *Server) SelfTest(ctx context.Context) error {
+	account := srv.options.SelfTestAccount
+	if account == nil || account.NewSession == nil {
+		return ErrNoSelfTestAccount
+	}
+
+	var errs []error
+	for _, conflict := range srv.ExtensionConflicts() {
+		errs = append(errs, conflict)
+	}
+
+	run := &selfTestRun{srv: srv, account: account, ctx: ctx, covered: make(map[string]bool)}
+	defer run.disconnect()
+	if err := run.runSteps(selfTestScript); err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	if err := run.runSteps(run.probes()); err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	if err := run.runSteps(selfTestCleanup); err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	return errors.Join(append(errs, run.failures...)...)
+}
+
+// selfTestExpect is the response a self-test command must get.
+type selfTestExpect int
+
+const (
+	expectOK     selfTestExpect = iota // OK
+	expectNotBAD                       // OK or NO
+	expectAny                          // any tagged response
+)
+
+// selfTestStep is a command of the self-test.
+type selfTestStep struct {
+	// state is the state the command is sent in.
+	state   imap.ConnState
+	command string
+	// literal is sent after the first continuation request, for APPEND.
+	literal string
+	// done is sent after the first continuation request, for IDLE.
+	done   bool
+	expect selfTestExpect
+}
+
+const selfTestMessage = "From: self-test <selftest@example.org>\r\n" +
+	"Subject: self-test\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Checking the handlers.\r\n"
+
+// selfTestScript exercises the built-in commands and the sample commands
+// of extensions. The mailbox is created first and, when it is selected,
+// holds one message.
+var selfTestScript = []selfTestStep{
+	{state: imap.ConnStateNotAuthenticated, command: "CAPABILITY"},
+	{state: imap.ConnStateNotAuthenticated, command: "NOOP"},
+	{state: imap.ConnStateNotAuthenticated, command: `ID ("name" "imap-go-selftest")`, expect: expectNotBAD},
+
+	{state: imap.ConnStateAuthenticated, command: "CREATE " + selfTestMailbox, expect: expectNotBAD},
+	{state: imap.ConnStateAuthenticated, command: "APPEND " + selfTestMailbox + " (\\Seen) {" +
+		strconv.Itoa(len(selfTestMessage)) + "}", literal: selfTestMessage},
+	{state: imap.ConnStateAuthenticated, command: "ENABLE IMAP4rev1"},
+	{state: imap.ConnStateAuthenticated, command: "SUBSCRIBE " + selfTestMailbox},
+	{state: imap.ConnStateAuthenticated, command: `LIST "" "*"`},
+	{state: imap.ConnStateAuthenticated, command: `LSUB "" "*"`},
+	{state: imap.ConnStateAuthenticated, command: "STATUS " + selfTestMailbox + " (MESSAGES UIDNEXT UIDVALIDITY UNSEEN)"},
+	{state: imap.ConnStateAuthenticated, command: "EXAMINE " + selfTestMailbox},
+	{state: imap.ConnStateAuthenticated, command: "IDLE", done: true},
+	{state: imap.ConnStateAuthenticated, command: "NAMESPACE", expect: expectNotBAD},
+	{state: imap.ConnStateAuthenticated, command: "GETQUOTAROOT " + selfTestMailbox, expect: expectNotBAD},
+	{state: imap.ConnStateAuthenticated, command: "MYRIGHTS " + selfTestMailbox, expect: expectNotBAD},
+	{state: imap.ConnStateAuthenticated, command: "GETACL " + selfTestMailbox, expect: expectNotBAD},
+	{state: imap.ConnStateAuthenticated, command: `GETMETADATA "" /shared/comment`, expect: expectNotBAD},
+	{state: imap.ConnStateAuthenticated, command: "NOTIFY NONE", expect: expectNotBAD},
+
+	{state: imap.ConnStateAuthenticated, command: "SELECT " + selfTestMailbox},
+	{state: imap.ConnStateSelected, command: "FETCH 1 (FLAGS UID INTERNALDATE RFC822.SIZE ENVELOPE BODYSTRUCTURE BODY.PEEK[HEADER] BODY.PEEK[1]<0.10>)"},
+	{state: imap.ConnStateSelected, command: "UID FETCH 1:* (UID FLAGS)"},
+	{state: imap.ConnStateSelected, command: "SEARCH ALL"},
+	{state: imap.ConnStateSelected, command: `UID SEARCH SEEN SUBJECT "self-test" SINCE 1-Jan-2000`},
+	{state: imap.ConnStateSelected, command: `SORT (DATE) UTF-8 ALL`, expect: expectNotBAD},
+	{state: imap.ConnStateSelected, command: `THREAD REFERENCES UTF-8 ALL`, expect: expectNotBAD},
+	{state: imap.ConnStateSelected, command: "STORE 1 +FLAGS (\\Flagged)"},
+	{state: imap.ConnStateSelected, command: "UID STORE 1:* -FLAGS.SILENT (\\Flagged)"},
+	{state: imap.ConnStateSelected, command: "COPY 1 " + selfTestMailbox},
+	{state: imap.ConnStateSelected, command: "UID MOVE 1 " + selfTestMailbox, expect: expectNotBAD},
+	{state: imap.ConnStateSelected, command: "CHECK"},
+	{state: imap.ConnStateSelected, command: "UNSELECT", expect: expectNotBAD},
+}
+
+// selfTestCleanup exercises the commands that change or delete the
+// mailbox, and logs out.
+var selfTestCleanup = []selfTestStep{
+	{state: imap.ConnStateSelected, command: "UID STORE 1:* +FLAGS.SILENT (\\Deleted)"},
+	{state: imap.ConnStateSelected, command: "EXPUNGE"},
+	{state: imap.ConnStateSelected, command: "CLOSE"},
+	{state: imap.ConnStateAuthenticated, command: "UNSUBSCRIBE " + selfTestMailbox},
+	{state: imap.ConnStateAuthenticated, command: "RENAME " + selfTestMailbox + " " + selfTestMailbox + "-renamed"},
+	{state: imap.ConnStateAuthenticated, command: "DELETE " + selfTestMailbox + "-renamed"},
+	{state: imap.ConnStateAuthenticated, command: "LOGOUT"},
+}
+
+// selfTestUnprobed lists the commands that are not sent without
+// arguments, as they end or take over the connection.
+var selfTestUnprobed = map[string]bool{
+	"LOGOUT":   true,
+	"STARTTLS": true,
+	"COMPRESS": true,
+}
+
+// selfTestRun is the state of a running self-test.
+type selfTestRun struct {
+	srv     *Server
+	account *SelfTestAccount
+	ctx     context.Context
+
+	conn *Conn
+	peer net.Conn
+	r    *bufio.Reader
+	// served is closed when the connection's serve loop has returned,
+	// after *panicked is set if a handler panicked.
+	served   chan struct{}
+	panicked *string
+
+	tag      int
+	covered  map[string]bool
+	failures []error
+}
+
+// probes returns the steps that send the registered commands that the
+// script does not cover, without arguments.
+func (run *selfTestRun) probes() []selfTestStep {
+	var steps []selfTestStep
+	names := run.srv.dispatcher.Names()
+	sort.Strings(names)
+	for _, name := range names {
+		if run.covered[name] || selfTestUnprobed[name] {
+			continue
+		}
+		steps = append(steps, selfTestStep{state: imap.ConnStateSelected, command: name, expect: expectAny})
+	}
+	return steps
+}
+
+// runSteps runs steps, recording failed commands. It returns an error if
+// the self-test cannot go on.
+func (run *selfTestRun) runSteps(steps []selfTestStep) error {
+	for _, step := range steps {
+		if err := run.ctx.Err(); err != nil {
+			return err
+		}
+		name := selfTestCommandName(step.command)
+		if run.srv.dispatcher.Get(name) == nil {
+			// Sample commands of extensions that are not installed.
+			continue
+		}
+		if err := run.enter(step.state); err != nil {
+			return err
+		}
+		run.covered[name] = true
+		if failure := run.do(step); failure != nil {
+			run.failures = append(run.failures, failure)
+		}
+	}
+	return nil
+}
+
+// selfTestCommandName returns the name of the handler of a command line.
+func selfTestCommandName(command string) string {
+	fields := strings.Fields(strings.ToUpper(command))
+	if len(fields) > 1 && fields[0] == "UID" {
+		fields = fields[1:]
+	}
+	return fields[0]
+}
+
+// enter connects and logs in or selects the mailbox as needed to send a
+// command in state.
+func (run *selfTestRun) enter(state imap.ConnState) error {
+	if run.conn != nil && state == imap.ConnStateNotAuthenticated &&
+		run.conn.State() != imap.ConnStateNotAuthenticated {
+		run.disconnect()
+	}
+	if run.conn == nil {
+		if err := run.connect(); err != nil {
+			return err
+		}
+	}
+	if state == imap.ConnStateNotAuthenticated {
+		return nil
+	}
+
+	if run.conn.State() == imap.ConnStateNotAuthenticated {
+		run.covered["LOGIN"] = true
+		login := "LOGIN " + selfTestQuote(run.account.Username) + " " + selfTestQuote(run.account.Password)
+		if failure := run.do(selfTestStep{command: login}); failure != nil {
+			failure.Command = "LOGIN"
+			return failure
+		}
+	}
+	if state == imap.ConnStateSelected && run.conn.State() != imap.ConnStateSelected {
+		run.covered["SELECT"] = true
+		if failure := run.do(selfTestStep{command: "SELECT " + selfTestMailbox}); failure != nil {
+			return failure
+		}
+	}
+	return nil
+}
+
+// connect opens a loopback connection to the server and reads its
+// greeting.
+func (run *selfTestRun) connect() error {
+	peer, netConn := net.Pipe()
+	c := newConn(netConn, run.srv)
+	c.isTLS = true
+	session, err := run.account.NewSession(c)
+	if err != nil {
+		_ = peer.Close()
+		_ = netConn.Close()
+		return fmt.Errorf("self-test: creating session: %w", err)
+	}
+	c.session = session
+
+	run.conn, run.peer, run.r = c, peer, bufio.NewReader(peer)
+	served, panicked := make(chan struct{}), new(string)
+	run.served, run.panicked = served, panicked
+	go func() {
+		defer close(served)
+		defer func() {
+			if r := recover(); r != nil {
+				*panicked = fmt.Sprintf("handler panicked: %v\n%s", r, debug.Stack())
+				_ = c.Close()
+			}
+		}()
+		c.serve()
+	}()
+
+	run.setDeadline()
+	greeting, err := run.readLine()
+	if err != nil {
+		run.disconnect()
+		return fmt.Errorf("self-test: reading greeting: %w", err)
+	}
+	if !strings.HasPrefix(greeting, "* OK") && !strings.HasPrefix(greeting, "* PREAUTH") {
+		run.disconnect()
+		return fmt.Errorf("self-test: unexpected greeting %q", greeting)
+	}
+	return nil
+}
+
+// disconnect closes the loopback connection.
+func (run *selfTestRun) disconnect() {
+	if run.conn == nil {
+		return
+	}
+	_ = run.peer.Close()
+	_ = run.conn.Close()
+	run.conn, run.peer, run.r = nil, nil, nil
+}
+
+// setDeadline sets the deadline of the next response.
+func (run *selfTestRun) setDeadline() {
+	deadline := time.Now().Add(SelfTestTimeout)
+	if d, ok := run.ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = run.peer.SetDeadline(deadline)
+}
+
+// do sends a command and reads its response. It returns a failure if the
+// response is not the expected one, or if the connection broke; the
+// connection is then closed, so that the next command opens another one.
+func (run *selfTestRun) do(step selfTestStep) *SelfTestFailure {
+	run.tag++
+	tag := "T" + strconv.Itoa(run.tag)
+	fail := func(reason string) *SelfTestFailure {
+		return &SelfTestFailure{Command: step.command, Reason: reason}
+	}
+
+	run.setDeadline()
+	if _, err := fmt.Fprintf(run.peer, "%s %s\r\n", tag, step.command); err != nil {
+		return fail(run.broken(err))
+	}
+	continued := false
+	for {
+		line, err := run.readLine()
+		if err != nil {
+			if step.command == "LOGOUT" && run.conn.State() == imap.ConnStateLogout {
+				run.disconnect()
+				return nil
+			}
+			return fail(run.broken(err))
+		}
+
+		switch {
+		case strings.HasPrefix(line, "+"):
+			// Send the literal or DONE after the first continuation
+			// request, and cancel any other, such as an AUTHENTICATE
+			// challenge.
+			reply := "*"
+			if !continued && step.literal != "" {
+				reply = step.literal
+			} else if !continued && step.done {
+				reply = "DONE"
+			}
+			continued = true
+			if _, err := fmt.Fprintf(run.peer, "%s\r\n", reply); err != nil {
+				return fail(run.broken(err))
+			}
+		case strings.HasPrefix(line, tag+" "):
+			status, text, _ := strings.Cut(line[len(tag)+1:], " ")
+			switch status = strings.ToUpper(status); {
+			case status == "OK":
+			case status == "NO" && step.expect != expectOK:
+			case status == "BAD" && step.expect == expectAny:
+			default:
+				return fail(status + " " + text)
+			}
+			if step.command == "LOGOUT" {
+				run.disconnect()
+			}
+			return nil
+		}
+	}
+}
+
+// broken returns the reason a command failed after the connection broke
+// with err, and closes it.
+func (run *selfTestRun) broken(err error) string {
+	served, panicked := run.served, run.panicked
+	run.disconnect()
+	select {
+	case <-served:
+		if *panicked != "" {
+			return *panicked
+		}
+	case <-time.After(time.Second):
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "no response"
+	}
+	return "connection closed: " + err.Error()
+}
+
+// readLine reads a response line, with the literals it contains.
+func (run *selfTestRun) readLine() (string, error) {
+	var b strings.Builder
+	for {
+		line, err := run.r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		b.WriteString(line)
+
+		n, ok := selfTestLiteralSize(line)
+		if !ok {
+			return b.String(), nil
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(run.r, buf); err != nil {
+			return "", err
+		}
+		b.WriteString("\r\n")
+		b.Write(buf)
+	}
+}
+
+// selfTestLiteralSize returns the size of the literal announced at the end
+// of a response line.
+func selfTestLiteralSize(line string) (int, bool) {
+	if !strings.HasSuffix(line, "}") {
+		return 0, false
+	}
+	i := strings.LastIndexByte(line, '{')
+	if i < 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(line[i+1:len(line)-1], "+"))
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// selfTestQuote returns s as a quoted string.
+func selfTestQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
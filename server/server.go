@@ -9,25 +9,56 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/extension"
 )
 
 // Server is an IMAP server.
 type Server struct {
 	options    *Options
 	dispatcher *Dispatcher
+	extensions []extension.ServerExtension
+	chains     map[string][]HandlerLayer
 	listeners  []net.Listener
 
 	mu         sync.Mutex
 	conns      map[*Conn]struct{}
 	connCount  atomic.Int64
+	nextConnID atomic.Uint64
 	shutdown   chan struct{}
 	isShutdown bool
+
+	// limits counts the commands rejected for exceeding
+	// Options.CommandLimits.
+	limits commandLimitCounters
+
+	// maintenance is the message of maintenance mode, or nil when the
+	// server is not in it. See SetMaintenanceMode.
+	maintenance atomic.Pointer[string]
+
+	// writes schedules the writes of the connections, or is nil if
+	// Options.WriteFairness is not set.
+	writes *writeScheduler
+
+	// handlers is what new connections use, which differs from dispatcher
+	// and extensions while extensions are disabled. See
+	// SetExtensionEnabled.
+	handlers atomic.Pointer[handlerSet]
+	// handlersMu guards disabled and userOps, the handlers registered with
+	// Handle, HandleFunc and WrapHandler after New, which are registered
+	// again when the handlers are rebuilt.
+	handlersMu sync.Mutex
+	disabled   map[string]bool
+	userOps    []func(*Dispatcher)
+	built      bool
 }
 
 // New creates a new IMAP server with the given options.
@@ -43,31 +74,77 @@ func New(opts ...Option) *Server {
 		conns:      make(map[*Conn]struct{}),
 		shutdown:   make(chan struct{}),
 	}
+	srv.dispatcher.SetUnknownHandler(options.UnknownCommandHandler)
+	if options.WriteFairness != nil {
+		srv.writes = newWriteScheduler(*options.WriteFairness)
+	}
 
 	// Register built-in command handlers
 	srv.registerBuiltinHandlers()
 
+	// Install extensions on top of the built-in handlers
+	srv.installExtensions()
+
+	srv.handlers.Store(&handlerSet{dispatcher: srv.dispatcher, extensions: srv.extensions})
+	srv.built = true
+	if len(options.DisabledExtensions) > 0 {
+		srv.handlersMu.Lock()
+		srv.disabled = make(map[string]bool)
+		for _, name := range options.DisabledExtensions {
+			srv.disabled[name] = true
+		}
+		srv.rebuildHandlers()
+		srv.handlersMu.Unlock()
+	}
+
 	return srv
 }
 
 // Handle registers a command handler.
 func (srv *Server) Handle(name string, handler CommandHandler) {
-	srv.dispatcher.Register(name, handler)
+	srv.applyHandlers(func(d *Dispatcher) { d.Register(name, handler) })
 }
 
 // HandleFunc registers a command handler function.
 func (srv *Server) HandleFunc(name string, fn CommandHandlerFunc) {
-	srv.dispatcher.RegisterFunc(name, fn)
+	srv.applyHandlers(func(d *Dispatcher) { d.RegisterFunc(name, fn) })
 }
 
 // WrapHandler wraps an existing command handler with a wrapper function.
 func (srv *Server) WrapHandler(name string, wrapper func(CommandHandler) CommandHandler) {
-	srv.dispatcher.Wrap(name, wrapper)
+	srv.applyHandlers(func(d *Dispatcher) { d.Wrap(name, wrapper) })
 }
 
-// Capabilities returns the capabilities for a connection.
+// Capabilities returns the capabilities for a connection in its current
+// state. Pre-authentication capabilities (STARTTLS, LOGINDISABLED and AUTH=)
+// are only advertised before the client has authenticated, and SASL
+// mechanisms with channel binding (AUTH=*-PLUS) only over TLS. Extensions that
+// implement extension.StateCapabilityExtension are asked for their
+// capabilities on every call. Options.HiddenCaps are never advertised,
+// whatever the case of their names.
+//
+// Capabilities computes them anew; responses use the snapshot cached by
+// Conn.Capabilities.
 func (srv *Server) Capabilities(c *Conn) []imap.Cap {
 	caps := srv.options.Caps.Clone()
+	state := c.State()
+
+	for _, ext := range c.handlerSet().extensions {
+		if sc, ok := ext.(extension.StateCapabilityExtension); ok {
+			caps.Add(sc.StateCapabilities(state, c)...)
+		} else {
+			caps.Add(ext.Capabilities()...)
+		}
+	}
+
+	if state != imap.ConnStateNotAuthenticated {
+		for _, cap := range caps.All() {
+			if isPreAuthCap(cap) {
+				caps.Remove(cap)
+			}
+		}
+		return withoutCaps(caps.All(), srv.options.HiddenCaps)
+	}
 
 	// Add STARTTLS if enabled and not already using TLS
 	if srv.options.EnableStartTLS && !c.IsTLS() {
@@ -79,11 +156,52 @@ func (srv *Server) Capabilities(c *Conn) []imap.Cap {
 		caps.Add(imap.CapLogindisabled)
 	}
 
-	return caps.All()
+	// Mechanisms with channel binding, such as SCRAM-SHA-256-PLUS, need
+	// TLS.
+	if !c.IsTLS() {
+		for _, cap := range caps.All() {
+			if mech, ok := cap.AuthMechanism(); ok && strings.HasSuffix(mech, "-PLUS") {
+				caps.Remove(cap)
+			}
+		}
+	}
+
+	return withoutCaps(caps.All(), srv.options.HiddenCaps)
+}
+
+// withoutCaps returns caps without the capabilities of hidden, whose names
+// are compared case-insensitively.
+func withoutCaps(caps, hidden []imap.Cap) []imap.Cap {
+	kept := caps[:0]
+	for _, cap := range caps {
+		if !containsCapFold(hidden, cap) {
+			kept = append(kept, cap)
+		}
+	}
+	return kept
+}
+
+// containsCapFold reports whether caps contains cap, ignoring case.
+func containsCapFold(caps []imap.Cap, cap imap.Cap) bool {
+	for _, c := range caps {
+		if strings.EqualFold(string(c), string(cap)) {
+			return true
+		}
+	}
+	return false
 }
 
 // Serve accepts connections on the listener and serves each one.
+//
+// With Options.StrictExtensions, Serve returns an error without accepting
+// connections if the installed extensions conflict.
 func (srv *Server) Serve(l net.Listener) error {
+	if srv.options.StrictExtensions {
+		if err := srv.extensionConflictsError(); err != nil {
+			return fmt.Errorf("conflicting extensions: %w", err)
+		}
+	}
+
 	srv.mu.Lock()
 	if srv.isShutdown {
 		srv.mu.Unlock()
@@ -111,13 +229,20 @@ func (srv *Server) Serve(l net.Listener) error {
 				return nil
 			default:
 			}
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
 			srv.options.Logger.Error("accept error", "error", err)
 			continue
 		}
 
 		if srv.options.MaxConnections > 0 && int(srv.connCount.Load()) >= srv.options.MaxConnections {
 			srv.options.Logger.Warn("max connections reached, rejecting", "remote", conn.RemoteAddr())
-			_ = conn.Close()
+			if srv.options.ResponseCodes.Limit {
+				go rejectConn(conn, "* BYE [LIMIT] Too many connections\r\n")
+			} else {
+				_ = conn.Close()
+			}
 			continue
 		}
 
@@ -125,6 +250,28 @@ func (srv *Server) Serve(l net.Listener) error {
 	}
 }
 
+// ServeConn serves a single connection, such as one end of net.Pipe in
+// tests, and returns when it ends. It fails if the server is shut down.
+func (srv *Server) ServeConn(conn net.Conn) error {
+	srv.mu.Lock()
+	isShutdown := srv.isShutdown
+	srv.mu.Unlock()
+	if isShutdown {
+		_ = conn.Close()
+		return errors.New("server is shut down")
+	}
+	srv.handleConn(conn)
+	return nil
+}
+
+// rejectConn writes a final response to a connection that is not served
+// and closes it.
+func rejectConn(conn net.Conn, response string) {
+	_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, _ = io.WriteString(conn, response)
+	_ = conn.Close()
+}
+
 // ListenAndServe listens on the given address and serves.
 func (srv *Server) ListenAndServe(addr string) error {
 	l, err := net.Listen("tcp", addr)
@@ -135,6 +282,9 @@ func (srv *Server) ListenAndServe(addr string) error {
 }
 
 // ListenAndServeTLS listens on the given address with TLS and serves.
+// The server's ALPN protocols, if any, are offered in addition to the
+// NextProtos of config. As with ServeTLS, the listener remains eligible
+// for Handoff.
 func (srv *Server) ListenAndServeTLS(addr string, config *tls.Config) error {
 	if config == nil {
 		config = srv.options.TLSConfig
@@ -143,18 +293,20 @@ func (srv *Server) ListenAndServeTLS(addr string, config *tls.Config) error {
 		return errors.New("TLS config required")
 	}
 
-	l, err := tls.Listen("tcp", addr, config)
+	l, err := net.Listen("tcp", addr)
 	if err != nil {
 		return fmt.Errorf("TLS listen: %w", err)
 	}
-	return srv.Serve(l)
+	return srv.ServeTLS(l, config)
 }
 
 // Shutdown gracefully shuts down the server.
 func (srv *Server) Shutdown(ctx context.Context) error {
 	srv.mu.Lock()
-	srv.isShutdown = true
-	close(srv.shutdown)
+	if !srv.isShutdown {
+		srv.isShutdown = true
+		close(srv.shutdown)
+	}
 
 	// Close all listeners
 	for _, l := range srv.listeners {
@@ -188,12 +340,27 @@ func (srv *Server) Logger() *slog.Logger {
 	return srv.options.Logger
 }
 
+// Conns returns the currently open connections.
+func (srv *Server) Conns() []*Conn {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	conns := make([]*Conn, 0, len(srv.conns))
+	for c := range srv.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
 // Dispatcher returns the command dispatcher.
 func (srv *Server) Dispatcher() *Dispatcher {
 	return srv.dispatcher
 }
 
 func (srv *Server) handleConn(netConn net.Conn) {
+	if !srv.acceptALPN(netConn) {
+		_ = netConn.Close()
+		return
+	}
 	c := newConn(netConn, srv)
 
 	srv.mu.Lock()
@@ -207,6 +374,10 @@ func (srv *Server) handleConn(netConn net.Conn) {
 		srv.mu.Unlock()
 		srv.connCount.Add(-1)
 		_ = c.Close()
+		c.closeSession()
+		if srv.options.OnConnClose != nil {
+			srv.options.OnConnClose(c)
+		}
 	}()
 
 	// Create session
@@ -1,13 +1,24 @@
 package server
 
 import (
+	"context"
+
 	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/auth/scram"
 )
 
 // Session is the interface that server backends must implement.
 // Each connection creates a new Session via the Server's NewSession callback.
+//
+// Errors returned by Session methods are reported to the client as
+// classified by imap.ClassifyError: an imap.IMAPError, possibly wrapped
+// with %w or classified with imap.WrapError, gives the response, and some
+// well-known errors, such as context.DeadlineExceeded and
+// os.ErrNotExist, are mapped to NO responses with matching codes. Other
+// errors are logged and reported as internal server errors.
 type Session interface {
-	// Close is called when the connection is closed.
+	// Close is called once when the connection is closed, after the
+	// command in progress, if any, has returned.
 	Close() error
 
 	// Login authenticates the user with a username and password.
@@ -70,6 +81,47 @@ type SessionMove interface {
 	Move(w *MoveWriter, numSet imap.NumSet, dest string) error
 }
 
+// SessionVanished is an optional interface for sessions that keep track of
+// expunged messages. It is used for the VANISHED (EARLIER) response to
+// UID FETCH with the VANISHED modifier (RFC 7162). Sessions that do not
+// implement it get a response computed from the UIDs that still exist.
+type SessionVanished interface {
+	// ExpungedUIDs returns the UIDs in uids that were expunged after the
+	// given mod-sequence. It may also return UIDs that were expunged
+	// earlier or never assigned.
+	ExpungedUIDs(uids *imap.UIDSet, sinceModSeq uint64) (*imap.UIDSet, error)
+}
+
+// SessionAuthenticate is an optional interface for sessions that support
+// SASL authentication with AUTHENTICATE. It is called by the mechanism
+// once the exchange is complete, with the credentials it carried: the
+// password for PLAIN and LOGIN, the token for XOAUTH2 and OAUTHBEARER, or
+// the client's response for CRAM-MD5. Sessions that do not implement it
+// only support the PLAIN and LOGIN mechanisms, which are checked with
+// Login.
+type SessionAuthenticate interface {
+	Authenticate(mechanism, identity string, credentials []byte) error
+}
+
+// SessionSCRAM is an optional interface for sessions that support the
+// SCRAM-SHA-256 and SCRAM-SHA-256-PLUS mechanisms (RFC 7677), in which the
+// client proves it knows the password without sending it.
+// SCRAMCredentials returns the keys stored for a user, see
+// scram.NewCredentials; an error fails the authentication. Once the
+// client's proof has been verified with them, SCRAMAuthenticated logs the
+// session in as the user.
+type SessionSCRAM interface {
+	SCRAMCredentials(mechanism, username string) (*scram.Credentials, error)
+	SCRAMAuthenticated(username string) error
+}
+
+// SessionCheck is an optional interface for sessions that support the
+// CHECK command. Check requests a checkpoint of the selected mailbox, such
+// as flushing cached state to disk.
+type SessionCheck interface {
+	Check() error
+}
+
 // SessionNamespace is an optional interface for sessions that support NAMESPACE.
 type SessionNamespace interface {
 	Namespace() (*imap.NamespaceData, error)
@@ -89,3 +141,14 @@ type SessionSort interface {
 type SessionThread interface {
 	Thread(kind NumKind, algorithm imap.ThreadAlgorithm, searchCriteria *imap.SearchCriteria, options *imap.SearchOptions) (*imap.ThreadData, error)
 }
+
+// SessionSearchWithContext is an optional interface for sessions whose
+// searches can be cancelled. SearchWithContext is called instead of
+// Session.Search with the command context, which has a deadline if
+// Options.SearchLimits.MaxDuration is set. When the context is done, the
+// session may stop early and return the matches found so far with
+// SearchData.Incomplete set, which are sent to the client with an OK [LIMIT]
+// response instead of failing the command.
+type SessionSearchWithContext interface {
+	SearchWithContext(ctx context.Context, kind NumKind, criteria *imap.SearchCriteria, options *imap.SearchOptions) (*imap.SearchData, error)
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/wire"
+)
+
+// baseSortKeys are the sort keys of RFC 5256.
+var baseSortKeys = map[imap.SortKey]bool{
+	imap.SortKeyArrival: true,
+	imap.SortKeyCc:      true,
+	imap.SortKeyDate:    true,
+	imap.SortKeyFrom:    true,
+	imap.SortKeySize:    true,
+	imap.SortKeySubject: true,
+	imap.SortKeyTo:      true,
+}
+
+// ReadSortCriteria reads a parenthesized list of sort criteria (RFC 5256)
+// for SORT and the commands extending it. Each key may be preceded by
+// REVERSE. DISPLAYFROM and DISPLAYTO (RFC 5957) are only accepted if
+// SORT=DISPLAY is advertised on conn; other unknown keys and empty lists
+// are rejected with a BAD error.
+func ReadSortCriteria(conn *Conn, dec *wire.Decoder) ([]imap.SortCriterion, error) {
+	var criteria []imap.SortCriterion
+	if err := dec.ReadList(func() error {
+		atom, err := dec.ReadAtom()
+		if err != nil {
+			return err
+		}
+
+		var criterion imap.SortCriterion
+		if strings.EqualFold(atom, "REVERSE") {
+			criterion.Reverse = true
+			if err := dec.ReadSP(); err != nil {
+				return err
+			}
+			if atom, err = dec.ReadAtom(); err != nil {
+				return err
+			}
+		}
+		criterion.Key = imap.SortKey(strings.ToUpper(atom))
+		criteria = append(criteria, criterion)
+		return nil
+	}); err != nil {
+		return nil, imap.ErrBad("invalid sort criteria")
+	}
+
+	if len(criteria) == 0 {
+		return nil, imap.ErrBad("empty sort criteria")
+	}
+	for _, c := range criteria {
+		if !conn.sortKeySupported(c.Key) {
+			return nil, imap.ErrBad("unknown sort key " + string(c.Key))
+		}
+	}
+	return criteria, nil
+}
+
+// sortKeySupported reports whether SORT accepts key on c.
+func (c *Conn) sortKeySupported(key imap.SortKey) bool {
+	if baseSortKeys[key] {
+		return true
+	}
+	if key != imap.SortKeyDisplayFrom && key != imap.SortKeyDisplayTo {
+		return false
+	}
+	for _, cap := range c.Capabilities() {
+		if cap == imap.CapSortDisplay {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/wire"
+)
+
+func TestReadSortCriteria(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	conn := newConn(c1, New())
+	if err := conn.SetState(imap.ConnStateAuthenticated); err != nil {
+		t.Fatalf("SetState() error: %v", err)
+	}
+	display := newConn(c1, New(WithCapabilities(imap.CapIMAP4rev1, imap.CapSort, imap.CapSortDisplay)))
+	if err := display.SetState(imap.ConnStateAuthenticated); err != nil {
+		t.Fatalf("SetState() error: %v", err)
+	}
+
+	tests := []struct {
+		conn    *Conn
+		input   string
+		want    []imap.SortCriterion
+		wantErr bool
+	}{
+		{conn, "(reverse date SUBJECT)", []imap.SortCriterion{{Key: imap.SortKeyDate, Reverse: true}, {Key: imap.SortKeySubject}}, false},
+		{conn, "(DISPLAYFROM)", nil, true},
+		{display, "(REVERSE DISPLAYFROM displayto)", []imap.SortCriterion{{Key: imap.SortKeyDisplayFrom, Reverse: true}, {Key: imap.SortKeyDisplayTo}}, false},
+		{display, "(NAME)", nil, true},
+		{conn, "()", nil, true},
+		{conn, "(REVERSE)", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ReadSortCriteria(tt.conn, wire.NewDecoder(strings.NewReader(tt.input)))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ReadSortCriteria(%q) = %v, want error", tt.input, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ReadSortCriteria(%q) error: %v", tt.input, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ReadSortCriteria(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/meszmate/imap-go/wire"
+)
+
+// memBudget tracks the memory used by responses being rendered on a
+// connection.
+type memBudget struct {
+	limit int64
+	used  atomic.Int64
+}
+
+// reserve reserves n bytes. It returns false if that would exceed the limit.
+func (b *memBudget) reserve(n int64) bool {
+	if b.used.Add(n) > b.limit {
+		b.used.Add(-n)
+		return false
+	}
+	return true
+}
+
+// release returns n reserved bytes to the budget.
+func (b *memBudget) release(n int64) {
+	b.used.Add(-n)
+}
+
+// spoolBuffer buffers a response in memory while the connection's memory
+// budget allows it and moves it to a temporary file once it does not.
+type spoolBuffer struct {
+	budget   *memBudget
+	dir      string
+	buf      bytes.Buffer
+	reserved int64
+	file     *os.File
+}
+
+func newSpoolBuffer(budget *memBudget, dir string) *spoolBuffer {
+	return &spoolBuffer{budget: budget, dir: dir}
+}
+
+func (s *spoolBuffer) Write(p []byte) (int, error) {
+	if s.file == nil {
+		if s.budget.reserve(int64(len(p))) {
+			s.reserved += int64(len(p))
+			return s.buf.Write(p)
+		}
+
+		f, err := os.CreateTemp(s.dir, "imap-spool-*")
+		if err != nil {
+			return 0, err
+		}
+		s.file = f
+		if _, err := s.buf.WriteTo(f); err != nil {
+			return 0, err
+		}
+		s.budget.release(s.reserved)
+		s.reserved = 0
+	}
+	return s.file.Write(p)
+}
+
+// spooled reports whether the buffer has been moved to a file.
+func (s *spoolBuffer) spooled() bool {
+	return s.file != nil
+}
+
+// WriteTo writes the buffered data to w.
+func (s *spoolBuffer) WriteTo(w io.Writer) (int64, error) {
+	if s.file == nil {
+		return s.buf.WriteTo(w)
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.Copy(w, s.file)
+}
+
+// Close releases the memory reservation and removes the spool file.
+func (s *spoolBuffer) Close() error {
+	s.budget.release(s.reserved)
+	s.reserved = 0
+	s.buf = bytes.Buffer{}
+	if s.file == nil {
+		return nil
+	}
+	name := s.file.Name()
+	err := s.file.Close()
+	if rerr := os.Remove(name); err == nil {
+		err = rerr
+	}
+	s.file = nil
+	return err
+}
+
+// encoderWriter adapts a wire.Encoder to io.Writer.
+type encoderWriter struct {
+	enc *wire.Encoder
+}
+
+func (w encoderWriter) Write(p []byte) (int, error) {
+	w.enc.Raw(p)
+	return len(p), nil
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/wire"
+)
+
+func TestSpoolBuffer(t *testing.T) {
+	budget := &memBudget{limit: 16}
+	sb := newSpoolBuffer(budget, t.TempDir())
+
+	data := strings.Repeat("0123456789", 10)
+	for i := 0; i < len(data); i += 7 {
+		end := i + 7
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := sb.Write([]byte(data[i:end])); err != nil {
+			t.Fatalf("Write() error: %v", err)
+		}
+	}
+	if !sb.spooled() {
+		t.Fatal("buffer exceeding the budget was not spooled")
+	}
+	if got := budget.used.Load(); got != 0 {
+		t.Errorf("budget used = %d after spooling, want 0", got)
+	}
+	name := sb.file.Name()
+
+	var out bytes.Buffer
+	if _, err := sb.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo() error: %v", err)
+	}
+	if out.String() != data {
+		t.Errorf("WriteTo() = %q, want %q", out.String(), data)
+	}
+
+	if err := sb.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("spool file %s still exists", name)
+	}
+}
+
+func TestSpoolBuffer_InMemory(t *testing.T) {
+	budget := &memBudget{limit: 64}
+	sb := newSpoolBuffer(budget, t.TempDir())
+
+	if _, err := sb.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if sb.spooled() {
+		t.Error("buffer within the budget was spooled")
+	}
+	if got := budget.used.Load(); got != 5 {
+		t.Errorf("budget used = %d, want 5", got)
+	}
+	_ = sb.Close()
+	if got := budget.used.Load(); got != 0 {
+		t.Errorf("budget used = %d after Close, want 0", got)
+	}
+}
+
+func TestFetchWriter_Spooled(t *testing.T) {
+	data := &imap.FetchMessageData{
+		SeqNum: 1,
+		UID:    42,
+		Flags:  []imap.Flag{imap.FlagSeen},
+		BodyStructure: &imap.BodyStructure{
+			Type:     "TEXT",
+			Subtype:  "PLAIN",
+			Params:   map[string]string{"CHARSET": strings.Repeat("x", 200)},
+			Encoding: "7BIT",
+			Size:     10,
+		},
+	}
+
+	var want bytes.Buffer
+	NewFetchWriter(NewResponseEncoder(wire.NewEncoder(&want))).WriteFetchData(data)
+
+	var got bytes.Buffer
+	re := NewResponseEncoder(wire.NewEncoder(&got))
+	re.budget = &memBudget{limit: 32}
+	re.spoolDir = t.TempDir()
+	w := NewFetchWriter(re)
+	w.WriteFetchData(data)
+	if err := w.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("spooled response = %q, want %q", got.String(), want.String())
+	}
+	if used := re.budget.used.Load(); used != 0 {
+		t.Errorf("budget used = %d after write, want 0", used)
+	}
+}
+
+func TestFetchWriter_SpoolError(t *testing.T) {
+	var out bytes.Buffer
+	re := NewResponseEncoder(wire.NewEncoder(&out))
+	re.budget = &memBudget{limit: 1}
+	re.spoolDir = "/nonexistent/spool/dir"
+	w := NewFetchWriter(re)
+	w.WriteFetchData(&imap.FetchMessageData{SeqNum: 1, UID: 1})
+	if w.Err() == nil {
+		t.Error("Err() = nil, want spool error")
+	}
+	if out.Len() != 0 {
+		t.Errorf("wrote %q after spool error, want nothing", out.String())
+	}
+}
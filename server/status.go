@@ -0,0 +1,126 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/wire"
+)
+
+// WriteStatusResponse writes a status response with a response code, for
+// example "A1 OK [APPENDUID 38505 3955] APPEND completed". tag is "*" for
+// an untagged response.
+//
+// args are the arguments of the response code, encoded by type:
+//
+//   - integers and imap.UID are written as numbers;
+//   - imap.Flag and imap.Cap are written as they are;
+//   - []imap.Flag and []string are written as parenthesized lists;
+//   - values implementing fmt.Stringer, such as *imap.UIDSet, are written
+//     using their String method;
+//   - other strings are written as atoms, or as quoted strings if they are
+//     not valid atoms.
+//
+// The response code policy and the Translator are applied as for the
+// other Write methods.
+func (c *Conn) WriteStatusResponse(tag string, typ imap.StatusResponseType, code imap.ResponseCode, text string, args ...any) {
+	c.writeStatus(tag, typ, code, text, args...)
+}
+
+// WriteOKCode writes a tagged OK response with a response code and its
+// arguments, see WriteStatusResponse.
+func (c *Conn) WriteOKCode(tag string, code imap.ResponseCode, text string, args ...any) {
+	c.writeStatus(tag, imap.StatusResponseTypeOK, code, text, args...)
+}
+
+// WriteNOCode writes a tagged NO response with a response code and its
+// arguments, see WriteStatusResponse.
+func (c *Conn) WriteNOCode(tag string, code imap.ResponseCode, text string, args ...any) {
+	c.writeStatus(tag, imap.StatusResponseTypeNO, code, text, args...)
+}
+
+// WriteBADCode writes a tagged BAD response with a response code and its
+// arguments, see WriteStatusResponse.
+func (c *Conn) WriteBADCode(tag string, code imap.ResponseCode, text string, args ...any) {
+	c.writeStatus(tag, imap.StatusResponseTypeBAD, code, text, args...)
+}
+
+// formatResponseCode returns the response code followed by its encoded
+// arguments.
+func formatResponseCode(code imap.ResponseCode, args []any) string {
+	if code == "" || len(args) == 0 {
+		return string(code)
+	}
+	var sb strings.Builder
+	sb.WriteString(string(code))
+	for _, arg := range args {
+		sb.WriteByte(' ')
+		writeCodeArg(&sb, arg)
+	}
+	return sb.String()
+}
+
+// writeCodeArg writes a response code argument, see WriteStatusResponse.
+func writeCodeArg(sb *strings.Builder, arg any) {
+	switch v := arg.(type) {
+	case string:
+		writeCodeString(sb, v)
+	case imap.Flag:
+		sb.WriteString(string(v))
+	case imap.Cap:
+		sb.WriteString(string(v))
+	case imap.UID:
+		sb.WriteString(strconv.FormatUint(uint64(v), 10))
+	case int:
+		sb.WriteString(strconv.Itoa(v))
+	case int64:
+		sb.WriteString(strconv.FormatInt(v, 10))
+	case uint32:
+		sb.WriteString(strconv.FormatUint(uint64(v), 10))
+	case uint64:
+		sb.WriteString(strconv.FormatUint(v, 10))
+	case []imap.Flag:
+		sb.WriteByte('(')
+		for i, f := range v {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(string(f))
+		}
+		sb.WriteByte(')')
+	case []string:
+		sb.WriteByte('(')
+		for i, s := range v {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			writeCodeString(sb, s)
+		}
+		sb.WriteByte(')')
+	case fmt.Stringer:
+		sb.WriteString(v.String())
+	default:
+		sb.WriteString(fmt.Sprint(v))
+	}
+}
+
+// writeCodeString writes a string argument as an atom if possible, or as a
+// quoted string. Line breaks cannot be encoded in a response code and are
+// replaced with spaces.
+func writeCodeString(sb *strings.Builder, s string) {
+	s = strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+	if !wire.NeedsQuoting(s) {
+		sb.WriteString(s)
+		return
+	}
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if wire.IsQuotedSpecial(s[i]) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(s[i])
+	}
+	sb.WriteByte('"')
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestFormatResponseCode(t *testing.T) {
+	uids, _ := imap.ParseUIDSet("1:3,7")
+	tests := []struct {
+		name string
+		code imap.ResponseCode
+		args []any
+		want string
+	}{
+		{"no code", "", []any{1}, ""},
+		{"no args", imap.ResponseCodeReadWrite, nil, "READ-WRITE"},
+		{"numbers", imap.ResponseCodeAppendUID, []any{uint32(38505), imap.UID(3955)}, "APPENDUID 38505 3955"},
+		{"set", imap.ResponseCodeCopyUID, []any{uint32(1), uids, "4:7"}, "COPYUID 1 1:3,7 4:7"},
+		{"flags", imap.ResponseCodePermanentFlags, []any{[]imap.Flag{imap.FlagSeen, imap.FlagWildcard}}, `PERMANENTFLAGS (\Seen \*)`},
+		{"string list", imap.ResponseCodeBadCharset, []any{[]string{"UTF-8", "ISO 8859-1"}}, `BADCHARSET (UTF-8 "ISO 8859-1")`},
+		{"quoted", "METADATA", []any{"LONGENTRIES", `a "b"]`}, `METADATA LONGENTRIES "a \"b\"]"`},
+		{"line break", "X", []any{"a\r\nb"}, `X "a  b"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatResponseCode(tt.code, tt.args); got != tt.want {
+				t.Errorf("formatResponseCode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConn_WriteCodeHelpers(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	conn := newConn(c1, New())
+
+	go func() {
+		conn.WriteOKCode("a1", imap.ResponseCodeAppendUID, "APPEND completed", uint32(5), imap.UID(9))
+		conn.WriteNOCode("a2", imap.ResponseCodeTryCreate, "no such mailbox")
+		conn.WriteBADCode("a3", imap.ResponseCodeClientBug, "bad argument")
+		conn.WriteStatusResponse("*", imap.StatusResponseTypeOK, imap.ResponseCodeUIDNext, "predicted", uint32(42))
+	}()
+
+	r := bufio.NewReader(c2)
+	for _, want := range []string{
+		"a1 OK [APPENDUID 5 9] APPEND completed\r\n",
+		"a2 NO [TRYCREATE] no such mailbox\r\n",
+		"a3 BAD [CLIENTBUG] bad argument\r\n",
+		"* OK [UIDNEXT 42] predicted\r\n",
+	} {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString() error: %v", err)
+		}
+		if line != want {
+			t.Errorf("got %q, want %q", line, want)
+		}
+	}
+}
@@ -0,0 +1,428 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// errNoSuchBlob is returned by the message stores of this package for
+// keys without a blob.
+var errNoSuchBlob = errors.New("storage: no such message blob")
+
+// MemMessageStore is a MessageStore keeping blobs in memory, for tests.
+type MemMessageStore struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+var _ MessageStore = (*MemMessageStore)(nil)
+
+// NewMemMessageStore creates an empty MemMessageStore.
+func NewMemMessageStore() *MemMessageStore {
+	return &MemMessageStore{blobs: make(map[string][]byte)}
+}
+
+// Put implements MessageStore.
+func (s *MemMessageStore) Put(ctx context.Context, key string, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = b
+	return nil
+}
+
+// Get implements MessageStore.
+func (s *MemMessageStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.blobs[key]
+	if !ok {
+		return nil, errNoSuchBlob
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+// Delete implements MessageStore.
+func (s *MemMessageStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, key)
+	return nil
+}
+
+// Len returns the number of stored blobs.
+func (s *MemMessageStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.blobs)
+}
+
+// DirMessageStore is a MessageStore keeping each blob in a file of a
+// directory.
+type DirMessageStore struct {
+	dir string
+}
+
+var _ MessageStore = (*DirMessageStore)(nil)
+
+// NewDirMessageStore creates a DirMessageStore for the directory dir,
+// which must exist.
+func NewDirMessageStore(dir string) *DirMessageStore {
+	return &DirMessageStore{dir: dir}
+}
+
+// Put implements MessageStore. The blob is written to a temporary file
+// that is renamed once complete, so that readers never see partial blobs.
+func (s *DirMessageStore) Put(ctx context.Context, key string, r io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.dir, ".put-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Get implements MessageStore.
+func (s *DirMessageStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errNoSuchBlob
+	}
+	return f, err
+}
+
+// Delete implements MessageStore.
+func (s *DirMessageStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// path returns the file of the blob stored under key.
+func (s *DirMessageStore) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, ".") || strings.ContainsAny(key, `/\`) {
+		return "", errors.New("storage: invalid blob key")
+	}
+	return filepath.Join(s.dir, key), nil
+}
+
+// MemSubscriptionStore is a SubscriptionStore keeping subscriptions in
+// memory, for tests.
+type MemSubscriptionStore struct {
+	mu    sync.Mutex
+	users map[string]map[string]bool
+}
+
+var _ SubscriptionStore = (*MemSubscriptionStore)(nil)
+
+// NewMemSubscriptionStore creates an empty MemSubscriptionStore.
+func NewMemSubscriptionStore() *MemSubscriptionStore {
+	return &MemSubscriptionStore{users: make(map[string]map[string]bool)}
+}
+
+// Subscriptions implements SubscriptionStore.
+func (s *MemSubscriptionStore) Subscriptions(ctx context.Context, user string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.users[user]))
+	for name := range s.users[user] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// SetSubscribed implements SubscriptionStore.
+func (s *MemSubscriptionStore) SetSubscribed(ctx context.Context, user, name string, subscribed bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !subscribed {
+		delete(s.users[user], name)
+		return nil
+	}
+	if s.users[user] == nil {
+		s.users[user] = make(map[string]bool)
+	}
+	s.users[user][name] = true
+	return nil
+}
+
+// MemMetadataStore is a MetadataStore keeping metadata in memory, for
+// tests. Every user has an INBOX.
+type MemMetadataStore struct {
+	mu          sync.Mutex
+	users       map[string]map[string]*memMailbox
+	uidValidity uint32
+}
+
+var _ MetadataStore = (*MemMetadataStore)(nil)
+
+type memMailbox struct {
+	info     MailboxInfo
+	messages []MessageInfo
+}
+
+// NewMemMetadataStore creates an empty MemMetadataStore.
+func NewMemMetadataStore() *MemMetadataStore {
+	return &MemMetadataStore{users: make(map[string]map[string]*memMailbox)}
+}
+
+// mailboxes returns the mailboxes of a user, creating the INBOX on first
+// use. The caller must hold s.mu.
+func (s *MemMetadataStore) mailboxes(user string) map[string]*memMailbox {
+	mboxes, ok := s.users[user]
+	if !ok {
+		mboxes = make(map[string]*memMailbox)
+		s.users[user] = mboxes
+		s.create(mboxes, "INBOX")
+	}
+	return mboxes
+}
+
+// create adds an empty mailbox. The caller must hold s.mu.
+func (s *MemMetadataStore) create(mboxes map[string]*memMailbox, name string) {
+	s.uidValidity++
+	mboxes[name] = &memMailbox{info: MailboxInfo{
+		Name:        name,
+		UIDValidity: s.uidValidity,
+		UIDNext:     1,
+	}}
+}
+
+// mailbox returns a mailbox of a user. The caller must hold s.mu.
+func (s *MemMetadataStore) mailbox(user, name string) (*memMailbox, error) {
+	mbox, ok := s.mailboxes(user)[name]
+	if !ok {
+		return nil, ErrNoSuchMailbox
+	}
+	return mbox, nil
+}
+
+// Mailboxes implements MetadataStore.
+func (s *MemMetadataStore) Mailboxes(ctx context.Context, user string) ([]MailboxInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var infos []MailboxInfo
+	for _, mbox := range s.mailboxes(user) {
+		infos = append(infos, mbox.info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+// Mailbox implements MetadataStore.
+func (s *MemMetadataStore) Mailbox(ctx context.Context, user, name string) (*MailboxInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mbox, err := s.mailbox(user, name)
+	if err != nil {
+		return nil, err
+	}
+	info := mbox.info
+	return &info, nil
+}
+
+// CreateMailbox implements MetadataStore.
+func (s *MemMetadataStore) CreateMailbox(ctx context.Context, user, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mboxes := s.mailboxes(user)
+	if _, ok := mboxes[name]; ok {
+		return ErrMailboxExists
+	}
+	s.create(mboxes, name)
+	return nil
+}
+
+// DeleteMailbox implements MetadataStore.
+func (s *MemMetadataStore) DeleteMailbox(ctx context.Context, user, name string) ([]MessageInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mbox, err := s.mailbox(user, name)
+	if err != nil {
+		return nil, err
+	}
+	if name == "INBOX" {
+		return nil, imap.ErrNo("cannot delete INBOX")
+	}
+	delete(s.users[user], name)
+	return mbox.messages, nil
+}
+
+// RenameMailbox implements MetadataStore.
+func (s *MemMetadataStore) RenameMailbox(ctx context.Context, user, name, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mbox, err := s.mailbox(user, name)
+	if err != nil {
+		return err
+	}
+	mboxes := s.users[user]
+	if _, ok := mboxes[newName]; ok {
+		return ErrMailboxExists
+	}
+	delete(mboxes, name)
+	mbox.info.Name = newName
+	mboxes[newName] = mbox
+	if name == "INBOX" {
+		// Renaming INBOX moves its messages and leaves it empty.
+		s.create(mboxes, "INBOX")
+	}
+	return nil
+}
+
+// Messages implements MetadataStore.
+func (s *MemMetadataStore) Messages(ctx context.Context, user, mailbox string) ([]MessageInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mbox, err := s.mailbox(user, mailbox)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]MessageInfo, len(mbox.messages))
+	for i, msg := range mbox.messages {
+		msgs[i] = copyMessageInfo(msg)
+	}
+	return msgs, nil
+}
+
+// AddMessage implements MetadataStore.
+func (s *MemMetadataStore) AddMessage(ctx context.Context, user, mailbox string, msg MessageInfo) (imap.UID, uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mbox, err := s.mailbox(user, mailbox)
+	if err != nil {
+		return 0, 0, err
+	}
+	msg = copyMessageInfo(msg)
+	msg.UID = mbox.info.UIDNext
+	mbox.info.UIDNext++
+	mbox.info.HighestModSeq++
+	msg.ModSeq = mbox.info.HighestModSeq
+	mbox.messages = append(mbox.messages, msg)
+	return msg.UID, mbox.info.UIDValidity, nil
+}
+
+// UpdateFlags implements MetadataStore.
+func (s *MemMetadataStore) UpdateFlags(ctx context.Context, user, mailbox string, uids []imap.UID, action imap.StoreAction, flags []imap.Flag) ([]MessageInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mbox, err := s.mailbox(user, mailbox)
+	if err != nil {
+		return nil, err
+	}
+	selected := make(map[imap.UID]bool, len(uids))
+	for _, uid := range uids {
+		selected[uid] = true
+	}
+
+	var updated []MessageInfo
+	for i := range mbox.messages {
+		msg := &mbox.messages[i]
+		if !selected[msg.UID] {
+			continue
+		}
+		newFlags := applyFlags(msg.Flags, action, flags)
+		if !sameFlags(newFlags, msg.Flags) {
+			msg.Flags = newFlags
+			mbox.info.HighestModSeq++
+			msg.ModSeq = mbox.info.HighestModSeq
+		}
+		updated = append(updated, copyMessageInfo(*msg))
+	}
+	return updated, nil
+}
+
+// RemoveMessages implements MetadataStore.
+func (s *MemMetadataStore) RemoveMessages(ctx context.Context, user, mailbox string, uids []imap.UID) ([]MessageInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mbox, err := s.mailbox(user, mailbox)
+	if err != nil {
+		return nil, err
+	}
+	remove := make(map[imap.UID]bool, len(uids))
+	for _, uid := range uids {
+		remove[uid] = true
+	}
+
+	var removed []MessageInfo
+	kept := mbox.messages[:0]
+	for _, msg := range mbox.messages {
+		if remove[msg.UID] {
+			removed = append(removed, msg)
+		} else {
+			kept = append(kept, msg)
+		}
+	}
+	mbox.messages = kept
+	if len(removed) > 0 {
+		mbox.info.HighestModSeq++
+	}
+	return removed, nil
+}
+
+// applyFlags returns the flags resulting from a STORE action.
+func applyFlags(current []imap.Flag, action imap.StoreAction, flags []imap.Flag) []imap.Flag {
+	var result []imap.Flag
+	switch action {
+	case imap.StoreFlagsSet:
+		for _, f := range flags {
+			if !hasFlag(result, f) {
+				result = append(result, f)
+			}
+		}
+	case imap.StoreFlagsAdd:
+		result = append(result, current...)
+		for _, f := range flags {
+			if !hasFlag(result, f) {
+				result = append(result, f)
+			}
+		}
+	case imap.StoreFlagsDel:
+		for _, f := range current {
+			if !hasFlag(flags, f) {
+				result = append(result, f)
+			}
+		}
+	}
+	return result
+}
+
+func copyMessageInfo(msg MessageInfo) MessageInfo {
+	msg.Flags = append([]imap.Flag(nil), msg.Flags...)
+	return msg
+}
@@ -0,0 +1,914 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/extensions/objectid"
+	"github.com/meszmate/imap-go/server"
+	"github.com/meszmate/imap-go/server/memserver"
+)
+
+// Delimiter is the hierarchy delimiter of mailbox names.
+const Delimiter = '/'
+
+// DefaultPollInterval is how often idling sessions check the metadata
+// store for changes when Backend.PollInterval is 0.
+const DefaultPollInterval = 30 * time.Second
+
+var (
+	mailboxFlags   = []imap.Flag{imap.FlagSeen, imap.FlagAnswered, imap.FlagFlagged, imap.FlagDeleted, imap.FlagDraft}
+	permanentFlags = append(append([]imap.Flag(nil), mailboxFlags...), imap.FlagWildcard)
+
+	errNotAuthenticated = imap.ErrNo("not authenticated")
+	errNoSelected       = imap.ErrNo("no mailbox selected")
+	errReadOnly         = imap.ErrNo("mailbox is read-only")
+	errNoSubscriptions  = imap.ErrNo("subscriptions are not supported")
+)
+
+// Backend composes a MessageStore and a MetadataStore into IMAP sessions.
+type Backend struct {
+	Messages MessageStore
+	Metadata MetadataStore
+	// Subscriptions stores the subscriptions of users. If nil, Metadata
+	// is used if it implements SubscriptionStore, and SUBSCRIBE fails
+	// otherwise.
+	Subscriptions SubscriptionStore
+
+	// Login checks the password of a user. If nil, LOGIN always fails.
+	Login func(username, password string) error
+
+	// PollInterval is how often idling sessions check for changes made by
+	// other sessions. If 0, DefaultPollInterval is used.
+	PollInterval time.Duration
+
+	// Structures caches the envelopes and body structures of messages,
+	// so that FETCH reads and parses a message once for all sessions. It
+	// may be shared with other backends. If nil, they are parsed for
+	// every FETCH.
+	Structures *imap.StructureCache
+}
+
+// NewSession creates a session, for use with server.WithNewSession.
+func (b *Backend) NewSession(conn *server.Conn) (server.Session, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Session{backend: b, ctx: ctx, cancel: cancel}, nil
+}
+
+// Session implements server.Session on top of a Backend. Store calls are
+// made with a context that is cancelled when the connection closes.
+type Session struct {
+	backend *Backend
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	user        string
+	mailbox     string
+	uidValidity uint32
+	selected    bool
+	readOnly    bool
+	// messages are the messages of the selected mailbox as last reported
+	// to the client; the sequence number of messages[i] is i+1.
+	messages []MessageInfo
+}
+
+var _ server.Session = (*Session)(nil)
+var _ server.SessionSearchWithContext = (*Session)(nil)
+
+// Close is called when the connection is closed.
+func (s *Session) Close() error {
+	s.cancel()
+	return nil
+}
+
+// Login authenticates the user with Backend.Login.
+func (s *Session) Login(username, password string) error {
+	if s.backend.Login == nil {
+		return imap.ErrNo("login not supported")
+	}
+	if err := s.backend.Login(username, password); err != nil {
+		return err
+	}
+	s.user = username
+	return nil
+}
+
+// LoginIdentity logs the session in as a user authenticated by the
+// server's AuthProvider, without calling Backend.Login.
+func (s *Session) LoginIdentity(identity server.Identity) error {
+	s.user = identity.Username
+	return nil
+}
+
+// Select opens a mailbox.
+func (s *Session) Select(mailbox string, options *imap.SelectOptions) (*imap.SelectData, error) {
+	if s.user == "" {
+		return nil, errNotAuthenticated
+	}
+	mailbox = imap.CanonicalMailboxName(mailbox)
+	info, err := s.backend.Metadata.Mailbox(s.ctx, s.user, mailbox)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := s.backend.Metadata.Messages(s.ctx, s.user, mailbox)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mailbox = mailbox
+	s.uidValidity = info.UIDValidity
+	s.selected = true
+	s.readOnly = options != nil && options.ReadOnly
+	s.messages = msgs
+
+	data := &imap.SelectData{
+		Flags:          mailboxFlags,
+		PermanentFlags: permanentFlags,
+		NumMessages:    uint32(len(msgs)),
+		UIDNext:        info.UIDNext,
+		UIDValidity:    info.UIDValidity,
+		HighestModSeq:  info.HighestModSeq,
+		ReadOnly:       s.readOnly,
+	}
+	for i, msg := range msgs {
+		if !hasFlag(msg.Flags, imap.FlagSeen) {
+			data.FirstUnseen = uint32(i + 1)
+			break
+		}
+	}
+	return data, nil
+}
+
+// Create creates a new mailbox.
+func (s *Session) Create(mailbox string, options *imap.CreateOptions) error {
+	if s.user == "" {
+		return errNotAuthenticated
+	}
+	return s.backend.Metadata.CreateMailbox(s.ctx, s.user, imap.CanonicalMailboxName(mailbox))
+}
+
+// Delete deletes a mailbox and the contents of its messages.
+func (s *Session) Delete(mailbox string) error {
+	if s.user == "" {
+		return errNotAuthenticated
+	}
+	mailbox = imap.CanonicalMailboxName(mailbox)
+	removed, err := s.backend.Metadata.DeleteMailbox(s.ctx, s.user, mailbox)
+	if err != nil {
+		return err
+	}
+	if s.selected && s.mailbox == mailbox {
+		_ = s.Unselect()
+	}
+	return s.deleteBlobs(removed)
+}
+
+// Rename renames a mailbox.
+func (s *Session) Rename(mailbox, newName string) error {
+	if s.user == "" {
+		return errNotAuthenticated
+	}
+	mailbox = imap.CanonicalMailboxName(mailbox)
+	newName = imap.CanonicalMailboxName(newName)
+	if err := s.backend.Metadata.RenameMailbox(s.ctx, s.user, mailbox, newName); err != nil {
+		return err
+	}
+	if s.selected && s.mailbox == mailbox {
+		s.mailbox = newName
+	}
+	return nil
+}
+
+// subscriptions returns the SubscriptionStore of the backend, or nil.
+func (b *Backend) subscriptions() SubscriptionStore {
+	if b.Subscriptions != nil {
+		return b.Subscriptions
+	}
+	subs, _ := b.Metadata.(SubscriptionStore)
+	return subs
+}
+
+// Subscribe subscribes to a mailbox, which must exist.
+func (s *Session) Subscribe(mailbox string) error {
+	if s.user == "" {
+		return errNotAuthenticated
+	}
+	subs := s.backend.subscriptions()
+	if subs == nil {
+		return errNoSubscriptions
+	}
+	mailbox = imap.CanonicalMailboxName(mailbox)
+	if _, err := s.backend.Metadata.Mailbox(s.ctx, s.user, mailbox); err != nil {
+		return err
+	}
+	return subs.SetSubscribed(s.ctx, s.user, mailbox, true)
+}
+
+// Unsubscribe unsubscribes from a mailbox, which may have been deleted
+// since.
+func (s *Session) Unsubscribe(mailbox string) error {
+	if s.user == "" {
+		return errNotAuthenticated
+	}
+	subs := s.backend.subscriptions()
+	if subs == nil {
+		return errNoSubscriptions
+	}
+	return subs.SetSubscribed(s.ctx, s.user, imap.CanonicalMailboxName(mailbox), false)
+}
+
+// List lists mailboxes matching the given patterns, merging the mailboxes
+// of the MetadataStore with the subscriptions of the SubscriptionStore.
+func (s *Session) List(w *server.ListWriter, ref string, patterns []string, options *imap.ListOptions) error {
+	if s.user == "" {
+		return errNotAuthenticated
+	}
+
+	// An empty pattern asks for the hierarchy delimiter.
+	if len(patterns) == 1 && patterns[0] == "" {
+		w.WriteList(&imap.ListData{Delim: Delimiter})
+		return nil
+	}
+
+	mailboxes, err := s.backend.Metadata.Mailboxes(s.ctx, s.user)
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(mailboxes))
+	for i, mbox := range mailboxes {
+		names[i] = mbox.Name
+	}
+	var subscriptions []string
+	if subs := s.backend.subscriptions(); subs != nil {
+		if subscriptions, err = subs.Subscriptions(s.ctx, s.user); err != nil {
+			return err
+		}
+	}
+
+	for _, data := range memserver.ListResponses(names, subscriptions, ref, patterns, options, Delimiter) {
+		w.WriteList(data)
+	}
+	return nil
+}
+
+// Status returns the status of a mailbox.
+func (s *Session) Status(mailbox string, options *imap.StatusOptions) (*imap.StatusData, error) {
+	if s.user == "" {
+		return nil, errNotAuthenticated
+	}
+	mailbox = imap.CanonicalMailboxName(mailbox)
+	info, err := s.backend.Metadata.Mailbox(s.ctx, s.user, mailbox)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := s.backend.Metadata.Messages(s.ctx, s.user, mailbox)
+	if err != nil {
+		return nil, err
+	}
+
+	var unseen, deleted uint32
+	var size int64
+	for _, msg := range msgs {
+		if !hasFlag(msg.Flags, imap.FlagSeen) {
+			unseen++
+		}
+		if hasFlag(msg.Flags, imap.FlagDeleted) {
+			deleted++
+		}
+		size += msg.Size
+	}
+
+	data := &imap.StatusData{Mailbox: info.Name}
+	if options.NumMessages {
+		n := uint32(len(msgs))
+		data.NumMessages = &n
+	}
+	if options.UIDNext {
+		n := uint32(info.UIDNext)
+		data.UIDNext = &n
+	}
+	if options.UIDValidity {
+		v := info.UIDValidity
+		data.UIDValidity = &v
+	}
+	if options.NumUnseen {
+		data.NumUnseen = &unseen
+	}
+	if options.NumRecent {
+		var n uint32
+		data.NumRecent = &n
+	}
+	if options.Size {
+		data.Size = &size
+	}
+	if options.NumDeleted {
+		data.NumDeleted = &deleted
+	}
+	if options.HighestModSeq {
+		n := info.HighestModSeq
+		data.HighestModSeq = &n
+	}
+	return data, nil
+}
+
+// Append stores the message in the message store and adds it to a
+// mailbox.
+func (s *Session) Append(mailbox string, r imap.LiteralReader, options *imap.AppendOptions) (*imap.AppendData, error) {
+	if s.user == "" {
+		return nil, errNotAuthenticated
+	}
+	mailbox = imap.CanonicalMailboxName(mailbox)
+	if _, err := s.backend.Metadata.Mailbox(s.ctx, s.user, mailbox); err != nil {
+		if errors.Is(err, ErrNoSuchMailbox) {
+			return nil, imap.ErrNoWithCode(imap.ResponseCodeTryCreate, "mailbox does not exist")
+		}
+		return nil, err
+	}
+
+	key, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+	cr := &countingReader{r: r}
+	if err := s.backend.Messages.Put(s.ctx, key, cr); err != nil {
+		return nil, err
+	}
+
+	msg := MessageInfo{Key: key, Size: cr.n, InternalDate: time.Now()}
+	if options != nil {
+		msg.Flags = options.Flags
+		if !options.InternalDate.IsZero() {
+			msg.InternalDate = options.InternalDate
+		}
+	}
+	uid, uidValidity, err := s.backend.Metadata.AddMessage(s.ctx, s.user, mailbox, msg)
+	if err != nil {
+		_ = s.backend.Messages.Delete(s.ctx, key)
+		return nil, err
+	}
+	return &imap.AppendData{UIDValidity: uidValidity, UID: uid}, nil
+}
+
+// Poll reports changes to the selected mailbox made by other sessions:
+// new messages, flag changes and, if allowExpunge is set, expunged
+// messages.
+func (s *Session) Poll(w *server.UpdateWriter, allowExpunge bool) error {
+	if !s.selected {
+		return nil
+	}
+	current, err := s.backend.Metadata.Messages(s.ctx, s.user, s.mailbox)
+	if err != nil {
+		return err
+	}
+	byUID := make(map[imap.UID]MessageInfo, len(current))
+	for _, msg := range current {
+		byUID[msg.UID] = msg
+	}
+
+	if allowExpunge {
+		// Expunge from the end, so that the sequence numbers of the
+		// messages not reported yet stay valid.
+		for i := len(s.messages) - 1; i >= 0; i-- {
+			if _, ok := byUID[s.messages[i].UID]; !ok {
+				w.WriteExpunge(uint32(i + 1))
+				s.messages = append(s.messages[:i], s.messages[i+1:]...)
+			}
+		}
+	}
+
+	var lastUID imap.UID
+	for i, msg := range s.messages {
+		lastUID = msg.UID
+		cur, ok := byUID[msg.UID]
+		if ok && cur.ModSeq != msg.ModSeq {
+			s.messages[i] = cur
+			if !sameFlags(cur.Flags, msg.Flags) {
+				w.WriteMessageFlags(uint32(i+1), cur.Flags)
+			}
+		}
+	}
+
+	n := len(s.messages)
+	for _, msg := range current {
+		if msg.UID > lastUID {
+			s.messages = append(s.messages, msg)
+		}
+	}
+	if len(s.messages) > n {
+		w.WriteExists(uint32(len(s.messages)))
+	}
+	return nil
+}
+
+// Idle polls the metadata store for changes every Backend.PollInterval
+// until stop is closed.
+func (s *Session) Idle(w *server.UpdateWriter, stop <-chan struct{}) error {
+	interval := s.backend.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Poll(w, true); err != nil {
+			return err
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Unselect closes the current mailbox without expunging.
+func (s *Session) Unselect() error {
+	s.mailbox = ""
+	s.selected = false
+	s.readOnly = false
+	s.messages = nil
+	return nil
+}
+
+// Expunge removes the messages marked as deleted, or those among uids if
+// uids is not nil, and deletes their contents.
+func (s *Session) Expunge(w *server.ExpungeWriter, uids *imap.UIDSet) error {
+	if !s.selected {
+		return errNoSelected
+	}
+	if s.readOnly {
+		return errReadOnly
+	}
+
+	current, err := s.backend.Metadata.Messages(s.ctx, s.user, s.mailbox)
+	if err != nil {
+		return err
+	}
+	var expunge []imap.UID
+	for _, msg := range current {
+		if hasFlag(msg.Flags, imap.FlagDeleted) && (uids == nil || uids.Contains(msg.UID)) {
+			expunge = append(expunge, msg.UID)
+		}
+	}
+	if len(expunge) == 0 {
+		return nil
+	}
+
+	removed, err := s.backend.Metadata.RemoveMessages(s.ctx, s.user, s.mailbox, expunge)
+	if err != nil {
+		return err
+	}
+	gone := make(map[imap.UID]bool, len(removed))
+	for _, msg := range removed {
+		gone[msg.UID] = true
+		s.backend.Structures.Invalidate(s.structureKey(msg.UID))
+	}
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if gone[s.messages[i].UID] {
+			w.WriteExpunge(uint32(i + 1))
+			s.messages = append(s.messages[:i], s.messages[i+1:]...)
+		}
+	}
+	return s.deleteBlobs(removed)
+}
+
+// Search searches for messages matching the criteria.
+func (s *Session) Search(kind server.NumKind, criteria *imap.SearchCriteria, options *imap.SearchOptions) (*imap.SearchData, error) {
+	return s.SearchWithContext(s.ctx, kind, criteria, options)
+}
+
+// SearchWithContext searches for messages matching the criteria until ctx
+// is done, and returns the matches found until then as incomplete results.
+// Message contents are only read if the criteria need them.
+func (s *Session) SearchWithContext(ctx context.Context, kind server.NumKind, criteria *imap.SearchCriteria, options *imap.SearchOptions) (*imap.SearchData, error) {
+	if !s.selected {
+		return nil, errNoSelected
+	}
+
+	data := &imap.SearchData{}
+	needBody := criteriaNeedBody(criteria)
+	var results []uint32
+	for i, info := range s.messages {
+		if ctx.Err() != nil {
+			data.Incomplete = true
+			break
+		}
+		msg, err := s.message(ctx, info, needBody)
+		if err != nil {
+			if ctx.Err() != nil {
+				data.Incomplete = true
+				break
+			}
+			return nil, err
+		}
+		seqNum := uint32(i + 1)
+		if !msg.Matches(seqNum, criteria) {
+			continue
+		}
+		if kind == server.NumKindUID {
+			results = append(results, uint32(info.UID))
+			data.AllUIDs = append(data.AllUIDs, info.UID)
+		} else {
+			results = append(results, seqNum)
+			data.AllSeqNums = append(data.AllSeqNums, seqNum)
+		}
+	}
+
+	// Results are in ascending order.
+	if options != nil && len(results) > 0 {
+		if options.ReturnCount {
+			data.Count = uint32(len(results))
+		}
+		if options.ReturnMin {
+			data.Min = results[0]
+		}
+		if options.ReturnMax {
+			data.Max = results[len(results)-1]
+		}
+		if options.ReturnAll {
+			ss := &imap.SeqSet{}
+			ss.AddNum(results...)
+			data.All = ss
+		}
+	}
+	return data, nil
+}
+
+// Fetch retrieves message data. Message contents are only read for the
+// items that need them.
+func (s *Session) Fetch(w *server.FetchWriter, numSet imap.NumSet, options *imap.FetchOptions) error {
+	if !s.selected {
+		return errNoSelected
+	}
+
+	cache := s.backend.Structures
+	needBody := options.EmailID || len(options.BodySection) > 0 ||
+		len(options.BinarySection) > 0 || len(options.BinarySizeSection) > 0
+	var seen []imap.UID
+	for _, i := range s.resolve(numSet) {
+		info := s.messages[i]
+		if options.ChangedSince > 0 && info.ModSeq <= options.ChangedSince {
+			continue
+		}
+
+		// The body is not read if the cache has the structures needed.
+		key := s.structureKey(info.UID)
+		var env *imap.Envelope
+		var bs *imap.BodyStructure
+		if options.Envelope {
+			env, _ = cache.Envelope(key)
+		}
+		if options.BodyStructure {
+			bs, _ = cache.BodyStructure(key)
+		}
+		withBody := needBody || (options.Envelope && env == nil) || (options.BodyStructure && bs == nil)
+		msg, err := s.message(s.ctx, info, withBody)
+		if err != nil {
+			return err
+		}
+
+		data := &imap.FetchMessageData{SeqNum: uint32(i + 1)}
+		if options.UID {
+			data.UID = info.UID
+		}
+		if options.Flags {
+			data.Flags = msg.CopyFlags()
+		}
+		if options.InternalDate {
+			data.InternalDate = info.InternalDate
+		}
+		if options.RFC822Size {
+			data.RFC822Size = info.Size
+		}
+		if options.Envelope {
+			if env == nil {
+				env = msg.ParseEnvelope()
+				cache.SetEnvelope(key, env)
+			}
+			data.Envelope = env
+		}
+		if options.BodyStructure {
+			if bs == nil {
+				bs = msg.ParseBodyStructure()
+				cache.SetBodyStructure(key, bs)
+			}
+			data.BodyStructure = bs
+		}
+		if options.EmailID {
+			data.EmailID = objectid.EmailID(msg.Body)
+		}
+		// CHANGEDSINCE implies MODSEQ (RFC 7162 §3.1.4.1).
+		if options.ModSeq || options.ChangedSince > 0 {
+			data.ModSeq = info.ModSeq
+		}
+
+		markSeen := false
+		if len(options.BodySection) > 0 {
+			data.BodySection = make(map[*imap.FetchItemBodySection]imap.SectionReader)
+			for _, section := range options.BodySection {
+				b := msg.Section(section)
+				data.BodySection[section] = imap.SectionReader{Reader: bytes.NewReader(b), Size: int64(len(b))}
+				markSeen = markSeen || !section.Peek
+			}
+		}
+		if len(options.BinarySection) > 0 {
+			data.BinarySection = make(map[*imap.FetchItemBinarySection]imap.SectionReader)
+			for _, section := range options.BinarySection {
+				b, err := msg.BinarySection(section.Part)
+				if err != nil {
+					return err
+				}
+				if p := section.Partial; p != nil {
+					b = partial(b, p.Offset, p.Count)
+				}
+				data.BinarySection[section] = imap.SectionReader{Reader: bytes.NewReader(b), Size: int64(len(b))}
+				markSeen = markSeen || !section.Peek
+			}
+		}
+		for _, part := range options.BinarySizeSection {
+			b, err := msg.BinarySection(part)
+			if err != nil {
+				return err
+			}
+			data.BinarySizeSection = append(data.BinarySizeSection, imap.BinarySizeData{Part: part, Size: uint32(len(b))})
+		}
+
+		if markSeen && !s.readOnly && !hasFlag(info.Flags, imap.FlagSeen) {
+			seen = append(seen, info.UID)
+		}
+		w.WriteFetchData(data)
+	}
+
+	if len(seen) > 0 {
+		updated, err := s.backend.Metadata.UpdateFlags(s.ctx, s.user, s.mailbox, seen, imap.StoreFlagsAdd, []imap.Flag{imap.FlagSeen})
+		if err != nil {
+			return err
+		}
+		s.update(updated)
+	}
+	return nil
+}
+
+// Store modifies message flags.
+func (s *Session) Store(w *server.FetchWriter, numSet imap.NumSet, flags *imap.StoreFlags, options *imap.StoreOptions) error {
+	if !s.selected {
+		return errNoSelected
+	}
+	if s.readOnly {
+		return errReadOnly
+	}
+
+	indexes := s.resolve(numSet)
+	uids := make([]imap.UID, len(indexes))
+	for j, i := range indexes {
+		uids[j] = s.messages[i].UID
+	}
+	updated, err := s.backend.Metadata.UpdateFlags(s.ctx, s.user, s.mailbox, uids, flags.Action, flags.Flags)
+	if err != nil {
+		return err
+	}
+	s.update(updated)
+
+	if !flags.Silent {
+		for _, i := range indexes {
+			w.WriteFlags(uint32(i+1), s.messages[i].Flags)
+		}
+	}
+	return nil
+}
+
+// Copy copies messages to another mailbox, storing a copy of their
+// contents.
+func (s *Session) Copy(numSet imap.NumSet, dest string) (*imap.CopyData, error) {
+	if !s.selected {
+		return nil, errNoSelected
+	}
+	dest = imap.CanonicalMailboxName(dest)
+	if _, err := s.backend.Metadata.Mailbox(s.ctx, s.user, dest); err != nil {
+		return nil, err
+	}
+
+	data := &imap.CopyData{}
+	for _, i := range s.resolve(numSet) {
+		info := s.messages[i]
+		key, err := newKey()
+		if err != nil {
+			return nil, err
+		}
+		if err := s.copyBlob(info.Key, key); err != nil {
+			return nil, err
+		}
+
+		var flags []imap.Flag
+		for _, f := range info.Flags {
+			if !strings.EqualFold(string(f), string(imap.FlagRecent)) {
+				flags = append(flags, f)
+			}
+		}
+		uid, uidValidity, err := s.backend.Metadata.AddMessage(s.ctx, s.user, dest, MessageInfo{
+			Key:          key,
+			Flags:        flags,
+			InternalDate: info.InternalDate,
+			Size:         info.Size,
+		})
+		if err != nil {
+			_ = s.backend.Messages.Delete(s.ctx, key)
+			return nil, err
+		}
+		data.UIDValidity = uidValidity
+		data.SourceUIDs.AddNum(info.UID)
+		data.DestUIDs.AddNum(uid)
+	}
+	return data, nil
+}
+
+// resolve returns the indexes in s.messages of the messages in numSet.
+func (s *Session) resolve(numSet imap.NumSet) []int {
+	_, byUID := numSet.(*imap.UIDSet)
+	var max uint32
+	if n := len(s.messages); n > 0 {
+		max = uint32(n)
+		if byUID {
+			max = uint32(s.messages[n-1].UID)
+		}
+	}
+
+	var indexes []int
+	for i, msg := range s.messages {
+		num := uint32(i + 1)
+		if byUID {
+			num = uint32(msg.UID)
+		}
+		for _, r := range numSet.Ranges() {
+			start, stop := r.Start, r.Stop
+			if start == 0 {
+				start = max
+			}
+			if stop == 0 {
+				stop = max
+			}
+			if start > stop {
+				start, stop = stop, start
+			}
+			if num >= start && num <= stop {
+				indexes = append(indexes, i)
+				break
+			}
+		}
+	}
+	return indexes
+}
+
+// update replaces the messages in s.messages with the updated ones of the
+// same UID.
+func (s *Session) update(updated []MessageInfo) {
+	byUID := make(map[imap.UID]MessageInfo, len(updated))
+	for _, msg := range updated {
+		byUID[msg.UID] = msg
+	}
+	for i, msg := range s.messages {
+		if u, ok := byUID[msg.UID]; ok {
+			s.messages[i] = u
+		}
+	}
+}
+
+// message returns info as a memserver.Message for matching and fetching,
+// with its contents read from the message store if withBody is set.
+func (s *Session) message(ctx context.Context, info MessageInfo, withBody bool) (*memserver.Message, error) {
+	msg := &memserver.Message{
+		UID:          info.UID,
+		Flags:        info.Flags,
+		InternalDate: info.InternalDate,
+		Size:         info.Size,
+		ModSeq:       info.ModSeq,
+	}
+	if !withBody {
+		return msg, nil
+	}
+	rc, err := s.backend.Messages.Get(ctx, info.Key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	msg.Body, err = io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// structureKey returns the key of a message of the selected mailbox in
+// Backend.Structures.
+func (s *Session) structureKey(uid imap.UID) imap.MessageKey {
+	return imap.MessageKey{Mailbox: s.user + "\x00" + s.mailbox, UIDValidity: s.uidValidity, UID: uid}
+}
+
+// copyBlob copies the blob stored under src to dst.
+func (s *Session) copyBlob(src, dst string) error {
+	if c, ok := s.backend.Messages.(MessageCopier); ok {
+		return c.Copy(s.ctx, src, dst)
+	}
+	rc, err := s.backend.Messages.Get(s.ctx, src)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return s.backend.Messages.Put(s.ctx, dst, rc)
+}
+
+// deleteBlobs deletes the contents of removed messages.
+func (s *Session) deleteBlobs(msgs []MessageInfo) error {
+	var errs []error
+	for _, msg := range msgs {
+		if err := s.backend.Messages.Delete(s.ctx, msg.Key); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// criteriaNeedBody reports whether matching criteria needs the message
+// contents.
+func criteriaNeedBody(criteria *imap.SearchCriteria) bool {
+	if criteria == nil {
+		return false
+	}
+	if len(criteria.Header) > 0 || len(criteria.Body) > 0 || len(criteria.Text) > 0 ||
+		!criteria.SentSince.IsZero() || !criteria.SentBefore.IsZero() || !criteria.SentOn.IsZero() {
+		return true
+	}
+	for i := range criteria.Not {
+		if criteriaNeedBody(&criteria.Not[i]) {
+			return true
+		}
+	}
+	for i := range criteria.Or {
+		if criteriaNeedBody(&criteria.Or[i][0]) || criteriaNeedBody(&criteria.Or[i][1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// newKey returns a random blob key.
+func newKey() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// partial returns the byte range of b starting at offset.
+func partial(b []byte, offset, count int64) []byte {
+	if offset >= int64(len(b)) {
+		return nil
+	}
+	end := offset + count
+	if end > int64(len(b)) {
+		end = int64(len(b))
+	}
+	return b[offset:end]
+}
+
+func hasFlag(flags []imap.Flag, flag imap.Flag) bool {
+	for _, f := range flags {
+		if strings.EqualFold(string(f), string(flag)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameFlags reports whether a and b contain the same flags.
+func sameFlags(a, b []imap.Flag) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, f := range a {
+		if !hasFlag(b, f) {
+			return false
+		}
+	}
+	return true
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,125 @@
+// Package storage implements an IMAP backend on top of two narrow storage
+// interfaces, so that production backends do not have to implement the
+// whole server.Session surface.
+//
+// Message contents are kept in a MessageStore, a blob store such as a
+// directory or an S3 bucket. Everything else, the mailboxes and the UIDs,
+// flags and mod-sequences of their messages, is kept in a MetadataStore,
+// typically a database. Backend composes the two into sessions:
+//
+//	backend := &storage.Backend{
+//		Messages: storage.NewDirMessageStore("/var/mail/blobs"),
+//		Metadata: db,
+//		Login:    users.Check,
+//	}
+//	srv := server.New(server.WithNewSession(backend.NewSession))
+//
+// Blobs are immutable: APPEND stores a new blob, COPY stores a copy of
+// it, unless the MessageStore implements MessageCopier, and EXPUNGE and
+// DELETE remove the blobs of the removed messages.
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+// Errors returned by MetadataStore implementations. They are IMAP errors,
+// so the session passes them on to the client unchanged.
+var (
+	// ErrNoSuchMailbox is returned for operations on a mailbox that does
+	// not exist.
+	ErrNoSuchMailbox error = imap.ErrNonExistent
+	// ErrMailboxExists is returned by CreateMailbox and RenameMailbox if
+	// the new mailbox exists already.
+	ErrMailboxExists error = imap.ErrAlreadyExists
+)
+
+// MessageStore stores message contents as blobs identified by keys chosen
+// by the session.
+type MessageStore interface {
+	// Put stores the blob read from r under key.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get returns a reader for the blob stored under key.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under key. Deleting a blob that does
+	// not exist is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// MessageCopier is an optional interface for message stores that can copy
+// a blob without reading it, such as with a server-side copy.
+type MessageCopier interface {
+	Copy(ctx context.Context, srcKey, dstKey string) error
+}
+
+// MailboxInfo describes a mailbox in a MetadataStore.
+type MailboxInfo struct {
+	Name        string
+	UIDValidity uint32
+	// UIDNext is the UID the next message added to the mailbox will get.
+	UIDNext imap.UID
+	// HighestModSeq is the highest mod-sequence of the mailbox, which is
+	// incremented for every change to it.
+	HighestModSeq uint64
+}
+
+// MessageInfo describes a message in a MetadataStore.
+type MessageInfo struct {
+	UID imap.UID
+	// Key is the key of the message contents in the MessageStore.
+	Key          string
+	Flags        []imap.Flag
+	InternalDate time.Time
+	Size         int64
+	// ModSeq is the mod-sequence of the last change to the message.
+	ModSeq uint64
+}
+
+// MetadataStore stores the mailboxes of users and the messages in them,
+// except for their contents. Implementations must be safe for concurrent
+// use, since every connection of a user uses the store.
+type MetadataStore interface {
+	// Mailboxes returns the mailboxes of a user.
+	Mailboxes(ctx context.Context, user string) ([]MailboxInfo, error)
+	// Mailbox returns a mailbox of a user, or ErrNoSuchMailbox.
+	Mailbox(ctx context.Context, user, name string) (*MailboxInfo, error)
+	// CreateMailbox creates an empty mailbox with a new UID validity.
+	CreateMailbox(ctx context.Context, user, name string) error
+	// DeleteMailbox deletes a mailbox and returns the messages it
+	// contained, whose blobs the session deletes.
+	DeleteMailbox(ctx context.Context, user, name string) ([]MessageInfo, error)
+	// RenameMailbox renames a mailbox, keeping its messages.
+	RenameMailbox(ctx context.Context, user, name, newName string) error
+
+	// Messages returns the messages in a mailbox, ordered by UID.
+	Messages(ctx context.Context, user, mailbox string) ([]MessageInfo, error)
+	// AddMessage adds a message to a mailbox, assigning it the next UID
+	// and a new mod-sequence, and returns the UID and the UID validity of
+	// the mailbox. The UID and ModSeq fields of msg are ignored.
+	AddMessage(ctx context.Context, user, mailbox string, msg MessageInfo) (uid imap.UID, uidValidity uint32, err error)
+	// UpdateFlags changes the flags of the messages with the given UIDs,
+	// assigning a new mod-sequence to the messages whose flags change, and
+	// returns the messages with their new flags. UIDs that do not exist
+	// are ignored.
+	UpdateFlags(ctx context.Context, user, mailbox string, uids []imap.UID, action imap.StoreAction, flags []imap.Flag) ([]MessageInfo, error)
+	// RemoveMessages removes the messages with the given UIDs from a
+	// mailbox and returns the removed messages. UIDs that do not exist
+	// are ignored.
+	RemoveMessages(ctx context.Context, user, mailbox string, uids []imap.UID) ([]MessageInfo, error)
+}
+
+// SubscriptionStore stores the names of the mailboxes users are
+// subscribed to. Subscriptions are independent of the mailboxes in the
+// MetadataStore: deleting or renaming a mailbox leaves them unchanged, and
+// subscriptions to mailboxes that no longer exist are listed with the
+// \NonExistent attribute.
+type SubscriptionStore interface {
+	// Subscriptions returns the mailbox names a user is subscribed to.
+	Subscriptions(ctx context.Context, user string) ([]string, error)
+	// SetSubscribed subscribes to or unsubscribes from a mailbox name.
+	SetSubscribed(ctx context.Context, user, name string, subscribed bool) error
+}
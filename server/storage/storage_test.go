@@ -0,0 +1,288 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/imaptest"
+	"github.com/meszmate/imap-go/server"
+	_ "github.com/meszmate/imap-go/server/commands"
+	"github.com/meszmate/imap-go/server/storage"
+)
+
+func newTestBackend(t *testing.T) (*storage.Backend, *imaptest.Harness) {
+	t.Helper()
+	backend := &storage.Backend{
+		Messages:      storage.NewMemMessageStore(),
+		Metadata:      storage.NewMemMetadataStore(),
+		Subscriptions: storage.NewMemSubscriptionStore(),
+		Login: func(username, password string) error {
+			if password != "secret" {
+				return imap.ErrNo("invalid credentials")
+			}
+			return nil
+		},
+	}
+	srv := server.New(server.WithNewSession(backend.NewSession), server.WithAllowInsecureAuth(true))
+	return backend, imaptest.NewHarness(t, srv)
+}
+
+func TestBackend(t *testing.T) {
+	backend, h := newTestBackend(t)
+	blobs := backend.Messages.(*storage.MemMessageStore)
+
+	c := h.Dial()
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	if err := c.Create("Archive"); err != nil {
+		t.Fatalf("Create() error: %v", err)
+	}
+
+	for _, msg := range []string{
+		"Subject: hello\r\n\r\nfirst message",
+		"Subject: world\r\n\r\nsecond message",
+	} {
+		if _, err := c.Append("INBOX", nil, []byte(msg)); err != nil {
+			t.Fatalf("Append() error: %v", err)
+		}
+	}
+	if blobs.Len() != 2 {
+		t.Errorf("stored %d blobs, want 2", blobs.Len())
+	}
+
+	data, err := c.Select("INBOX", nil)
+	if err != nil {
+		t.Fatalf("Select() error: %v", err)
+	}
+	if data.NumMessages != 2 || data.UIDNext != 3 {
+		t.Errorf("SelectData = %+v", data)
+	}
+
+	results, err := c.Search("SUBJECT world")
+	if err != nil {
+		t.Fatalf("Search() error: %v", err)
+	}
+	if len(results) != 1 || results[0] != 2 {
+		t.Errorf("Search() = %v, want [2]", results)
+	}
+
+	lines, err := c.Fetch("1", "(ENVELOPE BODY[TEXT])")
+	if err != nil {
+		t.Fatalf("Fetch() error: %v", err)
+	}
+	if got := strings.Join(lines, "\n"); !strings.Contains(got, `"hello"`) {
+		t.Errorf("Fetch() = %q", got)
+	}
+	results, err = c.Search("SEEN")
+	if err != nil {
+		t.Fatalf("Search() error: %v", err)
+	}
+	if len(results) != 1 || results[0] != 1 {
+		t.Errorf("SEEN after FETCH BODY[] = %v, want [1]", results)
+	}
+
+	copyData, err := c.Copy("1:2", "Archive")
+	if err != nil {
+		t.Fatalf("Copy() error: %v", err)
+	}
+	if copyData.DestUIDs.String() != "1:2" || blobs.Len() != 4 {
+		t.Errorf("COPYUID dest = %v, %d blobs", copyData.DestUIDs.String(), blobs.Len())
+	}
+
+	if err := c.Store("2", imap.StoreFlagsAdd, []imap.Flag{imap.FlagDeleted}, true); err != nil {
+		t.Fatalf("Store() error: %v", err)
+	}
+	if err := c.Expunge(); err != nil {
+		t.Fatalf("Expunge() error: %v", err)
+	}
+	if blobs.Len() != 3 {
+		t.Errorf("%d blobs after EXPUNGE, want 3", blobs.Len())
+	}
+
+	status, err := c.Status("Archive", &imap.StatusOptions{NumMessages: true, NumUnseen: true})
+	if err != nil {
+		t.Fatalf("Status() error: %v", err)
+	}
+	if *status.NumMessages != 2 || *status.NumUnseen != 1 {
+		t.Errorf("STATUS = %d messages, %d unseen", *status.NumMessages, *status.NumUnseen)
+	}
+}
+
+func TestBackend_Structures(t *testing.T) {
+	backend, h := newTestBackend(t)
+	backend.Structures = imap.NewStructureCache(1 << 20)
+
+	c := h.Dial()
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	if _, err := c.Append("INBOX", nil, []byte("Subject: cached\r\n\r\nbody")); err != nil {
+		t.Fatalf("Append() error: %v", err)
+	}
+	if _, err := c.Select("INBOX", nil); err != nil {
+		t.Fatalf("Select() error: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		lines, err := c.Fetch("1", "(ENVELOPE BODYSTRUCTURE)")
+		if err != nil {
+			t.Fatalf("Fetch() error: %v", err)
+		}
+		if got := strings.Join(lines, "\n"); !strings.Contains(got, `"cached"`) || !strings.Contains(got, `"text" "plain"`) {
+			t.Errorf("Fetch() = %q", got)
+		}
+	}
+	if stats := backend.Structures.Stats(); stats.Hits != 2 || stats.Entries != 2 {
+		t.Errorf("Stats() = %+v, want 2 hits and 2 entries", stats)
+	}
+
+	if err := c.Store("1", imap.StoreFlagsAdd, []imap.Flag{imap.FlagDeleted}, true); err != nil {
+		t.Fatalf("Store() error: %v", err)
+	}
+	if err := c.Expunge(); err != nil {
+		t.Fatalf("Expunge() error: %v", err)
+	}
+	if stats := backend.Structures.Stats(); stats.Entries != 0 {
+		t.Errorf("Stats() after EXPUNGE = %+v, want no entries", stats)
+	}
+}
+
+func TestBackend_Subscriptions(t *testing.T) {
+	_, h := newTestBackend(t)
+	c := h.Dial()
+	if err := c.Login("alice", "secret"); err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	if err := c.Subscribe("Archive"); err == nil {
+		t.Error("Subscribe() to a missing mailbox succeeded")
+	}
+	for _, name := range []string{"Archive", "Drafts"} {
+		if err := c.Create(name); err != nil {
+			t.Fatalf("Create() error: %v", err)
+		}
+		if err := c.Subscribe(name); err != nil {
+			t.Fatalf("Subscribe() error: %v", err)
+		}
+	}
+
+	// Deleting a mailbox keeps its subscription
+	if err := c.Delete("Archive"); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	list, err := c.ListSubscribed("", "*")
+	if err != nil {
+		t.Fatalf("ListSubscribed() error: %v", err)
+	}
+	var got []string
+	for _, data := range list {
+		got = append(got, fmt.Sprintf("%s %v", data.Mailbox, data.Attrs))
+	}
+	want := `Archive [\NonExistent \Subscribed] Drafts [\Subscribed]`
+	if strings.Join(got, " ") != want {
+		t.Errorf("ListSubscribed() = %q, want %q", got, want)
+	}
+
+	if err := c.Unsubscribe("Archive"); err != nil {
+		t.Fatalf("Unsubscribe() error: %v", err)
+	}
+	if list, _ := c.ListSubscribed("", "*"); len(list) != 1 {
+		t.Errorf("ListSubscribed() after Unsubscribe() returned %d mailboxes, want 1", len(list))
+	}
+}
+
+func TestBackend_Poll(t *testing.T) {
+	_, h := newTestBackend(t)
+
+	a := h.Dial()
+	if err := a.Login("bob", "secret"); err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	if _, err := a.Append("INBOX", nil, []byte("Subject: one\r\n\r\n")); err != nil {
+		t.Fatalf("Append() error: %v", err)
+	}
+	if _, err := a.Select("INBOX", nil); err != nil {
+		t.Fatalf("Select() error: %v", err)
+	}
+
+	b := h.Dial()
+	if err := b.Login("bob", "secret"); err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	if _, err := b.Append("INBOX", nil, []byte("Subject: two\r\n\r\n")); err != nil {
+		t.Fatalf("Append() error: %v", err)
+	}
+
+	if err := a.Noop(); err != nil {
+		t.Fatalf("Noop() error: %v", err)
+	}
+	results, err := a.Search("ALL")
+	if err != nil {
+		t.Fatalf("Search() error: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Search() after NOOP = %v, want the new message", results)
+	}
+}
+
+func TestDirMessageStore(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewDirMessageStore(t.TempDir())
+
+	if err := store.Put(ctx, "abc", strings.NewReader("message")); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	rc, err := store.Get(ctx, "abc")
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	b, _ := io.ReadAll(rc)
+	_ = rc.Close()
+	if string(b) != "message" {
+		t.Errorf("Get() = %q", b)
+	}
+
+	if err := store.Delete(ctx, "abc"); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	if err := store.Delete(ctx, "abc"); err != nil {
+		t.Errorf("Delete() of a missing blob: %v", err)
+	}
+	if _, err := store.Get(ctx, "abc"); err == nil {
+		t.Error("Get() of a deleted blob succeeded")
+	}
+	if err := store.Put(ctx, "../escape", strings.NewReader("x")); err == nil {
+		t.Error("Put() accepted a key with a path")
+	}
+}
+
+func TestMemMetadataStore_Mailboxes(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemMetadataStore()
+
+	if err := store.CreateMailbox(ctx, "alice", "INBOX"); !errors.Is(err, storage.ErrMailboxExists) {
+		t.Errorf("CreateMailbox(INBOX) = %v, want ErrMailboxExists", err)
+	}
+	if _, err := store.Mailbox(ctx, "alice", "Nope"); !errors.Is(err, storage.ErrNoSuchMailbox) {
+		t.Errorf("Mailbox() = %v, want ErrNoSuchMailbox", err)
+	}
+
+	uid, _, err := store.AddMessage(ctx, "alice", "INBOX", storage.MessageInfo{Key: "k1"})
+	if err != nil || uid != 1 {
+		t.Fatalf("AddMessage() = %d, %v", uid, err)
+	}
+	updated, err := store.UpdateFlags(ctx, "alice", "INBOX", []imap.UID{1, 9}, imap.StoreFlagsAdd, []imap.Flag{imap.FlagSeen})
+	if err != nil || len(updated) != 1 || updated[0].ModSeq != 2 {
+		t.Fatalf("UpdateFlags() = %+v, %v", updated, err)
+	}
+	// Unchanged flags keep the mod-sequence.
+	updated, _ = store.UpdateFlags(ctx, "alice", "INBOX", []imap.UID{1}, imap.StoreFlagsAdd, []imap.Flag{`\seen`})
+	if updated[0].ModSeq != 2 {
+		t.Errorf("ModSeq = %d after a no-op store, want 2", updated[0].ModSeq)
+	}
+}
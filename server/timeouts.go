@@ -0,0 +1,82 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// SetReadTimeout sets the deadline of the following reads from the
+// connection to d from now, or removes it if d is 0. The server sets the
+// deadlines described in Options before running a handler; handlers that
+// wait for the client for longer, such as IDLE, extend them.
+func (c *Conn) SetReadTimeout(d time.Duration) {
+	c.mu.Lock()
+	netConn := c.netConn
+	c.mu.Unlock()
+	if d > 0 {
+		_ = netConn.SetReadDeadline(time.Now().Add(d))
+	} else {
+		_ = netConn.SetReadDeadline(time.Time{})
+	}
+}
+
+// errCommandTimeout is returned by dispatch when reading the data of a
+// command timed out.
+var errCommandTimeout = errors.New("timed out reading command data")
+
+// isTimeout reports whether err is a network timeout.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// deadlineWriter sets the write deadline of a connection before each
+// write, see Options.WriteTimeout, and closes the connection when a write
+// times out, so that the goroutines blocked on it return.
+type deadlineWriter struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (w *deadlineWriter) Write(p []byte) (int, error) {
+	_ = w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	n, err := w.conn.Write(p)
+	if err != nil && isTimeout(err) {
+		_ = w.conn.Close()
+	}
+	return n, err
+}
+
+// timeoutWriter returns conn with the write timeout of the server applied.
+func (c *Conn) timeoutWriter(conn net.Conn) io.Writer {
+	if d := c.server.options.WriteTimeout; d > 0 {
+		return &deadlineWriter{conn: conn, timeout: d}
+	}
+	return conn
+}
+
+// literalTimeoutReader reads literal data from a connection, allowing
+// Options.LiteralTimeout for each read. Between reads, and once the
+// literal has been read, Options.ReadTimeout applies again.
+type literalTimeoutReader struct {
+	c *Conn
+	r io.Reader
+}
+
+// withLiteralTimeout returns r, which reads a literal from c, with the
+// literal timeout applied.
+func (c *Conn) withLiteralTimeout(r io.Reader) io.Reader {
+	return &literalTimeoutReader{c: c, r: r}
+}
+
+func (lr *literalTimeoutReader) Read(p []byte) (int, error) {
+	lr.c.SetReadTimeout(lr.c.server.options.LiteralTimeout)
+	n, err := lr.r.Read(p)
+	if err != nil && isTimeout(err) {
+		lr.c.readTimedOut.Store(true)
+	}
+	lr.c.SetReadTimeout(lr.c.server.options.ReadTimeout)
+	return n, err
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveTimeouts serves a connection with the timeouts set by configure
+// and returns the client side. The PUT command reads a literal and
+// answers with its content.
+func serveTimeouts(t *testing.T, configure func(o *Options)) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	srv := New()
+	srv.options.AutologoutPreAuth = 0
+	configure(srv.options)
+	srv.dispatcher.RegisterFunc("PING", func(ctx *CommandContext) error {
+		ctx.Conn.WriteOK(ctx.Tag, "PONG")
+		return nil
+	})
+	srv.dispatcher.RegisterFunc("PUT", func(ctx *CommandContext) error {
+		ctx.Conn.WriteContinuation("go ahead")
+		data, err := io.ReadAll(ctx.Conn.ReadLiteral(ctx.Name, 4))
+		if err != nil {
+			return err
+		}
+		if _, err := ctx.Conn.Decoder().ReadLine(); err != nil {
+			return err
+		}
+		ctx.Conn.WriteOK(ctx.Tag, string(data))
+		return nil
+	})
+
+	c1, c2 := net.Pipe()
+	t.Cleanup(func() { c2.Close() })
+	go newConn(c1, srv).serve()
+
+	_ = c2.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(c2)
+	if _, err := r.ReadString('\n'); err != nil {
+		t.Fatalf("reading greeting: %v", err)
+	}
+	return c2, r
+}
+
+// expectBYE reads the BYE ending a connection and checks that it is
+// closed.
+func expectBYE(t *testing.T, r *bufio.Reader, want string) {
+	t.Helper()
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("ReadString() error: %v", err)
+	}
+	if line != "* BYE "+want+"\r\n" {
+		t.Errorf("got %q, want BYE %s", line, want)
+	}
+	if line, err := r.ReadString('\n'); err == nil {
+		t.Errorf("connection still open, read %q", line)
+	}
+}
+
+func TestConn_ReadTimeout(t *testing.T) {
+	c, r := serveTimeouts(t, func(o *Options) { o.ReadTimeout = 50 * time.Millisecond })
+
+	// Waiting for a command is not limited by the read timeout
+	time.Sleep(100 * time.Millisecond)
+	if _, err := c.Write([]byte("a1 PING\r\n")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if line, _ := r.ReadString('\n'); line != "a1 OK PONG\r\n" {
+		t.Errorf("got %q", line)
+	}
+
+	// But receiving the rest of a command is
+	if _, err := c.Write([]byte("a2 PI")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	expectBYE(t, r, "Timed out reading command")
+}
+
+func TestConn_LiteralTimeout(t *testing.T) {
+	c, r := serveTimeouts(t, func(o *Options) { o.LiteralTimeout = 80 * time.Millisecond })
+
+	// A slow literal that keeps making progress is received
+	if _, err := c.Write([]byte("a1 PUT {4}\r\n")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if line, _ := r.ReadString('\n'); !strings.HasPrefix(line, "+ ") {
+		t.Fatalf("got %q, want a continuation request", line)
+	}
+	for _, b := range []string{"a", "b", "c", "d\r\n"} {
+		time.Sleep(40 * time.Millisecond)
+		if _, err := c.Write([]byte(b)); err != nil {
+			t.Fatalf("Write() error: %v", err)
+		}
+	}
+	if line, _ := r.ReadString('\n'); line != "a1 OK abcd\r\n" {
+		t.Errorf("got %q", line)
+	}
+
+	// A stalled one is not
+	if _, err := c.Write([]byte("a2 PUT {4}\r\n")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if line, _ := r.ReadString('\n'); !strings.HasPrefix(line, "+ ") {
+		t.Fatalf("got %q, want a continuation request", line)
+	}
+	if _, err := c.Write([]byte("ab")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	expectBYE(t, r, "Timed out reading command")
+}
+
+func TestConn_WriteTimeout(t *testing.T) {
+	c, _ := serveTimeouts(t, func(o *Options) { o.WriteTimeout = 50 * time.Millisecond })
+
+	// The client sends commands but does not read the responses: the
+	// server gives up on the connection instead of blocking forever.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, err := c.Write([]byte("a PING\r\n")); err != nil {
+				return
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection not closed after the write timeout")
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/meszmate/imap-go/wire"
+)
+
+func TestWithWireTrace(t *testing.T) {
+	var mu sync.Mutex
+	var trace strings.Builder
+	srv := New(WithWireTrace(func(conn *Conn, dir wire.Direction, data []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(&trace, "%s:%s", dir, data)
+	}))
+
+	c1, c2 := net.Pipe()
+	t.Cleanup(func() { c2.Close() })
+	conn := newConn(c1, srv)
+	done := make(chan struct{})
+	go func() {
+		conn.serve()
+		close(done)
+	}()
+
+	r := bufio.NewReader(c2)
+	if _, err := r.ReadString('\n'); err != nil {
+		t.Fatalf("reading greeting: %v", err)
+	}
+	fmt.Fprint(c2, "A1 NOOP\r\n")
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("ReadString() error: %v", err)
+	}
+	c2.Close()
+	<-done
+
+	mu.Lock()
+	got := trace.String()
+	mu.Unlock()
+	if !strings.HasPrefix(got, "write:* OK [CAPABILITY ") {
+		t.Errorf("trace does not start with the greeting: %q", got)
+	}
+	if !strings.Contains(got, "read:A1 NOOP\r\n") || !strings.HasSuffix(got, "write:"+line) {
+		t.Errorf("trace = %q", got)
+	}
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// BytesRead returns the number of bytes read from the client, including
+// literals, since the connection was accepted. Bytes are counted as they
+// are read from the network, so the count can include the start of the
+// next command of a client that pipelines commands.
+func (c *Conn) BytesRead() int64 {
+	return c.bytesRead.Load()
+}
+
+// BytesWritten returns the number of bytes of responses written to the
+// client since the connection was accepted.
+func (c *Conn) BytesWritten() int64 {
+	return c.bytesWritten.Load()
+}
+
+// countingWriter counts the bytes written to w in n.
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n.Add(int64(n))
+	return n, err
+}
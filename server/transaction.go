@@ -0,0 +1,47 @@
+package server
+
+// SessionTransaction is an optional interface for sessions that can run
+// several backend operations as one transaction, such as a session of a
+// SQL backend. The server calls Begin and then Commit or Rollback around
+// the operations of commands that compose several of them:
+//
+//   - CLOSE: expunging and closing the mailbox
+//   - MOVE, for sessions that do not implement SessionMove: copying the
+//     messages, flagging them \Deleted and expunging them
+//   - APPEND of several messages (MULTIAPPEND, RFC 3502), for sessions
+//     that do not implement it atomically themselves: appending each
+//     message
+//
+// Transactions are not nested: the session methods called in a
+// transaction do not begin another one.
+type SessionTransaction interface {
+	// Begin starts a transaction for the command with the given name,
+	// such as "CLOSE". If it fails, the command fails with its error.
+	Begin(command string) error
+	// Commit commits the transaction. If it fails, the command fails
+	// with its error.
+	Commit() error
+	// Rollback aborts the transaction after an operation failed.
+	Rollback() error
+}
+
+// InTransaction runs fn in a transaction of the session if it implements
+// SessionTransaction, see there, and otherwise just runs fn. The
+// transaction is committed if fn returns nil and rolled back otherwise;
+// fn's error is returned, and that of Rollback is logged.
+func (ctx *CommandContext) InTransaction(fn func() error) error {
+	tx, ok := ctx.Session.(SessionTransaction)
+	if !ok {
+		return fn()
+	}
+	if err := tx.Begin(ctx.Name); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			ctx.Conn.logger.Error("rolling back transaction", "command", ctx.Name, "error", rerr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
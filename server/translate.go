@@ -0,0 +1,39 @@
+package server
+
+import (
+	imap "github.com/meszmate/imap-go"
+)
+
+// Translator localizes the human-readable text of a response for a
+// connection. Response codes are passed for context and are never
+// translated. Use Conn.Language to find the language negotiated by the
+// client.
+type Translator func(conn *Conn, typ imap.StatusResponseType, code imap.ResponseCode, text string) string
+
+// translate localizes the text of NO, BAD and BYE responses and of
+// ALERT response codes.
+func (c *Conn) translate(typ imap.StatusResponseType, code imap.ResponseCode, text string) string {
+	tr := c.server.options.Translator
+	if tr == nil {
+		return text
+	}
+	if typ == imap.StatusResponseTypeOK && code != imap.ResponseCodeAlert {
+		return text
+	}
+	return tr(c, typ, code, text)
+}
+
+// Language returns the language negotiated for the connection, such as
+// with the LANGUAGE command (RFC 5255). It is empty if none was set.
+func (c *Conn) Language() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.language
+}
+
+// SetLanguage sets the language used for user-visible response text.
+func (c *Conn) SetLanguage(tag string) {
+	c.mu.Lock()
+	c.language = tag
+	c.mu.Unlock()
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+)
+
+func TestTranslator(t *testing.T) {
+	german := map[string]string{
+		"no such mailbox":    "Postfach existiert nicht",
+		"mailbox is full":    "Postfach ist voll",
+		"LOGOUT completed":   "Abgemeldet",
+		"server maintenance": "Wartungsarbeiten",
+	}
+	srv := New(WithTranslator(func(conn *Conn, typ imap.StatusResponseType, code imap.ResponseCode, text string) string {
+		if conn.Language() != "de" {
+			return text
+		}
+		if tr, ok := german[text]; ok {
+			return tr
+		}
+		return text
+	}))
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	conn := newConn(c1, srv)
+	conn.SetLanguage("de")
+
+	go func() {
+		conn.WriteNO("A1", "no such mailbox")
+		conn.WriteOK("A2", "LOGOUT completed")
+		conn.WriteOKCode("A3", "ALERT", "server maintenance")
+		conn.writeStatus("A4", imap.StatusResponseTypeNO, imap.ResponseCodeOverQuota, "mailbox is full")
+	}()
+
+	r := bufio.NewReader(c2)
+	for _, want := range []string{
+		"A1 NO Postfach existiert nicht\r\n",
+		"A2 OK LOGOUT completed\r\n",
+		"A3 OK [ALERT] Wartungsarbeiten\r\n",
+		"A4 NO [OVERQUOTA] Postfach ist voll\r\n",
+	} {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString() error: %v", err)
+		}
+		if line != want {
+			t.Errorf("got %q, want %q", line, want)
+		}
+	}
+}
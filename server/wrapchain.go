@@ -0,0 +1,184 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/meszmate/imap-go/extension"
+)
+
+// HandlerLayer is one layer of the handler chain of a command, as installed
+// by extensions.
+type HandlerLayer struct {
+	// Extension is the name of the extension that installed the layer, or
+	// empty for the built-in handler.
+	Extension string
+	// Wrapper is set if the layer wraps the layer below it, and unset if it
+	// is the handler registered for the command.
+	Wrapper bool
+	// Described is set if the extension implements extension.WrapDescriber,
+	// in which case Info describes the wrapper.
+	Described bool
+	Info      extension.WrapInfo
+}
+
+// ExtensionConflict is a pair of extensions whose handlers of a command do
+// not compose, so that one of them is not called or parses arguments the
+// other has already consumed.
+type ExtensionConflict struct {
+	Command string
+	// Extension is the extension whose wrapper causes the conflict.
+	Extension string
+	// Other is the extension of the affected layer, or empty for the
+	// built-in handler.
+	Other string
+	// Reason explains the conflict.
+	Reason string
+}
+
+// Error implements error.
+func (c ExtensionConflict) Error() string {
+	return fmt.Sprintf("%s: %s", c.Command, c.Reason)
+}
+
+// HandlerChain returns the layers of the handler of a command, innermost
+// first, as installed by the built-in handlers and extensions. Handlers
+// registered or wrapped with Handle and WrapHandler are not included. It
+// returns nil if no handler is registered for the command.
+func (srv *Server) HandlerChain(command string) []HandlerLayer {
+	command = strings.ToUpper(command)
+	if srv.dispatcher.Get(command) == nil {
+		return nil
+	}
+	chain, ok := srv.chains[command]
+	if !ok {
+		return []HandlerLayer{{}}
+	}
+	result := make([]HandlerLayer, len(chain))
+	copy(result, chain)
+	return result
+}
+
+// ExtensionConflicts returns the handler chains that break the composition
+// contract of extension.WrapDescriber, sorted by command:
+//
+//   - a wrapper that replaces the command hides the wrappers below it that
+//     it does not supersede, and
+//   - a wrapper that consumes arguments before calling the layer below it
+//     makes that layer parse them again.
+//
+// Conflicts are logged when the server is created; with
+// Options.StrictExtensions, Serve refuses to start if there are any.
+func (srv *Server) ExtensionConflicts() []ExtensionConflict {
+	commands := make([]string, 0, len(srv.chains))
+	for command := range srv.chains {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+
+	var conflicts []ExtensionConflict
+	for _, command := range commands {
+		conflicts = append(conflicts, chainConflicts(command, srv.chains[command])...)
+	}
+	return conflicts
+}
+
+// chainConflicts returns the conflicts in the handler chain of a command.
+func chainConflicts(command string, chain []HandlerLayer) []ExtensionConflict {
+	var conflicts []ExtensionConflict
+	hidden := make([]bool, len(chain))
+	for i, outer := range chain {
+		if !outer.Wrapper || !outer.Described || hidden[i] {
+			continue
+		}
+
+		if len(outer.Info.Parses) > 0 && i > 0 {
+			inner := chain[i-1]
+			conflicts = append(conflicts, ExtensionConflict{
+				Command:   command,
+				Extension: outer.Extension,
+				Other:     inner.Extension,
+				Reason: fmt.Sprintf("%s consumes the %s before calling %s, which parses the arguments again",
+					outer.Extension, strings.Join(outer.Info.Parses, " and "), layerName(inner)),
+			})
+		}
+
+		if !outer.Info.Replaces {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			inner := chain[j]
+			if !inner.Wrapper || hidden[j] || inner.Extension == outer.Extension {
+				continue
+			}
+			if containsString(outer.Info.Supersedes, inner.Extension) {
+				continue
+			}
+			hidden[j] = true
+			conflicts = append(conflicts, ExtensionConflict{
+				Command:   command,
+				Extension: outer.Extension,
+				Other:     inner.Extension,
+				Reason: fmt.Sprintf("%s replaces the handler without calling the wrapper of %s installed before it",
+					outer.Extension, inner.Extension),
+			})
+		}
+	}
+	return conflicts
+}
+
+// recordHandler records that ext registered the handler of a command,
+// which starts a new chain.
+func (srv *Server) recordHandler(command string, ext extension.ServerExtension) {
+	if srv.chains == nil {
+		srv.chains = make(map[string][]HandlerLayer)
+	}
+	srv.chains[strings.ToUpper(command)] = []HandlerLayer{{Extension: ext.Name()}}
+}
+
+// recordWrapper records that ext wrapped the handler of a command.
+func (srv *Server) recordWrapper(command string, ext extension.ServerExtension) {
+	if srv.chains == nil {
+		srv.chains = make(map[string][]HandlerLayer)
+	}
+	command = strings.ToUpper(command)
+	chain, ok := srv.chains[command]
+	if !ok {
+		chain = []HandlerLayer{{}}
+	}
+	layer := HandlerLayer{Extension: ext.Name(), Wrapper: true}
+	if d, ok := ext.(extension.WrapDescriber); ok {
+		layer.Described = true
+		layer.Info = d.DescribeWrap(command)
+	}
+	srv.chains[command] = append(chain, layer)
+}
+
+// extensionConflictsError returns the extension conflicts as an error, or
+// nil if there are none.
+func (srv *Server) extensionConflictsError() error {
+	var errs []error
+	for _, c := range srv.ExtensionConflicts() {
+		errs = append(errs, c)
+	}
+	return errors.Join(errs...)
+}
+
+// layerName returns the name of a layer for conflict messages.
+func layerName(layer HandlerLayer) string {
+	if layer.Extension == "" {
+		return "the built-in handler"
+	}
+	return layer.Extension
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/meszmate/imap-go/extension"
+)
+
+type describedExtension struct {
+	testExtension
+	info extension.WrapInfo
+}
+
+func (e *describedExtension) DescribeWrap(command string) extension.WrapInfo { return e.info }
+
+func newWrapExtension(name string, info *extension.WrapInfo) extension.ServerExtension {
+	ext := testExtension{
+		BaseExtension: extension.BaseExtension{ExtName: name},
+		wrap: func(command string, handler interface{}) interface{} {
+			if command != "FETCH" {
+				return nil
+			}
+			return handler
+		},
+	}
+	if info == nil {
+		return &ext
+	}
+	return &describedExtension{testExtension: ext, info: *info}
+}
+
+// newChainServer returns a server with FETCH and NOOP handlers and the
+// given extensions installed.
+func newChainServer(strict bool, exts ...extension.ServerExtension) *Server {
+	options := DefaultOptions()
+	options.Extensions = exts
+	options.StrictExtensions = strict
+	srv := &Server{
+		options:    options,
+		dispatcher: NewDispatcher(),
+		conns:      make(map[*Conn]struct{}),
+		shutdown:   make(chan struct{}),
+	}
+	noop := CommandHandlerFunc(func(ctx *CommandContext) error { return nil })
+	srv.Dispatcher().Register("FETCH", noop)
+	srv.Dispatcher().Register("NOOP", noop)
+	srv.installExtensions()
+	return srv
+}
+
+func TestHandlerChain(t *testing.T) {
+	srv := newChainServer(false,
+		newWrapExtension("PEEK", &extension.WrapInfo{}),
+		newWrapExtension("OPAQUE", nil),
+	)
+
+	chain := srv.HandlerChain("fetch")
+	if len(chain) != 3 {
+		t.Fatalf("HandlerChain(FETCH) = %+v, want 3 layers", chain)
+	}
+	if chain[0].Extension != "" || chain[0].Wrapper {
+		t.Errorf("layer 0 = %+v, want built-in handler", chain[0])
+	}
+	if chain[1].Extension != "PEEK" || !chain[1].Wrapper || !chain[1].Described {
+		t.Errorf("layer 1 = %+v, want described PEEK wrapper", chain[1])
+	}
+	if chain[2].Extension != "OPAQUE" || chain[2].Described {
+		t.Errorf("layer 2 = %+v, want undescribed OPAQUE wrapper", chain[2])
+	}
+	if chain := srv.HandlerChain("NOOP"); len(chain) != 1 || chain[0].Wrapper {
+		t.Errorf("HandlerChain(NOOP) = %+v, want built-in handler only", chain)
+	}
+	if chain := srv.HandlerChain("XUNKNOWN"); chain != nil {
+		t.Errorf("HandlerChain(XUNKNOWN) = %+v, want nil", chain)
+	}
+	if conflicts := srv.ExtensionConflicts(); len(conflicts) != 0 {
+		t.Errorf("ExtensionConflicts() = %v, want none", conflicts)
+	}
+}
+
+func TestExtensionConflicts(t *testing.T) {
+	tests := []struct {
+		name  string
+		exts  []extension.ServerExtension
+		other []string
+	}{
+		{
+			name: "replace hides wrapper",
+			exts: []extension.ServerExtension{
+				newWrapExtension("DOLLAR", &extension.WrapInfo{}),
+				newWrapExtension("MODSEQ", &extension.WrapInfo{Replaces: true}),
+			},
+			other: []string{"DOLLAR"},
+		},
+		{
+			name: "replace supersedes wrapper",
+			exts: []extension.ServerExtension{
+				newWrapExtension("MODSEQ", &extension.WrapInfo{Replaces: true}),
+				newWrapExtension("RESYNC", &extension.WrapInfo{Replaces: true, Supersedes: []string{"MODSEQ"}}),
+			},
+		},
+		{
+			name: "replace hides undescribed wrapper",
+			exts: []extension.ServerExtension{
+				newWrapExtension("OPAQUE", nil),
+				newWrapExtension("MODSEQ", &extension.WrapInfo{Replaces: true}),
+			},
+			other: []string{"OPAQUE"},
+		},
+		{
+			name: "consumed sequence set",
+			exts: []extension.ServerExtension{
+				newWrapExtension("INNER", &extension.WrapInfo{}),
+				newWrapExtension("OUTER", &extension.WrapInfo{Parses: []string{extension.ArgSequenceSet}}),
+			},
+			other: []string{"INNER"},
+		},
+		{
+			name: "consumed before built-in handler",
+			exts: []extension.ServerExtension{
+				newWrapExtension("OUTER", &extension.WrapInfo{Parses: []string{extension.ArgSequenceSet}}),
+			},
+			other: []string{""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newChainServer(false, tt.exts...)
+			conflicts := srv.ExtensionConflicts()
+			if len(conflicts) != len(tt.other) {
+				t.Fatalf("ExtensionConflicts() = %v, want %d conflicts", conflicts, len(tt.other))
+			}
+			for i, c := range conflicts {
+				if c.Command != "FETCH" || c.Other != tt.other[i] {
+					t.Errorf("conflict %d = %+v, want FETCH conflict with %q", i, c, tt.other[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStrictExtensions(t *testing.T) {
+	srv := newChainServer(true,
+		newWrapExtension("DOLLAR", &extension.WrapInfo{}),
+		newWrapExtension("MODSEQ", &extension.WrapInfo{Replaces: true}),
+	)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	err = srv.Serve(l)
+	if err == nil || !strings.Contains(err.Error(), "MODSEQ replaces") {
+		t.Fatalf("Serve() = %v, want conflict error", err)
+	}
+}
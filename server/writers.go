@@ -1,11 +1,13 @@
 package server
 
 import (
+	"bytes"
+	"fmt"
 	"io"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
-	"time"
 
 	imap "github.com/meszmate/imap-go"
 	"github.com/meszmate/imap-go/wire"
@@ -15,6 +17,11 @@ import (
 type ResponseEncoder struct {
 	mu  sync.Mutex
 	enc *wire.Encoder
+
+	// budget and spoolDir configure EncodeSpooled. If budget is nil,
+	// EncodeSpooled writes straight to the connection.
+	budget   *memBudget
+	spoolDir string
 }
 
 // NewResponseEncoder creates a new ResponseEncoder.
@@ -30,10 +37,45 @@ func (re *ResponseEncoder) Encode(fn func(enc *wire.Encoder)) {
 	_ = re.enc.Flush()
 }
 
+// EncodeSpooled renders a response with fn before taking exclusive access
+// to the encoder, so that other responses are not held up while a large
+// response is rendered. The response is buffered in memory within the
+// connection's memory budget and spooled to a temporary file beyond it.
+// If no budget is configured, EncodeSpooled behaves like Encode.
+//
+// If the response cannot be spooled, nothing is written and the error is
+// returned.
+func (re *ResponseEncoder) EncodeSpooled(fn func(enc *wire.Encoder)) error {
+	if re.budget == nil {
+		re.Encode(fn)
+		return nil
+	}
+
+	sb := newSpoolBuffer(re.budget, re.spoolDir)
+	defer func() { _ = sb.Close() }()
+
+	enc := wire.NewEncoder(sb)
+	fn(enc)
+	if err := enc.Flush(); err != nil {
+		return fmt.Errorf("spooling response: %w", err)
+	}
+
+	re.mu.Lock()
+	defer re.mu.Unlock()
+	if _, err := sb.WriteTo(encoderWriter{re.enc}); err != nil {
+		return fmt.Errorf("reading spooled response: %w", err)
+	}
+	return re.enc.Flush()
+}
+
 // FetchWriter writes FETCH response data.
 type FetchWriter struct {
 	enc     *ResponseEncoder
 	uidOnly bool
+	err     error
+
+	// collect, if set, receives fetch data instead of it being written.
+	collect func(data *imap.FetchMessageData)
 }
 
 // NewFetchWriter creates a new FetchWriter.
@@ -50,6 +92,9 @@ func (w *FetchWriter) SetUIDOnly(enabled bool) {
 // WriteFlags writes a FETCH FLAGS response.
 // In UIDONLY mode, seqNum is treated as a UID and UIDFETCH is used.
 func (w *FetchWriter) WriteFlags(seqNum uint32, flags []imap.Flag) {
+	if w.collect != nil {
+		return
+	}
 	flagStrs := make([]string, len(flags))
 	for i, f := range flags {
 		flagStrs[i] = string(f)
@@ -64,10 +109,22 @@ func (w *FetchWriter) WriteFlags(seqNum uint32, flags []imap.Flag) {
 	})
 }
 
+// Err returns the first error that prevented a FETCH response from being
+// written.
+func (w *FetchWriter) Err() error {
+	return w.err
+}
+
 // WriteFetchData writes a complete FETCH response for a message.
 // In UIDONLY mode, uses the UID as the message number and UIDFETCH as the keyword.
+// The response is rendered through ResponseEncoder.EncodeSpooled; if it
+// cannot be written, the error is available from Err.
 func (w *FetchWriter) WriteFetchData(data *imap.FetchMessageData) {
-	w.enc.Encode(func(enc *wire.Encoder) {
+	if w.collect != nil {
+		w.collect(data)
+		return
+	}
+	err := w.enc.EncodeSpooled(func(enc *wire.Encoder) {
 		num := data.SeqNum
 		keyword := "FETCH"
 		if w.uidOnly {
@@ -111,7 +168,13 @@ func (w *FetchWriter) WriteFetchData(data *imap.FetchMessageData) {
 		if data.Envelope != nil {
 			sp()
 			enc.Atom("ENVELOPE").SP()
-			writeEnvelope(enc, data.Envelope)
+			EncodeEnvelope(enc, data.Envelope)
+		}
+
+		if data.BodyStructure != nil {
+			sp()
+			enc.Atom("BODYSTRUCTURE").SP()
+			EncodeBodyStructure(enc, data.BodyStructure, true)
 		}
 
 		if data.ModSeq != 0 {
@@ -145,6 +208,29 @@ func (w *FetchWriter) WriteFetchData(data *imap.FetchMessageData) {
 			enc.Atom("PREVIEW").SP().Nil()
 		}
 
+		// Write BODY[] sections, ordered by name so that responses are
+		// deterministic
+		sections := make([]*imap.FetchItemBodySection, 0, len(data.BodySection))
+		for section := range data.BodySection {
+			sections = append(sections, section)
+		}
+		sort.Slice(sections, func(i, j int) bool {
+			return sections[i].ResponseName() < sections[j].ResponseName()
+		})
+		for _, section := range sections {
+			sp()
+			enc.Atom(section.ResponseName()).SP()
+			switch sr := data.BodySection[section]; {
+			case sr.Reader == nil:
+				enc.Nil()
+			case sr.Size > 0:
+				w.streamLiteral(enc, sr)
+			default:
+				bodyData, _ := io.ReadAll(sr.Reader)
+				enc.Literal(bodyData)
+			}
+		}
+
 		// Write BINARY sections (RFC 3516)
 		for section, reader := range data.BinarySection {
 			sp()
@@ -161,85 +247,65 @@ func (w *FetchWriter) WriteFetchData(data *imap.FetchMessageData) {
 
 		enc.EndList().CRLF()
 	})
+	if err != nil && w.err == nil {
+		w.err = err
+	}
 }
 
-func writeEnvelope(enc *wire.Encoder, env *imap.Envelope) {
-	enc.BeginList()
-	if env.Date.IsZero() {
-		enc.Nil()
-	} else {
-		enc.QuotedString(env.Date.Format(time.RFC822Z))
-	}
-	enc.SP()
-	if env.Subject == "" {
-		enc.Nil()
-	} else {
-		enc.String(env.Subject)
-	}
-	enc.SP()
-	writeAddressList(enc, env.From)
-	enc.SP()
-	writeAddressList(enc, env.Sender)
-	enc.SP()
-	writeAddressList(enc, env.ReplyTo)
-	enc.SP()
-	writeAddressList(enc, env.To)
-	enc.SP()
-	writeAddressList(enc, env.Cc)
-	enc.SP()
-	writeAddressList(enc, env.Bcc)
-	enc.SP()
-	if env.InReplyTo == "" {
-		enc.Nil()
-	} else {
-		enc.String(env.InReplyTo)
-	}
-	enc.SP()
-	if env.MessageID == "" {
-		enc.Nil()
-	} else {
-		enc.String(env.MessageID)
-	}
-	enc.EndList()
-}
-
-func writeAddressList(enc *wire.Encoder, addrs []*imap.Address) {
-	if len(addrs) == 0 {
-		enc.Nil()
+// streamLiteral writes a section as a literal of the size given by the
+// session, such as from its metadata, copying the data as it is read
+// rather than reading it into memory first. A section shorter than its
+// size is padded with spaces, so that the response stays well-formed, and
+// the error is available from Err; data beyond the size is not written.
+func (w *FetchWriter) streamLiteral(enc *wire.Encoder, sr imap.SectionReader) {
+	lw := enc.LiteralWriter(sr.Size, false)
+	n, err := io.CopyN(lw, sr.Reader, sr.Size)
+	if n == sr.Size {
 		return
 	}
-	enc.BeginList()
-	for i, addr := range addrs {
-		if i > 0 {
-			enc.SP()
-		}
-		enc.BeginList()
-		if addr.Name != "" {
-			enc.String(addr.Name)
-		} else {
-			enc.Nil()
-		}
-		enc.SP().Nil() // at-domain-list (always NIL in modern usage)
-		enc.SP()
-		if addr.Mailbox != "" {
-			enc.String(addr.Mailbox)
-		} else {
-			enc.Nil()
-		}
-		enc.SP()
-		if addr.Host != "" {
-			enc.String(addr.Host)
-		} else {
-			enc.Nil()
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if w.err == nil {
+		w.err = fmt.Errorf("section of %d bytes ended after %d: %w", sr.Size, n, err)
+	}
+	pad := bytes.Repeat([]byte{' '}, 4096)
+	for n < sr.Size {
+		chunk := pad
+		if rest := sr.Size - n; rest < int64(len(chunk)) {
+			chunk = chunk[:rest]
 		}
-		enc.EndList()
+		_, _ = lw.Write(chunk)
+		n += int64(len(chunk))
 	}
-	enc.EndList()
 }
 
 // ListWriter writes LIST responses.
 type ListWriter struct {
 	enc *ResponseEncoder
+	// allowed filters the mailboxes written, see Conn.NewListWriter.
+	allowed func(mailbox string) bool
+	// parents tracks the ancestors to infer, see InferParents.
+	parents *listParents
+	// myRights returns the rights of mailboxes listed without them, see
+	// SetMyRights.
+	myRights func(mailbox string) (imap.ACLRights, error)
+}
+
+// listParents tracks the mailboxes written by a ListWriter and the
+// ancestors they imply.
+type listParents struct {
+	patterns []string
+	written  map[string]bool
+	// missing are the ancestors matching patterns, with their
+	// delimiters, and seen their names.
+	missing []listParent
+	seen    map[string]bool
+}
+
+type listParent struct {
+	name  string
+	delim rune
 }
 
 // NewListWriter creates a new ListWriter.
@@ -247,14 +313,121 @@ func NewListWriter(enc *ResponseEncoder) *ListWriter {
 	return &ListWriter{enc: enc}
 }
 
-// WriteList writes a single LIST response.
+// InferParents makes w infer the ancestors of the mailboxes listed, for
+// backends that only report leaves, and returns the patterns to pass to
+// the session instead of patterns. The ancestors matching one of
+// patterns under ref that their descendants do not match, and that the
+// session does not write, are written by Flush with the \Noselect
+// attribute, as RFC 3501 requires for "foo" when only "foo/bar" exists
+// and "%" is listed.
+//
+// The returned patterns also match the descendants of the mailboxes
+// matching patterns; w leaves out the mailboxes only they match.
+func (w *ListWriter) InferParents(ref string, patterns []string) []string {
+	p := &listParents{written: make(map[string]bool), seen: make(map[string]bool)}
+	wider := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		if pattern == "" {
+			// The hierarchy delimiter is requested.
+			return patterns
+		}
+		p.patterns = append(p.patterns, ref+pattern)
+		wider[i] = pattern
+		if !strings.HasSuffix(pattern, "*") {
+			wider[i] += "*"
+		}
+	}
+	w.parents = p
+	return wider
+}
+
+// SetMyRights makes w write a MYRIGHTS response with the rights fn returns
+// for each mailbox listed without ListData.MyRights, for LIST RETURN
+// (MYRIGHTS) (RFC 8440) on backends that report rights with the MYRIGHTS
+// command only. Mailboxes with the \NonExistent or \Noselect attribute
+// and mailboxes for which fn fails get no MYRIGHTS response.
+func (w *ListWriter) SetMyRights(fn func(mailbox string) (imap.ACLRights, error)) {
+	w.myRights = fn
+}
+
+// Flush writes the ancestors inferred since InferParents that were not
+// written, sorted by name. Handlers call it after the session has listed the mailboxes.
+func (w *ListWriter) Flush() {
+	p := w.parents
+	if p == nil {
+		return
+	}
+	w.parents = nil
+	sort.Slice(p.missing, func(i, j int) bool { return p.missing[i].name < p.missing[j].name })
+	for _, parent := range p.missing {
+		if p.written[parent.name] {
+			continue
+		}
+		w.WriteList(&imap.ListData{
+			Attrs:   []imap.MailboxAttr{imap.MailboxAttrNoSelect},
+			Delim:   parent.delim,
+			Mailbox: parent.name,
+		})
+	}
+}
+
+// track records the ancestors implied by data, and reports whether data
+// matches the patterns and is to be written.
+func (p *listParents) track(data *imap.ListData) bool {
+	// Only the patterns the mailbox does not match itself, such as "%"
+	// for "foo/bar", call for its ancestors.
+	var patterns []string
+	for _, pattern := range p.patterns {
+		if !imap.MatchListPattern(pattern, data.Mailbox, data.Delim) {
+			patterns = append(patterns, pattern)
+		}
+	}
+	matched := len(patterns) < len(p.patterns)
+	if matched {
+		p.written[data.Mailbox] = true
+	}
+	if data.Delim == 0 || len(patterns) == 0 {
+		return matched
+	}
+	name := data.Mailbox
+	for {
+		i := strings.LastIndex(name, string(data.Delim))
+		if i <= 0 {
+			return matched
+		}
+		name = name[:i]
+		if p.seen[name] {
+			continue
+		}
+		for _, pattern := range patterns {
+			if imap.MatchListPattern(pattern, name, data.Delim) {
+				p.seen[name] = true
+				p.missing = append(p.missing, listParent{name: name, delim: data.Delim})
+				break
+			}
+		}
+	}
+}
+
+// WriteList writes a single LIST response. Duplicate attributes are
+// written once. ListData.Status and ListData.MyRights are written as
+// STATUS (RFC 5819) and MYRIGHTS (RFC 8440) responses following it.
 func (w *ListWriter) WriteList(data *imap.ListData) {
+	if w.allowed != nil && !w.allowed(data.Mailbox) {
+		return
+	}
+	if w.parents != nil && !w.parents.track(data) {
+		return
+	}
 	w.enc.Encode(func(enc *wire.Encoder) {
 		enc.Star().Atom("LIST").SP()
 
 		// Attributes
 		enc.BeginList()
 		for i, attr := range data.Attrs {
+			if hasAttr(data.Attrs[:i], attr) {
+				continue
+			}
 			if i > 0 {
 				enc.SP()
 			}
@@ -298,23 +471,32 @@ func (w *ListWriter) WriteList(data *imap.ListData) {
 				sp()
 				enc.QuotedString("OLDNAME").SP().BeginList().MailboxName(data.OldName).EndList()
 			}
-			if data.MyRights != "" {
-				sp()
-				enc.QuotedString("MYRIGHTS").SP().QuotedString(data.MyRights)
-			}
 			if data.Metadata != nil {
 				sp()
 				enc.QuotedString("METADATA").SP().BeginList()
-				mFirst := true
-				for k, v := range data.Metadata {
-					if !mFirst {
+				keys := make([]string, 0, len(data.Metadata))
+				for k := range data.Metadata {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for i, k := range keys {
+					if i > 0 {
 						enc.SP()
 					}
-					enc.QuotedString(k).SP().QuotedString(v)
-					mFirst = false
+					enc.QuotedString(k).SP().QuotedString(data.Metadata[k])
 				}
 				enc.EndList()
 			}
+			for _, item := range data.Extended {
+				sp()
+				enc.QuotedString(item.Tag).SP()
+				if item.Value.Kind == imap.ExtendedValueString {
+					// A string is only allowed inside a list.
+					writeExtendedValue(enc, imap.ExtendedList(item.Value))
+				} else {
+					writeExtendedValue(enc, item.Value)
+				}
+			}
 			enc.EndList()
 		}
 
@@ -363,6 +545,18 @@ func (w *ListWriter) WriteList(data *imap.ListData) {
 			enc.EndList().CRLF()
 		})
 	}
+
+	rights := data.MyRights
+	if rights == "" && w.myRights != nil && data.Selectable() {
+		if r, err := w.myRights(data.Mailbox); err == nil {
+			rights = string(r)
+		}
+	}
+	if rights != "" {
+		w.enc.Encode(func(enc *wire.Encoder) {
+			enc.Star().Atom("MYRIGHTS").SP().MailboxName(data.Mailbox).SP().AString(rights).CRLF()
+		})
+	}
 }
 
 // formatPart formats a MIME part number list (e.g., []int{1, 2}) as "1.2".
@@ -377,9 +571,40 @@ func formatPart(part []int) string {
 	return strings.Join(s, ".")
 }
 
+// hasAttr reports whether attrs holds attr, compared case-insensitively.
+func hasAttr(attrs []imap.MailboxAttr, attr imap.MailboxAttr) bool {
+	for _, a := range attrs {
+		if strings.EqualFold(string(a), string(attr)) {
+			return true
+		}
+	}
+	return false
+}
+
 // hasExtendedData returns true if any extended data fields are set in ListData.
 func hasExtendedData(data *imap.ListData) bool {
-	return len(data.ChildInfo) > 0 || data.OldName != "" || data.MyRights != "" || data.Metadata != nil
+	return len(data.ChildInfo) > 0 || data.OldName != "" || data.Metadata != nil ||
+		len(data.Extended) > 0
+}
+
+// writeExtendedValue writes the value of extended data (RFC 4466
+// tagged-ext-val).
+func writeExtendedValue(enc *wire.Encoder, v imap.ExtendedValue) {
+	switch v.Kind {
+	case imap.ExtendedValueList:
+		enc.BeginList()
+		for i, item := range v.List {
+			if i > 0 {
+				enc.SP()
+			}
+			writeExtendedValue(enc, item)
+		}
+		enc.EndList()
+	case imap.ExtendedValueString:
+		enc.String(v.Text)
+	default:
+		enc.Atom(v.Text)
+	}
 }
 
 // UpdateWriter writes unsolicited updates.
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	imap "github.com/meszmate/imap-go"
+	"github.com/meszmate/imap-go/wire"
+)
+
+func TestListWriter_ExtendedData(t *testing.T) {
+	var buf bytes.Buffer
+	enc := wire.NewEncoder(&buf)
+	NewListWriter(NewResponseEncoder(enc)).WriteList(&imap.ListData{
+		Attrs:     []imap.MailboxAttr{imap.MailboxAttrHasChildren},
+		Delim:     '/',
+		Mailbox:   "Archive",
+		ChildInfo: []string{"SUBSCRIBED"},
+		OldName:   "Old \"Archive\"",
+		Metadata:  map[string]string{"/private/comment": "b", "/private/a": "a"},
+		Extended: []imap.ListExtendedItem{
+			{Tag: "X-COUNTS", Value: imap.ExtendedList(imap.ExtendedAtom("1"), imap.ExtendedAtom("2:4"))},
+			{Tag: "X-OWNER", Value: imap.ExtendedString("John Doe")},
+		},
+	})
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Flush() error: %v", err)
+	}
+
+	want := `* LIST (\HasChildren) "/" Archive ("CHILDINFO" ("SUBSCRIBED") "OLDNAME" ("Old \"Archive\"")` +
+		` "METADATA" ("/private/a" "a" "/private/comment" "b") "X-COUNTS" (1 2:4) "X-OWNER" ("John Doe"))` + "\r\n"
+	if got := buf.String(); got != want {
+		t.Errorf("WriteList() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestListWriter_Attributes(t *testing.T) {
+	var buf bytes.Buffer
+	enc := wire.NewEncoder(&buf)
+	w := NewListWriter(NewResponseEncoder(enc))
+	patterns := w.InferParents("", []string{"%", "Work/%"})
+	if len(patterns) != 2 || patterns[0] != "%*" || patterns[1] != "Work/%*" {
+		t.Fatalf("InferParents() = %q", patterns)
+	}
+	// A session listing leaves only, with the parent of one after it.
+	for _, data := range []*imap.ListData{
+		{Attrs: []imap.MailboxAttr{imap.MailboxAttrMarked, "\\marked"}, Delim: '/', Mailbox: "INBOX"},
+		{Delim: '/', Mailbox: "Work/Reports/2024"},
+		{Delim: '/', Mailbox: "Archive/2024"},
+		{Attrs: []imap.MailboxAttr{imap.MailboxAttrUnmarked}, Delim: '/', Mailbox: "Archive"},
+	} {
+		w.WriteList(data)
+	}
+	w.Flush()
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Flush() error: %v", err)
+	}
+
+	want := `* LIST (\Marked) "/" INBOX` + "\r\n" +
+		`* LIST (\Unmarked) "/" Archive` + "\r\n" +
+		`* LIST (\Noselect) "/" Work` + "\r\n" +
+		`* LIST (\Noselect) "/" Work/Reports` + "\r\n"
+	if got := buf.String(); got != want {
+		t.Errorf("WriteList() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestListData_Selectable(t *testing.T) {
+	for _, tt := range []struct {
+		attrs []imap.MailboxAttr
+		want  bool
+	}{
+		{nil, true},
+		{[]imap.MailboxAttr{imap.MailboxAttrMarked}, true},
+		{[]imap.MailboxAttr{"\\NoSelect"}, false},
+		{[]imap.MailboxAttr{imap.MailboxAttrNonExistent}, false},
+	} {
+		if got := (&imap.ListData{Attrs: tt.attrs}).Selectable(); got != tt.want {
+			t.Errorf("Selectable(%v) = %v, want %v", tt.attrs, got, tt.want)
+		}
+	}
+}
+
+// onlyReader hides the type of a reader, such as one streaming a message
+// from remote storage.
+type onlyReader struct{ io.Reader }
+
+func TestFetchWriter_StreamedSection(t *testing.T) {
+	section := &imap.FetchItemBodySection{Peek: true}
+	write := func(sr imap.SectionReader) (string, error) {
+		var buf bytes.Buffer
+		enc := wire.NewEncoder(&buf)
+		w := NewFetchWriter(NewResponseEncoder(enc))
+		w.WriteFetchData(&imap.FetchMessageData{
+			SeqNum:      1,
+			RFC822Size:  sr.Size,
+			BodySection: map[*imap.FetchItemBodySection]imap.SectionReader{section: sr},
+		})
+		_ = enc.Flush()
+		return buf.String(), w.Err()
+	}
+
+	got, err := write(imap.SectionReader{Reader: onlyReader{strings.NewReader("hello world")}, Size: 5})
+	if want := "* 1 FETCH (RFC822.SIZE 5 BODY[] {5}\r\nhello)\r\n"; got != want || err != nil {
+		t.Errorf("WriteFetchData() = %q, %v; want %q", got, err, want)
+	}
+
+	got, err = write(imap.SectionReader{Reader: onlyReader{strings.NewReader("hi")}, Size: 5})
+	if want := "* 1 FETCH (RFC822.SIZE 5 BODY[] {5}\r\nhi   )\r\n"; got != want || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("WriteFetchData() with a short section = %q, %v; want %q and an error", got, err, want)
+	}
+}
@@ -0,0 +1,103 @@
+package imap
+
+import "strings"
+
+// SpecialUseAttrs are the special-use attributes of RFC 6154.
+var SpecialUseAttrs = []MailboxAttr{
+	MailboxAttrAll,
+	MailboxAttrArchive,
+	MailboxAttrDrafts,
+	MailboxAttrFlagged,
+	MailboxAttrJunk,
+	MailboxAttrSent,
+	MailboxAttrTrash,
+}
+
+// IsSpecialUse reports whether attr is a special-use attribute of RFC
+// 6154, compared case-insensitively.
+func (attr MailboxAttr) IsSpecialUse() bool {
+	for _, a := range SpecialUseAttrs {
+		if strings.EqualFold(string(attr), string(a)) {
+			return true
+		}
+	}
+	return false
+}
+
+// specialUseNames maps the lowercase names commonly given to special-use
+// mailboxes by servers and clients without SPECIAL-USE to their role.
+var specialUseNames = map[string]MailboxAttr{
+	"all mail":         MailboxAttrAll,
+	"archive":          MailboxAttrArchive,
+	"archives":         MailboxAttrArchive,
+	"archiv":           MailboxAttrArchive,
+	"archivo":          MailboxAttrArchive,
+	"drafts":           MailboxAttrDrafts,
+	"draft":            MailboxAttrDrafts,
+	"entwürfe":         MailboxAttrDrafts,
+	"brouillons":       MailboxAttrDrafts,
+	"borradores":       MailboxAttrDrafts,
+	"starred":          MailboxAttrFlagged,
+	"flagged":          MailboxAttrFlagged,
+	"junk":             MailboxAttrJunk,
+	"junk e-mail":      MailboxAttrJunk,
+	"junk email":       MailboxAttrJunk,
+	"spam":             MailboxAttrJunk,
+	"bulk mail":        MailboxAttrJunk,
+	"indésirables":     MailboxAttrJunk,
+	"sent":             MailboxAttrSent,
+	"sent mail":        MailboxAttrSent,
+	"sent items":       MailboxAttrSent,
+	"sent messages":    MailboxAttrSent,
+	"gesendet":         MailboxAttrSent,
+	"envoyés":          MailboxAttrSent,
+	"enviados":         MailboxAttrSent,
+	"trash":            MailboxAttrTrash,
+	"bin":              MailboxAttrTrash,
+	"deleted items":    MailboxAttrTrash,
+	"deleted messages": MailboxAttrTrash,
+	"papierkorb":       MailboxAttrTrash,
+	"corbeille":        MailboxAttrTrash,
+	"papelera":         MailboxAttrTrash,
+}
+
+// GuessSpecialUse guesses the special-use attribute of a mailbox from the
+// last level of its name, for servers without SPECIAL-USE: "Sent Items"
+// or "INBOX.Sent" are \Sent, "[Gmail]/Spam" is \Junk. delim is the
+// hierarchy delimiter, 0 if none. It returns "" if the name is not a
+// common name of a special-use mailbox.
+func GuessSpecialUse(name string, delim rune) MailboxAttr {
+	if delim != 0 {
+		if i := strings.LastIndex(name, string(delim)); i >= 0 {
+			name = name[i+len(string(delim)):]
+		}
+	}
+	return specialUseNames[strings.ToLower(strings.TrimSpace(name))]
+}
+
+// MailboxRoles returns the mailbox of each special-use role in the result
+// of a LIST command. If any mailbox has a special-use attribute, the
+// server supports SPECIAL-USE and only the attributes are used;
+// otherwise roles are guessed from the mailbox names with
+// GuessSpecialUse. The first mailbox with a role is kept.
+func MailboxRoles(list []*ListData) map[MailboxAttr]*ListData {
+	guess := true
+	for _, data := range list {
+		if data.SpecialUse() != "" {
+			guess = false
+			break
+		}
+	}
+
+	roles := make(map[MailboxAttr]*ListData)
+	for _, data := range list {
+		role := data.SpecialUse()
+		if guess && data.Selectable() {
+			role = GuessSpecialUse(data.Mailbox, data.Delim)
+		}
+		if _, ok := roles[role]; role != "" && !ok {
+			roles[role] = data
+		}
+	}
+	return roles
+}
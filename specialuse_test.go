@@ -0,0 +1,59 @@
+package imap
+
+import "testing"
+
+func TestGuessSpecialUse(t *testing.T) {
+	tests := []struct {
+		name  string
+		delim rune
+		want  MailboxAttr
+	}{
+		{"Sent", '/', MailboxAttrSent},
+		{"INBOX.Sent Items", '.', MailboxAttrSent},
+		{"[Gmail]/Spam", '/', MailboxAttrJunk},
+		{"Deleted Items", 0, MailboxAttrTrash},
+		{"Papierkorb", '/', MailboxAttrTrash},
+		{"Sent/2024", '/', ""},
+		{"INBOX", '/', ""},
+	}
+	for _, tt := range tests {
+		if got := GuessSpecialUse(tt.name, tt.delim); got != tt.want {
+			t.Errorf("GuessSpecialUse(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestListData_Role(t *testing.T) {
+	data := &ListData{Mailbox: "Bin", Delim: '/', Attrs: []MailboxAttr{"\\HasChildren", "\\trash"}}
+	if !data.HasChildren() || data.SpecialUse() != MailboxAttrTrash || !data.IsTrash() || data.IsSent() {
+		t.Errorf("Role() of %v = %q", data.Attrs, data.Role())
+	}
+
+	guessed := &ListData{Mailbox: "Drafts", Delim: '/'}
+	if guessed.SpecialUse() != "" || !guessed.IsDrafts() || guessed.HasChildren() {
+		t.Errorf("Role() of Drafts = %q", guessed.Role())
+	}
+	parent := &ListData{Mailbox: "Archive", Delim: '/', Attrs: []MailboxAttr{MailboxAttrNoSelect}}
+	if parent.IsArchive() {
+		t.Error("Role() guessed for a \\Noselect mailbox")
+	}
+}
+
+func TestMailboxRoles(t *testing.T) {
+	list := []*ListData{
+		{Mailbox: "INBOX"},
+		{Mailbox: "Sent", Delim: '/'},
+		{Mailbox: "Corbeille", Delim: '/'},
+		{Mailbox: "Trash", Delim: '/'},
+	}
+	roles := MailboxRoles(list)
+	if len(roles) != 2 || roles[MailboxAttrSent] != list[1] || roles[MailboxAttrTrash] != list[2] {
+		t.Errorf("MailboxRoles() guessed %v", roles)
+	}
+
+	list[3].Attrs = []MailboxAttr{MailboxAttrTrash}
+	roles = MailboxRoles(list)
+	if len(roles) != 1 || roles[MailboxAttrTrash] != list[3] {
+		t.Errorf("MailboxRoles() with special-use attributes = %v", roles)
+	}
+}
@@ -181,6 +181,7 @@ func TestCommandAllowedStates(t *testing.T) {
 		{"STARTTLS", 1},
 		{"SELECT", 2},
 		{"FETCH", 1},
+		{"CHECK", 1},
 		{"STORE", 1},
 		{"UNKNOWN", 0},
 	}
@@ -62,7 +62,7 @@ func CommandAllowedStates(cmd string) []imap.ConnState {
 		}
 
 	// Selected state
-	case "CLOSE", "UNSELECT", "EXPUNGE", "SEARCH", "FETCH", "STORE",
+	case "CHECK", "CLOSE", "UNSELECT", "EXPUNGE", "SEARCH", "FETCH", "STORE",
 		"COPY", "MOVE", "SORT", "THREAD", "UID":
 		return []imap.ConnState{
 			imap.ConnStateSelected,
@@ -0,0 +1,217 @@
+package imap
+
+import (
+	"container/list"
+	"sync"
+)
+
+// MessageKey identifies a message for StructureCache. A message keeps its
+// content for as long as its mailbox keeps its UIDVALIDITY, so the
+// envelope and body structure parsed from it can be shared by all the
+// sessions fetching it.
+type MessageKey struct {
+	// Mailbox identifies the mailbox, uniquely among all the mailboxes
+	// sharing the cache: for instance the user and mailbox name, or an
+	// internal mailbox ID.
+	Mailbox     string
+	UIDValidity uint32
+	UID         UID
+}
+
+// StructureCacheStats are the counters of a StructureCache.
+type StructureCacheStats struct {
+	Entries   int
+	Bytes     int64
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// StructureCache is a size-limited LRU cache of the envelopes and body
+// structures parsed from messages, shared by the sessions of a server so
+// that messages fetched by several clients are parsed once. The size of
+// the cached values is estimated from their strings and fields; the
+// least recently used values are evicted when it exceeds the limit.
+//
+// Cached values are shared between sessions and must not be modified.
+// Backends invalidate the values of messages when they are expunged.
+// All methods are safe for concurrent use, and those of a nil
+// *StructureCache do nothing, so that backends can use an optional cache
+// without checks.
+type StructureCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	lru      *list.List // of *structureEntry, most recently used first
+	entries  map[structureKey]*list.Element
+	stats    StructureCacheStats
+}
+
+// structureKey is the key of a cached value: a message and which of its
+// values is cached.
+type structureKey struct {
+	MessageKey
+	bodyStructure bool
+}
+
+type structureEntry struct {
+	key   structureKey
+	value interface{}
+	size  int64
+}
+
+// NewStructureCache creates a cache holding up to maxBytes of values.
+func NewStructureCache(maxBytes int64) *StructureCache {
+	return &StructureCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[structureKey]*list.Element),
+	}
+}
+
+// Envelope returns the cached envelope of a message.
+func (c *StructureCache) Envelope(key MessageKey) (*Envelope, bool) {
+	v, ok := c.get(structureKey{MessageKey: key})
+	if !ok {
+		return nil, false
+	}
+	return v.(*Envelope), true
+}
+
+// SetEnvelope caches the envelope of a message.
+func (c *StructureCache) SetEnvelope(key MessageKey, env *Envelope) {
+	if env == nil {
+		return
+	}
+	c.set(structureKey{MessageKey: key}, env, envelopeSize(env))
+}
+
+// BodyStructure returns the cached body structure of a message.
+func (c *StructureCache) BodyStructure(key MessageKey) (*BodyStructure, bool) {
+	v, ok := c.get(structureKey{MessageKey: key, bodyStructure: true})
+	if !ok {
+		return nil, false
+	}
+	return v.(*BodyStructure), true
+}
+
+// SetBodyStructure caches the body structure of a message.
+func (c *StructureCache) SetBodyStructure(key MessageKey, bs *BodyStructure) {
+	if bs == nil {
+		return
+	}
+	c.set(structureKey{MessageKey: key, bodyStructure: true}, bs, bodyStructureSize(bs))
+}
+
+// Invalidate removes the cached values of messages, such as those that
+// were expunged.
+func (c *StructureCache) Invalidate(keys ...MessageKey) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		for _, bs := range []bool{false, true} {
+			if e, ok := c.entries[structureKey{MessageKey: key, bodyStructure: bs}]; ok {
+				c.remove(e)
+			}
+		}
+	}
+}
+
+// Stats returns the counters of the cache.
+func (c *StructureCache) Stats() StructureCacheStats {
+	if c == nil {
+		return StructureCacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+func (c *StructureCache) get(key structureKey) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(e)
+	return e.Value.(*structureEntry).value, true
+}
+
+func (c *StructureCache) set(key structureKey, value interface{}, size int64) {
+	if c == nil || size > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+	c.entries[key] = c.lru.PushFront(&structureEntry{key: key, value: value, size: size})
+	c.stats.Entries++
+	c.stats.Bytes += size
+	for c.stats.Bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+// remove removes an entry. The caller must hold the lock.
+func (c *StructureCache) remove(e *list.Element) {
+	entry := c.lru.Remove(e).(*structureEntry)
+	delete(c.entries, entry.key)
+	c.stats.Entries--
+	c.stats.Bytes -= entry.size
+}
+
+// Estimated sizes, in bytes, of the structs and of each entry of maps
+// and slices, excluding the strings they reference.
+const (
+	structureEntrySize = 160
+	envelopeBaseSize   = 240
+	addressBaseSize    = 56
+	bodyStructureBase  = 296
+	mapEntrySize       = 48
+)
+
+// envelopeSize estimates the memory used by env.
+func envelopeSize(env *Envelope) int64 {
+	n := int64(envelopeBaseSize + len(env.Subject) + len(env.InReplyTo) + len(env.MessageID))
+	for _, addrs := range [][]*Address{env.From, env.Sender, env.ReplyTo, env.To, env.Cc, env.Bcc} {
+		for _, a := range addrs {
+			n += int64(addressBaseSize + len(a.Name) + len(a.Mailbox) + len(a.Host))
+		}
+	}
+	return n + structureEntrySize
+}
+
+// bodyStructureSize estimates the memory used by bs.
+func bodyStructureSize(bs *BodyStructure) int64 {
+	n := int64(bodyStructureBase + len(bs.Type) + len(bs.Subtype) + len(bs.ID) +
+		len(bs.Description) + len(bs.Encoding) + len(bs.MD5) + len(bs.Disposition) + len(bs.Location))
+	for _, params := range []map[string]string{bs.Params, bs.DispositionParams} {
+		for k, v := range params {
+			n += int64(mapEntrySize + len(k) + len(v))
+		}
+	}
+	for _, lang := range bs.Language {
+		n += int64(16 + len(lang))
+	}
+	if bs.Envelope != nil {
+		n += envelopeSize(bs.Envelope) - structureEntrySize
+	}
+	if bs.BodyStructure != nil {
+		n += bodyStructureSize(bs.BodyStructure) - structureEntrySize
+	}
+	for i := range bs.Children {
+		n += bodyStructureSize(&bs.Children[i]) - structureEntrySize
+	}
+	return n + structureEntrySize
+}
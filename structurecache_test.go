@@ -0,0 +1,59 @@
+package imap
+
+import "testing"
+
+func TestStructureCache(t *testing.T) {
+	key := func(uid UID) MessageKey { return MessageKey{Mailbox: "alice/INBOX", UIDValidity: 1, UID: uid} }
+	env := &Envelope{Subject: "hello"}
+	size := envelopeSize(env)
+	c := NewStructureCache(2 * size)
+
+	if _, ok := c.Envelope(key(1)); ok {
+		t.Fatal("Envelope() of an empty cache ok")
+	}
+	c.SetEnvelope(key(1), env)
+	c.SetEnvelope(key(2), &Envelope{Subject: "world"})
+	if got, ok := c.Envelope(key(1)); !ok || got != env {
+		t.Fatalf("Envelope(1) = %v, %v, want the cached envelope", got, ok)
+	}
+
+	// UID 2 is the least recently used and is evicted.
+	c.SetEnvelope(key(3), &Envelope{Subject: "again"})
+	if _, ok := c.Envelope(key(2)); ok {
+		t.Error("Envelope(2) ok after eviction")
+	}
+	if _, ok := c.Envelope(key(1)); !ok {
+		t.Error("Envelope(1) evicted, want UID 2 evicted")
+	}
+	if stats := c.Stats(); stats.Entries != 2 || stats.Bytes != 2*size || stats.Evictions != 1 || stats.Hits != 2 || stats.Misses != 2 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+
+	bs := &BodyStructure{Type: "text", Subtype: "plain"}
+	c.SetBodyStructure(key(1), bs)
+	if got, ok := c.BodyStructure(key(1)); !ok || got != bs {
+		t.Errorf("BodyStructure(1) = %v, %v, want the cached body structure", got, ok)
+	}
+	c.Invalidate(key(1), key(3))
+	if stats := c.Stats(); stats.Entries != 0 || stats.Bytes != 0 {
+		t.Errorf("Stats() after Invalidate = %+v, want an empty cache", stats)
+	}
+
+	large := &Envelope{Subject: string(make([]byte, 3*size))}
+	c.SetEnvelope(key(4), large)
+	if _, ok := c.Envelope(key(4)); ok {
+		t.Error("a value larger than the cache was cached")
+	}
+}
+
+func TestStructureCache_Nil(t *testing.T) {
+	var c *StructureCache
+	c.SetEnvelope(MessageKey{UID: 1}, &Envelope{})
+	if _, ok := c.Envelope(MessageKey{UID: 1}); ok {
+		t.Error("Envelope() of a nil cache ok")
+	}
+	c.Invalidate(MessageKey{UID: 1})
+	if stats := c.Stats(); stats != (StructureCacheStats{}) {
+		t.Errorf("Stats() of a nil cache = %+v", stats)
+	}
+}
@@ -0,0 +1,82 @@
+package imap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime/quotedprintable"
+	"strings"
+)
+
+// ErrUnknownTransferEncoding is returned for a Content-Transfer-Encoding
+// that cannot be decoded. Servers report it with the UNKNOWN-CTE response
+// code (RFC 3516).
+var ErrUnknownTransferEncoding = errors.New("imap: unknown content transfer encoding")
+
+// NewTransferDecoder returns a reader that decodes r according to the
+// Content-Transfer-Encoding encoding, which is matched case-insensitively.
+// 7BIT, 8BIT, BINARY and an empty encoding are returned unchanged.
+//
+// Decoding is lenient, as real-world messages often are not well formed:
+// base64 data may contain line breaks, other whitespace or garbage
+// characters and may lack padding, and quoted-printable data may use bare
+// LF line endings and invalid escapes, which are passed through.
+func NewTransferDecoder(encoding string, r io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "7bit", "8bit", "binary":
+		return r, nil
+	case "base64":
+		return base64.NewDecoder(base64.RawStdEncoding, &base64Filter{r: r}), nil
+	case "quoted-printable":
+		return quotedprintable.NewReader(r), nil
+	default:
+		return nil, ErrUnknownTransferEncoding
+	}
+}
+
+// DecodeTransferEncoding decodes data according to the
+// Content-Transfer-Encoding encoding. See NewTransferDecoder.
+func DecodeTransferEncoding(encoding string, data []byte) ([]byte, error) {
+	r, err := NewTransferDecoder(encoding, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// base64Filter drops everything but base64 alphabet characters and ends
+// the data at the first padding character, so that it can be decoded with
+// RawStdEncoding.
+type base64Filter struct {
+	r    io.Reader
+	done bool
+}
+
+func (f *base64Filter) Read(p []byte) (int, error) {
+	for !f.done {
+		n, err := f.r.Read(p)
+		j := 0
+		for _, b := range p[:n] {
+			if b == '=' {
+				f.done = true
+				break
+			}
+			if isBase64Char(b) {
+				p[j] = b
+				j++
+			}
+		}
+		if f.done {
+			err = io.EOF
+		}
+		if j > 0 || err != nil {
+			return j, err
+		}
+	}
+	return 0, io.EOF
+}
+
+func isBase64Char(b byte) bool {
+	return b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b == '+' || b == '/'
+}
@@ -0,0 +1,39 @@
+package imap
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeTransferEncoding(t *testing.T) {
+	tests := []struct {
+		encoding, in, want string
+	}{
+		{"", "plain text", "plain text"},
+		{"7BIT", "plain text", "plain text"},
+		{"base64", "aGVsbG8gd29ybGQ=", "hello world"},
+		{"BASE64", "aGVsbG8g\r\nd29y\nbGQ=\r\n", "hello world"},
+		{"base64", "aGVsbG8g d29ybGQ", "hello world"},
+		{"base64", "aGVsbG8gd29ybGQ=\r\n--boundary", "hello world"},
+		{"quoted-printable", "caf=C3=A9 =\r\nau lait", "café au lait"},
+		{"Quoted-Printable", "a=3db\nc=\nd", "a=b\ncd"},
+		{"quoted-printable", "50% =ZZ off", "50% =ZZ off"},
+	}
+	for _, tt := range tests {
+		got, err := DecodeTransferEncoding(tt.encoding, []byte(tt.in))
+		if err != nil {
+			t.Errorf("DecodeTransferEncoding(%q, %q) error: %v", tt.encoding, tt.in, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("DecodeTransferEncoding(%q, %q) = %q, want %q", tt.encoding, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeTransferEncoding_Unknown(t *testing.T) {
+	_, err := DecodeTransferEncoding("x-uuencode", []byte("begin 644"))
+	if !errors.Is(err, ErrUnknownTransferEncoding) {
+		t.Errorf("error = %v, want ErrUnknownTransferEncoding", err)
+	}
+}
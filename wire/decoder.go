@@ -15,38 +15,123 @@ import (
 
 // Decoder reads and parses IMAP protocol data from an io.Reader.
 type Decoder struct {
-	r *bufio.Reader
+	r  *bufio.Reader
+	tr *traceReader
 
 	// ContinuationRequest is called when the decoder needs to send a
 	// continuation request for non-synchronizing literals.
 	ContinuationRequest func() error
+
+	// MaxLineLength limits the length of the lines returned by ReadLine,
+	// which fails with a *LineTooLongError for longer lines. 0 means no
+	// limit.
+	MaxLineLength int
 }
 
 // NewDecoder creates a new Decoder reading from r.
 func NewDecoder(r io.Reader) *Decoder {
-	br, ok := r.(*bufio.Reader)
-	if !ok {
-		br = bufio.NewReaderSize(r, 4096)
-	}
-	return &Decoder{r: br}
+	return NewDecoderSize(r, 4096)
+}
+
+// NewDecoderSize is like NewDecoder, but reads from r through a buffer of
+// the given size instead of 4096 bytes, for example to save memory on
+// constrained devices. Longer lines are still read.
+func NewDecoderSize(r io.Reader, size int) *Decoder {
+	tr := &traceReader{r: r}
+	return &Decoder{r: bufio.NewReaderSize(tr, size), tr: tr}
 }
 
-// ReadLine reads a complete IMAP line (terminated by CRLF).
+// SetTrace sets a function that receives the data read from the
+// underlying reader, including data buffered ahead of what was parsed. A
+// nil fn disables tracing.
+func (d *Decoder) SetTrace(fn TraceFunc) {
+	d.tr.set(fn)
+}
+
+// ReadLine reads a complete IMAP line (terminated by CRLF). A line cut
+// short by an error other than io.EOF, such as a read timeout, is not
+// returned: the error is. Lines longer than MaxLineLength fail with a
+// *LineTooLongError; the rest of such a line is read and discarded
+// without being buffered, so that the next call reads the next line.
 func (d *Decoder) ReadLine() (string, error) {
 	var line []byte
 	for {
-		part, isPrefix, err := d.r.ReadLine()
-		if err != nil {
-			return "", err
-		}
+		part, err := d.r.ReadSlice('\n')
 		line = append(line, part...)
-		if !isPrefix {
-			break
+		if d.MaxLineLength > 0 && len(line) > d.MaxLineLength+len("\r\n") {
+			return "", d.discardLongLine(line, err == nil)
 		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return "", err
+		}
+		break
+	}
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if d.MaxLineLength > 0 && len(line) > d.MaxLineLength {
+		return "", d.discardLongLine(line, true)
 	}
 	return string(line), nil
 }
 
+// lineTailLength is the length of LineTooLongError.Tail.
+const lineTailLength = 64
+
+// LineTooLongError is the error of Decoder.ReadLine for a line longer than
+// MaxLineLength. It wraps ErrLineTooLong.
+type LineTooLongError struct {
+	// Head is the start of the line, up to MaxLineLength bytes, such as
+	// the tag of a command.
+	Head string
+	// Tail is the end of the line, without CRLF, such as the header of a
+	// literal ending it.
+	Tail string
+}
+
+func (e *LineTooLongError) Error() string {
+	return ErrLineTooLong.Error()
+}
+
+func (e *LineTooLongError) Unwrap() error {
+	return ErrLineTooLong
+}
+
+// discardLongLine reads the rest of a line longer than MaxLineLength, of
+// which line was read, and returns its LineTooLongError. done is true if
+// line is the whole line. Only the tail of the line is kept.
+func (d *Decoder) discardLongLine(line []byte, done bool) error {
+	e := &LineTooLongError{Head: string(line[:d.MaxLineLength])}
+	tail := keepTail(nil, line)
+	for !done {
+		part, err := d.r.ReadSlice('\n')
+		tail = keepTail(tail, part)
+		switch err {
+		case nil:
+			done = true
+		case bufio.ErrBufferFull:
+		default:
+			return err
+		}
+	}
+	tail = bytes.TrimSuffix(tail, []byte("\n"))
+	tail = bytes.TrimSuffix(tail, []byte("\r"))
+	e.Tail = string(tail)
+	return e
+}
+
+// keepTail appends b to tail and returns its last lineTailLength+2 bytes,
+// room for CRLF.
+func keepTail(tail, b []byte) []byte {
+	tail = append(tail, b...)
+	if n := len(tail) - (lineTailLength + 2); n > 0 {
+		tail = append(tail[:0], tail[n:]...)
+	}
+	return tail
+}
+
 // ReadAtom reads an atom (a sequence of non-special characters).
 func (d *Decoder) ReadAtom() (string, error) {
 	var buf bytes.Buffer
@@ -166,11 +251,35 @@ func (d *Decoder) ReadLiteralInfo() (*LiteralInfo, error) {
 }
 
 // ReadLiteral reads a literal value from the stream after the header has been parsed.
+// If the stream ends before size bytes, the reader fails with
+// io.ErrUnexpectedEOF rather than returning a truncated literal.
 func (d *Decoder) ReadLiteral(size int64) io.Reader {
-	return io.LimitReader(d.r, size)
+	return &literalReader{r: d.r, remaining: size}
+}
+
+// literalReader reads the data of a literal.
+type literalReader struct {
+	r         io.Reader
+	remaining int64
 }
 
-// ReadString reads either a quoted string, literal, or NIL.
+func (lr *literalReader) Read(p []byte) (int, error) {
+	if lr.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > lr.remaining {
+		p = p[:lr.remaining]
+	}
+	n, err := lr.r.Read(p)
+	lr.remaining -= int64(n)
+	if err == io.EOF && lr.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// ReadString reads a string: a quoted string or a literal. A literal8,
+// ~{n}, is accepted too, for the positions where RFC 3516 allows one.
 func (d *Decoder) ReadString() (string, error) {
 	b, err := d.r.Peek(1)
 	if err != nil {
@@ -181,24 +290,71 @@ func (d *Decoder) ReadString() (string, error) {
 	case '"':
 		return d.ReadQuotedString()
 	case '{', '~':
-		info, err := d.ReadLiteralInfo()
-		if err != nil {
-			return "", err
-		}
-		data := make([]byte, info.Size)
-		_, err = io.ReadFull(d.r, data)
-		if err != nil {
-			return "", err
-		}
-		return string(data), nil
+		return d.readLiteralString()
 	default:
-		return d.ReadAtom()
+		return "", fmt.Errorf("imap: expected string, got %q", b[0])
+	}
+}
+
+// readLiteralString reads a literal header and the literal data.
+func (d *Decoder) readLiteralString() (string, error) {
+	info, err := d.ReadLiteralInfo()
+	if err != nil {
+		return "", err
+	}
+	data := make([]byte, info.Size)
+	if _, err := io.ReadFull(d.r, data); err != nil {
+		return "", err
 	}
+	return string(data), nil
 }
 
-// ReadAString reads an astring (atom or string).
+// ReadAString reads an astring: a quoted string, a literal, or an atom
+// that may also contain ']' (ASTRING-CHAR). An atom must end at a space,
+// a closing parenthesis or the end of the line, so that a name such as
+// foo*bar is rejected rather than read as foo.
 func (d *Decoder) ReadAString() (string, error) {
-	return d.ReadString()
+	b, err := d.r.Peek(1)
+	if err != nil {
+		return "", err
+	}
+
+	switch b[0] {
+	case '"':
+		return d.ReadQuotedString()
+	case '{':
+		return d.readLiteralString()
+	}
+	s, err := d.readWhile(isAStringChar, "astring")
+	if err != nil {
+		return "", err
+	}
+	if b, err := d.r.Peek(1); err == nil {
+		switch b[0] {
+		case ' ', ')', '\r', '\n':
+		default:
+			return "", fmt.Errorf("imap: unexpected %q in astring", b[0])
+		}
+	}
+	return s, nil
+}
+
+// ReadMailbox reads a mailbox name, an astring. INBOX is case-insensitive
+// and returned in upper case, however it is written.
+func (d *Decoder) ReadMailbox() (string, error) {
+	name, err := d.ReadAString()
+	if err != nil {
+		return "", err
+	}
+	if strings.EqualFold(name, "INBOX") {
+		name = "INBOX"
+	}
+	return name, nil
+}
+
+// ReadTag reads a command tag: an atom that may contain ']' but not '+'.
+func (d *Decoder) ReadTag() (string, error) {
+	return d.readWhile(isTagChar, "tag")
 }
 
 // ReadNString reads a nstring (NIL or string). Returns empty string and false for NIL.
@@ -333,7 +489,7 @@ func (d *Decoder) ReadList(fn func() error) error {
 func (d *Decoder) ReadFlags() ([]string, error) {
 	var flags []string
 	err := d.ReadList(func() error {
-		flag, err := d.ReadAtom()
+		flag, err := d.ReadFlag()
 		if err != nil {
 			return err
 		}
@@ -343,10 +499,79 @@ func (d *Decoder) ReadFlags() ([]string, error) {
 	return flags, err
 }
 
-// DiscardLine discards the rest of the current line.
+// ReadFlag reads a flag: a keyword atom, a system flag such as \Seen, or
+// \* in PERMANENTFLAGS.
+func (d *Decoder) ReadFlag() (string, error) {
+	b, err := d.PeekByte()
+	if err != nil {
+		return "", err
+	}
+	if b != '\\' {
+		return d.ReadAtom()
+	}
+	_, _ = d.r.ReadByte()
+	if b, err := d.PeekByte(); err == nil && b == '*' {
+		_, _ = d.r.ReadByte()
+		return "\\*", nil
+	}
+	atom, err := d.ReadAtom()
+	if err != nil {
+		return "", fmt.Errorf("imap: expected flag: %w", err)
+	}
+	return "\\" + atom, nil
+}
+
+// ReadSequenceSet reads a sequence set or UID set such as "1:5,7,10:*" or
+// "$", without validating it. The result can be passed to
+// imap.ParseSeqSet or imap.ParseUIDSet.
+func (d *Decoder) ReadSequenceSet() (string, error) {
+	return d.readWhile(func(b byte) bool {
+		return (b >= '0' && b <= '9') || b == ':' || b == ',' || b == '*' || b == '$'
+	}, "sequence set")
+}
+
+// ReadListMailbox reads the mailbox pattern of LIST and LSUB: a string, or
+// an atom that may also contain the list wildcards '%' and '*' and ']'.
+func (d *Decoder) ReadListMailbox() (string, error) {
+	b, err := d.PeekByte()
+	if err != nil {
+		return "", err
+	}
+	if b == '"' || b == '{' || b == '~' {
+		return d.ReadString()
+	}
+	return d.readWhile(func(b byte) bool {
+		return isAtomChar(b) || b == '%' || b == '*' || b == ']'
+	}, "mailbox pattern")
+}
+
+// readWhile reads the bytes for which ok returns true. It fails if there
+// are none; what names the expected token in the error.
+func (d *Decoder) readWhile(ok func(b byte) bool, what string) (string, error) {
+	var buf bytes.Buffer
+	for {
+		b, err := d.r.Peek(1)
+		if err != nil || !ok(b[0]) {
+			break
+		}
+		_, _ = d.r.ReadByte()
+		buf.WriteByte(b[0])
+	}
+	if buf.Len() == 0 {
+		return "", fmt.Errorf("imap: expected %s", what)
+	}
+	return buf.String(), nil
+}
+
+// DiscardLine discards the rest of the current line, without buffering
+// it.
 func (d *Decoder) DiscardLine() error {
-	_, err := d.r.ReadBytes('\n')
-	return err
+	for {
+		_, err := d.r.ReadSlice('\n')
+		if err != bufio.ErrBufferFull {
+			return err
+		}
+	}
 }
 
 // DiscardN discards n bytes.
@@ -373,6 +598,31 @@ func isAtomChar(b byte) bool {
 	return true
 }
 
+// isAStringChar returns true if the byte is an ASTRING-CHAR: an atom
+// character or ']'.
+func isAStringChar(b byte) bool {
+	return isAtomChar(b) || b == ']'
+}
+
+// isTagChar returns true if the byte may appear in a tag: an ASTRING-CHAR
+// other than '+'.
+func isTagChar(b byte) bool {
+	return isAStringChar(b) && b != '+'
+}
+
+// ValidTag reports whether s is a valid command tag.
+func ValidTag(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isTagChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 // IsAtomSpecial returns true if the byte is an atom-special character.
 func IsAtomSpecial(b byte) bool {
 	return !isAtomChar(b)
@@ -1,9 +1,11 @@
 package wire
 
 import (
+	"errors"
 	"io"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func newDecoder(s string) *Decoder {
@@ -138,7 +140,7 @@ func TestReadString(t *testing.T) {
 		want    string
 		wantErr bool
 	}{
-		{name: "atom", input: "INBOX ", want: "INBOX"},
+		{name: "atom", input: "INBOX ", wantErr: true},
 		{name: "quoted", input: `"hello world"`, want: "hello world"},
 		{name: "literal", input: "{5}\r\nhello", want: "hello"},
 		{name: "empty quoted", input: `""`, want: ""},
@@ -173,10 +175,10 @@ func TestReadNString(t *testing.T) {
 		{name: "NIL lowercase", input: "nil ", want: "", wantOK: false},
 		{name: "NIL at EOF", input: "NIL", want: "", wantOK: false},
 		{name: "quoted string", input: `"hello"`, want: "hello", wantOK: true},
-		{name: "atom (not NIL)", input: "INBOX ", want: "INBOX", wantOK: true},
+		{name: "atom (not NIL)", input: "INBOX ", wantErr: true},
 		{name: "literal", input: "{3}\r\nfoo", want: "foo", wantOK: true},
-		{name: "NILS is not NIL", input: "NILS ", want: "NILS", wantOK: true},
-		{name: "NIL123 is not NIL", input: "NIL123 ", want: "NIL123", wantOK: true},
+		{name: "NILS is not NIL", input: "NILS ", wantErr: true},
+		{name: "NIL123 is not NIL", input: "NIL123 ", wantErr: true},
 	}
 
 	for _, tt := range tests {
@@ -396,6 +398,9 @@ func TestReadFlags(t *testing.T) {
 		{name: "empty flags", input: "()", want: nil},
 		{name: "single flag", input: "(FLAG1)", want: []string{"FLAG1"}},
 		{name: "multiple flags", input: "(FLAG1 FLAG2 FLAG3)", want: []string{"FLAG1", "FLAG2", "FLAG3"}},
+		{name: "system flags", input: "(\\Seen $Label1 \\Deleted)", want: []string{"\\Seen", "$Label1", "\\Deleted"}},
+		{name: "wildcard flag", input: "(\\Answered \\*)", want: []string{"\\Answered", "\\*"}},
+		{name: "lone backslash", input: "(\\)", wantErr: true},
 	}
 
 	for _, tt := range tests {
@@ -417,6 +422,67 @@ func TestReadFlags(t *testing.T) {
 	}
 }
 
+// ---------- ReadSequenceSet ----------
+
+func TestReadSequenceSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "single", input: "1 FLAGS", want: "1"},
+		{name: "ranges and star", input: "1:5,7,10:* (FLAGS)", want: "1:5,7,10:*"},
+		{name: "star", input: "*", want: "*"},
+		{name: "saved result", input: "$ FLAGS", want: "$"},
+		{name: "not a set", input: "FLAGS", wantErr: true},
+		{name: "empty", input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newDecoder(tt.input).ReadSequenceSet()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadSequenceSet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ReadSequenceSet() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// ---------- ReadListMailbox ----------
+
+func TestReadListMailbox(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "star", input: "*", want: "*"},
+		{name: "percent", input: "Archive/% ", want: "Archive/%"},
+		{name: "atom", input: "INBOX", want: "INBOX"},
+		{name: "quoted", input: `"My Folder/*"`, want: "My Folder/*"},
+		{name: "literal", input: "{3}\r\nA*B", want: "A*B"},
+		{name: "empty", input: "", wantErr: true},
+		{name: "paren", input: "(", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newDecoder(tt.input).ReadListMailbox()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadListMailbox() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ReadListMailbox() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 // ---------- PeekByte ----------
 
 func TestPeekByte(t *testing.T) {
@@ -497,6 +563,14 @@ func TestReadLine(t *testing.T) {
 	}
 }
 
+func TestReadLine_CutShort(t *testing.T) {
+	errTimeout := errors.New("i/o timeout")
+	d := NewDecoder(io.MultiReader(strings.NewReader("a1 NOO"), iotest.ErrReader(errTimeout)))
+	if got, err := d.ReadLine(); err != errTimeout {
+		t.Errorf("ReadLine() = %q, %v, want the read error", got, err)
+	}
+}
+
 // ---------- ExpectByte ----------
 
 func TestExpectByte(t *testing.T) {
@@ -688,6 +762,21 @@ func TestReadLiteral(t *testing.T) {
 	}
 }
 
+func TestReadLiteral_Truncated(t *testing.T) {
+	d := newDecoder("{10}\r\nhello")
+	info, err := d.ReadLiteralInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(d.ReadLiteral(info.Size))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("ReadAll() error = %v, want io.ErrUnexpectedEOF", err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("ReadLiteral returned %q, want %q", data, "hello")
+	}
+}
+
 // ---------- NewDecoder wraps existing bufio.Reader ----------
 
 func TestNewDecoderWithBufioReader(t *testing.T) {
@@ -719,14 +808,92 @@ func TestBuffered(t *testing.T) {
 // ---------- ReadAString ----------
 
 func TestReadAString(t *testing.T) {
-	// ReadAString delegates to ReadString, so test basic behavior
-	d := newDecoder(`"hello"`)
-	got, err := d.ReadAString()
-	if err != nil {
-		t.Fatal(err)
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "quoted", input: `"hello"`, want: "hello"},
+		{name: "atom", input: "INBOX ", want: "INBOX"},
+		{name: "resp-special", input: "foo]bar)", want: "foo]bar"},
+		{name: "literal", input: "{3}\r\nfoo", want: "foo"},
+		{name: "wildcard", input: "%", wantErr: true},
+		{name: "empty", input: " ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newDecoder(tt.input).ReadAString()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadAString() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ReadAString() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadMailbox(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "inbox", want: "INBOX"},
+		{input: `"InBox"`, want: "INBOX"},
+		{input: "Inbox/Sub", want: "Inbox/Sub"},
+		{input: "Archive]2024", want: "Archive]2024"},
+		{input: "Arch*", wantErr: true},
+		{input: "Arch) ", want: "Arch"},
+		{input: "*", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := newDecoder(tt.input).ReadMailbox()
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ReadMailbox(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ReadMailbox(%q) = %q, want %q", tt.input, got, tt.want)
+		}
 	}
-	if got != "hello" {
-		t.Errorf("ReadAString() = %q, want %q", got, "hello")
+}
+
+func TestReadTag(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "a001 NOOP", want: "a001"},
+		{input: "A]1 NOOP", want: "A]1"},
+		{input: "a+1 NOOP", want: "a"},
+		{input: "+ NOOP", wantErr: true},
+		{input: "* NOOP", wantErr: true},
+		{input: `"a" NOOP`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := newDecoder(tt.input).ReadTag()
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ReadTag(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ReadTag(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestValidTag(t *testing.T) {
+	for tag, want := range map[string]bool{
+		"a001": true, "A]1": true, "": false, "*": false, "+": false,
+		"a+1": false, "a%": false, "a(": false, "a\b": false, "é": false,
+	} {
+		if got := ValidTag(tag); got != want {
+			t.Errorf("ValidTag(%q) = %v, want %v", tag, got, want)
+		}
 	}
 }
 
@@ -772,3 +939,28 @@ func TestCombinedReads(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestReadLine_MaxLineLength(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	d := NewDecoderSize(strings.NewReader(long+"\r\nshort\r\n"+long), 16)
+	d.MaxLineLength = 99
+	_, err := d.ReadLine()
+	if !errors.Is(err, ErrLineTooLong) {
+		t.Fatalf("ReadLine() error = %v, want ErrLineTooLong", err)
+	}
+	var tooLong *LineTooLongError
+	if !errors.As(err, &tooLong) || len(tooLong.Head) != 99 || tooLong.Tail != long[:lineTailLength] {
+		t.Errorf("ReadLine() error = %#v, want the head and tail of the line", err)
+	}
+	if line, err := d.ReadLine(); err != nil || line != "short" {
+		t.Errorf("ReadLine() after a long line = %q, %v; want %q", line, err, "short")
+	}
+
+	d = NewDecoderSize(strings.NewReader(long+"\r\nshort\r\n"+long), 16)
+	d.MaxLineLength = 100
+	for _, want := range []string{long, "short", long} {
+		if line, err := d.ReadLine(); err != nil || line != want {
+			t.Errorf("ReadLine() = %q, %v; want %q", line, err, want)
+		}
+	}
+}
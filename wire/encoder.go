@@ -12,21 +12,37 @@ import (
 // Encoder writes IMAP protocol data to an io.Writer.
 // It provides a fluent API for building IMAP responses and commands.
 type Encoder struct {
-	w *bufio.Writer
+	w  *bufio.Writer
+	tw *traceWriter
 }
 
 // NewEncoder creates a new Encoder writing to w.
 func NewEncoder(w io.Writer) *Encoder {
-	bw, ok := w.(*bufio.Writer)
-	if !ok {
-		bw = bufio.NewWriterSize(w, 4096)
-	}
-	return &Encoder{w: bw}
+	return NewEncoderSize(w, 4096)
+}
+
+// NewEncoderSize is like NewEncoder, but buffers the data written to w in
+// a buffer of the given size instead of 4096 bytes.
+func NewEncoderSize(w io.Writer, size int) *Encoder {
+	tw := &traceWriter{w: w}
+	return &Encoder{w: bufio.NewWriterSize(tw, size), tw: tw}
+}
+
+// SetTrace sets a function that receives the data written to the
+// underlying writer as it is flushed. A nil fn disables tracing.
+func (e *Encoder) SetTrace(fn TraceFunc) {
+	e.tw.set(fn)
 }
 
 // Flush flushes buffered data to the underlying writer.
 func (e *Encoder) Flush() error {
-	return e.w.Flush()
+	if err := e.w.Flush(); err != nil {
+		return err
+	}
+	if bw, ok := e.tw.w.(*bufio.Writer); ok {
+		return bw.Flush()
+	}
+	return nil
 }
 
 // Raw writes raw bytes to the output.
@@ -183,9 +199,30 @@ func (e *Encoder) List(items []string) *Encoder {
 	return e
 }
 
-// Flags writes a parenthesized list of flags.
+// Flags writes a parenthesized list of flags. Flags are written as atoms,
+// such as $Forwarded, or as atoms preceded by a backslash, such as \Seen;
+// a flag that is neither, which the grammar does not allow, is written as
+// a string.
 func (e *Encoder) Flags(flags []string) *Encoder {
-	return e.List(flags)
+	_ = e.w.WriteByte('(')
+	for i, flag := range flags {
+		if i > 0 {
+			_ = e.w.WriteByte(' ')
+		}
+		if isFlag(flag) {
+			e.Atom(flag)
+		} else {
+			e.String(flag)
+		}
+	}
+	_ = e.w.WriteByte(')')
+	return e
+}
+
+// isFlag reports whether s can be written as a flag: an atom, an atom
+// preceded by a backslash, or \* in PERMANENTFLAGS.
+func isFlag(s string) bool {
+	return s == `\*` || !NeedsQuoting(strings.TrimPrefix(s, `\`))
 }
 
 // Date writes a date in DD-Mon-YYYY format.
@@ -262,8 +262,10 @@ func TestEncoderFlags(t *testing.T) {
 		want  string
 	}{
 		{"no flags", nil, "()"},
-		{"standard flags", []string{"\\Seen", "\\Answered"}, `("\\Seen" "\\Answered")`},
-		{"single flag", []string{"\\Flagged"}, `("\\Flagged")`},
+		{"standard flags", []string{"\\Seen", "\\Answered"}, `(\Seen \Answered)`},
+		{"single flag", []string{"\\Flagged"}, `(\Flagged)`},
+		{"keywords", []string{"$Forwarded", "\\*"}, `($Forwarded \*)`},
+		{"invalid flag", []string{"two words", "\\"}, `("two words" "\\")`},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
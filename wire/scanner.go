@@ -0,0 +1,190 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+// DefaultMaxLineLength is the line length limit of a Scanner whose
+// MaxLineLength is 0.
+const DefaultMaxLineLength = 64 * 1024
+
+// ErrLineTooLong is returned by Scanner.Feed when a line exceeds the
+// scanner's MaxLineLength, and wrapped by the LineTooLongError of
+// Decoder.ReadLine.
+var ErrLineTooLong = errors.New("imap: line too long")
+
+// TokenKind is the kind of a Token.
+type TokenKind int
+
+const (
+	// TokenLine is a complete line, including its CRLF.
+	TokenLine TokenKind = iota
+	// TokenLiteral is a chunk of literal data.
+	TokenLiteral
+)
+
+// Token is a piece of an IMAP stream found by a Scanner.
+type Token struct {
+	Kind TokenKind
+	// Data holds the raw bytes of the token. Data of a TokenLiteral
+	// aliases the slice passed to Feed.
+	Data []byte
+	// Tag is the first word of the message the token belongs to: a
+	// command tag, "*" or "+".
+	Tag string
+	// First reports whether the token is the first line of a message, as
+	// opposed to a line that continues a message after a literal.
+	First bool
+	// Literal is the literal announced at the end of a TokenLine, or nil.
+	Literal *LiteralInfo
+	// Final reports whether the token ends the message. It is set on
+	// lines that do not announce a literal.
+	Final bool
+}
+
+// Scanner splits a raw IMAP byte stream into lines and literals without
+// parsing the messages themselves, so that a proxy can relay traffic
+// unchanged while knowing where each command or response begins and ends.
+// It keeps its state between calls to Feed, so data may be fed in chunks
+// of any size as it arrives.
+//
+// A proxy typically forwards each token as is and only parses the first
+// line of the commands it needs to intercept, at which point the stream
+// is at a message boundary (see AtBoundary).
+type Scanner struct {
+	// MaxLineLength limits the length of a line, excluding literals. 0
+	// means DefaultMaxLineLength.
+	MaxLineLength int
+
+	line    []byte
+	literal int64
+	tag     string
+	inMsg   bool
+}
+
+// Feed consumes p and returns the tokens completed by it. Lines are
+// buffered until their CRLF has been seen; literal data is returned as
+// soon as it is fed. The returned tokens are valid until the next call to
+// Feed.
+func (s *Scanner) Feed(p []byte) ([]Token, error) {
+	var tokens []Token
+	for len(p) > 0 {
+		if s.literal > 0 {
+			n := int64(len(p))
+			if n > s.literal {
+				n = s.literal
+			}
+			s.literal -= n
+			tokens = append(tokens, Token{Kind: TokenLiteral, Data: p[:n], Tag: s.tag})
+			p = p[n:]
+			continue
+		}
+
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			if err := s.bufferLine(p); err != nil {
+				return tokens, err
+			}
+			break
+		}
+		if err := s.bufferLine(p[:i+1]); err != nil {
+			return tokens, err
+		}
+		p = p[i+1:]
+		tokens = append(tokens, s.endLine())
+	}
+	return tokens, nil
+}
+
+// AtBoundary reports whether the scanner is between two messages, that is
+// no partial line or literal of a message has been fed.
+func (s *Scanner) AtBoundary() bool {
+	return !s.inMsg && len(s.line) == 0
+}
+
+// PendingLiteral returns the number of bytes of the current literal that
+// have not been fed yet.
+func (s *Scanner) PendingLiteral() int64 {
+	return s.literal
+}
+
+// Reset discards any partial line or literal.
+func (s *Scanner) Reset() {
+	s.line = s.line[:0]
+	s.literal = 0
+	s.tag = ""
+	s.inMsg = false
+}
+
+func (s *Scanner) bufferLine(p []byte) error {
+	limit := s.MaxLineLength
+	if limit <= 0 {
+		limit = DefaultMaxLineLength
+	}
+	if len(s.line)+len(p) > limit {
+		return ErrLineTooLong
+	}
+	s.line = append(s.line, p...)
+	return nil
+}
+
+// endLine returns the buffered line as a token and updates the message
+// state.
+func (s *Scanner) endLine() Token {
+	data := make([]byte, len(s.line))
+	copy(data, s.line)
+	s.line = s.line[:0]
+
+	tok := Token{Kind: TokenLine, Data: data, First: !s.inMsg}
+	if tok.First {
+		tag := bytes.TrimRight(data, "\r\n")
+		if i := bytes.IndexByte(tag, ' '); i >= 0 {
+			tag = tag[:i]
+		}
+		s.tag = string(tag)
+	}
+	tok.Tag = s.tag
+
+	tok.Literal = trailingLiteral(data)
+	if tok.Literal != nil {
+		s.literal = tok.Literal.Size
+		s.inMsg = true
+	} else {
+		tok.Final = true
+		s.inMsg = false
+	}
+	return tok
+}
+
+// trailingLiteral parses a literal header such as {42}, {42+} or ~{42}
+// at the end of a line.
+func trailingLiteral(line []byte) *LiteralInfo {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if !bytes.HasSuffix(line, []byte("}")) {
+		return nil
+	}
+	open := bytes.LastIndexByte(line, '{')
+	if open < 0 {
+		return nil
+	}
+
+	info := &LiteralInfo{}
+	digits := line[open+1 : len(line)-1]
+	if bytes.HasSuffix(digits, []byte("+")) {
+		info.NonSync = true
+		digits = digits[:len(digits)-1]
+	}
+	if len(digits) == 0 {
+		return nil
+	}
+	size, err := strconv.ParseInt(string(digits), 10, 64)
+	if err != nil || size < 0 {
+		return nil
+	}
+	info.Size = size
+	info.Binary = open > 0 && line[open-1] == '~'
+	return info
+}
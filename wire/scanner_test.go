@@ -0,0 +1,134 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// scanAll feeds input to a Scanner in chunks of the given size and merges
+// adjacent literal chunks.
+func scanAll(t *testing.T, s *Scanner, input string, chunk int) []Token {
+	t.Helper()
+	var tokens []Token
+	for p := []byte(input); len(p) > 0; {
+		n := chunk
+		if n > len(p) {
+			n = len(p)
+		}
+		got, err := s.Feed(p[:n])
+		if err != nil {
+			t.Fatalf("Feed() error: %v", err)
+		}
+		for _, tok := range got {
+			tok.Data = append([]byte(nil), tok.Data...)
+			if last := len(tokens) - 1; tok.Kind == TokenLiteral && last >= 0 && tokens[last].Kind == TokenLiteral {
+				tokens[last].Data = append(tokens[last].Data, tok.Data...)
+				continue
+			}
+			tokens = append(tokens, tok)
+		}
+		p = p[n:]
+	}
+	return tokens
+}
+
+func TestScanner(t *testing.T) {
+	input := "A1 NOOP\r\n" +
+		"A2 APPEND INBOX {11+}\r\nhello\r\nyou ~{3}\r\nx\ny)\r\n" +
+		"A3 LOGIN {4}\r\nuser pass\r\n"
+
+	for _, chunk := range []int{1, 3, 7, len(input)} {
+		var s Scanner
+		tokens := scanAll(t, &s, input, chunk)
+
+		want := []struct {
+			kind    TokenKind
+			data    string
+			tag     string
+			first   bool
+			final   bool
+			literal int64
+		}{
+			{TokenLine, "A1 NOOP\r\n", "A1", true, true, -1},
+			{TokenLine, "A2 APPEND INBOX {11+}\r\n", "A2", true, false, 11},
+			{TokenLiteral, "hello\r\nyou ", "A2", false, false, -1},
+			{TokenLine, "~{3}\r\n", "A2", false, false, 3},
+			{TokenLiteral, "x\ny", "A2", false, false, -1},
+			{TokenLine, ")\r\n", "A2", false, true, -1},
+			{TokenLine, "A3 LOGIN {4}\r\n", "A3", true, false, 4},
+			{TokenLiteral, "user", "A3", false, false, -1},
+			{TokenLine, " pass\r\n", "A3", false, true, -1},
+		}
+		if len(tokens) != len(want) {
+			t.Fatalf("chunk %d: got %d tokens, want %d", chunk, len(tokens), len(want))
+		}
+		for i, w := range want {
+			tok := tokens[i]
+			if tok.Kind != w.kind || string(tok.Data) != w.data || tok.Tag != w.tag || tok.First != w.first || tok.Final != w.final {
+				t.Errorf("chunk %d: token %d = %+v (%q), want %+v", chunk, i, tok, tok.Data, w)
+			}
+			if w.literal < 0 {
+				if tok.Literal != nil {
+					t.Errorf("chunk %d: token %d Literal = %+v, want nil", chunk, i, tok.Literal)
+				}
+			} else if tok.Literal == nil || tok.Literal.Size != w.literal {
+				t.Errorf("chunk %d: token %d Literal = %+v, want size %d", chunk, i, tok.Literal, w.literal)
+			}
+		}
+		if !tokens[1].Literal.NonSync || !tokens[3].Literal.Binary {
+			t.Errorf("chunk %d: literal flags not detected", chunk)
+		}
+		if !s.AtBoundary() {
+			t.Errorf("chunk %d: AtBoundary() = false at end of input", chunk)
+		}
+
+		var relayed bytes.Buffer
+		for _, tok := range tokens {
+			relayed.Write(tok.Data)
+		}
+		if relayed.String() != input {
+			t.Errorf("chunk %d: relayed stream differs from input", chunk)
+		}
+	}
+}
+
+func TestScanner_Boundary(t *testing.T) {
+	var s Scanner
+	if !s.AtBoundary() {
+		t.Fatal("new scanner is not at a boundary")
+	}
+	if _, err := s.Feed([]byte("A1 APPEND INBOX {5}\r\nab")); err != nil {
+		t.Fatalf("Feed() error: %v", err)
+	}
+	if s.AtBoundary() {
+		t.Error("AtBoundary() = true inside a literal")
+	}
+	if got := s.PendingLiteral(); got != 3 {
+		t.Errorf("PendingLiteral() = %d, want 3", got)
+	}
+	if _, err := s.Feed([]byte("cde\r\nA2 NO")); err != nil {
+		t.Fatalf("Feed() error: %v", err)
+	}
+	if s.AtBoundary() {
+		t.Error("AtBoundary() = true with a partial line")
+	}
+
+	s.Reset()
+	if !s.AtBoundary() || s.PendingLiteral() != 0 {
+		t.Error("Reset() did not return to a boundary")
+	}
+}
+
+func TestScanner_LineTooLong(t *testing.T) {
+	s := Scanner{MaxLineLength: 16}
+	_, err := s.Feed([]byte(strings.Repeat("x", 10)))
+	if err != nil {
+		t.Fatalf("Feed() error: %v", err)
+	}
+	_, err = s.Feed([]byte(strings.Repeat("x", 10)))
+	if !errors.Is(err, ErrLineTooLong) {
+		t.Fatalf("Feed() error = %v, want ErrLineTooLong", err)
+	}
+}
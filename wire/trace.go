@@ -0,0 +1,78 @@
+package wire
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// Direction is the direction of traced protocol data.
+type Direction int
+
+const (
+	// DirectionRead is data read by a Decoder.
+	DirectionRead Direction = iota
+	// DirectionWrite is data written by an Encoder.
+	DirectionWrite
+)
+
+// String returns "read" or "write".
+func (d Direction) String() string {
+	if d == DirectionWrite {
+		return "write"
+	}
+	return "read"
+}
+
+// TraceFunc receives the bytes an Encoder writes to its writer or a Decoder
+// reads from its reader, in the order they are transferred, so that
+// protocol traces can be produced without a proxy. Data is passed in
+// chunks as they are flushed or read, which do not follow line boundaries.
+// data must not be retained after the call returns.
+type TraceFunc func(dir Direction, data []byte)
+
+// tracer holds the TraceFunc of an Encoder or Decoder. It may be changed
+// while another goroutine reads or writes.
+type tracer struct {
+	fn atomic.Pointer[TraceFunc]
+}
+
+func (t *tracer) set(fn TraceFunc) {
+	if fn == nil {
+		t.fn.Store(nil)
+		return
+	}
+	t.fn.Store(&fn)
+}
+
+func (t *tracer) trace(dir Direction, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	if fn := t.fn.Load(); fn != nil {
+		(*fn)(dir, data)
+	}
+}
+
+// traceWriter passes the data written to w to its tracer.
+type traceWriter struct {
+	tracer
+	w io.Writer
+}
+
+func (t *traceWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	t.trace(DirectionWrite, p[:n])
+	return n, err
+}
+
+// traceReader passes the data read from r to its tracer.
+type traceReader struct {
+	tracer
+	r io.Reader
+}
+
+func (t *traceReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.trace(DirectionRead, p[:n])
+	return n, err
+}
@@ -0,0 +1,56 @@
+package wire
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEncoder_SetTrace(t *testing.T) {
+	var out, traced bytes.Buffer
+	enc := NewEncoder(&out)
+	enc.SetTrace(func(dir Direction, data []byte) {
+		if dir != DirectionWrite {
+			t.Errorf("dir = %v, want write", dir)
+		}
+		traced.Write(data)
+	})
+
+	enc.Atom("A1").SP().Atom("NOOP").CRLF()
+	if traced.Len() != 0 {
+		t.Errorf("traced %q before Flush", traced.String())
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Flush() error: %v", err)
+	}
+	if traced.String() != "A1 NOOP\r\n" || out.String() != traced.String() {
+		t.Errorf("traced %q, wrote %q", traced.String(), out.String())
+	}
+
+	enc.SetTrace(nil)
+	enc.Atom("A2").CRLF()
+	_ = enc.Flush()
+	if traced.String() != "A1 NOOP\r\n" {
+		t.Errorf("traced %q after SetTrace(nil)", traced.String())
+	}
+}
+
+func TestDecoder_SetTrace(t *testing.T) {
+	var traced bytes.Buffer
+	dec := NewDecoder(strings.NewReader("* OK ready\r\n* 1 EXISTS\r\n"))
+	dec.SetTrace(func(dir Direction, data []byte) {
+		if dir != DirectionRead {
+			t.Errorf("dir = %v, want read", dir)
+		}
+		traced.Write(data)
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := dec.ReadLine(); err != nil {
+			t.Fatalf("ReadLine() error: %v", err)
+		}
+	}
+	if traced.String() != "* OK ready\r\n* 1 EXISTS\r\n" {
+		t.Errorf("traced %q", traced.String())
+	}
+}